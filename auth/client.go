@@ -5,38 +5,67 @@ package auth
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"crypto/tls"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"sync"
 	"time"
+
+	"github.com/houzhh15/sdp-common/backoff"
+	"github.com/houzhh15/sdp-common/device"
+	"github.com/houzhh15/sdp-common/egress"
+	"github.com/houzhh15/sdp-common/tunnel"
 )
 
+// ErrReauthRequired is returned by Refresh when the Controller reports
+// SESSION_LIFETIME_EXCEEDED: the session can no longer be refreshed and
+// a new Handshake is required.
+var ErrReauthRequired = errors.New("session lifetime exceeded: re-handshake required")
+
 // Client handles SDP authentication with Controller
 // This is the standard implementation for IH and AH clients
 type Client struct {
-	httpClient      *http.Client
-	controllerURL   string
-	certFingerprint string
+	controllerURL string
+	endpoints     Endpoints
 
-	mu           sync.RWMutex
-	token        string
-	expiresAt    time.Time
-	refreshTimer *time.Timer
-	stopChan     chan struct{}
+	mu              sync.RWMutex
+	httpClient      *http.Client // replaced by RotateCertificate
+	certFingerprint string
+	token           string
+	expiresAt       time.Time
+	clockSkew       time.Duration // Controller time minus local time, from server_time
+	refreshTimer    *time.Timer
+	refreshBackoff  *backoff.Backoff // delays between failed refresh attempts, reset on success
+	stopChan        chan struct{}
+
+	handshakeRetry backoff.Config
+
+	capabilities     tunnel.Capabilities // advertised in HandshakeRequest
+	peerCapabilities tunnel.Capabilities // reported by the Controller in the last handshake
+
+	// Posture hash of the device reported at handshake, sent in DevicePostureHeader
+	postureHash string
+
+	// Opt-in telemetry (nil when disabled)
+	telemetry      *TelemetryConfig
+	errorCounts    map[string]int64
+	telemetryTimer *time.Timer
+
+	// Last tunnel list, its ETag and the token it was fetched with, for conditional ListTunnels requests
+	tunnelsETag  string
+	tunnelsToken string
+	tunnels      []*tunnel.Tunnel
 }
 
-// DeviceInfo contains device information for authentication
-type DeviceInfo struct {
-	DeviceID   string            `json:"device_id"`
-	OS         string            `json:"os"`
-	OSVersion  string            `json:"os_version"`
-	Hostname   string            `json:"hostname,omitempty"`
-	Compliance bool              `json:"compliance"`
-	Attributes map[string]string `json:"attributes,omitempty"`
-}
+// DeviceInfo contains device information for authentication.
+// It is the shared device.Info, stored on the session and used for policy evaluation as is
+type DeviceInfo = device.Info
 
 // HandshakeRequest is the request body for authentication
 type HandshakeRequest struct {
@@ -44,31 +73,159 @@ type HandshakeRequest struct {
 	DeviceInfo      DeviceInfo `json:"device_info"`
 	Username        string     `json:"username,omitempty"`
 	Password        string     `json:"password,omitempty"`
+	// Capabilities optional features the client implements (see tunnel.Capability*)
+	Capabilities tunnel.Capabilities `json:"capabilities,omitempty"`
+}
+
+// Limits applied to DeviceInfo by HandshakeRequest.Validate
+const (
+	MaxDeviceFieldLength = device.MaxFieldLength
+	MaxDeviceAttributes  = device.MaxAttributes
+)
+
+// Validate checks the request as the Controller does before accepting it.
+// DeviceInfo is optional; when present, DeviceID and OS are required and
+// fields are bounded by MaxDeviceFieldLength / MaxDeviceAttributes.
+func (r *HandshakeRequest) Validate() error {
+	if r.DeviceInfo.IsZero() {
+		return nil
+	}
+	return r.DeviceInfo.Validate()
 }
 
 // HandshakeResponse is the response from authentication
 type HandshakeResponse struct {
-	Token     string                 `json:"token"`
-	ExpiresAt time.Time              `json:"expires_at"`
-	Message   string                 `json:"message,omitempty"`
-	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+	Token      string                 `json:"token"`
+	ExpiresAt  time.Time              `json:"expires_at"`
+	ServerTime time.Time              `json:"server_time,omitempty"` // Controller clock when the response was built
+	Message    string                 `json:"message,omitempty"`
+	Metadata   map[string]interface{} `json:"metadata,omitempty"`
+	// DataPlaneAddrs data plane addresses advertised by the Controller, in order of preference
+	DataPlaneAddrs []string `json:"dataplane_addrs,omitempty"`
+	// Capabilities optional features the Controller supports; nil from Controllers
+	// that predate capability advertisement (see tunnel.Capabilities.Supports)
+	Capabilities tunnel.Capabilities `json:"capabilities,omitempty"`
+}
+
+// TransferResponse is the response to RequestTransfer
+type TransferResponse struct {
+	Code      string    `json:"code"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// TransferRedeemRequest is the request body sent by the new device to redeem a transfer code
+type TransferRedeemRequest struct {
+	Code            string     `json:"code"`
+	CertFingerprint string     `json:"cert_fingerprint"`
+	DeviceInfo      DeviceInfo `json:"device_info"`
+}
+
+// Validate checks the request as the Controller does before accepting it
+func (r *TransferRedeemRequest) Validate() error {
+	if r.Code == "" {
+		return fmt.Errorf("code is required")
+	}
+	if r.DeviceInfo.IsZero() {
+		return nil
+	}
+	return r.DeviceInfo.Validate()
+}
+
+// TransferredTunnel is a tunnel of the old device re-created for the new device
+type TransferredTunnel struct {
+	TunnelID         string          `json:"tunnel_id"`
+	PreviousTunnelID string          `json:"previous_tunnel_id"`
+	ServiceID        string          `json:"service_id"`
+	TargetHost       string          `json:"target_host,omitempty"`
+	TargetPort       int             `json:"target_port,omitempty"`
+	Multiplex        bool            `json:"multiplex,omitempty"`
+	Obfuscate        bool            `json:"obfuscate,omitempty"`
+	ExpiresAt        time.Time       `json:"expires_at,omitempty"`
+	Credentials      json.RawMessage `json:"credentials,omitempty"`
+}
+
+// SkippedTunnel is a tunnel of the old device that was not re-created (e.g. denied by policy)
+type SkippedTunnel struct {
+	PreviousTunnelID string `json:"previous_tunnel_id"`
+	ServiceID        string `json:"service_id"`
+	Reason           string `json:"reason"`
+}
+
+// TransferRedeemResponse is the response to RedeemTransfer: a new session for
+// the new device plus the outcome for each tunnel of the old session
+type TransferRedeemResponse struct {
+	HandshakeResponse
+	Tunnels []TransferredTunnel `json:"tunnels"`
+	Skipped []SkippedTunnel     `json:"skipped,omitempty"`
+}
+
+// RotateResponse is the response from certificate rotation
+type RotateResponse struct {
+	Fingerprint         string    `json:"fingerprint"`
+	PreviousFingerprint string    `json:"previous_fingerprint"`
+	OverlapUntil        time.Time `json:"overlap_until"`
+	SessionsRebound     int       `json:"sessions_rebound"`
 }
 
 // RefreshResponse is the response from token refresh
 type RefreshResponse struct {
-	Token     string    `json:"token"`
-	ExpiresAt time.Time `json:"expires_at"`
+	Token      string    `json:"token"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	ServerTime time.Time `json:"server_time,omitempty"`
+}
+
+// Default Controller auth API paths (canonical; the Controller also serves
+// the legacy /api/v1/handshake, /api/v1/sessions/refresh aliases)
+const (
+	DefaultHandshakePath = "/api/v1/auth/handshake"
+	DefaultRefreshPath   = "/api/v1/auth/refresh"
+	DefaultRevokePath    = "/api/v1/auth/revoke"
+
+	// Session transfer between devices of the same identity (not affected by Endpoints)
+	DefaultTransferPath       = "/api/v1/auth/transfer"
+	DefaultTransferRedeemPath = "/api/v1/auth/transfer/redeem"
+
+	// Tunnel list of the session's client (not affected by Endpoints)
+	DefaultTunnelsPath = "/api/v1/tunnels"
+)
+
+// Endpoints are the Controller auth API paths, relative to ControllerURL.
+// Empty fields use the Default*Path constants. Revoke is sent as POST with
+// the token in the Authorization header.
+type Endpoints struct {
+	Handshake string
+	Refresh   string
+	Revoke    string
+}
+
+// withDefaults fills empty paths with the canonical defaults
+func (e Endpoints) withDefaults() Endpoints {
+	if e.Handshake == "" {
+		e.Handshake = DefaultHandshakePath
+	}
+	if e.Refresh == "" {
+		e.Refresh = DefaultRefreshPath
+	}
+	if e.Revoke == "" {
+		e.Revoke = DefaultRevokePath
+	}
+	return e
 }
 
 // Config contains configuration for auth client
 type Config struct {
-	ControllerURL   string        // Controller API base URL (e.g., https://controller:8443)
-	TLSConfig       *tls.Config   // TLS configuration for mTLS
-	CertFingerprint string        // Client certificate fingerprint
-	Timeout         time.Duration // HTTP timeout (default: 30s)
-	RetryAttempts   int           // Retry attempts for handshake (default: 3)
-	RetryInterval   time.Duration // Interval between retries (default: 5s)
-	RefreshBefore   time.Duration // Refresh token before expiry (default: 5min)
+	ControllerURL   string           // Controller API base URL (e.g., https://controller:8443)
+	TLSConfig       *tls.Config      // TLS configuration for mTLS
+	CertFingerprint string           // Client certificate fingerprint
+	Timeout         time.Duration    // HTTP timeout (default: 30s)
+	RetryAttempts   int              // Handshake attempts including the first (default: 3)
+	RetryInterval   time.Duration    // Initial backoff between handshake attempts, doubled each retry (default: 5s)
+	RefreshBefore   time.Duration    // Refresh token before expiry (default: 5min)
+	Telemetry       *TelemetryConfig // Opt-in usage statistics reporting (default: disabled)
+	Proxy           *egress.Config   // Outbound proxy (default: HTTPS_PROXY / NO_PROXY)
+	Endpoints       Endpoints        // Auth API paths (default: /api/v1/auth/*)
+	// Capabilities advertised to the Controller in the handshake (default: tunnel.DefaultCapabilities())
+	Capabilities tunnel.Capabilities
 }
 
 // NewClient creates a new authentication client
@@ -85,28 +242,47 @@ func NewClient(config *Config) *Client {
 	if config.RefreshBefore == 0 {
 		config.RefreshBefore = 5 * time.Minute
 	}
+	if config.Telemetry != nil && config.Telemetry.Interval == 0 {
+		config.Telemetry.Interval = time.Hour
+	}
+	if config.Capabilities == nil {
+		config.Capabilities = tunnel.DefaultCapabilities()
+	}
 
 	return &Client{
 		httpClient: &http.Client{
 			Transport: &http.Transport{
 				TLSClientConfig: config.TLSConfig,
+				Proxy:           config.Proxy.ProxyFunc(),
 			},
 			Timeout: config.Timeout,
 		},
 		controllerURL:   config.ControllerURL,
+		endpoints:       config.Endpoints.withDefaults(),
 		certFingerprint: config.CertFingerprint,
-		stopChan:        make(chan struct{}),
+		refreshBackoff: backoff.New(&backoff.Config{
+			InitialInterval: time.Minute,
+			MaxInterval:     5 * time.Minute,
+		}),
+		stopChan:     make(chan struct{}),
+		telemetry:    config.Telemetry,
+		capabilities: config.Capabilities,
+		handshakeRetry: backoff.Config{
+			InitialInterval: config.RetryInterval,
+			MaxAttempts:     config.RetryAttempts,
+		},
 	}
 }
 
 // Handshake performs initial authentication with Controller
-// Implements automatic retry with exponential backoff
+// Retries up to Config.RetryAttempts times with jittered exponential backoff
 func (c *Client) Handshake(ctx context.Context, deviceInfo DeviceInfo, username, password string) (*HandshakeResponse, error) {
 	reqBody := HandshakeRequest{
-		CertFingerprint: c.certFingerprint,
+		CertFingerprint: c.CertFingerprint(),
 		DeviceInfo:      deviceInfo,
 		Username:        username,
 		Password:        password,
+		Capabilities:    c.capabilities,
 	}
 
 	bodyBytes, err := json.Marshal(reqBody)
@@ -114,40 +290,39 @@ func (c *Client) Handshake(ctx context.Context, deviceInfo DeviceInfo, username,
 		return nil, fmt.Errorf("marshal request: %w", err)
 	}
 
-	// Retry logic with exponential backoff
-	var lastErr error
-	retryInterval := 5 * time.Second
-
-	for attempt := 1; attempt <= 3; attempt++ {
-		resp, err := c.doHandshake(ctx, bodyBytes)
-		if err == nil {
-			// Success - store token and start auto-refresh
-			c.mu.Lock()
-			c.token = resp.Token
-			c.expiresAt = resp.ExpiresAt
-			c.mu.Unlock()
-
-			c.startAutoRefresh()
-			return resp, nil
+	var resp *HandshakeResponse
+	err = backoff.Retry(ctx, &c.handshakeRetry, func(ctx context.Context) error {
+		r, err := c.doHandshake(ctx, bodyBytes)
+		if err != nil {
+			c.RecordError("handshake")
+			return err
 		}
-
-		lastErr = err
-		if attempt < 3 {
-			select {
-			case <-ctx.Done():
-				return nil, fmt.Errorf("handshake cancelled: %w", ctx.Err())
-			case <-time.After(retryInterval):
-				retryInterval *= 2 // Exponential backoff
-			}
+		resp = r
+		return nil
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("handshake cancelled: %w", ctx.Err())
 		}
+		return nil, fmt.Errorf("handshake failed after %d attempts: %w", c.handshakeRetry.MaxAttempts, err)
 	}
 
-	return nil, fmt.Errorf("handshake failed after 3 attempts: %w", lastErr)
+	// Success - store token and start auto-refresh
+	c.mu.Lock()
+	c.token = resp.Token
+	c.expiresAt = resp.ExpiresAt
+	c.peerCapabilities = resp.Capabilities
+	c.postureHash = handshakePostureHash(&deviceInfo)
+	c.mu.Unlock()
+
+	c.startAutoRefresh()
+	c.startTelemetry()
+	return resp, nil
 }
 
 // doHandshake performs a single handshake attempt
 func (c *Client) doHandshake(ctx context.Context, bodyBytes []byte) (*HandshakeResponse, error) {
-	url := c.controllerURL + "/api/v1/auth/handshake"
+	url := c.controllerURL + c.endpoints.Handshake
 
 	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(bodyBytes))
 	if err != nil {
@@ -155,7 +330,8 @@ func (c *Client) doHandshake(ctx context.Context, bodyBytes []byte) (*HandshakeR
 	}
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := c.httpClient.Do(req)
+	sentAt := time.Now()
+	resp, err := c.client().Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("send request: %w", err)
 	}
@@ -174,6 +350,7 @@ func (c *Client) doHandshake(ctx context.Context, bodyBytes []byte) (*HandshakeR
 	if err := json.Unmarshal(body, &handshakeResp); err != nil {
 		return nil, fmt.Errorf("parse response: %w", err)
 	}
+	c.updateClockSkew(handshakeResp.ServerTime, sentAt, time.Now())
 
 	return &handshakeResp, nil
 }
@@ -188,15 +365,16 @@ func (c *Client) Refresh(ctx context.Context) (*RefreshResponse, error) {
 		return nil, fmt.Errorf("no token to refresh")
 	}
 
-	url := c.controllerURL + "/api/v1/auth/refresh"
+	url := c.controllerURL + c.endpoints.Refresh
 
 	req, err := http.NewRequestWithContext(ctx, "POST", url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
-	req.Header.Set("Authorization", "Bearer "+oldToken)
+	c.authorize(req, oldToken)
 
-	resp, err := c.httpClient.Do(req)
+	sentAt := time.Now()
+	resp, err := c.client().Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("send request: %w", err)
 	}
@@ -208,6 +386,15 @@ func (c *Client) Refresh(ctx context.Context) (*RefreshResponse, error) {
 	}
 
 	if resp.StatusCode != http.StatusOK {
+		var errResp struct {
+			Code string `json:"code"`
+		}
+		if json.Unmarshal(body, &errResp) == nil && errResp.Code == "SESSION_LIFETIME_EXCEEDED" {
+			return nil, ErrReauthRequired
+		}
+		if isPostureDrift(body) {
+			return nil, ErrPostureDrift
+		}
 		return nil, fmt.Errorf("refresh failed (status %d): %s", resp.StatusCode, string(body))
 	}
 
@@ -215,6 +402,7 @@ func (c *Client) Refresh(ctx context.Context) (*RefreshResponse, error) {
 	if err := json.Unmarshal(body, &refreshResp); err != nil {
 		return nil, fmt.Errorf("parse response: %w", err)
 	}
+	c.updateClockSkew(refreshResp.ServerTime, sentAt, time.Now())
 
 	// Update token
 	c.mu.Lock()
@@ -235,15 +423,15 @@ func (c *Client) Revoke(ctx context.Context) error {
 		return nil // Nothing to revoke
 	}
 
-	url := c.controllerURL + "/api/v1/auth/revoke"
+	url := c.controllerURL + c.endpoints.Revoke
 
 	req, err := http.NewRequestWithContext(ctx, "POST", url, nil)
 	if err != nil {
 		return fmt.Errorf("create request: %w", err)
 	}
-	req.Header.Set("Authorization", "Bearer "+token)
+	c.authorize(req, token)
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.client().Do(req)
 	if err != nil {
 		return fmt.Errorf("send request: %w", err)
 	}
@@ -263,6 +451,259 @@ func (c *Client) Revoke(ctx context.Context) error {
 	return nil
 }
 
+// RequestTransfer asks the Controller for a one-time code that moves the
+// current session to another device of the same identity. The code is
+// short-lived; redeeming it on the new device (RedeemTransfer) revokes this
+// session and its tunnels.
+func (c *Client) RequestTransfer(ctx context.Context) (*TransferResponse, error) {
+	c.mu.RLock()
+	token := c.token
+	c.mu.RUnlock()
+
+	if token == "" {
+		return nil, fmt.Errorf("no session: handshake first")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.controllerURL+DefaultTransferPath, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	c.authorize(req, token)
+
+	resp, err := c.client().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("transfer request failed (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var transferResp TransferResponse
+	if err := json.Unmarshal(body, &transferResp); err != nil {
+		return nil, fmt.Errorf("parse response: %w", err)
+	}
+	return &transferResp, nil
+}
+
+// RedeemTransfer redeems a transfer code obtained on another device, instead
+// of Handshake. The request is sent over mTLS with this client's certificate,
+// which must carry the same identity as the old device. On success the new
+// session is stored and auto-refresh starts like after Handshake; tunnels
+// allowed by policy for this device are listed in the response.
+func (c *Client) RedeemTransfer(ctx context.Context, code string, deviceInfo DeviceInfo) (*TransferRedeemResponse, error) {
+	reqBody := TransferRedeemRequest{
+		Code:            code,
+		CertFingerprint: c.CertFingerprint(),
+		DeviceInfo:      deviceInfo,
+	}
+	if err := reqBody.Validate(); err != nil {
+		return nil, err
+	}
+
+	bodyBytes, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.controllerURL+DefaultTransferRedeemPath, bytes.NewReader(bodyBytes))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	sentAt := time.Now()
+	resp, err := c.client().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("transfer redeem failed (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var redeemResp TransferRedeemResponse
+	if err := json.Unmarshal(body, &redeemResp); err != nil {
+		return nil, fmt.Errorf("parse response: %w", err)
+	}
+	c.updateClockSkew(redeemResp.ServerTime, sentAt, time.Now())
+
+	c.mu.Lock()
+	c.token = redeemResp.Token
+	c.expiresAt = redeemResp.ExpiresAt
+	c.peerCapabilities = redeemResp.Capabilities
+	c.postureHash = handshakePostureHash(&deviceInfo)
+	c.mu.Unlock()
+
+	c.startAutoRefresh()
+	c.startTelemetry()
+	return &redeemResp, nil
+}
+
+// RotateCertificate replaces the client certificate without re-authenticating.
+// The request is sent over mTLS with the current certificate; on success the
+// Controller links both fingerprints for an overlap window and rebinds the
+// session, so the token and existing tunnels stay valid. Subsequent requests
+// use newCert.
+func (c *Client) RotateCertificate(ctx context.Context, newCert tls.Certificate) (*RotateResponse, error) {
+	c.mu.RLock()
+	token := c.token
+	c.mu.RUnlock()
+
+	if token == "" {
+		return nil, fmt.Errorf("no session: handshake first")
+	}
+	if len(newCert.Certificate) == 0 {
+		return nil, fmt.Errorf("certificate is empty")
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: newCert.Certificate[0]})
+	bodyBytes, err := json.Marshal(map[string]string{"cert_pem": string(certPEM)})
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+
+	url := c.controllerURL + "/api/v1/certs/rotate"
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(bodyBytes))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	c.authorize(req, token)
+
+	oldClient := c.client()
+	resp, err := oldClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("rotate failed (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var rotateResp RotateResponse
+	if err := json.Unmarshal(body, &rotateResp); err != nil {
+		return nil, fmt.Errorf("parse response: %w", err)
+	}
+
+	// Switch to the new certificate for subsequent connections (proxy settings are kept)
+	transport := &http.Transport{}
+	if oldTransport, ok := oldClient.Transport.(*http.Transport); ok {
+		transport = oldTransport.Clone()
+	}
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+	transport.TLSClientConfig.Certificates = []tls.Certificate{newCert}
+	transport.TLSClientConfig.GetClientCertificate = nil
+
+	hash := sha256.Sum256(newCert.Certificate[0])
+	c.mu.Lock()
+	c.httpClient = &http.Client{
+		Transport: transport,
+		Timeout:   oldClient.Timeout,
+	}
+	c.certFingerprint = "sha256:" + hex.EncodeToString(hash[:])
+	c.mu.Unlock()
+	oldClient.CloseIdleConnections()
+
+	return &rotateResp, nil
+}
+
+// CertFingerprint returns the fingerprint of the certificate in use
+func (c *Client) CertFingerprint() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.certFingerprint
+}
+
+// ListTunnels returns the tunnels of the session's client. The request is
+// conditional: when nothing changed since the last call with the same token,
+// the Controller answers 304 and the previous list is returned.
+func (c *Client) ListTunnels(ctx context.Context) ([]*tunnel.Tunnel, error) {
+	c.mu.RLock()
+	token := c.token
+	etag := ""
+	if c.tunnelsToken == token {
+		etag = c.tunnelsETag
+	}
+	c.mu.RUnlock()
+
+	if token == "" {
+		return nil, fmt.Errorf("no session: handshake first")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", c.controllerURL+DefaultTunnelsPath, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	c.authorize(req, token)
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	resp, err := c.client().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+
+	if resp.StatusCode == http.StatusNotModified && etag != "" {
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+		return append([]*tunnel.Tunnel(nil), c.tunnels...), nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("list tunnels failed (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var listResp struct {
+		Tunnels []*tunnel.Tunnel `json:"tunnels"`
+	}
+	if err := json.Unmarshal(body, &listResp); err != nil {
+		return nil, fmt.Errorf("parse response: %w", err)
+	}
+
+	c.mu.Lock()
+	c.tunnels = listResp.Tunnels
+	c.tunnelsETag = resp.Header.Get("ETag")
+	c.tunnelsToken = token
+	c.mu.Unlock()
+
+	return append([]*tunnel.Tunnel(nil), listResp.Tunnels...), nil
+}
+
+// client returns the HTTP client for the current certificate
+func (c *Client) client() *http.Client {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.httpClient
+}
+
 // GetToken returns the current token
 func (c *Client) GetToken() string {
 	c.mu.RLock()
@@ -285,7 +726,38 @@ func (c *Client) IsValid() bool {
 	if c.token == "" {
 		return false
 	}
-	return time.Now().Before(c.expiresAt)
+	return time.Now().Add(c.clockSkew).Before(c.expiresAt)
+}
+
+// PeerCapabilities returns the capabilities the Controller reported in the last
+// handshake (or transfer redeem). nil before the first handshake or when the
+// Controller does not advertise them; use Supports to decide whether to request
+// an optional feature, e.g. PeerCapabilities().Supports(tunnel.CapabilityMux)
+func (c *Client) PeerCapabilities() tunnel.Capabilities {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.peerCapabilities
+}
+
+// ClockSkew returns the estimated offset of the Controller clock from the local
+// clock (positive when the Controller is ahead), measured from server_time in
+// the last handshake or refresh response. Expiry checks and refresh scheduling
+// compensate for it; zero if the Controller does not report server_time
+func (c *Client) ClockSkew() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.clockSkew
+}
+
+// updateClockSkew estimates the skew against the midpoint of the request round trip
+func (c *Client) updateClockSkew(serverTime, sentAt, receivedAt time.Time) {
+	if serverTime.IsZero() {
+		return
+	}
+	midpoint := sentAt.Add(receivedAt.Sub(sentAt) / 2)
+	c.mu.Lock()
+	c.clockSkew = serverTime.Sub(midpoint)
+	c.mu.Unlock()
 }
 
 // startAutoRefresh starts automatic token refresh
@@ -293,14 +765,15 @@ func (c *Client) startAutoRefresh() {
 	c.mu.Lock()
 	expiresAt := c.expiresAt
 
-	// Calculate refresh time (5 minutes before expiry)
-	refreshAt := expiresAt.Add(-5 * time.Minute)
+	// Calculate refresh time (5 minutes before expiry), converted from Controller time to local time
+	refreshAt := expiresAt.Add(-5 * time.Minute).Add(-c.clockSkew)
 	duration := time.Until(refreshAt)
 
 	// If already expired or will expire very soon, refresh immediately
 	if duration < 0 {
 		duration = 0
 	}
+	c.refreshBackoff.Reset()
 
 	// Stop existing timer if any
 	if c.refreshTimer != nil {
@@ -319,8 +792,11 @@ func (c *Client) startAutoRefresh() {
 		defer cancel()
 
 		if _, err := c.Refresh(ctx); err != nil {
-			// Retry after 1 minute
-			c.scheduleRetryRefresh(1 * time.Minute)
+			c.RecordError("refresh")
+			if errors.Is(err, ErrReauthRequired) || errors.Is(err, ErrPostureDrift) {
+				return // Refreshing can no longer succeed, caller must Handshake again
+			}
+			c.scheduleRetryRefresh()
 		} else {
 			// Schedule next refresh
 			c.startAutoRefresh()
@@ -329,12 +805,14 @@ func (c *Client) startAutoRefresh() {
 	c.mu.Unlock()
 }
 
-// scheduleRetryRefresh schedules a retry for token refresh with exponential backoff
-func (c *Client) scheduleRetryRefresh(after time.Duration) {
+// scheduleRetryRefresh schedules a retry for token refresh with jittered
+// exponential backoff (1 minute, capped at 5 minutes)
+func (c *Client) scheduleRetryRefresh() {
 	c.mu.Lock()
 	if c.refreshTimer != nil {
 		c.refreshTimer.Stop()
 	}
+	after, _ := c.refreshBackoff.Next()
 
 	c.refreshTimer = time.AfterFunc(after, func() {
 		// Check if stopped
@@ -348,12 +826,11 @@ func (c *Client) scheduleRetryRefresh(after time.Duration) {
 		defer cancel()
 
 		if _, err := c.Refresh(ctx); err != nil {
-			// Continue retrying with exponential backoff (max 5 minutes)
-			nextRetry := after * 2
-			if nextRetry > 5*time.Minute {
-				nextRetry = 5 * time.Minute
+			c.RecordError("refresh")
+			if errors.Is(err, ErrReauthRequired) || errors.Is(err, ErrPostureDrift) {
+				return
 			}
-			c.scheduleRetryRefresh(nextRetry)
+			c.scheduleRetryRefresh()
 		} else {
 			// Success - schedule normal refresh
 			c.startAutoRefresh()
@@ -368,6 +845,9 @@ func (c *Client) Stop() {
 	if c.refreshTimer != nil {
 		c.refreshTimer.Stop()
 	}
+	if c.telemetryTimer != nil {
+		c.telemetryTimer.Stop()
+	}
 	c.mu.Unlock()
 
 	close(c.stopChan)
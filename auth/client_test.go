@@ -3,10 +3,18 @@ package auth
 import (
 	"context"
 	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/houzhh15/sdp-common/tunnel"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNewClient(t *testing.T) {
@@ -132,6 +140,26 @@ func TestHandshakeRequest(t *testing.T) {
 	assert.Equal(t, "user", req.Username)
 }
 
+func TestHandshakeRequest_Validate(t *testing.T) {
+	valid := DeviceInfo{DeviceID: "device-123", OS: "linux", Attributes: map[string]string{"key": "value"}}
+	assert.NoError(t, (&HandshakeRequest{DeviceInfo: valid}).Validate())
+	assert.NoError(t, (&HandshakeRequest{}).Validate(), "device info is optional")
+
+	assert.Error(t, (&HandshakeRequest{DeviceInfo: DeviceInfo{OS: "linux"}}).Validate())
+	assert.Error(t, (&HandshakeRequest{DeviceInfo: DeviceInfo{DeviceID: "device-123"}}).Validate())
+
+	long := valid
+	long.Hostname = strings.Repeat("h", MaxDeviceFieldLength+1)
+	assert.Error(t, (&HandshakeRequest{DeviceInfo: long}).Validate())
+
+	many := valid
+	many.Attributes = map[string]string{}
+	for i := 0; i <= MaxDeviceAttributes; i++ {
+		many.Attributes[fmt.Sprintf("k%d", i)] = "v"
+	}
+	assert.Error(t, (&HandshakeRequest{DeviceInfo: many}).Validate())
+}
+
 func TestRevoke_NoToken(t *testing.T) {
 	config := &Config{
 		ControllerURL:   "https://localhost:8443",
@@ -146,3 +174,301 @@ func TestRevoke_NoToken(t *testing.T) {
 	err := client.Revoke(ctx)
 	assert.NoError(t, err)
 }
+
+func TestRefreshLifetimeExceeded(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"status":"error","code":"SESSION_LIFETIME_EXCEEDED","message":"Session lifetime exceeded"}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(&Config{ControllerURL: server.URL})
+	client.mu.Lock()
+	client.token = "test-token"
+	client.mu.Unlock()
+
+	_, err := client.Refresh(context.Background())
+	assert.True(t, errors.Is(err, ErrReauthRequired), "expected ErrReauthRequired, got %v", err)
+}
+
+func TestRotateCertificate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/certs/rotate", r.URL.Path)
+		assert.Equal(t, "Bearer test-token", r.Header.Get("Authorization"))
+
+		var req map[string]string
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Contains(t, req["cert_pem"], "BEGIN CERTIFICATE")
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"success","fingerprint":"sha256:new","previous_fingerprint":"sha256:old","overlap_until":"2026-01-02T00:00:00Z","sessions_rebound":1}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(&Config{ControllerURL: server.URL, CertFingerprint: "sha256:old"})
+
+	// 未握手时不能轮换
+	_, err := client.RotateCertificate(context.Background(), tls.Certificate{Certificate: [][]byte{[]byte("der")}})
+	assert.Error(t, err)
+
+	client.mu.Lock()
+	client.token = "test-token"
+	client.mu.Unlock()
+	oldHTTPClient := client.client()
+
+	resp, err := client.RotateCertificate(context.Background(), tls.Certificate{Certificate: [][]byte{[]byte("der")}})
+	assert.NoError(t, err)
+	assert.Equal(t, "sha256:new", resp.Fingerprint)
+	assert.Equal(t, 1, resp.SessionsRebound)
+
+	// Token 保持不变，后续请求使用新证书
+	assert.Equal(t, "test-token", client.GetToken())
+	assert.NotEqual(t, "sha256:old", client.CertFingerprint())
+	assert.NotSame(t, oldHTTPClient, client.client())
+	transport := client.client().Transport.(*http.Transport)
+	assert.Len(t, transport.TLSClientConfig.Certificates, 1)
+}
+
+func TestSessionTransfer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case DefaultTransferPath:
+			assert.Equal(t, "Bearer laptop-token", r.Header.Get("Authorization"))
+			w.Write([]byte(`{"status":"success","code":"ABCD-EFGH-IJKL-MNOP","expires_at":"2026-01-01T00:02:00Z"}`))
+		case DefaultTransferRedeemPath:
+			var req TransferRedeemRequest
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			assert.Equal(t, "ABCD-EFGH-IJKL-MNOP", req.Code)
+			assert.Equal(t, "desktop-1", req.DeviceInfo.DeviceID)
+			w.Write([]byte(`{"status":"success","token":"desktop-token","expires_at":"2099-01-01T00:00:00Z",` +
+				`"tunnels":[{"tunnel_id":"tunnel-2","previous_tunnel_id":"tunnel-1","service_id":"svc-1"}],` +
+				`"skipped":[{"previous_tunnel_id":"tunnel-3","service_id":"svc-2","reason":"policy_denied"}]}`))
+		default:
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	laptop := NewClient(&Config{ControllerURL: server.URL})
+	defer laptop.Stop()
+	_, err := laptop.RequestTransfer(context.Background())
+	assert.Error(t, err, "transfer requires a session")
+
+	laptop.mu.Lock()
+	laptop.token = "laptop-token"
+	laptop.mu.Unlock()
+	transfer, err := laptop.RequestTransfer(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "ABCD-EFGH-IJKL-MNOP", transfer.Code)
+
+	desktop := NewClient(&Config{ControllerURL: server.URL})
+	defer desktop.Stop()
+	_, err = desktop.RedeemTransfer(context.Background(), "", DeviceInfo{})
+	assert.Error(t, err, "code is required")
+
+	resp, err := desktop.RedeemTransfer(context.Background(), transfer.Code, DeviceInfo{DeviceID: "desktop-1", OS: "linux"})
+	require.NoError(t, err)
+	assert.Equal(t, "desktop-token", desktop.GetToken())
+	require.Len(t, resp.Tunnels, 1)
+	assert.Equal(t, "tunnel-1", resp.Tunnels[0].PreviousTunnelID)
+	require.Len(t, resp.Skipped, 1)
+	assert.Equal(t, "policy_denied", resp.Skipped[0].Reason)
+}
+
+func TestListTunnels(t *testing.T) {
+	var conditional []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, DefaultTunnelsPath, r.URL.Path)
+		conditional = append(conditional, r.Header.Get("If-None-Match"))
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte(`{"type":"tunnel_list","status":"success","tunnels":[{"id":"tunnel-1","service_id":"svc-1"}]}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(&Config{ControllerURL: server.URL})
+	defer client.Stop()
+	_, err := client.ListTunnels(context.Background())
+	assert.Error(t, err, "listing requires a session")
+
+	client.mu.Lock()
+	client.token = "token-1"
+	client.mu.Unlock()
+	for i := 0; i < 2; i++ {
+		tunnels, err := client.ListTunnels(context.Background())
+		require.NoError(t, err)
+		require.Len(t, tunnels, 1)
+		assert.Equal(t, "tunnel-1", tunnels[0].ID)
+	}
+
+	// A new session does not reuse the cached list of the previous one
+	client.mu.Lock()
+	client.token = "token-2"
+	client.mu.Unlock()
+	_, err = client.ListTunnels(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"", `"v1"`, ""}, conditional)
+}
+
+func TestTelemetry_Disabled(t *testing.T) {
+	client := NewClient(&Config{ControllerURL: "https://localhost:8443"})
+
+	client.RecordError("handshake")
+	assert.Nil(t, client.errorCounts)
+	assert.Error(t, client.ReportTelemetry(context.Background()))
+}
+
+func TestReportTelemetry(t *testing.T) {
+	var received TelemetryReport
+	fail := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/telemetry", r.URL.Path)
+		assert.Equal(t, "Bearer test-token", r.Header.Get("Authorization"))
+		if fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&received)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	client := NewClient(&Config{
+		ControllerURL: server.URL,
+		Telemetry:     &TelemetryConfig{Enabled: true, SDKVersion: "2.0.0", Features: []string{"multiplex"}},
+	})
+	assert.Equal(t, time.Hour, client.telemetry.Interval)
+	client.mu.Lock()
+	client.token = "test-token"
+	client.mu.Unlock()
+
+	client.RecordError("refresh")
+	client.RecordError("refresh")
+
+	// 上报失败时保留计数
+	assert.Error(t, client.ReportTelemetry(context.Background()))
+	assert.Equal(t, int64(2), client.errorCounts["refresh"])
+
+	fail = false
+	assert.NoError(t, client.ReportTelemetry(context.Background()))
+	assert.Equal(t, "2.0.0", received.SDKVersion)
+	assert.Equal(t, []string{"multiplex"}, received.Features)
+	assert.Equal(t, int64(2), received.ErrorCounts["refresh"])
+	assert.Empty(t, client.errorCounts)
+}
+
+func TestTelemetrySDKVersion(t *testing.T) {
+	client := NewClient(&Config{
+		ControllerURL: "https://localhost:8443",
+		Telemetry:     &TelemetryConfig{Enabled: true},
+	})
+
+	// 未通过 -ldflags 设置时取构建信息中的模块版本
+	assert.NotEmpty(t, client.buildTelemetryReport(nil).SDKVersion)
+
+	saved := SDKVersion
+	SDKVersion = "v1.2.3"
+	defer func() { SDKVersion = saved }()
+	assert.Equal(t, "v1.2.3", client.buildTelemetryReport(nil).SDKVersion)
+}
+
+func TestReportPosture(t *testing.T) {
+	var headers []string
+	drift := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = append(headers, r.Header.Get(DevicePostureHeader))
+		switch r.URL.Path {
+		case DefaultPosturePath:
+			if drift {
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write([]byte(`{"code":"POSTURE_DRIFT","message":"Device posture changed, session revoked"}`))
+				return
+			}
+			w.Write([]byte(`{"drift":true,"policy":"flag"}`))
+		default:
+			w.Write([]byte(`{"tunnels":[]}`))
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(&Config{ControllerURL: server.URL})
+	laptop := DeviceInfo{DeviceID: "laptop-1", OS: "linux"}
+	client.mu.Lock()
+	client.token = "test-token"
+	client.postureHash = handshakePostureHash(&laptop)
+	client.mu.Unlock()
+
+	// 认证请求携带握手设备的指纹
+	_, err := client.ListTunnels(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, laptop.PostureHash(), headers[0])
+
+	_, err = client.ReportPosture(context.Background(), DeviceInfo{OS: "linux"})
+	assert.Error(t, err)
+
+	upgraded := DeviceInfo{DeviceID: "laptop-1", OS: "linux", OSVersion: "6.2"}
+	resp, err := client.ReportPosture(context.Background(), upgraded)
+	require.NoError(t, err)
+	assert.True(t, resp.Drift)
+	assert.Equal(t, upgraded.PostureHash(), client.PostureHash())
+
+	drift = true
+	_, err = client.ReportPosture(context.Background(), upgraded)
+	assert.ErrorIs(t, err, ErrPostureDrift)
+	assert.Empty(t, handshakePostureHash(&DeviceInfo{}))
+}
+
+func TestHandshakeClockSkew(t *testing.T) {
+	// Controller 时钟比本地慢 1 小时
+	serverNow := time.Now().Add(-time.Hour).UTC()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"token":"skewed-token","expires_at":"` + serverNow.Add(30*time.Minute).Format(time.RFC3339) +
+			`","server_time":"` + serverNow.Format(time.RFC3339Nano) + `"}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(&Config{ControllerURL: server.URL})
+	defer client.Stop()
+
+	_, err := client.Handshake(context.Background(), DeviceInfo{}, "", "")
+	require.NoError(t, err)
+
+	assert.InDelta(t, float64(-time.Hour), float64(client.ClockSkew()), float64(time.Second))
+	assert.True(t, client.IsValid(), "expiry should be judged on the Controller clock")
+}
+
+func TestHandshakeCapabilities(t *testing.T) {
+	capabilities := `,"capabilities":["e2e"]`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req HandshakeRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, tunnel.DefaultCapabilities(), req.Capabilities)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"token":"token-1","expires_at":"` + time.Now().Add(time.Hour).Format(time.RFC3339) + `"` + capabilities + `}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(&Config{ControllerURL: server.URL})
+	defer client.Stop()
+	assert.Nil(t, client.PeerCapabilities())
+
+	_, err := client.Handshake(context.Background(), DeviceInfo{}, "", "")
+	require.NoError(t, err)
+	assert.Equal(t, tunnel.Capabilities{tunnel.CapabilityE2E}, client.PeerCapabilities())
+	assert.False(t, client.PeerCapabilities().Supports(tunnel.CapabilityMux))
+
+	// 旧版本 Controller 不通告能力：按通告机制之前的特性降级
+	capabilities = ""
+	_, err = client.Handshake(context.Background(), DeviceInfo{}, "", "")
+	require.NoError(t, err)
+	assert.Nil(t, client.PeerCapabilities())
+	assert.True(t, client.PeerCapabilities().Supports(tunnel.CapabilityMux))
+}
@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// DevicePostureHeader carries the device posture hash (device.Info.PostureHash)
+// on authenticated requests. The Controller compares it with the hash recorded
+// for the session at handshake and reports a mismatch as device drift.
+const DevicePostureHeader = "X-SDP-Device-Posture"
+
+// DefaultPosturePath is the device posture report endpoint (not affected by Endpoints)
+const DefaultPosturePath = "/api/v1/auth/posture"
+
+// ErrPostureDrift is returned when the Controller revoked the session because
+// the device posture no longer matches the one recorded at handshake.
+// A new Handshake is required.
+var ErrPostureDrift = errors.New("device posture drift: session revoked, re-handshake required")
+
+// PostureReport is the body posted to /api/v1/auth/posture
+type PostureReport struct {
+	DeviceInfo DeviceInfo `json:"device_info"`
+}
+
+// Validate checks the reported device info (DeviceID and OS are required)
+func (r *PostureReport) Validate() error {
+	return r.DeviceInfo.Validate()
+}
+
+// PostureResponse is the Controller's answer to a posture report
+type PostureResponse struct {
+	Drift  bool   `json:"drift"`            // Posture differs from the one recorded for the session
+	Policy string `json:"policy,omitempty"` // Drift policy applied by the Controller (flag / revoke)
+}
+
+// ReportPosture reports the current device posture for the session.
+// When the Controller flags a drift the new posture becomes the session's
+// baseline; under the revoke policy the session is revoked and
+// ErrPostureDrift is returned.
+func (c *Client) ReportPosture(ctx context.Context, deviceInfo DeviceInfo) (*PostureResponse, error) {
+	c.mu.RLock()
+	token := c.token
+	c.mu.RUnlock()
+
+	if token == "" {
+		return nil, fmt.Errorf("no session: handshake first")
+	}
+
+	reqBody := PostureReport{DeviceInfo: deviceInfo}
+	if err := reqBody.Validate(); err != nil {
+		return nil, err
+	}
+	bodyBytes, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.controllerURL+DefaultPosturePath, bytes.NewReader(bodyBytes))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	c.authorize(req, token)
+
+	resp, err := c.client().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		if isPostureDrift(body) {
+			return nil, ErrPostureDrift
+		}
+		return nil, fmt.Errorf("posture report failed (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var postureResp PostureResponse
+	if err := json.Unmarshal(body, &postureResp); err != nil {
+		return nil, fmt.Errorf("parse response: %w", err)
+	}
+
+	c.mu.Lock()
+	c.postureHash = deviceInfo.PostureHash()
+	c.mu.Unlock()
+
+	return &postureResp, nil
+}
+
+// PostureHash returns the device posture hash sent with authenticated requests
+func (c *Client) PostureHash() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.postureHash
+}
+
+// authorize sets the bearer token and, when known, the device posture header
+func (c *Client) authorize(req *http.Request, token string) {
+	req.Header.Set("Authorization", "Bearer "+token)
+	if hash := c.PostureHash(); hash != "" {
+		req.Header.Set(DevicePostureHeader, hash)
+	}
+}
+
+// handshakePostureHash returns the posture hash the Controller records for a
+// session created with deviceInfo (empty when no device info was sent)
+func handshakePostureHash(deviceInfo *DeviceInfo) string {
+	if deviceInfo.IsZero() {
+		return ""
+	}
+	return deviceInfo.PostureHash()
+}
+
+// isPostureDrift reports whether an error response carries code POSTURE_DRIFT
+func isPostureDrift(body []byte) bool {
+	var errResp struct {
+		Code string `json:"code"`
+	}
+	return json.Unmarshal(body, &errResp) == nil && errResp.Code == "POSTURE_DRIFT"
+}
@@ -0,0 +1,212 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"time"
+)
+
+// SDKVersion is the sdp-common version reported in telemetry when
+// TelemetryConfig.SDKVersion is not set. Release builds may stamp it with
+// -ldflags "-X github.com/houzhh15/sdp-common/auth.SDKVersion=v1.2.3";
+// when empty the module version is read from the binary's build info.
+var SDKVersion string
+
+// sdkModulePath is the module whose version is looked up in build info
+const sdkModulePath = "github.com/houzhh15/sdp-common"
+
+// sdkVersion returns SDKVersion, falling back to the sdp-common module
+// version recorded in build info ("(devel)" for local or replaced builds)
+func sdkVersion() string {
+	if SDKVersion != "" {
+		return SDKVersion
+	}
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "(devel)"
+	}
+	if info.Main.Path == sdkModulePath && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	for _, dep := range info.Deps {
+		if dep.Path != sdkModulePath {
+			continue
+		}
+		if dep.Replace != nil && dep.Replace.Version != "" {
+			return dep.Replace.Version
+		}
+		if dep.Version != "" {
+			return dep.Version
+		}
+	}
+	return "(devel)"
+}
+
+// TelemetryConfig enables opt-in usage statistics reporting.
+// Reports carry only SDK version, platform, enabled feature names and
+// error counters; no tokens, addresses or payload data are sent.
+type TelemetryConfig struct {
+	Enabled    bool          // Must be set explicitly, telemetry is off by default
+	Interval   time.Duration // Reporting interval (default: 1h)
+	SDKVersion string        // Reported SDK/application version (default: SDKVersion)
+	Features   []string      // Feature flags in use (e.g. "multiplex", "pattern_service")
+}
+
+// TelemetryReport is the body posted to /api/v1/telemetry
+type TelemetryReport struct {
+	Type        string           `json:"type"`
+	SDKVersion  string           `json:"sdk_version"`
+	OS          string           `json:"os"`
+	Arch        string           `json:"arch"`
+	GoVersion   string           `json:"go_version"`
+	Features    []string         `json:"features,omitempty"`
+	ErrorCounts map[string]int64 `json:"error_counts,omitempty"`
+	Timestamp   time.Time        `json:"timestamp"`
+}
+
+// RecordError counts an error of the given kind for the next telemetry report.
+// It is a no-op unless telemetry is enabled.
+func (c *Client) RecordError(kind string) {
+	if c.telemetry == nil || !c.telemetry.Enabled || kind == "" {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.errorCounts == nil {
+		c.errorCounts = make(map[string]int64)
+	}
+	c.errorCounts[kind]++
+}
+
+// ReportTelemetry sends a telemetry report immediately.
+// Error counters are reset on success and kept for the next attempt on failure.
+func (c *Client) ReportTelemetry(ctx context.Context) error {
+	if c.telemetry == nil || !c.telemetry.Enabled {
+		return fmt.Errorf("telemetry not enabled")
+	}
+
+	c.mu.Lock()
+	token := c.token
+	counts := c.errorCounts
+	c.errorCounts = nil
+	c.mu.Unlock()
+
+	if token == "" {
+		c.restoreErrorCounts(counts)
+		return fmt.Errorf("no token for telemetry report")
+	}
+
+	if err := c.sendTelemetry(ctx, token, c.buildTelemetryReport(counts)); err != nil {
+		c.restoreErrorCounts(counts)
+		return err
+	}
+	return nil
+}
+
+// buildTelemetryReport builds a report from the current platform and counters
+func (c *Client) buildTelemetryReport(counts map[string]int64) *TelemetryReport {
+	version := c.telemetry.SDKVersion
+	if version == "" {
+		version = sdkVersion()
+	}
+
+	features := append([]string(nil), c.telemetry.Features...)
+	sort.Strings(features)
+
+	return &TelemetryReport{
+		Type:        "telemetry_report",
+		SDKVersion:  version,
+		OS:          runtime.GOOS,
+		Arch:        runtime.GOARCH,
+		GoVersion:   runtime.Version(),
+		Features:    features,
+		ErrorCounts: counts,
+		Timestamp:   time.Now(),
+	}
+}
+
+// sendTelemetry posts a single telemetry report
+func (c *Client) sendTelemetry(ctx context.Context, token string, report *TelemetryReport) error {
+	bodyBytes, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("marshal report: %w", err)
+	}
+
+	url := c.controllerURL + "/api/v1/telemetry"
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(bodyBytes))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	c.authorize(req, token)
+
+	resp, err := c.client().Do(req)
+	if err != nil {
+		return fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("telemetry report failed (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
+
+// restoreErrorCounts merges unsent counters back after a failed report
+func (c *Client) restoreErrorCounts(counts map[string]int64) {
+	if len(counts) == 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.errorCounts == nil {
+		c.errorCounts = make(map[string]int64, len(counts))
+	}
+	for kind, n := range counts {
+		c.errorCounts[kind] += n
+	}
+}
+
+// startTelemetry schedules periodic telemetry reports (no-op when disabled or already running)
+func (c *Client) startTelemetry() {
+	if c.telemetry == nil || !c.telemetry.Enabled {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.telemetryTimer != nil {
+		return
+	}
+
+	interval := c.telemetry.Interval
+	c.telemetryTimer = time.AfterFunc(interval, func() {
+		// Check if stopped
+		select {
+		case <-c.stopChan:
+			return
+		default:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		c.ReportTelemetry(ctx) // Best effort, counters are kept for the next interval
+		cancel()
+
+		c.mu.Lock()
+		c.telemetryTimer.Reset(interval)
+		c.mu.Unlock()
+	})
+}
@@ -0,0 +1,191 @@
+// Package backoff 提供带全抖动（full jitter）的指数退避与重试，供各客户端的重连、重试逻辑共用
+//
+// 第 n 次重试前的等待时间在 [0, min(MaxInterval, InitialInterval*Multiplier^n)] 内均匀随机，
+// 避免大量客户端在 Controller 重启后同时重连。
+//
+//	err := backoff.Retry(ctx, &backoff.Config{
+//	    InitialInterval: time.Second,
+//	    MaxAttempts:     5,
+//	    OnRetry: func(attempt int, err error, wait time.Duration) {
+//	        logger.Warn("retrying", "attempt", attempt, "error", err, "retry_in", wait)
+//	    },
+//	}, func(ctx context.Context) error {
+//	    return doRequest(ctx)
+//	})
+//
+// 长期运行的重连循环可直接使用 Backoff：失败时调用 Next 获取等待时间，成功后调用 Reset。
+package backoff
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"github.com/houzhh15/sdp-common/clock"
+)
+
+// 默认参数
+const (
+	DefaultInitialInterval = time.Second
+	DefaultMaxInterval     = 60 * time.Second
+	DefaultMultiplier      = 2.0
+)
+
+// Config 退避参数
+type Config struct {
+	InitialInterval time.Duration // 首次重试的等待上限（默认 1s）
+	MaxInterval     time.Duration // 单次等待上限（默认 60s）
+	Multiplier      float64       // 每次失败后等待上限的倍数（默认 2）
+	MaxElapsedTime  time.Duration // 自首次失败起的总耗时上限，0 表示不限制
+	MaxAttempts     int           // 最大尝试次数（含首次），0 表示不限制
+	// OnRetry 每次等待重试前调用，attempt 为刚失败的尝试序号（从 1 开始）
+	OnRetry func(attempt int, err error, wait time.Duration)
+	Clock   clock.Clock // 可选，默认真实时钟
+}
+
+// Backoff 退避状态（非并发安全）
+type Backoff struct {
+	initial     time.Duration
+	max         time.Duration
+	multiplier  float64
+	maxElapsed  time.Duration
+	maxAttempts int
+	clock       clock.Clock
+
+	attempt int       // 已失败次数
+	start   time.Time // 首次失败时间
+	jitter  func(d time.Duration) time.Duration
+}
+
+// New 创建退避状态，config 为 nil 时使用默认参数
+func New(config *Config) *Backoff {
+	if config == nil {
+		config = &Config{}
+	}
+	b := &Backoff{
+		initial:     config.InitialInterval,
+		max:         config.MaxInterval,
+		multiplier:  config.Multiplier,
+		maxElapsed:  config.MaxElapsedTime,
+		maxAttempts: config.MaxAttempts,
+		clock:       clock.Or(config.Clock),
+		jitter:      fullJitter,
+	}
+	if b.initial <= 0 {
+		b.initial = DefaultInitialInterval
+	}
+	if b.max <= 0 {
+		b.max = DefaultMaxInterval
+	}
+	if b.max < b.initial {
+		b.max = b.initial
+	}
+	if b.multiplier < 1 {
+		b.multiplier = DefaultMultiplier
+	}
+	return b
+}
+
+// Next 记录一次失败并返回下次重试前的等待时间
+// 超过 MaxAttempts 或 MaxElapsedTime 时返回 false，调用方应停止重试
+func (b *Backoff) Next() (time.Duration, bool) {
+	now := b.clock.Now()
+	if b.attempt == 0 {
+		b.start = now
+	}
+	b.attempt++
+	if b.maxAttempts > 0 && b.attempt >= b.maxAttempts {
+		return 0, false
+	}
+
+	wait := b.jitter(b.ceiling())
+	if b.maxElapsed > 0 && now.Sub(b.start)+wait > b.maxElapsed {
+		return 0, false
+	}
+	return wait, true
+}
+
+// Reset 成功后重置退避状态
+func (b *Backoff) Reset() {
+	b.attempt = 0
+	b.start = time.Time{}
+}
+
+// Attempts 返回自上次 Reset 以来的失败次数
+func (b *Backoff) Attempts() int {
+	return b.attempt
+}
+
+// ceiling 当前失败次数对应的等待上限
+func (b *Backoff) ceiling() time.Duration {
+	d := float64(b.initial)
+	for i := 1; i < b.attempt; i++ {
+		d *= b.multiplier
+		if d >= float64(b.max) {
+			return b.max
+		}
+	}
+	return time.Duration(d)
+}
+
+// fullJitter 返回 [0, d] 内的随机时长
+func fullJitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int64N(int64(d) + 1))
+}
+
+// permanentError 标记不应重试的错误
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent 包装不应重试的错误，Retry 遇到时立即返回原错误
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// Retry 执行 op 直到成功、返回 Permanent 错误、达到重试上限或 ctx 取消
+// 达到上限时返回最后一次的错误；ctx 取消时返回 ctx.Err()
+func Retry(ctx context.Context, config *Config, op func(ctx context.Context) error) error {
+	b := New(config)
+	var onRetry func(int, error, time.Duration)
+	if config != nil {
+		onRetry = config.OnRetry
+	}
+
+	for {
+		err := op(ctx)
+		if err == nil {
+			return nil
+		}
+		var permanent *permanentError
+		if errors.As(err, &permanent) {
+			return permanent.err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		wait, ok := b.Next()
+		if !ok {
+			return err
+		}
+		if onRetry != nil {
+			onRetry(b.Attempts(), err, wait)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-b.clock.After(wait):
+		}
+	}
+}
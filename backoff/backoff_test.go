@@ -0,0 +1,125 @@
+package backoff
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/houzhh15/sdp-common/clock"
+)
+
+func noJitter(d time.Duration) time.Duration { return d }
+
+func TestBackoffNext(t *testing.T) {
+	b := New(&Config{InitialInterval: time.Second, MaxInterval: 5 * time.Second})
+	b.jitter = noJitter
+
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, w := range want {
+		d, ok := b.Next()
+		if !ok || d != w {
+			t.Fatalf("attempt %d: expected %v, got %v (ok=%v)", i+1, w, d, ok)
+		}
+	}
+
+	b.Reset()
+	if d, _ := b.Next(); d != time.Second {
+		t.Errorf("Expected %v after Reset, got %v", time.Second, d)
+	}
+}
+
+func TestBackoffJitter(t *testing.T) {
+	b := New(&Config{InitialInterval: 100 * time.Millisecond, MaxInterval: 400 * time.Millisecond})
+	for i := 0; i < 100; i++ {
+		d, _ := b.Next()
+		if d < 0 || d > 400*time.Millisecond {
+			t.Fatalf("wait %v out of range", d)
+		}
+	}
+}
+
+func TestBackoffLimits(t *testing.T) {
+	b := New(&Config{MaxAttempts: 3})
+	for i := 0; i < 2; i++ {
+		if _, ok := b.Next(); !ok {
+			t.Fatalf("attempt %d: expected retry", i+1)
+		}
+	}
+	if _, ok := b.Next(); ok {
+		t.Error("Expected stop after MaxAttempts")
+	}
+
+	clk := clock.NewFake(time.Now())
+	b = New(&Config{InitialInterval: time.Second, MaxElapsedTime: 10 * time.Second, Clock: clk})
+	b.jitter = noJitter
+	if _, ok := b.Next(); !ok {
+		t.Fatal("Expected first retry")
+	}
+	clk.Advance(9 * time.Second)
+	if _, ok := b.Next(); ok {
+		t.Error("Expected stop when wait would exceed MaxElapsedTime")
+	}
+}
+
+func TestRetry(t *testing.T) {
+	ctx := context.Background()
+	fail := errors.New("unavailable")
+
+	var retries []int
+	calls := 0
+	err := Retry(ctx, &Config{
+		InitialInterval: time.Millisecond,
+		OnRetry:         func(attempt int, err error, wait time.Duration) { retries = append(retries, attempt) },
+	}, func(ctx context.Context) error {
+		calls++
+		if calls < 3 {
+			return fail
+		}
+		return nil
+	})
+	if err != nil || calls != 3 || len(retries) != 2 || retries[1] != 2 {
+		t.Errorf("Expected success on 3rd call, got err=%v calls=%d retries=%v", err, calls, retries)
+	}
+
+	calls = 0
+	err = Retry(ctx, &Config{InitialInterval: time.Millisecond, MaxAttempts: 3}, func(ctx context.Context) error {
+		calls++
+		return fail
+	})
+	if !errors.Is(err, fail) || calls != 3 {
+		t.Errorf("Expected last error after 3 calls, got err=%v calls=%d", err, calls)
+	}
+
+	// Permanent 错误不重试，返回原错误
+	calls = 0
+	err = Retry(ctx, nil, func(ctx context.Context) error {
+		calls++
+		return Permanent(fail)
+	})
+	if err != fail || calls != 1 {
+		t.Errorf("Expected permanent error after 1 call, got err=%v calls=%d", err, calls)
+	}
+}
+
+func TestRetryContextCancel(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- Retry(ctx, &Config{Clock: clk}, func(ctx context.Context) error {
+			return errors.New("unavailable")
+		})
+	}()
+
+	clk.BlockUntil(1) // 等待进入退避
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Retry did not return after cancel")
+	}
+}
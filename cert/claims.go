@@ -0,0 +1,185 @@
+package cert
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// 身份声明来源（证书字段），可直接作为 ClaimsMapping 字段的取值，也可在模板中以 {name} 引用
+const (
+	ClaimSourceCN           = "cn"             // Subject CommonName
+	ClaimSourceSANEmail     = "san_email"      // 第一个 email SAN
+	ClaimSourceSANEmailUser = "san_email_user" // 第一个 email SAN 中 @ 之前的部分
+	ClaimSourceSANURI       = "san_uri"        // 第一个 URI SAN
+	ClaimSourceOU           = "ou"             // 全部 OU，以 OUSeparator 依次连接
+	ClaimSourceFirstOU      = "ou_first"       // 第一个 OU
+	ClaimSourceO            = "o"              // 第一个 Organization
+)
+
+// DefaultOUSeparator OU 连接的默认分隔符
+const DefaultOUSeparator = "."
+
+// claimSources 各来源的取值函数，字段缺失时返回空串
+var claimSources = map[string]func(cert *x509.Certificate, ouSeparator string) string{
+	ClaimSourceCN: func(cert *x509.Certificate, _ string) string {
+		return cert.Subject.CommonName
+	},
+	ClaimSourceSANEmail: func(cert *x509.Certificate, _ string) string {
+		return firstValue(cert.EmailAddresses)
+	},
+	ClaimSourceSANEmailUser: func(cert *x509.Certificate, _ string) string {
+		user, _, _ := strings.Cut(firstValue(cert.EmailAddresses), "@")
+		return user
+	},
+	ClaimSourceSANURI: func(cert *x509.Certificate, _ string) string {
+		if len(cert.URIs) == 0 {
+			return ""
+		}
+		return cert.URIs[0].String()
+	},
+	ClaimSourceOU: func(cert *x509.Certificate, ouSeparator string) string {
+		return strings.Join(cert.Subject.OrganizationalUnit, ouSeparator)
+	},
+	ClaimSourceFirstOU: func(cert *x509.Certificate, _ string) string {
+		return firstValue(cert.Subject.OrganizationalUnit)
+	},
+	ClaimSourceO: func(cert *x509.Certificate, _ string) string {
+		return firstValue(cert.Subject.Organization)
+	},
+}
+
+// Claims 从客户端证书提取的身份声明
+type Claims struct {
+	ClientID    string `json:"client_id"`
+	ClientClass string `json:"client_class,omitempty"` // 客户端类别（角色），用于管理接口授权与会话有效期
+	Tenant      string `json:"tenant,omitempty"`
+}
+
+// ClaimsMapping 客户端证书字段到身份声明的映射，便于沿用现有 PKI 命名规则而无需重新签发证书
+//
+// 每个字段取值为单个来源（ClaimSource*），或包含 {source} 占位符的模板（如 "{o}/{cn}"）；
+// 模板中任一占位符取值为空时整个声明视为缺失。零值映射等价于 CN → ClientID、第一个 OU → 类别、不提取租户
+type ClaimsMapping struct {
+	ClientID    string `json:"client_id,omitempty" yaml:"client_id"`       // 默认 cn
+	ClientClass string `json:"client_class,omitempty" yaml:"client_class"` // 默认 ou_first
+	Tenant      string `json:"tenant,omitempty" yaml:"tenant"`             // 为空不提取
+	OUSeparator string `json:"ou_separator,omitempty" yaml:"ou_separator"` // ou 来源的连接符，默认 "."
+}
+
+// Validate 校验各声明的来源与模板语法（nil 映射合法）
+func (m *ClaimsMapping) Validate() error {
+	if m == nil {
+		return nil
+	}
+	for _, claim := range []struct{ name, expr string }{
+		{"client_id", m.ClientID},
+		{"client_class", m.ClientClass},
+		{"tenant", m.Tenant},
+	} {
+		if claim.expr == "" {
+			continue
+		}
+		if _, err := expandClaim(claim.expr, func(string) string { return "x" }); err != nil {
+			return fmt.Errorf("identity claim %s: %w", claim.name, err)
+		}
+	}
+	return nil
+}
+
+// Extract 按映射从证书提取身份声明，ClientID 缺失时返回错误
+func (m *ClaimsMapping) Extract(cert *x509.Certificate) (*Claims, error) {
+	if cert == nil {
+		return nil, errors.New("certificate is nil")
+	}
+
+	clientIDExpr, classExpr, tenantExpr, separator := ClaimSourceCN, ClaimSourceFirstOU, "", DefaultOUSeparator
+	if m != nil {
+		clientIDExpr = orDefault(m.ClientID, clientIDExpr)
+		classExpr = orDefault(m.ClientClass, classExpr)
+		tenantExpr = m.Tenant
+		separator = orDefault(m.OUSeparator, separator)
+	}
+	lookup := func(source string) string {
+		return claimSources[source](cert, separator)
+	}
+
+	claims := &Claims{}
+	var err error
+	if claims.ClientID, err = expandClaim(clientIDExpr, lookup); err != nil {
+		return nil, fmt.Errorf("identity claim client_id: %w", err)
+	}
+	if claims.ClientID == "" {
+		return nil, fmt.Errorf("certificate %q has no value for client_id claim %q", cert.Subject.CommonName, clientIDExpr)
+	}
+	if claims.ClientClass, err = expandClaim(classExpr, lookup); err != nil {
+		return nil, fmt.Errorf("identity claim client_class: %w", err)
+	}
+	if tenantExpr != "" {
+		if claims.Tenant, err = expandClaim(tenantExpr, lookup); err != nil {
+			return nil, fmt.Errorf("identity claim tenant: %w", err)
+		}
+	}
+	return claims, nil
+}
+
+// expandClaim 求值单个来源或模板，lookup 只会以已知来源名调用；任一占位符取值为空时返回空串
+func expandClaim(expr string, lookup func(source string) string) (string, error) {
+	if !strings.ContainsAny(expr, "{}") {
+		if _, ok := claimSources[expr]; !ok {
+			return "", fmt.Errorf("unknown source %q", expr)
+		}
+		return lookup(expr), nil
+	}
+
+	var b strings.Builder
+	missing := false
+	for rest := expr; rest != ""; {
+		open := strings.IndexByte(rest, '{')
+		if open < 0 {
+			open = len(rest)
+		}
+		if strings.IndexByte(rest[:open], '}') >= 0 {
+			return "", fmt.Errorf("unmatched '}' in template %q", expr)
+		}
+		b.WriteString(rest[:open])
+		if open == len(rest) {
+			break
+		}
+		end := strings.IndexByte(rest[open:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unclosed '{' in template %q", expr)
+		}
+		source := rest[open+1 : open+end]
+		if _, ok := claimSources[source]; !ok {
+			return "", fmt.Errorf("unknown placeholder {%s} in template %q", source, expr)
+		}
+		value := lookup(source)
+		if value == "" {
+			missing = true
+		}
+		b.WriteString(value)
+		rest = rest[open+end+1:]
+	}
+	if missing {
+		return "", nil
+	}
+	return b.String(), nil
+}
+
+// firstValue 返回切片的第一个元素（空切片返回空串）
+func firstValue(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// orDefault 返回 value，为空时返回 fallback
+func orDefault(value, fallback string) string {
+	if value != "" {
+		return value
+	}
+	return fallback
+}
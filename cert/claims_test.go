@@ -0,0 +1,89 @@
+package cert
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/url"
+	"testing"
+)
+
+func newClaimsTestCert() *x509.Certificate {
+	u, _ := url.Parse("spiffe://corp.example/user/alice")
+	return &x509.Certificate{
+		Subject: pkix.Name{
+			CommonName:         "Alice Liddell",
+			Organization:       []string{"acme"},
+			OrganizationalUnit: []string{"eng", "platform"},
+		},
+		EmailAddresses: []string{"alice@acme.example"},
+		URIs:           []*url.URL{u},
+	}
+}
+
+func TestClaimsMapping_Extract(t *testing.T) {
+	cert := newClaimsTestCert()
+
+	// 零值映射保持原有行为：CN → ClientID，第一个 OU → 类别
+	claims, err := (*ClaimsMapping)(nil).Extract(cert)
+	if err != nil {
+		t.Fatalf("Extract失败: %v", err)
+	}
+	if claims.ClientID != "Alice Liddell" || claims.ClientClass != "eng" || claims.Tenant != "" {
+		t.Errorf("默认声明错误: %+v", claims)
+	}
+
+	tests := []struct {
+		mapping ClaimsMapping
+		want    Claims
+	}{
+		{ClaimsMapping{ClientID: ClaimSourceSANEmail}, Claims{ClientID: "alice@acme.example", ClientClass: "eng"}},
+		{ClaimsMapping{ClientID: ClaimSourceSANEmailUser, Tenant: ClaimSourceO}, Claims{ClientID: "alice", ClientClass: "eng", Tenant: "acme"}},
+		{ClaimsMapping{ClientID: ClaimSourceSANURI, ClientClass: ClaimSourceOU}, Claims{ClientID: "spiffe://corp.example/user/alice", ClientClass: "eng.platform"}},
+		{ClaimsMapping{ClientID: "{o}/{san_email_user}", ClientClass: ClaimSourceOU, OUSeparator: "-"}, Claims{ClientID: "acme/alice", ClientClass: "eng-platform"}},
+	}
+	for _, tt := range tests {
+		claims, err := tt.mapping.Extract(cert)
+		if err != nil {
+			t.Fatalf("Extract(%+v)失败: %v", tt.mapping, err)
+		}
+		if *claims != tt.want {
+			t.Errorf("Extract(%+v) = %+v, 期望 %+v", tt.mapping, *claims, tt.want)
+		}
+	}
+
+	// 模板任一占位符缺失时声明缺失，ClientID 缺失返回错误
+	noSAN := &x509.Certificate{Subject: pkix.Name{CommonName: "bob"}}
+	if _, err := (&ClaimsMapping{ClientID: "{o}/{cn}"}).Extract(noSAN); err == nil {
+		t.Error("ClientID 模板缺少字段时应返回错误")
+	}
+	claims, err = (&ClaimsMapping{Tenant: "{o}"}).Extract(noSAN)
+	if err != nil || claims.ClientID != "bob" || claims.Tenant != "" {
+		t.Errorf("可选声明缺失不应报错: %+v, %v", claims, err)
+	}
+}
+
+func TestClaimsMapping_Validate(t *testing.T) {
+	valid := []*ClaimsMapping{
+		nil,
+		{},
+		{ClientID: ClaimSourceSANURI, ClientClass: ClaimSourceOU, Tenant: "{o}"},
+		{ClientID: "user:{cn}@{o}"},
+	}
+	for _, m := range valid {
+		if err := m.Validate(); err != nil {
+			t.Errorf("Validate(%+v)失败: %v", m, err)
+		}
+	}
+
+	invalid := []*ClaimsMapping{
+		{ClientID: "common_name"},
+		{ClientClass: "{ou"},
+		{Tenant: "o}"},
+		{ClientID: "{cn}/{serial}"},
+	}
+	for _, m := range invalid {
+		if err := m.Validate(); err == nil {
+			t.Errorf("Validate(%+v)应返回错误", m)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package cert
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// 内部组件角色
+const (
+	RoleController = "controller" // Controller 副本
+	RoleRelay      = "relay"      // 数据平面中继节点
+)
+
+// DefaultTrustDomain 内部身份默认信任域
+const DefaultTrustDomain = "sdp.internal"
+
+// ServiceIdentity 内部组件身份（Controller 副本、中继节点）
+// 编码为证书 URI SAN：spiffe://<trust-domain>/<role>/<id>，与终端用户证书（CN/OU 标识）区分
+type ServiceIdentity struct {
+	TrustDomain string `json:"trust_domain"`
+	Role        string `json:"role"`
+	ID          string `json:"id"`
+}
+
+// URI 返回身份的 URI SAN 形式
+func (s *ServiceIdentity) URI() string {
+	return fmt.Sprintf("spiffe://%s/%s/%s", s.TrustDomain, s.Role, s.ID)
+}
+
+// String 实现 fmt.Stringer
+func (s *ServiceIdentity) String() string {
+	return s.URI()
+}
+
+// ParseServiceIdentity 从证书 URI SAN 中提取指定信任域的内部身份
+// 证书不含该信任域的 spiffe URI 时返回错误（终端用户证书即属此类）
+func ParseServiceIdentity(cert *x509.Certificate, trustDomain string) (*ServiceIdentity, error) {
+	if cert == nil {
+		return nil, errors.New("certificate is nil")
+	}
+	if trustDomain == "" {
+		trustDomain = DefaultTrustDomain
+	}
+
+	for _, u := range cert.URIs {
+		if u.Scheme != "spiffe" || u.Host != trustDomain {
+			continue
+		}
+		parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("malformed service identity %q", u.String())
+		}
+		return &ServiceIdentity{TrustDomain: trustDomain, Role: parts[0], ID: parts[1]}, nil
+	}
+	return nil, fmt.Errorf("certificate %q has no service identity in trust domain %s", cert.Subject.CommonName, trustDomain)
+}
+
+// IsServiceCertificate 判断证书是否携带任意 spiffe 内部身份（用于拒绝其访问终端用户接口）
+func IsServiceCertificate(cert *x509.Certificate) bool {
+	if cert == nil {
+		return false
+	}
+	for _, u := range cert.URIs {
+		if u.Scheme == "spiffe" {
+			return true
+		}
+	}
+	return false
+}
+
+// InternalPeerPolicy 内部 RPC 对端校验策略
+// 内部证书可由独立 CA 签发（推荐），与用户证书共用 CA 时依靠 URI SAN 区分
+type InternalPeerPolicy struct {
+	TrustDomain  string   // 为空使用 DefaultTrustDomain
+	AllowedRoles []string // 允许的对端角色，为空允许 controller 与 relay
+}
+
+// Authorize 校验对端证书的内部身份与角色
+func (p *InternalPeerPolicy) Authorize(cert *x509.Certificate) (*ServiceIdentity, error) {
+	identity, err := ParseServiceIdentity(cert, p.TrustDomain)
+	if err != nil {
+		return nil, err
+	}
+
+	roles := p.AllowedRoles
+	if len(roles) == 0 {
+		roles = []string{RoleController, RoleRelay}
+	}
+	for _, role := range roles {
+		if identity.Role == role {
+			return identity, nil
+		}
+	}
+	return nil, fmt.Errorf("service role %q is not allowed", identity.Role)
+}
+
+// verifyConnection 在证书链验证通过后校验对端内部身份
+func (p *InternalPeerPolicy) verifyConnection(cs tls.ConnectionState) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("no peer certificate")
+	}
+	_, err := p.Authorize(cs.PeerCertificates[0])
+	return err
+}
+
+// GetInternalServerTLSConfig 生成内部 RPC 服务端 TLS 配置：强制 mTLS，对端须为允许角色的内部身份
+func (m *Manager) GetInternalServerTLSConfig(policy *InternalPeerPolicy) *tls.Config {
+	config := m.GetTLSConfig()
+	config.ClientAuth = tls.RequireAndVerifyClientCert
+	config.VerifyConnection = policy.verifyConnection
+	return config
+}
+
+// GetInternalClientTLSConfig 生成内部 RPC 客户端 TLS 配置：出示本组件证书，服务端须为允许角色的内部身份
+func (m *Manager) GetInternalClientTLSConfig(policy *InternalPeerPolicy) *tls.Config {
+	config := m.GetTLSConfig()
+	config.ClientCAs = nil
+	config.ClientAuth = tls.NoClientCert
+	config.VerifyConnection = policy.verifyConnection
+	return config
+}
@@ -0,0 +1,62 @@
+package cert
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/url"
+	"testing"
+)
+
+func newIdentityTestCert(uris ...string) *x509.Certificate {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "test"}}
+	for _, raw := range uris {
+		u, _ := url.Parse(raw)
+		cert.URIs = append(cert.URIs, u)
+	}
+	return cert
+}
+
+func TestParseServiceIdentity(t *testing.T) {
+	identity, err := ParseServiceIdentity(newIdentityTestCert("spiffe://sdp.internal/controller/ctrl-1"), "")
+	if err != nil {
+		t.Fatalf("ParseServiceIdentity失败: %v", err)
+	}
+	if identity.Role != RoleController || identity.ID != "ctrl-1" {
+		t.Errorf("身份错误: %+v", identity)
+	}
+	if identity.URI() != "spiffe://sdp.internal/controller/ctrl-1" {
+		t.Errorf("URI错误: %s", identity.URI())
+	}
+
+	// 终端用户证书、其他信任域、格式错误均应拒绝
+	for _, cert := range []*x509.Certificate{
+		newIdentityTestCert(),
+		newIdentityTestCert("spiffe://other.domain/controller/ctrl-1"),
+		newIdentityTestCert("spiffe://sdp.internal/controller"),
+	} {
+		if _, err := ParseServiceIdentity(cert, DefaultTrustDomain); err == nil {
+			t.Errorf("应返回错误: %v", cert.URIs)
+		}
+	}
+
+	if IsServiceCertificate(newIdentityTestCert()) {
+		t.Error("无 URI SAN 的证书不是内部证书")
+	}
+	if !IsServiceCertificate(newIdentityTestCert("spiffe://other.domain/relay/r1")) {
+		t.Error("携带 spiffe URI 的证书应识别为内部证书")
+	}
+}
+
+func TestInternalPeerPolicy_Authorize(t *testing.T) {
+	relay := newIdentityTestCert("spiffe://sdp.internal/relay/relay-1")
+
+	if _, err := (&InternalPeerPolicy{}).Authorize(relay); err != nil {
+		t.Errorf("默认策略应允许 relay: %v", err)
+	}
+	if _, err := (&InternalPeerPolicy{AllowedRoles: []string{RoleController}}).Authorize(relay); err == nil {
+		t.Error("仅允许 controller 时应拒绝 relay")
+	}
+	if _, err := (&InternalPeerPolicy{TrustDomain: "prod.sdp"}).Authorize(relay); err == nil {
+		t.Error("信任域不匹配时应拒绝")
+	}
+}
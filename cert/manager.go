@@ -15,27 +15,42 @@ type Config struct {
 	CertFile string // 证书文件路径
 	KeyFile  string // 私钥文件路径
 	CAFile   string // CA证书文件路径
+	KeyPEM   []byte // 私钥 PEM 内容（来自 config.Secret 等），设置后替代 KeyFile
+	// CAFiles / CADirs 额外的 CA 文件（可为多证书 bundle）与 CA 目录（*.pem、*.crt、*.cer），与 CAFile 合并为信任集
+	CAFiles []string
+	CADirs  []string
+	// TLSPolicy 协议版本、密码套件与曲线策略，nil 使用 DefaultTLSPolicy
+	TLSPolicy *TLSPolicy
 }
 
 // Manager 证书管理器（无状态）
 // 从 ih-client/internal/cert/manager.go 提取并扩展
 type Manager struct {
-	certFile   string
-	keyFile    string
-	caFile     string
-	cert       *tls.Certificate
-	x509Cert   *x509.Certificate
-	caCertPool *x509.CertPool
+	certFile  string
+	keyFile   string
+	caFile    string
+	cert      *tls.Certificate
+	x509Cert  *x509.Certificate
+	trust     *TrustStore // 未配置 CA 时为 nil
+	tlsPolicy *TLSPolicy
 }
 
 // NewManager 创建证书管理器
 func NewManager(config *Config) (*Manager, error) {
-	if config.CertFile == "" || config.KeyFile == "" {
+	if config.CertFile == "" || (config.KeyFile == "" && len(config.KeyPEM) == 0) {
 		return nil, fmt.Errorf("cert_file and key_file are required")
 	}
 
+	tlsPolicy := config.TLSPolicy
+	if tlsPolicy == nil {
+		tlsPolicy = DefaultTLSPolicy()
+	}
+	if err := tlsPolicy.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid TLS policy: %w", err)
+	}
+
 	// 加载证书和私钥
-	cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+	cert, err := loadKeyPair(config)
 	if err != nil {
 		return nil, fmt.Errorf("load certificate: %w", err)
 	}
@@ -46,29 +61,45 @@ func NewManager(config *Config) (*Manager, error) {
 		return nil, fmt.Errorf("parse certificate: %w", err)
 	}
 
-	// 加载CA证书池
-	var caCertPool *x509.CertPool
+	// 加载CA信任集
+	var trust *TrustStore
+	caFiles := config.CAFiles
 	if config.CAFile != "" {
-		caCertPool = x509.NewCertPool()
-		caData, err := os.ReadFile(config.CAFile)
+		caFiles = append([]string{config.CAFile}, caFiles...)
+	}
+	if len(caFiles) > 0 || len(config.CADirs) > 0 {
+		trust, err = LoadTrustStore(caFiles, config.CADirs)
 		if err != nil {
-			return nil, fmt.Errorf("read CA file: %w", err)
+			return nil, err
 		}
-		if !caCertPool.AppendCertsFromPEM(caData) {
-			return nil, fmt.Errorf("append CA certs failed")
+		if trust.Len() == 0 {
+			return nil, fmt.Errorf("no CA certificate found in CA dirs")
 		}
 	}
 
 	return &Manager{
-		certFile:   config.CertFile,
-		keyFile:    config.KeyFile,
-		caFile:     config.CAFile,
-		cert:       &cert,
-		x509Cert:   x509Cert,
-		caCertPool: caCertPool,
+		certFile:  config.CertFile,
+		keyFile:   config.KeyFile,
+		caFile:    config.CAFile,
+		cert:      &cert,
+		x509Cert:  x509Cert,
+		trust:     trust,
+		tlsPolicy: tlsPolicy,
 	}, nil
 }
 
+// loadKeyPair 加载证书与私钥，KeyPEM 优先于 KeyFile
+func loadKeyPair(config *Config) (tls.Certificate, error) {
+	if len(config.KeyPEM) == 0 {
+		return tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+	}
+	certPEM, err := os.ReadFile(config.CertFile)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.X509KeyPair(certPEM, config.KeyPEM)
+}
+
 // GetFingerprint 获取证书指纹（SHA256）
 // 复用 ih-client/internal/cert/manager.go 的实现
 func (m *Manager) GetFingerprint() string {
@@ -89,22 +120,42 @@ func (m *Manager) ValidateExpiry() error {
 	return nil
 }
 
-// GetTLSConfig 生成TLS配置（新增方法）
+// GetTLSConfig 生成TLS配置（新增方法），版本、密码套件与曲线按 TLSPolicy 设置
+// 作为服务端配置时按当前信任集校验客户端证书（见 TrustStore.BindServer），RootCAs 为生成时的快照
 func (m *Manager) GetTLSConfig() *tls.Config {
 	config := &tls.Config{
 		Certificates: []tls.Certificate{*m.cert},
-		MinVersion:   tls.VersionTLS12,
 	}
+	m.tlsPolicy.Apply(config)
 
-	if m.caCertPool != nil {
-		config.RootCAs = m.caCertPool
-		config.ClientCAs = m.caCertPool
+	if pool := m.GetCAPool(); pool != nil {
+		config.RootCAs = pool
+		config.ClientCAs = pool
 		config.ClientAuth = tls.RequireAndVerifyClientCert
+		m.trust.BindServer(config)
 	}
 
 	return config
 }
 
+// TLSPolicy 获取生效的 TLS 策略
+func (m *Manager) TLSPolicy() *TLSPolicy {
+	return m.tlsPolicy
+}
+
+// GetCAPool 获取当前CA证书池（未配置CA时为nil）
+func (m *Manager) GetCAPool() *x509.CertPool {
+	if m.trust == nil {
+		return nil
+	}
+	return m.trust.Pool()
+}
+
+// TrustStore 获取CA信任集，用于运行时增删 CA（未配置CA时为nil）
+func (m *Manager) TrustStore() *TrustStore {
+	return m.trust
+}
+
 // GetCertificate 获取TLS证书
 func (m *Manager) GetCertificate() *tls.Certificate {
 	return m.cert
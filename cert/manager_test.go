@@ -1,6 +1,7 @@
 package cert
 
 import (
+	"os"
 	"testing"
 	"time"
 )
@@ -178,3 +179,27 @@ func TestNewManager_InvalidPaths(t *testing.T) {
 		})
 	}
 }
+
+func TestNewManager_KeyPEM(t *testing.T) {
+	keyPEM, err := os.ReadFile("../certs/controller-key.pem")
+	if err != nil {
+		t.Skip("证书文件不存在，跳过测试")
+		return
+	}
+
+	// 私钥内容直接传入（如来自 config.Secret），无需 KeyFile
+	mgr, err := NewManager(&Config{
+		CertFile: "../certs/controller-cert.pem",
+		KeyPEM:   keyPEM,
+	})
+	if err != nil {
+		t.Fatalf("NewManager with KeyPEM failed: %v", err)
+	}
+	if mgr.GetCertificate().PrivateKey == nil {
+		t.Error("私钥未加载")
+	}
+
+	if _, err := NewManager(&Config{CertFile: "../certs/controller-cert.pem", KeyPEM: []byte("invalid")}); err == nil {
+		t.Error("无效私钥应返回错误")
+	}
+}
@@ -0,0 +1,49 @@
+package cert
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// certExpiring tracks registered active certificates near or past expiry as of the last scan
+	// Labels: state (expiring, expired)
+	certExpiring = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "cert_expiring",
+			Help: "Number of registered active certificates expiring within the warning window or already expired",
+		},
+		[]string{"state"},
+	)
+
+	// certLocalExpiry tracks the remaining validity of certificates held by this process (cert.ExpiryMonitor)
+	// Labels: cn (certificate common name); negative once expired
+	certLocalExpiry = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "cert_local_expiry_seconds",
+			Help: "Seconds until the local certificate expires, as of the last check (negative once expired)",
+		},
+		[]string{"cn"},
+	)
+
+	// certExpiryScanErrors tracks failed expiry scans
+	certExpiryScanErrors = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "cert_expiry_scan_errors_total",
+			Help: "Total number of failed certificate expiry scans",
+		},
+	)
+)
+
+// recordExpiryScan publishes the result of an expiry scan
+func recordExpiryScan(expiring, expired int) {
+	certExpiring.WithLabelValues(string(ExpiryStateExpiring)).Set(float64(expiring))
+	certExpiring.WithLabelValues(string(ExpiryStateExpired)).Set(float64(expired))
+}
+
+// recordLocalExpiry publishes the remaining validity of a local certificate
+func recordLocalExpiry(commonName string, remaining time.Duration) {
+	certLocalExpiry.WithLabelValues(commonName).Set(remaining.Seconds())
+}
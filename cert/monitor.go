@@ -0,0 +1,140 @@
+package cert
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/houzhh15/sdp-common/clock"
+	"github.com/houzhh15/sdp-common/logging"
+)
+
+// defaultExpiryCheckInterval 本地证书默认每小时检查一次
+const defaultExpiryCheckInterval = time.Hour
+
+// ExpiryMonitorConfig 本地证书到期监控配置
+type ExpiryMonitorConfig struct {
+	// Threshold 剩余有效期低于该值时触发 OnExpiring（默认 DefaultExpiryWarning，30 天）
+	Threshold time.Duration
+	// Interval 检查间隔（默认 1 小时）
+	Interval time.Duration
+	// OnExpiring 进入即将到期或已过期状态时调用（每个状态只调用一次），可用于告警或触发证书续期
+	// 在监控 goroutine 中同步执行，耗时操作应自行异步处理
+	OnExpiring func(notice *ExpiryNotice)
+	Logger     logging.Logger
+	Clock      clock.Clock // 默认真实时钟
+}
+
+// ExpiryNotice 本地证书到期通知
+type ExpiryNotice struct {
+	Fingerprint string
+	Subject     string
+	NotAfter    time.Time
+	Remaining   time.Duration // 距到期时间，已过期为负
+	State       ExpiryState
+}
+
+// DaysRemaining 剩余整天数，已过期为负数
+func (n *ExpiryNotice) DaysRemaining() int {
+	return int(n.Remaining.Hours() / 24)
+}
+
+// ExpiryMonitor 定期检查 Manager 持有的本地证书：更新 cert_local_expiry_seconds 指标，
+// 剩余有效期低于阈值时回调 OnExpiring。IH/AH 等长期运行的进程据此在证书到期前告警或续期
+type ExpiryMonitor struct {
+	manager    *Manager
+	threshold  time.Duration
+	interval   time.Duration
+	onExpiring func(*ExpiryNotice)
+	logger     logging.Logger
+	clock      clock.Clock
+
+	mu       sync.Mutex
+	notified ExpiryState // 已通知的状态，未通知为空
+}
+
+// NewExpiryMonitor 创建本地证书到期监控
+func NewExpiryMonitor(manager *Manager, cfg *ExpiryMonitorConfig) *ExpiryMonitor {
+	if cfg == nil {
+		cfg = &ExpiryMonitorConfig{}
+	}
+	threshold := cfg.Threshold
+	if threshold <= 0 {
+		threshold = DefaultExpiryWarning
+	}
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = defaultExpiryCheckInterval
+	}
+
+	return &ExpiryMonitor{
+		manager:    manager,
+		threshold:  threshold,
+		interval:   interval,
+		onExpiring: cfg.OnExpiring,
+		logger:     cfg.Logger,
+		clock:      clock.Or(cfg.Clock),
+	}
+}
+
+// Run 启动时立即检查一次，之后按间隔检查直到 ctx 结束
+func (m *ExpiryMonitor) Run(ctx context.Context) {
+	m.Check()
+
+	ticker := m.clock.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			m.Check()
+		}
+	}
+}
+
+// Check 执行一次检查并返回当前状态；未进入阈值时返回 nil
+func (m *ExpiryMonitor) Check() *ExpiryNotice {
+	x509Cert := m.manager.GetX509Certificate()
+	remaining := x509Cert.NotAfter.Sub(m.clock.Now())
+	recordLocalExpiry(x509Cert.Subject.CommonName, remaining)
+
+	if remaining > m.threshold {
+		m.mu.Lock()
+		m.notified = ""
+		m.mu.Unlock()
+		return nil
+	}
+
+	notice := &ExpiryNotice{
+		Fingerprint: m.manager.GetFingerprint(),
+		Subject:     x509Cert.Subject.String(),
+		NotAfter:    x509Cert.NotAfter,
+		Remaining:   remaining,
+		State:       ExpiryStateExpiring,
+	}
+	if remaining <= 0 {
+		notice.State = ExpiryStateExpired
+	}
+
+	m.mu.Lock()
+	first := m.notified != notice.State
+	m.notified = notice.State
+	m.mu.Unlock()
+
+	if first {
+		if m.logger != nil {
+			m.logger.Warn("Local certificate expiry alert",
+				"fingerprint", notice.Fingerprint,
+				"subject", notice.Subject,
+				"state", notice.State,
+				"not_after", notice.NotAfter,
+				"days_remaining", notice.DaysRemaining())
+		}
+		if m.onExpiring != nil {
+			m.onExpiring(notice)
+		}
+	}
+	return notice
+}
@@ -0,0 +1,127 @@
+package cert
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+	"time"
+
+	"github.com/houzhh15/sdp-common/clock"
+	"github.com/houzhh15/sdp-common/leaktest"
+)
+
+func TestExpiryMonitor_Check(t *testing.T) {
+	clk := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	mgr := &Manager{x509Cert: &x509.Certificate{
+		Raw:      []byte("test-cert"),
+		Subject:  pkix.Name{CommonName: "ih-client-001"},
+		NotAfter: clk.Now().Add(40 * 24 * time.Hour),
+	}}
+
+	var notices []*ExpiryNotice
+	monitor := NewExpiryMonitor(mgr, &ExpiryMonitorConfig{
+		Clock:      clk,
+		OnExpiring: func(n *ExpiryNotice) { notices = append(notices, n) },
+	})
+
+	// 阈值（默认 30 天）之外不回调
+	if notice := monitor.Check(); notice != nil || len(notices) != 0 {
+		t.Fatalf("40 天时不应回调: %+v", notice)
+	}
+
+	clk.Advance(20 * 24 * time.Hour)
+	notice := monitor.Check()
+	if notice == nil || notice.State != ExpiryStateExpiring || notice.DaysRemaining() != 20 {
+		t.Fatalf("期望剩余 20 天的即将到期通知，实际: %+v", notice)
+	}
+	if notice.Fingerprint != mgr.GetFingerprint() {
+		t.Errorf("指纹错误: %s", notice.Fingerprint)
+	}
+
+	// 同一状态只回调一次
+	clk.Advance(24 * time.Hour)
+	monitor.Check()
+	if len(notices) != 1 {
+		t.Fatalf("同一状态应只回调一次，实际 %d 次", len(notices))
+	}
+
+	clk.Advance(20 * 24 * time.Hour)
+	if notice := monitor.Check(); notice.State != ExpiryStateExpired || notice.Remaining >= 0 {
+		t.Fatalf("期望已过期通知，实际: %+v", notice)
+	}
+	if len(notices) != 2 || notices[1].State != ExpiryStateExpired {
+		t.Fatalf("过期后应再次回调: %+v", notices)
+	}
+}
+
+func TestExpiryMonitor_Run(t *testing.T) {
+	clk := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	mgr := &Manager{x509Cert: &x509.Certificate{
+		Raw:      []byte("test-cert"),
+		NotAfter: clk.Now().Add(2 * time.Hour),
+	}}
+
+	notified := make(chan *ExpiryNotice, 2)
+	monitor := NewExpiryMonitor(mgr, &ExpiryMonitorConfig{
+		Threshold:  time.Hour,
+		Interval:   30 * time.Minute,
+		Clock:      clk,
+		OnExpiring: func(n *ExpiryNotice) { notified <- n },
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		monitor.Run(ctx)
+		close(done)
+	}()
+
+	// 启动时检查一次（剩余 2 小时，不回调），之后每 30 分钟检查
+	clk.BlockUntil(1)
+	clk.Advance(time.Hour)
+	select {
+	case n := <-notified:
+		if n.State != ExpiryStateExpiring {
+			t.Errorf("状态错误: %s", n.State)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("进入阈值后应回调")
+	}
+
+	cancel()
+	<-done
+}
+
+func TestExpiryMonitor_RunNoLeak(t *testing.T) {
+	leaktest.Check(t)
+
+	clk := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	mgr := &Manager{x509Cert: &x509.Certificate{
+		Raw:      []byte("test-cert"),
+		NotAfter: clk.Now().Add(30 * time.Minute),
+	}}
+	monitor := NewExpiryMonitor(mgr, &ExpiryMonitorConfig{
+		Threshold:  time.Hour,
+		Interval:   time.Minute,
+		Clock:      clk,
+		OnExpiring: func(*ExpiryNotice) {},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		monitor.Run(ctx)
+		close(done)
+	}()
+	clk.BlockUntil(1)
+	clk.Advance(time.Minute)
+
+	// ctx 结束后 Run 返回，ticker 停止
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Run did not return after ctx was cancelled")
+	}
+}
@@ -12,6 +12,9 @@ import (
 	"gorm.io/gorm"
 )
 
+// ErrCertRotated 证书已被轮换且重叠期已结束
+var ErrCertRotated = errors.New("certificate has been rotated")
+
 // Registry 证书注册表（数据库支持）
 type Registry struct {
 	db      *gorm.DB
@@ -26,14 +29,21 @@ type CertRecord struct {
 	Fingerprint  string    `gorm:"uniqueIndex;not null"`
 	ClientID     string    `gorm:"index"`
 	Subject      string    `gorm:"not null"`
+	CommonName   string    `gorm:"index"` // 未记录 Identity 时用于检测同一身份的冲突证书
+	Identity     string    `gorm:"index"` // 映射后的客户端身份（见 RegisterWithIdentity），用于检测同一身份的冲突证书
 	Issuer       string    `gorm:"not null"`
 	NotBefore    time.Time `gorm:"not null"`
 	NotAfter     time.Time `gorm:"not null"`
 	Status       string    `gorm:"default:'active'"`
 	RevokedAt    *time.Time
 	RevokeReason string
-	CreatedAt    time.Time
-	UpdatedAt    time.Time
+	LastSeenAt   *time.Time // 最近一次握手使用时间
+	// 证书轮换：新旧证书互相链接，旧证书在 OverlapUntil 之前仍可使用
+	PreviousFingerprint string `gorm:"index"`
+	SupersededBy        string `gorm:"index"`
+	OverlapUntil        *time.Time
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
 }
 
 // TableName 指定表名
@@ -41,6 +51,25 @@ func (CertRecord) TableName() string {
 	return "cert_records"
 }
 
+// toCertInfo 转换为CertInfo
+func (record *CertRecord) toCertInfo() *CertInfo {
+	return &CertInfo{
+		Fingerprint: record.Fingerprint,
+		ClientID:    record.ClientID,
+		Identity:    record.Identity,
+		Subject:     record.Subject,
+		Issuer:      record.Issuer,
+		NotBefore:   record.NotBefore,
+		NotAfter:    record.NotAfter,
+		Status:      CertStatus(record.Status),
+		LastSeenAt:  record.LastSeenAt,
+
+		PreviousFingerprint: record.PreviousFingerprint,
+		SupersededBy:        record.SupersededBy,
+		OverlapUntil:        record.OverlapUntil,
+	}
+}
+
 // NewRegistry 创建证书注册表
 func NewRegistry(db *gorm.DB, logger logging.Logger) (*Registry, error) {
 	if db == nil {
@@ -60,8 +89,14 @@ func NewRegistry(db *gorm.DB, logger logging.Logger) (*Registry, error) {
 	return registry, nil
 }
 
-// Register 注册证书
+// Register 注册证书，冲突检测按证书 CN 匹配身份
 func (r *Registry) Register(clientID, fingerprint string, cert *x509.Certificate) error {
+	return r.RegisterWithIdentity(clientID, "", fingerprint, cert)
+}
+
+// RegisterWithIdentity 注册证书并记录其映射后的客户端身份（如 SAN 邮箱或模板生成的 ClientID），
+// FindConflicts 按该身份匹配；identity 为空时按证书 CN 匹配
+func (r *Registry) RegisterWithIdentity(clientID, identity, fingerprint string, cert *x509.Certificate) error {
 	if fingerprint == "" {
 		return errors.New("fingerprint is required")
 	}
@@ -76,6 +111,8 @@ func (r *Registry) Register(clientID, fingerprint string, cert *x509.Certificate
 		Fingerprint: fingerprint,
 		ClientID:    clientID,
 		Subject:     cert.Subject.String(),
+		CommonName:  cert.Subject.CommonName,
+		Identity:    identity,
 		Issuer:      cert.Issuer.String(),
 		NotBefore:   cert.NotBefore,
 		NotAfter:    cert.NotAfter,
@@ -115,15 +152,187 @@ func (r *Registry) GetCertInfo(fingerprint string) (*CertInfo, error) {
 		return nil, fmt.Errorf("failed to query certificate: %w", result.Error)
 	}
 
-	return &CertInfo{
-		Fingerprint: record.Fingerprint,
-		ClientID:    record.ClientID,
-		Subject:     record.Subject,
-		Issuer:      record.Issuer,
-		NotBefore:   record.NotBefore,
-		NotAfter:    record.NotAfter,
-		Status:      CertStatus(record.Status),
-	}, nil
+	return record.toCertInfo(), nil
+}
+
+// Rotate 注册新证书并与旧证书链接（单个事务）
+// 新证书继承旧证书的 ClientID；旧证书在 overlap 时间内仍通过 Validate，之后返回 ErrCertRotated。
+// 旧证书必须处于活跃状态且尚未被轮换
+func (r *Registry) Rotate(oldFingerprint, newFingerprint string, newCert *x509.Certificate, overlap time.Duration) (*CertInfo, error) {
+	if oldFingerprint == "" || newFingerprint == "" {
+		return nil, errors.New("fingerprint is required")
+	}
+	if oldFingerprint == newFingerprint {
+		return nil, errors.New("new certificate must differ from the current one")
+	}
+	if newCert == nil {
+		return nil, errors.New("certificate is required")
+	}
+	if overlap < 0 {
+		return nil, errors.New("overlap must not be negative")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	overlapUntil := now.Add(overlap)
+	var created CertRecord
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var old CertRecord
+		if err := tx.Where("fingerprint = ?", oldFingerprint).First(&old).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("certificate not found: %s", oldFingerprint)
+			}
+			return fmt.Errorf("failed to query certificate: %w", err)
+		}
+		if old.Status != string(StatusActive) {
+			return fmt.Errorf("certificate is not active: %s (%s)", oldFingerprint, old.Status)
+		}
+		if old.SupersededBy != "" {
+			return fmt.Errorf("certificate already rotated to %s", old.SupersededBy)
+		}
+
+		created = CertRecord{
+			Fingerprint:         newFingerprint,
+			ClientID:            old.ClientID,
+			Subject:             newCert.Subject.String(),
+			CommonName:          newCert.Subject.CommonName,
+			Identity:            old.Identity,
+			Issuer:              newCert.Issuer.String(),
+			NotBefore:           newCert.NotBefore,
+			NotAfter:            newCert.NotAfter,
+			Status:              string(StatusActive),
+			PreviousFingerprint: oldFingerprint,
+		}
+		if err := tx.Create(&created).Error; err != nil {
+			return fmt.Errorf("failed to register certificate: %w", err)
+		}
+
+		return tx.Model(&CertRecord{}).
+			Where("id = ?", old.ID).
+			Updates(map[string]interface{}{
+				"superseded_by": newFingerprint,
+				"overlap_until": &overlapUntil,
+			}).Error
+	})
+	if err != nil {
+		if r.logger != nil {
+			r.logger.Error("Failed to rotate certificate", "fingerprint", oldFingerprint, "error", err)
+		}
+		return nil, err
+	}
+
+	if r.logger != nil {
+		r.logger.Info("Certificate rotated",
+			"old_fingerprint", oldFingerprint,
+			"new_fingerprint", newFingerprint,
+			"client_id", created.ClientID,
+			"overlap_until", overlapUntil)
+	}
+
+	return created.toCertInfo(), nil
+}
+
+// Touch 记录证书最近一次使用时间（握手成功后调用）
+func (r *Registry) Touch(fingerprint string) error {
+	if fingerprint == "" {
+		return errors.New("fingerprint is required")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	result := r.db.Model(&CertRecord{}).
+		Where("fingerprint = ?", fingerprint).
+		Update("last_seen_at", &now)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update last seen: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("certificate not found: %s", fingerprint)
+	}
+
+	return nil
+}
+
+// TouchBatch 在一个事务中批量记录证书最近使用时间（key: 指纹），未注册的指纹忽略
+// 用于合并高频握手产生的 last_seen_at 更新，降低 SQLite 写锁竞争
+func (r *Registry) TouchBatch(seen map[string]time.Time) error {
+	if len(seen) == 0 {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		for fingerprint, at := range seen {
+			if err := tx.Model(&CertRecord{}).
+				Where("fingerprint = ?", fingerprint).
+				Update("last_seen_at", &at).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update last seen: %w", err)
+	}
+	return nil
+}
+
+// FindConflicts 列出与指定身份相同但指纹不同的活跃证书，身份为注册时记录的 Identity（未记录时为证书 CN）
+// 与 fingerprint 直接轮换链接的证书、已过期证书以及重叠期已结束的旧证书不视为冲突
+func (r *Registry) FindConflicts(identity, fingerprint string) ([]*CertInfo, error) {
+	if identity == "" || fingerprint == "" {
+		return nil, errors.New("identity and fingerprint are required")
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := time.Now()
+	var records []CertRecord
+	result := r.db.Where("COALESCE(NULLIF(identity, ''), common_name) = ? AND fingerprint <> ? AND status = ? AND not_after > ?",
+		identity, fingerprint, string(StatusActive), now).
+		// 轮换字段对升级前注册的证书为 NULL，NULL <> ? 永不成立，需按空串比较
+		Where("COALESCE(superseded_by, '') <> ? AND COALESCE(previous_fingerprint, '') <> ?", fingerprint, fingerprint).
+		Where("superseded_by = '' OR superseded_by IS NULL OR overlap_until > ?", now).
+		Order("created_at").
+		Find(&records)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to query conflicting certificates: %w", result.Error)
+	}
+
+	infos := make([]*CertInfo, len(records))
+	for i := range records {
+		infos[i] = records[i].toCertInfo()
+	}
+
+	return infos, nil
+}
+
+// ExpiringBefore 列出在 deadline 之前到期的活跃证书（含已过期但尚未标记为 expired 的证书），按到期时间升序
+func (r *Registry) ExpiringBefore(deadline time.Time) ([]*CertInfo, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var records []CertRecord
+	result := r.db.Where("not_after < ? AND status = ?", deadline, string(StatusActive)).
+		Order("not_after").
+		Find(&records)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to query expiring certificates: %w", result.Error)
+	}
+
+	infos := make([]*CertInfo, len(records))
+	for i := range records {
+		infos[i] = records[i].toCertInfo()
+	}
+
+	return infos, nil
 }
 
 // Revoke 吊销证书
@@ -176,6 +385,9 @@ func (r *Registry) Validate(fingerprint string) error {
 
 	// 检查过期
 	now := time.Now()
+	if info.SupersededBy != "" && info.OverlapUntil != nil && now.After(*info.OverlapUntil) {
+		return fmt.Errorf("%w: %s (replaced by %s)", ErrCertRotated, fingerprint, info.SupersededBy)
+	}
 	if now.Before(info.NotBefore) {
 		return fmt.Errorf("certificate not yet valid: %s", fingerprint)
 	}
@@ -214,16 +426,8 @@ func (r *Registry) List(page, pageSize int, status CertStatus) ([]*CertInfo, int
 
 	// 转换为CertInfo
 	infos := make([]*CertInfo, len(records))
-	for i, record := range records {
-		infos[i] = &CertInfo{
-			Fingerprint: record.Fingerprint,
-			ClientID:    record.ClientID,
-			Subject:     record.Subject,
-			Issuer:      record.Issuer,
-			NotBefore:   record.NotBefore,
-			NotAfter:    record.NotAfter,
-			Status:      CertStatus(record.Status),
-		}
+	for i := range records {
+		infos[i] = records[i].toCertInfo()
 	}
 
 	return infos, total, nil
@@ -0,0 +1,199 @@
+package cert
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/houzhh15/sdp-common/clock"
+	"github.com/houzhh15/sdp-common/logging"
+)
+
+// ExpiryState 证书到期状态
+type ExpiryState string
+
+const (
+	ExpiryStateExpiring ExpiryState = "expiring" // 在告警窗口内即将到期
+	ExpiryStateExpired  ExpiryState = "expired"  // 已过期（注册表状态仍为 active）
+)
+
+const (
+	// DefaultExpiryWarning 默认提前 30 天告警
+	DefaultExpiryWarning = 30 * 24 * time.Hour
+	// defaultExpiryScanInterval 默认每小时扫描一次
+	defaultExpiryScanInterval = time.Hour
+)
+
+// ExpiryScannerConfig 证书到期扫描配置
+type ExpiryScannerConfig struct {
+	Warning  time.Duration       // 提前告警窗口（默认 30 天）
+	Interval time.Duration       // 扫描间隔（默认 1 小时）
+	Audit    logging.AuditLogger // 可选：告警写入 SecurityEvent
+	Logger   logging.Logger
+	Clock    clock.Clock // 默认真实时钟
+}
+
+// ExpiringCert 扫描发现的即将到期/已过期证书
+type ExpiringCert struct {
+	*CertInfo
+	State     ExpiryState   `json:"state"`
+	Remaining time.Duration `json:"-"` // 距到期时间，已过期为负
+}
+
+// ExpiryScanner 定期扫描注册表中的证书到期时间，发出告警与指标
+// 同一证书的同一状态只告警一次；证书续期或吊销后不再出现在扫描结果中
+type ExpiryScanner struct {
+	registry *Registry
+	warning  time.Duration
+	interval time.Duration
+	audit    logging.AuditLogger
+	logger   logging.Logger
+	clock    clock.Clock
+
+	mu      sync.Mutex
+	alerted map[string]ExpiryState // 指纹 -> 已告警状态
+}
+
+// NewExpiryScanner 创建证书到期扫描器
+func NewExpiryScanner(registry *Registry, cfg *ExpiryScannerConfig) *ExpiryScanner {
+	if cfg == nil {
+		cfg = &ExpiryScannerConfig{}
+	}
+	warning := cfg.Warning
+	if warning <= 0 {
+		warning = DefaultExpiryWarning
+	}
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = defaultExpiryScanInterval
+	}
+
+	return &ExpiryScanner{
+		registry: registry,
+		warning:  warning,
+		interval: interval,
+		audit:    cfg.Audit,
+		logger:   cfg.Logger,
+		clock:    clock.Or(cfg.Clock),
+		alerted:  make(map[string]ExpiryState),
+	}
+}
+
+// Warning 返回告警窗口
+func (s *ExpiryScanner) Warning() time.Duration {
+	return s.warning
+}
+
+// Run 启动时立即扫描一次，之后按间隔扫描直到 ctx 结束
+func (s *ExpiryScanner) Run(ctx context.Context) {
+	s.scanAndLog(ctx)
+
+	ticker := s.clock.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			s.scanAndLog(ctx)
+		}
+	}
+}
+
+func (s *ExpiryScanner) scanAndLog(ctx context.Context) {
+	if _, err := s.Scan(ctx); err != nil && s.logger != nil {
+		s.logger.Error("Certificate expiry scan failed", "error", err)
+	}
+}
+
+// Scan 执行一次扫描，返回告警窗口内（含已过期）的活跃证书，按到期时间升序
+func (s *ExpiryScanner) Scan(ctx context.Context) ([]*ExpiringCert, error) {
+	now := s.clock.Now()
+	certs, err := s.registry.ExpiringBefore(now.Add(s.warning))
+	if err != nil {
+		certExpiryScanErrors.Inc()
+		return nil, err
+	}
+
+	result := make([]*ExpiringCert, 0, len(certs))
+	expiring, expired := 0, 0
+	for _, info := range certs {
+		remaining := info.NotAfter.Sub(now)
+		state := ExpiryStateExpiring
+		if remaining <= 0 {
+			state = ExpiryStateExpired
+			expired++
+		} else {
+			expiring++
+		}
+		result = append(result, &ExpiringCert{CertInfo: info, State: state, Remaining: remaining})
+	}
+	recordExpiryScan(expiring, expired)
+
+	s.mu.Lock()
+	seen := make(map[string]bool, len(result))
+	var alerts []*ExpiringCert
+	for _, c := range result {
+		seen[c.Fingerprint] = true
+		if s.alerted[c.Fingerprint] != c.State {
+			s.alerted[c.Fingerprint] = c.State
+			alerts = append(alerts, c)
+		}
+	}
+	for fingerprint := range s.alerted {
+		if !seen[fingerprint] {
+			delete(s.alerted, fingerprint)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, c := range alerts {
+		s.alert(ctx, c, now)
+	}
+
+	return result, nil
+}
+
+// alert 记录日志并写入安全事件
+func (s *ExpiryScanner) alert(ctx context.Context, c *ExpiringCert, now time.Time) {
+	daysRemaining := int(c.Remaining.Hours() / 24)
+
+	eventType := logging.EventCertExpiring
+	severity := logging.SeverityMedium
+	message := fmt.Sprintf("certificate expires in %d days", daysRemaining)
+	if c.State == ExpiryStateExpired {
+		eventType = logging.EventCertExpired
+		severity = logging.SeverityHigh
+		message = "certificate has expired"
+	}
+
+	if s.logger != nil {
+		s.logger.Warn("Certificate expiry alert",
+			"fingerprint", c.Fingerprint,
+			"client_id", c.ClientID,
+			"state", c.State,
+			"not_after", c.NotAfter)
+	}
+
+	if s.audit == nil {
+		return
+	}
+	err := s.audit.LogSecurity(ctx, &logging.SecurityEvent{
+		Timestamp: now,
+		ClientID:  c.ClientID,
+		EventType: eventType,
+		Severity:  severity,
+		Message:   message,
+		Details: map[string]interface{}{
+			"fingerprint":    c.Fingerprint,
+			"subject":        c.Subject,
+			"not_after":      c.NotAfter,
+			"days_remaining": daysRemaining,
+		},
+	})
+	if err != nil && s.logger != nil {
+		s.logger.Warn("Failed to write certificate expiry event", "fingerprint", c.Fingerprint, "error", err)
+	}
+}
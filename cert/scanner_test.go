@@ -0,0 +1,313 @@
+package cert
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/houzhh15/sdp-common/clock"
+	"github.com/houzhh15/sdp-common/logging"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// recordingAudit 记录安全事件的审计日志
+type recordingAudit struct {
+	events []*logging.SecurityEvent
+}
+
+func (a *recordingAudit) LogAccess(ctx context.Context, event *logging.AccessEvent) error {
+	return nil
+}
+
+func (a *recordingAudit) LogConnection(ctx context.Context, event *logging.ConnectionEvent) error {
+	return nil
+}
+
+func (a *recordingAudit) LogSecurity(ctx context.Context, event *logging.SecurityEvent) error {
+	a.events = append(a.events, event)
+	return nil
+}
+
+func (a *recordingAudit) Query(ctx context.Context, filter *logging.AuditFilter) ([]*logging.AuditLog, error) {
+	return nil, nil
+}
+
+func newTestRegistry(t *testing.T) *Registry {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("打开测试数据库失败: %v", err)
+	}
+	registry, err := NewRegistry(db, nil)
+	if err != nil {
+		t.Fatalf("NewRegistry失败: %v", err)
+	}
+	return registry
+}
+
+func registerTestCert(t *testing.T, r *Registry, clientID, fingerprint string, notAfter time.Time) {
+	cert := &x509.Certificate{
+		Subject:   pkix.Name{CommonName: clientID},
+		Issuer:    pkix.Name{CommonName: "test-ca"},
+		NotBefore: notAfter.Add(-365 * 24 * time.Hour),
+		NotAfter:  notAfter,
+	}
+	if err := r.Register(clientID, fingerprint, cert); err != nil {
+		t.Fatalf("Register失败: %v", err)
+	}
+}
+
+func TestRegistry_TouchAndExpiringBefore(t *testing.T) {
+	r := newTestRegistry(t)
+	now := time.Now()
+	registerTestCert(t, r, "ih-soon", "fp-soon", now.Add(10*24*time.Hour))
+	registerTestCert(t, r, "ih-later", "fp-later", now.Add(90*24*time.Hour))
+	registerTestCert(t, r, "ih-revoked", "fp-revoked", now.Add(5*24*time.Hour))
+	if err := r.Revoke("fp-revoked", "compromised"); err != nil {
+		t.Fatalf("Revoke失败: %v", err)
+	}
+
+	certs, err := r.ExpiringBefore(now.Add(30 * 24 * time.Hour))
+	if err != nil {
+		t.Fatalf("ExpiringBefore失败: %v", err)
+	}
+	if len(certs) != 1 || certs[0].Fingerprint != "fp-soon" {
+		t.Fatalf("期望仅返回 fp-soon，实际: %+v", certs)
+	}
+
+	if err := r.Touch("fp-soon"); err != nil {
+		t.Fatalf("Touch失败: %v", err)
+	}
+	info, err := r.GetCertInfo("fp-soon")
+	if err != nil {
+		t.Fatalf("GetCertInfo失败: %v", err)
+	}
+	if info.LastSeenAt == nil {
+		t.Error("Touch后 LastSeenAt 不应为空")
+	}
+	if err := r.Touch("fp-missing"); err == nil {
+		t.Error("未注册证书 Touch 应返回错误")
+	}
+
+	// 批量更新，未注册指纹忽略
+	seenAt := now.Add(time.Minute).Truncate(time.Second)
+	if err := r.TouchBatch(map[string]time.Time{"fp-soon": seenAt, "fp-later": seenAt, "fp-missing": seenAt}); err != nil {
+		t.Fatalf("TouchBatch失败: %v", err)
+	}
+	for _, fp := range []string{"fp-soon", "fp-later"} {
+		info, err := r.GetCertInfo(fp)
+		if err != nil {
+			t.Fatalf("GetCertInfo失败: %v", err)
+		}
+		if info.LastSeenAt == nil || !info.LastSeenAt.Equal(seenAt) {
+			t.Errorf("%s: 期望 LastSeenAt=%v，实际: %v", fp, seenAt, info.LastSeenAt)
+		}
+	}
+}
+
+func TestExpiryScanner_Scan(t *testing.T) {
+	r := newTestRegistry(t)
+	clk := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	registerTestCert(t, r, "ih-soon", "fp-soon", clk.Now().Add(10*24*time.Hour))
+	registerTestCert(t, r, "ih-later", "fp-later", clk.Now().Add(90*24*time.Hour))
+
+	audit := &recordingAudit{}
+	scanner := NewExpiryScanner(r, &ExpiryScannerConfig{Audit: audit, Clock: clk})
+
+	certs, err := scanner.Scan(context.Background())
+	if err != nil {
+		t.Fatalf("Scan失败: %v", err)
+	}
+	if len(certs) != 1 || certs[0].State != ExpiryStateExpiring {
+		t.Fatalf("期望 1 个即将到期证书，实际: %+v", certs)
+	}
+	if len(audit.events) != 1 || audit.events[0].EventType != logging.EventCertExpiring {
+		t.Fatalf("期望 1 个 cert_expiring 事件，实际: %+v", audit.events)
+	}
+	if days := audit.events[0].Details["days_remaining"]; days != 10 {
+		t.Errorf("期望 days_remaining=10，实际: %v", days)
+	}
+
+	// 同一状态不重复告警
+	if _, err := scanner.Scan(context.Background()); err != nil {
+		t.Fatalf("Scan失败: %v", err)
+	}
+	if len(audit.events) != 1 {
+		t.Errorf("同一状态不应重复告警，事件数: %d", len(audit.events))
+	}
+
+	// 过期后升级为 cert_expired
+	clk.Advance(11 * 24 * time.Hour)
+	certs, err = scanner.Scan(context.Background())
+	if err != nil {
+		t.Fatalf("Scan失败: %v", err)
+	}
+	if len(certs) != 1 || certs[0].State != ExpiryStateExpired {
+		t.Fatalf("期望 1 个已过期证书，实际: %+v", certs)
+	}
+	if len(audit.events) != 2 || audit.events[1].EventType != logging.EventCertExpired || audit.events[1].Severity != logging.SeverityHigh {
+		t.Errorf("期望追加 cert_expired 高危事件，实际: %+v", audit.events)
+	}
+}
+
+func TestRegistry_Rotate(t *testing.T) {
+	r := newTestRegistry(t)
+	now := time.Now()
+	registerTestCert(t, r, "ih-1", "fp-old", now.Add(10*24*time.Hour))
+
+	newCert := &x509.Certificate{
+		Subject:   pkix.Name{CommonName: "ih-1"},
+		Issuer:    pkix.Name{CommonName: "test-ca"},
+		NotBefore: now.Add(-time.Minute),
+		NotAfter:  now.Add(365 * 24 * time.Hour),
+	}
+	info, err := r.Rotate("fp-old", "fp-new", newCert, time.Hour)
+	if err != nil {
+		t.Fatalf("Rotate失败: %v", err)
+	}
+	if info.ClientID != "ih-1" || info.PreviousFingerprint != "fp-old" {
+		t.Fatalf("新证书应继承 ClientID 并链接旧证书，实际: %+v", info)
+	}
+
+	// 重叠期内新旧证书均有效
+	if err := r.Validate("fp-old"); err != nil {
+		t.Errorf("重叠期内旧证书应有效: %v", err)
+	}
+	if err := r.Validate("fp-new"); err != nil {
+		t.Errorf("新证书应有效: %v", err)
+	}
+	old, err := r.GetCertInfo("fp-old")
+	if err != nil {
+		t.Fatalf("GetCertInfo失败: %v", err)
+	}
+	if old.SupersededBy != "fp-new" || old.OverlapUntil == nil {
+		t.Errorf("旧证书应记录替换关系，实际: %+v", old)
+	}
+
+	// 同一证书不可重复轮换
+	if _, err := r.Rotate("fp-old", "fp-other", newCert, time.Hour); err == nil {
+		t.Error("已轮换证书再次轮换应返回错误")
+	}
+	if _, err := r.Rotate("fp-missing", "fp-other", newCert, time.Hour); err == nil {
+		t.Error("未注册证书轮换应返回错误")
+	}
+
+	// 重叠期为 0 时旧证书立即失效
+	registerTestCert(t, r, "ih-2", "fp-2-old", now.Add(10*24*time.Hour))
+	if _, err := r.Rotate("fp-2-old", "fp-2-new", newCert, 0); err != nil {
+		t.Fatalf("Rotate失败: %v", err)
+	}
+	if err := r.Validate("fp-2-old"); !errors.Is(err, ErrCertRotated) {
+		t.Errorf("重叠期结束后应返回 ErrCertRotated，实际: %v", err)
+	}
+}
+
+func TestRegistry_FindConflicts(t *testing.T) {
+	r := newTestRegistry(t)
+	now := time.Now()
+	registerTestCert(t, r, "ih-1", "fp-a", now.Add(10*24*time.Hour))
+
+	conflicts, err := r.FindConflicts("ih-1", "fp-a")
+	if err != nil {
+		t.Fatalf("FindConflicts失败: %v", err)
+	}
+	if len(conflicts) != 0 {
+		t.Fatalf("单张证书不应冲突，实际: %d", len(conflicts))
+	}
+
+	// 同一 CN 的第二张证书与第一张互为冲突
+	registerTestCert(t, r, "ih-1", "fp-b", now.Add(10*24*time.Hour))
+	conflicts, err = r.FindConflicts("ih-1", "fp-b")
+	if err != nil {
+		t.Fatalf("FindConflicts失败: %v", err)
+	}
+	if len(conflicts) != 1 || conflicts[0].Fingerprint != "fp-a" {
+		t.Fatalf("应检测到 fp-a 冲突，实际: %+v", conflicts)
+	}
+
+	// 已吊销证书不再冲突
+	if err := r.Revoke("fp-a", "duplicate identity"); err != nil {
+		t.Fatalf("Revoke失败: %v", err)
+	}
+	if conflicts, _ = r.FindConflicts("ih-1", "fp-b"); len(conflicts) != 0 {
+		t.Errorf("已吊销证书不应冲突，实际: %+v", conflicts)
+	}
+
+	// 轮换链上的新旧证书不视为冲突
+	newCert := &x509.Certificate{
+		Subject:   pkix.Name{CommonName: "ih-1"},
+		Issuer:    pkix.Name{CommonName: "test-ca"},
+		NotBefore: now.Add(-time.Minute),
+		NotAfter:  now.Add(365 * 24 * time.Hour),
+	}
+	if _, err := r.Rotate("fp-b", "fp-c", newCert, time.Hour); err != nil {
+		t.Fatalf("Rotate失败: %v", err)
+	}
+	if conflicts, _ = r.FindConflicts("ih-1", "fp-c"); len(conflicts) != 0 {
+		t.Errorf("轮换中的旧证书不应冲突，实际: %+v", conflicts)
+	}
+	if conflicts, _ = r.FindConflicts("ih-1", "fp-d"); len(conflicts) != 2 {
+		t.Errorf("未注册证书应与重叠期内的两张证书冲突，实际: %d", len(conflicts))
+	}
+}
+
+func TestRegistry_FindConflictsLegacyRows(t *testing.T) {
+	r := newTestRegistry(t)
+	registerTestCert(t, r, "ih-1", "fp-a", time.Now().Add(10*24*time.Hour))
+
+	// 轮换字段由 AutoMigrate 添加到既有表，升级前注册的证书这两列为 NULL
+	if err := r.db.Model(&CertRecord{}).Where("fingerprint = ?", "fp-a").Updates(map[string]interface{}{
+		"superseded_by":        gorm.Expr("NULL"),
+		"previous_fingerprint": gorm.Expr("NULL"),
+	}).Error; err != nil {
+		t.Fatalf("清空轮换字段失败: %v", err)
+	}
+
+	conflicts, err := r.FindConflicts("ih-1", "fp-b")
+	if err != nil {
+		t.Fatalf("FindConflicts失败: %v", err)
+	}
+	if len(conflicts) != 1 || conflicts[0].Fingerprint != "fp-a" {
+		t.Fatalf("轮换字段为 NULL 的证书应检测为冲突，实际: %+v", conflicts)
+	}
+}
+
+func TestRegistry_FindConflictsByIdentity(t *testing.T) {
+	r := newTestRegistry(t)
+	notAfter := time.Now().Add(10 * 24 * time.Hour)
+	newCert := func(cn string) *x509.Certificate {
+		return &x509.Certificate{
+			Subject:   pkix.Name{CommonName: cn},
+			Issuer:    pkix.Name{CommonName: "test-ca"},
+			NotBefore: notAfter.Add(-365 * 24 * time.Hour),
+			NotAfter:  notAfter,
+		}
+	}
+	if err := r.RegisterWithIdentity("client-1", "alice@example.com", "fp-a", newCert("Alice")); err != nil {
+		t.Fatalf("RegisterWithIdentity失败: %v", err)
+	}
+	// 未记录身份的证书按 CN 匹配
+	registerTestCert(t, r, "bob@example.com", "fp-b", notAfter)
+
+	if conflicts, _ := r.FindConflicts("alice@example.com", "fp-c"); len(conflicts) != 1 || conflicts[0].Fingerprint != "fp-a" {
+		t.Errorf("应按身份检测到 fp-a 冲突，实际: %+v", conflicts)
+	}
+	if conflicts, _ := r.FindConflicts("Alice", "fp-c"); len(conflicts) != 0 {
+		t.Errorf("记录了身份的证书不应再按 CN 匹配，实际: %+v", conflicts)
+	}
+	if conflicts, _ := r.FindConflicts("bob@example.com", "fp-c"); len(conflicts) != 1 || conflicts[0].Fingerprint != "fp-b" {
+		t.Errorf("未记录身份的证书应按 CN 匹配，实际: %+v", conflicts)
+	}
+
+	// 轮换后的新证书继承身份
+	if _, err := r.Rotate("fp-a", "fp-a2", newCert("Alice Laptop"), time.Hour); err != nil {
+		t.Fatalf("Rotate失败: %v", err)
+	}
+	info, err := r.GetCertInfo("fp-a2")
+	if err != nil || info.Identity != "alice@example.com" {
+		t.Errorf("轮换后的证书应继承身份，实际: %+v, %v", info, err)
+	}
+}
@@ -0,0 +1,233 @@
+package cert
+
+import (
+	"crypto/tls"
+	"fmt"
+	"strings"
+)
+
+// TLSPolicy TLS 协议版本、密码套件与曲线策略，应用到 Manager 及各传输层服务生成的 tls.Config
+type TLSPolicy struct {
+	MinVersion uint16 // 默认 TLS 1.2，不允许低于 TLS 1.2
+	MaxVersion uint16 // 0 表示不限制（当前为 TLS 1.3）
+	// CipherSuites TLS 1.2 密码套件（TLS 1.3 套件由 Go 固定，不可配置），为空使用 DefaultCipherSuites
+	CipherSuites []uint16
+	// CurvePreferences 密钥交换曲线优先顺序，为空使用 DefaultCurvePreferences
+	CurvePreferences []tls.CurveID
+}
+
+// DefaultCipherSuites 默认 TLS 1.2 密码套件：仅 ECDHE 前向保密 + AEAD
+var DefaultCipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+}
+
+// DefaultCurvePreferences 默认曲线顺序（优先后量子混合密钥交换）
+var DefaultCurvePreferences = []tls.CurveID{
+	tls.X25519MLKEM768,
+	tls.X25519,
+	tls.CurveP256,
+	tls.CurveP384,
+}
+
+var tlsVersions = map[string]uint16{
+	"TLS1.2": tls.VersionTLS12,
+	"TLS1.3": tls.VersionTLS13,
+}
+
+var curveNames = map[string]tls.CurveID{
+	"X25519MLKEM768": tls.X25519MLKEM768,
+	"X25519":         tls.X25519,
+	"P256":           tls.CurveP256,
+	"P384":           tls.CurveP384,
+	"P521":           tls.CurveP521,
+}
+
+// DefaultTLSPolicy 返回默认策略：TLS 1.2 起，默认密码套件与曲线
+func DefaultTLSPolicy() *TLSPolicy {
+	return &TLSPolicy{
+		MinVersion:       tls.VersionTLS12,
+		CipherSuites:     append([]uint16(nil), DefaultCipherSuites...),
+		CurvePreferences: append([]tls.CurveID(nil), DefaultCurvePreferences...),
+	}
+}
+
+// ParseTLSPolicy 从配置字符串构建策略并校验，空值使用默认值
+// 版本写作 "TLS1.2" / "TLS1.3"（也接受 "1.2"）；密码套件使用 IANA 名称（如 TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256）；
+// 曲线写作 X25519MLKEM768、X25519、P256、P384、P521（也接受 P-256 形式）
+func ParseTLSPolicy(minVersion, maxVersion string, cipherSuites, curves []string) (*TLSPolicy, error) {
+	policy := DefaultTLSPolicy()
+
+	if minVersion != "" {
+		v, err := ParseTLSVersion(minVersion)
+		if err != nil {
+			return nil, fmt.Errorf("min_version: %w", err)
+		}
+		policy.MinVersion = v
+	}
+	if maxVersion != "" {
+		v, err := ParseTLSVersion(maxVersion)
+		if err != nil {
+			return nil, fmt.Errorf("max_version: %w", err)
+		}
+		policy.MaxVersion = v
+	}
+
+	if len(cipherSuites) > 0 {
+		policy.CipherSuites = policy.CipherSuites[:0]
+		for _, name := range cipherSuites {
+			id, err := parseCipherSuite(name)
+			if err != nil {
+				return nil, err
+			}
+			policy.CipherSuites = append(policy.CipherSuites, id)
+		}
+	}
+
+	if len(curves) > 0 {
+		policy.CurvePreferences = policy.CurvePreferences[:0]
+		for _, name := range curves {
+			id, ok := curveNames[strings.ReplaceAll(strings.ToUpper(strings.TrimSpace(name)), "-", "")]
+			if !ok {
+				return nil, fmt.Errorf("unsupported curve %q", name)
+			}
+			policy.CurvePreferences = append(policy.CurvePreferences, id)
+		}
+	}
+
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// ParseTLSVersion 解析 "TLS1.2" / "TLS1.3"（大小写、"TLS 1.2"、"1.2" 均可）
+func ParseTLSVersion(s string) (uint16, error) {
+	name := strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(s), " ", ""))
+	if !strings.HasPrefix(name, "TLS") {
+		name = "TLS" + name
+	}
+	v, ok := tlsVersions[name]
+	if !ok {
+		return 0, fmt.Errorf("unsupported TLS version %q (want TLS1.2 or TLS1.3)", s)
+	}
+	return v, nil
+}
+
+// parseCipherSuite 按 IANA 名称查找安全的密码套件
+func parseCipherSuite(name string) (uint16, error) {
+	name = strings.TrimSpace(name)
+	for _, suite := range tls.InsecureCipherSuites() {
+		if suite.Name == name {
+			return 0, fmt.Errorf("cipher suite %s is insecure", name)
+		}
+	}
+	for _, suite := range tls.CipherSuites() {
+		if suite.Name != name {
+			continue
+		}
+		for _, v := range suite.SupportedVersions {
+			if v == tls.VersionTLS12 {
+				return suite.ID, nil
+			}
+		}
+		return 0, fmt.Errorf("cipher suite %s is TLS 1.3 only and not configurable", name)
+	}
+	return 0, fmt.Errorf("unknown cipher suite %q", name)
+}
+
+// Validate 校验版本范围与套件/曲线
+func (p *TLSPolicy) Validate() error {
+	if p.MinVersion != 0 && p.MinVersion < tls.VersionTLS12 {
+		return fmt.Errorf("min TLS version %s is not allowed (minimum TLS1.2)", tls.VersionName(p.MinVersion))
+	}
+	if p.MaxVersion != 0 && p.MaxVersion < tls.VersionTLS12 {
+		return fmt.Errorf("max TLS version %s is not allowed (minimum TLS1.2)", tls.VersionName(p.MaxVersion))
+	}
+	if p.MaxVersion != 0 && p.MinVersion > p.MaxVersion {
+		return fmt.Errorf("min TLS version %s is above max version %s", tls.VersionName(p.MinVersion), tls.VersionName(p.MaxVersion))
+	}
+	for _, id := range p.CipherSuites {
+		if _, err := parseCipherSuite(tls.CipherSuiteName(id)); err != nil {
+			return err
+		}
+	}
+	for _, id := range p.CurvePreferences {
+		if _, ok := curveNames[curveName(id)]; !ok {
+			return fmt.Errorf("unsupported curve %s", id)
+		}
+	}
+	return nil
+}
+
+// Apply 将策略写入 tls.Config（零值字段使用默认值）
+func (p *TLSPolicy) Apply(config *tls.Config) {
+	config.MinVersion = p.MinVersion
+	if config.MinVersion == 0 {
+		config.MinVersion = tls.VersionTLS12
+	}
+	config.MaxVersion = p.MaxVersion
+
+	// 复制切片，调用方修改 tls.Config 不影响策略本身
+	suites := p.CipherSuites
+	if len(suites) == 0 {
+		suites = DefaultCipherSuites
+	}
+	config.CipherSuites = append([]uint16(nil), suites...)
+
+	curves := p.CurvePreferences
+	if len(curves) == 0 {
+		curves = DefaultCurvePreferences
+	}
+	config.CurvePreferences = append([]tls.CurveID(nil), curves...)
+}
+
+// LogFields 生效策略的日志字段（启动时记录）
+func (p *TLSPolicy) LogFields() []interface{} {
+	effective := &tls.Config{}
+	p.Apply(effective)
+
+	maxVersion := "TLS1.3"
+	if effective.MaxVersion != 0 {
+		maxVersion = tlsVersionName(effective.MaxVersion)
+	}
+	ciphers := make([]string, 0, len(effective.CipherSuites))
+	for _, id := range effective.CipherSuites {
+		ciphers = append(ciphers, tls.CipherSuiteName(id))
+	}
+	curves := make([]string, 0, len(effective.CurvePreferences))
+	for _, id := range effective.CurvePreferences {
+		curves = append(curves, curveName(id))
+	}
+
+	return []interface{}{
+		"min_version", tlsVersionName(effective.MinVersion),
+		"max_version", maxVersion,
+		"cipher_suites", strings.Join(ciphers, ","),
+		"curves", strings.Join(curves, ","),
+	}
+}
+
+// tlsVersionName 以配置写法（TLS1.2）返回版本名
+func tlsVersionName(v uint16) string {
+	for name, id := range tlsVersions {
+		if id == v {
+			return name
+		}
+	}
+	return tls.VersionName(v)
+}
+
+// curveName 以配置写法返回曲线名
+func curveName(id tls.CurveID) string {
+	for name, c := range curveNames {
+		if c == id {
+			return name
+		}
+	}
+	return id.String()
+}
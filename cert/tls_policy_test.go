@@ -0,0 +1,66 @@
+package cert
+
+import (
+	"crypto/tls"
+	"strings"
+	"testing"
+)
+
+func TestParseTLSPolicy(t *testing.T) {
+	policy, err := ParseTLSPolicy("tls1.3", "", []string{"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384"}, []string{"X25519", "P-256"})
+	if err != nil {
+		t.Fatalf("ParseTLSPolicy失败: %v", err)
+	}
+	if policy.MinVersion != tls.VersionTLS13 {
+		t.Errorf("MinVersion错误: %x", policy.MinVersion)
+	}
+	if len(policy.CipherSuites) != 1 || policy.CipherSuites[0] != tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384 {
+		t.Errorf("CipherSuites错误: %v", policy.CipherSuites)
+	}
+	if len(policy.CurvePreferences) != 2 || policy.CurvePreferences[1] != tls.CurveP256 {
+		t.Errorf("CurvePreferences错误: %v", policy.CurvePreferences)
+	}
+
+	invalid := []struct {
+		name       string
+		minVersion string
+		maxVersion string
+		ciphers    []string
+		curves     []string
+	}{
+		{name: "TLS 1.1", minVersion: "TLS1.1"},
+		{name: "min高于max", minVersion: "TLS1.3", maxVersion: "TLS1.2"},
+		{name: "不安全套件", ciphers: []string{"TLS_RSA_WITH_RC4_128_SHA"}},
+		{name: "TLS 1.3套件", ciphers: []string{"TLS_AES_128_GCM_SHA256"}},
+		{name: "未知套件", ciphers: []string{"TLS_FOO"}},
+		{name: "未知曲线", curves: []string{"P192"}},
+	}
+	for _, tt := range invalid {
+		if _, err := ParseTLSPolicy(tt.minVersion, tt.maxVersion, tt.ciphers, tt.curves); err == nil {
+			t.Errorf("%s: 应返回错误", tt.name)
+		}
+	}
+}
+
+func TestTLSPolicy_Apply(t *testing.T) {
+	config := &tls.Config{}
+	(&TLSPolicy{MaxVersion: tls.VersionTLS12}).Apply(config)
+
+	if config.MinVersion != tls.VersionTLS12 || config.MaxVersion != tls.VersionTLS12 {
+		t.Errorf("版本错误: min=%x max=%x", config.MinVersion, config.MaxVersion)
+	}
+	if len(config.CipherSuites) != len(DefaultCipherSuites) {
+		t.Errorf("未使用默认密码套件: %v", config.CipherSuites)
+	}
+
+	// 修改 tls.Config 不影响默认列表
+	config.CipherSuites[0] = 0
+	if DefaultCipherSuites[0] == 0 {
+		t.Error("Apply未复制密码套件切片")
+	}
+
+	fields := DefaultTLSPolicy().LogFields()
+	if fields[1] != "TLS1.2" || fields[3] != "TLS1.3" || !strings.Contains(fields[7].(string), "X25519") {
+		t.Errorf("LogFields错误: %v", fields)
+	}
+}
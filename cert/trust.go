@@ -0,0 +1,216 @@
+package cert
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrCANotFound 信任集中不存在该指纹的 CA
+	ErrCANotFound = errors.New("CA not found in trust store")
+	// ErrLastCA 不允许移除最后一张 CA（空信任集会退回系统根证书）
+	ErrLastCA = errors.New("cannot remove the last CA from trust store")
+)
+
+// caBundleExts CA 目录中加载的文件扩展名
+var caBundleExts = map[string]bool{".pem": true, ".crt": true, ".cer": true}
+
+// TrustStore 可在运行时增删的 CA 信任集，用于 CA 轮换：先加入新 CA，全部证书换发后再移除旧 CA
+// 每次变更生成新的 x509.CertPool，已取得的证书池不受影响
+type TrustStore struct {
+	mu   sync.Mutex
+	cas  map[string]*x509.Certificate // 指纹 -> CA 证书
+	pool atomic.Pointer[x509.CertPool]
+}
+
+// NewTrustStore 创建空信任集
+func NewTrustStore() *TrustStore {
+	return &TrustStore{cas: make(map[string]*x509.Certificate)}
+}
+
+// LoadTrustStore 从 CA 文件（可含多张证书的 bundle）与目录（*.pem、*.crt、*.cer）加载信任集
+func LoadTrustStore(files, dirs []string) (*TrustStore, error) {
+	store := NewTrustStore()
+	for _, file := range files {
+		if _, err := store.AddFile(file); err != nil {
+			return nil, err
+		}
+	}
+	for _, dir := range dirs {
+		if _, err := store.AddDir(dir); err != nil {
+			return nil, err
+		}
+	}
+	return store, nil
+}
+
+// AddPEM 加入 PEM 中的全部证书，返回新加入的 CA 指纹（已存在的 CA 不重复加入）
+func (s *TrustStore) AddPEM(data []byte) ([]string, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		c, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse CA certificate: %w", err)
+		}
+		certs = append(certs, c)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no CA certificate found in PEM")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	added := make([]string, 0, len(certs))
+	for _, c := range certs {
+		fingerprint := caFingerprint(c)
+		if _, ok := s.cas[fingerprint]; ok {
+			continue
+		}
+		s.cas[fingerprint] = c
+		added = append(added, fingerprint)
+	}
+	if len(added) > 0 {
+		s.rebuild()
+	}
+	return added, nil
+}
+
+// AddFile 加入 CA 文件中的全部证书
+func (s *TrustStore) AddFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read CA file: %w", err)
+	}
+	added, err := s.AddPEM(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return added, nil
+}
+
+// AddDir 加入目录下全部 CA 文件（按文件名顺序，不递归子目录）
+func (s *TrustStore) AddDir(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read CA dir: %w", err)
+	}
+	var added []string
+	for _, entry := range entries {
+		if entry.IsDir() || !caBundleExts[strings.ToLower(filepath.Ext(entry.Name()))] {
+			continue
+		}
+		fingerprints, err := s.AddFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		added = append(added, fingerprints...)
+	}
+	return added, nil
+}
+
+// Remove 按指纹移除 CA；不存在时返回 ErrCANotFound，最后一张 CA 返回 ErrLastCA
+func (s *TrustStore) Remove(fingerprint string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.cas[fingerprint]; !ok {
+		return ErrCANotFound
+	}
+	if len(s.cas) == 1 {
+		return ErrLastCA
+	}
+	delete(s.cas, fingerprint)
+	s.rebuild()
+	return nil
+}
+
+// List 返回信任集中的 CA（按指纹排序）
+func (s *TrustStore) List() []*CertInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	infos := make([]*CertInfo, 0, len(s.cas))
+	for fingerprint, c := range s.cas {
+		status := StatusActive
+		if now.Before(c.NotBefore) || now.After(c.NotAfter) {
+			status = StatusExpired
+		}
+		infos = append(infos, &CertInfo{
+			Fingerprint: fingerprint,
+			Subject:     c.Subject.String(),
+			Issuer:      c.Issuer.String(),
+			NotBefore:   c.NotBefore,
+			NotAfter:    c.NotAfter,
+			Status:      status,
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Fingerprint < infos[j].Fingerprint })
+	return infos
+}
+
+// Len 返回 CA 数量
+func (s *TrustStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.cas)
+}
+
+// Pool 返回当前 CA 证书池（信任集为空时为 nil）
+func (s *TrustStore) Pool() *x509.CertPool {
+	return s.pool.Load()
+}
+
+// BindServer 使服务端 config 在每次握手时按当前信任集校验客户端证书
+// config.ClientCAs 须为绑定时的 Pool()；调用方之后替换了 ClientCAs 则不再跟随信任集。
+// 客户端方向的 RootCAs 不随信任集变化，CA 轮换时应先在客户端预置新 CA
+func (s *TrustStore) BindServer(config *tls.Config) {
+	bound := config.ClientCAs
+	config.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		pool := s.Pool()
+		if pool == bound || config.ClientCAs != bound {
+			return nil, nil
+		}
+		updated := config.Clone()
+		updated.ClientCAs = pool
+		updated.GetConfigForClient = nil
+		return updated, nil
+	}
+}
+
+// rebuild 重建证书池（调用方持有 s.mu）
+func (s *TrustStore) rebuild() {
+	if len(s.cas) == 0 {
+		s.pool.Store(nil)
+		return
+	}
+	pool := x509.NewCertPool()
+	for _, c := range s.cas {
+		pool.AddCert(c)
+	}
+	s.pool.Store(pool)
+}
+
+// caFingerprint 与 Manager.GetFingerprint 格式一致
+func caFingerprint(c *x509.Certificate) string {
+	hash := sha256.Sum256(c.Raw)
+	return "sha256:" + hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,171 @@
+package cert
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCA 测试用 CA
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, _ := x509.ParseCertificate(der)
+	return &testCA{cert: c, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue 签发叶子证书（同时可用于服务端与客户端认证）
+func (ca *testCA) issue(t *testing.T, name string) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestLoadTrustStore(t *testing.T) {
+	dir := t.TempDir()
+	ca1, ca2, ca3 := newTestCA(t, "ca-1"), newTestCA(t, "ca-2"), newTestCA(t, "ca-3")
+
+	// bundle 文件含两张 CA；目录中非证书扩展名的文件被忽略
+	bundle := filepath.Join(dir, "bundle.pem")
+	os.WriteFile(bundle, append(append([]byte{}, ca1.pem...), ca2.pem...), 0600)
+	caDir := filepath.Join(dir, "cas")
+	os.Mkdir(caDir, 0700)
+	os.WriteFile(filepath.Join(caDir, "ca-3.crt"), ca3.pem, 0600)
+	os.WriteFile(filepath.Join(caDir, "ca-1.pem"), ca1.pem, 0600)
+	os.WriteFile(filepath.Join(caDir, "README"), []byte("not a cert"), 0600)
+
+	store, err := LoadTrustStore([]string{bundle}, []string{caDir})
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if store.Len() != 3 {
+		t.Fatalf("Len = %d, want 3 (duplicates skipped)", store.Len())
+	}
+	if store.Pool() == nil {
+		t.Fatal("Pool should not be nil")
+	}
+
+	if err := store.Remove("sha256:unknown"); !errors.Is(err, ErrCANotFound) {
+		t.Errorf("remove unknown = %v, want ErrCANotFound", err)
+	}
+	pool := store.Pool()
+	for _, info := range store.List()[:2] {
+		if err := store.Remove(info.Fingerprint); err != nil {
+			t.Fatalf("remove %s: %v", info.Fingerprint, err)
+		}
+	}
+	if store.Pool() == pool {
+		t.Error("Pool should be rebuilt after removal")
+	}
+	if err := store.Remove(store.List()[0].Fingerprint); !errors.Is(err, ErrLastCA) {
+		t.Errorf("remove last = %v, want ErrLastCA", err)
+	}
+
+	if _, err := store.AddPEM([]byte("garbage")); err == nil {
+		t.Error("AddPEM without certificate should fail")
+	}
+	if _, err := LoadTrustStore(nil, []string{filepath.Join(dir, "missing")}); err == nil {
+		t.Error("missing CA dir should fail")
+	}
+}
+
+func TestTrustStore_BindServer(t *testing.T) {
+	oldCA, newCA := newTestCA(t, "old-ca"), newTestCA(t, "new-ca")
+	store := NewTrustStore()
+	store.AddPEM(oldCA.pem)
+
+	serverConfig := &tls.Config{
+		Certificates: []tls.Certificate{oldCA.issue(t, "server")},
+		ClientCAs:    store.Pool(),
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	store.BindServer(serverConfig)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(oldCA.cert)
+	handshake := func(client tls.Certificate) error {
+		clientConn, serverConn := net.Pipe()
+		defer serverConn.Close()
+		done := make(chan error, 1)
+		go func() { done <- tls.Server(serverConn, serverConfig).Handshake() }()
+		// TLS 1.3 客户端先于服务端完成握手，关闭连接使服务端的告警写入不阻塞
+		tls.Client(clientConn, &tls.Config{
+			Certificates: []tls.Certificate{client},
+			RootCAs:      roots,
+			ServerName:   "server",
+		}).Handshake()
+		clientConn.Close()
+		return <-done
+	}
+
+	rotated := newCA.issue(t, "client")
+	if err := handshake(oldCA.issue(t, "client")); err != nil {
+		t.Fatalf("client from trusted CA: %v", err)
+	}
+	if err := handshake(rotated); err == nil {
+		t.Fatal("client from untrusted CA should be rejected")
+	}
+
+	// 运行时加入新 CA 后立即生效，移除旧 CA 后旧证书被拒绝
+	added, err := store.AddPEM(newCA.pem)
+	if err != nil || len(added) != 1 {
+		t.Fatalf("AddPEM = %v, %v", added, err)
+	}
+	if err := handshake(rotated); err != nil {
+		t.Fatalf("client from added CA: %v", err)
+	}
+	if err := store.Remove(caFingerprint(oldCA.cert)); err != nil {
+		t.Fatal(err)
+	}
+	if err := handshake(oldCA.issue(t, "client")); err == nil {
+		t.Error("client from removed CA should be rejected")
+	}
+}
@@ -1,6 +1,9 @@
 package cert
 
-import "time"
+import (
+	"fmt"
+	"time"
+)
 
 // CertStatus 证书状态
 type CertStatus string
@@ -11,13 +14,38 @@ const (
 	StatusExpired CertStatus = "expired" // 已过期
 )
 
+// ConflictPolicy 证书身份冲突处理策略
+// 冲突指同一 CN 对应多张指纹不同的活跃证书（轮换链上的新旧证书除外），冲突证书会共享同一客户端的策略
+type ConflictPolicy string
+
+const (
+	ConflictPolicyFlag   ConflictPolicy = "flag"   // 允许握手，记录安全事件并在会话中标记（默认）
+	ConflictPolicyReject ConflictPolicy = "reject" // 拒绝新出现的冲突证书
+)
+
+// Validate 校验冲突处理策略取值（空值视为 flag）
+func (p ConflictPolicy) Validate() error {
+	switch p {
+	case "", ConflictPolicyFlag, ConflictPolicyReject:
+		return nil
+	}
+	return fmt.Errorf("invalid identity conflict policy: %s (valid: %s, %s)", p, ConflictPolicyFlag, ConflictPolicyReject)
+}
+
 // CertInfo 证书信息
 type CertInfo struct {
-	Fingerprint string     `json:"fingerprint"` // 证书指纹（SHA256）
-	ClientID    string     `json:"client_id"`   // 客户端标识（可选）
-	Subject     string     `json:"subject"`     // 证书主题
-	Issuer      string     `json:"issuer"`      // 签发者
-	NotBefore   time.Time  `json:"not_before"`  // 有效期开始时间
-	NotAfter    time.Time  `json:"not_after"`   // 有效期结束时间
-	Status      CertStatus `json:"status"`      // 证书状态
+	Fingerprint string     `json:"fingerprint"`            // 证书指纹（SHA256）
+	ClientID    string     `json:"client_id"`              // 客户端标识（可选）
+	Identity    string     `json:"identity,omitempty"`     // 映射后的客户端身份（冲突检测用，可选）
+	Subject     string     `json:"subject"`                // 证书主题
+	Issuer      string     `json:"issuer"`                 // 签发者
+	NotBefore   time.Time  `json:"not_before"`             // 有效期开始时间
+	NotAfter    time.Time  `json:"not_after"`              // 有效期结束时间
+	Status      CertStatus `json:"status"`                 // 证书状态
+	LastSeenAt  *time.Time `json:"last_seen_at,omitempty"` // 最近一次握手使用时间
+
+	// 证书轮换链接（见 Registry.Rotate）
+	PreviousFingerprint string     `json:"previous_fingerprint,omitempty"` // 被本证书替换的旧证书
+	SupersededBy        string     `json:"superseded_by,omitempty"`        // 替换本证书的新证书
+	OverlapUntil        *time.Time `json:"overlap_until,omitempty"`        // 已被替换的证书在此时间前仍然有效
 }
@@ -0,0 +1,51 @@
+// Package clock 提供可注入的时钟，便于对会话过期、策略时间条件、配对超时、
+// 心跳等时间相关逻辑进行确定性测试
+//
+// 生产代码使用 Real()；测试使用 NewFake 并通过 Advance 推进时间，无需 sleep。
+// 注意：net.Conn 的读写 deadline 由内核按真实时间计算，不应使用注入的时钟。
+package clock
+
+import "time"
+
+// Clock 时钟接口
+type Clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+	// After 在 d 之后向返回的通道发送当前时间
+	After(d time.Duration) <-chan time.Time
+	// NewTicker 创建周期触发器
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker 周期触发器（对应 *time.Ticker）
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// Real 返回基于 time 包的真实时钟
+func Real() Clock {
+	return realClock{}
+}
+
+// Or 返回 c，c 为 nil 时返回真实时钟（用于配置默认值）
+func Or(c Clock) Clock {
+	if c == nil {
+		return Real()
+	}
+	return c
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) Since(t time.Time) time.Duration        { return time.Since(t) }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (realClock) NewTicker(d time.Duration) Ticker       { return realTicker{time.NewTicker(d)} }
+
+type realTicker struct {
+	t *time.Ticker
+}
+
+func (r realTicker) C() <-chan time.Time { return r.t.C }
+func (r realTicker) Stop()               { r.t.Stop() }
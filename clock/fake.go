@@ -0,0 +1,147 @@
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Fake 手动推进的测试时钟
+//
+// After / NewTicker 注册的等待者仅在 Advance / Set 推进时间时触发；
+// 被测代码在独立 goroutine 中等待时，可先调用 BlockUntil 确认其已注册，避免竞态
+type Fake struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	waiters []*fakeWaiter
+}
+
+// fakeWaiter After 或 Ticker 的一次等待
+type fakeWaiter struct {
+	deadline time.Time
+	period   time.Duration // > 0 表示 Ticker
+	ch       chan time.Time
+}
+
+// NewFake 创建从 start 开始的测试时钟
+func NewFake(start time.Time) *Fake {
+	f := &Fake{now: start}
+	f.cond = sync.NewCond(&f.mu)
+	return f
+}
+
+// Now 返回当前测试时间
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// Since 返回相对测试时间的间隔
+func (f *Fake) Since(t time.Time) time.Duration {
+	return f.Now().Sub(t)
+}
+
+// After 注册一次性等待；d <= 0 时立即触发
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- f.now
+		return ch
+	}
+	f.addWaiter(&fakeWaiter{deadline: f.now.Add(d), ch: ch})
+	return ch
+}
+
+// NewTicker 创建测试 Ticker；与 time.Ticker 一样，消费不及时的触发会被丢弃
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	w := &fakeWaiter{deadline: f.now.Add(d), period: d, ch: make(chan time.Time, 1)}
+	f.addWaiter(w)
+	return &fakeTicker{clock: f, w: w}
+}
+
+// Advance 将时间推进 d，并按到期顺序触发等待者
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	target := f.now.Add(d)
+	f.mu.Unlock()
+	f.Set(target)
+}
+
+// Set 将时间设置为 t（不可回退），并按到期顺序触发等待者
+func (f *Fake) Set(t time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for {
+		sort.Slice(f.waiters, func(i, j int) bool { return f.waiters[i].deadline.Before(f.waiters[j].deadline) })
+		if len(f.waiters) == 0 || f.waiters[0].deadline.After(t) {
+			break
+		}
+
+		w := f.waiters[0]
+		f.waiters = f.waiters[1:]
+		if w.deadline.After(f.now) {
+			f.now = w.deadline
+		}
+		select {
+		case w.ch <- f.now:
+		default:
+		}
+		if w.period > 0 {
+			w.deadline = w.deadline.Add(w.period)
+			f.waiters = append(f.waiters, w)
+		}
+	}
+	if t.After(f.now) {
+		f.now = t
+	}
+}
+
+// BlockUntil 阻塞直到至少有 n 个等待者（After / Ticker）注册
+func (f *Fake) BlockUntil(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for len(f.waiters) < n {
+		f.cond.Wait()
+	}
+}
+
+// addWaiter 注册等待者（调用方持有锁）
+func (f *Fake) addWaiter(w *fakeWaiter) {
+	f.waiters = append(f.waiters, w)
+	f.cond.Broadcast()
+}
+
+// removeWaiter 注销等待者（调用方持有锁）
+func (f *Fake) removeWaiter(w *fakeWaiter) {
+	for i, existing := range f.waiters {
+		if existing == w {
+			f.waiters = append(f.waiters[:i], f.waiters[i+1:]...)
+			return
+		}
+	}
+}
+
+type fakeTicker struct {
+	clock *Fake
+	w     *fakeWaiter
+}
+
+func (t *fakeTicker) C() <-chan time.Time { return t.w.ch }
+
+func (t *fakeTicker) Stop() {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	t.clock.removeWaiter(t.w)
+}
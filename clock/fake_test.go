@@ -0,0 +1,86 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestFakeAfter(t *testing.T) {
+	f := NewFake(epoch)
+	ch := f.After(10 * time.Second)
+
+	f.Advance(9 * time.Second)
+	select {
+	case <-ch:
+		t.Fatal("After fired early")
+	default:
+	}
+
+	f.Advance(time.Second)
+	select {
+	case got := <-ch:
+		if !got.Equal(epoch.Add(10 * time.Second)) {
+			t.Errorf("Expected fire time %v, got %v", epoch.Add(10*time.Second), got)
+		}
+	default:
+		t.Fatal("After did not fire")
+	}
+
+	if f.Since(epoch) != 10*time.Second {
+		t.Errorf("Expected Since 10s, got %v", f.Since(epoch))
+	}
+}
+
+func TestFakeTicker(t *testing.T) {
+	f := NewFake(epoch)
+	ticker := f.NewTicker(time.Second)
+
+	f.Advance(time.Second)
+	<-ticker.C()
+
+	// 未消费的触发被丢弃（与 time.Ticker 一致），通道中最多一个
+	f.Advance(3 * time.Second)
+	<-ticker.C()
+	select {
+	case <-ticker.C():
+		t.Fatal("Expected dropped ticks")
+	default:
+	}
+
+	ticker.Stop()
+	f.Advance(time.Second)
+	select {
+	case <-ticker.C():
+		t.Fatal("Stopped ticker fired")
+	default:
+	}
+}
+
+func TestFakeBlockUntil(t *testing.T) {
+	f := NewFake(epoch)
+	done := make(chan struct{})
+	go func() {
+		<-f.After(time.Minute)
+		close(done)
+	}()
+
+	f.BlockUntil(1)
+	f.Advance(time.Minute)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Waiter was not released")
+	}
+}
+
+func TestOr(t *testing.T) {
+	if _, ok := Or(nil).(realClock); !ok {
+		t.Error("Or(nil) should return the real clock")
+	}
+	f := NewFake(epoch)
+	if Or(f) != f {
+		t.Error("Or should return the given clock")
+	}
+}
@@ -0,0 +1,45 @@
+// Command sdp-config 输出合并各层后最终生效的配置（敏感值已隐去）
+//
+// 配置按 基础文件（含 include）→ profile 覆盖文件 → 环境变量 的顺序合并，
+// 与组件启动时 config.NewProfileLoader 的解析结果一致。-profile 缺省读取 $SDP_PROFILE。
+//
+// 示例：
+//
+//	sdp-config -config /etc/sdp/controller.yaml -profile prod
+//	SDP_PROFILE=staging SDP_LOGGING_LEVEL=debug sdp-config -config controller.yaml
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/houzhh15/sdp-common/config"
+)
+
+var (
+	configFile = flag.String("config", "config.yaml", "Base configuration file (YAML or JSON)")
+	profile    = flag.String("profile", "", "Configuration profile overlay, e.g. prod, staging, dev (default $"+config.ProfileEnv+")")
+	envPrefix  = flag.String("env-prefix", config.DefaultEnvPrefix, "Prefix for environment overrides (empty disables them)")
+)
+
+func main() {
+	flag.Parse()
+
+	loader := config.NewProfileLoader(*profile)
+	loader.EnvPrefix = *envPrefix
+
+	cfg, err := loader.Load(*configFile)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	fmt.Printf("# source: %s\n", *configFile)
+	if loader.Profile != "" {
+		fmt.Printf("# profile: %s (%s)\n", loader.Profile, config.ProfilePath(*configFile, loader.Profile))
+	}
+	if err := config.Dump(os.Stdout, cfg); err != nil {
+		log.Fatalf("Failed to dump config: %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// controlPlane 以 IH 身份调用 Controller REST API
+type controlPlane struct {
+	baseURL      string
+	client       *http.Client
+	sessionToken string
+}
+
+func newControlPlane(baseURL string, tlsConfig *tls.Config, maxConns int) *controlPlane {
+	return &controlPlane{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client: &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig:     tlsConfig,
+				MaxIdleConnsPerHost: maxConns,
+			},
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+// handshake 证书握手，获取会话令牌（所有合成 IH 共用）
+func (cp *controlPlane) handshake(ctx context.Context, fingerprint string) error {
+	var resp struct {
+		SessionToken string `json:"session_token"`
+	}
+	err := cp.do(ctx, http.MethodPost, "/api/v1/auth/handshake", map[string]interface{}{
+		"type":        "handshake_request",
+		"fingerprint": fingerprint,
+	}, http.StatusOK, &resp)
+	if err != nil {
+		return fmt.Errorf("handshake: %w", err)
+	}
+	if resp.SessionToken == "" {
+		return fmt.Errorf("handshake: empty session token")
+	}
+	cp.sessionToken = resp.SessionToken
+	return nil
+}
+
+// createTunnel 创建隧道，返回隧道 ID
+func (cp *controlPlane) createTunnel(ctx context.Context, serviceID string) (string, error) {
+	var resp struct {
+		TunnelID string `json:"tunnel_id"`
+	}
+	err := cp.do(ctx, http.MethodPost, "/api/v1/tunnels", map[string]interface{}{
+		"session_token": cp.sessionToken,
+		"service_id":    serviceID,
+		"protocol":      "tcp",
+	}, http.StatusCreated, &resp)
+	if err != nil {
+		return "", err
+	}
+	return resp.TunnelID, nil
+}
+
+// deleteTunnel 删除隧道
+func (cp *controlPlane) deleteTunnel(ctx context.Context, tunnelID string) error {
+	return cp.do(ctx, http.MethodDelete, "/api/v1/tunnels/"+tunnelID, nil, http.StatusOK, nil)
+}
+
+// do 发送 JSON 请求并解析响应
+func (cp *controlPlane) do(ctx context.Context, method, path string, body interface{}, wantStatus int, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("marshal request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, cp.baseURL+path, reader)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if cp.sessionToken != "" {
+		req.Header.Set("Authorization", "Bearer "+cp.sessionToken)
+	}
+
+	resp, err := cp.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != wantStatus {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s: status=%d, body=%s", method, path, resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("decode response: %w", err)
+		}
+	}
+	return nil
+}
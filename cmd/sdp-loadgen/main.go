@@ -0,0 +1,141 @@
+// Command sdp-loadgen 对 Controller 控制面与数据平面中继进行压测
+//
+// 使用 SDK 启动合成 IH/AH 对：IH 身份通过 REST API 创建隧道，两端分别以 IH/AH 证书
+// 连接中继，AH 回显 IH 发送的负载。按 -ramp 线性爬升到 -tunnels 个并发隧道并保持
+// -duration，周期输出并在结束时汇总配对延迟、TTFB、吞吐和按阶段的错误分布。
+//
+// 示例：
+//
+//	sdp-loadgen -controller https://localhost:8443 -relay localhost:9443 \
+//	    -service web-service -tunnels 200 -ramp 30s -duration 2m -rate 65536
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/houzhh15/sdp-common/cert"
+	"github.com/houzhh15/sdp-common/tunnel"
+)
+
+var (
+	controllerURL  = flag.String("controller", "https://localhost:8443", "Controller URL")
+	relayAddr      = flag.String("relay", "localhost:9443", "Controller data plane (relay) address")
+	ihCertFile     = flag.String("ih-cert", "certs/ih-client-cert.pem", "IH certificate file (CN must start with \"ih\")")
+	ihKeyFile      = flag.String("ih-key", "certs/ih-client-key.pem", "IH private key file")
+	ahCertFile     = flag.String("ah-cert", "certs/ah-agent-cert.pem", "AH certificate file (CN must start with \"ah\")")
+	ahKeyFile      = flag.String("ah-key", "certs/ah-agent-key.pem", "AH private key file")
+	caFile         = flag.String("ca", "certs/ca-cert.pem", "CA certificate file")
+	serviceID      = flag.String("service", "", "Service ID the IH is authorized for (required)")
+	tunnels        = flag.Int("tunnels", 10, "Maximum concurrent tunnels (synthetic IH/AH pairs)")
+	ramp           = flag.Duration("ramp", 10*time.Second, "Time to ramp up linearly to -tunnels")
+	duration       = flag.Duration("duration", 30*time.Second, "Steady-state duration after ramp-up")
+	lifetime       = flag.Duration("tunnel-lifetime", 0, "Recreate each tunnel after this long (0 keeps tunnels for the whole run)")
+	payloadSize    = flag.Int("payload", 16*1024, "Bytes per write")
+	rate           = flag.Int("rate", 0, "Per-tunnel throughput limit in bytes/s (0 = unlimited)")
+	pairingTimeout = flag.Duration("pairing-timeout", 10*time.Second, "Timeout waiting for IH/AH pairing")
+	reportInterval = flag.Duration("report-interval", 5*time.Second, "Interval for progress reports (0 disables)")
+	jsonOutput     = flag.Bool("json", false, "Print the final report as JSON")
+)
+
+func main() {
+	flag.Parse()
+
+	if *serviceID == "" {
+		log.Fatal("-service is required")
+	}
+	if *tunnels <= 0 || *payloadSize <= 0 {
+		log.Fatal("-tunnels and -payload must be positive")
+	}
+
+	ihCert, err := cert.NewManager(&cert.Config{CertFile: *ihCertFile, KeyFile: *ihKeyFile, CAFile: *caFile})
+	if err != nil {
+		log.Fatalf("Failed to load IH certificate: %v", err)
+	}
+	ahCert, err := cert.NewManager(&cert.Config{CertFile: *ahCertFile, KeyFile: *ahKeyFile, CAFile: *caFile})
+	if err != nil {
+		log.Fatalf("Failed to load AH certificate: %v", err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	api := newControlPlane(*controllerURL, ihCert.GetTLSConfig(), *tunnels)
+	if err := api.handshake(ctx, ihCert.GetFingerprint()); err != nil {
+		log.Fatalf("Handshake failed: %v", err)
+	}
+
+	g := &loadgen{
+		cfg: pairConfig{
+			serviceID:      *serviceID,
+			payloadSize:    *payloadSize,
+			rate:           *rate,
+			pairingTimeout: *pairingTimeout,
+		},
+		api:   api,
+		ih:    tunnel.NewDataPlaneClient(*relayAddr, ihCert.GetTLSConfig()),
+		ah:    tunnel.NewDataPlaneClient(*relayAddr, ahCert.GetTLSConfig()),
+		stats: newStats(),
+	}
+
+	fmt.Fprintf(os.Stderr, "sdp-loadgen: %d tunnels, ramp %s, duration %s, payload %dB, rate %d B/s per tunnel\n",
+		*tunnels, *ramp, *duration, *payloadSize, *rate)
+
+	runCtx, stop := context.WithTimeout(ctx, *ramp+*duration)
+	defer stop()
+
+	if *reportInterval > 0 {
+		go func() {
+			ticker := time.NewTicker(*reportInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-runCtx.Done():
+					return
+				case <-ticker.C:
+					g.stats.snapshot().writeText(os.Stderr)
+				}
+			}
+		}()
+	}
+
+	// 线性爬升：第 i 个 worker 在 i*ramp/tunnels 时启动
+	var wg sync.WaitGroup
+	step := *ramp / time.Duration(*tunnels)
+rampLoop:
+	for i := 0; i < *tunnels; i++ {
+		if i > 0 && step > 0 {
+			select {
+			case <-runCtx.Done():
+				break rampLoop
+			case <-time.After(step):
+			}
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			g.worker(runCtx, *lifetime)
+		}()
+	}
+	wg.Wait()
+
+	final := g.stats.snapshot()
+	if *jsonOutput {
+		if err := final.writeJSON(os.Stdout); err != nil {
+			log.Fatalf("Failed to write report: %v", err)
+		}
+	} else {
+		fmt.Println("=== sdp-loadgen report ===")
+		final.writeText(os.Stdout)
+	}
+	if final.ErrorsTotal > 0 {
+		os.Exit(1)
+	}
+}
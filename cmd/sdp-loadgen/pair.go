@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/houzhh15/sdp-common/tunnel"
+)
+
+// ahReadyMarker AH 连接中继后立即写入的就绪标记
+// 中继配对前数据留在 AH 连接缓冲中，IH 收到该字节即表示配对完成
+const ahReadyMarker = 0xA5
+
+// pairConfig 单个合成 IH/AH 对的参数
+type pairConfig struct {
+	serviceID      string
+	payloadSize    int           // 每次写入的负载字节数
+	rate           int           // 每隧道吞吐上限（字节/秒），0 表示不限速
+	pairingTimeout time.Duration // 等待配对完成的超时
+}
+
+// loadgen 压测执行器
+type loadgen struct {
+	cfg   pairConfig
+	api   *controlPlane
+	ih    *tunnel.DataPlaneClient // IH 证书
+	ah    *tunnel.DataPlaneClient // AH 证书
+	stats *stats
+}
+
+// worker 持续运行合成隧道直到 ctx 结束；lifetime > 0 时每条隧道到期后重建（控制面 churn）
+func (g *loadgen) worker(ctx context.Context, lifetime time.Duration) {
+	for ctx.Err() == nil {
+		pairCtx, cancel := ctx, context.CancelFunc(func() {})
+		if lifetime > 0 {
+			pairCtx, cancel = context.WithTimeout(ctx, lifetime)
+		}
+		ok := g.runPair(pairCtx)
+		cancel()
+
+		if !ok {
+			// 失败后短暂退避，避免对 Controller 形成空转重试风暴
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+			}
+		}
+	}
+}
+
+// runPair 创建隧道、建立 IH/AH 两端中继连接并回显数据，直到 ctx 结束
+func (g *loadgen) runPair(ctx context.Context) bool {
+	start := time.Now()
+	tunnelID, err := g.api.createTunnel(ctx, g.cfg.serviceID)
+	if err != nil {
+		if ctx.Err() == nil {
+			g.stats.recordError(stageCreateTunnel)
+		}
+		return false
+	}
+	g.stats.recordCreate(time.Since(start))
+	defer func() {
+		delCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := g.api.deleteTunnel(delCtx, tunnelID); err != nil {
+			g.stats.recordError(stageDeleteTunnel)
+		}
+	}()
+
+	// AH 端：连接中继，写入就绪标记后回显；runPair 返回时关闭
+	done := make(chan struct{})
+	defer close(done)
+	ahErrCh := make(chan error, 1)
+	go func() {
+		conn, err := g.ah.Connect(tunnelID)
+		if err != nil {
+			ahErrCh <- err
+			return
+		}
+		go func() {
+			<-done
+			conn.Close()
+		}()
+		if _, err := conn.Write([]byte{ahReadyMarker}); err != nil {
+			ahErrCh <- err
+			return
+		}
+		io.Copy(conn, conn)
+	}()
+
+	// IH 端：连接中继并等待 AH 就绪标记
+	connectStart := time.Now()
+	ihConn, err := g.ih.ConnectTimed(tunnelID, connectStart)
+	if err != nil {
+		g.stats.recordError(stageIHConnect)
+		return false
+	}
+	defer ihConn.Close()
+
+	ihConn.SetReadDeadline(time.Now().Add(g.cfg.pairingTimeout))
+	marker := make([]byte, 1)
+	if _, err := io.ReadFull(ihConn, marker); err != nil || marker[0] != ahReadyMarker {
+		select {
+		case <-ahErrCh:
+			g.stats.recordError(stageAHConnect)
+		default:
+			g.stats.recordError(stagePairing)
+		}
+		return false
+	}
+	ihConn.SetReadDeadline(time.Time{})
+	g.stats.recordPairing(time.Since(connectStart))
+
+	g.stats.tunnelUp()
+	err = g.echo(ctx, ihConn)
+	g.stats.tunnelDown(err == nil)
+	if err != nil {
+		g.stats.recordError(stageIO)
+		return false
+	}
+	return true
+}
+
+// echo IH 端持续写入负载并读取回显，直到 ctx 结束
+func (g *loadgen) echo(ctx context.Context, conn net.Conn) error {
+	payload := make([]byte, g.cfg.payloadSize)
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+
+	var wg sync.WaitGroup
+	writeErr := make(chan error, 1)
+	sentAt := time.Now()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		writeErr <- g.writeLoop(ctx, conn, payload)
+	}()
+
+	// ctx 结束时关闭连接，解除读阻塞
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	buf := make([]byte, 32*1024)
+	first := true
+	var readErr error
+	for {
+		n, err := conn.Read(buf)
+		if n > 0 {
+			if first {
+				g.stats.recordTTFB(time.Since(sentAt))
+				first = false
+			}
+			g.stats.addBytes(n)
+		}
+		if err != nil {
+			readErr = err
+			break
+		}
+	}
+	conn.Close()
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		// 正常结束（压测结束或隧道生命周期到期）
+		return nil
+	}
+	if err := <-writeErr; err != nil {
+		return err
+	}
+	if errors.Is(readErr, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return readErr
+}
+
+// writeLoop 按 rate 限速写入负载
+func (g *loadgen) writeLoop(ctx context.Context, conn net.Conn, payload []byte) error {
+	var ticker *time.Ticker
+	if g.cfg.rate > 0 {
+		interval := time.Duration(float64(time.Second) * float64(len(payload)) / float64(g.cfg.rate))
+		if interval <= 0 {
+			interval = time.Millisecond
+		}
+		ticker = time.NewTicker(interval)
+		defer ticker.Stop()
+	}
+
+	for {
+		if _, err := conn.Write(payload); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if ticker == nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
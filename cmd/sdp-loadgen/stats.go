@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 错误阶段（错误分布按阶段统计）
+const (
+	stageCreateTunnel = "create_tunnel"
+	stageIHConnect    = "ih_connect"
+	stageAHConnect    = "ah_connect"
+	stagePairing      = "pairing"
+	stageIO           = "io"
+	stageDeleteTunnel = "delete_tunnel"
+)
+
+// latencies 记录一组延迟样本
+type latencies struct {
+	samples []time.Duration
+}
+
+func (l *latencies) add(d time.Duration) {
+	l.samples = append(l.samples, d)
+}
+
+// summary 延迟分位数汇总
+type summary struct {
+	Count int     `json:"count"`
+	P50Ms float64 `json:"p50_ms"`
+	P90Ms float64 `json:"p90_ms"`
+	P99Ms float64 `json:"p99_ms"`
+	MaxMs float64 `json:"max_ms"`
+}
+
+func (l *latencies) summary() summary {
+	if len(l.samples) == 0 {
+		return summary{}
+	}
+	sorted := append([]time.Duration(nil), l.samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return summary{
+		Count: len(sorted),
+		P50Ms: ms(percentile(sorted, 0.50)),
+		P90Ms: ms(percentile(sorted, 0.90)),
+		P99Ms: ms(percentile(sorted, 0.99)),
+		MaxMs: ms(sorted[len(sorted)-1]),
+	}
+}
+
+// percentile 最近秩法取分位数（sorted 需已升序）
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	idx := int(float64(len(sorted))*p+0.5) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+	return sorted[idx]
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// stats 压测统计（并发安全）
+type stats struct {
+	mu        sync.Mutex
+	started   time.Time
+	create    latencies // 控制面：隧道创建 API 延迟
+	pairing   latencies // IH 发起连接到收到 AH 就绪标记
+	ttfb      latencies // IH 发送首个负载到收到首个回显字节
+	bytes     int64     // IH 收到的回显字节数
+	active    int       // 当前活跃隧道数
+	peak      int       // 峰值并发隧道数
+	completed int       // 正常结束的隧道数
+	errors    map[string]int
+}
+
+func newStats() *stats {
+	return &stats{
+		started: time.Now(),
+		errors:  make(map[string]int),
+	}
+}
+
+func (s *stats) recordCreate(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.create.add(d)
+}
+
+func (s *stats) recordPairing(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pairing.add(d)
+}
+
+func (s *stats) recordTTFB(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ttfb.add(d)
+}
+
+func (s *stats) addBytes(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bytes += int64(n)
+}
+
+func (s *stats) recordError(stage string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errors[stage]++
+}
+
+// tunnelUp / tunnelDown 跟踪并发隧道数
+func (s *stats) tunnelUp() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.active++
+	if s.active > s.peak {
+		s.peak = s.active
+	}
+}
+
+func (s *stats) tunnelDown(ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.active--
+	if ok {
+		s.completed++
+	}
+}
+
+// report 压测报告
+type report struct {
+	ElapsedSec     float64        `json:"elapsed_sec"`
+	ActiveTunnels  int            `json:"active_tunnels"`
+	PeakTunnels    int            `json:"peak_tunnels"`
+	Completed      int            `json:"completed_tunnels"`
+	CreateTunnel   summary        `json:"create_tunnel"`
+	Pairing        summary        `json:"pairing"`
+	TTFB           summary        `json:"ttfb"`
+	BytesEchoed    int64          `json:"bytes_echoed"`
+	ThroughputMBps float64        `json:"throughput_mbps"`
+	Errors         map[string]int `json:"errors"`
+	ErrorsTotal    int            `json:"errors_total"`
+}
+
+func (s *stats) snapshot() *report {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elapsed := time.Since(s.started).Seconds()
+	r := &report{
+		ElapsedSec:    elapsed,
+		ActiveTunnels: s.active,
+		PeakTunnels:   s.peak,
+		Completed:     s.completed,
+		CreateTunnel:  s.create.summary(),
+		Pairing:       s.pairing.summary(),
+		TTFB:          s.ttfb.summary(),
+		BytesEchoed:   s.bytes,
+		Errors:        make(map[string]int, len(s.errors)),
+	}
+	if elapsed > 0 {
+		r.ThroughputMBps = float64(s.bytes) / elapsed / (1024 * 1024)
+	}
+	for stage, n := range s.errors {
+		r.Errors[stage] = n
+		r.ErrorsTotal += n
+	}
+	return r
+}
+
+// writeText 以文本格式输出报告
+func (r *report) writeText(w io.Writer) {
+	fmt.Fprintf(w, "elapsed=%.1fs active=%d peak=%d completed=%d errors=%d throughput=%.2f MB/s\n",
+		r.ElapsedSec, r.ActiveTunnels, r.PeakTunnels, r.Completed, r.ErrorsTotal, r.ThroughputMBps)
+	for _, row := range []struct {
+		name string
+		s    summary
+	}{
+		{"create_tunnel", r.CreateTunnel},
+		{"pairing", r.Pairing},
+		{"ttfb", r.TTFB},
+	} {
+		fmt.Fprintf(w, "  %-14s n=%-6d p50=%.1fms p90=%.1fms p99=%.1fms max=%.1fms\n",
+			row.name, row.s.Count, row.s.P50Ms, row.s.P90Ms, row.s.P99Ms, row.s.MaxMs)
+	}
+	if len(r.Errors) > 0 {
+		stages := make([]string, 0, len(r.Errors))
+		for stage := range r.Errors {
+			stages = append(stages, stage)
+		}
+		sort.Strings(stages)
+		fmt.Fprintf(w, "  errors:")
+		for _, stage := range stages {
+			fmt.Fprintf(w, " %s=%d", stage, r.Errors[stage])
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// writeJSON 以 JSON 格式输出报告
+func (r *report) writeJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
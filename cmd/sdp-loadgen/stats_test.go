@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLatencySummary(t *testing.T) {
+	var l latencies
+	for i := 1; i <= 100; i++ {
+		l.add(time.Duration(i) * time.Millisecond)
+	}
+
+	s := l.summary()
+	if s.Count != 100 {
+		t.Errorf("Expected 100 samples, got %d", s.Count)
+	}
+	if s.P50Ms != 50 || s.P90Ms != 90 || s.P99Ms != 99 || s.MaxMs != 100 {
+		t.Errorf("Unexpected percentiles: %+v", s)
+	}
+
+	var empty latencies
+	if got := empty.summary(); got.Count != 0 || got.MaxMs != 0 {
+		t.Errorf("Expected zero summary, got %+v", got)
+	}
+}
+
+func TestStatsSnapshot(t *testing.T) {
+	s := newStats()
+	s.tunnelUp()
+	s.tunnelUp()
+	s.tunnelDown(true)
+	s.recordPairing(5 * time.Millisecond)
+	s.recordTTFB(2 * time.Millisecond)
+	s.addBytes(1024)
+	s.recordError(stagePairing)
+	s.recordError(stagePairing)
+	s.recordError(stageIO)
+
+	r := s.snapshot()
+	if r.ActiveTunnels != 1 || r.PeakTunnels != 2 || r.Completed != 1 {
+		t.Errorf("Unexpected tunnel counts: %+v", r)
+	}
+	if r.BytesEchoed != 1024 || r.Pairing.Count != 1 || r.TTFB.Count != 1 {
+		t.Errorf("Unexpected samples: %+v", r)
+	}
+	if r.ErrorsTotal != 3 || r.Errors[stagePairing] != 2 {
+		t.Errorf("Unexpected error distribution: %v", r.Errors)
+	}
+
+	var buf bytes.Buffer
+	r.writeText(&buf)
+	if !strings.Contains(buf.String(), "errors: io=1 pairing=2") {
+		t.Errorf("Unexpected text report: %s", buf.String())
+	}
+}
@@ -0,0 +1,64 @@
+// Command sdp-relay 独立数据平面中继节点
+//
+// 基于 transport.TunnelRelayServer 在 Controller 进程之外承载 IH ↔ AH 中继，使数据平面容量
+// 可独立于控制平面扩展。配置 controller.addrs 时以内部身份（spiffe://<trust-domain>/relay/<id>）
+// 向 Controller 注册并周期心跳、确认隧道配对；Controller 以 DataPlaneAdvertiseAddrs 向 IH/AH 通告本节点的
+// advertise_addr，或在多跳服务的 relay_chain 中引用。
+// 收到 SIGINT/SIGTERM 后停止接受新连接，等待正在中继的隧道结束（最长 drain_timeout）再退出。
+//
+// 示例：
+//
+//	sdp-relay -config /etc/sdp/relay.yaml
+//	sdp-relay -config relay.yaml -check
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os/signal"
+	"syscall"
+
+	"github.com/houzhh15/sdp-common/logging"
+	"github.com/houzhh15/sdp-common/relay"
+)
+
+var (
+	configFile = flag.String("config", "relay.yaml", "Relay configuration file (YAML or JSON)")
+	check      = flag.Bool("check", false, "Validate the configuration and certificates, then exit")
+)
+
+func main() {
+	flag.Parse()
+
+	cfg, err := relay.LoadConfig(*configFile)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	logger, err := logging.NewLogger(&logging.Config{Level: cfg.LogLevel, Format: "json", Output: "stdout"})
+	if err != nil {
+		log.Fatalf("Failed to initialize logger: %v", err)
+	}
+
+	node, err := relay.New(cfg, logger)
+	if err != nil {
+		log.Fatalf("Failed to create relay node: %v", err)
+	}
+	if *check {
+		if identity := node.Identity(); identity != nil {
+			fmt.Printf("configuration OK (identity %s)\n", identity)
+		} else {
+			fmt.Println("configuration OK (no controller registration)")
+		}
+		return
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	if err := node.Run(ctx); err != nil {
+		log.Fatalf("Relay node failed: %v", err)
+	}
+}
@@ -1,12 +1,15 @@
 package config
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
 	"time"
 
+	"github.com/houzhh15/sdp-common/cert"
+	"github.com/houzhh15/sdp-common/transport"
 	"gopkg.in/yaml.v3"
 )
 
@@ -34,6 +37,38 @@ type TLSConfig struct {
 	KeyFile    string `yaml:"key_file" json:"key_file"`
 	CAFile     string `yaml:"ca_file" json:"ca_file"`
 	MinVersion string `yaml:"min_version" json:"min_version"` // TLS1.2, TLS1.3
+	MaxVersion string `yaml:"max_version" json:"max_version"` // 为空表示不限制
+
+	// CipherSuites TLS 1.2 密码套件 IANA 名称，CurvePreferences 曲线名（X25519、P256 等），为空使用默认安全列表
+	CipherSuites     []string `yaml:"cipher_suites" json:"cipher_suites"`
+	CurvePreferences []string `yaml:"curve_preferences" json:"curve_preferences"`
+
+	// Key 私钥 PEM 内容（env:/file:/kms: 引用或字面量），与 KeyFile 二选一
+	Key Secret `yaml:"key" json:"key"`
+
+	// CAFiles / CADirs 额外的 CA 文件（可为多证书 bundle）与 CA 目录，与 CAFile 合并为信任集
+	CAFiles []string `yaml:"ca_files" json:"ca_files"`
+	CADirs  []string `yaml:"ca_dirs" json:"ca_dirs"`
+}
+
+// KeyPEM 返回私钥 PEM：优先解析 Key，否则读取 KeyFile
+func (t *TLSConfig) KeyPEM(ctx context.Context) ([]byte, error) {
+	if t.Key.IsSet() {
+		return t.Key.Resolve(ctx)
+	}
+	if t.KeyFile == "" {
+		return nil, fmt.Errorf("tls key or key_file is required")
+	}
+	data, err := os.ReadFile(t.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("read key_file: %w", err)
+	}
+	return data, nil
+}
+
+// Policy 解析版本、密码套件与曲线配置为 cert.TLSPolicy
+func (t *TLSConfig) Policy() (*cert.TLSPolicy, error) {
+	return cert.ParseTLSPolicy(t.MinVersion, t.MaxVersion, t.CipherSuites, t.CurvePreferences)
 }
 
 // AuthConfig defines authentication configuration
@@ -55,6 +90,11 @@ type LoggingConfig struct {
 	Format    string `yaml:"format" json:"format"`         // json, text
 	Output    string `yaml:"output" json:"output"`         // stdout, file
 	AuditFile string `yaml:"audit_file" json:"audit_file"` // audit log file path
+	// AuditRedactFields additional request body fields redacted in API request audit events
+	AuditRedactFields []string `yaml:"audit_redact_fields" json:"audit_redact_fields,omitempty"`
+	// AuditMaxAge / AuditMaxSize audit log retention; older records are purged and kept as daily summaries
+	AuditMaxAge  time.Duration `yaml:"audit_max_age" json:"audit_max_age,omitempty"`
+	AuditMaxSize int64         `yaml:"audit_max_size" json:"audit_max_size,omitempty"` // bytes
 }
 
 // TransportConfig defines transport layer configuration
@@ -67,90 +107,163 @@ type TransportConfig struct {
 	ReadTimeout  time.Duration `yaml:"read_timeout" json:"read_timeout"`
 	WriteTimeout time.Duration `yaml:"write_timeout" json:"write_timeout"`
 	IdleTimeout  time.Duration `yaml:"idle_timeout" json:"idle_timeout"`
+
+	// HTTP 请求限制（防御超大请求体与 slowloris）
+	ReadHeaderTimeout time.Duration    `yaml:"read_header_timeout" json:"read_header_timeout"`
+	MaxHeaderBytes    int              `yaml:"max_header_bytes" json:"max_header_bytes"`
+	MaxBodyBytes      int64            `yaml:"max_body_bytes" json:"max_body_bytes"`             // 负数表示不限制
+	RouteMaxBodyBytes map[string]int64 `yaml:"route_max_body_bytes" json:"route_max_body_bytes"` // 路径前缀 -> 上限
+
+	// CORS 浏览器客户端跨域配置，未配置时关闭
+	CORS *transport.CORSConfig `yaml:"cors" json:"cors"`
+}
+
+// HTTPServerConfig converts transport settings into transport.HTTPServerConfig
+// Zero values fall back to transport defaults.
+func (t *TransportConfig) HTTPServerConfig() *transport.HTTPServerConfig {
+	return &transport.HTTPServerConfig{
+		ReadTimeout:       t.ReadTimeout,
+		ReadHeaderTimeout: t.ReadHeaderTimeout,
+		WriteTimeout:      t.WriteTimeout,
+		IdleTimeout:       t.IdleTimeout,
+		MaxHeaderBytes:    t.MaxHeaderBytes,
+		MaxBodyBytes:      t.MaxBodyBytes,
+		RouteMaxBodyBytes: t.RouteMaxBodyBytes,
+	}
 }
 
 // Loader provides configuration loading functionality
-type Loader struct{}
+//
+// 配置按层合并（后者覆盖前者）：
+//  1. 基础文件中 include 列出的文件（相对于该文件所在目录，可嵌套）
+//  2. 基础文件本身
+//  3. Profile 覆盖文件 <name>.<profile><ext>（如 controller.prod.yaml，同样支持 include）
+//  4. EnvPrefix 环境变量（如 SDP_LOGGING_LEVEL=debug）
+//
+// 映射逐键深度合并，标量与列表整体替换。
+type Loader struct {
+	// Profile 环境配置名（如 prod、staging、dev），为空时不叠加覆盖文件
+	Profile string
+	// EnvPrefix 环境变量覆盖前缀，为空时不读取环境变量
+	EnvPrefix string
+}
 
 // NewLoader creates a new configuration loader
 func NewLoader() *Loader {
 	return &Loader{}
 }
 
-// Load reads and parses configuration from file
+// NewProfileLoader creates a loader for the given profile with environment overrides enabled.
+// An empty profile falls back to $SDP_PROFILE (the --profile flag convention).
+func NewProfileLoader(profile string) *Loader {
+	if profile == "" {
+		profile = os.Getenv(ProfileEnv)
+	}
+	return &Loader{Profile: profile, EnvPrefix: DefaultEnvPrefix}
+}
+
+// Load reads, merges and parses configuration layers starting from path
 func (l *Loader) Load(path string) (*Config, error) {
-	// Read file
-	data, err := os.ReadFile(path)
+	config, err := l.resolve(path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read config file: %w", err)
+		return nil, err
+	}
+
+	// Validate configuration
+	if err := l.Validate(config); err != nil {
+		return nil, fmt.Errorf("config validation failed: %w", err)
 	}
 
-	// Determine format by extension
-	ext := filepath.Ext(path)
+	// Set defaults
+	l.setDefaults(config)
+
+	return config, nil
+}
 
-	var config Config
-	switch ext {
+// decode parses raw config data according to the file extension
+func decode(path string, data []byte, out interface{}) error {
+	switch ext := filepath.Ext(path); ext {
 	case ".yaml", ".yml":
-		if err := yaml.Unmarshal(data, &config); err != nil {
-			return nil, fmt.Errorf("failed to parse YAML: %w", err)
+		if err := yaml.Unmarshal(data, out); err != nil {
+			return fmt.Errorf("failed to parse YAML: %w", err)
 		}
 	case ".json":
-		if err := json.Unmarshal(data, &config); err != nil {
-			return nil, fmt.Errorf("failed to parse JSON: %w", err)
+		if err := json.Unmarshal(data, out); err != nil {
+			return fmt.Errorf("failed to parse JSON: %w", err)
 		}
 	default:
-		return nil, fmt.Errorf("unsupported config format: %s", ext)
+		return fmt.Errorf("unsupported config format: %s", ext)
 	}
+	return nil
+}
 
-	// Validate configuration
-	if err := l.Validate(&config); err != nil {
-		return nil, fmt.Errorf("config validation failed: %w", err)
+// Validate checks configuration validity, returning the first problem as a *FieldError
+func (l *Loader) Validate(config *Config) error {
+	if errs := l.check(config); len(errs) > 0 {
+		return errs[0]
 	}
-
-	// Set defaults
-	l.setDefaults(&config)
-
-	return &config, nil
+	return nil
 }
 
-// Validate checks configuration validity
-func (l *Loader) Validate(config *Config) error {
+// check collects every validation problem (see Diagnose)
+func (l *Loader) check(config *Config) []*FieldError {
+	var errs []*FieldError
+	add := func(field, format string, args ...interface{}) {
+		errs = append(errs, &FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
 	// Validate component type
 	switch config.Component.Type {
 	case "controller", "ih", "ah":
 		// valid
 	default:
-		return fmt.Errorf("invalid component type: %s (must be controller/ih/ah)", config.Component.Type)
+		add("component.type", "invalid component type: %s (must be controller/ih/ah)", config.Component.Type)
 	}
 
 	// Validate required fields
 	if config.Component.ID == "" {
-		return fmt.Errorf("component.id is required")
+		add("component.id", "component.id is required")
 	}
 
 	// Validate TLS files exist
 	if config.TLS.CertFile != "" {
 		if _, err := os.Stat(config.TLS.CertFile); err != nil {
-			return fmt.Errorf("cert_file not found: %s", config.TLS.CertFile)
+			add("tls.cert_file", "cert_file not found: %s", config.TLS.CertFile)
 		}
 	}
+	if config.TLS.KeyFile != "" && config.TLS.Key.IsSet() {
+		add("tls.key", "tls.key and tls.key_file are mutually exclusive")
+	}
 	if config.TLS.KeyFile != "" {
 		if _, err := os.Stat(config.TLS.KeyFile); err != nil {
-			return fmt.Errorf("key_file not found: %s", config.TLS.KeyFile)
+			add("tls.key_file", "key_file not found: %s", config.TLS.KeyFile)
 		}
 	}
 	if config.TLS.CAFile != "" {
 		if _, err := os.Stat(config.TLS.CAFile); err != nil {
-			return fmt.Errorf("ca_file not found: %s", config.TLS.CAFile)
+			add("tls.ca_file", "ca_file not found: %s", config.TLS.CAFile)
 		}
 	}
+	for _, file := range config.TLS.CAFiles {
+		if _, err := os.Stat(file); err != nil {
+			add("tls.ca_files", "ca file not found: %s", file)
+		}
+	}
+	for _, dir := range config.TLS.CADirs {
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			add("tls.ca_dirs", "ca dir not found: %s", dir)
+		}
+	}
+	if _, err := config.TLS.Policy(); err != nil {
+		add(tlsPolicyField(&config.TLS), "invalid tls policy: %v", err)
+	}
 
 	// Validate logging level
 	switch config.Logging.Level {
 	case "debug", "info", "warn", "error", "":
 		// valid
 	default:
-		return fmt.Errorf("invalid logging level: %s", config.Logging.Level)
+		add("logging.level", "invalid logging level: %s", config.Logging.Level)
 	}
 
 	// Validate logging format
@@ -158,7 +271,7 @@ func (l *Loader) Validate(config *Config) error {
 	case "json", "text", "":
 		// valid
 	default:
-		return fmt.Errorf("invalid logging format: %s", config.Logging.Format)
+		add("logging.format", "invalid logging format: %s", config.Logging.Format)
 	}
 
 	// Validate policy engine
@@ -166,15 +279,15 @@ func (l *Loader) Validate(config *Config) error {
 	case "embedded", "external", "":
 		// valid
 	default:
-		return fmt.Errorf("invalid policy engine: %s", config.Policy.Engine)
+		add("policy.engine", "invalid policy engine: %s", config.Policy.Engine)
 	}
 
 	// If external policy engine, endpoint is required
 	if config.Policy.Engine == "external" && config.Policy.Endpoint == "" {
-		return fmt.Errorf("policy.endpoint is required when engine=external")
+		add("policy.endpoint", "policy.endpoint is required when engine=external")
 	}
 
-	return nil
+	return errs
 }
 
 // setDefaults sets default values for optional fields
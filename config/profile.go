@@ -0,0 +1,218 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// ProfileEnv 未通过 --profile 指定时读取的环境变量
+	ProfileEnv = "SDP_PROFILE"
+	// DefaultEnvPrefix 环境变量覆盖的默认前缀（SDP_<SECTION>_<KEY>）
+	DefaultEnvPrefix = "SDP"
+
+	// includeKey 配置文件中引用其他文件的顶层键
+	includeKey = "include"
+)
+
+// ProfilePath 返回基础文件 path 对应 profile 的覆盖文件路径
+// 如 ProfilePath("/etc/sdp/controller.yaml", "prod") = "/etc/sdp/controller.prod.yaml"
+func ProfilePath(path, profile string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + profile + ext
+}
+
+// resolve 按层合并配置文件并应用环境变量覆盖（不校验、不填充默认值）
+func (l *Loader) resolve(path string) (*Config, error) {
+	merged, err := readLayer(path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if l.Profile != "" {
+		overlayPath := ProfilePath(path, l.Profile)
+		if _, err := os.Stat(overlayPath); err != nil {
+			return nil, fmt.Errorf("profile %q: overlay file not found: %s", l.Profile, overlayPath)
+		}
+		overlay, err := readLayer(overlayPath, nil)
+		if err != nil {
+			return nil, fmt.Errorf("profile %q: %w", l.Profile, err)
+		}
+		mergeMaps(merged, overlay)
+	}
+
+	// 合并结果按基础文件格式重新编码后解析，保持各格式自身的取值语义（如 JSON 中的时长为纳秒整数）
+	var config Config
+	var data []byte
+	if filepath.Ext(path) == ".json" {
+		data, err = json.Marshal(merged)
+	} else {
+		data, err = yaml.Marshal(merged)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode merged config: %w", err)
+	}
+	if err := decode(path, data, &config); err != nil {
+		return nil, err
+	}
+
+	if l.EnvPrefix != "" {
+		if err := applyEnv(reflect.ValueOf(&config).Elem(), strings.ToUpper(l.EnvPrefix)); err != nil {
+			return nil, err
+		}
+	}
+
+	return &config, nil
+}
+
+// readLayer 读取单个文件并先行合并其 include 的文件，stack 用于检测循环引用
+func readLayer(path string, stack []string) (map[string]interface{}, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve config path: %w", err)
+	}
+	for _, p := range stack {
+		if p == absPath {
+			return nil, fmt.Errorf("config include cycle: %s", strings.Join(append(stack, absPath), " -> "))
+		}
+	}
+	stack = append(stack, absPath)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	layer := map[string]interface{}{}
+	if err := decode(path, data, &layer); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if layer == nil {
+		layer = map[string]interface{}{}
+	}
+
+	includes, err := includeList(layer[includeKey])
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	delete(layer, includeKey)
+
+	merged := map[string]interface{}{}
+	for _, inc := range includes {
+		if !filepath.IsAbs(inc) {
+			inc = filepath.Join(filepath.Dir(path), inc)
+		}
+		base, err := readLayer(inc, stack)
+		if err != nil {
+			return nil, err
+		}
+		mergeMaps(merged, base)
+	}
+	mergeMaps(merged, layer)
+
+	return merged, nil
+}
+
+// includeList 解析 include 值（单个路径或路径列表）
+func includeList(v interface{}) ([]string, error) {
+	switch inc := v.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{inc}, nil
+	case []interface{}:
+		paths := make([]string, 0, len(inc))
+		for _, item := range inc {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("include entries must be file paths, got %T", item)
+			}
+			paths = append(paths, s)
+		}
+		return paths, nil
+	default:
+		return nil, fmt.Errorf("include must be a path or a list of paths, got %T", v)
+	}
+}
+
+// mergeMaps 将 src 深度合并到 dst：映射逐键合并，其余值整体替换
+func mergeMaps(dst, src map[string]interface{}) {
+	for key, value := range src {
+		srcMap, srcIsMap := value.(map[string]interface{})
+		dstMap, dstIsMap := dst[key].(map[string]interface{})
+		if srcIsMap && dstIsMap {
+			mergeMaps(dstMap, srcMap)
+			continue
+		}
+		dst[key] = value
+	}
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// applyEnv 按字段的 yaml 键名应用环境变量覆盖，如 transport.http_addr -> SDP_TRANSPORT_HTTP_ADDR
+// 仅支持标量字段（字符串、布尔、整数、时长），映射、列表与指针字段需通过文件配置
+func applyEnv(v reflect.Value, prefix string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if name == "" || name == "-" || !field.IsExported() {
+			continue
+		}
+		key := prefix + "_" + strings.ToUpper(name)
+		fv := v.Field(i)
+
+		if fv.Kind() == reflect.Struct {
+			if err := applyEnv(fv, key); err != nil {
+				return err
+			}
+			continue
+		}
+
+		raw, ok := os.LookupEnv(key)
+		if !ok {
+			continue
+		}
+		if err := setScalar(fv, raw); err != nil {
+			return fmt.Errorf("invalid %s=%q: %w", key, raw, err)
+		}
+	}
+	return nil
+}
+
+// setScalar 将字符串解析为字段类型并赋值
+func setScalar(fv reflect.Value, raw string) error {
+	switch {
+	case fv.Type() == durationType:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		fv.SetInt(int64(d))
+	case fv.Kind() == reflect.String:
+		fv.SetString(raw)
+	case fv.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	case fv.CanInt():
+		n, err := strconv.ParseInt(raw, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetInt(n)
+	default:
+		return fmt.Errorf("environment override not supported for %s fields", fv.Type())
+	}
+	return nil
+}
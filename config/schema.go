@@ -0,0 +1,89 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// durationPattern Go 时长字符串（如 30s、1h30m）；JSON 文件中的时长也可写作纳秒整数
+const durationPattern = `^-?([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$`
+
+// schemaEnums 取值受限的键（与 Loader.Validate 的检查一致）
+var schemaEnums = map[string][]string{
+	"component.type": {"controller", "ih", "ah"},
+	"logging.level":  {"debug", "info", "warn", "error"},
+	"logging.format": {"json", "text"},
+	"logging.output": {"stdout", "file"},
+	"policy.engine":  {"embedded", "external"},
+}
+
+// schemaRequired 必填的键
+var schemaRequired = map[string][]string{
+	"":          {"component"},
+	"component": {"type", "id"},
+}
+
+// JSONSchema 返回配置文件的 JSON Schema（draft 2020-12），供编辑器补全与校验 YAML/JSON 配置。
+// 未知键被视为错误（additionalProperties: false），文件存在性、TLS 策略等运行时检查仍需 Diagnose
+func JSONSchema() ([]byte, error) {
+	schema := schemaFor(reflect.TypeOf(Config{}), "")
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["title"] = "SDP component configuration"
+	schema["properties"].(map[string]interface{})[includeKey] = map[string]interface{}{
+		"description": "Files merged before this one, relative to its directory",
+		"oneOf": []interface{}{
+			map[string]interface{}{"type": "string"},
+			map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+		},
+	}
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+// schemaFor 按 yaml 标签为类型生成 schema，path 为点分隔键路径
+func schemaFor(t reflect.Type, path string) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == durationType:
+		return map[string]interface{}{"type": []string{"string", "integer"}, "pattern": durationPattern}
+	case t.Kind() == reflect.String:
+		s := map[string]interface{}{"type": "string"}
+		if enum, ok := schemaEnums[path]; ok {
+			s["enum"] = enum
+		}
+		return s
+	case t.Kind() == reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case t.Kind() == reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": schemaFor(t.Elem(), path)}
+	case t.Kind() == reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaFor(t.Elem(), path)}
+	case t.Kind() == reflect.Struct:
+		props := map[string]interface{}{}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name := yamlName(field)
+			if name == "" || !field.IsExported() {
+				continue
+			}
+			child := name
+			if path != "" {
+				child = path + "." + name
+			}
+			props[name] = schemaFor(field.Type, child)
+		}
+		s := map[string]interface{}{"type": "object", "properties": props, "additionalProperties": false}
+		if required, ok := schemaRequired[path]; ok {
+			s["required"] = required
+		}
+		return s
+	default:
+		return map[string]interface{}{}
+	}
+}
@@ -0,0 +1,124 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Secret 敏感配置值（私钥、HMAC 密钥、签名密钥等），可直接给出或引用外部来源：
+//
+//	env:NAME                  环境变量 NAME 的值
+//	file:/path/to/secret      文件内容（去除末尾换行）
+//	kms:<provider>:<key-id>   由已注册的 KMS 插件解密
+//	其他                      字面量
+//
+// String、JSON/YAML 序列化时字面量输出为 RedactedValue，引用形式原样输出（不含密钥本身），
+// 因此可安全写入日志和 Dump 结果。
+type Secret string
+
+// 引用前缀
+const (
+	secretEnvPrefix  = "env:"
+	secretFilePrefix = "file:"
+	secretKMSPrefix  = "kms:"
+)
+
+// KMSProvider KMS 插件，按密钥 ID 返回明文
+type KMSProvider interface {
+	Decrypt(ctx context.Context, keyID string) ([]byte, error)
+}
+
+var (
+	kmsMu        sync.RWMutex
+	kmsProviders = map[string]KMSProvider{}
+)
+
+// RegisterKMSProvider 注册 KMS 插件，供 kms:<name>:<key-id> 引用（同名覆盖）
+func RegisterKMSProvider(name string, provider KMSProvider) {
+	kmsMu.Lock()
+	defer kmsMu.Unlock()
+	kmsProviders[name] = provider
+}
+
+// IsSet 是否配置了值
+func (s Secret) IsSet() bool {
+	return s != ""
+}
+
+// IsReference 是否为 env:/file:/kms: 引用
+func (s Secret) IsReference() bool {
+	v := string(s)
+	return strings.HasPrefix(v, secretEnvPrefix) || strings.HasPrefix(v, secretFilePrefix) || strings.HasPrefix(v, secretKMSPrefix)
+}
+
+// Resolve 解析出密钥明文，未设置时返回 nil
+func (s Secret) Resolve(ctx context.Context) ([]byte, error) {
+	v := string(s)
+	switch {
+	case v == "":
+		return nil, nil
+
+	case strings.HasPrefix(v, secretEnvPrefix):
+		name := strings.TrimPrefix(v, secretEnvPrefix)
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return nil, fmt.Errorf("secret env %s is not set", name)
+		}
+		return []byte(value), nil
+
+	case strings.HasPrefix(v, secretFilePrefix):
+		path := strings.TrimPrefix(v, secretFilePrefix)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read secret file: %w", err)
+		}
+		return []byte(strings.TrimRight(string(data), "\r\n")), nil
+
+	case strings.HasPrefix(v, secretKMSPrefix):
+		name, keyID, ok := strings.Cut(strings.TrimPrefix(v, secretKMSPrefix), ":")
+		if !ok || name == "" || keyID == "" {
+			return nil, fmt.Errorf("invalid kms secret reference %q (want kms:<provider>:<key-id>)", v)
+		}
+		kmsMu.RLock()
+		provider := kmsProviders[name]
+		kmsMu.RUnlock()
+		if provider == nil {
+			return nil, fmt.Errorf("kms provider %q is not registered", name)
+		}
+		data, err := provider.Decrypt(ctx, keyID)
+		if err != nil {
+			return nil, fmt.Errorf("kms %s decrypt %s: %w", name, keyID, err)
+		}
+		return data, nil
+
+	default:
+		return []byte(v), nil
+	}
+}
+
+// String 返回可安全输出的表示（字面量隐去）
+func (s Secret) String() string {
+	if s == "" || s.IsReference() {
+		return string(s)
+	}
+	return RedactedValue
+}
+
+// GoString 防止 %#v 输出字面量
+func (s Secret) GoString() string {
+	return fmt.Sprintf("config.Secret(%q)", s.String())
+}
+
+// MarshalJSON 序列化为隐去后的表示
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// MarshalYAML 序列化为隐去后的表示
+func (s Secret) MarshalYAML() (interface{}, error) {
+	return s.String(), nil
+}
@@ -0,0 +1,315 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/houzhh15/sdp-common/cert"
+	"gopkg.in/yaml.v3"
+)
+
+// FieldError 配置校验错误，Field 为点分隔的键路径（如 tls.cert_file）
+type FieldError struct {
+	Field   string
+	Message string
+	// Position 该键最终生效值所在的位置，由 Diagnose 填充，无法定位时为 nil
+	Position *Position
+}
+
+// Error 返回错误描述（与 Loader.Validate 的历史输出一致，不含位置）
+func (e *FieldError) Error() string {
+	return e.Message
+}
+
+// Position 配置项的来源：文件中的行列，或覆盖它的环境变量
+type Position struct {
+	File   string
+	Line   int
+	Column int
+	// Env 值来自环境变量覆盖时的变量名
+	Env string
+}
+
+// String 以 file:line:col 格式输出（与编译器一致，便于编辑器和 CI 解析）
+func (p *Position) String() string {
+	if p.Env != "" {
+		return "$" + p.Env
+	}
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+}
+
+// Diagnosis Diagnose 的结果
+type Diagnosis struct {
+	// Config 合并后的配置，没有校验错误时已填充默认值
+	Config *Config
+	// Errors 全部校验错误（Load 只返回第一个）
+	Errors []*FieldError
+	// UnknownKeys 配置结构中不存在的键（拼写错误或已废弃），Load 会静默忽略
+	UnknownKeys []*FieldError
+}
+
+// Diagnose 按 Load 的规则合并 path 的各层配置并返回全部问题及其所在位置，供部署前在 CI 中校验。
+// 返回的 error 仅表示文件无法读取或解析（YAML 语法错误自带行号）
+func (l *Loader) Diagnose(path string) (*Diagnosis, error) {
+	config, err := l.resolve(path)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Diagnosis{Config: config, Errors: l.check(config)}
+	for _, fe := range d.Errors {
+		fe.Position = l.LocateNearest(path, fe.Field)
+	}
+	if len(d.Errors) == 0 {
+		l.setDefaults(config)
+	}
+
+	layers := []string{path}
+	if l.Profile != "" {
+		layers = append(layers, ProfilePath(path, l.Profile))
+	}
+	for _, layer := range layers {
+		unknown, err := unknownKeys(layer, nil)
+		if err != nil {
+			return nil, err
+		}
+		d.UnknownKeys = append(d.UnknownKeys, unknown...)
+	}
+	return d, nil
+}
+
+// Locate 返回 field（点分隔键路径）最终生效值的来源：环境变量覆盖优先，其次 profile 覆盖文件，
+// 再次基础文件及其 include（后列出的优先）；未在任何一层中出现时返回 nil
+func (l *Loader) Locate(path, field string) *Position {
+	keys := strings.Split(field, ".")
+
+	if l.EnvPrefix != "" {
+		env := strings.ToUpper(l.EnvPrefix + "_" + strings.Join(keys, "_"))
+		if _, ok := os.LookupEnv(env); ok {
+			return &Position{Env: env}
+		}
+	}
+	if l.Profile != "" {
+		if pos := locateInLayer(ProfilePath(path, l.Profile), keys, nil); pos != nil {
+			return pos
+		}
+	}
+	return locateInLayer(path, keys, nil)
+}
+
+// LocateNearest 同 Locate，键不存在时（如缺少必填项）退而返回最近一级所在节的位置
+func (l *Loader) LocateNearest(path, field string) *Position {
+	for field != "" {
+		if pos := l.Locate(path, field); pos != nil {
+			return pos
+		}
+		idx := strings.LastIndex(field, ".")
+		if idx < 0 {
+			break
+		}
+		field = field[:idx]
+	}
+	return nil
+}
+
+// readNode 读取文件为 YAML 节点树（JSON 是 YAML 的子集，同样可得到行号）
+func readNode(path string) (*yaml.Node, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%s: failed to parse: %w", path, err)
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	return doc.Content[0], nil
+}
+
+// locateInLayer 在文件及其 include 中查找键路径，文件自身优先于其 include
+func locateInLayer(path string, keys []string, stack []string) *Position {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil
+	}
+	for _, p := range stack {
+		if p == absPath {
+			return nil
+		}
+	}
+	stack = append(stack, absPath)
+
+	root, err := readNode(path)
+	if err != nil || root == nil {
+		return nil
+	}
+
+	node := root
+	for i, key := range keys {
+		keyNode, value := mappingEntry(node, key)
+		if keyNode == nil {
+			break
+		}
+		if i == len(keys)-1 {
+			return &Position{File: path, Line: keyNode.Line, Column: keyNode.Column}
+		}
+		node = value
+	}
+
+	includes := nodeIncludes(root)
+	for i := len(includes) - 1; i >= 0; i-- {
+		inc := includes[i]
+		if !filepath.IsAbs(inc) {
+			inc = filepath.Join(filepath.Dir(path), inc)
+		}
+		if pos := locateInLayer(inc, keys, stack); pos != nil {
+			return pos
+		}
+	}
+	return nil
+}
+
+// mappingEntry 返回映射节点中 key 对应的键节点与值节点
+func mappingEntry(node *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i], node.Content[i+1]
+		}
+	}
+	return nil, nil
+}
+
+// nodeIncludes 读取顶层 include 列表（格式错误由 Load 报告，这里忽略）
+func nodeIncludes(root *yaml.Node) []string {
+	_, value := mappingEntry(root, includeKey)
+	if value == nil {
+		return nil
+	}
+	switch value.Kind {
+	case yaml.ScalarNode:
+		return []string{value.Value}
+	case yaml.SequenceNode:
+		var paths []string
+		for _, item := range value.Content {
+			if item.Kind == yaml.ScalarNode {
+				paths = append(paths, item.Value)
+			}
+		}
+		return paths
+	}
+	return nil
+}
+
+// unknownKeys 返回文件及其 include 中 Config 结构不存在的键
+func unknownKeys(path string, stack []string) ([]*FieldError, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve config path: %w", err)
+	}
+	for _, p := range stack {
+		if p == absPath {
+			return nil, nil // 循环引用由 Load 报告
+		}
+	}
+	stack = append(stack, absPath)
+
+	root, err := readNode(path)
+	if err != nil || root == nil {
+		return nil, err
+	}
+
+	var found []*FieldError
+	for _, inc := range nodeIncludes(root) {
+		if !filepath.IsAbs(inc) {
+			inc = filepath.Join(filepath.Dir(path), inc)
+		}
+		unknown, err := unknownKeys(inc, stack)
+		if err != nil {
+			return nil, err
+		}
+		found = append(found, unknown...)
+	}
+
+	walkUnknown(root, reflect.TypeOf(Config{}), "", func(field string, key *yaml.Node) {
+		found = append(found, &FieldError{
+			Field:    field,
+			Message:  "unknown key (ignored when loading)",
+			Position: &Position{File: path, Line: key.Line, Column: key.Column},
+		})
+	})
+	return found, nil
+}
+
+// walkUnknown 对照结构体的 yaml 标签遍历映射节点，报告不存在的键
+func walkUnknown(node *yaml.Node, t reflect.Type, prefix string, report func(field string, key *yaml.Node)) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || node.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if prefix == "" && key.Value == includeKey {
+			continue
+		}
+		field := key.Value
+		if prefix != "" {
+			field = prefix + "." + key.Value
+		}
+		sf, ok := fieldByTag(t, key.Value)
+		if !ok {
+			report(field, key)
+			continue
+		}
+		walkUnknown(value, sf.Type, field, report)
+	}
+}
+
+// fieldByTag 按 yaml 标签名查找结构体字段
+func fieldByTag(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.IsExported() && yamlName(field) == name {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// yamlName 返回字段的 yaml 键名，未导出到配置时为空
+func yamlName(field reflect.StructField) string {
+	name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+	if name == "-" {
+		return ""
+	}
+	return name
+}
+
+// tlsPolicyField 定位 TLS 策略错误来自哪个键
+func tlsPolicyField(t *TLSConfig) string {
+	switch {
+	case t.MinVersion != "" && parseErr(cert.ParseTLSPolicy(t.MinVersion, "", nil, nil)):
+		return "tls.min_version"
+	case t.MaxVersion != "" && parseErr(cert.ParseTLSPolicy("", t.MaxVersion, nil, nil)):
+		return "tls.max_version"
+	case len(t.CipherSuites) > 0 && parseErr(cert.ParseTLSPolicy("", "", t.CipherSuites, nil)):
+		return "tls.cipher_suites"
+	case len(t.CurvePreferences) > 0 && parseErr(cert.ParseTLSPolicy("", "", nil, t.CurvePreferences)):
+		return "tls.curve_preferences"
+	default:
+		return "tls.min_version" // 版本范围冲突
+	}
+}
+
+func parseErr(_ *cert.TLSPolicy, err error) bool {
+	return err != nil
+}
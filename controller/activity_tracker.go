@@ -0,0 +1,130 @@
+package controller
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/houzhh15/sdp-common/clock"
+)
+
+// defaultActivityFlushInterval 隧道活跃时间写回 tunnel.Manager 的默认间隔
+const defaultActivityFlushInterval = time.Second
+
+// ActivityTracker 记录数据面上报的隧道活跃时间：Touch 只做原子比较交换（不加锁、不访问存储），
+// 后台按固定间隔把变化过的时间批量写回，避免每个连接/数据包都串行经过管理器锁或数据库写入
+type ActivityTracker struct {
+	entries sync.Map // map[string]*activityEntry
+	flushFn func(seen map[string]time.Time) (missing []string)
+
+	interval time.Duration
+	clock    clock.Clock
+
+	stopChan  chan struct{}
+	doneChan  chan struct{}
+	closeOnce sync.Once
+}
+
+// activityEntry 单个隧道的活跃时间（UnixNano），flushed 为已写回的值
+type activityEntry struct {
+	last    atomic.Int64
+	flushed atomic.Int64
+}
+
+// NewActivityTracker 创建并启动活跃时间跟踪器；flush 返回已不存在的隧道 ID，其记录随之丢弃。
+// interval <= 0 时使用默认 1s
+func NewActivityTracker(interval time.Duration, clk clock.Clock, flush func(seen map[string]time.Time) (missing []string)) *ActivityTracker {
+	if interval <= 0 {
+		interval = defaultActivityFlushInterval
+	}
+	t := &ActivityTracker{
+		flushFn:  flush,
+		interval: interval,
+		clock:    clock.Or(clk),
+		stopChan: make(chan struct{}),
+		doneChan: make(chan struct{}),
+	}
+	go t.loop()
+	return t
+}
+
+// Touch 记录隧道在 at 时刻活跃，早于已记录时间的调用被忽略
+func (t *ActivityTracker) Touch(tunnelID string, at time.Time) {
+	val, ok := t.entries.Load(tunnelID)
+	if !ok {
+		val, _ = t.entries.LoadOrStore(tunnelID, &activityEntry{})
+	}
+	entry := val.(*activityEntry)
+
+	nanos := at.UnixNano()
+	for {
+		last := entry.last.Load()
+		if nanos <= last || entry.last.CompareAndSwap(last, nanos) {
+			return
+		}
+	}
+}
+
+// LastActive 返回跟踪器中记录的最近活跃时间（可能尚未写回）
+func (t *ActivityTracker) LastActive(tunnelID string) (time.Time, bool) {
+	val, ok := t.entries.Load(tunnelID)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(0, val.(*activityEntry).last.Load()), true
+}
+
+// Forget 丢弃隧道的活跃记录（隧道删除后调用）
+func (t *ActivityTracker) Forget(tunnelID string) {
+	t.entries.Delete(tunnelID)
+}
+
+// Flush 立即写回自上次写回以来变化过的活跃时间
+func (t *ActivityTracker) Flush() {
+	seen := make(map[string]time.Time)
+	pending := make(map[string]int64)
+	t.entries.Range(func(key, value interface{}) bool {
+		entry := value.(*activityEntry)
+		if last := entry.last.Load(); last > entry.flushed.Load() {
+			seen[key.(string)] = time.Unix(0, last)
+			pending[key.(string)] = last
+		}
+		return true
+	})
+	if len(seen) == 0 {
+		return
+	}
+
+	for _, id := range t.flushFn(seen) {
+		t.entries.Delete(id)
+		delete(pending, id)
+	}
+	for id, nanos := range pending {
+		if val, ok := t.entries.Load(id); ok {
+			val.(*activityEntry).flushed.Store(nanos)
+		}
+	}
+}
+
+// Close 停止后台写回并写回剩余记录，可重复调用
+func (t *ActivityTracker) Close() {
+	t.closeOnce.Do(func() { close(t.stopChan) })
+	<-t.doneChan
+	t.Flush()
+}
+
+func (t *ActivityTracker) loop() {
+	defer close(t.doneChan)
+
+	ticker := t.clock.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.stopChan:
+			return
+		case <-ticker.C():
+			t.Flush()
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package controller
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/houzhh15/sdp-common/clock"
+	"github.com/houzhh15/sdp-common/logging"
+	"github.com/houzhh15/sdp-common/tunnel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestActivityTracker(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(start)
+
+	flushed := make(chan map[string]time.Time, 4)
+	tracker := NewActivityTracker(time.Second, clk, func(seen map[string]time.Time) []string {
+		flushed <- seen
+		return []string{"gone"}
+	})
+	defer tracker.Close()
+
+	// 并发 Touch 只保留最大值
+	var wg sync.WaitGroup
+	for i := 1; i <= 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tracker.Touch("t1", start.Add(time.Duration(i)*time.Millisecond))
+		}(i)
+	}
+	wg.Wait()
+	tracker.Touch("t1", start) // 更早的时间被忽略
+	tracker.Touch("gone", start)
+
+	at, ok := tracker.LastActive("t1")
+	require.True(t, ok)
+	assert.True(t, at.Equal(start.Add(50*time.Millisecond)))
+
+	clk.BlockUntil(1)
+	clk.Advance(time.Second)
+	seen := <-flushed
+	assert.Len(t, seen, 2)
+	assert.True(t, seen["t1"].Equal(start.Add(50*time.Millisecond)))
+
+	// flush 报告不存在的隧道被丢弃；未变化的记录不重复写回
+	_, ok = tracker.LastActive("gone")
+	assert.False(t, ok)
+	tracker.Flush()
+	select {
+	case seen := <-flushed:
+		t.Fatalf("unexpected flush: %v", seen)
+	default:
+	}
+
+	tracker.Touch("t1", start.Add(time.Second))
+	tracker.Close()
+	seen = <-flushed
+	assert.True(t, seen["t1"].Equal(start.Add(time.Second)))
+}
+
+func TestTunnelStoreAdapter_Update(t *testing.T) {
+	logger, err := logging.NewLogger(&logging.Config{Level: "error", Format: "json", Output: "stdout"})
+	require.NoError(t, err)
+	manager := NewInMemoryTunnelManager(logger).(*InMemoryTunnelManager)
+
+	created := time.Now().Add(-time.Hour)
+	manager.tunnels.Store("t1", &tunnel.Tunnel{
+		ID:         "t1",
+		CreatedAt:  created,
+		LastActive: created,
+		Metadata:   map[string]interface{}{"target_host": "127.0.0.1", "target_port": 8080},
+	})
+
+	store := NewTunnelStoreAdapter(manager)
+	adapter := store.(*TunnelStoreAdapter)
+	defer adapter.Close()
+
+	now := time.Now()
+	require.NoError(t, store.Update("t1", now))
+	require.NoError(t, store.Update("missing", now))
+
+	// 写回前 Get 已返回最新活跃时间，管理器中仍为旧值
+	info, err := store.Get("t1")
+	require.NoError(t, err)
+	assert.True(t, info.LastActive.Equal(now))
+	tun, err := manager.GetTunnel(context.Background(), "t1")
+	require.NoError(t, err)
+	assert.True(t, tun.LastActive.Equal(created))
+
+	adapter.activity.Flush()
+	tun, err = manager.GetTunnel(context.Background(), "t1")
+	require.NoError(t, err)
+	assert.True(t, tun.LastActive.Equal(now))
+	_, ok := adapter.activity.LastActive("missing")
+	assert.False(t, ok)
+}
@@ -0,0 +1,388 @@
+package controller
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/houzhh15/sdp-common/cert"
+	"github.com/houzhh15/sdp-common/logging"
+	"github.com/houzhh15/sdp-common/session"
+	"github.com/houzhh15/sdp-common/transport"
+	"github.com/houzhh15/sdp-common/tunnel"
+)
+
+const (
+	// defaultAdminClass 默认管理员客户端类别（证书 OU）
+	defaultAdminClass = "admin"
+
+	// defaultAuditLimit / maxAuditLimit 审计事件查询条数
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+
+	// defaultCertPageSize / maxCertPageSize 证书列表分页大小
+	defaultCertPageSize = 100
+	maxCertPageSize     = 1000
+
+	// defaultPolicyStatsLimit / maxPolicyStatsLimit 慢策略排行条数
+	defaultPolicyStatsLimit = 20
+	maxPolicyStatsLimit     = 1000
+)
+
+// dashboardAssets 内置管理控制台静态资源
+//
+//go:embed dashboard
+var dashboardAssets embed.FS
+
+// adminSession 管理接口返回的会话信息（Token 脱敏）
+type adminSession struct {
+	Token        string              `json:"token"`
+	ClientID     string              `json:"client_id"`
+	ClientClass  string              `json:"client_class,omitempty"`
+	Tenant       string              `json:"tenant,omitempty"`
+	DeviceInfo   *session.DeviceInfo `json:"device_info,omitempty"`
+	CreatedAt    time.Time           `json:"created_at"`
+	ExpiresAt    time.Time           `json:"expires_at"`
+	LastAccessAt time.Time           `json:"last_access_at"`
+	RefreshCount int                 `json:"refresh_count"`
+}
+
+// adminTunnel 管理接口返回的隧道信息，附带中继实时字节数（未进入中继时为空）
+type adminTunnel struct {
+	*tunnel.Tunnel
+	Relay *transport.TunnelRelayStats `json:"relay,omitempty"`
+}
+
+// adminCert 管理接口返回的证书信息，附带剩余天数与是否处于告警窗口
+type adminCert struct {
+	*cert.CertInfo
+	DaysRemaining int  `json:"days_remaining"` // 已过期为负数
+	Expiring      bool `json:"expiring"`       // 在 CertExpiryWarning 窗口内（含已过期）
+}
+
+// registerAdminHandlers registers RBAC-protected admin APIs and the optional dashboard
+func (c *Controller) registerAdminHandlers() {
+	c.handleVersioned("/api/{version}/admin/sessions", c.requireAdmin(c.handleAdminSessions))
+	c.handleVersioned("/api/{version}/admin/tunnels", c.requireAdmin(c.handleAdminTunnels))
+	c.handleVersioned("/api/{version}/admin/agents", c.requireAdmin(c.handleAdminAgents))
+	c.handleVersioned("/api/{version}/admin/relays", c.requireAdmin(c.handleAdminRelays))
+	c.handleVersioned("/api/{version}/admin/audit", c.requireAdmin(c.handleAdminAudit))
+	c.handleVersioned("/api/{version}/admin/audit/export", c.requireAdmin(c.handleAdminAuditExport))
+	c.handleVersioned("/api/{version}/admin/audit/purge", c.requireAdminMethods(c.handleAdminAuditPurge, http.MethodGet, http.MethodPost))
+	c.handleVersioned("/api/{version}/admin/policies", c.requireAdmin(c.handleAdminPolicies))
+	c.handleVersioned("/api/{version}/admin/policies/stats", c.requireAdmin(c.handleAdminPolicyStats))
+	c.handleVersioned("/api/{version}/admin/telemetry", c.requireAdmin(c.handleAdminTelemetry))
+	c.handleVersioned("/api/{version}/admin/certs", c.requireAdmin(c.handleAdminCerts))
+	c.handleVersioned("/api/{version}/admin/recycle-bin", c.requireAdminMethods(c.handleAdminRecycleBin, http.MethodGet, http.MethodDelete))
+	c.handleVersioned("/api/{version}/admin/recycle-bin/restore", c.requireAdminMethods(c.handleAdminRecycleBinRestore, http.MethodPost))
+	c.handleVersioned("/api/{version}/admin/maintenance", c.requireAdminMethods(c.handleAdminMaintenance, http.MethodGet, http.MethodPost, http.MethodDelete))
+	c.handleVersioned("/api/{version}/admin/trust", c.requireAdminMethods(c.handleAdminTrust, http.MethodGet, http.MethodPost, http.MethodDelete))
+	c.handleVersioned("/api/{version}/admin/events", c.requireAdmin(c.handleAdminEvents))
+	c.registerFaultHandlers()
+
+	if c.config != nil && c.config.EnableDashboard {
+		// 静态资源本身不含敏感数据，数据接口均需管理员会话
+		assets, _ := fs.Sub(dashboardAssets, "dashboard")
+		c.handle(routeRoles("/admin/"), "/admin/", http.StripPrefix("/admin/", http.FileServer(http.FS(assets))))
+	}
+}
+
+// requireAdmin 校验 Bearer 会话且客户端类别属于 AdminClasses，仅允许 GET
+func (c *Controller) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return c.requireAdminMethods(next, http.MethodGet)
+}
+
+// requireAdminMethods 同 requireAdmin，允许指定的 HTTP 方法
+func (c *Controller) requireAdminMethods(next http.HandlerFunc, methods ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		allowed := false
+		for _, m := range methods {
+			if r.Method == m {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		token := extractBearerToken(r)
+		if token == "" {
+			respondErrorWithStatus(w, "UNAUTHORIZED", "Missing authorization token", nil, http.StatusUnauthorized)
+			return
+		}
+
+		sess, err := c.sessionManager.ValidateSession(r.Context(), token)
+		if err != nil {
+			respondErrorWithStatus(w, "UNAUTHORIZED", "Invalid or expired session", nil, http.StatusUnauthorized)
+			return
+		}
+
+		if !c.isAdminClass(sess.ClientClass) {
+			c.logger.Warn("Admin access denied", "client_id", sess.ClientID, "client_class", sess.ClientClass, "path", r.URL.Path)
+			c.auditAccess(r.Context(), &logging.AccessEvent{
+				ClientID: sess.ClientID,
+				SourceIP: transport.ClientIPFromRequest(r),
+				Action:   "admin_access",
+				Result:   "denied",
+				Reason:   "client class is not an admin class",
+			})
+			respondErrorWithStatus(w, "FORBIDDEN", "Admin privileges required", nil, http.StatusForbidden)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// isAdminClass 检查客户端类别是否具备管理权限
+func (c *Controller) isAdminClass(class string) bool {
+	if class == "" {
+		return false
+	}
+
+	classes := []string{defaultAdminClass}
+	if c.config != nil && len(c.config.AdminClasses) > 0 {
+		classes = c.config.AdminClasses
+	}
+	for _, allowed := range classes {
+		if allowed == class {
+			return true
+		}
+	}
+	return false
+}
+
+// auditAccess 记录访问审计事件（未配置审计日志时忽略）
+func (c *Controller) auditAccess(ctx context.Context, event *logging.AccessEvent) {
+	if c.auditLogger == nil {
+		return
+	}
+	if err := c.auditLogger.LogAccess(ctx, event); err != nil {
+		c.logger.Warn("Failed to write audit event", "action", event.Action, "error", err)
+	}
+}
+
+// handleAdminSessions lists active sessions (tokens masked)
+func (c *Controller) handleAdminSessions(w http.ResponseWriter, r *http.Request) {
+	sessions, err := c.sessionManager.GetActiveSessions(r.Context())
+	if err != nil {
+		respondErrorWithStatus(w, "INTERNAL_ERROR", "Failed to retrieve sessions", nil, http.StatusInternalServerError)
+		return
+	}
+
+	result := make([]*adminSession, 0, len(sessions))
+	for _, sess := range sessions {
+		result = append(result, &adminSession{
+			Token:        maskToken(sess.Token),
+			ClientID:     sess.ClientID,
+			ClientClass:  sess.ClientClass,
+			Tenant:       sess.Tenant,
+			DeviceInfo:   sess.DeviceInfo,
+			CreatedAt:    sess.CreatedAt,
+			ExpiresAt:    sess.ExpiresAt,
+			LastAccessAt: sess.LastAccessAt,
+			RefreshCount: sess.RefreshCount,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.After(result[j].CreatedAt) })
+
+	respondAdmin(w, "admin_sessions", map[string]interface{}{"sessions": result})
+}
+
+// handleAdminTunnels lists all tunnels merged with live relay byte counts
+func (c *Controller) handleAdminTunnels(w http.ResponseWriter, r *http.Request) {
+	tunnels, err := c.tunnelManager.ListTunnels(r.Context(), &tunnel.TunnelFilter{
+		IncludeFailed: r.URL.Query().Get("include_failed") == "true",
+	})
+	if err != nil {
+		respondErrorWithStatus(w, "INTERNAL_ERROR", "Failed to retrieve tunnels", nil, http.StatusInternalServerError)
+		return
+	}
+
+	relays := make(map[string]*transport.TunnelRelayStats)
+	if c.relayServer != nil {
+		for _, stats := range c.relayServer.GetTunnelStats() {
+			relays[stats.TunnelID] = stats
+		}
+	}
+
+	result := make([]*adminTunnel, 0, len(tunnels))
+	for _, tun := range tunnels {
+		copied := *tun
+		if copied.SessionToken != "" {
+			copied.SessionToken = maskToken(copied.SessionToken)
+		}
+		result = append(result, &adminTunnel{Tunnel: &copied, Relay: relays[tun.ID]})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.After(result[j].CreatedAt) })
+
+	respondAdmin(w, "admin_tunnels", map[string]interface{}{"tunnels": result})
+}
+
+// handleAdminAgents lists agents connected to the SSE notifier
+func (c *Controller) handleAdminAgents(w http.ResponseWriter, r *http.Request) {
+	agents := c.tunnelNotifier.GetClients()
+	if agents == nil {
+		agents = []string{}
+	}
+	sort.Strings(agents)
+
+	respondAdmin(w, "admin_agents", map[string]interface{}{"agents": agents})
+}
+
+// handleAdminAudit returns the most recent audit events
+// Query parameters: limit (default 100, max 1000), client_id, action
+func (c *Controller) handleAdminAudit(w http.ResponseWriter, r *http.Request) {
+	limit := defaultAuditLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			respondError(w, "INVALID_REQUEST", "Invalid limit", nil)
+			return
+		}
+		limit = min(n, maxAuditLimit)
+	}
+
+	events := []*logging.AuditLog{}
+	if c.auditLogger != nil {
+		logs, err := c.auditLogger.Query(r.Context(), &logging.AuditFilter{
+			ClientID: r.URL.Query().Get("client_id"),
+			Action:   r.URL.Query().Get("action"),
+		})
+		if err != nil {
+			respondErrorWithStatus(w, "INTERNAL_ERROR", "Failed to query audit log", nil, http.StatusInternalServerError)
+			return
+		}
+		// 取最近的 limit 条，按时间倒序
+		if len(logs) > limit {
+			logs = logs[len(logs)-limit:]
+		}
+		for i := len(logs) - 1; i >= 0; i-- {
+			events = append(events, logs[i])
+		}
+	}
+
+	respondAdmin(w, "admin_audit", map[string]interface{}{
+		"enabled": c.auditLogger != nil,
+		"events":  events,
+	})
+}
+
+// handleAdminPolicies lists all policies
+func (c *Controller) handleAdminPolicies(w http.ResponseWriter, r *http.Request) {
+	policies, err := c.policyEngine.ListPolicies(r.Context(), nil)
+	if err != nil {
+		c.logger.Error("Failed to list policies", "error", err)
+		respondErrorWithStatus(w, "INTERNAL_ERROR", "Failed to retrieve policies", nil, http.StatusInternalServerError)
+		return
+	}
+
+	respondAdmin(w, "admin_policies", map[string]interface{}{"policies": policies})
+}
+
+// handleAdminPolicyStats lists per-policy evaluation counts and latencies, slowest (by average) first
+// Query parameters: limit (default 20, max 1000)
+func (c *Controller) handleAdminPolicyStats(w http.ResponseWriter, r *http.Request) {
+	limit := defaultPolicyStatsLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			respondError(w, "INVALID_REQUEST", "Invalid limit", nil)
+			return
+		}
+		limit = min(n, maxPolicyStatsLimit)
+	}
+
+	budget := c.policyEngine.EvaluationBudget()
+	respondAdmin(w, "admin_policy_stats", map[string]interface{}{
+		"policies":  c.policyEngine.SlowestPolicies(limit),
+		"budget_ms": float64(max(budget, 0)) / float64(time.Millisecond),
+	})
+}
+
+// handleAdminCerts lists registered certificates with expiry and last-seen info
+// Query parameters: status (active/revoked/expired), expiring=true (only certs within the warning window,
+// soonest first), page (default 1), page_size (default 100, max 1000)
+func (c *Controller) handleAdminCerts(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	page, pageSize := 1, defaultCertPageSize
+	if v := query.Get("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			respondError(w, "INVALID_REQUEST", "Invalid page", nil)
+			return
+		}
+		page = n
+	}
+	if v := query.Get("page_size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			respondError(w, "INVALID_REQUEST", "Invalid page_size", nil)
+			return
+		}
+		pageSize = min(n, maxCertPageSize)
+	}
+
+	now := time.Now()
+	warning := c.certScanner.Warning()
+
+	var (
+		certs []*cert.CertInfo
+		total int64
+		err   error
+	)
+	if query.Get("expiring") == "true" {
+		certs, err = c.certRegistry.ExpiringBefore(now.Add(warning))
+		total = int64(len(certs))
+	} else {
+		certs, total, err = c.certRegistry.List(page, pageSize, cert.CertStatus(query.Get("status")))
+	}
+	if err != nil {
+		c.logger.Error("Failed to list certificates", "error", err)
+		respondErrorWithStatus(w, "INTERNAL_ERROR", "Failed to retrieve certificates", nil, http.StatusInternalServerError)
+		return
+	}
+
+	result := make([]*adminCert, 0, len(certs))
+	for _, info := range certs {
+		remaining := info.NotAfter.Sub(now)
+		result = append(result, &adminCert{
+			CertInfo:      info,
+			DaysRemaining: int(remaining.Hours() / 24),
+			Expiring:      info.Status == cert.StatusActive && remaining < warning,
+		})
+	}
+
+	respondAdmin(w, "admin_certs", map[string]interface{}{
+		"certs":        result,
+		"total":        total,
+		"warning_days": int(warning.Hours() / 24),
+	})
+}
+
+// respondAdmin sends a successful admin API response
+func respondAdmin(w http.ResponseWriter, msgType string, fields map[string]interface{}) {
+	fields["type"] = msgType
+	fields["status"] = "success"
+	fields["timestamp"] = time.Now().Format(time.RFC3339)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(fields)
+}
+
+// maskToken keeps only a short prefix of the session token
+func maskToken(token string) string {
+	if len(token) <= 8 {
+		return "****"
+	}
+	return token[:8] + "****"
+}
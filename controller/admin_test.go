@@ -0,0 +1,433 @@
+package controller
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/houzhh15/sdp-common/cert"
+	"github.com/houzhh15/sdp-common/logging"
+	"github.com/houzhh15/sdp-common/policy"
+	"github.com/houzhh15/sdp-common/session"
+	"github.com/houzhh15/sdp-common/transport"
+	"github.com/houzhh15/sdp-common/tunnel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newAdminTestController(t *testing.T, cfg *Config) *Controller {
+	t.Helper()
+
+	logger, err := logging.NewLogger(&logging.Config{Level: "error", Format: "json", Output: "stdout"})
+	require.NoError(t, err)
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	storage, err := policy.NewDBStorage(db)
+	require.NoError(t, err)
+	engine, err := policy.NewEngine(&policy.Config{
+		Storage:          storage,
+		Logger:           logger,
+		DefaultDecision:  cfg.DefaultPolicyDecision,
+		ServiceDefaults:  cfg.ServicePolicyDefaults,
+		EvaluationBudget: cfg.PolicyEvaluationBudget,
+	})
+	require.NoError(t, err)
+	registry, err := cert.NewRegistry(db, logger)
+	require.NoError(t, err)
+	telemetry, err := newTelemetryStore(db)
+	require.NoError(t, err)
+
+	audit, err := logging.NewFileAuditLogger(filepath.Join(t.TempDir(), "audit.log"), logger)
+	require.NoError(t, err)
+	t.Cleanup(func() { audit.Close() })
+
+	sessionManager := session.NewManager(&session.Config{}, logger)
+	t.Cleanup(func() { sessionManager.Close() })
+
+	c := &Controller{
+		config:         cfg,
+		certRegistry:   registry,
+		certScanner:    cert.NewExpiryScanner(registry, &cert.ExpiryScannerConfig{Warning: cfg.CertExpiryWarning, Logger: logger}),
+		sessionManager: sessionManager,
+		policyEngine:   engine,
+		tunnelManager:  NewInMemoryTunnelManager(logger).(*InMemoryTunnelManager),
+		tunnelNotifier: tunnel.NewNotifier(logger, 30*time.Second),
+		auditLogger:    audit,
+		telemetry:      telemetry,
+		opsEvents:      newOpsEventLog(cfg.OpsEventCapacity),
+		relayNodes:     newRelayNodeRegistry(),
+		webhookClient:  &http.Client{Timeout: webhookTimeout},
+		logger:         logger,
+		relayServer:    transport.NewTunnelRelayServer(logger, &transport.TunnelRelayConfig{}),
+		mux:            http.NewServeMux(),
+		versions:       newVersionRegistry(nil, ""),
+	}
+	c.registerAdminHandlers()
+	return c
+}
+
+func createTestSession(t *testing.T, c *Controller, clientID, class string) string {
+	t.Helper()
+	sess, err := c.sessionManager.CreateSession(context.Background(), &session.CreateSessionRequest{
+		ClientID:    clientID,
+		ClientClass: class,
+	})
+	require.NoError(t, err)
+	return sess.Token
+}
+
+func adminGet(c *Controller, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	c.mux.ServeHTTP(w, req)
+	return w
+}
+
+func TestAdminAPI_RBAC(t *testing.T) {
+	c := newAdminTestController(t, &Config{})
+	adminToken := createTestSession(t, c, "alice", "admin")
+	userToken := createTestSession(t, c, "bob", "user")
+
+	tests := []struct {
+		name       string
+		token      string
+		wantStatus int
+	}{
+		{"missing token", "", http.StatusUnauthorized},
+		{"invalid token", "not-a-token", http.StatusUnauthorized},
+		{"non-admin class", userToken, http.StatusForbidden},
+		{"admin class", adminToken, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := adminGet(c, "/api/v1/admin/sessions", tt.token)
+			assert.Equal(t, tt.wantStatus, w.Code)
+		})
+	}
+
+	// 拒绝访问写入审计日志
+	logs, err := c.auditLogger.Query(context.Background(), &logging.AuditFilter{Action: "admin_access"})
+	require.NoError(t, err)
+	assert.Len(t, logs, 1)
+}
+
+func TestAdminAPI_CustomAdminClasses(t *testing.T) {
+	c := newAdminTestController(t, &Config{AdminClasses: []string{"ops"}})
+
+	assert.Equal(t, http.StatusOK, adminGet(c, "/api/v1/admin/agents", createTestSession(t, c, "carol", "ops")).Code)
+	assert.Equal(t, http.StatusForbidden, adminGet(c, "/api/v1/admin/agents", createTestSession(t, c, "dave", "admin")).Code)
+}
+
+func TestAdminAPI_SessionsMasked(t *testing.T) {
+	c := newAdminTestController(t, &Config{})
+	token := createTestSession(t, c, "alice", "admin")
+
+	w := adminGet(c, "/api/v2/admin/sessions", token)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp struct {
+		Type     string          `json:"type"`
+		Sessions []*adminSession `json:"sessions"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "admin_sessions", resp.Type)
+	require.Len(t, resp.Sessions, 1)
+	assert.Equal(t, "alice", resp.Sessions[0].ClientID)
+	assert.NotContains(t, w.Body.String(), token)
+}
+
+func TestAdminAPI_TunnelsMasked(t *testing.T) {
+	c := newAdminTestController(t, &Config{})
+	token := createTestSession(t, c, "alice", "admin")
+
+	require.NoError(t, c.tunnelManager.CreateServiceConfig(context.Background(), &tunnel.ServiceConfig{
+		ServiceID:  "svc-1",
+		TargetHost: "127.0.0.1",
+		TargetPort: 8080,
+	}))
+	_, err := c.tunnelManager.CreateTunnel(context.Background(), &tunnel.CreateTunnelRequest{
+		SessionToken: token,
+		ClientID:     "alice",
+		ServiceID:    "svc-1",
+		Protocol:     "tcp",
+	})
+	require.NoError(t, err)
+
+	w := adminGet(c, "/api/v1/admin/tunnels", token)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), token)
+
+	var resp struct {
+		Tunnels []map[string]interface{} `json:"tunnels"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Tunnels, 1)
+	assert.Equal(t, "svc-1", resp.Tunnels[0]["service_id"])
+	assert.NotContains(t, resp.Tunnels[0], "relay")
+}
+
+func TestAdminAPI_Audit(t *testing.T) {
+	c := newAdminTestController(t, &Config{})
+	token := createTestSession(t, c, "alice", "admin")
+
+	for _, action := range []string{"handshake", "tunnel_create", "tunnel_create"} {
+		c.auditAccess(context.Background(), &logging.AccessEvent{ClientID: "alice", Action: action, Result: "success"})
+	}
+
+	w := adminGet(c, "/api/v1/admin/audit?limit=2", token)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp struct {
+		Enabled bool                `json:"enabled"`
+		Events  []*logging.AuditLog `json:"events"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.True(t, resp.Enabled)
+	assert.Len(t, resp.Events, 2)
+
+	assert.Equal(t, http.StatusBadRequest, adminGet(c, "/api/v1/admin/audit?limit=x", token).Code)
+}
+
+func TestAdminAPI_AuditExport(t *testing.T) {
+	c := newAdminTestController(t, &Config{})
+	token := createTestSession(t, c, "alice", "admin")
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, action := range []string{"handshake", "tunnel_create", "tunnel_create", "tunnel_create"} {
+		c.auditAccess(context.Background(), &logging.AccessEvent{
+			Timestamp: start.Add(time.Duration(i) * time.Minute), ClientID: "bob", Action: action, Result: "success",
+		})
+	}
+
+	decode := func(r io.Reader) []*logging.AuditExportRecord {
+		var recs []*logging.AuditExportRecord
+		dec := json.NewDecoder(r)
+		for dec.More() {
+			var rec logging.AuditExportRecord
+			require.NoError(t, dec.Decode(&rec))
+			recs = append(recs, &rec)
+		}
+		return recs
+	}
+
+	// gzip + 时间范围 + 条数限制
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/audit/export?action=tunnel_create&start=2026-01-01T00:01:00Z&limit=2", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	c.mux.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+	require.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	gz, err := gzip.NewReader(w.Body)
+	require.NoError(t, err)
+	first := decode(gz)
+	require.Len(t, first, 2)
+	assert.Equal(t, "access", first[0].EventType)
+
+	// 从游标续传
+	w = adminGet(c, "/api/v1/admin/audit/export?action=tunnel_create&cursor="+first[1].Cursor, token)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	rest := decode(w.Body)
+	require.Len(t, rest, 1)
+	assert.True(t, rest[0].Timestamp.Equal(start.Add(3*time.Minute)))
+
+	assert.Equal(t, http.StatusBadRequest, adminGet(c, "/api/v1/admin/audit/export?cursor=1", token).Code)
+	assert.Equal(t, http.StatusBadRequest, adminGet(c, "/api/v1/admin/audit/export?start=yesterday", token).Code)
+	assert.Equal(t, http.StatusBadRequest, adminGet(c, "/api/v1/admin/audit/export?limit=-1", token).Code)
+
+	// 导出操作本身计入审计
+	logs, err := c.auditLogger.Query(context.Background(), &logging.AuditFilter{Action: "audit_export"})
+	require.NoError(t, err)
+	assert.Len(t, logs, 2)
+}
+
+func TestAdminAPI_AuditPurge(t *testing.T) {
+	c := newAdminTestController(t, &Config{AuditRetention: logging.AuditRetention{MaxAge: 24 * time.Hour}})
+	token := createTestSession(t, c, "alice", "admin")
+
+	now := time.Now()
+	for _, age := range []time.Duration{72 * time.Hour, 48 * time.Hour, time.Hour} {
+		c.auditAccess(context.Background(), &logging.AccessEvent{Timestamp: now.Add(-age), ClientID: "bob", Action: "tunnel_create", Result: "success"})
+	}
+
+	purge := func(body string) (*httptest.ResponseRecorder, *logging.AuditPurgeReport) {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/audit/purge", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		c.mux.ServeHTTP(w, req)
+		var resp struct {
+			Report *logging.AuditPurgeReport `json:"report"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w, resp.Report
+	}
+
+	// dry-run 报告将被清理的记录，不修改日志
+	w, report := purge(`{"dry_run": true}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.True(t, report.DryRun)
+	assert.Equal(t, 2, report.Removed)
+	require.NotEmpty(t, report.Summaries)
+	assert.Equal(t, "tunnel_create", report.Summaries[0].Action)
+
+	w, report = purge("")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.False(t, report.DryRun)
+	// dry-run 的审计记录（不早于截止时间）保留
+	assert.Equal(t, 2, report.Removed)
+
+	logs, err := c.auditLogger.Query(context.Background(), &logging.AuditFilter{ClientID: "bob"})
+	require.NoError(t, err)
+	assert.Len(t, logs, 1)
+	logs, err = c.auditLogger.Query(context.Background(), &logging.AuditFilter{Action: "audit_purge"})
+	require.NoError(t, err)
+	assert.Len(t, logs, 2)
+
+	var history struct {
+		Purges []*logging.AuditPurgeReport `json:"purges"`
+	}
+	w = adminGet(c, "/api/v1/admin/audit/purge", token)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &history))
+	require.Len(t, history.Purges, 1)
+	assert.Equal(t, 2, history.Purges[0].Removed)
+
+	w, _ = purge(`{"max_age": "yesterday"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w, _ = purge(`{"max_size": -1}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, http.StatusForbidden, adminGet(c, "/api/v1/admin/audit/purge", createTestSession(t, c, "bob", "user")).Code)
+}
+
+func TestAdminAPI_Policies(t *testing.T) {
+	c := newAdminTestController(t, &Config{})
+	token := createTestSession(t, c, "alice", "admin")
+
+	require.NoError(t, c.policyEngine.SavePolicy(context.Background(), &policy.Policy{
+		PolicyID:   "p1",
+		ClientID:   "alice",
+		ServiceID:  "svc-1",
+		ExpiryTime: time.Now().Add(time.Hour),
+	}))
+
+	w := adminGet(c, "/api/v1/admin/policies", token)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp struct {
+		Policies []*policy.Policy `json:"policies"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Policies, 1)
+	assert.Equal(t, "p1", resp.Policies[0].PolicyID)
+}
+
+func TestAdminAPI_PolicyStats(t *testing.T) {
+	ctx := context.Background()
+	c := newAdminTestController(t, &Config{})
+	token := createTestSession(t, c, "alice", "admin")
+
+	for _, id := range []string{"p1", "p2"} {
+		require.NoError(t, c.policyEngine.SavePolicy(ctx, &policy.Policy{
+			PolicyID:   id,
+			ClientID:   "alice",
+			ServiceID:  "svc-" + id,
+			ExpiryTime: time.Now().Add(time.Hour),
+		}))
+		_, err := c.policyEngine.EvaluateAccess(ctx, &policy.AccessRequest{ClientID: "alice", ServiceID: "svc-" + id})
+		require.NoError(t, err)
+	}
+
+	w := adminGet(c, "/api/v1/admin/policies/stats?limit=1", token)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp struct {
+		Policies []*policy.PolicyStats `json:"policies"`
+		BudgetMs float64               `json:"budget_ms"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Policies, 1)
+	assert.Equal(t, uint64(1), resp.Policies[0].Evaluations)
+	assert.Equal(t, float64(100), resp.BudgetMs)
+
+	assert.Equal(t, http.StatusBadRequest, adminGet(c, "/api/v1/admin/policies/stats?limit=x", token).Code)
+}
+
+func TestDashboard_Embedded(t *testing.T) {
+	disabled := newAdminTestController(t, &Config{})
+	assert.Equal(t, http.StatusNotFound, adminGet(disabled, "/admin/", "").Code)
+
+	c := newAdminTestController(t, &Config{EnableDashboard: true})
+	for _, path := range []string{"/admin/", "/admin/app.js", "/admin/style.css"} {
+		w := adminGet(c, path, "")
+		assert.Equal(t, http.StatusOK, w.Code, path)
+		assert.NotEmpty(t, w.Body.Bytes(), path)
+	}
+}
+
+func TestAdminAPI_Certs(t *testing.T) {
+	c := newAdminTestController(t, &Config{CertExpiryWarning: 30 * 24 * time.Hour})
+	token := createTestSession(t, c, "alice", "admin")
+
+	now := time.Now()
+	register := func(clientID, fingerprint string, notAfter time.Time) {
+		require.NoError(t, c.certRegistry.Register(clientID, fingerprint, &x509.Certificate{
+			Subject:   pkix.Name{CommonName: clientID},
+			Issuer:    pkix.Name{CommonName: "test-ca"},
+			NotBefore: now.Add(-time.Hour),
+			NotAfter:  notAfter,
+		}))
+	}
+	register("ih-soon", "fp-soon", now.Add(10*24*time.Hour+time.Hour))
+	register("ih-later", "fp-later", now.Add(90*24*time.Hour+time.Hour))
+	require.NoError(t, c.certRegistry.Touch("fp-later"))
+
+	var resp struct {
+		Type        string       `json:"type"`
+		Certs       []*adminCert `json:"certs"`
+		Total       int64        `json:"total"`
+		WarningDays int          `json:"warning_days"`
+	}
+
+	w := adminGet(c, "/api/v1/admin/certs", token)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "admin_certs", resp.Type)
+	assert.Equal(t, int64(2), resp.Total)
+	assert.Equal(t, 30, resp.WarningDays)
+	byFP := map[string]*adminCert{}
+	for _, ac := range resp.Certs {
+		byFP[ac.Fingerprint] = ac
+	}
+	require.Len(t, byFP, 2)
+	assert.True(t, byFP["fp-soon"].Expiring)
+	assert.Equal(t, 10, byFP["fp-soon"].DaysRemaining)
+	assert.Nil(t, byFP["fp-soon"].LastSeenAt)
+	assert.False(t, byFP["fp-later"].Expiring)
+	assert.NotNil(t, byFP["fp-later"].LastSeenAt)
+
+	w = adminGet(c, "/api/v1/admin/certs?expiring=true", token)
+	require.Equal(t, http.StatusOK, w.Code)
+	resp.Certs = nil
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Certs, 1)
+	assert.Equal(t, "fp-soon", resp.Certs[0].Fingerprint)
+
+	assert.Equal(t, http.StatusBadRequest, adminGet(c, "/api/v1/admin/certs?page=0", token).Code)
+}
@@ -0,0 +1,176 @@
+package controller
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/houzhh15/sdp-common/logging"
+	"github.com/houzhh15/sdp-common/transport"
+)
+
+// auditExportFlushEvery 每导出多少条记录刷新一次响应，使 SIEM 端边下载边处理
+const auditExportFlushEvery = 100
+
+// handleAdminAuditExport streams audit events as NDJSON (one logging.AuditExportRecord per line)
+// Query parameters: start, end (RFC3339), client_id, service_id, action, result, event_type, severity,
+// cursor (resume after the record carrying it), limit (0 = all). Gzip-compressed when the client
+// sends Accept-Encoding: gzip
+func (c *Controller) handleAdminAuditExport(w http.ResponseWriter, r *http.Request) {
+	if c.auditLogger == nil {
+		respondErrorWithStatus(w, "NOT_FOUND", "Audit log is not enabled", nil, http.StatusNotFound)
+		return
+	}
+	exporter, ok := c.auditLogger.(logging.AuditExporter)
+	if !ok {
+		respondErrorWithStatus(w, "NOT_IMPLEMENTED", "Audit logger does not support export", nil, http.StatusNotImplemented)
+		return
+	}
+
+	filter, err := parseAuditExportFilter(r)
+	if err != nil {
+		respondErrorWithStatus(w, "INVALID_REQUEST", err.Error(), nil, http.StatusBadRequest)
+		return
+	}
+	cursor := r.URL.Query().Get("cursor")
+
+	stream := &auditExportStream{w: w, gzip: acceptsGzip(r)}
+	err = exporter.Export(r.Context(), filter, cursor, stream.write)
+	switch {
+	case errors.Is(err, logging.ErrInvalidCursor) && !stream.started:
+		respondErrorWithStatus(w, "INVALID_REQUEST", "Invalid cursor", nil, http.StatusBadRequest)
+		return
+	case err != nil && !stream.started:
+		c.logger.Error("Failed to export audit log", "error", err)
+		respondErrorWithStatus(w, "INTERNAL_ERROR", "Failed to export audit log", nil, http.StatusInternalServerError)
+		return
+	case err != nil:
+		// 响应已开始，只能中断；客户端用最后收到的 cursor 续传
+		c.logger.Warn("Audit export interrupted", "exported", stream.count, "error", err)
+	}
+	stream.close()
+
+	clientID := ""
+	if sess, err := c.sessionManager.ValidateSession(r.Context(), extractBearerToken(r)); err == nil {
+		clientID = sess.ClientID
+	}
+	c.auditAccess(r.Context(), &logging.AccessEvent{
+		ClientID: clientID,
+		SourceIP: transport.ClientIPFromRequest(r),
+		Action:   "audit_export",
+		Result:   "success",
+		Details:  map[string]interface{}{"exported": stream.count, "cursor": cursor},
+	})
+}
+
+// parseAuditExportFilter 解析导出过滤条件
+func parseAuditExportFilter(r *http.Request) (*logging.AuditFilter, error) {
+	query := r.URL.Query()
+	filter := &logging.AuditFilter{
+		ClientID:  query.Get("client_id"),
+		ServiceID: query.Get("service_id"),
+		Action:    query.Get("action"),
+		Result:    query.Get("result"),
+		EventType: logging.SecurityEventType(query.Get("event_type")),
+		Severity:  logging.Severity(query.Get("severity")),
+	}
+	for name, dst := range map[string]*time.Time{"start": &filter.StartTime, "end": &filter.EndTime} {
+		if v := query.Get(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return nil, errors.New("Invalid " + name + ", expected RFC3339")
+			}
+			*dst = t
+		}
+	}
+	if !filter.StartTime.IsZero() && !filter.EndTime.IsZero() && filter.EndTime.Before(filter.StartTime) {
+		return nil, errors.New("end must not be before start")
+	}
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, errors.New("Invalid limit")
+		}
+		filter.Limit = n
+	}
+	return filter, nil
+}
+
+// acceptsGzip 请求是否接受 gzip 编码
+func acceptsGzip(r *http.Request) bool {
+	for _, enc := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(enc), ";")
+		if strings.EqualFold(strings.TrimSpace(name), "gzip") && strings.ReplaceAll(params, " ", "") != "q=0" {
+			return true
+		}
+	}
+	return false
+}
+
+// auditExportStream 逐条写出导出记录，首条记录时才发送响应头，便于在此之前返回错误状态码
+type auditExportStream struct {
+	w       http.ResponseWriter
+	gzip    bool
+	gz      *gzip.Writer
+	enc     *json.Encoder
+	started bool
+	count   int
+}
+
+func (s *auditExportStream) start() {
+	s.started = true
+	header := s.w.Header()
+	header.Set("Content-Type", "application/x-ndjson")
+	header.Set("Cache-Control", "no-store")
+	header.Add("Vary", "Accept-Encoding")
+
+	var out io.Writer = s.w
+	if s.gzip {
+		header.Set("Content-Encoding", "gzip")
+		s.gz = gzip.NewWriter(s.w)
+		out = s.gz
+	}
+	s.w.WriteHeader(http.StatusOK)
+	s.enc = json.NewEncoder(out)
+}
+
+func (s *auditExportStream) write(rec *logging.AuditExportRecord) error {
+	if !s.started {
+		s.start()
+	}
+	if err := s.enc.Encode(rec); err != nil {
+		return err
+	}
+	s.count++
+	if s.count%auditExportFlushEvery == 0 {
+		s.flush()
+	}
+	return nil
+}
+
+func (s *auditExportStream) flush() {
+	if s.gz != nil {
+		s.gz.Flush()
+	}
+	if f, ok := s.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// close 结束响应（无匹配记录时返回空的 200 响应）
+func (s *auditExportStream) close() {
+	if !s.started {
+		s.start()
+	}
+	if s.gz != nil {
+		s.gz.Close()
+	}
+	if f, ok := s.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
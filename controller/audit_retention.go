@@ -0,0 +1,132 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/houzhh15/sdp-common/clock"
+	"github.com/houzhh15/sdp-common/logging"
+	"github.com/houzhh15/sdp-common/transport"
+)
+
+// auditPurgeRequest 手动清理请求，未指定的限制使用 Config.AuditRetention
+type auditPurgeRequest struct {
+	DryRun  bool   `json:"dry_run"`
+	MaxAge  string `json:"max_age,omitempty"` // Go duration，如 "720h"
+	MaxSize int64  `json:"max_size,omitempty"`
+}
+
+// auditPurger 返回支持清理的审计日志记录器
+func (c *Controller) auditPurger() (logging.AuditPurger, bool) {
+	if c.auditLogger == nil {
+		return nil, false
+	}
+	purger, ok := c.auditLogger.(logging.AuditPurger)
+	return purger, ok
+}
+
+// handleAdminAuditPurge lists past purges with their summaries (GET) or purges the audit log
+// by the configured or requested retention (POST, {"dry_run": true} reports without deleting)
+func (c *Controller) handleAdminAuditPurge(w http.ResponseWriter, r *http.Request) {
+	if c.auditLogger == nil {
+		respondErrorWithStatus(w, "NOT_FOUND", "Audit log is not enabled", nil, http.StatusNotFound)
+		return
+	}
+	purger, ok := c.auditPurger()
+	if !ok {
+		respondErrorWithStatus(w, "NOT_IMPLEMENTED", "Audit logger does not support purge", nil, http.StatusNotImplemented)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		history, err := purger.PurgeHistory(r.Context())
+		if err != nil {
+			c.logger.Error("Failed to read audit purge history", "error", err)
+			respondErrorWithStatus(w, "INTERNAL_ERROR", "Failed to read audit purge history", nil, http.StatusInternalServerError)
+			return
+		}
+		respondAdmin(w, "admin_audit_purges", map[string]interface{}{
+			"retention": c.config.AuditRetention,
+			"purges":    history,
+		})
+		return
+	}
+
+	var req auditPurgeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		respondErrorWithStatus(w, "INVALID_REQUEST", "Invalid request body", nil, http.StatusBadRequest)
+		return
+	}
+	retention := c.config.AuditRetention
+	if req.MaxAge != "" {
+		maxAge, err := time.ParseDuration(req.MaxAge)
+		if err != nil {
+			respondErrorWithStatus(w, "INVALID_REQUEST", "Invalid max_age", nil, http.StatusBadRequest)
+			return
+		}
+		retention.MaxAge = maxAge
+	}
+	if req.MaxSize != 0 {
+		retention.MaxSize = req.MaxSize
+	}
+	if err := retention.Validate(); err != nil {
+		respondErrorWithStatus(w, "INVALID_REQUEST", err.Error(), nil, http.StatusBadRequest)
+		return
+	}
+	if !retention.IsSet() {
+		respondErrorWithStatus(w, "INVALID_REQUEST", "No audit retention configured, max_age or max_size is required", nil, http.StatusBadRequest)
+		return
+	}
+
+	report, err := purger.Purge(r.Context(), retention, req.DryRun)
+	if err != nil {
+		c.logger.Error("Failed to purge audit log", "error", err)
+		respondErrorWithStatus(w, "INTERNAL_ERROR", "Failed to purge audit log", nil, http.StatusInternalServerError)
+		return
+	}
+
+	clientID := ""
+	if sess, err := c.sessionManager.ValidateSession(r.Context(), extractBearerToken(r)); err == nil {
+		clientID = sess.ClientID
+	}
+	c.logger.Info("Audit log purge requested", "client_id", clientID, "dry_run", req.DryRun, "removed", report.Removed, "removed_bytes", report.RemovedBytes)
+	c.auditAccess(r.Context(), &logging.AccessEvent{
+		ClientID: clientID,
+		SourceIP: transport.ClientIPFromRequest(r),
+		Action:   "audit_purge",
+		Result:   "success",
+		Details:  map[string]interface{}{"dry_run": req.DryRun, "removed": report.Removed, "removed_bytes": report.RemovedBytes},
+	})
+	respondAdmin(w, "audit_purge", map[string]interface{}{"report": report})
+}
+
+// purgeAuditLog periodically purges audit records beyond AuditRetention, keeping summaries
+func (c *Controller) purgeAuditLog(ctx context.Context) {
+	purger, ok := c.auditPurger()
+	if !ok || !c.config.AuditRetention.IsSet() {
+		return
+	}
+
+	clk := clock.Or(c.config.Clock)
+	ticker := clk.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		report, err := purger.Purge(ctx, c.config.AuditRetention, false)
+		if err != nil {
+			c.logger.Warn("Failed to purge audit log", "error", err)
+		} else if report.RemovedBytes > 0 {
+			c.logger.Info("Audit log purged", "records", report.Removed, "bytes", report.RemovedBytes, "retained_bytes", report.RetainedBytes)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+	}
+}
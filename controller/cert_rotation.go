@@ -0,0 +1,145 @@
+package controller
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/houzhh15/sdp-common/logging"
+	"github.com/houzhh15/sdp-common/protocol"
+	"github.com/houzhh15/sdp-common/transport"
+)
+
+// defaultCertRotationOverlap 默认新旧证书重叠有效 24 小时
+const defaultCertRotationOverlap = 24 * time.Hour
+
+var (
+	errMissingCertPEM         = errors.New("cert_pem must contain a PEM encoded certificate")
+	errRotationClientMismatch = errors.New("certificate common name does not match the session client")
+	errRotationCertNotValid   = errors.New("certificate is not currently valid")
+)
+
+// certRotateRequest 证书轮换请求（新证书 PEM，仅叶子证书）
+type certRotateRequest struct {
+	CertPEM string `json:"cert_pem"`
+}
+
+// handleCertRotate rotates the caller's client certificate.
+// The caller must present the current certificate over mTLS together with a session
+// bound to it; the new certificate is linked to the old one for the overlap window,
+// existing sessions are rebound and tunnels (keyed by session token) keep running.
+func (c *Controller) handleCertRotate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx := r.Context()
+	token := extractBearerToken(r)
+	if token == "" {
+		respondErrorWithStatus(w, "UNAUTHORIZED", "Missing authorization token", nil, http.StatusUnauthorized)
+		return
+	}
+	sess, err := c.sessionManager.ValidateSession(ctx, token)
+	if err != nil {
+		respondErrorWithStatus(w, "UNAUTHORIZED", "Invalid or expired session", nil, http.StatusUnauthorized)
+		return
+	}
+
+	// 必须使用会话绑定的旧证书发起轮换
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		respondErrorWithStatus(w, "INVALID_CERT", "No client certificate", nil, http.StatusUnauthorized)
+		return
+	}
+	oldFingerprint := calculateFingerprint(r.TLS.PeerCertificates[0])
+	if oldFingerprint != sess.CertFingerprint {
+		respondErrorWithStatus(w, "INVALID_CERT", "Client certificate does not match session",
+			map[string]interface{}{"error_code": protocol.ErrCodeInvalidCert}, http.StatusForbidden)
+		return
+	}
+
+	var req certRotateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondErrorWithStatus(w, "INVALID_REQUEST", "Invalid request body", nil, http.StatusBadRequest)
+		return
+	}
+	newCert, err := parseRotationCert(req.CertPEM)
+	if err != nil {
+		respondErrorWithStatus(w, "INVALID_CERT", "Invalid certificate: "+err.Error(),
+			map[string]interface{}{"error_code": protocol.ErrCodeInvalidCert}, http.StatusBadRequest)
+		return
+	}
+	if err := c.verifyRotationCert(newCert, sess.ClientID); err != nil {
+		respondErrorWithStatus(w, "INVALID_CERT", "Invalid certificate: "+err.Error(),
+			map[string]interface{}{"error_code": protocol.ErrCodeInvalidCert}, http.StatusBadRequest)
+		return
+	}
+
+	overlap := c.config.CertRotationOverlap
+	if overlap <= 0 {
+		overlap = defaultCertRotationOverlap
+	}
+	newFingerprint := calculateFingerprint(newCert)
+	info, err := c.certRegistry.Rotate(oldFingerprint, newFingerprint, newCert, overlap)
+	if err != nil {
+		c.logger.Warn("Certificate rotation failed", "client_id", sess.ClientID, "error", err)
+		respondErrorWithStatus(w, "ROTATION_FAILED", "Certificate rotation failed", nil, http.StatusConflict)
+		return
+	}
+	rebound := c.sessionManager.RebindCertFingerprint(ctx, sess.ClientID, oldFingerprint, newFingerprint)
+
+	c.logger.Info("Client certificate rotated",
+		"client_id", sess.ClientID,
+		"old_fingerprint", oldFingerprint,
+		"new_fingerprint", newFingerprint,
+		"sessions", rebound)
+	c.auditAccess(ctx, &logging.AccessEvent{
+		ClientID: sess.ClientID,
+		SourceIP: transport.ClientIPFromRequest(r),
+		Action:   "cert_rotate",
+		Result:   "success",
+	})
+
+	overlapUntil := time.Now().Add(overlap)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":               "success",
+		"fingerprint":          info.Fingerprint,
+		"previous_fingerprint": oldFingerprint,
+		"overlap_until":        overlapUntil.Format(time.RFC3339),
+		"sessions_rebound":     rebound,
+	})
+}
+
+// parseRotationCert 解析 PEM 编码的新证书（取第一个 CERTIFICATE 块）
+func parseRotationCert(certPEM string) (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(certPEM))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errMissingCertPEM
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// verifyRotationCert 检查新证书归属同一客户端、当前有效，且（配置 CA 时）由受信 CA 签发
+func (c *Controller) verifyRotationCert(newCert *x509.Certificate, clientID string) error {
+	if c.extractClientID(newCert) != clientID {
+		return errRotationClientMismatch
+	}
+	now := time.Now()
+	if now.Before(newCert.NotBefore) || now.After(newCert.NotAfter) {
+		return errRotationCertNotValid
+	}
+	if c.certManager == nil || c.certManager.GetCAPool() == nil {
+		return nil
+	}
+	_, err := newCert.Verify(x509.VerifyOptions{
+		Roots:       c.certManager.GetCAPool(),
+		CurrentTime: now,
+		KeyUsages:   []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	return err
+}
@@ -0,0 +1,105 @@
+package controller
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/houzhh15/sdp-common/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newRotationTestCert 生成自签名客户端证书及其 PEM
+func newRotationTestCert(t *testing.T, clientID string, serial int64) (*x509.Certificate, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: clientID},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func postCertRotate(c *Controller, token string, peer *x509.Certificate, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/certs/rotate", strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if peer != nil {
+		req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{peer}}
+	}
+	w := httptest.NewRecorder()
+	c.handleCertRotate(w, req)
+	return w
+}
+
+func TestHandleCertRotate(t *testing.T) {
+	c := newAdminTestController(t, &Config{CertRotationOverlap: time.Hour})
+	ctx := context.Background()
+
+	oldCert, _ := newRotationTestCert(t, "ih-1", 1)
+	newCert, newPEM := newRotationTestCert(t, "ih-1", 2)
+	_, otherPEM := newRotationTestCert(t, "ih-2", 3)
+	oldFingerprint := calculateFingerprint(oldCert)
+	newFingerprint := calculateFingerprint(newCert)
+
+	require.NoError(t, c.certRegistry.Register("ih-1", oldFingerprint, oldCert))
+	sess, err := c.sessionManager.CreateSession(ctx, &session.CreateSessionRequest{
+		ClientID:        "ih-1",
+		CertFingerprint: oldFingerprint,
+	})
+	require.NoError(t, err)
+
+	body := func(certPEM string) string {
+		data, _ := json.Marshal(certRotateRequest{CertPEM: certPEM})
+		return string(data)
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, postCertRotate(c, "", oldCert, body(newPEM)).Code)
+	assert.Equal(t, http.StatusUnauthorized, postCertRotate(c, sess.Token, nil, body(newPEM)).Code)
+	// 必须使用会话绑定的证书
+	assert.Equal(t, http.StatusForbidden, postCertRotate(c, sess.Token, newCert, body(newPEM)).Code)
+	assert.Equal(t, http.StatusBadRequest, postCertRotate(c, sess.Token, oldCert, body("not-a-pem")).Code)
+	// 新证书 CN 必须与会话客户端一致
+	assert.Equal(t, http.StatusBadRequest, postCertRotate(c, sess.Token, oldCert, body(otherPEM)).Code)
+
+	w := postCertRotate(c, sess.Token, oldCert, body(newPEM))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var resp map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, newFingerprint, resp["fingerprint"])
+	assert.Equal(t, oldFingerprint, resp["previous_fingerprint"])
+	assert.EqualValues(t, 1, resp["sessions_rebound"])
+
+	// 会话保持有效并改绑新证书；重叠期内旧证书仍可握手
+	rebound, err := c.sessionManager.ValidateSession(ctx, sess.Token)
+	require.NoError(t, err)
+	assert.Equal(t, newFingerprint, rebound.CertFingerprint)
+	assert.NoError(t, c.certRegistry.Validate(oldFingerprint))
+	assert.NoError(t, c.certRegistry.Validate(newFingerprint))
+
+	// 旧证书不能再次发起轮换
+	assert.Equal(t, http.StatusForbidden, postCertRotate(c, sess.Token, oldCert, body(newPEM)).Code)
+}
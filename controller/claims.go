@@ -0,0 +1,34 @@
+package controller
+
+import (
+	"crypto/x509"
+
+	"github.com/houzhh15/sdp-common/cert"
+)
+
+// identityClaims 按 Config.IdentityClaims 从客户端证书提取 ClientID、类别与租户
+func (c *Controller) identityClaims(clientCert *x509.Certificate) (*cert.Claims, error) {
+	var mapping *cert.ClaimsMapping
+	if c.config != nil {
+		mapping = c.config.IdentityClaims
+	}
+	return mapping.Extract(clientCert)
+}
+
+// extractClientID extracts the client ID mapped from the certificate (empty when the certificate lacks it)
+func (c *Controller) extractClientID(clientCert *x509.Certificate) string {
+	claims, err := c.identityClaims(clientCert)
+	if err != nil {
+		return ""
+	}
+	return claims.ClientID
+}
+
+// extractClientClass extracts the client class mapped from the certificate (first OU by default)
+func (c *Controller) extractClientClass(clientCert *x509.Certificate) string {
+	claims, err := c.identityClaims(clientCert)
+	if err != nil {
+		return ""
+	}
+	return claims.ClientClass
+}
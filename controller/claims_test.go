@@ -0,0 +1,57 @@
+package controller
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/houzhh15/sdp-common/cert"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdentityClaimsMapping(t *testing.T) {
+	c := newAdminTestController(t, &Config{
+		IdentityClaims: &cert.ClaimsMapping{
+			ClientID:    cert.ClaimSourceSANEmail,
+			ClientClass: cert.ClaimSourceOU,
+			Tenant:      "{o}",
+		},
+	})
+	newCert := func(raw string, emails ...string) *x509.Certificate {
+		return &x509.Certificate{
+			Raw:            []byte(raw),
+			Subject:        pkix.Name{CommonName: "Alice", Organization: []string{"acme"}, OrganizationalUnit: []string{"ops", "admin"}},
+			EmailAddresses: emails,
+			NotBefore:      time.Now().Add(-time.Hour),
+			NotAfter:       time.Now().Add(time.Hour),
+		}
+	}
+
+	w := handshakeWithCert(c, newCert("alice-cert", "alice@acme.example"), "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp struct {
+		SessionToken string `json:"session_token"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	sess, err := c.sessionManager.ValidateSession(t.Context(), resp.SessionToken)
+	require.NoError(t, err)
+	assert.Equal(t, "alice@acme.example", sess.ClientID)
+	assert.Equal(t, "ops.admin", sess.ClientClass)
+	assert.Equal(t, "acme", sess.Tenant)
+
+	// 证书缺少映射的 ClientID 字段时拒绝握手
+	w = handshakeWithCert(c, newCert("no-email-cert"), "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "INVALID_CERT")
+
+	// 启动时校验映射
+	cfg := &Config{CertFile: "c", KeyFile: "k", CAFile: "ca", HTTPAddr: ":0", TCPProxyAddr: ":0",
+		IdentityClaims: &cert.ClaimsMapping{ClientID: "{cn"}}
+	assert.Error(t, cfg.Validate())
+	cfg.IdentityClaims.ClientID = "{cn}"
+	assert.NoError(t, cfg.Validate())
+}
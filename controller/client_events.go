@@ -0,0 +1,161 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/houzhh15/sdp-common/logging"
+	"github.com/houzhh15/sdp-common/policy"
+	"github.com/houzhh15/sdp-common/session"
+	"github.com/houzhh15/sdp-common/transport"
+	"github.com/houzhh15/sdp-common/tunnel"
+)
+
+// handleClientEventsSSE handles the IH-scoped event stream
+// 身份由会话令牌确定（不接受 agent_id 参数），只推送该客户端自己的隧道事件、
+// 策略变更和会话事件；会话被撤销时推送 session_revoked 后关闭流
+func (c *Controller) handleClientEventsSSE(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := extractBearerToken(r)
+	if token == "" {
+		respondErrorWithStatus(w, "UNAUTHORIZED", "Missing authorization token", nil, http.StatusUnauthorized)
+		return
+	}
+
+	sess, err := c.sessionManager.ValidateSession(r.Context(), token)
+	if err != nil {
+		respondErrorWithStatus(w, "UNAUTHORIZED", "Invalid or expired session", nil, http.StatusUnauthorized)
+		return
+	}
+
+	c.logger.Info("Client event stream request",
+		"client_id", sess.ClientID,
+		"client", transport.ClientIPFromRequest(r))
+
+	// 记录订阅流对应的会话，撤销该会话时关闭流
+	c.clientStreams.Store(sess.ClientID, token)
+	defer c.clientStreams.CompareAndDelete(sess.ClientID, token)
+
+	// 未携带能力请求头的订阅沿用握手时通告的能力
+	opts := sseSubscribeOptions(r)
+	if !opts.Capabilities.Advertised() {
+		opts.Capabilities = sessionCapabilities(sess)
+	}
+	if err := c.tunnelNotifier.SubscribeClientWith(sess.ClientID, opts, w); err != nil {
+		c.logger.Error("Failed to subscribe client stream", "client_id", sess.ClientID, "error", err)
+		http.Error(w, "Subscription failed", http.StatusInternalServerError)
+	}
+}
+
+// notifyPolicyChange pushes policy_updated / policy_deleted to the policy's client
+func (c *Controller) notifyPolicyChange(change string, p *policy.Policy) {
+	eventType := tunnel.EventPolicyUpdated
+	if change == policy.ChangeDeleted {
+		eventType = tunnel.EventPolicyDeleted
+	}
+	c.notifyClient(p.ClientID, &tunnel.ClientEvent{
+		Type:      eventType,
+		ClientID:  p.ClientID,
+		PolicyID:  p.PolicyID,
+		ServiceID: p.ServiceID,
+	})
+}
+
+// notifySessionRefreshed pushes session_refreshed with the new expiry
+func (c *Controller) notifySessionRefreshed(clientID string, expiresAt time.Time) {
+	c.notifyClient(clientID, &tunnel.ClientEvent{
+		Type:     tunnel.EventSessionRefreshed,
+		ClientID: clientID,
+		Details: map[string]interface{}{
+			"expires_at": expiresAt.Format(time.RFC3339),
+		},
+	})
+}
+
+// notifySessionRevoked pushes session_revoked and closes the stream if it was opened with the revoked token;
+// a non-empty reason (e.g. session_limit) is sent in details
+func (c *Controller) notifySessionRevoked(clientID, token, reason string) {
+	if streamToken, ok := c.clientStreams.Load(clientID); !ok || streamToken != token {
+		return
+	}
+	event := &tunnel.ClientEvent{
+		Type:     tunnel.EventSessionRevoked,
+		ClientID: clientID,
+	}
+	if reason != "" {
+		event.Details = map[string]interface{}{"reason": reason}
+	}
+	c.notifyClient(clientID, event)
+}
+
+// notifyClient delivers a client event; clients without an IH stream are skipped silently
+func (c *Controller) notifyClient(clientID string, event *tunnel.ClientEvent) {
+	if _, ok := c.clientStreams.Load(clientID); !ok {
+		return
+	}
+	if err := c.tunnelNotifier.NotifyClient(clientID, event); err != nil {
+		c.logger.Debug("Client event not delivered", "client_id", clientID, "type", event.Type, "error", err)
+	}
+}
+
+// onForcedRevocation reports a session revoked by the session concurrency policy to the client and the audit log
+func (c *Controller) onForcedRevocation(r *session.ForcedRevocation) {
+	c.notifySessionRevoked(r.Session.ClientID, r.Session.Token, r.Reason)
+	c.auditSecurity(context.Background(), &logging.SecurityEvent{
+		ClientID:  r.Session.ClientID,
+		EventType: logging.EventSessionRevoked,
+		Severity:  logging.SeverityLow,
+		Message:   "Session revoked by concurrency policy",
+		Details: map[string]interface{}{
+			"reason":    r.Reason,
+			"token":     maskToken(r.Session.Token),
+			"new_token": maskToken(r.NewToken),
+			"mode":      c.config.SessionConcurrency,
+		},
+	})
+}
+
+// notifyServiceStatusChanged pushes service_status_changed to IH clients with an active policy
+// for the service or an open tunnel to it
+func (c *Controller) notifyServiceStatusChanged(ctx context.Context, config *tunnel.ServiceConfig, previous tunnel.ServiceStatus, now time.Time) {
+	details := map[string]interface{}{
+		"status":          string(config.Status),
+		"previous_status": string(previous),
+	}
+	if window := config.ActiveMaintenance(now); config.Status == tunnel.ServiceStatusMaintenance && window != nil {
+		details["ends_at"] = window.End.UTC().Format(time.RFC3339)
+		if window.Message != "" {
+			details["message"] = window.Message
+		}
+	}
+
+	clients := make(map[string]bool)
+	policies, err := c.policyEngine.ListPolicies(ctx, &policy.PolicyFilter{ServiceID: config.ServiceID, Active: true})
+	if err != nil {
+		c.logger.Warn("Failed to list policies for service status event", "service_id", config.ServiceID, "error", err)
+	}
+	for _, p := range policies {
+		clients[p.ClientID] = true
+	}
+	tunnels, err := c.tunnelManager.ListTunnels(ctx, &tunnel.TunnelFilter{ServiceID: config.ServiceID})
+	if err != nil {
+		c.logger.Warn("Failed to list tunnels for service status event", "service_id", config.ServiceID, "error", err)
+	}
+	for _, t := range tunnels {
+		clients[t.ClientID] = true
+	}
+
+	for clientID := range clients {
+		c.notifyClient(clientID, &tunnel.ClientEvent{
+			Type:      tunnel.EventServiceStatusChanged,
+			ClientID:  clientID,
+			ServiceID: config.ServiceID,
+			Details:   details,
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package controller
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/houzhh15/sdp-common/policy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientEventsSSE_RequiresSession(t *testing.T) {
+	c := newAdminTestController(t, &Config{})
+
+	for _, token := range []string{"", "invalid-token"} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/client/events/stream", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		c.handleClientEventsSSE(w, req)
+		assert.Equal(t, http.StatusUnauthorized, w.Code, "token %q", token)
+	}
+}
+
+func TestClientEventsSSE_PolicyAndRevoke(t *testing.T) {
+	c := newAdminTestController(t, &Config{})
+	c.policyEngine.OnChange(c.notifyPolicyChange)
+	token := createTestSession(t, c, "alice", "user")
+
+	server := httptest.NewServer(http.HandlerFunc(c.handleClientEventsSSE))
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	events := make(chan string, 10)
+	go func() {
+		defer close(events)
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			if line := scanner.Text(); strings.HasPrefix(line, "event: ") {
+				events <- strings.TrimPrefix(line, "event: ")
+			}
+		}
+	}()
+	next := func() string {
+		select {
+		case e := <-events:
+			return e
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for event")
+			return ""
+		}
+	}
+	require.Equal(t, "connected", next())
+
+	// 其他客户端的策略变更不会推送
+	ctx := context.Background()
+	require.NoError(t, c.policyEngine.SavePolicy(ctx, &policy.Policy{
+		PolicyID: "p-bob", ClientID: "bob", ServiceID: "svc-1", ExpiryTime: time.Now().Add(time.Hour),
+	}))
+	require.NoError(t, c.policyEngine.SavePolicy(ctx, &policy.Policy{
+		PolicyID: "p-alice", ClientID: "alice", ServiceID: "svc-1", ExpiryTime: time.Now().Add(time.Hour),
+	}))
+	assert.Equal(t, "policy_updated", next())
+
+	// 撤销会话：推送 session_revoked 后关闭流
+	revoke := httptest.NewRequest(http.MethodDelete, "/api/v1/sessions/"+token, nil)
+	w := httptest.NewRecorder()
+	c.handleSessionRevoke(w, revoke)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "session_revoked", next())
+
+	select {
+	case _, ok := <-events:
+		assert.False(t, ok, "stream should be closed after session_revoked")
+	case <-time.After(2 * time.Second):
+		t.Fatal("stream was not closed")
+	}
+}
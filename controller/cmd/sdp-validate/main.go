@@ -0,0 +1,123 @@
+// Command sdp-validate 在部署前校验组件配置文件，适合在 CI 中运行
+//
+// 按 基础文件（含 include）→ profile 覆盖文件 → 环境变量 合并后执行 config.Loader 的全部检查，
+// component.type 为 controller 时再执行 controller.Config.Validate。问题以 file:line:col 格式输出，
+// 存在错误时退出码为 1；-strict 时未知键（拼写错误或已废弃）同样视为错误。
+// -schema 输出配置文件的 JSON Schema，可用于编辑器补全（如 yaml-language-server 的 $schema 注释）。
+//
+// 示例：
+//
+//	sdp-validate -config /etc/sdp/controller.yaml -profile prod
+//	sdp-validate -schema > sdp-config.schema.json
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/houzhh15/sdp-common/config"
+	"github.com/houzhh15/sdp-common/controller"
+)
+
+var (
+	configFile = flag.String("config", "config.yaml", "Base configuration file (YAML or JSON)")
+	profile    = flag.String("profile", "", "Configuration profile overlay, e.g. prod, staging, dev (default $"+config.ProfileEnv+")")
+	envPrefix  = flag.String("env-prefix", config.DefaultEnvPrefix, "Prefix for environment overrides (empty disables them)")
+	strict     = flag.Bool("strict", false, "Treat unknown keys as errors")
+	schema     = flag.Bool("schema", false, "Print the configuration JSON Schema and exit")
+)
+
+// controllerFields controller.Config.Validate 错误对应的配置文件键，用于定位行号
+var controllerFields = []struct {
+	prefix string
+	field  string
+}{
+	{"cert_file is required", "tls.cert_file"},
+	{"key_file is required", "tls.key_file"},
+	{"ca_file is required", "tls.ca_file"},
+	{"http_addr is required", "transport.http_addr"},
+	{"tcp_proxy_addr is required", "transport.tcp_proxy_addr"},
+	{"cors:", "transport.cors"},
+}
+
+func main() {
+	flag.Parse()
+
+	if *schema {
+		data, err := config.JSONSchema()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to generate schema: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(data))
+		return
+	}
+
+	loader := config.NewProfileLoader(*profile)
+	loader.EnvPrefix = *envPrefix
+
+	diag, err := loader.Diagnose(*configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", *configFile, err)
+		os.Exit(1)
+	}
+
+	errs := diag.Errors
+	if len(errs) == 0 && diag.Config.Component.Type == "controller" {
+		if fe := validateController(loader, diag.Config); fe != nil {
+			errs = append(errs, fe)
+		}
+	}
+
+	for _, fe := range diag.UnknownKeys {
+		severity := "warning"
+		if *strict {
+			severity = "error"
+		}
+		report(severity, fe)
+	}
+	for _, fe := range errs {
+		report("error", fe)
+	}
+
+	if len(errs) > 0 || (*strict && len(diag.UnknownKeys) > 0) {
+		os.Exit(1)
+	}
+	fmt.Printf("%s: OK (component %s/%s)\n", *configFile, diag.Config.Component.Type, diag.Config.Component.ID)
+}
+
+// validateController 执行 Controller 自身的配置校验
+func validateController(loader *config.Loader, fc *config.Config) *config.FieldError {
+	cfg, err := controller.ConfigFromFile(fc)
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err == nil {
+		return nil
+	}
+
+	fe := &config.FieldError{Message: "controller: " + err.Error()}
+	for _, f := range controllerFields {
+		if strings.HasPrefix(err.Error(), f.prefix) {
+			fe.Field = f.field
+			fe.Position = loader.LocateNearest(*configFile, f.field)
+			break
+		}
+	}
+	return fe
+}
+
+// report 输出单个问题：<位置>: <级别>: <键>: <描述>
+func report(severity string, fe *config.FieldError) {
+	location := *configFile
+	if fe.Position != nil {
+		location = fe.Position.String()
+	}
+	if fe.Field != "" {
+		fmt.Fprintf(os.Stderr, "%s: %s: %s: %s\n", location, severity, fe.Field, fe.Message)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%s: %s: %s\n", location, severity, fe.Message)
+}
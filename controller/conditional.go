@@ -0,0 +1,47 @@
+package controller
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// checkNotModified 设置 ETag / Last-Modified 响应头，请求的条件表明客户端缓存仍有效时
+// 返回 304 并返回 true（调用方不再写响应体）
+// If-None-Match 优先；仅在没有 If-None-Match 时才使用 If-Modified-Since（RFC 9110 13.2.2）
+func checkNotModified(w http.ResponseWriter, r *http.Request, etag string, modified time.Time) bool {
+	h := w.Header()
+	h.Set("ETag", etag)
+	h.Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	// 允许缓存但每次使用前必须向 Controller 确认
+	h.Set("Cache-Control", "no-cache")
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if !etagMatches(inm, etag) {
+			return false
+		}
+	} else if ims := r.Header.Get("If-Modified-Since"); ims != "" {
+		since, err := http.ParseTime(ims)
+		// Last-Modified 精确到秒
+		if err != nil || modified.Truncate(time.Second).After(since) {
+			return false
+		}
+	} else {
+		return false
+	}
+
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// etagMatches 判断 If-None-Match 是否包含 etag（弱比较，支持逗号分隔列表与 *）
+func etagMatches(header, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/houzhh15/sdp-common/tunnel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func conditionalGet(handler http.HandlerFunc, path, token string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	handler(w, req)
+	return w
+}
+
+func TestServicesList_Conditional(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newIdempotencyTestController(t)
+
+	w := conditionalGet(c.handleServicesList, "/api/v1/services", "", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	etag := w.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+	lastModified := w.Header().Get("Last-Modified")
+	require.NotEmpty(t, lastModified)
+
+	// 未变化：304 且无响应体
+	w = conditionalGet(c.handleServicesList, "/api/v1/services", "", map[string]string{"If-None-Match": `"other", W/` + etag})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+	assert.Equal(t, etag, w.Header().Get("ETag"))
+	w = conditionalGet(c.handleServicesGet, "/api/v1/services/svc-1", "", map[string]string{"If-None-Match": etag})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	w = conditionalGet(c.handleServicesList, "/api/v1/services", "", map[string]string{"If-Modified-Since": lastModified})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+
+	// 服务变更后返回新版本
+	svc, err := c.tunnelManager.GetServiceConfig(ctx, "svc-1")
+	require.NoError(t, err)
+	updated := *svc
+	updated.TargetPort = 9090
+	require.NoError(t, c.tunnelManager.UpdateServiceConfig(ctx, &updated))
+	w = conditionalGet(c.handleServicesList, "/api/v1/services", "", map[string]string{"If-None-Match": etag})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotEqual(t, etag, w.Header().Get("ETag"))
+	assert.Contains(t, w.Body.String(), "9090")
+
+	// 删除与恢复同样改变版本
+	etag = w.Header().Get("ETag")
+	require.NoError(t, c.tunnelManager.DeleteServiceConfig(ctx, "svc-1"))
+	w = conditionalGet(c.handleServicesList, "/api/v1/services", "", map[string]string{"If-None-Match": etag})
+	assert.Equal(t, http.StatusOK, w.Code)
+	etag = w.Header().Get("ETag")
+	_, err = c.tunnelManager.RestoreServiceConfig(ctx, "svc-1")
+	require.NoError(t, err)
+	w = conditionalGet(c.handleServicesList, "/api/v1/services", "", map[string]string{"If-None-Match": etag})
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestTunnelsList_Conditional(t *testing.T) {
+	c, token := newIdempotencyTestController(t)
+
+	// 条件请求不能绕过会话校验
+	w := conditionalGet(c.handleTunnels, "/api/v1/tunnels", "", map[string]string{"If-None-Match": "*"})
+	assert.NotEqual(t, http.StatusNotModified, w.Code)
+
+	w = conditionalGet(c.handleTunnels, "/api/v1/tunnels", token, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	etag := w.Header().Get("ETag")
+	w = conditionalGet(c.handleTunnels, "/api/v1/tunnels", token, map[string]string{"If-None-Match": etag})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+
+	require.Equal(t, http.StatusCreated, postTunnel(c, token, "svc-1", "").Code)
+	w = conditionalGet(c.handleTunnels, "/api/v1/tunnels", token, map[string]string{"If-None-Match": etag})
+	require.Equal(t, http.StatusOK, w.Code)
+	etag = w.Header().Get("ETag")
+	assert.Contains(t, w.Body.String(), "svc-1")
+
+	// 活跃时间写回也是隧道变更
+	tunnels, err := c.tunnelManager.ListTunnels(context.Background(), &tunnel.TunnelFilter{ClientID: "alice"})
+	require.NoError(t, err)
+	require.Len(t, tunnels, 1)
+	c.tunnelManager.TouchTunnels(map[string]time.Time{tunnels[0].ID: time.Now().Add(time.Minute)})
+	w = conditionalGet(c.handleTunnels, "/api/v1/tunnels", token, map[string]string{"If-None-Match": etag})
+	assert.Equal(t, http.StatusOK, w.Code)
+}
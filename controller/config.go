@@ -3,8 +3,19 @@ package controller
 import (
 	"crypto/tls"
 	"fmt"
+	"net"
 	"os"
+	"strings"
 	"time"
+
+	"github.com/houzhh15/sdp-common/cert"
+	"github.com/houzhh15/sdp-common/clock"
+	"github.com/houzhh15/sdp-common/config"
+	"github.com/houzhh15/sdp-common/logging"
+	"github.com/houzhh15/sdp-common/policy"
+	"github.com/houzhh15/sdp-common/session"
+	"github.com/houzhh15/sdp-common/transport"
+	"github.com/houzhh15/sdp-common/tunnel"
 )
 
 // Config Controller configuration
@@ -13,19 +24,198 @@ type Config struct {
 	CertFile string
 	KeyFile  string
 	CAFile   string
+	// CAFiles / CADirs 额外的 CA 文件（可为多证书 bundle）与 CA 目录，与 CAFile 合并为控制平面信任集；
+	// 运行时可通过 /api/{version}/admin/trust 增删 CA
+	CAFiles []string
+	CADirs  []string
+	// Key 私钥 PEM 来源（env:/file:/kms: 引用），设置后替代 KeyFile
+	Key config.Secret
+	// TLSPolicy TLS 版本、密码套件与曲线策略（可由 config.TLSConfig.Policy 生成），nil 使用 cert.DefaultTLSPolicy
+	TLSPolicy *cert.TLSPolicy
 
 	// Server addresses
 	HTTPAddr     string // HTTPS server address (e.g., ":8443")
 	TCPProxyAddr string // TCP proxy address (e.g., ":9443")
 
+	// HTTPRoles HTTPAddr 上提供的接口集合（admin、client、agent），默认全部；
+	// 与 Listeners 配合将管理、IH、AH 接口拆分到不同端口，便于按端口配置防火墙
+	HTTPRoles []ListenerRole
+	// Listeners 附加 HTTPS 监听，各自提供指定的接口集合，可使用独立的客户端证书信任集与认证模式
+	Listeners []*ListenerConfig
+
+	// DataPlaneAdvertiseAddrs 向 IH/AH 通告的数据平面地址（host:port，按优先级排列，如 LB 地址），
+	// 随握手、隧道创建响应、隧道事件与 GET /api/{version}/dataplane 下发；为空时通告 TCPProxyAddr（仅端口时补 localhost）
+	DataPlaneAdvertiseAddrs []string
+
 	// Logging
 	LogLevel string // debug, info, warn, error
 
 	// Database
-	DBPath string // SQLite database path (default: "controller.db")
+	DBPath   string          // SQLite database path (default: "controller.db")
+	Database *DatabaseConfig // SQLite tuning (WAL, busy timeout, write batching); nil uses defaults
 
 	// Data plane configuration (ZTNA-03)
 	DataPlane *DataPlaneConfig
+
+	// Internal 内部组件 RPC（Controller 副本之间、Controller 与中继节点），nil 不启用
+	Internal *InternalConfig
+
+	// Gateway 网关模式：在公开 TLS 监听上直接接入终端用户（无需安装 IH），nil 不启用
+	Gateway *GatewayConfig
+
+	// HTTP request limits (body size, header/idle timeouts); nil uses transport defaults
+	HTTP *transport.HTTPServerConfig
+
+	// CORS for browser clients (e.g. web admin console); nil disables CORS
+	CORS *transport.CORSConfig
+
+	// TrustedProxies 可信代理（LB、反向代理）的 CIDR 或 IP
+	// 仅来自这些地址的请求才采信 X-Forwarded-For / X-Real-IP；审计、策略 source_ip 条件均使用解析后的客户端 IP。
+	// LB 使用 PROXY protocol 时另需开启 HTTP.AcceptProxyProtocol
+	TrustedProxies []string
+
+	// SessionClasses 按客户端类别覆盖会话有效期（类别取自客户端证书 OU，如 "admin"、"service"）
+	SessionClasses map[string]*session.ClassPolicy
+
+	// SessionMaxLifetime 会话绝对生命周期上限，SessionMaxRefreshCount 会话最多刷新次数（0 表示不限）
+	// 超过后刷新返回 SESSION_LIFETIME_EXCEEDED，客户端需重新握手
+	SessionMaxLifetime     time.Duration
+	SessionMaxRefreshCount int
+
+	// SessionConcurrency 同一客户端重复握手时的并发会话策略（allow-multiple 默认、revoke-oldest、reject-new），
+	// SessionMaxPerClient 为每个客户端的活跃会话上限（默认 1）。revoke-oldest 撤销的会话记录安全事件并推送 session_revoked，
+	// reject-new 时握手返回 409 SESSION_LIMIT_REACHED
+	SessionConcurrency  session.ConcurrencyMode
+	SessionMaxPerClient int
+
+	// ClockSkewTolerance 容忍的客户端时钟偏差：会话过期后该时长内仍可校验与刷新，time_range 策略条件边界两侧各放宽该时长。
+	// 握手与刷新响应携带 server_time，客户端据此检测并补偿偏差；默认 0
+	ClockSkewTolerance time.Duration
+
+	// APIVersions API 版本生命周期配置（key: "v1"、"v2"），用于下发 Deprecation/Sunset 头
+	APIVersions map[string]*APIVersionPolicy
+	// DefaultAPIVersion 无版本路径（/api/...）且未携带 Accept-Version 时使用的版本，默认 "v1"
+	DefaultAPIVersion string
+
+	// TunnelIdempotencyTTL 隧道创建幂等键（Idempotency-Key）保留时间，默认 10 分钟
+	TunnelIdempotencyTTL time.Duration
+
+	// ExpiryWarningLead 会话/隧道到期前多久通过 SSE 推送 session_expiring / tunnel_expiring，默认 5 分钟
+	ExpiryWarningLead time.Duration
+
+	// CertExpiryWarning 已注册证书到期前多久发出告警（日志、cert_expiring 指标、cert_expiring 安全事件），默认 30 天
+	CertExpiryWarning time.Duration
+
+	// IdentityClaims 客户端证书字段到 ClientID、类别（角色）与租户的映射（CN、SAN email/URI、OU 连接或模板），
+	// 启动时校验；nil 使用 CN 作为 ClientID、第一个 OU 作为类别
+	IdentityClaims *cert.ClaimsMapping
+
+	// IdentityConflictPolicy 同一 CN 出现多张指纹不同的活跃证书时的处理策略：
+	// flag（默认，放行并记录 identity_conflict 安全事件、标记会话）或 reject（拒绝新出现的冲突证书）
+	IdentityConflictPolicy cert.ConflictPolicy
+
+	// DevicePostureDriftPolicy 请求携带的设备指纹（X-SDP-Device-Posture）与会话握手时记录的不一致时的处理策略：
+	// flag（默认，放行并记录 device_posture_drift 安全事件）或 revoke（同时撤销会话，客户端需重新握手）
+	DevicePostureDriftPolicy session.DriftPolicy
+
+	// CertRotationOverlap 客户端证书轮换后旧证书继续有效的时间，默认 24 小时
+	CertRotationOverlap time.Duration
+
+	// UsageAlertWebhooks 隧道用量超过服务 usage_alert 阈值时以 POST JSON 通知的地址（同时记录 usage_threshold_exceeded 安全事件）
+	UsageAlertWebhooks []string
+	// UsageAlertCooldown 同一隧道同类用量告警的最短间隔，默认 15 分钟；UsageAlertInterval 中继统计采样间隔，默认 10 秒
+	UsageAlertCooldown time.Duration
+	UsageAlertInterval time.Duration
+
+	// OpsEventCapacity 运维事件时间线（组件启动、证书重载、配置变更、中继绑定失败、AH 连接等）在内存中保留的条数，默认 1000
+	// OpsEventWebhooks 每条运维事件以 POST JSON 转发的地址（可选）
+	OpsEventCapacity int
+	OpsEventWebhooks []string
+
+	// ServiceScheduleInterval 按服务维护窗口与计划停用时间切换服务状态的扫描间隔，默认 30 秒
+	ServiceScheduleInterval time.Duration
+
+	// SessionTransferTTL 会话转移码（旧设备申请、新设备兑换）的有效期，默认 2 分钟
+	SessionTransferTTL time.Duration
+
+	// ServicesFile / PoliciesFile 启动时加载的声明式服务 / 策略文件（YAML 或 JSON，字段名同 API），
+	// 校验通过后按 SeedMode 与现有对象协调，便于以 GitOps 方式管理；任一文件无效时启动失败
+	ServicesFile string
+	PoliciesFile string
+	// SeedMode 协调方式：create（只创建缺失对象）、update（默认，另更新不一致的对象）、prune（另删除文件中没有的对象）
+	SeedMode SeedMode
+
+	// EventJournalRetention 持久化事件日志（GET /api/{version}/events、Last-Event-ID 补发）的保留时间，默认 7 天
+	EventJournalRetention time.Duration
+
+	// RecycleBinRetention 已删除策略与服务在回收站中的保留时间，超过后永久删除，默认 30 天
+	RecycleBinRetention time.Duration
+
+	// RelayStartTimeout 启动时等待数据平面中继监听成功的最长时间，之后才开始提供 HTTP 服务，默认 10 秒；
+	// 中继未就绪（启动失败、排空中）期间隧道创建返回 503 RELAY_UNAVAILABLE，/readyz 返回 503
+	RelayStartTimeout time.Duration
+
+	// ReconcileGracePeriod 启动后等待 AH 重连上报活跃隧道的时间，之后断开中继上仍无记录的隧道，默认 2 分钟
+	ReconcileGracePeriod time.Duration
+
+	// TunnelPairingTimeout 隧道创建后等待中继确认 IH 与 AH 配对的时间，超时未配对的隧道转为 failed 状态，
+	// 向 IH 推送 tunnel_failed 并从默认隧道列表中排除，保留 1 小时后删除；默认 2 分钟，负数关闭
+	TunnelPairingTimeout time.Duration
+
+	// DefaultPolicyDecision 客户端对服务没有任何策略时的决策：deny（默认）或 allow；
+	// ServicePolicyDefaults 按服务覆盖（key: ServiceID）。审计中区分 "denied by default" 与 "denied by policy"
+	DefaultPolicyDecision policy.DefaultDecision
+	ServicePolicyDefaults map[string]policy.DefaultDecision
+
+	// PolicyEvaluationBudget 单次策略评估耗时预算，超过时记录告警并计入 policy_slow_evaluations_total，
+	// 默认 100ms，负数关闭告警；慢策略排行见 GET /api/{version}/admin/policies/stats
+	PolicyEvaluationBudget time.Duration
+
+	// CredentialBrokers 按名称注册的临时凭据签发插件，服务通过 credential_broker 引用；
+	// 创建隧道时签发凭据并随响应交给 IH，隧道删除或到期时吊销
+	CredentialBrokers map[string]tunnel.CredentialBroker
+
+	// Clock 会话、策略、SSE 心跳、中继配对超时与到期扫描共用的时钟，默认真实时钟（测试可注入 clock.NewFake）
+	Clock clock.Clock
+
+	// AuditLogPath 审计日志文件路径，为空时不记录审计事件（管理控制台审计列表为空）
+	AuditLogPath string
+
+	// AuditRetention 审计日志保留策略（最长保留时间、最大字节数），每小时清理一次，被清理的记录按天汇总后保留；
+	// 零值不清理，手动清理见 POST /api/{version}/admin/audit/purge
+	AuditRetention logging.AuditRetention
+
+	// AuditRedactFields 写请求审计（api_request 事件）中额外脱敏的请求体字段，与默认规则
+	// （password、secret、token、private_key 等）合并；字段名等于规则或以 "_"+规则 结尾即脱敏
+	AuditRedactFields []string
+
+	// Tracing 启用请求追踪：采信请求的 W3C traceparent 头（缺失或无效时生成新的 trace ID），在 traceresponse 响应头中返回；
+	// 握手、隧道创建与中继配对耗时直方图以 trace_id 作为 exemplar，/metrics 按 Accept 协商输出 OpenMetrics 格式
+	Tracing bool
+
+	// Capabilities Controller 支持并在握手响应与 SSE connected 事件中通告的可选能力（tunnel.Capability*），
+	// 默认 tunnel.DefaultCapabilities()；去掉 mux 时多路复用请求降级为普通隧道，去掉 e2e 时拒绝 E2E 隧道
+	Capabilities tunnel.Capabilities
+
+	// AgentEventRateLimit 每个 AH 事件流的隧道与服务事件速率限制（突发容量与溢出策略见 tunnel.EventRateLimit），nil 表示不限制
+	AgentEventRateLimit *tunnel.EventRateLimit
+
+	// ServiceEventBatchWindow 服务事件合并窗口（tunnel.NotifierConfig.ServiceBatchWindow）：窗口内的服务变更合并为一个
+	// service_bulk_updated 推送，AH 批量注册结束时立即推送；0 表示逐条推送
+	ServiceEventBatchWindow time.Duration
+
+	// EmbedServiceInTunnelEvents 在隧道创建事件中内嵌服务配置快照（目标、协议、元数据），
+	// AH 无需等待服务配置同步即可建立隧道；默认关闭以控制事件大小
+	EmbedServiceInTunnelEvents bool
+
+	// AgentStreamPath AH 隧道事件流（SSE）的附加路径，须以 "/" 开头；
+	// 默认路径 /api/{version}/events/subscribe 与 /{version}/agent/tunnels/stream 始终注册
+	AgentStreamPath string
+
+	// EnableDashboard 启用内置管理控制台（/admin/），数据来自 /api/{version}/admin/* 接口
+	EnableDashboard bool
+	// AdminClasses 允许访问管理接口的客户端类别（证书 OU），默认 ["admin"]
+	AdminClasses []string
 }
 
 // DataPlaneConfig 数据平面中继服务器配置
@@ -38,6 +228,13 @@ type DataPlaneConfig struct {
 
 	// RelayConfig 中继配置
 	RelayConfig RelayConfig `yaml:"relay_config"`
+
+	// ReusePort 以 SO_REUSEPORT 绑定数据平面端口，允许新旧进程同时监听（Linux / BSD / macOS）
+	// 未启用时二进制升级通过监听 fd 传递完成（见 Controller.Upgrade）
+	ReusePort bool `yaml:"reuse_port"`
+
+	// DrainTimeout 升级时旧进程等待正在中继的隧道结束的最长时间 (默认 5m)，到期后强制断开
+	DrainTimeout time.Duration `yaml:"drain_timeout"`
 }
 
 // TLSConfig TLS 配置
@@ -48,13 +245,233 @@ type TLSConfig struct {
 	// KeyFile 服务器私钥文件路径
 	KeyFile string `yaml:"key_file"`
 
+	// Key 服务器私钥 PEM 来源（env:/file:/kms: 引用），设置后替代 KeyFile
+	Key config.Secret `yaml:"key"`
+
 	// CAFile CA 证书文件路径
 	CAFile string `yaml:"ca_file"`
 
+	// CAFiles / CADirs 额外的 CA 文件与 CA 目录，与 CAFile 合并为数据平面信任集（独立于控制平面）
+	CAFiles []string `yaml:"ca_files"`
+	CADirs  []string `yaml:"ca_dirs"`
+
 	// ClientAuth 客户端认证模式
 	// 可选值: NoClientCert, RequestClientCert, RequireAnyClientCert,
 	//        VerifyClientCertIfGiven, RequireAndVerifyClientCert
 	ClientAuth string `yaml:"client_auth"`
+
+	// MinVersion / MaxVersion 协议版本（TLS1.2、TLS1.3），CipherSuites / CurvePreferences 密码套件与曲线
+	// 均未设置时沿用 Controller 的 TLSPolicy
+	MinVersion       string   `yaml:"min_version"`
+	MaxVersion       string   `yaml:"max_version"`
+	CipherSuites     []string `yaml:"cipher_suites"`
+	CurvePreferences []string `yaml:"curve_preferences"`
+}
+
+// InternalConfig 内部 RPC 配置
+// 内部身份证书以 URI SAN spiffe://<trust-domain>/<role>/<id> 标识组件，建议由独立 CA 签发，与终端用户证书隔离
+type InternalConfig struct {
+	// ListenAddr 内部 RPC 监听地址 (默认 ":8444")
+	ListenAddr string `yaml:"listen_addr"`
+
+	// CertFile / KeyFile / Key 本副本内部身份证书与私钥（Key 设置后替代 KeyFile）
+	CertFile string        `yaml:"cert_file"`
+	KeyFile  string        `yaml:"key_file"`
+	Key      config.Secret `yaml:"key"`
+
+	// CAFile 签发内部身份证书的 CA
+	CAFile string `yaml:"ca_file"`
+
+	// TrustDomain 内部身份信任域 (默认 "sdp.internal")
+	TrustDomain string `yaml:"trust_domain"`
+
+	// AllowedRoles 允许调用内部 RPC 的对端角色 (默认 controller、relay)
+	AllowedRoles []string `yaml:"allowed_roles"`
+}
+
+// GatewayConfig 网关模式配置
+// 网关终止终端用户的 mTLS 连接，按 SNI 主机名选择服务，以客户端证书身份（CN）评估策略，
+// 为每条连接创建隧道并经数据平面中继转发到 AH；连接关闭后删除隧道
+type GatewayConfig struct {
+	// ListenAddr 公开监听地址 (如 ":443")
+	ListenAddr string `yaml:"listen_addr"`
+
+	// Routes SNI 主机名 → 服务 ID，支持单级通配 "*.example.com"（精确匹配优先）
+	Routes map[string]string `yaml:"routes"`
+
+	// ServiceDomain 未在 Routes 中的主机名按 "<service_id>.<ServiceDomain>" 解析服务（可选）
+	ServiceDomain string `yaml:"service_domain"`
+
+	// CertFile / KeyFile / Key 公开监听的服务器证书（需覆盖各服务主机名），未设置时使用 Controller 证书
+	CertFile string        `yaml:"cert_file"`
+	KeyFile  string        `yaml:"key_file"`
+	Key      config.Secret `yaml:"key"`
+
+	// CAFile / CAFiles / CADirs 终端用户证书的 CA，均未设置时使用控制平面信任集
+	CAFile  string   `yaml:"ca_file"`
+	CAFiles []string `yaml:"ca_files"`
+	CADirs  []string `yaml:"ca_dirs"`
+
+	// HandshakeTimeout TLS 握手超时 (默认 10秒)
+	HandshakeTimeout time.Duration `yaml:"handshake_timeout"`
+}
+
+// Validate 验证网关配置
+func (g *GatewayConfig) Validate() error {
+	if g.ListenAddr == "" {
+		return fmt.Errorf("listen_addr is required")
+	}
+	if len(g.Routes) == 0 && g.ServiceDomain == "" {
+		return fmt.Errorf("routes or service_domain is required")
+	}
+	for host, serviceID := range g.Routes {
+		if host == "" || serviceID == "" {
+			return fmt.Errorf("invalid route %q -> %q", host, serviceID)
+		}
+		if strings.Contains(strings.TrimPrefix(host, "*."), "*") {
+			return fmt.Errorf("invalid route host %q: only a leading \"*.\" wildcard is supported", host)
+		}
+	}
+	if g.CertFile != "" && g.KeyFile == "" && !g.Key.IsSet() {
+		return fmt.Errorf("key_file is required with cert_file")
+	}
+	if g.HandshakeTimeout < 0 {
+		return fmt.Errorf("handshake_timeout must not be negative")
+	}
+	if g.HandshakeTimeout == 0 {
+		g.HandshakeTimeout = 10 * time.Second
+	}
+	return nil
+}
+
+// hasCAs 是否配置了独立的终端用户 CA
+func (g *GatewayConfig) hasCAs() bool {
+	return g.CAFile != "" || len(g.CAFiles) > 0 || len(g.CADirs) > 0
+}
+
+// ListenerRole HTTPS 监听提供的接口集合
+type ListenerRole string
+
+const (
+	// ListenerRoleAdmin 管理接口（/api/{version}/admin/*）、事件日志轮询（/api/{version}/events）与管理控制台
+	ListenerRoleAdmin ListenerRole = "admin"
+	// ListenerRoleClient IH 接口：策略查询、隧道创建与列表、IH 事件流
+	ListenerRoleClient ListenerRole = "client"
+	// ListenerRoleAgent AH 接口：服务注册、隧道对账、AH 事件流
+	ListenerRoleAgent ListenerRole = "agent"
+)
+
+// validateListenerRoles 校验接口集合名称
+func validateListenerRoles(roles []ListenerRole) error {
+	for _, role := range roles {
+		if role != ListenerRoleAdmin && role != ListenerRoleClient && role != ListenerRoleAgent {
+			return fmt.Errorf("invalid role: %s (valid: %s, %s, %s)", role, ListenerRoleAdmin, ListenerRoleClient, ListenerRoleAgent)
+		}
+	}
+	return nil
+}
+
+// ListenerConfig 附加 HTTPS 监听配置
+// 健康检查、就绪探针、指标、认证（握手、刷新、会话转移）、证书轮换等共用接口在所有监听上提供，
+// 其余接口只在提供其接口集合的监听上注册，其他端口返回 404
+type ListenerConfig struct {
+	// Name 日志中的监听名称，默认为 Addr
+	Name string `yaml:"name"`
+
+	// Addr 监听地址 (如 ":8445")
+	Addr string `yaml:"addr"`
+
+	// Roles 提供的接口集合，至少一个
+	Roles []ListenerRole `yaml:"roles"`
+
+	// CAFile / CAFiles / CADirs 客户端证书信任集（如管理端口只信任管理员 CA），均未设置时使用控制平面信任集；
+	// 独立信任集不受 /api/{version}/admin/trust 运行时增删影响
+	CAFile  string   `yaml:"ca_file"`
+	CAFiles []string `yaml:"ca_files"`
+	CADirs  []string `yaml:"ca_dirs"`
+
+	// ClientAuth 客户端认证模式（取值同 TLSConfig.ClientAuth），默认 RequireAndVerifyClientCert；
+	// 提供 admin 或 agent 接口的监听不允许 NoClientCert、RequestClientCert、RequireAnyClientCert
+	ClientAuth string `yaml:"client_auth"`
+}
+
+// Validate 验证附加监听配置
+func (l *ListenerConfig) Validate() error {
+	if l.Addr == "" {
+		return fmt.Errorf("addr is required")
+	}
+	if len(l.Roles) == 0 {
+		return fmt.Errorf("at least one role is required")
+	}
+	if err := validateListenerRoles(l.Roles); err != nil {
+		return err
+	}
+	if l.ClientAuth != "" {
+		if _, ok := clientAuthModes[l.ClientAuth]; !ok {
+			return fmt.Errorf("invalid client_auth mode: %s", l.ClientAuth)
+		}
+	}
+	// 管理与 AH 接口依赖已验证的客户端证书识别调用方，不校验证书链的模式会让任意证书（或无证书）通过
+	if !verifiesClientCert(parseClientAuth(l.ClientAuth)) {
+		for _, role := range l.Roles {
+			if role == ListenerRoleAdmin || role == ListenerRoleAgent {
+				return fmt.Errorf("client_auth %s does not verify client certificates, not allowed for role %s", l.ClientAuth, role)
+			}
+		}
+	}
+	return nil
+}
+
+// verifiesClientCert 认证模式是否校验客户端证书链
+func verifiesClientCert(authType tls.ClientAuthType) bool {
+	return authType == tls.VerifyClientCertIfGiven || authType == tls.RequireAndVerifyClientCert
+}
+
+// hasCAs 是否配置了独立的客户端证书信任集
+func (l *ListenerConfig) hasCAs() bool {
+	return l.CAFile != "" || len(l.CAFiles) > 0 || len(l.CADirs) > 0
+}
+
+// name 日志中的监听名称
+func (l *ListenerConfig) name() string {
+	if l.Name != "" {
+		return l.Name
+	}
+	return l.Addr
+}
+
+// PeerPolicy 返回内部 RPC 对端校验策略
+func (i *InternalConfig) PeerPolicy() *cert.InternalPeerPolicy {
+	return &cert.InternalPeerPolicy{
+		TrustDomain:  i.TrustDomain,
+		AllowedRoles: i.AllowedRoles,
+	}
+}
+
+// Validate 验证内部 RPC 配置
+func (i *InternalConfig) Validate() error {
+	if i.ListenAddr == "" {
+		i.ListenAddr = ":8444"
+	}
+	if i.TrustDomain == "" {
+		i.TrustDomain = cert.DefaultTrustDomain
+	}
+
+	if i.CertFile == "" {
+		return fmt.Errorf("cert_file is required")
+	}
+	if !i.Key.IsSet() && i.KeyFile == "" {
+		return fmt.Errorf("key_file is required")
+	}
+	if i.CAFile == "" {
+		return fmt.Errorf("ca_file is required")
+	}
+	for _, role := range i.AllowedRoles {
+		if role != cert.RoleController && role != cert.RoleRelay {
+			return fmt.Errorf("invalid allowed role: %s (valid: %s, %s)", role, cert.RoleController, cert.RoleRelay)
+		}
+	}
+	return nil
 }
 
 // RelayConfig 中继配置
@@ -73,6 +490,41 @@ type RelayConfig struct {
 
 	// MaxConnections 最大并发连接数 (默认 10000)
 	MaxConnections int `yaml:"max_connections"`
+
+	// AcceptProxyProtocol 中继位于四层负载均衡之后时启用，要求 LB 发送 PROXY protocol v2 头
+	AcceptProxyProtocol bool `yaml:"accept_proxy_protocol"`
+
+	// MetricsServices 中继按服务统计的指标单独打标签的服务名单，名单外的服务计入 "other"；
+	// 为空时为前 MetricsServiceLimit 个出现的服务打标签 (默认 100)
+	MetricsServices     []string `yaml:"metrics_services"`
+	MetricsServiceLimit int      `yaml:"metrics_service_limit"`
+}
+
+// ConfigFromFile maps a component configuration file (config.Loader) onto the Controller
+// settings it covers: TLS files and policy, listen addresses, logging, audit log and HTTP limits.
+// Options without a file equivalent (DataPlane, Internal, Clock ...) are left at their zero values
+func ConfigFromFile(fc *config.Config) (*Config, error) {
+	tlsPolicy, err := fc.TLS.Policy()
+	if err != nil {
+		return nil, fmt.Errorf("invalid tls policy: %w", err)
+	}
+	return &Config{
+		CertFile:          fc.TLS.CertFile,
+		KeyFile:           fc.TLS.KeyFile,
+		CAFile:            fc.TLS.CAFile,
+		CAFiles:           fc.TLS.CAFiles,
+		CADirs:            fc.TLS.CADirs,
+		Key:               fc.TLS.Key,
+		TLSPolicy:         tlsPolicy,
+		HTTPAddr:          fc.Transport.HTTPAddr,
+		TCPProxyAddr:      fc.Transport.TCPProxyAddr,
+		LogLevel:          fc.Logging.Level,
+		AuditLogPath:      fc.Logging.AuditFile,
+		AuditRedactFields: fc.Logging.AuditRedactFields,
+		AuditRetention:    logging.AuditRetention{MaxAge: fc.Logging.AuditMaxAge, MaxSize: fc.Logging.AuditMaxSize},
+		HTTP:              fc.Transport.HTTPServerConfig(),
+		CORS:              fc.Transport.CORS,
+	}, nil
 }
 
 // Validate validates the configuration
@@ -80,10 +532,10 @@ func (c *Config) Validate() error {
 	if c.CertFile == "" {
 		return fmt.Errorf("cert_file is required")
 	}
-	if c.KeyFile == "" {
+	if c.KeyFile == "" && !c.Key.IsSet() {
 		return fmt.Errorf("key_file is required")
 	}
-	if c.CAFile == "" {
+	if c.CAFile == "" && len(c.CAFiles) == 0 && len(c.CADirs) == 0 {
 		return fmt.Errorf("ca_file is required")
 	}
 	if c.HTTPAddr == "" {
@@ -96,6 +548,128 @@ func (c *Config) Validate() error {
 		c.LogLevel = "info"
 	}
 
+	if c.ExpiryWarningLead < 0 {
+		return fmt.Errorf("expiry warning lead must not be negative")
+	}
+	if c.CertExpiryWarning < 0 {
+		return fmt.Errorf("cert expiry warning must not be negative")
+	}
+	if c.CertRotationOverlap < 0 {
+		return fmt.Errorf("cert rotation overlap must not be negative")
+	}
+	if c.UsageAlertCooldown < 0 || c.UsageAlertInterval < 0 {
+		return fmt.Errorf("usage alert cooldown and interval must not be negative")
+	}
+	if c.ServiceEventBatchWindow < 0 {
+		return fmt.Errorf("service event batch window must not be negative")
+	}
+	if c.ServiceScheduleInterval < 0 {
+		return fmt.Errorf("service schedule interval must not be negative")
+	}
+	if err := validateWebhooks("usage alert", c.UsageAlertWebhooks); err != nil {
+		return err
+	}
+	if c.OpsEventCapacity < 0 {
+		return fmt.Errorf("ops event capacity must not be negative")
+	}
+	if err := validateWebhooks("ops event", c.OpsEventWebhooks); err != nil {
+		return err
+	}
+	if err := c.SeedMode.Validate(); err != nil {
+		return err
+	}
+	if c.SessionTransferTTL < 0 {
+		return fmt.Errorf("session transfer ttl must not be negative")
+	}
+	if c.AgentStreamPath != "" && !strings.HasPrefix(c.AgentStreamPath, "/") {
+		return fmt.Errorf("agent stream path must start with /: %s", c.AgentStreamPath)
+	}
+	if err := c.IdentityClaims.Validate(); err != nil {
+		return err
+	}
+	if err := c.IdentityConflictPolicy.Validate(); err != nil {
+		return err
+	}
+	if err := c.DevicePostureDriftPolicy.Validate(); err != nil {
+		return err
+	}
+	if c.EventJournalRetention < 0 {
+		return fmt.Errorf("event journal retention must not be negative")
+	}
+	if c.RecycleBinRetention < 0 {
+		return fmt.Errorf("recycle bin retention must not be negative")
+	}
+	if err := c.AuditRetention.Validate(); err != nil {
+		return err
+	}
+	for _, addr := range c.DataPlaneAdvertiseAddrs {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return fmt.Errorf("invalid data plane advertise address %q: %w", addr, err)
+		}
+	}
+	if c.RelayStartTimeout < 0 {
+		return fmt.Errorf("relay start timeout must not be negative")
+	}
+	if c.ReconcileGracePeriod < 0 {
+		return fmt.Errorf("reconcile grace period must not be negative")
+	}
+	if c.TLSPolicy != nil {
+		if err := c.TLSPolicy.Validate(); err != nil {
+			return fmt.Errorf("invalid tls policy: %w", err)
+		}
+	}
+	if c.SessionMaxLifetime < 0 || c.SessionMaxRefreshCount < 0 || c.SessionMaxPerClient < 0 {
+		return fmt.Errorf("session limits must not be negative")
+	}
+	if err := c.SessionConcurrency.Validate(); err != nil {
+		return err
+	}
+	if c.ClockSkewTolerance < 0 {
+		return fmt.Errorf("clock skew tolerance must not be negative")
+	}
+	if err := c.Database.Validate(); err != nil {
+		return err
+	}
+	if c.CORS.Enabled() && c.CORS.AllowCredentials {
+		for _, origin := range c.CORS.AllowedOrigins {
+			if origin == "*" {
+				return fmt.Errorf("cors: wildcard origin cannot be used with allow_credentials")
+			}
+		}
+	}
+
+	if _, err := transport.NewClientIPResolver(c.TrustedProxies); err != nil {
+		return err
+	}
+
+	for version := range c.APIVersions {
+		if !isSupportedAPIVersion(version) {
+			return fmt.Errorf("unsupported API version: %s", version)
+		}
+	}
+	if c.DefaultAPIVersion != "" && !isSupportedAPIVersion(c.DefaultAPIVersion) {
+		return fmt.Errorf("unsupported default API version: %s", c.DefaultAPIVersion)
+	}
+
+	for class, p := range c.SessionClasses {
+		if p == nil || p.TTL < 0 || p.MaxLifetime < 0 {
+			return fmt.Errorf("invalid session class %q", class)
+		}
+	}
+	if err := c.DefaultPolicyDecision.Validate(); err != nil {
+		return err
+	}
+	for serviceID, decision := range c.ServicePolicyDefaults {
+		if err := decision.Validate(); err != nil {
+			return fmt.Errorf("service %s: %w", serviceID, err)
+		}
+	}
+	for name, broker := range c.CredentialBrokers {
+		if name == "" || broker == nil {
+			return fmt.Errorf("invalid credential broker %q", name)
+		}
+	}
+
 	// Validate data plane configuration
 	if c.DataPlane != nil {
 		if err := c.DataPlane.Validate(); err != nil {
@@ -103,6 +677,48 @@ func (c *Config) Validate() error {
 		}
 	}
 
+	if c.Internal != nil {
+		if err := c.Internal.Validate(); err != nil {
+			return fmt.Errorf("internal config error: %w", err)
+		}
+		if c.Internal.ListenAddr == c.HTTPAddr || c.Internal.ListenAddr == c.TCPProxyAddr {
+			return fmt.Errorf("internal config error: listen_addr %s conflicts with public listeners", c.Internal.ListenAddr)
+		}
+	}
+
+	if c.Gateway != nil {
+		if err := c.Gateway.Validate(); err != nil {
+			return fmt.Errorf("gateway config error: %w", err)
+		}
+		if c.Gateway.ListenAddr == c.HTTPAddr || c.Gateway.ListenAddr == c.TCPProxyAddr ||
+			(c.Internal != nil && c.Gateway.ListenAddr == c.Internal.ListenAddr) {
+			return fmt.Errorf("gateway config error: listen_addr %s conflicts with another listener", c.Gateway.ListenAddr)
+		}
+	}
+
+	if err := validateListenerRoles(c.HTTPRoles); err != nil {
+		return fmt.Errorf("http_roles: %w", err)
+	}
+	addrs := map[string]bool{c.HTTPAddr: true, c.TCPProxyAddr: true}
+	if c.Internal != nil {
+		addrs[c.Internal.ListenAddr] = true
+	}
+	if c.Gateway != nil {
+		addrs[c.Gateway.ListenAddr] = true
+	}
+	for i, l := range c.Listeners {
+		if l == nil {
+			return fmt.Errorf("listener %d: config is required", i)
+		}
+		if err := l.Validate(); err != nil {
+			return fmt.Errorf("listener %s: %w", l.name(), err)
+		}
+		if addrs[l.Addr] {
+			return fmt.Errorf("listener %s: addr %s conflicts with another listener", l.name(), l.Addr)
+		}
+		addrs[l.Addr] = true
+	}
+
 	return nil
 }
 
@@ -113,6 +729,13 @@ func (d *DataPlaneConfig) Validate() error {
 		d.ListenAddr = ":9443" // 默认端口
 	}
 
+	if d.DrainTimeout < 0 {
+		return fmt.Errorf("drain_timeout must not be negative")
+	}
+	if d.DrainTimeout == 0 {
+		d.DrainTimeout = defaultDrainTimeout
+	}
+
 	// 验证 TLS 配置
 	if err := d.TLS.Validate(); err != nil {
 		return fmt.Errorf("tls config error: %w", err)
@@ -136,20 +759,32 @@ func (t *TLSConfig) Validate() error {
 		return fmt.Errorf("cert_file not found: %s", t.CertFile)
 	}
 
-	// 验证密钥文件存在性
-	if t.KeyFile == "" {
-		return fmt.Errorf("key_file is required")
-	}
-	if _, err := os.Stat(t.KeyFile); os.IsNotExist(err) {
-		return fmt.Errorf("key_file not found: %s", t.KeyFile)
+	// 验证密钥文件存在性（通过 Key 引用私钥时跳过）
+	if !t.Key.IsSet() {
+		if t.KeyFile == "" {
+			return fmt.Errorf("key_file is required")
+		}
+		if _, err := os.Stat(t.KeyFile); os.IsNotExist(err) {
+			return fmt.Errorf("key_file not found: %s", t.KeyFile)
+		}
 	}
 
 	// 验证 CA 文件存在性
-	if t.CAFile == "" {
+	if t.CAFile == "" && len(t.CAFiles) == 0 && len(t.CADirs) == 0 {
 		return fmt.Errorf("ca_file is required")
 	}
-	if _, err := os.Stat(t.CAFile); os.IsNotExist(err) {
-		return fmt.Errorf("ca_file not found: %s", t.CAFile)
+	for _, file := range append([]string{t.CAFile}, t.CAFiles...) {
+		if file == "" {
+			continue
+		}
+		if _, err := os.Stat(file); os.IsNotExist(err) {
+			return fmt.Errorf("ca_file not found: %s", file)
+		}
+	}
+	for _, dir := range t.CADirs {
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			return fmt.Errorf("ca_dir not found: %s", dir)
+		}
 	}
 
 	// 验证客户端认证模式
@@ -169,19 +804,39 @@ func (t *TLSConfig) Validate() error {
 		return fmt.Errorf("invalid client_auth mode: %s (valid: NoClientCert, RequestClientCert, RequireAnyClientCert, VerifyClientCertIfGiven, RequireAndVerifyClientCert)", t.ClientAuth)
 	}
 
+	// 验证 TLS 策略
+	if _, err := t.Policy(nil); err != nil {
+		return fmt.Errorf("invalid tls policy: %w", err)
+	}
+
 	return nil
 }
 
+// Policy 返回数据平面 TLS 策略，未配置版本、套件与曲线时返回 fallback
+func (t *TLSConfig) Policy(fallback *cert.TLSPolicy) (*cert.TLSPolicy, error) {
+	if t.MinVersion == "" && t.MaxVersion == "" && len(t.CipherSuites) == 0 && len(t.CurvePreferences) == 0 {
+		return fallback, nil
+	}
+	return cert.ParseTLSPolicy(t.MinVersion, t.MaxVersion, t.CipherSuites, t.CurvePreferences)
+}
+
+// clientAuthModes 客户端认证模式名称（TLSConfig.ClientAuth、ListenerConfig.ClientAuth）
+var clientAuthModes = map[string]tls.ClientAuthType{
+	"NoClientCert":               tls.NoClientCert,
+	"RequestClientCert":          tls.RequestClientCert,
+	"RequireAnyClientCert":       tls.RequireAnyClientCert,
+	"VerifyClientCertIfGiven":    tls.VerifyClientCertIfGiven,
+	"RequireAndVerifyClientCert": tls.RequireAndVerifyClientCert,
+}
+
 // GetClientAuthType 返回 tls.ClientAuthType
 func (t *TLSConfig) GetClientAuthType() tls.ClientAuthType {
-	authModes := map[string]tls.ClientAuthType{
-		"NoClientCert":               tls.NoClientCert,
-		"RequestClientCert":          tls.RequestClientCert,
-		"RequireAnyClientCert":       tls.RequireAnyClientCert,
-		"VerifyClientCertIfGiven":    tls.VerifyClientCertIfGiven,
-		"RequireAndVerifyClientCert": tls.RequireAndVerifyClientCert,
-	}
-	if authType, ok := authModes[t.ClientAuth]; ok {
+	return parseClientAuth(t.ClientAuth)
+}
+
+// parseClientAuth 解析客户端认证模式，未知或未设置时为 RequireAndVerifyClientCert
+func parseClientAuth(mode string) tls.ClientAuthType {
+	if authType, ok := clientAuthModes[mode]; ok {
 		return authType
 	}
 	return tls.RequireAndVerifyClientCert // 默认
@@ -229,6 +884,9 @@ func (r *RelayConfig) Validate() error {
 	if r.MaxConnections <= 0 {
 		return fmt.Errorf("max_connections must be positive, got: %d", r.MaxConnections)
 	}
+	if r.MetricsServiceLimit < 0 {
+		return fmt.Errorf("metrics_service_limit must not be negative, got: %d", r.MetricsServiceLimit)
+	}
 
 	return nil
 }
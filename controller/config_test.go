@@ -7,6 +7,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/houzhh15/sdp-common/config"
+	"github.com/houzhh15/sdp-common/transport"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -84,6 +86,17 @@ func TestDataPlaneConfig_Validate(t *testing.T) {
 			wantErr: true,
 			errMsg:  "key_file not found",
 		},
+		{
+			name: "Key reference instead of key file",
+			config: &DataPlaneConfig{
+				TLS: TLSConfig{
+					CertFile: certFile,
+					Key:      "env:SDP_DATA_PLANE_KEY",
+					CAFile:   caFile,
+				},
+			},
+			wantErr: false,
+		},
 		{
 			name: "Missing CA file",
 			config: &DataPlaneConfig{
@@ -109,6 +122,19 @@ func TestDataPlaneConfig_Validate(t *testing.T) {
 			wantErr: true,
 			errMsg:  "invalid client_auth mode",
 		},
+		{
+			name: "Negative drain timeout",
+			config: &DataPlaneConfig{
+				TLS: TLSConfig{
+					CertFile: certFile,
+					KeyFile:  keyFile,
+					CAFile:   caFile,
+				},
+				DrainTimeout: -time.Second,
+			},
+			wantErr: true,
+			errMsg:  "drain_timeout must not be negative",
+		},
 	}
 
 	for _, tt := range tests {
@@ -420,3 +446,165 @@ func TestConfig_Validate_WithDataPlane(t *testing.T) {
 		})
 	}
 }
+
+// TestConfig_Validate_TrustedProxies 测试可信代理配置校验
+func TestConfig_Validate_TrustedProxies(t *testing.T) {
+	base := Config{
+		CertFile:     "cert.pem",
+		KeyFile:      "key.pem",
+		CAFile:       "ca.pem",
+		HTTPAddr:     ":8443",
+		TCPProxyAddr: ":9443",
+	}
+
+	valid := base
+	valid.TrustedProxies = []string{"10.0.0.0/8", "192.168.1.10", "fd00::/8"}
+	require.NoError(t, valid.Validate())
+
+	invalid := base
+	invalid.TrustedProxies = []string{"10.0.0.0/33"}
+	err := invalid.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid trusted proxy")
+}
+
+// TestConfig_Validate_ServiceEventBatchWindow 测试服务事件合并窗口校验
+func TestConfig_Validate_ServiceEventBatchWindow(t *testing.T) {
+	cfg := Config{
+		CertFile:                "cert.pem",
+		KeyFile:                 "key.pem",
+		CAFile:                  "ca.pem",
+		HTTPAddr:                ":8443",
+		TCPProxyAddr:            ":9443",
+		ServiceEventBatchWindow: 200 * time.Millisecond,
+	}
+	require.NoError(t, cfg.Validate())
+
+	cfg.ServiceEventBatchWindow = -time.Second
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "service event batch window")
+}
+
+// TestConfig_Validate_Listeners 测试附加监听配置校验
+func TestConfig_Validate_Listeners(t *testing.T) {
+	base := Config{
+		CertFile:     "cert.pem",
+		KeyFile:      "key.pem",
+		CAFile:       "ca.pem",
+		HTTPAddr:     ":8443",
+		TCPProxyAddr: ":9443",
+	}
+
+	tests := []struct {
+		name      string
+		httpRoles []ListenerRole
+		listeners []*ListenerConfig
+		errMsg    string
+	}{
+		{
+			name:      "Separate admin port",
+			httpRoles: []ListenerRole{ListenerRoleClient, ListenerRoleAgent},
+			listeners: []*ListenerConfig{{Name: "admin", Addr: ":8445", Roles: []ListenerRole{ListenerRoleAdmin}, ClientAuth: "RequireAndVerifyClientCert"}},
+		},
+		{
+			name:      "Invalid http role",
+			httpRoles: []ListenerRole{"public"},
+			errMsg:    "http_roles: invalid role: public",
+		},
+		{
+			name:      "Missing addr",
+			listeners: []*ListenerConfig{{Roles: []ListenerRole{ListenerRoleAdmin}}},
+			errMsg:    "addr is required",
+		},
+		{
+			name:      "Missing roles",
+			listeners: []*ListenerConfig{{Addr: ":8445"}},
+			errMsg:    "at least one role is required",
+		},
+		{
+			name:      "Invalid client auth",
+			listeners: []*ListenerConfig{{Addr: ":8445", Roles: []ListenerRole{ListenerRoleAdmin}, ClientAuth: "Optional"}},
+			errMsg:    "invalid client_auth mode",
+		},
+		{
+			name:      "Client listener without client certs",
+			listeners: []*ListenerConfig{{Addr: ":8445", Roles: []ListenerRole{ListenerRoleClient}, ClientAuth: "RequestClientCert"}},
+		},
+		{
+			name:      "Admin listener without verified client certs",
+			listeners: []*ListenerConfig{{Addr: ":8445", Roles: []ListenerRole{ListenerRoleAdmin}, ClientAuth: "NoClientCert"}},
+			errMsg:    "not allowed for role admin",
+		},
+		{
+			name:      "Agent listener accepting any client cert",
+			listeners: []*ListenerConfig{{Addr: ":8445", Roles: []ListenerRole{ListenerRoleClient, ListenerRoleAgent}, ClientAuth: "RequireAnyClientCert"}},
+			errMsg:    "not allowed for role agent",
+		},
+		{
+			name:      "Addr conflicts with http_addr",
+			listeners: []*ListenerConfig{{Addr: ":8443", Roles: []ListenerRole{ListenerRoleAdmin}}},
+			errMsg:    "conflicts with another listener",
+		},
+		{
+			name: "Duplicate listener addr",
+			listeners: []*ListenerConfig{
+				{Addr: ":8445", Roles: []ListenerRole{ListenerRoleAdmin}},
+				{Addr: ":8445", Roles: []ListenerRole{ListenerRoleAgent}},
+			},
+			errMsg: "conflicts with another listener",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := base
+			cfg.HTTPRoles = tt.httpRoles
+			cfg.Listeners = tt.listeners
+			err := cfg.Validate()
+			if tt.errMsg == "" {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errMsg)
+			}
+		})
+	}
+}
+
+func TestConfigFromFile(t *testing.T) {
+	fc := &config.Config{
+		TLS: config.TLSConfig{
+			CertFile:   "cert.pem",
+			Key:        "env:CONTROLLER_KEY",
+			CAFile:     "ca.pem",
+			MinVersion: "TLS1.3",
+		},
+		Logging: config.LoggingConfig{Level: "debug", AuditFile: "audit.log"},
+		Transport: config.TransportConfig{
+			HTTPAddr:     ":8443",
+			TCPProxyAddr: ":9443",
+			MaxBodyBytes: 1024,
+			CORS:         &transport.CORSConfig{AllowedOrigins: []string{"*"}, AllowCredentials: true},
+		},
+	}
+
+	cfg, err := ConfigFromFile(fc)
+	require.NoError(t, err)
+	assert.Equal(t, "cert.pem", cfg.CertFile)
+	assert.True(t, cfg.Key.IsSet())
+	assert.Equal(t, uint16(tls.VersionTLS13), cfg.TLSPolicy.MinVersion)
+	assert.Equal(t, ":8443", cfg.HTTPAddr)
+	assert.Equal(t, "debug", cfg.LogLevel)
+	assert.Equal(t, "audit.log", cfg.AuditLogPath)
+	assert.Equal(t, int64(1024), cfg.HTTP.MaxBodyBytes)
+
+	// Controller 自身的校验在映射后执行
+	err = cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cors:")
+
+	fc.TLS.MinVersion = "TLS1.9"
+	_, err = ConfigFromFile(fc)
+	assert.Error(t, err)
+}
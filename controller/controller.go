@@ -32,11 +32,14 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -46,7 +49,6 @@ import (
 	"github.com/houzhh15/sdp-common/session"
 	"github.com/houzhh15/sdp-common/transport"
 	"github.com/houzhh15/sdp-common/tunnel"
-	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
@@ -61,19 +63,51 @@ type Controller struct {
 	policyEngine   *policy.Engine
 	tunnelManager  *InMemoryTunnelManager
 	tunnelNotifier *tunnel.Notifier
+	eventJournal   *tunnel.DBJournal   // Persistent SSE event journal
+	auditLogger    logging.AuditLogger // nil when AuditLogPath is not configured
+	telemetry      *telemetryStore     // Opt-in client SDK usage statistics
+	idempotency    *idempotencyCache   // Tunnel creation idempotency keys
+	clientIP       *transport.ClientIPResolver
+	expiry         *expiryWatcher      // Session/tunnel expiry warnings over SSE
+	usageAlerts    *usageAlerter       // Per-service tunnel usage thresholds over relay accounting
+	schedule       *serviceScheduler   // Service maintenance windows and scheduled disablement
+	opsEvents      *opsEventLog        // Operational timeline served by /admin/events
+	webhookClient  *http.Client        // Ops event webhook forwarding
+	certScanner    *cert.ExpiryScanner // Registered certificate expiry alerts
+	clientStreams  sync.Map            // IH client ID -> session token of its event stream
+	credentials    sync.Map            // tunnel ID -> *issuedCredential, revoked when the tunnel is deleted
+	maintenance    maintenanceMode     // Runtime read-only mode toggled through the admin API
+	transfers      sessionTransfers    // Pending session transfer codes between IH devices
 	logger         logging.Logger
 
 	// Transport servers
 	httpServer  transport.HTTPServer
 	relayServer transport.TunnelRelayServer // Controller data plane: IH ↔ Controller ↔ AH
+	relayReady  *relayReadiness             // Relay startup failures; nil skips readiness checks
+	internal    *internalRPC                // Internal RPC between replicas and relay nodes; nil when disabled
+	relayNodes  *relayNodeRegistry          // Standalone relay nodes registered over internal RPC
+	listeners   []*listener                 // Additional HTTPS listeners serving a subset of the API (Config.Listeners)
+	gateway     *gateway                    // Public mTLS gateway relaying end users to services; nil when disabled
+
+	// Data plane CA trust set when DataPlane.TLS is configured; nil while the relay shares certManager's trust
+	relayTrust atomic.Pointer[cert.TrustStore]
 
 	// Internal state
 	db         *gorm.DB
+	certTouch  *writeBatcher[string, time.Time] // Coalesces certificate last_seen_at updates; nil writes synchronously
 	mux        *http.ServeMux
+	routes     []route // Registered routes with their listener roles, for per-listener muxes
+	versions   *versionRegistry
 	ctx        context.Context
 	cancelFunc context.CancelFunc
 }
 
+// notifierMaxConsecutiveDrops AH 事件流连续丢弃该数量的广播事件后断开，由 AH 重连恢复
+const notifierMaxConsecutiveDrops = 50
+
+// notifierMaxSlowWrites AH 事件流连续该数量的事件发送耗时超过 tunnel.DefaultSlowWriteThreshold 后断开
+const notifierMaxSlowWrites = 5
+
 // New creates a new Controller instance with the given configuration
 func New(cfg *Config) (*Controller, error) {
 	if err := cfg.Validate(); err != nil {
@@ -91,14 +125,23 @@ func New(cfg *Config) (*Controller, error) {
 	}
 
 	// Initialize certificate manager
+	keyPEM, err := cfg.Key.Resolve(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve private key: %w", err)
+	}
 	certManager, err := cert.NewManager(&cert.Config{
-		CertFile: cfg.CertFile,
-		KeyFile:  cfg.KeyFile,
-		CAFile:   cfg.CAFile,
+		CertFile:  cfg.CertFile,
+		KeyFile:   cfg.KeyFile,
+		CAFile:    cfg.CAFile,
+		CAFiles:   cfg.CAFiles,
+		CADirs:    cfg.CADirs,
+		KeyPEM:    keyPEM,
+		TLSPolicy: cfg.TLSPolicy,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize cert manager: %w", err)
 	}
+	logger.Info("TLS policy", certManager.TLSPolicy().LogFields()...)
 
 	// Validate certificate
 	if err := certManager.ValidateExpiry(); err != nil {
@@ -112,10 +155,13 @@ func New(cfg *Config) (*Controller, error) {
 	if dbPath == "" {
 		dbPath = "controller.db"
 	}
-	db, err := gorm.Open(sqlite.Open(dbPath), &gorm.Config{})
+	db, err := openDatabase(dbPath, cfg.Database)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
+	if mode, err := journalMode(db); err == nil {
+		logger.Info("Database opened", "path", dbPath, "journal_mode", mode)
+	}
 
 	// Initialize certificate registry
 	certRegistry, err := cert.NewRegistry(db, logger)
@@ -123,10 +169,19 @@ func New(cfg *Config) (*Controller, error) {
 		return nil, fmt.Errorf("failed to initialize cert registry: %w", err)
 	}
 
-	// Initialize session manager
+	// Initialize session manager; forced revocations are reported once the Controller exists
+	var c *Controller
 	sessionManager := session.NewManager(&session.Config{
-		TokenTTL:        3600 * time.Second,
-		CleanupInterval: 300 * time.Second,
+		TokenTTL:             3600 * time.Second,
+		CleanupInterval:      300 * time.Second,
+		ClientClasses:        cfg.SessionClasses,
+		MaxSessionLifetime:   cfg.SessionMaxLifetime,
+		MaxRefreshCount:      cfg.SessionMaxRefreshCount,
+		ClockSkewTolerance:   cfg.ClockSkewTolerance,
+		Concurrency:          cfg.SessionConcurrency,
+		MaxSessionsPerClient: cfg.SessionMaxPerClient,
+		OnForcedRevocation:   func(r *session.ForcedRevocation) { c.onForcedRevocation(r) },
+		Clock:                cfg.Clock,
 	}, logger)
 
 	// Initialize policy engine
@@ -139,6 +194,12 @@ func New(cfg *Config) (*Controller, error) {
 		Storage:   policyStorage,
 		Evaluator: &policy.DefaultEvaluator{},
 		Logger:    logger,
+		Clock:     cfg.Clock,
+
+		DefaultDecision:    cfg.DefaultPolicyDecision,
+		ServiceDefaults:    cfg.ServicePolicyDefaults,
+		EvaluationBudget:   cfg.PolicyEvaluationBudget,
+		ClockSkewTolerance: cfg.ClockSkewTolerance,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize policy engine: %w", err)
@@ -147,11 +208,58 @@ func New(cfg *Config) (*Controller, error) {
 	// Initialize tunnel manager
 	tunnelManager := NewInMemoryTunnelManager(logger)
 
+	// Persist broadcast events for audit, polling (GET /api/v1/events) and Last-Event-ID replay
+	eventJournal, err := tunnel.NewDBJournal(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize event journal: %w", err)
+	}
+
+	// Persist opt-in client SDK usage statistics across restarts
+	telemetry, err := newTelemetryStore(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize telemetry store: %w", err)
+	}
+
 	// Initialize tunnel notifier
-	tunnelNotifier := tunnel.NewNotifier(logger, 30*time.Second)
+	tunnelNotifier := tunnel.NewNotifierWithConfig(&tunnel.NotifierConfig{
+		Logger:              logger,
+		Heartbeat:           30 * time.Second,
+		Clock:               cfg.Clock,
+		MaxConsecutiveDrops: notifierMaxConsecutiveDrops,
+		MaxSlowWrites:       notifierMaxSlowWrites,
+		Capabilities:        cfg.Capabilities,
+		RateLimit:           cfg.AgentEventRateLimit,
+		ServiceBatchWindow:  cfg.ServiceEventBatchWindow,
+		Journal:             eventJournal,
+	})
+
+	// Initialize audit logger (optional)
+	var auditLogger logging.AuditLogger
+	if cfg.AuditLogPath != "" {
+		auditLogger, err = logging.NewFileAuditLogger(cfg.AuditLogPath, logger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize audit logger: %w", err)
+		}
+	}
 
 	// Initialize HTTP server
-	httpServer := transport.NewHTTPServer(tlsConfig)
+	httpServer := transport.NewHTTPServerWithConfig(tlsConfig, cfg.HTTP)
+
+	// Real client IP extraction (trusted X-Forwarded-For / X-Real-IP); validated in cfg.Validate
+	clientIP, err := transport.NewClientIPResolver(cfg.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trusted proxies: %w", err)
+	}
+
+	// Internal RPC (controller ↔ controller, controller ↔ relay) with a separate service identity
+	var internal *internalRPC
+	if cfg.Internal != nil {
+		internal, err = newInternalRPC(cfg)
+		if err != nil {
+			return nil, err
+		}
+		logger.Info("Internal service identity loaded", "identity", internal.identity.URI())
+	}
 
 	// Initialize Tunnel Relay Server for Controller data plane (IH ↔ Controller ↔ AH)
 	// NOTE: Controller should use TunnelRelayServer, NOT TCPProxyServer
@@ -165,6 +273,11 @@ func New(cfg *Config) (*Controller, error) {
 			ReadTimeout:    cfg.DataPlane.RelayConfig.ReadTimeout,
 			WriteTimeout:   cfg.DataPlane.RelayConfig.WriteTimeout,
 			MaxConnections: cfg.DataPlane.RelayConfig.MaxConnections,
+
+			AcceptProxyProtocol: cfg.DataPlane.RelayConfig.AcceptProxyProtocol,
+			MetricsServices:     cfg.DataPlane.RelayConfig.MetricsServices,
+			MetricsServiceLimit: cfg.DataPlane.RelayConfig.MetricsServiceLimit,
+			Clock:               cfg.Clock,
 		}
 	} else {
 		// Use default configuration if not specified
@@ -174,13 +287,49 @@ func New(cfg *Config) (*Controller, error) {
 			ReadTimeout:    300 * time.Second,
 			WriteTimeout:   300 * time.Second,
 			MaxConnections: 10000,
+			Clock:          cfg.Clock,
+		}
+	}
+	// 中继按服务统计字节数、活跃隧道、错误与首字节时间（service 标签）
+	relayConfig.ServiceResolver = func(tunnelID string) string {
+		tun, err := tunnelManager.GetTunnel(context.Background(), tunnelID)
+		if err != nil {
+			return ""
+		}
+		return tun.ServiceID
+	}
+	// 按隧道生效的服务等级标记中继连接的 DSCP
+	relayConfig.QoSResolver = func(tunnelID string) string {
+		tun, err := tunnelManager.GetTunnel(context.Background(), tunnelID)
+		if err != nil {
+			return ""
+		}
+		return tun.QoSClass()
+	}
+	// 中继确认配对，超时未配对的隧道由 watchTunnelPairing 转为 failed
+	relayConfig.OnPaired = func(tunnelID string) {
+		tunnelManager.(*InMemoryTunnelManager).MarkPaired(tunnelID, time.Now())
+	}
+	if cfg.Tracing {
+		// 配对耗时以创建隧道的请求的 trace ID 作为 exemplar
+		relayConfig.TraceResolver = func(tunnelID string) string {
+			tun, err := tunnelManager.GetTunnel(context.Background(), tunnelID)
+			if err != nil {
+				return ""
+			}
+			return tun.TraceID()
 		}
 	}
+	if internal != nil {
+		// 多跳隧道：以内部身份转发到下一跳中继，接受其他副本或中继节点转发的连接
+		relayConfig.ChainTLSConfig = internal.relayChainTLSConfig(certManager.GetCAPool())
+		relayConfig.ChainPeers = internal.policy
+	}
 	relayServer := transport.NewTunnelRelayServer(logger, relayConfig)
 
 	ctx, cancel := context.WithCancel(context.Background())
 
-	c := &Controller{
+	c = &Controller{
 		config:         cfg,
 		certManager:    certManager,
 		certRegistry:   certRegistry,
@@ -188,20 +337,71 @@ func New(cfg *Config) (*Controller, error) {
 		policyEngine:   policyEngine,
 		tunnelManager:  tunnelManager.(*InMemoryTunnelManager),
 		tunnelNotifier: tunnelNotifier,
+		eventJournal:   eventJournal,
+		auditLogger:    auditLogger,
+		telemetry:      telemetry,
+		idempotency:    newIdempotencyCache(cfg.TunnelIdempotencyTTL),
+		clientIP:       clientIP,
 		logger:         logger,
 		httpServer:     httpServer,
 		relayServer:    relayServer,
+		relayReady:     newRelayReadiness(),
+		internal:       internal,
 		db:             db,
 		mux:            http.NewServeMux(),
+		versions:       newVersionRegistry(cfg.APIVersions, cfg.DefaultAPIVersion),
 		ctx:            ctx,
 		cancelFunc:     cancel,
 	}
 
+	c.opsEvents = newOpsEventLog(cfg.OpsEventCapacity)
+	c.relayNodes = newRelayNodeRegistry()
+	c.webhookClient = &http.Client{Timeout: webhookTimeout}
+	c.expiry = newExpiryWatcher(c, cfg.ExpiryWarningLead, cfg.Clock)
+	c.usageAlerts = newUsageAlerter(c)
+	c.schedule = newServiceScheduler(c)
+	c.certScanner = cert.NewExpiryScanner(certRegistry, &cert.ExpiryScannerConfig{
+		Warning: cfg.CertExpiryWarning,
+		Audit:   auditLogger,
+		Logger:  logger,
+		Clock:   cfg.Clock,
+	})
+
+	if interval := cfg.Database.writeBatchInterval(); interval > 0 {
+		c.certTouch = newWriteBatcher("cert_last_seen", interval, cfg.Clock, logger, certRegistry.TouchBatch)
+	}
+
+	// Declarative services and policies (GitOps); an invalid file aborts startup without changes
+	if err := c.applySeedFiles(ctx); err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to apply declarative config: %w", err)
+	}
+
+	// Push policy changes to the affected IH's event stream
+	policyEngine.OnChange(c.notifyPolicyChange)
+
 	// Register HTTP handlers
 	c.registerHandlers()
+	if c.internal != nil {
+		c.registerInternalHandlers()
+	}
 
 	// Register middleware
-	c.registerMiddleware()
+	c.registerMiddleware(c.httpServer)
+
+	// Additional listeners serve the routes of their roles with their own client certificate policy
+	if c.listeners, err = c.newListeners(keyPEM); err != nil {
+		cancel()
+		return nil, err
+	}
+
+	// Gateway mode: end users without an IH reach services through the relay by SNI
+	if cfg.Gateway != nil {
+		if c.gateway, err = c.newGateway(keyPEM); err != nil {
+			cancel()
+			return nil, err
+		}
+	}
 
 	return c, nil
 }
@@ -210,22 +410,89 @@ func New(cfg *Config) (*Controller, error) {
 func (c *Controller) Start() error {
 	c.logger.Info("Controller starting", "version", "1.0.0")
 
-	// Start data plane server in background with mTLS
+	// Start data plane server in background with mTLS; the API is served once the relay listens,
+	// otherwise tunnels created during startup would time out pairing
 	go c.startDataPlane()
+	if err := c.waitRelay(c.config.RelayStartTimeout); err != nil {
+		c.logger.Error("Data plane relay not ready, tunnel creation unavailable until it is", "error", err)
+	} else {
+		c.recordOpsEvent(OpsComponentStarted, "relay", OpsSeverityInfo, "Data plane relay listening",
+			map[string]interface{}{"addr": c.relayServer.Addr().String()})
+	}
 
 	// Start HTTP server in background
 	go c.startHTTPServer()
+	for _, l := range c.listeners {
+		go c.startListener(l)
+	}
+	if c.gateway != nil {
+		go c.startGateway()
+	}
+
+	// Start internal RPC server (replicas and relay nodes) in background
+	if c.internal != nil {
+		go c.startInternalServer()
+	}
+
+	// Push session/tunnel expiry warnings to subscribed IH clients
+	go c.expiry.run(c.ctx)
+
+	// Fail tunnels the relay never confirmed as paired
+	go c.watchTunnelPairing(c.ctx)
+
+	// Alert on registered certificates nearing expiry
+	go c.certScanner.Run(c.ctx)
+
+	// Disconnect relayed tunnels no AH reported once agents had time to reconnect
+	go c.sweepRelayTunnels(c.ctx)
+
+	// Drop journaled events past the retention period
+	go c.pruneEventJournal(c.ctx)
+
+	// Permanently remove recycle bin entries past the retention period
+	go c.purgeRecycleBin(c.ctx)
+
+	// Purge audit records past AuditRetention, keeping daily summaries
+	go c.purgeAuditLog(c.ctx)
+
+	// Alert on tunnels exceeding their service's usage thresholds
+	go c.usageAlerts.run(c.ctx)
+
+	// Flip service status on maintenance windows and scheduled disablement
+	go c.schedule.run(c.ctx)
+
+	c.recordOpsEvent(OpsComponentStarted, "controller", OpsSeverityInfo, "Controller started", map[string]interface{}{
+		"http_addr": c.config.HTTPAddr,
+		"listeners": len(c.listeners),
+		"gateway":   c.gateway != nil,
+		"internal":  c.internal != nil,
+	})
 
 	fmt.Printf("\n✅ Controller started successfully!\n")
 	fmt.Printf("   HTTPS Server: https://localhost%s\n", c.config.HTTPAddr)
 	fmt.Printf("   TCP Proxy:    localhost%s\n", c.config.TCPProxyAddr)
+	for _, l := range c.listeners {
+		fmt.Printf("   Listener:     https://localhost%s (%s)\n", l.config.Addr, l.config.name())
+	}
+	if c.gateway != nil {
+		fmt.Printf("   Gateway:      localhost%s\n", c.gateway.config.ListenAddr)
+	}
 	fmt.Printf("   Health Check: https://localhost%s/health\n", c.config.HTTPAddr)
 	fmt.Printf("   Press Ctrl+C to stop\n\n")
 
-	// Wait for interrupt signal
+	// Wait for interrupt signal; the upgrade signal (SIGUSR2) hands the data plane to a new process
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	<-sigChan
+	signal.Notify(sigChan, append([]os.Signal{syscall.SIGINT, syscall.SIGTERM}, upgradeSignals...)...)
+	for sig := range sigChan {
+		if !isUpgradeSignal(sig) {
+			break
+		}
+		if err := c.Upgrade(); err != nil {
+			c.logger.Error("Binary upgrade failed, continuing with current process", "error", err)
+			continue
+		}
+		return nil
+	}
 
 	c.logger.Info("Shutting down Controller...")
 	return c.Stop()
@@ -233,16 +500,59 @@ func (c *Controller) Start() error {
 
 // Stop gracefully stops the Controller
 func (c *Controller) Stop() error {
+	c.recordOpsEvent(OpsComponentStopped, "controller", OpsSeverityInfo, "Controller stopping", nil)
 	c.cancelFunc()
 
 	if err := c.httpServer.Stop(); err != nil {
 		c.logger.Error("Failed to stop HTTP server", "error", err)
 	}
 
+	for _, l := range c.listeners {
+		if err := l.server.Stop(); err != nil {
+			c.logger.Error("Failed to stop HTTPS listener", "name", l.config.name(), "error", err)
+		}
+	}
+
+	// Gateway connections are relay IH sides; close them before the relay waits for its tunnels
+	if c.gateway != nil {
+		c.gateway.stop()
+	}
+
 	if err := c.relayServer.Stop(); err != nil {
 		c.logger.Error("Failed to stop relay server", "error", err)
 	}
 
+	if c.internal != nil {
+		if err := c.internal.server.Stop(); err != nil {
+			c.logger.Error("Failed to stop internal RPC server", "error", err)
+		}
+	}
+
+	// 停止会话后台清理
+	if err := c.sessionManager.Close(); err != nil {
+		c.logger.Error("Failed to close session manager", "error", err)
+	}
+
+	if closer, ok := c.auditLogger.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			c.logger.Error("Failed to close audit logger", "error", err)
+		}
+	}
+
+	// 写入尚未落盘的合并更新后再关闭数据库
+	if c.certTouch != nil {
+		if err := c.certTouch.Close(); err != nil {
+			c.logger.Error("Failed to flush certificate last seen updates", "error", err)
+		}
+	}
+	if c.db != nil {
+		if sqlDB, err := c.db.DB(); err == nil {
+			if err := sqlDB.Close(); err != nil {
+				c.logger.Error("Failed to close database", "error", err)
+			}
+		}
+	}
+
 	c.logger.Info("Controller stopped")
 	return nil
 }
@@ -266,6 +576,14 @@ func (c *Controller) AddPolicy(pol *policy.Policy) error {
 	return c.policyEngine.SavePolicy(c.ctx, pol)
 }
 
+// InternalClient returns the mTLS client for other replicas' internal RPC (nil when Internal is not configured)
+func (c *Controller) InternalClient() *InternalClient {
+	if c.internal == nil {
+		return nil
+	}
+	return c.internal.client
+}
+
 // startDataPlane starts the tunnel relay server with mTLS
 func (c *Controller) startDataPlane() {
 	// Determine listen address
@@ -280,15 +598,34 @@ func (c *Controller) startDataPlane() {
 	var tlsConfig *tls.Config
 	if c.config.DataPlane != nil {
 		// Load certificates from DataPlane config
+		keyPEM, err := c.config.DataPlane.TLS.Key.Resolve(c.ctx)
+		if err != nil {
+			c.logger.Error("Failed to resolve data plane private key", "error", err)
+			c.relayFailed(fmt.Errorf("data plane private key: %w", err))
+			return
+		}
+		policy, err := c.config.DataPlane.TLS.Policy(c.certManager.TLSPolicy())
+		if err != nil {
+			c.logger.Error("Invalid data plane TLS policy", "error", err)
+			c.relayFailed(fmt.Errorf("data plane TLS policy: %w", err))
+			return
+		}
 		dataPlaneManager, err := cert.NewManager(&cert.Config{
-			CertFile: c.config.DataPlane.TLS.CertFile,
-			KeyFile:  c.config.DataPlane.TLS.KeyFile,
-			CAFile:   c.config.DataPlane.TLS.CAFile,
+			CertFile:  c.config.DataPlane.TLS.CertFile,
+			KeyFile:   c.config.DataPlane.TLS.KeyFile,
+			CAFile:    c.config.DataPlane.TLS.CAFile,
+			CAFiles:   c.config.DataPlane.TLS.CAFiles,
+			CADirs:    c.config.DataPlane.TLS.CADirs,
+			KeyPEM:    keyPEM,
+			TLSPolicy: policy,
 		})
 		if err != nil {
 			c.logger.Error("Failed to load data plane certificates", "error", err)
+			c.relayFailed(fmt.Errorf("data plane certificates: %w", err))
 			return
 		}
+		c.logger.Info("Data plane TLS policy", policy.LogFields()...)
+		c.relayTrust.Store(dataPlaneManager.TrustStore())
 
 		tlsConfig = dataPlaneManager.GetTLSConfig()
 		// Override client auth mode with DataPlane config
@@ -298,36 +635,50 @@ func (c *Controller) startDataPlane() {
 		tlsConfig = c.certManager.GetTLSConfig()
 	}
 
-	if err := c.relayServer.StartTLS(listenAddr, tlsConfig); err != nil {
+	// 升级后的新进程优先使用旧进程传递的监听 socket，端口在升级期间不会关闭
+	reusePort := c.config.DataPlane != nil && c.config.DataPlane.ReusePort
+	ln, inherited, err := transport.Listen(relayListenerName, listenAddr, reusePort)
+	if err != nil {
 		c.logger.Error("Tunnel relay server error", "error", err)
+		c.relayFailed(err)
+		return
+	}
+	if inherited {
+		c.logger.Info("Using data plane listener inherited from previous process", "addr", ln.Addr().String())
+	}
+
+	if err := c.relayServer.Serve(ln, tlsConfig); err != nil {
+		c.logger.Error("Tunnel relay server error", "error", err)
+		c.relayFailed(err)
 	}
 }
 
 // startHTTPServer starts the HTTP server
 func (c *Controller) startHTTPServer() {
-	c.logger.Info("Starting HTTPS server", "addr", c.config.HTTPAddr)
-	if err := c.httpServer.Start(c.config.HTTPAddr, c.mux); err != nil {
+	c.logger.Info("Starting HTTPS server", "addr", c.config.HTTPAddr, "roles", c.config.HTTPRoles)
+	if err := c.httpServer.Start(c.config.HTTPAddr, c.routeMux(c.config.HTTPRoles)); err != nil {
 		log.Fatalf("Failed to start HTTP server: %v", err)
 	}
 }
 
-// registerMiddleware registers HTTP middleware
-func (c *Controller) registerMiddleware() {
-	c.httpServer.RegisterMiddleware(func(next http.Handler) http.Handler {
+// registerMiddleware registers HTTP middleware on an HTTPS server (main or additional listener)
+func (c *Controller) registerMiddleware(server transport.HTTPServer) {
+	// CORS 位于最外层，预检请求无需经过后续中间件（未配置时不生效）
+	server.RegisterMiddleware(transport.CORSMiddleware(c.config.CORS))
+
+	// 解析真实客户端 IP，供审计与策略评估使用（transport.ClientIPFromRequest）
+	server.RegisterMiddleware(transport.ClientIPMiddleware(c.clientIP))
+
+	server.RegisterMiddleware(func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			start := time.Now()
-			c.logger.Info("HTTP request", "method", r.Method, "path", r.URL.Path)
+			c.logger.Info("HTTP request", "method", r.Method, "path", r.URL.Path, "client_ip", transport.ClientIPFromRequest(r))
 			next.ServeHTTP(w, r)
 			c.logger.Debug("HTTP response", "method", r.Method, "path", r.URL.Path, "duration", time.Since(start))
 		})
 	})
 }
 
-// extractClientID extracts client ID from certificate
-func extractClientID(cert *x509.Certificate) string {
-	return cert.Subject.CommonName
-}
-
 // extractBearerToken extracts Bearer token from Authorization header
 func extractBearerToken(r *http.Request) string {
 	auth := r.Header.Get("Authorization")
@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/houzhh15/sdp-common/logging"
+	"github.com/houzhh15/sdp-common/tunnel"
+)
+
+// issuedCredential ephemeral target credential minted for a tunnel
+type issuedCredential struct {
+	broker     string
+	clientID   string
+	serviceID  string
+	credential *tunnel.TargetCredential
+}
+
+// mintTunnelCredential mints target credentials for a tunnel whose service references a credential broker.
+// Returns nil when the service does not use ephemeral credentials
+func (c *Controller) mintTunnelCredential(ctx context.Context, tun *tunnel.Tunnel, service *tunnel.ServiceConfig) (*tunnel.TargetCredential, error) {
+	if service.CredentialBroker == "" {
+		return nil, nil
+	}
+	broker := c.config.CredentialBrokers[service.CredentialBroker]
+	if broker == nil {
+		return nil, fmt.Errorf("credential broker %q is not configured", service.CredentialBroker)
+	}
+
+	targetPort, _ := tun.Metadata["target_port"].(int)
+	targetHost, _ := tun.Metadata["target_host"].(string)
+	credential, err := broker.Mint(ctx, &tunnel.CredentialRequest{
+		TunnelID:   tun.ID,
+		ClientID:   tun.ClientID,
+		ServiceID:  tun.ServiceID,
+		TargetHost: targetHost,
+		TargetPort: targetPort,
+		ExpiresAt:  tun.ExpiresAt,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("mint credential via %s: %w", service.CredentialBroker, err)
+	}
+	if credential == nil {
+		return nil, fmt.Errorf("credential broker %q returned no credential", service.CredentialBroker)
+	}
+
+	c.credentials.Store(tun.ID, &issuedCredential{
+		broker:     service.CredentialBroker,
+		clientID:   tun.ClientID,
+		serviceID:  tun.ServiceID,
+		credential: credential,
+	})
+	c.logger.Info("Tunnel credential minted",
+		"tunnel_id", tun.ID,
+		"broker", service.CredentialBroker,
+		"credential_id", credential.CredentialID)
+	return credential, nil
+}
+
+// tunnelCredential returns the credential minted for a tunnel (idempotent replays return it again)
+func (c *Controller) tunnelCredential(tunnelID string) *tunnel.TargetCredential {
+	if val, ok := c.credentials.Load(tunnelID); ok {
+		return val.(*issuedCredential).credential
+	}
+	return nil
+}
+
+// revokeTunnelCredential revokes the credential of a deleted or expired tunnel.
+// Revocation failures are logged and audited; the credential still expires on the broker side
+func (c *Controller) revokeTunnelCredential(ctx context.Context, tunnelID string) {
+	val, ok := c.credentials.LoadAndDelete(tunnelID)
+	if !ok {
+		return
+	}
+	issued := val.(*issuedCredential)
+
+	result, reason := "success", ""
+	broker := c.config.CredentialBrokers[issued.broker]
+	if broker == nil {
+		result, reason = "failure", "credential broker not configured"
+	} else if err := broker.Revoke(ctx, issued.credential); err != nil {
+		result, reason = "failure", err.Error()
+	}
+
+	if result == "success" {
+		c.logger.Info("Tunnel credential revoked", "tunnel_id", tunnelID, "broker", issued.broker)
+	} else {
+		c.logger.Warn("Failed to revoke tunnel credential", "tunnel_id", tunnelID, "broker", issued.broker, "error", reason)
+	}
+	c.auditAccess(ctx, &logging.AccessEvent{
+		ClientID:  issued.clientID,
+		ServiceID: issued.serviceID,
+		Action:    "credential_revoke",
+		Result:    result,
+		Reason:    reason,
+		Details: map[string]interface{}{
+			"tunnel_id":     tunnelID,
+			"broker":        issued.broker,
+			"credential_id": issued.credential.CredentialID,
+		},
+	})
+}
@@ -0,0 +1,109 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/houzhh15/sdp-common/tunnel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeBroker 记录签发与吊销的凭据
+type fakeBroker struct {
+	mu      sync.Mutex
+	minted  []*tunnel.CredentialRequest
+	revoked []string
+	mintErr error
+}
+
+func (b *fakeBroker) Mint(ctx context.Context, req *tunnel.CredentialRequest) (*tunnel.TargetCredential, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.mintErr != nil {
+		return nil, b.mintErr
+	}
+	b.minted = append(b.minted, req)
+	return &tunnel.TargetCredential{
+		CredentialID: "lease-" + req.TunnelID,
+		Username:     "v-" + req.ClientID,
+		Password:     "secret",
+		ExpiresAt:    time.Now().Add(time.Hour),
+	}, nil
+}
+
+func (b *fakeBroker) Revoke(ctx context.Context, credential *tunnel.TargetCredential) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.revoked = append(b.revoked, credential.CredentialID)
+	return nil
+}
+
+func newCredentialTestController(t *testing.T) (*Controller, string, *fakeBroker) {
+	t.Helper()
+	c, token := newIdempotencyTestController(t)
+	broker := &fakeBroker{}
+	c.config.CredentialBrokers = map[string]tunnel.CredentialBroker{"vault": broker}
+
+	svc, err := c.tunnelManager.GetServiceConfig(context.Background(), "svc-1")
+	require.NoError(t, err)
+	svc.CredentialBroker = "vault"
+	return c, token, broker
+}
+
+func TestTunnelCredentials_MintAndRevoke(t *testing.T) {
+	c, token, broker := newCredentialTestController(t)
+
+	created := postTunnel(c, token, "svc-1", "retry-1")
+	require.Equal(t, http.StatusCreated, created.Code, created.Body.String())
+	var resp struct {
+		TunnelID    string                   `json:"tunnel_id"`
+		Credentials *tunnel.TargetCredential `json:"credentials"`
+	}
+	require.NoError(t, json.Unmarshal(created.Body.Bytes(), &resp))
+	require.NotNil(t, resp.Credentials)
+	assert.Equal(t, "lease-"+resp.TunnelID, resp.Credentials.CredentialID)
+	assert.Equal(t, "secret", resp.Credentials.Password)
+	require.Len(t, broker.minted, 1)
+	assert.Equal(t, "127.0.0.1", broker.minted[0].TargetHost)
+	assert.Equal(t, 8080, broker.minted[0].TargetPort)
+
+	// 凭据不会随隧道事件下发给 AH
+	tun, err := c.tunnelManager.GetTunnel(context.Background(), resp.TunnelID)
+	require.NoError(t, err)
+	assert.NotContains(t, tun.Metadata, "credentials")
+
+	// 幂等重放返回同一凭据，不重复签发
+	replay := postTunnel(c, token, "svc-1", "retry-1")
+	require.Equal(t, http.StatusCreated, replay.Code)
+	assert.Contains(t, replay.Body.String(), "lease-"+resp.TunnelID)
+	assert.Len(t, broker.minted, 1)
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/v1/tunnels/"+resp.TunnelID, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	c.handleTunnelDelete(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, []string{"lease-" + resp.TunnelID}, broker.revoked)
+	assert.Nil(t, c.tunnelCredential(resp.TunnelID))
+}
+
+func TestTunnelCredentials_MintFailure(t *testing.T) {
+	c, token, broker := newCredentialTestController(t)
+	broker.mintErr = errors.New("vault sealed")
+
+	w := postTunnel(c, token, "svc-1", "")
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	assert.Contains(t, w.Body.String(), "CREDENTIAL_UNAVAILABLE")
+
+	// 签发失败时不保留隧道
+	tunnels, err := c.tunnelManager.ListTunnels(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Empty(t, tunnels)
+}
@@ -0,0 +1,151 @@
+// SDP Controller dashboard: polls the RBAC-protected admin APIs.
+(function () {
+  'use strict';
+
+  var API = '/api/v1';
+  var REFRESH_MS = 3000;
+  var TOKEN_KEY = 'sdp-admin-token';
+  var timer = null;
+
+  function token() {
+    return sessionStorage.getItem(TOKEN_KEY) || '';
+  }
+
+  function setStatus(text, isError) {
+    var el = document.getElementById('status');
+    el.textContent = text;
+    el.className = isError ? 'status error' : 'status';
+  }
+
+  function formatBytes(n) {
+    if (n === undefined || n === null) return '-';
+    var units = ['B', 'KB', 'MB', 'GB', 'TB'];
+    var i = 0;
+    while (n >= 1024 && i < units.length - 1) {
+      n /= 1024;
+      i++;
+    }
+    return n.toFixed(i === 0 ? 0 : 1) + ' ' + units[i];
+  }
+
+  function formatTime(s) {
+    if (!s || s.indexOf('0001-01-01') === 0) return '-';
+    return new Date(s).toLocaleString();
+  }
+
+  function cell(text) {
+    var td = document.createElement('td');
+    td.textContent = text === undefined || text === null || text === '' ? '-' : String(text);
+    return td;
+  }
+
+  function renderRows(id, items, columns) {
+    var body = document.getElementById(id);
+    body.replaceChildren();
+    items.forEach(function (item) {
+      var tr = document.createElement('tr');
+      columns(item).forEach(function (v) { tr.appendChild(cell(v)); });
+      body.appendChild(tr);
+    });
+    document.getElementById(id + '-count').textContent = '(' + items.length + ')';
+  }
+
+  function get(path) {
+    return fetch(API + path, {
+      headers: { 'Authorization': 'Bearer ' + token() },
+      credentials: 'same-origin'
+    }).then(function (resp) {
+      return resp.json().then(function (body) {
+        if (!resp.ok) {
+          var err = new Error(body.message || resp.statusText);
+          err.status = resp.status;
+          throw err;
+        }
+        return body;
+      });
+    });
+  }
+
+  function refresh() {
+    if (!token()) {
+      setStatus('Sign in with an admin client certificate or paste an admin session token.', false);
+      return;
+    }
+
+    Promise.all([
+      get('/admin/sessions'),
+      get('/admin/tunnels'),
+      get('/admin/agents'),
+      get('/admin/audit?limit=50'),
+      get('/admin/policies')
+    ]).then(function (r) {
+      renderRows('sessions', r[0].sessions, function (s) {
+        var device = s.device_info ? s.device_info.device_id + ' (' + s.device_info.os +
+          (s.device_info.compliance ? '' : ', non-compliant') + ')' : '';
+        return [s.client_id, s.client_class, device, s.token, formatTime(s.created_at), formatTime(s.expires_at), s.refresh_count];
+      });
+      renderRows('tunnels', r[1].tunnels, function (t) {
+        var relay = t.relay || {};
+        return [t.id, t.client_id, t.service_id, t.status, formatBytes(relay.bytes_ih_to_ah),
+          formatBytes(relay.bytes_ah_to_ih), formatTime(relay.started_at)];
+      });
+
+      var agents = document.getElementById('agents');
+      agents.replaceChildren();
+      r[2].agents.forEach(function (a) {
+        var li = document.createElement('li');
+        li.textContent = a;
+        agents.appendChild(li);
+      });
+      document.getElementById('agents-count').textContent = '(' + r[2].agents.length + ')';
+
+      renderRows('audit', r[3].events, function (e) {
+        var d = e.data || {};
+        return [formatTime(e.timestamp), e.event_type, d.client_id, d.action || d.event_type, d.result || d.severity];
+      });
+      renderRows('policies', r[4].policies || [], function (p) {
+        return [p.policy_id, p.client_id, p.service_id, formatTime(p.expiry_time)];
+      });
+
+      var note = r[3].enabled ? '' : ' (audit log disabled)';
+      setStatus('Updated ' + new Date().toLocaleTimeString() + note, false);
+    }).catch(function (err) {
+      if (err.status === 401 || err.status === 403) {
+        sessionStorage.removeItem(TOKEN_KEY);
+      }
+      setStatus(err.message, true);
+    });
+  }
+
+  function start() {
+    if (timer) clearInterval(timer);
+    refresh();
+    timer = setInterval(refresh, REFRESH_MS);
+  }
+
+  document.getElementById('auth').addEventListener('submit', function (ev) {
+    ev.preventDefault();
+    var input = document.getElementById('token');
+    sessionStorage.setItem(TOKEN_KEY, input.value.trim());
+    input.value = '';
+    start();
+  });
+
+  document.getElementById('handshake').addEventListener('click', function () {
+    fetch(API + '/handshake', { method: 'POST', credentials: 'same-origin' })
+      .then(function (resp) { return resp.json(); })
+      .then(function (body) {
+        if (!body.session_token) throw new Error(body.message || 'Handshake failed');
+        sessionStorage.setItem(TOKEN_KEY, body.session_token);
+        start();
+      })
+      .catch(function (err) { setStatus(err.message, true); });
+  });
+
+  document.getElementById('logout').addEventListener('click', function () {
+    sessionStorage.removeItem(TOKEN_KEY);
+    start();
+  });
+
+  start();
+})();
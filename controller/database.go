@@ -0,0 +1,107 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// 嵌入式 SQLite 默认参数
+const (
+	defaultDBBusyTimeout        = 5 * time.Second
+	defaultDBMaxOpenConns       = 4
+	defaultDBWriteBatchInterval = time.Second
+)
+
+// DatabaseConfig 嵌入式 SQLite 调优参数
+type DatabaseConfig struct {
+	// DisableWAL 使用默认的 rollback journal；默认启用 WAL，读写互不阻塞
+	DisableWAL bool
+	// BusyTimeout 写锁被占用时等待的时间，超时才返回 "database is locked"，默认 5s
+	BusyTimeout time.Duration
+	// MaxOpenConns 连接池上限，默认 4（WAL 下可并发读，写入仍串行）；内存数据库固定为 1
+	MaxOpenConns int
+	// WriteBatchInterval 高频更新（证书 last_seen_at）合并写入的间隔，默认 1s，负数表示逐条同步写入
+	WriteBatchInterval time.Duration
+}
+
+// Validate 校验数据库参数
+func (d *DatabaseConfig) Validate() error {
+	if d == nil {
+		return nil
+	}
+	if d.BusyTimeout < 0 || d.MaxOpenConns < 0 {
+		return fmt.Errorf("database: busy_timeout and max_open_conns must not be negative")
+	}
+	return nil
+}
+
+func (d *DatabaseConfig) writeBatchInterval() time.Duration {
+	if d == nil || d.WriteBatchInterval == 0 {
+		return defaultDBWriteBatchInterval
+	}
+	return d.WriteBatchInterval
+}
+
+// openDatabase 打开 SQLite 数据库：每个连接设置 journal_mode / busy_timeout / synchronous，
+// 写事务以 BEGIN IMMEDIATE 开始，避免读锁升级为写锁时的死锁式 "database is locked"
+func openDatabase(path string, cfg *DatabaseConfig) (*gorm.DB, error) {
+	if cfg == nil {
+		cfg = &DatabaseConfig{}
+	}
+	busyTimeout := cfg.BusyTimeout
+	if busyTimeout == 0 {
+		busyTimeout = defaultDBBusyTimeout
+	}
+	maxOpen := cfg.MaxOpenConns
+	if maxOpen == 0 {
+		maxOpen = defaultDBMaxOpenConns
+	}
+
+	params := []string{
+		fmt.Sprintf("_busy_timeout=%d", busyTimeout.Milliseconds()),
+		"_txlock=immediate",
+	}
+	if !cfg.DisableWAL {
+		// WAL 下 synchronous=NORMAL 仍保证崩溃一致性，仅在断电时可能丢失最近的提交
+		params = append(params, "_journal_mode=WAL", "_synchronous=NORMAL")
+	}
+	// 每个连接各自持有一个内存数据库，只能使用单连接
+	if isMemoryDSN(path) {
+		maxOpen = 1
+	}
+
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	db, err := gorm.Open(sqlite.Open(path+sep+strings.Join(params, "&")), &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(maxOpen)
+	sqlDB.SetMaxIdleConns(maxOpen)
+	return db, nil
+}
+
+// isMemoryDSN 是否为 SQLite 内存数据库
+func isMemoryDSN(path string) bool {
+	return strings.HasPrefix(path, ":memory:") || strings.Contains(path, "mode=memory")
+}
+
+// journalMode 返回当前 journal 模式（wal / delete / memory）
+func journalMode(db *gorm.DB) (string, error) {
+	var mode string
+	if err := db.Raw("PRAGMA journal_mode").Scan(&mode).Error; err != nil {
+		return "", err
+	}
+	return mode, nil
+}
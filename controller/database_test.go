@@ -0,0 +1,189 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/houzhh15/sdp-common/cert"
+	"github.com/houzhh15/sdp-common/clock"
+	"github.com/houzhh15/sdp-common/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenDatabase(t *testing.T) {
+	t.Run("defaults enable WAL and busy timeout", func(t *testing.T) {
+		db, err := openDatabase(filepath.Join(t.TempDir(), "controller.db"), nil)
+		require.NoError(t, err)
+		sqlDB, _ := db.DB()
+		defer sqlDB.Close()
+
+		mode, err := journalMode(db)
+		require.NoError(t, err)
+		assert.Equal(t, "wal", mode)
+
+		var timeout int
+		require.NoError(t, db.Raw("PRAGMA busy_timeout").Scan(&timeout).Error)
+		assert.Equal(t, 5000, timeout)
+		assert.Equal(t, defaultDBMaxOpenConns, sqlDB.Stats().MaxOpenConnections)
+	})
+
+	t.Run("WAL disabled", func(t *testing.T) {
+		db, err := openDatabase(filepath.Join(t.TempDir(), "controller.db"), &DatabaseConfig{DisableWAL: true, BusyTimeout: time.Second})
+		require.NoError(t, err)
+		sqlDB, _ := db.DB()
+		defer sqlDB.Close()
+
+		mode, err := journalMode(db)
+		require.NoError(t, err)
+		assert.Equal(t, "delete", mode)
+
+		var timeout int
+		require.NoError(t, db.Raw("PRAGMA busy_timeout").Scan(&timeout).Error)
+		assert.Equal(t, 1000, timeout)
+	})
+
+	t.Run("memory database uses a single connection", func(t *testing.T) {
+		db, err := openDatabase(":memory:", &DatabaseConfig{MaxOpenConns: 8})
+		require.NoError(t, err)
+		sqlDB, _ := db.DB()
+		defer sqlDB.Close()
+		assert.Equal(t, 1, sqlDB.Stats().MaxOpenConnections)
+	})
+
+	t.Run("negative values rejected", func(t *testing.T) {
+		assert.Error(t, (&DatabaseConfig{BusyTimeout: -time.Second}).Validate())
+		assert.Error(t, (&DatabaseConfig{MaxOpenConns: -1}).Validate())
+		assert.NoError(t, (&DatabaseConfig{WriteBatchInterval: -1}).Validate())
+	})
+}
+
+func TestWriteBatcher(t *testing.T) {
+	logger, err := logging.NewLogger(&logging.Config{Level: "error", Format: "json", Output: "stdout"})
+	require.NoError(t, err)
+	clk := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	var (
+		mu      sync.Mutex
+		batches []map[string]int
+		fail    = true
+	)
+	flushed := make(chan struct{}, 4)
+	b := newWriteBatcher("test", time.Second, clk, logger, func(batch map[string]int) error {
+		mu.Lock()
+		defer mu.Unlock()
+		defer func() { flushed <- struct{}{} }()
+		if fail {
+			fail = false
+			return errors.New("database is locked")
+		}
+		batches = append(batches, batch)
+		return nil
+	})
+
+	b.Add("a", 1)
+	b.Add("a", 2)
+	b.Add("b", 1)
+	clk.BlockUntil(1)
+
+	// 首次写入失败，数据保留到下一轮
+	clk.Advance(time.Second)
+	<-flushed
+	b.Add("a", 3)
+	clk.Advance(time.Second)
+	<-flushed
+
+	mu.Lock()
+	require.Len(t, batches, 1)
+	assert.Equal(t, map[string]int{"a": 3, "b": 1}, batches[0])
+	mu.Unlock()
+
+	// Close 写入剩余更新
+	b.Add("c", 1)
+	require.NoError(t, b.Close())
+	require.NoError(t, b.Close())
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, batches, 2)
+	assert.Equal(t, map[string]int{"c": 1}, batches[1])
+}
+
+// BenchmarkLastSeenWrites 32 个并发写入方更新 50 个证书的 last_seen_at：
+// rollback journal 与 WAL 下逐条写入（Registry.Touch），以及 WAL 下经 writeBatcher 合并写入。
+// 文档中的参考数据：go test ./controller -run '^$' -bench LastSeenWrites -benchtime 2000x
+func BenchmarkLastSeenWrites(b *testing.B) {
+	const writers, certs = 32, 50
+
+	modes := []struct {
+		name    string
+		cfg     *DatabaseConfig
+		batched bool
+	}{
+		{"rollback", &DatabaseConfig{DisableWAL: true}, false},
+		{"wal", nil, false},
+		{"wal_batched", nil, true},
+	}
+	for _, mode := range modes {
+		b.Run(mode.name, func(b *testing.B) {
+			logger, err := logging.NewLogger(&logging.Config{Level: "error", Format: "json", Output: "stdout"})
+			require.NoError(b, err)
+			db, err := openDatabase(filepath.Join(b.TempDir(), "controller.db"), mode.cfg)
+			require.NoError(b, err)
+			sqlDB, _ := db.DB()
+			defer sqlDB.Close()
+			registry, err := cert.NewRegistry(db, logger)
+			require.NoError(b, err)
+
+			now := time.Now()
+			fingerprints := make([]string, certs)
+			for i := range fingerprints {
+				fingerprints[i] = fmt.Sprintf("fp-%02d", i)
+				require.NoError(b, db.Create(&cert.CertRecord{
+					Fingerprint: fingerprints[i], Subject: "CN=bench", Issuer: "CN=bench-ca",
+					NotBefore: now, NotAfter: now.Add(time.Hour),
+				}).Error)
+			}
+
+			var batcher *writeBatcher[string, time.Time]
+			if mode.batched {
+				batcher = newWriteBatcher("bench", time.Hour, clock.Real(), logger, registry.TouchBatch)
+				defer batcher.Close()
+			}
+
+			b.ResetTimer()
+			var wg sync.WaitGroup
+			errs := make(chan error, writers)
+			for w := 0; w < writers; w++ {
+				wg.Add(1)
+				go func(w int) {
+					defer wg.Done()
+					for i := w; i < b.N; i += writers {
+						fingerprint := fingerprints[i%certs]
+						if batcher != nil {
+							batcher.Add(fingerprint, time.Now())
+							continue
+						}
+						if err := registry.Touch(fingerprint); err != nil {
+							errs <- err
+							return
+						}
+					}
+				}(w)
+			}
+			wg.Wait()
+			if batcher != nil {
+				require.NoError(b, batcher.Flush())
+			}
+			b.StopTimer()
+			close(errs)
+			for err := range errs {
+				b.Fatal(err)
+			}
+		})
+	}
+}
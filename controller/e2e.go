@@ -0,0 +1,164 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/houzhh15/sdp-common/logging"
+	"github.com/houzhh15/sdp-common/transport"
+	"github.com/houzhh15/sdp-common/tunnel"
+)
+
+// handleTunnelE2EKey exchanges the AH public key of an end-to-end encrypted tunnel.
+// POST: the AH publishes its key (first key wins), the IH is notified via tunnel_e2e_ready.
+// GET:  the owning IH polls for the key (?tunnel_id=) if it is not subscribed to client events
+func (c *Controller) handleTunnelE2EKey(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		c.handleTunnelE2EKeyPublish(w, r)
+	case http.MethodGet:
+		c.handleTunnelE2EKeyGet(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (c *Controller) handleTunnelE2EKeyPublish(w http.ResponseWriter, r *http.Request) {
+	// 仅持有已验证 AH 证书的 agent 可上报公钥，agent 身份取自证书 CN
+	agentID, ok := verifiedAgentID(r)
+	if !ok {
+		respondErrorWithStatus(w, "FORBIDDEN", "Only agents may publish tunnel keys", nil, http.StatusForbidden)
+		return
+	}
+
+	var report tunnel.E2EKeyReport
+	if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+		respondErrorWithStatus(w, "INVALID_REQUEST", "Invalid request body", nil, http.StatusBadRequest)
+		return
+	}
+	if report.TunnelID == "" {
+		respondErrorWithStatus(w, "INVALID_REQUEST", "Missing tunnel_id", nil, http.StatusBadRequest)
+		return
+	}
+	if _, err := tunnel.ParseE2EPublicKey(report.PublicKey); err != nil {
+		respondErrorWithStatus(w, "INVALID_REQUEST", err.Error(), nil, http.StatusBadRequest)
+		return
+	}
+
+	if report.AgentID != "" && report.AgentID != agentID {
+		respondErrorWithStatus(w, "FORBIDDEN", "agent_id does not match client certificate", nil, http.StatusForbidden)
+		return
+	}
+
+	ctx := r.Context()
+	if !c.agentServesTunnel(ctx, agentID, report.TunnelID) {
+		respondErrorWithStatus(w, "FORBIDDEN", "Agent does not serve this tunnel", nil, http.StatusForbidden)
+		return
+	}
+
+	tun, err := c.tunnelManager.SetAgentE2EKey(ctx, report.TunnelID, report.PublicKey)
+	switch {
+	case errors.Is(err, errE2ENotEnabled):
+		respondErrorWithStatus(w, "E2E_NOT_ENABLED", err.Error(), nil, http.StatusBadRequest)
+		return
+	case errors.Is(err, errE2EKeyExists):
+		respondErrorWithStatus(w, "E2E_KEY_EXISTS", err.Error(), nil, http.StatusConflict)
+		return
+	case err != nil:
+		respondErrorWithStatus(w, "TUNNEL_NOT_FOUND", "Tunnel not found", nil, http.StatusNotFound)
+		return
+	}
+
+	c.logger.Info("Tunnel e2e key published", "tunnel_id", tun.ID, "agent_id", agentID)
+	c.auditAccess(ctx, &logging.AccessEvent{
+		ClientID:  agentID,
+		ServiceID: tun.ServiceID,
+		SourceIP:  transport.ClientIPFromRequest(r),
+		Action:    "tunnel_e2e_key",
+		Result:    "success",
+		Details:   map[string]interface{}{"tunnel_id": tun.ID},
+	})
+
+	c.notifyClient(tun.ClientID, &tunnel.ClientEvent{
+		Type:      tunnel.EventTunnelE2EReady,
+		ClientID:  tun.ClientID,
+		ServiceID: tun.ServiceID,
+		Details: map[string]interface{}{
+			"tunnel_id":  tun.ID,
+			"public_key": report.PublicKey,
+		},
+		Timestamp: time.Now(),
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"type":      "tunnel_e2e_key",
+		"status":    "success",
+		"tunnel_id": tun.ID,
+	})
+}
+
+// agentServesTunnel reports whether agentID may act for the tunnel's service: services
+// registered by an agent (registered_by) are served by that agent only, services created
+// by an administrator are not bound to an agent. Unknown tunnels pass and fail later with 404
+func (c *Controller) agentServesTunnel(ctx context.Context, agentID, tunnelID string) bool {
+	tun, err := c.tunnelManager.GetTunnel(ctx, tunnelID)
+	if err != nil {
+		return true
+	}
+	return c.agentServesService(ctx, agentID, tun.ServiceID)
+}
+
+// agentServesService reports whether agentID may act for the service (see agentServesTunnel)
+func (c *Controller) agentServesService(ctx context.Context, agentID, serviceID string) bool {
+	svc, err := c.tunnelManager.GetServiceConfig(ctx, serviceID)
+	if err != nil {
+		return false
+	}
+	owner, _ := svc.Metadata[serviceMetadataRegisteredBy].(string)
+	return owner == "" || owner == agentID
+}
+
+func (c *Controller) handleTunnelE2EKeyGet(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	token := extractBearerToken(r)
+	if token == "" {
+		respondErrorWithStatus(w, "UNAUTHORIZED", "Missing authorization token", nil, http.StatusUnauthorized)
+		return
+	}
+	sess, err := c.sessionManager.ValidateSession(ctx, token)
+	if err != nil {
+		respondErrorWithStatus(w, "UNAUTHORIZED", "Invalid or expired session", nil, http.StatusUnauthorized)
+		return
+	}
+
+	// 非隧道所有者与不存在的隧道返回相同结果，不暴露其他客户端的隧道
+	tun, err := c.tunnelManager.GetTunnel(ctx, r.URL.Query().Get("tunnel_id"))
+	if err != nil || tun.ClientID != sess.ClientID {
+		respondErrorWithStatus(w, "TUNNEL_NOT_FOUND", "Tunnel not found", nil, http.StatusNotFound)
+		return
+	}
+	if !tun.IsEndToEnd() {
+		respondErrorWithStatus(w, "E2E_NOT_ENABLED", errE2ENotEnabled.Error(), nil, http.StatusBadRequest)
+		return
+	}
+	publicKey := tun.E2EAgentPublicKey()
+	if publicKey == "" {
+		respondErrorWithStatus(w, "E2E_KEY_PENDING", "Agent key not yet published", nil, http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"type":       "tunnel_e2e_key",
+		"status":     "success",
+		"tunnel_id":  tun.ID,
+		"public_key": publicKey,
+	})
+}
@@ -0,0 +1,153 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/houzhh15/sdp-common/tunnel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func postE2ETunnel(c *Controller, token, publicKey string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(map[string]interface{}{
+		"session_token":  token,
+		"service_id":     "svc-1",
+		"protocol":       "tcp",
+		"e2e_public_key": publicKey,
+	})
+	w := httptest.NewRecorder()
+	c.handleTunnelCreate(w, httptest.NewRequest(http.MethodPost, "/api/v1/tunnels", bytes.NewReader(body)))
+	return w
+}
+
+func publishE2EKey(c *Controller, tunnelID, publicKey string) *httptest.ResponseRecorder {
+	return publishE2EKeyAs(c, "ah-1", tunnelID, publicKey)
+}
+
+// publishE2EKeyAs 以证书 CN 为 agentID 的已验证 AH 身份上报公钥
+func publishE2EKeyAs(c *Controller, agentID, tunnelID, publicKey string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(&tunnel.E2EKeyReport{AgentID: agentID, TunnelID: tunnelID, PublicKey: publicKey})
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/tunnels/e2e-key", bytes.NewReader(body))
+	peer := &x509.Certificate{Subject: pkix.Name{CommonName: agentID}}
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{peer}, VerifiedChains: [][]*x509.Certificate{{peer}}}
+	w := httptest.NewRecorder()
+	c.handleTunnelE2EKey(w, req)
+	return w
+}
+
+func getE2EKey(c *Controller, token, tunnelID string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/tunnels/e2e-key?tunnel_id="+tunnelID, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	c.handleTunnelE2EKey(w, req)
+	return w
+}
+
+func TestTunnelE2E_KeyExchange(t *testing.T) {
+	c, token := newIdempotencyTestController(t)
+	ihKey, err := tunnel.GenerateE2EKey()
+	require.NoError(t, err)
+	ahKey, err := tunnel.GenerateE2EKey()
+	require.NoError(t, err)
+
+	created := postE2ETunnel(c, token, ihKey.PublicKey())
+	require.Equal(t, http.StatusCreated, created.Code, created.Body.String())
+	assert.Contains(t, created.Body.String(), `"end_to_end":true`)
+	tunnelID := tunnelIDFrom(t, created)
+
+	tun, err := c.tunnelManager.GetTunnel(context.Background(), tunnelID)
+	require.NoError(t, err)
+	assert.Equal(t, ihKey.PublicKey(), tun.E2EPublicKey())
+
+	// AH 尚未上报
+	pending := getE2EKey(c, token, tunnelID)
+	assert.Equal(t, http.StatusNotFound, pending.Code)
+	assert.Contains(t, pending.Body.String(), "E2E_KEY_PENDING")
+
+	require.Equal(t, http.StatusOK, publishE2EKey(c, tunnelID, ahKey.PublicKey()).Code)
+
+	w := getE2EKey(c, token, tunnelID)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp struct {
+		PublicKey string `json:"public_key"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, ahKey.PublicKey(), resp.PublicKey)
+
+	// 只接受首次上报
+	other, _ := tunnel.GenerateE2EKey()
+	assert.Equal(t, http.StatusConflict, publishE2EKey(c, tunnelID, other.PublicKey()).Code)
+
+	// 其他客户端看不到该隧道
+	bobToken := createTestSession(t, c, "bob", "user")
+	assert.Equal(t, http.StatusNotFound, getE2EKey(c, bobToken, tunnelID).Code)
+}
+
+func TestTunnelE2E_Required(t *testing.T) {
+	c, token := newIdempotencyTestController(t)
+	svc, err := c.tunnelManager.GetServiceConfig(context.Background(), "svc-1")
+	require.NoError(t, err)
+	svc.EndToEnd = true
+
+	w := postE2ETunnel(c, token, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "E2E_REQUIRED")
+
+	w = postE2ETunnel(c, token, "not-a-key")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// 未启用 E2E 的隧道不接受 AH 公钥
+	svc.EndToEnd = false
+	plain := postTunnel(c, token, "svc-1", "")
+	require.Equal(t, http.StatusCreated, plain.Code)
+	key, _ := tunnel.GenerateE2EKey()
+	assert.Equal(t, http.StatusBadRequest, publishE2EKey(c, tunnelIDFrom(t, plain), key.PublicKey()).Code)
+	assert.Equal(t, http.StatusNotFound, publishE2EKey(c, "tunnel-unknown", key.PublicKey()).Code)
+}
+
+func TestTunnelE2E_PublisherIdentity(t *testing.T) {
+	c, token := newIdempotencyTestController(t)
+	svc, err := c.tunnelManager.GetServiceConfig(context.Background(), "svc-1")
+	require.NoError(t, err)
+	svc.Metadata = map[string]interface{}{serviceMetadataRegisteredBy: "ah-1"}
+
+	ihKey, _ := tunnel.GenerateE2EKey()
+	ahKey, _ := tunnel.GenerateE2EKey()
+	created := postE2ETunnel(c, token, ihKey.PublicKey())
+	require.Equal(t, http.StatusCreated, created.Code, created.Body.String())
+	tunnelID := tunnelIDFrom(t, created)
+
+	// 未经验证的对端证书不能上报
+	body, _ := json.Marshal(&tunnel.E2EKeyReport{AgentID: "ah-1", TunnelID: tunnelID, PublicKey: ahKey.PublicKey()})
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/tunnels/e2e-key", bytes.NewReader(body))
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "ah-1"}}}}
+	w := httptest.NewRecorder()
+	c.handleTunnelE2EKey(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// IH 证书与不服务该隧道的 agent 被拒绝，公钥未被占用
+	assert.Equal(t, http.StatusForbidden, publishE2EKeyAs(c, "ih-client", tunnelID, ahKey.PublicKey()).Code)
+	foreign := publishE2EKeyAs(c, "ah-foreign", tunnelID, ahKey.PublicKey())
+	assert.Equal(t, http.StatusForbidden, foreign.Code)
+	assert.Contains(t, foreign.Body.String(), "FORBIDDEN")
+	assert.Equal(t, http.StatusNotFound, getE2EKey(c, token, tunnelID).Code)
+
+	// 请求体 agent_id 必须与证书一致
+	body, _ = json.Marshal(&tunnel.E2EKeyReport{AgentID: "ah-foreign", TunnelID: tunnelID, PublicKey: ahKey.PublicKey()})
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/tunnels/e2e-key", bytes.NewReader(body))
+	peer := &x509.Certificate{Subject: pkix.Name{CommonName: "ah-1"}}
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{peer}, VerifiedChains: [][]*x509.Certificate{{peer}}}
+	w = httptest.NewRecorder()
+	c.handleTunnelE2EKey(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	require.Equal(t, http.StatusOK, publishE2EKeyAs(c, "ah-1", tunnelID, ahKey.PublicKey()).Code)
+}
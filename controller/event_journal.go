@@ -0,0 +1,99 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/houzhh15/sdp-common/clock"
+	"github.com/houzhh15/sdp-common/tunnel"
+)
+
+const (
+	// defaultEventJournalRetention 事件日志默认保留 7 天
+	defaultEventJournalRetention = 7 * 24 * time.Hour
+
+	// defaultEventPageSize / maxEventPageSize 事件日志轮询单次返回条数
+	defaultEventPageSize = 100
+	maxEventPageSize     = 1000
+)
+
+// handleEventJournal returns journaled tunnel/service events after ?since=<seq>
+// Polling consumers pass the returned next_since back to continue where they left off
+func (c *Controller) handleEventJournal(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	var since uint64
+	if v := query.Get("since"); v != "" {
+		seq, ok := tunnel.ParseEventID(v)
+		if !ok {
+			respondErrorWithStatus(w, "INVALID_REQUEST", "Invalid since", nil, http.StatusBadRequest)
+			return
+		}
+		since = seq
+	}
+
+	limit := defaultEventPageSize
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			respondErrorWithStatus(w, "INVALID_REQUEST", "Invalid limit", nil, http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxEventPageSize)
+	}
+
+	entries := []*tunnel.JournalEntry{}
+	if c.eventJournal != nil {
+		found, err := c.eventJournal.Since(r.Context(), since, limit)
+		if err != nil {
+			c.logger.Error("Failed to query event journal", "since", since, "error", err)
+			respondErrorWithStatus(w, "INTERNAL_ERROR", "Failed to query event journal", nil, http.StatusInternalServerError)
+			return
+		}
+		entries = append(entries, found...)
+	}
+
+	nextSince := since
+	if len(entries) > 0 {
+		nextSince = entries[len(entries)-1].Seq
+	}
+
+	respondAdmin(w, "event_list", map[string]interface{}{
+		"events":     entries,
+		"next_since": nextSince,
+		"has_more":   len(entries) == limit,
+	})
+}
+
+// pruneEventJournal periodically deletes journaled events older than EventJournalRetention
+func (c *Controller) pruneEventJournal(ctx context.Context) {
+	if c.eventJournal == nil {
+		return
+	}
+
+	retention := c.config.EventJournalRetention
+	if retention <= 0 {
+		retention = defaultEventJournalRetention
+	}
+
+	clk := clock.Or(c.config.Clock)
+	ticker := clk.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		pruned, err := c.eventJournal.Prune(ctx, clk.Now().Add(-retention))
+		if err != nil {
+			c.logger.Warn("Failed to prune event journal", "error", err)
+		} else if pruned > 0 {
+			c.logger.Info("Event journal pruned", "events", pruned)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/houzhh15/sdp-common/tunnel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestEventJournal_Polling(t *testing.T) {
+	c, token := newIdempotencyTestController(t)
+	adminToken := createTestSession(t, c, "root", "admin")
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	journal, err := tunnel.NewDBJournal(db)
+	require.NoError(t, err)
+	c.eventJournal = journal
+	c.tunnelNotifier = tunnel.NewNotifierWithConfig(&tunnel.NotifierConfig{Heartbeat: 30 * time.Second, Journal: journal})
+	c.handleVersioned("/api/{version}/events", c.requireAdmin(c.handleEventJournal))
+
+	require.Equal(t, http.StatusCreated, postTunnel(c, token, "svc-1", "").Code)
+	require.Equal(t, http.StatusCreated, postTunnel(c, token, "svc-1", "").Code)
+
+	var page struct {
+		Events    []*tunnel.JournalEntry `json:"events"`
+		NextSince uint64                 `json:"next_since"`
+		HasMore   bool                   `json:"has_more"`
+	}
+	w := adminGet(c, "/api/v1/events?limit=1", adminToken)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	require.Len(t, page.Events, 1)
+	assert.Equal(t, uint64(1), page.Events[0].Seq)
+	assert.Equal(t, tunnel.JournalKindTunnel, page.Events[0].Kind)
+	assert.Equal(t, "alice", page.Events[0].ClientID)
+	assert.NotContains(t, string(page.Events[0].Data), token, "session tokens must not be journaled")
+	assert.True(t, page.HasMore)
+
+	w = adminGet(c, "/api/v1/events?since=1", adminToken)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	require.Len(t, page.Events, 1)
+	assert.Equal(t, uint64(2), page.NextSince)
+	assert.False(t, page.HasMore)
+
+	w = adminGet(c, "/api/v1/events?since=2", adminToken)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	assert.Empty(t, page.Events)
+	assert.Equal(t, uint64(2), page.NextSince)
+
+	assert.Equal(t, http.StatusBadRequest, adminGet(c, "/api/v1/events?since=abc", adminToken).Code)
+	assert.Equal(t, http.StatusForbidden, adminGet(c, "/api/v1/events", token).Code)
+
+	// 超过保留期的事件被清理
+	pruned, err := journal.Prune(t.Context(), time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), pruned)
+}
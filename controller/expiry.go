@@ -0,0 +1,149 @@
+package controller
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/houzhh15/sdp-common/clock"
+	"github.com/houzhh15/sdp-common/tunnel"
+)
+
+const (
+	// defaultExpiryWarningLead 默认在到期前 5 分钟推送提醒
+	defaultExpiryWarningLead = 5 * time.Minute
+	// maxExpiryCheckInterval 到期扫描的最长间隔
+	maxExpiryCheckInterval = 30 * time.Second
+)
+
+// expiryWatcher 定期扫描会话和隧道，到期前通过 SSE 向所属 IH 推送 session_expiring / tunnel_expiring
+// 每个对象的同一到期时间只提醒一次；会话刷新后到期时间变化，会再次提醒
+type expiryWatcher struct {
+	c     *Controller
+	lead  time.Duration
+	clock clock.Clock
+
+	mu     sync.Mutex
+	warned map[string]time.Time // 对象键 -> 已提醒的到期时间
+}
+
+// newExpiryWatcher 创建到期提醒扫描器
+func newExpiryWatcher(c *Controller, lead time.Duration, clk clock.Clock) *expiryWatcher {
+	if lead <= 0 {
+		lead = defaultExpiryWarningLead
+	}
+	return &expiryWatcher{
+		c:      c,
+		lead:   lead,
+		clock:  clock.Or(clk),
+		warned: make(map[string]time.Time),
+	}
+}
+
+// run 周期扫描直到 ctx 结束（扫描间隔为提前量的一半，最长 30s）
+func (e *expiryWatcher) run(ctx context.Context) {
+	interval := e.lead / 2
+	if interval > maxExpiryCheckInterval {
+		interval = maxExpiryCheckInterval
+	}
+	if interval < time.Second {
+		interval = time.Second
+	}
+
+	ticker := e.clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			e.scan(ctx, e.clock.Now())
+		}
+	}
+}
+
+// scan 执行一次扫描：推送即将到期提醒，并删除已过期的隧道
+func (e *expiryWatcher) scan(ctx context.Context, now time.Time) {
+	seen := make(map[string]bool)
+
+	sessions, err := e.c.sessionManager.GetActiveSessions(ctx)
+	if err != nil {
+		e.c.logger.Warn("Expiry scan: failed to list sessions", "error", err)
+	}
+	for _, sess := range sessions {
+		key := "session:" + sess.Token
+		seen[key] = true
+		if sess.ExpiresAt.Sub(now) > e.lead {
+			continue
+		}
+		e.warn(key, sess.ClientID, &tunnel.ExpiryEvent{
+			Type:      tunnel.EventSessionExpiring,
+			ClientID:  sess.ClientID,
+			ExpiresAt: sess.ExpiresAt,
+			Renewable: sess.MaxExpiresAt.IsZero() || sess.ExpiresAt.Before(sess.MaxExpiresAt),
+		})
+	}
+
+	tunnels, err := e.c.tunnelManager.ListTunnels(ctx, nil)
+	if err != nil {
+		e.c.logger.Warn("Expiry scan: failed to list tunnels", "error", err)
+	}
+	for _, tun := range tunnels {
+		if tun.ExpiresAt.IsZero() {
+			continue
+		}
+		if !now.Before(tun.ExpiresAt) {
+			e.c.logger.Info("Tunnel expired", "tunnel_id", tun.ID, "client_id", tun.ClientID)
+			e.c.tunnelManager.DeleteTunnel(ctx, tun.ID)
+			e.c.revokeTunnelCredential(ctx, tun.ID)
+			continue
+		}
+
+		key := "tunnel:" + tun.ID
+		seen[key] = true
+		if tun.ExpiresAt.Sub(now) > e.lead {
+			continue
+		}
+		e.warn(key, tun.ClientID, &tunnel.ExpiryEvent{
+			Type:      tunnel.EventTunnelExpiring,
+			ClientID:  tun.ClientID,
+			TunnelID:  tun.ID,
+			ExpiresAt: tun.ExpiresAt,
+		})
+	}
+
+	// 清理已不存在对象的提醒记录
+	e.mu.Lock()
+	for key := range e.warned {
+		if !seen[key] {
+			delete(e.warned, key)
+		}
+	}
+	e.mu.Unlock()
+}
+
+// warn 推送提醒（同一到期时间只推送一次）
+// 客户端未订阅时不记录，订阅后的下一次扫描仍会推送
+func (e *expiryWatcher) warn(key, clientID string, event *tunnel.ExpiryEvent) {
+	e.mu.Lock()
+	prev, ok := e.warned[key]
+	e.mu.Unlock()
+	if ok && prev.Equal(event.ExpiresAt) {
+		return
+	}
+
+	if err := e.c.tunnelNotifier.NotifyExpiry(clientID, event); err != nil {
+		e.c.logger.Debug("Expiry warning not delivered", "client_id", clientID, "type", event.Type, "error", err)
+		return
+	}
+
+	e.mu.Lock()
+	e.warned[key] = event.ExpiresAt
+	e.mu.Unlock()
+	e.c.logger.Info("Expiry warning sent",
+		"client_id", clientID,
+		"type", event.Type,
+		"tunnel_id", event.TunnelID,
+		"expires_at", event.ExpiresAt.Format(time.RFC3339))
+}
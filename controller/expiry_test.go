@@ -0,0 +1,88 @@
+package controller
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/houzhh15/sdp-common/tunnel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpiryWatcher_Scan(t *testing.T) {
+	c, _ := newIdempotencyTestController(t)
+	ctx := context.Background()
+
+	expired, err := c.tunnelManager.CreateTunnel(ctx, &tunnel.CreateTunnelRequest{
+		ClientID: "alice", ServiceID: "svc-1", Protocol: "tcp", TTL: 30,
+	})
+	require.NoError(t, err)
+	expiring, err := c.tunnelManager.CreateTunnel(ctx, &tunnel.CreateTunnelRequest{
+		ClientID: "alice", ServiceID: "svc-1", Protocol: "tcp", TTL: 3660,
+	})
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		c.tunnelNotifier.Subscribe("alice", recorder)
+		close(done)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	// 58 分钟后：会话（1 小时）和第二条隧道进入 5 分钟提醒窗口，第一条隧道已过期
+	watcher := newExpiryWatcher(c, 0, nil)
+	now := time.Now().Add(58 * time.Minute)
+	watcher.scan(ctx, now)
+	// 同一到期时间不重复提醒
+	watcher.scan(ctx, now)
+	time.Sleep(100 * time.Millisecond)
+
+	c.tunnelNotifier.Unsubscribe("alice")
+	<-done
+
+	body := recorder.Body.String()
+	assert.Equal(t, 1, strings.Count(body, "event: "+tunnel.EventSessionExpiring+"\n"))
+	assert.Equal(t, 1, strings.Count(body, "event: "+tunnel.EventTunnelExpiring+"\n"))
+	assert.Contains(t, body, `"tunnel_id":"`+expiring.ID+`"`)
+	assert.Contains(t, body, `"renewable":true`)
+
+	_, err = c.tunnelManager.GetTunnel(ctx, expired.ID)
+	assert.Error(t, err, "expired tunnel should be deleted")
+	_, err = c.tunnelManager.GetTunnel(ctx, expiring.ID)
+	assert.NoError(t, err)
+}
+
+func TestExpiryWatcher_RetryWhenNotSubscribed(t *testing.T) {
+	c, _ := newIdempotencyTestController(t)
+	ctx := context.Background()
+
+	tun, err := c.tunnelManager.CreateTunnel(ctx, &tunnel.CreateTunnelRequest{
+		ClientID: "alice", ServiceID: "svc-1", Protocol: "tcp", TTL: 60,
+	})
+	require.NoError(t, err)
+
+	// 客户端未订阅时不记录提醒，订阅后下一次扫描仍会推送
+	watcher := newExpiryWatcher(c, time.Minute, nil)
+	watcher.scan(ctx, time.Now())
+	assert.Empty(t, watcher.warned)
+
+	recorder := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		c.tunnelNotifier.Subscribe("alice", recorder)
+		close(done)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	watcher.scan(ctx, time.Now())
+	time.Sleep(100 * time.Millisecond)
+	c.tunnelNotifier.Unsubscribe("alice")
+	<-done
+
+	assert.Contains(t, recorder.Body.String(), `"tunnel_id":"`+tun.ID+`"`)
+	assert.Contains(t, watcher.warned, "tunnel:"+tun.ID)
+}
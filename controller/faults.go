@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/houzhh15/sdp-common/faults"
+)
+
+// faultRequest 故障注入请求（delay 使用 Go duration 字符串，如 "500ms"）
+type faultRequest struct {
+	Point string `json:"point"`
+	Count int    `json:"count,omitempty"`
+	Delay string `json:"delay,omitempty"`
+}
+
+// registerFaultHandlers registers the test-only fault injection endpoint
+// 仅在 -tags faults 构建下注册，默认构建中该路由不存在
+func (c *Controller) registerFaultHandlers() {
+	if !faults.Enabled() {
+		return
+	}
+	c.logger.Warn("Fault injection enabled: test-only build, do not use in production")
+
+	handler := c.requireAdminMethods(c.handleAdminFaults, http.MethodGet, http.MethodPost, http.MethodDelete)
+	c.handleVersioned("/api/{version}/admin/faults", func(w http.ResponseWriter, r *http.Request) {
+		// 端点自身的会话校验不受 session_error 影响，保证故障可随时清除
+		handler(w, r.WithContext(faults.Bypass(r.Context())))
+	})
+}
+
+// handleAdminFaults lists (GET), injects (POST) or clears (DELETE, optional ?point=) faults
+func (c *Controller) handleAdminFaults(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		var req faultRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondErrorWithStatus(w, "INVALID_REQUEST", "Invalid request body", nil, http.StatusBadRequest)
+			return
+		}
+		fault := faults.Fault{Point: req.Point, Count: req.Count}
+		if req.Delay != "" {
+			delay, err := time.ParseDuration(req.Delay)
+			if err != nil {
+				respondErrorWithStatus(w, "INVALID_REQUEST", "Invalid delay", nil, http.StatusBadRequest)
+				return
+			}
+			fault.Delay = delay
+		}
+		if err := faults.Inject(fault); err != nil {
+			respondErrorWithStatus(w, "INVALID_REQUEST", err.Error(), nil, http.StatusBadRequest)
+			return
+		}
+		c.logger.Warn("Fault injected", "point", fault.Point, "count", fault.Count, "delay", fault.Delay.String())
+
+	case http.MethodDelete:
+		if point := r.URL.Query().Get("point"); point != "" {
+			faults.Clear(point)
+		} else {
+			faults.Reset()
+		}
+		c.logger.Info("Faults cleared", "point", r.URL.Query().Get("point"))
+	}
+
+	respondAdmin(w, "admin_faults", map[string]interface{}{"faults": faults.Active()})
+}
@@ -0,0 +1,47 @@
+//go:build faults
+
+package controller
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/houzhh15/sdp-common/faults"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminFaults_InjectSessionError(t *testing.T) {
+	t.Cleanup(faults.Reset)
+
+	c := newAdminTestController(t, &Config{})
+	adminToken := createTestSession(t, c, "ops", "admin")
+	userToken := createTestSession(t, c, "alice", "user")
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+		w := httptest.NewRecorder()
+		c.mux.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodPost, "/api/v1/admin/faults", `{"point":"session_error"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	_, err := c.sessionManager.ValidateSession(context.Background(), userToken)
+	assert.ErrorIs(t, err, faults.ErrInjected)
+
+	// 端点自身不受 session_error 影响，可清除故障
+	w = do(http.MethodDelete, "/api/v1/admin/faults", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	_, err = c.sessionManager.ValidateSession(context.Background(), userToken)
+	assert.NoError(t, err)
+
+	w = do(http.MethodPost, "/api/v1/admin/faults", `{"point":"sse_delay","delay":"bogus"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,307 @@
+package controller
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/houzhh15/sdp-common/cert"
+	"github.com/houzhh15/sdp-common/logging"
+	"github.com/houzhh15/sdp-common/policy"
+	"github.com/houzhh15/sdp-common/tunnel"
+)
+
+// metadataKeyGateway 网关创建的隧道标记（隧道 Metadata），AH 与管理接口可据此区分
+const metadataKeyGateway = "gateway"
+
+// errGatewayDenied 连接未通过授权（已记录审计），不再按错误日志输出
+var errGatewayDenied = errors.New("gateway access denied")
+
+// gateway 网关模式的公开监听（Config.Gateway）
+type gateway struct {
+	config    *GatewayConfig
+	tlsConfig *tls.Config
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{} // 进行中的用户连接，停止时关闭
+	stopped  bool
+	wg       sync.WaitGroup
+}
+
+// serviceFor 按 SNI 主机名解析服务：Routes 精确匹配，其次单级通配 "*.<domain>"，最后 "<service_id>.<ServiceDomain>"
+func (g *GatewayConfig) serviceFor(serverName string) (string, bool) {
+	host := strings.TrimSuffix(strings.ToLower(serverName), ".")
+	if host == "" {
+		return "", false
+	}
+	if serviceID, ok := g.Routes[host]; ok {
+		return serviceID, true
+	}
+	if _, parent, ok := strings.Cut(host, "."); ok {
+		if serviceID, ok := g.Routes["*."+parent]; ok {
+			return serviceID, true
+		}
+		if g.ServiceDomain != "" && strings.EqualFold(parent, strings.TrimSuffix(g.ServiceDomain, ".")) {
+			label, _, _ := strings.Cut(host, ".")
+			return label, true
+		}
+	}
+	return "", false
+}
+
+// newGateway 创建网关：服务器证书默认同 Controller，终端用户证书默认按控制平面信任集校验
+func (c *Controller) newGateway(keyPEM []byte) (*gateway, error) {
+	cfg := c.config.Gateway
+	tlsConfig := c.certManager.GetTLSConfig()
+	if cfg.CertFile != "" || cfg.hasCAs() {
+		managerConfig := &cert.Config{
+			CertFile:  c.config.CertFile,
+			KeyFile:   c.config.KeyFile,
+			CAFile:    c.config.CAFile,
+			CAFiles:   c.config.CAFiles,
+			CADirs:    c.config.CADirs,
+			KeyPEM:    keyPEM,
+			TLSPolicy: c.certManager.TLSPolicy(),
+		}
+		if cfg.CertFile != "" {
+			gatewayKey, err := cfg.Key.Resolve(context.Background())
+			if err != nil {
+				return nil, fmt.Errorf("failed to resolve gateway private key: %w", err)
+			}
+			managerConfig.CertFile, managerConfig.KeyFile, managerConfig.KeyPEM = cfg.CertFile, cfg.KeyFile, gatewayKey
+		}
+		if cfg.hasCAs() {
+			managerConfig.CAFile, managerConfig.CAFiles, managerConfig.CADirs = cfg.CAFile, cfg.CAFiles, cfg.CADirs
+		}
+		manager, err := cert.NewManager(managerConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load gateway certificates: %w", err)
+		}
+		tlsConfig = manager.GetTLSConfig()
+	}
+	// 终端用户以客户端证书标识身份，必须由受信任的 CA 签发
+	tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+
+	return &gateway{config: cfg, tlsConfig: tlsConfig, conns: make(map[net.Conn]struct{})}, nil
+}
+
+// startGateway starts the public gateway listener
+func (c *Controller) startGateway() {
+	ln, err := net.Listen("tcp", c.gateway.config.ListenAddr)
+	if err != nil {
+		c.logger.Error("Gateway listener error", "addr", c.gateway.config.ListenAddr, "error", err)
+		return
+	}
+	c.logger.Info("Starting gateway listener with mTLS", "addr", ln.Addr().String())
+	c.serveGateway(ln)
+}
+
+// serveGateway accepts user connections until the gateway is stopped
+func (c *Controller) serveGateway(ln net.Listener) {
+	g := c.gateway
+	g.mu.Lock()
+	if g.stopped {
+		g.mu.Unlock()
+		ln.Close()
+		return
+	}
+	g.listener = ln
+	g.mu.Unlock()
+
+	for {
+		raw, err := ln.Accept()
+		if err != nil {
+			g.mu.Lock()
+			stopped := g.stopped
+			g.mu.Unlock()
+			if stopped {
+				return
+			}
+			c.logger.Error("Gateway accept error", "error", err)
+			continue
+		}
+		if !g.track(raw) {
+			raw.Close()
+			return
+		}
+		go func() {
+			defer g.untrack(raw)
+			acceptedAt := time.Now()
+			conn := tls.Server(raw, g.tlsConfig)
+			defer conn.Close()
+
+			ctx, cancel := context.WithTimeout(c.ctx, g.config.HandshakeTimeout)
+			err := conn.HandshakeContext(ctx)
+			cancel()
+			if err != nil {
+				c.logger.Debug("Gateway TLS handshake failed", "remote_addr", raw.RemoteAddr().String(), "error", err)
+				return
+			}
+			if err := c.serveGatewayConn(conn, acceptedAt); err != nil && !errors.Is(err, errGatewayDenied) {
+				c.logger.Warn("Gateway connection failed", "remote_addr", raw.RemoteAddr().String(), "error", err)
+			}
+		}()
+	}
+}
+
+// serveGatewayConn 授权已完成 TLS 握手的用户连接，创建隧道并经中继转发到 AH，阻塞至连接结束
+func (c *Controller) serveGatewayConn(conn *tls.Conn, acceptedAt time.Time) error {
+	ctx := c.ctx
+	state := conn.ConnectionState()
+	sourceIP, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+
+	serviceID, ok := c.config.Gateway.serviceFor(state.ServerName)
+	if !ok {
+		return fmt.Errorf("no gateway route for server name %q", state.ServerName)
+	}
+	if len(state.PeerCertificates) == 0 {
+		return fmt.Errorf("no client certificate")
+	}
+	clientCert := state.PeerCertificates[0]
+	clientID := c.extractClientID(clientCert)
+	deny := func(reason string) error {
+		c.logger.Warn("Gateway access denied", "client_id", clientID, "service_id", serviceID, "reason", reason)
+		c.auditAccess(ctx, &logging.AccessEvent{
+			ClientID:  clientID,
+			ServiceID: serviceID,
+			SourceIP:  sourceIP,
+			Action:    "gateway_connect",
+			Result:    "denied",
+			Reason:    reason,
+		})
+		return errGatewayDenied
+	}
+
+	// Internal service identities must not reach services as end users
+	if cert.IsServiceCertificate(clientCert) {
+		return deny("internal service certificate")
+	}
+	if clientID == "" {
+		return deny("no client identity in certificate")
+	}
+	// Read-only mode: no certificate registration or new tunnels, as for handleTunnelCreate
+	if c.maintenance.status().Enabled {
+		return deny("controller in maintenance mode")
+	}
+	fingerprint := calculateFingerprint(clientCert)
+	if _, err := c.certRegistry.GetCertInfo(fingerprint); err == nil {
+		if err := c.certRegistry.Validate(fingerprint); err != nil {
+			return deny(err.Error())
+		}
+	}
+	if err := c.ensureCertRegistered(fingerprint, clientCert); err != nil {
+		return fmt.Errorf("certificate registration failed: %w", err)
+	}
+
+	serviceConfig, err := c.tunnelManager.GetServiceConfig(ctx, serviceID)
+	if err != nil {
+		return deny("service not found")
+	}
+	// The gateway terminates TLS and has no IH to receive keys or credentials
+	if serviceConfig.EndToEnd || serviceConfig.CredentialBroker != "" {
+		return deny("service requires an IH (end-to-end encryption or target credentials)")
+	}
+	if serviceConfig.IsPattern() {
+		return deny("pattern service requires an explicit target")
+	}
+	// RelayIH pairs on the local relay, the AH of a chained service waits on the last hop
+	if len(serviceConfig.RelayChain) > 0 {
+		return deny("service is reachable through a relay chain")
+	}
+	if unavailable := checkServiceAvailable(serviceConfig, time.Now()); unavailable != nil {
+		return deny(unavailable.message)
+	}
+
+	decision, err := c.policyEngine.EvaluateAccess(ctx, &policy.AccessRequest{
+		ClientID:  clientID,
+		ServiceID: serviceID,
+		SourceIP:  sourceIP,
+		Timestamp: time.Now(),
+	})
+	if err != nil {
+		return deny("policy evaluation failed")
+	}
+	if !decision.Allowed {
+		return deny(decision.Reason)
+	}
+	if decision.Constraints != nil && decision.Constraints.RequireE2E {
+		return deny("policy requires end-to-end encryption")
+	}
+	// The user's TLS connection is relayed as is and cannot be framed for obfuscation
+	if policyObfuscate(decision) {
+		return deny("policy requires traffic obfuscation")
+	}
+
+	if _, err := c.relayStatus(); err != nil {
+		return fmt.Errorf("data plane relay unavailable: %w", err)
+	}
+
+	tun, err := c.tunnelManager.CreateTunnel(ctx, &tunnel.CreateTunnelRequest{
+		ClientID:   clientID,
+		ServiceID:  serviceID,
+		Protocol:   "tcp",
+		ClientAddr: conn.RemoteAddr().String(),
+		QoSClass:   policyQoSClass(decision),
+		Metadata:   map[string]interface{}{metadataKeyGateway: true},
+	})
+	if err != nil {
+		return fmt.Errorf("tunnel creation failed: %w", err)
+	}
+	defer c.tunnelManager.DeleteTunnel(context.Background(), tun.ID)
+
+	c.logger.Info("Gateway tunnel created", "tunnel_id", tun.ID, "client_id", clientID, "service_id", serviceID, "server_name", state.ServerName)
+	details := map[string]interface{}{"tunnel_id": tun.ID, "server_name": state.ServerName}
+	if decision.Default {
+		details["policy_decision"] = decision.Reason
+	}
+	c.auditAccess(ctx, &logging.AccessEvent{
+		ClientID:  clientID,
+		ServiceID: serviceID,
+		SourceIP:  sourceIP,
+		Action:    "gateway_connect",
+		Result:    "success",
+		Details:   details,
+	})
+
+	c.notifyTunnelCreated(tun, serviceConfig)
+	return c.relayServer.RelayIH(conn, tun.ID, "gateway:"+clientID, acceptedAt)
+}
+
+// track 记录进行中的连接，网关已停止时返回 false
+func (g *gateway) track(conn net.Conn) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.stopped {
+		return false
+	}
+	g.conns[conn] = struct{}{}
+	g.wg.Add(1)
+	return true
+}
+
+func (g *gateway) untrack(conn net.Conn) {
+	g.mu.Lock()
+	delete(g.conns, conn)
+	g.mu.Unlock()
+	g.wg.Done()
+}
+
+// stop 停止接受连接，断开进行中的用户连接并等待其隧道清理完成
+func (g *gateway) stop() {
+	g.mu.Lock()
+	g.stopped = true
+	if g.listener != nil {
+		g.listener.Close()
+	}
+	for conn := range g.conns {
+		conn.Close()
+	}
+	g.mu.Unlock()
+	g.wg.Wait()
+}
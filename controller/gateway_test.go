@@ -0,0 +1,202 @@
+package controller
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/houzhh15/sdp-common/logging"
+	"github.com/houzhh15/sdp-common/policy"
+	"github.com/houzhh15/sdp-common/transport"
+	"github.com/houzhh15/sdp-common/tunnel"
+)
+
+func TestGatewayConfig_ServiceFor(t *testing.T) {
+	cfg := &GatewayConfig{
+		Routes: map[string]string{
+			"app.example.com":    "svc-app",
+			"*.db.example.com":   "svc-db",
+			"git.apps.corp.test": "svc-git",
+		},
+		ServiceDomain: "apps.corp.test",
+	}
+
+	cases := []struct {
+		serverName string
+		serviceID  string
+		ok         bool
+	}{
+		{"app.example.com", "svc-app", true},
+		{"APP.Example.com.", "svc-app", true},
+		{"eu.db.example.com", "svc-db", true},
+		{"a.eu.db.example.com", "", false}, // 通配只匹配一级
+		{"git.apps.corp.test", "svc-git", true},
+		{"wiki.apps.corp.test", "wiki", true},
+		{"x.wiki.apps.corp.test", "", false},
+		{"example.com", "", false},
+		{"", "", false},
+	}
+	for _, tc := range cases {
+		serviceID, ok := cfg.serviceFor(tc.serverName)
+		assert.Equal(t, tc.ok, ok, tc.serverName)
+		assert.Equal(t, tc.serviceID, serviceID, tc.serverName)
+	}
+}
+
+func TestGatewayConfig_Validate(t *testing.T) {
+	cfg := &GatewayConfig{ListenAddr: ":8443", ServiceDomain: "apps.corp.test"}
+	require.NoError(t, cfg.Validate())
+	assert.Equal(t, 10*time.Second, cfg.HandshakeTimeout)
+
+	invalid := []*GatewayConfig{
+		{ServiceDomain: "apps.corp.test"},
+		{ListenAddr: ":8443"},
+		{ListenAddr: ":8443", Routes: map[string]string{"app.*.com": "svc"}},
+		{ListenAddr: ":8443", Routes: map[string]string{"app.example.com": ""}},
+		{ListenAddr: ":8443", ServiceDomain: "apps.corp.test", CertFile: "gw.pem"},
+		{ListenAddr: ":8443", ServiceDomain: "apps.corp.test", HandshakeTimeout: -time.Second},
+	}
+	for i, cfg := range invalid {
+		assert.Error(t, cfg.Validate(), "case %d", i)
+	}
+
+	conflict := &Config{
+		CertFile:     "cert.pem",
+		KeyFile:      "key.pem",
+		CAFile:       "ca.pem",
+		HTTPAddr:     ":8443",
+		TCPProxyAddr: ":9443",
+		Gateway:      &GatewayConfig{ListenAddr: ":8443", ServiceDomain: "apps.corp.test"},
+	}
+	assert.ErrorContains(t, conflict.Validate(), "gateway")
+}
+
+func TestGateway_Relay(t *testing.T) {
+	pki := newInternalTestPKI(t)
+	serverCert, serverKey := pki.issue("controller", "")
+	aliceCert, aliceKey := pki.issue("alice", "")
+	bobCert, bobKey := pki.issue("bob", "")
+	ahCert, ahKey := pki.issue("ah-1", "")
+
+	cfg := &Config{Gateway: &GatewayConfig{
+		ListenAddr: "127.0.0.1:0",
+		Routes:     map[string]string{"app.example.com": "svc-1"},
+	}}
+	require.NoError(t, cfg.Gateway.Validate())
+	c := newAdminTestController(t, cfg)
+	c.ctx = context.Background()
+	c.certManager = pki.manager(serverCert, serverKey)
+	c.relayServer = transport.NewTunnelRelayServer(c.logger, nil)
+
+	ctx := context.Background()
+	require.NoError(t, c.tunnelManager.CreateServiceConfig(ctx, &tunnel.ServiceConfig{
+		ServiceID:  "svc-1",
+		TargetHost: "127.0.0.1",
+		TargetPort: 8080,
+	}))
+	require.NoError(t, c.policyEngine.SavePolicy(ctx, &policy.Policy{
+		PolicyID:   "p1",
+		ClientID:   "alice",
+		ServiceID:  "svc-1",
+		ExpiryTime: time.Now().Add(time.Hour),
+	}))
+
+	relayLn, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go c.relayServer.Serve(relayLn, c.certManager.GetTLSConfig())
+	t.Cleanup(func() { c.relayServer.Stop() })
+
+	c.gateway, err = c.newGateway(nil)
+	require.NoError(t, err)
+	gatewayLn, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go c.serveGateway(gatewayLn)
+	t.Cleanup(c.gateway.stop)
+
+	dial := func(certFile, keyFile, serverName string) net.Conn {
+		pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+		require.NoError(t, err)
+		conn, err := tls.Dial("tcp", gatewayLn.Addr().String(), &tls.Config{
+			ServerName:   serverName,
+			Certificates: []tls.Certificate{pair},
+			// 测试证书只含 IP SAN，不校验服务名
+			InsecureSkipVerify: true,
+		})
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+		return conn
+	}
+	// 被拒绝的连接由网关关闭
+	assertClosed := func(conn net.Conn) {
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, err := conn.Read(make([]byte, 1))
+		require.Error(t, err)
+		var netErr net.Error
+		assert.False(t, errors.As(err, &netErr) && netErr.Timeout(), "connection should be closed, got %v", err)
+	}
+
+	user := dial(aliceCert, aliceKey, "app.example.com")
+
+	var tunnelID string
+	require.Eventually(t, func() bool {
+		tunnels, err := c.tunnelManager.ListTunnels(ctx, &tunnel.TunnelFilter{ClientID: "alice"})
+		if err != nil || len(tunnels) != 1 {
+			return false
+		}
+		tunnelID = tunnels[0].ID
+		assert.Equal(t, "svc-1", tunnels[0].ServiceID)
+		assert.Equal(t, true, tunnels[0].Metadata[metadataKeyGateway])
+		return true
+	}, 2*time.Second, 10*time.Millisecond)
+
+	ahPair, err := tls.LoadX509KeyPair(ahCert, ahKey)
+	require.NoError(t, err)
+	ahTLS := &tls.Config{Certificates: []tls.Certificate{ahPair}, RootCAs: c.certManager.GetCAPool()}
+	ah, err := tunnel.NewDataPlaneClient(relayLn.Addr().String(), ahTLS).Connect(tunnelID)
+	require.NoError(t, err)
+	defer ah.Close()
+
+	_, err = user.Write([]byte("ping"))
+	require.NoError(t, err)
+	buf := make([]byte, 4)
+	ah.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, err = io.ReadFull(ah, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "ping", string(buf))
+
+	_, err = ah.Write([]byte("pong"))
+	require.NoError(t, err)
+	user.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, err = io.ReadFull(user, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "pong", string(buf))
+
+	// 用户断开后隧道随之删除
+	user.Close()
+	require.Eventually(t, func() bool {
+		_, err := c.tunnelManager.GetTunnel(ctx, tunnelID)
+		return err != nil
+	}, 2*time.Second, 10*time.Millisecond)
+
+	// 未配置的服务名与无策略的用户均被拒绝
+	assertClosed(dial(aliceCert, aliceKey, "other.example.com"))
+	assertClosed(dial(bobCert, bobKey, "app.example.com"))
+
+	// 维护模式下不新建隧道
+	c.maintenance.set(true, "upgrade", "root", time.Now())
+	assertClosed(dial(aliceCert, aliceKey, "app.example.com"))
+	c.maintenance.set(false, "", "root", time.Now())
+	events, err := c.auditLogger.Query(ctx, &logging.AuditFilter{ClientID: "alice", Action: "gateway_connect", Result: "denied"})
+	require.NoError(t, err)
+	assert.Len(t, events, 1)
+	tunnels, err := c.tunnelManager.ListTunnels(ctx, &tunnel.TunnelFilter{})
+	require.NoError(t, err)
+	assert.Empty(t, tunnels)
+}
@@ -2,12 +2,21 @@ package controller
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/houzhh15/sdp-common/policy"
+	"github.com/houzhh15/sdp-common/qos"
+	"github.com/houzhh15/sdp-common/session"
+	"github.com/houzhh15/sdp-common/tunnel"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // TestRespondErrorWithStatus tests the error response function with custom status codes
@@ -122,3 +131,413 @@ func TestTunnelResponse_Format(t *testing.T) {
 	assert.NotEmpty(t, mockResponse["controller_addr"])
 	assert.NotEmpty(t, mockResponse["expires_at"])
 }
+
+// TestTunnelCreate_RecordsClientAddr tests that the IH source address is stored for PROXY protocol
+func TestTunnelCreate_RecordsClientAddr(t *testing.T) {
+	c, token := newIdempotencyTestController(t)
+
+	w := postTunnel(c, token, "svc-1", "")
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	tun, err := c.tunnelManager.GetTunnel(context.Background(), tunnelIDFrom(t, w))
+	require.NoError(t, err)
+	assert.Equal(t, "192.0.2.1:1234", tun.Metadata[tunnel.MetadataKeyClientAddr])
+	assert.Equal(t, "192.0.2.1:1234", tun.ClientAddr().String())
+}
+
+// TestServiceConfig_InvalidProxyProtocol tests proxy_protocol validation on service creation
+func TestServiceConfig_InvalidProxyProtocol(t *testing.T) {
+	c, _ := newIdempotencyTestController(t)
+
+	err := c.tunnelManager.CreateServiceConfig(context.Background(), &tunnel.ServiceConfig{
+		ServiceID:     "svc-pp",
+		TargetHost:    "127.0.0.1",
+		TargetPort:    5432,
+		ProxyProtocol: "v1",
+	})
+	assert.Error(t, err)
+}
+
+// TestTunnelCreate_ControllerResolvesTarget tests DNS resolution on the Controller for ResolveOnController services
+func TestTunnelCreate_ControllerResolvesTarget(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newIdempotencyTestController(t)
+	c.tunnelManager.lookupIP = func(ctx context.Context, host string) ([]net.IP, error) {
+		if host != "db.internal" {
+			return nil, errors.New("no such host")
+		}
+		return []net.IP{net.ParseIP("2001:db8::5"), net.ParseIP("10.1.2.3")}, nil
+	}
+
+	// 禁止本地 DNS 的域名目标必须由 Controller 解析
+	err := c.tunnelManager.CreateServiceConfig(ctx, &tunnel.ServiceConfig{
+		ServiceID: "svc-dns", TargetHost: "db.internal", TargetPort: 5432, ForbidLocalDNS: true,
+	})
+	require.Error(t, err)
+
+	require.NoError(t, c.tunnelManager.CreateServiceConfig(ctx, &tunnel.ServiceConfig{
+		ServiceID: "svc-dns", TargetHost: "db.internal", TargetPort: 5432, ResolveOnController: true, ForbidLocalDNS: true,
+	}))
+	tun, err := c.tunnelManager.CreateTunnel(ctx, &tunnel.CreateTunnelRequest{ClientID: "ih-1", ServiceID: "svc-dns"})
+	require.NoError(t, err)
+	assert.Equal(t, "10.1.2.3", tun.Metadata[tunnel.MetadataKeyTargetIP], "IPv4 preferred")
+
+	// 解析失败时拒绝创建隧道
+	require.NoError(t, c.tunnelManager.CreateServiceConfig(ctx, &tunnel.ServiceConfig{
+		ServiceID: "svc-missing", TargetHost: "missing.internal", TargetPort: 80, ResolveOnController: true,
+	}))
+	_, err = c.tunnelManager.CreateTunnel(ctx, &tunnel.CreateTunnelRequest{ClientID: "ih-1", ServiceID: "svc-missing"})
+	assert.Error(t, err)
+}
+
+// TestTunnelCreate_DefaultDecision tests the default decision when no policy covers the service
+func TestTunnelCreate_DefaultDecision(t *testing.T) {
+	ctx := context.Background()
+	c := newAdminTestController(t, &Config{
+		TCPProxyAddr:          ":9443",
+		ServicePolicyDefaults: map[string]policy.DefaultDecision{"svc-open": policy.DefaultAllow},
+	})
+	for _, id := range []string{"svc-open", "svc-closed"} {
+		require.NoError(t, c.tunnelManager.CreateServiceConfig(ctx, &tunnel.ServiceConfig{ServiceID: id, TargetHost: "127.0.0.1", TargetPort: 8080}))
+	}
+	token := createTestSession(t, c, "bob", "user")
+
+	w := postTunnel(c, token, "svc-open", "")
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	w = postTunnel(c, token, "svc-closed", "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	decision, err := c.policyEngine.EvaluateAccess(ctx, &policy.AccessRequest{ClientID: "bob", ServiceID: "svc-closed"})
+	require.NoError(t, err)
+	assert.Equal(t, policy.ReasonDeniedByDefault, decision.Reason)
+
+	// 存在适用策略时不再按默认允许
+	require.NoError(t, c.policyEngine.SavePolicy(ctx, &policy.Policy{
+		PolicyID:   "p-open",
+		ClientID:   "bob",
+		ServiceID:  "svc-open",
+		ExpiryTime: time.Now().Add(time.Hour),
+		Conditions: []*policy.Condition{{Type: "device_compliance", Operator: "eq", Value: true}},
+	}))
+	w = postTunnel(c, token, "svc-open", "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	decision, err = c.policyEngine.EvaluateAccess(ctx, &policy.AccessRequest{ClientID: "bob", ServiceID: "svc-open"})
+	require.NoError(t, err)
+	assert.Equal(t, policy.ReasonDeniedByPolicy, decision.Reason)
+	assert.False(t, decision.Default)
+}
+
+func TestTunnelCreate_EmbedServiceInEvent(t *testing.T) {
+	for _, embed := range []bool{false, true} {
+		c, token := newIdempotencyTestController(t)
+		c.config.EmbedServiceInTunnelEvents = embed
+
+		recorder := httptest.NewRecorder()
+		done := make(chan struct{})
+		go func() {
+			c.tunnelNotifier.Subscribe("ah-1", recorder)
+			close(done)
+		}()
+		time.Sleep(50 * time.Millisecond)
+
+		require.Equal(t, http.StatusCreated, postTunnel(c, token, "svc-1", "").Code)
+		time.Sleep(50 * time.Millisecond)
+		c.tunnelNotifier.Unsubscribe("ah-1")
+		<-done
+
+		body := recorder.Body.String()
+		require.Contains(t, body, "event: tunnel\n")
+		if embed {
+			assert.Contains(t, body, `"service":{"service_id":"svc-1"`)
+			assert.Contains(t, body, `"target_host":"127.0.0.1","target_port":8080`)
+		} else {
+			assert.NotContains(t, body, `"service":`)
+		}
+	}
+}
+
+func TestDataPlaneDiscovery(t *testing.T) {
+	c, token := newIdempotencyTestController(t)
+
+	get := func() *tunnel.DataPlaneInfo {
+		w := httptest.NewRecorder()
+		c.handleDataPlane(w, httptest.NewRequest(http.MethodGet, "/api/v1/dataplane", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		var info tunnel.DataPlaneInfo
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &info))
+		return &info
+	}
+
+	// 默认通告 TCPProxyAddr
+	info := get()
+	assert.Equal(t, []string{"localhost:9443"}, info.Addrs)
+	assert.True(t, info.Ready)
+
+	c.config.DataPlaneAdvertiseAddrs = []string{"relay-a.example.com:9443", "relay-b.example.com:9443"}
+	assert.Equal(t, c.config.DataPlaneAdvertiseAddrs, get().Addrs)
+
+	w := postTunnel(c, token, "svc-1", "")
+	require.Equal(t, http.StatusCreated, w.Code)
+	var resp struct {
+		ControllerAddr string   `json:"controller_addr"`
+		DataPlaneAddrs []string `json:"dataplane_addrs"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "relay-a.example.com:9443", resp.ControllerAddr)
+	assert.Equal(t, c.config.DataPlaneAdvertiseAddrs, resp.DataPlaneAddrs)
+
+	// 中继不可用时仍返回地址，Ready 为 false
+	c.relayReady = newRelayReadiness()
+	assert.False(t, get().Ready)
+}
+
+func TestConfigValidate_DataPlaneAdvertiseAddrs(t *testing.T) {
+	cfg := &Config{
+		CertFile: "c", KeyFile: "k", CAFile: "ca", HTTPAddr: ":8443", TCPProxyAddr: ":9443",
+		DataPlaneAdvertiseAddrs: []string{"relay.example.com"},
+	}
+	assert.ErrorContains(t, cfg.Validate(), "invalid data plane advertise address")
+
+	cfg.DataPlaneAdvertiseAddrs = []string{"relay.example.com:9443"}
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestTunnelCreate_DisabledCapabilities(t *testing.T) {
+	c, token := newIdempotencyTestController(t)
+	c.config.Capabilities = tunnel.Capabilities{tunnel.CapabilityEventReplay}
+
+	key, err := tunnel.GenerateE2EKey()
+	require.NoError(t, err)
+
+	post := func(fields map[string]interface{}) *httptest.ResponseRecorder {
+		fields["session_token"] = token
+		fields["service_id"] = "svc-1"
+		body, _ := json.Marshal(fields)
+		w := httptest.NewRecorder()
+		c.handleTunnelCreate(w, httptest.NewRequest(http.MethodPost, "/api/v1/tunnels", bytes.NewReader(body)))
+		return w
+	}
+
+	// 多路复用降级为普通隧道，响应如实报告
+	w := post(map[string]interface{}{"multiplex": true})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var resp struct {
+		Multiplex bool `json:"multiplex"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.False(t, resp.Multiplex)
+
+	// E2E 不能静默降级
+	w = post(map[string]interface{}{"e2e_public_key": key.PublicKey()})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "CAPABILITY_UNSUPPORTED")
+}
+
+func TestTunnelCreate_RelayChain(t *testing.T) {
+	ctx := context.Background()
+	c, legacyToken := newIdempotencyTestController(t)
+	chain := []string{"dmz-relay.example.com:9443", "internal-relay.corp:9443"}
+
+	err := c.tunnelManager.CreateServiceConfig(ctx, &tunnel.ServiceConfig{
+		ServiceID: "svc-chain", TargetHost: "10.0.0.5", TargetPort: 22, RelayChain: chain[:1],
+	})
+	assert.ErrorContains(t, err, "relay_chain")
+	require.NoError(t, c.tunnelManager.CreateServiceConfig(ctx, &tunnel.ServiceConfig{
+		ServiceID: "svc-chain", TargetHost: "10.0.0.5", TargetPort: 22, RelayChain: chain,
+	}))
+	require.NoError(t, c.policyEngine.SavePolicy(ctx, &policy.Policy{
+		PolicyID: "p-chain", ClientID: "alice", ServiceID: "svc-chain", ExpiryTime: time.Now().Add(time.Hour),
+	}))
+
+	// 未通告 relay_chain 能力的客户端无法发送多跳握手
+	w := postTunnel(c, legacyToken, "svc-chain", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "CAPABILITY_UNSUPPORTED")
+
+	sess, err := c.sessionManager.CreateSession(ctx, &session.CreateSessionRequest{
+		ClientID: "alice",
+		Metadata: map[string]interface{}{sessionMetadataCapabilities: []string(tunnel.DefaultCapabilities())},
+	})
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		c.tunnelNotifier.Subscribe("ah-1", recorder)
+		close(done)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	w = postTunnel(c, sess.Token, "svc-chain", "")
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var resp struct {
+		ControllerAddr string   `json:"controller_addr"`
+		DataPlaneAddrs []string `json:"dataplane_addrs"`
+		RelayChain     []string `json:"relay_chain"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, chain, resp.RelayChain)
+	assert.Equal(t, chain[0], resp.ControllerAddr, "IH connects to the first hop")
+	assert.Equal(t, chain[:1], resp.DataPlaneAddrs)
+
+	tun, err := c.tunnelManager.GetTunnel(ctx, tunnelIDFrom(t, w))
+	require.NoError(t, err)
+	assert.Equal(t, chain, tun.RelayChain())
+
+	// AH 连接最后一跳
+	time.Sleep(50 * time.Millisecond)
+	c.tunnelNotifier.Unsubscribe("ah-1")
+	<-done
+	assert.Contains(t, recorder.Body.String(), `"controller_addr":"internal-relay.corp:9443"`)
+
+	// 普通服务的响应不含中继链
+	w = postTunnel(c, sess.Token, "svc-1", "")
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.NotContains(t, w.Body.String(), "relay_chain")
+}
+
+func TestTunnelCreate_QoSClass(t *testing.T) {
+	ctx := context.Background()
+	c, aliceToken := newIdempotencyTestController(t)
+
+	err := c.tunnelManager.CreateServiceConfig(ctx, &tunnel.ServiceConfig{
+		ServiceID: "svc-qos", TargetHost: "10.0.0.5", TargetPort: 5060, QoSClass: "platinum",
+	})
+	assert.ErrorContains(t, err, "QoS class")
+	require.NoError(t, c.tunnelManager.CreateServiceConfig(ctx, &tunnel.ServiceConfig{
+		ServiceID: "svc-qos", TargetHost: "10.0.0.5", TargetPort: 5060, QoSClass: qos.ClassInteractive,
+	}))
+	require.NoError(t, c.policyEngine.SavePolicy(ctx, &policy.Policy{
+		PolicyID: "p-qos-alice", ClientID: "alice", ServiceID: "svc-qos", ExpiryTime: time.Now().Add(time.Hour),
+	}))
+	assert.ErrorContains(t, c.policyEngine.SavePolicy(ctx, &policy.Policy{
+		PolicyID: "p-qos-bob", ClientID: "bob", ServiceID: "svc-qos", ExpiryTime: time.Now().Add(time.Hour), QoSClass: "gold",
+	}), "QoS class")
+	require.NoError(t, c.policyEngine.SavePolicy(ctx, &policy.Policy{
+		PolicyID: "p-qos-bob", ClientID: "bob", ServiceID: "svc-qos", ExpiryTime: time.Now().Add(time.Hour), QoSClass: qos.ClassRealtime,
+	}))
+	bobToken := createTestSession(t, c, "bob", "user")
+
+	tests := []struct {
+		token string
+		want  string
+	}{
+		{aliceToken, qos.ClassInteractive}, // 服务配置的等级
+		{bobToken, qos.ClassRealtime},      // 策略覆盖
+	}
+	for _, tt := range tests {
+		w := postTunnel(c, tt.token, "svc-qos", "")
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var resp struct {
+			QoSClass string `json:"qos_class"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, tt.want, resp.QoSClass)
+
+		tun, err := c.tunnelManager.GetTunnel(ctx, tunnelIDFrom(t, w))
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, tun.QoSClass())
+	}
+
+	// 未设置服务等级的服务不标记
+	w := postTunnel(c, aliceToken, "svc-1", "")
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.NotContains(t, w.Body.String(), "qos_class")
+}
+
+func TestTunnelCreate_ReverseForward(t *testing.T) {
+	ctx := context.Background()
+	c, aliceToken := newIdempotencyTestController(t)
+	require.NoError(t, c.policyEngine.SavePolicy(ctx, &policy.Policy{
+		PolicyID: "p-rev-bob", ClientID: "bob", ServiceID: "svc-1", ExpiryTime: time.Now().Add(time.Hour), ReverseForward: true,
+	}))
+	bobToken := createTestSession(t, c, "bob", "user")
+
+	post := func(token, bindAddr string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]interface{}{
+			"session_token":   token,
+			"service_id":      "svc-1",
+			"reverse_forward": bindAddr,
+		})
+		w := httptest.NewRecorder()
+		c.handleTunnelCreate(w, httptest.NewRequest(http.MethodPost, "/api/v1/tunnels", bytes.NewReader(body)))
+		return w
+	}
+
+	// 策略未显式允许
+	w := post(aliceToken, "localhost:9000")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "POLICY_DENIED")
+
+	w = post(bobToken, "example.com:9000")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "INVALID_REQUEST")
+
+	w = post(bobToken, "localhost:9000")
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var resp struct {
+		Multiplex      bool   `json:"multiplex"`
+		ReverseForward string `json:"reverse_forward"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.True(t, resp.Multiplex, "reverse forwards always use a multiplexed tunnel")
+	assert.Equal(t, "localhost:9000", resp.ReverseForward)
+
+	tun, err := c.tunnelManager.GetTunnel(ctx, tunnelIDFrom(t, w))
+	require.NoError(t, err)
+	assert.True(t, tun.IsMultiplexed())
+	assert.Equal(t, "localhost:9000", tun.ReverseForwardAddr())
+
+	// 普通隧道不回显
+	w = postTunnel(c, bobToken, "svc-1", "")
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.NotContains(t, w.Body.String(), "reverse_forward")
+
+	// Controller 关闭该特性
+	c.config.Capabilities = tunnel.Capabilities{tunnel.CapabilityMux}
+	w = post(bobToken, "localhost:9000")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "CAPABILITY_UNSUPPORTED")
+}
+
+func TestTunnelCreate_Obfuscate(t *testing.T) {
+	ctx := context.Background()
+	c, aliceToken := newIdempotencyTestController(t)
+	require.NoError(t, c.policyEngine.SavePolicy(ctx, &policy.Policy{
+		PolicyID: "p-obf-bob", ClientID: "bob", ServiceID: "svc-1", ExpiryTime: time.Now().Add(time.Hour), Obfuscate: true,
+	}))
+
+	// 未通告 obfuscate 能力的客户端无法按混淆帧格式收发数据
+	legacyToken := createTestSession(t, c, "bob", "user")
+	w := postTunnel(c, legacyToken, "svc-1", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "CAPABILITY_UNSUPPORTED")
+
+	sess, err := c.sessionManager.CreateSession(ctx, &session.CreateSessionRequest{
+		ClientID: "bob",
+		Metadata: map[string]interface{}{sessionMetadataCapabilities: []string(tunnel.DefaultCapabilities())},
+	})
+	require.NoError(t, err)
+	w = postTunnel(c, sess.Token, "svc-1", "")
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var resp struct {
+		Obfuscate bool `json:"obfuscate"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.True(t, resp.Obfuscate)
+
+	tun, err := c.tunnelManager.GetTunnel(ctx, tunnelIDFrom(t, w))
+	require.NoError(t, err)
+	assert.True(t, tun.IsObfuscated())
+
+	// 策略未要求时不启用
+	w = postTunnel(c, aliceToken, "svc-1", "")
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.NotContains(t, w.Body.String(), "obfuscate")
+
+	// Controller 关闭该特性时不静默降级
+	c.config.Capabilities = tunnel.Capabilities{tunnel.CapabilityMux}
+	w = postTunnel(c, sess.Token, "svc-1", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "CAPABILITY_UNSUPPORTED")
+}
@@ -1,16 +1,26 @@
 package controller
 
 import (
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"strings"
 	"time"
 
+	"github.com/houzhh15/sdp-common/auth"
+	"github.com/houzhh15/sdp-common/cert"
+	"github.com/houzhh15/sdp-common/clock"
+	"github.com/houzhh15/sdp-common/device"
+	"github.com/houzhh15/sdp-common/logging"
 	"github.com/houzhh15/sdp-common/policy"
 	"github.com/houzhh15/sdp-common/protocol"
 	"github.com/houzhh15/sdp-common/session"
+	"github.com/houzhh15/sdp-common/transport"
 	"github.com/houzhh15/sdp-common/tunnel"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
@@ -18,30 +28,67 @@ import (
 // This implements the complete SDP 2.0 specification REST API
 func (c *Controller) registerHandlers() {
 	// Health check endpoint
-	c.mux.HandleFunc("/health", c.handleHealth)
+	c.handle(nil, "/health", http.HandlerFunc(c.handleHealth))
+	// Readiness: data plane relay listening and database reachable
+	c.handle(nil, "/readyz", http.HandlerFunc(c.handleReadyz))
 
-	// Metrics endpoint for Prometheus
-	c.mux.Handle("/metrics", promhttp.Handler())
+	// Metrics endpoint for Prometheus (OpenMetrics when requested via Accept, carrying trace_id exemplars)
+	c.handle(nil, "/metrics", promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer,
+		promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: true})))
 
-	// Session management endpoints
-	c.mux.HandleFunc("/api/v1/handshake", c.handleHandshake)
-	c.mux.HandleFunc("/api/v1/sessions/refresh", c.handleSessionRefresh)
-	c.mux.HandleFunc("/api/v1/sessions/", c.handleSessionRevoke)
+	// Versioned API endpoints: /api/v1/..., /api/v2/... and /api/... (Accept-Version negotiation)
+	// All versions share the same handlers; version-specific differences go through VersionShim
+
+	// Auth endpoints (canonical, used by auth.Client)
+	c.handleVersioned("/api/{version}/auth/handshake", c.handleHandshake)
+	c.handleVersioned("/api/{version}/auth/refresh", c.handleSessionRefresh)
+	c.handleVersioned("/api/{version}/auth/revoke", c.handleAuthRevoke)
+	c.handleVersioned("/api/{version}/auth/transfer", c.handleSessionTransfer)
+	c.handleVersioned("/api/{version}/auth/transfer/redeem", c.handleSessionTransferRedeem)
+	c.handleVersioned(postureReportPattern, c.handleSessionPosture)
+
+	// Legacy aliases of the auth endpoints
+	c.handleVersioned("/api/{version}/handshake", c.handleHandshake)
+	c.handleVersioned("/api/{version}/sessions/refresh", c.handleSessionRefresh)
+	c.handleVersioned("/api/{version}/sessions/", c.handleSessionRevoke)
+
+	// Client certificate rotation (mTLS with the current certificate)
+	c.handleVersioned("/api/{version}/certs/rotate", c.handleCertRotate)
 
 	// Policy endpoints
-	c.mux.HandleFunc("/api/v1/policies", c.handlePolicies)
+	c.handleVersioned("/api/{version}/policies", c.handlePolicies)
 
 	// Service configuration endpoints (SDP 2.0 0x04)
-	c.mux.HandleFunc("/api/v1/services", c.handleServicesList)
-	c.mux.HandleFunc("/api/v1/services/", c.handleServicesGet)
+	c.handleVersioned("/api/{version}/services", c.handleServicesList)
+	c.handleVersioned("/api/{version}/services/", c.handleServicesGet)
+	c.handleVersioned("/api/{version}/services/register", c.handleServicesRegister)
+
+	// Data plane address discovery
+	c.handleVersioned("/api/{version}/dataplane", c.handleDataPlane)
 
 	// Tunnel management endpoints
-	c.mux.HandleFunc("/api/v1/tunnels", c.handleTunnels)
-	c.mux.HandleFunc("/api/v1/tunnels/stats", c.handleTunnelStats)
-	c.mux.HandleFunc("/api/v1/tunnels/", c.handleTunnelDelete)
+	c.handleVersioned("/api/{version}/tunnels", c.handleTunnels)
+	c.handleVersioned("/api/{version}/tunnels/stats", c.handleTunnelStats)
+	c.handleVersioned("/api/{version}/tunnels/reconcile", c.handleTunnelReconcile)
+	c.handleVersioned("/api/{version}/tunnels/e2e-key", c.handleTunnelE2EKey)
+	c.handleVersioned("/api/{version}/tunnels/", c.handleTunnelDelete)
+
+	// Client SDK telemetry (opt-in usage statistics)
+	c.handleVersioned("/api/{version}/telemetry", c.handleTelemetry)
+
+	// SSE subscription endpoints (AH stream: tunnel.Subscriber default path and legacy agent path)
+	c.handleVersioned("/api/{version}/events/subscribe", c.handleTunnelEventsSSE)
+	c.handleVersioned("/{version}/agent/tunnels/stream", c.handleTunnelEventsSSE)
+	if c.config != nil && c.config.AgentStreamPath != "" {
+		c.handle([]ListenerRole{ListenerRoleAgent}, c.config.AgentStreamPath, http.HandlerFunc(c.handleTunnelEventsSSE))
+	}
+	c.handleVersioned("/api/{version}/client/events/stream", c.handleClientEventsSSE)
+
+	// Persistent event journal for polling consumers (admin sessions only)
+	c.handleVersioned("/api/{version}/events", c.requireAdmin(c.handleEventJournal))
 
-	// SSE subscription endpoints
-	c.mux.HandleFunc("/v1/agent/tunnels/stream", c.handleTunnelEventsSSE)
+	// Admin endpoints (RBAC) and optional embedded dashboard
+	c.registerAdminHandlers()
 }
 
 // handleHealth handles health check requests
@@ -53,6 +100,7 @@ func (c *Controller) handleHealth(w http.ResponseWriter, r *http.Request) {
 // handleHandshake handles client handshake requests
 func (c *Controller) handleHandshake(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
+	defer observeDuration(ctx, handshakeDuration, time.Now())
 
 	// Extract client certificate
 	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
@@ -65,35 +113,101 @@ func (c *Controller) handleHandshake(w http.ResponseWriter, r *http.Request) {
 
 	c.logger.Info("Handshake request received", "fingerprint", fingerprint)
 
-	// Validate certificate
-	if err := c.certRegistry.Validate(fingerprint); err != nil {
-		// If not registered, register it
-		clientID := fmt.Sprintf("client-%d", time.Now().Unix())
-		if err := c.certRegistry.Register(clientID, fingerprint, clientCert); err != nil {
-			c.logger.Error("Failed to register certificate", "error", err)
-			respondError(w, "INVALID_CERT", "Certificate registration failed", nil)
-			return
-		}
+	// Internal service identities (replicas, relay nodes) must not obtain end-user sessions
+	if cert.IsServiceCertificate(clientCert) {
+		c.logger.Warn("Handshake rejected: internal service certificate", "fingerprint", fingerprint)
+		respondErrorWithStatus(w, "INVALID_CERT", "Internal service certificates cannot be used for client sessions", nil, http.StatusForbidden)
+		return
 	}
 
-	clientID := extractClientID(clientCert)
+	// Map certificate fields to the client identity (Config.IdentityClaims)
+	claims, err := c.identityClaims(clientCert)
+	if err != nil {
+		c.logger.Warn("Handshake rejected: no client identity", "fingerprint", fingerprint, "error", err)
+		respondErrorWithStatus(w, "INVALID_CERT", "Certificate does not carry the configured client identity", nil, http.StatusForbidden)
+		return
+	}
+
+	// Parse optional request body (auth.HandshakeRequest); cert-only clients send none
+	var req auth.HandshakeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		respondErrorWithStatus(w, "INVALID_REQUEST", "Invalid request body", nil, http.StatusBadRequest)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		respondErrorWithStatus(w, "INVALID_REQUEST", err.Error(), nil, http.StatusBadRequest)
+		return
+	}
+	if req.CertFingerprint != "" && req.CertFingerprint != fingerprint {
+		c.logger.Warn("Handshake rejected: fingerprint mismatch", "fingerprint", fingerprint, "claimed", req.CertFingerprint)
+		respondErrorWithStatus(w, "INVALID_CERT", "cert_fingerprint does not match the client certificate", nil, http.StatusBadRequest)
+		return
+	}
+	deviceInfo := handshakeDeviceInfo(&req.DeviceInfo)
+
+	// Detect other active certificates claiming the same identity (CN)
+	_, lookupErr := c.certRegistry.GetCertInfo(fingerprint)
+	conflicts, reject := c.checkIdentityConflict(r, clientCert, fingerprint, lookupErr == nil, "")
+	if reject {
+		c.auditAccess(ctx, &logging.AccessEvent{
+			ClientID: claims.ClientID,
+			SourceIP: transport.ClientIPFromRequest(r),
+			Action:   "handshake",
+			Result:   "denied",
+			Reason:   "identity conflict",
+		})
+		respondErrorWithStatus(w, "IDENTITY_CONFLICT", "Another certificate is already registered for this identity", nil, http.StatusForbidden)
+		return
+	}
+
+	if err := c.ensureCertRegistered(fingerprint, clientCert); err != nil {
+		respondError(w, "INVALID_CERT", "Certificate registration failed", nil)
+		return
+	}
+
+	clientID := claims.ClientID
 
 	// Optional: Evaluate access to a demo service
-	_, err := c.policyEngine.EvaluateAccess(ctx, &policy.AccessRequest{
-		ClientID:  clientID,
-		ServiceID: "demo-service-001",
-		Timestamp: time.Now(),
+	_, err = c.policyEngine.EvaluateAccess(ctx, &policy.AccessRequest{
+		ClientID:   clientID,
+		ServiceID:  "demo-service-001",
+		DeviceInfo: deviceInfo,
+		SourceIP:   transport.ClientIPFromRequest(r),
+		Timestamp:  time.Now(),
 	})
 	if err != nil {
 		c.logger.Warn("Policy evaluation warning", "client_id", clientID, "error", err)
 	}
 
-	// Create session
+	// Create session (flagged when the identity is shared by other certificates)
+	metadata := map[string]interface{}{"source_ip": transport.ClientIPFromRequest(r)}
+	if req.Capabilities.Advertised() {
+		metadata[sessionMetadataCapabilities] = []string(req.Capabilities)
+	}
+	if len(conflicts) > 0 {
+		metadata["identity_conflict"] = true
+		metadata["conflicting_fingerprints"] = conflicts
+	}
 	sess, err := c.sessionManager.CreateSession(ctx, &session.CreateSessionRequest{
 		ClientID:        clientID,
 		CertFingerprint: fingerprint,
-		Metadata:        map[string]interface{}{"source_ip": r.RemoteAddr},
+		DeviceInfo:      deviceInfo,
+		ClientClass:     claims.ClientClass,
+		Tenant:          claims.Tenant,
+		Metadata:        metadata,
 	})
+	if errors.Is(err, session.ErrSessionLimitReached) {
+		c.logger.Warn("Session rejected by concurrency policy", "client_id", clientID)
+		c.auditAccess(ctx, &logging.AccessEvent{
+			ClientID: clientID,
+			SourceIP: transport.ClientIPFromRequest(r),
+			Action:   "handshake",
+			Result:   "denied",
+			Reason:   "session limit reached",
+		})
+		respondErrorWithStatus(w, "SESSION_LIMIT_REACHED", "Client already has an active session", nil, http.StatusConflict)
+		return
+	}
 	if err != nil {
 		c.logger.Error("Failed to create session", "error", err)
 		respondError(w, "UNAUTHORIZED", "Session creation failed", nil)
@@ -101,6 +215,12 @@ func (c *Controller) handleHandshake(w http.ResponseWriter, r *http.Request) {
 	}
 
 	c.logger.Info("Session created", "client_id", sess.ClientID, "token", sess.Token[:16]+"...")
+	c.auditAccess(ctx, &logging.AccessEvent{
+		ClientID: sess.ClientID,
+		SourceIP: transport.ClientIPFromRequest(r),
+		Action:   "handshake",
+		Result:   "success",
+	})
 
 	// Return session token
 	w.Header().Set("Content-Type", "application/json")
@@ -108,11 +228,39 @@ func (c *Controller) handleHandshake(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"type":          protocol.MsgTypeHandshakeResp,
 		"status":        "success",
-		"session_token": sess.Token,
+		"token":         sess.Token,
+		"session_token": sess.Token, // legacy field name
 		"expires_at":    sess.ExpiresAt.Format(time.RFC3339),
+		"server_time":   c.serverTime(),
+
+		"dataplane_addrs": c.dataPlaneAddrs(),
+		"capabilities":    c.capabilities(),
 	})
 }
 
+// ensureCertRegistered validates the client certificate, registering it on first use, and records it as seen
+func (c *Controller) ensureCertRegistered(fingerprint string, clientCert *x509.Certificate) error {
+	if err := c.certRegistry.Validate(fingerprint); err != nil {
+		// If not registered, register it
+		clientID := fmt.Sprintf("client-%d", time.Now().Unix())
+		if err := c.certRegistry.RegisterWithIdentity(clientID, c.extractClientID(clientCert), fingerprint, clientCert); err != nil {
+			c.logger.Error("Failed to register certificate", "error", err)
+			return err
+		}
+	}
+	c.touchCert(fingerprint)
+	return nil
+}
+
+// handshakeDeviceInfo returns the device info to store on the session (nil when not supplied).
+// The same device.Info is used for policy evaluation, including hostname and custom attributes
+func handshakeDeviceInfo(d *device.Info) *device.Info {
+	if d == nil || d.IsZero() {
+		return nil
+	}
+	return d.Clone()
+}
+
 // handleSessionRefresh handles session refresh requests
 func (c *Controller) handleSessionRefresh(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -130,34 +278,91 @@ func (c *Controller) handleSessionRefresh(w http.ResponseWriter, r *http.Request
 	sess, err := c.sessionManager.RefreshSession(ctx, token)
 	if err != nil {
 		c.logger.Warn("Session refresh failed", "error", err)
+		if errors.Is(err, session.ErrSessionLifetimeExceeded) {
+			respondErrorWithStatus(w, "SESSION_LIFETIME_EXCEEDED", "Session lifetime exceeded, re-handshake required",
+				map[string]interface{}{"error_code": protocol.ErrCodeSessionLifetimeExceeded}, http.StatusUnauthorized)
+			return
+		}
 		respondError(w, "ERROR", "Session refresh failed", nil)
 		return
 	}
 
 	c.logger.Info("Session refreshed", "client_id", sess.ClientID)
+	c.notifySessionRefreshed(sess.ClientID, sess.ExpiresAt)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"status":        "success",
-		"session_token": sess.Token,
+		"token":         sess.Token,
+		"session_token": sess.Token, // legacy field name
 		"expires_at":    sess.ExpiresAt.Format(time.RFC3339),
+		"server_time":   c.serverTime(),
 	})
 }
 
-// handleSessionRevoke handles session revoke requests
+// serverTime returns the Controller's current time for handshake/refresh responses,
+// letting clients measure their clock skew against expires_at
+func (c *Controller) serverTime() string {
+	return clock.Or(c.config.Clock).Now().UTC().Format(time.RFC3339Nano)
+}
+
+// touchCert records the certificate's last seen time, coalesced by certTouch when batching is enabled
+func (c *Controller) touchCert(fingerprint string) {
+	if c.certTouch != nil {
+		c.certTouch.Add(fingerprint, clock.Or(c.config.Clock).Now())
+		return
+	}
+	if err := c.certRegistry.Touch(fingerprint); err != nil {
+		c.logger.Warn("Failed to record certificate last seen", "fingerprint", fingerprint, "error", err)
+	}
+}
+
+// sseSubscribeOptions reads the Last-Event-ID header and heartbeat query parameter of an SSE request
+func sseSubscribeOptions(r *http.Request) *tunnel.SubscribeOptions {
+	return &tunnel.SubscribeOptions{
+		LastEventID:  r.Header.Get("Last-Event-ID"),
+		Heartbeat:    tunnel.ParseHeartbeat(r.URL.Query().Get(tunnel.HeartbeatParam)),
+		Capabilities: tunnel.ParseCapabilities(r.Header.Get(tunnel.CapabilitiesHeader)),
+	}
+}
+
+// handleAuthRevoke handles session revoke requests (POST, token from Authorization header)
+func (c *Controller) handleAuthRevoke(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := extractBearerToken(r)
+	if token == "" {
+		respondError(w, "ERROR", "Missing authorization token", nil)
+		return
+	}
+	c.revokeSession(w, r, token)
+}
+
+// handleSessionRevoke handles legacy session revoke requests (DELETE /sessions/{token})
 func (c *Controller) handleSessionRevoke(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodDelete {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	ctx := r.Context()
-	token := strings.TrimPrefix(r.URL.Path, "/api/v1/sessions/")
+	token := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
 	if token == "" {
 		respondError(w, "ERROR", "Missing session token", nil)
 		return
 	}
+	c.revokeSession(w, r, token)
+}
+
+// revokeSession revokes a session and notifies the owning client's event stream
+func (c *Controller) revokeSession(w http.ResponseWriter, r *http.Request, token string) {
+	ctx := r.Context()
+
+	// 撤销前取出所属客户端，用于通知其事件流
+	sess, _ := c.sessionManager.ValidateSession(ctx, token)
 
 	err := c.sessionManager.RevokeSession(ctx, token)
 	if err != nil {
@@ -165,8 +370,11 @@ func (c *Controller) handleSessionRevoke(w http.ResponseWriter, r *http.Request)
 		respondError(w, "ERROR", "Session not found", nil)
 		return
 	}
+	if sess != nil {
+		c.notifySessionRevoked(sess.ClientID, token, "")
+	}
 
-	c.logger.Info("Session revoked", "token", token[:16]+"...")
+	c.logger.Info("Session revoked", "token", maskToken(token))
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -222,12 +430,18 @@ func (c *Controller) handleServicesList(w http.ResponseWriter, r *http.Request)
 	}
 
 	ctx := r.Context()
+	// 须在读取数据之前获取版本，避免并发变更时 ETag 描述的内容比响应体更新
+	etag, modified := c.tunnelManager.ServicesVersion()
 	configs, err := c.tunnelManager.ListServiceConfigs(ctx, "")
 	if err != nil {
 		c.logger.Error("Failed to list service configs", "error", err)
 		respondError(w, "ERROR", "Failed to retrieve service configs", nil)
 		return
 	}
+	// AH 周期轮询时服务列表通常未变化，If-None-Match 命中返回 304
+	if checkNotModified(w, r, etag, modified) {
+		return
+	}
 
 	c.logger.Info("Service configs listed", "count", len(configs))
 
@@ -240,9 +454,10 @@ func (c *Controller) handleServicesList(w http.ResponseWriter, r *http.Request)
 	})
 }
 
-// handleServicesGet handles single service configuration get requests
+// handleServicesGet handles single service configuration get requests,
+// and unregistration (DELETE) by the agent that registered the service
 func (c *Controller) handleServicesGet(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
+	if r.Method != http.MethodGet && r.Method != http.MethodDelete {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
@@ -253,13 +468,21 @@ func (c *Controller) handleServicesGet(w http.ResponseWriter, r *http.Request) {
 		respondError(w, "ERROR", "Service ID is required", nil)
 		return
 	}
+	if r.Method == http.MethodDelete {
+		c.handleServiceUnregister(w, r, serviceID)
+		return
+	}
 
+	etag, modified := c.tunnelManager.ServicesVersion()
 	config, err := c.tunnelManager.GetServiceConfig(ctx, serviceID)
 	if err != nil {
 		c.logger.Warn("Service config not found", "service_id", serviceID, "error", err)
 		respondError(w, "ERROR", fmt.Sprintf("Service not found: %s", serviceID), nil)
 		return
 	}
+	if checkNotModified(w, r, etag, modified) {
+		return
+	}
 
 	c.logger.Info("Service config retrieved", "service_id", serviceID)
 
@@ -291,11 +514,18 @@ func (c *Controller) handleTunnels(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		tunnels, err := c.tunnelManager.ListTunnels(ctx, &tunnel.TunnelFilter{ClientID: sess.ClientID})
+		etag, modified := c.tunnelManager.TunnelsVersion()
+		tunnels, err := c.tunnelManager.ListTunnels(ctx, &tunnel.TunnelFilter{
+			ClientID:      sess.ClientID,
+			IncludeFailed: r.URL.Query().Get("include_failed") == "true",
+		})
 		if err != nil {
 			respondError(w, "ERROR", "Failed to retrieve tunnels", nil)
 			return
 		}
+		if checkNotModified(w, r, etag, modified) {
+			return
+		}
 
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
@@ -312,11 +542,22 @@ func (c *Controller) handleTunnels(w http.ResponseWriter, r *http.Request) {
 // handleTunnelCreate handles tunnel creation requests
 func (c *Controller) handleTunnelCreate(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
+	defer observeDuration(ctx, tunnelCreateDuration, time.Now())
 
 	var req struct {
 		SessionToken string `json:"session_token"`
 		ServiceID    string `json:"service_id"`
 		Protocol     string `json:"protocol"`
+		TargetHost   string `json:"target_host,omitempty"` // 模式化服务的具体目标
+		TargetPort   int    `json:"target_port,omitempty"`
+		Multiplex    bool   `json:"multiplex,omitempty"` // 单连接多路复用模式
+		TTL          int64  `json:"ttl,omitempty"`       // 隧道有效期（秒），0 表示不过期
+		// IdempotencyKey 幂等键（也可用 Idempotency-Key 请求头），TTL 内重试返回原隧道
+		IdempotencyKey string `json:"idempotency_key,omitempty"`
+		// E2EPublicKey IH 的端到端加密公钥（base64 X25519），非空时隧道启用 E2E
+		E2EPublicKey string `json:"e2e_public_key,omitempty"`
+		// ReverseForward 反向转发的 AH 监听地址（host:port），须由匹配策略允许
+		ReverseForward string `json:"reverse_forward,omitempty"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -324,6 +565,15 @@ func (c *Controller) handleTunnelCreate(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	idempotencyKey := r.Header.Get(headerIdempotencyKey)
+	if idempotencyKey == "" {
+		idempotencyKey = req.IdempotencyKey
+	}
+	if len(idempotencyKey) > maxIdempotencyKeyLen {
+		respondErrorWithStatus(w, "INVALID_REQUEST", "Idempotency key too long", nil, http.StatusBadRequest)
+		return
+	}
+
 	// Validate session token
 	sess, err := c.sessionManager.ValidateSession(ctx, req.SessionToken)
 	if err != nil {
@@ -331,25 +581,152 @@ func (c *Controller) handleTunnelCreate(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// Without a listening relay the IH/AH connections can never pair
+	if _, err := c.relayStatus(); err != nil {
+		c.logger.Warn("Tunnel creation rejected: data plane relay unavailable", "client_id", sess.ClientID, "error", err)
+		w.Header().Set("Retry-After", "5")
+		respondErrorWithStatus(w, "RELAY_UNAVAILABLE", "Data plane relay is not available", nil, http.StatusServiceUnavailable)
+		return
+	}
+
+	// Idempotent replay: return the original tunnel instead of creating a duplicate
+	var createdTunnelID string
+	if idempotencyKey != "" && c.idempotency != nil {
+		fingerprint := fmt.Sprintf("%s|%s|%s|%d|%t|%d|%s|%s", req.ServiceID, req.Protocol, req.TargetHost, req.TargetPort, req.Multiplex, req.TTL, req.E2EPublicKey, req.ReverseForward)
+		for {
+			entry, owner, err := c.idempotency.Acquire(sess.ClientID, idempotencyKey, fingerprint)
+			if err != nil {
+				respondErrorWithStatus(w, "IDEMPOTENCY_KEY_MISMATCH", err.Error(), nil, http.StatusUnprocessableEntity)
+				return
+			}
+			if owner {
+				// 创建失败（createdTunnelID 为空）时释放幂等键，允许重试
+				defer func() { c.idempotency.Complete(sess.ClientID, idempotencyKey, entry, createdTunnelID) }()
+				break
+			}
+
+			tun, err := c.tunnelManager.GetTunnel(ctx, entry.tunnelID)
+			if err != nil || tun.Status == tunnel.TunnelStatusFailed {
+				// 原隧道已删除或未能配对，幂等键失效后按新请求处理
+				c.idempotency.Forget(sess.ClientID, idempotencyKey, entry)
+				continue
+			}
+
+			c.logger.Info("Tunnel creation replayed", "tunnel_id", tun.ID, "client_id", sess.ClientID)
+			w.Header().Set(headerIdempotentReplayed, "true")
+			c.respondTunnelCreated(w, tun)
+			return
+		}
+	}
+
 	// Query service configuration to verify service exists
-	_, err = c.tunnelManager.GetServiceConfig(ctx, req.ServiceID)
+	serviceConfig, err := c.tunnelManager.GetServiceConfig(ctx, req.ServiceID)
 	if err != nil {
 		c.logger.Warn("Service not found", "service_id", req.ServiceID, "error", err)
 		respondErrorWithStatus(w, "SERVICE_NOT_FOUND", fmt.Sprintf("Service not found: %s", req.ServiceID), nil, http.StatusNotFound)
 		return
 	}
 
+	// Services under maintenance or disabled reject new tunnels; existing tunnels keep running
+	now := clock.Or(c.config.Clock).Now()
+	if unavailable := checkServiceAvailable(serviceConfig, now); unavailable != nil {
+		c.logger.Warn("Tunnel creation rejected: service unavailable", "client_id", sess.ClientID, "service_id", req.ServiceID, "code", unavailable.code)
+		unavailable.respond(w, now)
+		return
+	}
+
+	// Validate requested destination against the service pattern (CIDR + port set)
+	if _, _, err := serviceConfig.ResolveTarget(req.TargetHost, req.TargetPort); err != nil {
+		c.logger.Warn("Invalid tunnel target", "service_id", req.ServiceID, "target_host", req.TargetHost, "target_port", req.TargetPort, "error", err)
+		respondErrorWithStatus(w, "INVALID_TARGET", err.Error(), nil, http.StatusBadRequest)
+		return
+	}
+	if req.ReverseForward != "" {
+		if err := tunnel.ValidateReverseForwardAddr(req.ReverseForward); err != nil {
+			respondErrorWithStatus(w, "INVALID_REQUEST", err.Error(), nil, http.StatusBadRequest)
+			return
+		}
+	}
+
 	// Evaluate policy
 	decision, err := c.policyEngine.EvaluateAccess(ctx, &policy.AccessRequest{
-		ClientID:  sess.ClientID,
-		ServiceID: req.ServiceID,
-		Timestamp: time.Now(),
+		ClientID:   sess.ClientID,
+		ServiceID:  req.ServiceID,
+		DeviceInfo: sess.DeviceInfo,
+		SourceIP:   transport.ClientIPFromRequest(r),
+		Timestamp:  time.Now(),
 	})
 	if err != nil || !decision.Allowed {
-		c.logger.Warn("Access denied", "client_id", sess.ClientID, "service_id", req.ServiceID)
+		// "denied by default" (no policy for the service) vs "denied by policy" (conditions not met)
+		reason := "policy evaluation failed"
+		if err == nil {
+			reason = decision.Reason
+		}
+		c.logger.Warn("Access denied", "client_id", sess.ClientID, "service_id", req.ServiceID, "reason", reason)
+		c.auditAccess(ctx, &logging.AccessEvent{
+			ClientID:  sess.ClientID,
+			ServiceID: req.ServiceID,
+			SourceIP:  transport.ClientIPFromRequest(r),
+			Action:    "tunnel_create",
+			Result:    "denied",
+			Reason:    reason,
+		})
 		respondErrorWithStatus(w, "POLICY_DENIED", "Access denied by policy", nil, http.StatusForbidden)
 		return
 	}
+	// Reverse forwards expose a listener on the AH host, so the matched policy must allow them explicitly
+	if req.ReverseForward != "" && (decision.Constraints == nil || !decision.Constraints.ReverseForward) {
+		c.logger.Warn("Reverse forward denied", "client_id", sess.ClientID, "service_id", req.ServiceID, "bind_addr", req.ReverseForward)
+		c.auditAccess(ctx, &logging.AccessEvent{
+			ClientID:  sess.ClientID,
+			ServiceID: req.ServiceID,
+			SourceIP:  transport.ClientIPFromRequest(r),
+			Action:    "tunnel_create",
+			Result:    "denied",
+			Reason:    "reverse forward not allowed by policy",
+			Details:   map[string]interface{}{"reverse_forward": req.ReverseForward},
+		})
+		respondErrorWithStatus(w, "POLICY_DENIED", "Reverse forwarding is not allowed by policy", nil, http.StatusForbidden)
+		return
+	}
+
+	// Features disabled on this Controller: multiplexing degrades to a plain tunnel
+	// (the response reports multiplex=false), E2E cannot be downgraded silently
+	if req.Multiplex && !c.capabilities().Has(tunnel.CapabilityMux) {
+		c.logger.Info("Multiplexing disabled, creating plain tunnel", "client_id", sess.ClientID, "service_id", req.ServiceID)
+		req.Multiplex = false
+	}
+	if req.E2EPublicKey != "" && !c.capabilities().Has(tunnel.CapabilityE2E) {
+		respondErrorWithStatus(w, "CAPABILITY_UNSUPPORTED", "End-to-end encryption is disabled on this controller", nil, http.StatusBadRequest)
+		return
+	}
+	// Reverse forwards run over a multiplexed tunnel: the AH opens a stream per accepted connection
+	if req.ReverseForward != "" && !(c.capabilities().Has(tunnel.CapabilityReverseForward) && c.capabilities().Has(tunnel.CapabilityMux)) {
+		respondErrorWithStatus(w, "CAPABILITY_UNSUPPORTED", "Reverse forwarding is disabled on this controller", nil, http.StatusBadRequest)
+		return
+	}
+	// Chained services can only be reached by clients that send the multi-hop handshake
+	if len(serviceConfig.RelayChain) > 0 && !sessionCapabilities(sess).Supports(tunnel.CapabilityRelayChain) {
+		respondErrorWithStatus(w, "CAPABILITY_UNSUPPORTED", "Service is reachable through a relay chain, which this client does not support", nil, http.StatusBadRequest)
+		return
+	}
+	// Obfuscation changes the data plane framing and cannot be downgraded silently
+	obfuscate := policyObfuscate(decision)
+	if obfuscate && !(c.capabilities().Has(tunnel.CapabilityObfuscate) && sessionCapabilities(sess).Supports(tunnel.CapabilityObfuscate)) {
+		respondErrorWithStatus(w, "CAPABILITY_UNSUPPORTED", "Policy requires traffic obfuscation, which this client or controller does not support", nil, http.StatusBadRequest)
+		return
+	}
+
+	// End-to-end encryption: required by the service or the matched policy
+	if req.E2EPublicKey != "" {
+		if _, err := tunnel.ParseE2EPublicKey(req.E2EPublicKey); err != nil {
+			respondErrorWithStatus(w, "INVALID_REQUEST", err.Error(), nil, http.StatusBadRequest)
+			return
+		}
+	} else if serviceConfig.EndToEnd || (decision.Constraints != nil && decision.Constraints.RequireE2E) {
+		respondErrorWithStatus(w, "E2E_REQUIRED", "End-to-end encryption is required for this service", nil, http.StatusBadRequest)
+		return
+	}
 
 	// Create tunnel
 	tun, err := c.tunnelManager.CreateTunnel(ctx, &tunnel.CreateTunnelRequest{
@@ -357,6 +734,17 @@ func (c *Controller) handleTunnelCreate(w http.ResponseWriter, r *http.Request)
 		ClientID:     sess.ClientID,
 		ServiceID:    req.ServiceID,
 		Protocol:     req.Protocol,
+		TargetHost:   req.TargetHost,
+		TargetPort:   req.TargetPort,
+		Multiplex:    req.Multiplex,
+		TTL:          req.TTL,
+		ClientAddr:   transport.ClientAddrFromRequest(r),
+		E2EPublicKey: req.E2EPublicKey,
+		QoSClass:     policyQoSClass(decision),
+		TraceID:      traceIDFromContext(ctx),
+
+		ReverseForward: req.ReverseForward,
+		Obfuscate:      obfuscate,
 	})
 	if err != nil {
 		c.logger.Error("Failed to create tunnel", "error", err)
@@ -364,35 +752,185 @@ func (c *Controller) handleTunnelCreate(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// Ephemeral target credentials (delivered to the IH only, never to the AH or the relay)
+	credential, err := c.mintTunnelCredential(ctx, tun, serviceConfig)
+	if err != nil {
+		c.logger.Error("Failed to mint tunnel credential", "tunnel_id", tun.ID, "service_id", req.ServiceID, "error", err)
+		c.tunnelManager.DeleteTunnel(ctx, tun.ID)
+		respondErrorWithStatus(w, "CREDENTIAL_UNAVAILABLE", "Failed to issue target credentials", nil, http.StatusBadGateway)
+		return
+	}
+
+	createdTunnelID = tun.ID
+
 	c.logger.Info("Tunnel created", "tunnel_id", tun.ID, "client_id", sess.ClientID)
+	details := map[string]interface{}{"tunnel_id": tun.ID}
+	if credential != nil {
+		details["credential_id"] = credential.CredentialID
+	}
+	if decision.Default {
+		details["policy_decision"] = decision.Reason
+	}
+	if req.ReverseForward != "" {
+		details["reverse_forward"] = req.ReverseForward
+	}
+	if obfuscate {
+		details["obfuscate"] = true
+	}
+	c.auditAccess(ctx, &logging.AccessEvent{
+		ClientID:  sess.ClientID,
+		ServiceID: req.ServiceID,
+		SourceIP:  transport.ClientIPFromRequest(r),
+		Action:    "tunnel_create",
+		Result:    "success",
+		Details:   details,
+	})
 
-	// Extract controller address (remove https:// prefix if present)
-	controllerAddr := c.config.TCPProxyAddr
-	if controllerAddr[0] == ':' {
-		// If only port is specified, use localhost
-		controllerAddr = "localhost" + controllerAddr
+	c.notifyTunnelCreated(tun, serviceConfig)
+	c.respondTunnelCreated(w, tun)
+}
+
+// policyQoSClass returns the DSCP class set by the matched policy; empty lets the service's class apply
+func policyQoSClass(decision *policy.AccessDecision) string {
+	if decision == nil || decision.Constraints == nil {
+		return ""
 	}
+	return decision.Constraints.QoSClass
+}
 
-	// Notify AH agents with controller data plane address
+// policyObfuscate reports whether the matched policy requires traffic obfuscation
+func policyObfuscate(decision *policy.AccessDecision) bool {
+	return decision != nil && decision.Constraints != nil && decision.Constraints.Obfuscate
+}
+
+// notifyTunnelCreated notifies AH agents of a new tunnel with the controller data plane address.
+// For a chained tunnel the AH connects to the last hop of the relay chain
+func (c *Controller) notifyTunnelCreated(tun *tunnel.Tunnel, serviceConfig *tunnel.ServiceConfig) {
+	controllerAddr, dataPlaneAddrs := c.controllerDataPlaneAddr(), c.dataPlaneAddrs()
+	if chain := tun.RelayChain(); len(chain) > 0 {
+		controllerAddr = chain[len(chain)-1]
+		dataPlaneAddrs = []string{controllerAddr}
+	}
 	event := &tunnel.TunnelEvent{
 		Type:      tunnel.EventTypeCreated,
 		Tunnel:    tun,
 		Timestamp: time.Now(),
 		Details: map[string]interface{}{
 			"controller_addr": controllerAddr, // 添加 Controller 数据平面地址
+			"dataplane_addrs": dataPlaneAddrs,
 		},
 	}
+	if c.config.EmbedServiceInTunnelEvents {
+		event.Service = serviceConfig.EventSnapshot()
+	}
 	c.tunnelNotifier.Notify(event)
+}
+
+// controllerDataPlaneAddr returns the preferred data plane address handed to IH/AH
+func (c *Controller) controllerDataPlaneAddr() string {
+	if addrs := c.dataPlaneAddrs(); len(addrs) > 0 {
+		return addrs[0]
+	}
+	return ""
+}
+
+// capabilities returns the optional features advertised by this Controller
+func (c *Controller) capabilities() tunnel.Capabilities {
+	if c.config.Capabilities == nil {
+		return tunnel.DefaultCapabilities()
+	}
+	return c.config.Capabilities
+}
+
+// sessionMetadataCapabilities session metadata key holding the capabilities from the handshake request
+const sessionMetadataCapabilities = "capabilities"
+
+// sessionCapabilities returns the capabilities the client advertised in its handshake;
+// nil when it did not advertise (see tunnel.Capabilities.Supports)
+func sessionCapabilities(sess *session.Session) tunnel.Capabilities {
+	switch v := sess.Metadata[sessionMetadataCapabilities].(type) {
+	case []string:
+		return v
+	case []interface{}: // decoded from the session store
+		caps := tunnel.Capabilities{}
+		for _, name := range v {
+			if s, ok := name.(string); ok {
+				caps = append(caps, s)
+			}
+		}
+		return caps
+	}
+	return nil
+}
+
+// dataPlaneAddrs returns the advertised data plane addresses in order of preference
+func (c *Controller) dataPlaneAddrs() []string {
+	if len(c.config.DataPlaneAdvertiseAddrs) > 0 {
+		return c.config.DataPlaneAdvertiseAddrs
+	}
+	// Extract controller address (remove https:// prefix if present)
+	controllerAddr := c.config.TCPProxyAddr
+	if controllerAddr == "" {
+		return nil
+	}
+	if controllerAddr[0] == ':' {
+		// If only port is specified, use localhost
+		controllerAddr = "localhost" + controllerAddr
+	}
+	return []string{controllerAddr}
+}
 
+// handleDataPlane advertises the data plane addresses so clients need not hard-code them
+func (c *Controller) handleDataPlane(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	_, err := c.relayStatus()
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	json.NewEncoder(w).Encode(&tunnel.DataPlaneInfo{
+		Addrs: c.dataPlaneAddrs(),
+		Ready: err == nil,
+	})
+}
+
+// respondTunnelCreated sends the tunnel creation response (also used for idempotent replays)
+func (c *Controller) respondTunnelCreated(w http.ResponseWriter, tun *tunnel.Tunnel) {
+	resp := map[string]interface{}{
 		"type":            "tunnel_response",
 		"status":          "success",
 		"tunnel_id":       tun.ID,
-		"controller_addr": controllerAddr,
+		"controller_addr": c.controllerDataPlaneAddr(),
+		"dataplane_addrs": c.dataPlaneAddrs(),
+		"multiplex":       tun.IsMultiplexed(),
+		"end_to_end":      tun.IsEndToEnd(),
 		"expires_at":      tun.ExpiresAt.Format(time.RFC3339),
-	})
+	}
+	if credential := c.tunnelCredential(tun.ID); credential != nil {
+		resp["credentials"] = credential
+	}
+	if class := tun.QoSClass(); class != "" {
+		// The IH marks its data plane connections with the same DSCP as the relay
+		resp["qos_class"] = class
+	}
+	if tun.IsObfuscated() {
+		// Both peers frame the data plane connection with ObfuscatedConn
+		resp["obfuscate"] = true
+	}
+	if addr := tun.ReverseForwardAddr(); addr != "" {
+		// The IH accepts the streams the AH opens for connections to this address
+		resp["reverse_forward"] = addr
+	}
+	if chain := tun.RelayChain(); len(chain) > 0 {
+		// The IH connects to the first hop with ConnectChain
+		resp["relay_chain"] = chain
+		resp["controller_addr"] = chain[0]
+		resp["dataplane_addrs"] = []string{chain[0]}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(resp)
 }
 
 // handleTunnelDelete handles tunnel deletion requests
@@ -427,6 +965,7 @@ func (c *Controller) handleTunnelDelete(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	c.revokeTunnelCredential(ctx, tunnelID)
 	c.logger.Info("Tunnel deleted", "tunnel_id", tunnelID)
 
 	w.Header().Set("Content-Type", "application/json")
@@ -475,8 +1014,9 @@ func (c *Controller) handleTunnelStats(w http.ResponseWriter, r *http.Request) {
 			"pending_ih": stats.PendingIH,
 			"pending_ah": stats.PendingAH,
 		},
-		"error_count": stats.ErrorCount,
-		"timestamp":   time.Now().Format(time.RFC3339),
+		"error_count":   stats.ErrorCount,
+		"close_reasons": stats.CloseReasons,
+		"timestamp":     time.Now().Format(time.RFC3339),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -493,6 +1033,10 @@ func (c *Controller) handleTunnelStats(w http.ResponseWriter, r *http.Request) {
 // Supports agent_id and agent_type query parameters as per design doc 3.2.2
 func (c *Controller) handleTunnelEventsSSE(w http.ResponseWriter, r *http.Request) {
 	agentID := r.URL.Query().Get("agent_id")
+	if agentID == "" {
+		// Older Subscribers identify themselves with client_id
+		agentID = r.URL.Query().Get("client_id")
+	}
 	agentType := r.URL.Query().Get("agent_type") // "ih" or "ah"
 
 	if agentID == "" {
@@ -505,10 +1049,22 @@ func (c *Controller) handleTunnelEventsSSE(w http.ResponseWriter, r *http.Reques
 	c.logger.Info("SSE connection request",
 		"agent_id", agentID,
 		"agent_type", agentType,
-		"client", r.RemoteAddr)
+		"client", transport.ClientIPFromRequest(r))
+
+	if agentType == "ah" {
+		details := map[string]interface{}{"agent_id": agentID, "client_ip": transport.ClientIPFromRequest(r)}
+		c.recordOpsEvent(OpsAgentConnected, "agent", OpsSeverityInfo, "Agent subscribed to events", details)
+		defer c.recordOpsEvent(OpsAgentDisconnected, "agent", OpsSeverityInfo, "Agent event stream closed", details)
+	}
 
-	if err := c.tunnelNotifier.Subscribe(agentID, w); err != nil {
+	// Last-Event-ID: replay journaled events missed while disconnected (also across Controller restarts);
+	// heartbeat: interval requested by the subscriber, clamped by the notifier
+	if err := c.tunnelNotifier.SubscribeWith(agentID, sseSubscribeOptions(r), w); err != nil {
 		c.logger.Error("Failed to subscribe", "error", err)
+		if errors.Is(err, tunnel.ErrReservedAgentID) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		http.Error(w, "Subscription failed", http.StatusInternalServerError)
 		return
 	}
@@ -0,0 +1,226 @@
+package controller
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/houzhh15/sdp-common/auth"
+	"github.com/houzhh15/sdp-common/logging"
+	"github.com/houzhh15/sdp-common/session"
+	"github.com/houzhh15/sdp-common/tunnel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func handshakeWithCert(c *Controller, clientCert *x509.Certificate, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/handshake", strings.NewReader(body))
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{clientCert}}
+	w := httptest.NewRecorder()
+	c.handleHandshake(w, req)
+	return w
+}
+
+func TestHandshake_DeviceInfo(t *testing.T) {
+	pki := newInternalTestPKI(t)
+	clientCert := pki.manager(pki.issue("alice", "")).GetX509Certificate()
+	fingerprint := calculateFingerprint(clientCert)
+	c := newAdminTestController(t, &Config{})
+	adminToken := createTestSession(t, c, "root", "admin")
+
+	// 请求体非法或设备信息校验失败
+	assert.Equal(t, http.StatusBadRequest, handshakeWithCert(c, clientCert, `{"device_info":`).Code)
+	assert.Equal(t, http.StatusBadRequest, handshakeWithCert(c, clientCert, `{"device_info":{"os":"linux"}}`).Code)
+	assert.Equal(t, http.StatusBadRequest, handshakeWithCert(c, clientCert, `{"cert_fingerprint":"sha256:other"}`).Code)
+
+	body := `{"cert_fingerprint":"` + fingerprint + `","device_info":{"device_id":"laptop-1","os":"linux","os_version":"6.1","hostname":"alice-laptop","compliance":true,"attributes":{"disk_encrypted":"true"}}}`
+	w := handshakeWithCert(c, clientCert, body)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var resp struct {
+		SessionToken string `json:"session_token"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	sess, err := c.sessionManager.ValidateSession(t.Context(), resp.SessionToken)
+	require.NoError(t, err)
+	require.NotNil(t, sess.DeviceInfo)
+	assert.Equal(t, "laptop-1", sess.DeviceInfo.DeviceID)
+	assert.Equal(t, "true", sess.DeviceInfo.Attributes["disk_encrypted"])
+
+	// 会话保存的设备信息直接用于策略评估，主机名与自定义属性不再丢失
+	assert.Equal(t, "linux", sess.DeviceInfo.OS)
+	assert.Equal(t, "alice-laptop", sess.DeviceInfo.Hostname)
+	assert.True(t, sess.DeviceInfo.Compliance)
+
+	// 管理接口会话列表包含设备信息
+	var listing struct {
+		Sessions []struct {
+			ClientID   string              `json:"client_id"`
+			DeviceInfo *session.DeviceInfo `json:"device_info"`
+		} `json:"sessions"`
+	}
+	w = adminGet(c, "/api/v1/admin/sessions", adminToken)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &listing))
+	found := false
+	for _, s := range listing.Sessions {
+		if s.ClientID == "alice" {
+			found = true
+			require.NotNil(t, s.DeviceInfo)
+			assert.Equal(t, "6.1", s.DeviceInfo.OSVersion)
+		}
+	}
+	assert.True(t, found)
+
+	// 仅证书握手（无请求体）仍然可用
+	assert.Equal(t, http.StatusOK, handshakeWithCert(c, clientCert, "").Code)
+}
+
+func TestAuthClient_CanonicalAndLegacyPaths(t *testing.T) {
+	pki := newInternalTestPKI(t)
+	serverCert, serverKey := pki.issue("controller", "")
+	clientManager := pki.manager(pki.issue("alice", ""))
+	c := newAdminTestController(t, &Config{})
+	c.mux = http.NewServeMux()
+	c.registerHandlers()
+
+	server := httptest.NewUnstartedServer(c.mux)
+	server.TLS = pki.manager(serverCert, serverKey).GetTLSConfig()
+	server.StartTLS()
+	defer server.Close()
+
+	// auth.Client 默认使用 /api/v1/auth/*
+	client := auth.NewClient(&auth.Config{
+		ControllerURL:   server.URL,
+		TLSConfig:       clientManager.GetTLSConfig(),
+		CertFingerprint: clientManager.GetFingerprint(),
+	})
+	defer client.Stop()
+
+	ctx := context.Background()
+	resp, err := client.Handshake(ctx, auth.DeviceInfo{DeviceID: "laptop-1", OS: "linux"}, "", "")
+	require.NoError(t, err)
+	require.NotEmpty(t, resp.Token)
+	assert.False(t, resp.ExpiresAt.IsZero())
+	assert.False(t, resp.ServerTime.IsZero(), "handshake response carries server_time")
+	assert.Less(t, client.ClockSkew().Abs(), time.Second)
+
+	refreshed, err := client.Refresh(ctx)
+	require.NoError(t, err)
+	assert.NotEmpty(t, refreshed.Token)
+	assert.False(t, refreshed.ServerTime.IsZero(), "refresh response carries server_time")
+
+	require.NoError(t, client.Revoke(ctx))
+	_, err = c.sessionManager.ValidateSession(ctx, refreshed.Token)
+	assert.Error(t, err)
+
+	// 旧路径仍可用（别名）
+	legacy := auth.NewClient(&auth.Config{
+		ControllerURL:   server.URL,
+		TLSConfig:       clientManager.GetTLSConfig(),
+		CertFingerprint: clientManager.GetFingerprint(),
+		Endpoints:       auth.Endpoints{Handshake: "/api/v1/handshake", Refresh: "/api/v1/sessions/refresh"},
+	})
+	defer legacy.Stop()
+	_, err = legacy.Handshake(ctx, auth.DeviceInfo{}, "", "")
+	require.NoError(t, err)
+	_, err = legacy.Refresh(ctx)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/v1/sessions/"+legacy.GetToken(), nil)
+	w := httptest.NewRecorder()
+	c.mux.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+}
+
+func TestHandshake_Capabilities(t *testing.T) {
+	pki := newInternalTestPKI(t)
+	clientCert := pki.manager(pki.issue("alice", "")).GetX509Certificate()
+	c := newAdminTestController(t, &Config{})
+
+	w := handshakeWithCert(c, clientCert, `{"capabilities":["mux","ws_events"]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var resp auth.HandshakeResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, tunnel.DefaultCapabilities(), resp.Capabilities)
+
+	sess, err := c.sessionManager.ValidateSession(t.Context(), resp.Token)
+	require.NoError(t, err)
+	assert.Equal(t, tunnel.Capabilities{"mux", "ws_events"}, sessionCapabilities(sess))
+
+	// 未通告能力的旧客户端
+	w = handshakeWithCert(c, clientCert, "")
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	sess, err = c.sessionManager.ValidateSession(t.Context(), resp.Token)
+	require.NoError(t, err)
+	assert.Nil(t, sessionCapabilities(sess))
+
+	// 配置的能力集合覆盖默认值
+	c.config.Capabilities = tunnel.Capabilities{tunnel.CapabilityEventReplay}
+	w = handshakeWithCert(c, clientCert, "")
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, tunnel.Capabilities{tunnel.CapabilityEventReplay}, resp.Capabilities)
+}
+
+func TestHandshake_SessionConcurrency(t *testing.T) {
+	pki := newInternalTestPKI(t)
+	clientCert := pki.manager(pki.issue("alice", "")).GetX509Certificate()
+	token := func(w *httptest.ResponseRecorder) string {
+		var resp struct {
+			SessionToken string `json:"session_token"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp.SessionToken
+	}
+
+	t.Run("revoke-oldest", func(t *testing.T) {
+		c := newAdminTestController(t, &Config{SessionConcurrency: session.ConcurrencyRevokeOldest})
+		c.sessionManager = session.NewManager(&session.Config{
+			Concurrency:        c.config.SessionConcurrency,
+			OnForcedRevocation: c.onForcedRevocation,
+		}, c.logger)
+		t.Cleanup(func() { c.sessionManager.Close() })
+
+		w := handshakeWithCert(c, clientCert, "")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		first := token(w)
+		w = handshakeWithCert(c, clientCert, "")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		second := token(w)
+
+		_, err := c.sessionManager.ValidateSession(t.Context(), first)
+		assert.Error(t, err, "re-handshake must revoke the previous session")
+		_, err = c.sessionManager.ValidateSession(t.Context(), second)
+		assert.NoError(t, err)
+
+		logs, err := c.auditLogger.Query(t.Context(), &logging.AuditFilter{EventType: logging.EventSessionRevoked})
+		require.NoError(t, err)
+		require.Len(t, logs, 1)
+		assert.Equal(t, session.RevokeReasonSessionLimit, logs[0].Data.(*logging.SecurityEvent).Details["reason"])
+	})
+
+	t.Run("reject-new", func(t *testing.T) {
+		c := newAdminTestController(t, &Config{})
+		c.sessionManager = session.NewManager(&session.Config{Concurrency: session.ConcurrencyRejectNew}, c.logger)
+		t.Cleanup(func() { c.sessionManager.Close() })
+
+		w := handshakeWithCert(c, clientCert, "")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		first := token(w)
+
+		w = handshakeWithCert(c, clientCert, "")
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Contains(t, w.Body.String(), "SESSION_LIMIT_REACHED")
+
+		// 登出后可重新握手
+		require.NoError(t, c.sessionManager.RevokeSession(t.Context(), first))
+		assert.Equal(t, http.StatusOK, handshakeWithCert(c, clientCert, "").Code)
+	})
+}
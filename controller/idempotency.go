@@ -0,0 +1,124 @@
+package controller
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// headerIdempotencyKey 隧道创建幂等键请求头（也可通过请求体 idempotency_key 传递）
+	headerIdempotencyKey = "Idempotency-Key"
+	// headerIdempotentReplayed 重放响应标记头
+	headerIdempotentReplayed = "Idempotent-Replayed"
+
+	// defaultIdempotencyTTL 幂等键默认保留时间
+	defaultIdempotencyTTL = 10 * time.Minute
+	// maxIdempotencyKeyLen 幂等键最大长度
+	maxIdempotencyKeyLen = 255
+)
+
+// errIdempotencyKeyMismatch 同一幂等键被用于参数不同的请求
+var errIdempotencyKeyMismatch = errors.New("idempotency key reused with different request parameters")
+
+// idempotencyEntry 一个幂等键对应的隧道创建结果
+type idempotencyEntry struct {
+	fingerprint string        // 请求参数摘要（service/target/protocol/multiplex）
+	tunnelID    string        // 创建成功后的隧道 ID
+	done        chan struct{} // 创建完成（成功或失败）时关闭
+	expiresAt   time.Time
+}
+
+// idempotencyCache 按客户端保存最近的幂等键
+// 同一键的并发请求只有第一个执行创建，其余等待其结果
+type idempotencyCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]*idempotencyEntry // key: clientID + "\x00" + idempotency key
+}
+
+// newIdempotencyCache 创建幂等键缓存
+func newIdempotencyCache(ttl time.Duration) *idempotencyCache {
+	if ttl <= 0 {
+		ttl = defaultIdempotencyTTL
+	}
+	return &idempotencyCache{
+		ttl:     ttl,
+		entries: make(map[string]*idempotencyEntry),
+	}
+}
+
+// Acquire 查询或占用幂等键
+// owner 为 true 时调用方负责创建隧道并调用 Complete；否则 entry 为已完成的原始结果
+func (c *idempotencyCache) Acquire(clientID, key, fingerprint string) (entry *idempotencyEntry, owner bool, err error) {
+	cacheKey := clientID + "\x00" + key
+
+	for {
+		c.mu.Lock()
+		now := time.Now()
+		c.pruneLocked(now)
+
+		entry, ok := c.entries[cacheKey]
+		if !ok {
+			entry = &idempotencyEntry{
+				fingerprint: fingerprint,
+				done:        make(chan struct{}),
+				expiresAt:   now.Add(c.ttl),
+			}
+			c.entries[cacheKey] = entry
+			c.mu.Unlock()
+			return entry, true, nil
+		}
+		c.mu.Unlock()
+
+		if entry.fingerprint != fingerprint {
+			return nil, false, errIdempotencyKeyMismatch
+		}
+
+		<-entry.done
+		if entry.tunnelID != "" {
+			return entry, false, nil
+		}
+		// 原请求创建失败且已释放键，重新竞争
+	}
+}
+
+// Complete 记录创建结果；tunnelID 为空表示创建失败，释放该键以便重试
+func (c *idempotencyCache) Complete(clientID, key string, entry *idempotencyEntry, tunnelID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry.tunnelID = tunnelID
+	if tunnelID == "" {
+		cacheKey := clientID + "\x00" + key
+		if c.entries[cacheKey] == entry {
+			delete(c.entries, cacheKey)
+		}
+	}
+	close(entry.done)
+}
+
+// Forget 删除幂等键（原隧道已不存在时使用）
+func (c *idempotencyCache) Forget(clientID, key string, entry *idempotencyEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cacheKey := clientID + "\x00" + key
+	if c.entries[cacheKey] == entry {
+		delete(c.entries, cacheKey)
+	}
+}
+
+// pruneLocked 清理过期且已完成的幂等键（调用方持有锁）
+func (c *idempotencyCache) pruneLocked(now time.Time) {
+	for k, entry := range c.entries {
+		if now.Before(entry.expiresAt) {
+			continue
+		}
+		select {
+		case <-entry.done:
+			delete(c.entries, k)
+		default:
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/houzhh15/sdp-common/policy"
+	"github.com/houzhh15/sdp-common/tunnel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newIdempotencyTestController(t *testing.T) (*Controller, string) {
+	t.Helper()
+
+	c := newAdminTestController(t, &Config{TCPProxyAddr: ":9443"})
+	c.idempotency = newIdempotencyCache(time.Minute)
+
+	require.NoError(t, c.tunnelManager.CreateServiceConfig(context.Background(), &tunnel.ServiceConfig{
+		ServiceID:  "svc-1",
+		TargetHost: "127.0.0.1",
+		TargetPort: 8080,
+	}))
+	require.NoError(t, c.policyEngine.SavePolicy(context.Background(), &policy.Policy{
+		PolicyID:   "p1",
+		ClientID:   "alice",
+		ServiceID:  "svc-1",
+		ExpiryTime: time.Now().Add(time.Hour),
+	}))
+	return c, createTestSession(t, c, "alice", "user")
+}
+
+func postTunnel(c *Controller, token, serviceID, key string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(map[string]interface{}{
+		"session_token": token,
+		"service_id":    serviceID,
+		"protocol":      "tcp",
+	})
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/tunnels", bytes.NewReader(body))
+	if key != "" {
+		req.Header.Set(headerIdempotencyKey, key)
+	}
+	w := httptest.NewRecorder()
+	c.handleTunnelCreate(w, req)
+	return w
+}
+
+func tunnelIDFrom(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var resp struct {
+		TunnelID string `json:"tunnel_id"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return resp.TunnelID
+}
+
+func TestTunnelCreate_IdempotentReplay(t *testing.T) {
+	c, token := newIdempotencyTestController(t)
+
+	first := postTunnel(c, token, "svc-1", "retry-1")
+	require.Equal(t, http.StatusCreated, first.Code)
+	assert.Empty(t, first.Header().Get(headerIdempotentReplayed))
+
+	replay := postTunnel(c, token, "svc-1", "retry-1")
+	require.Equal(t, http.StatusCreated, replay.Code)
+	assert.Equal(t, "true", replay.Header().Get(headerIdempotentReplayed))
+	assert.Equal(t, tunnelIDFrom(t, first), tunnelIDFrom(t, replay))
+
+	tunnels, err := c.tunnelManager.ListTunnels(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Len(t, tunnels, 1)
+
+	// 不带幂等键的请求照常创建新隧道
+	other := postTunnel(c, token, "svc-1", "")
+	require.Equal(t, http.StatusCreated, other.Code)
+	assert.NotEqual(t, tunnelIDFrom(t, first), tunnelIDFrom(t, other))
+}
+
+func TestTunnelCreate_IdempotencyKeyMismatch(t *testing.T) {
+	c, token := newIdempotencyTestController(t)
+	require.NoError(t, c.tunnelManager.CreateServiceConfig(context.Background(), &tunnel.ServiceConfig{
+		ServiceID:  "svc-2",
+		TargetHost: "127.0.0.1",
+		TargetPort: 9090,
+	}))
+
+	require.Equal(t, http.StatusCreated, postTunnel(c, token, "svc-1", "k").Code)
+	w := postTunnel(c, token, "svc-2", "k")
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+}
+
+func TestTunnelCreate_IdempotencyFailureReleasesKey(t *testing.T) {
+	c, token := newIdempotencyTestController(t)
+
+	// 服务不存在时创建失败，键被释放
+	require.Equal(t, http.StatusNotFound, postTunnel(c, token, "svc-missing", "k").Code)
+	require.NoError(t, c.tunnelManager.CreateServiceConfig(context.Background(), &tunnel.ServiceConfig{
+		ServiceID:  "svc-missing",
+		TargetHost: "127.0.0.1",
+		TargetPort: 7070,
+	}))
+	require.NoError(t, c.policyEngine.SavePolicy(context.Background(), &policy.Policy{
+		PolicyID:   "p2",
+		ClientID:   "alice",
+		ServiceID:  "svc-missing",
+		ExpiryTime: time.Now().Add(time.Hour),
+	}))
+	w := postTunnel(c, token, "svc-missing", "k")
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.Empty(t, w.Header().Get(headerIdempotentReplayed))
+}
+
+func TestTunnelCreate_IdempotencyDeletedTunnel(t *testing.T) {
+	c, token := newIdempotencyTestController(t)
+
+	first := postTunnel(c, token, "svc-1", "k")
+	require.Equal(t, http.StatusCreated, first.Code)
+	require.NoError(t, c.tunnelManager.DeleteTunnel(context.Background(), tunnelIDFrom(t, first)))
+
+	w := postTunnel(c, token, "svc-1", "k")
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.Empty(t, w.Header().Get(headerIdempotentReplayed))
+	assert.NotEqual(t, tunnelIDFrom(t, first), tunnelIDFrom(t, w))
+}
+
+func TestIdempotencyCache_Concurrent(t *testing.T) {
+	cache := newIdempotencyCache(time.Minute)
+
+	var mu sync.Mutex
+	owners := 0
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			entry, owner, err := cache.Acquire("alice", "k", "fp")
+			require.NoError(t, err)
+			if owner {
+				mu.Lock()
+				owners++
+				mu.Unlock()
+				time.Sleep(10 * time.Millisecond)
+				cache.Complete("alice", "k", entry, "tunnel-1")
+				return
+			}
+			assert.Equal(t, "tunnel-1", entry.tunnelID)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, owners)
+
+	// 不同客户端的同名键互不影响
+	_, owner, err := cache.Acquire("bob", "k", "fp")
+	require.NoError(t, err)
+	assert.True(t, owner)
+}
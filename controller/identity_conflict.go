@@ -0,0 +1,91 @@
+package controller
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/houzhh15/sdp-common/cert"
+	"github.com/houzhh15/sdp-common/logging"
+	"github.com/houzhh15/sdp-common/transport"
+)
+
+// identityConflictPolicy 返回生效的证书身份冲突处理策略，默认 flag
+func (c *Controller) identityConflictPolicy() cert.ConflictPolicy {
+	if c.config != nil && c.config.IdentityConflictPolicy != "" {
+		return c.config.IdentityConflictPolicy
+	}
+	return cert.ConflictPolicyFlag
+}
+
+// checkIdentityConflict 检测映射出相同客户端身份（claims.ClientID）但指纹不同的活跃证书，并为每个冲突记录安全事件
+// 返回冲突证书指纹，以及是否应拒绝握手：reject 策略仅拒绝尚未注册的新证书，
+// 已注册的证书（如 flag 策略下放行的）仅标记，由管理员通过吊销或轮换处理。
+// transferredFrom 为会话转移的源证书指纹：与它的冲突是转移的预期结果，记录事件但不拒绝（reject 策略的唯一例外）
+func (c *Controller) checkIdentityConflict(r *http.Request, clientCert *x509.Certificate, fingerprint string, registered bool, transferredFrom string) ([]string, bool) {
+	clientID := c.extractClientID(clientCert)
+	if clientID == "" {
+		return nil, false
+	}
+
+	conflicts, err := c.certRegistry.FindConflicts(clientID, fingerprint)
+	if err != nil {
+		c.logger.Warn("Failed to check certificate identity conflicts", "client_id", clientID, "error", err)
+		return nil, false
+	}
+	if len(conflicts) == 0 {
+		return nil, false
+	}
+
+	policy := c.identityConflictPolicy()
+	reject := policy == cert.ConflictPolicyReject && !registered &&
+		slices.ContainsFunc(conflicts, func(conflict *cert.CertInfo) bool { return conflict.Fingerprint != transferredFrom })
+	action := "flagged"
+	if reject {
+		action = "rejected"
+	}
+
+	fingerprints := make([]string, len(conflicts))
+	for i, conflict := range conflicts {
+		fingerprints[i] = conflict.Fingerprint
+		conflictAction := action
+		if conflict.Fingerprint == transferredFrom {
+			conflictAction = "transferred"
+		}
+		c.logger.Warn("Certificate identity conflict",
+			"client_id", clientID,
+			"fingerprint", fingerprint,
+			"conflicting_fingerprint", conflict.Fingerprint,
+			"action", conflictAction)
+		c.auditSecurity(r.Context(), &logging.SecurityEvent{
+			Timestamp: time.Now(),
+			ClientID:  clientID,
+			EventType: logging.EventIdentityConflict,
+			Severity:  logging.SeverityHigh,
+			Message:   "Multiple active certificates share the same identity",
+			Details: map[string]interface{}{
+				"fingerprint":             fingerprint,
+				"subject":                 clientCert.Subject.String(),
+				"conflicting_fingerprint": conflict.Fingerprint,
+				"conflicting_subject":     conflict.Subject,
+				"policy":                  string(policy),
+				"action":                  conflictAction,
+				"source_ip":               transport.ClientIPFromRequest(r),
+			},
+		})
+	}
+
+	return fingerprints, reject
+}
+
+// auditSecurity 记录安全事件（未配置审计日志时忽略）
+func (c *Controller) auditSecurity(ctx context.Context, event *logging.SecurityEvent) {
+	if c.auditLogger == nil {
+		return
+	}
+	if err := c.auditLogger.LogSecurity(ctx, event); err != nil {
+		c.logger.Warn("Failed to write security event", "event_type", event.EventType, "error", err)
+	}
+}
@@ -0,0 +1,88 @@
+package controller
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/houzhh15/sdp-common/cert"
+	"github.com/houzhh15/sdp-common/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandshake_IdentityConflict(t *testing.T) {
+	pki := newInternalTestPKI(t)
+	first := pki.manager(pki.issue("alice", "")).GetX509Certificate()
+	second := pki.manager(pki.issue("alice", "")).GetX509Certificate()
+	other := pki.manager(pki.issue("bob", "")).GetX509Certificate()
+
+	cfg := &Config{IdentityConflictPolicy: cert.ConflictPolicyReject}
+	require.NoError(t, cfg.IdentityConflictPolicy.Validate())
+	c := newAdminTestController(t, cfg)
+
+	require.Equal(t, http.StatusOK, handshakeWithCert(c, first, "").Code)
+	require.Equal(t, http.StatusOK, handshakeWithCert(c, other, "").Code)
+
+	// reject：新出现的同名证书被拒绝且不注册，原证书继续可用
+	w := handshakeWithCert(c, second, "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "IDENTITY_CONFLICT")
+	_, err := c.certRegistry.GetCertInfo(calculateFingerprint(second))
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusOK, handshakeWithCert(c, first, "").Code)
+
+	events, err := c.auditLogger.Query(context.Background(), &logging.AuditFilter{EventType: logging.EventIdentityConflict})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, "alice", events[0].Indexed["client_id"])
+
+	// flag：放行并在会话中标记冲突
+	cfg.IdentityConflictPolicy = cert.ConflictPolicyFlag
+	assert.Equal(t, http.StatusOK, handshakeWithCert(c, second, "").Code)
+	sessions, err := c.sessionManager.GetActiveSessions(context.Background())
+	require.NoError(t, err)
+	flagged := 0
+	for _, sess := range sessions {
+		if sess.Metadata["identity_conflict"] == true {
+			flagged++
+			assert.Equal(t, calculateFingerprint(second), sess.CertFingerprint)
+			assert.Equal(t, []string{calculateFingerprint(first)}, sess.Metadata["conflicting_fingerprints"])
+		}
+	}
+	assert.Equal(t, 1, flagged)
+
+	assert.Error(t, (&Config{IdentityConflictPolicy: "ignore"}).IdentityConflictPolicy.Validate())
+}
+
+func TestHandshake_IdentityConflictMappedClientID(t *testing.T) {
+	c := newAdminTestController(t, &Config{
+		IdentityConflictPolicy: cert.ConflictPolicyReject,
+		IdentityClaims:         &cert.ClaimsMapping{ClientID: cert.ClaimSourceSANEmail},
+	})
+	newCert := func(raw, cn, email string) *x509.Certificate {
+		return &x509.Certificate{
+			Raw:            []byte(raw),
+			Subject:        pkix.Name{CommonName: cn},
+			EmailAddresses: []string{email},
+			NotBefore:      time.Now().Add(-time.Hour),
+			NotAfter:       time.Now().Add(time.Hour),
+		}
+	}
+
+	require.Equal(t, http.StatusOK, handshakeWithCert(c, newCert("alice-1", "Alice", "alice@acme.example"), "").Code)
+	// CN 相同但映射为不同客户端：不是冲突
+	require.Equal(t, http.StatusOK, handshakeWithCert(c, newCert("alice-2", "Alice", "alice.b@acme.example"), "").Code)
+	// CN 不同但映射为同一客户端：冲突
+	w := handshakeWithCert(c, newCert("alice-3", "Alice Laptop", "alice@acme.example"), "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "IDENTITY_CONFLICT")
+
+	events, err := c.auditLogger.Query(context.Background(), &logging.AuditFilter{EventType: logging.EventIdentityConflict})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, "alice@acme.example", events[0].Indexed["client_id"])
+}
@@ -0,0 +1,289 @@
+package controller
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/houzhh15/sdp-common/cert"
+	"github.com/houzhh15/sdp-common/logging"
+	"github.com/houzhh15/sdp-common/transport"
+	"github.com/houzhh15/sdp-common/tunnel"
+)
+
+// defaultInternalRPCTimeout 内部 RPC 客户端请求超时
+const defaultInternalRPCTimeout = 10 * time.Second
+
+// InternalStatus 内部 RPC 状态响应（GET /internal/v1/status）
+type InternalStatus struct {
+	Identity  *cert.ServiceIdentity `json:"identity"`
+	Version   string                `json:"version"`
+	Tunnels   int                   `json:"tunnels"`
+	Timestamp time.Time             `json:"timestamp"`
+}
+
+// internalRPC 内部 RPC 监听与客户端（Controller 副本之间、Controller 与中继节点）
+// 使用独立的内部身份证书与 mTLS 监听，终端用户证书无法访问；内部证书也不能用于终端用户握手
+type internalRPC struct {
+	identity *cert.ServiceIdentity
+	policy   *cert.InternalPeerPolicy
+	server   transport.HTTPServer
+	mux      *http.ServeMux
+	client   *InternalClient
+
+	certManager *cert.Manager
+}
+
+// newInternalRPC 加载内部身份证书并创建内部 RPC 监听与客户端
+func newInternalRPC(cfg *Config) (*internalRPC, error) {
+	keyPEM, err := cfg.Internal.Key.Resolve(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve internal private key: %w", err)
+	}
+	certManager, err := cert.NewManager(&cert.Config{
+		CertFile:  cfg.Internal.CertFile,
+		KeyFile:   cfg.Internal.KeyFile,
+		CAFile:    cfg.Internal.CAFile,
+		KeyPEM:    keyPEM,
+		TLSPolicy: cfg.TLSPolicy,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load internal identity certificate: %w", err)
+	}
+
+	// 本副本证书必须携带 controller 角色的内部身份
+	identity, err := cert.ParseServiceIdentity(certManager.GetX509Certificate(), cfg.Internal.TrustDomain)
+	if err != nil {
+		return nil, fmt.Errorf("invalid internal identity certificate: %w", err)
+	}
+	if identity.Role != cert.RoleController {
+		return nil, fmt.Errorf("internal identity %s is not a controller identity", identity)
+	}
+
+	policy := cfg.Internal.PeerPolicy()
+	return &internalRPC{
+		identity: identity,
+		policy:   policy,
+		server:   transport.NewHTTPServerWithConfig(certManager.GetInternalServerTLSConfig(policy), cfg.HTTP),
+		mux:      http.NewServeMux(),
+		client:   NewInternalClient(certManager, policy, defaultInternalRPCTimeout),
+
+		certManager: certManager,
+	}, nil
+}
+
+// relayChainTLSConfig 多跳隧道中本副本中继连接下一跳的客户端配置：出示内部身份证书，按数据平面 CA 校验下一跳
+// 下一跳的数据平面监听须信任内部 CA，并以 ChainPeers 接受本副本的内部身份
+func (r *internalRPC) relayChainTLSConfig(dataPlaneCAs *x509.CertPool) *tls.Config {
+	config := r.certManager.GetTLSConfig()
+	config.ClientCAs = nil
+	config.ClientAuth = tls.NoClientCert
+	config.GetConfigForClient = nil
+	config.RootCAs = dataPlaneCAs
+	return config
+}
+
+// registerInternalHandlers registers internal RPC handlers (internal listener only)
+func (c *Controller) registerInternalHandlers() {
+	c.internal.mux.HandleFunc("/internal/v1/status", c.requireInternalPeer(c.handleInternalStatus))
+	c.internal.mux.HandleFunc("/internal/v1/tunnels/", c.requireInternalPeer(c.handleInternalTunnel))
+	c.internal.mux.HandleFunc("/internal/v1/relays", c.requireInternalPeer(c.handleInternalRelays))
+	c.internal.mux.HandleFunc("/internal/v1/relays/", c.requireInternalPeer(c.handleInternalRelay))
+}
+
+// startInternalServer starts the internal RPC listener
+func (c *Controller) startInternalServer() {
+	c.logger.Info("Starting internal RPC server with mTLS",
+		"addr", c.config.Internal.ListenAddr,
+		"identity", c.internal.identity.URI(),
+		"allowed_roles", strings.Join(c.config.Internal.AllowedRoles, ","))
+	if err := c.internal.server.Start(c.config.Internal.ListenAddr, c.internal.mux); err != nil {
+		c.logger.Error("Internal RPC server error", "error", err)
+	}
+}
+
+// requireInternalPeer 校验对端证书的内部身份（TLS 握手已校验一次，此处防御性复核并记录拒绝）
+func (c *Controller) requireInternalPeer(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+			respondErrorWithStatus(w, "UNAUTHORIZED", "Internal peer certificate required", nil, http.StatusUnauthorized)
+			return
+		}
+		peer, err := c.internal.policy.Authorize(r.TLS.PeerCertificates[0])
+		if err != nil {
+			c.logger.Warn("Internal RPC peer rejected", "subject", r.TLS.PeerCertificates[0].Subject.CommonName, "error", err)
+			c.auditAccess(r.Context(), &logging.AccessEvent{
+				Timestamp: time.Now(),
+				ClientID:  r.TLS.PeerCertificates[0].Subject.CommonName,
+				SourceIP:  transport.ClientIPFromRequest(r),
+				Action:    "internal_rpc",
+				Result:    "denied",
+				Reason:    err.Error(),
+				Details:   map[string]interface{}{"path": r.URL.Path},
+			})
+			respondErrorWithStatus(w, "FORBIDDEN", "Internal peer not allowed", nil, http.StatusForbidden)
+			return
+		}
+
+		c.logger.Debug("Internal RPC request", "peer", peer.URI(), "path", r.URL.Path)
+		next(w, r)
+	}
+}
+
+// handleInternalStatus returns this replica's identity and load
+func (c *Controller) handleInternalStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondErrorWithStatus(w, "METHOD_NOT_ALLOWED", "Method not allowed", nil, http.StatusMethodNotAllowed)
+		return
+	}
+
+	tunnels, err := c.tunnelManager.ListTunnels(r.Context(), nil)
+	if err != nil {
+		respondErrorWithStatus(w, "INTERNAL_ERROR", "Failed to list tunnels", nil, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&InternalStatus{
+		Identity:  c.internal.identity,
+		Version:   "1.0.0",
+		Tunnels:   len(tunnels),
+		Timestamp: time.Now(),
+	})
+}
+
+// handleInternalTunnel returns a tunnel by ID for relay nodes and peer replicas (session token stripped);
+// POST /internal/v1/tunnels/{id}/paired confirms that a relay node paired the tunnel
+func (c *Controller) handleInternalTunnel(w http.ResponseWriter, r *http.Request) {
+	tunnelID := strings.TrimPrefix(r.URL.Path, "/internal/v1/tunnels/")
+	if id, ok := strings.CutSuffix(tunnelID, "/paired"); ok {
+		c.handleInternalTunnelPaired(w, r, id)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		respondErrorWithStatus(w, "METHOD_NOT_ALLOWED", "Method not allowed", nil, http.StatusMethodNotAllowed)
+		return
+	}
+	if tunnelID == "" || strings.Contains(tunnelID, "/") {
+		respondErrorWithStatus(w, "INVALID_REQUEST", "Invalid tunnel ID", nil, http.StatusBadRequest)
+		return
+	}
+
+	tun, err := c.tunnelManager.GetTunnel(r.Context(), tunnelID)
+	if err != nil {
+		respondErrorWithStatus(w, "TUNNEL_NOT_FOUND", "Tunnel not found", nil, http.StatusNotFound)
+		return
+	}
+
+	result := *tun
+	result.SessionToken = ""
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&result)
+}
+
+// handleInternalTunnelPaired 记录中继节点上报的隧道配对，已转为 failed 的隧道返回 409
+func (c *Controller) handleInternalTunnelPaired(w http.ResponseWriter, r *http.Request, tunnelID string) {
+	if r.Method != http.MethodPost {
+		respondErrorWithStatus(w, "METHOD_NOT_ALLOWED", "Method not allowed", nil, http.StatusMethodNotAllowed)
+		return
+	}
+	if tunnelID == "" || strings.Contains(tunnelID, "/") {
+		respondErrorWithStatus(w, "INVALID_REQUEST", "Invalid tunnel ID", nil, http.StatusBadRequest)
+		return
+	}
+	if _, err := c.tunnelManager.GetTunnel(r.Context(), tunnelID); err != nil {
+		respondErrorWithStatus(w, "TUNNEL_NOT_FOUND", "Tunnel not found", nil, http.StatusNotFound)
+		return
+	}
+	if !c.tunnelManager.MarkPaired(tunnelID, time.Now()) {
+		respondErrorWithStatus(w, "TUNNEL_FAILED", "Tunnel already failed", nil, http.StatusConflict)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// InternalClient 内部 RPC mTLS 客户端，使用本组件内部身份证书访问其他副本或 Controller 的 /internal/v1 接口
+type InternalClient struct {
+	httpClient *http.Client
+}
+
+// NewInternalClient 创建内部 RPC 客户端，服务端证书须由内部 CA 签发且身份满足 policy
+func NewInternalClient(certManager *cert.Manager, policy *cert.InternalPeerPolicy, timeout time.Duration) *InternalClient {
+	if timeout <= 0 {
+		timeout = defaultInternalRPCTimeout
+	}
+	return &InternalClient{
+		httpClient: &http.Client{
+			Timeout: timeout,
+			Transport: &http.Transport{
+				TLSClientConfig: certManager.GetInternalClientTLSConfig(policy),
+			},
+		},
+	}
+}
+
+// Status 查询对端副本状态（peerAddr 形如 "controller-2:8444"）
+func (c *InternalClient) Status(ctx context.Context, peerAddr string) (*InternalStatus, error) {
+	var status InternalStatus
+	if err := c.get(ctx, peerAddr, "/internal/v1/status", &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// GetTunnel 从对端 Controller 查询隧道（中继节点校验隧道 ID 时使用）
+func (c *InternalClient) GetTunnel(ctx context.Context, peerAddr, tunnelID string) (*tunnel.Tunnel, error) {
+	var tun tunnel.Tunnel
+	if err := c.get(ctx, peerAddr, "/internal/v1/tunnels/"+tunnelID, &tun); err != nil {
+		return nil, err
+	}
+	return &tun, nil
+}
+
+// ReportPaired 向 Controller 确认隧道已在本中继节点完成配对
+func (c *InternalClient) ReportPaired(ctx context.Context, peerAddr, tunnelID string) error {
+	path := "/internal/v1/tunnels/" + tunnelID + "/paired"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://"+peerAddr+path, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("internal rpc %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("internal rpc %s: status %d", path, resp.StatusCode)
+	}
+	return nil
+}
+
+// get 发送 GET 请求并解码 JSON 响应
+func (c *InternalClient) get(ctx context.Context, peerAddr, path string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://"+peerAddr+path, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("internal rpc %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("internal rpc %s: status %d", path, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
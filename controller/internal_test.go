@@ -0,0 +1,171 @@
+package controller
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/houzhh15/sdp-common/cert"
+	"github.com/houzhh15/sdp-common/tunnel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// internalTestPKI 测试用内部 CA，签发带 spiffe URI SAN 的证书并写入临时目录
+type internalTestPKI struct {
+	t      *testing.T
+	dir    string
+	ca     *x509.Certificate
+	caKey  *ecdsa.PrivateKey
+	CAFile string
+	serial int64
+}
+
+func newInternalTestPKI(t *testing.T) *internalTestPKI {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "internal-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	ca, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	pki := &internalTestPKI{t: t, dir: t.TempDir(), ca: ca, caKey: key, serial: 1}
+	pki.CAFile = filepath.Join(pki.dir, "internal-ca.pem")
+	require.NoError(t, os.WriteFile(pki.CAFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	return pki
+}
+
+// issue 签发证书，identityURI 为空时生成终端用户证书；返回证书与私钥文件路径
+func (p *internalTestPKI) issue(name, identityURI string) (string, string) {
+	p.t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(p.t, err)
+
+	p.serial++
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(p.serial),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if identityURI != "" {
+		u, err := url.Parse(identityURI)
+		require.NoError(p.t, err)
+		template.URIs = []*url.URL{u}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, p.ca, &key.PublicKey, p.caKey)
+	require.NoError(p.t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(p.t, err)
+
+	certFile := filepath.Join(p.dir, name+"-cert.pem")
+	keyFile := filepath.Join(p.dir, name+"-key.pem")
+	require.NoError(p.t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(p.t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return certFile, keyFile
+}
+
+func (p *internalTestPKI) manager(certFile, keyFile string) *cert.Manager {
+	p.t.Helper()
+	m, err := cert.NewManager(&cert.Config{CertFile: certFile, KeyFile: keyFile, CAFile: p.CAFile})
+	require.NoError(p.t, err)
+	return m
+}
+
+func TestInternalRPC(t *testing.T) {
+	pki := newInternalTestPKI(t)
+	ctrlCert, ctrlKey := pki.issue("ctrl-1", "spiffe://sdp.internal/controller/ctrl-1")
+	relayCert, relayKey := pki.issue("relay-1", "spiffe://sdp.internal/relay/relay-1")
+	userCert, userKey := pki.issue("ih-alice", "")
+
+	cfg := &Config{Internal: &InternalConfig{CertFile: ctrlCert, KeyFile: ctrlKey, CAFile: pki.CAFile}}
+	require.NoError(t, cfg.Internal.Validate())
+
+	c := newAdminTestController(t, cfg)
+	internal, err := newInternalRPC(cfg)
+	require.NoError(t, err)
+	c.internal = internal
+	c.registerInternalHandlers()
+	assert.Equal(t, "spiffe://sdp.internal/controller/ctrl-1", internal.identity.URI())
+
+	tun := &tunnel.Tunnel{ID: "tun-1", ClientID: "alice", ServiceID: "svc-1", SessionToken: "secret"}
+	c.tunnelManager.tunnels.Store(tun.ID, tun)
+
+	server := httptest.NewUnstartedServer(internal.mux)
+	server.TLS = pki.manager(ctrlCert, ctrlKey).GetInternalServerTLSConfig(cfg.Internal.PeerPolicy())
+	server.StartTLS()
+	defer server.Close()
+	peerAddr := server.Listener.Addr().String()
+	ctx := context.Background()
+
+	// 中继节点以内部身份访问
+	client := NewInternalClient(pki.manager(relayCert, relayKey), cfg.Internal.PeerPolicy(), time.Second)
+	status, err := client.Status(ctx, peerAddr)
+	require.NoError(t, err)
+	assert.Equal(t, "ctrl-1", status.Identity.ID)
+	assert.Equal(t, 1, status.Tunnels)
+
+	got, err := client.GetTunnel(ctx, peerAddr, "tun-1")
+	require.NoError(t, err)
+	assert.Equal(t, "svc-1", got.ServiceID)
+	assert.Empty(t, got.SessionToken, "session token must not leave the replica")
+
+	_, err = client.GetTunnel(ctx, peerAddr, "missing")
+	assert.Error(t, err)
+
+	// 终端用户证书（同一 CA 但无内部身份）在握手阶段被拒绝
+	userClient := NewInternalClient(pki.manager(userCert, userKey), cfg.Internal.PeerPolicy(), time.Second)
+	_, err = userClient.Status(ctx, peerAddr)
+	assert.Error(t, err)
+
+	// 请求级复核：仅允许 controller 角色时拒绝中继节点（复用已建立的连接）
+	c.internal.policy = &cert.InternalPeerPolicy{AllowedRoles: []string{cert.RoleController}}
+	_, err = client.Status(ctx, peerAddr)
+	assert.ErrorContains(t, err, "status 403")
+}
+
+func TestInternalRPC_RejectsNonControllerIdentity(t *testing.T) {
+	pki := newInternalTestPKI(t)
+	relayCert, relayKey := pki.issue("relay-1", "spiffe://sdp.internal/relay/relay-1")
+
+	_, err := newInternalRPC(&Config{Internal: &InternalConfig{CertFile: relayCert, KeyFile: relayKey, CAFile: pki.CAFile}})
+	assert.ErrorContains(t, err, "not a controller identity")
+}
+
+func TestHandshake_RejectsServiceCertificate(t *testing.T) {
+	pki := newInternalTestPKI(t)
+	relayCert, relayKey := pki.issue("relay-1", "spiffe://sdp.internal/relay/relay-1")
+	c := newAdminTestController(t, &Config{})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/handshake", nil)
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{pki.manager(relayCert, relayKey).GetX509Certificate()}}
+	w := httptest.NewRecorder()
+	c.handleHandshake(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
@@ -0,0 +1,127 @@
+package controller
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/houzhh15/sdp-common/cert"
+	"github.com/houzhh15/sdp-common/transport"
+)
+
+// listenerRoutes 只属于部分接口集合的路由模式；未列出的路由在所有监听上提供
+// （健康检查、就绪探针、指标、认证、证书轮换、服务与数据平面发现、隧道统计与 E2E 密钥、遥测）
+var listenerRoutes = map[string][]ListenerRole{
+	"/api/{version}/policies":             {ListenerRoleClient},
+	"/api/{version}/tunnels":              {ListenerRoleClient},
+	"/api/{version}/client/events/stream": {ListenerRoleClient},
+	"/api/{version}/services/register":    {ListenerRoleAgent},
+	"/api/{version}/tunnels/reconcile":    {ListenerRoleAgent},
+	"/api/{version}/events/subscribe":     {ListenerRoleAgent},
+	"/{version}/agent/tunnels/stream":     {ListenerRoleAgent},
+	"/api/{version}/events":               {ListenerRoleAdmin},
+	"/admin/":                             {ListenerRoleAdmin},
+}
+
+// routeRoles 返回路由模式所属的接口集合，nil 表示所有监听
+func routeRoles(pattern string) []ListenerRole {
+	if strings.HasPrefix(pattern, "/api/{version}/admin/") {
+		return []ListenerRole{ListenerRoleAdmin}
+	}
+	return listenerRoutes[pattern]
+}
+
+// route 已注册的路由及其所属接口集合
+type route struct {
+	path    string
+	handler http.Handler
+	roles   []ListenerRole // nil 表示所有监听
+}
+
+// servedBy 路由是否由提供 roles 的监听提供
+func (r *route) servedBy(roles []ListenerRole) bool {
+	if r.roles == nil {
+		return true
+	}
+	for _, role := range r.roles {
+		if slices.Contains(roles, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// listener 附加 HTTPS 监听（Config.Listeners）
+type listener struct {
+	config *ListenerConfig
+	server transport.HTTPServer
+	mux    *http.ServeMux
+}
+
+// handle 在主路由注册 path，并记录其接口集合供按监听挑选
+func (c *Controller) handle(roles []ListenerRole, path string, handler http.Handler) {
+	c.mux.Handle(path, handler)
+	c.routes = append(c.routes, route{path: path, handler: handler, roles: roles})
+}
+
+// routeMux 返回只包含 roles 接口集合（及共用接口）的路由；roles 为空时为全部接口
+func (c *Controller) routeMux(roles []ListenerRole) *http.ServeMux {
+	if len(roles) == 0 {
+		return c.mux
+	}
+	mux := http.NewServeMux()
+	for i := range c.routes {
+		if c.routes[i].servedBy(roles) {
+			mux.Handle(c.routes[i].path, c.routes[i].handler)
+		}
+	}
+	return mux
+}
+
+// newListeners 为 Config.Listeners 创建 HTTPS 服务器（须在注册路由之后调用）
+func (c *Controller) newListeners(keyPEM []byte) ([]*listener, error) {
+	listeners := make([]*listener, 0, len(c.config.Listeners))
+	for _, cfg := range c.config.Listeners {
+		tlsConfig, err := c.listenerTLSConfig(cfg, keyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("listener %s: %w", cfg.name(), err)
+		}
+		server := transport.NewHTTPServerWithConfig(tlsConfig, c.config.HTTP)
+		c.registerMiddleware(server)
+		listeners = append(listeners, &listener{config: cfg, server: server, mux: c.routeMux(cfg.Roles)})
+	}
+	return listeners, nil
+}
+
+// listenerTLSConfig 附加监听的 TLS 配置：服务端证书与 TLS 策略同主监听，客户端证书信任集与认证模式按监听配置
+func (c *Controller) listenerTLSConfig(cfg *ListenerConfig, keyPEM []byte) (*tls.Config, error) {
+	// 每个监听使用独立的 tls.Config，ClientAuth 不影响主监听
+	tlsConfig := c.certManager.GetTLSConfig()
+	if cfg.hasCAs() {
+		manager, err := cert.NewManager(&cert.Config{
+			CertFile:  c.config.CertFile,
+			KeyFile:   c.config.KeyFile,
+			CAFile:    cfg.CAFile,
+			CAFiles:   cfg.CAFiles,
+			CADirs:    cfg.CADirs,
+			KeyPEM:    keyPEM,
+			TLSPolicy: c.certManager.TLSPolicy(),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client CAs: %w", err)
+		}
+		tlsConfig = manager.GetTLSConfig()
+	}
+	tlsConfig.ClientAuth = parseClientAuth(cfg.ClientAuth)
+	return tlsConfig, nil
+}
+
+// startListener starts an additional HTTPS listener
+func (c *Controller) startListener(l *listener) {
+	c.logger.Info("Starting HTTPS listener", "name", l.config.name(), "addr", l.config.Addr, "roles", l.config.Roles)
+	if err := l.server.Start(l.config.Addr, l.mux); err != nil {
+		c.logger.Error("HTTPS listener error", "name", l.config.name(), "error", err)
+	}
+}
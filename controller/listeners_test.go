@@ -0,0 +1,120 @@
+package controller
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouteMux_Roles(t *testing.T) {
+	c := newAdminTestController(t, &Config{EnableDashboard: true, AgentStreamPath: "/sse/tunnels"})
+	c.mux = http.NewServeMux()
+	c.routes = nil
+	c.registerHandlers()
+
+	// 路由本身已注册（而非由上级子树路由或重定向处理）
+	served := func(mux *http.ServeMux, path string) bool {
+		_, pattern := mux.Handler(httptest.NewRequest(http.MethodGet, path, nil))
+		return pattern == path
+	}
+
+	cases := []struct {
+		path   string
+		admin  bool
+		client bool
+		agent  bool
+	}{
+		{"/health", true, true, true},
+		{"/metrics", true, true, true},
+		{"/api/v1/auth/handshake", true, true, true},
+		{"/api/auth/refresh", true, true, true},
+		{"/api/v1/services", true, true, true},
+		{"/api/v1/admin/sessions", true, false, false},
+		{"/api/admin/trust", true, false, false},
+		{"/api/v1/events", true, false, false},
+		{"/admin/", true, false, false},
+		{"/api/v1/tunnels", false, true, false},
+		{"/api/v1/policies", false, true, false},
+		{"/api/v1/client/events/stream", false, true, false},
+		{"/api/v1/events/subscribe", false, false, true},
+		{"/api/v1/services/register", false, false, true},
+		{"/v1/agent/tunnels/stream", false, false, true},
+		{"/sse/tunnels", false, false, true},
+	}
+	admin := c.routeMux([]ListenerRole{ListenerRoleAdmin})
+	client := c.routeMux([]ListenerRole{ListenerRoleClient})
+	agent := c.routeMux([]ListenerRole{ListenerRoleAgent})
+	both := c.routeMux([]ListenerRole{ListenerRoleClient, ListenerRoleAgent})
+	for _, tc := range cases {
+		assert.Equal(t, tc.admin, served(admin, tc.path), "admin %s", tc.path)
+		assert.Equal(t, tc.client, served(client, tc.path), "client %s", tc.path)
+		assert.Equal(t, tc.agent, served(agent, tc.path), "agent %s", tc.path)
+		assert.Equal(t, tc.client || tc.agent, served(both, tc.path), "client+agent %s", tc.path)
+		assert.True(t, served(c.routeMux(nil), tc.path), "all %s", tc.path)
+	}
+}
+
+func TestListenerTLSConfig(t *testing.T) {
+	userPKI := newInternalTestPKI(t)
+	adminPKI := newInternalTestPKI(t)
+	serverCert, serverKey := userPKI.issue("controller", "")
+	userCert, userKey := userPKI.issue("ih-alice", "")
+	adminCert, adminKey := adminPKI.issue("admin-bob", "")
+
+	c := newAdminTestController(t, &Config{CertFile: serverCert, KeyFile: serverKey})
+	c.certManager = userPKI.manager(serverCert, serverKey)
+	c.mux = http.NewServeMux()
+	c.routes = nil
+	c.registerHandlers()
+
+	// 默认信任集与认证模式同主监听
+	tlsConfig, err := c.listenerTLSConfig(&ListenerConfig{Addr: ":0", Roles: []ListenerRole{ListenerRoleClient}}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, tls.RequireAndVerifyClientCert, tlsConfig.ClientAuth)
+	assert.Same(t, c.certManager.GetCAPool(), tlsConfig.ClientCAs)
+
+	// 管理端口只信任管理员 CA
+	tlsConfig, err = c.listenerTLSConfig(&ListenerConfig{
+		Addr:   ":0",
+		Roles:  []ListenerRole{ListenerRoleAdmin},
+		CAFile: adminPKI.CAFile,
+	}, nil)
+	require.NoError(t, err)
+
+	server := httptest.NewUnstartedServer(c.routeMux([]ListenerRole{ListenerRoleAdmin}))
+	server.TLS = tlsConfig
+	server.StartTLS()
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	caPEM, err := os.ReadFile(userPKI.CAFile)
+	require.NoError(t, err)
+	require.True(t, roots.AppendCertsFromPEM(caPEM))
+	get := func(certFile, keyFile string) (*http.Response, error) {
+		pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+		require.NoError(t, err)
+		client := &http.Client{
+			Timeout: time.Second,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{
+				RootCAs:      roots,
+				Certificates: []tls.Certificate{pair},
+			}},
+		}
+		return client.Get(server.URL + "/health")
+	}
+
+	resp, err := get(adminCert, adminKey)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	_, err = get(userCert, userKey)
+	assert.Error(t, err, "certificate from the control plane CA must be rejected on the admin listener")
+}
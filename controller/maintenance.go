@@ -0,0 +1,151 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/houzhh15/sdp-common/clock"
+	"github.com/houzhh15/sdp-common/logging"
+	"github.com/houzhh15/sdp-common/transport"
+)
+
+// defaultMaintenanceMessage 未指定说明时返回给被拒绝请求的提示
+const defaultMaintenanceMessage = "Controller is in maintenance mode, try again later"
+
+// maintenanceExempt 维护模式下仍接受写请求的端点：会话建立、续期、撤销、设备间转移与设备指纹上报（已有隧道依赖有效会话，
+// 管理员也需要会话才能关闭维护模式；转移时不重建隧道）、AH 重连后的隧道对账，以及维护模式开关本身
+var maintenanceExempt = map[string]bool{
+	"/api/{version}/auth/handshake":       true,
+	"/api/{version}/auth/refresh":         true,
+	"/api/{version}/auth/revoke":          true,
+	"/api/{version}/auth/transfer":        true,
+	"/api/{version}/auth/transfer/redeem": true,
+	"/api/{version}/auth/posture":         true,
+	"/api/{version}/handshake":            true,
+	"/api/{version}/sessions/refresh":     true,
+	"/api/{version}/sessions/":            true,
+	"/api/{version}/tunnels/reconcile":    true,
+	"/api/{version}/admin/maintenance":    true,
+}
+
+// maintenanceMode 运行时维护模式（只读）：拒绝新建隧道等写操作，已有隧道、GET 与 SSE 不受影响
+// 零值为关闭
+type maintenanceMode struct {
+	mu      sync.RWMutex
+	enabled bool
+	message string
+	since   time.Time
+	by      string // 开启维护模式的管理员客户端 ID
+}
+
+// maintenanceStatus 维护模式状态（管理接口返回）
+type maintenanceStatus struct {
+	Enabled bool       `json:"enabled"`
+	Message string     `json:"message,omitempty"`
+	Since   *time.Time `json:"since,omitempty"`
+	By      string     `json:"by,omitempty"`
+}
+
+// status 返回当前状态
+func (m *maintenanceMode) status() maintenanceStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if !m.enabled {
+		return maintenanceStatus{}
+	}
+	since := m.since
+	return maintenanceStatus{Enabled: true, Message: m.message, Since: &since, By: m.by}
+}
+
+// set 开启（enabled=true）或关闭维护模式；重复开启只更新说明，保留开始时间
+func (m *maintenanceMode) set(enabled bool, message, by string, now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !enabled {
+		m.enabled, m.message, m.since, m.by = false, "", time.Time{}, ""
+		return
+	}
+	if message == "" {
+		message = defaultMaintenanceMessage
+	}
+	if !m.enabled {
+		m.since = now
+	}
+	m.enabled, m.message, m.by = true, message, by
+}
+
+// maintenanceGate 维护模式下以 503 拒绝 pattern 的写请求（GET、HEAD、OPTIONS 与豁免端点除外）
+func (c *Controller) maintenanceGate(pattern string, next http.HandlerFunc) http.HandlerFunc {
+	if maintenanceExempt[pattern] {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next(w, r)
+			return
+		}
+		if status := c.maintenance.status(); status.Enabled {
+			respondErrorWithStatus(w, "MAINTENANCE", status.Message, map[string]interface{}{
+				"maintenance_since": status.Since,
+			}, http.StatusServiceUnavailable)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// maintenanceRequest 开启维护模式的请求体（可省略）
+type maintenanceRequest struct {
+	Message string `json:"message,omitempty"`
+}
+
+// handleAdminMaintenance shows (GET), enables (POST) or disables (DELETE) maintenance mode
+func (c *Controller) handleAdminMaintenance(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		var req maintenanceRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			respondErrorWithStatus(w, "INVALID_REQUEST", "Invalid request body", nil, http.StatusBadRequest)
+			return
+		}
+		clientID := c.adminClientID(r)
+		c.maintenance.set(true, req.Message, clientID, clock.Or(c.config.Clock).Now())
+		c.logger.Warn("Maintenance mode enabled", "client_id", clientID, "message", c.maintenance.status().Message)
+		c.auditMaintenance(r, clientID, "maintenance_enable")
+		c.recordOpsEvent(OpsConfigChanged, "maintenance", OpsSeverityWarning, "Maintenance mode enabled",
+			map[string]interface{}{"client_id": clientID, "message": c.maintenance.status().Message})
+
+	case http.MethodDelete:
+		clientID := c.adminClientID(r)
+		c.maintenance.set(false, "", "", time.Time{})
+		c.logger.Info("Maintenance mode disabled", "client_id", clientID)
+		c.auditMaintenance(r, clientID, "maintenance_disable")
+		c.recordOpsEvent(OpsConfigChanged, "maintenance", OpsSeverityInfo, "Maintenance mode disabled",
+			map[string]interface{}{"client_id": clientID})
+	}
+
+	respondAdmin(w, "admin_maintenance", map[string]interface{}{"maintenance": c.maintenance.status()})
+}
+
+// adminClientID 返回请求会话的客户端 ID（requireAdmin 已校验会话）
+func (c *Controller) adminClientID(r *http.Request) string {
+	if sess, err := c.sessionManager.ValidateSession(r.Context(), extractBearerToken(r)); err == nil {
+		return sess.ClientID
+	}
+	return ""
+}
+
+// auditMaintenance 记录维护模式切换
+func (c *Controller) auditMaintenance(r *http.Request, clientID, action string) {
+	c.auditAccess(r.Context(), &logging.AccessEvent{
+		ClientID: clientID,
+		SourceIP: transport.ClientIPFromRequest(r),
+		Action:   action,
+		Result:   "success",
+	})
+}
@@ -0,0 +1,108 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serveRequest(c *Controller, method, path, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	c.mux.ServeHTTP(w, req)
+	return w
+}
+
+func TestMaintenanceMode(t *testing.T) {
+	c, token := newIdempotencyTestController(t)
+	c.mux = http.NewServeMux()
+	c.registerHandlers()
+	adminToken := createTestSession(t, c, "root", "admin")
+
+	createBody, _ := json.Marshal(map[string]interface{}{"session_token": token, "service_id": "svc-1", "protocol": "tcp"})
+	createTunnel := func() *httptest.ResponseRecorder {
+		return serveRequest(c, http.MethodPost, "/api/v1/tunnels", token, string(createBody))
+	}
+
+	// 非管理员不能切换
+	w := serveRequest(c, http.MethodPost, "/api/v1/admin/maintenance", token, "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = serveRequest(c, http.MethodPost, "/api/v1/admin/maintenance", adminToken, `{"message":"database upgrade"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		Maintenance maintenanceStatus `json:"maintenance"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.True(t, resp.Maintenance.Enabled)
+	assert.Equal(t, "database upgrade", resp.Maintenance.Message)
+	assert.Equal(t, "root", resp.Maintenance.By)
+	require.NotNil(t, resp.Maintenance.Since)
+
+	// 写操作被拒绝（含版本协商路径），读操作与会话续期照常
+	w = createTunnel()
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Contains(t, w.Body.String(), "MAINTENANCE")
+	assert.Contains(t, w.Body.String(), "database upgrade")
+	w = serveRequest(c, http.MethodPost, "/api/tunnels", token, string(createBody))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	w = serveRequest(c, http.MethodGet, "/api/v1/tunnels", token, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serveRequest(c, http.MethodGet, "/api/v1/admin/maintenance", adminToken, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	refreshBody, _ := json.Marshal(map[string]string{"session_token": token})
+	w = serveRequest(c, http.MethodPost, "/api/v1/auth/refresh", token, string(refreshBody))
+	assert.NotEqual(t, http.StatusServiceUnavailable, w.Code)
+
+	// /readyz 反映维护模式但仍返回 200
+	rw := httptest.NewRecorder()
+	c.mux.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusOK, rw.Code)
+	var ready struct {
+		Status string                     `json:"status"`
+		Checks map[string]*readinessCheck `json:"checks"`
+	}
+	require.NoError(t, json.Unmarshal(rw.Body.Bytes(), &ready))
+	assert.Equal(t, "maintenance", ready.Status)
+	require.Contains(t, ready.Checks, "maintenance")
+	assert.Equal(t, "database upgrade", ready.Checks["maintenance"].Message)
+
+	// 关闭后恢复
+	w = serveRequest(c, http.MethodDelete, "/api/v1/admin/maintenance", adminToken, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusCreated, createTunnel().Code)
+
+	rw = httptest.NewRecorder()
+	c.mux.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.NotContains(t, rw.Body.String(), "maintenance")
+}
+
+func TestMaintenanceMode_DefaultMessage(t *testing.T) {
+	var m maintenanceMode
+	assert.False(t, m.status().Enabled)
+
+	since := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	m.set(true, "", "root", since)
+	status := m.status()
+	assert.Equal(t, defaultMaintenanceMessage, status.Message)
+
+	// 重复开启只更新说明，保留开始时间
+	m.set(true, "extended", "ops", since.Add(time.Hour))
+	status = m.status()
+	assert.Equal(t, "extended", status.Message)
+	assert.Equal(t, "ops", status.By)
+	assert.True(t, since.Equal(*status.Since))
+
+	m.set(false, "", "", time.Time{})
+	assert.Equal(t, maintenanceStatus{}, m.status())
+}
@@ -0,0 +1,186 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/houzhh15/sdp-common/clock"
+)
+
+const (
+	// defaultOpsEventCapacity 运维事件默认保留条数
+	defaultOpsEventCapacity = 1000
+	// defaultOpsEventLimit / maxOpsEventLimit 管理接口单次返回的条数
+	defaultOpsEventLimit = 100
+	maxOpsEventLimit     = 1000
+)
+
+// 运维事件类型
+const (
+	OpsComponentStarted  = "component_started"  // 组件开始提供服务（中继、HTTPS、网关等）
+	OpsComponentStopped  = "component_stopped"  // Controller 停止
+	OpsCertReloaded      = "cert_reloaded"      // 监听器信任的 CA 在运行时变更
+	OpsConfigChanged     = "config_changed"     // 维护模式、服务配置或服务状态变更
+	OpsRelayBindFailed   = "relay_bind_failed"  // 数据平面中继监听或证书加载失败
+	OpsAgentConnected    = "agent_connected"    // AH 建立事件订阅
+	OpsAgentDisconnected = "agent_disconnected" // AH 事件订阅断开
+	OpsUpgrade           = "upgrade"            // 二进制升级（交接数据平面）
+	OpsRelayRegistered   = "relay_registered"   // 独立中继节点注册（首次心跳）
+	OpsRelayDeregistered = "relay_deregistered" // 独立中继节点注销
+)
+
+// 运维事件级别
+const (
+	OpsSeverityInfo    = "info"
+	OpsSeverityWarning = "warning"
+	OpsSeverityError   = "error"
+)
+
+// OpsEvent 运维事件（Controller 运行时间线），与安全审计日志相互独立
+type OpsEvent struct {
+	ID        uint64                 `json:"id"` // 进程内递增序号
+	Timestamp time.Time              `json:"timestamp"`
+	Type      string                 `json:"type"`
+	Component string                 `json:"component"` // relay、http、gateway、agent、service 等
+	Severity  string                 `json:"severity"`
+	Message   string                 `json:"message"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+}
+
+// opsEventLog 运维事件环形缓冲：写满后覆盖最旧的事件
+type opsEventLog struct {
+	mu     sync.RWMutex
+	events []*OpsEvent
+	next   int    // 下一条写入位置
+	seq    uint64 // 最近一条事件的 ID
+}
+
+// newOpsEventLog 创建容量为 capacity 的运维事件缓冲
+func newOpsEventLog(capacity int) *opsEventLog {
+	if capacity <= 0 {
+		capacity = defaultOpsEventCapacity
+	}
+	return &opsEventLog{events: make([]*OpsEvent, 0, capacity)}
+}
+
+// add 追加事件并分配 ID
+func (l *opsEventLog) add(event *OpsEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.seq++
+	event.ID = l.seq
+	if len(l.events) < cap(l.events) {
+		l.events = append(l.events, event)
+		return
+	}
+	l.events[l.next] = event
+	l.next = (l.next + 1) % len(l.events)
+}
+
+// capacity 返回缓冲容量
+func (l *opsEventLog) capacity() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return cap(l.events)
+}
+
+// opsEventFilter 查询条件（零值字段不过滤）
+type opsEventFilter struct {
+	Type      string
+	Component string
+	Since     time.Time
+	AfterID   uint64
+	Limit     int
+}
+
+// list 按时间倒序返回符合条件的事件，最多 filter.Limit 条
+func (l *opsEventLog) list(filter *opsEventFilter) []*OpsEvent {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	result := []*OpsEvent{}
+	for i := len(l.events) - 1; i >= 0; i-- {
+		event := l.events[(l.next+i)%len(l.events)]
+		if filter.Type != "" && event.Type != filter.Type {
+			continue
+		}
+		if filter.Component != "" && event.Component != filter.Component {
+			continue
+		}
+		if event.Timestamp.Before(filter.Since) || event.ID <= filter.AfterID {
+			continue
+		}
+		result = append(result, event)
+		if filter.Limit > 0 && len(result) >= filter.Limit {
+			break
+		}
+	}
+	return result
+}
+
+// recordOpsEvent 记录运维事件，配置了 OpsEventWebhooks 时异步转发
+func (c *Controller) recordOpsEvent(eventType, component, severity, message string, details map[string]interface{}) {
+	if c.opsEvents == nil {
+		return
+	}
+	event := &OpsEvent{
+		Timestamp: clock.Or(c.config.Clock).Now(),
+		Type:      eventType,
+		Component: component,
+		Severity:  severity,
+		Message:   message,
+		Details:   details,
+	}
+	c.opsEvents.add(event)
+
+	for _, webhook := range c.config.OpsEventWebhooks {
+		go func(webhook string) {
+			if err := postWebhook(c.webhookClient, webhook, event); err != nil {
+				c.logger.Warn("Ops event webhook failed", "webhook", webhook, "type", event.Type, "error", err)
+			}
+		}(webhook)
+	}
+}
+
+// handleAdminEvents lists ops events, newest first
+// Query parameters: type, component, since (RFC3339), after_id, limit (default 100, max 1000)
+func (c *Controller) handleAdminEvents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := &opsEventFilter{
+		Type:      query.Get("type"),
+		Component: query.Get("component"),
+		Limit:     defaultOpsEventLimit,
+	}
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			respondError(w, "INVALID_REQUEST", "Invalid limit", nil)
+			return
+		}
+		filter.Limit = min(n, maxOpsEventLimit)
+	}
+	if v := query.Get("since"); v != "" {
+		since, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			respondError(w, "INVALID_REQUEST", "Invalid since, expected RFC3339", nil)
+			return
+		}
+		filter.Since = since
+	}
+	if v := query.Get("after_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			respondError(w, "INVALID_REQUEST", "Invalid after_id", nil)
+			return
+		}
+		filter.AfterID = id
+	}
+
+	respondAdmin(w, "admin_events", map[string]interface{}{
+		"events":   c.opsEvents.list(filter),
+		"capacity": c.opsEvents.capacity(),
+	})
+}
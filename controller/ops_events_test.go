@@ -0,0 +1,106 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpsEventLog_RingBuffer(t *testing.T) {
+	log := newOpsEventLog(3)
+	start := time.Now()
+	for i := 1; i <= 5; i++ {
+		component := "relay"
+		if i%2 == 0 {
+			component = "agent"
+		}
+		log.add(&OpsEvent{Timestamp: start.Add(time.Duration(i) * time.Second), Type: OpsConfigChanged, Component: component, Message: fmt.Sprintf("event %d", i)})
+	}
+
+	// 容量 3：最旧的两条被覆盖，按时间倒序返回
+	events := log.list(&opsEventFilter{})
+	require.Len(t, events, 3)
+	assert.Equal(t, []uint64{5, 4, 3}, []uint64{events[0].ID, events[1].ID, events[2].ID})
+
+	events = log.list(&opsEventFilter{Component: "relay"})
+	require.Len(t, events, 2)
+	assert.Equal(t, "event 5", events[0].Message)
+
+	assert.Len(t, log.list(&opsEventFilter{Limit: 1}), 1)
+	assert.Len(t, log.list(&opsEventFilter{AfterID: 4}), 1)
+	assert.Len(t, log.list(&opsEventFilter{Since: start.Add(4 * time.Second)}), 2)
+	assert.Empty(t, log.list(&opsEventFilter{Type: OpsAgentConnected}))
+}
+
+func TestAdminAPI_Events(t *testing.T) {
+	received := make(chan OpsEvent, 8)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event OpsEvent
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&event))
+		received <- event
+	}))
+	defer webhook.Close()
+
+	c := newAdminTestController(t, &Config{OpsEventWebhooks: []string{webhook.URL}})
+	adminToken := createTestSession(t, c, "alice", "admin")
+
+	// 维护模式开关记录 config_changed
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/maintenance", bytes.NewReader([]byte(`{"message":"db migration"}`)))
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	c.mux.ServeHTTP(httptest.NewRecorder(), req)
+	c.recordOpsEvent(OpsRelayBindFailed, "relay", OpsSeverityError, "Data plane relay failed to start", map[string]interface{}{"error": "address in use"})
+
+	select {
+	case event := <-received:
+		assert.NotZero(t, event.ID)
+	case <-time.After(2 * time.Second):
+		t.Fatal("ops event not forwarded to webhook")
+	}
+
+	w := adminGet(c, "/api/v1/admin/events", adminToken)
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		Type     string      `json:"type"`
+		Capacity int         `json:"capacity"`
+		Events   []*OpsEvent `json:"events"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "admin_events", resp.Type)
+	assert.Equal(t, defaultOpsEventCapacity, resp.Capacity)
+	require.Len(t, resp.Events, 2)
+	assert.Equal(t, OpsRelayBindFailed, resp.Events[0].Type)
+	assert.Equal(t, "address in use", resp.Events[0].Details["error"])
+	assert.Equal(t, OpsConfigChanged, resp.Events[1].Type)
+	assert.Equal(t, "maintenance", resp.Events[1].Component)
+
+	w = adminGet(c, "/api/v1/admin/events?type="+OpsConfigChanged, adminToken)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Events, 1)
+
+	for _, query := range []string{"limit=0", "since=yesterday", "after_id=-1"} {
+		w = adminGet(c, "/api/v1/admin/events?"+query, adminToken)
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+
+	userToken := createTestSession(t, c, "bob", "user")
+	assert.Equal(t, http.StatusForbidden, adminGet(c, "/api/v1/admin/events", userToken).Code)
+}
+
+func TestConfig_OpsEventValidation(t *testing.T) {
+	base := Config{CertFile: "c", KeyFile: "k", CAFile: "ca", HTTPAddr: ":1", TCPProxyAddr: ":2"}
+
+	invalid := base
+	invalid.OpsEventWebhooks = []string{"ftp://x"}
+	assert.ErrorContains(t, invalid.Validate(), "ops event webhook")
+
+	negative := base
+	negative.OpsEventCapacity = -1
+	assert.ErrorContains(t, negative.Validate(), "ops event capacity")
+}
@@ -0,0 +1,92 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	"github.com/houzhh15/sdp-common/clock"
+	"github.com/houzhh15/sdp-common/tunnel"
+)
+
+const (
+	// defaultTunnelPairingTimeout 隧道创建后等待中继确认配对的默认时间（长于中继默认的 30 秒配对超时）
+	defaultTunnelPairingTimeout = 2 * time.Minute
+	// failedTunnelRetention failed 隧道的保留时间，期间 IH 与管理员可查询失败原因
+	failedTunnelRetention = time.Hour
+	// pairingCheckInterval 未配对隧道的扫描间隔
+	pairingCheckInterval = 10 * time.Second
+)
+
+// tunnelPairingTimeout 返回生效的配对确认超时，负数表示关闭
+func (c *Controller) tunnelPairingTimeout() time.Duration {
+	if c.config == nil || c.config.TunnelPairingTimeout == 0 {
+		return defaultTunnelPairingTimeout
+	}
+	return c.config.TunnelPairingTimeout
+}
+
+// watchTunnelPairing 周期将超时未配对的隧道转为 failed，并删除超过保留时间的 failed 隧道
+func (c *Controller) watchTunnelPairing(ctx context.Context) {
+	timeout := c.tunnelPairingTimeout()
+	if timeout < 0 {
+		return
+	}
+
+	clk := clock.Or(c.config.Clock)
+	ticker := clk.NewTicker(pairingCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			c.failUnpairedTunnels(ctx, clk.Now(), timeout)
+		}
+	}
+}
+
+// failUnpairedTunnels 执行一次扫描：创建超过 timeout 仍未配对的隧道转为 failed，吊销其临时凭据并向 IH 推送 tunnel_failed
+// 对账恢复的隧道（Controller 重启前已建立）与多跳隧道（由链上最后一跳中继配对，不一定是本中继）不参与判定
+func (c *Controller) failUnpairedTunnels(ctx context.Context, now time.Time, timeout time.Duration) {
+	tunnels, err := c.tunnelManager.ListTunnels(ctx, &tunnel.TunnelFilter{IncludeFailed: true})
+	if err != nil {
+		c.logger.Warn("Pairing scan: failed to list tunnels", "error", err)
+		return
+	}
+
+	for _, tun := range tunnels {
+		if tun.Status == tunnel.TunnelStatusFailed {
+			if now.Sub(tun.LastActive) >= failedTunnelRetention {
+				c.tunnelManager.DeleteTunnel(ctx, tun.ID)
+			}
+			continue
+		}
+		if !tun.PairedAt.IsZero() || now.Sub(tun.CreatedAt) < timeout {
+			continue
+		}
+		if reconciled, _ := tun.Metadata["reconciled"].(bool); reconciled || len(tun.RelayChain()) > 0 {
+			continue
+		}
+
+		failed := c.tunnelManager.MarkFailed(tun.ID, tunnel.TunnelFailurePairingTimeout, now)
+		if failed == nil {
+			continue
+		}
+		c.revokeTunnelCredential(ctx, tun.ID)
+		c.logger.Warn("Tunnel not paired within timeout",
+			"tunnel_id", tun.ID,
+			"client_id", tun.ClientID,
+			"service_id", tun.ServiceID,
+			"timeout", timeout)
+		c.notifyClient(tun.ClientID, &tunnel.ClientEvent{
+			Type:      tunnel.EventTunnelFailed,
+			ClientID:  tun.ClientID,
+			ServiceID: tun.ServiceID,
+			Details: map[string]interface{}{
+				"tunnel_id": tun.ID,
+				"reason":    failed.FailureReason,
+			},
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package controller
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/houzhh15/sdp-common/tunnel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTunnelPairingTimeout(t *testing.T) {
+	c, token := newIdempotencyTestController(t)
+	ctx := context.Background()
+
+	server := httptest.NewServer(http.HandlerFunc(c.handleClientEventsSSE))
+	defer server.Close()
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	defer c.tunnelNotifier.UnsubscribeClient("alice")
+
+	events := make(chan *tunnel.ClientEvent, 10)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			if data, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+				var event tunnel.ClientEvent
+				if json.Unmarshal([]byte(data), &event) == nil && event.Type == tunnel.EventTunnelFailed {
+					events <- &event
+				}
+			}
+		}
+	}()
+	for c.tunnelNotifier.ClientCount() == 0 {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	unpaired := tunnelIDFrom(t, postTunnel(c, token, "svc-1", ""))
+	paired := tunnelIDFrom(t, postTunnel(c, token, "svc-1", ""))
+	assert.True(t, c.tunnelManager.MarkPaired(paired, time.Now()))
+
+	// 超时前不判定
+	c.failUnpairedTunnels(ctx, time.Now(), time.Minute)
+	tunnels, err := c.tunnelManager.ListTunnels(ctx, nil)
+	require.NoError(t, err)
+	assert.Len(t, tunnels, 2)
+
+	c.failUnpairedTunnels(ctx, time.Now().Add(2*time.Minute), time.Minute)
+	tun, err := c.tunnelManager.GetTunnel(ctx, unpaired)
+	require.NoError(t, err)
+	assert.Equal(t, tunnel.TunnelStatusFailed, tun.Status)
+	assert.Equal(t, tunnel.TunnelFailurePairingTimeout, tun.FailureReason)
+	tun, err = c.tunnelManager.GetTunnel(ctx, paired)
+	require.NoError(t, err)
+	assert.Equal(t, tunnel.TunnelStatusActive, tun.Status)
+
+	select {
+	case event := <-events:
+		failure := event.TunnelFailure()
+		require.NotNil(t, failure)
+		assert.Equal(t, unpaired, failure.TunnelID)
+		assert.Equal(t, "svc-1", failure.ServiceID)
+		assert.Equal(t, tunnel.TunnelFailurePairingTimeout, failure.Reason)
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for tunnel_failed")
+	}
+
+	// 失败的隧道不再确认配对，默认不出现在列表中
+	assert.False(t, c.tunnelManager.MarkPaired(unpaired, time.Now()))
+	listTunnels := func(query string) []*tunnel.Tunnel {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/tunnels"+query, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		c.handleTunnels(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		var body struct {
+			Tunnels []*tunnel.Tunnel `json:"tunnels"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		return body.Tunnels
+	}
+	require.Len(t, listTunnels(""), 1)
+	assert.Equal(t, paired, listTunnels("")[0].ID)
+	assert.Len(t, listTunnels("?include_failed=true"), 2)
+	failed, err := c.tunnelManager.ListTunnels(ctx, &tunnel.TunnelFilter{Status: tunnel.TunnelStatusFailed})
+	require.NoError(t, err)
+	assert.Len(t, failed, 1)
+
+	// 保留期过后删除
+	c.failUnpairedTunnels(ctx, time.Now().Add(2*time.Minute+failedTunnelRetention), time.Minute)
+	_, err = c.tunnelManager.GetTunnel(ctx, unpaired)
+	assert.Error(t, err)
+	_, err = c.tunnelManager.GetTunnel(ctx, paired)
+	assert.NoError(t, err)
+}
+
+func TestInternalTunnelPaired(t *testing.T) {
+	c, token := newIdempotencyTestController(t)
+	tunnelID := tunnelIDFrom(t, postTunnel(c, token, "svc-1", ""))
+
+	post := func(path string) int {
+		w := httptest.NewRecorder()
+		c.handleInternalTunnel(w, httptest.NewRequest(http.MethodPost, path, nil))
+		return w.Code
+	}
+	assert.Equal(t, http.StatusNotFound, post("/internal/v1/tunnels/tunnel-missing/paired"))
+	assert.Equal(t, http.StatusBadRequest, post("/internal/v1/tunnels//paired"))
+	assert.Equal(t, http.StatusMethodNotAllowed, post("/internal/v1/tunnels/"+tunnelID))
+	assert.Equal(t, http.StatusNoContent, post("/internal/v1/tunnels/"+tunnelID+"/paired"))
+
+	tun, err := c.tunnelManager.GetTunnel(context.Background(), tunnelID)
+	require.NoError(t, err)
+	assert.False(t, tun.PairedAt.IsZero())
+	assert.Nil(t, c.tunnelManager.MarkFailed(tunnelID, tunnel.TunnelFailurePairingTimeout, time.Now()), "paired tunnels never fail")
+}
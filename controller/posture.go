@@ -0,0 +1,146 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/houzhh15/sdp-common/auth"
+	"github.com/houzhh15/sdp-common/logging"
+	"github.com/houzhh15/sdp-common/protocol"
+	"github.com/houzhh15/sdp-common/session"
+	"github.com/houzhh15/sdp-common/transport"
+)
+
+// postureReportPattern 设备指纹上报端点，由 handler 自行比对请求体中的设备信息
+const postureReportPattern = "/api/{version}/auth/posture"
+
+// devicePostureDriftPolicy 返回生效的设备指纹漂移处理策略，默认 flag
+func (c *Controller) devicePostureDriftPolicy() session.DriftPolicy {
+	if c.config != nil && c.config.DevicePostureDriftPolicy != "" {
+		return c.config.DevicePostureDriftPolicy
+	}
+	return session.DriftPolicyFlag
+}
+
+// postureGate 比对携带 Bearer 会话的请求中的设备指纹头，漂移时记录安全事件，revoke 策略下撤销会话并拒绝请求
+// 会话已记录设备指纹时，未携带指纹头同样视为漂移；握手未上报设备信息的会话不检查
+func (c *Controller) postureGate(pattern string, next http.HandlerFunc) http.HandlerFunc {
+	if pattern == postureReportPattern {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		hash := r.Header.Get(auth.DevicePostureHeader)
+		token := extractBearerToken(r)
+		if token == "" || c.sessionManager == nil {
+			next(w, r)
+			return
+		}
+		if _, revoked := c.checkDevicePosture(r, token, hash, "api_request"); revoked {
+			respondPostureDrift(w)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// checkDevicePosture 比对会话记录的设备指纹，漂移时记录 device_posture_drift 安全事件并按策略撤销会话
+// 会话无效时交由后续 handler 按原有逻辑拒绝
+func (c *Controller) checkDevicePosture(r *http.Request, token, hash, source string) (*session.PostureDrift, bool) {
+	drift, err := c.sessionManager.ObservePosture(r.Context(), token, hash)
+	if err != nil || drift == nil {
+		return nil, false
+	}
+
+	policy := c.devicePostureDriftPolicy()
+	revoke := policy == session.DriftPolicyRevoke
+	action := "flagged"
+	severity := logging.SeverityMedium
+	if revoke {
+		action = "revoked"
+		severity = logging.SeverityHigh
+	}
+
+	c.logger.Warn("Device posture drift detected",
+		"client_id", drift.ClientID,
+		"token", maskToken(token),
+		"source", source,
+		"drifts", drift.Drifts,
+		"action", action)
+	c.auditSecurity(r.Context(), &logging.SecurityEvent{
+		Timestamp: time.Now(),
+		ClientID:  drift.ClientID,
+		EventType: logging.EventDevicePostureDrift,
+		Severity:  severity,
+		Message:   "Session device posture differs from the one recorded at handshake",
+		Details: map[string]interface{}{
+			"token":         maskToken(token),
+			"expected_hash": drift.Expected,
+			"observed_hash": drift.Observed,
+			"missing":       drift.Observed == "",
+			"drifts":        drift.Drifts,
+			"source":        source,
+			"policy":        string(policy),
+			"action":        action,
+			"source_ip":     transport.ClientIPFromRequest(r),
+		},
+	})
+
+	if !revoke {
+		return drift, false
+	}
+	if err := c.sessionManager.RevokeSession(r.Context(), token); err != nil {
+		c.logger.Warn("Failed to revoke drifted session", "client_id", drift.ClientID, "error", err)
+		return drift, false
+	}
+	c.notifySessionRevoked(drift.ClientID, token, session.RevokeReasonPostureDrift)
+	return drift, true
+}
+
+// respondPostureDrift 会话因设备漂移被撤销
+func respondPostureDrift(w http.ResponseWriter) {
+	respondErrorWithStatus(w, "POSTURE_DRIFT", "Device posture changed, session revoked",
+		map[string]interface{}{"error_code": protocol.ErrCodePostureDrift}, http.StatusUnauthorized)
+}
+
+// handleSessionPosture handles device posture reports (POST, body auth.PostureReport)
+// 上报的设备信息与会话记录的指纹比对；flag 策略下新指纹成为会话基线
+func (c *Controller) handleSessionPosture(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := extractBearerToken(r)
+	if token == "" {
+		respondErrorWithStatus(w, "UNAUTHORIZED", "Missing authorization token", nil, http.StatusUnauthorized)
+		return
+	}
+	if _, err := c.sessionManager.ValidateSession(r.Context(), token); err != nil {
+		respondErrorWithStatus(w, "UNAUTHORIZED", "Invalid or expired session", nil, http.StatusUnauthorized)
+		return
+	}
+
+	var report auth.PostureReport
+	if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+		respondErrorWithStatus(w, "INVALID_REQUEST", "Invalid request body", nil, http.StatusBadRequest)
+		return
+	}
+	if err := report.Validate(); err != nil {
+		respondErrorWithStatus(w, "INVALID_REQUEST", err.Error(),
+			map[string]interface{}{"error_code": protocol.ErrCodeInvalidRequest}, http.StatusBadRequest)
+		return
+	}
+
+	drift, revoked := c.checkDevicePosture(r, token, report.DeviceInfo.PostureHash(), "posture_report")
+	if revoked {
+		respondPostureDrift(w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&auth.PostureResponse{
+		Drift:  drift != nil,
+		Policy: string(c.devicePostureDriftPolicy()),
+	})
+}
@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/houzhh15/sdp-common/auth"
+	"github.com/houzhh15/sdp-common/device"
+	"github.com/houzhh15/sdp-common/logging"
+	"github.com/houzhh15/sdp-common/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func postPosture(c *Controller, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/posture", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	c.handleSessionPosture(w, req)
+	return w
+}
+
+func adminGetWithPosture(c *Controller, path, token, hash string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set(auth.DevicePostureHeader, hash)
+	w := httptest.NewRecorder()
+	c.mux.ServeHTTP(w, req)
+	return w
+}
+
+func TestDevicePostureDrift(t *testing.T) {
+	cfg := &Config{}
+	c := newAdminTestController(t, cfg)
+	ctx := context.Background()
+
+	laptop := &device.Info{DeviceID: "laptop-1", OS: "linux"}
+	windows := &device.Info{DeviceID: "laptop-1", OS: "windows"}
+	sess, err := c.sessionManager.CreateSession(ctx, &session.CreateSessionRequest{ClientID: "alice", ClientClass: "admin", DeviceInfo: laptop})
+	require.NoError(t, err)
+
+	driftEvents := func() int {
+		events, err := c.auditLogger.Query(ctx, &logging.AuditFilter{EventType: logging.EventDevicePostureDrift})
+		require.NoError(t, err)
+		return len(events)
+	}
+
+	// flag：指纹一致或变化均放行，变化记录安全事件
+	assert.Equal(t, http.StatusOK, adminGetWithPosture(c, "/api/v1/admin/telemetry", sess.Token, laptop.PostureHash()).Code)
+	assert.Equal(t, 0, driftEvents())
+	assert.Equal(t, http.StatusOK, adminGetWithPosture(c, "/api/v1/admin/telemetry", sess.Token, windows.PostureHash()).Code)
+	assert.Equal(t, 1, driftEvents())
+
+	// 未携带指纹头同样是漂移，基线不变
+	assert.Equal(t, http.StatusOK, adminGetWithPosture(c, "/api/v1/admin/telemetry", sess.Token, "").Code)
+	assert.Equal(t, 2, driftEvents())
+	assert.Equal(t, http.StatusOK, adminGetWithPosture(c, "/api/v1/admin/telemetry", sess.Token, windows.PostureHash()).Code)
+	assert.Equal(t, 2, driftEvents())
+
+	// 上报与当前基线一致的设备信息不是漂移
+	w := postPosture(c, sess.Token, `{"device_info":{"device_id":"laptop-1","os":"windows"}}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp auth.PostureResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.False(t, resp.Drift)
+	assert.Equal(t, "flag", resp.Policy)
+
+	assert.Equal(t, http.StatusBadRequest, postPosture(c, sess.Token, `{"device_info":{"os":"linux"}}`).Code)
+
+	// revoke：漂移后撤销会话并返回 POSTURE_DRIFT
+	cfg.DevicePostureDriftPolicy = session.DriftPolicyRevoke
+	w = postPosture(c, sess.Token, `{"device_info":{"device_id":"laptop-2","os":"darwin"}}`)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "POSTURE_DRIFT")
+	assert.Equal(t, 3, driftEvents())
+	_, err = c.sessionManager.ValidateSession(ctx, sess.Token)
+	assert.Error(t, err)
+
+	other, err := c.sessionManager.CreateSession(ctx, &session.CreateSessionRequest{ClientID: "root", ClientClass: "admin", DeviceInfo: laptop})
+	require.NoError(t, err)
+	w = adminGetWithPosture(c, "/api/v1/admin/telemetry", other.Token, windows.PostureHash())
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "POSTURE_DRIFT")
+
+	// 省略指纹头不能绕过 revoke
+	stolen, err := c.sessionManager.CreateSession(ctx, &session.CreateSessionRequest{ClientID: "root", ClientClass: "admin", DeviceInfo: laptop})
+	require.NoError(t, err)
+	w = adminGetWithPosture(c, "/api/v1/admin/telemetry", stolen.Token, "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "POSTURE_DRIFT")
+	_, err = c.sessionManager.ValidateSession(ctx, stolen.Token)
+	assert.Error(t, err)
+
+	// 握手未上报设备信息的会话不检查
+	bare, err := c.sessionManager.CreateSession(ctx, &session.CreateSessionRequest{ClientID: "root", ClientClass: "admin"})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, adminGetWithPosture(c, "/api/v1/admin/telemetry", bare.Token, "").Code)
+
+	assert.Error(t, (&Config{DevicePostureDriftPolicy: "ignore"}).DevicePostureDriftPolicy.Validate())
+}
@@ -0,0 +1,145 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/houzhh15/sdp-common/clock"
+)
+
+// defaultRelayStartTimeout 启动时等待数据平面中继就绪的最长时间，超时后 HTTP 服务照常启动，隧道创建返回 RELAY_UNAVAILABLE
+const defaultRelayStartTimeout = 10 * time.Second
+
+var (
+	errRelayStarting = errors.New("relay is starting")
+	errRelayStopped  = errors.New("relay is not accepting connections")
+)
+
+// relayReadiness 本地数据平面中继的启动结果（就绪由 relayServer.Ready 通知，这里只记录启动失败）
+type relayReadiness struct {
+	failed chan struct{} // 启动失败后关闭
+	once   sync.Once
+	err    error // close(failed) 之前写入
+}
+
+func newRelayReadiness() *relayReadiness {
+	return &relayReadiness{failed: make(chan struct{})}
+}
+
+// fail 记录启动失败原因（只记录第一次）
+func (r *relayReadiness) fail(err error) {
+	if r == nil {
+		return
+	}
+	r.once.Do(func() {
+		r.err = err
+		close(r.failed)
+	})
+}
+
+// relayFailed 标记中继启动失败，并记录 relay_bind_failed 运维事件
+func (c *Controller) relayFailed(err error) {
+	c.relayReady.fail(err)
+	c.recordOpsEvent(OpsRelayBindFailed, "relay", OpsSeverityError, "Data plane relay failed to start",
+		map[string]interface{}{"error": err.Error()})
+}
+
+// relayStatus 返回中继的监听地址；不可用（启动中、启动失败、排空中或已停止）时返回原因。
+// relayReady 为 nil（未通过 New 创建，不启动本地数据平面）时不检查
+func (c *Controller) relayStatus() (string, error) {
+	if c.relayReady == nil {
+		return "", nil
+	}
+	select {
+	case <-c.relayReady.failed:
+		return "", c.relayReady.err
+	default:
+	}
+	select {
+	case <-c.relayServer.Ready():
+	default:
+		return "", errRelayStarting
+	}
+	addr := c.relayServer.Addr()
+	if addr == nil {
+		return "", errRelayStopped
+	}
+	return addr.String(), nil
+}
+
+// waitRelay 等待中继就绪或启动失败，最长 timeout
+func (c *Controller) waitRelay(timeout time.Duration) error {
+	if c.relayReady == nil {
+		return nil
+	}
+	if timeout <= 0 {
+		timeout = defaultRelayStartTimeout
+	}
+
+	select {
+	case <-c.relayServer.Ready():
+		return nil
+	case <-c.relayReady.failed:
+		return c.relayReady.err
+	case <-clock.Or(c.config.Clock).After(timeout):
+		return errRelayStarting
+	}
+}
+
+// readinessCheck /readyz 中单项检查的结果
+type readinessCheck struct {
+	Status  string `json:"status"` // up / down
+	Addr    string `json:"addr,omitempty"`
+	Error   string `json:"error,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// handleReadyz 就绪检查：数据平面中继已监听且数据库可用时返回 200，否则返回 503（负载均衡据此摘除实例）
+// 维护模式不影响状态码（GET 与 SSE 仍需可达），status 为 "maintenance" 并附带 maintenance 检查项
+func (c *Controller) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]*readinessCheck{}
+	ready := true
+
+	relay := &readinessCheck{Status: "up"}
+	if addr, err := c.relayStatus(); err != nil {
+		relay.Status, relay.Error = "down", err.Error()
+		ready = false
+	} else {
+		relay.Addr = addr
+	}
+	checks["relay"] = relay
+
+	if c.db != nil {
+		database := &readinessCheck{Status: "up"}
+		ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+		defer cancel()
+		sqlDB, err := c.db.DB()
+		if err == nil {
+			err = sqlDB.PingContext(ctx)
+		}
+		if err != nil {
+			database.Status, database.Error = "down", err.Error()
+			ready = false
+		}
+		checks["database"] = database
+	}
+
+	status, code := "ready", http.StatusOK
+	if maintenance := c.maintenance.status(); maintenance.Enabled {
+		checks["maintenance"] = &readinessCheck{Status: "maintenance", Message: maintenance.Message}
+		status = "maintenance"
+	}
+	if !ready {
+		status, code = "not_ready", http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": status,
+		"checks": checks,
+	})
+}
@@ -0,0 +1,80 @@
+package controller
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func getReadyz(t *testing.T, c *Controller) (int, map[string]*readinessCheck) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	c.handleReadyz(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	var resp struct {
+		Checks map[string]*readinessCheck `json:"checks"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return w.Code, resp.Checks
+}
+
+func TestReadiness_RelayGatesTunnelCreation(t *testing.T) {
+	c, token := newIdempotencyTestController(t)
+	c.relayReady = newRelayReadiness()
+	defer c.relayServer.Stop()
+
+	// 中继尚未监听
+	w := postTunnel(c, token, "svc-1", "")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Contains(t, w.Body.String(), "RELAY_UNAVAILABLE")
+	assert.Equal(t, "5", w.Header().Get("Retry-After"))
+
+	code, checks := getReadyz(t, c)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "down", checks["relay"].Status)
+	assert.Equal(t, errRelayStarting.Error(), checks["relay"].Error)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go c.relayServer.Serve(ln, &tls.Config{})
+	require.NoError(t, c.waitRelay(time.Second))
+
+	code, checks = getReadyz(t, c)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "up", checks["relay"].Status)
+	assert.Equal(t, ln.Addr().String(), checks["relay"].Addr)
+
+	assert.Equal(t, http.StatusCreated, postTunnel(c, token, "svc-1", "").Code)
+
+	// 停止后重新不可用
+	require.NoError(t, c.relayServer.Stop())
+	assert.Equal(t, http.StatusServiceUnavailable, postTunnel(c, token, "svc-1", "").Code)
+}
+
+func TestReadiness_RelayStartFailure(t *testing.T) {
+	c, _ := newIdempotencyTestController(t)
+	c.relayReady = newRelayReadiness()
+
+	bindErr := errors.New("listen tcp :9443: bind: address already in use")
+	c.relayReady.fail(bindErr)
+	c.relayReady.fail(errors.New("ignored"))
+
+	assert.Equal(t, bindErr, c.waitRelay(time.Second))
+	code, checks := getReadyz(t, c)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, bindErr.Error(), checks["relay"].Error)
+}
+
+func TestReadiness_WaitRelayTimeout(t *testing.T) {
+	c := newAdminTestController(t, &Config{})
+	c.relayReady = newRelayReadiness()
+
+	assert.ErrorIs(t, c.waitRelay(20*time.Millisecond), errRelayStarting)
+}
@@ -0,0 +1,225 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/houzhh15/sdp-common/clock"
+	"github.com/houzhh15/sdp-common/logging"
+	"github.com/houzhh15/sdp-common/policy"
+	"github.com/houzhh15/sdp-common/transport"
+	"github.com/houzhh15/sdp-common/tunnel"
+)
+
+// defaultReconcileGracePeriod 启动后等待 AH 重连上报隧道的时间，之后断开中继上仍未知的隧道
+const defaultReconcileGracePeriod = 2 * time.Minute
+
+// isInitiatingHost reports whether the request carries an IH client certificate
+// (CN starting with "ih", consistent with the data plane relay)
+func isInitiatingHost(r *http.Request) bool {
+	return r.TLS != nil && len(r.TLS.PeerCertificates) > 0 && strings.HasPrefix(r.TLS.PeerCertificates[0].Subject.CommonName, "ih")
+}
+
+// verifiedAgentID returns the agent identity (certificate CN) of a request carrying a
+// verified AH client certificate; IH certificates and unverified peers yield false
+func verifiedAgentID(r *http.Request) (string, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return "", false
+	}
+	cn := r.TLS.VerifiedChains[0][0].Subject.CommonName
+	if cn == "" || strings.HasPrefix(cn, "ih") {
+		return "", false
+	}
+	return cn, true
+}
+
+// handleTunnelReconcile handles AH tunnel reports after (re)connecting to the SSE stream
+// Known tunnels are kept, valid unknown tunnels are rebuilt (Controller restart),
+// the rest are returned for the AH to terminate and disconnected on the relay
+func (c *Controller) handleTunnelReconcile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 仅持有已验证 AH 证书的 agent 可上报隧道，agent 身份取自证书 CN
+	agentID, ok := verifiedAgentID(r)
+	if !ok {
+		respondErrorWithStatus(w, "FORBIDDEN", "Only agents may reconcile tunnels", nil, http.StatusForbidden)
+		return
+	}
+
+	var report tunnel.ReconcileReport
+	if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+		respondErrorWithStatus(w, "INVALID_REQUEST", "Invalid request body", nil, http.StatusBadRequest)
+		return
+	}
+	if report.AgentID == "" {
+		respondErrorWithStatus(w, "INVALID_REQUEST", "Missing agent_id", nil, http.StatusBadRequest)
+		return
+	}
+	if report.AgentID != agentID {
+		respondErrorWithStatus(w, "FORBIDDEN", "agent_id does not match client certificate", nil, http.StatusForbidden)
+		return
+	}
+
+	ctx := r.Context()
+	result := c.reconcileTunnels(ctx, &report)
+
+	c.logger.Info("Tunnels reconciled",
+		"agent_id", report.AgentID,
+		"kept", len(result.Kept),
+		"rebuilt", len(result.Rebuilt),
+		"terminate", len(result.Terminate))
+	c.auditAccess(ctx, &logging.AccessEvent{
+		ClientID: report.AgentID,
+		SourceIP: transport.ClientIPFromRequest(r),
+		Action:   "tunnel_reconcile",
+		Result:   "success",
+		Details: map[string]interface{}{
+			"kept":      result.Kept,
+			"rebuilt":   result.Rebuilt,
+			"terminate": result.Terminate,
+		},
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"type":      "tunnel_reconcile",
+		"status":    "success",
+		"kept":      result.Kept,
+		"rebuilt":   result.Rebuilt,
+		"terminate": result.Terminate,
+	})
+}
+
+// reconcileTunnels classifies the reported tunnels against the tunnel manager
+func (c *Controller) reconcileTunnels(ctx context.Context, report *tunnel.ReconcileReport) *tunnel.ReconcileResult {
+	result := &tunnel.ReconcileResult{Kept: []string{}, Rebuilt: []string{}, Terminate: []string{}}
+
+	for _, reported := range report.Tunnels {
+		if reported == nil || reported.TunnelID == "" {
+			continue
+		}
+
+		tun, err := c.tunnelManager.GetTunnel(ctx, reported.TunnelID)
+		serviceID := reported.ServiceID
+		if err == nil {
+			serviceID = tun.ServiceID
+		}
+		// 服务不存在或注册于其他 agent 的隧道不保留、不重建，也不在中继上断开，仅由上报方释放
+		if !c.agentServesService(ctx, report.AgentID, serviceID) {
+			c.logger.Warn("Reported tunnel not served by agent",
+				"tunnel_id", reported.TunnelID,
+				"agent_id", report.AgentID,
+				"service_id", serviceID)
+			result.Terminate = append(result.Terminate, reported.TunnelID)
+			continue
+		}
+
+		if err == nil {
+			if tun.Status == tunnel.TunnelStatusFailed {
+				// 未能配对的隧道不会再使用，AH 释放其资源
+				result.Terminate = append(result.Terminate, reported.TunnelID)
+				continue
+			}
+			result.Kept = append(result.Kept, reported.TunnelID)
+			continue
+		}
+
+		if reason := c.restoreReportedTunnel(ctx, reported); reason != "" {
+			c.logger.Warn("Reported tunnel rejected",
+				"tunnel_id", reported.TunnelID,
+				"agent_id", report.AgentID,
+				"client_id", reported.ClientID,
+				"service_id", reported.ServiceID,
+				"reason", reason)
+			result.Terminate = append(result.Terminate, reported.TunnelID)
+			if c.relayServer != nil {
+				c.relayServer.CloseTunnelWithReason(reported.TunnelID, tunnel.RelayCloseRejected)
+			}
+			continue
+		}
+		result.Rebuilt = append(result.Rebuilt, reported.TunnelID)
+	}
+
+	return result
+}
+
+// restoreReportedTunnel rebuilds an unknown tunnel if it would still be allowed today,
+// returning the rejection reason otherwise
+func (c *Controller) restoreReportedTunnel(ctx context.Context, reported *tunnel.ReportedTunnel) string {
+	now := time.Now()
+	if !reported.ExpiresAt.IsZero() && !reported.ExpiresAt.After(now) {
+		return "tunnel expired"
+	}
+	if reported.ClientID == "" {
+		return "missing client_id"
+	}
+
+	serviceConfig, err := c.tunnelManager.GetServiceConfig(ctx, reported.ServiceID)
+	if err != nil {
+		return "service not found"
+	}
+
+	// 固定服务以当前配置为准（由 Controller 解析域名的服务，AH 上报的是解析出的 IP）
+	host, port := reported.TargetHost, reported.TargetPort
+	if !serviceConfig.IsPattern() {
+		host, port = "", 0
+	}
+	targetHost, targetPort, err := serviceConfig.ResolveTarget(host, port)
+	if err != nil {
+		return "invalid target: " + err.Error()
+	}
+
+	decision, err := c.policyEngine.EvaluateAccess(ctx, &policy.AccessRequest{
+		ClientID:  reported.ClientID,
+		ServiceID: reported.ServiceID,
+		Timestamp: now,
+	})
+	if err != nil {
+		return "policy denied"
+	}
+	if !decision.Allowed {
+		return "policy denied: " + decision.Reason
+	}
+
+	if _, err := c.tunnelManager.RestoreTunnel(ctx, reported, serviceConfig, targetHost, targetPort); err != nil {
+		return "restore failed: " + err.Error()
+	}
+	return ""
+}
+
+// sweepRelayTunnels disconnects relayed tunnels still unknown once the reconcile
+// grace period after startup has passed (their AH never reported them)
+func (c *Controller) sweepRelayTunnels(ctx context.Context) {
+	grace := c.config.ReconcileGracePeriod
+	if grace <= 0 {
+		grace = defaultReconcileGracePeriod
+	}
+
+	select {
+	case <-ctx.Done():
+		return
+	case <-clock.Or(c.config.Clock).After(grace):
+	}
+
+	closed := 0
+	for _, stats := range c.relayServer.GetTunnelStats() {
+		tunnelID := strings.TrimRight(stats.TunnelID, "\x00")
+		if _, err := c.tunnelManager.GetTunnel(ctx, tunnelID); err == nil {
+			continue
+		}
+		if c.relayServer.CloseTunnelWithReason(tunnelID, tunnel.RelayCloseUnknownTunnel) {
+			closed++
+			c.logger.Warn("Unknown relay tunnel closed after reconcile grace period", "tunnel_id", tunnelID, "client", stats.Client)
+		}
+	}
+	if closed > 0 {
+		c.logger.Info("Relay tunnels reconciled", "closed", closed)
+	}
+}
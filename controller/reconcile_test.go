@@ -0,0 +1,135 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/houzhh15/sdp-common/service"
+	"github.com/houzhh15/sdp-common/tunnel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withAgentCert 为请求附加 CN 为 agentID 的已验证客户端证书
+func withAgentCert(req *http.Request, agentID string) *http.Request {
+	peer := &x509.Certificate{Subject: pkix.Name{CommonName: agentID}}
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{peer}, VerifiedChains: [][]*x509.Certificate{{peer}}}
+	return req
+}
+
+func serveReconcile(c *Controller, certCN string, report *tunnel.ReconcileReport) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(report)
+	req := withAgentCert(httptest.NewRequest(http.MethodPost, "/api/v1/tunnels/reconcile", bytes.NewReader(body)), certCN)
+	w := httptest.NewRecorder()
+	c.handleTunnelReconcile(w, req)
+	return w
+}
+
+func postReconcile(t *testing.T, c *Controller, report *tunnel.ReconcileReport) *tunnel.ReconcileResult {
+	t.Helper()
+	w := serveReconcile(c, report.AgentID, report)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var result tunnel.ReconcileResult
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	return &result
+}
+
+func TestTunnelReconcile_AfterRestart(t *testing.T) {
+	c, token := newIdempotencyTestController(t)
+	ctx := context.Background()
+
+	created := postTunnel(c, token, "svc-1", "")
+	require.Equal(t, http.StatusCreated, created.Code)
+	knownID := tunnelIDFrom(t, created)
+
+	result := postReconcile(t, c, &tunnel.ReconcileReport{
+		AgentID: "ah-1",
+		Tunnels: []*tunnel.ReportedTunnel{
+			{TunnelID: knownID, ClientID: "alice", ServiceID: "svc-1"},
+			// Controller 重启前创建、内存中已丢失的隧道
+			{TunnelID: "tunnel-lost", ClientID: "alice", ServiceID: "svc-1", TargetHost: "127.0.0.1", TargetPort: 8080, Multiplex: true, CreatedAt: time.Now().Add(-time.Hour)},
+			{TunnelID: "tunnel-no-service", ClientID: "alice", ServiceID: "svc-deleted"},
+			{TunnelID: "tunnel-no-policy", ClientID: "bob", ServiceID: "svc-1"},
+			{TunnelID: "tunnel-expired", ClientID: "alice", ServiceID: "svc-1", ExpiresAt: time.Now().Add(-time.Minute)},
+		},
+	})
+
+	assert.Equal(t, []string{knownID}, result.Kept)
+	assert.Equal(t, []string{"tunnel-lost"}, result.Rebuilt)
+	assert.ElementsMatch(t, []string{"tunnel-no-service", "tunnel-no-policy", "tunnel-expired"}, result.Terminate)
+
+	restored, err := c.tunnelManager.GetTunnel(ctx, "tunnel-lost")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", restored.ClientID)
+	assert.Equal(t, "127.0.0.1", restored.Metadata["target_host"])
+	assert.Equal(t, 8080, restored.Metadata["target_port"])
+	assert.Equal(t, true, restored.Metadata["reconciled"])
+	assert.True(t, restored.IsMultiplexed())
+
+	for _, id := range result.Terminate {
+		_, err := c.tunnelManager.GetTunnel(ctx, id)
+		assert.Error(t, err, id)
+	}
+
+	// 重连后再次上报：重建的隧道视为已知
+	again := postReconcile(t, c, &tunnel.ReconcileReport{
+		AgentID: "ah-1",
+		Tunnels: []*tunnel.ReportedTunnel{{TunnelID: "tunnel-lost", ClientID: "alice", ServiceID: "svc-1"}},
+	})
+	assert.Equal(t, []string{"tunnel-lost"}, again.Kept)
+	assert.Empty(t, again.Rebuilt)
+}
+
+func TestTunnelReconcile_AgentIdentity(t *testing.T) {
+	c, token := newIdempotencyTestController(t)
+	ctx := context.Background()
+
+	created := postTunnel(c, token, "svc-1", "")
+	require.Equal(t, http.StatusCreated, created.Code)
+	knownID := tunnelIDFrom(t, created)
+	c.mux = http.NewServeMux()
+	c.registerHandlers()
+	require.Equal(t, http.StatusOK, registerServices(c, "ah-2", service.Service{ID: "svc-2", TargetHost: "127.0.0.1", TargetPort: 9090}).Code)
+
+	// 上报的 agent_id 必须与证书一致
+	report := &tunnel.ReconcileReport{AgentID: "ah-2", Tunnels: []*tunnel.ReportedTunnel{{TunnelID: knownID, ClientID: "alice", ServiceID: "svc-1"}}}
+	assert.Equal(t, http.StatusForbidden, serveReconcile(c, "ah-1", report).Code)
+	// IH 证书与未验证的连接不能上报
+	assert.Equal(t, http.StatusForbidden, serveReconcile(c, "ih-client", &tunnel.ReconcileReport{AgentID: "ih-client"}).Code)
+	w := httptest.NewRecorder()
+	c.handleTunnelReconcile(w, httptest.NewRequest(http.MethodPost, "/api/v1/tunnels/reconcile", bytes.NewReader([]byte(`{"agent_id":"ah-1"}`))))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// 其他 agent 注册的服务的隧道既不保留也不重建
+	result := postReconcile(t, c, &tunnel.ReconcileReport{
+		AgentID: "ah-1",
+		Tunnels: []*tunnel.ReportedTunnel{
+			{TunnelID: "tunnel-foreign", ClientID: "alice", ServiceID: "svc-2"},
+		},
+	})
+	assert.Empty(t, result.Kept)
+	assert.Empty(t, result.Rebuilt)
+	assert.Equal(t, []string{"tunnel-foreign"}, result.Terminate)
+	_, err := c.tunnelManager.GetTunnel(ctx, "tunnel-foreign")
+	assert.Error(t, err)
+}
+
+func TestTunnelReconcile_InvalidRequest(t *testing.T) {
+	c, _ := newIdempotencyTestController(t)
+
+	w := serveReconcile(c, "ah-1", &tunnel.ReconcileReport{})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	c.handleTunnelReconcile(w, httptest.NewRequest(http.MethodGet, "/api/v1/tunnels/reconcile", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
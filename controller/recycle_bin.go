@@ -0,0 +1,154 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/houzhh15/sdp-common/clock"
+	"github.com/houzhh15/sdp-common/logging"
+	"github.com/houzhh15/sdp-common/transport"
+)
+
+// defaultRecycleBinRetention 已删除策略与服务默认保留 30 天
+const defaultRecycleBinRetention = 30 * 24 * time.Hour
+
+// 回收站对象类型
+const (
+	recycleKindPolicy  = "policy"
+	recycleKindService = "service"
+)
+
+// recycleRequest 回收站恢复请求
+type recycleRequest struct {
+	Kind string `json:"kind"` // "policy" / "service"
+	ID   string `json:"id"`
+}
+
+// recycleBinRetention 返回生效的回收站保留时间
+func (c *Controller) recycleBinRetention() time.Duration {
+	if c.config != nil && c.config.RecycleBinRetention > 0 {
+		return c.config.RecycleBinRetention
+	}
+	return defaultRecycleBinRetention
+}
+
+// handleAdminRecycleBin lists soft-deleted policies and services (GET)
+// or permanently purges one object (DELETE ?kind=policy|service&id=...)
+func (c *Controller) handleAdminRecycleBin(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if r.Method == http.MethodDelete {
+		req := &recycleRequest{Kind: r.URL.Query().Get("kind"), ID: r.URL.Query().Get("id")}
+		if req.ID == "" {
+			respondErrorWithStatus(w, "INVALID_REQUEST", "id is required", nil, http.StatusBadRequest)
+			return
+		}
+
+		var err error
+		switch req.Kind {
+		case recycleKindPolicy:
+			err = c.policyEngine.PurgePolicy(ctx, req.ID)
+		case recycleKindService:
+			err = c.tunnelManager.PurgeServiceConfig(ctx, req.ID)
+		default:
+			respondErrorWithStatus(w, "INVALID_REQUEST", "kind must be policy or service", nil, http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			respondErrorWithStatus(w, "NOT_FOUND", "Object not found in recycle bin", nil, http.StatusNotFound)
+			return
+		}
+
+		c.auditRecycleBin(r, "recycle_bin_purge", req)
+		respondAdmin(w, "recycle_bin_purged", map[string]interface{}{"kind": req.Kind, "id": req.ID})
+		return
+	}
+
+	policies, err := c.policyEngine.ListDeletedPolicies(ctx)
+	if err != nil {
+		c.logger.Error("Failed to list deleted policies", "error", err)
+		respondErrorWithStatus(w, "INTERNAL_ERROR", "Failed to retrieve recycle bin", nil, http.StatusInternalServerError)
+		return
+	}
+
+	respondAdmin(w, "admin_recycle_bin", map[string]interface{}{
+		"policies":       policies,
+		"services":       c.tunnelManager.ListDeletedServiceConfigs(ctx),
+		"retention_days": int(c.recycleBinRetention().Hours() / 24),
+	})
+}
+
+// handleAdminRecycleBinRestore restores a soft-deleted policy or service
+func (c *Controller) handleAdminRecycleBinRestore(w http.ResponseWriter, r *http.Request) {
+	var req recycleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID == "" {
+		respondErrorWithStatus(w, "INVALID_REQUEST", "Invalid request body", nil, http.StatusBadRequest)
+		return
+	}
+
+	var (
+		restored interface{}
+		err      error
+	)
+	switch req.Kind {
+	case recycleKindPolicy:
+		restored, err = c.policyEngine.RestorePolicy(r.Context(), req.ID)
+	case recycleKindService:
+		restored, err = c.tunnelManager.RestoreServiceConfig(r.Context(), req.ID)
+	default:
+		respondErrorWithStatus(w, "INVALID_REQUEST", "kind must be policy or service", nil, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		respondErrorWithStatus(w, "NOT_FOUND", "Object not found in recycle bin", nil, http.StatusNotFound)
+		return
+	}
+
+	c.auditRecycleBin(r, "recycle_bin_restore", &req)
+	respondAdmin(w, "recycle_bin_restored", map[string]interface{}{"kind": req.Kind, req.Kind: restored})
+}
+
+// auditRecycleBin 记录回收站恢复/永久删除操作
+func (c *Controller) auditRecycleBin(r *http.Request, action string, req *recycleRequest) {
+	clientID := ""
+	if sess, err := c.sessionManager.ValidateSession(r.Context(), extractBearerToken(r)); err == nil {
+		clientID = sess.ClientID
+	}
+
+	c.logger.Info("Recycle bin operation", "action", action, "kind", req.Kind, "id", req.ID, "client_id", clientID)
+	c.auditAccess(r.Context(), &logging.AccessEvent{
+		ClientID: clientID,
+		SourceIP: transport.ClientIPFromRequest(r),
+		Action:   action,
+		Result:   "success",
+		Details:  map[string]interface{}{"kind": req.Kind, "id": req.ID},
+	})
+}
+
+// purgeRecycleBin periodically deletes policies and services kept in the recycle bin longer than RecycleBinRetention
+func (c *Controller) purgeRecycleBin(ctx context.Context) {
+	retention := c.recycleBinRetention()
+
+	clk := clock.Or(c.config.Clock)
+	ticker := clk.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		policies, err := c.policyEngine.PurgeDeletedPolicies(ctx, retention)
+		if err != nil {
+			c.logger.Warn("Failed to purge deleted policies", "error", err)
+		}
+		services := c.tunnelManager.PurgeDeletedServiceConfigs(clk.Now().Add(-retention))
+		if policies > 0 || services > 0 {
+			c.logger.Info("Recycle bin purged", "policies", policies, "services", services)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+	}
+}
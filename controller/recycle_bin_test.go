@@ -0,0 +1,76 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/houzhh15/sdp-common/policy"
+	"github.com/houzhh15/sdp-common/tunnel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func recycleBinRequest(c *Controller, method, path, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	c.mux.ServeHTTP(w, req)
+	return w
+}
+
+func TestAdminRecycleBin(t *testing.T) {
+	c, token := newIdempotencyTestController(t)
+	adminToken := createTestSession(t, c, "root", "admin")
+	ctx := context.Background()
+
+	require.NoError(t, c.policyEngine.DeletePolicy(ctx, "p1"))
+	require.NoError(t, c.tunnelManager.DeleteServiceConfig(ctx, "svc-1"))
+
+	// 已删除的服务与策略不再参与隧道创建
+	assert.NotEqual(t, http.StatusCreated, postTunnel(c, token, "svc-1", "").Code)
+	_, err := c.tunnelManager.GetServiceConfig(ctx, "svc-1")
+	assert.Error(t, err)
+
+	var bin struct {
+		Policies      []*policy.Policy        `json:"policies"`
+		Services      []*tunnel.ServiceConfig `json:"services"`
+		RetentionDays int                     `json:"retention_days"`
+	}
+	w := adminGet(c, "/api/v1/admin/recycle-bin", adminToken)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &bin))
+	require.Len(t, bin.Policies, 1)
+	require.Len(t, bin.Services, 1)
+	assert.Equal(t, "p1", bin.Policies[0].PolicyID)
+	assert.NotNil(t, bin.Services[0].DeletedAt)
+	assert.Equal(t, 30, bin.RetentionDays)
+
+	assert.Equal(t, http.StatusForbidden, adminGet(c, "/api/v1/admin/recycle-bin", token).Code)
+
+	// 恢复后重新生效
+	assert.Equal(t, http.StatusOK, recycleBinRequest(c, http.MethodPost, "/api/v1/admin/recycle-bin/restore", adminToken, `{"kind":"policy","id":"p1"}`).Code)
+	assert.Equal(t, http.StatusOK, recycleBinRequest(c, http.MethodPost, "/api/v1/admin/recycle-bin/restore", adminToken, `{"kind":"service","id":"svc-1"}`).Code)
+	assert.Equal(t, http.StatusNotFound, recycleBinRequest(c, http.MethodPost, "/api/v1/admin/recycle-bin/restore", adminToken, `{"kind":"service","id":"svc-1"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, recycleBinRequest(c, http.MethodPost, "/api/v1/admin/recycle-bin/restore", adminToken, `{"kind":"tunnel","id":"x"}`).Code)
+	assert.Equal(t, http.StatusCreated, postTunnel(c, token, "svc-1", "").Code)
+
+	// 永久删除
+	require.NoError(t, c.tunnelManager.DeleteServiceConfig(ctx, "svc-1"))
+	assert.Equal(t, http.StatusOK, recycleBinRequest(c, http.MethodDelete, "/api/v1/admin/recycle-bin?kind=service&id=svc-1", adminToken, "").Code)
+	assert.Equal(t, http.StatusNotFound, recycleBinRequest(c, http.MethodPost, "/api/v1/admin/recycle-bin/restore", adminToken, `{"kind":"service","id":"svc-1"}`).Code)
+
+	// 超过保留期的条目被清理
+	require.NoError(t, c.policyEngine.DeletePolicy(ctx, "p1"))
+	require.NoError(t, c.tunnelManager.CreateServiceConfig(ctx, &tunnel.ServiceConfig{ServiceID: "svc-2", TargetHost: "127.0.0.1", TargetPort: 80}))
+	require.NoError(t, c.tunnelManager.DeleteServiceConfig(ctx, "svc-2"))
+	assert.Equal(t, 0, c.tunnelManager.PurgeDeletedServiceConfigs(time.Now().Add(-time.Hour)))
+	assert.Equal(t, 1, c.tunnelManager.PurgeDeletedServiceConfigs(time.Now().Add(time.Second)))
+	purged, err := c.policyEngine.PurgeDeletedPolicies(ctx, -time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+}
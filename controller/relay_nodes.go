@@ -0,0 +1,146 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/houzhh15/sdp-common/cert"
+	"github.com/houzhh15/sdp-common/clock"
+	"github.com/houzhh15/sdp-common/relay"
+)
+
+// relayStaleHeartbeats 超过该数量的心跳间隔未收到注册时，中继节点在列表中标记为离线
+const relayStaleHeartbeats = 3
+
+// RelayNode 已注册的独立中继节点（GET /internal/v1/relays、/api/{version}/admin/relays）
+type RelayNode struct {
+	relay.Registration
+	Identity     string    `json:"identity"` // 内部身份 URI
+	RegisteredAt time.Time `json:"registered_at"`
+	LastSeen     time.Time `json:"last_seen"`
+	Online       bool      `json:"online"` // 最近 relayStaleHeartbeats 个心跳间隔内有心跳
+}
+
+// relayNodeRegistry 独立中继节点注册表（内存），节点周期心跳，Controller 重启后由下一次心跳重建
+type relayNodeRegistry struct {
+	mu    sync.Mutex
+	nodes map[string]*RelayNode
+}
+
+func newRelayNodeRegistry() *relayNodeRegistry {
+	return &relayNodeRegistry{nodes: make(map[string]*RelayNode)}
+}
+
+// upsert 记录注册或心跳，返回是否为新注册的节点
+func (r *relayNodeRegistry) upsert(reg *relay.Registration, identity string, now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	node, ok := r.nodes[reg.NodeID]
+	if !ok {
+		node = &RelayNode{RegisteredAt: now}
+		r.nodes[reg.NodeID] = node
+	}
+	node.Registration = *reg
+	node.Identity = identity
+	node.LastSeen = now
+	return !ok
+}
+
+// remove 删除节点，返回节点是否存在
+func (r *relayNodeRegistry) remove(nodeID string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.nodes[nodeID]
+	delete(r.nodes, nodeID)
+	return ok
+}
+
+// list 按节点 ID 排序返回副本，并按最近心跳计算 Online
+func (r *relayNodeRegistry) list(now time.Time) []*RelayNode {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	nodes := make([]*RelayNode, 0, len(r.nodes))
+	for _, node := range r.nodes {
+		copied := *node
+		interval := copied.HeartbeatInterval
+		if interval <= 0 {
+			interval = relay.DefaultHeartbeatInterval
+		}
+		copied.Online = now.Sub(copied.LastSeen) <= relayStaleHeartbeats*interval
+		nodes = append(nodes, &copied)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].NodeID < nodes[j].NodeID })
+	return nodes
+}
+
+// handleInternalRelays lists registered relay nodes (GET /internal/v1/relays)
+func (c *Controller) handleInternalRelays(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondErrorWithStatus(w, "METHOD_NOT_ALLOWED", "Method not allowed", nil, http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"relays": c.relayNodes.list(clock.Or(c.config.Clock).Now()),
+	})
+}
+
+// handleInternalRelay registers (PUT, body relay.Registration) or deregisters (DELETE) a relay node.
+// 节点只能以自身内部身份（relay 角色、ID 与路径一致）注册或注销
+func (c *Controller) handleInternalRelay(w http.ResponseWriter, r *http.Request) {
+	nodeID := strings.TrimPrefix(r.URL.Path, "/internal/v1/relays/")
+	if nodeID == "" || strings.Contains(nodeID, "/") {
+		respondErrorWithStatus(w, "INVALID_REQUEST", "Invalid relay node ID", nil, http.StatusBadRequest)
+		return
+	}
+	peer, err := c.internal.policy.Authorize(r.TLS.PeerCertificates[0])
+	if err != nil || peer.Role != cert.RoleRelay || peer.ID != nodeID {
+		respondErrorWithStatus(w, "FORBIDDEN", "Relay nodes may only register themselves", nil, http.StatusForbidden)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		var reg relay.Registration
+		if err := json.NewDecoder(r.Body).Decode(&reg); err != nil {
+			respondErrorWithStatus(w, "INVALID_REQUEST", "Invalid request body", nil, http.StatusBadRequest)
+			return
+		}
+		if reg.NodeID != nodeID || reg.AdvertiseAddr == "" {
+			respondErrorWithStatus(w, "INVALID_REQUEST", "node_id must match the path and advertise_addr is required", nil, http.StatusBadRequest)
+			return
+		}
+		if c.relayNodes.upsert(&reg, peer.URI(), clock.Or(c.config.Clock).Now()) {
+			c.logger.Info("Relay node registered", "node_id", nodeID, "advertise_addr", reg.AdvertiseAddr, "version", reg.Version)
+			c.recordOpsEvent(OpsRelayRegistered, "relay", OpsSeverityInfo, "Relay node registered", map[string]interface{}{
+				"node_id":        nodeID,
+				"advertise_addr": reg.AdvertiseAddr,
+				"version":        reg.Version,
+			})
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	case http.MethodDelete:
+		if c.relayNodes.remove(nodeID) {
+			c.logger.Info("Relay node deregistered", "node_id", nodeID)
+			c.recordOpsEvent(OpsRelayDeregistered, "relay", OpsSeverityInfo, "Relay node deregistered", map[string]interface{}{
+				"node_id": nodeID,
+			})
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		respondErrorWithStatus(w, "METHOD_NOT_ALLOWED", "Method not allowed", nil, http.StatusMethodNotAllowed)
+	}
+}
+
+// handleAdminRelays returns the registered standalone relay nodes
+func (c *Controller) handleAdminRelays(w http.ResponseWriter, r *http.Request) {
+	respondAdmin(w, "admin_relays", map[string]interface{}{
+		"relays": c.relayNodes.list(clock.Or(c.config.Clock).Now()),
+	})
+}
@@ -0,0 +1,109 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/houzhh15/sdp-common/config"
+	"github.com/houzhh15/sdp-common/relay"
+	"github.com/houzhh15/sdp-common/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRelayNodeRegistration(t *testing.T) {
+	pki := newInternalTestPKI(t)
+	ctrlCert, ctrlKey := pki.issue("ctrl-1", "spiffe://sdp.internal/controller/ctrl-1")
+	relayCert, relayKey := pki.issue("relay-1", "spiffe://sdp.internal/relay/relay-1")
+	dataCert, dataKey := pki.issue("relay-1-data", "")
+
+	cfg := &Config{Internal: &InternalConfig{CertFile: ctrlCert, KeyFile: ctrlKey, CAFile: pki.CAFile}}
+	c := newAdminTestController(t, cfg)
+	internal, err := newInternalRPC(cfg)
+	require.NoError(t, err)
+	c.internal = internal
+	c.registerInternalHandlers()
+
+	server := httptest.NewUnstartedServer(internal.mux)
+	server.TLS = pki.manager(ctrlCert, ctrlKey).GetInternalServerTLSConfig(cfg.Internal.PeerPolicy())
+	server.StartTLS()
+	defer server.Close()
+
+	relayCfg := &relay.Config{
+		ListenAddr:    "127.0.0.1:0",
+		AdvertiseAddr: "relay-1.example.com:9443",
+		TLS:           config.TLSConfig{CertFile: dataCert, KeyFile: dataKey, CAFile: pki.CAFile},
+		Controller: relay.ControllerConfig{
+			Addrs:             []string{server.Listener.Addr().String()},
+			CertFile:          relayCert,
+			KeyFile:           relayKey,
+			CAFile:            pki.CAFile,
+			HeartbeatInterval: 50 * time.Millisecond,
+		},
+		DrainTimeout: time.Second,
+	}
+	relayCfg.SetDefaults()
+	node, err := relay.New(relayCfg, c.logger)
+	require.NoError(t, err)
+	assert.Equal(t, "relay-1", node.Identity().ID)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- node.Run(ctx) }()
+
+	require.Eventually(t, func() bool { return len(c.relayNodes.list(time.Now())) == 1 }, 5*time.Second, 20*time.Millisecond)
+	nodes := c.relayNodes.list(time.Now())
+	assert.Equal(t, "relay-1.example.com:9443", nodes[0].AdvertiseAddr)
+	assert.Equal(t, "spiffe://sdp.internal/relay/relay-1", nodes[0].Identity)
+	assert.True(t, nodes[0].Online)
+	assert.False(t, c.relayNodes.list(time.Now().Add(time.Second))[0].Online, "node should go offline after missed heartbeats")
+
+	// 管理接口列出已注册节点
+	admin, err := c.sessionManager.CreateSession(context.Background(), &session.CreateSessionRequest{ClientID: "root", ClientClass: "admin"})
+	require.NoError(t, err)
+	w := adminGet(c, "/api/v1/admin/relays", admin.Token)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), "relay-1.example.com:9443")
+
+	// 退出时注销
+	cancel()
+	require.NoError(t, <-done)
+	assert.Empty(t, c.relayNodes.list(time.Now()))
+}
+
+func TestRelayNodeRegistration_RejectsOtherIdentity(t *testing.T) {
+	pki := newInternalTestPKI(t)
+	ctrlCert, ctrlKey := pki.issue("ctrl-1", "spiffe://sdp.internal/controller/ctrl-1")
+	relayCert, relayKey := pki.issue("relay-2", "spiffe://sdp.internal/relay/relay-2")
+
+	cfg := &Config{Internal: &InternalConfig{CertFile: ctrlCert, KeyFile: ctrlKey, CAFile: pki.CAFile}}
+	c := newAdminTestController(t, cfg)
+	internal, err := newInternalRPC(cfg)
+	require.NoError(t, err)
+	c.internal = internal
+
+	put := func(peer *x509.Certificate, path string, reg *relay.Registration) int {
+		body, _ := json.Marshal(reg)
+		req := httptest.NewRequest(http.MethodPut, path, bytes.NewReader(body))
+		req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{peer}}
+		w := httptest.NewRecorder()
+		c.handleInternalRelay(w, req)
+		return w.Code
+	}
+	relay2 := pki.manager(relayCert, relayKey).GetX509Certificate()
+	ctrl := pki.manager(ctrlCert, ctrlKey).GetX509Certificate()
+
+	// 只能以自身身份注册
+	assert.Equal(t, http.StatusForbidden, put(relay2, "/internal/v1/relays/relay-1", &relay.Registration{NodeID: "relay-1", AdvertiseAddr: "relay-1:9443"}))
+	assert.Equal(t, http.StatusForbidden, put(ctrl, "/internal/v1/relays/ctrl-1", &relay.Registration{NodeID: "ctrl-1", AdvertiseAddr: "ctrl-1:9443"}))
+	assert.Equal(t, http.StatusBadRequest, put(relay2, "/internal/v1/relays/relay-2", &relay.Registration{NodeID: "relay-2"}))
+	assert.Equal(t, http.StatusNoContent, put(relay2, "/internal/v1/relays/relay-2", &relay.Registration{NodeID: "relay-2", AdvertiseAddr: "relay-2:9443"}))
+	assert.Len(t, c.relayNodes.list(time.Now()), 1)
+}
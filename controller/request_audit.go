@@ -0,0 +1,259 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/houzhh15/sdp-common/logging"
+	"github.com/houzhh15/sdp-common/transport"
+)
+
+const (
+	// actionAPIRequest 写请求审计事件的 Action
+	actionAPIRequest = "api_request"
+
+	// maxAuditBodyBytes 审计记录的请求体上限，超过时只记录大小
+	maxAuditBodyBytes = 64 << 10
+
+	// redactedValue 脱敏后的字段值
+	redactedValue = "[REDACTED]"
+)
+
+// auditSecretPathPatterns 路径中的对象 ID 本身是凭据的端点（DELETE /sessions/{token}），记录时掩码
+var auditSecretPathPatterns = map[string]bool{
+	"/api/{version}/sessions/": true,
+}
+
+// defaultAuditRedactFields 请求体中默认脱敏的字段：字段名（不区分大小写）等于规则或以 "_"+规则 结尾，
+// 如 session_token、client_secret、db_password
+var defaultAuditRedactFields = []string{
+	"password",
+	"passphrase",
+	"secret",
+	"token",
+	"private_key",
+	"api_key",
+	"credentials",
+	"authorization",
+}
+
+// auditStatusWriter 记录 handler 写出的状态码
+type auditStatusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *auditStatusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *auditStatusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// requestAudit 将 pattern 的写请求（POST、PUT、PATCH、DELETE）记录为 api_request 审计事件：
+// 操作者、端点、对象 ID、结果与脱敏后的请求体。未配置审计日志时不做任何处理
+func (c *Controller) requestAudit(pattern string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next(w, r)
+			return
+		}
+		if c.auditLogger == nil {
+			next(w, r)
+			return
+		}
+
+		body, truncated := peekRequestBody(r)
+		var fields map[string]interface{}
+		if !truncated && len(body) > 0 {
+			json.Unmarshal(body, &fields)
+		}
+
+		// 在 handler 之前解析操作者：撤销会话的请求执行后会话已失效
+		clientID, clientClass := c.requestActor(r, fields)
+
+		start := time.Now()
+		sw := &auditStatusWriter{ResponseWriter: w}
+		next(sw, r)
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+
+		path := r.URL.Path
+		objectIDs := requestObjectIDs(pattern, path, fields)
+		if id := objectIDs["id"]; id != "" && auditSecretPathPatterns[pattern] {
+			objectIDs["id"] = maskToken(id)
+			path = strings.Replace(path, id, objectIDs["id"], 1)
+		}
+		serviceID := objectIDs["service_id"]
+		if serviceID == "" && strings.HasSuffix(pattern, "/services/") {
+			serviceID = objectIDs["id"]
+		}
+		details := map[string]interface{}{
+			"method":      r.Method,
+			"endpoint":    pattern,
+			"path":        path,
+			"status":      sw.status,
+			"duration_ms": time.Since(start).Milliseconds(),
+		}
+		if clientClass != "" {
+			details["client_class"] = clientClass
+		}
+		if len(objectIDs) > 0 {
+			details["object_ids"] = objectIDs
+		}
+		switch {
+		case truncated:
+			details["request_body_truncated"] = true
+		case fields != nil:
+			details["request_body"] = redactAuditFields(fields, c.auditRedactFields())
+		case len(body) > 0:
+			details["request_body_bytes"] = len(body)
+		}
+
+		event := &logging.AccessEvent{
+			ClientID:  clientID,
+			ServiceID: serviceID,
+			SourceIP:  transport.ClientIPFromRequest(r),
+			Action:    actionAPIRequest,
+			Result:    auditResult(sw.status),
+			Details:   details,
+		}
+		if event.Result != "success" {
+			event.Reason = http.StatusText(sw.status)
+		}
+		c.auditAccess(r.Context(), event)
+	}
+}
+
+// peekRequestBody 读取请求体用于审计，并恢复 r.Body 供 handler 完整读取
+// 超过 maxAuditBodyBytes 时 truncated 为 true
+func peekRequestBody(r *http.Request) (body []byte, truncated bool) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, false
+	}
+	buf, err := io.ReadAll(io.LimitReader(r.Body, maxAuditBodyBytes+1))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(buf), r.Body), r.Body}
+	if err != nil {
+		return nil, false
+	}
+	if len(buf) > maxAuditBodyBytes {
+		return nil, true
+	}
+	return buf, false
+}
+
+// requestActor 请求的操作者：Bearer 会话、请求体中的 session_token，或 mTLS 客户端证书
+func (c *Controller) requestActor(r *http.Request, fields map[string]interface{}) (clientID, clientClass string) {
+	token := extractBearerToken(r)
+	if token == "" {
+		token, _ = fields["session_token"].(string)
+	}
+	if token != "" && c.sessionManager != nil {
+		if sess, err := c.sessionManager.ValidateSession(r.Context(), token); err == nil {
+			return sess.ClientID, sess.ClientClass
+		}
+	}
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		peer := r.TLS.PeerCertificates[0]
+		return c.extractClientID(peer), c.extractClientClass(peer)
+	}
+	return "", ""
+}
+
+// requestObjectIDs 请求涉及的对象 ID：路径中 pattern 之后的部分（如 /tunnels/{id}）记为 "id"，
+// 以及请求体中字符串类型的 id / *_id 字段
+func requestObjectIDs(pattern, path string, fields map[string]interface{}) map[string]string {
+	ids := make(map[string]string)
+	if strings.HasSuffix(pattern, "/") {
+		resource := pattern[strings.LastIndex(strings.TrimSuffix(pattern, "/"), "/"):]
+		if i := strings.LastIndex(path, resource); i >= 0 {
+			if id := strings.Trim(path[i+len(resource):], "/"); id != "" {
+				ids["id"] = id
+			}
+		}
+	}
+	for key, value := range fields {
+		s, ok := value.(string)
+		if !ok || s == "" || (key != "id" && !strings.HasSuffix(key, "_id")) {
+			continue
+		}
+		ids[key] = s
+	}
+	return ids
+}
+
+// auditRedactFields 默认脱敏规则与 Config.AuditRedactFields 合并
+func (c *Controller) auditRedactFields() []string {
+	if c.config == nil || len(c.config.AuditRedactFields) == 0 {
+		return defaultAuditRedactFields
+	}
+	rules := make([]string, 0, len(defaultAuditRedactFields)+len(c.config.AuditRedactFields))
+	rules = append(rules, defaultAuditRedactFields...)
+	for _, rule := range c.config.AuditRedactFields {
+		rules = append(rules, strings.ToLower(rule))
+	}
+	return rules
+}
+
+// redactAuditFields 返回脱敏后的副本，递归处理嵌套对象与数组
+func redactAuditFields(value interface{}, rules []string) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, field := range v {
+			if redactAuditField(key, rules) {
+				out[key] = redactedValue
+				continue
+			}
+			out[key] = redactAuditFields(field, rules)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = redactAuditFields(item, rules)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// redactAuditField 字段名是否命中脱敏规则
+func redactAuditField(key string, rules []string) bool {
+	key = strings.ToLower(key)
+	for _, rule := range rules {
+		if key == rule || strings.HasSuffix(key, "_"+rule) {
+			return true
+		}
+	}
+	return false
+}
+
+// auditResult 按状态码归类请求结果：2xx/3xx 为 success，401/403 为 denied，其余为 failure
+func auditResult(status int) string {
+	switch {
+	case status < http.StatusBadRequest:
+		return "success"
+	case status == http.StatusUnauthorized, status == http.StatusForbidden:
+		return "denied"
+	default:
+		return "failure"
+	}
+}
@@ -0,0 +1,138 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/houzhh15/sdp-common/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func apiRequestEvents(t *testing.T, c *Controller) []*logging.AccessEvent {
+	t.Helper()
+	logs, err := c.auditLogger.Query(context.Background(), &logging.AuditFilter{Action: actionAPIRequest})
+	require.NoError(t, err)
+	events := make([]*logging.AccessEvent, 0, len(logs))
+	for _, log := range logs {
+		events = append(events, log.Data.(*logging.AccessEvent))
+	}
+	return events
+}
+
+func TestRequestAudit_TunnelCreate(t *testing.T) {
+	c, token := newIdempotencyTestController(t)
+	c.mux = http.NewServeMux()
+	c.registerHandlers()
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"session_token": token,
+		"service_id":    "svc-1",
+		"protocol":      "tcp",
+		"options":       map[string]interface{}{"db_password": "hunter2"},
+	})
+	w := serveRequest(c, http.MethodPost, "/api/v1/tunnels", "", string(body))
+	require.Less(t, w.Code, http.StatusBadRequest, w.Body.String())
+
+	// 读请求不审计
+	serveRequest(c, http.MethodGet, "/api/v1/tunnels", token, "")
+
+	events := apiRequestEvents(t, c)
+	require.Len(t, events, 1)
+	event := events[0]
+	assert.Equal(t, "alice", event.ClientID)
+	assert.Equal(t, "svc-1", event.ServiceID)
+	assert.Equal(t, "success", event.Result)
+	assert.Equal(t, http.MethodPost, event.Details["method"])
+	assert.Equal(t, "/api/{version}/tunnels", event.Details["endpoint"])
+	assert.Equal(t, w.Code, event.Details["status"])
+	assert.Equal(t, map[string]string{"service_id": "svc-1"}, event.Details["object_ids"])
+
+	recorded := event.Details["request_body"].(map[string]interface{})
+	assert.Equal(t, redactedValue, recorded["session_token"])
+	assert.Equal(t, redactedValue, recorded["options"].(map[string]interface{})["db_password"])
+	assert.Equal(t, "tcp", recorded["protocol"])
+}
+
+func TestRequestAudit_OutcomeAndPathIDs(t *testing.T) {
+	c, token := newIdempotencyTestController(t)
+	c.mux = http.NewServeMux()
+	c.registerHandlers()
+
+	// 非管理员开启维护模式被拒绝
+	w := serveRequest(c, http.MethodPost, "/api/v1/admin/maintenance", token, `{}`)
+	require.Equal(t, http.StatusForbidden, w.Code)
+
+	w = serveRequest(c, http.MethodPost, "/api/v1/tunnels", token, `{"service_id":`)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	// 撤销会话：执行后会话失效，操作者仍可识别；路径中的令牌被掩码
+	w = serveRequest(c, http.MethodDelete, "/api/v1/sessions/"+token, token, "")
+	require.Less(t, w.Code, http.StatusBadRequest, w.Body.String())
+
+	events := apiRequestEvents(t, c)
+	require.Len(t, events, 3)
+
+	assert.Equal(t, "denied", events[0].Result)
+	assert.Equal(t, "alice", events[0].ClientID)
+
+	assert.Equal(t, "failure", events[1].Result)
+	assert.NotEmpty(t, events[1].Reason)
+	assert.Equal(t, len(`{"service_id":`), events[1].Details["request_body_bytes"], "non-JSON bodies are recorded by size only")
+
+	assert.Equal(t, "success", events[2].Result)
+	assert.Equal(t, "alice", events[2].ClientID)
+	assert.Equal(t, map[string]string{"id": maskToken(token)}, events[2].Details["object_ids"])
+	assert.NotContains(t, events[2].Details["path"], token)
+}
+
+func TestRequestAudit_LargeBody(t *testing.T) {
+	c, token := newIdempotencyTestController(t)
+	c.mux = http.NewServeMux()
+	c.registerHandlers()
+
+	body := `{"session_token":"` + token + `","service_id":"svc-1","padding":"` + strings.Repeat("x", maxAuditBodyBytes) + `"}`
+	w := serveRequest(c, http.MethodPost, "/api/v1/tunnels", "", body)
+	require.Less(t, w.Code, http.StatusBadRequest, "handler must still see the full body: %s", w.Body.String())
+
+	events := apiRequestEvents(t, c)
+	require.Len(t, events, 1)
+	assert.Equal(t, true, events[0].Details["request_body_truncated"])
+	assert.NotContains(t, events[0].Details, "request_body")
+}
+
+func TestRedactAuditFields(t *testing.T) {
+	c := &Controller{config: &Config{AuditRedactFields: []string{"Webhook_URL"}}}
+	rules := c.auditRedactFields()
+
+	in := map[string]interface{}{
+		"client_secret": "s3cr3t",
+		"Authorization": "Bearer x",
+		"secrets":       []interface{}{"kept"},
+		"policy_id":     "p1",
+		"alerts": []interface{}{
+			map[string]interface{}{"webhook_url": "https://hooks.example", "threshold": 10.0},
+		},
+	}
+	out := redactAuditFields(in, rules).(map[string]interface{})
+
+	assert.Equal(t, redactedValue, out["client_secret"])
+	assert.Equal(t, redactedValue, out["Authorization"])
+	assert.Equal(t, []interface{}{"kept"}, out["secrets"])
+	assert.Equal(t, "p1", out["policy_id"])
+	alert := out["alerts"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, redactedValue, alert["webhook_url"])
+	assert.Equal(t, 10.0, alert["threshold"])
+	assert.Equal(t, "s3cr3t", in["client_secret"], "input must not be modified")
+}
+
+func TestAuditResult(t *testing.T) {
+	assert.Equal(t, "success", auditResult(http.StatusCreated))
+	assert.Equal(t, "success", auditResult(http.StatusNotModified))
+	assert.Equal(t, "denied", auditResult(http.StatusUnauthorized))
+	assert.Equal(t, "denied", auditResult(http.StatusForbidden))
+	assert.Equal(t, "failure", auditResult(http.StatusServiceUnavailable))
+}
@@ -0,0 +1,296 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/houzhh15/sdp-common/policy"
+	"github.com/houzhh15/sdp-common/tunnel"
+)
+
+// SeedMode 声明式文件（PoliciesFile / ServicesFile）与现有对象的协调方式
+type SeedMode string
+
+const (
+	// SeedModeCreate 只创建不存在的对象，已存在的对象保持不变
+	SeedModeCreate SeedMode = "create"
+	// SeedModeUpdate 创建不存在的对象并更新与文件不一致的对象（默认）
+	SeedModeUpdate SeedMode = "update"
+	// SeedModePrune 同 update，并删除文件中没有的对象（移入回收站，可恢复）
+	SeedModePrune SeedMode = "prune"
+)
+
+// Validate 校验协调方式（空值表示默认 update）
+func (m SeedMode) Validate() error {
+	switch m {
+	case "", SeedModeCreate, SeedModeUpdate, SeedModePrune:
+		return nil
+	}
+	return fmt.Errorf("invalid seed mode %q (expected create, update or prune)", m)
+}
+
+// servicesFile 声明式服务文件结构
+//
+//	services:
+//	  - service_id: web
+//	    target_host: 10.0.0.5
+//	    target_port: 443
+//	    protocol: tcp
+type servicesFile struct {
+	Services []*tunnel.ServiceConfig `json:"services"`
+}
+
+// policiesFile 声明式策略文件结构
+//
+//	policies:
+//	  - policy_id: web-alice
+//	    client_id: alice
+//	    service_id: web
+//	    expiry_time: 2027-01-01T00:00:00Z
+type policiesFile struct {
+	Policies []*policy.Policy `json:"policies"`
+}
+
+// seedResult 一次协调的结果
+type seedResult struct {
+	Created   int
+	Updated   int
+	Deleted   int
+	Unchanged int
+}
+
+// applySeedFiles 启动时加载并协调声明式服务与策略文件；服务先于策略处理，策略可引用文件中的服务。
+// 任一文件无法解析或校验失败时不做任何修改
+func (c *Controller) applySeedFiles(ctx context.Context) error {
+	mode := c.config.SeedMode
+	if mode == "" {
+		mode = SeedModeUpdate
+	}
+
+	var services servicesFile
+	if c.config.ServicesFile != "" {
+		if err := readSeedFile(c.config.ServicesFile, &services); err != nil {
+			return err
+		}
+		if err := validateSeedServices(services.Services); err != nil {
+			return fmt.Errorf("%s: %w", c.config.ServicesFile, err)
+		}
+	}
+	var policies policiesFile
+	if c.config.PoliciesFile != "" {
+		if err := readSeedFile(c.config.PoliciesFile, &policies); err != nil {
+			return err
+		}
+		if err := validateSeedPolicies(policies.Policies); err != nil {
+			return fmt.Errorf("%s: %w", c.config.PoliciesFile, err)
+		}
+	}
+
+	if c.config.ServicesFile != "" {
+		result, err := c.seedServices(ctx, services.Services, mode)
+		if err != nil {
+			return fmt.Errorf("%s: %w", c.config.ServicesFile, err)
+		}
+		c.logger.Info("Declarative services applied", "file", c.config.ServicesFile, "mode", mode,
+			"created", result.Created, "updated", result.Updated, "deleted", result.Deleted, "unchanged", result.Unchanged)
+	}
+	if c.config.PoliciesFile != "" {
+		result, err := c.seedPolicies(ctx, policies.Policies, mode)
+		if err != nil {
+			return fmt.Errorf("%s: %w", c.config.PoliciesFile, err)
+		}
+		c.logger.Info("Declarative policies applied", "file", c.config.PoliciesFile, "mode", mode,
+			"created", result.Created, "updated", result.Updated, "deleted", result.Deleted, "unchanged", result.Unchanged)
+	}
+	return nil
+}
+
+// readSeedFile 读取 YAML（或 JSON）文件，字段名沿用 API 的 JSON 字段名
+func readSeedFile(path string, out interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", path, err)
+	}
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+	// 经 JSON 转换后解码，ServiceConfig / Policy 只有 json 标签
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(out); err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+	return nil
+}
+
+// validateSeedServices 校验服务文件：service_id 必填且唯一，配置满足创建服务时的校验
+func validateSeedServices(services []*tunnel.ServiceConfig) error {
+	seen := make(map[string]bool, len(services))
+	for i, svc := range services {
+		if svc == nil || svc.ServiceID == "" {
+			return fmt.Errorf("services[%d]: service_id is required", i)
+		}
+		if seen[svc.ServiceID] {
+			return fmt.Errorf("services[%d]: duplicate service_id %s", i, svc.ServiceID)
+		}
+		seen[svc.ServiceID] = true
+		if err := validateServiceConfig(svc); err != nil {
+			return fmt.Errorf("service %s: %w", svc.ServiceID, err)
+		}
+	}
+	return nil
+}
+
+// validateSeedPolicies 校验策略文件：policy_id、client_id、service_id 必填，policy_id 唯一，条件合法
+func validateSeedPolicies(policies []*policy.Policy) error {
+	seen := make(map[string]bool, len(policies))
+	for i, pol := range policies {
+		if pol == nil || pol.PolicyID == "" {
+			return fmt.Errorf("policies[%d]: policy_id is required", i)
+		}
+		if seen[pol.PolicyID] {
+			return fmt.Errorf("policies[%d]: duplicate policy_id %s", i, pol.PolicyID)
+		}
+		seen[pol.PolicyID] = true
+		if pol.ClientID == "" || pol.ServiceID == "" {
+			return fmt.Errorf("policy %s: client_id and service_id are required", pol.PolicyID)
+		}
+		if err := policy.ValidateConditions(pol.Conditions); err != nil {
+			return fmt.Errorf("policy %s: %w", pol.PolicyID, err)
+		}
+	}
+	return nil
+}
+
+// seedServices 按 mode 将声明的服务与现有服务协调
+func (c *Controller) seedServices(ctx context.Context, desired []*tunnel.ServiceConfig, mode SeedMode) (*seedResult, error) {
+	existing, err := c.tunnelManager.ListServiceConfigs(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("list services: %w", err)
+	}
+	current := make(map[string]*tunnel.ServiceConfig, len(existing))
+	for _, svc := range existing {
+		current[svc.ServiceID] = svc
+	}
+
+	result := &seedResult{}
+	declared := make(map[string]bool, len(desired))
+	for _, svc := range desired {
+		declared[svc.ServiceID] = true
+		if svc.Status == "" {
+			svc.Status = tunnel.ServiceStatusActive
+		}
+		old, ok := current[svc.ServiceID]
+		switch {
+		case !ok:
+			if err := c.tunnelManager.CreateServiceConfig(ctx, svc); err != nil {
+				return nil, fmt.Errorf("create service %s: %w", svc.ServiceID, err)
+			}
+			result.Created++
+		case mode == SeedModeCreate || sameService(old, svc):
+			result.Unchanged++
+		default:
+			svc.CreatedAt = old.CreatedAt
+			if err := c.tunnelManager.UpdateServiceConfig(ctx, svc); err != nil {
+				return nil, fmt.Errorf("update service %s: %w", svc.ServiceID, err)
+			}
+			result.Updated++
+		}
+	}
+
+	if mode == SeedModePrune {
+		for serviceID := range current {
+			if declared[serviceID] {
+				continue
+			}
+			if err := c.tunnelManager.DeleteServiceConfig(ctx, serviceID); err != nil {
+				return nil, fmt.Errorf("delete service %s: %w", serviceID, err)
+			}
+			result.Deleted++
+		}
+	}
+	return result, nil
+}
+
+// seedPolicies 按 mode 将声明的策略与现有策略协调
+func (c *Controller) seedPolicies(ctx context.Context, desired []*policy.Policy, mode SeedMode) (*seedResult, error) {
+	existing, err := c.policyEngine.ListPolicies(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	current := make(map[string]*policy.Policy, len(existing))
+	for _, pol := range existing {
+		current[pol.PolicyID] = pol
+	}
+
+	result := &seedResult{}
+	declared := make(map[string]bool, len(desired))
+	for _, pol := range desired {
+		declared[pol.PolicyID] = true
+		old, ok := current[pol.PolicyID]
+		switch {
+		case ok && (mode == SeedModeCreate || samePolicy(old, pol)):
+			result.Unchanged++
+			continue
+		case ok:
+			pol.CreatedAt = old.CreatedAt
+			result.Updated++
+		default:
+			result.Created++
+		}
+		if err := c.policyEngine.SavePolicy(ctx, pol); err != nil {
+			return nil, err
+		}
+	}
+
+	if mode == SeedModePrune {
+		for policyID := range current {
+			if declared[policyID] {
+				continue
+			}
+			if err := c.policyEngine.DeletePolicy(ctx, policyID); err != nil {
+				return nil, err
+			}
+			result.Deleted++
+		}
+	}
+	return result, nil
+}
+
+// sameService 比较服务配置（忽略时间戳）
+func sameService(a, b *tunnel.ServiceConfig) bool {
+	x, y := *a, *b
+	x.CreatedAt, x.UpdatedAt, x.DeletedAt = y.CreatedAt, y.UpdatedAt, y.DeletedAt
+	return sameJSON(&x, &y)
+}
+
+// samePolicy 比较策略（忽略时间戳；存储返回的过期时间可能带不同时区）
+func samePolicy(a, b *policy.Policy) bool {
+	x, y := *a, *b
+	x.CreatedAt, x.UpdatedAt, x.DeletedAt = y.CreatedAt, y.UpdatedAt, y.DeletedAt
+	x.ExpiryTime, y.ExpiryTime = x.ExpiryTime.UTC(), y.ExpiryTime.UTC()
+	return sameJSON(&x, &y)
+}
+
+// sameJSON 按 JSON 编码比较，条件值等 interface{} 字段经存储往返后类型可能不同（如 int 与 float64）
+func sameJSON(a, b interface{}) bool {
+	x, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	y, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(x, y)
+}
@@ -0,0 +1,161 @@
+package controller
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/houzhh15/sdp-common/policy"
+	"github.com/houzhh15/sdp-common/tunnel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeSeedFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+const seedServicesYAML = `
+services:
+  - service_id: web
+    service_name: Web
+    target_host: 10.0.0.5
+    target_port: 443
+    protocol: tcp
+  - service_id: db
+    target_host: 10.0.0.6
+    target_port: 5432
+    protocol: tcp
+`
+
+const seedPoliciesYAML = `
+policies:
+  - policy_id: web-alice
+    client_id: alice
+    service_id: web
+    expiry_time: 2099-01-01T00:00:00Z
+    conditions:
+      - type: device_os
+        operator: in
+        value: [linux, darwin]
+  - policy_id: db-alice
+    client_id: alice
+    service_id: db
+    expiry_time: 2099-01-01T00:00:00Z
+`
+
+func TestApplySeedFiles(t *testing.T) {
+	ctx := context.Background()
+	c := newAdminTestController(t, &Config{
+		ServicesFile: writeSeedFile(t, "services.yaml", seedServicesYAML),
+		PoliciesFile: writeSeedFile(t, "policies.yaml", seedPoliciesYAML),
+	})
+	require.NoError(t, c.tunnelManager.CreateServiceConfig(ctx, &tunnel.ServiceConfig{ServiceID: "manual", TargetHost: "127.0.0.1", TargetPort: 80}))
+	require.NoError(t, c.policyEngine.SavePolicy(ctx, &policy.Policy{PolicyID: "manual", ClientID: "bob", ServiceID: "manual", ExpiryTime: time.Now().Add(time.Hour)}))
+
+	require.NoError(t, c.applySeedFiles(ctx))
+	web, err := c.tunnelManager.GetServiceConfig(ctx, "web")
+	require.NoError(t, err)
+	assert.Equal(t, 443, web.TargetPort)
+	assert.Equal(t, tunnel.ServiceStatusActive, web.Status)
+	pol, err := c.policyEngine.GetPolicy(ctx, "web-alice")
+	require.NoError(t, err)
+	require.Len(t, pol.Conditions, 1)
+	createdAt := pol.CreatedAt
+
+	// 再次启动：内容未变化时不改动对象
+	result, err := c.seedPolicies(ctx, mustReadPolicies(t, c.config.PoliciesFile), SeedModeUpdate)
+	require.NoError(t, err)
+	assert.Equal(t, &seedResult{Unchanged: 2}, result)
+
+	// create 模式不覆盖已存在的对象，update 模式覆盖
+	c.config.ServicesFile = writeSeedFile(t, "services.yaml", `
+services:
+  - service_id: web
+    target_host: 10.0.0.7
+    target_port: 8443
+    protocol: tcp
+`)
+	c.config.SeedMode = SeedModeCreate
+	require.NoError(t, c.applySeedFiles(ctx))
+	web, _ = c.tunnelManager.GetServiceConfig(ctx, "web")
+	assert.Equal(t, 443, web.TargetPort)
+
+	c.config.SeedMode = SeedModeUpdate
+	require.NoError(t, c.applySeedFiles(ctx))
+	web, _ = c.tunnelManager.GetServiceConfig(ctx, "web")
+	assert.Equal(t, 8443, web.TargetPort)
+	_, err = c.tunnelManager.GetServiceConfig(ctx, "db")
+	assert.NoError(t, err, "update mode keeps objects missing from the file")
+
+	// prune 模式删除文件中没有的对象（移入回收站）
+	c.config.PoliciesFile = writeSeedFile(t, "policies.yaml", `
+policies:
+  - policy_id: web-alice
+    client_id: alice
+    service_id: web
+    expiry_time: 2099-01-01T00:00:00Z
+    conditions:
+      - type: device_os
+        operator: in
+        value: [linux, darwin]
+`)
+	c.config.SeedMode = SeedModePrune
+	require.NoError(t, c.applySeedFiles(ctx))
+	_, err = c.tunnelManager.GetServiceConfig(ctx, "db")
+	assert.Error(t, err)
+	_, err = c.tunnelManager.GetServiceConfig(ctx, "manual")
+	assert.Error(t, err)
+	assert.Len(t, c.tunnelManager.ListDeletedServiceConfigs(ctx), 2)
+	policies, err := c.policyEngine.ListPolicies(ctx, nil)
+	require.NoError(t, err)
+	require.Len(t, policies, 1)
+	assert.Equal(t, "web-alice", policies[0].PolicyID)
+	assert.True(t, policies[0].CreatedAt.Equal(createdAt))
+}
+
+func TestApplySeedFiles_Invalid(t *testing.T) {
+	ctx := context.Background()
+	cases := map[string]struct {
+		services string
+		policies string
+		errText  string
+	}{
+		"unknown field":        {services: "services:\n  - service_id: web\n    target_hots: x\n", errText: "target_hots"},
+		"duplicate service":    {services: "services:\n  - service_id: web\n  - service_id: web\n", errText: "duplicate service_id"},
+		"missing policy field": {policies: "policies:\n  - policy_id: p\n    client_id: alice\n", errText: "service_id are required"},
+		"invalid condition":    {policies: "policies:\n  - policy_id: p\n    client_id: alice\n    service_id: web\n    conditions:\n      - type: nope\n", errText: "policy p"},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cfg := &Config{ServicesFile: writeSeedFile(t, "services.yaml", seedServicesYAML)}
+			if tc.services != "" {
+				cfg.ServicesFile = writeSeedFile(t, "services.yaml", tc.services)
+			}
+			if tc.policies != "" {
+				cfg.PoliciesFile = writeSeedFile(t, "policies.yaml", tc.policies)
+			}
+			c := newAdminTestController(t, cfg)
+
+			assert.ErrorContains(t, c.applySeedFiles(ctx), tc.errText)
+			// 校验失败时不做任何修改
+			services, err := c.tunnelManager.ListServiceConfigs(ctx, "")
+			require.NoError(t, err)
+			assert.Empty(t, services)
+		})
+	}
+
+	assert.Error(t, SeedMode("replace").Validate())
+}
+
+func mustReadPolicies(t *testing.T, path string) []*policy.Policy {
+	t.Helper()
+	var file policiesFile
+	require.NoError(t, readSeedFile(path, &file))
+	return file.Policies
+}
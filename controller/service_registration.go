@@ -0,0 +1,220 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/houzhh15/sdp-common/logging"
+	"github.com/houzhh15/sdp-common/service"
+	"github.com/houzhh15/sdp-common/transport"
+	"github.com/houzhh15/sdp-common/tunnel"
+)
+
+// serviceMetadataRegisteredBy 服务 Metadata 中记录注册该服务的 AH agent_id；
+// 只有同一 agent 可以更新或注销，管理员 / 声明式文件创建的服务（无此键）不能被 AH 覆盖
+const serviceMetadataRegisteredBy = "registered_by"
+
+// handleServicesRegister handles service registration by AH agents (e.g. services discovered
+// by the k8s provider). New services are created, changed ones updated; a service owned by
+// another agent or created by an administrator is rejected with 409 and nothing is applied
+func (c *Controller) handleServicesRegister(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	// 仅持有已验证 AH 证书的 agent 可注册服务，agent 身份取自证书 CN
+	agentID, ok := verifiedAgentID(r)
+	if !ok {
+		respondErrorWithStatus(w, "FORBIDDEN", "Only agents may register services", nil, http.StatusForbidden)
+		return
+	}
+
+	var req service.RegisterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondErrorWithStatus(w, "INVALID_REQUEST", "Invalid request body", nil, http.StatusBadRequest)
+		return
+	}
+	if req.AgentID != "" && req.AgentID != agentID {
+		respondErrorWithStatus(w, "FORBIDDEN", "agent_id does not match client certificate", nil, http.StatusForbidden)
+		return
+	}
+	req.AgentID = agentID
+
+	ctx := r.Context()
+	configs := make([]*tunnel.ServiceConfig, 0, len(req.Services))
+	seen := make(map[string]bool, len(req.Services))
+	for i := range req.Services {
+		config, err := registeredServiceConfig(req.AgentID, &req.Services[i])
+		if err == nil && seen[config.ServiceID] {
+			err = fmt.Errorf("duplicate service id %s", config.ServiceID)
+		}
+		if err != nil {
+			respondErrorWithStatus(w, "INVALID_REQUEST", err.Error(), nil, http.StatusBadRequest)
+			return
+		}
+		seen[config.ServiceID] = true
+
+		if existing, err := c.tunnelManager.GetServiceConfig(ctx, config.ServiceID); err == nil {
+			if owner, _ := existing.Metadata[serviceMetadataRegisteredBy].(string); owner != req.AgentID {
+				respondErrorWithStatus(w, "SERVICE_CONFLICT", fmt.Sprintf("Service %s is managed elsewhere", config.ServiceID),
+					map[string]interface{}{"service_id": config.ServiceID}, http.StatusConflict)
+				return
+			}
+		}
+		configs = append(configs, config)
+	}
+
+	var created, updated []string
+	for _, config := range configs {
+		existing, err := c.tunnelManager.GetServiceConfig(ctx, config.ServiceID)
+		if err != nil {
+			if err := c.tunnelManager.CreateServiceConfig(ctx, config); err != nil {
+				c.logger.Error("Failed to register service", "service_id", config.ServiceID, "error", err)
+				respondErrorWithStatus(w, "INVALID_REQUEST", err.Error(), nil, http.StatusBadRequest)
+				return
+			}
+			c.notifyServiceEvent(tunnel.ServiceEventCreated, config)
+			created = append(created, config.ServiceID)
+			continue
+		}
+		if sameService(existing, config) {
+			continue
+		}
+		config.CreatedAt = existing.CreatedAt
+		if err := c.tunnelManager.UpdateServiceConfig(ctx, config); err != nil {
+			c.logger.Error("Failed to update registered service", "service_id", config.ServiceID, "error", err)
+			respondErrorWithStatus(w, "INVALID_REQUEST", err.Error(), nil, http.StatusBadRequest)
+			return
+		}
+		c.notifyServiceEvent(tunnel.ServiceEventUpdated, config)
+		updated = append(updated, config.ServiceID)
+	}
+	c.flushServiceEvents()
+
+	c.logger.Info("Services registered", "agent_id", req.AgentID, "count", len(configs), "created", len(created), "updated", len(updated))
+	if len(created) > 0 || len(updated) > 0 {
+		c.recordOpsEvent(OpsConfigChanged, "service", OpsSeverityInfo, "Services registered by agent",
+			map[string]interface{}{"agent_id": req.AgentID, "created": created, "updated": updated})
+	}
+	c.auditAccess(ctx, &logging.AccessEvent{
+		ClientID: req.AgentID,
+		SourceIP: transport.ClientIPFromRequest(r),
+		Action:   "service_register",
+		Result:   "success",
+		Details: map[string]interface{}{
+			"created": created,
+			"updated": updated,
+		},
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "success",
+		"message": fmt.Sprintf("%d services registered", len(configs)),
+		"created": created,
+		"updated": updated,
+	})
+}
+
+// handleServiceUnregister handles DELETE /api/v1/services/{id}?agent_id=... from the agent that registered the service
+// (agent_id is optional and must match the client certificate)
+func (c *Controller) handleServiceUnregister(w http.ResponseWriter, r *http.Request, serviceID string) {
+	agentID, ok := verifiedAgentID(r)
+	if !ok {
+		respondErrorWithStatus(w, "FORBIDDEN", "Only agents may unregister services", nil, http.StatusForbidden)
+		return
+	}
+	if claimed := r.URL.Query().Get("agent_id"); claimed != "" && claimed != agentID {
+		respondErrorWithStatus(w, "FORBIDDEN", "agent_id does not match client certificate", nil, http.StatusForbidden)
+		return
+	}
+
+	ctx := r.Context()
+	existing, err := c.tunnelManager.GetServiceConfig(ctx, serviceID)
+	if err != nil {
+		respondErrorWithStatus(w, "NOT_FOUND", fmt.Sprintf("Service not found: %s", serviceID), nil, http.StatusNotFound)
+		return
+	}
+	if owner, _ := existing.Metadata[serviceMetadataRegisteredBy].(string); owner != agentID {
+		respondErrorWithStatus(w, "FORBIDDEN", fmt.Sprintf("Service %s is not registered by %s", serviceID, agentID), nil, http.StatusForbidden)
+		return
+	}
+
+	if err := c.tunnelManager.DeleteServiceConfig(ctx, serviceID); err != nil {
+		c.logger.Error("Failed to unregister service", "service_id", serviceID, "error", err)
+		respondErrorWithStatus(w, "INTERNAL_ERROR", "Failed to unregister service", nil, http.StatusInternalServerError)
+		return
+	}
+	c.notifyServiceEvent(tunnel.ServiceEventDeleted, existing)
+
+	c.logger.Info("Service unregistered", "agent_id", agentID, "service_id", serviceID)
+	c.recordOpsEvent(OpsConfigChanged, "service", OpsSeverityInfo, "Service unregistered by agent",
+		map[string]interface{}{"agent_id": agentID, "service_id": serviceID})
+	c.auditAccess(ctx, &logging.AccessEvent{
+		ClientID:  agentID,
+		ServiceID: serviceID,
+		SourceIP:  transport.ClientIPFromRequest(r),
+		Action:    "service_unregister",
+		Result:    "success",
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// registeredServiceConfig 将 AH 注册的服务转换为服务配置，并记录注册方
+func registeredServiceConfig(agentID string, svc *service.Service) (*tunnel.ServiceConfig, error) {
+	if svc.ID == "" || strings.Contains(svc.ID, "/") {
+		return nil, fmt.Errorf("invalid service id %q", svc.ID)
+	}
+	if svc.TargetHost == "" || svc.TargetPort <= 0 || svc.TargetPort > 65535 {
+		return nil, fmt.Errorf("service %s: invalid target %s:%d", svc.ID, svc.TargetHost, svc.TargetPort)
+	}
+	protocol := strings.ToLower(svc.Protocol)
+	switch protocol {
+	case "":
+		protocol = "tcp"
+	case "tcp", "udp":
+	default:
+		return nil, fmt.Errorf("service %s: unsupported protocol %s", svc.ID, svc.Protocol)
+	}
+
+	config := &tunnel.ServiceConfig{
+		ServiceID:   svc.ID,
+		ServiceName: svc.Name,
+		TargetHost:  svc.TargetHost,
+		TargetPort:  svc.TargetPort,
+		Protocol:    protocol,
+		Status:      tunnel.ServiceStatusActive,
+		Metadata:    make(map[string]interface{}, len(svc.Metadata)+1),
+	}
+	if config.ServiceName == "" {
+		config.ServiceName = svc.ID
+	}
+	if svc.Status == string(tunnel.ServiceStatusInactive) {
+		config.Status = tunnel.ServiceStatusInactive
+	}
+	for k, v := range svc.Metadata {
+		config.Metadata[k] = v
+	}
+	config.Metadata[serviceMetadataRegisteredBy] = agentID
+	return config, nil
+}
+
+// notifyServiceEvent 向 AH 推送服务配置变更（SSE service_created / service_updated / service_deleted）
+func (c *Controller) notifyServiceEvent(eventType tunnel.ServiceEventType, config *tunnel.ServiceConfig) {
+	if c.tunnelNotifier == nil {
+		return
+	}
+	if err := c.tunnelNotifier.NotifyService(&tunnel.ServiceEvent{Type: eventType, Service: config}); err != nil {
+		c.logger.Warn("Failed to notify service event", "service_id", config.ServiceID, "type", eventType, "error", err)
+	}
+}
+
+// flushServiceEvents 批量变更结束时立即推送合并窗口中的服务事件（Config.ServiceEventBatchWindow）
+func (c *Controller) flushServiceEvents() {
+	if c.tunnelNotifier != nil {
+		c.tunnelNotifier.FlushServiceEvents()
+	}
+}
@@ -0,0 +1,157 @@
+package controller
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/houzhh15/sdp-common/service"
+	"github.com/houzhh15/sdp-common/tunnel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// registerServices 以证书 CN 为 agentID 的已验证 AH 身份注册服务
+func registerServices(c *Controller, agentID string, services ...service.Service) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(service.RegisterRequest{AgentID: agentID, Services: services})
+	return serveAsAgent(c, agentID, http.MethodPost, "/api/v1/services/register", string(body))
+}
+
+func serveAsAgent(c *Controller, certCN, method, path, body string) *httptest.ResponseRecorder {
+	req := withAgentCert(httptest.NewRequest(method, path, strings.NewReader(body)), certCN)
+	w := httptest.NewRecorder()
+	c.mux.ServeHTTP(w, req)
+	return w
+}
+
+func TestServiceRegistration(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newIdempotencyTestController(t)
+	c.mux = http.NewServeMux()
+	c.registerHandlers()
+
+	web := service.Service{ID: "default.web", TargetHost: "web.default.svc", TargetPort: 80, Metadata: map[string]string{"k8s_namespace": "default"}}
+	w := registerServices(c, "ah-k8s", web)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	config, err := c.tunnelManager.GetServiceConfig(ctx, "default.web")
+	require.NoError(t, err)
+	assert.Equal(t, "tcp", config.Protocol)
+	assert.Equal(t, "ah-k8s", config.Metadata[serviceMetadataRegisteredBy])
+	assert.Equal(t, "default", config.Metadata["k8s_namespace"])
+
+	// 重复注册未变化的服务不更新
+	etag, _ := c.tunnelManager.ServicesVersion()
+	require.Equal(t, http.StatusOK, registerServices(c, "ah-k8s", web).Code)
+	unchanged, _ := c.tunnelManager.ServicesVersion()
+	assert.Equal(t, etag, unchanged)
+
+	web.TargetPort = 8080
+	require.Equal(t, http.StatusOK, registerServices(c, "ah-k8s", web).Code)
+	config, _ = c.tunnelManager.GetServiceConfig(ctx, "default.web")
+	assert.Equal(t, 8080, config.TargetPort)
+
+	// 其他 agent 与管理员创建的服务不能被覆盖，整个请求不生效
+	other := service.Service{ID: "default.api", TargetHost: "api.default.svc", TargetPort: 80}
+	assert.Equal(t, http.StatusConflict, registerServices(c, "ah-other", other, web).Code)
+	_, err = c.tunnelManager.GetServiceConfig(ctx, "default.api")
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusConflict, registerServices(c, "ah-k8s", service.Service{ID: "svc-1", TargetHost: "x", TargetPort: 1}).Code)
+	assert.Equal(t, http.StatusBadRequest, registerServices(c, "ah-k8s", service.Service{ID: "bad", TargetHost: "x"}).Code)
+
+	// IH 证书、未验证的连接与冒用其他 agent_id 的请求不能注册服务
+	pki := newInternalTestPKI(t)
+	ih := pki.manager(pki.issue("ih-client", "")).GetX509Certificate()
+	body, _ := json.Marshal(service.RegisterRequest{AgentID: "ah-k8s", Services: []service.Service{other}})
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/services/register", strings.NewReader(string(body)))
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{ih}}
+	w = httptest.NewRecorder()
+	c.mux.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, http.StatusForbidden, serveRequest(c, http.MethodPost, "/api/v1/services/register", "", string(body)).Code)
+	assert.Equal(t, http.StatusForbidden, serveAsAgent(c, "ah-other", http.MethodPost, "/api/v1/services/register", string(body)).Code)
+	_, err = c.tunnelManager.GetServiceConfig(ctx, "default.api")
+	assert.Error(t, err)
+
+	// agent 身份取自证书，请求体可省略 agent_id
+	body, _ = json.Marshal(service.RegisterRequest{Services: []service.Service{other}})
+	require.Equal(t, http.StatusOK, serveAsAgent(c, "ah-other", http.MethodPost, "/api/v1/services/register", string(body)).Code)
+	config, err = c.tunnelManager.GetServiceConfig(ctx, "default.api")
+	require.NoError(t, err)
+	assert.Equal(t, "ah-other", config.Metadata[serviceMetadataRegisteredBy])
+
+	// 只有注册方可以注销，查询参数中的 agent_id 须与证书一致
+	assert.Equal(t, http.StatusForbidden, serveRequest(c, http.MethodDelete, "/api/v1/services/default.web?agent_id=ah-k8s", "", "").Code)
+	assert.Equal(t, http.StatusForbidden, serveAsAgent(c, "ah-other", http.MethodDelete, "/api/v1/services/default.web?agent_id=ah-k8s", "").Code)
+	assert.Equal(t, http.StatusForbidden, serveAsAgent(c, "ah-other", http.MethodDelete, "/api/v1/services/default.web", "").Code)
+	assert.Equal(t, http.StatusForbidden, serveAsAgent(c, "ah-k8s", http.MethodDelete, "/api/v1/services/svc-1", "").Code)
+	assert.Equal(t, http.StatusNoContent, serveAsAgent(c, "ah-k8s", http.MethodDelete, "/api/v1/services/default.web?agent_id=ah-k8s", "").Code)
+	_, err = c.tunnelManager.GetServiceConfig(ctx, "default.web")
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusNotFound, serveAsAgent(c, "ah-k8s", http.MethodDelete, "/api/v1/services/default.web", "").Code)
+}
+
+func TestServiceRegistration_Client(t *testing.T) {
+	c, _ := newIdempotencyTestController(t)
+	c.mux = http.NewServeMux()
+	c.registerHandlers()
+	// 模拟 mTLS 终止后携带 ah-k8s 证书的连接
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.mux.ServeHTTP(w, withAgentCert(r, "ah-k8s"))
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	client := service.NewClient(&service.Config{ControllerURL: server.URL, AgentID: "ah-k8s"})
+	require.NoError(t, client.Register(ctx, []service.Service{{ID: "default.web", TargetHost: "127.0.0.1", TargetPort: 80}}))
+	services, err := client.Fetch(ctx)
+	require.NoError(t, err)
+	assert.Len(t, services, 2)
+
+	require.NoError(t, client.Unregister(ctx, "default.web"))
+	assert.Error(t, client.Unregister(ctx, "svc-1"))
+	_, err = c.tunnelManager.GetServiceConfig(ctx, "svc-1")
+	assert.NoError(t, err)
+	_, err = c.tunnelManager.GetServiceConfig(ctx, "default.web")
+	assert.Error(t, err)
+}
+
+func TestServiceRegistration_BatchedEvents(t *testing.T) {
+	c, _ := newIdempotencyTestController(t)
+	c.mux = http.NewServeMux()
+	c.registerHandlers()
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	journal, err := tunnel.NewDBJournal(db)
+	require.NoError(t, err)
+	// 合并窗口远长于测试时间：事件只能由注册结束时的 Flush 推送
+	c.tunnelNotifier = tunnel.NewNotifierWithConfig(&tunnel.NotifierConfig{
+		Heartbeat:          30 * time.Second,
+		ServiceBatchWindow: time.Hour,
+		Journal:            journal,
+	})
+
+	w := registerServices(c, "ah-k8s",
+		service.Service{ID: "default.web", TargetHost: "web.default.svc", TargetPort: 80},
+		service.Service{ID: "default.api", TargetHost: "api.default.svc", TargetPort: 80},
+		service.Service{ID: "default.db", TargetHost: "db.default.svc", TargetPort: 5432},
+	)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	entries, err := journal.Since(context.Background(), 0, 10)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, string(tunnel.ServiceEventBulkUpdated), entries[0].Type)
+	var event tunnel.ServiceEvent
+	require.NoError(t, json.Unmarshal(entries[0].Data, &event))
+	assert.Len(t, event.Events, 3)
+}
@@ -0,0 +1,145 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/houzhh15/sdp-common/clock"
+	"github.com/houzhh15/sdp-common/tunnel"
+)
+
+// defaultServiceScheduleInterval 服务维护计划默认扫描间隔
+const defaultServiceScheduleInterval = 30 * time.Second
+
+// serviceScheduler 定期按维护窗口与计划停用时间切换服务状态（active / maintenance / inactive），
+// 状态变化时更新服务配置（SSE 推送给 AH），并向可访问该服务的 IH 推送 service_status_changed
+type serviceScheduler struct {
+	c        *Controller
+	clock    clock.Clock
+	interval time.Duration
+}
+
+// newServiceScheduler 创建服务维护计划调度器
+func newServiceScheduler(c *Controller) *serviceScheduler {
+	interval := c.config.ServiceScheduleInterval
+	if interval <= 0 {
+		interval = defaultServiceScheduleInterval
+	}
+	return &serviceScheduler{
+		c:        c,
+		clock:    clock.Or(c.config.Clock),
+		interval: interval,
+	}
+}
+
+// run 周期扫描直到 ctx 结束
+func (s *serviceScheduler) run(ctx context.Context) {
+	ticker := s.clock.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			s.scan(ctx, s.clock.Now())
+		}
+	}
+}
+
+// scan 执行一次扫描：切换状态与 now 不一致的服务，已生效的计划停用时间与已结束的维护窗口随之清除
+func (s *serviceScheduler) scan(ctx context.Context, now time.Time) {
+	configs, err := s.c.tunnelManager.ListServiceConfigs(ctx, "")
+	if err != nil {
+		s.c.logger.Warn("Service schedule scan: failed to list services", "error", err)
+		return
+	}
+	for _, config := range configs {
+		status := config.ScheduledStatus(now)
+		if status == config.Status {
+			continue
+		}
+
+		updated := *config
+		updated.Status = status
+		if status == tunnel.ServiceStatusInactive {
+			updated.DisableAt = nil
+		}
+		updated.MaintenanceWindows = nil
+		for _, w := range config.MaintenanceWindows {
+			if w.End.After(now) {
+				updated.MaintenanceWindows = append(updated.MaintenanceWindows, w)
+			}
+		}
+		if err := s.c.tunnelManager.UpdateServiceConfig(ctx, &updated); err != nil {
+			s.c.logger.Warn("Service schedule: failed to update service status",
+				"service_id", config.ServiceID, "status", status, "error", err)
+			continue
+		}
+
+		s.c.logger.Info("Service status changed by schedule",
+			"service_id", config.ServiceID,
+			"previous_status", config.Status,
+			"status", status)
+		s.c.recordOpsEvent(OpsConfigChanged, "service", OpsSeverityInfo, "Service status changed by schedule", map[string]interface{}{
+			"service_id":      config.ServiceID,
+			"previous_status": string(config.Status),
+			"status":          string(status),
+		})
+		s.c.notifyServiceEvent(tunnel.ServiceEventUpdated, &updated)
+		s.c.notifyServiceStatusChanged(ctx, &updated, config.Status, now)
+	}
+	s.c.flushServiceEvents()
+}
+
+// serviceUnavailable 服务当前不接受新建隧道的原因
+type serviceUnavailable struct {
+	code    string
+	message string
+	status  int
+	endsAt  time.Time // 维护窗口结束时间，手动维护或停用时为零值
+}
+
+// checkServiceAvailable 按服务状态与维护计划判断能否新建隧道（已有隧道不受影响），可用时返回 nil
+// 直接按 now 计算，不依赖调度器是否已完成状态切换
+func checkServiceAvailable(config *tunnel.ServiceConfig, now time.Time) *serviceUnavailable {
+	switch config.ScheduledStatus(now) {
+	case tunnel.ServiceStatusMaintenance:
+		u := &serviceUnavailable{
+			code:    "MAINTENANCE",
+			message: fmt.Sprintf("Service %s is under maintenance", config.ServiceID),
+			status:  http.StatusServiceUnavailable,
+		}
+		if w := config.ActiveMaintenance(now); w != nil {
+			u.endsAt = w.End
+			if w.Message != "" {
+				u.message = w.Message
+			}
+		}
+		return u
+	case tunnel.ServiceStatusInactive:
+		return &serviceUnavailable{
+			code:    "SERVICE_DISABLED",
+			message: fmt.Sprintf("Service %s is disabled", config.ServiceID),
+			status:  http.StatusForbidden,
+		}
+	}
+	return nil
+}
+
+// respond 写出错误响应；维护窗口有结束时间时附带 ends_at 与 Retry-After
+func (u *serviceUnavailable) respond(w http.ResponseWriter, now time.Time) {
+	var details interface{}
+	if !u.endsAt.IsZero() {
+		details = map[string]interface{}{"ends_at": u.endsAt.UTC().Format(time.RFC3339)}
+		retryAfter := int(u.endsAt.Sub(now).Round(time.Second) / time.Second)
+		if retryAfter < 1 {
+			retryAfter = 1
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	}
+	respondErrorWithStatus(w, u.code, u.message, details, u.status)
+}
@@ -0,0 +1,137 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/houzhh15/sdp-common/tunnel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServiceScheduler_Scan(t *testing.T) {
+	c, token := newIdempotencyTestController(t)
+	ctx := context.Background()
+
+	start := time.Now().Add(time.Hour)
+	disableAt := start.Add(24 * time.Hour)
+	config, err := c.tunnelManager.GetServiceConfig(ctx, "svc-1")
+	require.NoError(t, err)
+	updated := *config
+	updated.MaintenanceWindows = []tunnel.MaintenanceWindow{{Start: start, End: start.Add(time.Hour), Message: "Database upgrade"}}
+	updated.DisableAt = &disableAt
+	require.NoError(t, c.tunnelManager.UpdateServiceConfig(ctx, &updated))
+
+	c.clientStreams.Store("alice", token)
+	recorder := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		c.tunnelNotifier.SubscribeClient("alice", recorder)
+		close(done)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	scheduler := newServiceScheduler(c)
+	status := func() tunnel.ServiceStatus {
+		config, err := c.tunnelManager.GetServiceConfig(ctx, "svc-1")
+		require.NoError(t, err)
+		return config.Status
+	}
+
+	// 窗口开始前不变
+	scheduler.scan(ctx, start.Add(-time.Minute))
+	assert.Equal(t, tunnel.ServiceStatusActive, status())
+
+	// 进入维护窗口
+	scheduler.scan(ctx, start)
+	assert.Equal(t, tunnel.ServiceStatusMaintenance, status())
+	scheduler.scan(ctx, start.Add(time.Minute))
+
+	// 窗口结束后恢复，已结束的窗口被清除
+	scheduler.scan(ctx, start.Add(time.Hour))
+	assert.Equal(t, tunnel.ServiceStatusActive, status())
+	config, err = c.tunnelManager.GetServiceConfig(ctx, "svc-1")
+	require.NoError(t, err)
+	assert.Empty(t, config.MaintenanceWindows)
+
+	// 到达计划停用时间
+	scheduler.scan(ctx, disableAt)
+	config, err = c.tunnelManager.GetServiceConfig(ctx, "svc-1")
+	require.NoError(t, err)
+	assert.Equal(t, tunnel.ServiceStatusInactive, config.Status)
+	assert.Nil(t, config.DisableAt)
+
+	time.Sleep(100 * time.Millisecond)
+	c.tunnelNotifier.UnsubscribeClient("alice")
+	<-done
+
+	body := recorder.Body.String()
+	assert.Equal(t, 3, strings.Count(body, "event: "+tunnel.EventServiceStatusChanged+"\n"))
+	assert.Contains(t, body, `"message":"Database upgrade"`)
+	assert.Contains(t, body, `"status":"maintenance"`)
+	assert.Contains(t, body, `"status":"inactive"`)
+}
+
+func TestTunnelCreate_ServiceUnavailable(t *testing.T) {
+	c, token := newIdempotencyTestController(t)
+	ctx := context.Background()
+
+	config, err := c.tunnelManager.GetServiceConfig(ctx, "svc-1")
+	require.NoError(t, err)
+	end := time.Now().Add(10 * time.Minute).Truncate(time.Second)
+
+	// 维护窗口内：无需等待调度器切换状态即拒绝
+	updated := *config
+	updated.MaintenanceWindows = []tunnel.MaintenanceWindow{{Start: time.Now().Add(-time.Minute), End: end, Message: "Back at 02:00 UTC"}}
+	require.NoError(t, c.tunnelManager.UpdateServiceConfig(ctx, &updated))
+
+	w := postTunnel(c, token, "svc-1", "")
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+	var resp struct {
+		Code    string                 `json:"code"`
+		Message string                 `json:"message"`
+		Details map[string]interface{} `json:"details"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "MAINTENANCE", resp.Code)
+	assert.Equal(t, "Back at 02:00 UTC", resp.Message)
+	assert.Equal(t, end.UTC().Format(time.RFC3339), resp.Details["ends_at"])
+
+	// 手动设置的维护状态
+	manual := *config
+	manual.Status = tunnel.ServiceStatusMaintenance
+	require.NoError(t, c.tunnelManager.UpdateServiceConfig(ctx, &manual))
+	w = postTunnel(c, token, "svc-1", "")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Contains(t, w.Body.String(), "MAINTENANCE")
+
+	disabled := *config
+	disabled.Status = tunnel.ServiceStatusInactive
+	require.NoError(t, c.tunnelManager.UpdateServiceConfig(ctx, &disabled))
+	w = postTunnel(c, token, "svc-1", "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "SERVICE_DISABLED")
+
+	active := *config
+	active.Status = tunnel.ServiceStatusActive
+	require.NoError(t, c.tunnelManager.UpdateServiceConfig(ctx, &active))
+	assert.Equal(t, http.StatusCreated, postTunnel(c, token, "svc-1", "").Code)
+}
+
+func TestServiceConfig_InvalidMaintenanceWindow(t *testing.T) {
+	c, _ := newIdempotencyTestController(t)
+	now := time.Now()
+	err := c.tunnelManager.CreateServiceConfig(context.Background(), &tunnel.ServiceConfig{
+		ServiceID:          "svc-bad",
+		TargetHost:         "127.0.0.1",
+		TargetPort:         8080,
+		MaintenanceWindows: []tunnel.MaintenanceWindow{{Start: now, End: now.Add(-time.Hour)}},
+	})
+	assert.Error(t, err)
+}
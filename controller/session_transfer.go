@@ -0,0 +1,440 @@
+package controller
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/json"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/houzhh15/sdp-common/auth"
+	"github.com/houzhh15/sdp-common/cert"
+	"github.com/houzhh15/sdp-common/clock"
+	"github.com/houzhh15/sdp-common/logging"
+	"github.com/houzhh15/sdp-common/policy"
+	"github.com/houzhh15/sdp-common/session"
+	"github.com/houzhh15/sdp-common/transport"
+	"github.com/houzhh15/sdp-common/tunnel"
+)
+
+// defaultSessionTransferTTL 会话转移码默认有效期
+const defaultSessionTransferTTL = 2 * time.Minute
+
+// 隧道未能转移到新设备的原因（auth.SkippedTunnel.Reason）
+const (
+	transferSkipMaintenance     = "maintenance"            // 维护模式下不新建隧道
+	transferSkipServiceNotFound = "service_not_found"      // 服务已删除
+	transferSkipPolicyDenied    = "policy_denied"          // 新设备（设备信息、来源 IP）不满足策略
+	transferSkipE2ERequired     = "e2e_required"           // 端到端密钥属于旧设备，需由新设备自行创建
+	transferSkipExpired         = "expired"                // 隧道已到期
+	transferSkipFailed          = "creation_failed"        // 创建隧道失败
+	transferSkipCredential      = "credential_unavailable" // 目标临时凭据签发失败
+	transferSkipReverseForward  = "reverse_forward"        // 反向转发的目标位于旧设备所在网络
+	transferSkipObfuscate       = "obfuscate_unsupported"  // 策略要求流量混淆，新设备不支持
+)
+
+// sessionTransfer 旧设备申请的一次性会话转移
+type sessionTransfer struct {
+	clientID    string
+	token       string // 旧设备会话，兑换后撤销
+	fingerprint string // 旧设备证书指纹
+	expiresAt   time.Time
+}
+
+// sessionTransfers 待兑换的会话转移码，零值可用
+// 每个会话同时只保留最新的转移码，兑换（无论成功与否）后立即失效
+type sessionTransfers struct {
+	mu      sync.Mutex
+	pending map[string]*sessionTransfer // code -> transfer
+}
+
+// issue 为会话生成转移码，替换该会话之前未兑换的转移码
+func (s *sessionTransfers) issue(transfer *sessionTransfer, now time.Time) (string, error) {
+	b := make([]byte, 10) // 80 位熵，16 个 base32 字符
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	code := base32.StdEncoding.EncodeToString(b)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pending == nil {
+		s.pending = make(map[string]*sessionTransfer)
+	}
+	for key, t := range s.pending {
+		if t.token == transfer.token || !now.Before(t.expiresAt) {
+			delete(s.pending, key)
+		}
+	}
+	s.pending[code] = transfer
+	return formatTransferCode(code), nil
+}
+
+// redeem 取出并作废转移码，不存在或已过期时返回 false
+func (s *sessionTransfers) redeem(code string, now time.Time) (*sessionTransfer, bool) {
+	code = normalizeTransferCode(code)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	transfer, ok := s.pending[code]
+	if !ok {
+		return nil, false
+	}
+	delete(s.pending, code)
+	if !now.Before(transfer.expiresAt) {
+		return nil, false
+	}
+	return transfer, true
+}
+
+// formatTransferCode 以 4 字符一组展示转移码（便于在两台设备间手工输入）
+func formatTransferCode(code string) string {
+	groups := make([]string, 0, len(code)/4)
+	for i := 0; i < len(code); i += 4 {
+		groups = append(groups, code[i:min(i+4, len(code))])
+	}
+	return strings.Join(groups, "-")
+}
+
+// normalizeTransferCode 去掉分隔符与空白并转为大写
+func normalizeTransferCode(code string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+// handleSessionTransfer issues a one-time transfer code for the caller's session (POST, old device).
+// The code is redeemed by another device of the same identity within SessionTransferTTL
+func (c *Controller) handleSessionTransfer(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx := r.Context()
+	token := extractBearerToken(r)
+	if token == "" {
+		respondErrorWithStatus(w, "UNAUTHORIZED", "Missing authorization token", nil, http.StatusUnauthorized)
+		return
+	}
+	sess, err := c.sessionManager.ValidateSession(ctx, token)
+	if err != nil {
+		respondErrorWithStatus(w, "UNAUTHORIZED", "Invalid or expired session", nil, http.StatusUnauthorized)
+		return
+	}
+
+	ttl := c.config.SessionTransferTTL
+	if ttl <= 0 {
+		ttl = defaultSessionTransferTTL
+	}
+	now := clock.Or(c.config.Clock).Now()
+	expiresAt := now.Add(ttl)
+	code, err := c.transfers.issue(&sessionTransfer{
+		clientID:    sess.ClientID,
+		token:       token,
+		fingerprint: sess.CertFingerprint,
+		expiresAt:   expiresAt,
+	}, now)
+	if err != nil {
+		c.logger.Error("Failed to issue session transfer code", "client_id", sess.ClientID, "error", err)
+		respondErrorWithStatus(w, "INTERNAL_ERROR", "Failed to issue transfer code", nil, http.StatusInternalServerError)
+		return
+	}
+
+	c.logger.Info("Session transfer code issued", "client_id", sess.ClientID, "token", maskToken(token))
+	c.auditAccess(ctx, &logging.AccessEvent{
+		ClientID: sess.ClientID,
+		SourceIP: transport.ClientIPFromRequest(r),
+		Action:   "session_transfer_request",
+		Result:   "success",
+		Details:  map[string]interface{}{"expires_at": expiresAt},
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"type":       "session_transfer",
+		"status":     "success",
+		"code":       code,
+		"expires_at": expiresAt.Format(time.RFC3339),
+	})
+}
+
+// handleSessionTransferRedeem redeems a transfer code on the new device (POST over mTLS, body auth.TransferRedeemRequest).
+// The new device's certificate must carry the same identity (CN) as the old session. It receives its own session;
+// the old session is revoked and its tunnels are re-created for the new session where policy allows
+func (c *Controller) handleSessionTransferRedeem(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx := r.Context()
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		respondErrorWithStatus(w, "INVALID_CERT", "No client certificate", nil, http.StatusUnauthorized)
+		return
+	}
+	clientCert := r.TLS.PeerCertificates[0]
+	fingerprint := calculateFingerprint(clientCert)
+	if cert.IsServiceCertificate(clientCert) {
+		respondErrorWithStatus(w, "INVALID_CERT", "Internal service certificates cannot be used for client sessions", nil, http.StatusForbidden)
+		return
+	}
+
+	var req auth.TransferRedeemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondErrorWithStatus(w, "INVALID_REQUEST", "Invalid request body", nil, http.StatusBadRequest)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		respondErrorWithStatus(w, "INVALID_REQUEST", err.Error(), nil, http.StatusBadRequest)
+		return
+	}
+	if req.CertFingerprint != "" && req.CertFingerprint != fingerprint {
+		respondErrorWithStatus(w, "INVALID_CERT", "cert_fingerprint does not match the client certificate", nil, http.StatusBadRequest)
+		return
+	}
+
+	claims, err := c.identityClaims(clientCert)
+	if err != nil {
+		respondErrorWithStatus(w, "INVALID_CERT", "Certificate does not carry the configured client identity", nil, http.StatusForbidden)
+		return
+	}
+	clientID := claims.ClientID
+	denied := func(reason string) {
+		c.logger.Warn("Session transfer rejected", "client_id", clientID, "fingerprint", fingerprint, "reason", reason)
+		c.auditAccess(ctx, &logging.AccessEvent{
+			ClientID: clientID,
+			SourceIP: transport.ClientIPFromRequest(r),
+			Action:   "session_transfer",
+			Result:   "denied",
+			Reason:   reason,
+		})
+	}
+
+	// 转移码一经提交即作废，防止穷举
+	transfer, ok := c.transfers.redeem(req.Code, clock.Or(c.config.Clock).Now())
+	if !ok {
+		denied("invalid or expired transfer code")
+		respondErrorWithStatus(w, "TRANSFER_CODE_INVALID", "Transfer code is invalid or expired", nil, http.StatusNotFound)
+		return
+	}
+	if transfer.clientID != clientID {
+		denied("identity mismatch")
+		respondErrorWithStatus(w, "IDENTITY_MISMATCH", "Certificate identity does not match the transferred session", nil, http.StatusForbidden)
+		return
+	}
+	if _, err := c.sessionManager.ValidateSession(ctx, transfer.token); err != nil {
+		denied("source session no longer valid")
+		respondErrorWithStatus(w, "TRANSFER_CODE_INVALID", "The transferred session is no longer valid", nil, http.StatusGone)
+		return
+	}
+
+	// 新设备证书与源会话证书同属一个身份，是转移的预期结果；与其他证书的冲突按策略处理
+	_, lookupErr := c.certRegistry.GetCertInfo(fingerprint)
+	if _, reject := c.checkIdentityConflict(r, clientCert, fingerprint, lookupErr == nil, transfer.fingerprint); reject {
+		denied("identity conflict")
+		respondErrorWithStatus(w, "IDENTITY_CONFLICT", "Another certificate is already registered for this identity", nil, http.StatusForbidden)
+		return
+	}
+
+	if err := c.ensureCertRegistered(fingerprint, clientCert); err != nil {
+		respondErrorWithStatus(w, "INVALID_CERT", "Certificate registration failed", nil, http.StatusForbidden)
+		return
+	}
+
+	sess, err := c.sessionManager.CreateSession(ctx, &session.CreateSessionRequest{
+		ClientID:        clientID,
+		CertFingerprint: fingerprint,
+		DeviceInfo:      handshakeDeviceInfo(&req.DeviceInfo),
+		ClientClass:     claims.ClientClass,
+		Tenant:          claims.Tenant,
+		Metadata: map[string]interface{}{
+			"source_ip":        transport.ClientIPFromRequest(r),
+			"transferred_from": transfer.fingerprint,
+		},
+		Replaces: transfer.token,
+	})
+	if err != nil {
+		c.logger.Error("Failed to create session", "error", err)
+		respondErrorWithStatus(w, "INTERNAL_ERROR", "Session creation failed", nil, http.StatusInternalServerError)
+		return
+	}
+
+	// 旧会话的隧道迁移到新会话：新隧道全部创建后再删除旧隧道、撤销旧会话
+	previous, err := c.tunnelManager.ListTunnels(ctx, &tunnel.TunnelFilter{ClientID: clientID})
+	if err != nil {
+		c.logger.Warn("Session transfer: failed to list tunnels", "client_id", clientID, "error", err)
+	}
+	moved := []auth.TransferredTunnel{}
+	var skipped []auth.SkippedTunnel
+	for _, old := range previous {
+		if old.SessionToken != transfer.token {
+			continue
+		}
+		tun, reason := c.transferTunnel(r, sess, old)
+		if tun == nil {
+			skipped = append(skipped, auth.SkippedTunnel{PreviousTunnelID: old.ID, ServiceID: old.ServiceID, Reason: reason})
+		} else {
+			moved = append(moved, *tun)
+		}
+		c.tunnelManager.DeleteTunnel(ctx, old.ID)
+		c.revokeTunnelCredential(ctx, old.ID)
+	}
+
+	if err := c.sessionManager.RevokeSession(ctx, transfer.token); err != nil {
+		c.logger.Warn("Session transfer: failed to revoke source session", "client_id", clientID, "error", err)
+	}
+	c.notifySessionRevoked(clientID, transfer.token, "")
+
+	c.logger.Info("Session transferred", "client_id", clientID, "from", transfer.fingerprint, "to", fingerprint,
+		"tunnels", len(moved), "skipped", len(skipped))
+	c.auditAccess(ctx, &logging.AccessEvent{
+		ClientID: clientID,
+		SourceIP: transport.ClientIPFromRequest(r),
+		Action:   "session_transfer",
+		Result:   "success",
+		Details: map[string]interface{}{
+			"from_fingerprint": transfer.fingerprint,
+			"to_fingerprint":   fingerprint,
+			"tunnels":          len(moved),
+			"skipped":          len(skipped),
+		},
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"type":            "session_transfer_redeem",
+		"status":          "success",
+		"token":           sess.Token,
+		"session_token":   sess.Token, // legacy field name
+		"expires_at":      sess.ExpiresAt.Format(time.RFC3339),
+		"server_time":     c.serverTime(),
+		"dataplane_addrs": c.dataPlaneAddrs(),
+		"capabilities":    c.capabilities(),
+		"tunnels":         moved,
+		"skipped":         skipped,
+	})
+}
+
+// transferTunnel 为新会话重建旧设备的隧道（同一服务与目标、剩余有效期），按新设备重新评估策略
+// 未能重建时返回原因
+func (c *Controller) transferTunnel(r *http.Request, sess *session.Session, old *tunnel.Tunnel) (*auth.TransferredTunnel, string) {
+	ctx := r.Context()
+	if c.maintenance.status().Enabled {
+		return nil, transferSkipMaintenance
+	}
+	serviceConfig, err := c.tunnelManager.GetServiceConfig(ctx, old.ServiceID)
+	if err != nil {
+		return nil, transferSkipServiceNotFound
+	}
+	if old.IsEndToEnd() || serviceConfig.EndToEnd {
+		return nil, transferSkipE2ERequired
+	}
+	if old.IsReverseForward() {
+		return nil, transferSkipReverseForward
+	}
+
+	var ttl int64
+	if !old.ExpiresAt.IsZero() {
+		remaining := old.ExpiresAt.Sub(clock.Or(c.config.Clock).Now())
+		if remaining <= 0 {
+			return nil, transferSkipExpired
+		}
+		ttl = int64(math.Ceil(remaining.Seconds()))
+	}
+
+	decision, err := c.policyEngine.EvaluateAccess(ctx, &policy.AccessRequest{
+		ClientID:   sess.ClientID,
+		ServiceID:  old.ServiceID,
+		DeviceInfo: sess.DeviceInfo,
+		SourceIP:   transport.ClientIPFromRequest(r),
+		Timestamp:  time.Now(),
+	})
+	if err != nil || !decision.Allowed {
+		reason := "policy evaluation failed"
+		if err == nil {
+			reason = decision.Reason
+		}
+		c.auditAccess(ctx, &logging.AccessEvent{
+			ClientID:  sess.ClientID,
+			ServiceID: old.ServiceID,
+			SourceIP:  transport.ClientIPFromRequest(r),
+			Action:    "tunnel_create",
+			Result:    "denied",
+			Reason:    reason,
+			Details:   map[string]interface{}{"transferred_from": old.ID},
+		})
+		return nil, transferSkipPolicyDenied
+	}
+	if decision.Constraints != nil && decision.Constraints.RequireE2E {
+		return nil, transferSkipE2ERequired
+	}
+	obfuscate := policyObfuscate(decision)
+	if obfuscate && !(c.capabilities().Has(tunnel.CapabilityObfuscate) && sessionCapabilities(sess).Supports(tunnel.CapabilityObfuscate)) {
+		return nil, transferSkipObfuscate
+	}
+
+	// 模式化服务沿用旧隧道的具体目标
+	var targetHost string
+	var targetPort int
+	if serviceConfig.IsPattern() {
+		host, port, err := serviceConfig.ResolveTunnelTarget(old)
+		if err != nil {
+			return nil, transferSkipFailed
+		}
+		targetHost, targetPort = host, port
+	}
+
+	tun, err := c.tunnelManager.CreateTunnel(ctx, &tunnel.CreateTunnelRequest{
+		SessionToken: sess.Token,
+		ClientID:     sess.ClientID,
+		ServiceID:    old.ServiceID,
+		Protocol:     old.Protocol,
+		TargetHost:   targetHost,
+		TargetPort:   targetPort,
+		Multiplex:    old.IsMultiplexed(),
+		TTL:          ttl,
+		ClientAddr:   transport.ClientAddrFromRequest(r),
+		QoSClass:     policyQoSClass(decision),
+		TraceID:      traceIDFromContext(r.Context()),
+		Obfuscate:    obfuscate,
+	})
+	if err != nil {
+		c.logger.Error("Session transfer: failed to create tunnel", "service_id", old.ServiceID, "error", err)
+		return nil, transferSkipFailed
+	}
+	credential, err := c.mintTunnelCredential(ctx, tun, serviceConfig)
+	if err != nil {
+		c.logger.Error("Session transfer: failed to mint tunnel credential", "tunnel_id", tun.ID, "error", err)
+		c.tunnelManager.DeleteTunnel(ctx, tun.ID)
+		return nil, transferSkipCredential
+	}
+
+	c.auditAccess(ctx, &logging.AccessEvent{
+		ClientID:  sess.ClientID,
+		ServiceID: old.ServiceID,
+		SourceIP:  transport.ClientIPFromRequest(r),
+		Action:    "tunnel_create",
+		Result:    "success",
+		Details:   map[string]interface{}{"tunnel_id": tun.ID, "transferred_from": old.ID},
+	})
+	c.notifyTunnelCreated(tun, serviceConfig)
+
+	moved := &auth.TransferredTunnel{
+		TunnelID:         tun.ID,
+		PreviousTunnelID: old.ID,
+		ServiceID:        tun.ServiceID,
+		TargetHost:       targetHost,
+		TargetPort:       targetPort,
+		Multiplex:        tun.IsMultiplexed(),
+		Obfuscate:        tun.IsObfuscated(),
+		ExpiresAt:        tun.ExpiresAt,
+	}
+	if credential != nil {
+		moved.Credentials, _ = json.Marshal(credential)
+	}
+	return moved, ""
+}
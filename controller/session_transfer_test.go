@@ -0,0 +1,162 @@
+package controller
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/houzhh15/sdp-common/auth"
+	"github.com/houzhh15/sdp-common/cert"
+	"github.com/houzhh15/sdp-common/clock"
+	"github.com/houzhh15/sdp-common/logging"
+	"github.com/houzhh15/sdp-common/policy"
+	"github.com/houzhh15/sdp-common/tunnel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func redeemTransfer(c *Controller, clientCert *x509.Certificate, code string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(auth.TransferRedeemRequest{
+		Code:       code,
+		DeviceInfo: auth.DeviceInfo{DeviceID: "desktop-1", OS: "linux"},
+	})
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/transfer/redeem", strings.NewReader(string(body)))
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{clientCert}}
+	w := httptest.NewRecorder()
+	c.mux.ServeHTTP(w, req)
+	return w
+}
+
+func requestTransfer(t *testing.T, c *Controller, token string) string {
+	t.Helper()
+	w := serveRequest(c, http.MethodPost, "/api/v1/auth/transfer", token, "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp auth.TransferResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.NotEmpty(t, resp.Code)
+	return resp.Code
+}
+
+func TestSessionTransfer(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newIdempotencyTestController(t)
+	c.mux = http.NewServeMux()
+	c.registerHandlers()
+
+	pki := newInternalTestPKI(t)
+	laptop := pki.manager(pki.issue("alice", "")).GetX509Certificate()
+	desktop := pki.manager(pki.issue("alice", "")).GetX509Certificate()
+	other := pki.manager(pki.issue("bob", "")).GetX509Certificate()
+
+	w := handshakeWithCert(c, laptop, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var hs auth.HandshakeResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &hs))
+	oldToken := hs.Token
+
+	// svc-2 的策略在转移前被删除：新设备不再有权访问，隧道不迁移
+	require.NoError(t, c.tunnelManager.CreateServiceConfig(ctx, &tunnel.ServiceConfig{ServiceID: "svc-2", TargetHost: "127.0.0.1", TargetPort: 9090}))
+	require.NoError(t, c.policyEngine.SavePolicy(ctx, &policy.Policy{PolicyID: "p2", ClientID: "alice", ServiceID: "svc-2", ExpiryTime: time.Now().Add(time.Hour)}))
+	require.Equal(t, http.StatusCreated, postTunnel(c, oldToken, "svc-1", "").Code)
+	require.Equal(t, http.StatusCreated, postTunnel(c, oldToken, "svc-2", "").Code)
+	require.NoError(t, c.policyEngine.DeletePolicy(ctx, "p2"))
+
+	// 其他身份的证书不能兑换，转移码随即作废
+	code := requestTransfer(t, c, oldToken)
+	assert.Equal(t, http.StatusForbidden, redeemTransfer(c, other, code).Code)
+	assert.Equal(t, http.StatusNotFound, redeemTransfer(c, desktop, code).Code)
+
+	code = requestTransfer(t, c, oldToken)
+	w = redeemTransfer(c, desktop, strings.ToLower(code))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp auth.TransferRedeemResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.NotEmpty(t, resp.Token)
+	require.Len(t, resp.Tunnels, 1)
+	assert.Equal(t, "svc-1", resp.Tunnels[0].ServiceID)
+	require.Len(t, resp.Skipped, 1)
+	assert.Equal(t, "svc-2", resp.Skipped[0].ServiceID)
+	assert.Equal(t, transferSkipPolicyDenied, resp.Skipped[0].Reason)
+
+	// 新会话属于新设备，旧会话及其隧道已撤销
+	sess, err := c.sessionManager.ValidateSession(ctx, resp.Token)
+	require.NoError(t, err)
+	assert.Equal(t, calculateFingerprint(desktop), sess.CertFingerprint)
+	assert.Equal(t, "desktop-1", sess.DeviceInfo.DeviceID)
+	_, err = c.sessionManager.ValidateSession(ctx, oldToken)
+	assert.Error(t, err)
+	tunnels, err := c.tunnelManager.ListTunnels(ctx, &tunnel.TunnelFilter{ClientID: "alice"})
+	require.NoError(t, err)
+	require.Len(t, tunnels, 1)
+	assert.Equal(t, resp.Tunnels[0].TunnelID, tunnels[0].ID)
+	assert.Equal(t, resp.Token, tunnels[0].SessionToken)
+
+	// 转移码只能使用一次
+	assert.Equal(t, http.StatusNotFound, redeemTransfer(c, desktop, code).Code)
+	assert.Equal(t, http.StatusUnauthorized, serveRequest(c, http.MethodPost, "/api/v1/auth/transfer", oldToken, "").Code)
+}
+
+func TestSessionTransfer_Expired(t *testing.T) {
+	c, token := newIdempotencyTestController(t)
+	fake := clock.NewFake(time.Now())
+	c.config.Clock = fake
+	c.config.SessionTransferTTL = time.Minute
+	c.mux = http.NewServeMux()
+	c.registerHandlers()
+
+	pki := newInternalTestPKI(t)
+	desktop := pki.manager(pki.issue("alice", "")).GetX509Certificate()
+
+	code := requestTransfer(t, c, token)
+	fake.Advance(2 * time.Minute)
+	assert.Equal(t, http.StatusNotFound, redeemTransfer(c, desktop, code).Code)
+
+	// 旧会话不受影响
+	_, err := c.sessionManager.ValidateSession(context.Background(), token)
+	assert.NoError(t, err)
+}
+
+func TestSessionTransfer_IdentityConflict(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newIdempotencyTestController(t)
+	c.config.IdentityConflictPolicy = cert.ConflictPolicyReject
+	c.mux = http.NewServeMux()
+	c.registerHandlers()
+
+	pki := newInternalTestPKI(t)
+	laptop := pki.manager(pki.issue("alice", "")).GetX509Certificate()
+	desktop := pki.manager(pki.issue("alice", "")).GetX509Certificate()
+	tablet := pki.manager(pki.issue("alice", "")).GetX509Certificate()
+
+	w := handshakeWithCert(c, laptop, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var hs auth.HandshakeResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &hs))
+
+	// 与源会话证书的冲突是转移的预期结果：记录安全事件但不拒绝
+	w = redeemTransfer(c, desktop, requestTransfer(t, c, hs.Token))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp auth.TransferRedeemResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	events, err := c.auditLogger.Query(ctx, &logging.AuditFilter{EventType: logging.EventIdentityConflict})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	details := events[0].Data.(*logging.SecurityEvent).Details
+	assert.Equal(t, calculateFingerprint(laptop), details["conflicting_fingerprint"])
+	assert.Equal(t, "transferred", details["action"])
+
+	// 仍有其他活跃证书（laptop）时按 reject 策略拒绝，新证书不注册
+	w = redeemTransfer(c, tablet, requestTransfer(t, c, resp.Token))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "IDENTITY_CONFLICT")
+	_, err = c.certRegistry.GetCertInfo(calculateFingerprint(tablet))
+	assert.Error(t, err)
+	_, err = c.sessionManager.ValidateSession(ctx, resp.Token)
+	assert.NoError(t, err)
+}
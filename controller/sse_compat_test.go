@@ -0,0 +1,73 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/houzhh15/sdp-common/tunnel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSubscriberNotifierCompatibility 验证 tunnel.Subscriber 与 Controller 的 Notifier 端点互通
+func TestSubscriberNotifierCompatibility(t *testing.T) {
+	c := newAdminTestController(t, &Config{AgentStreamPath: "/sse/tunnels"})
+	c.mux = http.NewServeMux()
+	c.registerHandlers()
+
+	server := httptest.NewServer(c.mux)
+	defer server.Close()
+
+	cases := []struct {
+		name       string
+		streamPath string
+	}{
+		{"default", ""},
+		{"legacy agent path", "/v1/agent/tunnels/stream"},
+		{"configured path", "/sse/tunnels"},
+	}
+	for i, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			agentID := "ah-" + tc.name
+			events := make(chan *tunnel.TunnelEvent, 1)
+			sub := tunnel.NewSubscriber(&tunnel.SubscriberConfig{
+				ControllerURL: server.URL,
+				AgentID:       agentID,
+				StreamPath:    tc.streamPath,
+				Callback: func(event *tunnel.TunnelEvent) error {
+					events <- event
+					return nil
+				},
+			})
+			ctx, cancel := context.WithCancel(context.Background())
+			require.NoError(t, sub.Start(ctx))
+			defer func() {
+				cancel()
+				sub.Stop()
+				c.tunnelNotifier.Unsubscribe(agentID)
+			}()
+
+			require.Eventually(t, func() bool {
+				return slices.Contains(c.tunnelNotifier.GetClients(), agentID)
+			}, 5*time.Second, 10*time.Millisecond, "subscriber should register under its agent ID")
+
+			tunnelID := "tun-" + string(rune('a'+i))
+			require.NoError(t, c.tunnelNotifier.NotifyOne(agentID, &tunnel.TunnelEvent{
+				Type:   tunnel.EventTypeCreated,
+				Tunnel: &tunnel.Tunnel{ID: tunnelID, ServiceID: "svc-1"},
+			}))
+
+			select {
+			case event := <-events:
+				assert.Equal(t, tunnel.EventTypeCreated, event.Type)
+				assert.Equal(t, tunnelID, event.Tunnel.ID)
+			case <-time.After(5 * time.Second):
+				t.Fatal("tunnel event not delivered")
+			}
+		})
+	}
+}
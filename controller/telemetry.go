@@ -0,0 +1,253 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/houzhh15/sdp-common/protocol"
+	"gorm.io/gorm"
+)
+
+const (
+	// maxTelemetryFeatures / maxTelemetryErrorKinds 单次上报的字段数量上限，防止客户端撑大统计表
+	maxTelemetryFeatures   = 64
+	maxTelemetryErrorKinds = 64
+)
+
+// telemetryReport 客户端 SDK 上报的使用统计（与 auth.TelemetryReport 对应）
+type telemetryReport struct {
+	SDKVersion  string           `json:"sdk_version"`
+	OS          string           `json:"os"`
+	Arch        string           `json:"arch"`
+	GoVersion   string           `json:"go_version"`
+	Features    []string         `json:"features,omitempty"`
+	ErrorCounts map[string]int64 `json:"error_counts,omitempty"`
+}
+
+// ClientTelemetry 单个客户端的最新上报信息及累计错误数
+type ClientTelemetry struct {
+	ClientID     string           `json:"client_id"`
+	SDKVersion   string           `json:"sdk_version"`
+	OS           string           `json:"os"`
+	Arch         string           `json:"arch"`
+	GoVersion    string           `json:"go_version"`
+	Features     []string         `json:"features,omitempty"`
+	ErrorCounts  map[string]int64 `json:"error_counts,omitempty"`
+	ReportCount  int64            `json:"report_count"`
+	FirstSeenAt  time.Time        `json:"first_seen_at"`
+	LastReportAt time.Time        `json:"last_report_at"`
+}
+
+// TelemetrySummary 按版本/系统/特性聚合的客户端统计
+type TelemetrySummary struct {
+	Clients    int              `json:"clients"`
+	Versions   map[string]int   `json:"versions"`
+	OS         map[string]int   `json:"os"`
+	Features   map[string]int   `json:"features"`
+	ErrorTotal map[string]int64 `json:"error_total"`
+}
+
+// telemetryRecord 客户端遥测数据库记录（每个 ClientID 一行）
+type telemetryRecord struct {
+	ClientID        string `gorm:"primaryKey"`
+	SDKVersion      string `gorm:"index"`
+	OS              string
+	Arch            string
+	GoVersion       string
+	FeaturesJSON    string `gorm:"type:text"` // JSON 序列化的特性列表
+	ErrorCountsJSON string `gorm:"type:text"` // JSON 序列化的累计错误数
+	ReportCount     int64
+	FirstSeenAt     time.Time
+	LastReportAt    time.Time `gorm:"index"`
+}
+
+// TableName 指定表名
+func (telemetryRecord) TableName() string {
+	return "client_telemetry"
+}
+
+// telemetryStore 客户端遥测统计存储（数据库，按 ClientID 保存最新上报），Controller 重启后统计保留
+type telemetryStore struct {
+	db *gorm.DB
+}
+
+// newTelemetryStore 创建遥测统计存储并迁移表结构
+func newTelemetryStore(db *gorm.DB) (*telemetryStore, error) {
+	if db == nil {
+		return nil, errors.New("database is required")
+	}
+	if err := db.AutoMigrate(&telemetryRecord{}); err != nil {
+		return nil, fmt.Errorf("failed to migrate client_telemetry table: %w", err)
+	}
+	return &telemetryStore{db: db}, nil
+}
+
+// Record 记录一次上报：版本/平台/特性取最新值，错误计数累加
+func (s *telemetryStore) Record(ctx context.Context, clientID string, report *telemetryReport, now time.Time) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var record telemetryRecord
+		err := tx.Where("client_id = ?", clientID).Take(&record).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			record = telemetryRecord{ClientID: clientID, FirstSeenAt: now}
+		case err != nil:
+			return fmt.Errorf("failed to load telemetry: %w", err)
+		}
+
+		entry, err := record.toClientTelemetry()
+		if err != nil {
+			return err
+		}
+		for kind, n := range report.ErrorCounts {
+			if n > 0 {
+				entry.ErrorCounts[kind] += n
+			}
+		}
+
+		featuresJSON, err := json.Marshal(report.Features)
+		if err != nil {
+			return fmt.Errorf("failed to marshal features: %w", err)
+		}
+		errorCountsJSON, err := json.Marshal(entry.ErrorCounts)
+		if err != nil {
+			return fmt.Errorf("failed to marshal error counts: %w", err)
+		}
+
+		record.SDKVersion = report.SDKVersion
+		record.OS = report.OS
+		record.Arch = report.Arch
+		record.GoVersion = report.GoVersion
+		record.FeaturesJSON = string(featuresJSON)
+		record.ErrorCountsJSON = string(errorCountsJSON)
+		record.ReportCount++
+		record.LastReportAt = now
+		if err := tx.Save(&record).Error; err != nil {
+			return fmt.Errorf("failed to save telemetry: %w", err)
+		}
+		return nil
+	})
+}
+
+// List 返回所有客户端统计（按 ClientID 排序）
+func (s *telemetryStore) List(ctx context.Context) ([]*ClientTelemetry, error) {
+	var records []telemetryRecord
+	if err := s.db.WithContext(ctx).Order("client_id").Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("failed to query telemetry: %w", err)
+	}
+
+	result := make([]*ClientTelemetry, 0, len(records))
+	for i := range records {
+		entry, err := records[i].toClientTelemetry()
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, entry)
+	}
+	return result, nil
+}
+
+// summarizeTelemetry 按版本/系统/特性聚合客户端统计
+func summarizeTelemetry(clients []*ClientTelemetry) *TelemetrySummary {
+	summary := &TelemetrySummary{
+		Clients:    len(clients),
+		Versions:   make(map[string]int),
+		OS:         make(map[string]int),
+		Features:   make(map[string]int),
+		ErrorTotal: make(map[string]int64),
+	}
+	for _, entry := range clients {
+		summary.Versions[entry.SDKVersion]++
+		summary.OS[entry.OS]++
+		for _, feature := range entry.Features {
+			summary.Features[feature]++
+		}
+		for kind, n := range entry.ErrorCounts {
+			summary.ErrorTotal[kind] += n
+		}
+	}
+	return summary
+}
+
+// toClientTelemetry 反序列化数据库记录
+func (r *telemetryRecord) toClientTelemetry() (*ClientTelemetry, error) {
+	entry := &ClientTelemetry{
+		ClientID:     r.ClientID,
+		SDKVersion:   r.SDKVersion,
+		OS:           r.OS,
+		Arch:         r.Arch,
+		GoVersion:    r.GoVersion,
+		ErrorCounts:  make(map[string]int64),
+		ReportCount:  r.ReportCount,
+		FirstSeenAt:  r.FirstSeenAt,
+		LastReportAt: r.LastReportAt,
+	}
+	if r.FeaturesJSON != "" {
+		if err := json.Unmarshal([]byte(r.FeaturesJSON), &entry.Features); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal features of %s: %w", r.ClientID, err)
+		}
+	}
+	if r.ErrorCountsJSON != "" {
+		if err := json.Unmarshal([]byte(r.ErrorCountsJSON), &entry.ErrorCounts); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal error counts of %s: %w", r.ClientID, err)
+		}
+	}
+	return entry, nil
+}
+
+// handleTelemetry handles opt-in client SDK usage reports
+func (c *Controller) handleTelemetry(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := extractBearerToken(r)
+	if token == "" {
+		respondErrorWithStatus(w, "UNAUTHORIZED", "Missing authorization token", nil, http.StatusUnauthorized)
+		return
+	}
+
+	sess, err := c.sessionManager.ValidateSession(r.Context(), token)
+	if err != nil {
+		respondErrorWithStatus(w, "UNAUTHORIZED", "Invalid or expired session", nil, http.StatusUnauthorized)
+		return
+	}
+
+	var report telemetryReport
+	if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+		respondErrorWithStatus(w, "INVALID_REQUEST", "Invalid request body", nil, http.StatusBadRequest)
+		return
+	}
+	if len(report.Features) > maxTelemetryFeatures || len(report.ErrorCounts) > maxTelemetryErrorKinds {
+		respondErrorWithStatus(w, "INVALID_REQUEST", "Too many telemetry fields",
+			map[string]interface{}{"error_code": protocol.ErrCodeInvalidRequest}, http.StatusBadRequest)
+		return
+	}
+
+	if err := c.telemetry.Record(r.Context(), sess.ClientID, &report, time.Now()); err != nil {
+		c.logger.Error("Failed to record telemetry", "client_id", sess.ClientID, "error", err)
+		respondErrorWithStatus(w, "INTERNAL_ERROR", "Failed to record telemetry", nil, http.StatusInternalServerError)
+		return
+	}
+	c.logger.Debug("Telemetry report received", "client_id", sess.ClientID, "sdk_version", report.SDKVersion, "os", report.OS)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleAdminTelemetry returns aggregated client SDK usage statistics
+func (c *Controller) handleAdminTelemetry(w http.ResponseWriter, r *http.Request) {
+	clients, err := c.telemetry.List(r.Context())
+	if err != nil {
+		c.logger.Error("Failed to list telemetry", "error", err)
+		respondErrorWithStatus(w, "INTERNAL_ERROR", "Failed to list telemetry", nil, http.StatusInternalServerError)
+		return
+	}
+	respondAdmin(w, "admin_telemetry", map[string]interface{}{
+		"summary": summarizeTelemetry(clients),
+		"clients": clients,
+	})
+}
@@ -0,0 +1,114 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func postTelemetry(c *Controller, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/telemetry", strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	c.handleTelemetry(w, req)
+	return w
+}
+
+func newTestTelemetryStore(t *testing.T, path string) *telemetryStore {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(path), &gorm.Config{})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	store, err := newTelemetryStore(db)
+	require.NoError(t, err)
+	return store
+}
+
+func TestTelemetryStore_Aggregation(t *testing.T) {
+	store := newTestTelemetryStore(t, ":memory:")
+	ctx := context.Background()
+	now := time.Now()
+
+	require.NoError(t, store.Record(ctx, "alice", &telemetryReport{SDKVersion: "1.0.0", OS: "linux", Features: []string{"multiplex"}, ErrorCounts: map[string]int64{"refresh": 2}}, now))
+	require.NoError(t, store.Record(ctx, "alice", &telemetryReport{SDKVersion: "1.1.0", OS: "linux", Features: []string{"multiplex"}, ErrorCounts: map[string]int64{"refresh": 1}}, now))
+	require.NoError(t, store.Record(ctx, "bob", &telemetryReport{SDKVersion: "1.1.0", OS: "darwin", ErrorCounts: map[string]int64{"handshake": 1}}, now))
+
+	clients, err := store.List(ctx)
+	require.NoError(t, err)
+	summary := summarizeTelemetry(clients)
+	assert.Equal(t, 2, summary.Clients)
+	assert.Equal(t, map[string]int{"1.1.0": 2}, summary.Versions)
+	assert.Equal(t, map[string]int{"linux": 1, "darwin": 1}, summary.OS)
+	assert.Equal(t, map[string]int{"multiplex": 1}, summary.Features)
+	assert.Equal(t, map[string]int64{"refresh": 3, "handshake": 1}, summary.ErrorTotal)
+
+	require.Len(t, clients, 2)
+	assert.Equal(t, "alice", clients[0].ClientID)
+	assert.Equal(t, int64(2), clients[0].ReportCount)
+}
+
+func TestTelemetryStore_PersistsAcrossRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "controller.db")
+	ctx := context.Background()
+	first := time.Now().Add(-time.Hour).UTC()
+
+	store := newTestTelemetryStore(t, path)
+	require.NoError(t, store.Record(ctx, "alice", &telemetryReport{SDKVersion: "1.0.0", OS: "linux", ErrorCounts: map[string]int64{"refresh": 2}}, first))
+
+	// 重新打开数据库，模拟 Controller 重启
+	reopened := newTestTelemetryStore(t, path)
+	require.NoError(t, reopened.Record(ctx, "alice", &telemetryReport{SDKVersion: "1.1.0", OS: "linux", ErrorCounts: map[string]int64{"refresh": 1}}, time.Now()))
+
+	clients, err := reopened.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, clients, 1)
+	assert.Equal(t, "1.1.0", clients[0].SDKVersion)
+	assert.Equal(t, int64(2), clients[0].ReportCount)
+	assert.Equal(t, int64(3), clients[0].ErrorCounts["refresh"])
+	assert.True(t, clients[0].FirstSeenAt.Equal(first))
+}
+
+func TestHandleTelemetry(t *testing.T) {
+	c := newAdminTestController(t, &Config{})
+	userToken := createTestSession(t, c, "bob", "user")
+	adminToken := createTestSession(t, c, "alice", "admin")
+
+	assert.Equal(t, http.StatusUnauthorized, postTelemetry(c, "", `{}`).Code)
+	assert.Equal(t, http.StatusUnauthorized, postTelemetry(c, "not-a-token", `{}`).Code)
+	assert.Equal(t, http.StatusBadRequest, postTelemetry(c, userToken, `not-json`).Code)
+
+	w := postTelemetry(c, userToken, `{"type":"telemetry_report","sdk_version":"1.0.0","os":"linux","arch":"amd64","features":["multiplex"],"error_counts":{"refresh":1}}`)
+	require.Equal(t, http.StatusNoContent, w.Code)
+
+	// 统计仅管理员可见
+	assert.Equal(t, http.StatusForbidden, adminGet(c, "/api/v1/admin/telemetry", userToken).Code)
+
+	w = adminGet(c, "/api/v1/admin/telemetry", adminToken)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp struct {
+		Summary *TelemetrySummary  `json:"summary"`
+		Clients []*ClientTelemetry `json:"clients"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, 1, resp.Summary.Clients)
+	require.Len(t, resp.Clients, 1)
+	assert.Equal(t, "bob", resp.Clients[0].ClientID)
+	assert.Equal(t, int64(1), resp.Clients[0].ErrorCounts["refresh"])
+}
@@ -0,0 +1,107 @@
+package controller
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// W3C Trace Context 请求头与响应头
+const (
+	headerTraceparent   = "traceparent"
+	headerTraceresponse = "traceresponse"
+)
+
+// 带 exemplar 的请求耗时直方图，启用 Tracing 时以请求的 trace ID 作为 exemplar
+var (
+	handshakeDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "controller_handshake_duration_seconds",
+		Help:    "Duration of client handshake requests in seconds",
+		Buckets: []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5},
+	})
+	tunnelCreateDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "controller_tunnel_create_duration_seconds",
+		Help:    "Duration of tunnel creation requests in seconds",
+		Buckets: []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5},
+	})
+)
+
+type traceIDKey struct{}
+
+// traceIDFromContext 返回请求的 trace ID，未启用 Tracing 时为空
+func traceIDFromContext(ctx context.Context) string {
+	traceID, _ := ctx.Value(traceIDKey{}).(string)
+	return traceID
+}
+
+// traceRequest 启用 Tracing 时为请求确定 trace ID（采信有效的 traceparent，否则生成），
+// 写入请求上下文并通过 traceresponse 头返回本次处理的 span
+func (c *Controller) traceRequest(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if c.config == nil || !c.config.Tracing {
+			next(w, r)
+			return
+		}
+		traceID := parseTraceparent(r.Header.Get(headerTraceparent))
+		if traceID == "" {
+			traceID = randomHex(16)
+		}
+		w.Header().Set(headerTraceresponse, "00-"+traceID+"-"+randomHex(8)+"-01")
+		next(w, r.WithContext(context.WithValue(r.Context(), traceIDKey{}, traceID)))
+	}
+}
+
+// parseTraceparent 解析 traceparent（version-traceid-parentid-flags），返回 trace ID；
+// 格式无效、版本为 ff 或 ID 全零时返回空
+func parseTraceparent(value string) string {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" ||
+		len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return ""
+	}
+	// 版本 00 恰好 4 段，更高版本允许追加字段
+	if parts[0] == "00" && len(parts) != 4 {
+		return ""
+	}
+	for _, part := range parts[:4] {
+		if !isLowerHex(part) {
+			return ""
+		}
+	}
+	if strings.Trim(parts[1], "0") == "" || strings.Trim(parts[2], "0") == "" {
+		return ""
+	}
+	return parts[1]
+}
+
+func isLowerHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if (s[i] < '0' || s[i] > '9') && (s[i] < 'a' || s[i] > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// randomHex 返回 n 字节随机数的十六进制编码
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// observeDuration 记录自 start 起的耗时，请求带 trace ID 时附加 trace_id exemplar
+func observeDuration(ctx context.Context, h prometheus.Histogram, start time.Time) {
+	seconds := time.Since(start).Seconds()
+	if traceID := traceIDFromContext(ctx); traceID != "" {
+		h.(prometheus.ExemplarObserver).ObserveWithExemplar(seconds, prometheus.Labels{"trace_id": traceID})
+		return
+	}
+	h.Observe(seconds)
+}
@@ -0,0 +1,101 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "4bf92f3577b34da6a3ce929d0e0e4736"},
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-future", "4bf92f3577b34da6a3ce929d0e0e4736"},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", ""},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", ""},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", ""},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", ""},
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", ""},
+		{"00-4bf92f3577b34da6-00f067aa0ba902b7-01", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, parseTraceparent(tt.value), tt.value)
+	}
+}
+
+func TestTracingExemplars(t *testing.T) {
+	const traceID = "0af7651916cd43dd8448eb211c80319c"
+	pki := newInternalTestPKI(t)
+	clientCert := pki.manager(pki.issue("alice", "")).GetX509Certificate()
+	c, token := newIdempotencyTestController(t)
+	c.mux = http.NewServeMux()
+	c.registerHandlers()
+
+	// 未启用 Tracing：不返回 traceresponse
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/handshake", nil)
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{clientCert}}
+	w := httptest.NewRecorder()
+	c.mux.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Empty(t, w.Header().Get(headerTraceresponse))
+
+	c.config.Tracing = true
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/auth/handshake", nil)
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{clientCert}}
+	req.Header.Set(headerTraceparent, "00-"+traceID+"-b7ad6b7169203331-01")
+	w = httptest.NewRecorder()
+	c.mux.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, traceID, parseTraceparent(w.Header().Get(headerTraceresponse)))
+
+	// 无 traceparent 时生成新的 trace ID，并记录到隧道 Metadata
+	body, _ := json.Marshal(map[string]interface{}{"session_token": token, "service_id": "svc-1", "protocol": "tcp"})
+	w = httptest.NewRecorder()
+	c.mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/tunnels", bytes.NewReader(body)))
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	generated := parseTraceparent(w.Header().Get(headerTraceresponse))
+	require.NotEmpty(t, generated)
+	assert.NotEqual(t, traceID, generated)
+	tun, err := c.tunnelManager.GetTunnel(context.Background(), tunnelIDFrom(t, w))
+	require.NoError(t, err)
+	assert.Equal(t, generated, tun.TraceID())
+
+	// OpenMetrics 输出携带 exemplar，Prometheus 文本格式不变
+	metrics := func(accept string) string {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		req.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		c.mux.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		out, err := io.ReadAll(w.Body)
+		require.NoError(t, err)
+		return string(out)
+	}
+	open := metrics("application/openmetrics-text; version=1.0.0")
+	assert.True(t, hasExemplar(open, "controller_handshake_duration_seconds_bucket", traceID), open)
+	assert.True(t, hasExemplar(open, "controller_tunnel_create_duration_seconds_bucket", generated), open)
+	assert.NotContains(t, metrics("text/plain"), "trace_id")
+}
+
+// hasExemplar 判断 OpenMetrics 输出中 metric 的某个桶携带指定 trace_id 的 exemplar
+func hasExemplar(out, metric, traceID string) bool {
+	for _, line := range strings.Split(out, "\n") {
+		if strings.HasPrefix(line, metric+"{") && strings.Contains(line, `# {trace_id="`+traceID+`"}`) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/houzhh15/sdp-common/cert"
+	"github.com/houzhh15/sdp-common/logging"
+	"github.com/houzhh15/sdp-common/transport"
+)
+
+// 信任集所属监听器
+const (
+	trustListenerControlPlane = "control_plane" // HTTPS API（Config.CAFile / CAFiles / CADirs）
+	trustListenerDataPlane    = "data_plane"    // 隧道中继（DataPlane.TLS），未单独配置时与控制平面共用
+)
+
+// trustRequest 向信任集加入 CA 的请求体
+type trustRequest struct {
+	Listener string `json:"listener"`
+	CAPEM    string `json:"ca_pem"`
+}
+
+// trustStore 返回监听器的 CA 信任集；数据平面未单独配置 TLS 时返回控制平面信任集
+func (c *Controller) trustStore(listener string) *cert.TrustStore {
+	if c.certManager == nil {
+		return nil
+	}
+	switch listener {
+	case trustListenerControlPlane:
+		return c.certManager.TrustStore()
+	case trustListenerDataPlane:
+		if c.config.DataPlane == nil {
+			return c.certManager.TrustStore()
+		}
+		return c.relayTrust.Load()
+	}
+	return nil
+}
+
+// trustListings 返回各监听器的 CA 列表，数据平面共用控制平面信任集时不单独列出
+func (c *Controller) trustListings() map[string][]*cert.CertInfo {
+	listings := make(map[string][]*cert.CertInfo)
+	control := c.trustStore(trustListenerControlPlane)
+	if control != nil {
+		listings[trustListenerControlPlane] = control.List()
+	}
+	if data := c.trustStore(trustListenerDataPlane); data != nil && data != control {
+		listings[trustListenerDataPlane] = data.List()
+	}
+	return listings
+}
+
+// handleAdminTrust lists (GET), adds (POST) or removes (DELETE) trusted CAs per listener for CA rotation
+func (c *Controller) handleAdminTrust(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		var req trustRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.CAPEM == "" {
+			respondErrorWithStatus(w, "INVALID_REQUEST", "listener and ca_pem are required", nil, http.StatusBadRequest)
+			return
+		}
+		store := c.trustStore(req.Listener)
+		if store == nil {
+			respondErrorWithStatus(w, "NOT_FOUND", "No trust store for listener", map[string]string{"listener": req.Listener}, http.StatusNotFound)
+			return
+		}
+		added, err := store.AddPEM([]byte(req.CAPEM))
+		if err != nil {
+			respondErrorWithStatus(w, "INVALID_CA", err.Error(), nil, http.StatusBadRequest)
+			return
+		}
+		clientID := c.adminClientID(r)
+		c.logger.Warn("Trusted CA added", "client_id", clientID, "listener", req.Listener, "fingerprints", added)
+		c.auditTrust(r, clientID, "trust_ca_add", req.Listener, added)
+		c.recordOpsEvent(OpsCertReloaded, "listener", OpsSeverityWarning, "Trusted CA added",
+			map[string]interface{}{"client_id": clientID, "listener": req.Listener, "fingerprints": added})
+		respondAdmin(w, "admin_trust", map[string]interface{}{"listener": req.Listener, "added": added, "listeners": c.trustListings()})
+		return
+
+	case http.MethodDelete:
+		listener := r.URL.Query().Get("listener")
+		fingerprint := r.URL.Query().Get("fingerprint")
+		store := c.trustStore(listener)
+		if store == nil || fingerprint == "" {
+			respondErrorWithStatus(w, "INVALID_REQUEST", "listener and fingerprint are required", nil, http.StatusBadRequest)
+			return
+		}
+		switch err := store.Remove(fingerprint); {
+		case errors.Is(err, cert.ErrCANotFound):
+			respondErrorWithStatus(w, "NOT_FOUND", err.Error(), map[string]string{"fingerprint": fingerprint}, http.StatusNotFound)
+			return
+		case errors.Is(err, cert.ErrLastCA):
+			respondErrorWithStatus(w, "LAST_CA", err.Error(), map[string]string{"fingerprint": fingerprint}, http.StatusConflict)
+			return
+		}
+		clientID := c.adminClientID(r)
+		c.logger.Warn("Trusted CA removed", "client_id", clientID, "listener", listener, "fingerprint", fingerprint)
+		c.auditTrust(r, clientID, "trust_ca_remove", listener, []string{fingerprint})
+		c.recordOpsEvent(OpsCertReloaded, "listener", OpsSeverityWarning, "Trusted CA removed",
+			map[string]interface{}{"client_id": clientID, "listener": listener, "fingerprint": fingerprint})
+	}
+
+	respondAdmin(w, "admin_trust", map[string]interface{}{"listeners": c.trustListings()})
+}
+
+// auditTrust 记录信任集变更
+func (c *Controller) auditTrust(r *http.Request, clientID, action, listener string, fingerprints []string) {
+	c.auditAccess(r.Context(), &logging.AccessEvent{
+		ClientID: clientID,
+		SourceIP: transport.ClientIPFromRequest(r),
+		Action:   action,
+		Result:   "success",
+		Details:  map[string]interface{}{"listener": listener, "fingerprints": fingerprints},
+	})
+}
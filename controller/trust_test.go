@@ -0,0 +1,77 @@
+package controller
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/houzhh15/sdp-common/cert"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminTrust(t *testing.T) {
+	pki := newInternalTestPKI(t)
+	c := newAdminTestController(t, &Config{})
+	c.certManager = pki.manager(pki.issue("controller", ""))
+	adminToken := createTestSession(t, c, "root", "admin")
+	userToken := createTestSession(t, c, "alice", "user")
+
+	listCAs := func(w *http.Response) map[string][]*cert.CertInfo {
+		var resp struct {
+			Listeners map[string][]*cert.CertInfo `json:"listeners"`
+		}
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+		return resp.Listeners
+	}
+
+	w := serveRequest(c, http.MethodGet, "/api/v1/admin/trust", userToken, "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// 未单独配置数据平面 TLS 时只列出控制平面信任集
+	w = serveRequest(c, http.MethodGet, "/api/v1/admin/trust", adminToken, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	listeners := listCAs(w.Result())
+	require.Len(t, listeners[trustListenerControlPlane], 1)
+	assert.NotContains(t, listeners, trustListenerDataPlane)
+	oldCA := listeners[trustListenerControlPlane][0].Fingerprint
+
+	// 加入新 CA：由新 CA 签发的证书立即通过控制平面校验
+	newPKI := newInternalTestPKI(t)
+	caPEM, err := os.ReadFile(newPKI.CAFile)
+	require.NoError(t, err)
+	body, _ := json.Marshal(trustRequest{Listener: trustListenerControlPlane, CAPEM: string(caPEM)})
+	w = serveRequest(c, http.MethodPost, "/api/v1/admin/trust", adminToken, string(body))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, listCAs(w.Result())[trustListenerControlPlane], 2)
+
+	certFile, _ := newPKI.issue("client", "")
+	certPEM, err := os.ReadFile(certFile)
+	require.NoError(t, err)
+	block, _ := pem.Decode(certPEM)
+	clientCert, err := x509.ParseCertificate(block.Bytes)
+	require.NoError(t, err)
+	require.NoError(t, c.verifyRotationCert(clientCert, "client"))
+
+	body, _ = json.Marshal(trustRequest{Listener: "unknown", CAPEM: string(caPEM)})
+	w = serveRequest(c, http.MethodPost, "/api/v1/admin/trust", adminToken, string(body))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	body, _ = json.Marshal(trustRequest{Listener: trustListenerControlPlane, CAPEM: "not a pem"})
+	w = serveRequest(c, http.MethodPost, "/api/v1/admin/trust", adminToken, string(body))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// 移除旧 CA；最后一张 CA 不可移除
+	remove := func(fingerprint string) int {
+		query := url.Values{"listener": {trustListenerControlPlane}, "fingerprint": {fingerprint}}
+		return serveRequest(c, http.MethodDelete, "/api/v1/admin/trust?"+query.Encode(), adminToken, "").Code
+	}
+	assert.Equal(t, http.StatusOK, remove(oldCA))
+	assert.Equal(t, http.StatusNotFound, remove(oldCA))
+	remaining := c.certManager.TrustStore().List()
+	require.Len(t, remaining, 1)
+	assert.Equal(t, http.StatusConflict, remove(remaining[0].Fingerprint))
+}
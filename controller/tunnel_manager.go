@@ -1,8 +1,14 @@
 package controller
 
 import (
+	"cmp"
 	"context"
+	"errors"
 	"fmt"
+	"net"
+	"slices"
+	"sort"
+	"strconv"
 	"sync"
 	"time"
 
@@ -11,17 +17,40 @@ import (
 	"github.com/houzhh15/sdp-common/tunnel"
 )
 
+var (
+	// errE2ENotEnabled the tunnel was created without an IH end-to-end key
+	errE2ENotEnabled = errors.New("tunnel is not end-to-end encrypted")
+	// errE2EKeyExists the agent key of the tunnel has already been published
+	errE2EKeyExists = errors.New("agent e2e key already published")
+)
+
 // InMemoryTunnelManager implements tunnel.Manager interface using in-memory storage
 type InMemoryTunnelManager struct {
 	tunnels  sync.Map // map[string]*tunnel.Tunnel
 	services sync.Map // map[string]*tunnel.ServiceConfig
+	deleted  sync.Map // map[string]*tunnel.ServiceConfig, soft-deleted services (recycle bin)
 	logger   logging.Logger
+
+	// epoch distinguishes versions of different manager instances (e.g. across restarts)
+	epoch          string
+	serviceVersion objectVersion // bumped on every service config change
+	tunnelVersion  objectVersion // bumped on every tunnel change
+
+	// lookupIP resolves TargetHost for services with ResolveOnController (replaceable in tests)
+	lookupIP func(ctx context.Context, host string) ([]net.IP, error)
 }
 
 // NewInMemoryTunnelManager creates a new in-memory tunnel manager
 func NewInMemoryTunnelManager(logger logging.Logger) tunnel.Manager {
+	now := time.Now()
 	return &InMemoryTunnelManager{
-		logger: logger,
+		logger:         logger,
+		epoch:          strconv.FormatInt(now.UnixNano(), 36),
+		serviceVersion: objectVersion{modified: now},
+		tunnelVersion:  objectVersion{modified: now},
+		lookupIP: func(ctx context.Context, host string) ([]net.IP, error) {
+			return net.DefaultResolver.LookupIP(ctx, "ip", host)
+		},
 	}
 }
 
@@ -33,6 +62,12 @@ func (m *InMemoryTunnelManager) CreateTunnel(ctx context.Context, req *tunnel.Cr
 		return nil, fmt.Errorf("service not found: %s (error: %w)", req.ServiceID, err)
 	}
 
+	// 解析具体目标地址（模式化服务需校验请求的目标是否在 CIDR/端口集合内）
+	targetHost, targetPort, err := serviceConfig.ResolveTarget(req.TargetHost, req.TargetPort)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tunnel target: %w", err)
+	}
+
 	// Generate a simple tunnel ID (without uuid dependency for now)
 	tunnelID := fmt.Sprintf("tunnel-%d", time.Now().UnixNano())
 
@@ -48,25 +83,142 @@ func (m *InMemoryTunnelManager) CreateTunnel(ctx context.Context, req *tunnel.Cr
 		Stats:        &tunnel.TunnelStats{},
 		Metadata:     req.Metadata,
 	}
+	if req.TTL > 0 {
+		// 到期前推送 tunnel_expiring，到期后由 Controller 删除
+		tun.ExpiresAt = tun.CreatedAt.Add(time.Duration(req.TTL) * time.Second)
+	}
 
 	if tun.Metadata == nil {
 		tun.Metadata = make(map[string]interface{})
 	}
 
 	// 将目标地址存储到 Metadata 中（用于 TCP Proxy 查询）
-	tun.Metadata["target_host"] = serviceConfig.TargetHost
-	tun.Metadata["target_port"] = serviceConfig.TargetPort
+	tun.Metadata["target_host"] = targetHost
+	tun.Metadata["target_port"] = targetPort
+	if req.Multiplex || req.ReverseForward != "" {
+		// AH 通过该标记决定以多路复用方式处理数据平面连接
+		tun.Metadata[tunnel.MetadataKeyMultiplex] = true
+	}
+	if req.ReverseForward != "" {
+		// AH 在该地址监听，并在多路复用会话上向 IH 打开流
+		tun.Metadata[tunnel.MetadataKeyReverseForward] = req.ReverseForward
+	}
+	if req.Obfuscate {
+		// IH 与 AH 均以混淆连接包装数据平面连接
+		tun.Metadata[tunnel.MetadataKeyObfuscate] = true
+	}
+	if req.ClientAddr != "" {
+		// AH 为启用 PROXY protocol 的服务向目标转发 IH 原始源地址
+		tun.Metadata[tunnel.MetadataKeyClientAddr] = req.ClientAddr
+	}
+	if req.E2EPublicKey != "" {
+		// IH 公钥，AH 上报自身公钥后双方即可派生隧道密钥
+		tun.Metadata[tunnel.MetadataKeyE2EPublicKey] = req.E2EPublicKey
+	}
+	if serviceConfig.ResolveOnController && net.ParseIP(targetHost) == nil {
+		// 由 Controller 解析目标域名，AH 直接拨号该 IP，不依赖 AH 本地 DNS
+		ip, err := m.resolveTarget(ctx, targetHost)
+		if err != nil {
+			return nil, fmt.Errorf("resolve target %s: %w", targetHost, err)
+		}
+		tun.Metadata[tunnel.MetadataKeyTargetIP] = ip.String()
+	}
+	if len(serviceConfig.RelayChain) > 0 {
+		// 多跳隧道：IH 连接第一跳，AH 连接最后一跳
+		tun.Metadata[tunnel.MetadataKeyRelayChain] = slices.Clone(serviceConfig.RelayChain)
+	}
+	if qosClass := cmp.Or(req.QoSClass, serviceConfig.QoSClass); qosClass != "" {
+		// 策略指定的服务等级优先于服务配置
+		tun.Metadata[tunnel.MetadataKeyQoSClass] = qosClass
+	}
+	if req.TraceID != "" {
+		tun.Metadata[tunnel.MetadataKeyTraceID] = req.TraceID
+	}
 
 	m.tunnels.Store(tun.ID, tun)
+	m.tunnelVersion.bump()
 	m.logger.Info("Tunnel created",
 		"tunnel_id", tun.ID,
 		"client_id", req.ClientID,
 		"service_id", req.ServiceID,
-		"target", fmt.Sprintf("%s:%d", serviceConfig.TargetHost, serviceConfig.TargetPort))
+		"target", fmt.Sprintf("%s:%d", targetHost, targetPort))
 
 	return tun, nil
 }
 
+// RestoreTunnel re-registers a tunnel reported by an AH after a Controller restart,
+// keeping its original ID so the relay pairing and AH state stay valid.
+// A tunnel restored concurrently by another report is returned as is
+func (m *InMemoryTunnelManager) RestoreTunnel(ctx context.Context, reported *tunnel.ReportedTunnel, service *tunnel.ServiceConfig, targetHost string, targetPort int) (*tunnel.Tunnel, error) {
+	now := time.Now()
+	createdAt := reported.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = now
+	}
+	tun := &tunnel.Tunnel{
+		ID:         reported.TunnelID,
+		ClientID:   reported.ClientID,
+		ServiceID:  reported.ServiceID,
+		Protocol:   service.Protocol,
+		Status:     tunnel.TunnelStatusActive,
+		CreatedAt:  createdAt,
+		LastActive: now,
+		ExpiresAt:  reported.ExpiresAt,
+		Stats:      &tunnel.TunnelStats{},
+		Metadata: map[string]interface{}{
+			"target_host": targetHost,
+			"target_port": targetPort,
+			"reconciled":  true,
+		},
+	}
+	if reported.Multiplex {
+		tun.Metadata[tunnel.MetadataKeyMultiplex] = true
+	}
+	if reported.Obfuscate {
+		tun.Metadata[tunnel.MetadataKeyObfuscate] = true
+	}
+	if service.ResolveOnController && net.ParseIP(targetHost) == nil && net.ParseIP(reported.TargetHost) != nil {
+		// AH 上报的是创建隧道时由 Controller 解析出的 IP，沿用而不重新解析
+		tun.Metadata[tunnel.MetadataKeyTargetIP] = reported.TargetHost
+	}
+	if len(service.RelayChain) > 0 {
+		tun.Metadata[tunnel.MetadataKeyRelayChain] = slices.Clone(service.RelayChain)
+	}
+	if service.QoSClass != "" {
+		// 策略覆盖的服务等级不在上报中，恢复的隧道使用服务配置的等级
+		tun.Metadata[tunnel.MetadataKeyQoSClass] = service.QoSClass
+	}
+
+	if existing, loaded := m.tunnels.LoadOrStore(tun.ID, tun); loaded {
+		return existing.(*tunnel.Tunnel), nil
+	}
+	m.tunnelVersion.bump()
+	m.logger.Info("Tunnel restored",
+		"tunnel_id", tun.ID,
+		"client_id", tun.ClientID,
+		"service_id", tun.ServiceID,
+		"target", fmt.Sprintf("%s:%d", targetHost, targetPort))
+
+	return tun, nil
+}
+
+// resolveTarget resolves a service target host, preferring IPv4 addresses
+func (m *InMemoryTunnelManager) resolveTarget(ctx context.Context, host string) (net.IP, error) {
+	ips, err := m.lookupIP(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no addresses found")
+	}
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			return ip, nil
+		}
+	}
+	return ips[0], nil
+}
+
 // GetTunnel retrieves a tunnel by ID
 func (m *InMemoryTunnelManager) GetTunnel(ctx context.Context, tunnelID string) (*tunnel.Tunnel, error) {
 	val, ok := m.tunnels.Load(tunnelID)
@@ -76,6 +228,37 @@ func (m *InMemoryTunnelManager) GetTunnel(ctx context.Context, tunnelID string)
 	return val.(*tunnel.Tunnel), nil
 }
 
+// SetAgentE2EKey records the AH public key of an end-to-end encrypted tunnel.
+// Only the first key is accepted so that a second AH cannot take over the tunnel key
+func (m *InMemoryTunnelManager) SetAgentE2EKey(ctx context.Context, tunnelID, publicKey string) (*tunnel.Tunnel, error) {
+	for {
+		val, ok := m.tunnels.Load(tunnelID)
+		if !ok {
+			return nil, fmt.Errorf("tunnel not found: %s", tunnelID)
+		}
+		current := val.(*tunnel.Tunnel)
+		if !current.IsEndToEnd() {
+			return nil, errE2ENotEnabled
+		}
+		if current.E2EAgentPublicKey() != "" {
+			return nil, errE2EKeyExists
+		}
+
+		// 复制后替换，避免与读取 Metadata 的请求并发修改
+		updated := *current
+		updated.Metadata = make(map[string]interface{}, len(current.Metadata)+1)
+		for k, v := range current.Metadata {
+			updated.Metadata[k] = v
+		}
+		updated.Metadata[tunnel.MetadataKeyE2EAgentPublicKey] = publicKey
+		if m.tunnels.CompareAndSwap(tunnelID, current, &updated) {
+			m.tunnelVersion.bump()
+			m.logger.Info("Tunnel e2e key published", "tunnel_id", tunnelID)
+			return &updated, nil
+		}
+	}
+}
+
 // UpdateTunnel updates an existing tunnel
 func (m *InMemoryTunnelManager) UpdateTunnel(ctx context.Context, tun *tunnel.Tunnel) error {
 	_, ok := m.tunnels.Load(tun.ID)
@@ -85,14 +268,95 @@ func (m *InMemoryTunnelManager) UpdateTunnel(ctx context.Context, tun *tunnel.Tu
 
 	tun.LastActive = time.Now()
 	m.tunnels.Store(tun.ID, tun)
+	m.tunnelVersion.bump()
 	m.logger.Info("Tunnel updated", "tunnel_id", tun.ID, "status", tun.Status)
 
 	return nil
 }
 
+// TouchTunnels applies batched last active times without logging or replacing newer values,
+// returning the IDs of tunnels that no longer exist
+func (m *InMemoryTunnelManager) TouchTunnels(seen map[string]time.Time) []string {
+	var missing []string
+	touched := false
+	for tunnelID, at := range seen {
+		for {
+			val, ok := m.tunnels.Load(tunnelID)
+			if !ok {
+				missing = append(missing, tunnelID)
+				break
+			}
+			current := val.(*tunnel.Tunnel)
+			if !at.After(current.LastActive) {
+				break
+			}
+			// 复制后替换，与 SetAgentE2EKey 一致，不修改其他请求持有的对象
+			updated := *current
+			updated.LastActive = at
+			if m.tunnels.CompareAndSwap(tunnelID, current, &updated) {
+				touched = true
+				break
+			}
+		}
+	}
+	if touched {
+		m.tunnelVersion.bump()
+	}
+	return missing
+}
+
+// MarkPaired records the first relay pairing of a tunnel; false if the tunnel does not exist or already failed
+func (m *InMemoryTunnelManager) MarkPaired(tunnelID string, at time.Time) bool {
+	for {
+		val, ok := m.tunnels.Load(tunnelID)
+		if !ok {
+			return false
+		}
+		current := val.(*tunnel.Tunnel)
+		if current.Status == tunnel.TunnelStatusFailed {
+			return false
+		}
+		if !current.PairedAt.IsZero() {
+			return true
+		}
+		updated := *current
+		updated.PairedAt = at
+		if m.tunnels.CompareAndSwap(tunnelID, current, &updated) {
+			m.tunnelVersion.bump()
+			return true
+		}
+	}
+}
+
+// MarkFailed moves a tunnel that has not paired yet to the failed state.
+// Returns the updated tunnel, or nil if the tunnel does not exist, paired meanwhile or already failed
+func (m *InMemoryTunnelManager) MarkFailed(tunnelID, reason string, at time.Time) *tunnel.Tunnel {
+	for {
+		val, ok := m.tunnels.Load(tunnelID)
+		if !ok {
+			return nil
+		}
+		current := val.(*tunnel.Tunnel)
+		if current.Status == tunnel.TunnelStatusFailed || !current.PairedAt.IsZero() {
+			return nil
+		}
+		updated := *current
+		updated.Status = tunnel.TunnelStatusFailed
+		updated.FailureReason = reason
+		updated.LastActive = at
+		if m.tunnels.CompareAndSwap(tunnelID, current, &updated) {
+			m.tunnelVersion.bump()
+			m.logger.Info("Tunnel failed", "tunnel_id", tunnelID, "reason", reason)
+			return &updated
+		}
+	}
+}
+
 // DeleteTunnel removes a tunnel
 func (m *InMemoryTunnelManager) DeleteTunnel(ctx context.Context, tunnelID string) error {
-	m.tunnels.Delete(tunnelID)
+	if _, ok := m.tunnels.LoadAndDelete(tunnelID); ok {
+		m.tunnelVersion.bump()
+	}
 	m.logger.Info("Tunnel deleted", "tunnel_id", tunnelID)
 	return nil
 }
@@ -102,6 +366,10 @@ func (m *InMemoryTunnelManager) ListTunnels(ctx context.Context, filter *tunnel.
 	var tunnels []*tunnel.Tunnel
 	m.tunnels.Range(func(key, value interface{}) bool {
 		tun := value.(*tunnel.Tunnel)
+		// 失败的隧道只在显式请求时返回
+		if tun.Status == tunnel.TunnelStatusFailed && (filter == nil || (!filter.IncludeFailed && filter.Status != tunnel.TunnelStatusFailed)) {
+			return true
+		}
 		// Apply filter if needed
 		if filter != nil {
 			if filter.ClientID != "" && tun.ClientID != filter.ClientID {
@@ -136,6 +404,9 @@ func (m *InMemoryTunnelManager) CreateServiceConfig(ctx context.Context, config
 	if config.ServiceID == "" {
 		return fmt.Errorf("service_id is required")
 	}
+	if err := validateServiceConfig(config); err != nil {
+		return err
+	}
 
 	// Set timestamps
 	config.CreatedAt = time.Now()
@@ -146,6 +417,9 @@ func (m *InMemoryTunnelManager) CreateServiceConfig(ctx context.Context, config
 	}
 
 	m.services.Store(config.ServiceID, config)
+	// 回收站中的同 ID 服务被新配置取代
+	m.deleted.Delete(config.ServiceID)
+	m.serviceVersion.bump()
 	m.logger.Info("Service config created",
 		"service_id", config.ServiceID,
 		"target", fmt.Sprintf("%s:%d", config.TargetHost, config.TargetPort))
@@ -153,6 +427,35 @@ func (m *InMemoryTunnelManager) CreateServiceConfig(ctx context.Context, config
 	return nil
 }
 
+// validateServiceConfig 创建与更新服务配置前的校验（目标模式、PROXY protocol、解析方式、影子流量、上游 TLS、多跳中继、维护计划、服务等级、用量告警）
+func validateServiceConfig(config *tunnel.ServiceConfig) error {
+	if err := config.ValidatePattern(); err != nil {
+		return err
+	}
+	if err := config.ValidateProxyProtocol(); err != nil {
+		return err
+	}
+	if err := config.ValidateResolution(); err != nil {
+		return err
+	}
+	if err := config.ValidateShadow(); err != nil {
+		return err
+	}
+	if err := config.ValidateUpstreamTLS(); err != nil {
+		return err
+	}
+	if err := config.ValidateRelayChain(); err != nil {
+		return err
+	}
+	if err := config.ValidateMaintenance(); err != nil {
+		return err
+	}
+	if err := config.ValidateQoS(); err != nil {
+		return err
+	}
+	return config.ValidateUsageAlert()
+}
+
 // GetServiceConfig 获取单个服务配置（HTTP GET）
 func (m *InMemoryTunnelManager) GetServiceConfig(ctx context.Context, serviceID string) (*tunnel.ServiceConfig, error) {
 	val, ok := m.services.Load(serviceID)
@@ -180,9 +483,13 @@ func (m *InMemoryTunnelManager) UpdateServiceConfig(ctx context.Context, config
 	if !ok {
 		return fmt.Errorf("service not found: %s", config.ServiceID)
 	}
+	if err := validateServiceConfig(config); err != nil {
+		return err
+	}
 
 	config.UpdatedAt = time.Now()
 	m.services.Store(config.ServiceID, config)
+	m.serviceVersion.bump()
 	m.logger.Info("Service config updated",
 		"service_id", config.ServiceID,
 		"target", fmt.Sprintf("%s:%d", config.TargetHost, config.TargetPort))
@@ -191,22 +498,123 @@ func (m *InMemoryTunnelManager) UpdateServiceConfig(ctx context.Context, config
 }
 
 // DeleteServiceConfig 删除服务配置（触发 SSE Push）
+// 软删除：服务移入回收站，不再参与查询与隧道创建，可通过 RestoreServiceConfig 恢复
 func (m *InMemoryTunnelManager) DeleteServiceConfig(ctx context.Context, serviceID string) error {
-	m.services.Delete(serviceID)
+	val, ok := m.services.LoadAndDelete(serviceID)
+	if ok {
+		deleted := *val.(*tunnel.ServiceConfig)
+		now := time.Now()
+		deleted.DeletedAt = &now
+		m.deleted.Store(serviceID, &deleted)
+		m.serviceVersion.bump()
+	}
 	m.logger.Info("Service config deleted", "service_id", serviceID)
 	return nil
 }
 
-// TunnelStoreAdapter adapts tunnel.Manager to transport.TunnelStore interface
+// ListDeletedServiceConfigs 列出回收站中的服务（按删除时间倒序）
+func (m *InMemoryTunnelManager) ListDeletedServiceConfigs(ctx context.Context) []*tunnel.ServiceConfig {
+	var configs []*tunnel.ServiceConfig
+	m.deleted.Range(func(key, value interface{}) bool {
+		configs = append(configs, value.(*tunnel.ServiceConfig))
+		return true
+	})
+	sort.Slice(configs, func(i, j int) bool {
+		return configs[i].DeletedAt.After(*configs[j].DeletedAt)
+	})
+	return configs
+}
+
+// RestoreServiceConfig 从回收站恢复服务配置
+func (m *InMemoryTunnelManager) RestoreServiceConfig(ctx context.Context, serviceID string) (*tunnel.ServiceConfig, error) {
+	val, ok := m.deleted.LoadAndDelete(serviceID)
+	if !ok {
+		return nil, fmt.Errorf("deleted service not found: %s", serviceID)
+	}
+
+	config := *val.(*tunnel.ServiceConfig)
+	config.DeletedAt = nil
+	config.UpdatedAt = time.Now()
+	m.services.Store(serviceID, &config)
+	m.serviceVersion.bump()
+	m.logger.Info("Service config restored", "service_id", serviceID)
+	return &config, nil
+}
+
+// PurgeServiceConfig 永久删除回收站中的服务配置
+func (m *InMemoryTunnelManager) PurgeServiceConfig(ctx context.Context, serviceID string) error {
+	if _, ok := m.deleted.LoadAndDelete(serviceID); !ok {
+		return fmt.Errorf("deleted service not found: %s", serviceID)
+	}
+	m.logger.Info("Service config purged", "service_id", serviceID)
+	return nil
+}
+
+// PurgeDeletedServiceConfigs 永久删除 before 之前移入回收站的服务，返回删除个数
+func (m *InMemoryTunnelManager) PurgeDeletedServiceConfigs(before time.Time) int {
+	purged := 0
+	m.deleted.Range(func(key, value interface{}) bool {
+		if value.(*tunnel.ServiceConfig).DeletedAt.Before(before) {
+			m.deleted.Delete(key)
+			purged++
+		}
+		return true
+	})
+	return purged
+}
+
+// ServicesVersion returns the ETag and last modification time of the service config list
+func (m *InMemoryTunnelManager) ServicesVersion() (string, time.Time) {
+	return m.serviceVersion.etag(m.epoch, "s")
+}
+
+// TunnelsVersion returns the ETag and last modification time of the tunnel list
+func (m *InMemoryTunnelManager) TunnelsVersion() (string, time.Time) {
+	return m.tunnelVersion.etag(m.epoch, "t")
+}
+
+// objectVersion is a change counter of an object collection, used for conditional list requests
+type objectVersion struct {
+	mu       sync.Mutex
+	counter  uint64
+	modified time.Time
+}
+
+// bump records a change; call it after the change is stored so that a version
+// read before listing never describes newer contents than the list
+func (v *objectVersion) bump() {
+	v.mu.Lock()
+	v.counter++
+	v.modified = time.Now()
+	v.mu.Unlock()
+}
+
+// etag returns the strong ETag and last modification time of the current version
+func (v *objectVersion) etag(epoch, kind string) (string, time.Time) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return fmt.Sprintf("\"%s-%s%d\"", epoch, kind, v.counter), v.modified
+}
+
+// tunnelToucher is implemented by managers that can apply batched last active times directly
+type tunnelToucher interface {
+	TouchTunnels(seen map[string]time.Time) []string
+}
+
+// TunnelStoreAdapter adapts tunnel.Manager to transport.TunnelStore interface.
+// Update only records activity in an ActivityTracker; call Close to stop the flush loop
 type TunnelStoreAdapter struct {
-	manager tunnel.Manager
+	manager  tunnel.Manager
+	activity *ActivityTracker
 }
 
-// NewTunnelStoreAdapter creates a new adapter
+// NewTunnelStoreAdapter creates a new adapter whose activity updates are written back every second
 func NewTunnelStoreAdapter(manager tunnel.Manager) transport.TunnelStore {
-	return &TunnelStoreAdapter{
+	a := &TunnelStoreAdapter{
 		manager: manager,
 	}
+	a.activity = NewActivityTracker(defaultActivityFlushInterval, nil, a.flushActivity)
+	return a
 }
 
 // Get retrieves tunnel information for TCP proxy (implements transport.TunnelStore)
@@ -225,23 +633,51 @@ func (a *TunnelStoreAdapter) Get(tunnelID string) (*transport.TunnelInfo, error)
 		return nil, fmt.Errorf("target address not found in tunnel metadata")
 	}
 
+	lastActive := tun.LastActive
+	if at, ok := a.activity.LastActive(tunnelID); ok && at.After(lastActive) {
+		lastActive = at // 尚未写回的活跃时间
+	}
+
 	return &transport.TunnelInfo{
 		TunnelID:   tun.ID,
 		TargetHost: targetHost,
 		TargetPort: targetPort,
 		CreatedAt:  tun.CreatedAt,
-		LastActive: tun.LastActive,
+		LastActive: lastActive,
 	}, nil
 }
 
-// Update updates the last active time for a tunnel (implements transport.TunnelStore)
+// Update records the last active time for a tunnel (implements transport.TunnelStore).
+// The time is written back to the manager asynchronously, so Update never blocks on it
 func (a *TunnelStoreAdapter) Update(tunnelID string, lastActive time.Time) error {
-	ctx := context.Background()
-	tun, err := a.manager.GetTunnel(ctx, tunnelID)
-	if err != nil {
-		return err
+	a.activity.Touch(tunnelID, lastActive)
+	return nil
+}
+
+// Close stops the activity flush loop after writing back pending updates
+func (a *TunnelStoreAdapter) Close() error {
+	a.activity.Close()
+	return nil
+}
+
+// flushActivity writes batched last active times back to the manager
+func (a *TunnelStoreAdapter) flushActivity(seen map[string]time.Time) []string {
+	if toucher, ok := a.manager.(tunnelToucher); ok {
+		return toucher.TouchTunnels(seen)
 	}
 
-	tun.LastActive = lastActive
-	return a.manager.UpdateTunnel(ctx, tun)
+	ctx := context.Background()
+	var missing []string
+	for tunnelID, at := range seen {
+		tun, err := a.manager.GetTunnel(ctx, tunnelID)
+		if err != nil {
+			missing = append(missing, tunnelID)
+			continue
+		}
+		tun.LastActive = at
+		if err := a.manager.UpdateTunnel(ctx, tun); err != nil {
+			missing = append(missing, tunnelID)
+		}
+	}
+	return missing
 }
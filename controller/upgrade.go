@@ -0,0 +1,89 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/houzhh15/sdp-common/transport"
+)
+
+// defaultDrainTimeout 升级时旧进程默认等待隧道结束的时间
+const defaultDrainTimeout = 5 * time.Minute
+
+// relayListenerName 数据平面监听器在 transport.InheritedListenersEnv 中的名称
+const relayListenerName = "relay"
+
+// drainTimeout 返回生效的排空超时
+func (c *Controller) drainTimeout() time.Duration {
+	if c.config.DataPlane != nil && c.config.DataPlane.DrainTimeout > 0 {
+		return c.config.DataPlane.DrainTimeout
+	}
+	return defaultDrainTimeout
+}
+
+// Upgrade performs a zero-downtime binary upgrade: it starts the current executable (already replaced
+// on disk) with the same arguments, hands it the data plane listener, then drains and stops this process.
+// The HTTP and internal listeners are released before the new process starts so it can bind them;
+// control plane clients retry during that window while the data plane port stays open throughout.
+// Relayed tunnels keep flowing in this process until they end or DrainTimeout expires; the new process
+// rebuilds tunnel state through the regular AH reconcile flow.
+func (c *Controller) Upgrade() error {
+	ln := c.relayServer.Listener()
+	if ln == nil {
+		return fmt.Errorf("data plane listener not started")
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to resolve executable: %w", err)
+	}
+
+	c.logger.Info("Starting binary upgrade", "executable", exe)
+	c.stopControlPlane()
+
+	proc, err := transport.StartProcessWithListeners(exe, os.Args[1:], map[string]net.Listener{relayListenerName: ln})
+	if err != nil {
+		// 新进程未启动：恢复控制平面监听，继续由本进程服务
+		go c.startHTTPServer()
+		if c.internal != nil {
+			go c.startInternalServer()
+		}
+		return err
+	}
+	c.logger.Info("New process started, draining data plane", "pid", proc.Pid, "drain_timeout", c.drainTimeout().String())
+	c.recordOpsEvent(OpsUpgrade, "controller", OpsSeverityInfo, "Handing data plane to upgraded process",
+		map[string]interface{}{"pid": proc.Pid, "executable": exe})
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.drainTimeout())
+	defer cancel()
+	c.Drain(ctx)
+
+	return c.Stop()
+}
+
+// Drain stops accepting data plane connections and waits for relayed tunnels to finish until ctx is done,
+// then disconnects the rest. With DataPlane.ReusePort the new process binds the port itself, so an external
+// supervisor can start it and then call Drain (followed by Stop) on the old one.
+func (c *Controller) Drain(ctx context.Context) error {
+	if err := c.relayServer.Drain(ctx); err != nil {
+		c.logger.Warn("Data plane drain deadline reached", "error", err)
+		return err
+	}
+	c.logger.Info("Data plane drained")
+	return nil
+}
+
+// stopControlPlane 关闭 HTTP 与内部 RPC 监听，释放端口供新进程绑定
+func (c *Controller) stopControlPlane() {
+	if err := c.httpServer.Stop(); err != nil {
+		c.logger.Error("Failed to stop HTTP server", "error", err)
+	}
+	if c.internal != nil {
+		if err := c.internal.server.Stop(); err != nil {
+			c.logger.Error("Failed to stop internal RPC server", "error", err)
+		}
+	}
+}
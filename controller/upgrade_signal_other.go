@@ -0,0 +1,12 @@
+//go:build windows
+
+package controller
+
+import "os"
+
+// upgradeSignals Windows 不支持 SIGUSR2，升级需直接调用 Controller.Upgrade
+var upgradeSignals []os.Signal
+
+func isUpgradeSignal(os.Signal) bool {
+	return false
+}
@@ -0,0 +1,15 @@
+//go:build !windows
+
+package controller
+
+import (
+	"os"
+	"syscall"
+)
+
+// upgradeSignals 触发 Controller.Upgrade 的信号
+var upgradeSignals = []os.Signal{syscall.SIGUSR2}
+
+func isUpgradeSignal(sig os.Signal) bool {
+	return sig == syscall.SIGUSR2
+}
@@ -0,0 +1,211 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/houzhh15/sdp-common/clock"
+	"github.com/houzhh15/sdp-common/logging"
+	"github.com/houzhh15/sdp-common/tunnel"
+)
+
+const (
+	// defaultUsageAlertInterval 中继统计默认采样间隔
+	defaultUsageAlertInterval = 10 * time.Second
+	// defaultUsageAlertCooldown 同一隧道同类告警的默认最短间隔
+	defaultUsageAlertCooldown = 15 * time.Minute
+)
+
+// 用量告警类型
+const (
+	usageAlertRate  = "rate"  // 速率超过 max_bytes_per_second
+	usageAlertTotal = "total" // 累计字节超过 max_total_bytes
+)
+
+// usageAlert 用量告警（webhook 请求体）
+type usageAlert struct {
+	Type      string    `json:"type"` // 固定为 tunnel_usage_alert
+	Kind      string    `json:"kind"` // rate 或 total
+	TunnelID  string    `json:"tunnel_id"`
+	ServiceID string    `json:"service_id"`
+	ClientID  string    `json:"client_id"`
+	Value     int64     `json:"value"`     // 字节/秒或累计字节
+	Threshold int64     `json:"threshold"` // 对应阈值
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// tunnelUsage 隧道的用量采样状态
+type tunnelUsage struct {
+	startedAt time.Time            // 当前中继连接的开始时间，变化表示隧道重新建立了中继连接
+	lastBytes uint64               // 当前中继连接最近一次采样的字节数
+	lastAt    time.Time            // 最近一次采样时间
+	previous  uint64               // 已结束的中继连接累计字节
+	alerted   map[string]time.Time // 告警类型 -> 最近告警时间（冷却）
+}
+
+// usageAlerter 按服务 usage_alert 阈值定期评估中继统计，超过时记录安全事件并调用 webhook
+// 同一隧道同类告警在冷却时间内只发送一次
+type usageAlerter struct {
+	c        *Controller
+	clock    clock.Clock
+	interval time.Duration
+	cooldown time.Duration
+	webhooks []string
+	client   *http.Client
+
+	mu      sync.Mutex
+	tunnels map[string]*tunnelUsage // tunnel ID -> 采样状态
+}
+
+// newUsageAlerter 创建用量告警评估器
+func newUsageAlerter(c *Controller) *usageAlerter {
+	interval := c.config.UsageAlertInterval
+	if interval <= 0 {
+		interval = defaultUsageAlertInterval
+	}
+	cooldown := c.config.UsageAlertCooldown
+	if cooldown <= 0 {
+		cooldown = defaultUsageAlertCooldown
+	}
+	return &usageAlerter{
+		c:        c,
+		clock:    clock.Or(c.config.Clock),
+		interval: interval,
+		cooldown: cooldown,
+		webhooks: c.config.UsageAlertWebhooks,
+		client:   &http.Client{Timeout: webhookTimeout},
+		tunnels:  make(map[string]*tunnelUsage),
+	}
+}
+
+// run 周期采样直到 ctx 结束
+func (a *usageAlerter) run(ctx context.Context) {
+	ticker := a.clock.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			a.scan(ctx, a.clock.Now())
+		}
+	}
+}
+
+// scan 执行一次采样：更新各隧道的速率与累计字节并检查阈值
+func (a *usageAlerter) scan(ctx context.Context, now time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	relayed := make(map[string]bool)
+	for _, stats := range a.c.relayServer.GetTunnelStats() {
+		tunnelID := strings.TrimRight(stats.TunnelID, "\x00")
+		relayed[tunnelID] = true
+
+		tun, err := a.c.tunnelManager.GetTunnel(ctx, tunnelID)
+		if err != nil {
+			continue
+		}
+		service, err := a.c.tunnelManager.GetServiceConfig(ctx, tun.ServiceID)
+		if err != nil || service.UsageAlert == nil {
+			continue
+		}
+
+		usage := a.tunnels[tunnelID]
+		if usage == nil {
+			usage = &tunnelUsage{alerted: make(map[string]time.Time)}
+			a.tunnels[tunnelID] = usage
+		}
+		if !usage.startedAt.Equal(stats.StartedAt) {
+			// 新的中继连接：上一连接的字节计入累计，速率从连接开始时计算
+			usage.previous += usage.lastBytes
+			usage.startedAt = stats.StartedAt
+			usage.lastBytes = 0
+			usage.lastAt = stats.StartedAt
+		}
+
+		bytes := stats.BytesIHToAH + stats.BytesAHToIH
+		limits := service.UsageAlert
+		if elapsed := now.Sub(usage.lastAt).Seconds(); limits.MaxBytesPerSecond > 0 && elapsed > 0 && bytes >= usage.lastBytes {
+			rate := int64(float64(bytes-usage.lastBytes) / elapsed)
+			if rate > limits.MaxBytesPerSecond {
+				a.alert(ctx, usage, tun, usageAlertRate, rate, limits.MaxBytesPerSecond, now)
+			}
+		}
+		if total := int64(usage.previous + bytes); limits.MaxTotalBytes > 0 && total > limits.MaxTotalBytes {
+			a.alert(ctx, usage, tun, usageAlertTotal, total, limits.MaxTotalBytes, now)
+		}
+		usage.lastBytes = bytes
+		usage.lastAt = now
+	}
+
+	// 中继连接已结束的隧道保留累计字节，隧道删除后清理
+	for tunnelID, usage := range a.tunnels {
+		if relayed[tunnelID] {
+			continue
+		}
+		if _, err := a.c.tunnelManager.GetTunnel(ctx, tunnelID); err != nil {
+			delete(a.tunnels, tunnelID)
+			continue
+		}
+		usage.previous += usage.lastBytes
+		usage.lastBytes = 0
+		usage.startedAt = time.Time{}
+	}
+}
+
+// alert 发送告警（冷却期内跳过）
+func (a *usageAlerter) alert(ctx context.Context, usage *tunnelUsage, tun *tunnel.Tunnel, kind string, value, threshold int64, now time.Time) {
+	if last, ok := usage.alerted[kind]; ok && now.Sub(last) < a.cooldown {
+		return
+	}
+	usage.alerted[kind] = now
+
+	event := &usageAlert{
+		Type:      "tunnel_usage_alert",
+		Kind:      kind,
+		TunnelID:  tun.ID,
+		ServiceID: tun.ServiceID,
+		ClientID:  tun.ClientID,
+		Value:     value,
+		Threshold: threshold,
+		Timestamp: now,
+	}
+	a.c.logger.Warn("Tunnel usage threshold exceeded",
+		"tunnel_id", tun.ID,
+		"service_id", tun.ServiceID,
+		"client_id", tun.ClientID,
+		"kind", kind,
+		"value", value,
+		"threshold", threshold)
+	a.c.auditSecurity(ctx, &logging.SecurityEvent{
+		Timestamp: now,
+		ClientID:  tun.ClientID,
+		EventType: logging.EventUsageThreshold,
+		Severity:  logging.SeverityMedium,
+		Message:   fmt.Sprintf("Tunnel %s usage exceeded threshold", kind),
+		Details: map[string]interface{}{
+			"tunnel_id":  tun.ID,
+			"service_id": tun.ServiceID,
+			"kind":       kind,
+			"value":      value,
+			"threshold":  threshold,
+		},
+	})
+
+	for _, webhook := range a.webhooks {
+		go a.post(webhook, event)
+	}
+}
+
+// post 调用告警 webhook，失败仅记录日志
+func (a *usageAlerter) post(webhook string, event *usageAlert) {
+	if err := postWebhook(a.client, webhook, event); err != nil {
+		a.c.logger.Warn("Usage alert webhook failed", "webhook", webhook, "error", err)
+	}
+}
@@ -0,0 +1,101 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/houzhh15/sdp-common/transport"
+	"github.com/houzhh15/sdp-common/tunnel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// usageTestRelay 返回固定中继统计的中继服务器
+type usageTestRelay struct {
+	transport.TunnelRelayServer
+	stats []*transport.TunnelRelayStats
+}
+
+func (r *usageTestRelay) GetTunnelStats() []*transport.TunnelRelayStats { return r.stats }
+
+func TestUsageAlerter(t *testing.T) {
+	ctx := context.Background()
+	alerts := make(chan usageAlert, 8)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert usageAlert
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&alert))
+		alerts <- alert
+	}))
+	defer webhook.Close()
+
+	c := newAdminTestController(t, &Config{UsageAlertWebhooks: []string{webhook.URL}, UsageAlertCooldown: time.Minute})
+	relay := &usageTestRelay{TunnelRelayServer: c.relayServer}
+	c.relayServer = relay
+	alerter := newUsageAlerter(c)
+
+	require.NoError(t, c.tunnelManager.CreateServiceConfig(ctx, &tunnel.ServiceConfig{
+		ServiceID:  "svc-1",
+		TargetHost: "127.0.0.1",
+		TargetPort: 8080,
+		UsageAlert: &tunnel.UsageAlertConfig{MaxBytesPerSecond: 1000, MaxTotalBytes: 50000},
+	}))
+	tun, err := c.tunnelManager.CreateTunnel(ctx, &tunnel.CreateTunnelRequest{ClientID: "alice", ServiceID: "svc-1", Protocol: "tcp"})
+	require.NoError(t, err)
+
+	start := time.Now()
+	sample := func(startedAt time.Time, bytes uint64, at time.Duration) {
+		relay.stats = []*transport.TunnelRelayStats{{TunnelID: tun.ID, StartedAt: startedAt, BytesIHToAH: bytes / 2, BytesAHToIH: bytes - bytes/2}}
+		alerter.scan(ctx, start.Add(at))
+	}
+	expect := func(kind string, value int64) {
+		t.Helper()
+		select {
+		case alert := <-alerts:
+			assert.Equal(t, kind, alert.Kind)
+			assert.Equal(t, value, alert.Value)
+			assert.Equal(t, tun.ID, alert.TunnelID)
+			assert.Equal(t, "alice", alert.ClientID)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("no %s alert", kind)
+		}
+	}
+
+	sample(start, 5000, 10*time.Second) // 500 B/s
+	sample(start, 25000, 20*time.Second)
+	expect(usageAlertRate, 2000)
+	sample(start, 26000, 30*time.Second)
+
+	// 新的中继连接：累计字节包含上一连接；速率告警仍在冷却期内
+	second := start.Add(35 * time.Second)
+	sample(second, 30000, 40*time.Second)
+	expect(usageAlertTotal, 56000)
+
+	sample(second, 130000, 90*time.Second)
+	expect(usageAlertRate, 2000)
+	select {
+	case alert := <-alerts:
+		t.Fatalf("unexpected alert during cooldown: %+v", alert)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// 隧道删除后清理采样状态
+	require.NoError(t, c.tunnelManager.DeleteTunnel(ctx, tun.ID))
+	relay.stats = nil
+	alerter.scan(ctx, start.Add(100*time.Second))
+	assert.Empty(t, alerter.tunnels)
+}
+
+func TestServiceConfig_ValidateUsageAlert(t *testing.T) {
+	valid := &tunnel.ServiceConfig{ServiceID: "svc", UsageAlert: &tunnel.UsageAlertConfig{MaxTotalBytes: 1}}
+	assert.NoError(t, valid.ValidateUsageAlert())
+	empty := &tunnel.ServiceConfig{ServiceID: "svc", UsageAlert: &tunnel.UsageAlertConfig{}}
+	assert.Error(t, empty.ValidateUsageAlert())
+	negative := &tunnel.ServiceConfig{ServiceID: "svc", UsageAlert: &tunnel.UsageAlertConfig{MaxBytesPerSecond: -1}}
+	assert.Error(t, negative.ValidateUsageAlert())
+
+	assert.ErrorContains(t, (&Config{CertFile: "c", KeyFile: "k", CAFile: "ca", HTTPAddr: ":1", TCPProxyAddr: ":2", UsageAlertWebhooks: []string{"ftp://x"}}).Validate(), "usage alert webhook")
+}
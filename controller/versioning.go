@@ -0,0 +1,205 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// API 版本
+const (
+	APIVersionV1 = "v1"
+	APIVersionV2 = "v2"
+
+	// versionPlaceholder 路由模式中的版本占位符，如 "/api/{version}/tunnels"
+	versionPlaceholder = "{version}"
+
+	headerAcceptVersion = "Accept-Version"
+	headerAPIVersion    = "API-Version"
+)
+
+// supportedAPIVersions 已实现的 API 版本（按从旧到新排序）
+var supportedAPIVersions = []string{APIVersionV1, APIVersionV2}
+
+// APIVersionPolicy API 版本生命周期配置
+type APIVersionPolicy struct {
+	// Deprecated 标记为弃用，响应附带 Deprecation 头
+	Deprecated bool `yaml:"deprecated"`
+
+	// Sunset 下线时间，响应附带 Sunset 头；到期后该版本返回 410 Gone
+	Sunset time.Time `yaml:"sunset"`
+
+	// Link 迁移说明链接，响应附带 Link: <...>; rel="deprecation"
+	Link string `yaml:"link"`
+}
+
+// VersionShim 版本兼容层
+// 在共享的业务 handler 外包装版本特定的请求/响应适配，使各版本复用同一套业务逻辑
+type VersionShim func(next http.HandlerFunc) http.HandlerFunc
+
+type apiVersionKey struct{}
+
+// APIVersionFromContext 返回请求协商得到的 API 版本
+func APIVersionFromContext(ctx context.Context) string {
+	v, _ := ctx.Value(apiVersionKey{}).(string)
+	return v
+}
+
+// versionRegistry API 版本注册表
+type versionRegistry struct {
+	mu             sync.RWMutex
+	policies       map[string]*APIVersionPolicy
+	shims          map[string]VersionShim
+	defaultVersion string
+}
+
+// newVersionRegistry 创建版本注册表
+func newVersionRegistry(policies map[string]*APIVersionPolicy, defaultVersion string) *versionRegistry {
+	if defaultVersion == "" {
+		defaultVersion = APIVersionV1
+	}
+
+	vr := &versionRegistry{
+		policies:       make(map[string]*APIVersionPolicy),
+		shims:          make(map[string]VersionShim),
+		defaultVersion: defaultVersion,
+	}
+	for version, p := range policies {
+		vr.policies[version] = p
+	}
+	return vr
+}
+
+// registerShim 为指定版本注册兼容层（可在启动后调用）
+func (vr *versionRegistry) registerShim(version string, shim VersionShim) error {
+	if !isSupportedAPIVersion(version) {
+		return fmt.Errorf("unsupported API version: %s", version)
+	}
+
+	vr.mu.Lock()
+	defer vr.mu.Unlock()
+	vr.shims[version] = shim
+	return nil
+}
+
+// versionedPaths 展开路由模式，返回 版本 -> 路径 以及不带版本的协商路径
+func versionedPaths(pattern string) (map[string]string, string) {
+	paths := make(map[string]string, len(supportedAPIVersions))
+	for _, version := range supportedAPIVersions {
+		paths[version] = strings.Replace(pattern, versionPlaceholder, version, 1)
+	}
+	negotiated := strings.Replace(pattern, "/"+versionPlaceholder, "", 1)
+	return paths, negotiated
+}
+
+// wrap 包装指定版本的 handler：写入版本/弃用响应头、应用兼容层，
+// 并将请求路径改写为规范（v1）路径，使 handler 内部的路径解析保持不变
+func (vr *versionRegistry) wrap(version, pattern string, handler http.HandlerFunc) http.HandlerFunc {
+	paths, negotiated := versionedPaths(pattern)
+	canonical := paths[APIVersionV1]
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		vr.mu.RLock()
+		policy := vr.policies[version]
+		shim := vr.shims[version]
+		vr.mu.RUnlock()
+
+		w.Header().Set(headerAPIVersion, version)
+		if policy != nil {
+			if policy.Deprecated {
+				w.Header().Set("Deprecation", "true")
+			}
+			if !policy.Sunset.IsZero() {
+				w.Header().Set("Sunset", policy.Sunset.UTC().Format(http.TimeFormat))
+				if time.Now().After(policy.Sunset) {
+					respondErrorWithStatus(w, "API_VERSION_SUNSET",
+						fmt.Sprintf("API version %s is no longer available", version), nil, http.StatusGone)
+					return
+				}
+			}
+			if policy.Link != "" {
+				w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"deprecation\"", policy.Link))
+			}
+		}
+
+		// 改写为规范路径（/api/v2/tunnels/x 与 /api/tunnels/x 均映射为 /api/v1/tunnels/x）
+		for _, prefix := range []string{paths[version], negotiated} {
+			if rest, ok := cutPathPrefix(r.URL.Path, prefix); ok {
+				r.URL.Path = canonical + rest
+				break
+			}
+		}
+
+		r = r.WithContext(context.WithValue(r.Context(), apiVersionKey{}, version))
+
+		next := handler
+		if shim != nil {
+			next = shim(handler)
+		}
+		next(w, r)
+	}
+}
+
+// negotiate 返回不带版本的路由 handler，按 Accept-Version 头选择版本（缺省为默认版本）
+func (vr *versionRegistry) negotiate(handlers map[string]http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		version := r.Header.Get(headerAcceptVersion)
+		if version == "" {
+			version = vr.defaultVersion
+		}
+
+		handler, ok := handlers[version]
+		if !ok {
+			respondErrorWithStatus(w, "UNSUPPORTED_API_VERSION",
+				fmt.Sprintf("Unsupported API version: %s", version),
+				map[string]interface{}{"supported_versions": supportedAPIVersions}, http.StatusNotAcceptable)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// handleVersioned 按版本注册路由
+// pattern 使用 {version} 占位符，例如 "/api/{version}/tunnels"，将注册：
+// /api/v1/tunnels、/api/v2/tunnels，以及按 Accept-Version 协商的 /api/tunnels
+func (c *Controller) handleVersioned(pattern string, handler http.HandlerFunc) {
+	paths, negotiated := versionedPaths(pattern)
+	handler = c.traceRequest(c.requestAudit(pattern, c.maintenanceGate(pattern, c.postureGate(pattern, handler))))
+	roles := routeRoles(pattern)
+
+	handlers := make(map[string]http.HandlerFunc, len(paths))
+	for version, path := range paths {
+		h := c.versions.wrap(version, pattern, handler)
+		handlers[version] = h
+		c.handle(roles, path, h)
+	}
+	c.handle(roles, negotiated, c.versions.negotiate(handlers))
+}
+
+// RegisterVersionShim 为指定 API 版本注册兼容层
+// 当某版本的请求/响应格式与共享业务逻辑不同时，通过 shim 进行转换
+func (c *Controller) RegisterVersionShim(version string, shim VersionShim) error {
+	return c.versions.registerShim(version, shim)
+}
+
+// cutPathPrefix 按路径段匹配前缀（"/api/v1/tunnels" 匹配 "/api/v1/tunnels/x"，不匹配 "/api/v1/tunnelsx"）
+func cutPathPrefix(path, prefix string) (string, bool) {
+	if !strings.HasPrefix(path, prefix) {
+		return "", false
+	}
+	rest := path[len(prefix):]
+	if rest != "" && !strings.HasSuffix(prefix, "/") && rest[0] != '/' {
+		return "", false
+	}
+	return rest, true
+}
+
+// isSupportedAPIVersion 检查版本是否已实现
+func isSupportedAPIVersion(version string) bool {
+	i := sort.SearchStrings(supportedAPIVersions, version)
+	return i < len(supportedAPIVersions) && supportedAPIVersions[i] == version
+}
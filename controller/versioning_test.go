@@ -0,0 +1,114 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newVersionedTestController(policies map[string]*APIVersionPolicy) (*Controller, *[]string) {
+	c := &Controller{
+		mux:      http.NewServeMux(),
+		versions: newVersionRegistry(policies, ""),
+	}
+
+	var seen []string
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		seen = append(seen, APIVersionFromContext(r.Context())+" "+r.URL.Path)
+		w.WriteHeader(http.StatusOK)
+	}
+	c.handleVersioned("/api/{version}/tunnels/", handler)
+	return c, &seen
+}
+
+func TestHandleVersioned_Routes(t *testing.T) {
+	c, seen := newVersionedTestController(nil)
+
+	tests := []struct {
+		name          string
+		path          string
+		acceptVersion string
+		wantStatus    int
+		wantVersion   string
+		wantSeen      string
+	}{
+		{"v1 path", "/api/v1/tunnels/t1", "", http.StatusOK, "v1", "v1 /api/v1/tunnels/t1"},
+		{"v2 path shares handler", "/api/v2/tunnels/t1", "", http.StatusOK, "v2", "v2 /api/v1/tunnels/t1"},
+		{"negotiated default", "/api/tunnels/t1", "", http.StatusOK, "v1", "v1 /api/v1/tunnels/t1"},
+		{"negotiated v2", "/api/tunnels/t1", "v2", http.StatusOK, "v2", "v2 /api/v1/tunnels/t1"},
+		{"unsupported version", "/api/tunnels/t1", "v9", http.StatusNotAcceptable, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			*seen = nil
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.acceptVersion != "" {
+				req.Header.Set(headerAcceptVersion, tt.acceptVersion)
+			}
+			w := httptest.NewRecorder()
+			c.mux.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Equal(t, tt.wantVersion, w.Header().Get(headerAPIVersion))
+			if tt.wantSeen != "" {
+				require.Len(t, *seen, 1)
+				assert.Equal(t, tt.wantSeen, (*seen)[0])
+			}
+		})
+	}
+}
+
+func TestHandleVersioned_Deprecation(t *testing.T) {
+	sunset := time.Now().Add(24 * time.Hour)
+	c, _ := newVersionedTestController(map[string]*APIVersionPolicy{
+		APIVersionV1: {Deprecated: true, Sunset: sunset, Link: "https://example.com/migrate-v2"},
+	})
+
+	w := httptest.NewRecorder()
+	c.mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/tunnels/t1", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "true", w.Header().Get("Deprecation"))
+	assert.Equal(t, sunset.UTC().Format(http.TimeFormat), w.Header().Get("Sunset"))
+	assert.Equal(t, `<https://example.com/migrate-v2>; rel="deprecation"`, w.Header().Get("Link"))
+
+	// v2 不受影响
+	w = httptest.NewRecorder()
+	c.mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v2/tunnels/t1", nil))
+	assert.Empty(t, w.Header().Get("Deprecation"))
+}
+
+func TestHandleVersioned_SunsetPassed(t *testing.T) {
+	c, seen := newVersionedTestController(map[string]*APIVersionPolicy{
+		APIVersionV1: {Deprecated: true, Sunset: time.Now().Add(-time.Hour)},
+	})
+
+	w := httptest.NewRecorder()
+	c.mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/tunnels/t1", nil))
+	assert.Equal(t, http.StatusGone, w.Code)
+	assert.Empty(t, *seen)
+}
+
+func TestRegisterVersionShim(t *testing.T) {
+	c, _ := newVersionedTestController(nil)
+
+	require.NoError(t, c.RegisterVersionShim(APIVersionV2, func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Shim", "v2")
+			next(w, r)
+		}
+	}))
+	assert.Error(t, c.RegisterVersionShim("v9", nil))
+
+	w := httptest.NewRecorder()
+	c.mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v2/tunnels/t1", nil))
+	assert.Equal(t, "v2", w.Header().Get("X-Shim"))
+
+	w = httptest.NewRecorder()
+	c.mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/tunnels/t1", nil))
+	assert.Empty(t, w.Header().Get("X-Shim"))
+}
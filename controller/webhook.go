@@ -0,0 +1,45 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// webhookTimeout 单次 webhook 调用超时
+const webhookTimeout = 5 * time.Second
+
+// postWebhook 以 POST JSON 调用 webhook，非 2xx 响应视为失败
+func postWebhook(client *http.Client, webhook string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, webhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook rejected with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// validateWebhooks 校验 webhook 地址（http / https 绝对地址）
+func validateWebhooks(kind string, webhooks []string) error {
+	for _, webhook := range webhooks {
+		if u, err := url.Parse(webhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid %s webhook: %q", kind, webhook)
+		}
+	}
+	return nil
+}
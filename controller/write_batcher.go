@@ -0,0 +1,99 @@
+package controller
+
+import (
+	"sync"
+	"time"
+
+	"github.com/houzhh15/sdp-common/clock"
+	"github.com/houzhh15/sdp-common/logging"
+)
+
+// writeBatcher 合并高频的按键更新（同一键仅保留最新值），按固定间隔在一个事务中写入，
+// 降低并发握手时 SQLite 写锁竞争
+type writeBatcher[K comparable, V any] struct {
+	name     string
+	flushFn  func(batch map[K]V) error
+	interval time.Duration
+	clock    clock.Clock
+	logger   logging.Logger
+
+	mu      sync.Mutex
+	pending map[K]V
+
+	stopChan  chan struct{}
+	doneChan  chan struct{}
+	closeOnce sync.Once
+}
+
+// newWriteBatcher 创建并启动批量写入器，Close 时写入剩余数据
+func newWriteBatcher[K comparable, V any](name string, interval time.Duration, clk clock.Clock, logger logging.Logger, flush func(map[K]V) error) *writeBatcher[K, V] {
+	b := &writeBatcher[K, V]{
+		name:     name,
+		flushFn:  flush,
+		interval: interval,
+		clock:    clock.Or(clk),
+		logger:   logger,
+		pending:  make(map[K]V),
+		stopChan: make(chan struct{}),
+		doneChan: make(chan struct{}),
+	}
+	go b.loop()
+	return b
+}
+
+// Add 记录一次更新，覆盖同一键尚未写入的值
+func (b *writeBatcher[K, V]) Add(key K, value V) {
+	b.mu.Lock()
+	b.pending[key] = value
+	b.mu.Unlock()
+}
+
+// Flush 立即写入当前累积的更新
+func (b *writeBatcher[K, V]) Flush() error {
+	b.mu.Lock()
+	batch := b.pending
+	if len(batch) == 0 {
+		b.mu.Unlock()
+		return nil
+	}
+	b.pending = make(map[K]V)
+	b.mu.Unlock()
+
+	if err := b.flushFn(batch); err != nil {
+		// 写入失败时放回，不覆盖期间产生的更新值
+		b.mu.Lock()
+		for k, v := range batch {
+			if _, ok := b.pending[k]; !ok {
+				b.pending[k] = v
+			}
+		}
+		b.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Close 停止定时写入并写入剩余数据，可重复调用
+func (b *writeBatcher[K, V]) Close() error {
+	b.closeOnce.Do(func() { close(b.stopChan) })
+	<-b.doneChan
+	return b.Flush()
+}
+
+func (b *writeBatcher[K, V]) loop() {
+	defer close(b.doneChan)
+
+	ticker := b.clock.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.stopChan:
+			return
+		case <-ticker.C():
+			if err := b.Flush(); err != nil {
+				b.logger.Warn("Batched write failed, will retry", "batch", b.name, "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,97 @@
+// Package device 定义 IH 上报的设备信息，握手（auth）、会话（session）与策略评估（policy）共用同一结构，
+// Controller 将握手请求中的设备信息原样保存到会话并用于策略评估，无需逐字段转换
+package device
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// 设备信息字段上限（Validate 校验）
+const (
+	MaxFieldLength = 256
+	MaxAttributes  = 32
+)
+
+// Info 设备信息
+type Info struct {
+	DeviceID   string            `json:"device_id"`
+	OS         string            `json:"os"`
+	OSVersion  string            `json:"os_version"`
+	Hostname   string            `json:"hostname,omitempty"`
+	Compliance bool              `json:"compliance"`
+	Attributes map[string]string `json:"attributes,omitempty"` // 自定义属性（如 disk_encrypted）
+}
+
+// IsZero 是否未提供任何设备信息
+func (d *Info) IsZero() bool {
+	return d.DeviceID == "" && d.OS == "" && d.OSVersion == "" && d.Hostname == "" && !d.Compliance && len(d.Attributes) == 0
+}
+
+// Validate 校验必填字段（DeviceID、OS）与长度上限
+func (d *Info) Validate() error {
+	if d.DeviceID == "" {
+		return errors.New("device_info.device_id is required")
+	}
+	if d.OS == "" {
+		return errors.New("device_info.os is required")
+	}
+	for name, value := range map[string]string{
+		"device_id":  d.DeviceID,
+		"os":         d.OS,
+		"os_version": d.OSVersion,
+		"hostname":   d.Hostname,
+	} {
+		if len(value) > MaxFieldLength {
+			return fmt.Errorf("device_info.%s exceeds %d bytes", name, MaxFieldLength)
+		}
+	}
+	if len(d.Attributes) > MaxAttributes {
+		return fmt.Errorf("device_info.attributes exceeds %d entries", MaxAttributes)
+	}
+	for k, v := range d.Attributes {
+		if k == "" || len(k) > MaxFieldLength || len(v) > MaxFieldLength {
+			return fmt.Errorf("invalid device_info attribute %q", k)
+		}
+	}
+	return nil
+}
+
+// Clone 深拷贝（Attributes 不与原对象共享），nil 返回 nil
+func (d *Info) Clone() *Info {
+	if d == nil {
+		return nil
+	}
+	c := *d
+	c.Attributes = maps.Clone(d.Attributes)
+	return &c
+}
+
+// PostureHash 设备指纹摘要（"sha256:" + 十六进制），覆盖全部字段，Attributes 按键排序后参与计算
+// 会话记录握手时的摘要，后续请求携带的摘要与之不同即视为设备漂移；nil 返回空字符串
+func (d *Info) PostureHash() string {
+	if d == nil {
+		return ""
+	}
+
+	var b strings.Builder
+	for _, field := range []string{d.DeviceID, d.OS, d.OSVersion, d.Hostname, strconv.FormatBool(d.Compliance)} {
+		// 长度前缀避免字段拼接产生歧义
+		b.WriteString(strconv.Itoa(len(field)))
+		b.WriteByte(':')
+		b.WriteString(field)
+	}
+	for _, key := range slices.Sorted(maps.Keys(d.Attributes)) {
+		value := d.Attributes[key]
+		fmt.Fprintf(&b, "%d:%s%d:%s", len(key), key, len(value), value)
+	}
+
+	sum := sha256.Sum256([]byte(b.String()))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
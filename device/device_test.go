@@ -0,0 +1,67 @@
+package device
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInfo_Validate(t *testing.T) {
+	valid := Info{DeviceID: "laptop-1", OS: "linux", Hostname: "alice-laptop", Attributes: map[string]string{"disk_encrypted": "true"}}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("valid device info: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		info Info
+	}{
+		{"missing device id", Info{OS: "linux"}},
+		{"missing os", Info{DeviceID: "laptop-1"}},
+		{"hostname too long", Info{DeviceID: "laptop-1", OS: "linux", Hostname: strings.Repeat("h", MaxFieldLength+1)}},
+		{"empty attribute key", Info{DeviceID: "laptop-1", OS: "linux", Attributes: map[string]string{"": "x"}}},
+	}
+	for _, tt := range tests {
+		if err := tt.info.Validate(); err == nil {
+			t.Errorf("%s: expected error", tt.name)
+		}
+	}
+}
+
+func TestInfo_Clone(t *testing.T) {
+	orig := &Info{DeviceID: "laptop-1", OS: "linux", Attributes: map[string]string{"team": "infra"}}
+	clone := orig.Clone()
+	clone.Attributes["team"] = "sales"
+	if orig.Attributes["team"] != "infra" {
+		t.Error("clone shares attributes with the original")
+	}
+	if (*Info)(nil).Clone() != nil {
+		t.Error("nil clone should be nil")
+	}
+	if !(&Info{}).IsZero() || orig.IsZero() {
+		t.Error("IsZero mismatch")
+	}
+}
+
+func TestInfo_PostureHash(t *testing.T) {
+	info := &Info{DeviceID: "laptop-1", OS: "linux", OSVersion: "6.1", Attributes: map[string]string{"a": "1", "b": "2"}}
+	hash := info.PostureHash()
+	if !strings.HasPrefix(hash, "sha256:") {
+		t.Fatalf("unexpected hash format %q", hash)
+	}
+	if info.Clone().PostureHash() != hash {
+		t.Error("hash of an identical device differs")
+	}
+
+	changed := info.Clone()
+	changed.OS = "windows"
+	if changed.PostureHash() == hash {
+		t.Error("OS change not reflected in hash")
+	}
+	// 字段边界变化不应产生相同摘要
+	if (&Info{DeviceID: "ab", OS: "c"}).PostureHash() == (&Info{DeviceID: "a", OS: "bc"}).PostureHash() {
+		t.Error("field boundaries are ambiguous")
+	}
+	if (*Info)(nil).PostureHash() != "" {
+		t.Error("nil device should have an empty hash")
+	}
+}
@@ -0,0 +1,213 @@
+// Package egress 提供出站代理支持（HTTP CONNECT / SOCKS5），用于出口流量强制经代理的
+// 数据中心内 AH/IH 访问 Controller：控制平面 HTTP 客户端使用 ProxyFunc，
+// 数据平面 mTLS 连接通过 Dialer 建立经代理的 TCP 隧道后再握手。
+//
+// 未显式配置代理时遵循环境变量 HTTPS_PROXY / HTTP_PROXY / NO_PROXY（localhost 与回环地址始终直连）。
+package egress
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+	"golang.org/x/net/proxy"
+)
+
+// Config 出站代理配置，nil 等价于零值（使用环境变量）
+type Config struct {
+	// URL 显式代理地址，设置后所有连接均经此代理（忽略环境变量）：
+	//   http://[user:pass@]host:port    HTTP CONNECT
+	//   https://[user:pass@]host:port   到代理的连接使用 TLS，再 CONNECT
+	//   socks5://[user:pass@]host:port  SOCKS5（socks5h 同义，均由代理解析目标域名）
+	URL string
+	// DisableEnvironment 未设置 URL 时不读取环境变量，始终直连
+	DisableEnvironment bool
+}
+
+// Validate 检查代理地址
+func (c *Config) Validate() error {
+	_, err := c.explicitURL()
+	return err
+}
+
+// explicitURL 解析显式代理地址，未设置时返回 nil
+func (c *Config) explicitURL() (*url.URL, error) {
+	if c == nil || c.URL == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy url: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q (http, https, socks5)", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy url %q: missing host", c.URL)
+	}
+	return u, nil
+}
+
+// ProxyFor 返回访问 target 应使用的代理，nil 表示直连
+func (c *Config) ProxyFor(target *url.URL) (*url.URL, error) {
+	u, err := c.explicitURL()
+	if err != nil || u != nil {
+		return u, err
+	}
+	if c != nil && c.DisableEnvironment {
+		return nil, nil
+	}
+	return httpproxy.FromEnvironment().ProxyFunc()(target)
+}
+
+// ProxyFunc 返回用于 http.Transport.Proxy 的代理选择函数
+// （net/http 原生支持 http、https、socks5 代理及 HTTPS 目标的 CONNECT 隧道）
+func (c *Config) ProxyFunc() func(*http.Request) (*url.URL, error) {
+	return func(req *http.Request) (*url.URL, error) {
+		return c.ProxyFor(req.URL)
+	}
+}
+
+// Dialer 建立经出站代理的 TCP 连接（用于数据平面等非 HTTP 连接）
+type Dialer struct {
+	Config  *Config
+	Timeout time.Duration // 连接超时（含代理握手），0 表示不限
+}
+
+// DialContext 连接 addr（host:port），需要时经代理建立隧道
+func (d *Dialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if d.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.Timeout)
+		defer cancel()
+	}
+
+	// 数据平面目标按 https 方案匹配 HTTPS_PROXY / NO_PROXY
+	proxyURL, err := d.Config.ProxyFor(&url.URL{Scheme: "https", Host: addr})
+	if err != nil {
+		return nil, err
+	}
+
+	direct := &net.Dialer{}
+	if proxyURL == nil {
+		return direct.DialContext(ctx, network, addr)
+	}
+
+	switch proxyURL.Scheme {
+	case "socks5", "socks5h":
+		return dialSOCKS5(ctx, direct, proxyURL, network, addr)
+	case "http", "https":
+		return dialConnect(ctx, direct, proxyURL, addr)
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", proxyURL.Scheme)
+	}
+}
+
+// dialSOCKS5 经 SOCKS5 代理连接 addr
+func dialSOCKS5(ctx context.Context, direct *net.Dialer, proxyURL *url.URL, network, addr string) (net.Conn, error) {
+	var auth *proxy.Auth
+	if proxyURL.User != nil {
+		password, _ := proxyURL.User.Password()
+		auth = &proxy.Auth{User: proxyURL.User.Username(), Password: password}
+	}
+	dialer, err := proxy.SOCKS5("tcp", proxyHostPort(proxyURL), auth, direct)
+	if err != nil {
+		return nil, fmt.Errorf("socks5 proxy: %w", err)
+	}
+	conn, err := dialer.(proxy.ContextDialer).DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, fmt.Errorf("socks5 proxy %s: %w", proxyURL.Host, err)
+	}
+	return conn, nil
+}
+
+// dialConnect 经 HTTP(S) 代理使用 CONNECT 建立到 addr 的隧道
+func dialConnect(ctx context.Context, direct *net.Dialer, proxyURL *url.URL, addr string) (net.Conn, error) {
+	conn, err := direct.DialContext(ctx, "tcp", proxyHostPort(proxyURL))
+	if err != nil {
+		return nil, fmt.Errorf("connect to proxy %s: %w", proxyURL.Host, err)
+	}
+
+	if proxyURL.Scheme == "https" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: proxyURL.Hostname()})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("tls handshake with proxy %s: %w", proxyURL.Host, err)
+		}
+		conn = tlsConn
+	}
+
+	// 代理握手期间遵循 ctx 的截止时间
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if proxyURL.User != nil {
+		password, _ := proxyURL.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(proxyURL.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("write CONNECT to proxy %s: %w", proxyURL.Host, err)
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("read CONNECT response from proxy %s: %w", proxyURL.Host, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %s refused CONNECT %s: %s", proxyURL.Host, addr, resp.Status)
+	}
+
+	// 代理可能在响应后紧接着转发了目标数据，读取时先消费缓冲
+	if br.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// proxyHostPort 返回代理地址，缺省端口按方案补全
+func proxyHostPort(u *url.URL) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	port := "80"
+	switch u.Scheme {
+	case "https":
+		port = "443"
+	case "socks5", "socks5h":
+		port = "1080"
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// bufferedConn 优先读取 CONNECT 响应后已缓冲的数据
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
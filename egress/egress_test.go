@@ -0,0 +1,253 @@
+package egress
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// startEchoServer 启动回显服务，返回地址
+func startEchoServer(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// startConnectProxy 启动 HTTP CONNECT 代理，记录请求次数与认证头
+func startConnectProxy(t *testing.T, requests *int32, auth *atomic.Value) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				req, err := http.ReadRequest(bufio.NewReader(conn))
+				if err != nil || req.Method != http.MethodConnect {
+					return
+				}
+				atomic.AddInt32(requests, 1)
+				auth.Store(req.Header.Get("Proxy-Authorization"))
+
+				target, err := net.Dial("tcp", req.Host)
+				if err != nil {
+					conn.Write([]byte("HTTP/1.1 502 Bad Gateway\r\n\r\n"))
+					return
+				}
+				defer target.Close()
+				conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+				go io.Copy(target, conn)
+				io.Copy(conn, target)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// startSOCKS5Proxy 启动无认证 SOCKS5 代理（仅支持 CONNECT + IPv4/域名）
+func startSOCKS5Proxy(t *testing.T, requests *int32) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				buf := make([]byte, 262)
+				// 方法协商
+				if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+					return
+				}
+				if _, err := io.ReadFull(conn, buf[:buf[1]]); err != nil {
+					return
+				}
+				conn.Write([]byte{0x05, 0x00})
+
+				// 请求：VER CMD RSV ATYP
+				if _, err := io.ReadFull(conn, buf[:4]); err != nil {
+					return
+				}
+				var host string
+				switch buf[3] {
+				case 0x01:
+					io.ReadFull(conn, buf[:4])
+					host = net.IP(buf[:4]).String()
+				case 0x03:
+					io.ReadFull(conn, buf[:1])
+					n := int(buf[0])
+					io.ReadFull(conn, buf[:n])
+					host = string(buf[:n])
+				default:
+					return
+				}
+				io.ReadFull(conn, buf[:2])
+				port := binary.BigEndian.Uint16(buf[:2])
+				atomic.AddInt32(requests, 1)
+
+				target, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(port))))
+				if err != nil {
+					conn.Write([]byte{0x05, 0x05, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+					return
+				}
+				defer target.Close()
+				conn.Write([]byte{0x05, 0x00, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+				go io.Copy(target, conn)
+				io.Copy(conn, target)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func assertEcho(t *testing.T, conn net.Conn) {
+	t.Helper()
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if string(buf) != "ping" {
+		t.Fatalf("echo = %q, want ping", buf)
+	}
+}
+
+func TestDialer_HTTPConnect(t *testing.T) {
+	target := startEchoServer(t)
+	var requests int32
+	var auth atomic.Value
+	proxyAddr := startConnectProxy(t, &requests, &auth)
+
+	d := &Dialer{Config: &Config{URL: "http://user:secret@" + proxyAddr}, Timeout: 2 * time.Second}
+	conn, err := d.DialContext(context.Background(), "tcp", target)
+	if err != nil {
+		t.Fatalf("DialContext: %v", err)
+	}
+	assertEcho(t, conn)
+
+	if atomic.LoadInt32(&requests) != 1 {
+		t.Errorf("proxy CONNECT requests = %d, want 1", requests)
+	}
+	if got := auth.Load(); got != "Basic dXNlcjpzZWNyZXQ=" {
+		t.Errorf("Proxy-Authorization = %v", got)
+	}
+}
+
+func TestDialer_ConnectRefused(t *testing.T) {
+	var requests int32
+	var auth atomic.Value
+	proxyAddr := startConnectProxy(t, &requests, &auth)
+
+	// 目标不可达，代理返回 502
+	d := &Dialer{Config: &Config{URL: "http://" + proxyAddr}, Timeout: 2 * time.Second}
+	if _, err := d.DialContext(context.Background(), "tcp", "127.0.0.1:1"); err == nil {
+		t.Fatal("expected error when proxy refuses CONNECT")
+	}
+}
+
+func TestDialer_SOCKS5(t *testing.T) {
+	target := startEchoServer(t)
+	var requests int32
+	proxyAddr := startSOCKS5Proxy(t, &requests)
+
+	d := &Dialer{Config: &Config{URL: "socks5://" + proxyAddr}, Timeout: 2 * time.Second}
+	conn, err := d.DialContext(context.Background(), "tcp", target)
+	if err != nil {
+		t.Fatalf("DialContext: %v", err)
+	}
+	assertEcho(t, conn)
+
+	if atomic.LoadInt32(&requests) != 1 {
+		t.Errorf("socks5 requests = %d, want 1", requests)
+	}
+}
+
+func TestConfig_Environment(t *testing.T) {
+	t.Setenv("HTTPS_PROXY", "http://proxy.corp:3128")
+	t.Setenv("NO_PROXY", "internal.corp")
+
+	target := &url.URL{Scheme: "https", Host: "controller.example.com:9443"}
+
+	var nilConfig *Config
+	proxyURL, err := nilConfig.ProxyFor(target)
+	if err != nil || proxyURL == nil || proxyURL.Host != "proxy.corp:3128" {
+		t.Fatalf("nil config should use HTTPS_PROXY, got %v (%v)", proxyURL, err)
+	}
+
+	proxyURL, _ = nilConfig.ProxyFor(&url.URL{Scheme: "https", Host: "ctl.internal.corp:9443"})
+	if proxyURL != nil {
+		t.Errorf("NO_PROXY host should be direct, got %v", proxyURL)
+	}
+
+	proxyURL, _ = (&Config{DisableEnvironment: true}).ProxyFor(target)
+	if proxyURL != nil {
+		t.Errorf("DisableEnvironment should be direct, got %v", proxyURL)
+	}
+
+	// 显式配置优先于环境变量
+	proxyURL, _ = (&Config{URL: "socks5://10.0.0.1:1080"}).ProxyFor(target)
+	if proxyURL == nil || proxyURL.Scheme != "socks5" {
+		t.Errorf("explicit URL should win, got %v", proxyURL)
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		url     string
+		wantErr bool
+	}{
+		{"", false},
+		{"http://proxy:3128", false},
+		{"https://proxy", false},
+		{"socks5://user:pw@proxy:1080", false},
+		{"ftp://proxy", true},
+		{"http://", true},
+	}
+	for _, tt := range tests {
+		err := (&Config{URL: tt.url}).Validate()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Validate(%q) error = %v, wantErr %v", tt.url, err, tt.wantErr)
+		}
+	}
+}
@@ -6,17 +6,24 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
-	"io"
 	"log"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/houzhh15/sdp-common/cert"
+	"github.com/houzhh15/sdp-common/egress"
+	"github.com/houzhh15/sdp-common/k8s"
 	"github.com/houzhh15/sdp-common/logging"
+	"github.com/houzhh15/sdp-common/qos"
+	"github.com/houzhh15/sdp-common/service"
+	"github.com/houzhh15/sdp-common/transport"
 	"github.com/houzhh15/sdp-common/tunnel"
 )
 
@@ -27,15 +34,30 @@ import (
 // 3. 订阅 Controller 的隧道事件（SSE created/deleted）
 // 4. 根据 ServiceID 路由到不同的目标服务
 // 5. 通过 TCP Proxy 透明转发数据
+// 6. SSE 重连后上报活跃隧道，Controller 重启后据此恢复隧道状态
 
 func main() {
 	// 解析命令行参数
 	certFile := flag.String("cert", "../../certs/ah-agent-cert.pem", "Certificate file path")
 	keyFile := flag.String("key", "../../certs/ah-agent-key.pem", "Private key file path")
 	caFile := flag.String("ca", "../../certs/ca-cert.pem", "CA certificate file path")
-	controller := flag.String("controller", "https://localhost:8443", "Controller URL")
+	controller := flag.String("controller", "https://localhost:8443", "Controller URL; comma-separated for failover, the first is the primary")
+	failoverAfter := flag.Duration("failover-after", tunnel.DefaultFailoverAfter, "How long the attached Controller may stay unreachable before switching to the next one")
 	agentID := flag.String("agent-id", "ah-agent-001", "Agent ID")
 	logLevel := flag.String("log-level", "info", "Log level (debug, info, warn, error)")
+	hotServices := flag.String("hot-services", "", "Comma-separated service IDs to keep pre-warmed target connections for")
+	prewarmConns := flag.Int("prewarm-conns", 2, "Idle target connections kept per hot service")
+	proxyURL := flag.String("proxy", "", "Outbound proxy for reaching the Controller (http://, https://, socks5://); empty uses HTTPS_PROXY/NO_PROXY")
+	accessLogPath := flag.String("access-log", "", "File for per-connection access events (tunnel, service, target, bytes, close reason); empty logs to stdout only")
+	blockHTTPMethods := flag.String("block-http-methods", "", "Comma-separated HTTP methods to reject on the data path (e.g. DELETE,TRACE)")
+	sniAllow := flag.String("sni-allow", "", "Comma-separated TLS server names allowed on the data path (\"*.example.com\" wildcards); non-TLS connections are rejected")
+	inspectServices := flag.String("inspect-services", "", "Comma-separated service IDs the L7 inspectors apply to; empty applies to all services")
+	echoServices := flag.String("echo-services", "", "Comma-separated service IDs answered by the built-in echo service instead of their target (for ih-client -diagnose)")
+	k8sEnabled := flag.Bool("k8s", false, "Discover Kubernetes Services/Endpoints and register them with the Controller")
+	k8sNamespace := flag.String("k8s-namespace", "", "Namespace to watch (default: the pod's namespace)")
+	k8sSelector := flag.String("k8s-selector", "", "Label selector for Services to expose (e.g. sdp.io/expose=true)")
+	k8sSidecar := flag.Bool("k8s-sidecar", false, "Sidecar mode: expose only Services backed by this pod (POD_IP), targeting 127.0.0.1")
+	reverseGatewayPorts := flag.Bool("reverse-gateway-ports", false, "Allow reverse forwards (ih-client -R) to listen on non-loopback addresses, like sshd GatewayPorts")
 	flag.Parse()
 
 	logger, err := logging.NewLogger(&logging.Config{
@@ -49,6 +71,12 @@ func main() {
 
 	logger.Info("AH Agent 启动 (SDP 2.0 规范 0x04 混合方案)", "version", "1.0.0-example", "agent_id", *agentID)
 
+	controllers := splitList(*controller)
+	if len(controllers) == 0 {
+		logger.Error("未配置 Controller 地址")
+		os.Exit(1)
+	}
+
 	// 使用sdp-common的cert包加载证书
 	certManager, err := cert.NewManager(&cert.Config{
 		CertFile: *certFile,
@@ -75,32 +103,105 @@ func main() {
 	// 获取TLS配置
 	tlsConfig := certManager.GetTLSConfig()
 
+	// 出站代理：控制平面 HTTP/SSE 与数据平面 mTLS 连接均经此代理（CONNECT / SOCKS5）
+	egressProxy := &egress.Config{URL: *proxyURL}
+	if err := egressProxy.Validate(); err != nil {
+		logger.Error("出站代理配置无效", "error", err)
+		os.Exit(1)
+	}
+
+	// 连接访问日志：每条转发连接写入 open/close ConnectionEvent
+	var accessAudit logging.AuditLogger
+	if *accessLogPath != "" {
+		fileAudit, err := logging.NewFileAuditLogger(*accessLogPath, logger)
+		if err != nil {
+			logger.Error("打开访问日志失败", "error", err, "path", *accessLogPath)
+			os.Exit(1)
+		}
+		defer fileAudit.Close()
+		accessAudit = fileAudit
+	}
+
+	// L7 检查插件：在数据写入目标服务前检查 IH→目标的数据流，拒绝时关闭连接并记入访问日志
+	var inspectors []tunnel.Inspector
+	if methods := splitList(*blockHTTPMethods); len(methods) > 0 {
+		inspectors = append(inspectors, &tunnel.HTTPMethodInspector{BlockedMethods: methods, Services: splitList(*inspectServices)})
+	}
+	if names := splitList(*sniAllow); len(names) > 0 {
+		inspectors = append(inspectors, &tunnel.SNIInspector{AllowedServerNames: names, Services: splitList(*inspectServices)})
+	}
+
 	agent := &AHAgent{
 		agentID:       *agentID,
-		controllerURL: *controller,
+		controllers:   controllers,
 		services:      make(map[string]*tunnel.ServiceConfig),
 		logger:        logger,
 		tlsConfig:     tlsConfig,
+		egressProxy:   egressProxy,
 		activeTunnels: make(map[string]*activeTunnel),
+		targetPool:    tunnel.NewTargetPool(&tunnel.TargetPoolConfig{IdleConns: *prewarmConns, Logger: logger}),
+		hotServices:   make(map[string]bool),
+		echoServices:  make(map[string]bool),
+		accessLog:     tunnel.NewAccessLogger(&tunnel.AccessLogConfig{Audit: accessAudit, Logger: logger, Inspectors: inspectors}),
+		upstreamTLS: tunnel.NewUpstreamTLSDialer(&tunnel.UpstreamTLSDialerConfig{
+			AgentCertificate: certManager.GetCertificate,
+			Logger:           logger,
+		}),
+	}
+	for _, id := range strings.Split(*hotServices, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			agent.hotServices[id] = true
+		}
 	}
 
+	for _, id := range splitList(*echoServices) {
+		agent.echoServices[id] = true
+	}
+	agent.reverseGatewayPorts = *reverseGatewayPorts
+
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// 混合方案步骤 1: HTTP GET 获取初始服务配置（0x04 消息）
-	if err := agent.fetchServiceConfigs(ctx); err != nil {
+	// 长期运行时定期检查本地证书，进入 30 天告警期或过期时提醒续期
+	go cert.NewExpiryMonitor(certManager, &cert.ExpiryMonitorConfig{
+		OnExpiring: func(n *cert.ExpiryNotice) {
+			logger.Warn("证书需要续期",
+				"state", n.State,
+				"not_after", n.NotAfter,
+				"days_remaining", n.DaysRemaining())
+		},
+	}).Run(ctx)
+
+	// 混合方案步骤 1: HTTP GET 获取初始服务配置（0x04 消息），主 Controller 不可用时依次尝试备用 Controller
+	if err := agent.loadServiceConfigs(ctx); err != nil {
 		logger.Error("获取服务配置失败", "error", err)
 		os.Exit(1)
 	}
 
 	// 启动订阅器（SSE 实时更新）
-	subscriber := tunnel.NewSubscriber(&tunnel.SubscriberConfig{
-		ControllerURL: *controller,
+	var subscriber *tunnel.Subscriber
+	subscriber = tunnel.NewSubscriber(&tunnel.SubscriberConfig{
+		ControllerURL: controllers[0],
+		FailoverURLs:  controllers[1:],
+		FailoverAfter: *failoverAfter,
 		AgentID:       *agentID,
 		TLSConfig:     tlsConfig,
 		Callback:      agent.handleEvent,
 		Logger:        logger,
+		Proxy:         egressProxy,
+		// 服务配置变更（批量导入时为合并后的一批）
+		ServiceEventCallback: agent.handleServiceEvents,
+		// 每次（重）连接后上报活跃隧道，终止 Controller 不再认可的隧道；
+		// 连接到与服务配置来源不同的 Controller（故障切换）时先重新同步服务配置
+		ConnectedCallback: func(ctx context.Context) {
+			agent.attachController(ctx, subscriber.ControllerURL())
+			go agent.reconcileTunnels(ctx, subscriber)
+		},
+		FailoverCallback: func(from, to string) {
+			logger.Warn("Controller 持续不可达，切换到备用 Controller", "from", from, "to", to)
+		},
 	})
+	agent.subscriber = subscriber
 
 	if err := subscriber.Start(ctx); err != nil {
 		logger.Error("启动订阅器失败", "error", err)
@@ -108,71 +209,214 @@ func main() {
 	}
 	defer subscriber.Stop()
 
+	// Kubernetes 服务发现：将匹配选择器的 Service 注册到 Controller，随后经 SSE service_created 事件下发到本 agent
+	var k8sDone chan struct{}
+	if *k8sEnabled {
+		provider, err := k8s.NewProvider(&k8s.Config{
+			Namespace:     *k8sNamespace,
+			LabelSelector: *k8sSelector,
+			Sidecar:       *k8sSidecar,
+			// 服务注册写入主 Controller（各 Controller 共享服务配置存储）
+			Registrar: service.NewClient(&service.Config{
+				ControllerURL: controllers[0],
+				TLSConfig:     tlsConfig,
+				AgentID:       *agentID,
+				Proxy:         egressProxy,
+			}),
+			// Sidecar 随 Pod 终止，注销本 Pod 的服务
+			UnregisterOnStop: *k8sSidecar,
+			Logger:           logger,
+		})
+		if err != nil {
+			logger.Error("初始化 Kubernetes 服务发现失败", "error", err)
+			os.Exit(1)
+		}
+		k8sDone = make(chan struct{})
+		go func() {
+			defer close(k8sDone)
+			provider.Run(ctx)
+		}()
+	}
+
 	fmt.Printf("\n✅ AH Agent started successfully!\n")
-	fmt.Printf("   Controller: %s\n", *controller)
+	fmt.Printf("   Controller: %s\n", controllers[0])
+	if len(controllers) > 1 {
+		fmt.Printf("   Failover:   %s\n", strings.Join(controllers[1:], ", "))
+	}
 	fmt.Printf("   Agent ID: %s\n", *agentID)
 	fmt.Printf("   Registered Services: %d\n", len(agent.services))
 	for serviceID, svc := range agent.services {
+		if agent.echoServices[serviceID] {
+			fmt.Printf("     - %s → echo\n", serviceID)
+			continue
+		}
 		fmt.Printf("     - %s → %s:%d\n", serviceID, svc.TargetHost, svc.TargetPort)
 	}
 	fmt.Printf("   Press Ctrl+C to stop\n\n")
 
-	logger.Info("已连接到Controller", "url", *controller)
-
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 	<-sigChan
 
 	logger.Info("收到退出信号，正在清理...")
 	cancel()
+	if k8sDone != nil {
+		<-k8sDone
+	}
 	agent.cleanup()
 	logger.Info("AH Agent 已停止")
 }
 
 type AHAgent struct {
 	agentID       string
-	controllerURL string
+	controllers   []string                         // Controller 地址，第一个为主 Controller
+	syncedFrom    string                           // 当前服务配置来自的 Controller
 	services      map[string]*tunnel.ServiceConfig // serviceID -> 服务配置
 	logger        logging.Logger
 	tlsConfig     *tls.Config
+	egressProxy   *egress.Config // 出站代理（nil 或空 URL 时遵循环境变量）
 	activeTunnels map[string]*activeTunnel
+	tunnelsMu     sync.Mutex                // 保护 activeTunnels（转发 goroutine 与对账并发访问）
+	targetPool    *tunnel.TargetPool        // 目标连接预热池（仅热点服务保持空闲连接）
+	hotServices   map[string]bool           // 需要预热的服务 ID
+	echoServices  map[string]bool           // 由内置回显服务应答的服务 ID（连通性诊断），不拨号目标
+	accessLog     *tunnel.AccessLogger      // 按连接记录访问日志
+	upstreamTLS   *tunnel.UpstreamTLSDialer // 服务配置 upstream_tls 时与目标的 TLS 握手
+	subscriber    *tunnel.Subscriber        // 上报端到端加密公钥
+
+	// reverseGatewayPorts 允许反向转发监听非回环地址（同 sshd GatewayPorts），默认只监听回环地址
+	reverseGatewayPorts bool
 }
 
 type activeTunnel struct {
 	tunnelID   string
+	clientID   string
 	serviceID  string // 用于标识服务
+	ihEndpoint string
 	targetHost string
 	targetPort int
 	proxyConn  net.Conn
 	targetConn net.Conn
+	mux        *tunnel.MuxSession // 多路复用模式下的会话（此时 proxyConn/targetConn 为空）
 	cancel     context.CancelFunc
+	createdAt  time.Time
+	expiresAt  time.Time
+
+	// 服务启用 PROXY protocol 时，每个目标连接开头写入 IH 原始源地址
+	proxyProtocol bool
+	clientAddr    *net.TCPAddr
+
+	// 建立隧道时的服务配置（影子流量按目标连接生效）
+	service *tunnel.ServiceConfig
+
+	// 隧道启用流量混淆时发送方向的开销统计，未启用时为 nil
+	obfuscation *tunnel.ObfuscationStats
+}
+
+// writeProxyHeader 服务启用 PROXY protocol 时向目标连接写入 v2 头
+// Controller 未记录 IH 源地址时写入 LOCAL 命令，目标服务使用连接自身地址
+func (t *activeTunnel) writeProxyHeader(targetConn net.Conn) error {
+	if !t.proxyProtocol {
+		return nil
+	}
+	return transport.WriteProxyHeaderV2(targetConn, t.clientAddr, targetConn.RemoteAddr())
+}
+
+// mirrorTarget 按服务影子配置包装目标连接，影子目标不可用时仅记录日志，隧道照常转发
+func (a *AHAgent) mirrorTarget(ctx context.Context, t *activeTunnel, targetConn net.Conn) net.Conn {
+	if t.service == nil || t.service.Shadow == nil {
+		return targetConn
+	}
+	conn, err := t.service.MirrorTarget(targetConn, func(addr string) (net.Conn, error) {
+		return a.targetPool.Get(ctx, addr)
+	})
+	if err != nil {
+		a.logger.Warn("连接影子目标失败", "error", err, "tunnel_id", t.tunnelID)
+	}
+	return conn
 }
 
-// fetchServiceConfigs HTTP GET 获取初始服务配置（混合方案步骤 1）
-func (a *AHAgent) fetchServiceConfigs(ctx context.Context) error {
+// dialTarget 连接目标服务，回显服务返回内置回显连接
+func (a *AHAgent) dialTarget(ctx context.Context, serviceID, targetAddr string) (net.Conn, error) {
+	if a.echoServices[serviceID] {
+		return tunnel.NewEchoConn(), nil
+	}
+	return a.targetPool.Get(ctx, targetAddr)
+}
+
+// prepareTarget 目标连接建立后依次包装影子镜像、写入 PROXY protocol 头，服务配置 upstream_tls 时再与目标完成 TLS 握手
+// 失败时关闭 targetConn；回显服务须原样返回 IH 数据，不做任何包装
+func (a *AHAgent) prepareTarget(ctx context.Context, t *activeTunnel, targetConn net.Conn) (net.Conn, error) {
+	if a.echoServices[t.serviceID] {
+		return targetConn, nil
+	}
+	targetConn = a.mirrorTarget(ctx, t, targetConn)
+	if err := t.writeProxyHeader(targetConn); err != nil {
+		targetConn.Close()
+		return nil, fmt.Errorf("写入 PROXY protocol 头失败: %w", err)
+	}
+	return a.upstreamTLS.Client(ctx, t.service, targetConn, t.targetHost)
+}
+
+// e2eSession 隧道启用端到端加密时生成本端密钥并上报 Controller，返回用于包装数据平面连接的会话
+// 未启用时返回 nil；公钥已被其他连接上报（重复的隧道事件）时返回错误，不建立隧道
+func (a *AHAgent) e2eSession(tun *tunnel.Tunnel) (*tunnel.E2ESession, error) {
+	if !tun.IsEndToEnd() {
+		return nil, nil
+	}
+	key, err := tunnel.GenerateE2EKey()
+	if err != nil {
+		return nil, err
+	}
+	session, err := key.Session(tun.ID, tun.E2EPublicKey(), tunnel.E2ESideAH)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := a.subscriber.PublishE2EKey(ctx, tun.ID, key.PublicKey()); err != nil {
+		return nil, fmt.Errorf("publish e2e key: %w", err)
+	}
+	return session, nil
+}
+
+// newDataPlaneClient 创建经出站代理连接 Controller 数据平面的客户端
+// 请求关闭通知：中继断开隧道时访问日志记录 close_reason=relay_closed 及中继给出的原因
+func (a *AHAgent) newDataPlaneClient(addr string) *tunnel.DataPlaneClient {
+	return tunnel.NewDataPlaneClientWithConfig(&tunnel.DataPlaneClientConfig{
+		ServerAddr:  addr,
+		TLSConfig:   a.tlsConfig,
+		Proxy:       a.egressProxy,
+		CloseNotice: true,
+	})
+}
+
+// fetchServiceConfigs HTTP GET 从指定 Controller 获取服务配置（混合方案步骤 1）
+func (a *AHAgent) fetchServiceConfigs(ctx context.Context, controllerURL string) ([]*tunnel.ServiceConfig, error) {
 	client := &http.Client{
 		Transport: &http.Transport{
 			TLSClientConfig: a.tlsConfig,
+			Proxy:           a.egressProxy.ProxyFunc(),
 		},
 		Timeout: 10 * time.Second,
 	}
 
-	url := fmt.Sprintf("%s/api/v1/services", a.controllerURL)
+	url := fmt.Sprintf("%s/api/v1/services", strings.TrimSuffix(controllerURL, "/"))
 	a.logger.Info("正在获取服务配置", "url", url)
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		return fmt.Errorf("创建请求失败: %w", err)
+		return nil, fmt.Errorf("创建请求失败: %w", err)
 	}
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return fmt.Errorf("HTTP请求失败: %w", err)
+		return nil, fmt.Errorf("HTTP请求失败: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("HTTP状态码异常: %d", resp.StatusCode)
+		return nil, fmt.Errorf("HTTP状态码异常: %d", resp.StatusCode)
 	}
 
 	var result struct {
@@ -182,19 +426,66 @@ func (a *AHAgent) fetchServiceConfigs(ctx context.Context) error {
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return fmt.Errorf("解析响应失败: %w", err)
+		return nil, fmt.Errorf("解析响应失败: %w", err)
 	}
+	return result.Services, nil
+}
 
-	// 保存服务配置
-	for _, svc := range result.Services {
-		a.services[svc.ServiceID] = svc
-		a.logger.Info("加载服务配置",
-			"service_id", svc.ServiceID,
-			"target", fmt.Sprintf("%s:%d", svc.TargetHost, svc.TargetPort))
+// loadServiceConfigs 启动时按顺序从各 Controller 获取初始服务配置，使用第一个成功的结果
+func (a *AHAgent) loadServiceConfigs(ctx context.Context) error {
+	var lastErr error
+	for _, controllerURL := range a.controllers {
+		services, err := a.fetchServiceConfigs(ctx, controllerURL)
+		if err != nil {
+			a.logger.Warn("从 Controller 获取服务配置失败", "controller", controllerURL, "error", err)
+			lastErr = err
+			continue
+		}
+
+		for _, svc := range services {
+			a.services[svc.ServiceID] = svc
+			a.warmService(svc)
+			a.logger.Info("加载服务配置",
+				"service_id", svc.ServiceID,
+				"target", fmt.Sprintf("%s:%d", svc.TargetHost, svc.TargetPort))
+		}
+		a.syncedFrom = controllerURL
+		a.logger.Info("服务配置加载完成", "count", len(a.services), "controller", controllerURL)
+		return nil
 	}
+	return lastErr
+}
 
-	a.logger.Info("服务配置加载完成", "count", len(a.services))
-	return nil
+// attachController 记录当前连接的 Controller；与服务配置来源不同时（故障切换后）重新获取服务配置，
+// 按更新 / 删除事件应用到本地服务表，补齐断线期间错过的服务配置变更
+// 在订阅循环中同步执行：服务表只由订阅回调访问，同步完成前不读取新事件
+func (a *AHAgent) attachController(ctx context.Context, controllerURL string) {
+	a.logger.Info("已连接到 Controller", "url", controllerURL)
+	if controllerURL == a.syncedFrom {
+		return
+	}
+
+	services, err := a.fetchServiceConfigs(ctx, controllerURL)
+	if err != nil {
+		// 保留现有服务表，之后的服务配置事件照常应用
+		a.logger.Error("故障切换后同步服务配置失败", "controller", controllerURL, "error", err)
+		return
+	}
+
+	var events []*tunnel.ServiceEvent
+	current := make(map[string]bool, len(services))
+	for _, svc := range services {
+		current[svc.ServiceID] = true
+		events = append(events, &tunnel.ServiceEvent{Type: tunnel.ServiceEventUpdated, Service: svc})
+	}
+	for serviceID, svc := range a.services {
+		if !current[serviceID] {
+			events = append(events, &tunnel.ServiceEvent{Type: tunnel.ServiceEventDeleted, Service: svc})
+		}
+	}
+	a.handleServiceEvents(events)
+	a.logger.Info("故障切换后服务配置已同步", "from", a.syncedFrom, "controller", controllerURL, "services", len(a.services))
+	a.syncedFrom = controllerURL
 }
 
 // handleEvent 处理所有事件（隧道事件和服务配置事件）
@@ -205,48 +496,44 @@ func (a *AHAgent) handleEvent(event *tunnel.TunnelEvent) error {
 		a.handleTunnelCreated(event)
 	case tunnel.EventTypeDeleted:
 		a.handleTunnelDeleted(event)
-	// 服务配置事件处理（通过 Metadata 区分）
-	case "service_created", "service_updated":
-		a.handleServiceEvent(event)
 	default:
 		a.logger.Warn("Unknown event type", "type", event.Type)
 	}
 	return nil
 }
 
-// handleServiceEvent 处理服务配置变更事件（混合方案步骤 2：SSE Push）
-func (a *AHAgent) handleServiceEvent(event *tunnel.TunnelEvent) {
-	// 从 event.Details 中获取服务配置
-	if event.Details == nil {
-		a.logger.Error("服务配置事件数据为空")
-		return
-	}
+// handleServiceEvents 处理服务配置变更事件（混合方案步骤 2：SSE Push）
+// 合并推送的一批事件逐条应用到本地服务表，最后汇总记录一次
+func (a *AHAgent) handleServiceEvents(events []*tunnel.ServiceEvent) error {
+	for _, event := range events {
+		svc := event.Service
+		if svc == nil {
+			a.logger.Error("服务配置事件数据为空", "event_type", event.Type)
+			continue
+		}
 
-	serviceData, ok := event.Details["service"]
-	if !ok {
-		a.logger.Error("服务配置数据缺失")
-		return
-	}
+		// 目标变化或服务删除时释放旧地址的预热连接
+		if old, ok := a.services[svc.ServiceID]; ok && !old.IsPattern() {
+			a.targetPool.Unwarm(net.JoinHostPort(old.TargetHost, strconv.Itoa(old.TargetPort)))
+		}
 
-	// 将 map 转换为 ServiceConfig
-	serviceJSON, err := json.Marshal(serviceData)
-	if err != nil {
-		a.logger.Error("序列化服务配置失败", "error", err)
-		return
-	}
+		if event.Type == tunnel.ServiceEventDeleted {
+			delete(a.services, svc.ServiceID)
+			a.upstreamTLS.Forget(svc.ServiceID)
+			a.logger.Info("服务配置已删除", "service_id", svc.ServiceID)
+			continue
+		}
 
-	var svc tunnel.ServiceConfig
-	if err := json.Unmarshal(serviceJSON, &svc); err != nil {
-		a.logger.Error("反序列化服务配置失败", "error", err)
-		return
+		a.services[svc.ServiceID] = svc
+		a.warmService(svc)
+		a.logger.Debug("服务配置已更新",
+			"service_id", svc.ServiceID,
+			"target", fmt.Sprintf("%s:%d", svc.TargetHost, svc.TargetPort),
+			"event_type", event.Type)
 	}
 
-	// 更新本地服务配置
-	a.services[svc.ServiceID] = &svc
-	a.logger.Info("服务配置已更新",
-		"service_id", svc.ServiceID,
-		"target", fmt.Sprintf("%s:%d", svc.TargetHost, svc.TargetPort),
-		"event_type", event.Type)
+	a.logger.Info("服务配置变更已应用", "events", len(events), "services", len(a.services))
+	return nil
 }
 
 func (a *AHAgent) handleTunnelCreated(event *tunnel.TunnelEvent) {
@@ -258,8 +545,19 @@ func (a *AHAgent) handleTunnelCreated(event *tunnel.TunnelEvent) {
 	tun := event.Tunnel
 
 	// Per SDP 2.0: 根据 ServiceID 查找对应的目标服务
+	// Controller 内嵌了服务配置快照时优先使用快照（服务配置事件可能晚于隧道事件到达）
 	serviceID := tun.ServiceID
 	service, ok := a.services[serviceID]
+	if snap := event.Service; snap != nil && snap.ServiceID == serviceID {
+		if !ok || snap.UpdatedAt.After(service.UpdatedAt) {
+			if ok && !service.IsPattern() {
+				a.targetPool.Unwarm(net.JoinHostPort(service.TargetHost, strconv.Itoa(service.TargetPort)))
+			}
+			a.services[serviceID] = snap
+			a.warmService(snap)
+		}
+		service, ok = snap, true
+	}
 	if !ok {
 		a.logger.Error("未注册的服务",
 			"service_id", serviceID,
@@ -293,41 +591,130 @@ func (a *AHAgent) handleTunnelCreated(event *tunnel.TunnelEvent) {
 		return
 	}
 
+	// 反向转发（ssh -R）：AH 监听，连接经多路复用隧道转回 IH，目标由 IH 拨号
+	if tun.IsReverseForward() {
+		a.handleReverseForward(tun, proxyAddr)
+		return
+	}
+
+	// 解析具体目标：固定服务使用配置地址，模式化（CIDR）服务使用隧道携带的目标并在本地复核
+	targetHost, targetPort, err := service.ResolveTunnelTarget(tun)
+	if err != nil {
+		a.logger.Error("隧道目标无效", "tunnel_id", tun.ID, "service_id", serviceID, "error", err)
+		return
+	}
+
 	a.logger.Info("收到隧道创建通知",
 		"tunnel_id", tun.ID,
 		"service_id", serviceID,
 		"tcp_proxy", proxyAddr,
-		"target", fmt.Sprintf("%s:%d", service.TargetHost, service.TargetPort))
+		"target", net.JoinHostPort(targetHost, strconv.Itoa(targetPort)))
 
-	// Per SDP 2.0 Architecture: AH connects to target service (step 1)
-	targetAddr := fmt.Sprintf("%s:%d", service.TargetHost, service.TargetPort)
-	targetConn, err := net.Dial("tcp", targetAddr)
+	targetAddr := net.JoinHostPort(targetHost, strconv.Itoa(targetPort))
+
+	// 端到端加密：中继只转发密文，IH 与 AH 之间的数据平面连接由隧道密钥加密
+	e2e, err := a.e2eSession(tun)
 	if err != nil {
-		a.logger.Error("连接目标服务失败", "error", err, "target", targetAddr)
+		a.logger.Error("端到端加密协商失败", "error", err, "tunnel_id", tun.ID)
+		return
+	}
+
+	// 多路复用模式：保持一条数据平面连接，IH 每个本地连接对应一个流，按流拨号目标服务
+	if tun.IsMultiplexed() {
+		dataPlaneClient := a.newDataPlaneClient(proxyAddr)
+		var muxSession *tunnel.MuxSession
+		obfuscation := obfuscationStats(tun)
+		conn, err := dataPlaneClient.Connect(tun.ID)
+		if err == nil {
+			a.markQoS(tun, conn)
+			if e2e != nil {
+				// 先加密底层连接，流复用帧同样不暴露给中继
+				conn = e2e.Wrap(conn)
+			}
+			conn = obfuscate(conn, obfuscation)
+			muxSession = tunnel.NewMuxSession(conn, false)
+		}
+		if err != nil {
+			a.logger.Error("连接TCP Proxy失败", "error", err, "addr", proxyAddr)
+			return
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		activeTun := &activeTunnel{
+			tunnelID:   tun.ID,
+			clientID:   tun.ClientID,
+			serviceID:  serviceID,
+			ihEndpoint: tun.IHEndpoint,
+			targetHost: targetHost,
+			targetPort: targetPort,
+			mux:        muxSession,
+			cancel:     cancel,
+			createdAt:  tun.CreatedAt,
+			expiresAt:  tun.ExpiresAt,
+
+			proxyProtocol: service.ProxyProtocol == tunnel.ProxyProtocolV2,
+			clientAddr:    tun.ClientAddr(),
+			service:       service,
+			obfuscation:   obfuscation,
+		}
+		a.storeTunnel(activeTun)
+
+		go a.serveMux(ctx, activeTun)
+
+		a.logger.Info("多路复用隧道已建立", "tunnel_id", tun.ID, "service_id", serviceID, "target", targetAddr, "proxy", proxyAddr)
 		return
 	}
 
-	// Per SDP 2.0 Architecture: AH connects to Controller TCP Proxy with mTLS (step 2)
+	// Per SDP 2.0 Architecture: AH connects to target service and Controller TCP Proxy with mTLS
+	// 两者并行拨号，热点服务直接复用预热连接，缩短首字节延迟
 	// Use DataPlaneClient SDK to establish connection (encapsulates protocol details)
-	dataPlaneClient := tunnel.NewDataPlaneClient(proxyAddr, a.tlsConfig)
-	proxyConn, err := dataPlaneClient.Connect(tun.ID)
+	dataPlaneClient := a.newDataPlaneClient(proxyAddr)
+	receivedAt := time.Now()
+	targetConn, proxyConn, err := tunnel.DialParallel(
+		func() (net.Conn, error) { return a.dialTarget(context.Background(), serviceID, targetAddr) },
+		func() (net.Conn, error) { return dataPlaneClient.Connect(tun.ID) },
+	)
 	if err != nil {
-		a.logger.Error("连接TCP Proxy失败", "error", err, "addr", proxyAddr)
-		targetConn.Close()
+		a.logger.Error("建立隧道连接失败", "error", err, "target", targetAddr, "addr", proxyAddr)
 		return
 	}
+	a.markQoS(tun, proxyConn)
+	if e2e != nil {
+		proxyConn = e2e.Wrap(proxyConn)
+	}
+	obfuscation := obfuscationStats(tun)
+	proxyConn = obfuscate(proxyConn, obfuscation)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	activeTun := &activeTunnel{
 		tunnelID:   tun.ID,
+		clientID:   tun.ClientID,
 		serviceID:  serviceID,
-		targetHost: service.TargetHost,
-		targetPort: service.TargetPort,
+		ihEndpoint: tun.IHEndpoint,
+		targetHost: targetHost,
+		targetPort: targetPort,
 		proxyConn:  proxyConn,
 		targetConn: targetConn,
 		cancel:     cancel,
+		createdAt:  tun.CreatedAt,
+		expiresAt:  tun.ExpiresAt,
+
+		proxyProtocol: service.ProxyProtocol == tunnel.ProxyProtocolV2,
+		clientAddr:    tun.ClientAddr(),
+		service:       service,
+		obfuscation:   obfuscation,
 	}
-	a.activeTunnels[tun.ID] = activeTun
+	targetConn, err = a.prepareTarget(ctx, activeTun, targetConn)
+	if err != nil {
+		a.logger.Error("准备目标连接失败", "error", err, "target", targetAddr)
+		cancel()
+		proxyConn.Close()
+		return
+	}
+	// 记录从收到隧道事件到目标返回首字节的耗时（tunnel_ttfb_seconds{side="ah"}），启用 upstream TLS 时以握手后的首个应用数据为准
+	targetConn = tunnel.NewTTFBConn(targetConn, serviceID, tunnel.TTFBSideAH, receivedAt)
+	activeTun.targetConn = targetConn
+	a.storeTunnel(activeTun)
 
 	// Per SDP 2.0 Architecture: Start bidirectional forwarding (step 3)
 	go a.forwardData(ctx, activeTun)
@@ -335,34 +722,213 @@ func (a *AHAgent) handleTunnelCreated(event *tunnel.TunnelEvent) {
 	a.logger.Info("隧道已建立 (SDP 2.0 compliant)", "tunnel_id", tun.ID, "service_id", serviceID, "target", targetAddr, "proxy", proxyAddr)
 }
 
+// markQoS 按隧道的服务等级标记数据平面连接的 DSCP，平台或连接不支持时忽略
+func (a *AHAgent) markQoS(tun *tunnel.Tunnel, conn net.Conn) {
+	if err := qos.MarkClass(conn, tun.QoSClass()); err != nil {
+		a.logger.Debug("跳过 DSCP 标记", "tunnel_id", tun.ID, "qos_class", tun.QoSClass(), "error", err)
+	}
+}
+
+// accessInfo 访问日志中的连接标识
+func (t *activeTunnel) accessInfo(streamID uint32) *tunnel.ConnAccess {
+	return &tunnel.ConnAccess{
+		TunnelID:   t.tunnelID,
+		ClientID:   t.clientID,
+		ServiceID:  t.serviceID,
+		Target:     net.JoinHostPort(t.targetHost, strconv.Itoa(t.targetPort)),
+		IHEndpoint: t.ihEndpoint,
+		StreamID:   streamID,
+	}
+}
+
+// obfuscationStats 隧道启用流量混淆时返回新的开销统计，否则为 nil
+func obfuscationStats(tun *tunnel.Tunnel) *tunnel.ObfuscationStats {
+	if !tun.IsObfuscated() {
+		return nil
+	}
+	return &tunnel.ObfuscationStats{}
+}
+
+// obfuscate 以混淆连接包装数据平面连接（位于 E2E 之上，先填充后加密），stats 为 nil 时原样返回
+func obfuscate(conn net.Conn, stats *tunnel.ObfuscationStats) net.Conn {
+	if stats == nil {
+		return conn
+	}
+	return (&tunnel.ObfuscationConfig{Stats: stats}).Wrap(conn)
+}
+
+// logTunnelClosed 记录隧道关闭，启用流量混淆时附带发送方向的开销统计
+func (a *AHAgent) logTunnelClosed(tun *activeTunnel, msg string) {
+	fields := []interface{}{"tunnel_id", tun.tunnelID}
+	if tun.obfuscation != nil {
+		snap := tun.obfuscation.Snapshot()
+		fields = append(fields,
+			"obfuscation_payload_bytes", snap.PayloadBytes,
+			"obfuscation_overhead_bytes", snap.OverheadBytes,
+			"obfuscation_overhead_ratio", snap.OverheadRatio())
+	}
+	a.logger.Info(msg, fields...)
+}
+
 func (a *AHAgent) forwardData(ctx context.Context, tun *activeTunnel) {
 	defer func() {
 		tun.cancel()
-		tun.proxyConn.Close()
-		tun.targetConn.Close()
-		delete(a.activeTunnels, tun.tunnelID)
-		a.logger.Info("隧道已关闭", "tunnel_id", tun.tunnelID)
+		a.removeTunnel(tun.tunnelID)
+		a.logTunnelClosed(tun, "隧道已关闭")
 	}()
 
-	errChan := make(chan error, 2)
+	// 双向转发直到任一端关闭或隧道被取消，结束时记录时长、字节数与关闭原因
+	event := a.accessLog.Forward(ctx, tun.accessInfo(0), tun.proxyConn, tun.targetConn)
+	if event.Details["close_reason"] == tunnel.CloseReasonError {
+		a.logger.Error("数据转发错误", "error", event.Details["error"], "tunnel_id", tun.tunnelID)
+	}
+}
+
+// serveMux 接收 IH 打开的流，为每个流单独拨号目标服务并双向转发
+func (a *AHAgent) serveMux(ctx context.Context, tun *activeTunnel) {
+	defer func() {
+		tun.cancel()
+		tun.mux.Close()
+		a.removeTunnel(tun.tunnelID)
+		a.logTunnelClosed(tun, "多路复用隧道已关闭")
+	}()
 
 	go func() {
-		_, err := io.Copy(tun.targetConn, tun.proxyConn)
-		errChan <- err
+		<-ctx.Done()
+		tun.mux.Close()
+	}()
+
+	targetAddr := net.JoinHostPort(tun.targetHost, strconv.Itoa(tun.targetPort))
+	for {
+		stream, err := tun.mux.AcceptStream()
+		if err != nil {
+			if reason := tunnel.RelayCloseReason(err); reason != "" {
+				a.logger.Warn("中继断开多路复用隧道", "tunnel_id", tun.tunnelID, "reason", reason)
+			}
+			return
+		}
+
+		go func(stream *tunnel.MuxStream) {
+			defer stream.Close()
+
+			targetConn, err := a.dialTarget(ctx, tun.serviceID, targetAddr)
+			if err != nil {
+				a.logger.Error("连接目标服务失败", "error", err, "target", targetAddr, "stream_id", stream.ID())
+				return
+			}
+			targetConn, err = a.prepareTarget(ctx, tun, targetConn)
+			if err != nil {
+				a.logger.Error("准备目标连接失败", "error", err, "target", targetAddr, "stream_id", stream.ID())
+				return
+			}
+			defer targetConn.Close()
+
+			a.accessLog.Forward(ctx, tun.accessInfo(stream.ID()), stream, targetConn)
+		}(stream)
+	}
+}
+
+// handleReverseForward 建立反向转发：在隧道指定的地址上监听，每个连接在多路复用会话上打开一个流转回 IH
+func (a *AHAgent) handleReverseForward(tun *tunnel.Tunnel, proxyAddr string) {
+	bindAddr := tun.ReverseForwardAddr()
+	if err := tunnel.ValidateReverseForwardAddr(bindAddr); err != nil {
+		a.logger.Error("反向转发地址无效", "tunnel_id", tun.ID, "error", err)
+		return
+	}
+	if !a.reverseGatewayPorts && !tunnel.IsLoopbackForwardAddr(bindAddr) {
+		a.logger.Error("反向转发只允许监听回环地址（需 -reverse-gateway-ports）", "tunnel_id", tun.ID, "bind", bindAddr)
+		return
+	}
+	bindHost, bindPort, _ := net.SplitHostPort(bindAddr)
+	port, _ := strconv.Atoi(bindPort)
+
+	e2e, err := a.e2eSession(tun)
+	if err != nil {
+		a.logger.Error("端到端加密协商失败", "error", err, "tunnel_id", tun.ID)
+		return
+	}
+
+	ln, err := net.Listen("tcp", bindAddr)
+	if err != nil {
+		a.logger.Error("反向转发监听失败", "error", err, "tunnel_id", tun.ID, "bind", bindAddr)
+		return
+	}
+
+	// AH 作为多路复用服务端打开流（偶数 ID），IH 接受流并拨号其所在网络中的目标
+	conn, err := a.newDataPlaneClient(proxyAddr).Connect(tun.ID)
+	if err != nil {
+		ln.Close()
+		a.logger.Error("连接TCP Proxy失败", "error", err, "addr", proxyAddr)
+		return
+	}
+	a.markQoS(tun, conn)
+	if e2e != nil {
+		conn = e2e.Wrap(conn)
+	}
+	obfuscation := obfuscationStats(tun)
+	conn = obfuscate(conn, obfuscation)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	activeTun := &activeTunnel{
+		tunnelID:   tun.ID,
+		clientID:   tun.ClientID,
+		serviceID:  tun.ServiceID,
+		ihEndpoint: tun.IHEndpoint,
+		targetHost: bindHost,
+		targetPort: port,
+		mux:        tunnel.NewMuxSession(conn, false),
+		cancel:     cancel,
+		createdAt:  tun.CreatedAt,
+		expiresAt:  tun.ExpiresAt,
+
+		obfuscation: obfuscation,
+	}
+	a.storeTunnel(activeTun)
+
+	go a.serveReverseForward(ctx, activeTun, ln)
+
+	a.logger.Info("反向转发已建立", "tunnel_id", tun.ID, "service_id", tun.ServiceID, "bind", ln.Addr().String(), "proxy", proxyAddr)
+}
+
+// serveReverseForward 接受本地连接并转回 IH，会话关闭或隧道取消时停止监听
+// 本地连接作为访问日志的对端、IH 侧流作为目标，L7 检查作用于发往 IH 侧服务的数据
+func (a *AHAgent) serveReverseForward(ctx context.Context, tun *activeTunnel, ln net.Listener) {
+	defer func() {
+		tun.cancel()
+		tun.mux.Close()
+		a.removeTunnel(tun.tunnelID)
+		a.logTunnelClosed(tun, "反向转发已关闭")
 	}()
 
 	go func() {
-		_, err := io.Copy(tun.proxyConn, tun.targetConn)
-		errChan <- err
+		select {
+		case <-ctx.Done():
+		case <-tun.mux.Done():
+		}
+		ln.Close()
 	}()
 
-	select {
-	case err := <-errChan:
-		if err != nil && err != io.EOF {
-			a.logger.Error("数据转发错误", "error", err, "tunnel_id", tun.tunnelID)
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() == nil && !tun.mux.IsClosed() {
+				a.logger.Warn("反向转发监听结束", "tunnel_id", tun.tunnelID, "error", err)
+			}
+			return
 		}
-	case <-ctx.Done():
-		a.logger.Info("隧道被取消", "tunnel_id", tun.tunnelID)
+
+		go func(conn net.Conn) {
+			defer conn.Close()
+
+			stream, err := tun.mux.OpenStream()
+			if err != nil {
+				a.logger.Error("打开反向转发流失败", "error", err, "tunnel_id", tun.tunnelID)
+				return
+			}
+			defer stream.Close()
+
+			a.accessLog.Forward(ctx, tun.accessInfo(stream.ID()), conn, stream)
+		}(conn)
 	}
 }
 
@@ -375,13 +941,95 @@ func (a *AHAgent) handleTunnelDeleted(event *tunnel.TunnelEvent) {
 	tunnelID := event.Tunnel.ID
 	a.logger.Info("收到隧道删除通知", "tunnel_id", tunnelID)
 
-	if tun, ok := a.activeTunnels[tunnelID]; ok {
+	a.tunnelsMu.Lock()
+	tun, ok := a.activeTunnels[tunnelID]
+	a.tunnelsMu.Unlock()
+	if ok {
 		tun.cancel()
 	}
 }
 
+func (a *AHAgent) storeTunnel(tun *activeTunnel) {
+	a.tunnelsMu.Lock()
+	defer a.tunnelsMu.Unlock()
+	a.activeTunnels[tun.tunnelID] = tun
+}
+
+func (a *AHAgent) removeTunnel(tunnelID string) {
+	a.tunnelsMu.Lock()
+	defer a.tunnelsMu.Unlock()
+	delete(a.activeTunnels, tunnelID)
+}
+
+// reconcileTunnels 向 Controller 上报本地活跃隧道（Controller 重启后据此重建隧道记录），
+// 并关闭 Controller 判定需要终止的隧道（服务已删除、策略不再允许等）
+func (a *AHAgent) reconcileTunnels(ctx context.Context, subscriber *tunnel.Subscriber) {
+	a.tunnelsMu.Lock()
+	reported := make([]*tunnel.ReportedTunnel, 0, len(a.activeTunnels))
+	for _, tun := range a.activeTunnels {
+		reported = append(reported, &tunnel.ReportedTunnel{
+			TunnelID:   tun.tunnelID,
+			ClientID:   tun.clientID,
+			ServiceID:  tun.serviceID,
+			TargetHost: tun.targetHost,
+			TargetPort: tun.targetPort,
+			Multiplex:  tun.mux != nil,
+			Obfuscate:  tun.obfuscation != nil,
+			CreatedAt:  tun.createdAt,
+			ExpiresAt:  tun.expiresAt,
+		})
+	}
+	a.tunnelsMu.Unlock()
+
+	result, err := subscriber.Reconcile(ctx, reported)
+	if err != nil {
+		a.logger.Error("隧道对账失败", "error", err)
+		return
+	}
+
+	for _, tunnelID := range result.Terminate {
+		a.tunnelsMu.Lock()
+		tun, ok := a.activeTunnels[tunnelID]
+		a.tunnelsMu.Unlock()
+		if ok {
+			a.logger.Warn("Controller 要求终止隧道", "tunnel_id", tunnelID)
+			tun.cancel()
+		}
+	}
+	a.logger.Info("隧道对账完成",
+		"kept", len(result.Kept),
+		"rebuilt", len(result.Rebuilt),
+		"terminated", len(result.Terminate))
+}
+
+// warmService 为热点服务建立空闲目标连接（模式化服务目标不固定、回显服务不连接目标，不预热）
+func (a *AHAgent) warmService(svc *tunnel.ServiceConfig) {
+	if !a.hotServices[svc.ServiceID] || svc.IsPattern() || a.echoServices[svc.ServiceID] {
+		return
+	}
+	// Controller 解析的域名目标在创建隧道时才确定 IP，不按域名在本地解析预热
+	if svc.ResolveOnController && net.ParseIP(svc.TargetHost) == nil {
+		return
+	}
+	a.targetPool.Warm(net.JoinHostPort(svc.TargetHost, strconv.Itoa(svc.TargetPort)))
+}
+
 func (a *AHAgent) cleanup() {
+	a.tunnelsMu.Lock()
+	defer a.tunnelsMu.Unlock()
 	for _, tun := range a.activeTunnels {
 		tun.cancel()
 	}
+	a.targetPool.Close()
+}
+
+// splitList 解析逗号分隔的参数列表，忽略空项
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
 }
@@ -20,8 +20,10 @@ package main
 import (
 	"flag"
 	"log"
+	"strings"
 	"time"
 
+	"github.com/houzhh15/sdp-common/cert"
 	"github.com/houzhh15/sdp-common/controller"
 	"github.com/houzhh15/sdp-common/policy"
 )
@@ -33,13 +35,32 @@ var (
 	httpAddr  = flag.String("addr", ":8443", "HTTPS server address")
 	proxyAddr = flag.String("proxy-addr", ":9443", "TCP proxy address")
 	logLevel  = flag.String("log-level", "info", "Log level (debug, info, warn, error)")
+
+	tlsMinVersion = flag.String("tls-min-version", "TLS1.2", "Minimum TLS version (TLS1.2, TLS1.3)")
+	tlsCiphers    = flag.String("tls-ciphers", "", "Comma-separated TLS 1.2 cipher suites (IANA names, default: ECDHE+AEAD)")
+
+	embedService = flag.Bool("embed-service", false, "Embed a service config snapshot in tunnel_created events")
+
+	servicesFile = flag.String("services-file", "", "Declarative services file (YAML) applied at startup instead of the demo service")
+	policiesFile = flag.String("policies-file", "", "Declarative policies file (YAML) applied at startup instead of the demo policy")
+	seedMode     = flag.String("seed-mode", "update", "How declarative files are applied (create, update, prune)")
 )
 
 func main() {
 	flag.Parse()
 
+	var ciphers []string
+	if *tlsCiphers != "" {
+		ciphers = strings.Split(*tlsCiphers, ",")
+	}
+	tlsPolicy, err := cert.ParseTLSPolicy(*tlsMinVersion, "", ciphers, nil)
+	if err != nil {
+		log.Fatalf("Invalid TLS policy: %v", err)
+	}
+
 	// Create Controller with SDK
 	ctrl, err := controller.New(&controller.Config{
+		TLSPolicy:    tlsPolicy,
 		CertFile:     *certFile,
 		KeyFile:      *keyFile,
 		CAFile:       *caFile,
@@ -47,18 +68,36 @@ func main() {
 		TCPProxyAddr: *proxyAddr,
 		LogLevel:     *logLevel,
 		DBPath:       "controller.db",
+
+		EmbedServiceInTunnelEvents: *embedService,
+
+		ServicesFile: *servicesFile,
+		PoliciesFile: *policiesFile,
+		SeedMode:     controller.SeedMode(*seedMode),
 	})
 	if err != nil {
 		log.Fatalf("Failed to create controller: %v", err)
 	}
 
-	// Pre-configure a demo service
+	// Pre-configure a demo service and policy unless they are managed declaratively
+	if *servicesFile == "" && *policiesFile == "" {
+		seedDemo(ctrl)
+	}
+
+	// Start the Controller (blocks until interrupted with Ctrl+C)
+	if err := ctrl.Start(); err != nil {
+		log.Fatalf("Controller error: %v", err)
+	}
+}
+
+// seedDemo adds the demo service and policy used by the other examples
+func seedDemo(ctrl *controller.Controller) {
 	if err := ctrl.AddService("demo-service-001", "localhost", 9999); err != nil {
 		log.Printf("Warning: Failed to add demo service: %v", err)
 	}
 
 	// Add demo policies (for testing)
-	// In production, policies should be managed via REST API or admin UI
+	// In production, policies should be managed via REST API, admin UI or -policies-file
 	if err := ctrl.AddPolicy(&policy.Policy{
 		PolicyID:  "policy-allow-ih-client",
 		ClientID:  "ih-client", // Match the client ID from session
@@ -70,9 +109,4 @@ func main() {
 	}); err != nil {
 		log.Printf("Warning: Failed to add demo policy: %v", err)
 	}
-
-	// Start the Controller (blocks until interrupted with Ctrl+C)
-	if err := ctrl.Start(); err != nil {
-		log.Fatalf("Controller error: %v", err)
-	}
 }
@@ -7,6 +7,7 @@ import (
 	"context"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -22,6 +23,7 @@ import (
 	"github.com/houzhh15/sdp-common/cert"
 	"github.com/houzhh15/sdp-common/logging"
 	"github.com/houzhh15/sdp-common/policy"
+	"github.com/houzhh15/sdp-common/qos"
 	"github.com/houzhh15/sdp-common/tunnel"
 )
 
@@ -31,15 +33,55 @@ var (
 	caFile     = flag.String("ca", "../../certs/ca-cert.pem", "CA certificate file path")
 	controller = flag.String("controller", "https://localhost:8443", "Controller URL")
 	localAddr  = flag.String("local", "localhost:8080", "Local proxy listen address")
-	proxyAddr  = flag.String("proxy", "localhost:9443", "Controller TCP proxy address")
+	proxyAddr  = flag.String("proxy", "", "Controller TCP proxy address (default: discovered from the Controller)")
 	tunnelID   = flag.String("tunnel-id", "tunnel-12345678", "Tunnel ID for this connection")
 	logLevel   = flag.String("log-level", "info", "Log level (debug, info, warn, error)")
+	multiplex  = flag.Bool("multiplex", false, "Keep one relay connection per tunnel and multiplex local connections over it")
+	endToEnd   = flag.Bool("e2e", false, "Encrypt tunnel data end-to-end with the AH so the relay only sees ciphertext")
+
+	diagnose       = flag.String("diagnose", "", "Create a tunnel to this AH echo service (ah-agent -echo-services), print RTT/loss/throughput and exit")
+	diagnoseProbes = flag.Int("diagnose-probes", 20, "RTT probes sent by -diagnose")
+	diagnoseBytes  = flag.Int64("diagnose-bytes", 4<<20, "Bytes echoed by the -diagnose throughput test (negative skips it)")
+
+	adminSocket    = flag.String("admin-socket", "", "Unix socket for the local admin API; enables link shaping of the local proxy, adjustable at runtime (testing only)")
+	shapeBandwidth = flag.Int64("shape-bandwidth", 0, "Initial bandwidth cap in bytes/s per direction for the local proxy (testing only)")
+	shapeLatency   = flag.Duration("shape-latency", 0, "Initial one-way latency added in each direction (testing only)")
+	shapeJitter    = flag.Duration("shape-jitter", 0, "Initial latency jitter (testing only)")
+	shapeDrop      = flag.Float64("shape-drop", 0, "Initial chunk drop rate in [0, 1); dropped chunks are delayed as if retransmitted (testing only)")
+
+	// forwards -L / -R 端口转发（可重复），指定时每条转发创建独立隧道并替代 -local 代理
+	forwards []*tunnel.ForwardSpec
 )
 
+func init() {
+	flag.Var(forwardFlag{}, "L", "Local forward `[bind_address:]port:service_id[:host:hostport]`, like ssh -L (repeatable)")
+	flag.Var(forwardFlag{remote: true}, "R", "Reverse forward `[bind_address:]port:service_id:host:hostport`: the AH serving service_id listens and forwards back to host:hostport on this side, like ssh -R (repeatable, requires a policy with reverse_forward)")
+}
+
+// forwardFlag parses one -L or -R value into forwards
+type forwardFlag struct {
+	remote bool
+}
+
+func (f forwardFlag) String() string { return "" }
+
+func (f forwardFlag) Set(value string) error {
+	parse := tunnel.ParseLocalForward
+	if f.remote {
+		parse = tunnel.ParseRemoteForward
+	}
+	spec, err := parse(value)
+	if err != nil {
+		return err
+	}
+	forwards = append(forwards, spec)
+	return nil
+}
+
 // IHProxy represents the IH Client with local proxy capability
 type IHProxy struct {
 	localAddr string
-	proxyAddr string
+	dataPlane *tunnel.DataPlaneClient // 数据平面客户端（未指定 -proxy 时从 Controller 发现地址）
 	tunnelID  string
 	tlsConfig *tls.Config
 	logger    logging.Logger
@@ -56,6 +98,34 @@ type IHProxy struct {
 	httpClient    *http.Client     // HTTP客户端
 	policies      []*policy.Policy // 缓存的策略列表
 	tunnelCreated bool             // 隧道是否已创建
+	serviceID     string           // 隧道对应服务，用于 TTFB 指标标签
+
+	// 多路复用模式：每个隧道保持一条中继连接，本地连接以编号流承载
+	multiplex  bool
+	muxSession *tunnel.MuxSession
+
+	// 多跳隧道：服务位于多个中继之后时，连接链上第一跳并由中继逐跳转发
+	relayChain []string
+
+	// 隧道的 DSCP 服务等级（Controller 按服务配置或策略下发），为空时不标记
+	qosClass string
+
+	// 端到端加密：创建隧道时提交本端公钥，AH 上报公钥后派生隧道密钥
+	e2eKey     *tunnel.E2EKey
+	e2eMu      sync.Mutex // 保护 e2eSession（首次连接时轮询 AH 公钥）
+	e2eSession *tunnel.E2ESession
+
+	// 流量混淆：策略要求时 Controller 在创建响应中标记，数据平面连接以混淆连接包装；未启用时为 nil
+	obfuscation *tunnel.ObfuscationStats
+
+	// 端口转发：模式化服务的具体目标（-L）或 AH 侧监听地址（-R），为空时使用服务配置
+	targetHost     string
+	targetPort     int
+	reverseForward string
+
+	// 链路整形（测试用）：未启用时为 nil，转发等同 io.Copy
+	shaper        *tunnel.Shaper
+	adminListener net.Listener
 }
 
 func main() {
@@ -97,15 +167,24 @@ func main() {
 	}
 
 	// 3. Create IH Proxy
+	newDataPlane := func() *tunnel.DataPlaneClient {
+		return tunnel.NewDataPlaneClientWithConfig(&tunnel.DataPlaneClientConfig{
+			ServerAddr:  *proxyAddr,
+			TLSConfig:   certManager.GetTLSConfig(),
+			Discover:    tunnel.DiscoverFromController(*controller, certManager.GetTLSConfig(), nil),
+			CloseNotice: true,
+		})
+	}
 	proxy := &IHProxy{
 		localAddr:     *localAddr,
-		proxyAddr:     *proxyAddr,
+		dataPlane:     newDataPlane(),
 		tunnelID:      *tunnelID,
 		tlsConfig:     certManager.GetTLSConfig(),
 		logger:        logger,
 		active:        make(map[string]net.Conn),
 		shutdown:      make(chan struct{}),
 		controllerURL: *controller,
+		multiplex:     *multiplex,
 		httpClient: &http.Client{
 			Transport: &http.Transport{
 				TLSClientConfig: certManager.GetTLSConfig(),
@@ -114,11 +193,30 @@ func main() {
 		},
 	}
 
+	if *endToEnd {
+		if proxy.e2eKey, err = tunnel.GenerateE2EKey(); err != nil {
+			log.Fatalf("Failed to generate e2e key: %v", err)
+		}
+	}
+
 	// 4. step-08: 执行握手获取session token
 	if err := proxy.handshake(fingerprint); err != nil {
 		log.Fatalf("Handshake failed: %v", err)
 	}
 
+	// 诊断模式：经隧道连接 AH 回显服务，输出报告后退出（0 正常，1 失败，2 存在丢失或数据损坏）
+	if *diagnose != "" {
+		os.Exit(proxy.diagnose(*diagnose))
+	}
+
+	// 端口转发模式：每条 -L / -R 创建独立隧道，运行至收到中断信号
+	if len(forwards) > 0 {
+		if err := proxy.runForwards(forwards, newDataPlane); err != nil {
+			log.Fatalf("Port forwarding failed: %v", err)
+		}
+		return
+	}
+
 	// 5. step-08: 查询策略
 	if err := proxy.queryPolicies(); err != nil {
 		logger.Warn("Failed to query policies", "error", err.Error())
@@ -131,6 +229,7 @@ func main() {
 		serviceID = proxy.policies[0].ServiceID
 	}
 
+	proxy.serviceID = serviceID
 	newTunnelID, err := proxy.createTunnel(serviceID)
 	if err != nil {
 		logger.Warn("Failed to create tunnel during startup, will use command-line tunnel-id", "error", err.Error())
@@ -140,6 +239,10 @@ func main() {
 		logger.Info("Tunnel pre-created", "tunnel_id", newTunnelID)
 	}
 
+	if err := proxy.setupShaping(); err != nil {
+		log.Fatalf("Failed to set up link shaping: %v", err)
+	}
+
 	// 6. Start local proxy server
 	if err := proxy.Start(); err != nil {
 		log.Fatalf("Failed to start proxy: %v", err)
@@ -149,10 +252,17 @@ func main() {
 	fmt.Printf("\n✅ IH Client Proxy started successfully!\n\n")
 	fmt.Printf("📍 Configuration:\n")
 	fmt.Printf("   Local Address:  %s  (用户连接这里)\n", *localAddr)
-	fmt.Printf("   Proxy Address:  %s  (连接到 Controller)\n", *proxyAddr)
+	fmt.Printf("   Proxy Address:  %s  (连接到 Controller)\n", proxy.dataPlane.ServerAddr())
 	fmt.Printf("   Tunnel ID:      %s\n", proxy.tunnelID)
 	fmt.Printf("   Controller:     %s\n", *controller)
 	fmt.Printf("   Client ID:      %s\n", fingerprint[:16]+"...")
+	if proxy.shaper != nil {
+		cfg := proxy.shaper.Config()
+		fmt.Printf("   Link Shaping:   bandwidth=%dB/s latency=%s jitter=%s drop=%.3f\n", cfg.Bandwidth, cfg.Latency, cfg.Jitter, cfg.DropRate)
+		if *adminSocket != "" {
+			fmt.Printf("   Admin Socket:   %s  (curl --unix-socket %s http://localhost/shaping)\n", *adminSocket, *adminSocket)
+		}
+	}
 	fmt.Printf("\n💡 使用方法:\n")
 	fmt.Printf("   curl http://%s\n", *localAddr)
 	fmt.Printf("   或在浏览器访问: http://%s\n", *localAddr)
@@ -162,12 +272,24 @@ func main() {
 
 	logger.Info("Proxy ready for connections",
 		"local", *localAddr,
-		"proxy", *proxyAddr,
+		"proxy", proxy.dataPlane.ServerAddr(),
 		"tunnel_id", proxy.tunnelID)
 
 	// 6. Monitor connection stats
 	go proxy.monitorStats()
 
+	// 长期运行时定期检查本地证书，进入 30 天告警期或过期时提醒续期
+	expiryCtx, stopExpiry := context.WithCancel(context.Background())
+	defer stopExpiry()
+	go cert.NewExpiryMonitor(certManager, &cert.ExpiryMonitorConfig{
+		OnExpiring: func(n *cert.ExpiryNotice) {
+			logger.Warn("Certificate needs renewal",
+				"state", n.State,
+				"not_after", n.NotAfter,
+				"days_remaining", n.DaysRemaining())
+		},
+	}).Run(expiryCtx)
+
 	// 7. Wait for interrupt signal
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
@@ -203,6 +325,9 @@ func (p *IHProxy) Stop() {
 	if p.listener != nil {
 		p.listener.Close()
 	}
+	if p.adminListener != nil {
+		p.adminListener.Close()
+	}
 
 	// Close all active connections
 	p.mu.Lock()
@@ -210,6 +335,9 @@ func (p *IHProxy) Stop() {
 		p.logger.Info("Closing connection", "id", id)
 		conn.Close()
 	}
+	if p.muxSession != nil {
+		p.muxSession.Close()
+	}
 	p.mu.Unlock()
 
 	// Wait for all goroutines
@@ -255,6 +383,7 @@ func (p *IHProxy) acceptLoop() {
 // handleConnection processes a single user connection
 func (p *IHProxy) handleConnection(localConn net.Conn) {
 	defer p.wg.Done()
+	acceptedAt := time.Now()
 
 	// Generate connection ID
 	p.mu.Lock()
@@ -277,12 +406,10 @@ func (p *IHProxy) handleConnection(localConn net.Conn) {
 		p.logger.Info("Connection closed", "id", connID)
 	}()
 
-	// Connect to Controller TCP Proxy with timeout
-	p.logger.Info("Connecting to proxy", "id", connID, "addr", p.proxyAddr)
+	// Connect to Controller TCP Proxy (or open a stream on the shared relay connection)
+	p.logger.Info("Connecting to proxy", "id", connID, "addr", p.dataPlane.ServerAddr(), "multiplex", p.multiplex)
 
-	// Use DataPlaneClient SDK to establish connection (encapsulates protocol details)
-	dataPlaneClient := tunnel.NewDataPlaneClient(p.proxyAddr, p.tlsConfig)
-	proxyConn, err := dataPlaneClient.Connect(p.tunnelID)
+	proxyConn, err := p.openProxyConn(acceptedAt)
 	if err != nil {
 		p.logger.Error("Failed to connect to proxy", "id", connID, "error", err)
 		return
@@ -299,14 +426,14 @@ func (p *IHProxy) handleConnection(localConn net.Conn) {
 
 	// Local -> Proxy (upstream)
 	go func() {
-		n, err := io.Copy(proxyConn, localConn)
+		n, err := p.shaper.Copy(proxyConn, localConn, tunnel.ShapeUpstream)
 		p.logger.Debug("Upstream transfer completed", "id", connID, "bytes", n)
 		errChan <- err
 	}()
 
 	// Proxy -> Local (downstream)
 	go func() {
-		n, err := io.Copy(localConn, proxyConn)
+		n, err := p.shaper.Copy(localConn, proxyConn, tunnel.ShapeDownstream)
 		p.logger.Debug("Downstream transfer completed", "id", connID, "bytes", n)
 		errChan <- err
 	}()
@@ -314,7 +441,9 @@ func (p *IHProxy) handleConnection(localConn net.Conn) {
 	// Wait for either direction to complete or context cancel
 	select {
 	case err := <-errChan:
-		if err != nil && err != io.EOF {
+		if reason := tunnel.RelayCloseReason(err); reason != "" {
+			p.logger.Warn("Tunnel closed by relay", "id", connID, "tunnel_id", p.tunnelID, "reason", reason)
+		} else if err != nil && err != io.EOF {
 			p.logger.Error("Data transfer error", "id", connID, "error", err)
 		}
 	case <-ctx.Done():
@@ -324,6 +453,363 @@ func (p *IHProxy) handleConnection(localConn net.Conn) {
 	}
 }
 
+// setupShaping enables link shaping of the local proxy when a shaping flag or
+// the admin socket is set. The admin API registers the proxy under its local
+// listen address so QA can change the shaping while connections are open.
+func (p *IHProxy) setupShaping() error {
+	cfg := &tunnel.ShapingConfig{
+		Bandwidth: *shapeBandwidth,
+		Latency:   *shapeLatency,
+		Jitter:    *shapeJitter,
+		DropRate:  *shapeDrop,
+	}
+	if *adminSocket == "" && *cfg == (tunnel.ShapingConfig{}) {
+		return nil
+	}
+
+	shaper, err := tunnel.NewShaper(cfg)
+	if err != nil {
+		return err
+	}
+	p.shaper = shaper
+	p.logger.Warn("Link shaping enabled for testing", "mapping", p.localAddr,
+		"bandwidth", cfg.Bandwidth, "latency", cfg.Latency, "jitter", cfg.Jitter, "drop_rate", cfg.DropRate)
+
+	if *adminSocket == "" {
+		return nil
+	}
+	ln, err := tunnel.ListenShapingAdmin(*adminSocket)
+	if err != nil {
+		return err
+	}
+	p.adminListener = ln
+	admin := tunnel.NewShapingAdmin()
+	admin.Register(p.localAddr, shaper)
+	go http.Serve(ln, admin)
+	p.logger.Info("Admin socket listening", "path", *adminSocket)
+	return nil
+}
+
+// errMuxTunnelClosed is returned for new local connections once the shared
+// relay connection of a multiplexed tunnel has closed
+var errMuxTunnelClosed = errors.New("multiplexed tunnel closed")
+
+// openProxyConn returns a data plane connection for one local connection.
+// In multiplex mode it opens a new stream on the shared relay connection,
+// otherwise it dials a dedicated relay connection whose handshake carries
+// acceptedAt so the relay and this client can report time-to-first-byte.
+func (p *IHProxy) openProxyConn(acceptedAt time.Time) (io.ReadWriteCloser, error) {
+	e2e, err := p.endToEndSession()
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.multiplex {
+		conn, err := p.dialRelay(acceptedAt)
+		if err != nil {
+			return nil, err
+		}
+		if e2e != nil {
+			conn = e2e.Wrap(conn)
+		}
+		conn = p.obfuscate(conn)
+		return tunnel.NewTTFBConn(conn, p.serviceID, tunnel.TTFBSideIH, acceptedAt), nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.muxSession != nil && p.muxSession.IsClosed() {
+		// AH serves a multiplexed tunnel over a single relay connection and ends the
+		// tunnel when it closes; re-dialing would only wait on the relay for a peer
+		return nil, errMuxTunnelClosed
+	}
+	if p.muxSession == nil {
+		conn, err := p.dialRelay(time.Time{})
+		if err != nil {
+			return nil, err
+		}
+		if e2e != nil {
+			// 加密底层中继连接，流复用帧同样不暴露给中继
+			conn = e2e.Wrap(conn)
+		}
+		conn = p.obfuscate(conn)
+		session := tunnel.NewMuxSession(conn, true)
+		p.muxSession = session
+		p.logger.Info("Multiplexed relay connection established", "tunnel_id", p.tunnelID)
+		go func() {
+			<-session.Done()
+			select {
+			case <-p.shutdown:
+			default:
+				p.logger.Error("Multiplexed relay connection closed, tunnel must be recreated", "tunnel_id", p.tunnelID)
+			}
+		}()
+	}
+
+	return p.muxSession.OpenStream()
+}
+
+// dialRelay dials a dedicated relay connection using the DataPlaneClient SDK.
+// Chained tunnels connect to the first hop of the relay chain; otherwise a
+// non-zero acceptedAt selects the timed handshake. The connection is marked
+// with the tunnel's DSCP class.
+func (p *IHProxy) dialRelay(acceptedAt time.Time) (net.Conn, error) {
+	var conn net.Conn
+	var err error
+	switch {
+	case len(p.relayChain) > 0:
+		conn, err = p.dataPlane.ConnectChain(p.tunnelID, p.relayChain)
+	case acceptedAt.IsZero():
+		conn, err = p.dataPlane.Connect(p.tunnelID)
+	default:
+		conn, err = p.dataPlane.ConnectTimed(p.tunnelID, acceptedAt)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Unsupported platforms or connections keep the default DSCP
+	if err := qos.MarkClass(conn, p.qosClass); err != nil {
+		p.logger.Debug("DSCP marking skipped", "tunnel_id", p.tunnelID, "qos_class", p.qosClass, "error", err)
+	}
+	return conn, nil
+}
+
+// obfuscate wraps a data plane connection for obfuscated tunnels. It is applied
+// after the e2e wrapper so padding is encrypted along with the payload.
+func (p *IHProxy) obfuscate(conn net.Conn) net.Conn {
+	if p.obfuscation == nil {
+		return conn
+	}
+	return (&tunnel.ObfuscationConfig{Stats: p.obfuscation}).Wrap(conn)
+}
+
+// obfuscationFields returns log fields with the padding overhead of obfuscated tunnels
+func (p *IHProxy) obfuscationFields() []interface{} {
+	if p.obfuscation == nil {
+		return nil
+	}
+	snap := p.obfuscation.Snapshot()
+	return []interface{}{
+		"obfuscation_payload_bytes", snap.PayloadBytes,
+		"obfuscation_overhead_bytes", snap.OverheadBytes,
+		"obfuscation_overhead_ratio", snap.OverheadRatio(),
+	}
+}
+
+// endToEndSession returns the tunnel key session when end-to-end encryption is enabled.
+// The AH publishes its key after receiving the tunnel event, so the first call
+// polls the Controller until the key is available.
+func (p *IHProxy) endToEndSession() (*tunnel.E2ESession, error) {
+	if p.e2eKey == nil {
+		return nil, nil
+	}
+	p.e2eMu.Lock()
+	defer p.e2eMu.Unlock()
+	if p.e2eSession != nil {
+		return p.e2eSession, nil
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		agentKey, err := p.fetchAgentE2EKey()
+		if err != nil {
+			return nil, err
+		}
+		if agentKey != "" {
+			session, err := p.e2eKey.Session(p.tunnelID, agentKey, tunnel.E2ESideIH)
+			if err != nil {
+				return nil, err
+			}
+			p.e2eSession = session
+			p.logger.Info("End-to-end tunnel key established", "tunnel_id", p.tunnelID)
+			return session, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for agent e2e key")
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+// fetchAgentE2EKey 查询 AH 上报的公钥，尚未上报时返回空
+func (p *IHProxy) fetchAgentE2EKey() (string, error) {
+	req, err := http.NewRequest("GET", p.controllerURL+"/api/v1/tunnels/e2e-key?tunnel_id="+p.tunnelID, nil)
+	if err != nil {
+		return "", fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+p.sessionToken)
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var keyResp struct {
+		PublicKey string `json:"public_key"`
+		Code      string `json:"code"`
+	}
+	json.NewDecoder(resp.Body).Decode(&keyResp)
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return keyResp.PublicKey, nil
+	case resp.StatusCode == http.StatusNotFound && keyResp.Code == "E2E_KEY_PENDING":
+		return "", nil
+	default:
+		return "", fmt.Errorf("query e2e key failed: status=%d", resp.StatusCode)
+	}
+}
+
+// diagnose creates a tunnel to an AH echo service, measures RTT, loss and
+// throughput over it and prints the report. It returns the process exit code.
+func (p *IHProxy) diagnose(serviceID string) int {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	p.serviceID = serviceID
+	tunnelID, err := p.createTunnel(serviceID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Diagnostics failed: %v\n", err)
+		return 1
+	}
+	p.tunnelID = tunnelID
+
+	fmt.Printf("\n🔍 Diagnosing tunnel %s to echo service %s via %s\n\n", tunnelID, serviceID, p.dataPlane.ServerAddr())
+	conn, err := p.openProxyConn(time.Now())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Diagnostics failed: connect to relay: %v\n", err)
+		return 1
+	}
+	report, err := tunnel.RunDiagnostics(ctx, conn, &tunnel.DiagnosticsConfig{
+		Probes:          *diagnoseProbes,
+		ThroughputBytes: *diagnoseBytes,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Diagnostics failed: %v\n", err)
+		return 1
+	}
+	report.Print(os.Stdout)
+	if !report.Healthy() {
+		return 2
+	}
+	return 0
+}
+
+// runForwards creates one tunnel per -L / -R forward and serves them until
+// interrupted. Each forward uses its own data plane client so tunnels on
+// different relays or chains do not share state.
+func (p *IHProxy) runForwards(specs []*tunnel.ForwardSpec, newDataPlane func() *tunnel.DataPlaneClient) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	fmt.Printf("\n✅ Port forwards:\n")
+	for _, spec := range specs {
+		fp := p.forwardProxy(spec, newDataPlane())
+		tunnelID, err := fp.createTunnel(spec.ServiceID)
+		if err != nil {
+			stop()
+			return fmt.Errorf("%s: %w", spec, err)
+		}
+		fp.tunnelID = tunnelID
+
+		var ln net.Listener
+		if !spec.Remote {
+			if ln, err = net.Listen("tcp", spec.BindAddr); err != nil {
+				stop()
+				return fmt.Errorf("%s: %w", spec, err)
+			}
+		}
+
+		wg.Add(1)
+		go func(spec *tunnel.ForwardSpec) {
+			defer wg.Done()
+			defer fp.Stop()
+			if err := fp.serveForward(ctx, spec, ln); err != nil {
+				p.logger.Error("Port forward stopped", "forward", spec.String(), "tunnel_id", fp.tunnelID, "error", err)
+			}
+			if fields := fp.obfuscationFields(); fields != nil {
+				p.logger.Info("Port forward obfuscation stats", append([]interface{}{"forward", spec.String(), "tunnel_id", fp.tunnelID}, fields...)...)
+			}
+		}(spec)
+		fmt.Printf("   %s  (tunnel %s)\n", spec, tunnelID)
+	}
+	fmt.Printf("\n   Press Ctrl+C to stop\n\n")
+
+	<-ctx.Done()
+	p.logger.Info("Shutting down port forwards...")
+	return nil
+}
+
+// forwardProxy returns a proxy for one forward that shares the session,
+// HTTP client and e2e key with p. Reverse forwards always use multiplexing:
+// the AH opens one stream per connection accepted on its side.
+func (p *IHProxy) forwardProxy(spec *tunnel.ForwardSpec, dataPlane *tunnel.DataPlaneClient) *IHProxy {
+	fp := &IHProxy{
+		dataPlane:     dataPlane,
+		tlsConfig:     p.tlsConfig,
+		logger:        p.logger,
+		active:        make(map[string]net.Conn),
+		shutdown:      make(chan struct{}),
+		sessionToken:  p.sessionToken,
+		controllerURL: p.controllerURL,
+		httpClient:    p.httpClient,
+		serviceID:     spec.ServiceID,
+		multiplex:     p.multiplex || spec.Remote,
+		e2eKey:        p.e2eKey,
+	}
+	if spec.Remote {
+		fp.reverseForward = spec.BindAddr
+	} else {
+		fp.targetHost, fp.targetPort = spec.TargetHost, spec.TargetPort
+	}
+	return fp
+}
+
+// serveForward serves a local forward on ln, or for a reverse forward
+// connects the multiplexed relay connection and dials spec's target for
+// every stream the AH opens.
+func (p *IHProxy) serveForward(ctx context.Context, spec *tunnel.ForwardSpec, ln net.Listener) error {
+	if !spec.Remote {
+		return tunnel.ServeForward(ctx, ln, func(ctx context.Context) (io.ReadWriteCloser, error) {
+			conn, err := p.openProxyConn(time.Now())
+			if err != nil {
+				p.logger.Error("Failed to open tunnel connection", "forward", spec.String(), "error", err)
+			}
+			return conn, err
+		})
+	}
+
+	e2e, err := p.endToEndSession()
+	if err != nil {
+		return err
+	}
+	conn, err := p.dialRelay(time.Time{})
+	if err != nil {
+		return err
+	}
+	if e2e != nil {
+		conn = e2e.Wrap(conn)
+	}
+	conn = p.obfuscate(conn)
+	session := tunnel.NewMuxSession(conn, true)
+	p.mu.Lock()
+	p.muxSession = session
+	p.mu.Unlock()
+
+	var dialer net.Dialer
+	return tunnel.ServeReverseForward(ctx, session, func(ctx context.Context) (net.Conn, error) {
+		conn, err := dialer.DialContext(ctx, "tcp", spec.Target())
+		if err != nil {
+			p.logger.Error("Failed to dial reverse forward target", "forward", spec.String(), "error", err)
+		}
+		return conn, err
+	})
+}
+
 // monitorStats periodically logs connection statistics
 func (p *IHProxy) monitorStats() {
 	ticker := time.NewTicker(30 * time.Second)
@@ -338,9 +824,8 @@ func (p *IHProxy) monitorStats() {
 			p.mu.Unlock()
 
 			if activeCount > 0 || totalCount > 0 {
-				p.logger.Info("Connection stats",
-					"active", activeCount,
-					"total", totalCount)
+				fields := []interface{}{"active", activeCount, "total", totalCount}
+				p.logger.Info("Connection stats", append(fields, p.obfuscationFields()...)...)
 			}
 
 		case <-p.shutdown:
@@ -357,8 +842,9 @@ func (p *IHProxy) handshake(fingerprint string) error {
 
 	// 构造握手请求
 	reqBody := map[string]interface{}{
-		"type":        "handshake_request",
-		"fingerprint": fingerprint,
+		"type":         "handshake_request",
+		"fingerprint":  fingerprint,
+		"capabilities": tunnel.DefaultCapabilities(),
 	}
 
 	bodyBytes, err := json.Marshal(reqBody)
@@ -367,7 +853,7 @@ func (p *IHProxy) handshake(fingerprint string) error {
 	}
 
 	// 发送POST请求
-	req, err := http.NewRequest("POST", p.controllerURL+"/api/v1/handshake", bytes.NewReader(bodyBytes))
+	req, err := http.NewRequest("POST", p.controllerURL+"/api/v1/auth/handshake", bytes.NewReader(bodyBytes))
 	if err != nil {
 		return fmt.Errorf("create request: %w", err)
 	}
@@ -390,6 +876,8 @@ func (p *IHProxy) handshake(fingerprint string) error {
 		Status       string `json:"status"`
 		SessionToken string `json:"session_token"`
 		ExpiresAt    string `json:"expires_at"`
+		// Controller 支持的可选能力，旧版本 Controller 不返回
+		Capabilities tunnel.Capabilities `json:"capabilities,omitempty"`
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&handshakeResp); err != nil {
 		return fmt.Errorf("decode response: %w", err)
@@ -399,7 +887,17 @@ func (p *IHProxy) handshake(fingerprint string) error {
 	p.sessionToken = handshakeResp.SessionToken
 	p.logger.Info("Handshake successful",
 		"token", p.sessionToken[:16]+"...",
-		"expires_at", handshakeResp.ExpiresAt)
+		"expires_at", handshakeResp.ExpiresAt,
+		"capabilities", handshakeResp.Capabilities.String())
+
+	// 按 Controller 能力降级：多路复用退回每连接一条中继连接；E2E 不能静默降级
+	if p.multiplex && !handshakeResp.Capabilities.Supports(tunnel.CapabilityMux) {
+		p.logger.Warn("Controller does not support multiplexing, using one relay connection per local connection")
+		p.multiplex = false
+	}
+	if p.e2eKey != nil && !handshakeResp.Capabilities.Supports(tunnel.CapabilityE2E) {
+		return fmt.Errorf("controller does not support end-to-end encryption")
+	}
 
 	return nil
 }
@@ -460,6 +958,17 @@ func (p *IHProxy) createTunnel(serviceID string) (string, error) {
 		"session_token": p.sessionToken,
 		"service_id":    serviceID,
 		"local_port":    8080,
+		"multiplex":     p.multiplex,
+	}
+	if p.e2eKey != nil {
+		reqBody["e2e_public_key"] = p.e2eKey.PublicKey()
+	}
+	if p.targetHost != "" {
+		reqBody["target_host"] = p.targetHost
+		reqBody["target_port"] = p.targetPort
+	}
+	if p.reverseForward != "" {
+		reqBody["reverse_forward"] = p.reverseForward
 	}
 
 	bodyBytes, err := json.Marshal(reqBody)
@@ -481,6 +990,20 @@ func (p *IHProxy) createTunnel(serviceID string) (string, error) {
 
 	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
+		// 服务维护中：向用户显示维护说明与预计结束时间
+		var apiErr struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+			Details struct {
+				EndsAt string `json:"ends_at"`
+			} `json:"details"`
+		}
+		if json.Unmarshal(body, &apiErr) == nil && apiErr.Code == "MAINTENANCE" {
+			if apiErr.Details.EndsAt != "" {
+				return "", fmt.Errorf("service under maintenance until %s: %s", apiErr.Details.EndsAt, apiErr.Message)
+			}
+			return "", fmt.Errorf("service under maintenance: %s", apiErr.Message)
+		}
 		return "", fmt.Errorf("create tunnel failed: status=%d, body=%s", resp.StatusCode, string(body))
 	}
 
@@ -490,6 +1013,20 @@ func (p *IHProxy) createTunnel(serviceID string) (string, error) {
 		Status    string `json:"status"`
 		TunnelID  string `json:"tunnel_id"`
 		ExpiresAt string `json:"expires_at,omitempty"`
+		// ControllerAddr Controller 当前首选的数据平面地址
+		ControllerAddr string `json:"controller_addr,omitempty"`
+		// Multiplex 隧道实际是否为多路复用模式（Controller 禁用多路复用时为 false）
+		Multiplex *bool `json:"multiplex,omitempty"`
+		// RelayChain 多跳隧道经过的中继链，第一跳为本端连接的地址
+		RelayChain []string `json:"relay_chain,omitempty"`
+		// QoSClass 隧道的 DSCP 服务等级，本端据此标记数据平面连接
+		QoSClass string `json:"qos_class,omitempty"`
+		// 服务配置了凭据 broker 时签发的临时目标凭据（隧道删除或到期后失效）
+		Credentials *tunnel.TargetCredential `json:"credentials,omitempty"`
+		// ReverseForward 反向转发隧道的 AH 监听地址
+		ReverseForward string `json:"reverse_forward,omitempty"`
+		// Obfuscate 策略要求流量混淆，数据平面连接须以混淆连接包装
+		Obfuscate bool `json:"obfuscate,omitempty"`
 		// Note: TargetHost/Port 不在 Tunnel 响应中，应从 ServiceConfig 获取
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&tunnelResp); err != nil {
@@ -500,6 +1037,40 @@ func (p *IHProxy) createTunnel(serviceID string) (string, error) {
 		"tunnel_id", tunnelResp.TunnelID,
 		"service_id", serviceID,
 		"expires_at", tunnelResp.ExpiresAt)
+	if p.multiplex && tunnelResp.Multiplex != nil && !*tunnelResp.Multiplex {
+		p.logger.Warn("Tunnel created without multiplexing, using one relay connection per local connection",
+			"tunnel_id", tunnelResp.TunnelID)
+		p.multiplex = false
+	}
+	// 未通过 -proxy 固定地址时跟随 Controller 通告的数据平面地址
+	if *proxyAddr == "" && tunnelResp.ControllerAddr != "" {
+		p.dataPlane.SetServerAddr(tunnelResp.ControllerAddr)
+	}
+	// 多跳隧道必须经中继链到达 AH 所在的最后一跳，不受 -proxy 影响
+	if len(tunnelResp.RelayChain) > 0 {
+		p.logger.Info("Tunnel uses a relay chain",
+			"tunnel_id", tunnelResp.TunnelID,
+			"relay_chain", tunnelResp.RelayChain)
+		p.relayChain = tunnelResp.RelayChain
+	}
+	p.qosClass = tunnelResp.QoSClass
+	p.obfuscation = nil
+	if tunnelResp.Obfuscate {
+		p.logger.Info("Tunnel uses traffic obfuscation", "tunnel_id", tunnelResp.TunnelID)
+		p.obfuscation = &tunnel.ObfuscationStats{}
+	}
+	// 不支持反向转发的 Controller 会忽略该字段并创建普通隧道
+	if p.reverseForward != "" && tunnelResp.ReverseForward == "" {
+		return "", fmt.Errorf("controller does not support reverse forwarding")
+	}
+	if cred := tunnelResp.Credentials; cred != nil {
+		// 密码/令牌只交给本地用户，不写入日志
+		p.logger.Info("Ephemeral target credentials issued",
+			"tunnel_id", tunnelResp.TunnelID,
+			"username", cred.Username,
+			"expires_at", cred.ExpiresAt)
+		fmt.Printf("\n🔑 Target credentials (valid until tunnel closes): username=%s password=%s\n", cred.Username, cred.Password)
+	}
 
 	return tunnelResp.TunnelID, nil
 }
@@ -0,0 +1,72 @@
+// Package faults 提供用于韧性测试的故障注入点
+//
+// 仅在以 faults 构建标签编译时生效（go build -tags faults / go test -tags faults），
+// 默认构建中所有注入点均为空操作，Inject 返回 ErrDisabled，不影响生产路径。
+//
+// 注入点：
+//   - RelayDrop：中继服务器丢弃接下来 N 个入站连接（accept 后立即关闭）
+//   - SSEDelay：SSE 推送每个事件前延迟 Delay
+//   - HandshakeCorrupt：数据平面客户端发送的握手帧被篡改（首字节翻转）
+//   - SessionError：会话校验返回 ErrInjected
+//
+// Count > 0 表示仅触发接下来 Count 次；Count <= 0 表示持续生效直到 Clear/Reset。
+// Controller 在 faults 构建下注册测试专用管理端点 /api/v1/admin/faults。
+package faults
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// 故障注入点
+const (
+	RelayDrop        = "relay_drop"
+	SSEDelay         = "sse_delay"
+	HandshakeCorrupt = "handshake_corrupt"
+	SessionError     = "session_error"
+)
+
+var (
+	// ErrDisabled 未以 faults 构建标签编译
+	ErrDisabled = errors.New("fault injection disabled (build with -tags faults)")
+	// ErrInjected 注入的故障错误
+	ErrInjected = errors.New("injected fault")
+)
+
+// Fault 故障配置
+type Fault struct {
+	Point string        `json:"point"`
+	Count int           `json:"count,omitempty"` // 剩余触发次数；<= 0 表示持续生效
+	Delay time.Duration `json:"delay,omitempty"` // 仅 SSEDelay
+}
+
+type bypassKey struct{}
+
+// Bypass 返回不受故障注入影响的上下文
+// 故障管理端点自身的会话校验使用该上下文，保证注入 session_error 后仍可清除故障
+func Bypass(ctx context.Context) context.Context {
+	return context.WithValue(ctx, bypassKey{}, true)
+}
+
+// bypassed 检查上下文是否跳过故障注入
+func bypassed(ctx context.Context) bool {
+	skip, _ := ctx.Value(bypassKey{}).(bool)
+	return skip
+}
+
+// Validate 校验故障配置
+func (f *Fault) Validate() error {
+	switch f.Point {
+	case RelayDrop, HandshakeCorrupt, SessionError:
+		return nil
+	case SSEDelay:
+		if f.Delay <= 0 {
+			return fmt.Errorf("sse_delay requires a positive delay")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown fault point: %q", f.Point)
+	}
+}
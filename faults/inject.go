@@ -0,0 +1,107 @@
+//go:build faults
+
+package faults
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	mu     sync.Mutex
+	active = make(map[string]*Fault)
+)
+
+// Enabled 是否以 faults 构建标签编译
+func Enabled() bool { return true }
+
+// Inject 注入故障（同一注入点覆盖之前的配置）
+func Inject(f Fault) error {
+	if err := f.Validate(); err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	active[f.Point] = &f
+	return nil
+}
+
+// Clear 清除指定注入点
+func Clear(point string) {
+	mu.Lock()
+	defer mu.Unlock()
+	delete(active, point)
+}
+
+// Reset 清除所有注入点
+func Reset() {
+	mu.Lock()
+	defer mu.Unlock()
+	active = make(map[string]*Fault)
+}
+
+// Active 返回当前生效的故障（按注入点排序）
+func Active() []Fault {
+	mu.Lock()
+	defer mu.Unlock()
+	faults := make([]Fault, 0, len(active))
+	for _, f := range active {
+		faults = append(faults, *f)
+	}
+	sort.Slice(faults, func(i, j int) bool { return faults[i].Point < faults[j].Point })
+	return faults
+}
+
+// trigger 检查注入点是否触发，并消耗一次计数
+func trigger(point string) (Fault, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	f, ok := active[point]
+	if !ok {
+		return Fault{}, false
+	}
+	if f.Count > 0 {
+		f.Count--
+		if f.Count == 0 {
+			delete(active, point)
+		}
+	}
+	return *f, true
+}
+
+// DropRelayConn 中继服务器是否丢弃当前入站连接
+func DropRelayConn() bool {
+	_, ok := trigger(RelayDrop)
+	return ok
+}
+
+// DelaySSE 在推送 SSE 事件前按配置延迟
+func DelaySSE() {
+	if f, ok := trigger(SSEDelay); ok {
+		time.Sleep(f.Delay)
+	}
+}
+
+// CorruptHandshake 返回篡改后的握手帧（未触发时原样返回）
+func CorruptHandshake(frame []byte) []byte {
+	if _, ok := trigger(HandshakeCorrupt); !ok || len(frame) == 0 {
+		return frame
+	}
+	corrupted := append([]byte(nil), frame...)
+	corrupted[0] ^= 0xFF
+	return corrupted
+}
+
+// SessionValidationError 返回注入的会话校验错误（未触发时为 nil）
+func SessionValidationError(ctx context.Context) error {
+	if bypassed(ctx) {
+		return nil
+	}
+	if _, ok := trigger(SessionError); ok {
+		return fmt.Errorf("validate session: %w", ErrInjected)
+	}
+	return nil
+}
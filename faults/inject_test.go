@@ -0,0 +1,87 @@
+//go:build faults
+
+package faults
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestInjectCount(t *testing.T) {
+	t.Cleanup(Reset)
+
+	if err := Inject(Fault{Point: RelayDrop, Count: 2}); err != nil {
+		t.Fatalf("Inject failed: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if !DropRelayConn() {
+			t.Fatalf("Expected drop %d", i+1)
+		}
+	}
+	if DropRelayConn() {
+		t.Error("Expected fault to be exhausted after Count triggers")
+	}
+	if len(Active()) != 0 {
+		t.Errorf("Expected no active faults, got %v", Active())
+	}
+}
+
+func TestInjectPersistentAndClear(t *testing.T) {
+	t.Cleanup(Reset)
+
+	Inject(Fault{Point: SessionError})
+	for i := 0; i < 3; i++ {
+		if err := SessionValidationError(context.Background()); !errors.Is(err, ErrInjected) {
+			t.Fatalf("Expected ErrInjected, got %v", err)
+		}
+	}
+	// Bypass 上下文不受影响
+	if err := SessionValidationError(Bypass(context.Background())); err != nil {
+		t.Errorf("Expected bypassed context to skip fault, got %v", err)
+	}
+
+	Clear(SessionError)
+	if err := SessionValidationError(context.Background()); err != nil {
+		t.Errorf("Expected no error after Clear, got %v", err)
+	}
+}
+
+func TestCorruptHandshake(t *testing.T) {
+	t.Cleanup(Reset)
+
+	frame := []byte{0xFE, 0x01, 0x02}
+	Inject(Fault{Point: HandshakeCorrupt, Count: 1})
+
+	corrupted := CorruptHandshake(frame)
+	if corrupted[0] == frame[0] {
+		t.Error("Expected first byte to be corrupted")
+	}
+	if frame[0] != 0xFE {
+		t.Error("Original frame must not be modified")
+	}
+	if got := CorruptHandshake(frame); got[0] != 0xFE {
+		t.Error("Expected frame unchanged once the fault is exhausted")
+	}
+}
+
+func TestDelaySSE(t *testing.T) {
+	t.Cleanup(Reset)
+
+	Inject(Fault{Point: SSEDelay, Delay: 50 * time.Millisecond, Count: 1})
+	start := time.Now()
+	DelaySSE()
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Expected delay of at least 50ms, got %v", elapsed)
+	}
+}
+
+func TestInjectValidate(t *testing.T) {
+	if err := Inject(Fault{Point: "unknown"}); err == nil {
+		t.Error("Expected error for unknown point")
+	}
+	if err := Inject(Fault{Point: SSEDelay}); err == nil {
+		t.Error("Expected error for sse_delay without delay")
+	}
+}
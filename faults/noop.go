@@ -0,0 +1,32 @@
+//go:build !faults
+
+package faults
+
+import "context"
+
+// Enabled 是否以 faults 构建标签编译
+func Enabled() bool { return false }
+
+// Inject 默认构建不支持故障注入
+func Inject(f Fault) error { return ErrDisabled }
+
+// Clear 空操作
+func Clear(point string) {}
+
+// Reset 空操作
+func Reset() {}
+
+// Active 默认构建无生效故障
+func Active() []Fault { return nil }
+
+// DropRelayConn 空操作
+func DropRelayConn() bool { return false }
+
+// DelaySSE 空操作
+func DelaySSE() {}
+
+// CorruptHandshake 原样返回
+func CorruptHandshake(frame []byte) []byte { return frame }
+
+// SessionValidationError 空操作
+func SessionValidationError(ctx context.Context) error { return nil }
@@ -0,0 +1,28 @@
+//go:build !faults
+
+package faults
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestDisabledByDefault(t *testing.T) {
+	if Enabled() {
+		t.Fatal("Expected fault injection to be disabled without the faults build tag")
+	}
+	if err := Inject(Fault{Point: RelayDrop, Count: 1}); !errors.Is(err, ErrDisabled) {
+		t.Errorf("Expected ErrDisabled, got %v", err)
+	}
+	if DropRelayConn() {
+		t.Error("DropRelayConn should be a no-op")
+	}
+	if err := SessionValidationError(context.Background()); err != nil {
+		t.Errorf("SessionValidationError should be a no-op, got %v", err)
+	}
+	frame := []byte{0x01, 0x02}
+	if got := CorruptHandshake(frame); got[0] != 0x01 {
+		t.Error("CorruptHandshake should return the frame unchanged")
+	}
+}
@@ -0,0 +1,248 @@
+package k8s
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// 集群内 ServiceAccount 挂载路径
+const (
+	inClusterTokenFile     = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	inClusterCAFile        = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+	inClusterNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+)
+
+// errWatchExpired 资源版本过旧（410 Gone），需要重新 list
+var errWatchExpired = errors.New("watch resource version expired")
+
+// objectMeta Kubernetes 对象元数据（仅使用到的字段）
+type objectMeta struct {
+	Name            string            `json:"name"`
+	Namespace       string            `json:"namespace"`
+	ResourceVersion string            `json:"resourceVersion"`
+	Labels          map[string]string `json:"labels,omitempty"`
+	Annotations     map[string]string `json:"annotations,omitempty"`
+}
+
+// kubeService core/v1 Service
+type kubeService struct {
+	Metadata objectMeta `json:"metadata"`
+	Spec     struct {
+		Type  string        `json:"type"`
+		Ports []servicePort `json:"ports"`
+	} `json:"spec"`
+}
+
+// servicePort core/v1 ServicePort
+type servicePort struct {
+	Name     string `json:"name"`
+	Protocol string `json:"protocol"`
+	Port     int    `json:"port"`
+}
+
+// kubeEndpoints core/v1 Endpoints（与同名 Service 对应）
+type kubeEndpoints struct {
+	Metadata objectMeta       `json:"metadata"`
+	Subsets  []endpointSubset `json:"subsets"`
+}
+
+// endpointSubset core/v1 EndpointSubset，Addresses 只包含就绪的地址
+type endpointSubset struct {
+	Addresses []struct {
+		IP string `json:"ip"`
+	} `json:"addresses"`
+	Ports []struct {
+		Name     string `json:"name"`
+		Port     int    `json:"port"`
+		Protocol string `json:"protocol"`
+	} `json:"ports"`
+}
+
+// listMeta 列表元数据，ResourceVersion 作为后续 watch 的起点
+type listMeta struct {
+	ResourceVersion string `json:"resourceVersion"`
+}
+
+// watchEvent watch 流中的单个事件
+type watchEvent struct {
+	Type   string          `json:"type"` // ADDED, MODIFIED, DELETED, BOOKMARK, ERROR
+	Object json.RawMessage `json:"object"`
+}
+
+// apiClient 最小化的 Kubernetes API 客户端（list / watch core/v1 资源），不依赖 client-go
+type apiClient struct {
+	server    string
+	tokenFile string
+	http      *http.Client
+	// stream watch 使用的客户端，不设置整体超时（由 timeoutSeconds 与 ctx 控制）
+	stream *http.Client
+}
+
+// newAPIClient 创建 API 客户端，server 为空时使用集群内配置
+func newAPIClient(config *Config) (*apiClient, error) {
+	server, tokenFile, caFile := config.APIServer, config.TokenFile, config.CAFile
+	if server == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return nil, fmt.Errorf("not running in a cluster: KUBERNETES_SERVICE_HOST / KUBERNETES_SERVICE_PORT not set and no APIServer configured")
+		}
+		server = "https://" + net.JoinHostPort(host, port)
+		if tokenFile == "" {
+			tokenFile = inClusterTokenFile
+		}
+		if caFile == "" {
+			caFile = inClusterCAFile
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if caFile != "" {
+		caPEM, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("read kubernetes CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates in kubernetes CA file %s", caFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+
+	return &apiClient{
+		server:    strings.TrimSuffix(server, "/"),
+		tokenFile: tokenFile,
+		http:      &http.Client{Transport: transport, Timeout: 30 * time.Second},
+		stream:    &http.Client{Transport: transport},
+	}, nil
+}
+
+// resourcePath 返回 core/v1 资源路径，namespace 为空表示所有命名空间
+func resourcePath(namespace, resource string) string {
+	if namespace == "" {
+		return "/api/v1/" + resource
+	}
+	return "/api/v1/namespaces/" + neturl.PathEscape(namespace) + "/" + resource
+}
+
+// newRequest 创建带 ServiceAccount 令牌的请求；令牌每次重新读取，投射令牌会定期轮换
+func (c *apiClient) newRequest(ctx context.Context, path string, query neturl.Values) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.server+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.tokenFile != "" {
+		token, err := os.ReadFile(c.tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("read service account token: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+	return req, nil
+}
+
+// list 列出资源，out 为 {metadata, items} 结构
+func (c *apiClient) list(ctx context.Context, namespace, resource, selector string, out interface{}) error {
+	query := neturl.Values{}
+	if selector != "" {
+		query.Set("labelSelector", selector)
+	}
+	req, err := c.newRequest(ctx, resourcePath(namespace, resource), query)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("list %s: %w", resource, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("list %s: status %d: %s", resource, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode %s list: %w", resource, err)
+	}
+	return nil
+}
+
+// watch 从 resourceVersion 开始监视资源，收到第一个变更事件时返回 nil；
+// 服务端在 timeout 后正常结束 watch 时同样返回 nil，调用方随后重新 list
+func (c *apiClient) watch(ctx context.Context, namespace, resource, selector, resourceVersion string, timeout time.Duration) error {
+	query := neturl.Values{}
+	query.Set("watch", "true")
+	query.Set("resourceVersion", resourceVersion)
+	query.Set("allowWatchBookmarks", "true")
+	query.Set("timeoutSeconds", fmt.Sprint(int(timeout.Seconds())))
+	if selector != "" {
+		query.Set("labelSelector", selector)
+	}
+	req, err := c.newRequest(ctx, resourcePath(namespace, resource), query)
+	if err != nil {
+		return err
+	}
+	resp, err := c.stream.Do(req)
+	if err != nil {
+		return fmt.Errorf("watch %s: %w", resource, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusGone:
+		return errWatchExpired
+	default:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("watch %s: status %d: %s", resource, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	decoder := json.NewDecoder(bufio.NewReader(resp.Body))
+	for {
+		var event watchEvent
+		if err := decoder.Decode(&event); err != nil {
+			if errors.Is(err, io.EOF) || ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("watch %s: %w", resource, err)
+		}
+		switch event.Type {
+		case "BOOKMARK":
+			continue
+		case "ERROR":
+			// 常见原因是资源版本过旧（Status code 410）
+			var status struct {
+				Code    int    `json:"code"`
+				Message string `json:"message"`
+			}
+			json.Unmarshal(event.Object, &status)
+			if status.Code == http.StatusGone {
+				return errWatchExpired
+			}
+			return fmt.Errorf("watch %s: %s", resource, status.Message)
+		default:
+			return nil
+		}
+	}
+}
+
+// namespaceFromServiceAccount 读取 Pod 所在命名空间
+func namespaceFromServiceAccount() (string, error) {
+	data, err := os.ReadFile(inClusterNamespaceFile)
+	if err != nil {
+		return "", fmt.Errorf("read pod namespace: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
@@ -0,0 +1,391 @@
+// Package k8s 为 AH agent 提供 Kubernetes 服务发现：按标签选择器监视 Service / Endpoints，
+// 将有就绪端点的 Service 端口自动注册为 Controller 服务配置并保持同步（端点全部下线或 Service 删除时注销）。
+//
+// Sidecar 模式下 AH 与业务容器运行在同一 Pod，只暴露本 Pod（PodIP）作为端点的 Service 端口，
+// 目标地址为 127.0.0.1:<容器端口>。
+//
+//	provider, err := k8s.NewProvider(&k8s.Config{
+//	    LabelSelector: "sdp.io/expose=true",
+//	    Registrar:     serviceClient, // *service.Client
+//	    Logger:        logger,
+//	})
+//	if err != nil {
+//	    return err
+//	}
+//	go provider.Run(ctx)
+//
+// 使用集群内配置时，ServiceAccount 需要对 services、endpoints 的 list / watch 权限。
+package k8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/houzhh15/sdp-common/backoff"
+	"github.com/houzhh15/sdp-common/logging"
+	"github.com/houzhh15/sdp-common/service"
+)
+
+// 默认参数
+const (
+	DefaultResyncInterval = 5 * time.Minute
+	DefaultDebounce       = time.Second
+	DefaultClusterDomain  = "cluster.local"
+
+	// unregisterTimeout 停止时注销服务的超时
+	unregisterTimeout = 10 * time.Second
+)
+
+// 注册服务的 Metadata 键
+const (
+	MetadataNamespace = "k8s_namespace"
+	MetadataService   = "k8s_service"
+	MetadataPort      = "k8s_port"
+	MetadataPod       = "k8s_pod" // 仅 Sidecar 模式
+)
+
+// Registrar 向 Controller 注册 / 注销服务，*service.Client 实现该接口
+type Registrar interface {
+	Register(ctx context.Context, services []service.Service) error
+	Unregister(ctx context.Context, serviceID string) error
+}
+
+// Config Kubernetes 服务发现配置
+type Config struct {
+	// APIServer Kubernetes API 地址（如 "https://10.0.0.1:443"），为空时使用集群内配置
+	// （KUBERNETES_SERVICE_HOST / KUBERNETES_SERVICE_PORT 与 ServiceAccount 挂载的令牌、CA）
+	APIServer string
+	// TokenFile / CAFile 访问 API 的令牌与 CA 文件，集群内配置时默认为 ServiceAccount 挂载路径
+	TokenFile string
+	CAFile    string
+
+	// Namespace 监视的命名空间，默认 Pod 所在命名空间；AllNamespaces 监视所有命名空间（Sidecar 模式不可用）
+	Namespace     string
+	AllNamespaces bool
+	// LabelSelector Service 标签选择器（如 "sdp.io/expose=true"），Endpoints 使用同一选择器（端点继承 Service 标签）
+	LabelSelector string
+	// ClusterDomain 集群 DNS 域，目标地址为 <service>.<namespace>.svc.<ClusterDomain>，默认 cluster.local
+	ClusterDomain string
+
+	// Sidecar 只暴露本 Pod 作为端点的服务，目标为 127.0.0.1
+	Sidecar bool
+	// PodIP / PodName 本 Pod 的 IP 与名称，默认取环境变量 POD_IP / POD_NAME（通过 downward API 注入）；
+	// Sidecar 模式必须有 PodIP，PodName 非空时追加到服务 ID，使多副本各自注册不同的服务
+	PodIP   string
+	PodName string
+
+	// Registrar 注册目标（必填）
+	Registrar Registrar
+	// ResyncInterval 单次 watch 的最长时间，到期后重新 list 并协调，默认 5 分钟
+	ResyncInterval time.Duration
+	// Debounce 收到变更后等待合并的时间，默认 1 秒
+	Debounce time.Duration
+	// UnregisterOnStop Run 结束时注销已注册的服务（如 Pod 终止）
+	UnregisterOnStop bool
+
+	Logger logging.Logger
+}
+
+// Provider 监视 Kubernetes Service / Endpoints 并同步到 Controller
+type Provider struct {
+	config    *Config
+	api       *apiClient
+	namespace string
+	logger    logging.Logger
+
+	mu         sync.Mutex
+	registered map[string]service.Service // service ID -> 已注册的服务
+}
+
+// NewProvider 创建 Kubernetes 服务发现
+func NewProvider(config *Config) (*Provider, error) {
+	if config.Registrar == nil {
+		return nil, fmt.Errorf("registrar is required")
+	}
+	if config.PodIP == "" {
+		config.PodIP = os.Getenv("POD_IP")
+	}
+	if config.PodName == "" {
+		config.PodName = os.Getenv("POD_NAME")
+	}
+	if config.Sidecar {
+		if config.PodIP == "" {
+			return nil, fmt.Errorf("sidecar mode requires the pod IP (POD_IP)")
+		}
+		if config.AllNamespaces {
+			return nil, fmt.Errorf("sidecar mode cannot watch all namespaces")
+		}
+	}
+	if config.ClusterDomain == "" {
+		config.ClusterDomain = DefaultClusterDomain
+	}
+	if config.ResyncInterval <= 0 {
+		config.ResyncInterval = DefaultResyncInterval
+	}
+	if config.Debounce <= 0 {
+		config.Debounce = DefaultDebounce
+	}
+	if config.Logger == nil {
+		config.Logger = &noopLogger{}
+	}
+
+	api, err := newAPIClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	namespace := config.Namespace
+	if config.AllNamespaces {
+		namespace = ""
+	} else if namespace == "" {
+		if namespace, err = namespaceFromServiceAccount(); err != nil {
+			return nil, fmt.Errorf("namespace is required outside a pod: %w", err)
+		}
+	}
+
+	return &Provider{
+		config:     config,
+		api:        api,
+		namespace:  namespace,
+		logger:     config.Logger,
+		registered: make(map[string]service.Service),
+	}, nil
+}
+
+// Run 同步并监视变更直到 ctx 结束；失败时按指数退避重试
+func (p *Provider) Run(ctx context.Context) error {
+	retry := backoff.New(&backoff.Config{InitialInterval: time.Second, MaxInterval: time.Minute})
+	defer p.stop()
+
+	for {
+		versions, err := p.sync(ctx)
+		if err == nil {
+			retry.Reset()
+			err = p.waitForChange(ctx, versions)
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		wait := p.config.Debounce
+		switch {
+		case errors.Is(err, errWatchExpired):
+			// 资源版本过旧，立即重新 list
+			continue
+		case err != nil:
+			wait, _ = retry.Next()
+			p.logger.Warn("Kubernetes service discovery failed", "error", err, "retry_in", wait)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Services 返回当前已注册的服务（按 ID 排序）
+func (p *Provider) Services() []service.Service {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	services := make([]service.Service, 0, len(p.registered))
+	for _, svc := range p.registered {
+		services = append(services, svc)
+	}
+	sort.Slice(services, func(i, j int) bool { return services[i].ID < services[j].ID })
+	return services
+}
+
+// resourceVersions list 得到的资源版本，作为 watch 起点
+type resourceVersions struct {
+	services  string
+	endpoints string
+}
+
+// sync list Service 与 Endpoints 并与已注册的服务协调
+func (p *Provider) sync(ctx context.Context) (*resourceVersions, error) {
+	var services struct {
+		Metadata listMeta      `json:"metadata"`
+		Items    []kubeService `json:"items"`
+	}
+	if err := p.api.list(ctx, p.namespace, "services", p.config.LabelSelector, &services); err != nil {
+		return nil, err
+	}
+	var endpoints struct {
+		Metadata listMeta        `json:"metadata"`
+		Items    []kubeEndpoints `json:"items"`
+	}
+	if err := p.api.list(ctx, p.namespace, "endpoints", p.config.LabelSelector, &endpoints); err != nil {
+		return nil, err
+	}
+
+	p.reconcile(ctx, p.desired(services.Items, endpoints.Items))
+	return &resourceVersions{services: services.Metadata.ResourceVersion, endpoints: endpoints.Metadata.ResourceVersion}, nil
+}
+
+// waitForChange 同时监视 Service 与 Endpoints，任一发生变更、watch 到期或出错时返回
+func (p *Provider) waitForChange(ctx context.Context, versions *resourceVersions) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	done := make(chan error, 2)
+	go func() {
+		done <- p.api.watch(ctx, p.namespace, "services", p.config.LabelSelector, versions.services, p.config.ResyncInterval)
+	}()
+	go func() {
+		done <- p.api.watch(ctx, p.namespace, "endpoints", p.config.LabelSelector, versions.endpoints, p.config.ResyncInterval)
+	}()
+	return <-done
+}
+
+// desired 计算应注册的服务：每个有就绪端点的 Service 端口一个服务
+func (p *Provider) desired(services []kubeService, endpoints []kubeEndpoints) map[string]service.Service {
+	byName := make(map[string]*kubeEndpoints, len(endpoints))
+	for i := range endpoints {
+		byName[endpoints[i].Metadata.Namespace+"/"+endpoints[i].Metadata.Name] = &endpoints[i]
+	}
+
+	desired := make(map[string]service.Service)
+	for i := range services {
+		svc := &services[i]
+		if svc.Spec.Type == "ExternalName" {
+			continue
+		}
+		eps := byName[svc.Metadata.Namespace+"/"+svc.Metadata.Name]
+		if eps == nil {
+			continue
+		}
+		for _, port := range svc.Spec.Ports {
+			protocol := strings.ToLower(port.Protocol)
+			if protocol == "" {
+				protocol = "tcp"
+			}
+			if protocol != "tcp" && protocol != "udp" {
+				continue
+			}
+			targetPort, ok := p.endpointPort(eps, port.Name)
+			if !ok {
+				continue
+			}
+
+			id := svc.Metadata.Namespace + "." + svc.Metadata.Name
+			portLabel := port.Name
+			if portLabel == "" {
+				portLabel = strconv.Itoa(port.Port)
+			}
+			if len(svc.Spec.Ports) > 1 {
+				id += "." + portLabel
+			}
+			registered := service.Service{
+				Name:       svc.Metadata.Name,
+				TargetHost: fmt.Sprintf("%s.%s.svc.%s", svc.Metadata.Name, svc.Metadata.Namespace, p.config.ClusterDomain),
+				TargetPort: port.Port,
+				Protocol:   protocol,
+				Metadata: map[string]string{
+					MetadataNamespace: svc.Metadata.Namespace,
+					MetadataService:   svc.Metadata.Name,
+					MetadataPort:      portLabel,
+				},
+			}
+			if p.config.Sidecar {
+				// 直接连接本 Pod 的容器端口，不经过 Service 负载均衡
+				registered.TargetHost = "127.0.0.1"
+				registered.TargetPort = targetPort
+				if p.config.PodName != "" {
+					id += "." + p.config.PodName
+					registered.Metadata[MetadataPod] = p.config.PodName
+				}
+			}
+			registered.ID = id
+			desired[id] = registered
+		}
+	}
+	return desired
+}
+
+// endpointPort 返回 Service 端口（按名称匹配，单端口 Service 名称为空）对应的就绪端点端口；
+// Sidecar 模式只考虑包含本 Pod IP 的端点
+func (p *Provider) endpointPort(eps *kubeEndpoints, name string) (int, bool) {
+	for _, subset := range eps.Subsets {
+		ready := false
+		for _, addr := range subset.Addresses {
+			if !p.config.Sidecar || addr.IP == p.config.PodIP {
+				ready = true
+				break
+			}
+		}
+		if !ready {
+			continue
+		}
+		for _, port := range subset.Ports {
+			if port.Name == name {
+				return port.Port, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// reconcile 注册新增或变化的服务、注销不再需要的服务；单个服务失败只记录日志，下次同步时重试
+func (p *Provider) reconcile(ctx context.Context, desired map[string]service.Service) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ids := make([]string, 0, len(desired))
+	for id := range desired {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		svc := desired[id]
+		if old, ok := p.registered[id]; ok && reflect.DeepEqual(old, svc) {
+			continue
+		}
+		if err := p.config.Registrar.Register(ctx, []service.Service{svc}); err != nil {
+			p.logger.Warn("Failed to register kubernetes service", "service_id", id, "error", err)
+			continue
+		}
+		p.registered[id] = svc
+		p.logger.Info("Kubernetes service registered", "service_id", id, "target", fmt.Sprintf("%s:%d", svc.TargetHost, svc.TargetPort))
+	}
+
+	for id := range p.registered {
+		if _, ok := desired[id]; ok {
+			continue
+		}
+		if err := p.config.Registrar.Unregister(ctx, id); err != nil {
+			p.logger.Warn("Failed to unregister kubernetes service", "service_id", id, "error", err)
+			continue
+		}
+		delete(p.registered, id)
+		p.logger.Info("Kubernetes service unregistered", "service_id", id)
+	}
+}
+
+// stop Run 结束时按配置注销已注册的服务
+func (p *Provider) stop() {
+	if !p.config.UnregisterOnStop {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), unregisterTimeout)
+	defer cancel()
+	p.reconcile(ctx, nil)
+}
+
+// noopLogger 未配置 Logger 时丢弃日志
+type noopLogger struct{}
+
+func (l *noopLogger) Info(msg string, args ...interface{})  {}
+func (l *noopLogger) Warn(msg string, args ...interface{})  {}
+func (l *noopLogger) Error(msg string, args ...interface{}) {}
+func (l *noopLogger) Debug(msg string, args ...interface{}) {}
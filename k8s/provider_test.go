@@ -0,0 +1,295 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/houzhh15/sdp-common/service"
+)
+
+// fakeRegistrar 记录注册 / 注销调用
+type fakeRegistrar struct {
+	mu         sync.Mutex
+	services   map[string]service.Service
+	registers  int
+	failFor    string
+	unregister []string
+}
+
+func newFakeRegistrar() *fakeRegistrar {
+	return &fakeRegistrar{services: make(map[string]service.Service)}
+}
+
+func (r *fakeRegistrar) Register(ctx context.Context, services []service.Service) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, svc := range services {
+		if svc.ID == r.failFor {
+			return fmt.Errorf("conflict")
+		}
+		r.services[svc.ID] = svc
+	}
+	r.registers++
+	return nil
+}
+
+func (r *fakeRegistrar) Unregister(ctx context.Context, serviceID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.services, serviceID)
+	r.unregister = append(r.unregister, serviceID)
+	return nil
+}
+
+func (r *fakeRegistrar) get(id string) (service.Service, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	svc, ok := r.services[id]
+	return svc, ok
+}
+
+// fakeAPIServer 提供 services / endpoints 的 list 与 watch；watch 在 changed 关闭前阻塞
+type fakeAPIServer struct {
+	mu        sync.Mutex
+	services  []kubeService
+	endpoints []kubeEndpoints
+	version   int
+	changed   chan struct{}
+	selector  string
+}
+
+func (s *fakeAPIServer) set(services []kubeService, endpoints []kubeEndpoints) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.services, s.endpoints = services, endpoints
+	s.version++
+	if s.changed != nil {
+		close(s.changed)
+	}
+	s.changed = make(chan struct{})
+}
+
+func (s *fakeAPIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.selector = r.URL.Query().Get("labelSelector")
+	changed := s.changed
+	var items interface{}
+	switch r.URL.Path {
+	case "/api/v1/namespaces/default/services":
+		items = s.services
+	case "/api/v1/namespaces/default/endpoints":
+		items = s.endpoints
+	default:
+		s.mu.Unlock()
+		http.NotFound(w, r)
+		return
+	}
+	version := fmt.Sprint(s.version)
+	s.mu.Unlock()
+
+	if r.URL.Query().Get("watch") != "true" {
+		json.NewEncoder(w).Encode(map[string]interface{}{"metadata": map[string]string{"resourceVersion": version}, "items": items})
+		return
+	}
+	if r.URL.Query().Get("resourceVersion") != version {
+		json.NewEncoder(w).Encode(watchEvent{Type: "MODIFIED", Object: json.RawMessage("{}")})
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.(http.Flusher).Flush()
+	select {
+	case <-changed:
+		json.NewEncoder(w).Encode(watchEvent{Type: "MODIFIED", Object: json.RawMessage("{}")})
+	case <-r.Context().Done():
+	}
+}
+
+func testService(name string, ports ...servicePort) kubeService {
+	var svc kubeService
+	svc.Metadata = objectMeta{Name: name, Namespace: "default"}
+	svc.Spec.Type = "ClusterIP"
+	svc.Spec.Ports = ports
+	return svc
+}
+
+func testEndpoints(name string, ip string, ports map[string]int) kubeEndpoints {
+	var subset endpointSubset
+	subset.Addresses = append(subset.Addresses, struct {
+		IP string `json:"ip"`
+	}{IP: ip})
+	for portName, port := range ports {
+		subset.Ports = append(subset.Ports, struct {
+			Name     string `json:"name"`
+			Port     int    `json:"port"`
+			Protocol string `json:"protocol"`
+		}{Name: portName, Port: port, Protocol: "TCP"})
+	}
+	return kubeEndpoints{Metadata: objectMeta{Name: name, Namespace: "default"}, Subsets: []endpointSubset{subset}}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestProviderRun(t *testing.T) {
+	api := &fakeAPIServer{}
+	api.set(
+		[]kubeService{
+			testService("web", servicePort{Port: 80, Protocol: "TCP"}),
+			testService("db", servicePort{Name: "pg", Port: 5432, Protocol: "TCP"}, servicePort{Name: "metrics", Port: 9187, Protocol: "TCP"}),
+			testService("idle", servicePort{Port: 80, Protocol: "TCP"}),
+		},
+		[]kubeEndpoints{
+			testEndpoints("web", "10.1.0.5", map[string]int{"": 8080}),
+			testEndpoints("db", "10.1.0.6", map[string]int{"pg": 5432, "metrics": 9187}),
+			{Metadata: objectMeta{Name: "idle", Namespace: "default"}},
+		},
+	)
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	registrar := newFakeRegistrar()
+	provider, err := NewProvider(&Config{
+		APIServer:        server.URL,
+		Namespace:        "default",
+		LabelSelector:    "sdp.io/expose=true",
+		Registrar:        registrar,
+		Debounce:         10 * time.Millisecond,
+		UnregisterOnStop: true,
+	})
+	if err != nil {
+		t.Fatalf("NewProvider: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		provider.Run(ctx)
+		close(done)
+	}()
+
+	waitFor(t, "initial registration", func() bool { return len(provider.Services()) == 3 })
+	web, _ := registrar.get("default.web")
+	if web.TargetHost != "web.default.svc.cluster.local" || web.TargetPort != 80 || web.Protocol != "tcp" {
+		t.Errorf("unexpected web service: %+v", web)
+	}
+	if _, ok := registrar.get("default.db.pg"); !ok {
+		t.Error("multi-port service should register one service per port")
+	}
+	if _, ok := registrar.get("default.idle"); ok {
+		t.Error("service without ready endpoints should not be registered")
+	}
+	api.mu.Lock()
+	if api.selector != "sdp.io/expose=true" {
+		t.Errorf("label selector = %q", api.selector)
+	}
+	api.mu.Unlock()
+
+	// web 端点下线后注销，db 未变化不重复注册
+	registrar.mu.Lock()
+	registers := registrar.registers
+	registrar.mu.Unlock()
+	api.set(
+		[]kubeService{testService("web", servicePort{Port: 80, Protocol: "TCP"}), testService("db", servicePort{Name: "pg", Port: 5432, Protocol: "TCP"}, servicePort{Name: "metrics", Port: 9187, Protocol: "TCP"})},
+		[]kubeEndpoints{{Metadata: objectMeta{Name: "web", Namespace: "default"}}, testEndpoints("db", "10.1.0.6", map[string]int{"pg": 5432, "metrics": 9187})},
+	)
+	waitFor(t, "web unregistration", func() bool { return len(provider.Services()) == 2 })
+	if _, ok := registrar.get("default.web"); ok {
+		t.Error("web should be unregistered")
+	}
+	registrar.mu.Lock()
+	if registrar.registers != registers {
+		t.Errorf("unchanged services re-registered: %d -> %d", registers, registrar.registers)
+	}
+	registrar.mu.Unlock()
+
+	// 停止时注销全部服务
+	cancel()
+	<-done
+	registrar.mu.Lock()
+	defer registrar.mu.Unlock()
+	if len(registrar.services) != 0 {
+		t.Errorf("services left after stop: %v", registrar.services)
+	}
+}
+
+func TestProviderSidecar(t *testing.T) {
+	registrar := newFakeRegistrar()
+	provider := &Provider{
+		config: &Config{
+			Sidecar:       true,
+			PodIP:         "10.1.0.7",
+			PodName:       "web-7d9f",
+			ClusterDomain: DefaultClusterDomain,
+			Registrar:     registrar,
+			Logger:        &noopLogger{},
+		},
+		logger:     &noopLogger{},
+		registered: make(map[string]service.Service),
+	}
+
+	services := []kubeService{
+		testService("web", servicePort{Name: "http", Port: 80, Protocol: "TCP"}),
+		testService("api", servicePort{Port: 80, Protocol: "TCP"}),
+		testService("dns", servicePort{Port: 53, Protocol: "SCTP"}),
+	}
+	endpoints := []kubeEndpoints{
+		testEndpoints("web", "10.1.0.7", map[string]int{"http": 8080}),
+		testEndpoints("api", "10.1.0.9", map[string]int{"": 9000}),
+		testEndpoints("dns", "10.1.0.7", map[string]int{"": 53}),
+	}
+	desired := provider.desired(services, endpoints)
+	if len(desired) != 1 {
+		t.Fatalf("sidecar should expose only local services, got %v", desired)
+	}
+	web, ok := desired["default.web.web-7d9f"]
+	if !ok {
+		t.Fatalf("missing pod-scoped service id: %v", desired)
+	}
+	if web.TargetHost != "127.0.0.1" || web.TargetPort != 8080 {
+		t.Errorf("sidecar target = %s:%d", web.TargetHost, web.TargetPort)
+	}
+	if web.Metadata[MetadataPod] != "web-7d9f" || web.Metadata[MetadataPort] != "http" {
+		t.Errorf("unexpected metadata: %v", web.Metadata)
+	}
+
+	// 注册失败的服务下次同步时重试
+	registrar.failFor = "default.web.web-7d9f"
+	provider.reconcile(context.Background(), desired)
+	if len(provider.Services()) != 0 {
+		t.Error("failed registration should not be recorded")
+	}
+	registrar.failFor = ""
+	provider.reconcile(context.Background(), desired)
+	if len(provider.Services()) != 1 {
+		t.Error("registration should be retried")
+	}
+}
+
+func TestNewProviderValidation(t *testing.T) {
+	registrar := newFakeRegistrar()
+	cases := map[string]*Config{
+		"missing registrar":      {APIServer: "http://127.0.0.1", Namespace: "default"},
+		"sidecar without pod ip": {APIServer: "http://127.0.0.1", Namespace: "default", Registrar: registrar, Sidecar: true},
+		"sidecar all namespaces": {APIServer: "http://127.0.0.1", Registrar: registrar, Sidecar: true, PodIP: "10.0.0.1", AllNamespaces: true},
+	}
+	t.Setenv("POD_IP", "")
+	for name, config := range cases {
+		if _, err := NewProvider(config); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+// Package leaktest 检测测试结束后残留的 goroutine
+//
+// 在测试开头调用 Check，测试（及其后注册的 Cleanup）结束后比对 goroutine 快照，
+// 在超时时间内仍未退出的新 goroutine 视为泄漏并报告其调用栈：
+//
+//	func TestSubscriberStop(t *testing.T) {
+//	    leaktest.Check(t)
+//	    sub := tunnel.NewSubscriber(cfg)
+//	    sub.Start(ctx)
+//	    defer sub.Stop()
+//	    ...
+//	}
+//
+// Check 应在其他 Cleanup 之前调用（Cleanup 按注册的逆序执行），使组件的 Close/Stop 先于检测运行
+package leaktest
+
+import (
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// DefaultTimeout 等待 goroutine 退出的默认时间
+const DefaultTimeout = 5 * time.Second
+
+// ignoredFrames 运行时与测试框架自身的 goroutine，调用栈包含其一即不视为泄漏
+var ignoredFrames = []string{
+	"testing.Main(",
+	"testing.(*T).Run(",
+	"testing.tRunner(",
+	"runtime.MHeap_Scavenger",
+	"signal.signal_recv",
+	"os/signal.loop",
+	"created by runtime.gc",
+	"runtime_mcall",
+	"goroutine in C code",
+}
+
+// Check 记录当前 goroutine 快照，测试结束时检测泄漏（等待 DefaultTimeout）
+// ignore 为调用栈中出现即忽略的函数名片段（如第三方库的常驻 goroutine）
+func Check(t testing.TB, ignore ...string) {
+	t.Helper()
+	CheckTimeout(t, DefaultTimeout, ignore...)
+}
+
+// CheckTimeout 同 Check，指定等待 goroutine 退出的时间
+func CheckTimeout(t testing.TB, timeout time.Duration, ignore ...string) {
+	t.Helper()
+	before := snapshot(ignore)
+	t.Cleanup(func() {
+		deadline := time.Now().Add(timeout)
+		for {
+			leaked := leakedSince(before, ignore)
+			if len(leaked) == 0 {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Errorf("leaktest: %d goroutine(s) leaked:\n\n%s", len(leaked), strings.Join(leaked, "\n\n"))
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+}
+
+// leakedSince 返回 before 中不存在的 goroutine 调用栈
+func leakedSince(before map[string]bool, ignore []string) []string {
+	var leaked []string
+	for id, stack := range goroutines(ignore) {
+		if !before[id] {
+			leaked = append(leaked, stack)
+		}
+	}
+	sort.Strings(leaked)
+	return leaked
+}
+
+// snapshot 当前 goroutine ID 集合
+func snapshot(ignore []string) map[string]bool {
+	ids := make(map[string]bool)
+	for id := range goroutines(ignore) {
+		ids[id] = true
+	}
+	return ids
+}
+
+// goroutines 解析 runtime.Stack 输出，返回 goroutine ID -> 调用栈（不含当前 goroutine 与忽略项）
+func goroutines(ignore []string) map[string]string {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	result := make(map[string]string)
+	for i, stack := range strings.Split(string(buf), "\n\n") {
+		// 第一段为调用 runtime.Stack 的当前 goroutine
+		if i == 0 || stack == "" || isIgnored(stack, ignore) {
+			continue
+		}
+		// "goroutine 18 [chan receive]:"
+		header, _, _ := strings.Cut(stack, "\n")
+		fields := strings.Fields(header)
+		if len(fields) < 2 {
+			continue
+		}
+		result[fields[1]] = stack
+	}
+	return result
+}
+
+func isIgnored(stack string, ignore []string) bool {
+	for _, frame := range ignoredFrames {
+		if strings.Contains(stack, frame) {
+			return true
+		}
+	}
+	for _, frame := range ignore {
+		if strings.Contains(stack, frame) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package leaktest
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// recordingTB 记录 Errorf 并手动执行 Cleanup
+type recordingTB struct {
+	testing.TB
+	errors   []string
+	cleanups []func()
+}
+
+func (r *recordingTB) Helper()           {}
+func (r *recordingTB) Cleanup(fn func()) { r.cleanups = append(r.cleanups, fn) }
+func (r *recordingTB) Errorf(f string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(f, args...))
+}
+
+func (r *recordingTB) finish() {
+	for i := len(r.cleanups) - 1; i >= 0; i-- {
+		r.cleanups[i]()
+	}
+}
+
+func TestCheck_DetectsLeak(t *testing.T) {
+	stop := make(chan struct{})
+	defer close(stop)
+
+	tb := &recordingTB{TB: t}
+	CheckTimeout(tb, 50*time.Millisecond)
+	go func() { <-stop }()
+	tb.finish()
+
+	if len(tb.errors) != 1 {
+		t.Fatalf("expected one leak report, got %v", tb.errors)
+	}
+}
+
+func TestCheck_WaitsForExit(t *testing.T) {
+	tb := &recordingTB{TB: t}
+	CheckTimeout(tb, time.Second)
+	go time.Sleep(20 * time.Millisecond)
+	tb.finish()
+
+	if len(tb.errors) != 0 {
+		t.Fatalf("unexpected leak report: %v", tb.errors)
+	}
+}
+
+func TestCheck_Ignore(t *testing.T) {
+	stop := make(chan struct{})
+	defer close(stop)
+
+	tb := &recordingTB{TB: t}
+	CheckTimeout(tb, 50*time.Millisecond, "leaktest.TestCheck_Ignore.func")
+	go func() { <-stop }()
+	tb.finish()
+
+	if len(tb.errors) != 0 {
+		t.Fatalf("ignored goroutine reported: %v", tb.errors)
+	}
+}
@@ -25,6 +25,8 @@ type FileAuditLogger struct {
 	file       *os.File
 	mu         sync.Mutex
 	logs       []*AuditLog // 内存缓存，用于 Query（生产环境应使用数据库）
+
+	purgedOffset int64 // 累计从文件开头清理的字节数（见 Purge），导出游标为文件偏移加上该值
 }
 
 // NewFileAuditLogger 创建新的文件审计日志记录器
@@ -34,12 +36,21 @@ func NewFileAuditLogger(outputPath string, logger Logger) (*FileAuditLogger, err
 		return nil, fmt.Errorf("open audit log file: %w", err)
 	}
 
-	return &FileAuditLogger{
+	a := &FileAuditLogger{
 		outputPath: outputPath,
 		logger:     logger,
 		file:       f,
 		logs:       make([]*AuditLog, 0),
-	}, nil
+	}
+	reports, err := readPurgeReports(outputPath + auditPurgeSuffix)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if len(reports) > 0 {
+		a.purgedOffset = reports[len(reports)-1].PurgedOffset
+	}
+	return a, nil
 }
 
 // LogAccess 记录访问事件
@@ -170,33 +181,15 @@ func (a *FileAuditLogger) matchFilter(log *AuditLog, filter *AuditFilter) bool {
 	}
 
 	// 索引字段过滤
-	if filter.ClientID != "" {
-		if v, ok := log.Indexed["client_id"].(string); !ok || v != filter.ClientID {
-			return false
-		}
-	}
-	if filter.ServiceID != "" {
-		if v, ok := log.Indexed["service_id"].(string); !ok || v != filter.ServiceID {
-			return false
-		}
-	}
-	if filter.Action != "" {
-		if v, ok := log.Indexed["action"].(string); !ok || v != filter.Action {
-			return false
-		}
-	}
-	if filter.Result != "" {
-		if v, ok := log.Indexed["result"].(string); !ok || v != filter.Result {
-			return false
-		}
-	}
-	if filter.EventType != "" {
-		if v, ok := log.Indexed["event_type"].(SecurityEventType); !ok || v != filter.EventType {
-			return false
-		}
-	}
-	if filter.Severity != "" {
-		if v, ok := log.Indexed["severity"].(Severity); !ok || v != filter.Severity {
+	for key, want := range map[string]string{
+		"client_id":  filter.ClientID,
+		"service_id": filter.ServiceID,
+		"action":     filter.Action,
+		"result":     filter.Result,
+		"event_type": string(filter.EventType),
+		"severity":   string(filter.Severity),
+	} {
+		if want != "" && indexedValue(log, key) != want {
 			return false
 		}
 	}
@@ -204,6 +197,20 @@ func (a *FileAuditLogger) matchFilter(log *AuditLog, filter *AuditFilter) bool {
 	return true
 }
 
+// indexedValue 索引字段的字符串值（内存记录为具体类型，从文件解码的记录为 string）
+func indexedValue(log *AuditLog, key string) string {
+	switch v := log.Indexed[key].(type) {
+	case string:
+		return v
+	case SecurityEventType:
+		return string(v)
+	case Severity:
+		return string(v)
+	default:
+		return ""
+	}
+}
+
 // writeLog 写入审计日志到文件
 func (a *FileAuditLogger) writeLog(log *AuditLog) error {
 	a.mu.Lock()
@@ -0,0 +1,114 @@
+package logging
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+// ErrInvalidCursor 导出游标无效（格式错误或不在记录边界上）
+var ErrInvalidCursor = errors.New("invalid audit export cursor")
+
+// AuditExporter 支持流式导出的审计日志记录器（可选接口，供 SIEM 批量拉取）
+type AuditExporter interface {
+	// Export 从 cursor（空字符串表示起点）之后按写入顺序遍历匹配 filter 的记录并逐条调用 fn，
+	// fn 返回错误时停止并返回该错误。filter.Limit > 0 时最多导出 Limit 条，Offset 被忽略。
+	// 每条记录的 Cursor 可传回 Export 从其后继续（断点续传）
+	Export(ctx context.Context, filter *AuditFilter, cursor string, fn func(rec *AuditExportRecord) error) error
+}
+
+// AuditExportRecord 导出记录：审计日志及其续传游标
+type AuditExportRecord struct {
+	Cursor string `json:"cursor"`
+	*AuditLog
+}
+
+// Export 从审计日志文件流式导出（实现 AuditExporter）
+// 游标为记录结束处的文件偏移（含已清理的字节数），进程重启与清理后仍然有效；
+// 游标指向已清理的记录时从最早的保留记录继续。尚未写完的末行不会导出
+func (a *FileAuditLogger) Export(ctx context.Context, filter *AuditFilter, cursor string, fn func(rec *AuditExportRecord) error) error {
+	if filter == nil {
+		filter = &AuditFilter{}
+	}
+
+	// 打开文件与读取清理偏移须与 Purge 互斥，二者对应同一个文件
+	a.mu.Lock()
+	f, err := os.Open(a.outputPath)
+	base := a.purgedOffset
+	a.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("open audit log file: %w", err)
+	}
+	defer f.Close()
+
+	offset, err := a.seekCursor(f, cursor, base)
+	if err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(f)
+	exported := 0
+	for filter.Limit <= 0 || exported < filter.Limit {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return nil // 不完整的末行留待下次导出
+		}
+		if err != nil {
+			return fmt.Errorf("read audit log: %w", err)
+		}
+		offset += int64(len(line))
+
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		var log AuditLog
+		if err := json.Unmarshal(line, &log); err != nil {
+			a.logger.Warn("Skipping malformed audit log line", "offset", offset, "error", err)
+			continue
+		}
+		if !a.matchFilter(&log, filter) {
+			continue
+		}
+
+		if err := fn(&AuditExportRecord{Cursor: strconv.FormatInt(base+offset, 10), AuditLog: &log}); err != nil {
+			return err
+		}
+		exported++
+	}
+	return nil
+}
+
+// seekCursor 定位到游标处并返回文件偏移，游标必须位于记录边界（文件开头或换行符之后）；
+// base 为已清理的字节数，不大于 base 的游标从文件开头继续
+func (a *FileAuditLogger) seekCursor(f *os.File, cursor string, base int64) (int64, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	offset, err := strconv.ParseInt(cursor, 10, 64)
+	if err != nil || offset < 0 {
+		return 0, ErrInvalidCursor
+	}
+	if offset -= base; offset <= 0 {
+		return 0, nil
+	}
+
+	prev := make([]byte, 1)
+	if _, err := f.ReadAt(prev, offset-1); err != nil || prev[0] != '\n' {
+		return 0, ErrInvalidCursor
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("seek audit log: %w", err)
+	}
+	return offset, nil
+}
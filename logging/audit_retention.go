@@ -0,0 +1,307 @@
+package logging
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// auditPurgeSuffix 清理记录（含汇总）文件后缀，与审计日志文件同目录，不参与清理
+const auditPurgeSuffix = ".purge"
+
+// AuditRetention 审计日志保留策略，零值字段不限制
+type AuditRetention struct {
+	// MaxAge 最长保留时间，早于 now-MaxAge 的记录被清理
+	MaxAge time.Duration `yaml:"max_age" json:"max_age,omitempty"`
+	// MaxSize 审计日志最大字节数，超出时从最早的记录开始清理
+	MaxSize int64 `yaml:"max_size" json:"max_size,omitempty"`
+}
+
+// IsSet 是否配置了任一限制
+func (r AuditRetention) IsSet() bool {
+	return r.MaxAge > 0 || r.MaxSize > 0
+}
+
+// Validate 验证保留策略
+func (r AuditRetention) Validate() error {
+	if r.MaxAge < 0 || r.MaxSize < 0 {
+		return fmt.Errorf("audit retention max_age and max_size must not be negative")
+	}
+	return nil
+}
+
+// AuditPurger 支持按保留策略清理的审计日志记录器（可选接口）
+type AuditPurger interface {
+	// Purge 按 retention 清理最早的记录，被清理的记录按天、事件类型、动作与结果汇总计数后保留；
+	// dryRun 时只返回将被清理的内容，不修改日志
+	Purge(ctx context.Context, retention AuditRetention, dryRun bool) (*AuditPurgeReport, error)
+	// PurgeHistory 返回历次清理的报告（含汇总），按时间顺序
+	PurgeHistory(ctx context.Context) ([]*AuditPurgeReport, error)
+}
+
+// AuditPurgeReport 一次清理的结果
+type AuditPurgeReport struct {
+	DryRun    bool           `json:"dry_run,omitempty"`
+	Time      time.Time      `json:"time"`
+	Retention AuditRetention `json:"retention"`
+	// Cutoff 按 MaxAge 计算的截止时间（未设置 MaxAge 时为零值）
+	Cutoff        time.Time `json:"cutoff,omitempty"`
+	Removed       int       `json:"removed"`
+	RemovedBytes  int64     `json:"removed_bytes"`
+	RetainedBytes int64     `json:"retained_bytes"`
+	// OldestRemoved / NewestRemoved 被清理记录的时间范围
+	OldestRemoved time.Time `json:"oldest_removed,omitempty"`
+	NewestRemoved time.Time `json:"newest_removed,omitempty"`
+	// Summaries 被清理记录的汇总
+	Summaries []*AuditSummary `json:"summaries,omitempty"`
+	// PurgedOffset 累计清理的字节数，导出游标据此在清理后保持有效
+	PurgedOffset int64 `json:"purged_offset"`
+}
+
+// AuditSummary 被清理记录按天（UTC）、事件类型、动作与结果的计数；
+// 安全事件的动作与结果分别为安全事件类型与严重程度
+type AuditSummary struct {
+	Date      string `json:"date"`
+	EventType string `json:"event_type"`
+	Action    string `json:"action,omitempty"`
+	Result    string `json:"result,omitempty"`
+	Count     int    `json:"count"`
+}
+
+// summaryKey 返回记录所属的汇总维度
+func summaryKey(log *AuditLog) AuditSummary {
+	s := AuditSummary{
+		Date:      log.Timestamp.UTC().Format(time.DateOnly),
+		EventType: log.EventType,
+		Action:    indexedValue(log, "action"),
+		Result:    indexedValue(log, "result"),
+	}
+	if log.EventType == "security" {
+		s.Action, s.Result = indexedValue(log, "event_type"), indexedValue(log, "severity")
+	}
+	return s
+}
+
+// Purge 清理审计日志文件开头超出保留策略的记录（实现 AuditPurger）
+// 只清理连续的最早记录（遇到第一条应保留的记录即停止），文件以新文件原子替换；
+// 清理报告追加到 "<审计日志>.purge"，此前的导出游标在清理后仍然有效
+func (a *FileAuditLogger) Purge(ctx context.Context, retention AuditRetention, dryRun bool) (*AuditPurgeReport, error) {
+	if err := retention.Validate(); err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	report := &AuditPurgeReport{DryRun: dryRun, Time: time.Now(), Retention: retention, PurgedOffset: a.purgedOffset}
+	if retention.MaxAge > 0 {
+		report.Cutoff = report.Time.Add(-retention.MaxAge)
+	}
+	if !retention.IsSet() {
+		return report, nil
+	}
+
+	f, err := os.Open(a.outputPath)
+	if err != nil {
+		return nil, fmt.Errorf("open audit log file: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("stat audit log file: %w", err)
+	}
+	size := info.Size()
+
+	firstKept, err := a.scanPurge(ctx, f, size, report)
+	if err != nil {
+		return nil, err
+	}
+	report.RetainedBytes = size - report.RemovedBytes
+	if dryRun || report.RemovedBytes == 0 {
+		report.PurgedOffset += report.RemovedBytes
+		return report, nil
+	}
+
+	if err := a.truncateHead(f, report.RemovedBytes); err != nil {
+		return nil, err
+	}
+	a.purgedOffset += report.RemovedBytes
+	report.PurgedOffset = a.purgedOffset
+	a.pruneCache(firstKept)
+
+	if err := appendPurgeReport(a.outputPath+auditPurgeSuffix, report); err != nil {
+		// 日志已清理，报告写入失败只影响汇总
+		a.logger.Error("Failed to record audit purge summary", "error", err)
+	}
+	return report, nil
+}
+
+// scanPurge 统计开头应清理的记录并汇总，返回第一条保留记录的 ID（全部清理时为空）
+func (a *FileAuditLogger) scanPurge(ctx context.Context, f *os.File, size int64, report *AuditPurgeReport) (string, error) {
+	counts := make(map[AuditSummary]int)
+	defer func() {
+		for key, count := range counts {
+			s := key
+			s.Count = count
+			report.Summaries = append(report.Summaries, &s)
+		}
+		sort.Slice(report.Summaries, func(i, j int) bool {
+			x, y := report.Summaries[i], report.Summaries[j]
+			if x.Date != y.Date {
+				return x.Date < y.Date
+			}
+			if x.EventType != y.EventType {
+				return x.EventType < y.EventType
+			}
+			if x.Action != y.Action {
+				return x.Action < y.Action
+			}
+			return x.Result < y.Result
+		})
+	}()
+
+	reader := bufio.NewReader(f)
+	for {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return "", nil // 未写完的末行不清理
+		}
+		if err != nil {
+			return "", fmt.Errorf("read audit log: %w", err)
+		}
+
+		var log AuditLog
+		trimmed := bytes.TrimSpace(line)
+		malformed := len(trimmed) == 0 || json.Unmarshal(trimmed, &log) != nil
+		oversize := report.Retention.MaxSize > 0 && size-report.RemovedBytes > report.Retention.MaxSize
+		expired := !malformed && !report.Cutoff.IsZero() && log.Timestamp.Before(report.Cutoff)
+		if !malformed && !oversize && !expired {
+			return log.ID, nil
+		}
+
+		report.RemovedBytes += int64(len(line))
+		if malformed {
+			continue // 空行与损坏行随前后的记录一起清理，不计数
+		}
+		report.Removed++
+		if report.OldestRemoved.IsZero() || log.Timestamp.Before(report.OldestRemoved) {
+			report.OldestRemoved = log.Timestamp
+		}
+		if log.Timestamp.After(report.NewestRemoved) {
+			report.NewestRemoved = log.Timestamp
+		}
+		counts[summaryKey(&log)]++
+	}
+}
+
+// truncateHead 以去掉开头 n 字节的新文件替换审计日志，并重新打开写入句柄
+func (a *FileAuditLogger) truncateHead(f *os.File, n int64) error {
+	tmp, err := os.CreateTemp(filepath.Dir(a.outputPath), filepath.Base(a.outputPath)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("create audit log file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := f.Seek(n, io.SeekStart); err != nil {
+		tmp.Close()
+		return fmt.Errorf("seek audit log: %w", err)
+	}
+	if _, err := io.Copy(tmp, f); err != nil {
+		tmp.Close()
+		return fmt.Errorf("copy audit log: %w", err)
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return fmt.Errorf("chmod audit log: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("sync audit log: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close audit log: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), a.outputPath); err != nil {
+		return fmt.Errorf("replace audit log: %w", err)
+	}
+
+	file, err := os.OpenFile(a.outputPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("open audit log file: %w", err)
+	}
+	a.file.Close()
+	a.file = file
+	return nil
+}
+
+// pruneCache 丢弃内存缓存中 firstKept 之前的记录；firstKept 为空表示全部清理，
+// 不在缓存中表示被清理的记录均早于本进程写入
+func (a *FileAuditLogger) pruneCache(firstKept string) {
+	if firstKept == "" {
+		a.logs = a.logs[:0]
+		return
+	}
+	for i, log := range a.logs {
+		if log.ID == firstKept {
+			a.logs = append(a.logs[:0], a.logs[i:]...)
+			return
+		}
+	}
+}
+
+// PurgeHistory 读取历次清理报告（实现 AuditPurger）
+func (a *FileAuditLogger) PurgeHistory(ctx context.Context) ([]*AuditPurgeReport, error) {
+	return readPurgeReports(a.outputPath + auditPurgeSuffix)
+}
+
+// appendPurgeReport 追加一次清理报告
+func appendPurgeReport(path string, report *AuditPurgeReport) error {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// readPurgeReports 读取清理报告文件，文件不存在时返回空
+func readPurgeReports(path string) ([]*AuditPurgeReport, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read audit purge history: %w", err)
+	}
+
+	var reports []*AuditPurgeReport
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if line = bytes.TrimSpace(line); len(line) == 0 {
+			continue
+		}
+		var report AuditPurgeReport
+		if err := json.Unmarshal(line, &report); err != nil {
+			continue // 未写完的报告
+		}
+		reports = append(reports, &report)
+	}
+	return reports, nil
+}
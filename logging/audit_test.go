@@ -2,7 +2,9 @@ package logging
 
 import (
 	"context"
+	"errors"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 )
@@ -369,3 +371,161 @@ func TestSeverityLevels(t *testing.T) {
 		}
 	}
 }
+
+func TestFileAuditLogger_Export(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	logger, _ := NewLogger(&Config{Level: "error", Format: "json", Output: "stdout"})
+	auditLogger, err := NewFileAuditLogger(path, logger)
+	if err != nil {
+		t.Fatalf("Failed to create audit logger: %v", err)
+	}
+	defer auditLogger.Close()
+
+	ctx := context.Background()
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		auditLogger.LogAccess(ctx, &AccessEvent{Timestamp: start.Add(time.Duration(i) * time.Hour), ClientID: "client-1", Action: "tunnel_create", Result: "success"})
+	}
+	auditLogger.LogSecurity(ctx, &SecurityEvent{Timestamp: start.Add(5 * time.Hour), ClientID: "client-2", EventType: EventIdentityConflict, Severity: SeverityHigh})
+
+	export := func(filter *AuditFilter, cursor string) []*AuditExportRecord {
+		t.Helper()
+		var recs []*AuditExportRecord
+		if err := auditLogger.Export(ctx, filter, cursor, func(rec *AuditExportRecord) error {
+			recs = append(recs, rec)
+			return nil
+		}); err != nil {
+			t.Fatalf("Export failed: %v", err)
+		}
+		return recs
+	}
+
+	// 时间范围 + 条数限制，再从游标续传
+	filter := &AuditFilter{StartTime: start.Add(time.Hour), EndTime: start.Add(4 * time.Hour), Limit: 2}
+	first := export(filter, "")
+	if len(first) != 2 || !first[0].Timestamp.Equal(start.Add(time.Hour)) {
+		t.Fatalf("Unexpected first page: %d records", len(first))
+	}
+	rest := export(&AuditFilter{StartTime: filter.StartTime, EndTime: filter.EndTime}, first[1].Cursor)
+	if len(rest) != 2 || !rest[1].Timestamp.Equal(start.Add(4*time.Hour)) {
+		t.Fatalf("Expected 2 records after cursor, got %d", len(rest))
+	}
+
+	// 从文件解码的记录同样可按安全事件类型过滤
+	if recs := export(&AuditFilter{EventType: EventIdentityConflict}, ""); len(recs) != 1 || recs[0].EventType != "security" {
+		t.Errorf("Expected 1 security record, got %d", len(recs))
+	}
+
+	for _, cursor := range []string{"abc", "-1", "3", "999999"} {
+		err := auditLogger.Export(ctx, nil, cursor, func(*AuditExportRecord) error { return nil })
+		if !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("cursor %q: expected ErrInvalidCursor, got %v", cursor, err)
+		}
+	}
+}
+
+func TestFileAuditLogger_Purge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	logger, _ := NewLogger(&Config{Level: "error", Format: "json", Output: "stdout"})
+	auditLogger, err := NewFileAuditLogger(path, logger)
+	if err != nil {
+		t.Fatalf("Failed to create audit logger: %v", err)
+	}
+	defer func() { auditLogger.Close() }()
+
+	ctx := context.Background()
+	now := time.Now()
+	for _, age := range []time.Duration{50 * time.Hour, 49 * time.Hour, 26 * time.Hour, 2 * time.Hour, time.Hour} {
+		auditLogger.LogAccess(ctx, &AccessEvent{Timestamp: now.Add(-age), ClientID: "client-1", Action: "tunnel_create", Result: "success"})
+	}
+	auditLogger.LogSecurity(ctx, &SecurityEvent{Timestamp: now.Add(-30 * time.Minute), ClientID: "client-2", EventType: EventIdentityConflict, Severity: SeverityHigh})
+
+	export := func(cursor string) []*AuditExportRecord {
+		t.Helper()
+		var recs []*AuditExportRecord
+		if err := auditLogger.Export(ctx, nil, cursor, func(rec *AuditExportRecord) error {
+			recs = append(recs, rec)
+			return nil
+		}); err != nil {
+			t.Fatalf("Export failed: %v", err)
+		}
+		return recs
+	}
+	before := export("")
+	sizeBefore, _ := os.Stat(path)
+
+	// dry-run 只报告，不修改文件
+	retention := AuditRetention{MaxAge: 24 * time.Hour}
+	report, err := auditLogger.Purge(ctx, retention, true)
+	if err != nil {
+		t.Fatalf("Purge dry-run failed: %v", err)
+	}
+	if !report.DryRun || report.Removed != 3 {
+		t.Fatalf("Expected dry-run removing 3 records, got %+v", report)
+	}
+	total := 0
+	for _, s := range report.Summaries {
+		if s.EventType != "access" || s.Action != "tunnel_create" || s.Result != "success" {
+			t.Errorf("Unexpected summary %+v", s)
+		}
+		total += s.Count
+	}
+	if total != 3 {
+		t.Errorf("Expected summaries to count 3 records, got %d", total)
+	}
+	if info, _ := os.Stat(path); info.Size() != sizeBefore.Size() {
+		t.Fatal("Dry-run must not modify the audit log")
+	}
+
+	report, err = auditLogger.Purge(ctx, retention, false)
+	if err != nil {
+		t.Fatalf("Purge failed: %v", err)
+	}
+	if report.Removed != 3 || report.PurgedOffset != report.RemovedBytes || report.RetainedBytes+report.RemovedBytes != sizeBefore.Size() {
+		t.Fatalf("Unexpected purge report %+v", report)
+	}
+
+	// 清理前的游标继续有效；指向已清理记录的游标从最早的保留记录继续
+	if recs := export(before[3].Cursor); len(recs) != 2 || recs[0].Cursor != before[4].Cursor {
+		t.Errorf("Expected 2 records after pre-purge cursor, got %d", len(recs))
+	}
+	if recs := export(before[0].Cursor); len(recs) != 3 || recs[0].Cursor != before[3].Cursor {
+		t.Errorf("Expected purged cursor to resume at the oldest retained record, got %d records", len(recs))
+	}
+	if logs, _ := auditLogger.Query(ctx, nil); len(logs) != 3 {
+		t.Errorf("Expected 3 cached records after purge, got %d", len(logs))
+	}
+
+	// 清理后继续写入，重新打开后游标与清理记录保留
+	auditLogger.LogAccess(ctx, &AccessEvent{ClientID: "client-3", Action: "handshake", Result: "success"})
+	auditLogger.Close()
+	auditLogger, err = NewFileAuditLogger(path, logger)
+	if err != nil {
+		t.Fatalf("Failed to reopen audit logger: %v", err)
+	}
+	if recs := export(before[5].Cursor); len(recs) != 1 || recs[0].Data.(map[string]interface{})["client_id"] != "client-3" {
+		t.Errorf("Expected the record written after purge, got %d records", len(recs))
+	}
+	history, err := auditLogger.PurgeHistory(ctx)
+	if err != nil || len(history) != 1 || history[0].Removed != 3 || len(history[0].Summaries) == 0 {
+		t.Fatalf("Expected 1 purge report with summaries, got %d (%v)", len(history), err)
+	}
+
+	// 按大小清理：超出上限的记录全部清理
+	last := export("")
+	info, _ := os.Stat(path)
+	report, err = auditLogger.Purge(ctx, AuditRetention{MaxSize: 1}, false)
+	if err != nil {
+		t.Fatalf("Purge by size failed: %v", err)
+	}
+	if report.Removed != len(last) || report.RetainedBytes != 0 || report.RemovedBytes != info.Size() {
+		t.Errorf("Expected all %d records purged, got %+v", len(last), report)
+	}
+	if recs := export(""); len(recs) != 0 {
+		t.Errorf("Expected empty audit log, got %d records", len(recs))
+	}
+
+	if _, err := auditLogger.Purge(ctx, AuditRetention{MaxAge: -time.Hour}, true); err == nil {
+		t.Error("Expected negative retention to be rejected")
+	}
+}
@@ -48,6 +48,7 @@ type SecurityEventType string
 const (
 	EventCertInvalid        SecurityEventType = "cert_invalid"
 	EventCertExpired        SecurityEventType = "cert_expired"
+	EventCertExpiring       SecurityEventType = "cert_expiring"
 	EventCertRevoked        SecurityEventType = "cert_revoked"
 	EventSessionExpired     SecurityEventType = "session_expired"
 	EventSessionRevoked     SecurityEventType = "session_revoked"
@@ -56,6 +57,9 @@ const (
 	EventPolicyViolation    SecurityEventType = "policy_violation"
 	EventAnomalousActivity  SecurityEventType = "anomalous_activity"
 	EventBruteForceAttempt  SecurityEventType = "brute_force_attempt"
+	EventIdentityConflict   SecurityEventType = "identity_conflict"
+	EventUsageThreshold     SecurityEventType = "usage_threshold_exceeded"
+	EventDevicePostureDrift SecurityEventType = "device_posture_drift"
 )
 
 // Severity 严重程度
@@ -0,0 +1,175 @@
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrInvalidCondition 策略条件未注册或操作符/值不合法（保存策略时返回）
+var ErrInvalidCondition = errors.New("invalid policy condition")
+
+// ConditionFunc 条件评估函数，返回请求是否满足条件
+type ConditionFunc func(cond *Condition, evalCtx *EvalContext) (bool, error)
+
+// ConditionValidator 条件校验函数，保存策略时检查操作符与值（如 CIDR、时间格式）
+type ConditionValidator func(cond *Condition) error
+
+// conditionPlugin 已注册的条件类型
+type conditionPlugin struct {
+	evaluate ConditionFunc
+	validate ConditionValidator
+}
+
+var (
+	conditionMu sync.RWMutex
+	conditions  = map[string]conditionPlugin{}
+)
+
+// RegisterCondition 注册条件类型（同名覆盖，可替换内置类型），供 DefaultEvaluator 评估
+// validate 可为 nil，此时保存策略只检查类型已注册
+//
+//	policy.RegisterCondition("network_zone", func(cond *policy.Condition, evalCtx *policy.EvalContext) (bool, error) {
+//	    zones, err := cond.StringListValue()
+//	    ...
+//	}, nil)
+func RegisterCondition(conditionType string, evaluate ConditionFunc, validate ConditionValidator) {
+	if conditionType == "" || evaluate == nil {
+		panic("policy: RegisterCondition requires a type and an evaluate func")
+	}
+	conditionMu.Lock()
+	defer conditionMu.Unlock()
+	conditions[conditionType] = conditionPlugin{evaluate: evaluate, validate: validate}
+}
+
+// RegisteredConditions 已注册的条件类型（排序）
+func RegisteredConditions() []string {
+	conditionMu.RLock()
+	defer conditionMu.RUnlock()
+	types := make([]string, 0, len(conditions))
+	for t := range conditions {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// lookupCondition 按类型查找已注册的条件
+func lookupCondition(conditionType string) (conditionPlugin, bool) {
+	conditionMu.RLock()
+	defer conditionMu.RUnlock()
+	plugin, ok := conditions[conditionType]
+	return plugin, ok
+}
+
+// ValidateConditions 校验条件列表：类型必须已注册，并通过该类型的 Validate
+// 返回的错误包装 ErrInvalidCondition
+func ValidateConditions(conds []*Condition) error {
+	for i, cond := range conds {
+		if cond == nil {
+			return fmt.Errorf("%w: condition %d is empty", ErrInvalidCondition, i)
+		}
+		plugin, ok := lookupCondition(cond.Type)
+		if !ok {
+			return fmt.Errorf("%w: unsupported condition type: %s", ErrInvalidCondition, cond.Type)
+		}
+		if plugin.validate == nil {
+			continue
+		}
+		if err := plugin.validate(cond); err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrInvalidCondition, cond.Type, err)
+		}
+	}
+	return nil
+}
+
+// StringValue 条件值作为字符串
+func (c *Condition) StringValue() (string, error) {
+	s, ok := c.Value.(string)
+	if !ok {
+		return "", fmt.Errorf("value must be a string, got %T", c.Value)
+	}
+	return s, nil
+}
+
+// StringListValue 条件值作为字符串数组（接受 []string 与 JSON 解码得到的 []interface{}）
+func (c *Condition) StringListValue() ([]string, error) {
+	switch v := c.Value.(type) {
+	case []string:
+		return v, nil
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("value must be a string array, got element %T", item)
+			}
+			list = append(list, s)
+		}
+		return list, nil
+	default:
+		return nil, fmt.Errorf("value must be a string array, got %T", c.Value)
+	}
+}
+
+// BoolValue 条件值作为布尔值
+func (c *Condition) BoolValue() (bool, error) {
+	b, ok := c.Value.(bool)
+	if !ok {
+		return false, fmt.Errorf("value must be a bool, got %T", c.Value)
+	}
+	return b, nil
+}
+
+// NumberValue 条件值作为数值（JSON 数字解码为 float64，代码中构造的策略可用整数）
+func (c *Condition) NumberValue() (float64, error) {
+	switch v := c.Value.(type) {
+	case float64:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case json.Number:
+		return v.Float64()
+	default:
+		return 0, fmt.Errorf("value must be a number, got %T", c.Value)
+	}
+}
+
+// DurationValue 条件值作为时长：字符串按 time.ParseDuration 解析（如 "72h"），数值按秒
+func (c *Condition) DurationValue() (time.Duration, error) {
+	if s, ok := c.Value.(string); ok {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q: %w", s, err)
+		}
+		return d, nil
+	}
+	seconds, err := c.NumberValue()
+	if err != nil {
+		return 0, fmt.Errorf("value must be a duration string or seconds, got %T", c.Value)
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// listValue 条件值作为任意元素数组
+func (c *Condition) listValue() ([]interface{}, bool) {
+	switch v := c.Value.(type) {
+	case []interface{}:
+		return v, true
+	case []string:
+		list := make([]interface{}, len(v))
+		for i, s := range v {
+			list[i] = s
+		}
+		return list, true
+	default:
+		return nil, false
+	}
+}
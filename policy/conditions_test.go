@@ -0,0 +1,112 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRegisterCondition(t *testing.T) {
+	RegisterCondition("network_zone", func(cond *Condition, evalCtx *EvalContext) (bool, error) {
+		zones, err := cond.StringListValue()
+		if err != nil {
+			return false, err
+		}
+		zone := evalCtx.Request.DeviceInfo.Attributes["network_zone"]
+		for _, z := range zones {
+			if z == zone {
+				return true, nil
+			}
+		}
+		return false, nil
+	}, func(cond *Condition) error {
+		if cond.Operator != "in" {
+			return errors.New("only in is supported")
+		}
+		_, err := cond.StringListValue()
+		return err
+	})
+
+	policy := &Policy{
+		PolicyID:   "policy-zone",
+		Conditions: []*Condition{{Type: "network_zone", Operator: "in", Value: []interface{}{"corp"}}},
+	}
+	evalCtx := &EvalContext{
+		Request:   &AccessRequest{DeviceInfo: &DeviceInfo{Attributes: map[string]string{"network_zone": "corp"}}},
+		Timestamp: time.Now(),
+	}
+	allowed, err := NewDefaultEvaluator().Evaluate(context.Background(), policy, evalCtx)
+	if err != nil || !allowed {
+		t.Fatalf("expected custom condition to allow, got %v, %v", allowed, err)
+	}
+
+	evalCtx.Request.DeviceInfo.Attributes["network_zone"] = "guest"
+	if allowed, _ := NewDefaultEvaluator().Evaluate(context.Background(), policy, evalCtx); allowed {
+		t.Error("expected custom condition to deny other zones")
+	}
+}
+
+func TestValidateConditionsOnSave(t *testing.T) {
+	storage, err := NewDBStorage(setupTestDB(t))
+	if err != nil {
+		t.Fatalf("NewDBStorage failed: %v", err)
+	}
+	engine, err := NewEngine(&Config{Storage: storage, Logger: &mockLogger{}})
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	ctx := context.Background()
+
+	invalid := []*Condition{
+		{Type: "vuln_scan_age", Operator: "lt", Value: "72h"}, // 未注册
+		{Type: "device_os", Operator: "gt", Value: "linux"},
+		{Type: "device_compliance", Operator: "eq", Value: "yes"},
+		{Type: "source_ip", Operator: "in", Value: []interface{}{"10.0.0.0/33"}},
+		{Type: "time_range", Operator: "between", Value: []interface{}{"2026-01-02T00:00:00Z", "2026-01-01T00:00:00Z"}},
+	}
+	for _, cond := range invalid {
+		err := engine.SavePolicy(ctx, &Policy{PolicyID: "p-" + cond.Type, ClientID: "c1", ServiceID: "s1", Conditions: []*Condition{cond}})
+		if !errors.Is(err, ErrInvalidCondition) {
+			t.Errorf("%s/%s: expected ErrInvalidCondition, got %v", cond.Type, cond.Operator, err)
+		}
+	}
+	if policies, _ := engine.ListPolicies(ctx, nil); len(policies) != 0 {
+		t.Errorf("expected no policy saved, got %d", len(policies))
+	}
+
+	// 批量加载时任一策略非法则全部拒绝
+	err = engine.LoadPolicies(ctx, []*Policy{
+		{PolicyID: "ok", ClientID: "c1", ServiceID: "s1", Conditions: []*Condition{{Type: "device_os", Operator: "in", Value: []string{"linux"}}}},
+		{PolicyID: "bad", ClientID: "c1", ServiceID: "s1", Conditions: []*Condition{{Type: "geo_location", Operator: "in", Value: "CN"}}},
+	})
+	if !errors.Is(err, ErrInvalidCondition) {
+		t.Errorf("expected ErrInvalidCondition, got %v", err)
+	}
+
+	valid := &Policy{PolicyID: "p-valid", ClientID: "c1", ServiceID: "s1", Conditions: []*Condition{
+		{Type: "device_os", Operator: "in", Value: []interface{}{"linux", "darwin"}},
+		{Type: "source_ip", Operator: "not_in", Value: []string{"203.0.113.7", "10.0.0.0/8"}},
+	}}
+	if err := engine.SavePolicy(ctx, valid); err != nil {
+		t.Errorf("SavePolicy failed: %v", err)
+	}
+}
+
+func TestConditionValueHelpers(t *testing.T) {
+	if d, err := (&Condition{Value: "72h"}).DurationValue(); err != nil || d != 72*time.Hour {
+		t.Errorf("DurationValue string: %v, %v", d, err)
+	}
+	if d, err := (&Condition{Value: float64(90)}).DurationValue(); err != nil || d != 90*time.Second {
+		t.Errorf("DurationValue seconds: %v, %v", d, err)
+	}
+	if n, err := (&Condition{Value: 3}).NumberValue(); err != nil || n != 3 {
+		t.Errorf("NumberValue: %v, %v", n, err)
+	}
+	if _, err := (&Condition{Value: []interface{}{"a", 1}}).StringListValue(); err == nil {
+		t.Error("expected error for mixed list")
+	}
+	if _, err := (&Condition{Value: "true"}).BoolValue(); err == nil {
+		t.Error("expected error for string bool")
+	}
+}
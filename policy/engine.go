@@ -1,11 +1,16 @@
 package policy
 
 import (
+	"cmp"
 	"context"
 	"fmt"
+	"slices"
+	"sync"
 	"time"
 
+	"github.com/houzhh15/sdp-common/clock"
 	"github.com/houzhh15/sdp-common/logging"
+	"github.com/houzhh15/sdp-common/qos"
 )
 
 // Engine 策略引擎（扩展原 Engine，分离关注点）
@@ -13,13 +18,44 @@ type Engine struct {
 	storage   Storage   // 存储接口
 	evaluator Evaluator // 评估接口
 	logger    logging.Logger
+	clock     clock.Clock // 策略有效期与时间条件的参考时钟
+
+	defaultDecision  DefaultDecision
+	serviceDefaults  map[string]DefaultDecision
+	evaluationBudget time.Duration
+	clockSkew        time.Duration
+	stats            *evalStats // 按策略的评估次数与耗时
+
+	mu       sync.RWMutex
+	onChange ChangeHandler // 策略变更通知（如推送给 IH）
 }
 
+// 策略变更类型
+const (
+	ChangeSaved   = "saved"
+	ChangeDeleted = "deleted"
+)
+
+// ChangeHandler 策略变更回调（ChangeSaved / ChangeDeleted）
+type ChangeHandler func(change string, policy *Policy)
+
 // Config 引擎配置
 type Config struct {
 	Storage   Storage
 	Evaluator Evaluator
 	Logger    logging.Logger
+	Clock     clock.Clock // 默认真实时钟；测试可注入 clock.NewFake
+
+	// DefaultDecision 客户端对服务没有任何适用策略时的决策，默认 deny
+	DefaultDecision DefaultDecision
+	// ServiceDefaults 按服务覆盖 DefaultDecision（key: ServiceID）
+	ServiceDefaults map[string]DefaultDecision
+
+	// EvaluationBudget 单次策略评估耗时预算，超过时记录告警并计入慢评估，默认 DefaultEvaluationBudget，负数关闭告警
+	EvaluationBudget time.Duration
+
+	// ClockSkewTolerance time_range 条件边界两侧的宽限，容忍请求时间戳与服务器时钟的偏差，默认 0
+	ClockSkewTolerance time.Duration
 }
 
 // NewEngine 创建策略引擎（重构原 NewEngine，支持依赖注入）
@@ -30,19 +66,69 @@ func NewEngine(cfg *Config) (*Engine, error) {
 	if cfg.Evaluator == nil {
 		cfg.Evaluator = NewDefaultEvaluator()
 	}
+	if err := cfg.DefaultDecision.Validate(); err != nil {
+		return nil, err
+	}
+	for serviceID, decision := range cfg.ServiceDefaults {
+		if err := decision.Validate(); err != nil {
+			return nil, fmt.Errorf("service %s: %w", serviceID, err)
+		}
+	}
+	if cfg.ClockSkewTolerance < 0 {
+		return nil, fmt.Errorf("clock skew tolerance must not be negative")
+	}
+	budget := cfg.EvaluationBudget
+	if budget == 0 {
+		budget = DefaultEvaluationBudget
+	}
 
 	return &Engine{
-		storage:   cfg.Storage,
-		evaluator: cfg.Evaluator,
-		logger:    cfg.Logger,
+		storage:          cfg.Storage,
+		evaluator:        cfg.Evaluator,
+		logger:           cfg.Logger,
+		clock:            clock.Or(cfg.Clock),
+		defaultDecision:  cfg.DefaultDecision,
+		serviceDefaults:  cfg.ServiceDefaults,
+		evaluationBudget: budget,
+		clockSkew:        cfg.ClockSkewTolerance,
+		stats:            newEvalStats(),
 	}, nil
 }
 
+// DefaultDecisionFor 服务的默认决策（服务覆盖优先，其次引擎默认值，均未设置时为 deny）
+func (e *Engine) DefaultDecisionFor(serviceID string) DefaultDecision {
+	if decision, ok := e.serviceDefaults[serviceID]; ok && decision != "" {
+		return decision
+	}
+	if e.defaultDecision != "" {
+		return e.defaultDecision
+	}
+	return DefaultDeny
+}
+
+// OnChange 注册策略变更回调（保存、批量加载、删除后调用）
+func (e *Engine) OnChange(handler ChangeHandler) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.onChange = handler
+}
+
+// notifyChange 调用策略变更回调
+func (e *Engine) notifyChange(change string, policy *Policy) {
+	e.mu.RLock()
+	handler := e.onChange
+	e.mu.RUnlock()
+	if handler != nil {
+		handler(change, policy)
+	}
+}
+
 // GetPoliciesForClient 获取客户端的策略列表（复用 Engine.GetPolicies 逻辑）
 func (e *Engine) GetPoliciesForClient(ctx context.Context, clientID string) ([]*Policy, error) {
 	filter := &PolicyFilter{
 		ClientID: clientID,
 		Active:   true, // 仅返回有效策略
+		ActiveAt: e.clock.Now(),
 	}
 
 	policies, err := e.storage.QueryPolicies(ctx, filter)
@@ -66,31 +152,35 @@ func (e *Engine) EvaluateAccess(ctx context.Context, req *AccessRequest) (*Acces
 		return nil, fmt.Errorf("get policies: %w", err)
 	}
 
-	if len(policies) == 0 {
-		return &AccessDecision{
-			Allowed: false,
-			Reason:  "no policy found for client",
-		}, nil
-	}
-
 	// 2. 构造评估上下文
 	evalCtx := &EvalContext{
-		Request:   req,
-		Timestamp: req.Timestamp,
+		Request:            req,
+		Timestamp:          req.Timestamp,
+		ClockSkewTolerance: e.clockSkew,
 	}
 	if evalCtx.Timestamp.IsZero() {
-		evalCtx.Timestamp = time.Now()
+		evalCtx.Timestamp = e.clock.Now()
 	}
 
-	// 3. 遍历策略，找到第一个匹配的
-	for _, policy := range policies {
+	// 3. 按优先级依次评估：任一匹配的 deny 策略直接拒绝，否则取优先级最高的匹配 allow 策略
+	// deny 策略只是 allow/默认决策之上的例外，不计入适用策略
+	var matched *Policy
+	applicable := 0
+	for _, policy := range sortPolicies(policies) {
 		// 检查 ServiceID 匹配
 		if policy.ServiceID != req.ServiceID {
 			continue
 		}
+		if !policy.IsDeny() {
+			applicable++
+			// 已有匹配的 allow 时只需继续检查 deny 策略
+			if matched != nil {
+				continue
+			}
+		}
 
 		// 评估策略
-		allowed, err := e.evaluator.Evaluate(ctx, policy, evalCtx)
+		ok, err := e.evaluate(ctx, policy, evalCtx)
 		if err != nil {
 			e.logError("Evaluate policy failed", err, map[string]interface{}{
 				"policy_id": policy.PolicyID,
@@ -98,49 +188,172 @@ func (e *Engine) EvaluateAccess(ctx context.Context, req *AccessRequest) (*Acces
 			})
 			continue
 		}
+		if !ok {
+			continue
+		}
 
-		if allowed {
-			// 策略匹配，允许访问
-			decision := &AccessDecision{
-				Allowed: true,
-				Reason:  "policy matched",
-				Policy:  policy,
-				Constraints: &AccessConstraints{
-					BandwidthLimit:   policy.BandwidthLimit,
-					ConcurrencyLimit: policy.ConcurrencyLimit,
-					ExpiresAt:        policy.ExpiryTime,
-				},
-			}
-
-			e.logInfo("Access granted", map[string]interface{}{
+		if policy.IsDeny() {
+			e.logInfo("Access denied", map[string]interface{}{
 				"client_id":  req.ClientID,
 				"service_id": req.ServiceID,
 				"policy_id":  policy.PolicyID,
+				"reason":     "explicit deny",
 			})
+			return &AccessDecision{
+				Allowed: false,
+				Reason:  ReasonDeniedByPolicy,
+				Policy:  policy,
+			}, nil
+		}
+		matched = policy
+	}
+
+	if matched != nil {
+		// 策略匹配，允许访问
+		decision := &AccessDecision{
+			Allowed: true,
+			Reason:  ReasonPolicyMatched,
+			Policy:  matched,
+			Constraints: &AccessConstraints{
+				BandwidthLimit:   matched.BandwidthLimit,
+				ConcurrencyLimit: matched.ConcurrencyLimit,
+				ExpiresAt:        matched.ExpiryTime,
+				RequireE2E:       matched.RequireE2E,
+				QoSClass:         matched.QoSClass,
+				ReverseForward:   matched.ReverseForward,
+				Obfuscate:        matched.Obfuscate,
+			},
+		}
+
+		e.logInfo("Access granted", map[string]interface{}{
+			"client_id":  req.ClientID,
+			"service_id": req.ServiceID,
+			"policy_id":  matched.PolicyID,
+		})
+
+		return decision, nil
+	}
+
+	// 存在适用的 allow 策略但均未满足：由策略拒绝，不受默认决策影响
+	if applicable > 0 {
+		e.logInfo("Access denied", map[string]interface{}{
+			"client_id":  req.ClientID,
+			"service_id": req.ServiceID,
+			"reason":     ReasonDeniedByPolicy,
+			"policies":   applicable,
+		})
+		return &AccessDecision{
+			Allowed: false,
+			Reason:  ReasonDeniedByPolicy,
+		}, nil
+	}
 
-			return decision, nil
+	// 没有适用策略：按服务/引擎默认决策
+	// 默认允许时，已过期的 allow 策略仍视为适用，避免策略到期后反而放行
+	if e.DefaultDecisionFor(req.ServiceID) == DefaultAllow {
+		expired, err := e.storage.QueryPolicies(ctx, &PolicyFilter{ClientID: req.ClientID, ServiceID: req.ServiceID})
+		if err != nil {
+			return nil, fmt.Errorf("query policies: %w", err)
 		}
+		if slices.ContainsFunc(expired, func(p *Policy) bool { return !p.IsDeny() }) {
+			e.logInfo("Access denied", map[string]interface{}{
+				"client_id":  req.ClientID,
+				"service_id": req.ServiceID,
+				"reason":     ReasonDeniedByPolicy,
+				"expired":    len(expired),
+			})
+			return &AccessDecision{
+				Allowed: false,
+				Reason:  ReasonDeniedByPolicy,
+			}, nil
+		}
+
+		e.logInfo("Access granted", map[string]interface{}{
+			"client_id":  req.ClientID,
+			"service_id": req.ServiceID,
+			"reason":     ReasonAllowedByDefault,
+		})
+		return &AccessDecision{
+			Allowed: true,
+			Reason:  ReasonAllowedByDefault,
+			Default: true,
+		}, nil
 	}
 
-	// 没有匹配的策略
 	e.logInfo("Access denied", map[string]interface{}{
 		"client_id":  req.ClientID,
 		"service_id": req.ServiceID,
-		"reason":     "no matching policy",
+		"reason":     ReasonDeniedByDefault,
 	})
 
 	return &AccessDecision{
 		Allowed: false,
-		Reason:  "no matching policy",
+		Reason:  ReasonDeniedByDefault,
+		Default: true,
 	}, nil
 }
 
-// LoadPolicies 批量加载策略（新增）
+// sortPolicies 按评估顺序排序（Priority 降序，相同优先级按 PolicyID 升序），不修改入参
+func sortPolicies(policies []*Policy) []*Policy {
+	sorted := slices.Clone(policies)
+	slices.SortStableFunc(sorted, func(a, b *Policy) int {
+		if c := cmp.Compare(b.Priority, a.Priority); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.PolicyID, b.PolicyID)
+	})
+	return sorted
+}
+
+// evaluate 评估单条策略并记录耗时，超过 EvaluationBudget 时告警
+// 返回策略条件是否满足；统计结果中命中的 deny 策略与未命中的策略均记为 denied
+func (e *Engine) evaluate(ctx context.Context, policy *Policy, evalCtx *EvalContext) (bool, error) {
+	start := time.Now()
+	matched, err := e.evaluator.Evaluate(ctx, policy, evalCtx)
+	elapsed := time.Since(start)
+
+	result := "denied"
+	if err != nil {
+		result = "error"
+	} else if matched && !policy.IsDeny() {
+		result = "allowed"
+	}
+	slow := e.evaluationBudget > 0 && elapsed > e.evaluationBudget
+	if slow {
+		e.logWarn("Slow policy evaluation", map[string]interface{}{
+			"policy_id":  policy.PolicyID,
+			"client_id":  policy.ClientID,
+			"service_id": policy.ServiceID,
+			"elapsed_ms": durationMs(elapsed),
+			"budget_ms":  durationMs(e.evaluationBudget),
+		})
+	}
+	e.stats.record(policy.PolicyID, result, elapsed, slow, start)
+
+	return matched, err
+}
+
+// SlowestPolicies 按平均评估耗时降序返回前 n 条策略的统计（n <= 0 返回全部）
+// 统计自进程启动起累计，删除策略时清除
+func (e *Engine) SlowestPolicies(n int) []*PolicyStats {
+	return e.stats.slowest(n)
+}
+
+// EvaluationBudget 单次策略评估耗时预算（<= 0 表示不告警）
+func (e *Engine) EvaluationBudget() time.Duration {
+	return e.evaluationBudget
+}
+
+// LoadPolicies 批量加载策略（单个事务，失败时不留下部分结果）
 func (e *Engine) LoadPolicies(ctx context.Context, policies []*Policy) error {
+	if err := validatePolicies(policies); err != nil {
+		return err
+	}
+	if err := e.storage.SavePolicies(ctx, policies); err != nil {
+		return fmt.Errorf("save policies: %w", err)
+	}
 	for _, policy := range policies {
-		if err := e.storage.SavePolicy(ctx, policy); err != nil {
-			return fmt.Errorf("save policy %s: %w", policy.PolicyID, err)
-		}
+		e.notifyChange(ChangeSaved, policy)
 	}
 
 	e.logInfo("Policies loaded", map[string]interface{}{
@@ -150,13 +363,61 @@ func (e *Engine) LoadPolicies(ctx context.Context, policies []*Policy) error {
 	return nil
 }
 
+// ReplaceClientPolicies 原子替换客户端的全部策略（导入/同步）
+// 不在新集合中的旧策略发送 ChangeDeleted，新集合中的策略发送 ChangeSaved
+func (e *Engine) ReplaceClientPolicies(ctx context.Context, clientID string, policies []*Policy) error {
+	if err := validatePolicies(policies); err != nil {
+		return err
+	}
+
+	// 替换前读取旧策略，变更通知需要被移除的策略
+	previous, err := e.storage.QueryPolicies(ctx, &PolicyFilter{ClientID: clientID})
+	if err != nil {
+		return fmt.Errorf("query policies: %w", err)
+	}
+
+	now := e.clock.Now()
+	kept := make(map[string]bool, len(policies))
+	for _, policy := range policies {
+		if policy.CreatedAt.IsZero() {
+			policy.CreatedAt = now
+		}
+		policy.UpdatedAt = now
+		kept[policy.PolicyID] = true
+	}
+
+	if err := e.storage.ReplaceAllForClient(ctx, clientID, policies); err != nil {
+		return fmt.Errorf("replace policies: %w", err)
+	}
+
+	e.logInfo("Client policies replaced", map[string]interface{}{
+		"client_id": clientID,
+		"previous":  len(previous),
+		"count":     len(policies),
+	})
+	for _, policy := range previous {
+		if !kept[policy.PolicyID] {
+			e.notifyChange(ChangeDeleted, policy)
+		}
+	}
+	for _, policy := range policies {
+		e.notifyChange(ChangeSaved, policy)
+	}
+
+	return nil
+}
+
 // SavePolicy 保存策略
 func (e *Engine) SavePolicy(ctx context.Context, policy *Policy) error {
+	if err := validatePolicies([]*Policy{policy}); err != nil {
+		return err
+	}
+
 	// 设置时间戳
 	if policy.CreatedAt.IsZero() {
-		policy.CreatedAt = time.Now()
+		policy.CreatedAt = e.clock.Now()
 	}
-	policy.UpdatedAt = time.Now()
+	policy.UpdatedAt = e.clock.Now()
 
 	if err := e.storage.SavePolicy(ctx, policy); err != nil {
 		return fmt.Errorf("save policy: %w", err)
@@ -166,10 +427,27 @@ func (e *Engine) SavePolicy(ctx context.Context, policy *Policy) error {
 		"policy_id": policy.PolicyID,
 		"client_id": policy.ClientID,
 	})
+	e.notifyChange(ChangeSaved, policy)
 
 	return nil
 }
 
+// validatePolicies 保存前校验策略效果与条件（未注册的类型或非法值拒绝保存，避免评估时才失败）
+func validatePolicies(policies []*Policy) error {
+	for _, policy := range policies {
+		if err := policy.Effect.Validate(); err != nil {
+			return fmt.Errorf("policy %s: %w", policy.PolicyID, err)
+		}
+		if err := ValidateConditions(policy.Conditions); err != nil {
+			return fmt.Errorf("policy %s: %w", policy.PolicyID, err)
+		}
+		if err := qos.ValidateClass(policy.QoSClass); err != nil {
+			return fmt.Errorf("policy %s: %w", policy.PolicyID, err)
+		}
+	}
+	return nil
+}
+
 // GetPolicy 获取策略
 func (e *Engine) GetPolicy(ctx context.Context, policyID string) (*Policy, error) {
 	policy, err := e.storage.GetPolicy(ctx, policyID)
@@ -180,19 +458,113 @@ func (e *Engine) GetPolicy(ctx context.Context, policyID string) (*Policy, error
 	return policy, nil
 }
 
-// DeletePolicy 删除策略
+// ListPolicies 按过滤条件列出策略（filter 为 nil 时返回全部）
+func (e *Engine) ListPolicies(ctx context.Context, filter *PolicyFilter) ([]*Policy, error) {
+	if filter == nil {
+		filter = &PolicyFilter{}
+	}
+
+	policies, err := e.storage.QueryPolicies(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("query policies: %w", err)
+	}
+
+	return policies, nil
+}
+
+// DeletePolicy 删除策略（移入回收站，可通过 RestorePolicy 恢复）
 func (e *Engine) DeletePolicy(ctx context.Context, policyID string) error {
+	// 删除前读取策略，变更通知需要 ClientID
+	existing, _ := e.storage.GetPolicy(ctx, policyID)
+
 	if err := e.storage.DeletePolicy(ctx, policyID); err != nil {
 		return fmt.Errorf("delete policy: %w", err)
 	}
 
+	e.stats.forget(policyID)
 	e.logInfo("Policy deleted", map[string]interface{}{
 		"policy_id": policyID,
 	})
+	if existing != nil {
+		e.notifyChange(ChangeDeleted, existing)
+	}
+
+	return nil
+}
+
+// DeletePolicies 批量删除策略（单个事务，任一不存在则不删除任何策略）
+func (e *Engine) DeletePolicies(ctx context.Context, policyIDs []string) error {
+	// 删除前读取策略，变更通知需要 ClientID
+	existing := make([]*Policy, 0, len(policyIDs))
+	for _, policyID := range policyIDs {
+		if policy, err := e.storage.GetPolicy(ctx, policyID); err == nil {
+			existing = append(existing, policy)
+		}
+	}
+
+	if err := e.storage.DeletePolicies(ctx, policyIDs); err != nil {
+		return fmt.Errorf("delete policies: %w", err)
+	}
+
+	for _, policyID := range policyIDs {
+		e.stats.forget(policyID)
+	}
+	e.logInfo("Policies deleted", map[string]interface{}{
+		"count": len(policyIDs),
+	})
+	for _, policy := range existing {
+		e.notifyChange(ChangeDeleted, policy)
+	}
 
 	return nil
 }
 
+// ListDeletedPolicies 列出回收站中的策略
+func (e *Engine) ListDeletedPolicies(ctx context.Context) ([]*Policy, error) {
+	policies, err := e.storage.ListDeletedPolicies(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list deleted policies: %w", err)
+	}
+	return policies, nil
+}
+
+// RestorePolicy 从回收站恢复策略，恢复后重新参与评估
+func (e *Engine) RestorePolicy(ctx context.Context, policyID string) (*Policy, error) {
+	policy, err := e.storage.RestorePolicy(ctx, policyID)
+	if err != nil {
+		return nil, fmt.Errorf("restore policy: %w", err)
+	}
+
+	e.logInfo("Policy restored", map[string]interface{}{
+		"policy_id": policyID,
+		"client_id": policy.ClientID,
+	})
+	e.notifyChange(ChangeSaved, policy)
+
+	return policy, nil
+}
+
+// PurgePolicy 永久删除回收站中的策略
+func (e *Engine) PurgePolicy(ctx context.Context, policyID string) error {
+	if err := e.storage.PurgePolicy(ctx, policyID); err != nil {
+		return fmt.Errorf("purge policy: %w", err)
+	}
+
+	e.logInfo("Policy purged", map[string]interface{}{
+		"policy_id": policyID,
+	})
+	return nil
+}
+
+// PurgeDeletedPolicies 永久删除在回收站中超过 retention 的策略
+func (e *Engine) PurgeDeletedPolicies(ctx context.Context, retention time.Duration) (int64, error) {
+	purged, err := e.storage.PurgeDeletedPolicies(ctx, e.clock.Now().Add(-retention))
+	if err != nil {
+		return 0, fmt.Errorf("purge deleted policies: %w", err)
+	}
+	return purged, nil
+}
+
 // 日志辅助方法
 func (e *Engine) logInfo(msg string, fields ...interface{}) {
 	if e.logger != nil {
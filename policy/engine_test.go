@@ -5,6 +5,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/houzhh15/sdp-common/clock"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
@@ -202,6 +203,53 @@ func TestDefaultEvaluator(t *testing.T) {
 		}
 	})
 
+	// 测试来源 IP 条件
+	t.Run("SourceIPCondition", func(t *testing.T) {
+		policy := &Policy{
+			PolicyID:   "policy-006",
+			ExpiryTime: time.Now().Add(24 * time.Hour),
+			Conditions: []*Condition{
+				{
+					Type:     "source_ip",
+					Operator: "in",
+					Value:    []interface{}{"10.0.0.0/8", "203.0.113.7"},
+				},
+			},
+		}
+
+		for ip, want := range map[string]bool{
+			"10.1.2.3":         true,
+			"203.0.113.7":      true,
+			"203.0.113.7:5000": true,
+			"198.51.100.9":     false,
+			"":                 false,
+		} {
+			evalCtx := &EvalContext{
+				Request:   &AccessRequest{SourceIP: ip},
+				Timestamp: time.Now(),
+			}
+			allowed, err := evaluator.Evaluate(ctx, policy, evalCtx)
+			if err != nil {
+				t.Fatalf("Evaluate failed: %v", err)
+			}
+			if allowed != want {
+				t.Errorf("source %q: allowed = %v, want %v", ip, allowed, want)
+			}
+		}
+
+		policy.Conditions[0].Operator = "not_in"
+		allowed, err := evaluator.Evaluate(ctx, policy, &EvalContext{
+			Request:   &AccessRequest{SourceIP: "198.51.100.9"},
+			Timestamp: time.Now(),
+		})
+		if err != nil {
+			t.Fatalf("Evaluate failed: %v", err)
+		}
+		if !allowed {
+			t.Error("Expected source outside not_in list to be allowed")
+		}
+	})
+
 	// 测试时间范围条件
 	t.Run("TimeRangeCondition", func(t *testing.T) {
 		now := time.Now()
@@ -331,6 +379,111 @@ func TestEngine(t *testing.T) {
 	}
 }
 
+// TestEvaluateAccessConflictResolution 测试优先级排序与显式拒绝
+func TestEvaluateAccessConflictResolution(t *testing.T) {
+	newEngine := func(t *testing.T, policies ...*Policy) *Engine {
+		storage, err := NewDBStorage(setupTestDB(t))
+		if err != nil {
+			t.Fatalf("NewDBStorage failed: %v", err)
+		}
+		engine, err := NewEngine(&Config{Storage: storage, Logger: &mockLogger{}})
+		if err != nil {
+			t.Fatalf("NewEngine failed: %v", err)
+		}
+		if err := engine.LoadPolicies(context.Background(), policies); err != nil {
+			t.Fatalf("LoadPolicies failed: %v", err)
+		}
+		return engine
+	}
+	evaluate := func(t *testing.T, engine *Engine, os string) *AccessDecision {
+		decision, err := engine.EvaluateAccess(context.Background(), &AccessRequest{
+			ClientID:   "client-1",
+			ServiceID:  "svc-1",
+			DeviceInfo: &DeviceInfo{DeviceID: "dev-1", OS: os},
+		})
+		if err != nil {
+			t.Fatalf("EvaluateAccess failed: %v", err)
+		}
+		return decision
+	}
+	allow := func(id string, priority int, bandwidth int64) *Policy {
+		return &Policy{PolicyID: id, ClientID: "client-1", ServiceID: "svc-1", Priority: priority, BandwidthLimit: bandwidth}
+	}
+	denyOS := func(id string, priority int, os string) *Policy {
+		return &Policy{
+			PolicyID: id, ClientID: "client-1", ServiceID: "svc-1", Priority: priority, Effect: EffectDeny,
+			Conditions: []*Condition{{Type: "device_os", Operator: "eq", Value: os}},
+		}
+	}
+
+	t.Run("highest priority allow wins", func(t *testing.T) {
+		engine := newEngine(t, allow("a-low", 1, 100), allow("z-high", 10, 200))
+		decision := evaluate(t, engine, "Linux")
+		if !decision.Allowed || decision.Policy.PolicyID != "z-high" {
+			t.Fatalf("Expected z-high to be applied, got %+v", decision)
+		}
+		if decision.Constraints.BandwidthLimit != 200 {
+			t.Errorf("Expected constraints of z-high, got %d", decision.Constraints.BandwidthLimit)
+		}
+	})
+
+	t.Run("equal priority ordered by policy id", func(t *testing.T) {
+		engine := newEngine(t, allow("b", 5, 200), allow("a", 5, 100))
+		for i := 0; i < 5; i++ {
+			if decision := evaluate(t, engine, "Linux"); decision.Policy.PolicyID != "a" {
+				t.Fatalf("Expected policy a, got %s", decision.Policy.PolicyID)
+			}
+		}
+	})
+
+	t.Run("matching deny overrides higher priority allow", func(t *testing.T) {
+		engine := newEngine(t, allow("allow-all", 100, 0), denyOS("deny-windows", 0, "Windows"))
+		decision := evaluate(t, engine, "Windows")
+		if decision.Allowed {
+			t.Fatal("Expected explicit deny to override allow")
+		}
+		if decision.Policy == nil || decision.Policy.PolicyID != "deny-windows" {
+			t.Errorf("Expected deny-windows in decision, got %+v", decision.Policy)
+		}
+		if decision.Reason != "denied by policy" {
+			t.Errorf("Unexpected reason: %s", decision.Reason)
+		}
+	})
+
+	t.Run("non-matching deny does not block", func(t *testing.T) {
+		engine := newEngine(t, allow("allow-all", 0, 0), denyOS("deny-windows", 100, "Windows"))
+		if decision := evaluate(t, engine, "Linux"); !decision.Allowed || decision.Policy.PolicyID != "allow-all" {
+			t.Fatalf("Expected allow-all to apply, got %+v", decision)
+		}
+	})
+
+	t.Run("deny alone does not grant access", func(t *testing.T) {
+		engine := newEngine(t, denyOS("deny-windows", 0, "Windows"))
+		if decision := evaluate(t, engine, "Linux"); decision.Allowed {
+			t.Fatal("Expected no access without an allow policy")
+		}
+	})
+
+	t.Run("invalid effect rejected", func(t *testing.T) {
+		engine := newEngine(t)
+		err := engine.SavePolicy(context.Background(), &Policy{PolicyID: "p", ClientID: "client-1", ServiceID: "svc-1", Effect: "audit"})
+		if err == nil {
+			t.Fatal("Expected invalid effect to be rejected")
+		}
+	})
+
+	t.Run("priority and effect persisted", func(t *testing.T) {
+		engine := newEngine(t, denyOS("deny-windows", 7, "Windows"))
+		got, err := engine.GetPolicy(context.Background(), "deny-windows")
+		if err != nil {
+			t.Fatalf("GetPolicy failed: %v", err)
+		}
+		if got.Priority != 7 || got.Effect != EffectDeny {
+			t.Errorf("Expected priority 7 and deny, got %d %q", got.Priority, got.Effect)
+		}
+	})
+}
+
 // TestLoadPolicies 测试批量加载策略
 func TestLoadPolicies(t *testing.T) {
 	db := setupTestDB(t)
@@ -384,3 +537,479 @@ func TestLoadPolicies(t *testing.T) {
 		t.Errorf("Expected 2 policies, got %d", len(clientPolicies))
 	}
 }
+
+// TestEngineOnChange 测试策略变更回调
+func TestEngineOnChange(t *testing.T) {
+	db := setupTestDB(t)
+	storage, err := NewDBStorage(db)
+	if err != nil {
+		t.Fatalf("NewDBStorage failed: %v", err)
+	}
+	engine, err := NewEngine(&Config{Storage: storage, Logger: &mockLogger{}})
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+
+	var changes []string
+	engine.OnChange(func(change string, p *Policy) {
+		changes = append(changes, change+":"+p.PolicyID+":"+p.ClientID)
+	})
+
+	ctx := context.Background()
+	policy := &Policy{
+		PolicyID:   "policy-020",
+		ClientID:   "client-020",
+		ServiceID:  "service-020",
+		ExpiryTime: time.Now().Add(time.Hour),
+	}
+	if err := engine.SavePolicy(ctx, policy); err != nil {
+		t.Fatalf("SavePolicy failed: %v", err)
+	}
+	if err := engine.DeletePolicy(ctx, "policy-020"); err != nil {
+		t.Fatalf("DeletePolicy failed: %v", err)
+	}
+
+	expected := []string{"saved:policy-020:client-020", "deleted:policy-020:client-020"}
+	if len(changes) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, changes)
+	}
+	for i := range expected {
+		if changes[i] != expected[i] {
+			t.Errorf("Change %d: expected %s, got %s", i, expected[i], changes[i])
+		}
+	}
+}
+
+// TestEngineClock 测试注入时钟后有效期与时间条件按该时钟判断
+func TestEngineClock(t *testing.T) {
+	db := setupTestDB(t)
+	storage, err := NewDBStorage(db)
+	if err != nil {
+		t.Fatalf("NewDBStorage failed: %v", err)
+	}
+
+	start := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(start)
+	engine, err := NewEngine(&Config{
+		Storage:   storage,
+		Evaluator: NewDefaultEvaluator(),
+		Logger:    &mockLogger{},
+		Clock:     clk,
+	})
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+
+	ctx := context.Background()
+	policy := &Policy{
+		PolicyID:   "policy-030",
+		ClientID:   "client-030",
+		ServiceID:  "service-030",
+		ExpiryTime: start.Add(2 * time.Hour),
+		Conditions: []*Condition{
+			{
+				Type:     "time_range",
+				Operator: "between",
+				Value:    []interface{}{start.Add(-time.Hour).Format(time.RFC3339), start.Add(time.Hour).Format(time.RFC3339)},
+			},
+		},
+	}
+	if err := engine.SavePolicy(ctx, policy); err != nil {
+		t.Fatalf("SavePolicy failed: %v", err)
+	}
+	if !policy.CreatedAt.Equal(start) {
+		t.Errorf("Expected CreatedAt %v, got %v", start, policy.CreatedAt)
+	}
+
+	// Timestamp 为零值时使用注入时钟
+	req := &AccessRequest{ClientID: "client-030", ServiceID: "service-030"}
+	decision, err := engine.EvaluateAccess(ctx, req)
+	if err != nil {
+		t.Fatalf("EvaluateAccess failed: %v", err)
+	}
+	if !decision.Allowed {
+		t.Errorf("Expected access allowed within time range, got denied: %s", decision.Reason)
+	}
+
+	// 超出时间范围但策略未过期
+	clk.Advance(90 * time.Minute)
+	decision, err = engine.EvaluateAccess(ctx, &AccessRequest{ClientID: "client-030", ServiceID: "service-030"})
+	if err != nil {
+		t.Fatalf("EvaluateAccess failed: %v", err)
+	}
+	if decision.Allowed {
+		t.Error("Expected access denied outside time range")
+	}
+
+	// 策略过期后不再返回
+	clk.Advance(time.Hour)
+	policies, err := engine.GetPoliciesForClient(ctx, "client-030")
+	if err != nil {
+		t.Fatalf("GetPoliciesForClient failed: %v", err)
+	}
+	if len(policies) != 0 {
+		t.Errorf("Expected 0 active policies after expiry, got %d", len(policies))
+	}
+}
+
+// TestEngineClockSkewTolerance 测试 time_range 边界的时钟偏差宽限
+func TestEngineClockSkewTolerance(t *testing.T) {
+	storage, err := NewDBStorage(setupTestDB(t))
+	if err != nil {
+		t.Fatalf("NewDBStorage failed: %v", err)
+	}
+	if _, err := NewEngine(&Config{Storage: storage, ClockSkewTolerance: -time.Second}); err == nil {
+		t.Error("Expected negative tolerance to be rejected")
+	}
+
+	start := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+	engine, err := NewEngine(&Config{Storage: storage, Logger: &mockLogger{}, ClockSkewTolerance: time.Minute})
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	ctx := context.Background()
+	if err := engine.SavePolicy(ctx, &Policy{
+		PolicyID:  "policy-skew",
+		ClientID:  "client-skew",
+		ServiceID: "service-skew",
+		Conditions: []*Condition{{
+			Type:     "time_range",
+			Operator: "between",
+			Value:    []interface{}{start.Format(time.RFC3339), start.Add(time.Hour).Format(time.RFC3339)},
+		}},
+	}); err != nil {
+		t.Fatalf("SavePolicy failed: %v", err)
+	}
+
+	cases := []struct {
+		at      time.Time
+		allowed bool
+	}{
+		{start.Add(-30 * time.Second), true},
+		{start.Add(time.Hour + 30*time.Second), true},
+		{start.Add(-2 * time.Minute), false},
+		{start.Add(time.Hour + 2*time.Minute), false},
+	}
+	for _, tc := range cases {
+		decision, err := engine.EvaluateAccess(ctx, &AccessRequest{ClientID: "client-skew", ServiceID: "service-skew", Timestamp: tc.at})
+		if err != nil {
+			t.Fatalf("EvaluateAccess failed: %v", err)
+		}
+		if decision.Allowed != tc.allowed {
+			t.Errorf("At %v: expected allowed=%v, got %v", tc.at, tc.allowed, decision.Allowed)
+		}
+	}
+}
+
+// TestEngineDefaultDecision 测试无适用策略时的默认决策与服务覆盖
+func TestEngineDefaultDecision(t *testing.T) {
+	storage, err := NewDBStorage(setupTestDB(t))
+	if err != nil {
+		t.Fatalf("NewDBStorage failed: %v", err)
+	}
+	if _, err := NewEngine(&Config{Storage: storage, DefaultDecision: "maybe"}); err == nil {
+		t.Error("Expected invalid default decision to be rejected")
+	}
+
+	start := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(start)
+	engine, err := NewEngine(&Config{
+		Storage:         storage,
+		Logger:          &mockLogger{},
+		Clock:           clk,
+		DefaultDecision: DefaultAllow,
+		ServiceDefaults: map[string]DefaultDecision{"service-secret": DefaultDeny},
+	})
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	ctx := context.Background()
+
+	tests := []struct {
+		serviceID string
+		allowed   bool
+		reason    string
+	}{
+		{"service-wiki", true, ReasonAllowedByDefault},
+		{"service-secret", false, ReasonDeniedByDefault},
+	}
+	for _, tt := range tests {
+		decision, err := engine.EvaluateAccess(ctx, &AccessRequest{ClientID: "client-040", ServiceID: tt.serviceID})
+		if err != nil {
+			t.Fatalf("EvaluateAccess failed: %v", err)
+		}
+		if decision.Allowed != tt.allowed || decision.Reason != tt.reason || !decision.Default {
+			t.Errorf("%s: got allowed=%v reason=%q default=%v", tt.serviceID, decision.Allowed, decision.Reason, decision.Default)
+		}
+	}
+
+	// 仅有 deny 策略时不算适用策略：未命中的 deny 回落到默认允许，命中的 deny 拒绝
+	if err := engine.SavePolicy(ctx, &Policy{
+		PolicyID:   "policy-041",
+		ClientID:   "client-040",
+		ServiceID:  "service-docs",
+		Effect:     EffectDeny,
+		Conditions: []*Condition{{Type: "device_os", Operator: "eq", Value: "Windows"}},
+	}); err != nil {
+		t.Fatalf("SavePolicy failed: %v", err)
+	}
+	for os, want := range map[string]bool{"Linux": true, "Windows": false} {
+		decision, err := engine.EvaluateAccess(ctx, &AccessRequest{
+			ClientID:   "client-040",
+			ServiceID:  "service-docs",
+			DeviceInfo: &DeviceInfo{DeviceID: "dev-1", OS: os},
+		})
+		if err != nil {
+			t.Fatalf("EvaluateAccess failed: %v", err)
+		}
+		if decision.Allowed != want || decision.Default != want {
+			t.Errorf("%s: got allowed=%v reason=%q default=%v", os, decision.Allowed, decision.Reason, decision.Default)
+		}
+	}
+
+	// 适用策略条件不满足时由策略拒绝；策略过期后仍不回落到默认允许
+	if err := engine.SavePolicy(ctx, &Policy{
+		PolicyID:   "policy-040",
+		ClientID:   "client-040",
+		ServiceID:  "service-wiki",
+		ExpiryTime: start.Add(time.Hour),
+		Conditions: []*Condition{{Type: "device_compliance", Operator: "eq", Value: true}},
+	}); err != nil {
+		t.Fatalf("SavePolicy failed: %v", err)
+	}
+	for _, advance := range []time.Duration{0, 2 * time.Hour} {
+		clk.Advance(advance)
+		decision, err := engine.EvaluateAccess(ctx, &AccessRequest{ClientID: "client-040", ServiceID: "service-wiki"})
+		if err != nil {
+			t.Fatalf("EvaluateAccess failed: %v", err)
+		}
+		if decision.Allowed || decision.Reason != ReasonDeniedByPolicy || decision.Default {
+			t.Errorf("after %v: got allowed=%v reason=%q default=%v", advance, decision.Allowed, decision.Reason, decision.Default)
+		}
+	}
+}
+
+// TestDBStorageBatch 测试批量保存/删除的事务性
+func TestDBStorageBatch(t *testing.T) {
+	db := setupTestDB(t)
+	storage, err := NewDBStorage(db)
+	if err != nil {
+		t.Fatalf("NewDBStorage failed: %v", err)
+	}
+	ctx := context.Background()
+
+	countFor := func(clientID string) int {
+		policies, err := storage.QueryPolicies(ctx, &PolicyFilter{ClientID: clientID})
+		if err != nil {
+			t.Fatalf("QueryPolicies failed: %v", err)
+		}
+		return len(policies)
+	}
+
+	// 中途失败（Metadata 无法序列化）时全部回滚
+	err = storage.SavePolicies(ctx, []*Policy{
+		{PolicyID: "policy-040", ClientID: "client-040", ServiceID: "svc-a"},
+		{PolicyID: "policy-041", ClientID: "client-040", ServiceID: "svc-b", Metadata: map[string]interface{}{"bad": make(chan int)}},
+	})
+	if err == nil {
+		t.Fatal("Expected SavePolicies to fail")
+	}
+	if n := countFor("client-040"); n != 0 {
+		t.Errorf("Expected rollback to leave 0 policies, got %d", n)
+	}
+
+	// 成功保存，重复保存同一 PolicyID 为更新
+	batch := []*Policy{
+		{PolicyID: "policy-040", ClientID: "client-040", ServiceID: "svc-a"},
+		{PolicyID: "policy-041", ClientID: "client-040", ServiceID: "svc-b"},
+	}
+	if err := storage.SavePolicies(ctx, batch); err != nil {
+		t.Fatalf("SavePolicies failed: %v", err)
+	}
+	batch[1].BandwidthLimit = 500
+	if err := storage.SavePolicies(ctx, batch); err != nil {
+		t.Fatalf("SavePolicies (update) failed: %v", err)
+	}
+	if n := countFor("client-040"); n != 2 {
+		t.Errorf("Expected 2 policies, got %d", n)
+	}
+	if p, _ := storage.GetPolicy(ctx, "policy-041"); p == nil || p.BandwidthLimit != 500 {
+		t.Errorf("Expected policy-041 to be updated, got %+v", p)
+	}
+
+	// 任一策略不存在时不删除任何策略
+	if err := storage.DeletePolicies(ctx, []string{"policy-040", "policy-missing"}); err == nil {
+		t.Fatal("Expected DeletePolicies to fail for missing policy")
+	}
+	if n := countFor("client-040"); n != 2 {
+		t.Errorf("Expected rollback to keep 2 policies, got %d", n)
+	}
+	if err := storage.DeletePolicies(ctx, []string{"policy-040", "policy-041"}); err != nil {
+		t.Fatalf("DeletePolicies failed: %v", err)
+	}
+	if n := countFor("client-040"); n != 0 {
+		t.Errorf("Expected 0 policies after batch delete, got %d", n)
+	}
+}
+
+// TestReplaceClientPolicies 测试原子替换客户端策略及变更通知
+func TestReplaceClientPolicies(t *testing.T) {
+	db := setupTestDB(t)
+	storage, err := NewDBStorage(db)
+	if err != nil {
+		t.Fatalf("NewDBStorage failed: %v", err)
+	}
+	engine, err := NewEngine(&Config{Storage: storage, Logger: &mockLogger{}})
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	ctx := context.Background()
+
+	if err := engine.LoadPolicies(ctx, []*Policy{
+		{PolicyID: "policy-050", ClientID: "client-050", ServiceID: "svc-a"},
+		{PolicyID: "policy-051", ClientID: "client-050", ServiceID: "svc-b"},
+		{PolicyID: "policy-060", ClientID: "client-060", ServiceID: "svc-a"},
+	}); err != nil {
+		t.Fatalf("LoadPolicies failed: %v", err)
+	}
+
+	var changes []string
+	engine.OnChange(func(change string, p *Policy) {
+		changes = append(changes, change+":"+p.PolicyID)
+	})
+
+	// PolicyID 与其他客户端冲突时整体回滚
+	err = engine.ReplaceClientPolicies(ctx, "client-050", []*Policy{
+		{PolicyID: "policy-052", ClientID: "client-050", ServiceID: "svc-c"},
+		{PolicyID: "policy-060", ClientID: "client-050", ServiceID: "svc-a"},
+	})
+	if err == nil {
+		t.Fatal("Expected conflict with another client's policy")
+	}
+	policies, _ := engine.ListPolicies(ctx, &PolicyFilter{ClientID: "client-050"})
+	if len(policies) != 2 {
+		t.Errorf("Expected original 2 policies after rollback, got %d", len(policies))
+	}
+	if len(changes) != 0 {
+		t.Errorf("Expected no change notifications after failure, got %v", changes)
+	}
+
+	// ClientID 不匹配时拒绝
+	if err := engine.ReplaceClientPolicies(ctx, "client-050", []*Policy{{PolicyID: "policy-053", ClientID: "client-060"}}); err == nil {
+		t.Error("Expected error for policy of another client")
+	}
+
+	if err := engine.ReplaceClientPolicies(ctx, "client-050", []*Policy{
+		{PolicyID: "policy-051", ClientID: "client-050", ServiceID: "svc-b", BandwidthLimit: 100},
+		{PolicyID: "policy-052", ClientID: "client-050", ServiceID: "svc-c"},
+	}); err != nil {
+		t.Fatalf("ReplaceClientPolicies failed: %v", err)
+	}
+
+	policies, _ = engine.ListPolicies(ctx, &PolicyFilter{ClientID: "client-050"})
+	ids := map[string]bool{}
+	for _, p := range policies {
+		ids[p.PolicyID] = true
+	}
+	if len(ids) != 2 || !ids["policy-051"] || !ids["policy-052"] {
+		t.Errorf("Unexpected policies after replace: %v", ids)
+	}
+	if other, _ := engine.ListPolicies(ctx, &PolicyFilter{ClientID: "client-060"}); len(other) != 1 {
+		t.Errorf("Other client's policies should be untouched, got %d", len(other))
+	}
+
+	expected := []string{"deleted:policy-050", "saved:policy-051", "saved:policy-052"}
+	if len(changes) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, changes)
+	}
+	for i := range expected {
+		if changes[i] != expected[i] {
+			t.Errorf("Change %d: expected %s, got %s", i, expected[i], changes[i])
+		}
+	}
+}
+
+// TestPolicyRecycleBin 测试软删除、恢复与永久删除
+func TestPolicyRecycleBin(t *testing.T) {
+	db := setupTestDB(t)
+	storage, err := NewDBStorage(db)
+	if err != nil {
+		t.Fatalf("NewDBStorage failed: %v", err)
+	}
+	engine, err := NewEngine(&Config{Storage: storage, Logger: &mockLogger{}})
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	ctx := context.Background()
+
+	if err := engine.LoadPolicies(ctx, []*Policy{
+		{PolicyID: "policy-070", ClientID: "client-070", ServiceID: "svc-a"},
+		{PolicyID: "policy-071", ClientID: "client-070", ServiceID: "svc-b"},
+	}); err != nil {
+		t.Fatalf("LoadPolicies failed: %v", err)
+	}
+	if err := engine.DeletePolicy(ctx, "policy-070"); err != nil {
+		t.Fatalf("DeletePolicy failed: %v", err)
+	}
+
+	// 已删除策略不参与查询与评估
+	if _, err := engine.GetPolicy(ctx, "policy-070"); err == nil {
+		t.Error("Expected deleted policy to be hidden")
+	}
+	decision, err := engine.EvaluateAccess(ctx, &AccessRequest{ClientID: "client-070", ServiceID: "svc-a"})
+	if err != nil || decision.Allowed {
+		t.Errorf("Expected deleted policy to be ignored, got %+v, %v", decision, err)
+	}
+
+	deleted, err := engine.ListDeletedPolicies(ctx)
+	if err != nil || len(deleted) != 1 || deleted[0].PolicyID != "policy-070" || deleted[0].DeletedAt == nil {
+		t.Fatalf("Unexpected recycle bin: %+v, %v", deleted, err)
+	}
+
+	// 恢复后重新生效
+	var changes []string
+	engine.OnChange(func(change string, p *Policy) {
+		changes = append(changes, change+":"+p.PolicyID)
+	})
+	if _, err := engine.RestorePolicy(ctx, "policy-070"); err != nil {
+		t.Fatalf("RestorePolicy failed: %v", err)
+	}
+	if _, err := engine.RestorePolicy(ctx, "policy-070"); err == nil {
+		t.Error("Expected restoring a live policy to fail")
+	}
+	decision, _ = engine.EvaluateAccess(ctx, &AccessRequest{ClientID: "client-070", ServiceID: "svc-a"})
+	if !decision.Allowed {
+		t.Error("Expected restored policy to be evaluated")
+	}
+	if len(changes) != 1 || changes[0] != "saved:policy-070" {
+		t.Errorf("Unexpected change notifications: %v", changes)
+	}
+
+	// 回收站中的同 ID 策略被重新保存的策略取代
+	if err := engine.DeletePolicy(ctx, "policy-071"); err != nil {
+		t.Fatalf("DeletePolicy failed: %v", err)
+	}
+	if err := engine.SavePolicy(ctx, &Policy{PolicyID: "policy-071", ClientID: "client-070", ServiceID: "svc-c"}); err != nil {
+		t.Fatalf("SavePolicy over deleted policy failed: %v", err)
+	}
+	if p, err := engine.GetPolicy(ctx, "policy-071"); err != nil || p.ServiceID != "svc-c" {
+		t.Errorf("Expected re-created policy, got %+v, %v", p, err)
+	}
+
+	// 永久删除
+	if err := engine.DeletePolicies(ctx, []string{"policy-070", "policy-071"}); err != nil {
+		t.Fatalf("DeletePolicies failed: %v", err)
+	}
+	if err := engine.PurgePolicy(ctx, "policy-070"); err != nil {
+		t.Fatalf("PurgePolicy failed: %v", err)
+	}
+	if _, err := engine.RestorePolicy(ctx, "policy-070"); err == nil {
+		t.Error("Expected purged policy to be unrecoverable")
+	}
+	if n, err := engine.PurgeDeletedPolicies(ctx, time.Hour); err != nil || n != 0 {
+		t.Errorf("Expected recent deletions to be retained, purged %d, %v", n, err)
+	}
+	if n, err := engine.PurgeDeletedPolicies(ctx, -time.Minute); err != nil || n != 1 {
+		t.Errorf("Expected 1 expired deletion to be purged, got %d, %v", n, err)
+	}
+}
@@ -3,7 +3,7 @@ package policy
 import (
 	"context"
 	"fmt"
-	"reflect"
+	"net"
 	"strings"
 	"time"
 )
@@ -44,20 +44,23 @@ func (e *DefaultEvaluator) Evaluate(ctx context.Context, policy *Policy, evalCtx
 	return true, nil
 }
 
-// evaluateCondition 评估单个条件
+// 内置条件类型
+func init() {
+	e := &DefaultEvaluator{}
+	RegisterCondition("device_os", e.evaluateDeviceOS, validateDeviceOS)
+	RegisterCondition("geo_location", e.evaluateGeoLocation, validateGeoLocation)
+	RegisterCondition("time_range", e.evaluateTimeRange, validateTimeRange)
+	RegisterCondition("device_compliance", e.evaluateDeviceCompliance, validateDeviceCompliance)
+	RegisterCondition("source_ip", e.evaluateSourceIP, validateSourceIP)
+}
+
+// evaluateCondition 评估单个条件（按类型查找 RegisterCondition 注册的评估函数）
 func (e *DefaultEvaluator) evaluateCondition(cond *Condition, evalCtx *EvalContext) (bool, error) {
-	switch cond.Type {
-	case "device_os":
-		return e.evaluateDeviceOS(cond, evalCtx)
-	case "geo_location":
-		return e.evaluateGeoLocation(cond, evalCtx)
-	case "time_range":
-		return e.evaluateTimeRange(cond, evalCtx)
-	case "device_compliance":
-		return e.evaluateDeviceCompliance(cond, evalCtx)
-	default:
+	plugin, ok := lookupCondition(cond.Type)
+	if !ok {
 		return false, fmt.Errorf("unsupported condition type: %s", cond.Type)
 	}
+	return plugin.evaluate(cond, evalCtx)
 }
 
 // evaluateDeviceOS 评估设备操作系统
@@ -77,12 +80,12 @@ func (e *DefaultEvaluator) evaluateDeviceOS(cond *Condition, evalCtx *EvalContex
 		return strings.EqualFold(deviceOS, expectedOS), nil
 
 	case "in":
-		allowedOSList, ok := cond.Value.([]interface{})
-		if !ok {
+		allowedOSList, err := cond.StringListValue()
+		if err != nil {
 			return false, fmt.Errorf("invalid value type for in operator")
 		}
 		for _, os := range allowedOSList {
-			if osStr, ok := os.(string); ok && strings.EqualFold(deviceOS, osStr) {
+			if strings.EqualFold(deviceOS, os) {
 				return true, nil
 			}
 		}
@@ -110,8 +113,8 @@ func (e *DefaultEvaluator) evaluateGeoLocation(cond *Condition, evalCtx *EvalCon
 
 	switch cond.Operator {
 	case "in":
-		allowedCountries, ok := cond.Value.([]interface{})
-		if !ok {
+		allowedCountries, err := cond.StringListValue()
+		if err != nil {
 			return false, fmt.Errorf("invalid value type for in operator")
 		}
 		// TODO: 实现 IP 地理位置查询
@@ -126,12 +129,60 @@ func (e *DefaultEvaluator) evaluateGeoLocation(cond *Condition, evalCtx *EvalCon
 	}
 }
 
+// evaluateSourceIP 评估客户端来源 IP
+// Value 为 CIDR 或 IP 字符串数组；SourceIP 由 Controller 按可信代理配置解析（X-Forwarded-For / PROXY protocol）
+func (e *DefaultEvaluator) evaluateSourceIP(cond *Condition, evalCtx *EvalContext) (bool, error) {
+	if evalCtx.Request == nil || evalCtx.Request.SourceIP == "" {
+		return false, nil
+	}
+
+	ip := net.ParseIP(evalCtx.Request.SourceIP)
+	if ip == nil {
+		if host, _, err := net.SplitHostPort(evalCtx.Request.SourceIP); err == nil {
+			ip = net.ParseIP(host)
+		}
+	}
+	if ip == nil {
+		return false, nil
+	}
+
+	entries, err := cond.StringListValue()
+	if err != nil {
+		return false, fmt.Errorf("invalid value type for %s operator", cond.Operator)
+	}
+	matched := false
+	for _, s := range entries {
+		if strings.Contains(s, "/") {
+			_, network, err := net.ParseCIDR(s)
+			if err != nil {
+				return false, fmt.Errorf("invalid source_ip CIDR %q: %w", s, err)
+			}
+			if network.Contains(ip) {
+				matched = true
+				break
+			}
+		} else if allowed := net.ParseIP(s); allowed != nil && allowed.Equal(ip) {
+			matched = true
+			break
+		}
+	}
+
+	switch cond.Operator {
+	case "in":
+		return matched, nil
+	case "not_in":
+		return !matched, nil
+	default:
+		return false, fmt.Errorf("unsupported operator for source_ip: %s", cond.Operator)
+	}
+}
+
 // evaluateTimeRange 评估时间范围
 func (e *DefaultEvaluator) evaluateTimeRange(cond *Condition, evalCtx *EvalContext) (bool, error) {
 	switch cond.Operator {
 	case "between":
 		// Value 应该是 [startTime, endTime] 数组
-		timeRange, ok := cond.Value.([]interface{})
+		timeRange, ok := cond.listValue()
 		if !ok || len(timeRange) != 2 {
 			return false, fmt.Errorf("invalid value type for between operator")
 		}
@@ -146,8 +197,10 @@ func (e *DefaultEvaluator) evaluateTimeRange(cond *Condition, evalCtx *EvalConte
 			return false, fmt.Errorf("parse end time: %w", err)
 		}
 
+		// 两侧各放宽 ClockSkewTolerance
 		currentTime := evalCtx.Timestamp
-		return currentTime.After(startTime) && currentTime.Before(endTime), nil
+		skew := evalCtx.ClockSkewTolerance
+		return currentTime.After(startTime.Add(-skew)) && currentTime.Before(endTime.Add(skew)), nil
 
 	default:
 		return false, fmt.Errorf("unsupported operator for time_range: %s", cond.Operator)
@@ -173,6 +226,82 @@ func (e *DefaultEvaluator) evaluateDeviceCompliance(cond *Condition, evalCtx *Ev
 	}
 }
 
+// validateDeviceOS 校验 device_os：eq/ne 为字符串，in 为字符串数组
+func validateDeviceOS(cond *Condition) error {
+	switch cond.Operator {
+	case "eq", "ne":
+		_, err := cond.StringValue()
+		return err
+	case "in":
+		_, err := cond.StringListValue()
+		return err
+	default:
+		return fmt.Errorf("unsupported operator for device_os: %s", cond.Operator)
+	}
+}
+
+// validateGeoLocation 校验 geo_location：in 为国家代码数组
+func validateGeoLocation(cond *Condition) error {
+	if cond.Operator != "in" {
+		return fmt.Errorf("unsupported operator for geo_location: %s", cond.Operator)
+	}
+	_, err := cond.StringListValue()
+	return err
+}
+
+// validateSourceIP 校验 source_ip：in/not_in 为 IP 或 CIDR 数组
+func validateSourceIP(cond *Condition) error {
+	if cond.Operator != "in" && cond.Operator != "not_in" {
+		return fmt.Errorf("unsupported operator for source_ip: %s", cond.Operator)
+	}
+	entries, err := cond.StringListValue()
+	if err != nil {
+		return err
+	}
+	for _, s := range entries {
+		if strings.Contains(s, "/") {
+			if _, _, err := net.ParseCIDR(s); err != nil {
+				return fmt.Errorf("invalid source_ip CIDR %q: %w", s, err)
+			}
+		} else if net.ParseIP(s) == nil {
+			return fmt.Errorf("invalid source_ip entry %q", s)
+		}
+	}
+	return nil
+}
+
+// validateTimeRange 校验 time_range：between 为 [start, end] 且 start 早于 end
+func validateTimeRange(cond *Condition) error {
+	if cond.Operator != "between" {
+		return fmt.Errorf("unsupported operator for time_range: %s", cond.Operator)
+	}
+	timeRange, ok := cond.listValue()
+	if !ok || len(timeRange) != 2 {
+		return fmt.Errorf("value must be [start, end]")
+	}
+	start, err := parseTime(timeRange[0])
+	if err != nil {
+		return fmt.Errorf("parse start time: %w", err)
+	}
+	end, err := parseTime(timeRange[1])
+	if err != nil {
+		return fmt.Errorf("parse end time: %w", err)
+	}
+	if !start.Before(end) {
+		return fmt.Errorf("start time must be before end time")
+	}
+	return nil
+}
+
+// validateDeviceCompliance 校验 device_compliance：eq 为布尔值
+func validateDeviceCompliance(cond *Condition) error {
+	if cond.Operator != "eq" {
+		return fmt.Errorf("unsupported operator for device_compliance: %s", cond.Operator)
+	}
+	_, err := cond.BoolValue()
+	return err
+}
+
 // parseTime 解析时间值
 func parseTime(val interface{}) (time.Time, error) {
 	switch v := val.(type) {
@@ -185,6 +314,6 @@ func parseTime(val interface{}) (time.Time, error) {
 	case float64:
 		return time.Unix(int64(v), 0), nil
 	default:
-		return time.Time{}, fmt.Errorf("unsupported time type: %s", reflect.TypeOf(val).String())
+		return time.Time{}, fmt.Errorf("unsupported time type: %T", val)
 	}
 }
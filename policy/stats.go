@@ -0,0 +1,168 @@
+package policy
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// DefaultEvaluationBudget 单次策略评估耗时预算，超过时记录告警日志
+const DefaultEvaluationBudget = 100 * time.Millisecond
+
+// 慢策略 Top-N 指标
+const (
+	slowPolicyTopN         = 10
+	slowPolicyPublishEvery = 10 * time.Second
+)
+
+var (
+	// policyEvaluations tracks policy evaluations by result
+	// Labels: result (allowed, denied, error)
+	policyEvaluations = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "policy_evaluations_total",
+			Help: "Total number of policy evaluations grouped by result",
+		},
+		[]string{"result"},
+	)
+
+	// policyEvaluationDuration tracks the latency of a single policy evaluation
+	policyEvaluationDuration = promauto.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "policy_evaluation_duration_seconds",
+			Help:    "Duration of a single policy evaluation in seconds",
+			Buckets: []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1},
+		},
+	)
+
+	// policySlowEvaluations tracks evaluations exceeding the evaluation budget
+	policySlowEvaluations = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "policy_slow_evaluations_total",
+			Help: "Total number of policy evaluations exceeding the evaluation budget",
+		},
+	)
+
+	// policySlowestAvg tracks the average evaluation latency of the top-N slowest policies
+	// Labels: policy (policy ID; only the current top-N are exported to bound cardinality)
+	policySlowestAvg = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "policy_slowest_evaluation_avg_seconds",
+			Help: "Average evaluation latency of the slowest policies (top-N)",
+		},
+		[]string{"policy"},
+	)
+)
+
+// PolicyStats 单条策略的评估统计
+type PolicyStats struct {
+	PolicyID        string    `json:"policy_id"`
+	Evaluations     uint64    `json:"evaluations"`
+	Errors          uint64    `json:"errors"`
+	SlowEvaluations uint64    `json:"slow_evaluations"` // 超过评估预算的次数
+	AvgMs           float64   `json:"avg_ms"`
+	MaxMs           float64   `json:"max_ms"`
+	LastEvaluatedAt time.Time `json:"last_evaluated_at"`
+}
+
+// policyStat 单条策略的累计值
+type policyStat struct {
+	evaluations uint64
+	errors      uint64
+	slow        uint64
+	total       time.Duration
+	max         time.Duration
+	last        time.Time
+}
+
+// evalStats 按策略统计评估次数与耗时
+type evalStats struct {
+	mu          sync.Mutex
+	policies    map[string]*policyStat
+	lastPublish time.Time
+}
+
+func newEvalStats() *evalStats {
+	return &evalStats{policies: make(map[string]*policyStat)}
+}
+
+// record 记录一次评估，result 为 allowed / denied / error
+func (s *evalStats) record(policyID, result string, elapsed time.Duration, slow bool, now time.Time) {
+	policyEvaluations.WithLabelValues(result).Inc()
+	policyEvaluationDuration.Observe(elapsed.Seconds())
+	if slow {
+		policySlowEvaluations.Inc()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := s.policies[policyID]
+	if !ok {
+		st = &policyStat{}
+		s.policies[policyID] = st
+	}
+	st.evaluations++
+	st.total += elapsed
+	st.max = max(st.max, elapsed)
+	st.last = now
+	if result == "error" {
+		st.errors++
+	}
+	if slow {
+		st.slow++
+	}
+
+	if now.Sub(s.lastPublish) >= slowPolicyPublishEvery {
+		s.lastPublish = now
+		policySlowestAvg.Reset()
+		for _, top := range s.slowestLocked(slowPolicyTopN) {
+			policySlowestAvg.WithLabelValues(top.PolicyID).Set(top.AvgMs / 1000)
+		}
+	}
+}
+
+// forget 删除策略的统计（策略删除后不再参与评估）
+func (s *evalStats) forget(policyID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.policies, policyID)
+}
+
+// slowest 按平均耗时降序返回前 n 条策略（n <= 0 返回全部）
+func (s *evalStats) slowest(n int) []*PolicyStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.slowestLocked(n)
+}
+
+func (s *evalStats) slowestLocked(n int) []*PolicyStats {
+	result := make([]*PolicyStats, 0, len(s.policies))
+	for id, st := range s.policies {
+		result = append(result, &PolicyStats{
+			PolicyID:        id,
+			Evaluations:     st.evaluations,
+			Errors:          st.errors,
+			SlowEvaluations: st.slow,
+			AvgMs:           durationMs(st.total) / float64(st.evaluations),
+			MaxMs:           durationMs(st.max),
+			LastEvaluatedAt: st.last,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].AvgMs != result[j].AvgMs {
+			return result[i].AvgMs > result[j].AvgMs
+		}
+		return result[i].PolicyID < result[j].PolicyID
+	})
+	if n > 0 && len(result) > n {
+		result = result[:n]
+	}
+	return result
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
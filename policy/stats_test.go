@@ -0,0 +1,65 @@
+package policy
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestEngineEvaluationStats(t *testing.T) {
+	RegisterCondition("test_sleep", func(cond *Condition, evalCtx *EvalContext) (bool, error) {
+		d, err := cond.DurationValue()
+		if err != nil {
+			return false, err
+		}
+		time.Sleep(d)
+		return true, nil
+	}, nil)
+
+	storage, err := NewDBStorage(setupTestDB(t))
+	if err != nil {
+		t.Fatalf("NewDBStorage failed: %v", err)
+	}
+	engine, err := NewEngine(&Config{Storage: storage, Logger: &mockLogger{}, EvaluationBudget: 5 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	ctx := context.Background()
+
+	for _, p := range []*Policy{
+		{PolicyID: "policy-fast", ClientID: "client-050", ServiceID: "service-fast"},
+		{PolicyID: "policy-slow", ClientID: "client-050", ServiceID: "service-slow",
+			Conditions: []*Condition{{Type: "test_sleep", Operator: "eq", Value: "20ms"}}},
+	} {
+		if err := engine.SavePolicy(ctx, p); err != nil {
+			t.Fatalf("SavePolicy failed: %v", err)
+		}
+	}
+	for _, serviceID := range []string{"service-fast", "service-fast", "service-slow"} {
+		if _, err := engine.EvaluateAccess(ctx, &AccessRequest{ClientID: "client-050", ServiceID: serviceID}); err != nil {
+			t.Fatalf("EvaluateAccess failed: %v", err)
+		}
+	}
+
+	stats := engine.SlowestPolicies(0)
+	if len(stats) != 2 {
+		t.Fatalf("Expected stats for 2 policies, got %d", len(stats))
+	}
+	if stats[0].PolicyID != "policy-slow" || stats[0].SlowEvaluations != 1 || stats[0].AvgMs < 20 {
+		t.Errorf("Unexpected slowest policy: %+v", stats[0])
+	}
+	if stats[1].PolicyID != "policy-fast" || stats[1].Evaluations != 2 || stats[1].SlowEvaluations != 0 {
+		t.Errorf("Unexpected fast policy stats: %+v", stats[1])
+	}
+	if top := engine.SlowestPolicies(1); len(top) != 1 || top[0].PolicyID != "policy-slow" {
+		t.Errorf("Expected top-1 to be policy-slow, got %+v", top)
+	}
+
+	// 删除策略后清除统计
+	if err := engine.DeletePolicy(ctx, "policy-slow"); err != nil {
+		t.Fatalf("DeletePolicy failed: %v", err)
+	}
+	if stats := engine.SlowestPolicies(0); len(stats) != 1 || stats[0].PolicyID != "policy-fast" {
+		t.Errorf("Expected only policy-fast after delete, got %+v", stats)
+	}
+}
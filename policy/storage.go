@@ -3,6 +3,7 @@ package policy
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
@@ -15,6 +16,23 @@ type Storage interface {
 	GetPolicy(ctx context.Context, policyID string) (*Policy, error)
 	DeletePolicy(ctx context.Context, policyID string) error
 	QueryPolicies(ctx context.Context, filter *PolicyFilter) ([]*Policy, error)
+
+	// SavePolicies 在单个事务中批量保存策略，任一失败则全部回滚
+	SavePolicies(ctx context.Context, policies []*Policy) error
+	// DeletePolicies 在单个事务中批量删除策略，任一不存在则全部回滚
+	DeletePolicies(ctx context.Context, policyIDs []string) error
+	// ReplaceAllForClient 原子替换客户端的全部策略（用于导入/同步）
+	ReplaceAllForClient(ctx context.Context, clientID string, policies []*Policy) error
+
+	// 回收站：DeletePolicy/DeletePolicies 为软删除，已删除策略不参与查询与评估
+	// ListDeletedPolicies 列出已删除策略（按删除时间倒序）
+	ListDeletedPolicies(ctx context.Context) ([]*Policy, error)
+	// RestorePolicy 从回收站恢复策略
+	RestorePolicy(ctx context.Context, policyID string) (*Policy, error)
+	// PurgePolicy 永久删除回收站中的策略
+	PurgePolicy(ctx context.Context, policyID string) error
+	// PurgeDeletedPolicies 永久删除 before 之前删除的策略，返回删除条数
+	PurgeDeletedPolicies(ctx context.Context, before time.Time) (int64, error)
 }
 
 // policyDBModel 数据库模型（用于 GORM）
@@ -23,13 +41,20 @@ type policyDBModel struct {
 	PolicyID         string `gorm:"uniqueIndex"`
 	ClientID         string `gorm:"index"`
 	ServiceID        string `gorm:"index"`
+	Priority         int
+	Effect           string
 	BandwidthLimit   int64
 	ConcurrencyLimit int
 	ExpiryTime       time.Time
+	RequireE2E       bool
+	QoSClass         string
+	ReverseForward   bool
+	Obfuscate        bool
 	ConditionsJSON   string `gorm:"type:text"` // JSON 序列化的条件列表
 	MetadataJSON     string `gorm:"type:text"` // JSON 序列化的元数据
 	CreatedAt        time.Time
 	UpdatedAt        time.Time
+	DeletedAt        gorm.DeletedAt `gorm:"index"` // 软删除（回收站）
 }
 
 func (policyDBModel) TableName() string {
@@ -53,16 +78,41 @@ func NewDBStorage(db *gorm.DB) (*DBStorage, error) {
 
 // SavePolicy 保存策略（复用 PolicyService.CreatePolicy 逻辑）
 func (s *DBStorage) SavePolicy(ctx context.Context, policy *Policy) error {
+	return s.savePolicy(s.db.WithContext(ctx), policy)
+}
+
+// SavePolicies 批量保存策略（单个事务）
+func (s *DBStorage) SavePolicies(ctx context.Context, policies []*Policy) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, policy := range policies {
+			if err := s.savePolicy(tx, policy); err != nil {
+				return fmt.Errorf("policy %s: %w", policy.PolicyID, err)
+			}
+		}
+		return nil
+	})
+}
+
+// savePolicy 在给定会话（事务或普通连接）中保存单个策略
+func (s *DBStorage) savePolicy(db *gorm.DB, policy *Policy) error {
 	// 转换为数据库模型
 	model, err := s.toDBModel(policy)
 	if err != nil {
 		return fmt.Errorf("convert to db model: %w", err)
 	}
 
-	// 如果已存在则更新，否则创建
-	result := s.db.WithContext(ctx).Save(model)
-	if result.Error != nil {
-		return fmt.Errorf("save policy: %w", result.Error)
+	// 如果已存在则更新，否则创建（按 PolicyID 定位主键，避免唯一索引冲突）
+	// 回收站中的同 ID 策略被新策略取代
+	var existing policyDBModel
+	result := db.Unscoped().Select("id").Where("policy_id = ?", policy.PolicyID).Take(&existing)
+	if result.Error == nil {
+		model.ID = existing.ID
+	} else if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("lookup policy: %w", result.Error)
+	}
+
+	if err := db.Unscoped().Save(model).Error; err != nil {
+		return fmt.Errorf("save policy: %w", err)
 	}
 
 	return nil
@@ -88,7 +138,7 @@ func (s *DBStorage) GetPolicy(ctx context.Context, policyID string) (*Policy, er
 	return policy, nil
 }
 
-// DeletePolicy 删除策略（复用 PolicyService.DeletePolicy 逻辑）
+// DeletePolicy 删除策略（软删除，移入回收站）
 func (s *DBStorage) DeletePolicy(ctx context.Context, policyID string) error {
 	result := s.db.WithContext(ctx).Where("policy_id = ?", policyID).Delete(&policyDBModel{})
 	if result.Error != nil {
@@ -102,6 +152,62 @@ func (s *DBStorage) DeletePolicy(ctx context.Context, policyID string) error {
 	return nil
 }
 
+// DeletePolicies 批量删除策略（单个事务，软删除）
+func (s *DBStorage) DeletePolicies(ctx context.Context, policyIDs []string) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, policyID := range policyIDs {
+			result := tx.Where("policy_id = ?", policyID).Delete(&policyDBModel{})
+			if result.Error != nil {
+				return fmt.Errorf("delete policy %s: %w", policyID, result.Error)
+			}
+			if result.RowsAffected == 0 {
+				return fmt.Errorf("policy not found: %s", policyID)
+			}
+		}
+		return nil
+	})
+}
+
+// ReplaceAllForClient 删除客户端现有策略并写入新策略（单个事务）
+// policies 的 ClientID 必须为 clientID；PolicyID 已被其他客户端占用时整体回滚
+func (s *DBStorage) ReplaceAllForClient(ctx context.Context, clientID string, policies []*Policy) error {
+	if clientID == "" {
+		return fmt.Errorf("client_id is required")
+	}
+	for _, policy := range policies {
+		if policy.ClientID != clientID {
+			return fmt.Errorf("policy %s belongs to client %q, not %q", policy.PolicyID, policy.ClientID, clientID)
+		}
+	}
+
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// 新集合中的 ID 先彻底移除（本客户端现有策略或回收站中的同 ID 策略），其余旧策略移入回收站
+		if len(policies) > 0 {
+			ids := make([]string, 0, len(policies))
+			for _, policy := range policies {
+				ids = append(ids, policy.PolicyID)
+			}
+			if err := tx.Unscoped().Where("policy_id IN ? AND (client_id = ? OR deleted_at IS NOT NULL)", ids, clientID).Delete(&policyDBModel{}).Error; err != nil {
+				return fmt.Errorf("remove replaced policies: %w", err)
+			}
+		}
+		if err := tx.Where("client_id = ?", clientID).Delete(&policyDBModel{}).Error; err != nil {
+			return fmt.Errorf("delete client policies: %w", err)
+		}
+		for _, policy := range policies {
+			model, err := s.toDBModel(policy)
+			if err != nil {
+				return fmt.Errorf("convert policy %s: %w", policy.PolicyID, err)
+			}
+			// 现有策略已删除，直接插入；与其他客户端冲突时由唯一索引拒绝
+			if err := tx.Create(model).Error; err != nil {
+				return fmt.Errorf("create policy %s: %w", policy.PolicyID, err)
+			}
+		}
+		return nil
+	})
+}
+
 // QueryPolicies 查询策略（复用 Engine.GetPolicies 和 PolicyService.ListPolicies 逻辑）
 func (s *DBStorage) QueryPolicies(ctx context.Context, filter *PolicyFilter) ([]*Policy, error) {
 	query := s.db.WithContext(ctx).Model(&policyDBModel{})
@@ -115,12 +221,16 @@ func (s *DBStorage) QueryPolicies(ctx context.Context, filter *PolicyFilter) ([]
 		}
 		if filter.Active {
 			// 仅查询未过期策略（复用 Engine.GetPolicies 的过滤逻辑）
-			query = query.Where("expiry_time > ? OR expiry_time = ?", time.Now(), time.Time{})
+			at := filter.ActiveAt
+			if at.IsZero() {
+				at = time.Now()
+			}
+			query = query.Where("expiry_time > ? OR expiry_time = ?", at, time.Time{})
 		}
 	}
 
 	var models []policyDBModel
-	if err := query.Find(&models).Error; err != nil {
+	if err := query.Order("priority DESC, policy_id").Find(&models).Error; err != nil {
 		return nil, fmt.Errorf("query policies: %w", err)
 	}
 
@@ -137,15 +247,74 @@ func (s *DBStorage) QueryPolicies(ctx context.Context, filter *PolicyFilter) ([]
 	return policies, nil
 }
 
+// ListDeletedPolicies 列出回收站中的策略
+func (s *DBStorage) ListDeletedPolicies(ctx context.Context) ([]*Policy, error) {
+	var models []policyDBModel
+	if err := s.db.WithContext(ctx).Unscoped().Where("deleted_at IS NOT NULL").Order("deleted_at DESC").Find(&models).Error; err != nil {
+		return nil, fmt.Errorf("query deleted policies: %w", err)
+	}
+
+	policies := make([]*Policy, 0, len(models))
+	for i := range models {
+		policy, err := s.fromDBModel(&models[i])
+		if err != nil {
+			return nil, fmt.Errorf("convert policy %s: %w", models[i].PolicyID, err)
+		}
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
+
+// RestorePolicy 从回收站恢复策略
+func (s *DBStorage) RestorePolicy(ctx context.Context, policyID string) (*Policy, error) {
+	result := s.db.WithContext(ctx).Unscoped().Model(&policyDBModel{}).
+		Where("policy_id = ? AND deleted_at IS NOT NULL", policyID).
+		Update("deleted_at", nil)
+	if result.Error != nil {
+		return nil, fmt.Errorf("restore policy: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, fmt.Errorf("deleted policy not found: %s", policyID)
+	}
+	return s.GetPolicy(ctx, policyID)
+}
+
+// PurgePolicy 永久删除回收站中的策略
+func (s *DBStorage) PurgePolicy(ctx context.Context, policyID string) error {
+	result := s.db.WithContext(ctx).Unscoped().Where("policy_id = ? AND deleted_at IS NOT NULL", policyID).Delete(&policyDBModel{})
+	if result.Error != nil {
+		return fmt.Errorf("purge policy: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("deleted policy not found: %s", policyID)
+	}
+	return nil
+}
+
+// PurgeDeletedPolicies 永久删除 before 之前移入回收站的策略
+func (s *DBStorage) PurgeDeletedPolicies(ctx context.Context, before time.Time) (int64, error) {
+	result := s.db.WithContext(ctx).Unscoped().Where("deleted_at IS NOT NULL AND deleted_at < ?", before).Delete(&policyDBModel{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("purge deleted policies: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
 // toDBModel 转换为数据库模型
 func (s *DBStorage) toDBModel(policy *Policy) (*policyDBModel, error) {
 	model := &policyDBModel{
 		PolicyID:         policy.PolicyID,
 		ClientID:         policy.ClientID,
 		ServiceID:        policy.ServiceID,
+		Priority:         policy.Priority,
+		Effect:           string(policy.Effect),
 		BandwidthLimit:   policy.BandwidthLimit,
 		ConcurrencyLimit: policy.ConcurrencyLimit,
 		ExpiryTime:       policy.ExpiryTime,
+		RequireE2E:       policy.RequireE2E,
+		QoSClass:         policy.QoSClass,
+		ReverseForward:   policy.ReverseForward,
+		Obfuscate:        policy.Obfuscate,
 		CreatedAt:        policy.CreatedAt,
 		UpdatedAt:        policy.UpdatedAt,
 	}
@@ -177,12 +346,22 @@ func (s *DBStorage) fromDBModel(model *policyDBModel) (*Policy, error) {
 		PolicyID:         model.PolicyID,
 		ClientID:         model.ClientID,
 		ServiceID:        model.ServiceID,
+		Priority:         model.Priority,
+		Effect:           Effect(model.Effect),
 		BandwidthLimit:   model.BandwidthLimit,
 		ConcurrencyLimit: model.ConcurrencyLimit,
 		ExpiryTime:       model.ExpiryTime,
+		RequireE2E:       model.RequireE2E,
+		QoSClass:         model.QoSClass,
+		ReverseForward:   model.ReverseForward,
+		Obfuscate:        model.Obfuscate,
 		CreatedAt:        model.CreatedAt,
 		UpdatedAt:        model.UpdatedAt,
 	}
+	if model.DeletedAt.Valid {
+		deletedAt := model.DeletedAt.Time
+		policy.DeletedAt = &deletedAt
+	}
 
 	// 反序列化 Conditions
 	if model.ConditionsJSON != "" {
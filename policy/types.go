@@ -1,7 +1,10 @@
 package policy
 
 import (
+	"fmt"
 	"time"
+
+	"github.com/houzhh15/sdp-common/device"
 )
 
 // Policy 策略（扩展原 PolicyEntry）
@@ -10,18 +13,48 @@ type Policy struct {
 	PolicyID         string                 `json:"policy_id" gorm:"uniqueIndex"`
 	ClientID         string                 `json:"client_id" gorm:"index"`
 	ServiceID        string                 `json:"service_id" gorm:"index"` // 通过 ServiceID 关联到 ServiceConfig
+	Priority         int                    `json:"priority,omitempty"`      // 评估优先级，数值大者先评估
+	Effect           Effect                 `json:"effect,omitempty"`        // allow（默认）或 deny
 	BandwidthLimit   int64                  `json:"bandwidth_limit"`         // bytes/s
 	ConcurrencyLimit int                    `json:"concurrency_limit"`       // 最大并发连接数
 	ExpiryTime       time.Time              `json:"expiry_time"`
-	Conditions       []*Condition           `json:"conditions,omitempty"` // 新增：策略条件
+	RequireE2E       bool                   `json:"require_e2e,omitempty"`     // 要求隧道启用端到端加密
+	QoSClass         string                 `json:"qos_class,omitempty"`       // 覆盖服务配置的 DSCP 服务等级（见 qos 包）
+	ReverseForward   bool                   `json:"reverse_forward,omitempty"` // 允许反向转发（ssh -R 语义，AH 监听并转回 IH 所在网络）
+	Obfuscate        bool                   `json:"obfuscate,omitempty"`       // 隧道启用流量混淆（填充帧长、随机化发送时机）
+	Conditions       []*Condition           `json:"conditions,omitempty"`      // 新增：策略条件
 	Metadata         map[string]interface{} `json:"metadata,omitempty"`
 	CreatedAt        time.Time              `json:"created_at"`
 	UpdatedAt        time.Time              `json:"updated_at"`
+	DeletedAt        *time.Time             `json:"deleted_at,omitempty"` // 软删除时间（仅回收站中的策略）
+}
+
+// Effect 策略效果
+type Effect string
+
+const (
+	EffectAllow Effect = "allow" // 条件满足时允许访问（默认）
+	EffectDeny  Effect = "deny"  // 条件满足时拒绝访问，优先于任何 allow 策略
+)
+
+// Validate 校验策略效果（空值等同 allow）
+func (e Effect) Validate() error {
+	switch e {
+	case "", EffectAllow, EffectDeny:
+		return nil
+	default:
+		return fmt.Errorf("invalid policy effect: %s", e)
+	}
+}
+
+// IsDeny 是否为显式拒绝策略
+func (p *Policy) IsDeny() bool {
+	return p.Effect == EffectDeny
 }
 
 // Condition 策略条件（新增）
 type Condition struct {
-	Type     string      `json:"type"`     // "device_os", "geo_location", "time_range"
+	Type     string      `json:"type"`     // "device_os", "geo_location", "time_range", "source_ip" 或 RegisterCondition 注册的类型
 	Operator string      `json:"operator"` // "eq", "in", "between", "ne", "not_in"
 	Value    interface{} `json:"value"`    // 条件值（可以是字符串、数组、时间等）
 }
@@ -30,7 +63,8 @@ type Condition struct {
 type PolicyFilter struct {
 	ClientID  string
 	ServiceID string
-	Active    bool // 是否仅查询有效（未过期）策略
+	Active    bool      // 是否仅查询有效（未过期）策略
+	ActiveAt  time.Time // Active 判断的参考时间，零值为当前时间
 }
 
 // AccessRequest 访问请求（新增）
@@ -43,18 +77,39 @@ type AccessRequest struct {
 	Metadata   map[string]interface{} `json:"metadata,omitempty"`
 }
 
-// DeviceInfo 设备信息
-type DeviceInfo struct {
-	DeviceID   string `json:"device_id"`
-	OS         string `json:"os"`
-	OSVersion  string `json:"os_version"`
-	Compliance bool   `json:"compliance"`
+// DeviceInfo 设备信息（与握手、会话共用 device.Info，含 Hostname 与自定义属性）
+type DeviceInfo = device.Info
+
+// DefaultDecision 没有适用策略（客户端对该服务无任何策略）时的默认决策
+type DefaultDecision string
+
+const (
+	DefaultDeny  DefaultDecision = "deny"  // 默认拒绝（默认值）
+	DefaultAllow DefaultDecision = "allow" // 默认允许，仅建议用于迁移期或内部低敏服务
+)
+
+// Validate 校验默认决策取值（空值视为 deny）
+func (d DefaultDecision) Validate() error {
+	switch d {
+	case "", DefaultDeny, DefaultAllow:
+		return nil
+	}
+	return fmt.Errorf("invalid default decision: %s (valid: %s, %s)", d, DefaultDeny, DefaultAllow)
 }
 
+// 访问决策原因（AccessDecision.Reason）
+const (
+	ReasonPolicyMatched    = "policy matched"
+	ReasonDeniedByPolicy   = "denied by policy"   // 显式 deny 策略匹配，或存在适用的 allow 策略但条件均不满足
+	ReasonDeniedByDefault  = "denied by default"  // 无适用策略，按默认拒绝
+	ReasonAllowedByDefault = "allowed by default" // 无适用策略，按默认允许
+)
+
 // AccessDecision 访问决策（新增）
 type AccessDecision struct {
 	Allowed     bool               `json:"allowed"`
 	Reason      string             `json:"reason"`
+	Default     bool               `json:"default,omitempty"` // 由默认决策给出（无适用策略）
 	Policy      *Policy            `json:"policy,omitempty"`
 	Constraints *AccessConstraints `json:"constraints,omitempty"`
 }
@@ -64,10 +119,16 @@ type AccessConstraints struct {
 	BandwidthLimit   int64     `json:"bandwidth_limit"`
 	ConcurrencyLimit int       `json:"concurrency_limit"`
 	ExpiresAt        time.Time `json:"expires_at"`
+	RequireE2E       bool      `json:"require_e2e,omitempty"`
+	QoSClass         string    `json:"qos_class,omitempty"`
+	ReverseForward   bool      `json:"reverse_forward,omitempty"` // 允许创建反向转发隧道
+	Obfuscate        bool      `json:"obfuscate,omitempty"`       // 隧道须启用流量混淆
 }
 
 // EvalContext 评估上下文（新增）
 type EvalContext struct {
 	Request   *AccessRequest
 	Timestamp time.Time
+	// ClockSkewTolerance 时间类条件边界两侧的宽限（Config.ClockSkewTolerance）
+	ClockSkewTolerance time.Duration
 }
@@ -11,6 +11,10 @@ const (
 	ErrCodeUnauthorized   = 40100 // 未授权
 	ErrCodeInvalidCert    = 40101 // 证书无效
 	ErrCodeSessionExpired = 40102 // 会话过期
+	// 会话超过最大生命周期或刷新次数上限，需重新握手
+	ErrCodeSessionLifetimeExceeded = 40103
+	// 请求携带的设备指纹与会话记录不一致，会话已按策略撤销，需重新握手
+	ErrCodePostureDrift = 40104
 
 	// 授权错误 (403xx)
 	ErrCodeNoPolicy = 40301 // 无授权策略
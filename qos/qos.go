@@ -0,0 +1,110 @@
+// Package qos 提供数据平面连接的 DSCP 标记，使网络按服务等级区分隧道流量的优先级
+//
+// 服务等级来自 ServiceConfig.QoSClass 或策略的 QoSClass（策略优先），Controller 创建隧道时写入隧道 Metadata，
+// 中继、AH、IH 分别标记各自的数据平面连接：
+//
+//	if err := qos.MarkClass(conn, tun.QoSClass()); err != nil {
+//	    logger.Debug("DSCP marking skipped", "error", err)
+//	}
+//
+// 标记设置 IPv4 TOS / IPv6 Traffic Class 字段的高 6 位，仅作用于本端发出的数据包。
+// 不支持的平台（Linux、macOS、FreeBSD 以外）或非 TCP 连接返回 ErrUnsupported，调用方忽略即可，连接照常使用。
+package qos
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"syscall"
+)
+
+// 服务等级
+const (
+	ClassBestEffort    = "best_effort"   // CS0：默认
+	ClassBulk          = "bulk"          // CS1：备份、批量同步等低于默认优先级的流量
+	ClassTransactional = "transactional" // AF21：数据库、API 调用
+	ClassInteractive   = "interactive"   // AF41：SSH、远程桌面
+	ClassRealtime      = "realtime"      // EF：语音、实时音视频
+)
+
+// MaxDSCP DSCP 字段为 6 位
+const MaxDSCP = 63
+
+// ErrUnsupported 当前平台或连接类型不支持 DSCP 标记
+var ErrUnsupported = errors.New("DSCP marking is not supported on this platform or connection")
+
+// classes 服务等级与标准 DSCP 名称（RFC 2474 CS、RFC 2597 AF、RFC 3246 EF）对应的 DSCP 值
+var classes = map[string]int{
+	ClassBestEffort:    0,
+	ClassBulk:          8,
+	ClassTransactional: 18,
+	ClassInteractive:   34,
+	ClassRealtime:      46,
+
+	"cs0": 0, "cs1": 8, "cs2": 16, "cs3": 24, "cs4": 32, "cs5": 40, "cs6": 48, "cs7": 56,
+	"af11": 10, "af12": 12, "af13": 14,
+	"af21": 18, "af22": 20, "af23": 22,
+	"af31": 26, "af32": 28, "af33": 30,
+	"af41": 34, "af42": 36, "af43": 38,
+	"ef": 46,
+}
+
+// DSCP 返回服务等级对应的 DSCP 值，class 可以是服务等级或标准 DSCP 名称（不区分大小写）
+// 空字符串表示不标记，返回 -1
+func DSCP(class string) (int, error) {
+	if class == "" {
+		return -1, nil
+	}
+	if dscp, ok := classes[strings.ToLower(class)]; ok {
+		return dscp, nil
+	}
+	return 0, fmt.Errorf("unknown QoS class %q (expected best_effort, bulk, transactional, interactive, realtime or a DSCP name such as af41)", class)
+}
+
+// ValidateClass 校验服务等级，空字符串合法（不标记）
+func ValidateClass(class string) error {
+	_, err := DSCP(class)
+	return err
+}
+
+// MarkClass 按服务等级标记连接，class 为空时不做任何操作
+func MarkClass(conn net.Conn, class string) error {
+	dscp, err := DSCP(class)
+	if err != nil || dscp < 0 {
+		return err
+	}
+	return Mark(conn, dscp)
+}
+
+// Mark 为连接发出的数据包设置 DSCP
+// conn 可以是 TCP 连接或包装 TCP 连接、实现 NetConn() 的连接（如 *tls.Conn）
+func Mark(conn net.Conn, dscp int) error {
+	if dscp < 0 || dscp > MaxDSCP {
+		return fmt.Errorf("DSCP out of range: %d", dscp)
+	}
+	raw, err := rawConn(conn)
+	if err != nil {
+		return err
+	}
+	ipv6 := false
+	if addr, ok := conn.LocalAddr().(*net.TCPAddr); ok {
+		ipv6 = addr.IP.To4() == nil
+	}
+	return setTOS(raw, dscp<<2, ipv6)
+}
+
+// rawConn 逐层解包，返回底层套接字
+func rawConn(conn net.Conn) (syscall.RawConn, error) {
+	for conn != nil {
+		switch c := conn.(type) {
+		case syscall.Conn:
+			return c.SyscallConn()
+		case interface{ NetConn() net.Conn }:
+			conn = c.NetConn()
+		default:
+			return nil, ErrUnsupported
+		}
+	}
+	return nil, ErrUnsupported
+}
@@ -0,0 +1,10 @@
+//go:build !(linux || darwin || freebsd)
+
+package qos
+
+import "syscall"
+
+// setTOS 当前平台不支持设置 TOS / Traffic Class
+func setTOS(c syscall.RawConn, tos int, ipv6 bool) error {
+	return ErrUnsupported
+}
@@ -0,0 +1,79 @@
+package qos
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"runtime"
+	"testing"
+)
+
+func TestDSCP(t *testing.T) {
+	tests := []struct {
+		class string
+		want  int
+	}{
+		{"", -1},
+		{ClassBestEffort, 0},
+		{ClassBulk, 8},
+		{ClassInteractive, 34},
+		{ClassRealtime, 46},
+		{"AF41", 34},
+		{"cs6", 48},
+	}
+	for _, tt := range tests {
+		got, err := DSCP(tt.class)
+		if err != nil || got != tt.want {
+			t.Errorf("DSCP(%q) = %d, %v; want %d", tt.class, got, err, tt.want)
+		}
+	}
+
+	if err := ValidateClass("platinum"); err == nil {
+		t.Error("ValidateClass(platinum) = nil, want error")
+	}
+}
+
+func TestMark(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		if conn, err := ln.Accept(); err == nil {
+			defer conn.Close()
+			conn.Read(make([]byte, 1))
+		}
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	supported := runtime.GOOS == "linux" || runtime.GOOS == "darwin" || runtime.GOOS == "freebsd"
+	for _, c := range []net.Conn{conn, tls.Client(conn, &tls.Config{InsecureSkipVerify: true})} {
+		err := MarkClass(c, ClassInteractive)
+		if supported && err != nil {
+			t.Errorf("MarkClass(%T) error = %v", c, err)
+		}
+		if !supported && !errors.Is(err, ErrUnsupported) {
+			t.Errorf("MarkClass(%T) error = %v, want ErrUnsupported", c, err)
+		}
+	}
+
+	if err := Mark(conn, 64); err == nil {
+		t.Error("Mark(64) = nil, want out of range error")
+	}
+	if err := MarkClass(conn, ""); err != nil {
+		t.Errorf("MarkClass(empty) = %v, want nil", err)
+	}
+
+	pipe, peer := net.Pipe()
+	defer pipe.Close()
+	defer peer.Close()
+	if err := Mark(pipe, 46); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Mark(net.Pipe) error = %v, want ErrUnsupported", err)
+	}
+}
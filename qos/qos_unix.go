@@ -0,0 +1,24 @@
+//go:build linux || darwin || freebsd
+
+package qos
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// setTOS 设置 IP_TOS（IPv4）或 IPV6_TCLASS（IPv6）
+func setTOS(c syscall.RawConn, tos int, ipv6 bool) error {
+	var opErr error
+	if err := c.Control(func(fd uintptr) {
+		if ipv6 {
+			opErr = unix.SetsockoptInt(int(fd), unix.IPPROTO_IPV6, unix.IPV6_TCLASS, tos)
+			return
+		}
+		opErr = unix.SetsockoptInt(int(fd), unix.IPPROTO_IP, unix.IP_TOS, tos)
+	}); err != nil {
+		return err
+	}
+	return opErr
+}
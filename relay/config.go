@@ -0,0 +1,200 @@
+// Package relay 独立数据平面中继节点：基于 transport.TunnelRelayServer，在 Controller 进程之外
+// 承载 IH ↔ AH 中继，向 Controller 注册并确认配对，使数据平面容量可独立于控制平面扩展
+package relay
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/houzhh15/sdp-common/cert"
+	"github.com/houzhh15/sdp-common/config"
+	"gopkg.in/yaml.v3"
+)
+
+// 默认值
+const (
+	DefaultListenAddr        = ":9443"
+	DefaultHeartbeatInterval = 30 * time.Second
+	DefaultDrainTimeout      = 5 * time.Minute
+)
+
+// Config 中继节点配置
+type Config struct {
+	// ListenAddr 数据平面监听地址（默认 ":9443"）
+	ListenAddr string `yaml:"listen_addr" json:"listen_addr"`
+	// AdvertiseAddr 向 Controller 注册的数据平面地址（DataPlaneAdvertiseAddrs 或 relay_chain 中引用的地址），默认 ListenAddr
+	AdvertiseAddr string `yaml:"advertise_addr" json:"advertise_addr"`
+
+	// TLS 数据平面 mTLS：服务端证书与签发 IH/AH 客户端证书的 CA
+	TLS config.TLSConfig `yaml:"tls" json:"tls"`
+
+	// Limits 连接数、缓冲区与超时
+	Limits LimitsConfig `yaml:"limits" json:"limits"`
+
+	// Controller 向 Controller 内部 RPC 注册与确认配对，未配置地址时独立运行
+	Controller ControllerConfig `yaml:"controller" json:"controller"`
+
+	// MetricsAddr Prometheus 指标与健康检查（/metrics、/healthz、/readyz）的 HTTP 监听地址，为空不启用
+	MetricsAddr string `yaml:"metrics_addr" json:"metrics_addr"`
+
+	// AcceptProxyProtocol 中继位于四层负载均衡之后时启用，要求 LB 发送 PROXY protocol v2 头
+	AcceptProxyProtocol bool `yaml:"accept_proxy_protocol" json:"accept_proxy_protocol"`
+
+	// DrainTimeout 退出时等待正在中继的隧道结束的最长时间（默认 5 分钟），到期后强制断开
+	DrainTimeout time.Duration `yaml:"drain_timeout" json:"drain_timeout"`
+
+	// LogLevel 日志级别（debug、info、warn、error，默认 info）
+	LogLevel string `yaml:"log_level" json:"log_level"`
+}
+
+// LimitsConfig 中继资源限制，零值使用默认值
+type LimitsConfig struct {
+	MaxConnections int           `yaml:"max_connections" json:"max_connections"` // 最大并发连接数（默认 10000）
+	BufferSize     int           `yaml:"buffer_size" json:"buffer_size"`         // 转发缓冲区（默认 32KB）
+	PairingTimeout time.Duration `yaml:"pairing_timeout" json:"pairing_timeout"` // 等待另一端的时间（默认 30 秒）
+	ReadTimeout    time.Duration `yaml:"read_timeout" json:"read_timeout"`       // 读超时（默认 300 秒）
+	WriteTimeout   time.Duration `yaml:"write_timeout" json:"write_timeout"`     // 写超时（默认 300 秒）
+
+	// MetricsServices / MetricsServiceLimit 按服务统计的指标单独打标签的服务名单与上限（见 transport.TunnelRelayConfig）
+	MetricsServices     []string `yaml:"metrics_services" json:"metrics_services"`
+	MetricsServiceLimit int      `yaml:"metrics_service_limit" json:"metrics_service_limit"`
+}
+
+// ControllerConfig Controller 注册配置
+// 中继节点以内部身份证书（URI SAN spiffe://<trust-domain>/relay/<id>）访问 Controller 的内部 RPC 监听
+type ControllerConfig struct {
+	// Addrs Controller 内部 RPC 地址（host:port），按顺序尝试，前一个失败时切换到下一个
+	Addrs []string `yaml:"addrs" json:"addrs"`
+
+	// CertFile / KeyFile / Key 中继内部身份证书与私钥，CAFile 签发 Controller 内部证书的 CA
+	CertFile string        `yaml:"cert_file" json:"cert_file"`
+	KeyFile  string        `yaml:"key_file" json:"key_file"`
+	Key      config.Secret `yaml:"key" json:"key"`
+	CAFile   string        `yaml:"ca_file" json:"ca_file"`
+
+	// TrustDomain 内部身份信任域（默认 cert.DefaultTrustDomain）
+	TrustDomain string `yaml:"trust_domain" json:"trust_domain"`
+
+	// HeartbeatInterval 注册心跳间隔（默认 30 秒），Controller 超过 3 个间隔未收到心跳时视为离线
+	HeartbeatInterval time.Duration `yaml:"heartbeat_interval" json:"heartbeat_interval"`
+
+	// AcceptChainPeers 接受 Controller 副本与其他中继节点以内部身份转发的多跳隧道，
+	// 并以本节点内部身份连接下一跳（内部证书须由数据平面 CA 信任）
+	AcceptChainPeers bool `yaml:"accept_chain_peers" json:"accept_chain_peers"`
+}
+
+// Enabled 是否配置了 Controller
+func (c *ControllerConfig) Enabled() bool {
+	return len(c.Addrs) > 0
+}
+
+// LoadConfig 读取 YAML 或 JSON 配置文件（按扩展名），填充默认值并校验；YAML 中的未知字段视为错误
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	cfg := &Config{}
+	switch ext := filepath.Ext(path); ext {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(cfg); err != nil {
+			return nil, fmt.Errorf("failed to parse YAML: %w", err)
+		}
+	case ".json":
+		if err := json.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("failed to parse JSON: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported config format: %s", ext)
+	}
+
+	cfg.SetDefaults()
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("config validation failed: %w", err)
+	}
+	return cfg, nil
+}
+
+// SetDefaults 填充未设置的默认值
+func (c *Config) SetDefaults() {
+	if c.ListenAddr == "" {
+		c.ListenAddr = DefaultListenAddr
+	}
+	if c.AdvertiseAddr == "" {
+		c.AdvertiseAddr = c.ListenAddr
+	}
+	if c.DrainTimeout == 0 {
+		c.DrainTimeout = DefaultDrainTimeout
+	}
+	if c.LogLevel == "" {
+		c.LogLevel = "info"
+	}
+	if c.Limits.MaxConnections == 0 {
+		c.Limits.MaxConnections = 10000
+	}
+	if c.Limits.BufferSize == 0 {
+		c.Limits.BufferSize = 32 * 1024
+	}
+	if c.Limits.PairingTimeout == 0 {
+		c.Limits.PairingTimeout = 30 * time.Second
+	}
+	if c.Limits.ReadTimeout == 0 {
+		c.Limits.ReadTimeout = 300 * time.Second
+	}
+	if c.Limits.WriteTimeout == 0 {
+		c.Limits.WriteTimeout = 300 * time.Second
+	}
+	if c.Controller.HeartbeatInterval == 0 {
+		c.Controller.HeartbeatInterval = DefaultHeartbeatInterval
+	}
+	if c.Controller.TrustDomain == "" {
+		c.Controller.TrustDomain = cert.DefaultTrustDomain
+	}
+}
+
+// Validate 校验配置
+func (c *Config) Validate() error {
+	if c.ListenAddr == "" {
+		return fmt.Errorf("listen_addr is required")
+	}
+	if c.TLS.CertFile == "" {
+		return fmt.Errorf("tls.cert_file is required")
+	}
+	if c.TLS.KeyFile == "" && !c.TLS.Key.IsSet() {
+		return fmt.Errorf("tls.key_file is required")
+	}
+	if c.TLS.CAFile == "" && len(c.TLS.CAFiles) == 0 && len(c.TLS.CADirs) == 0 {
+		return fmt.Errorf("tls.ca_file is required")
+	}
+	if _, err := c.TLS.Policy(); err != nil {
+		return fmt.Errorf("invalid tls policy: %w", err)
+	}
+	if c.Limits.MaxConnections < 0 || c.Limits.BufferSize < 0 || c.Limits.MetricsServiceLimit < 0 {
+		return fmt.Errorf("limits must not be negative")
+	}
+	if c.Limits.PairingTimeout < 0 || c.Limits.ReadTimeout < 0 || c.Limits.WriteTimeout < 0 || c.DrainTimeout < 0 {
+		return fmt.Errorf("timeouts must not be negative")
+	}
+
+	if c.Controller.Enabled() {
+		if c.Controller.CertFile == "" || (c.Controller.KeyFile == "" && !c.Controller.Key.IsSet()) {
+			return fmt.Errorf("controller.cert_file and controller.key_file are required for controller registration")
+		}
+		if c.Controller.CAFile == "" {
+			return fmt.Errorf("controller.ca_file is required for controller registration")
+		}
+		if c.Controller.HeartbeatInterval < 0 {
+			return fmt.Errorf("controller.heartbeat_interval must not be negative")
+		}
+	} else if c.Controller.AcceptChainPeers {
+		return fmt.Errorf("controller.accept_chain_peers requires a controller internal identity")
+	}
+	return nil
+}
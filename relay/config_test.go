@@ -0,0 +1,114 @@
+package relay
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfig_Defaults(t *testing.T) {
+	path := writeConfig(t, "relay.yaml", `
+tls:
+  cert_file: relay-cert.pem
+  key_file: relay-key.pem
+  ca_file: ca.pem
+controller:
+  addrs: ["ctrl-1:8444"]
+  cert_file: internal-cert.pem
+  key_file: internal-key.pem
+  ca_file: internal-ca.pem
+`)
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ListenAddr != DefaultListenAddr || cfg.AdvertiseAddr != DefaultListenAddr {
+		t.Errorf("listen/advertise = %q/%q", cfg.ListenAddr, cfg.AdvertiseAddr)
+	}
+	if cfg.Limits.MaxConnections != 10000 || cfg.Limits.BufferSize != 32*1024 || cfg.Limits.PairingTimeout != 30*time.Second {
+		t.Errorf("unexpected limits: %+v", cfg.Limits)
+	}
+	if cfg.Controller.HeartbeatInterval != DefaultHeartbeatInterval || cfg.Controller.TrustDomain == "" {
+		t.Errorf("unexpected controller defaults: %+v", cfg.Controller)
+	}
+	if cfg.DrainTimeout != DefaultDrainTimeout || cfg.LogLevel != "info" {
+		t.Errorf("drain_timeout/log_level = %v/%q", cfg.DrainTimeout, cfg.LogLevel)
+	}
+}
+
+func TestLoadConfig_Example(t *testing.T) {
+	cfg, err := LoadConfig(filepath.Join("..", "examples", "configs", "relay.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.Controller.Enabled() || cfg.MetricsAddr == "" {
+		t.Errorf("example should enable controller registration and metrics: %+v", cfg)
+	}
+}
+
+func TestLoadConfig_UnknownField(t *testing.T) {
+	path := writeConfig(t, "relay.yaml", `
+listen_adr: ":9443"
+tls:
+  cert_file: relay-cert.pem
+  key_file: relay-key.pem
+  ca_file: ca.pem
+`)
+	if _, err := LoadConfig(path); err == nil || !strings.Contains(err.Error(), "listen_adr") {
+		t.Errorf("expected unknown field error, got %v", err)
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	base := func() *Config {
+		cfg := &Config{}
+		cfg.TLS.CertFile, cfg.TLS.KeyFile, cfg.TLS.CAFile = "cert.pem", "key.pem", "ca.pem"
+		cfg.SetDefaults()
+		return cfg
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*Config)
+		errMsg string
+	}{
+		{"valid standalone", func(*Config) {}, ""},
+		{"missing tls cert", func(c *Config) { c.TLS.CertFile = "" }, "tls.cert_file"},
+		{"missing tls ca", func(c *Config) { c.TLS.CAFile = "" }, "tls.ca_file"},
+		{"negative limit", func(c *Config) { c.Limits.MaxConnections = -1 }, "must not be negative"},
+		{"negative timeout", func(c *Config) { c.Limits.PairingTimeout = -time.Second }, "must not be negative"},
+		{"controller without identity", func(c *Config) { c.Controller.Addrs = []string{"ctrl-1:8444"} }, "controller.cert_file"},
+		{"controller without ca", func(c *Config) {
+			c.Controller.Addrs = []string{"ctrl-1:8444"}
+			c.Controller.CertFile, c.Controller.KeyFile = "internal-cert.pem", "internal-key.pem"
+		}, "controller.ca_file"},
+		{"chain peers without controller", func(c *Config) { c.Controller.AcceptChainPeers = true }, "accept_chain_peers"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := base()
+			tt.modify(cfg)
+			err := cfg.Validate()
+			if tt.errMsg == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+				t.Errorf("expected error containing %q, got %v", tt.errMsg, err)
+			}
+		})
+	}
+}
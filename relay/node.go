@@ -0,0 +1,396 @@
+package relay
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/houzhh15/sdp-common/cert"
+	"github.com/houzhh15/sdp-common/logging"
+	"github.com/houzhh15/sdp-common/transport"
+	"github.com/houzhh15/sdp-common/tunnel"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// 隧道缓存：Controller 查询结果保留 tunnelCacheTTL，查询失败的隧道 tunnelMissTTL 内不再查询
+const (
+	tunnelCacheTTL      = time.Minute
+	tunnelMissTTL       = 30 * time.Second
+	tunnelLookupTimeout = time.Second
+)
+
+// Node 独立中继节点：数据平面 mTLS 监听、Controller 注册心跳、配对确认与指标端点
+type Node struct {
+	config    *Config
+	logger    logging.Logger
+	server    transport.TunnelRelayServer
+	tlsConfig *tls.Config
+
+	// identity 本节点内部身份，controller 为 Controller 内部 RPC 客户端；未配置 Controller 时均为 nil
+	identity   *cert.ServiceIdentity
+	controller *controllerClient
+	tunnels    *tunnelCache
+
+	draining atomic.Bool
+}
+
+// New 加载证书并创建中继节点（不监听，见 Run）
+func New(cfg *Config, logger logging.Logger) (*Node, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	if logger == nil {
+		return nil, errors.New("logger is required")
+	}
+
+	keyPEM, err := cfg.TLS.Key.Resolve(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve data plane private key: %w", err)
+	}
+	policy, err := cfg.TLS.Policy()
+	if err != nil {
+		return nil, fmt.Errorf("invalid tls policy: %w", err)
+	}
+	dataPlane, err := cert.NewManager(&cert.Config{
+		CertFile:  cfg.TLS.CertFile,
+		KeyFile:   cfg.TLS.KeyFile,
+		CAFile:    cfg.TLS.CAFile,
+		CAFiles:   cfg.TLS.CAFiles,
+		CADirs:    cfg.TLS.CADirs,
+		KeyPEM:    keyPEM,
+		TLSPolicy: policy,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load data plane certificates: %w", err)
+	}
+
+	n := &Node{config: cfg, logger: logger}
+	n.tlsConfig = dataPlane.GetTLSConfig()
+	n.tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+
+	relayConfig := &transport.TunnelRelayConfig{
+		PairingTimeout: cfg.Limits.PairingTimeout,
+		BufferSize:     cfg.Limits.BufferSize,
+		ReadTimeout:    cfg.Limits.ReadTimeout,
+		WriteTimeout:   cfg.Limits.WriteTimeout,
+		MaxConnections: cfg.Limits.MaxConnections,
+
+		AcceptProxyProtocol: cfg.AcceptProxyProtocol,
+		MetricsServices:     cfg.Limits.MetricsServices,
+		MetricsServiceLimit: cfg.Limits.MetricsServiceLimit,
+	}
+
+	if cfg.Controller.Enabled() {
+		internal, err := n.loadInternalIdentity()
+		if err != nil {
+			return nil, err
+		}
+		controllerPolicy := &cert.InternalPeerPolicy{TrustDomain: cfg.Controller.TrustDomain, AllowedRoles: []string{cert.RoleController}}
+		n.controller = &controllerClient{
+			addrs: cfg.Controller.Addrs,
+			httpClient: &http.Client{
+				Transport: &http.Transport{TLSClientConfig: internal.GetInternalClientTLSConfig(controllerPolicy)},
+			},
+		}
+		n.tunnels = newTunnelCache(n.controller.getTunnel)
+
+		// 中继按服务统计指标、按 QoS 等级标记连接、以 trace ID 作为配对耗时 exemplar，隧道信息来自 Controller
+		relayConfig.ServiceResolver = func(tunnelID string) string {
+			if tun := n.tunnels.get(tunnelID); tun != nil {
+				return tun.ServiceID
+			}
+			return ""
+		}
+		relayConfig.QoSResolver = func(tunnelID string) string {
+			if tun := n.tunnels.get(tunnelID); tun != nil {
+				return tun.QoSClass()
+			}
+			return ""
+		}
+		relayConfig.TraceResolver = func(tunnelID string) string {
+			if tun := n.tunnels.get(tunnelID); tun != nil {
+				return tun.TraceID()
+			}
+			return ""
+		}
+		relayConfig.OnPaired = func(tunnelID string) {
+			go n.reportPaired(tunnelID)
+		}
+
+		if cfg.Controller.AcceptChainPeers {
+			// 多跳隧道：以内部身份连接下一跳，接受 Controller 副本与其他中继节点转发的连接
+			chainTLS := internal.GetTLSConfig()
+			chainTLS.ClientCAs = nil
+			chainTLS.ClientAuth = tls.NoClientCert
+			chainTLS.GetConfigForClient = nil
+			chainTLS.RootCAs = dataPlane.GetCAPool()
+			relayConfig.ChainTLSConfig = chainTLS
+			relayConfig.ChainPeers = &cert.InternalPeerPolicy{
+				TrustDomain:  cfg.Controller.TrustDomain,
+				AllowedRoles: []string{cert.RoleController, cert.RoleRelay},
+			}
+		}
+	}
+
+	n.server = transport.NewTunnelRelayServer(logger, relayConfig)
+	return n, nil
+}
+
+// loadInternalIdentity 加载中继内部身份证书，身份须为 relay 角色
+func (n *Node) loadInternalIdentity() (*cert.Manager, error) {
+	cfg := &n.config.Controller
+	keyPEM, err := cfg.Key.Resolve(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve internal private key: %w", err)
+	}
+	manager, err := cert.NewManager(&cert.Config{
+		CertFile: cfg.CertFile,
+		KeyFile:  cfg.KeyFile,
+		CAFile:   cfg.CAFile,
+		KeyPEM:   keyPEM,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load internal identity certificate: %w", err)
+	}
+
+	identity, err := cert.ParseServiceIdentity(manager.GetX509Certificate(), cfg.TrustDomain)
+	if err != nil {
+		return nil, fmt.Errorf("invalid internal identity certificate: %w", err)
+	}
+	if identity.Role != cert.RoleRelay {
+		return nil, fmt.Errorf("internal identity %s is not a relay identity", identity)
+	}
+	n.identity = identity
+	return manager, nil
+}
+
+// Identity 本节点内部身份，未配置 Controller 时为 nil
+func (n *Node) Identity() *cert.ServiceIdentity {
+	return n.identity
+}
+
+// Server 底层中继服务器（统计、隧道列表）
+func (n *Node) Server() transport.TunnelRelayServer {
+	return n.server
+}
+
+// Run 启动数据平面与指标监听，向 Controller 注册并周期心跳；ctx 取消后排空隧道、注销并返回
+func (n *Node) Run(ctx context.Context) error {
+	ln, err := net.Listen("tcp", n.config.ListenAddr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", n.config.ListenAddr, err)
+	}
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- n.server.Serve(ln, n.tlsConfig)
+	}()
+	select {
+	case <-n.server.Ready():
+	case err := <-serveErr:
+		return err
+	}
+
+	var metrics *http.Server
+	if n.config.MetricsAddr != "" {
+		metrics, err = n.startMetrics()
+		if err != nil {
+			n.server.Stop()
+			return err
+		}
+	}
+
+	var wg sync.WaitGroup
+	heartbeatCtx, stopHeartbeat := context.WithCancel(ctx)
+	if n.controller != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			n.heartbeat(heartbeatCtx)
+		}()
+	}
+
+	n.logger.Info("Relay node started",
+		"addr", ln.Addr().String(),
+		"advertise_addr", n.config.AdvertiseAddr,
+		"controllers", len(n.config.Controller.Addrs),
+		"metrics_addr", n.config.MetricsAddr)
+
+	var runErr error
+	select {
+	case <-ctx.Done():
+	case runErr = <-serveErr:
+		n.logger.Error("Relay server stopped unexpectedly", "error", runErr)
+	}
+	stopHeartbeat()
+	wg.Wait()
+
+	// 先向 Controller 通告排空，再等待正在中继的隧道结束
+	n.draining.Store(true)
+	n.sendRegistration(context.Background())
+	drainCtx, cancel := context.WithTimeout(context.Background(), n.config.DrainTimeout)
+	if err := n.server.Drain(drainCtx); err != nil {
+		n.logger.Warn("Relay drain timed out", "timeout", n.config.DrainTimeout)
+	}
+	cancel()
+	n.server.Stop()
+
+	if n.controller != nil {
+		if err := n.controller.deregister(context.Background(), n.identity.ID); err != nil {
+			n.logger.Warn("Failed to deregister from controller", "error", err)
+		}
+	}
+	if metrics != nil {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		metrics.Shutdown(shutdownCtx)
+		cancel()
+	}
+	n.logger.Info("Relay node stopped")
+	return runErr
+}
+
+// startMetrics 启动指标与健康检查监听：/metrics（OpenMetrics 协商，含 exemplar）、/healthz、/readyz（排空中返回 503）
+func (n *Node) startMetrics() (*http.Server, error) {
+	ln, err := net.Listen("tcp", n.config.MetricsAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on metrics addr %s: %w", n.config.MetricsAddr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer,
+		promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: true})))
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("OK"))
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if n.draining.Load() {
+			http.Error(w, "draining", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("OK"))
+	})
+
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			n.logger.Error("Metrics server error", "error", err)
+		}
+	}()
+	return server, nil
+}
+
+// heartbeat 立即注册，之后按 HeartbeatInterval 刷新注册并清理过期的隧道缓存
+func (n *Node) heartbeat(ctx context.Context) {
+	ticker := time.NewTicker(n.config.Controller.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		n.sendRegistration(ctx)
+		n.tunnels.prune(time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sendRegistration 向 Controller 上报本节点地址与负载
+func (n *Node) sendRegistration(ctx context.Context) {
+	if n.controller == nil {
+		return
+	}
+	if err := n.controller.register(ctx, n.registration()); err != nil && ctx.Err() == nil {
+		n.logger.Warn("Failed to register with controller", "error", err)
+	}
+}
+
+// registration 当前注册信息
+func (n *Node) registration() *Registration {
+	stats := n.server.GetStats()
+	return &Registration{
+		NodeID:             n.identity.ID,
+		AdvertiseAddr:      n.config.AdvertiseAddr,
+		Version:            Version,
+		MaxConnections:     n.config.Limits.MaxConnections,
+		ActiveTunnels:      stats.ActiveTunnels,
+		PendingConnections: stats.PendingConnections,
+		HeartbeatInterval:  n.config.Controller.HeartbeatInterval,
+		Draining:           n.draining.Load(),
+	}
+}
+
+// reportPaired 向 Controller 确认配对；Controller 已将隧道判定为失败（409）时断开该隧道
+func (n *Node) reportPaired(tunnelID string) {
+	err := n.controller.reportPaired(context.Background(), tunnelID)
+	if err == nil {
+		return
+	}
+	var statusErr *rpcStatusError
+	if errors.As(err, &statusErr) && statusErr.status == http.StatusConflict {
+		n.logger.Warn("Controller rejected pairing of failed tunnel", "tunnel_id", tunnelID)
+		n.server.CloseTunnelWithReason(tunnelID, string(transport.CloseReasonRejected))
+		return
+	}
+	n.logger.Warn("Failed to report pairing to controller", "tunnel_id", tunnelID, "error", err)
+}
+
+// tunnelCache 缓存从 Controller 查询的隧道
+type tunnelCache struct {
+	lookup func(ctx context.Context, tunnelID string) (*tunnel.Tunnel, error)
+
+	mu      sync.Mutex
+	entries map[string]*tunnelCacheEntry
+}
+
+type tunnelCacheEntry struct {
+	tunnel  *tunnel.Tunnel // 查询失败时为 nil
+	expires time.Time
+}
+
+func newTunnelCache(lookup func(ctx context.Context, tunnelID string) (*tunnel.Tunnel, error)) *tunnelCache {
+	return &tunnelCache{lookup: lookup, entries: make(map[string]*tunnelCacheEntry)}
+}
+
+// get 返回隧道，缓存未命中时同步查询 Controller（超时 tunnelLookupTimeout）；查询失败返回 nil
+func (c *tunnelCache) get(tunnelID string) *tunnel.Tunnel {
+	now := time.Now()
+	c.mu.Lock()
+	entry, ok := c.entries[tunnelID]
+	c.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.tunnel
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), tunnelLookupTimeout)
+	defer cancel()
+	tun, err := c.lookup(ctx, tunnelID)
+	entry = &tunnelCacheEntry{tunnel: tun, expires: now.Add(tunnelCacheTTL)}
+	if err != nil {
+		entry = &tunnelCacheEntry{expires: now.Add(tunnelMissTTL)}
+	}
+
+	c.mu.Lock()
+	c.entries[tunnelID] = entry
+	c.mu.Unlock()
+	return entry.tunnel
+}
+
+// prune 删除过期条目
+func (c *tunnelCache) prune(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, id)
+		}
+	}
+}
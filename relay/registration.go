@@ -0,0 +1,143 @@
+package relay
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/houzhh15/sdp-common/tunnel"
+)
+
+// Version 中继节点版本，随注册上报；发布构建以
+// -ldflags "-X github.com/houzhh15/sdp-common/relay.Version=v1.2.3" 写入
+var Version = "dev"
+
+// defaultRPCTimeout 访问 Controller 内部 RPC 的单次请求超时
+const defaultRPCTimeout = 5 * time.Second
+
+// Registration 中继节点注册信息（PUT /internal/v1/relays/{id}），按心跳间隔重复发送以上报负载
+type Registration struct {
+	NodeID             string        `json:"node_id"`        // 内部身份 ID（spiffe://<trust-domain>/relay/<id>）
+	AdvertiseAddr      string        `json:"advertise_addr"` // 数据平面地址
+	Version            string        `json:"version,omitempty"`
+	MaxConnections     int           `json:"max_connections"`
+	ActiveTunnels      int           `json:"active_tunnels"`
+	PendingConnections int           `json:"pending_connections"`
+	HeartbeatInterval  time.Duration `json:"heartbeat_interval"`
+	Draining           bool          `json:"draining,omitempty"` // 排空中，不应再为其分配新隧道
+}
+
+// controllerClient 以中继内部身份访问 Controller 内部 RPC（/internal/v1）
+// 注册发送给所有 Controller 副本；隧道只保存在创建它的副本上，查询与配对确认依次尝试各副本
+type controllerClient struct {
+	addrs      []string
+	httpClient *http.Client
+}
+
+// register 向所有副本注册或刷新本节点（心跳），至少一个副本成功时返回 nil
+func (c *controllerClient) register(ctx context.Context, reg *Registration) error {
+	body, err := json.Marshal(reg)
+	if err != nil {
+		return fmt.Errorf("failed to encode registration: %w", err)
+	}
+	return c.broadcast(ctx, http.MethodPut, "/internal/v1/relays/"+reg.NodeID, body)
+}
+
+// deregister 退出时向所有副本注销本节点
+func (c *controllerClient) deregister(ctx context.Context, nodeID string) error {
+	return c.broadcast(ctx, http.MethodDelete, "/internal/v1/relays/"+nodeID, nil)
+}
+
+// reportPaired 确认隧道已在本节点完成配对
+func (c *controllerClient) reportPaired(ctx context.Context, tunnelID string) error {
+	return c.do(ctx, http.MethodPost, "/internal/v1/tunnels/"+tunnelID+"/paired", nil, http.StatusNoContent, nil)
+}
+
+// getTunnel 查询隧道（服务 ID、QoS 等级、trace ID）
+func (c *controllerClient) getTunnel(ctx context.Context, tunnelID string) (*tunnel.Tunnel, error) {
+	var tun tunnel.Tunnel
+	if err := c.do(ctx, http.MethodGet, "/internal/v1/tunnels/"+tunnelID, nil, http.StatusOK, &tun); err != nil {
+		return nil, err
+	}
+	return &tun, nil
+}
+
+// broadcast 向所有副本发送期望 204 的请求，全部失败时返回最后一个错误
+func (c *controllerClient) broadcast(ctx context.Context, method, path string, body []byte) error {
+	var lastErr error
+	succeeded := false
+	for _, addr := range c.addrs {
+		if err := c.doOnce(ctx, addr, method, path, body, http.StatusNoContent, nil); err != nil {
+			lastErr = err
+			continue
+		}
+		succeeded = true
+	}
+	if succeeded {
+		return nil
+	}
+	return lastErr
+}
+
+// do 依次向各副本发送请求直到成功；404（隧道在其他副本）、5xx 与网络错误时尝试下一个，其他 4xx 为确定结果
+func (c *controllerClient) do(ctx context.Context, method, path string, body []byte, want int, out interface{}) error {
+	var lastErr error
+	for _, addr := range c.addrs {
+		err := c.doOnce(ctx, addr, method, path, body, want, out)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		var statusErr *rpcStatusError
+		if errors.As(err, &statusErr) && statusErr.status < http.StatusInternalServerError && statusErr.status != http.StatusNotFound {
+			return err
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+	}
+	return lastErr
+}
+
+func (c *controllerClient) doOnce(ctx context.Context, addr, method, path string, body []byte, want int, out interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, defaultRPCTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, "https://"+addr+path, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("internal rpc %s %s: %w", addr, path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != want {
+		return &rpcStatusError{path: path, status: resp.StatusCode}
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
+	}
+	return nil
+}
+
+// rpcStatusError Controller 返回了非预期的状态码
+type rpcStatusError struct {
+	path   string
+	status int
+}
+
+func (e *rpcStatusError) Error() string {
+	return fmt.Sprintf("internal rpc %s: status %d", e.path, e.status)
+}
@@ -0,0 +1,120 @@
+package relay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/houzhh15/sdp-common/tunnel"
+)
+
+// newControllerClient 以 httptest TLS 服务模拟 Controller 副本（各副本共用同一测试 CA）
+func newControllerClient(t *testing.T, handlers ...http.HandlerFunc) *controllerClient {
+	t.Helper()
+	client := &controllerClient{}
+	for _, h := range handlers {
+		server := httptest.NewTLSServer(h)
+		t.Cleanup(server.Close)
+		client.addrs = append(client.addrs, strings.TrimPrefix(server.URL, "https://"))
+		client.httpClient = server.Client()
+	}
+	return client
+}
+
+func TestControllerClient_RegisterBroadcast(t *testing.T) {
+	var registered atomic.Int32
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		var reg Registration
+		if r.Method != http.MethodPut || r.URL.Path != "/internal/v1/relays/relay-1" || json.NewDecoder(r.Body).Decode(&reg) != nil || reg.NodeID != "relay-1" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		registered.Add(1)
+		w.WriteHeader(http.StatusNoContent)
+	}
+	down := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	client := newControllerClient(t, ok, down, ok)
+	if err := client.register(context.Background(), &Registration{NodeID: "relay-1", AdvertiseAddr: "relay-1:9443"}); err != nil {
+		t.Fatal(err)
+	}
+	if registered.Load() != 2 {
+		t.Errorf("registration should reach every replica, got %d", registered.Load())
+	}
+
+	client = newControllerClient(t, down, down)
+	if err := client.register(context.Background(), &Registration{NodeID: "relay-1"}); err == nil {
+		t.Error("expected error when no replica accepts the registration")
+	}
+}
+
+func TestControllerClient_Failover(t *testing.T) {
+	notFound := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}
+	found := func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&tunnel.Tunnel{ID: "tun-1", ServiceID: "svc-1"})
+	}
+	conflict := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusConflict)
+	}
+
+	// 隧道只保存在创建它的副本上：404 时尝试下一个副本
+	tun, err := newControllerClient(t, notFound, found).getTunnel(context.Background(), "tun-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tun.ServiceID != "svc-1" {
+		t.Errorf("service = %q", tun.ServiceID)
+	}
+
+	// 其他 4xx 为确定结果，不再尝试后续副本
+	var calls atomic.Int32
+	counted := func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusNoContent)
+	}
+	err = newControllerClient(t, conflict, counted).reportPaired(context.Background(), "tun-1")
+	var statusErr *rpcStatusError
+	if !errors.As(err, &statusErr) || statusErr.status != http.StatusConflict {
+		t.Fatalf("expected 409 status error, got %v", err)
+	}
+	if calls.Load() != 0 {
+		t.Error("conflict must not fail over to the next replica")
+	}
+}
+
+func TestTunnelCache(t *testing.T) {
+	var lookups atomic.Int32
+	cache := newTunnelCache(func(ctx context.Context, tunnelID string) (*tunnel.Tunnel, error) {
+		lookups.Add(1)
+		if tunnelID == "missing" {
+			return nil, errors.New("not found")
+		}
+		return &tunnel.Tunnel{ID: tunnelID, ServiceID: "svc-1"}, nil
+	})
+
+	for i := 0; i < 3; i++ {
+		if tun := cache.get("tun-1"); tun == nil || tun.ServiceID != "svc-1" {
+			t.Fatalf("get = %+v", tun)
+		}
+		if tun := cache.get("missing"); tun != nil {
+			t.Fatalf("missing tunnel = %+v", tun)
+		}
+	}
+	if lookups.Load() != 2 {
+		t.Errorf("hits and misses should be cached, lookups = %d", lookups.Load())
+	}
+
+	cache.prune(cache.entries["missing"].expires)
+	if len(cache.entries) != 1 {
+		t.Errorf("only the expired miss should be pruned, left %d", len(cache.entries))
+	}
+}
@@ -9,8 +9,11 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	neturl "net/url"
 	"sync"
 	"time"
+
+	"github.com/houzhh15/sdp-common/egress"
 )
 
 // Client handles service registration with Controller
@@ -23,6 +26,11 @@ type Client struct {
 	mu       sync.RWMutex
 	services map[string]*Service
 	stopChan chan struct{}
+
+	// Validators and result of the last successful Fetch, for conditional requests
+	fetchETag         string
+	fetchLastModified string
+	fetched           []Service
 }
 
 // Service represents a service configuration
@@ -70,10 +78,11 @@ type HeartbeatResponse struct {
 
 // Config contains configuration for service client
 type Config struct {
-	ControllerURL string        // Controller API base URL
-	TLSConfig     *tls.Config   // TLS configuration for mTLS
-	AgentID       string        // Agent identifier
-	Timeout       time.Duration // HTTP timeout (default: 10s)
+	ControllerURL string         // Controller API base URL
+	TLSConfig     *tls.Config    // TLS configuration for mTLS
+	AgentID       string         // Agent identifier
+	Timeout       time.Duration  // HTTP timeout (default: 10s)
+	Proxy         *egress.Config // Outbound proxy (default: HTTPS_PROXY / NO_PROXY)
 }
 
 // NewClient creates a new service registration client
@@ -86,6 +95,7 @@ func NewClient(config *Config) *Client {
 		httpClient: &http.Client{
 			Transport: &http.Transport{
 				TLSClientConfig: config.TLSConfig,
+				Proxy:           config.Proxy.ProxyFunc(),
 			},
 			Timeout: config.Timeout,
 		},
@@ -145,50 +155,84 @@ func (c *Client) Register(ctx context.Context, services []Service) error {
 	return nil
 }
 
-// Fetch fetches the list of services from Controller
+// Fetch fetches the list of services from Controller.
+// The request is conditional: when the list has not changed since the last
+// Fetch the Controller answers 304 and the previous result is returned
 func (c *Client) Fetch(ctx context.Context) ([]Service, error) {
+	services, _, err := c.FetchIfChanged(ctx)
+	return services, err
+}
+
+// FetchIfChanged is Fetch that also reports whether the list changed since
+// the last successful fetch (always true for the first one)
+func (c *Client) FetchIfChanged(ctx context.Context) ([]Service, bool, error) {
 	url := c.controllerURL + "/api/v1/services"
 
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return nil, fmt.Errorf("create request: %w", err)
+		return nil, false, fmt.Errorf("create request: %w", err)
+	}
+	c.mu.RLock()
+	if c.fetched != nil {
+		if c.fetchETag != "" {
+			req.Header.Set("If-None-Match", c.fetchETag)
+		} else if c.fetchLastModified != "" {
+			req.Header.Set("If-Modified-Since", c.fetchLastModified)
+		}
 	}
+	c.mu.RUnlock()
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("send request: %w", err)
+		return nil, false, fmt.Errorf("send request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("read response: %w", err)
+		return nil, false, fmt.Errorf("read response: %w", err)
+	}
+
+	if resp.StatusCode == http.StatusNotModified {
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+		if c.fetched == nil {
+			return nil, false, fmt.Errorf("fetch failed: not modified without cached services")
+		}
+		return append([]Service(nil), c.fetched...), false, nil
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("fetch failed (status %d): %s", resp.StatusCode, string(body))
+		return nil, false, fmt.Errorf("fetch failed (status %d): %s", resp.StatusCode, string(body))
 	}
 
 	var fetchResp FetchResponse
 	if err := json.Unmarshal(body, &fetchResp); err != nil {
-		return nil, fmt.Errorf("parse response: %w", err)
+		return nil, false, fmt.Errorf("parse response: %w", err)
+	}
+	if fetchResp.Services == nil {
+		fetchResp.Services = []Service{}
 	}
 
 	// Update cache
 	c.mu.Lock()
 	c.services = make(map[string]*Service)
 	for i := range fetchResp.Services {
-		svc := &fetchResp.Services[i]
-		c.services[svc.ID] = svc
+		svc := fetchResp.Services[i]
+		c.services[svc.ID] = &svc
 	}
+	c.fetchETag = resp.Header.Get("ETag")
+	c.fetchLastModified = resp.Header.Get("Last-Modified")
+	c.fetched = fetchResp.Services
 	c.mu.Unlock()
 
-	return fetchResp.Services, nil
+	return append([]Service(nil), fetchResp.Services...), true, nil
 }
 
-// Unregister unregisters a service from Controller
+// Unregister unregisters a service from Controller.
+// Only services registered by this agent can be unregistered
 func (c *Client) Unregister(ctx context.Context, serviceID string) error {
-	url := fmt.Sprintf("%s/api/v1/services/%s", c.controllerURL, serviceID)
+	url := fmt.Sprintf("%s/api/v1/services/%s?agent_id=%s", c.controllerURL, neturl.PathEscape(serviceID), neturl.QueryEscape(c.agentID))
 
 	req, err := http.NewRequestWithContext(ctx, "DELETE", url, nil)
 	if err != nil {
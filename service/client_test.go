@@ -1,11 +1,16 @@
 package service
 
 import (
+	"context"
 	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNewClient(t *testing.T) {
@@ -172,3 +177,43 @@ func TestStop(t *testing.T) {
 		t.Error("stopChan should be closed")
 	}
 }
+
+func TestFetchIfChanged(t *testing.T) {
+	version := "\"v1\""
+	services := []Service{{ID: "svc-1", TargetHost: "localhost", TargetPort: 8080}}
+	var conditional []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conditional = append(conditional, r.Header.Get("If-None-Match"))
+		w.Header().Set("ETag", version)
+		if r.Header.Get("If-None-Match") == version {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		json.NewEncoder(w).Encode(FetchResponse{Status: "success", Services: services, Count: len(services)})
+	}))
+	defer server.Close()
+
+	client := NewClient(&Config{ControllerURL: server.URL, AgentID: "agent-123"})
+	ctx := context.Background()
+
+	got, changed, err := client.FetchIfChanged(ctx)
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Len(t, got, 1)
+
+	// Unchanged: the previous result is returned
+	got, changed, err = client.FetchIfChanged(ctx)
+	require.NoError(t, err)
+	assert.False(t, changed)
+	require.Len(t, got, 1)
+	assert.Equal(t, "svc-1", got[0].ID)
+
+	version = "\"v2\""
+	services = append(services, Service{ID: "svc-2", TargetHost: "localhost", TargetPort: 8081})
+	got, err = client.Fetch(ctx)
+	require.NoError(t, err)
+	assert.Len(t, got, 2)
+	assert.Len(t, client.GetServices(), 2)
+
+	assert.Equal(t, []string{"", "\"v1\"", "\"v1\""}, conditional)
+}
@@ -2,21 +2,84 @@ package session
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
 
+	"github.com/houzhh15/sdp-common/clock"
+	"github.com/houzhh15/sdp-common/device"
+	"github.com/houzhh15/sdp-common/faults"
 	"github.com/houzhh15/sdp-common/logging"
 )
 
-// DeviceInfo 设备信息（新增）
-type DeviceInfo struct {
-	DeviceID   string `json:"device_id"`
-	OS         string `json:"os"`
-	OSVersion  string `json:"os_version"`
-	Compliance bool   `json:"compliance"`
+// ErrSessionLifetimeExceeded 会话已达到最大生命周期或刷新次数上限，不可再刷新，客户端需重新握手
+var ErrSessionLifetimeExceeded = errors.New("SESSION_LIFETIME_EXCEEDED: re-handshake required")
+
+// ErrSessionLimitReached 客户端的活跃会话已达上限且并发策略为 reject-new，新会话被拒绝
+var ErrSessionLimitReached = errors.New("SESSION_LIMIT_REACHED: client already has an active session")
+
+// ConcurrencyMode 同一客户端多个会话的并发策略（CreateSession 时生效）
+type ConcurrencyMode string
+
+const (
+	ConcurrencyAllowMultiple ConcurrencyMode = "allow-multiple" // 不限制（默认）
+	ConcurrencyRevokeOldest  ConcurrencyMode = "revoke-oldest"  // 超出上限时撤销最早创建的会话
+	ConcurrencyRejectNew     ConcurrencyMode = "reject-new"     // 超出上限时拒绝新会话
+)
+
+// Validate 验证并发策略（空值等同 allow-multiple）
+func (c ConcurrencyMode) Validate() error {
+	switch c {
+	case "", ConcurrencyAllowMultiple, ConcurrencyRevokeOldest, ConcurrencyRejectNew:
+		return nil
+	default:
+		return fmt.Errorf("invalid session concurrency mode: %s", c)
+	}
+}
+
+// RevokeReasonSessionLimit 会话因并发上限被新会话取代
+const RevokeReasonSessionLimit = "session_limit"
+
+// RevokeReasonPostureDrift 会话的设备指纹与握手时不一致，按 DriftPolicyRevoke 撤销
+const RevokeReasonPostureDrift = "posture_drift"
+
+// DriftPolicy 会话设备指纹漂移的处理策略
+type DriftPolicy string
+
+const (
+	DriftPolicyFlag   DriftPolicy = "flag"   // 记录安全事件，会话继续有效（默认）
+	DriftPolicyRevoke DriftPolicy = "revoke" // 记录安全事件并撤销会话
+)
+
+// Validate 校验漂移处理策略取值（空值视为 flag）
+func (p DriftPolicy) Validate() error {
+	switch p {
+	case "", DriftPolicyFlag, DriftPolicyRevoke:
+		return nil
+	}
+	return fmt.Errorf("invalid device posture drift policy: %s (valid: %s, %s)", p, DriftPolicyFlag, DriftPolicyRevoke)
 }
 
+// PostureDrift 一次设备指纹漂移（ObservePosture 返回）
+type PostureDrift struct {
+	ClientID string
+	Token    string
+	Expected string // 会话此前记录的指纹
+	Observed string // 本次请求携带的指纹
+	Drifts   int    // 该会话累计漂移次数（含本次）
+}
+
+// ForcedRevocation 会话被强制撤销的通知（非客户端主动登出）
+type ForcedRevocation struct {
+	Session  *Session // 被撤销的会话
+	Reason   string   // 撤销原因，如 RevokeReasonSessionLimit
+	NewToken string   // 取代它的新会话 Token
+}
+
+// DeviceInfo 设备信息（与握手、策略评估共用 device.Info）
+type DeviceInfo = device.Info
+
 // Session 会话对象（扩展原有定义）
 type Session struct {
 	Token           string                 `json:"token"`
@@ -26,7 +89,15 @@ type Session struct {
 	CreatedAt       time.Time              `json:"created_at"`
 	ExpiresAt       time.Time              `json:"expires_at"`
 	LastAccessAt    time.Time              `json:"last_access_at"` // 新增
+	ClientClass     string                 `json:"client_class,omitempty"`
+	MaxExpiresAt    time.Time              `json:"max_expires_at,omitempty"` // 绝对过期上限，刷新不可超过；零值表示不限
+	RefreshCount    int                    `json:"refresh_count"`
 	Metadata        map[string]interface{} `json:"metadata,omitempty"`
+	// PostureHash 设备指纹（device.Info.PostureHash），握手时记录，漂移后更新为最新值
+	PostureHash   string `json:"posture_hash,omitempty"`
+	PostureDrifts int    `json:"posture_drifts,omitempty"` // 累计检测到的设备漂移次数
+	// Tenant 客户端所属租户（由证书身份声明映射提取），未配置时为空
+	Tenant string `json:"tenant,omitempty"`
 }
 
 // CreateSessionRequest 创建会话请求
@@ -34,7 +105,17 @@ type CreateSessionRequest struct {
 	ClientID        string
 	CertFingerprint string
 	DeviceInfo      *DeviceInfo
+	ClientClass     string // 客户端类别（如 admin、service），用于匹配 Config.ClientClasses
+	Tenant          string // 客户端所属租户（可选）
 	Metadata        map[string]interface{}
+	// Replaces 新会话取代的会话 Token（如会话转移，由调用方随后撤销），不计入并发上限
+	Replaces string
+}
+
+// ClassPolicy 客户端类别的会话有效期策略
+type ClassPolicy struct {
+	TTL         time.Duration `json:"ttl" yaml:"ttl"`                   // 创建/刷新后的有效期，0 表示使用全局 TokenTTL
+	MaxLifetime time.Duration `json:"max_lifetime" yaml:"max_lifetime"` // 自创建起的绝对有效期上限，0 表示不限
 }
 
 // Manager 会话管理器（合并 session.Manager 和 session.Registry）
@@ -44,14 +125,49 @@ type Manager struct {
 	mu              sync.RWMutex
 	tokenTTL        time.Duration
 	cleanupInterval time.Duration
+	tokenGenerator  TokenGenerator
+	clientClasses   map[string]*ClassPolicy
+	maxLifetime     time.Duration
+	maxRefreshCount int
+	clockSkew       time.Duration
+	concurrency     ConcurrencyMode
+	maxPerClient    int
+	onForcedRevoke  func(*ForcedRevocation)
 	logger          logging.Logger
+	clock           clock.Clock
 	stopChan        chan struct{}
+	doneChan        chan struct{} // 后台清理 goroutine 退出后关闭
+	closeOnce       sync.Once
 }
 
 // Config 管理器配置
 type Config struct {
-	TokenTTL        time.Duration // Token 有效期，默认 3600s
-	CleanupInterval time.Duration // 清理间隔，默认 300s (5分钟)
+	TokenTTL        time.Duration  // Token 有效期，默认 3600s
+	CleanupInterval time.Duration  // 清理间隔，默认 300s (5分钟)
+	TokenGenerator  TokenGenerator // Token 生成器，默认 RandomTokenGenerator（crypto/rand）
+
+	// ClientClasses 按客户端类别覆盖有效期（如 admin: 30m，service: 24h）
+	ClientClasses map[string]*ClassPolicy
+
+	// MaxSessionLifetime 会话自创建起的绝对有效期上限，0 表示不限
+	// 与类别 MaxLifetime 同时设置时取较小值
+	MaxSessionLifetime time.Duration
+	// MaxRefreshCount 单个会话最多刷新次数，0 表示不限
+	MaxRefreshCount int
+
+	// ClockSkewTolerance 过期判断允许的时钟偏差：会话在 ExpiresAt 之后该时长内仍可校验和刷新，
+	// 避免客户端时钟略快时按本地时间临界刷新失败；不影响 MaxExpiresAt 上限，默认 0
+	ClockSkewTolerance time.Duration
+
+	// Concurrency 同一客户端的并发会话策略，默认 allow-multiple；MaxSessionsPerClient 为
+	// revoke-oldest / reject-new 下每个客户端的活跃会话上限，默认 1（单会话）
+	Concurrency          ConcurrencyMode
+	MaxSessionsPerClient int
+	// OnForcedRevocation 会话被并发策略强制撤销后调用（在锁外），用于通知客户端与审计
+	OnForcedRevocation func(*ForcedRevocation)
+
+	// Clock 时钟（过期判断、清理周期），默认真实时钟；测试可注入 clock.NewFake
+	Clock clock.Clock
 }
 
 // NewManager 创建会话管理器（复用 session.go 逻辑）
@@ -62,15 +178,39 @@ func NewManager(cfg *Config, logger logging.Logger) *Manager {
 	if cfg.CleanupInterval == 0 {
 		cfg.CleanupInterval = 300 * time.Second // 默认 5 分钟
 	}
+	if cfg.TokenGenerator == nil {
+		cfg.TokenGenerator = &RandomTokenGenerator{}
+	}
+	if cfg.Concurrency == "" {
+		cfg.Concurrency = ConcurrencyAllowMultiple
+	}
+	if cfg.MaxSessionsPerClient <= 0 {
+		cfg.MaxSessionsPerClient = 1
+	}
 
-	return &Manager{
+	m := &Manager{
 		sessions:        make(map[string]*Session),
 		clientSessions:  make(map[string][]string),
 		tokenTTL:        cfg.TokenTTL,
 		cleanupInterval: cfg.CleanupInterval,
+		tokenGenerator:  cfg.TokenGenerator,
+		clientClasses:   cfg.ClientClasses,
+		maxLifetime:     cfg.MaxSessionLifetime,
+		maxRefreshCount: cfg.MaxRefreshCount,
+		clockSkew:       cfg.ClockSkewTolerance,
+		concurrency:     cfg.Concurrency,
+		maxPerClient:    cfg.MaxSessionsPerClient,
+		onForcedRevoke:  cfg.OnForcedRevocation,
 		logger:          logger,
+		clock:           clock.Or(cfg.Clock),
 		stopChan:        make(chan struct{}),
+		doneChan:        make(chan struct{}),
 	}
+
+	// 后台清理随管理器创建自动启动，由 Close 停止
+	go m.cleanupLoop()
+
+	return m
 }
 
 // CreateSession 创建会话（复用 session.go，增加 DeviceInfo 和 Metadata）
@@ -79,25 +219,53 @@ func (m *Manager) CreateSession(ctx context.Context, req *CreateSessionRequest)
 		return nil, fmt.Errorf("client_id is required")
 	}
 
-	// 生成 Token（复用 session.go 的 generateToken）
-	token, err := generateToken()
+	// 生成 Token（默认 crypto/rand，可通过 Config.TokenGenerator 替换）
+	token, err := m.tokenGenerator.GenerateToken(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("generate token failed: %w", err)
 	}
+	if token == "" {
+		return nil, fmt.Errorf("generate token failed: empty token")
+	}
 
-	now := time.Now()
+	now := m.clock.Now()
+	ttl, maxLifetime := m.lifetimeFor(req.ClientClass)
 	session := &Session{
 		Token:           token,
 		ClientID:        req.ClientID,
 		CertFingerprint: req.CertFingerprint,
 		DeviceInfo:      req.DeviceInfo,
+		PostureHash:     req.DeviceInfo.PostureHash(),
+		ClientClass:     req.ClientClass,
+		Tenant:          req.Tenant,
 		CreatedAt:       now,
-		ExpiresAt:       now.Add(m.tokenTTL),
 		LastAccessAt:    now,
 		Metadata:        req.Metadata,
 	}
+	if maxLifetime > 0 {
+		session.MaxExpiresAt = now.Add(maxLifetime)
+	}
+	session.ExpiresAt = session.capExpiry(now.Add(ttl))
 
 	m.mu.Lock()
+	if _, exists := m.sessions[token]; exists {
+		m.mu.Unlock()
+		return nil, fmt.Errorf("generate token failed: duplicate token")
+	}
+	var revoked []*Session
+	if m.concurrency != ConcurrencyAllowMultiple {
+		active := m.activeSessionsLocked(req.ClientID, req.Replaces, now)
+		if excess := len(active) - m.maxPerClient + 1; excess > 0 {
+			if m.concurrency == ConcurrencyRejectNew {
+				m.mu.Unlock()
+				return nil, ErrSessionLimitReached
+			}
+			revoked = active[:excess]
+			for _, old := range revoked {
+				m.removeLocked(old)
+			}
+		}
+	}
 	m.sessions[token] = session
 	m.clientSessions[req.ClientID] = append(m.clientSessions[req.ClientID], token)
 	m.mu.Unlock()
@@ -108,11 +276,26 @@ func (m *Manager) CreateSession(ctx context.Context, req *CreateSessionRequest)
 		"expires_at", session.ExpiresAt.Format(time.RFC3339),
 	)
 
+	for _, old := range revoked {
+		m.logger.Info("Session revoked by concurrency policy",
+			"token", old.Token,
+			"client_id", old.ClientID,
+			"mode", m.concurrency,
+		)
+		if m.onForcedRevoke != nil {
+			m.onForcedRevoke(&ForcedRevocation{Session: old, Reason: RevokeReasonSessionLimit, NewToken: token})
+		}
+	}
+
 	return session, nil
 }
 
 // ValidateSession 验证会话（复用 session.go，更新 LastAccessAt）
 func (m *Manager) ValidateSession(ctx context.Context, token string) (*Session, error) {
+	if err := faults.SessionValidationError(ctx); err != nil {
+		return nil, err
+	}
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -122,12 +305,12 @@ func (m *Manager) ValidateSession(ctx context.Context, token string) (*Session,
 	}
 
 	// 检查过期
-	if time.Now().After(session.ExpiresAt) {
+	if m.expired(session, m.clock.Now()) {
 		return nil, fmt.Errorf("session expired")
 	}
 
 	// 更新最后访问时间（新增）
-	session.LastAccessAt = time.Now()
+	session.LastAccessAt = m.clock.Now()
 
 	return session, nil
 }
@@ -142,24 +325,60 @@ func (m *Manager) RefreshSession(ctx context.Context, token string) (*Session, e
 		return nil, fmt.Errorf("session not found")
 	}
 
+	// 检查绝对生命周期与刷新次数上限（优先于普通过期，便于客户端识别需重新握手）
+	now := m.clock.Now()
+	if !session.MaxExpiresAt.IsZero() && !now.Before(session.MaxExpiresAt) {
+		return nil, ErrSessionLifetimeExceeded
+	}
+	if m.maxRefreshCount > 0 && session.RefreshCount >= m.maxRefreshCount {
+		return nil, ErrSessionLifetimeExceeded
+	}
+
 	// 检查过期
-	if time.Now().After(session.ExpiresAt) {
+	if m.expired(session, now) {
 		return nil, fmt.Errorf("session expired")
 	}
 
-	// 延长过期时间
-	session.ExpiresAt = time.Now().Add(m.tokenTTL)
-	session.LastAccessAt = time.Now()
+	// 延长过期时间（按类别 TTL，且不超过绝对过期上限）
+	ttl, _ := m.lifetimeFor(session.ClientClass)
+	session.ExpiresAt = session.capExpiry(now.Add(ttl))
+	session.LastAccessAt = now
+	session.RefreshCount++
 
 	m.logger.Debug("Session refreshed",
 		"token", token,
 		"client_id", session.ClientID,
 		"expires_at", session.ExpiresAt.Format(time.RFC3339),
+		"refresh_count", session.RefreshCount,
 	)
 
 	return session, nil
 }
 
+// lifetimeFor 返回客户端类别对应的 TTL 和绝对有效期上限
+func (m *Manager) lifetimeFor(class string) (time.Duration, time.Duration) {
+	ttl := m.tokenTTL
+	var maxLifetime time.Duration
+	if p, ok := m.clientClasses[class]; ok && p != nil {
+		if p.TTL > 0 {
+			ttl = p.TTL
+		}
+		maxLifetime = p.MaxLifetime
+	}
+	if m.maxLifetime > 0 && (maxLifetime == 0 || m.maxLifetime < maxLifetime) {
+		maxLifetime = m.maxLifetime
+	}
+	return ttl, maxLifetime
+}
+
+// capExpiry 将过期时间限制在绝对过期上限之内
+func (s *Session) capExpiry(expiresAt time.Time) time.Time {
+	if !s.MaxExpiresAt.IsZero() && expiresAt.After(s.MaxExpiresAt) {
+		return s.MaxExpiresAt
+	}
+	return expiresAt
+}
+
 // RevokeSession 撤销会话（新增方法）
 func (m *Manager) RevokeSession(ctx context.Context, token string) error {
 	m.mu.Lock()
@@ -170,23 +389,7 @@ func (m *Manager) RevokeSession(ctx context.Context, token string) error {
 		return fmt.Errorf("session not found")
 	}
 
-	// 从 sessions 映射中移除
-	delete(m.sessions, token)
-
-	// 从 clientSessions 映射中移除
-	if tokens, exists := m.clientSessions[session.ClientID]; exists {
-		newTokens := make([]string, 0, len(tokens))
-		for _, t := range tokens {
-			if t != token {
-				newTokens = append(newTokens, t)
-			}
-		}
-		if len(newTokens) > 0 {
-			m.clientSessions[session.ClientID] = newTokens
-		} else {
-			delete(m.clientSessions, session.ClientID)
-		}
-	}
+	m.removeLocked(session)
 
 	m.logger.Info("Session revoked",
 		"token", token,
@@ -196,12 +399,44 @@ func (m *Manager) RevokeSession(ctx context.Context, token string) error {
 	return nil
 }
 
+// removeLocked 从 sessions 与 clientSessions 中移除会话（调用方持有写锁）
+func (m *Manager) removeLocked(session *Session) {
+	delete(m.sessions, session.Token)
+
+	tokens, exists := m.clientSessions[session.ClientID]
+	if !exists {
+		return
+	}
+	newTokens := make([]string, 0, len(tokens))
+	for _, t := range tokens {
+		if t != session.Token {
+			newTokens = append(newTokens, t)
+		}
+	}
+	if len(newTokens) > 0 {
+		m.clientSessions[session.ClientID] = newTokens
+	} else {
+		delete(m.clientSessions, session.ClientID)
+	}
+}
+
+// activeSessionsLocked 返回客户端未过期的会话（按创建顺序），不含 except（调用方持有锁）
+func (m *Manager) activeSessionsLocked(clientID, except string, now time.Time) []*Session {
+	var active []*Session
+	for _, token := range m.clientSessions[clientID] {
+		if session, exists := m.sessions[token]; exists && token != except && !m.expired(session, now) {
+			active = append(active, session)
+		}
+	}
+	return active
+}
+
 // GetActiveSessions 获取所有活跃会话（新增方法）
 func (m *Manager) GetActiveSessions(ctx context.Context) ([]*Session, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	now := time.Now()
+	now := m.clock.Now()
 	sessions := make([]*Session, 0, len(m.sessions))
 
 	for _, session := range m.sessions {
@@ -224,7 +459,7 @@ func (m *Manager) GetSessionsByClient(ctx context.Context, clientID string) ([]*
 	}
 
 	sessions := make([]*Session, 0, len(tokens))
-	now := time.Now()
+	now := m.clock.Now()
 
 	for _, token := range tokens {
 		if session, exists := m.sessions[token]; exists {
@@ -237,9 +472,74 @@ func (m *Manager) GetSessionsByClient(ctx context.Context, clientID string) ([]*
 	return sessions, nil
 }
 
-// StartCleanup 启动定期清理（复用 session.go 和 registry.go 逻辑）
-func (m *Manager) StartCleanup(ctx context.Context) {
-	ticker := time.NewTicker(m.cleanupInterval)
+// RebindCertFingerprint 将客户端绑定旧证书指纹的活跃会话改绑到新指纹（证书轮换），返回改绑数量
+// Token 与有效期保持不变，基于 Token 的隧道不受影响
+func (m *Manager) RebindCertFingerprint(ctx context.Context, clientID, oldFingerprint, newFingerprint string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.clock.Now()
+	rebound := 0
+	for _, token := range m.clientSessions[clientID] {
+		session, exists := m.sessions[token]
+		if !exists || m.expired(session, now) || session.CertFingerprint != oldFingerprint {
+			continue
+		}
+		session.CertFingerprint = newFingerprint
+		rebound++
+	}
+
+	if rebound > 0 && m.logger != nil {
+		m.logger.Info("Sessions rebound to rotated certificate",
+			"client_id", clientID,
+			"count", rebound,
+		)
+	}
+
+	return rebound
+}
+
+// ObservePosture 比对请求携带的设备指纹与会话记录的指纹，不一致时返回漂移（否则为 nil）
+// 会话未记录指纹时（握手未上报设备信息）以本次指纹为基线；漂移后记录新指纹，同一变化只报告一次。
+// 已记录指纹的会话未携带指纹（hash 为空）同样是漂移，基线不变，每次都报告
+func (m *Manager) ObservePosture(ctx context.Context, token, hash string) (*PostureDrift, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, ok := m.sessions[token]
+	if !ok {
+		return nil, fmt.Errorf("session not found")
+	}
+	if m.expired(session, m.clock.Now()) {
+		return nil, fmt.Errorf("session expired")
+	}
+	if hash == session.PostureHash {
+		return nil, nil
+	}
+	if session.PostureHash == "" {
+		session.PostureHash = hash
+		return nil, nil
+	}
+
+	drift := &PostureDrift{
+		ClientID: session.ClientID,
+		Token:    session.Token,
+		Expected: session.PostureHash,
+		Observed: hash,
+	}
+	if hash != "" {
+		session.PostureHash = hash
+	}
+	session.PostureDrifts++
+	drift.Drifts = session.PostureDrifts
+	return drift, nil
+}
+
+// cleanupLoop 定期清理过期会话（复用 session.go 和 registry.go 逻辑）
+func (m *Manager) cleanupLoop() {
+	defer close(m.doneChan)
+
+	ticker := m.clock.NewTicker(m.cleanupInterval)
 	defer ticker.Stop()
 
 	m.logger.Info("Session cleanup started",
@@ -248,31 +548,56 @@ func (m *Manager) StartCleanup(ctx context.Context) {
 
 	for {
 		select {
-		case <-ticker.C:
+		case <-ticker.C():
 			m.cleanExpired()
-		case <-ctx.Done():
-			m.logger.Info("Session cleanup stopped (context done)")
-			return
 		case <-m.stopChan:
-			m.logger.Info("Session cleanup stopped (manual)")
+			m.logger.Info("Session cleanup stopped")
 			return
 		}
 	}
 }
 
-// StopCleanup 停止清理（新增）
+// StartCleanup 阻塞直到 ctx 结束或管理器关闭；ctx 结束时关闭管理器
+//
+// Deprecated: NewManager 已自动启动后台清理，使用 Close 停止即可。
+// 保留该方法仅为兼容旧的调用方式，不会启动第二个清理循环。
+func (m *Manager) StartCleanup(ctx context.Context) {
+	select {
+	case <-ctx.Done():
+		m.Close()
+	case <-m.stopChan:
+	}
+}
+
+// StopCleanup 停止清理
+//
+// Deprecated: 使用 Close。
 func (m *Manager) StopCleanup() {
-	close(m.stopChan)
+	m.Close()
+}
+
+// Close 停止后台清理并等待其退出（幂等，可重复调用）
+func (m *Manager) Close() error {
+	m.closeOnce.Do(func() {
+		close(m.stopChan)
+	})
+	<-m.doneChan
+	return nil
+}
+
+// expired 会话是否已过期（含 ClockSkewTolerance 宽限）
+func (m *Manager) expired(s *Session, now time.Time) bool {
+	return now.After(s.ExpiresAt.Add(m.clockSkew))
 }
 
 // cleanExpired 清理过期会话（合并 session.go 和 registry.go 清理逻辑）
 func (m *Manager) cleanExpired() {
-	now := time.Now()
+	now := m.clock.Now()
 	expiredTokens := make([]string, 0)
 
 	m.mu.RLock()
 	for token, session := range m.sessions {
-		if now.After(session.ExpiresAt) {
+		if m.expired(session, now) {
 			expiredTokens = append(expiredTokens, token)
 		}
 	}
@@ -286,22 +611,7 @@ func (m *Manager) cleanExpired() {
 	m.mu.Lock()
 	for _, token := range expiredTokens {
 		if session, ok := m.sessions[token]; ok {
-			delete(m.sessions, token)
-
-			// 从 clientSessions 中移除
-			if tokens, exists := m.clientSessions[session.ClientID]; exists {
-				newTokens := make([]string, 0, len(tokens))
-				for _, t := range tokens {
-					if t != token {
-						newTokens = append(newTokens, t)
-					}
-				}
-				if len(newTokens) > 0 {
-					m.clientSessions[session.ClientID] = newTokens
-				} else {
-					delete(m.clientSessions, session.ClientID)
-				}
-			}
+			m.removeLocked(session)
 		}
 	}
 	m.mu.Unlock()
@@ -318,7 +628,7 @@ func (m *Manager) GetStats() map[string]interface{} {
 
 	activeCount := 0
 	expiredCount := 0
-	now := time.Now()
+	now := m.clock.Now()
 
 	for _, session := range m.sessions {
 		if now.Before(session.ExpiresAt) {
@@ -1,10 +1,17 @@
 package session
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"strings"
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/houzhh15/sdp-common/clock"
+	"github.com/houzhh15/sdp-common/leaktest"
 )
 
 // mockLogger 模拟日志记录器
@@ -138,9 +145,11 @@ func TestValidateSession(t *testing.T) {
 
 // TestValidateSessionExpired 测试过期会话验证
 func TestValidateSessionExpired(t *testing.T) {
+	clk := clock.NewFake(time.Now())
 	manager := NewManager(&Config{
 		TokenTTL:        1 * time.Second, // 1 秒过期
 		CleanupInterval: 300 * time.Second,
+		Clock:           clk,
 	}, &mockLogger{})
 
 	// 创建会话
@@ -152,8 +161,14 @@ func TestValidateSessionExpired(t *testing.T) {
 		t.Fatalf("CreateSession failed: %v", err)
 	}
 
-	// 等待过期
-	time.Sleep(2 * time.Second)
+	// 到期前仍然有效
+	clk.Advance(999 * time.Millisecond)
+	if _, err := manager.ValidateSession(context.Background(), session.Token); err != nil {
+		t.Fatalf("Expected session valid before expiry, got %v", err)
+	}
+
+	// 推进时钟至过期
+	clk.Advance(2 * time.Millisecond)
 
 	// 验证过期会话
 	_, err = manager.ValidateSession(context.Background(), session.Token)
@@ -162,9 +177,51 @@ func TestValidateSessionExpired(t *testing.T) {
 	}
 }
 
+// TestClockSkewTolerance 测试过期宽限
+func TestClockSkewTolerance(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	manager := NewManager(&Config{
+		TokenTTL:           time.Minute,
+		ClockSkewTolerance: 30 * time.Second,
+		Clock:              clk,
+	}, &mockLogger{})
+	defer manager.Close()
+
+	ctx := context.Background()
+	first, err := manager.CreateSession(ctx, &CreateSessionRequest{ClientID: "test-client-skew"})
+	if err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+	second, err := manager.CreateSession(ctx, &CreateSessionRequest{ClientID: "test-client-skew"})
+	if err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+
+	// 过期后宽限期内仍可校验与刷新，且不被清理
+	clk.Advance(time.Minute + 20*time.Second)
+	manager.cleanExpired()
+	if _, err := manager.ValidateSession(ctx, first.Token); err != nil {
+		t.Errorf("Expected session valid within tolerance, got %v", err)
+	}
+	if _, err := manager.RefreshSession(ctx, second.Token); err != nil {
+		t.Errorf("Expected refresh within tolerance, got %v", err)
+	}
+
+	// 超出宽限后过期
+	clk.Advance(11 * time.Second)
+	if _, err := manager.ValidateSession(ctx, first.Token); err == nil {
+		t.Error("Expected session expired beyond tolerance")
+	}
+	if _, err := manager.ValidateSession(ctx, second.Token); err != nil {
+		t.Errorf("Expected refreshed session valid, got %v", err)
+	}
+}
+
 // TestRefreshSession 测试会话刷新
 func TestRefreshSession(t *testing.T) {
+	clk := clock.NewFake(time.Now())
 	manager := NewManager(&Config{
+		Clock:           clk,
 		TokenTTL:        3600 * time.Second,
 		CleanupInterval: 300 * time.Second,
 	}, &mockLogger{})
@@ -180,8 +237,8 @@ func TestRefreshSession(t *testing.T) {
 
 	originalExpiresAt := session.ExpiresAt
 
-	// 等待 1 秒
-	time.Sleep(1 * time.Second)
+	// 推进 1 秒
+	clk.Advance(1 * time.Second)
 
 	// 刷新会话
 	refreshedSession, err := manager.RefreshSession(context.Background(), session.Token)
@@ -327,9 +384,45 @@ func TestGetSessionsByClient(t *testing.T) {
 	}
 }
 
+// TestRebindCertFingerprint 测试证书轮换后会话改绑新指纹
+func TestRebindCertFingerprint(t *testing.T) {
+	manager := NewManager(&Config{}, &mockLogger{})
+	ctx := context.Background()
+
+	old, err := manager.CreateSession(ctx, &CreateSessionRequest{ClientID: "client-A", CertFingerprint: "sha256:old"})
+	if err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+	other, err := manager.CreateSession(ctx, &CreateSessionRequest{ClientID: "client-A", CertFingerprint: "sha256:other"})
+	if err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+
+	if n := manager.RebindCertFingerprint(ctx, "client-A", "sha256:old", "sha256:new"); n != 1 {
+		t.Fatalf("Expected 1 rebound session, got %d", n)
+	}
+
+	sess, err := manager.ValidateSession(ctx, old.Token)
+	if err != nil {
+		t.Fatalf("Session should survive rotation: %v", err)
+	}
+	if sess.CertFingerprint != "sha256:new" {
+		t.Errorf("Expected fingerprint sha256:new, got %s", sess.CertFingerprint)
+	}
+	if other.CertFingerprint != "sha256:other" {
+		t.Errorf("Unrelated session should keep its fingerprint, got %s", other.CertFingerprint)
+	}
+
+	if n := manager.RebindCertFingerprint(ctx, "client-B", "sha256:new", "sha256:x"); n != 0 {
+		t.Errorf("Expected 0 rebound sessions for other client, got %d", n)
+	}
+}
+
 // TestCleanupExpired 测试过期清理
 func TestCleanupExpired(t *testing.T) {
+	clk := clock.NewFake(time.Now())
 	manager := NewManager(&Config{
+		Clock:           clk,
 		TokenTTL:        1 * time.Second, // 1 秒过期
 		CleanupInterval: 300 * time.Second,
 	}, &mockLogger{})
@@ -351,8 +444,8 @@ func TestCleanupExpired(t *testing.T) {
 		t.Errorf("Expected 2 sessions, got %d", stats["total"])
 	}
 
-	// 等待过期
-	time.Sleep(2 * time.Second)
+	// 推进时钟至过期
+	clk.Advance(2 * time.Second)
 
 	// 手动触发清理
 	manager.cleanExpired()
@@ -412,7 +505,9 @@ func TestConcurrency(t *testing.T) {
 
 // TestGetStats 测试统计信息
 func TestGetStats(t *testing.T) {
+	clk := clock.NewFake(time.Now())
 	manager := NewManager(&Config{
+		Clock:           clk,
 		TokenTTL:        1 * time.Second,
 		CleanupInterval: 300 * time.Second,
 	}, &mockLogger{})
@@ -438,8 +533,8 @@ func TestGetStats(t *testing.T) {
 		t.Errorf("Expected active 3, got %d", stats["active"])
 	}
 
-	// 等待过期
-	time.Sleep(2 * time.Second)
+	// 推进时钟至过期
+	clk.Advance(2 * time.Second)
 
 	// 再次获取统计信息
 	stats = manager.GetStats()
@@ -454,3 +549,390 @@ func TestGetStats(t *testing.T) {
 		t.Errorf("Expected expired 3, got %d", stats["expired"])
 	}
 }
+
+// TestBackgroundCleanup 测试后台清理随 NewManager 自动启动
+func TestBackgroundCleanup(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	manager := NewManager(&Config{
+		TokenTTL:        100 * time.Millisecond,
+		CleanupInterval: 50 * time.Millisecond,
+		Clock:           clk,
+	}, &mockLogger{})
+	defer manager.Close()
+
+	if _, err := manager.CreateSession(context.Background(), &CreateSessionRequest{ClientID: "test-client-bg"}); err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+
+	// 等待清理 ticker 注册后推进到会话过期并触发一次清理
+	clk.BlockUntil(1)
+	clk.Advance(150 * time.Millisecond)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if manager.GetStats()["total"].(int) == 0 {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Error("Expected expired session to be cleaned up automatically")
+}
+
+// TestCloseIdempotent 测试 Close/StopCleanup 可重复调用
+func TestCloseIdempotent(t *testing.T) {
+	manager := NewManager(&Config{}, &mockLogger{})
+
+	if err := manager.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if err := manager.Close(); err != nil {
+		t.Fatalf("second Close failed: %v", err)
+	}
+	manager.StopCleanup()
+	manager.StopCleanup()
+
+	// 关闭后 StartCleanup 立即返回
+	done := make(chan struct{})
+	go func() {
+		manager.StartCleanup(context.Background())
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("StartCleanup should return after Close")
+	}
+}
+
+// TestCustomTokenGenerator 测试注入确定性 Token 生成器
+func TestCustomTokenGenerator(t *testing.T) {
+	counter := 0
+	manager := NewManager(&Config{
+		TokenGenerator: TokenGeneratorFunc(func(ctx context.Context) (string, error) {
+			counter++
+			return fmt.Sprintf("test-token-%d", counter), nil
+		}),
+	}, &mockLogger{})
+	defer manager.Close()
+
+	sess, err := manager.CreateSession(context.Background(), &CreateSessionRequest{ClientID: "test-client-gen"})
+	if err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+	if sess.Token != "test-token-1" {
+		t.Errorf("Expected token test-token-1, got %s", sess.Token)
+	}
+
+	// 重复 Token 必须被拒绝
+	counter = 0
+	if _, err := manager.CreateSession(context.Background(), &CreateSessionRequest{ClientID: "test-client-gen"}); err == nil {
+		t.Error("Expected error for duplicate token")
+	}
+}
+
+// TestRandomTokenGenerator_Entropy 测试自定义熵源
+func TestRandomTokenGenerator_Entropy(t *testing.T) {
+	gen := &RandomTokenGenerator{Entropy: bytes.NewReader(make([]byte, 32))}
+	token, err := gen.GenerateToken(context.Background())
+	if err != nil {
+		t.Fatalf("GenerateToken failed: %v", err)
+	}
+	if token != strings.Repeat("0", 64) {
+		t.Errorf("Unexpected token: %s", token)
+	}
+
+	// 熵不足时返回错误
+	if _, err := gen.GenerateToken(context.Background()); err == nil {
+		t.Error("Expected error for exhausted entropy source")
+	}
+}
+
+// TestClientClassTTL 测试按客户端类别覆盖有效期
+func TestClientClassTTL(t *testing.T) {
+	manager := NewManager(&Config{
+		TokenTTL: time.Hour,
+		ClientClasses: map[string]*ClassPolicy{
+			"admin":   {TTL: 30 * time.Minute},
+			"service": {TTL: 24 * time.Hour},
+		},
+	}, &mockLogger{})
+	defer manager.Close()
+
+	tests := []struct {
+		class string
+		want  time.Duration
+	}{
+		{"admin", 30 * time.Minute},
+		{"service", 24 * time.Hour},
+		{"", time.Hour},
+		{"unknown", time.Hour},
+	}
+
+	for _, tt := range tests {
+		sess, err := manager.CreateSession(context.Background(), &CreateSessionRequest{
+			ClientID:    "test-client-class",
+			ClientClass: tt.class,
+		})
+		if err != nil {
+			t.Fatalf("CreateSession(%q) failed: %v", tt.class, err)
+		}
+		got := sess.ExpiresAt.Sub(sess.CreatedAt)
+		if got != tt.want {
+			t.Errorf("class %q: TTL = %v, want %v", tt.class, got, tt.want)
+		}
+		if sess.ClientClass != tt.class {
+			t.Errorf("class %q: ClientClass = %q", tt.class, sess.ClientClass)
+		}
+	}
+}
+
+// TestClientClassMaxLifetime 测试刷新不超过类别的绝对有效期上限
+func TestClientClassMaxLifetime(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	manager := NewManager(&Config{
+		Clock: clk,
+		ClientClasses: map[string]*ClassPolicy{
+			"admin": {TTL: time.Hour, MaxLifetime: 300 * time.Millisecond},
+		},
+	}, &mockLogger{})
+	defer manager.Close()
+
+	sess, err := manager.CreateSession(context.Background(), &CreateSessionRequest{
+		ClientID:    "test-client-admin",
+		ClientClass: "admin",
+	})
+	if err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+	if !sess.ExpiresAt.Equal(sess.MaxExpiresAt) {
+		t.Errorf("ExpiresAt %v should be capped to MaxExpiresAt %v", sess.ExpiresAt, sess.MaxExpiresAt)
+	}
+
+	refreshed, err := manager.RefreshSession(context.Background(), sess.Token)
+	if err != nil {
+		t.Fatalf("RefreshSession failed: %v", err)
+	}
+	if refreshed.ExpiresAt.After(sess.MaxExpiresAt) {
+		t.Errorf("refreshed ExpiresAt %v exceeds cap %v", refreshed.ExpiresAt, sess.MaxExpiresAt)
+	}
+
+	clk.Advance(400 * time.Millisecond)
+	if _, err := manager.RefreshSession(context.Background(), sess.Token); err == nil {
+		t.Error("Expected refresh to fail after max lifetime")
+	}
+}
+
+// TestMaxRefreshCount 测试刷新次数上限
+func TestMaxRefreshCount(t *testing.T) {
+	manager := NewManager(&Config{MaxRefreshCount: 2}, &mockLogger{})
+	defer manager.Close()
+
+	sess, err := manager.CreateSession(context.Background(), &CreateSessionRequest{ClientID: "test-client-refresh"})
+	if err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+
+	for i := 1; i <= 2; i++ {
+		refreshed, err := manager.RefreshSession(context.Background(), sess.Token)
+		if err != nil {
+			t.Fatalf("RefreshSession %d failed: %v", i, err)
+		}
+		if refreshed.RefreshCount != i {
+			t.Errorf("RefreshCount = %d, want %d", refreshed.RefreshCount, i)
+		}
+	}
+
+	_, err = manager.RefreshSession(context.Background(), sess.Token)
+	if !errors.Is(err, ErrSessionLifetimeExceeded) {
+		t.Errorf("Expected ErrSessionLifetimeExceeded, got %v", err)
+	}
+}
+
+// TestMaxSessionLifetime 测试全局绝对生命周期上限（与类别上限取较小值）
+func TestMaxSessionLifetime(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	manager := NewManager(&Config{
+		Clock:              clk,
+		TokenTTL:           time.Hour,
+		MaxSessionLifetime: 200 * time.Millisecond,
+		ClientClasses: map[string]*ClassPolicy{
+			"service": {MaxLifetime: 24 * time.Hour},
+		},
+	}, &mockLogger{})
+	defer manager.Close()
+
+	sess, err := manager.CreateSession(context.Background(), &CreateSessionRequest{
+		ClientID:    "test-client-lifetime",
+		ClientClass: "service",
+	})
+	if err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+	if got := sess.MaxExpiresAt.Sub(sess.CreatedAt); got != 200*time.Millisecond {
+		t.Errorf("MaxExpiresAt offset = %v, want 200ms", got)
+	}
+
+	clk.Advance(300 * time.Millisecond)
+	_, err = manager.RefreshSession(context.Background(), sess.Token)
+	if !errors.Is(err, ErrSessionLifetimeExceeded) {
+		t.Errorf("Expected ErrSessionLifetimeExceeded, got %v", err)
+	}
+}
+
+// TestConcurrencyRevokeOldest 测试 revoke-oldest：超出上限时撤销最早的会话并通知
+func TestConcurrencyRevokeOldest(t *testing.T) {
+	var revoked []*ForcedRevocation
+	manager := NewManager(&Config{
+		Concurrency:          ConcurrencyRevokeOldest,
+		MaxSessionsPerClient: 2,
+		OnForcedRevocation:   func(r *ForcedRevocation) { revoked = append(revoked, r) },
+	}, &mockLogger{})
+	defer manager.Close()
+
+	ctx := context.Background()
+	var tokens []string
+	for i := 0; i < 3; i++ {
+		sess, err := manager.CreateSession(ctx, &CreateSessionRequest{ClientID: "client-a"})
+		if err != nil {
+			t.Fatalf("CreateSession %d failed: %v", i, err)
+		}
+		tokens = append(tokens, sess.Token)
+	}
+	// 其他客户端不受影响
+	if _, err := manager.CreateSession(ctx, &CreateSessionRequest{ClientID: "client-b"}); err != nil {
+		t.Fatalf("CreateSession for another client failed: %v", err)
+	}
+
+	if len(revoked) != 1 {
+		t.Fatalf("Expected 1 forced revocation, got %d", len(revoked))
+	}
+	if revoked[0].Session.Token != tokens[0] || revoked[0].NewToken != tokens[2] || revoked[0].Reason != RevokeReasonSessionLimit {
+		t.Errorf("Unexpected revocation %+v", revoked[0])
+	}
+	if _, err := manager.ValidateSession(ctx, tokens[0]); err == nil {
+		t.Error("Oldest session should be revoked")
+	}
+	if sessions, _ := manager.GetSessionsByClient(ctx, "client-a"); len(sessions) != 2 {
+		t.Errorf("Expected 2 active sessions, got %d", len(sessions))
+	}
+}
+
+// TestConcurrencyRejectNew 测试 reject-new：已有活跃会话时拒绝新会话，过期与被取代的会话不计入
+func TestConcurrencyRejectNew(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	manager := NewManager(&Config{Clock: clk, TokenTTL: time.Minute, Concurrency: ConcurrencyRejectNew}, &mockLogger{})
+	defer manager.Close()
+
+	ctx := context.Background()
+	first, err := manager.CreateSession(ctx, &CreateSessionRequest{ClientID: "client-a"})
+	if err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+	if _, err := manager.CreateSession(ctx, &CreateSessionRequest{ClientID: "client-a"}); !errors.Is(err, ErrSessionLimitReached) {
+		t.Fatalf("Expected ErrSessionLimitReached, got %v", err)
+	}
+
+	// 会话转移：新会话取代旧会话
+	second, err := manager.CreateSession(ctx, &CreateSessionRequest{ClientID: "client-a", Replaces: first.Token})
+	if err != nil {
+		t.Fatalf("CreateSession replacing the active session failed: %v", err)
+	}
+
+	clk.Advance(2 * time.Minute)
+	if _, err := manager.CreateSession(ctx, &CreateSessionRequest{ClientID: "client-a"}); err != nil {
+		t.Errorf("Expired sessions must not count towards the limit: %v", err)
+	}
+	if _, err := manager.ValidateSession(ctx, second.Token); err == nil {
+		t.Error("Expected the replaced session to have expired")
+	}
+}
+
+func TestConcurrencyMode_Validate(t *testing.T) {
+	for _, mode := range []ConcurrencyMode{"", ConcurrencyAllowMultiple, ConcurrencyRevokeOldest, ConcurrencyRejectNew} {
+		if err := mode.Validate(); err != nil {
+			t.Errorf("%q: unexpected error %v", mode, err)
+		}
+	}
+	if err := ConcurrencyMode("single").Validate(); err == nil {
+		t.Error("Expected invalid mode to be rejected")
+	}
+}
+
+// TestObservePosture 测试设备指纹漂移检测
+func TestObservePosture(t *testing.T) {
+	manager := NewManager(&Config{}, &mockLogger{})
+	defer manager.Close()
+	ctx := context.Background()
+
+	laptop := &DeviceInfo{DeviceID: "laptop-1", OS: "linux"}
+	sess, err := manager.CreateSession(ctx, &CreateSessionRequest{ClientID: "client-a", DeviceInfo: laptop})
+	if err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+	if sess.PostureHash != laptop.PostureHash() {
+		t.Fatalf("PostureHash = %q, want handshake device hash", sess.PostureHash)
+	}
+
+	// 相同指纹不视为漂移
+	if drift, err := manager.ObservePosture(ctx, sess.Token, laptop.PostureHash()); err != nil || drift != nil {
+		t.Fatalf("ObservePosture = %v, %v; want no drift", drift, err)
+	}
+
+	// 未携带指纹视为漂移，基线不变，每次都报告
+	for i := 1; i <= 2; i++ {
+		drift, err := manager.ObservePosture(ctx, sess.Token, "")
+		if err != nil || drift == nil || drift.Expected != laptop.PostureHash() || drift.Observed != "" || drift.Drifts != i {
+			t.Fatalf("ObservePosture(\"\") = %+v, %v; want drift #%d", drift, err, i)
+		}
+	}
+	if drift, _ := manager.ObservePosture(ctx, sess.Token, laptop.PostureHash()); drift != nil {
+		t.Errorf("baseline changed by missing posture: %+v", drift)
+	}
+
+	other := (&DeviceInfo{DeviceID: "laptop-1", OS: "windows"}).PostureHash()
+	drift, err := manager.ObservePosture(ctx, sess.Token, other)
+	if err != nil || drift == nil {
+		t.Fatalf("ObservePosture = %v, %v; want drift", drift, err)
+	}
+	if drift.Expected != laptop.PostureHash() || drift.Observed != other || drift.Drifts != 3 || drift.ClientID != "client-a" {
+		t.Errorf("unexpected drift %+v", drift)
+	}
+	// 同一变化只报告一次
+	if drift, _ := manager.ObservePosture(ctx, sess.Token, other); drift != nil {
+		t.Errorf("repeated posture reported as drift: %+v", drift)
+	}
+
+	// 未记录指纹的会话以首次上报为基线
+	bare, _ := manager.CreateSession(ctx, &CreateSessionRequest{ClientID: "client-b"})
+	if drift, _ := manager.ObservePosture(ctx, bare.Token, ""); drift != nil {
+		t.Errorf("missing posture on a session without device info reported as drift: %+v", drift)
+	}
+	if drift, _ := manager.ObservePosture(ctx, bare.Token, other); drift != nil {
+		t.Errorf("first posture reported as drift: %+v", drift)
+	}
+	if _, err := manager.ObservePosture(ctx, "missing", other); err == nil {
+		t.Error("Expected error for unknown session")
+	}
+
+	if err := DriftPolicy("ignore").Validate(); err == nil {
+		t.Error("Expected invalid drift policy to be rejected")
+	}
+}
+
+// TestManagerCloseNoLeak 测试 Close 停止后台清理循环且可重复调用
+func TestManagerCloseNoLeak(t *testing.T) {
+	leaktest.Check(t)
+
+	manager := NewManager(&Config{CleanupInterval: 10 * time.Millisecond}, &mockLogger{})
+	if _, err := manager.CreateSession(context.Background(), &CreateSessionRequest{ClientID: "client-a"}); err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+	time.Sleep(30 * time.Millisecond) // 清理循环至少运行一轮
+
+	if err := manager.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if err := manager.Close(); err != nil {
+		t.Fatalf("second Close failed: %v", err)
+	}
+}
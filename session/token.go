@@ -1,15 +1,43 @@
 package session
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"fmt"
+	"io"
 )
 
-// generateToken 生成 64 字符十六进制 Token（完整复用 session.go）
-func generateToken() (string, error) {
+// TokenGenerator 会话 Token 生成器
+// 测试可注入确定性实现，生产环境可接入 KMS 等外部熵源/签名服务
+type TokenGenerator interface {
+	GenerateToken(ctx context.Context) (string, error)
+}
+
+// TokenGeneratorFunc 函数适配器
+type TokenGeneratorFunc func(ctx context.Context) (string, error)
+
+// GenerateToken 实现 TokenGenerator
+func (f TokenGeneratorFunc) GenerateToken(ctx context.Context) (string, error) {
+	return f(ctx)
+}
+
+// RandomTokenGenerator 默认实现：从熵源读取 32 字节，编码为 64 字符十六进制 Token
+type RandomTokenGenerator struct {
+	// Entropy 熵源，为空时使用 crypto/rand
+	Entropy io.Reader
+}
+
+// GenerateToken 实现 TokenGenerator
+func (g *RandomTokenGenerator) GenerateToken(ctx context.Context) (string, error) {
+	entropy := g.Entropy
+	if entropy == nil {
+		entropy = rand.Reader
+	}
+
 	b := make([]byte, 32) // 32 字节 = 64 字符 hex
-	if _, err := rand.Read(b); err != nil {
-		return "", err
+	if _, err := io.ReadFull(entropy, b); err != nil {
+		return "", fmt.Errorf("read entropy: %w", err)
 	}
 	return hex.EncodeToString(b), nil
 }
@@ -0,0 +1,68 @@
+//go:build integration
+
+package integration
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/houzhh15/sdp-common/testinfra"
+)
+
+func TestEndToEndTraffic(t *testing.T) {
+	cluster := testinfra.Start(t, nil)
+	if err := cluster.WaitForTraffic(30 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	// 多于一次读写缓冲的负载
+	payload := bytes.Repeat([]byte("sdp-testinfra"), 64*1024)
+	if err := cluster.RoundTrip(payload, 10*time.Second); err != nil {
+		t.Fatalf("large payload: %v", err)
+	}
+}
+
+func TestTargetOutage(t *testing.T) {
+	cluster := testinfra.Start(t, nil)
+	if err := cluster.WaitForTraffic(30 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	cluster.Target.Stop()
+	if err := cluster.RoundTrip([]byte("ping"), 3*time.Second); err == nil {
+		t.Fatal("traffic should fail while the target is down")
+	}
+
+	if err := cluster.Target.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cluster.WaitForTraffic(30 * time.Second); err != nil {
+		t.Fatalf("traffic after target recovery: %v", err)
+	}
+}
+
+func TestAHCrashRecovery(t *testing.T) {
+	cluster := testinfra.Start(t, nil)
+	if err := cluster.WaitForTraffic(30 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cluster.AH.Kill(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cluster.RoundTrip([]byte("ping"), 3*time.Second); err == nil {
+		t.Fatal("traffic should fail while the AH is down")
+	}
+
+	if err := cluster.StartAH(); err != nil {
+		t.Fatal(err)
+	}
+	// 示例 IH 不会重连已断开的多路复用会话，重启后以新隧道恢复
+	if err := cluster.RestartIH(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cluster.WaitForTraffic(30 * time.Second); err != nil {
+		t.Fatalf("traffic after AH restart: %v", err)
+	}
+}
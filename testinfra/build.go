@@ -0,0 +1,95 @@
+package testinfra
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// modulePath 根模块路径，用于定位仓库根目录
+const modulePath = "github.com/houzhh15/sdp-common"
+
+// 示例程序二进制名
+const (
+	controllerBinary = "controller-example"
+	ahAgentBinary    = "ah-agent-example"
+	ihClientBinary   = "ih-client-example"
+)
+
+// examples 二进制名 -> 仓库内示例目录（各自为独立模块）
+var examples = map[string]string{
+	controllerBinary: "examples/controller",
+	ahAgentBinary:    "examples/ah-agent",
+	ihClientBinary:   "examples/ih-client",
+}
+
+var (
+	buildMu   sync.Mutex
+	buildDone = make(map[string]error) // binDir -> 构建结果，同一测试进程内只构建一次
+)
+
+// RepoRoot 从当前目录向上查找根模块（sdp-common）的 go.mod 所在目录
+func RepoRoot() (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	for {
+		if readModulePath(filepath.Join(dir, "go.mod")) == modulePath {
+			return dir, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("%s go.mod not found above the working directory", modulePath)
+		}
+		dir = parent
+	}
+}
+
+func readModulePath(goMod string) string {
+	f, err := os.Open(goMod)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "module" {
+			return fields[1]
+		}
+	}
+	return ""
+}
+
+// Build 将 Controller、AH、IH 示例编译到 binDir；同一 binDir 在进程内只构建一次（go 构建缓存使重复构建很快）
+func Build(repoRoot, binDir string) error {
+	buildMu.Lock()
+	defer buildMu.Unlock()
+	if err, ok := buildDone[binDir]; ok {
+		return err
+	}
+
+	err := build(repoRoot, binDir)
+	buildDone[binDir] = err
+	return err
+}
+
+func build(repoRoot, binDir string) error {
+	if err := os.MkdirAll(binDir, 0o755); err != nil {
+		return err
+	}
+	for binary, dir := range examples {
+		cmd := exec.Command("go", "build", "-o", filepath.Join(binDir, binary), ".")
+		cmd.Dir = filepath.Join(repoRoot, dir)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("build %s: %w\n%s", dir, err, out)
+		}
+	}
+	return nil
+}
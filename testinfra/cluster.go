@@ -0,0 +1,386 @@
+// Package testinfra 为多进程集成测试提供基础设施
+//
+// Start 将 Controller（内置数据平面中继）、AH agent、IH client 示例编译后作为独立进程启动，
+// 使用临时生成的 PKI 完成 mTLS，并在进程内启动回显目标服务，形成完整的 IH → 中继 → AH → 目标链路：
+//
+//	func TestEndToEnd(t *testing.T) {
+//	    cluster := testinfra.Start(t, nil)
+//	    if err := cluster.WaitForTraffic(30 * time.Second); err != nil {
+//	        t.Fatal(err)
+//	    }
+//	    cluster.Target.Stop() // 目标故障
+//	    if err := cluster.RoundTrip([]byte("ping"), 2*time.Second); err == nil {
+//	        t.Fatal("expected failure with target down")
+//	    }
+//	}
+//
+// 各进程以真实二进制运行，可通过 Process 的 Stop / Kill / Restart 模拟崩溃与重启；
+// 测试失败时自动输出各进程日志。需要 PATH 中有 go 工具链，否则跳过测试。
+package testinfra
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// 默认参数
+const (
+	DefaultServiceID    = "echo"
+	DefaultStartTimeout = time.Minute
+
+	// ihClientID IH 证书 CN，Controller 以此作为策略中的 client_id
+	ihClientID = "ih-client"
+)
+
+// Config 集群配置
+type Config struct {
+	// RepoRoot 仓库根目录，默认从当前目录向上查找
+	RepoRoot string
+	// BinDir 示例二进制输出目录，默认 <系统临时目录>/sdp-testinfra-bin
+	BinDir string
+	// ServiceID 回显目标注册的服务 ID，默认 "echo"
+	ServiceID string
+	// ControllerArgs / AHArgs / IHArgs 追加给各进程的命令行参数
+	ControllerArgs []string
+	AHArgs         []string
+	IHArgs         []string
+	// StartTimeout 等待各进程就绪的时间，默认 1 分钟
+	StartTimeout time.Duration
+}
+
+// Cluster 运行中的多进程 SDP 部署
+type Cluster struct {
+	// Dir 工作目录（证书、声明式文件、Controller 数据库与进程日志）
+	Dir string
+	PKI *PKI
+
+	Controller *Process
+	AH         *Process
+	IH         *Process
+	Target     *Target
+
+	ServiceID     string
+	ControllerURL string
+	RelayAddr     string
+	// IHAddr IH 本地代理地址，连接它即经隧道到达目标
+	IHAddr string
+
+	config    *Config
+	clientTLS *tls.Config
+}
+
+// Start 构建并启动集群，等待全部组件就绪；测试结束时自动停止。任一步骤失败时测试立即失败
+func Start(t testing.TB, config *Config) *Cluster {
+	t.Helper()
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("testinfra: go toolchain not found in PATH")
+	}
+	if config == nil {
+		config = &Config{}
+	}
+	if config.ServiceID == "" {
+		config.ServiceID = DefaultServiceID
+	}
+	if config.StartTimeout <= 0 {
+		config.StartTimeout = DefaultStartTimeout
+	}
+	if config.RepoRoot == "" {
+		root, err := RepoRoot()
+		if err != nil {
+			t.Fatalf("testinfra: %v", err)
+		}
+		config.RepoRoot = root
+	}
+	if config.BinDir == "" {
+		config.BinDir = filepath.Join(os.TempDir(), "sdp-testinfra-bin")
+	}
+	if err := Build(config.RepoRoot, config.BinDir); err != nil {
+		t.Fatalf("testinfra: %v", err)
+	}
+
+	c := &Cluster{Dir: t.TempDir(), ServiceID: config.ServiceID, config: config}
+	t.Cleanup(func() {
+		if t.Failed() {
+			c.dumpLogs(t)
+		}
+		c.Close()
+	})
+	if err := c.start(); err != nil {
+		t.Fatalf("testinfra: %v", err)
+	}
+	return c
+}
+
+func (c *Cluster) start() error {
+	var err error
+	if c.PKI, err = NewPKI(c.Dir); err != nil {
+		return err
+	}
+	controllerCert, err := c.PKI.Issue("controller", "localhost", "localhost", "127.0.0.1")
+	if err != nil {
+		return err
+	}
+	ahCert, err := c.PKI.Issue("ah-agent", "ah-agent")
+	if err != nil {
+		return err
+	}
+	ihCert, err := c.PKI.Issue("ih-client", ihClientID)
+	if err != nil {
+		return err
+	}
+	if c.clientTLS, err = c.tlsConfig(ahCert); err != nil {
+		return err
+	}
+
+	if c.Target, err = NewTarget(); err != nil {
+		return err
+	}
+	servicesFile, policiesFile, err := c.writeSeedFiles()
+	if err != nil {
+		return err
+	}
+
+	httpAddr, relayAddr, ihAddr, err := freeAddrs()
+	if err != nil {
+		return err
+	}
+	c.ControllerURL = "https://" + httpAddr
+	c.RelayAddr = relayAddr
+	c.IHAddr = ihAddr
+
+	c.Controller = c.process(controllerBinary, controllerCert, append([]string{
+		"-addr", httpAddr,
+		"-proxy-addr", relayAddr,
+		"-services-file", servicesFile,
+		"-policies-file", policiesFile,
+	}, c.config.ControllerArgs...))
+	c.AH = c.process(ahAgentBinary, ahCert, append([]string{
+		"-controller", c.ControllerURL,
+		"-agent-id", "ah-testinfra",
+	}, c.config.AHArgs...))
+	c.IH = c.process(ihClientBinary, ihCert, append([]string{
+		"-controller", c.ControllerURL,
+		"-local", ihAddr,
+		"-proxy", relayAddr,
+		// 每个本地连接作为隧道内的独立流，AH 按流拨号目标，同一隧道可承载多次连接
+		"-multiplex",
+	}, c.config.IHArgs...))
+
+	if err := c.Controller.Start(); err != nil {
+		return err
+	}
+	if err := c.WaitControllerReady(c.config.StartTimeout); err != nil {
+		return err
+	}
+	if err := c.StartAH(); err != nil {
+		return err
+	}
+	return c.StartIH()
+}
+
+// process 创建使用指定证书的组件进程（未启动）
+func (c *Cluster) process(binary string, certs *CertFiles, args []string) *Process {
+	return &Process{
+		Name:    binary,
+		Path:    filepath.Join(c.config.BinDir, binary),
+		Args:    append([]string{"-cert", certs.CertFile, "-key", certs.KeyFile, "-ca", c.PKI.CAFile}, args...),
+		Dir:     c.Dir,
+		LogFile: filepath.Join(c.Dir, binary+".log"),
+	}
+}
+
+// writeSeedFiles 写入回显目标的服务与授权 IH 的策略，Controller 启动时加载
+func (c *Cluster) writeSeedFiles() (string, string, error) {
+	services := fmt.Sprintf(`services:
+  - service_id: %s
+    service_name: testinfra echo target
+    target_host: 127.0.0.1
+    target_port: %d
+    protocol: tcp
+`, c.ServiceID, c.Target.Port())
+	policies := fmt.Sprintf(`policies:
+  - policy_id: testinfra-%s
+    client_id: %s
+    service_id: %s
+`, c.ServiceID, ihClientID, c.ServiceID)
+
+	servicesFile := filepath.Join(c.Dir, "services.yaml")
+	policiesFile := filepath.Join(c.Dir, "policies.yaml")
+	if err := os.WriteFile(servicesFile, []byte(services), 0o600); err != nil {
+		return "", "", err
+	}
+	if err := os.WriteFile(policiesFile, []byte(policies), 0o600); err != nil {
+		return "", "", err
+	}
+	return servicesFile, policiesFile, nil
+}
+
+// tlsConfig 测试进程访问 Controller API 使用的 mTLS 配置
+func (c *Cluster) tlsConfig(certs *CertFiles) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certs.CertFile, certs.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	caPEM, err := os.ReadFile(c.PKI.CAFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(caPEM)
+	return &tls.Config{Certificates: []tls.Certificate{cert}, RootCAs: pool, MinVersion: tls.VersionTLS12}, nil
+}
+
+// WaitControllerReady 轮询 Controller /readyz 直到返回 200
+func (c *Cluster) WaitControllerReady(timeout time.Duration) error {
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: c.clientTLS}, Timeout: 2 * time.Second}
+	defer client.CloseIdleConnections()
+
+	deadline := time.Now().Add(timeout)
+	for {
+		resp, err := client.Get(c.ControllerURL + "/readyz")
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return nil
+			}
+			err = fmt.Errorf("status %d", resp.StatusCode)
+		}
+		if !c.Controller.Running() {
+			return fmt.Errorf("controller exited (%v):\n%s", c.Controller.exitErr(), tail(c.Controller.Logs()))
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("controller not ready: %v", err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// StartAH 启动 AH 并等待其连接 Controller（已获取服务配置并订阅事件）
+func (c *Cluster) StartAH() error {
+	offset := c.AH.logOffset()
+	if err := c.AH.Start(); err != nil {
+		return err
+	}
+	return c.AH.waitForLogAfter(offset, "已连接到Controller", c.config.StartTimeout)
+}
+
+// StartIH 启动 IH 并等待其完成握手、创建隧道并开始监听本地地址
+func (c *Cluster) StartIH() error {
+	offset := c.IH.logOffset()
+	if err := c.IH.Start(); err != nil {
+		return err
+	}
+	return c.IH.waitForLogAfter(offset, "Proxy ready for connections", c.config.StartTimeout)
+}
+
+// RestartController 重启 Controller 并等待就绪
+func (c *Cluster) RestartController() error {
+	if err := c.Controller.Restart(); err != nil {
+		return err
+	}
+	return c.WaitControllerReady(c.config.StartTimeout)
+}
+
+// RestartAH 重启 AH 并等待重新连接
+func (c *Cluster) RestartAH() error {
+	if err := c.AH.Stop(); err != nil {
+		return err
+	}
+	return c.StartAH()
+}
+
+// RestartIH 重启 IH 并等待就绪（新会话与新隧道）
+func (c *Cluster) RestartIH() error {
+	if err := c.IH.Stop(); err != nil {
+		return err
+	}
+	return c.StartIH()
+}
+
+// RoundTrip 经 IH 本地地址发送 payload，并校验在 timeout 内收到相同的回显
+func (c *Cluster) RoundTrip(payload []byte, timeout time.Duration) error {
+	conn, err := net.DialTimeout("tcp", c.IHAddr, timeout)
+	if err != nil {
+		return fmt.Errorf("dial IH: %w", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	// 边写边读，大负载时避免两端缓冲写满互相阻塞
+	writeErr := make(chan error, 1)
+	go func() {
+		_, err := conn.Write(payload)
+		writeErr <- err
+	}()
+	echo := make([]byte, len(payload))
+	if _, err := io.ReadFull(conn, echo); err != nil {
+		return fmt.Errorf("read echo: %w", err)
+	}
+	if err := <-writeErr; err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+	if !bytes.Equal(echo, payload) {
+		return fmt.Errorf("echo mismatch: sent %d bytes, received different data", len(payload))
+	}
+	return nil
+}
+
+// WaitForTraffic 重试 RoundTrip 直到端到端链路可用（如 AH 刚重连、隧道事件尚未送达）
+func (c *Cluster) WaitForTraffic(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	payload := []byte("testinfra-ping")
+	for {
+		err := c.RoundTrip(payload, 2*time.Second)
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("no end-to-end traffic after %s: %w", timeout, err)
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+// Close 停止全部进程与目标服务
+func (c *Cluster) Close() {
+	for _, p := range []*Process{c.IH, c.AH, c.Controller} {
+		if p != nil {
+			p.Stop()
+		}
+	}
+	if c.Target != nil {
+		c.Target.Stop()
+	}
+}
+
+func (c *Cluster) dumpLogs(t testing.TB) {
+	for _, p := range []*Process{c.Controller, c.AH, c.IH} {
+		if p != nil {
+			t.Logf("=== %s output ===\n%s", p.Name, tail(p.Logs()))
+		}
+	}
+}
+
+// freeAddrs 分配 Controller API、中继与 IH 本地代理使用的空闲端口
+func freeAddrs() (string, string, string, error) {
+	var addrs [3]string
+	for i := range addrs {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return "", "", "", err
+		}
+		addrs[i] = ln.Addr().String()
+		defer ln.Close()
+	}
+	return addrs[0], addrs[1], addrs[2], nil
+}
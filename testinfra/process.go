@@ -0,0 +1,196 @@
+package testinfra
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// stopTimeout SIGTERM 后等待进程退出的时间，超时后 SIGKILL
+const stopTimeout = 10 * time.Second
+
+// Process 以独立进程运行的组件（Controller / AH / IH），输出同时写入内存缓冲与日志文件
+type Process struct {
+	Name    string
+	Path    string
+	Args    []string
+	Dir     string
+	LogFile string
+
+	mu     sync.Mutex
+	cmd    *exec.Cmd
+	output bytes.Buffer
+	exited chan struct{}
+	err    error
+}
+
+// Start 启动进程；已在运行时返回错误
+func (p *Process) Start() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cmd != nil {
+		return fmt.Errorf("%s already running", p.Name)
+	}
+
+	var out io.Writer = &lockedWriter{mu: &p.mu, buf: &p.output}
+	var logFile *os.File
+	if p.LogFile != "" {
+		f, err := os.OpenFile(p.LogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
+		}
+		logFile = f
+		out = io.MultiWriter(out, f)
+	}
+
+	cmd := exec.Command(p.Path, p.Args...)
+	cmd.Dir = p.Dir
+	cmd.Stdout = out
+	cmd.Stderr = out
+	if err := cmd.Start(); err != nil {
+		if logFile != nil {
+			logFile.Close()
+		}
+		return fmt.Errorf("start %s: %w", p.Name, err)
+	}
+
+	exited := make(chan struct{})
+	p.cmd, p.exited, p.err = cmd, exited, nil
+	go func() {
+		err := cmd.Wait()
+		if logFile != nil {
+			logFile.Close()
+		}
+		p.mu.Lock()
+		p.err = err
+		p.mu.Unlock()
+		close(exited)
+	}()
+	return nil
+}
+
+// Stop 发送 SIGTERM 优雅停止，超时后 SIGKILL；未运行时为空操作
+func (p *Process) Stop() error {
+	return p.signal(syscall.SIGTERM)
+}
+
+// Kill 立即 SIGKILL，模拟进程崩溃
+func (p *Process) Kill() error {
+	return p.signal(syscall.SIGKILL)
+}
+
+// Restart 停止后重新启动
+func (p *Process) Restart() error {
+	if err := p.Stop(); err != nil {
+		return err
+	}
+	return p.Start()
+}
+
+func (p *Process) signal(sig syscall.Signal) error {
+	p.mu.Lock()
+	cmd, exited := p.cmd, p.exited
+	p.mu.Unlock()
+	if cmd == nil {
+		return nil
+	}
+
+	cmd.Process.Signal(sig)
+	select {
+	case <-exited:
+	case <-time.After(stopTimeout):
+		cmd.Process.Kill()
+		<-exited
+	}
+
+	p.mu.Lock()
+	p.cmd = nil
+	p.mu.Unlock()
+	return nil
+}
+
+// Running 进程是否在运行（已启动且未退出）
+func (p *Process) Running() bool {
+	p.mu.Lock()
+	exited := p.exited
+	running := p.cmd != nil
+	p.mu.Unlock()
+	if !running {
+		return false
+	}
+	select {
+	case <-exited:
+		return false
+	default:
+		return true
+	}
+}
+
+// Logs 返回进程启动以来（含重启前）的全部输出
+func (p *Process) Logs() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.output.String()
+}
+
+// WaitForLog 等待输出中出现 substr；进程提前退出或超时返回错误（附最近输出）
+func (p *Process) WaitForLog(substr string, timeout time.Duration) error {
+	return p.waitForLogAfter(0, substr, timeout)
+}
+
+// logOffset 当前输出长度，配合 waitForLogAfter 只匹配之后的新输出（如重启后）
+func (p *Process) logOffset() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.output.Len()
+}
+
+func (p *Process) waitForLogAfter(offset int, substr string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		logs := p.Logs()
+		if offset <= len(logs) && strings.Contains(logs[offset:], substr) {
+			return nil
+		}
+		if !p.Running() {
+			return fmt.Errorf("%s exited before logging %q (%v):\n%s", p.Name, substr, p.exitErr(), tail(logs))
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for %s to log %q:\n%s", p.Name, substr, tail(logs))
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func (p *Process) exitErr() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+// tail 返回最后 4KB 输出，用于错误信息
+func tail(logs string) string {
+	const max = 4096
+	if len(logs) > max {
+		return "..." + logs[len(logs)-max:]
+	}
+	return logs
+}
+
+// lockedWriter 与 Logs 共享锁写入缓冲
+type lockedWriter struct {
+	mu  *sync.Mutex
+	buf *bytes.Buffer
+}
+
+func (w *lockedWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.Write(b)
+}
@@ -0,0 +1,91 @@
+package testinfra
+
+import (
+	"io"
+	"net"
+	"sync"
+)
+
+// Target 回显目标服务：把收到的数据原样写回；Stop 后可在同一地址重新 Start，模拟目标故障与恢复
+type Target struct {
+	Addr string
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	wg       sync.WaitGroup
+}
+
+// NewTarget 在 127.0.0.1 的随机端口启动回显目标
+func NewTarget() (*Target, error) {
+	t := &Target{Addr: "127.0.0.1:0", conns: make(map[net.Conn]struct{})}
+	if err := t.Start(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Start 开始监听 Addr；已在运行时为空操作
+func (t *Target) Start() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.listener != nil {
+		return nil
+	}
+	ln, err := net.Listen("tcp", t.Addr)
+	if err != nil {
+		return err
+	}
+	t.listener = ln
+	t.Addr = ln.Addr().String()
+
+	t.wg.Add(1)
+	go t.acceptLoop(ln)
+	return nil
+}
+
+// Stop 关闭监听与所有连接；之后的连接被拒绝
+func (t *Target) Stop() {
+	t.mu.Lock()
+	ln := t.listener
+	t.listener = nil
+	for conn := range t.conns {
+		conn.Close()
+	}
+	t.mu.Unlock()
+
+	if ln != nil {
+		ln.Close()
+	}
+	t.wg.Wait()
+}
+
+// Port 监听端口
+func (t *Target) Port() int {
+	_, port, _ := net.SplitHostPort(t.Addr)
+	n, _ := net.LookupPort("tcp", port)
+	return n
+}
+
+func (t *Target) acceptLoop(ln net.Listener) {
+	defer t.wg.Done()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		t.mu.Lock()
+		t.conns[conn] = struct{}{}
+		t.mu.Unlock()
+
+		t.wg.Add(1)
+		go func() {
+			defer t.wg.Done()
+			io.Copy(conn, conn)
+			conn.Close()
+			t.mu.Lock()
+			delete(t.conns, conn)
+			t.mu.Unlock()
+		}()
+	}
+}
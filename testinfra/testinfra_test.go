@@ -0,0 +1,114 @@
+package testinfra
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestPKI(t *testing.T) {
+	pki, err := NewPKI(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := pki.Issue("controller", "localhost", "localhost", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pair, err := tls.LoadX509KeyPair(files.CertFile, files.KeyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	caPEM, err := os.ReadFile(pki.CAFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(caPEM)
+	for _, usage := range []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth} {
+		if _, err := leaf.Verify(x509.VerifyOptions{Roots: roots, DNSName: "localhost", KeyUsages: []x509.ExtKeyUsage{usage}}); err != nil {
+			t.Errorf("verify %v: %v", usage, err)
+		}
+	}
+	if err := leaf.VerifyHostname("127.0.0.1"); err != nil {
+		t.Errorf("IP SAN: %v", err)
+	}
+	if _, err := leaf.Verify(x509.VerifyOptions{Roots: pki.CertPool(), DNSName: "localhost"}); err != nil {
+		t.Errorf("verify with CertPool: %v", err)
+	}
+}
+
+func TestPKI_URISAN(t *testing.T) {
+	pki, err := NewPKI(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := pki.Issue("relay", "relay-dmz", "127.0.0.1", "spiffe://sdp.internal/relay/dmz-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pair, err := tls.LoadX509KeyPair(files.CertFile, files.KeyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leaf.URIs) != 1 || leaf.URIs[0].String() != "spiffe://sdp.internal/relay/dmz-1" {
+		t.Errorf("URIs = %v", leaf.URIs)
+	}
+	if len(leaf.IPAddresses) != 1 || len(leaf.DNSNames) != 0 {
+		t.Errorf("IPAddresses = %v, DNSNames = %v", leaf.IPAddresses, leaf.DNSNames)
+	}
+}
+
+func TestTargetRestart(t *testing.T) {
+	target, err := NewTarget()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer target.Stop()
+
+	echo := func() error {
+		conn, err := net.DialTimeout("tcp", target.Addr, time.Second)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(time.Second))
+		if _, err := conn.Write([]byte("ping")); err != nil {
+			return err
+		}
+		buf := make([]byte, 4)
+		_, err = io.ReadFull(conn, buf)
+		return err
+	}
+	if err := echo(); err != nil {
+		t.Fatalf("echo: %v", err)
+	}
+
+	addr := target.Addr
+	target.Stop()
+	if err := echo(); err == nil {
+		t.Fatal("stopped target should refuse connections")
+	}
+	if err := target.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if target.Addr != addr {
+		t.Errorf("restarted on %s, want %s", target.Addr, addr)
+	}
+	if err := echo(); err != nil {
+		t.Fatalf("echo after restart: %v", err)
+	}
+}
@@ -0,0 +1,133 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ClientIPResolver 从请求中提取真实客户端 IP
+//
+// 仅当直接对端（r.RemoteAddr）位于可信代理网段时才采信转发头：
+//   - X-Forwarded-For：从右向左跳过可信代理，第一个不可信地址即客户端
+//   - X-Real-IP：无 X-Forwarded-For 时使用
+//
+// 监听器启用 PROXY protocol 时 r.RemoteAddr 已是 LB 传递的源地址，同样适用上述规则。
+// 未配置可信代理时始终返回 r.RemoteAddr 的 IP，转发头可被客户端伪造，不会被采信
+type ClientIPResolver struct {
+	trusted []*net.IPNet
+}
+
+// NewClientIPResolver 创建客户端 IP 解析器
+// trustedProxies 为可信代理（LB、反向代理）的 CIDR 或单个 IP
+func NewClientIPResolver(trustedProxies []string) (*ClientIPResolver, error) {
+	resolver := &ClientIPResolver{}
+	for _, entry := range trustedProxies {
+		network, err := parseCIDROrIP(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+		}
+		resolver.trusted = append(resolver.trusted, network)
+	}
+	return resolver, nil
+}
+
+// parseCIDROrIP 解析 CIDR，单个 IP 视为 /32 或 /128
+func parseCIDROrIP(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, network, err := net.ParseCIDR(s)
+		return network, err
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("not an IP address or CIDR")
+	}
+	bits := 128
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, bits = ip4, 32
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+// isTrusted 检查 IP 是否属于可信代理
+func (res *ClientIPResolver) isTrusted(ip net.IP) bool {
+	for _, network := range res.trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP 返回请求的真实客户端 IP（不含端口）
+func (res *ClientIPResolver) ClientIP(r *http.Request) string {
+	peer := remoteHost(r.RemoteAddr)
+	peerIP := net.ParseIP(peer)
+	if res == nil || peerIP == nil || !res.isTrusted(peerIP) {
+		return peer
+	}
+
+	if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+		hops := strings.Split(strings.Join(xff, ","), ",")
+		client := peer
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip := net.ParseIP(strings.TrimSpace(hops[i]))
+			if ip == nil {
+				// 无法解析的条目之后的地址不可信，停在最后一个可信代理
+				break
+			}
+			client = ip.String()
+			if !res.isTrusted(ip) {
+				break
+			}
+		}
+		return client
+	}
+
+	if realIP := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); realIP != nil {
+		return realIP.String()
+	}
+	return peer
+}
+
+// remoteHost 去掉 RemoteAddr 中的端口
+func remoteHost(remoteAddr string) string {
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		return host
+	}
+	return remoteAddr
+}
+
+type clientIPContextKey struct{}
+
+// ClientIPMiddleware 解析真实客户端 IP 并存入请求上下文
+// 审计、限流、策略 source_ip 条件等通过 ClientIPFromRequest 读取，保证各处取值一致
+func ClientIPMiddleware(resolver *ClientIPResolver) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), clientIPContextKey{}, resolver.ClientIP(r))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// ClientIPFromRequest 返回 ClientIPMiddleware 解析的客户端 IP
+// 未经过中间件时退化为 r.RemoteAddr 的 IP
+func ClientIPFromRequest(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPContextKey{}).(string); ok {
+		return ip
+	}
+	return remoteHost(r.RemoteAddr)
+}
+
+// ClientAddrFromRequest 返回 ip:port 形式的客户端地址
+// 客户端 IP 来自转发头时原始端口未知，端口为 0
+func ClientAddrFromRequest(r *http.Request) string {
+	ip := ClientIPFromRequest(r)
+	if ip == remoteHost(r.RemoteAddr) {
+		return r.RemoteAddr
+	}
+	return net.JoinHostPort(ip, "0")
+}
@@ -0,0 +1,79 @@
+package transport
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newClientIPRequest(remoteAddr string, headers map[string]string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = remoteAddr
+	for k, v := range headers {
+		r.Header.Set(k, v)
+	}
+	return r
+}
+
+func TestClientIPResolver(t *testing.T) {
+	resolver, err := NewClientIPResolver([]string{"10.0.0.0/8", "192.168.1.10"})
+	if err != nil {
+		t.Fatalf("NewClientIPResolver: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		want       string
+	}{
+		{"direct client", "203.0.113.7:5000", nil, "203.0.113.7"},
+		{"untrusted peer ignores XFF", "203.0.113.7:5000", map[string]string{"X-Forwarded-For": "1.2.3.4"}, "203.0.113.7"},
+		{"trusted LB", "10.0.0.2:40000", map[string]string{"X-Forwarded-For": "198.51.100.9"}, "198.51.100.9"},
+		{"spoofed leftmost entry", "10.0.0.2:40000", map[string]string{"X-Forwarded-For": "1.2.3.4, 198.51.100.9, 10.1.1.1"}, "198.51.100.9"},
+		{"single trusted IP", "192.168.1.10:40000", map[string]string{"X-Forwarded-For": "198.51.100.9"}, "198.51.100.9"},
+		{"all hops trusted", "10.0.0.2:40000", map[string]string{"X-Forwarded-For": "10.3.3.3"}, "10.3.3.3"},
+		{"garbage entry", "10.0.0.2:40000", map[string]string{"X-Forwarded-For": "unknown, 10.1.1.1"}, "10.1.1.1"},
+		{"X-Real-IP", "10.0.0.2:40000", map[string]string{"X-Real-IP": "198.51.100.9"}, "198.51.100.9"},
+		{"trusted peer without headers", "10.0.0.2:40000", nil, "10.0.0.2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resolver.ClientIP(newClientIPRequest(tt.remoteAddr, tt.headers)); got != tt.want {
+				t.Errorf("ClientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientIPResolver_InvalidCIDR(t *testing.T) {
+	if _, err := NewClientIPResolver([]string{"not-a-cidr"}); err == nil {
+		t.Fatal("expected error for invalid trusted proxy")
+	}
+}
+
+func TestClientIPMiddleware(t *testing.T) {
+	resolver, _ := NewClientIPResolver([]string{"10.0.0.0/8"})
+
+	var gotIP, gotAddr string
+	handler := ClientIPMiddleware(resolver)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotIP = ClientIPFromRequest(r)
+		gotAddr = ClientAddrFromRequest(r)
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), newClientIPRequest("10.0.0.2:40000", map[string]string{"X-Forwarded-For": "198.51.100.9"}))
+	if gotIP != "198.51.100.9" || gotAddr != "198.51.100.9:0" {
+		t.Errorf("forwarded: ip=%q addr=%q", gotIP, gotAddr)
+	}
+
+	handler.ServeHTTP(httptest.NewRecorder(), newClientIPRequest("203.0.113.7:5000", nil))
+	if gotIP != "203.0.113.7" || gotAddr != "203.0.113.7:5000" {
+		t.Errorf("direct: ip=%q addr=%q", gotIP, gotAddr)
+	}
+
+	// 未经过中间件时退化为 RemoteAddr
+	if ip := ClientIPFromRequest(newClientIPRequest("203.0.113.7:5000", nil)); ip != "203.0.113.7" {
+		t.Errorf("fallback ip = %q", ip)
+	}
+}
@@ -0,0 +1,82 @@
+package transport
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// 关闭通知（与 tunnel.CloseNoticeConn 一致）
+// 握手版本为 0x02 的客户端，中继 → 客户端方向按 [Type 1B][Length 4B BE][Payload] 成帧，
+// 中继断开隧道前发送 CLOSE 帧告知原因
+const (
+	closeNoticeVersion byte = 0x02
+
+	closeNoticeFrameData  byte = 0x01
+	closeNoticeFrameClose byte = 0x02
+
+	// closeNoticeTimeout 发送 CLOSE 帧的写超时，对端不读取时不阻塞断开
+	closeNoticeTimeout = time.Second
+)
+
+// noticeConn 请求了关闭通知的客户端连接：Write 写出 DATA 帧，notifyClose 写出 CLOSE 帧
+type noticeConn struct {
+	net.Conn
+
+	mu     sync.Mutex // 串行化转发 goroutine 与 notifyClose 的写入
+	once   sync.Once
+	closed bool
+	buf    []byte // 帧头与负载合并写出，每帧只产生一个 TLS 记录
+}
+
+// NetConn 返回被包装的连接（用于设置套接字选项）
+func (c *noticeConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// Write 将 p 作为一个 DATA 帧写出
+func (c *noticeConn) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return 0, io.ErrClosedPipe
+	}
+	if err := c.writeFrame(closeNoticeFrameData, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// notifyClose 发送 CLOSE 帧（只发送一次），之后的 Write 返回 io.ErrClosedPipe
+// 先设置写超时，使阻塞在慢速对端上的 DATA 帧写入尽快返回
+func (c *noticeConn) notifyClose(reason string) {
+	c.once.Do(func() {
+		c.Conn.SetWriteDeadline(time.Now().Add(closeNoticeTimeout))
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.closed = true
+		c.Conn.SetWriteDeadline(time.Now().Add(closeNoticeTimeout))
+		c.writeFrame(closeNoticeFrameClose, []byte(reason))
+	})
+}
+
+// writeFrame 写出一帧（调用方持有 mu）
+func (c *noticeConn) writeFrame(frameType byte, payload []byte) error {
+	c.buf = append(c.buf[:0], frameType, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(c.buf[1:5], uint32(len(payload)))
+	c.buf = append(c.buf, payload...)
+	_, err := c.Conn.Write(c.buf)
+	return err
+}
+
+// notifyClose 向请求了关闭通知的连接发送关闭原因，其他连接不做处理
+func notifyClose(conn net.Conn, reason string) {
+	if nc, ok := conn.(*noticeConn); ok {
+		nc.notifyClose(reason)
+	}
+}
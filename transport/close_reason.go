@@ -0,0 +1,91 @@
+package transport
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"syscall"
+)
+
+// CloseReason 中继连接的关闭原因
+//
+// 每个接入连接在结束时恰好记录一次：未完成配对的连接各记一次，配对成功的 IH/AH 两条连接作为一个中继记一次。
+// 与关闭通知（CLOSE 帧）共用的取值与 tunnel.RelayClose* 一致
+type CloseReason string
+
+const (
+	// 配对前
+	CloseReasonHandshakeFailed CloseReason = "handshake_failed" // TLS 握手或隧道握手帧读取失败、缺少客户端证书
+	CloseReasonUnknownClient   CloseReason = "unknown_client"   // 证书 CN 既不是 IH 也不是 AH
+	CloseReasonCapacity        CloseReason = "capacity"         // 达到 MaxConnections，接入即拒绝
+	CloseReasonFaultInjected   CloseReason = "fault_injected"   // 故障注入丢弃（faults.DropRelayConn）
+	CloseReasonPairingTimeout  CloseReason = "pairing_timeout"  // 对端未在配对超时内连接
+
+	// 多跳隧道（配对前）
+	CloseReasonChainRejected      CloseReason = "chain_rejected"       // 多跳握手被拒绝（上一跳身份不可信、发起方不是 IH、本中继未配置转发）
+	CloseReasonNextHopUnreachable CloseReason = "next_hop_unreachable" // 无法连接下一跳中继
+
+	// 中继过程中
+	CloseReasonPeerClosed CloseReason = "peer_closed" // 一端正常关闭（EOF），正常结束
+	CloseReasonPeerReset  CloseReason = "peer_reset"  // 一端异常断开（RST、读写错误）
+	CloseReasonIdle       CloseReason = "idle"        // 读写超时
+
+	// 中继或 Controller 主动断开（CloseTunnelWithReason / Drain / Stop）
+	CloseReasonShutdown      CloseReason = "shutdown"        // Controller 停止或升级排空到期
+	CloseReasonTerminated    CloseReason = "terminated"      // 未指明原因的主动断开
+	CloseReasonRejected      CloseReason = "tunnel_rejected" // 对账时隧道被拒绝
+	CloseReasonUnknownTunnel CloseReason = "unknown_tunnel"  // 对账宽限期后仍无 AH 上报的隧道
+	CloseReasonPolicyRevoked CloseReason = "policy_revoked"  // 访问策略被撤销
+	CloseReasonQuota         CloseReason = "quota_exceeded"  // 超出流量或连接配额
+	CloseReasonDeleted       CloseReason = "tunnel_deleted"  // 隧道被删除
+	CloseReasonExpired       CloseReason = "tunnel_expired"  // 隧道已过期
+)
+
+// knownCloseReasons CloseTunnelWithReason 可直接计入统计的原因，其他取值按 terminated 统计，避免指标标签基数失控
+var knownCloseReasons = map[CloseReason]bool{
+	CloseReasonShutdown:      true,
+	CloseReasonTerminated:    true,
+	CloseReasonRejected:      true,
+	CloseReasonUnknownTunnel: true,
+	CloseReasonPolicyRevoked: true,
+	CloseReasonIdle:          true,
+	CloseReasonQuota:         true,
+	CloseReasonDeleted:       true,
+	CloseReasonExpired:       true,
+}
+
+// closeReasonOf 将主动断开时给出的原因映射为统计用的关闭原因
+func closeReasonOf(reason string) CloseReason {
+	if r := CloseReason(reason); knownCloseReasons[r] {
+		return r
+	}
+	return CloseReasonTerminated
+}
+
+// IsError 关闭原因是否计为中继错误（ErrorCount 与 tunnel_relay_errors_total）
+func (r CloseReason) IsError() bool {
+	switch r {
+	case CloseReasonHandshakeFailed, CloseReasonUnknownClient, CloseReasonPairingTimeout, CloseReasonPeerReset, CloseReasonIdle,
+		CloseReasonChainRejected, CloseReasonNextHopUnreachable:
+		return true
+	}
+	return false
+}
+
+// classifyRelayError 由转发结束时 io.Copy 返回的错误判断关闭原因（nil 即读到 EOF）
+func classifyRelayError(err error) CloseReason {
+	switch {
+	case err == nil, errors.Is(err, io.EOF), errors.Is(err, net.ErrClosed):
+		return CloseReasonPeerClosed
+	case errors.Is(err, os.ErrDeadlineExceeded):
+		return CloseReasonIdle
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE), errors.Is(err, syscall.ECONNABORTED):
+		return CloseReasonPeerReset
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return CloseReasonIdle
+	}
+	return CloseReasonPeerReset
+}
@@ -0,0 +1,144 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/houzhh15/sdp-common/clock"
+	"github.com/houzhh15/sdp-common/tunnel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestClassifyRelayError tests mapping io.Copy errors to close reasons
+func TestClassifyRelayError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want CloseReason
+	}{
+		{"eof", nil, CloseReasonPeerClosed},
+		{"explicit eof", io.EOF, CloseReasonPeerClosed},
+		{"closed", fmt.Errorf("read: %w", net.ErrClosed), CloseReasonPeerClosed},
+		{"deadline", &net.OpError{Op: "read", Err: os.ErrDeadlineExceeded}, CloseReasonIdle},
+		{"reset", &net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, CloseReasonPeerReset},
+		{"broken pipe", &net.OpError{Op: "write", Err: os.NewSyscallError("write", syscall.EPIPE)}, CloseReasonPeerReset},
+		{"other", errors.New("tls: bad record MAC"), CloseReasonPeerReset},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, classifyRelayError(tt.err))
+		})
+	}
+}
+
+// TestCloseReasonOf tests that explicit close reasons keep a bounded label set
+func TestCloseReasonOf(t *testing.T) {
+	assert.Equal(t, CloseReasonPolicyRevoked, closeReasonOf(tunnel.RelayClosePolicyRevoked))
+	assert.Equal(t, CloseReasonShutdown, closeReasonOf(tunnel.RelayCloseShutdown))
+	assert.Equal(t, CloseReasonTerminated, closeReasonOf("operator said so"))
+	assert.Equal(t, CloseReasonTerminated, closeReasonOf(string(CloseReasonHandshakeFailed)))
+
+	assert.True(t, CloseReasonPairingTimeout.IsError())
+	assert.True(t, CloseReasonPeerReset.IsError())
+	assert.False(t, CloseReasonPeerClosed.IsError())
+	assert.False(t, CloseReasonPolicyRevoked.IsError())
+}
+
+// TestRelayCloseReasons_Terminated tests that an explicit close is counted with its reason rather than as an error
+func TestRelayCloseReasons_Terminated(t *testing.T) {
+	server := &tunnelRelayServer{logger: &noopLogger{}, clock: clock.Real()}
+
+	ih, ihPeer := net.Pipe()
+	ah, ahPeer := net.Pipe()
+	defer ihPeer.Close()
+	defer ahPeer.Close()
+
+	done := make(chan error, 1)
+	go func() { done <- server.relayData(ih, ah, "tunnel-001", "ih-client", time.Now(), nil) }()
+
+	require.Eventually(t, func() bool {
+		return server.CloseTunnelWithReason("tunnel-001", tunnel.RelayClosePolicyRevoked)
+	}, 2*time.Second, 10*time.Millisecond)
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("relay did not finish after close")
+	}
+
+	stats := server.GetStats()
+	assert.Equal(t, map[CloseReason]uint64{CloseReasonPolicyRevoked: 1}, stats.CloseReasons)
+	assert.Zero(t, stats.ErrorCount)
+}
+
+// TestRelayCloseReasons_PairingTimeout tests that an unpaired connection is counted once as pairing_timeout
+func TestRelayCloseReasons_PairingTimeout(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	server := &tunnelRelayServer{logger: &noopLogger{}, clock: clk, pairingTimeout: time.Second}
+
+	conn, peer := net.Pipe()
+	defer peer.Close()
+
+	done := make(chan error, 1)
+	go func() { done <- server.handleAHConnection(conn, "tunnel-001", "ah-agent") }()
+	clk.BlockUntil(1)
+	clk.Advance(time.Second)
+
+	select {
+	case err := <-done:
+		assert.ErrorContains(t, err, "pairing timeout")
+	case <-time.After(2 * time.Second):
+		t.Fatal("pairing did not time out")
+	}
+
+	stats := server.GetStats()
+	assert.Equal(t, map[CloseReason]uint64{CloseReasonPairingTimeout: 1}, stats.CloseReasons)
+	assert.Equal(t, 1, stats.ErrorCount)
+	assert.Zero(t, stats.PendingAH)
+}
+
+// TestRelayCloseReasons_PairedSurvivesTimeout tests that a waiting side taken by its peer is not closed at the pairing deadline
+func TestRelayCloseReasons_PairedSurvivesTimeout(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	server := &tunnelRelayServer{logger: &noopLogger{}, clock: clk, pairingTimeout: time.Second}
+
+	ah, ahPeer := net.Pipe()
+	ih, ihPeer := net.Pipe()
+	defer ahPeer.Close()
+
+	ahDone := make(chan error, 1)
+	go func() { ahDone <- server.handleAHConnection(ah, "tunnel-001", "ah-agent") }()
+	clk.BlockUntil(1)
+
+	ihDone := make(chan error, 1)
+	go func() { ihDone <- server.handleIHConnection(ih, "tunnel-001", "ih-client", clk.Now(), nil) }()
+	require.Eventually(t, func() bool { return len(server.GetTunnelStats()) == 1 }, 2*time.Second, 10*time.Millisecond)
+
+	// 配对超时到期后中继仍然可用
+	clk.Advance(2 * time.Second)
+	go ihPeer.Write([]byte("ping"))
+	buf := make([]byte, 4)
+	_, err := io.ReadFull(ahPeer, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "ping", string(buf))
+
+	ihPeer.Close()
+	for _, done := range []chan error{ihDone, ahDone} {
+		select {
+		case err := <-done:
+			assert.NoError(t, err)
+		case <-time.After(2 * time.Second):
+			t.Fatal("relay did not finish after peer closed")
+		}
+	}
+
+	stats := server.GetStats()
+	assert.Equal(t, map[CloseReason]uint64{CloseReasonPeerClosed: 1}, stats.CloseReasons)
+	assert.Zero(t, stats.ErrorCount)
+}
@@ -0,0 +1,119 @@
+package transport
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSConfig 跨域资源共享配置（浏览器管理控制台访问 Controller API）
+// 默认关闭：AllowedOrigins 为空时不输出任何 CORS 响应头
+type CORSConfig struct {
+	// AllowedOrigins 允许的来源，如 "https://admin.example.com"；"*" 表示任意来源（不可与 AllowCredentials 同用）
+	AllowedOrigins []string `yaml:"allowed_origins" json:"allowed_origins"`
+
+	// AllowedMethods 允许的方法（默认 GET, POST, PUT, DELETE, OPTIONS）
+	AllowedMethods []string `yaml:"allowed_methods" json:"allowed_methods"`
+
+	// AllowedHeaders 允许的请求头（默认 Authorization, Content-Type, Accept-Version, Last-Event-ID）
+	AllowedHeaders []string `yaml:"allowed_headers" json:"allowed_headers"`
+
+	// ExposedHeaders 浏览器可读取的响应头
+	ExposedHeaders []string `yaml:"exposed_headers" json:"exposed_headers"`
+
+	// AllowCredentials 是否允许携带凭证（Cookie、客户端证书）
+	AllowCredentials bool `yaml:"allow_credentials" json:"allow_credentials"`
+
+	// MaxAge 预检结果缓存时间
+	MaxAge time.Duration `yaml:"max_age" json:"max_age"`
+}
+
+// Enabled 是否启用 CORS
+func (c *CORSConfig) Enabled() bool {
+	return c != nil && len(c.AllowedOrigins) > 0
+}
+
+// allowOrigin 返回应写入 Access-Control-Allow-Origin 的值，不允许时返回空
+func (c *CORSConfig) allowOrigin(origin string) string {
+	for _, allowed := range c.AllowedOrigins {
+		if allowed == "*" {
+			if c.AllowCredentials {
+				// 携带凭证时禁止通配，回显具体来源同样不安全，直接拒绝
+				return ""
+			}
+			return "*"
+		}
+		if strings.EqualFold(allowed, origin) {
+			return origin
+		}
+	}
+	return ""
+}
+
+// CORSMiddleware 创建 CORS 中间件
+// 未配置（nil 或 AllowedOrigins 为空）时直接透传；预检请求（OPTIONS + Access-Control-Request-Method）
+// 在中间件内应答 204，不进入业务 handler。SSE 等流式响应同样在此写入 CORS 头。
+func CORSMiddleware(config *CORSConfig) func(http.Handler) http.Handler {
+	if !config.Enabled() {
+		return func(next http.Handler) http.Handler { return next }
+	}
+
+	methods := config.AllowedMethods
+	if len(methods) == 0 {
+		methods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodOptions}
+	}
+	headers := config.AllowedHeaders
+	if len(headers) == 0 {
+		headers = []string{"Authorization", "Content-Type", "Accept-Version", "Last-Event-ID"}
+	}
+	allowMethods := strings.Join(methods, ", ")
+	allowHeaders := strings.Join(headers, ", ")
+	exposeHeaders := strings.Join(config.ExposedHeaders, ", ")
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Add("Vary", "Origin")
+			allowed := config.allowOrigin(origin)
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+			if allowed == "" {
+				if preflight {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+				// 非预检请求不附带 CORS 头，由浏览器拦截响应
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("Access-Control-Allow-Origin", allowed)
+			if config.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			if preflight {
+				w.Header().Add("Vary", "Access-Control-Request-Method")
+				w.Header().Add("Vary", "Access-Control-Request-Headers")
+				w.Header().Set("Access-Control-Allow-Methods", allowMethods)
+				w.Header().Set("Access-Control-Allow-Headers", allowHeaders)
+				if config.MaxAge > 0 {
+					w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(config.MaxAge.Seconds())))
+				}
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			if exposeHeaders != "" {
+				w.Header().Set("Access-Control-Expose-Headers", exposeHeaders)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
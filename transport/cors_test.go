@@ -0,0 +1,128 @@
+package transport
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newCORSTestHandler(config *CORSConfig) (http.Handler, *int) {
+	calls := 0
+	handler := CORSMiddleware(config)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusOK)
+	}))
+	return handler, &calls
+}
+
+func TestCORSMiddleware_DisabledByDefault(t *testing.T) {
+	for _, config := range []*CORSConfig{nil, {}} {
+		handler, calls := newCORSTestHandler(config)
+
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/tunnels", nil)
+		req.Header.Set("Origin", "https://evil.example.com")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != "" {
+			t.Errorf("expected no CORS header when disabled, got %q", got)
+		}
+		if *calls != 1 {
+			t.Errorf("expected handler to be called once, got %d", *calls)
+		}
+	}
+}
+
+func TestCORSMiddleware_AllowedOrigin(t *testing.T) {
+	handler, calls := newCORSTestHandler(&CORSConfig{
+		AllowedOrigins:   []string{"https://admin.example.com"},
+		AllowCredentials: true,
+		ExposedHeaders:   []string{"API-Version"},
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/agent/tunnels/stream", nil)
+	req.Header.Set("Origin", "https://admin.example.com")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://admin.example.com" {
+		t.Errorf("Allow-Origin = %q", got)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Credentials"); got != "true" {
+		t.Errorf("Allow-Credentials = %q", got)
+	}
+	if got := w.Header().Get("Access-Control-Expose-Headers"); got != "API-Version" {
+		t.Errorf("Expose-Headers = %q", got)
+	}
+	if *calls != 1 {
+		t.Errorf("expected handler to be called once, got %d", *calls)
+	}
+}
+
+func TestCORSMiddleware_DisallowedOrigin(t *testing.T) {
+	handler, calls := newCORSTestHandler(&CORSConfig{AllowedOrigins: []string{"https://admin.example.com"}})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/tunnels", nil)
+	req.Header.Set("Origin", "https://evil.example.com")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("expected no Allow-Origin for disallowed origin, got %q", got)
+	}
+
+	// 预检被拒绝且不进入 handler
+	req = httptest.NewRequest(http.MethodOptions, "/api/v1/tunnels", nil)
+	req.Header.Set("Origin", "https://evil.example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("preflight status = %d, want 403", w.Code)
+	}
+	if *calls != 1 {
+		t.Errorf("expected handler to be called once, got %d", *calls)
+	}
+}
+
+func TestCORSMiddleware_Preflight(t *testing.T) {
+	handler, calls := newCORSTestHandler(&CORSConfig{
+		AllowedOrigins: []string{"https://admin.example.com"},
+		MaxAge:         10 * time.Minute,
+	})
+
+	req := httptest.NewRequest(http.MethodOptions, "/api/v1/tunnels", nil)
+	req.Header.Set("Origin", "https://admin.example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Errorf("status = %d, want 204", w.Code)
+	}
+	if w.Header().Get("Access-Control-Allow-Methods") == "" || w.Header().Get("Access-Control-Allow-Headers") == "" {
+		t.Error("expected Allow-Methods and Allow-Headers on preflight")
+	}
+	if got := w.Header().Get("Access-Control-Max-Age"); got != "600" {
+		t.Errorf("Max-Age = %q, want 600", got)
+	}
+	if *calls != 0 {
+		t.Errorf("preflight should not reach handler, got %d calls", *calls)
+	}
+}
+
+func TestCORSMiddleware_WildcardWithCredentials(t *testing.T) {
+	handler, _ := newCORSTestHandler(&CORSConfig{
+		AllowedOrigins:   []string{"*"},
+		AllowCredentials: true,
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/tunnels", nil)
+	req.Header.Set("Origin", "https://any.example.com")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("wildcard must not be combined with credentials, got %q", got)
+	}
+}
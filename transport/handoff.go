@@ -0,0 +1,127 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// InheritedListenersEnv 继承监听器的环境变量，格式 "name=fd[,name=fd...]"
+// 由 StartProcessWithListeners 为新进程设置；新进程通过 Listen / InheritedListener 按名称取回已打开的监听 socket，
+// 二进制升级期间端口不会关闭，内核队列中的连接由新进程继续 accept
+const InheritedListenersEnv = "SDP_INHERITED_LISTENERS"
+
+// Listen 创建 TCP 监听：优先使用父进程传递的同名监听器，否则绑定 addr
+// reusePort 在绑定时设置 SO_REUSEPORT，允许新旧进程同时绑定同一端口（Linux / BSD / macOS）
+// 返回值 inherited 表示监听器来自父进程
+func Listen(name, addr string, reusePort bool) (ln net.Listener, inherited bool, err error) {
+	ln, err = InheritedListener(name)
+	if err != nil {
+		return nil, false, err
+	}
+	if ln != nil {
+		return ln, true, nil
+	}
+
+	lc := net.ListenConfig{}
+	if reusePort {
+		lc.Control = setReusePort
+	}
+	ln, err = lc.Listen(context.Background(), "tcp", addr)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	return ln, false, nil
+}
+
+// InheritedListener 返回父进程传递的同名监听器，未传递时返回 nil
+func InheritedListener(name string) (net.Listener, error) {
+	fd, ok := inheritedFD(name)
+	if !ok {
+		return nil, nil
+	}
+
+	f := os.NewFile(uintptr(fd), name)
+	if f == nil {
+		return nil, fmt.Errorf("inherited listener %s: invalid fd %d", name, fd)
+	}
+	defer f.Close()
+
+	ln, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("inherited listener %s: %w", name, err)
+	}
+	return ln, nil
+}
+
+// inheritedFD 解析 InheritedListenersEnv 中指定名称的 fd
+func inheritedFD(name string) (int, bool) {
+	for _, pair := range strings.Split(os.Getenv(InheritedListenersEnv), ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || key != name {
+			continue
+		}
+		fd, err := strconv.Atoi(value)
+		if err != nil || fd < 3 {
+			return 0, false
+		}
+		return fd, true
+	}
+	return 0, false
+}
+
+// StartProcessWithListeners 启动新进程（通常为升级后的同一二进制）并传递监听 socket
+// 子进程继承标准输入输出，监听器以 ExtraFiles 传递（fd 从 3 开始），名称与 fd 的对应关系写入 InheritedListenersEnv
+// 调用方之后可关闭自己的监听器副本，不影响子进程
+func StartProcessWithListeners(path string, args []string, listeners map[string]net.Listener) (*os.Process, error) {
+	names := make([]string, 0, len(listeners))
+	for name := range listeners {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	files := make([]*os.File, 0, len(names))
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		fl, ok := listeners[name].(interface{ File() (*os.File, error) })
+		if !ok {
+			return nil, fmt.Errorf("listener %s does not support fd passing", name)
+		}
+		f, err := fl.File()
+		if err != nil {
+			return nil, fmt.Errorf("listener %s: %w", name, err)
+		}
+		files = append(files, f)
+		pairs = append(pairs, fmt.Sprintf("%s=%d", name, 2+len(files)))
+	}
+
+	env := make([]string, 0, len(os.Environ())+1)
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, InheritedListenersEnv+"=") {
+			env = append(env, kv)
+		}
+	}
+	env = append(env, InheritedListenersEnv+"="+strings.Join(pairs, ","))
+
+	cmd := exec.Command(path, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = env
+	cmd.ExtraFiles = files
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start %s: %w", path, err)
+	}
+	return cmd.Process, nil
+}
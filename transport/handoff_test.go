@@ -0,0 +1,65 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+
+package transport
+
+import (
+	"net"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListen_Inherited(t *testing.T) {
+	parent, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer parent.Close()
+
+	f, err := parent.(*net.TCPListener).File()
+	require.NoError(t, err)
+	// 与子进程一致，InheritedListener 独占传入的 fd 并负责关闭；
+	// 直接传 f.Fd() 会在 f 被回收时二次关闭同一 fd 号，误关之后复用该号的其他连接
+	fd, err := syscall.Dup(int(f.Fd()))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	t.Setenv(InheritedListenersEnv, "http=99,relay="+strconv.Itoa(fd))
+
+	ln, inherited, err := Listen("relay", "127.0.0.1:0", false)
+	require.NoError(t, err)
+	defer ln.Close()
+	assert.True(t, inherited)
+	assert.Equal(t, parent.Addr().String(), ln.Addr().String())
+
+	// 关闭父进程副本后继承的监听器仍可 accept
+	parent.Close()
+	go func() {
+		if conn, err := net.Dial("tcp", ln.Addr().String()); err == nil {
+			conn.Close()
+		}
+	}()
+	conn, err := ln.Accept()
+	require.NoError(t, err)
+	conn.Close()
+
+	// 未传递的名称回退为新绑定
+	other, inherited, err := Listen("grpc", "127.0.0.1:0", false)
+	require.NoError(t, err)
+	defer other.Close()
+	assert.False(t, inherited)
+}
+
+func TestListen_ReusePort(t *testing.T) {
+	first, _, err := Listen("relay", "127.0.0.1:0", true)
+	require.NoError(t, err)
+	defer first.Close()
+
+	// 新旧进程同时绑定同一端口
+	second, _, err := Listen("relay", first.Addr().String(), true)
+	require.NoError(t, err)
+	second.Close()
+
+	_, _, err = Listen("relay", first.Addr().String(), false)
+	assert.Error(t, err)
+}
@@ -6,24 +6,89 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 )
 
+// HTTPServerConfig HTTP 服务器限制配置（防御超大请求体与慢速攻击）
+type HTTPServerConfig struct {
+	ReadTimeout       time.Duration // 读取整个请求的超时（默认 15s）
+	ReadHeaderTimeout time.Duration // 读取请求头的超时，防御 slowloris（默认 5s）
+	WriteTimeout      time.Duration // 写响应超时（默认 15s）
+	IdleTimeout       time.Duration // Keep-Alive 空闲超时（默认 60s）
+	MaxHeaderBytes    int           // 请求头最大字节数（默认 1MB）
+
+	// MaxBodyBytes 默认请求体上限（默认 1MB），负数表示不限制
+	MaxBodyBytes int64
+	// RouteMaxBodyBytes 按路径前缀覆盖请求体上限（最长前缀优先），负数表示不限制
+	RouteMaxBodyBytes map[string]int64
+
+	// AcceptProxyProtocol 位于四层 LB 之后时启用，要求每个连接以 PROXY protocol v2 头开头，
+	// r.RemoteAddr 为 LB 传递的源地址
+	AcceptProxyProtocol bool
+}
+
+// DefaultHTTPServerConfig 返回默认配置
+func DefaultHTTPServerConfig() *HTTPServerConfig {
+	return &HTTPServerConfig{
+		ReadTimeout:       15 * time.Second,
+		ReadHeaderTimeout: 5 * time.Second,
+		WriteTimeout:      15 * time.Second,
+		IdleTimeout:       60 * time.Second,
+		MaxHeaderBytes:    1 << 20,
+		MaxBodyBytes:      1 << 20,
+	}
+}
+
 // httpServer HTTP/REST API 服务器实现
 // 支持 mTLS、中间件链、优雅关闭
 type httpServer struct {
 	server      *http.Server
 	tlsConfig   *tls.Config
+	config      *HTTPServerConfig
 	middlewares []func(http.Handler) http.Handler
 	mu          sync.RWMutex
 }
 
-// NewHTTPServer 创建 HTTP 服务器
+// NewHTTPServer 创建 HTTP 服务器（使用默认限制配置）
 // tlsConfig 为 nil 则使用普通 HTTP（不推荐生产环境）
 func NewHTTPServer(tlsConfig *tls.Config) HTTPServer {
+	return NewHTTPServerWithConfig(tlsConfig, nil)
+}
+
+// NewHTTPServerWithConfig 使用自定义限制配置创建 HTTP 服务器
+// config 中的零值字段使用默认值
+func NewHTTPServerWithConfig(tlsConfig *tls.Config, config *HTTPServerConfig) HTTPServer {
+	defaults := DefaultHTTPServerConfig()
+	if config == nil {
+		config = defaults
+	} else {
+		merged := *config
+		if merged.ReadTimeout == 0 {
+			merged.ReadTimeout = defaults.ReadTimeout
+		}
+		if merged.ReadHeaderTimeout == 0 {
+			merged.ReadHeaderTimeout = defaults.ReadHeaderTimeout
+		}
+		if merged.WriteTimeout == 0 {
+			merged.WriteTimeout = defaults.WriteTimeout
+		}
+		if merged.IdleTimeout == 0 {
+			merged.IdleTimeout = defaults.IdleTimeout
+		}
+		if merged.MaxHeaderBytes == 0 {
+			merged.MaxHeaderBytes = defaults.MaxHeaderBytes
+		}
+		if merged.MaxBodyBytes == 0 {
+			merged.MaxBodyBytes = defaults.MaxBodyBytes
+		}
+		config = &merged
+	}
+
 	return &httpServer{
 		tlsConfig:   tlsConfig,
+		config:      config,
 		middlewares: make([]func(http.Handler) http.Handler, 0),
 	}
 }
@@ -45,21 +110,43 @@ func (s *httpServer) Start(addr string, handler http.Handler) error {
 		finalHandler = s.middlewares[i](finalHandler)
 	}
 
+	// 请求体大小限制位于最外层，先于业务中间件生效
+	finalHandler = s.limitBody(finalHandler)
+
+	// 显式声明 ALPN：GetConfigForClient 按握手替换配置时（如 cert.TrustStore 变更后），替换后的配置仍协商 h2 / http/1.1
+	if s.tlsConfig != nil && len(s.tlsConfig.NextProtos) == 0 {
+		s.tlsConfig.NextProtos = []string{"h2", "http/1.1"}
+	}
+
 	// 创建 HTTP Server
 	s.server = &http.Server{
-		Addr:         addr,
-		Handler:      finalHandler,
-		TLSConfig:    s.tlsConfig,
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
-		IdleTimeout:  60 * time.Second,
+		Addr:              addr,
+		Handler:           finalHandler,
+		TLSConfig:         s.tlsConfig,
+		ReadTimeout:       s.config.ReadTimeout,
+		ReadHeaderTimeout: s.config.ReadHeaderTimeout,
+		WriteTimeout:      s.config.WriteTimeout,
+		IdleTimeout:       s.config.IdleTimeout,
+		MaxHeaderBytes:    s.config.MaxHeaderBytes,
 	}
 
 	s.mu.Unlock()
 
 	// 启动服务器
 	var err error
-	if s.tlsConfig != nil {
+	if s.config.AcceptProxyProtocol {
+		var ln net.Listener
+		ln, err = net.Listen("tcp", addr)
+		if err != nil {
+			return fmt.Errorf("failed to listen on %s: %w", addr, err)
+		}
+		ln = NewProxyProtocolListener(ln)
+		if s.tlsConfig != nil {
+			err = s.server.ServeTLS(ln, "", "")
+		} else {
+			err = s.server.Serve(ln)
+		}
+	} else if s.tlsConfig != nil {
 		// HTTPS with mTLS
 		err = s.server.ListenAndServeTLS("", "") // 证书已在 tlsConfig 中配置
 	} else {
@@ -74,6 +161,36 @@ func (s *httpServer) Start(addr string, handler http.Handler) error {
 	return err
 }
 
+// limitBody 按路由限制请求体大小
+// Content-Length 已知且超限时直接返回 413；否则通过 http.MaxBytesReader 在读取时截断
+func (s *httpServer) limitBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit := s.config.bodyLimit(r.URL.Path)
+		if limit >= 0 && r.Body != nil && r.Body != http.NoBody {
+			if r.ContentLength > limit {
+				w.Header().Set("Connection", "close")
+				http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// bodyLimit 返回路径对应的请求体上限（最长前缀匹配）
+func (c *HTTPServerConfig) bodyLimit(path string) int64 {
+	limit := c.MaxBodyBytes
+	matched := -1
+	for prefix, l := range c.RouteMaxBodyBytes {
+		if strings.HasPrefix(path, prefix) && len(prefix) > matched {
+			limit = l
+			matched = len(prefix)
+		}
+	}
+	return limit
+}
+
 // Stop 优雅关闭服务器（等待现有连接完成）
 func (s *httpServer) Stop() error {
 	s.mu.RLock()
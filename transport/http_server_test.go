@@ -3,8 +3,10 @@ package transport
 import (
 	"crypto/tls"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 )
@@ -183,3 +185,81 @@ func TestHTTPServer_TLS(t *testing.T) {
 
 	server.Stop()
 }
+
+func TestHTTPServer_MaxBodyBytes(t *testing.T) {
+	server := NewHTTPServerWithConfig(nil, &HTTPServerConfig{
+		MaxBodyBytes:      16,
+		RouteMaxBodyBytes: map[string]int64{"/upload": 1024},
+	})
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+
+	go server.Start(":18091", handler)
+	defer server.Stop()
+	time.Sleep(100 * time.Millisecond)
+
+	tests := []struct {
+		name       string
+		path       string
+		body       io.Reader
+		wantStatus int
+	}{
+		{"within limit", "/api", strings.NewReader("small"), http.StatusOK},
+		{"content-length over limit", "/api", strings.NewReader(strings.Repeat("x", 64)), http.StatusRequestEntityTooLarge},
+		// io.MultiReader 隐藏长度，使用 chunked 编码，由 MaxBytesReader 截断
+		{"chunked over limit", "/api", io.MultiReader(strings.NewReader(strings.Repeat("x", 64))), http.StatusRequestEntityTooLarge},
+		{"route override", "/upload/file", strings.NewReader(strings.Repeat("x", 512)), http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Post("http://localhost:18091"+tt.path, "application/octet-stream", tt.body)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestHTTPServer_ReadHeaderTimeout(t *testing.T) {
+	server := NewHTTPServerWithConfig(nil, &HTTPServerConfig{
+		ReadHeaderTimeout: 200 * time.Millisecond,
+	})
+
+	go server.Start(":18092", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Stop()
+	time.Sleep(100 * time.Millisecond)
+
+	conn, err := net.Dial("tcp", "localhost:18092")
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	// 发送不完整的请求头后停止（slowloris）
+	if _, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n")); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	start := time.Now()
+	_, err = io.ReadAll(conn)
+	if err != nil {
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			t.Fatal("server did not close slow connection")
+		}
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("connection closed after %v, expected ~200ms", elapsed)
+	}
+}
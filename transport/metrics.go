@@ -1,6 +1,8 @@
 package transport
 
 import (
+	"sync"
+
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
@@ -35,7 +37,7 @@ var (
 	)
 
 	// tunnelRelayErrors tracks the total number of relay errors by reason
-	// Labels: reason (pairing_timeout, read_error, write_error, validation_error, unknown)
+	// Labels: reason (error close reasons: handshake_failed, unknown_client, pairing_timeout, peer_reset, idle)
 	tunnelRelayErrors = promauto.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "tunnel_relay_errors_total",
@@ -43,8 +45,115 @@ var (
 		},
 		[]string{"reason"},
 	)
+
+	// tunnelRelayTTFB tracks time from IH local connect to the first AH→IH byte forwarded by the relay
+	// Labels: service (resolved via TunnelRelayConfig.ServiceResolver and mapped by serviceLabeler, "unknown" otherwise)
+	tunnelRelayTTFB = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "tunnel_relay_ttfb_seconds",
+			Help:    "Time from IH local connect to first byte from AH forwarded by the relay, by service",
+			Buckets: []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+		},
+		[]string{"service"},
+	)
+
+	// tunnelRelayServiceBytes tracks bytes relayed per service
+	// Labels: service (see serviceLabeler: allow-listed or first-N services, "other" otherwise)
+	tunnelRelayServiceBytes = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "tunnel_relay_service_bytes_total",
+			Help: "Total bytes relayed grouped by service",
+		},
+		[]string{"service"},
+	)
+
+	// tunnelRelayServiceActive tracks tunnels currently being relayed per service
+	// Labels: service
+	tunnelRelayServiceActive = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "tunnel_relay_service_active_tunnels",
+			Help: "Number of tunnels currently being relayed grouped by service",
+		},
+		[]string{"service"},
+	)
+
+	// tunnelRelayServiceErrors tracks relay errors per service and reason
+	// Labels: service, reason (same values as tunnel_relay_errors_total)
+	tunnelRelayServiceErrors = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "tunnel_relay_service_errors_total",
+			Help: "Total number of tunnel relay errors grouped by service and reason",
+		},
+		[]string{"service", "reason"},
+	)
+
+	// tunnelRelayCloses tracks relay connection closes per service and close reason
+	// Labels: service, reason (see CloseReason)
+	tunnelRelayCloses = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "tunnel_relay_closes_total",
+			Help: "Total number of tunnel relay connection closes grouped by service and close reason",
+		},
+		[]string{"service", "reason"},
+	)
 )
 
+// 服务标签取值
+const (
+	MetricsServiceOther   = "other"   // 不在名单内或超出上限的服务
+	MetricsServiceUnknown = "unknown" // 无法解析隧道所属服务
+
+	defaultMetricsServiceLimit = 100
+)
+
+// serviceLabeler 将服务 ID 映射为指标标签，限制 service 标签基数
+// 配置了名单时只有名单内的服务单独打标签；否则按出现顺序为前 limit 个服务打标签，其余计入 "other"
+type serviceLabeler struct {
+	allow map[string]bool
+	limit int
+
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+func newServiceLabeler(allow []string, limit int) *serviceLabeler {
+	l := &serviceLabeler{limit: limit, seen: make(map[string]bool)}
+	if l.limit <= 0 {
+		l.limit = defaultMetricsServiceLimit
+	}
+	if len(allow) > 0 {
+		l.allow = make(map[string]bool, len(allow))
+		for _, service := range allow {
+			l.allow[service] = true
+		}
+	}
+	return l
+}
+
+// label 返回服务的指标标签
+func (l *serviceLabeler) label(service string) string {
+	if service == "" || service == MetricsServiceUnknown {
+		return MetricsServiceUnknown
+	}
+	if l.allow != nil {
+		if l.allow[service] {
+			return service
+		}
+		return MetricsServiceOther
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.seen[service] {
+		return service
+	}
+	if len(l.seen) >= l.limit {
+		return MetricsServiceOther
+	}
+	l.seen[service] = true
+	return service
+}
+
 // updateTunnelMetrics updates the tunnel total metrics based on current state
 func (s *tunnelRelayServer) updateTunnelMetrics() {
 	stats := s.GetStats()
@@ -57,16 +166,43 @@ func (s *tunnelRelayServer) updateTunnelMetrics() {
 }
 
 // recordPairingDuration records the duration of a pairing operation
-func recordPairingDuration(duration float64) {
-	tunnelPairingDuration.Observe(duration)
+// traceID 非空时（Controller 启用 Tracing 并经 TraceResolver 返回隧道的 trace ID）作为 exemplar 附加到所在桶
+func recordPairingDuration(duration float64, traceID string) {
+	observeWithTraceID(tunnelPairingDuration, duration, traceID)
 }
 
-// recordBytesTransferred records the number of bytes transferred
-func recordBytesTransferred(bytes uint64) {
+// observeWithTraceID 记录观测值，traceID 非空时附加 trace_id exemplar（OpenMetrics 格式输出）
+func observeWithTraceID(o prometheus.Observer, value float64, traceID string) {
+	if eo, ok := o.(prometheus.ExemplarObserver); ok && traceID != "" {
+		eo.ObserveWithExemplar(value, prometheus.Labels{"trace_id": traceID})
+		return
+	}
+	o.Observe(value)
+}
+
+// recordBytesTransferred records the number of bytes transferred for a service label
+func recordBytesTransferred(service string, bytes uint64) {
 	tunnelBytesTransferred.Add(float64(bytes))
+	tunnelRelayServiceBytes.WithLabelValues(service).Add(float64(bytes))
 }
 
-// recordRelayError records a relay error with the given reason
-func recordRelayError(reason string) {
+// recordRelayError records a relay error with the given reason for a service label
+func recordRelayError(service, reason string) {
 	tunnelRelayErrors.WithLabelValues(reason).Inc()
+	tunnelRelayServiceErrors.WithLabelValues(service, reason).Inc()
+}
+
+// recordRelayClose records a relay connection close with the given close reason for a service label
+func recordRelayClose(service, reason string) {
+	tunnelRelayCloses.WithLabelValues(service, reason).Inc()
+}
+
+// recordRelayActive adjusts the active tunnel gauge of a service label by delta
+func recordRelayActive(service string, delta float64) {
+	tunnelRelayServiceActive.WithLabelValues(service).Add(delta)
+}
+
+// recordRelayTTFB records the time to first byte of a relayed tunnel
+func recordRelayTTFB(service string, seconds float64) {
+	tunnelRelayTTFB.WithLabelValues(service).Observe(seconds)
 }
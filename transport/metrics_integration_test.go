@@ -19,6 +19,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -83,9 +84,9 @@ func TestPrometheusMetricsExposure(t *testing.T) {
 	// 这里我们直接测试指标记录函数的存在性
 
 	// 测试指标记录函数
-	recordPairingDuration(0.5)
-	recordBytesTransferred(1024)
-	recordRelayError("test_error")
+	recordPairingDuration(0.5, "")
+	recordBytesTransferred("svc-test", 1024)
+	recordRelayError("svc-test", "test_error")
 
 	// 验证函数调用没有 panic
 	// 实际的指标值验证应该在 controller 集成测试中进行
@@ -371,3 +372,58 @@ func TestMetricsAccuracy(t *testing.T) {
 	// 8. 触发一些错误（超时、连接失败）
 	// 9. 验证 tunnel_relay_errors_total{reason="..."} 正确递增
 }
+
+// TestServiceLabeler 测试按服务打标签的基数控制
+func TestServiceLabeler(t *testing.T) {
+	limited := newServiceLabeler(nil, 2)
+	assert.Equal(t, "svc-a", limited.label("svc-a"))
+	assert.Equal(t, "svc-b", limited.label("svc-b"))
+	assert.Equal(t, MetricsServiceOther, limited.label("svc-c"), "beyond limit")
+	assert.Equal(t, "svc-a", limited.label("svc-a"), "already labeled services keep their label")
+	assert.Equal(t, MetricsServiceUnknown, limited.label(""))
+
+	allowed := newServiceLabeler([]string{"postgres"}, 0)
+	assert.Equal(t, "postgres", allowed.label("postgres"))
+	assert.Equal(t, MetricsServiceOther, allowed.label("redis"))
+	assert.Equal(t, MetricsServiceUnknown, allowed.label(MetricsServiceUnknown))
+
+	assert.Equal(t, defaultMetricsServiceLimit, newServiceLabeler(nil, 0).limit)
+}
+
+func TestPairingDurationExemplar(t *testing.T) {
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	server := NewTunnelRelayServer(nil, &TunnelRelayConfig{
+		PairingTimeout: time.Second,
+		TraceResolver: func(tunnelID string) string {
+			if tunnelID == "tunnel-traced" {
+				return traceID
+			}
+			return ""
+		},
+	}).(*tunnelRelayServer)
+	defer server.Stop()
+
+	// 隧道 ID 在握手帧中以零填充
+	padded := make([]byte, tunnelIDLength)
+	copy(padded, "tunnel-traced")
+	assert.Equal(t, traceID, server.resolveTrace(string(padded)))
+	assert.Empty(t, server.resolveTrace("tunnel-other"))
+	recordPairingDuration(0.07, server.resolveTrace(string(padded)))
+
+	families, err := prometheus.DefaultGatherer.Gather()
+	require.NoError(t, err)
+	var exemplars []string
+	for _, family := range families {
+		if family.GetName() != "tunnel_pairing_duration_seconds" {
+			continue
+		}
+		for _, bucket := range family.GetMetric()[0].GetHistogram().GetBucket() {
+			for _, label := range bucket.GetExemplar().GetLabel() {
+				if label.GetName() == "trace_id" {
+					exemplars = append(exemplars, label.GetValue())
+				}
+			}
+		}
+	}
+	assert.Equal(t, []string{traceID}, exemplars)
+}
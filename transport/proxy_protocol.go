@@ -0,0 +1,190 @@
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// PROXY protocol v2 (https://www.haproxy.org/download/2.9/doc/proxy-protocol.txt)
+//
+// 使用场景：
+//   - AH → Target：在目标连接开头写入 IH 原始源地址，目标服务（nginx、HAProxy 等）据此获取真实客户端 IP
+//   - LB → Controller 中继：中继部署在四层负载均衡之后时，从 LB 写入的头部恢复客户端地址
+var proxyProtocolV2Signature = []byte{0x0D, 0x0A, 0x0D, 0x0A, 0x00, 0x0D, 0x0A, 0x51, 0x55, 0x49, 0x54, 0x0A}
+
+const (
+	proxyProtocolV2HeaderLen = 16 // signature(12) + ver_cmd(1) + fam(1) + len(2)
+
+	proxyProtocolV2CmdLocal = 0x20
+	proxyProtocolV2CmdProxy = 0x21
+
+	proxyProtocolV2FamUnspec = 0x00
+	proxyProtocolV2FamTCP4   = 0x11
+	proxyProtocolV2FamTCP6   = 0x21
+
+	// proxyProtocolHeaderTimeout 读取 PROXY 头的超时
+	proxyProtocolHeaderTimeout = 5 * time.Second
+)
+
+// ErrNoProxyHeader 连接开头不是 PROXY protocol v2 头
+var ErrNoProxyHeader = errors.New("proxy protocol: missing v2 header")
+
+// EncodeProxyHeaderV2 编码 PROXY protocol v2 头
+// src 为 nil 或不是 TCP 地址时编码为 LOCAL 命令（接收方使用连接自身地址）
+func EncodeProxyHeaderV2(src, dst net.Addr) []byte {
+	header := make([]byte, proxyProtocolV2HeaderLen, proxyProtocolV2HeaderLen+36)
+	copy(header, proxyProtocolV2Signature)
+
+	srcTCP, srcOK := src.(*net.TCPAddr)
+	dstTCP, dstOK := dst.(*net.TCPAddr)
+	if !srcOK || !dstOK || srcTCP == nil || dstTCP == nil {
+		header[12] = proxyProtocolV2CmdLocal
+		header[13] = proxyProtocolV2FamUnspec
+		return header
+	}
+
+	header[12] = proxyProtocolV2CmdProxy
+	src4, dst4 := srcTCP.IP.To4(), dstTCP.IP.To4()
+	if src4 != nil && dst4 != nil {
+		header[13] = proxyProtocolV2FamTCP4
+		header = append(header, src4...)
+		header = append(header, dst4...)
+	} else {
+		// 任一端为 IPv6 时统一编码为 IPv6（IPv4 使用映射地址）
+		header[13] = proxyProtocolV2FamTCP6
+		header = append(header, srcTCP.IP.To16()...)
+		header = append(header, dstTCP.IP.To16()...)
+	}
+	header = binary.BigEndian.AppendUint16(header, uint16(srcTCP.Port))
+	header = binary.BigEndian.AppendUint16(header, uint16(dstTCP.Port))
+	binary.BigEndian.PutUint16(header[14:16], uint16(len(header)-proxyProtocolV2HeaderLen))
+	return header
+}
+
+// WriteProxyHeaderV2 向连接写入 PROXY protocol v2 头（须在任何业务数据之前调用）
+func WriteProxyHeaderV2(w io.Writer, src, dst net.Addr) error {
+	if _, err := w.Write(EncodeProxyHeaderV2(src, dst)); err != nil {
+		return fmt.Errorf("write proxy protocol header: %w", err)
+	}
+	return nil
+}
+
+// ReadProxyHeaderV2 读取并解析 PROXY protocol v2 头
+// LOCAL 命令或未知地址族返回 nil 地址；不以 v2 签名开头时返回 ErrNoProxyHeader 且不消费数据
+func ReadProxyHeaderV2(r *bufio.Reader) (src, dst net.Addr, err error) {
+	header, err := r.Peek(proxyProtocolV2HeaderLen)
+	if err != nil {
+		if len(header) < len(proxyProtocolV2Signature) || !bytes.Equal(header[:len(proxyProtocolV2Signature)], proxyProtocolV2Signature) {
+			return nil, nil, ErrNoProxyHeader
+		}
+		return nil, nil, fmt.Errorf("read proxy protocol header: %w", err)
+	}
+	if !bytes.Equal(header[:12], proxyProtocolV2Signature) {
+		return nil, nil, ErrNoProxyHeader
+	}
+
+	verCmd, fam := header[12], header[13]
+	length := int(binary.BigEndian.Uint16(header[14:16]))
+	if verCmd != proxyProtocolV2CmdLocal && verCmd != proxyProtocolV2CmdProxy {
+		return nil, nil, fmt.Errorf("proxy protocol: unsupported version/command 0x%02x", verCmd)
+	}
+	if _, err := r.Discard(proxyProtocolV2HeaderLen); err != nil {
+		return nil, nil, err
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, nil, fmt.Errorf("read proxy protocol addresses: %w", err)
+	}
+	if verCmd == proxyProtocolV2CmdLocal {
+		return nil, nil, nil
+	}
+
+	// 地址之后可能带有 TLV 扩展，忽略
+	switch fam {
+	case proxyProtocolV2FamTCP4:
+		if length < 12 {
+			return nil, nil, fmt.Errorf("proxy protocol: short IPv4 address block")
+		}
+		src = &net.TCPAddr{IP: net.IP(payload[0:4]), Port: int(binary.BigEndian.Uint16(payload[8:10]))}
+		dst = &net.TCPAddr{IP: net.IP(payload[4:8]), Port: int(binary.BigEndian.Uint16(payload[10:12]))}
+	case proxyProtocolV2FamTCP6:
+		if length < 36 {
+			return nil, nil, fmt.Errorf("proxy protocol: short IPv6 address block")
+		}
+		src = &net.TCPAddr{IP: net.IP(payload[0:16]), Port: int(binary.BigEndian.Uint16(payload[32:34]))}
+		dst = &net.TCPAddr{IP: net.IP(payload[16:32]), Port: int(binary.BigEndian.Uint16(payload[34:36]))}
+	}
+	return src, dst, nil
+}
+
+// NewProxyProtocolListener 包装监听器，要求每个连接以 PROXY protocol v2 头开头
+// 头部在首次 Read 或 RemoteAddr 时解析（不阻塞 Accept），之后 RemoteAddr 返回头部中的源地址；
+// 缺少头部的连接读取时返回 ErrNoProxyHeader。仅应在所有入站流量都经过 LB 时启用
+func NewProxyProtocolListener(ln net.Listener) net.Listener {
+	return &proxyProtocolListener{Listener: ln}
+}
+
+type proxyProtocolListener struct {
+	net.Listener
+}
+
+func (l *proxyProtocolListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &proxyProtocolConn{Conn: conn, reader: bufio.NewReader(conn)}, nil
+}
+
+// proxyProtocolConn 解析 PROXY 头后透明读写的连接
+type proxyProtocolConn struct {
+	net.Conn
+	reader *bufio.Reader
+
+	once   sync.Once
+	err    error
+	remote net.Addr
+}
+
+func (c *proxyProtocolConn) readHeader() {
+	c.once.Do(func() {
+		c.Conn.SetReadDeadline(time.Now().Add(proxyProtocolHeaderTimeout))
+		defer c.Conn.SetReadDeadline(time.Time{})
+
+		src, _, err := ReadProxyHeaderV2(c.reader)
+		if err != nil {
+			c.err = err
+			return
+		}
+		c.remote = src
+	})
+}
+
+func (c *proxyProtocolConn) Read(p []byte) (int, error) {
+	c.readHeader()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(p)
+}
+
+// NetConn 返回底层 TCP 连接（用于设置套接字选项）
+func (c *proxyProtocolConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+func (c *proxyProtocolConn) RemoteAddr() net.Addr {
+	c.readHeader()
+	if c.remote != nil {
+		return c.remote
+	}
+	return c.Conn.RemoteAddr()
+}
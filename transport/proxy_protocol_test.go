@@ -0,0 +1,119 @@
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestProxyHeaderV2_IPv4RoundTrip(t *testing.T) {
+	src := &net.TCPAddr{IP: net.ParseIP("203.0.113.7"), Port: 51234}
+	dst := &net.TCPAddr{IP: net.ParseIP("10.0.0.5"), Port: 5432}
+
+	header := EncodeProxyHeaderV2(src, dst)
+	if len(header) != 16+12 {
+		t.Fatalf("header length = %d, want 28", len(header))
+	}
+
+	r := bufio.NewReader(bytes.NewReader(append(header, "payload"...)))
+	gotSrc, gotDst, err := ReadProxyHeaderV2(r)
+	if err != nil {
+		t.Fatalf("read header: %v", err)
+	}
+	if gotSrc.String() != src.String() || gotDst.String() != dst.String() {
+		t.Errorf("got %v -> %v, want %v -> %v", gotSrc, gotDst, src, dst)
+	}
+	rest, _ := io.ReadAll(r)
+	if string(rest) != "payload" {
+		t.Errorf("payload = %q, want %q", rest, "payload")
+	}
+}
+
+func TestProxyHeaderV2_IPv6AndMixed(t *testing.T) {
+	src := &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 40000}
+	dst := &net.TCPAddr{IP: net.ParseIP("10.0.0.5"), Port: 443}
+
+	header := EncodeProxyHeaderV2(src, dst)
+	if len(header) != 16+36 {
+		t.Fatalf("header length = %d, want 52", len(header))
+	}
+
+	gotSrc, gotDst, err := ReadProxyHeaderV2(bufio.NewReader(bytes.NewReader(header)))
+	if err != nil {
+		t.Fatalf("read header: %v", err)
+	}
+	if gotSrc.String() != "[2001:db8::1]:40000" {
+		t.Errorf("src = %v", gotSrc)
+	}
+	if !gotDst.(*net.TCPAddr).IP.Equal(dst.IP) || gotDst.(*net.TCPAddr).Port != 443 {
+		t.Errorf("dst = %v", gotDst)
+	}
+}
+
+func TestProxyHeaderV2_Local(t *testing.T) {
+	dst := &net.TCPAddr{IP: net.ParseIP("10.0.0.5"), Port: 443}
+	header := EncodeProxyHeaderV2(nil, dst)
+	if len(header) != 16 {
+		t.Fatalf("header length = %d, want 16", len(header))
+	}
+
+	src, gotDst, err := ReadProxyHeaderV2(bufio.NewReader(bytes.NewReader(header)))
+	if err != nil {
+		t.Fatalf("read header: %v", err)
+	}
+	if src != nil || gotDst != nil {
+		t.Errorf("LOCAL header should carry no addresses, got %v -> %v", src, gotDst)
+	}
+}
+
+func TestProxyHeaderV2_Missing(t *testing.T) {
+	r := bufio.NewReader(bytes.NewReader([]byte("GET / HTTP/1.1\r\nHost: x\r\n\r\n")))
+	if _, _, err := ReadProxyHeaderV2(r); !errors.Is(err, ErrNoProxyHeader) {
+		t.Fatalf("err = %v, want ErrNoProxyHeader", err)
+	}
+	// 未消费数据
+	line, _ := r.ReadString('\n')
+	if line != "GET / HTTP/1.1\r\n" {
+		t.Errorf("data consumed: %q", line)
+	}
+}
+
+func TestProxyProtocolListener(t *testing.T) {
+	raw, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	ln := NewProxyProtocolListener(raw)
+	defer ln.Close()
+
+	src := &net.TCPAddr{IP: net.ParseIP("198.51.100.20"), Port: 6000}
+	go func() {
+		conn, err := net.Dial("tcp", raw.Addr().String())
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		WriteProxyHeaderV2(conn, src, raw.Addr())
+		conn.Write([]byte("hello"))
+	}()
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("accept: %v", err)
+	}
+	defer conn.Close()
+
+	if conn.RemoteAddr().String() != src.String() {
+		t.Errorf("RemoteAddr = %v, want %v", conn.RemoteAddr(), src)
+	}
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if string(buf) != "hello" {
+		t.Errorf("data = %q, want hello", buf)
+	}
+}
@@ -0,0 +1,197 @@
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// 多跳握手（与 tunnel.EncodeChainHandshake 一致）
+// [0xFE][0x03][8 字节连接时间][36 字节 Tunnel ID][标志 1][跳序号 1][路由数 1]{[地址长度 1][地址]}[来源长度 1][来源]
+// 路由为本中继之后的各跳地址；来源为发起隧道的 IH 身份（证书 CN），仅由中继转发时填写
+const (
+	chainHandshakeVersion byte = 0x03
+	chainFlagCloseNotice  byte = 0x01
+	maxRelayHops               = 8
+
+	// chainDialTimeout 连接下一跳中继（含 TLS 握手）的超时
+	chainDialTimeout = 10 * time.Second
+)
+
+// RelayHop 多跳隧道中本中继所在的位置（TunnelRelayStats.Hop）
+// 中间跳的 BytesIHToAH / BytesAHToIH 分别为发往 / 来自下一跳的字节数
+type RelayHop struct {
+	Index int    `json:"index"`          // 0 为 IH 接入的第一跳
+	Prev  string `json:"prev,omitempty"` // 上一跳中继的内部身份，第一跳为空
+	Next  string `json:"next,omitempty"` // 下一跳中继地址，最后一跳为空
+}
+
+// chainRoute 多跳握手中基础帧之后的路由信息
+type chainRoute struct {
+	flags  byte
+	hop    int
+	route  []string
+	origin string
+}
+
+// relayHandshake 解析后的隧道握手
+type relayHandshake struct {
+	tunnelID    string    // 36 字节填充格式
+	connectedAt time.Time // 未携带时为零值
+	closeNotice bool
+	chain       *chainRoute // 多跳握手时非空
+}
+
+// readChainRoute 读取多跳握手的路由部分
+func readChainRoute(r io.Reader) (*chainRoute, error) {
+	header := make([]byte, 3)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("failed to read chain handshake: %w", err)
+	}
+	if int(header[2]) >= maxRelayHops {
+		return nil, fmt.Errorf("chain handshake has too many hops: %d", header[2])
+	}
+	chain := &chainRoute{flags: header[0], hop: int(header[1])}
+	readString := func() (string, error) {
+		var n [1]byte
+		if _, err := io.ReadFull(r, n[:]); err != nil {
+			return "", err
+		}
+		buf := make([]byte, n[0])
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return "", err
+		}
+		return string(buf), nil
+	}
+	for i := 0; i < int(header[2]); i++ {
+		addr, err := readString()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read chain handshake: %w", err)
+		}
+		if addr == "" {
+			return nil, fmt.Errorf("chain handshake has an empty hop address")
+		}
+		chain.route = append(chain.route, addr)
+	}
+	origin, err := readString()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chain handshake: %w", err)
+	}
+	chain.origin = origin
+	return chain, nil
+}
+
+// encodeChainHandshake 编码转发给下一跳的多跳握手帧
+func encodeChainHandshake(hs *relayHandshake, hop int, route []string, origin string) []byte {
+	frame := make([]byte, tunnelIDLength+timedHandshakeExtra, tunnelIDLength+timedHandshakeExtra+64)
+	frame[0] = timedHandshakeMagic
+	frame[1] = chainHandshakeVersion
+	if !hs.connectedAt.IsZero() {
+		binary.BigEndian.PutUint64(frame[2:10], uint64(hs.connectedAt.UnixNano()))
+	}
+	copy(frame[10:], hs.tunnelID)
+
+	// 请求下一跳的关闭通知不会转发给 IH，各跳之间按普通连接断开处理
+	frame = append(frame, 0, byte(hop), byte(len(route)))
+	for _, addr := range route {
+		frame = append(frame, byte(len(addr)))
+		frame = append(frame, addr...)
+	}
+	frame = append(frame, byte(len(origin)))
+	return append(frame, origin...)
+}
+
+// acceptChain 校验多跳握手并返回本中继的位置与发起隧道的客户端身份
+// 由上一跳转发的握手（来源非空）须来自 ChainPeers 允许的内部身份；多跳隧道只能由 IH 发起
+func (s *tunnelRelayServer) acceptChain(peer *x509.Certificate, clientCN string, chain *chainRoute) (*RelayHop, string, error) {
+	hop := &RelayHop{}
+	if chain.origin != "" {
+		if s.chainPeers == nil {
+			return nil, "", fmt.Errorf("chained connections from other relays are not accepted")
+		}
+		identity, err := s.chainPeers.Authorize(peer)
+		if err != nil {
+			return nil, "", fmt.Errorf("untrusted previous hop %s: %w", clientCN, err)
+		}
+		hop.Index, hop.Prev, clientCN = chain.hop, identity.String(), chain.origin
+	}
+	if s.determineClientType(clientCN) != "ih" {
+		return nil, "", fmt.Errorf("only IH connections can be chained: %s", clientCN)
+	}
+	return hop, clientCN, nil
+}
+
+// forwardChain 多跳隧道的中间跳：连接路由中的下一跳并转发剩余路由，之后与下一跳双向中继
+func (s *tunnelRelayServer) forwardChain(conn net.Conn, hs *relayHandshake, clientCN string, hop *RelayHop) error {
+	hop.Next = hs.chain.route[0]
+	if s.chainTLSConfig == nil {
+		notifyClose(conn, string(CloseReasonChainRejected))
+		s.recordClose(s.serviceLabel(hs.tunnelID), CloseReasonChainRejected)
+		return fmt.Errorf("relay chaining is not configured, cannot forward tunnel %s to %s", hs.tunnelID, hop.Next)
+	}
+
+	next, err := s.dialNextHop(hop.Next)
+	if err == nil {
+		err = writeChainHandshake(next, encodeChainHandshake(hs, hop.Index+1, hs.chain.route[1:], clientCN))
+		if err != nil {
+			next.Close()
+		}
+	}
+	if err != nil {
+		notifyClose(conn, string(CloseReasonNextHopUnreachable))
+		s.recordClose(s.serviceLabel(hs.tunnelID), CloseReasonNextHopUnreachable)
+		return fmt.Errorf("failed to reach next hop %s: %w", hop.Next, err)
+	}
+
+	s.logger.Info("Chained tunnel forwarded",
+		"tunnel_id", hs.tunnelID,
+		"client", clientCN,
+		"hop", hop.Index,
+		"next_hop", hop.Next)
+
+	connectedAt := hs.connectedAt
+	if connectedAt.IsZero() {
+		connectedAt = time.Now()
+	}
+	return s.relayData(conn, next, hs.tunnelID, clientCN, connectedAt, hop)
+}
+
+// dialNextHop 以 ChainTLSConfig 与下一跳中继建立 mTLS 连接
+func (s *tunnelRelayServer) dialNextHop(addr string) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), chainDialTimeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	raw, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := s.chainTLSConfig
+	if tlsConfig.ServerName == "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			host = addr
+		}
+		tlsConfig = tlsConfig.Clone()
+		tlsConfig.ServerName = host
+	}
+	conn := tls.Client(raw, tlsConfig)
+	if err := conn.HandshakeContext(ctx); err != nil {
+		raw.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// writeChainHandshake 在写超时内写出握手帧
+func writeChainHandshake(conn net.Conn, frame []byte) error {
+	conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	defer conn.SetWriteDeadline(time.Time{})
+	_, err := conn.Write(frame)
+	return err
+}
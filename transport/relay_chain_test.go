@@ -0,0 +1,200 @@
+package transport
+
+import (
+	"bytes"
+	"crypto/tls"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/houzhh15/sdp-common/cert"
+	"github.com/houzhh15/sdp-common/testinfra"
+	"github.com/houzhh15/sdp-common/tunnel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// chainTestPKI issues loopback certificates from a testinfra CA
+type chainTestPKI struct {
+	*testinfra.PKI
+}
+
+func newChainTestPKI(t *testing.T) *chainTestPKI {
+	pki, err := testinfra.NewPKI(t.TempDir())
+	require.NoError(t, err)
+	return &chainTestPKI{PKI: pki}
+}
+
+// issue signs a certificate usable for both client and server auth; identity is an optional spiffe URI SAN
+func (p *chainTestPKI) issue(t *testing.T, commonName, identity string) tls.Certificate {
+	hosts := []string{"127.0.0.1"}
+	if identity != "" {
+		hosts = append(hosts, identity)
+	}
+	files, err := p.Issue(commonName, commonName, hosts...)
+	require.NoError(t, err)
+	pair, err := tls.LoadX509KeyPair(files.CertFile, files.KeyFile)
+	require.NoError(t, err)
+	return pair
+}
+
+// startChainRelay serves a relay on a loopback listener with mTLS required
+func startChainRelay(t *testing.T, pki *chainTestPKI, config *TunnelRelayConfig) (*tunnelRelayServer, string) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	config.PairingTimeout = 5 * time.Second
+	config.BufferSize = 32 * 1024
+	config.ReadTimeout = 5 * time.Second
+	config.MaxConnections = 100
+	server := NewTunnelRelayServer(logger, config).(*tunnelRelayServer)
+	t.Cleanup(func() { server.Stop() })
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go server.Serve(ln, &tls.Config{
+		Certificates: []tls.Certificate{pki.issue(t, "relay", "")},
+		ClientCAs:    pki.CertPool(),
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	})
+	select {
+	case <-server.Ready():
+	case <-time.After(time.Second):
+		t.Fatal("relay did not become ready")
+	}
+	return server, server.Addr().String()
+}
+
+func dialChainRelay(t *testing.T, pki *chainTestPKI, addr string, client tls.Certificate, frame []byte) *tls.Conn {
+	conn, err := tls.Dial("tcp", addr, &tls.Config{Certificates: []tls.Certificate{client}, RootCAs: pki.CertPool()})
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	_, err = conn.Write(frame)
+	require.NoError(t, err)
+	return conn
+}
+
+// TestReadTunnelHandshake_Chain tests parsing of IH-originated and relay-forwarded chain frames
+func TestReadTunnelHandshake_Chain(t *testing.T) {
+	sent := time.Unix(0, 1700000000123456789)
+	frame, err := tunnel.EncodeChainHandshake("tunnel-001", sent, true, []string{"10.0.1.1:9443", "10.0.2.1:9443"})
+	require.NoError(t, err)
+
+	r := bytes.NewReader(append(frame, "payload"...))
+	hs, err := readTunnelHandshake(r)
+	require.NoError(t, err)
+	assert.Equal(t, "tunnel-001", string(bytes.TrimRight([]byte(hs.tunnelID), "\x00")))
+	assert.True(t, sent.Equal(hs.connectedAt))
+	assert.True(t, hs.closeNotice)
+	require.NotNil(t, hs.chain)
+	assert.Equal(t, 0, hs.chain.hop)
+	assert.Equal(t, []string{"10.0.1.1:9443", "10.0.2.1:9443"}, hs.chain.route)
+	assert.Empty(t, hs.chain.origin)
+	rest, _ := io.ReadAll(r)
+	assert.Equal(t, "payload", string(rest))
+
+	// 转发给下一跳：跳序号递增、路由前移、携带来源，不再请求关闭通知
+	forwarded, err := readTunnelHandshake(bytes.NewReader(encodeChainHandshake(hs, 1, hs.chain.route[1:], "ih-client-001")))
+	require.NoError(t, err)
+	assert.Equal(t, hs.tunnelID, forwarded.tunnelID)
+	assert.True(t, sent.Equal(forwarded.connectedAt))
+	assert.False(t, forwarded.closeNotice)
+	assert.Equal(t, 1, forwarded.chain.hop)
+	assert.Equal(t, []string{"10.0.2.1:9443"}, forwarded.chain.route)
+	assert.Equal(t, "ih-client-001", forwarded.chain.origin)
+
+	_, err = readTunnelHandshake(bytes.NewReader(frame[:len(frame)-3]))
+	assert.Error(t, err)
+}
+
+// TestRelayChain_TwoHops tests a tunnel forwarded from a DMZ relay to an internal relay that pairs with the AH
+func TestRelayChain_TwoHops(t *testing.T) {
+	pki := newChainTestPKI(t)
+	inner, innerAddr := startChainRelay(t, pki, &TunnelRelayConfig{
+		ChainPeers: &cert.InternalPeerPolicy{AllowedRoles: []string{cert.RoleRelay}},
+	})
+	dmz, dmzAddr := startChainRelay(t, pki, &TunnelRelayConfig{
+		ChainTLSConfig: &tls.Config{
+			Certificates: []tls.Certificate{pki.issue(t, "relay-dmz", "spiffe://sdp.internal/relay/dmz-1")},
+			RootCAs:      pki.CertPool(),
+		},
+	})
+
+	tunnelID := make([]byte, tunnelIDLength)
+	copy(tunnelID, "tunnel-chain-001")
+	ah := dialChainRelay(t, pki, innerAddr, pki.issue(t, "ah-agent-001", ""), tunnelID)
+
+	frame, err := tunnel.EncodeChainHandshake("tunnel-chain-001", time.Now(), false, []string{innerAddr})
+	require.NoError(t, err)
+	ih := dialChainRelay(t, pki, dmzAddr, pki.issue(t, "ih-client-001", ""), frame)
+
+	_, err = ih.Write([]byte("ping"))
+	require.NoError(t, err)
+	buf := make([]byte, 4)
+	_, err = io.ReadFull(ah, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "ping", string(buf))
+
+	_, err = ah.Write([]byte("pong!"))
+	require.NoError(t, err)
+	buf = make([]byte, 5)
+	_, err = io.ReadFull(ih, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "pong!", string(buf))
+
+	// 各跳分别统计本段字节数
+	dmzStats := dmz.GetTunnelStats()
+	require.Len(t, dmzStats, 1)
+	require.NotNil(t, dmzStats[0].Hop)
+	assert.Equal(t, RelayHop{Index: 0, Next: innerAddr}, *dmzStats[0].Hop)
+	assert.Equal(t, uint64(4), dmzStats[0].BytesIHToAH)
+	assert.Equal(t, uint64(5), dmzStats[0].BytesAHToIH)
+
+	innerStats := inner.GetTunnelStats()
+	require.Len(t, innerStats, 1)
+	require.NotNil(t, innerStats[0].Hop)
+	assert.Equal(t, RelayHop{Index: 1, Prev: "spiffe://sdp.internal/relay/dmz-1"}, *innerStats[0].Hop)
+	assert.Equal(t, uint64(4), innerStats[0].BytesIHToAH)
+	assert.Equal(t, uint64(5), innerStats[0].BytesAHToIH)
+}
+
+// TestRelayChain_Rejected tests untrusted forwarded handshakes, non-IH originators and unreachable next hops
+func TestRelayChain_Rejected(t *testing.T) {
+	pki := newChainTestPKI(t)
+	relay, addr := startChainRelay(t, pki, &TunnelRelayConfig{
+		ChainPeers: &cert.InternalPeerPolicy{AllowedRoles: []string{cert.RoleRelay}},
+	})
+
+	closed := func(conn *tls.Conn) {
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, err := conn.Read(make([]byte, 1))
+		assert.Error(t, err)
+	}
+
+	padded := make([]byte, tunnelIDLength)
+	copy(padded, "tunnel-001")
+	hs := &relayHandshake{tunnelID: string(padded), chain: &chainRoute{}}
+
+	// 用户证书冒充上一跳中继
+	closed(dialChainRelay(t, pki, addr, pki.issue(t, "ih-client-001", ""), encodeChainHandshake(hs, 1, nil, "ih-client-002")))
+	// 中继转发的来源不是 IH
+	closed(dialChainRelay(t, pki, addr, pki.issue(t, "relay-dmz", "spiffe://sdp.internal/relay/dmz-1"), encodeChainHandshake(hs, 1, nil, "ah-agent-001")))
+	// 本中继未配置 ChainTLSConfig，无法继续转发
+	frame, err := tunnel.EncodeChainHandshake("tunnel-001", time.Time{}, false, []string{"127.0.0.1:1"})
+	require.NoError(t, err)
+	closed(dialChainRelay(t, pki, addr, pki.issue(t, "ih-client-001", ""), frame))
+
+	require.Eventually(t, func() bool {
+		return relay.GetStats().CloseReasons[CloseReasonChainRejected] == 3
+	}, 2*time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, 3, relay.GetStats().ErrorCount)
+
+	// 下一跳不可达
+	dmz, dmzAddr := startChainRelay(t, pki, &TunnelRelayConfig{ChainTLSConfig: &tls.Config{RootCAs: pki.CertPool()}})
+	closed(dialChainRelay(t, pki, dmzAddr, pki.issue(t, "ih-client-001", ""), frame))
+	require.Eventually(t, func() bool {
+		return dmz.GetStats().CloseReasons[CloseReasonNextHopUnreachable] == 1
+	}, 2*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,13 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd)
+
+package transport
+
+import (
+	"errors"
+	"syscall"
+)
+
+// setReusePort 当前平台不支持 SO_REUSEPORT
+func setReusePort(network, address string, c syscall.RawConn) error {
+	return errors.New("SO_REUSEPORT is not supported on this platform")
+}
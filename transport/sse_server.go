@@ -79,7 +79,6 @@ func (s *sseServer) Subscribe(clientID string, w http.ResponseWriter) error {
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("X-Accel-Buffering", "no") // 禁用 nginx 缓冲
 
 	// 确保支持流式响应
@@ -2,9 +2,9 @@ package transport
 
 import (
 	"crypto/tls"
-	"crypto/x509"
 	"fmt"
-	"os"
+
+	"github.com/houzhh15/sdp-common/cert"
 )
 
 // TLSConfig TLS 配置
@@ -13,40 +13,69 @@ type TLSConfig struct {
 	KeyFile    string `yaml:"key_file" json:"key_file"`
 	CAFile     string `yaml:"ca_file" json:"ca_file"`
 	MinVersion uint16 `yaml:"min_version" json:"min_version"` // tls.VersionTLS12
+	MaxVersion uint16 `yaml:"max_version" json:"max_version"` // 0 表示不限制
+
+	// CAFiles / CADirs 额外的 CA 文件（可为多证书 bundle）与 CA 目录，与 CAFile 合并为信任集（CA 轮换期间同时信任新旧 CA）
+	CAFiles []string `yaml:"ca_files" json:"ca_files"`
+	CADirs  []string `yaml:"ca_dirs" json:"ca_dirs"`
+
+	// CipherSuites TLS 1.2 密码套件 IANA 名称，CurvePreferences 曲线名（X25519、P256 等），为空使用 cert 包默认策略
+	CipherSuites     []string `yaml:"cipher_suites" json:"cipher_suites"`
+	CurvePreferences []string `yaml:"curve_preferences" json:"curve_preferences"`
+}
+
+// Policy 构建并校验 TLS 策略
+func (cfg *TLSConfig) Policy() (*cert.TLSPolicy, error) {
+	policy, err := cert.ParseTLSPolicy("", "", cfg.CipherSuites, cfg.CurvePreferences)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.MinVersion != 0 {
+		policy.MinVersion = cfg.MinVersion
+	}
+	policy.MaxVersion = cfg.MaxVersion
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	return policy, nil
 }
 
 // LoadTLSConfig 加载 TLS 配置并创建 tls.Config
 // 自动启用 mTLS 双向认证（RequireAndVerifyClientCert）
 func LoadTLSConfig(cfg *TLSConfig) (*tls.Config, error) {
+	policy, err := cfg.Policy()
+	if err != nil {
+		return nil, fmt.Errorf("invalid TLS policy: %w", err)
+	}
+
 	// 1. 加载服务端证书和私钥
-	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	keyPair, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load cert/key: %w", err)
 	}
 
-	// 2. 加载 CA 证书（用于验证客户端证书）
-	caCert, err := os.ReadFile(cfg.CAFile)
+	// 2. 加载 CA 信任集（用于验证客户端证书）
+	caFiles := cfg.CAFiles
+	if cfg.CAFile != "" {
+		caFiles = append([]string{cfg.CAFile}, caFiles...)
+	}
+	trust, err := cert.LoadTrustStore(caFiles, cfg.CADirs)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read CA cert: %w", err)
+		return nil, fmt.Errorf("failed to load CA certs: %w", err)
 	}
-
-	caCertPool := x509.NewCertPool()
-	if !caCertPool.AppendCertsFromPEM(caCert) {
-		return nil, fmt.Errorf("failed to parse CA cert")
+	if trust.Len() == 0 {
+		return nil, fmt.Errorf("no CA certificate configured (ca_file, ca_files or ca_dirs)")
 	}
 
 	// 3. 创建 TLS 配置
 	tlsConfig := &tls.Config{
-		Certificates: []tls.Certificate{cert},
-		ClientCAs:    caCertPool,
+		Certificates: []tls.Certificate{keyPair},
+		ClientCAs:    trust.Pool(),
 		ClientAuth:   tls.RequireAndVerifyClientCert, // 强制 mTLS
-		MinVersion:   cfg.MinVersion,
 	}
 
-	// 默认最低版本 TLS 1.2
-	if tlsConfig.MinVersion == 0 {
-		tlsConfig.MinVersion = tls.VersionTLS12
-	}
+	// 版本（默认最低 TLS 1.2）、密码套件与曲线
+	policy.Apply(tlsConfig)
 
 	return tlsConfig, nil
 }
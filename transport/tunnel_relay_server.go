@@ -3,14 +3,20 @@ package transport
 import (
 	"context"
 	"crypto/tls"
+	"encoding/binary"
 	"fmt"
 	"io"
 	"net"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/houzhh15/sdp-common/cert"
+	"github.com/houzhh15/sdp-common/clock"
+	"github.com/houzhh15/sdp-common/faults"
 	"github.com/houzhh15/sdp-common/logging"
+	"github.com/houzhh15/sdp-common/qos"
 )
 
 // TunnelRelayServer Controller 数据平面中继服务器
@@ -34,11 +40,41 @@ type TunnelRelayServer interface {
 	// StartTLS 启动 mTLS 监听（强制要求 mTLS）
 	StartTLS(addr string, tlsConfig *tls.Config) error
 
-	// Stop 停止服务器
+	// Serve 在已创建的 TCP 监听器上提供 mTLS 中继（如继承自旧进程的监听器，见 Listen）
+	Serve(ln net.Listener, tlsConfig *tls.Config) error
+
+	// Listener 返回底层 TCP 监听器（TLS 之前），用于二进制升级时传递给新进程；未启动时为 nil
+	Listener() net.Listener
+
+	// Ready 返回在中继开始接受连接后关闭的通道，用于启动顺序控制（先中继就绪，再接受隧道创建）
+	Ready() <-chan struct{}
+
+	// Addr 返回中继实际监听的地址（监听 :0 时含分配的端口）；未启动、排空中或已停止时为 nil
+	Addr() net.Addr
+
+	// Drain 停止接受新连接并关闭待配对连接，等待正在中继的隧道结束；
+	// ctx 到期后强制断开剩余隧道并返回 ctx.Err()
+	Drain(ctx context.Context) error
+
+	// Stop 停止服务器，关闭待配对连接与正在中继的隧道
 	Stop() error
 
 	// GetStats 获取统计信息
 	GetStats() *RelayStats
+
+	// GetTunnelStats 获取正在中继的隧道及其实时字节数
+	GetTunnelStats() []*TunnelRelayStats
+
+	// CloseTunnel 断开正在中继的隧道（Controller 对账后终止未知隧道），隧道不存在时返回 false
+	CloseTunnel(tunnelID string) bool
+
+	// CloseTunnelWithReason 同 CloseTunnel，请求了关闭通知（握手版本 0x02）的一端先收到
+	// 机器可读的关闭原因（如 tunnel_rejected、policy_revoked），其他客户端只看到连接断开
+	CloseTunnelWithReason(tunnelID, reason string) bool
+
+	// RelayIH 以 IH 一端接入进程内已建立的连接（如 Controller 网关终止的终端用户连接），与 AH 配对后双向中继，
+	// 阻塞至中继结束；配对超时返回错误。connectedAt 为用户连接建立时间（用于 TTFB），conn 由中继关闭
+	RelayIH(conn net.Conn, tunnelID, client string, connectedAt time.Time) error
 }
 
 // PendingConnection 待配对连接
@@ -47,6 +83,47 @@ type PendingConnection struct {
 	TunnelID   string
 	ClientType string // "ih" or "ah"
 	ReceivedAt time.Time
+	// ConnectedAt 客户端本地连接时间（来自带时间戳的握手帧，否则为 ReceivedAt）
+	ConnectedAt time.Time
+	// Hop 多跳隧道中本中继的位置（IH 一端经多跳握手接入时），其他连接为 nil
+	Hop *RelayHop
+
+	// done 对端取走本连接并结束中继，或本连接未配对即被关闭时关闭，等待配对的 goroutine 随之返回
+	done      chan struct{}
+	doneOnce  sync.Once
+	closeOnce sync.Once
+	mu        sync.Mutex
+	reason    CloseReason // 未配对即被关闭的原因
+}
+
+// close 未配对即关闭：通知关闭原因、断开连接并唤醒等待的 goroutine（只生效一次）
+func (p *PendingConnection) close(reason CloseReason) {
+	p.closeOnce.Do(func() {
+		p.mu.Lock()
+		p.reason = reason
+		p.mu.Unlock()
+		if p.Conn != nil {
+			notifyClose(p.Conn, string(reason))
+			p.Conn.Close()
+		}
+		p.finish()
+	})
+}
+
+// finish 唤醒等待配对的 goroutine
+func (p *PendingConnection) finish() {
+	p.doneOnce.Do(func() {
+		if p.done != nil {
+			close(p.done)
+		}
+	})
+}
+
+// closeReason 未配对即被关闭的原因，被对端取走配对时为空
+func (p *PendingConnection) closeReason() CloseReason {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.reason
 }
 
 // RelayStats 中继统计信息
@@ -56,15 +133,113 @@ type RelayStats struct {
 	PendingIH          int // Separate count for pending IH connections
 	PendingAH          int // Separate count for pending AH connections
 	TotalRelayed       uint64
-	ErrorCount         int
+	ErrorCount         int // 错误类关闭原因（CloseReason.IsError）的次数
+	// CloseReasons 按关闭原因统计的连接关闭次数（未配对连接各计一次，配对的中继计一次）
+	CloseReasons map[CloseReason]uint64
+}
+
+// TunnelRelayStats 单个隧道的实时中继统计
+type TunnelRelayStats struct {
+	TunnelID    string    `json:"tunnel_id"`
+	Service     string    `json:"service,omitempty"`
+	Client      string    `json:"client"`
+	StartedAt   time.Time `json:"started_at"`
+	BytesIHToAH uint64    `json:"bytes_ih_to_ah"`
+	BytesAHToIH uint64    `json:"bytes_ah_to_ih"`
+	// ClientConnectedAt IH 本地连接时间，TTFBSeconds 从该时间到 AH 首字节经中继转发的耗时（尚未收到时为 0）
+	ClientConnectedAt time.Time `json:"client_connected_at"`
+	TTFBSeconds       float64   `json:"ttfb_seconds,omitempty"`
+	// Hop 多跳隧道中本中继所在的跳（各跳分别统计字节数），普通隧道为 nil
+	Hop *RelayHop `json:"hop,omitempty"`
+}
+
+// activeRelay 正在中继的隧道（字节数在转发过程中原子累加）
+type activeRelay struct {
+	tunnelID    string
+	service     string
+	label       string // service 的指标标签（名单外或超出上限时为 "other"）
+	client      string
+	startedAt   time.Time
+	connectedAt time.Time
+	bytesIHToAH atomic.Uint64
+	bytesAHToIH atomic.Uint64
+	ttfb        atomic.Int64 // 纳秒
+	hop         *RelayHop
+	ihConn      net.Conn
+	ahConn      net.Conn
+	reason      atomic.Pointer[CloseReason] // 主动断开的原因，先设置者生效
+}
+
+// countingWriter 统计写入字节数，供实时统计使用
+// onFirstWrite 非空时在首次写出数据后调用一次（每个方向只有一个写入 goroutine）
+type countingWriter struct {
+	w            io.Writer
+	counter      *atomic.Uint64
+	onFirstWrite func()
+	wrote        bool
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.counter.Add(uint64(n))
+	if n > 0 && !c.wrote {
+		c.wrote = true
+		if c.onFirstWrite != nil {
+			c.onFirstWrite()
+		}
+	}
+	return n, err
+}
+
+// Timed handshake constants（与 tunnel.EncodeTimedHandshake 一致）
+// 帧格式: [0xFE][version][8 字节 unix 纳秒, 大端][36 字节 Tunnel ID]
+const (
+	timedHandshakeMagic byte = 0xFE
+	tunnelIDLength           = 36
+	timedHandshakeExtra      = 10 // 相对普通 36 字节握手多出的字节数
+)
+
+// readTunnelHandshake 读取握手帧，兼容普通 36 字节帧、带时间戳的帧、关闭通知帧（版本 0x02）和多跳帧（版本 0x03）
+// 返回的 tunnelID 保持 36 字节填充格式，各种帧的同一隧道可以互相配对；
+// connectedAt 在普通帧或未携带连接时间时为零值，closeNotice 表示客户端请求关闭通知
+func readTunnelHandshake(r io.Reader) (*relayHandshake, error) {
+	buf := make([]byte, tunnelIDLength)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, fmt.Errorf("failed to read tunnel ID: %w", err)
+	}
+	if buf[0] != timedHandshakeMagic {
+		return &relayHandshake{tunnelID: string(buf)}, nil
+	}
+
+	frame := make([]byte, tunnelIDLength+timedHandshakeExtra)
+	copy(frame, buf)
+	if _, err := io.ReadFull(r, frame[tunnelIDLength:]); err != nil {
+		return nil, fmt.Errorf("failed to read timed handshake: %w", err)
+	}
+	hs := &relayHandshake{tunnelID: string(frame[10:]), closeNotice: frame[1] == closeNoticeVersion}
+	if nanos := int64(binary.BigEndian.Uint64(frame[2:10])); nanos != 0 {
+		hs.connectedAt = time.Unix(0, nanos)
+	}
+	if frame[1] == chainHandshakeVersion {
+		chain, err := readChainRoute(r)
+		if err != nil {
+			return nil, err
+		}
+		hs.chain = chain
+		hs.closeNotice = chain.flags&chainFlagCloseNotice != 0
+	}
+	return hs, nil
 }
 
 // tunnelRelayServer 实现
 type tunnelRelayServer struct {
 	listener net.Listener
+	raw      net.Listener // TLS / PROXY protocol 之前的 TCP 监听器
+	draining atomic.Bool
 	logger   logging.Logger
 	wg       sync.WaitGroup
 	stopChan chan struct{}
+	ready    chan struct{} // Serve 设置好监听器后关闭
 	mu       sync.RWMutex
 
 	// 配置参数
@@ -73,15 +248,31 @@ type tunnelRelayServer struct {
 	readTimeout    time.Duration // 读超时（默认 30 秒）
 	writeTimeout   time.Duration // 写超时（默认 30 秒）
 	maxConnections int           // 最大连接数
+	clock          clock.Clock   // 配对超时与待配对清理的计时时钟
+
+	serviceResolver     func(tunnelID string) string
+	traceResolver       func(tunnelID string) string
+	onPaired            func(tunnelID string)
+	qosResolver         func(tunnelID string) string
+	serviceLabels       *serviceLabeler
+	acceptProxyProtocol bool
+
+	// 多跳隧道
+	chainTLSConfig *tls.Config
+	chainPeers     *cert.InternalPeerPolicy
 
 	// 待配对连接（tunnelID -> PendingConnection）
 	pendingIH sync.Map // map[string]*PendingConnection
 	pendingAH sync.Map // map[string]*PendingConnection
 
+	// 正在中继的隧道（tunnelID -> *activeRelay）
+	activeRelays sync.Map
+
 	// 统计信息
 	activeTunnels int
 	totalRelayed  uint64
 	errorCount    int
+	closeReasons  map[CloseReason]uint64
 }
 
 // TunnelRelayConfig 中继服务器配置
@@ -91,6 +282,40 @@ type TunnelRelayConfig struct {
 	ReadTimeout    time.Duration // 读超时（默认 30 秒）
 	WriteTimeout   time.Duration // 写超时（默认 30 秒）
 	MaxConnections int           // 最大连接数（默认 10000）
+
+	// ServiceResolver 根据隧道 ID 返回服务 ID，用于按服务统计的指标（字节数、活跃隧道、错误、TTFB）的 service 标签（可选）
+	ServiceResolver func(tunnelID string) string
+
+	// QoSResolver 根据隧道 ID 返回 DSCP 服务等级（见 qos 包），配对后据此标记 IH 与 AH 两侧的中继连接（可选）
+	// 返回空字符串时不标记；多跳隧道只由最后一跳标记
+	QoSResolver func(tunnelID string) string
+
+	// TraceResolver 根据隧道 ID 返回创建该隧道的请求的 trace ID，非空时作为配对耗时直方图的 exemplar（可选）
+	TraceResolver func(tunnelID string) string
+
+	// OnPaired 隧道在本中继完成 IH 与 AH 配对时调用（参数为去除填充的隧道 ID），Controller 据此确认隧道已配对（可选）
+	// 在中继 goroutine 中同步调用，须快速返回
+	OnPaired func(tunnelID string)
+
+	// MetricsServices 单独打 service 标签的服务名单，名单外的服务计入 "other"；
+	// 为空时按出现顺序为前 MetricsServiceLimit 个服务（默认 100）打标签，避免标签基数无限增长
+	MetricsServices     []string
+	MetricsServiceLimit int
+
+	// AcceptProxyProtocol 中继部署在四层 LB 之后时启用，要求每个连接以 PROXY protocol v2 头开头
+	AcceptProxyProtocol bool
+
+	// Clock 配对超时与待配对连接清理使用的时钟（默认真实时钟）
+	// 连接读写 deadline 由内核计时，始终使用真实时间
+	Clock clock.Clock
+
+	// ChainTLSConfig 多跳隧道连接下一跳中继的 mTLS 客户端配置（出示本中继的内部身份证书，信任下一跳的服务端证书）；
+	// 为空时本中继只能作为链上最后一跳，需要继续转发的多跳握手被拒绝
+	ChainTLSConfig *tls.Config
+
+	// ChainPeers 允许转发多跳隧道给本中继的上一跳内部身份（如 AllowedRoles: relay、controller）；
+	// 为空时只接受 IH 直接发起的多跳握手。上一跳的内部证书须由数据平面监听信任的 CA 签发
+	ChainPeers *cert.InternalPeerPolicy
 }
 
 // NewTunnelRelayServer 创建隧道中继服务器
@@ -112,11 +337,23 @@ func NewTunnelRelayServer(logger logging.Logger, config *TunnelRelayConfig) Tunn
 	server := &tunnelRelayServer{
 		logger:         logger,
 		stopChan:       make(chan struct{}),
+		ready:          make(chan struct{}),
 		pairingTimeout: config.PairingTimeout,
 		bufferSize:     config.BufferSize,
 		readTimeout:    config.ReadTimeout,
 		writeTimeout:   config.WriteTimeout,
 		maxConnections: config.MaxConnections,
+		clock:          clock.Or(config.Clock),
+
+		serviceResolver:     config.ServiceResolver,
+		qosResolver:         config.QoSResolver,
+		traceResolver:       config.TraceResolver,
+		onPaired:            config.OnPaired,
+		serviceLabels:       newServiceLabeler(config.MetricsServices, config.MetricsServiceLimit),
+		acceptProxyProtocol: config.AcceptProxyProtocol,
+
+		chainTLSConfig: config.ChainTLSConfig,
+		chainPeers:     config.ChainPeers,
 	}
 
 	// 启动超时清理 goroutine
@@ -131,26 +368,78 @@ func (s *tunnelRelayServer) StartTLS(addr string, tlsConfig *tls.Config) error {
 		return fmt.Errorf("TLS config is required for tunnel relay")
 	}
 
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	return s.Serve(ln, tlsConfig)
+}
+
+// Serve 在给定 TCP 监听器上启动 mTLS 中继
+func (s *tunnelRelayServer) Serve(raw net.Listener, tlsConfig *tls.Config) error {
+	if tlsConfig == nil {
+		return fmt.Errorf("TLS config is required for tunnel relay")
+	}
+
 	// 强制要求客户端证书
 	if tlsConfig.ClientAuth != tls.RequireAndVerifyClientCert {
 		s.logger.Warn("TLS config does not require client cert, overriding to RequireAndVerifyClientCert")
 		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
 	}
 
-	ln, err := tls.Listen("tcp", addr, tlsConfig)
-	if err != nil {
-		return fmt.Errorf("failed to listen on %s with TLS: %w", addr, err)
+	var ln net.Listener
+	if s.acceptProxyProtocol {
+		// LB → 中继：先解析 PROXY 头再进行 TLS 握手
+		ln = tls.NewListener(NewProxyProtocolListener(raw), tlsConfig)
+	} else {
+		ln = tls.NewListener(raw, tlsConfig)
 	}
 
 	s.mu.Lock()
+	s.raw = raw
 	s.listener = ln
+	select {
+	case <-s.ready:
+	default:
+		close(s.ready)
+	}
 	s.mu.Unlock()
 
-	s.logger.Info("Tunnel Relay Server started with mTLS", "addr", addr)
+	s.logger.Info("Tunnel Relay Server started with mTLS", "addr", raw.Addr().String(), "proxy_protocol", s.acceptProxyProtocol)
 
 	return s.acceptLoop()
 }
 
+// Listener 返回底层 TCP 监听器
+func (s *tunnelRelayServer) Listener() net.Listener {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.raw
+}
+
+// Ready 返回中继开始接受连接后关闭的通道
+func (s *tunnelRelayServer) Ready() <-chan struct{} {
+	return s.ready
+}
+
+// Addr 返回正在接受连接的监听地址
+func (s *tunnelRelayServer) Addr() net.Addr {
+	select {
+	case <-s.stopChan:
+		return nil
+	default:
+	}
+	if s.draining.Load() {
+		return nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.raw == nil {
+		return nil
+	}
+	return s.raw.Addr()
+}
+
 // acceptLoop 接受连接循环
 func (s *tunnelRelayServer) acceptLoop() error {
 	for {
@@ -165,9 +454,20 @@ func (s *tunnelRelayServer) acceptLoop() error {
 				s.logger.Info("Tunnel Relay Server stopped")
 				return nil
 			default:
-				s.logger.Error("Failed to accept connection", "error", err.Error())
-				continue
 			}
+			if s.draining.Load() {
+				s.logger.Info("Tunnel Relay Server stopped accepting (draining)")
+				return nil
+			}
+			s.logger.Error("Failed to accept connection", "error", err.Error())
+			continue
+		}
+
+		if faults.DropRelayConn() {
+			s.logger.Warn("Fault injection: dropping relay connection", "remote_addr", conn.RemoteAddr().String())
+			conn.Close()
+			s.recordClose(MetricsServiceUnknown, CloseReasonFaultInjected)
+			continue
 		}
 
 		// 检查连接数限制
@@ -178,6 +478,7 @@ func (s *tunnelRelayServer) acceptLoop() error {
 		if activeCount >= s.maxConnections {
 			s.logger.Warn("Max connections reached, rejecting", "max", s.maxConnections)
 			conn.Close()
+			s.recordClose(MetricsServiceUnknown, CloseReasonCapacity)
 			continue
 		}
 
@@ -187,9 +488,6 @@ func (s *tunnelRelayServer) acceptLoop() error {
 			defer s.wg.Done()
 			if err := s.handleConnection(conn); err != nil {
 				s.logger.Error("Connection handling error", "error", err.Error())
-				s.mu.Lock()
-				s.errorCount++
-				s.mu.Unlock()
 			}
 		}()
 	}
@@ -201,7 +499,11 @@ func (s *tunnelRelayServer) handleConnection(conn net.Conn) error {
 
 	// 设置 TCP KeepAlive 和 TCP_NODELAY
 	if tcpConn, ok := conn.(*tls.Conn); ok {
-		if netConn := tcpConn.NetConn(); netConn != nil {
+		netConn := tcpConn.NetConn()
+		if pc, ok := netConn.(*proxyProtocolConn); ok {
+			netConn = pc.Conn
+		}
+		if netConn != nil {
 			if tcp, ok := netConn.(*net.TCPConn); ok {
 				// 启用 TCP KeepAlive，30秒间隔
 				if err := tcp.SetKeepAlive(true); err != nil {
@@ -223,12 +525,16 @@ func (s *tunnelRelayServer) handleConnection(conn net.Conn) error {
 		conn.SetReadDeadline(time.Now().Add(s.readTimeout))
 	}
 
-	// 1. 读取 TunnelID（36 字节 UUID）
-	buf := make([]byte, 36)
-	if _, err := io.ReadFull(conn, buf); err != nil {
-		return fmt.Errorf("failed to read tunnel ID: %w", err)
+	// 1. 读取 TunnelID（36 字节 UUID，或带本地连接时间戳 / 多跳路由的握手帧）
+	hs, err := readTunnelHandshake(conn)
+	if err != nil {
+		s.recordClose(MetricsServiceUnknown, CloseReasonHandshakeFailed)
+		return err
+	}
+	tunnelID, connectedAt := hs.tunnelID, hs.connectedAt
+	if connectedAt.IsZero() {
+		connectedAt = time.Now()
 	}
-	tunnelID := string(buf)
 
 	// 清除读超时
 	if s.readTimeout > 0 {
@@ -238,28 +544,52 @@ func (s *tunnelRelayServer) handleConnection(conn net.Conn) error {
 	// 2. 提取客户端 ID 判断是 IH 还是 AH
 	tlsConn, ok := conn.(*tls.Conn)
 	if !ok {
+		s.recordClose(MetricsServiceUnknown, CloseReasonHandshakeFailed)
 		return fmt.Errorf("not a TLS connection")
 	}
 
 	state := tlsConn.ConnectionState()
 	if len(state.PeerCertificates) == 0 {
+		s.recordClose(MetricsServiceUnknown, CloseReasonHandshakeFailed)
 		return fmt.Errorf("no client certificate provided")
 	}
 
 	clientCN := state.PeerCertificates[0].Subject.CommonName
+
+	// 请求了关闭通知的客户端：中继 → 客户端方向按帧写出，断开前告知原因
+	if hs.closeNotice {
+		conn = &noticeConn{Conn: conn}
+	}
+
+	// 多跳隧道：上一跳中继转发的连接以发起隧道的 IH 身份参与配对，路由未走完时继续转发
+	var hop *RelayHop
+	if hs.chain != nil {
+		hop, clientCN, err = s.acceptChain(state.PeerCertificates[0], clientCN, hs.chain)
+		if err != nil {
+			s.logger.Warn("Chained connection rejected", "tunnel_id", tunnelID, "client_cn", clientCN, "error", err)
+			notifyClose(conn, string(CloseReasonChainRejected))
+			s.recordClose(s.serviceLabel(tunnelID), CloseReasonChainRejected)
+			return err
+		}
+		if len(hs.chain.route) > 0 {
+			return s.forwardChain(conn, hs, clientCN, hop)
+		}
+	}
 	clientType := s.determineClientType(clientCN)
 
 	s.logger.Info("Connection received",
 		"tunnel_id", tunnelID,
 		"client_cn", clientCN,
+		"remote_addr", conn.RemoteAddr().String(),
 		"client_type", clientType)
 
 	// 3. 尝试配对
 	if clientType == "ih" {
-		return s.handleIHConnection(conn, tunnelID, clientCN)
+		return s.handleIHConnection(conn, tunnelID, clientCN, connectedAt, hop)
 	} else if clientType == "ah" {
 		return s.handleAHConnection(conn, tunnelID, clientCN)
 	} else {
+		s.recordClose(s.serviceLabel(tunnelID), CloseReasonUnknownClient)
 		return fmt.Errorf("unknown client type: %s", clientCN)
 	}
 }
@@ -280,14 +610,15 @@ func (s *tunnelRelayServer) determineClientType(cn string) string {
 }
 
 // handleIHConnection 处理 IH 连接
-func (s *tunnelRelayServer) handleIHConnection(conn net.Conn, tunnelID, clientCN string) error {
+// hop 为多跳隧道中本中继（最后一跳）的位置，普通连接为 nil
+func (s *tunnelRelayServer) handleIHConnection(conn net.Conn, tunnelID, clientCN string, connectedAt time.Time, hop *RelayHop) error {
 	// 检查是否已有 AH 在等待
 	if value, ok := s.pendingAH.LoadAndDelete(tunnelID); ok {
 		ahConn := value.(*PendingConnection)
 
 		// Record pairing duration
-		pairingDuration := time.Since(ahConn.ReceivedAt).Seconds()
-		recordPairingDuration(pairingDuration)
+		pairingDuration := s.clock.Since(ahConn.ReceivedAt).Seconds()
+		s.paired(tunnelID, pairingDuration)
 
 		// Update tunnel metrics
 		s.mu.Lock()
@@ -301,58 +632,76 @@ func (s *tunnelRelayServer) handleIHConnection(conn net.Conn, tunnelID, clientCN
 			"ah_client", ahConn.TunnelID,
 			"pairing_duration", pairingDuration)
 
-		// 立即开始转发
-		return s.relayData(conn, ahConn.Conn, tunnelID, clientCN)
+		// 立即开始转发，结束后唤醒 AH 的等待 goroutine
+		defer ahConn.finish()
+		return s.relayData(conn, ahConn.Conn, tunnelID, clientCN, connectedAt, hop)
 	}
 
 	// AH 未到达，将 IH 加入等待队列
 	pending := &PendingConnection{
-		Conn:       conn,
-		TunnelID:   tunnelID,
-		ClientType: "ih",
-		ReceivedAt: time.Now(),
+		Conn:        conn,
+		TunnelID:    tunnelID,
+		ClientType:  "ih",
+		ReceivedAt:  s.clock.Now(),
+		ConnectedAt: connectedAt,
+		Hop:         hop,
+		done:        make(chan struct{}),
 	}
 	s.pendingIH.Store(tunnelID, pending)
 
 	s.logger.Info("IH waiting for AH", "tunnel_id", tunnelID, "client_cn", clientCN)
 
-	// 等待配对或超时
-	ctx, cancel := context.WithTimeout(context.Background(), s.pairingTimeout)
-	defer cancel()
+	ahConn, err := s.waitForPeer(pending, &s.pendingIH, &s.pendingAH)
+	if ahConn == nil {
+		return err
+	}
+	defer ahConn.finish()
 
-	ticker := time.NewTicker(100 * time.Millisecond)
-	defer ticker.Stop()
+	// Record pairing duration (IH arrived first, AH arrived later)
+	pairingDuration := s.clock.Since(pending.ReceivedAt).Seconds()
+	s.paired(tunnelID, pairingDuration)
 
-	for {
-		select {
-		case <-ctx.Done():
-			s.pendingIH.Delete(tunnelID)
-			return fmt.Errorf("pairing timeout for tunnel %s", tunnelID)
+	// Update tunnel metrics
+	s.mu.Lock()
+	s.activeTunnels++
+	s.mu.Unlock()
+	tunnelTotal.WithLabelValues("active").Inc()
 
-		case <-ticker.C:
-			// 检查 AH 是否已到达
-			if value, ok := s.pendingAH.LoadAndDelete(tunnelID); ok {
-				s.pendingIH.Delete(tunnelID)
-				ahConn := value.(*PendingConnection)
-
-				// Record pairing duration (IH arrived first, AH arrived later)
-				pairingDuration := time.Since(pending.ReceivedAt).Seconds()
-				recordPairingDuration(pairingDuration)
-
-				// Update tunnel metrics
-				s.mu.Lock()
-				s.activeTunnels++
-				s.mu.Unlock()
-				tunnelTotal.WithLabelValues("active").Inc()
-
-				s.logger.Info("Pairing completed (AH arrived)",
-					"tunnel_id", tunnelID,
-					"ih_client", clientCN,
-					"pairing_duration", pairingDuration)
-				return s.relayData(conn, ahConn.Conn, tunnelID, clientCN)
-			}
-		}
+	s.logger.Info("Pairing completed (AH arrived)",
+		"tunnel_id", tunnelID,
+		"ih_client", clientCN,
+		"pairing_duration", pairingDuration)
+	return s.relayData(conn, ahConn.Conn, tunnelID, clientCN, connectedAt, hop)
+}
+
+// RelayIH 以 IH 一端接入进程内的连接，配对与中继同 TLS 接入的 IH
+func (s *tunnelRelayServer) RelayIH(conn net.Conn, tunnelID, client string, connectedAt time.Time) error {
+	if len(tunnelID) == 0 || len(tunnelID) > tunnelIDLength {
+		conn.Close()
+		return fmt.Errorf("invalid tunnel ID length: %d", len(tunnelID))
+	}
+	select {
+	case <-s.stopChan:
+		conn.Close()
+		return fmt.Errorf("relay server stopped")
+	default:
+	}
+	if s.draining.Load() {
+		conn.Close()
+		return fmt.Errorf("relay server draining")
 	}
+	if connectedAt.IsZero() {
+		connectedAt = time.Now()
+	}
+
+	s.wg.Add(1)
+	defer s.wg.Done()
+	defer conn.Close()
+
+	// 与握手帧中的隧道 ID 一致：不足 36 字节以零填充
+	padded := make([]byte, tunnelIDLength)
+	copy(padded, tunnelID)
+	return s.handleIHConnection(conn, string(padded), client, connectedAt, nil)
 }
 
 // handleAHConnection 处理 AH 连接
@@ -362,8 +711,8 @@ func (s *tunnelRelayServer) handleAHConnection(conn net.Conn, tunnelID, clientCN
 		ihConn := value.(*PendingConnection)
 
 		// Record pairing duration (IH arrived first, AH arrived later)
-		pairingDuration := time.Since(ihConn.ReceivedAt).Seconds()
-		recordPairingDuration(pairingDuration)
+		pairingDuration := s.clock.Since(ihConn.ReceivedAt).Seconds()
+		s.paired(tunnelID, pairingDuration)
 
 		// Update tunnel metrics
 		s.mu.Lock()
@@ -377,8 +726,9 @@ func (s *tunnelRelayServer) handleAHConnection(conn net.Conn, tunnelID, clientCN
 			"ih_client", ihConn.TunnelID,
 			"pairing_duration", pairingDuration)
 
-		// 立即开始转发
-		return s.relayData(conn, ihConn.Conn, tunnelID, clientCN)
+		// 立即开始转发，结束后唤醒 IH 的等待 goroutine
+		defer ihConn.finish()
+		return s.relayData(ihConn.Conn, conn, tunnelID, clientCN, ihConn.ConnectedAt, ihConn.Hop)
 	}
 
 	// IH 未到达，将 AH 加入等待队列
@@ -386,41 +736,83 @@ func (s *tunnelRelayServer) handleAHConnection(conn net.Conn, tunnelID, clientCN
 		Conn:       conn,
 		TunnelID:   tunnelID,
 		ClientType: "ah",
-		ReceivedAt: time.Now(),
+		ReceivedAt: s.clock.Now(),
+		done:       make(chan struct{}),
 	}
 	s.pendingAH.Store(tunnelID, pending)
 
 	s.logger.Info("AH waiting for IH", "tunnel_id", tunnelID, "client_cn", clientCN)
 
-	// 等待配对或超时
-	ctx, cancel := context.WithTimeout(context.Background(), s.pairingTimeout)
-	defer cancel()
+	ihConn, err := s.waitForPeer(pending, &s.pendingAH, &s.pendingIH)
+	if ihConn == nil {
+		return err
+	}
+	defer ihConn.finish()
+
+	s.logger.Info("Pairing completed (IH arrived)",
+		"tunnel_id", tunnelID,
+		"ah_client", clientCN)
+	return s.relayData(ihConn.Conn, conn, tunnelID, clientCN, ihConn.ConnectedAt, ihConn.Hop)
+}
+
+// waitForPeer 在 own 队列中等待配对，直到：
+//   - 在 peer 队列中找到对端：返回对端连接，由当前 goroutine 转发；
+//   - 被对端 goroutine 取走配对：等待其结束中继后返回 nil，期间不受配对超时影响；
+//   - 配对超时或被清理、停止关闭：记录关闭原因，配对超时返回错误
+func (s *tunnelRelayServer) waitForPeer(pending *PendingConnection, own, peer *sync.Map) (*PendingConnection, error) {
+	tunnelID := pending.TunnelID
+	timeout := s.clock.After(s.pairingTimeout)
+	stopped := s.stopChan
 
 	ticker := time.NewTicker(100 * time.Millisecond)
 	defer ticker.Stop()
 
 	for {
 		select {
-		case <-ctx.Done():
-			s.pendingAH.Delete(tunnelID)
-			return fmt.Errorf("pairing timeout for tunnel %s", tunnelID)
+		case <-timeout:
+			// 已被对端取走时不能关闭，继续等待中继结束
+			if own.CompareAndDelete(tunnelID, pending) {
+				pending.close(CloseReasonPairingTimeout)
+			}
+
+		case <-stopped:
+			// Stop 遍历待配对队列之后才入队的连接在此关闭
+			stopped = nil
+			if own.CompareAndDelete(tunnelID, pending) {
+				pending.close(CloseReasonShutdown)
+			}
+
+		case <-pending.done:
+			reason := pending.closeReason()
+			if reason == "" {
+				return nil, nil
+			}
+			own.CompareAndDelete(tunnelID, pending)
+			s.recordClose(s.serviceLabel(tunnelID), reason)
+			if reason == CloseReasonPairingTimeout {
+				return nil, fmt.Errorf("pairing timeout for tunnel %s", tunnelID)
+			}
+			return nil, nil
 
 		case <-ticker.C:
-			// 检查 IH 是否已到达
-			if value, ok := s.pendingIH.LoadAndDelete(tunnelID); ok {
-				s.pendingAH.Delete(tunnelID)
-				ihConn := value.(*PendingConnection)
-				s.logger.Info("Pairing completed (IH arrived)",
-					"tunnel_id", tunnelID,
-					"ah_client", clientCN)
-				return s.relayData(ihConn.Conn, conn, tunnelID, clientCN)
+			// 检查对端是否已到达；先从队列取出自己，避免双方同时取走对方
+			if _, ok := peer.Load(tunnelID); !ok {
+				continue
+			}
+			if !own.CompareAndDelete(tunnelID, pending) {
+				continue
+			}
+			if value, ok := peer.LoadAndDelete(tunnelID); ok {
+				return value.(*PendingConnection), nil
 			}
+			own.Store(tunnelID, pending)
 		}
 	}
 }
 
 // relayData 双向转发数据（零拷贝）
-func (s *tunnelRelayServer) relayData(ihConn, ahConn net.Conn, tunnelID, clientInfo string) error {
+// connectedAt 为 IH 本地连接时间，用于计算首字节时间（TTFB）；多跳隧道的中间跳 ahConn 为下一跳中继的连接
+func (s *tunnelRelayServer) relayData(ihConn, ahConn net.Conn, tunnelID, clientInfo string, connectedAt time.Time, hop *RelayHop) error {
 	defer ihConn.Close()
 	defer ahConn.Close()
 
@@ -436,13 +828,36 @@ func (s *tunnelRelayServer) relayData(ihConn, ahConn net.Conn, tunnelID, clientI
 
 	s.logger.Info("Starting data relay", "tunnel_id", tunnelID, "client", clientInfo)
 
+	service := s.resolveService(tunnelID)
+	relay := &activeRelay{
+		tunnelID:    tunnelID,
+		service:     service,
+		label:       s.serviceLabels.label(service),
+		client:      clientInfo,
+		startedAt:   s.clock.Now(),
+		connectedAt: connectedAt,
+		hop:         hop,
+		ihConn:      ihConn,
+		ahConn:      ahConn,
+	}
+	s.activeRelays.Store(tunnelID, relay)
+	defer s.activeRelays.Delete(tunnelID)
+	// Stop 先关闭 stopChan 再遍历 activeRelays：其后登记的隧道在此关闭
+	select {
+	case <-s.stopChan:
+		relay.close(string(CloseReasonShutdown))
+	default:
+	}
+	s.markQoS(tunnelID, ihConn, ahConn)
+	recordRelayActive(relay.label, 1)
+	defer recordRelayActive(relay.label, -1)
+
 	errChan := make(chan error, 2)
-	var bytesIHToAH, bytesAHToIH uint64
 
 	// IH → AH
 	go func() {
-		n, err := io.Copy(ahConn, ihConn)
-		bytesIHToAH = uint64(n)
+		n, err := io.Copy(&countingWriter{w: ahConn, counter: &relay.bytesIHToAH}, ihConn)
+		notifyClose(ahConn, string(CloseReasonPeerClosed))
 		s.logger.Debug("IH→AH relay finished",
 			"tunnel_id", tunnelID,
 			"bytes", n,
@@ -452,8 +867,8 @@ func (s *tunnelRelayServer) relayData(ihConn, ahConn net.Conn, tunnelID, clientI
 
 	// AH → IH
 	go func() {
-		n, err := io.Copy(ihConn, ahConn)
-		bytesAHToIH = uint64(n)
+		n, err := io.Copy(&countingWriter{w: ihConn, counter: &relay.bytesAHToIH, onFirstWrite: relay.recordFirstByte}, ahConn)
+		notifyClose(ihConn, string(CloseReasonPeerClosed))
 		s.logger.Debug("AH→IH relay finished",
 			"tunnel_id", tunnelID,
 			"bytes", n,
@@ -464,6 +879,8 @@ func (s *tunnelRelayServer) relayData(ihConn, ahConn net.Conn, tunnelID, clientI
 	// 等待任一方向完成
 	err := <-errChan
 
+	// 另一方向可能仍在收尾，字节数取自原子计数而非其局部变量
+	bytesIHToAH, bytesAHToIH := relay.bytesIHToAH.Load(), relay.bytesAHToIH.Load()
 	totalBytes := bytesIHToAH + bytesAHToIH
 
 	s.mu.Lock()
@@ -471,46 +888,118 @@ func (s *tunnelRelayServer) relayData(ihConn, ahConn net.Conn, tunnelID, clientI
 	s.mu.Unlock()
 
 	// Record bytes transferred in Prometheus
-	recordBytesTransferred(totalBytes)
-
-	// Record error if present
-	if err != nil {
-		s.mu.Lock()
-		s.errorCount++
-		s.mu.Unlock()
+	recordBytesTransferred(relay.label, totalBytes)
 
-		// Determine error reason
-		reason := "unknown"
-		if err == io.EOF {
-			reason = "connection_closed"
-		} else if strings.Contains(err.Error(), "read") {
-			reason = "read_error"
-		} else if strings.Contains(err.Error(), "write") {
-			reason = "write_error"
-		}
-		recordRelayError(reason)
+	// 主动断开的原因优先，否则按先结束方向的错误判断
+	reason := classifyRelayError(err)
+	if r := relay.reason.Load(); r != nil {
+		reason = *r
 	}
+	s.recordClose(relay.label, reason)
 
-	s.logger.Info("Data relay completed",
+	fields := []interface{}{
 		"tunnel_id", tunnelID,
 		"ih_to_ah_bytes", bytesIHToAH,
 		"ah_to_ih_bytes", bytesAHToIH,
-		"error", err)
+		"reason", reason,
+		"error", err,
+	}
+	if hop != nil {
+		// 各跳分别记录本段的字节数
+		fields = append(fields, "hop", hop.Index, "prev_hop", hop.Prev, "next_hop", hop.Next)
+	}
+	s.logger.Info("Data relay completed", fields...)
 
 	return err
 }
 
+// recordClose 记录一次连接关闭，错误类原因同时计入 ErrorCount 与 tunnel_relay_errors_total
+func (s *tunnelRelayServer) recordClose(service string, reason CloseReason) {
+	s.mu.Lock()
+	if s.closeReasons == nil {
+		s.closeReasons = make(map[CloseReason]uint64)
+	}
+	s.closeReasons[reason]++
+	if reason.IsError() {
+		s.errorCount++
+	}
+	s.mu.Unlock()
+
+	recordRelayClose(service, string(reason))
+	if reason.IsError() {
+		recordRelayError(service, string(reason))
+	}
+}
+
+// markQoS 按隧道的服务等级标记两侧连接，不支持标记的平台或连接只记录调试日志
+func (s *tunnelRelayServer) markQoS(tunnelID string, conns ...net.Conn) {
+	if s.qosResolver == nil {
+		return
+	}
+	class := s.qosResolver(strings.TrimRight(tunnelID, "\x00"))
+	if class == "" {
+		return
+	}
+	for _, conn := range conns {
+		if err := qos.MarkClass(conn, class); err != nil {
+			s.logger.Debug("DSCP marking skipped", "tunnel_id", tunnelID, "qos_class", class, "error", err)
+		}
+	}
+}
+
+// serviceLabel 隧道所属服务的指标标签
+func (s *tunnelRelayServer) serviceLabel(tunnelID string) string {
+	return s.serviceLabels.label(s.resolveService(tunnelID))
+}
+
+// resolveService 查询隧道所属服务，未配置解析器或查询失败时返回 "unknown"
+func (s *tunnelRelayServer) resolveService(tunnelID string) string {
+	if s.serviceResolver != nil {
+		if service := s.serviceResolver(strings.TrimRight(tunnelID, "\x00")); service != "" {
+			return service
+		}
+	}
+	return MetricsServiceUnknown
+}
+
+// paired 记录配对耗时并通知 OnPaired
+func (s *tunnelRelayServer) paired(tunnelID string, pairingDuration float64) {
+	recordPairingDuration(pairingDuration, s.resolveTrace(tunnelID))
+	if s.onPaired != nil {
+		s.onPaired(strings.TrimRight(tunnelID, "\x00"))
+	}
+}
+
+// resolveTrace 查询隧道的 trace ID，未配置解析器时返回空
+func (s *tunnelRelayServer) resolveTrace(tunnelID string) string {
+	if s.traceResolver == nil {
+		return ""
+	}
+	return s.traceResolver(strings.TrimRight(tunnelID, "\x00"))
+}
+
+// recordFirstByte 记录 AH→IH 首字节转发时间
+// 跨主机时钟偏差导致结果为负时只保留统计中的零值，不计入指标
+func (r *activeRelay) recordFirstByte() {
+	ttfb := time.Since(r.connectedAt)
+	if ttfb <= 0 {
+		return
+	}
+	r.ttfb.Store(int64(ttfb))
+	recordRelayTTFB(r.label, ttfb.Seconds())
+}
+
 // cleanupExpiredConnections 清理过期的待配对连接
 func (s *tunnelRelayServer) cleanupExpiredConnections() {
-	ticker := time.NewTicker(60 * time.Second) // 每60秒扫描一次过期连接
+	ticker := s.clock.NewTicker(60 * time.Second) // 每60秒扫描一次过期连接
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-s.stopChan:
 			return
-		case <-ticker.C:
-			now := time.Now()
+		case <-ticker.C():
+			now := s.clock.Now()
 
 			// 清理过期的 IH 连接
 			s.pendingIH.Range(func(key, value interface{}) bool {
@@ -519,11 +1008,9 @@ func (s *tunnelRelayServer) cleanupExpiredConnections() {
 					s.logger.Warn("Cleaning up expired IH connection",
 						"tunnel_id", pending.TunnelID,
 						"age_seconds", int(now.Sub(pending.ReceivedAt).Seconds()))
-					pending.Conn.Close()
-					s.pendingIH.Delete(key)
-
-					// Record timeout error in metrics
-					recordRelayError("pairing_timeout")
+					// 关闭原因由等待配对的 goroutine 记录
+					s.pendingIH.CompareAndDelete(key, pending)
+					pending.close(CloseReasonPairingTimeout)
 				}
 				return true
 			})
@@ -535,11 +1022,9 @@ func (s *tunnelRelayServer) cleanupExpiredConnections() {
 					s.logger.Warn("Cleaning up expired AH connection",
 						"tunnel_id", pending.TunnelID,
 						"age_seconds", int(now.Sub(pending.ReceivedAt).Seconds()))
-					pending.Conn.Close()
-					s.pendingAH.Delete(key)
-
-					// Record timeout error in metrics
-					recordRelayError("pairing_timeout")
+					// 关闭原因由等待配对的 goroutine 记录
+					s.pendingAH.CompareAndDelete(key, pending)
+					pending.close(CloseReasonPairingTimeout)
 				}
 				return true
 			})
@@ -547,7 +1032,52 @@ func (s *tunnelRelayServer) cleanupExpiredConnections() {
 	}
 }
 
-// Stop 停止服务器
+// Drain 停止接受新连接并等待正在中继的隧道结束
+// 监听器副本已传递给新进程时，关闭本进程的副本不影响新进程继续 accept
+func (s *tunnelRelayServer) Drain(ctx context.Context) error {
+	s.draining.Store(true)
+
+	s.mu.Lock()
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	s.mu.Unlock()
+
+	// 待配对连接的对端可能连到新进程，无法在本进程配对：关闭后由客户端重试
+	closePending := func(key, value interface{}) bool {
+		value.(*PendingConnection).close(CloseReasonShutdown)
+		return true
+	}
+	s.pendingIH.Range(closePending)
+	s.pendingAH.Range(closePending)
+
+	s.logger.Info("Tunnel Relay Server draining", "active_tunnels", s.GetStats().ActiveTunnels)
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		s.logger.Info("Tunnel Relay Server drained")
+		return nil
+	case <-ctx.Done():
+	}
+
+	remaining := 0
+	s.activeRelays.Range(func(key, value interface{}) bool {
+		value.(*activeRelay).close(string(CloseReasonShutdown))
+		remaining++
+		return true
+	})
+	s.logger.Warn("Drain deadline reached, closing remaining tunnels", "tunnels", remaining)
+	<-done
+	return ctx.Err()
+}
+
+// Stop 停止服务器，关闭待配对连接与正在中继的隧道
 func (s *tunnelRelayServer) Stop() error {
 	// 使用 select 防止重复关闭
 	select {
@@ -566,14 +1096,18 @@ func (s *tunnelRelayServer) Stop() error {
 
 	// 关闭所有待配对连接
 	s.pendingIH.Range(func(key, value interface{}) bool {
-		pending := value.(*PendingConnection)
-		pending.Conn.Close()
+		value.(*PendingConnection).close(CloseReasonShutdown)
 		return true
 	})
 
 	s.pendingAH.Range(func(key, value interface{}) bool {
-		pending := value.(*PendingConnection)
-		pending.Conn.Close()
+		value.(*PendingConnection).close(CloseReasonShutdown)
+		return true
+	})
+
+	// 关闭正在中继的隧道（需要等待隧道自然结束时使用 Drain）
+	s.activeRelays.Range(func(key, value interface{}) bool {
+		value.(*activeRelay).close(string(CloseReasonShutdown))
 		return true
 	})
 
@@ -601,6 +1135,11 @@ func (s *tunnelRelayServer) GetStats() *RelayStats {
 		return true
 	})
 
+	closeReasons := make(map[CloseReason]uint64, len(s.closeReasons))
+	for reason, n := range s.closeReasons {
+		closeReasons[reason] = n
+	}
+
 	return &RelayStats{
 		ActiveTunnels:      s.activeTunnels,
 		PendingConnections: pendingIHCount + pendingAHCount,
@@ -608,5 +1147,63 @@ func (s *tunnelRelayServer) GetStats() *RelayStats {
 		PendingAH:          pendingAHCount,
 		TotalRelayed:       s.totalRelayed,
 		ErrorCount:         s.errorCount,
+		CloseReasons:       closeReasons,
+	}
+}
+
+// GetTunnelStats 获取正在中继的隧道及其实时字节数
+func (s *tunnelRelayServer) GetTunnelStats() []*TunnelRelayStats {
+	stats := make([]*TunnelRelayStats, 0)
+	s.activeRelays.Range(func(key, value interface{}) bool {
+		relay := value.(*activeRelay)
+		stats = append(stats, &TunnelRelayStats{
+			TunnelID:          relay.tunnelID,
+			Service:           relay.service,
+			Client:            relay.client,
+			StartedAt:         relay.startedAt,
+			BytesIHToAH:       relay.bytesIHToAH.Load(),
+			BytesAHToIH:       relay.bytesAHToIH.Load(),
+			ClientConnectedAt: relay.connectedAt,
+			TTFBSeconds:       time.Duration(relay.ttfb.Load()).Seconds(),
+			Hop:               relay.hop,
+		})
+		return true
+	})
+	return stats
+}
+
+// CloseTunnel 断开正在中继的隧道，两端连接关闭后转发 goroutine 自行退出
+func (s *tunnelRelayServer) CloseTunnel(tunnelID string) bool {
+	return s.CloseTunnelWithReason(tunnelID, string(CloseReasonTerminated))
+}
+
+// CloseTunnelWithReason 断开正在中继的隧道，请求了关闭通知的一端先收到 reason
+// 握手帧中的隧道 ID 可能以 \x00 填充，按去除填充后的 ID 匹配
+func (s *tunnelRelayServer) CloseTunnelWithReason(tunnelID, reason string) bool {
+	closed := false
+	s.activeRelays.Range(func(key, value interface{}) bool {
+		if strings.TrimRight(key.(string), "\x00") != tunnelID {
+			return true
+		}
+		value.(*activeRelay).close(reason)
+		closed = true
+		return false
+	})
+	if closed {
+		s.logger.Info("Relay tunnel closed", "tunnel_id", tunnelID, "reason", reason)
+	}
+	return closed
+}
+
+// close 通知两端关闭原因后断开连接，统计按先给出的原因计入
+func (r *activeRelay) close(reason string) {
+	closeReason := closeReasonOf(reason)
+	r.reason.CompareAndSwap(nil, &closeReason)
+	for _, conn := range []net.Conn{r.ihConn, r.ahConn} {
+		if conn == nil {
+			continue
+		}
+		notifyClose(conn, reason)
+		conn.Close()
 	}
 }
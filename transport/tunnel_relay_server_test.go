@@ -1,17 +1,25 @@
 package transport
 
 import (
+	"bytes"
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/binary"
 	"io"
 	"log/slog"
 	"net"
 	"os"
+	"runtime"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/houzhh15/sdp-common/clock"
+	"github.com/houzhh15/sdp-common/leaktest"
+	"github.com/houzhh15/sdp-common/qos"
+	"github.com/houzhh15/sdp-common/tunnel"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 ) // mockConn implements net.Conn for testing
@@ -131,6 +139,7 @@ func TestHandleConnection_TunnelIDValidation(t *testing.T) {
 	server := &tunnelRelayServer{
 		logger:         logger,
 		pairingTimeout: 5 * time.Second,
+		clock:          clock.Real(),
 		bufferSize:     32 * 1024,
 		pendingIH:      sync.Map{},
 		pendingAH:      sync.Map{},
@@ -163,6 +172,7 @@ func TestPairing_Success_IHFirst(t *testing.T) {
 	server := &tunnelRelayServer{
 		logger:         logger,
 		pairingTimeout: 5 * time.Second,
+		clock:          clock.Real(),
 		bufferSize:     32 * 1024,
 		pendingIH:      sync.Map{},
 		pendingAH:      sync.Map{},
@@ -213,6 +223,7 @@ func TestPairing_Success_AHFirst(t *testing.T) {
 	server := &tunnelRelayServer{
 		logger:         logger,
 		pairingTimeout: 5 * time.Second,
+		clock:          clock.Real(),
 		bufferSize:     32 * 1024,
 		pendingIH:      sync.Map{},
 		pendingAH:      sync.Map{},
@@ -262,9 +273,11 @@ func TestPairing_Timeout(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo}))
 
 	shortTimeout := 2 * time.Second
+	clk := clock.NewFake(time.Now())
 	server := &tunnelRelayServer{
 		logger:         logger,
 		pairingTimeout: shortTimeout,
+		clock:          clk,
 		bufferSize:     32 * 1024,
 		pendingIH:      sync.Map{},
 		pendingAH:      sync.Map{},
@@ -272,32 +285,71 @@ func TestPairing_Timeout(t *testing.T) {
 		stopChan:       make(chan struct{}),
 	}
 
-	go server.cleanupExpiredConnections()
-
-	tunnelID := "test-tunnel-003-timeout-no-match--"
+	tunnelID := "test-tunnel-003-timeout-no-match----"
 	require.Equal(t, 36, len(tunnelID))
 
-	ihData := []byte("hello from IH")
-	ihConn := newMockTLSConn(append([]byte(tunnelID), ihData...), "ih-client-003")
+	ihConn := newMockTLSConn([]byte("hello from IH"), "ih-client-003")
 
-	server.wg.Add(1)
+	done := make(chan error, 1)
 	go func() {
-		defer server.wg.Done()
-		server.handleConnection(ihConn)
+		done <- server.handleIHConnection(ihConn, tunnelID, ihConn.clientCN, time.Now(), nil)
 	}()
 
-	time.Sleep(100 * time.Millisecond)
+	// IH 进入等待队列并注册配对超时计时器
+	clk.BlockUntil(1)
 	_, ihExists := server.pendingIH.Load(tunnelID)
 	assert.True(t, ihExists, "IH should be in pendingIH initially")
 
-	time.Sleep(shortTimeout + 1*time.Second)
+	clk.Advance(shortTimeout - time.Millisecond)
+	select {
+	case err := <-done:
+		t.Fatalf("pairing ended before timeout: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	clk.Advance(time.Millisecond)
+	select {
+	case err := <-done:
+		assert.ErrorContains(t, err, "pairing timeout")
+	case <-time.After(2 * time.Second):
+		t.Fatal("pairing did not time out after advancing clock")
+	}
 
 	_, ihStillExists := server.pendingIH.Load(tunnelID)
 	assert.False(t, ihStillExists, "Expired IH should be cleaned up")
-	assert.True(t, ihConn.closed, "Expired IH should be closed")
+}
 
-	close(server.stopChan)
-	server.wg.Wait()
+// TestCleanupExpiredConnections_FakeClock tests the periodic sweep of stale pending connections
+func TestCleanupExpiredConnections_FakeClock(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	server := &tunnelRelayServer{
+		logger:         &noopLogger{},
+		pairingTimeout: 30 * time.Second,
+		clock:          clk,
+		stopChan:       make(chan struct{}),
+	}
+
+	stale := newMockConn(nil)
+	server.pendingAH.Store("stale", &PendingConnection{Conn: stale, TunnelID: "stale", ClientType: "ah", ReceivedAt: clk.Now()})
+
+	go server.cleanupExpiredConnections()
+	defer close(server.stopChan)
+	clk.BlockUntil(1)
+
+	fresh := newMockConn(nil)
+	clk.Advance(30 * time.Second)
+	server.pendingIH.Store("fresh", &PendingConnection{Conn: fresh, TunnelID: "fresh", ClientType: "ih", ReceivedAt: clk.Now()})
+	clk.Advance(30 * time.Second)
+
+	require.Eventually(t, func() bool {
+		_, ok := server.pendingAH.Load("stale")
+		return !ok
+	}, 2*time.Second, 10*time.Millisecond, "stale AH should be cleaned up")
+	_, ok := server.pendingIH.Load("fresh")
+	assert.True(t, ok, "fresh IH should be kept")
+	stale.mu.Lock()
+	assert.True(t, stale.closed)
+	stale.mu.Unlock()
 }
 
 // TestGetStats tests statistics retrieval
@@ -306,6 +358,7 @@ func TestGetStats(t *testing.T) {
 	server := &tunnelRelayServer{
 		logger:         logger,
 		pairingTimeout: 5 * time.Second,
+		clock:          clock.Real(),
 		bufferSize:     32 * 1024,
 		pendingIH:      sync.Map{},
 		pendingAH:      sync.Map{},
@@ -333,12 +386,283 @@ func TestGetStats(t *testing.T) {
 	assert.Equal(t, 3, stats.ErrorCount)
 }
 
+// TestGetTunnelStats tests per-tunnel live byte counts
+func TestGetTunnelStats(t *testing.T) {
+	server := &tunnelRelayServer{}
+	assert.Empty(t, server.GetTunnelStats())
+
+	relay := &activeRelay{tunnelID: "tunnel-001", client: "10.0.0.1:5000", startedAt: time.Now()}
+	server.activeRelays.Store(relay.tunnelID, relay)
+
+	var buf bytes.Buffer
+	w := &countingWriter{w: &buf, counter: &relay.bytesIHToAH}
+	_, err := w.Write([]byte("hello"))
+	require.NoError(t, err)
+	relay.bytesAHToIH.Add(7)
+
+	stats := server.GetTunnelStats()
+	require.Len(t, stats, 1)
+	assert.Equal(t, "tunnel-001", stats[0].TunnelID)
+	assert.Equal(t, uint64(5), stats[0].BytesIHToAH)
+	assert.Equal(t, uint64(7), stats[0].BytesAHToIH)
+}
+
+// TestCloseTunnel tests closing a relayed tunnel by its unpadded ID
+func TestCloseTunnel(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	server := &tunnelRelayServer{logger: logger}
+
+	ih, ihPeer := net.Pipe()
+	ah, ahPeer := net.Pipe()
+	defer ihPeer.Close()
+	defer ahPeer.Close()
+
+	padded := make([]byte, tunnelIDLength)
+	copy(padded, "tunnel-001")
+	server.activeRelays.Store(string(padded), &activeRelay{tunnelID: string(padded), ihConn: ih, ahConn: ah})
+
+	assert.False(t, server.CloseTunnel("tunnel-002"))
+	assert.True(t, server.CloseTunnel("tunnel-001"))
+
+	_, err := ih.Write([]byte("x"))
+	assert.ErrorIs(t, err, io.ErrClosedPipe)
+	_, err = ah.Write([]byte("x"))
+	assert.ErrorIs(t, err, io.ErrClosedPipe)
+}
+
+// TestRelayIH tests pairing an in-process IH connection with a TLS-connected AH
+func TestRelayIH(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	paired := make(chan string, 1)
+	server := NewTunnelRelayServer(logger, &TunnelRelayConfig{
+		PairingTimeout: 2 * time.Second,
+		MaxConnections: 10,
+		OnPaired:       func(tunnelID string) { paired <- tunnelID },
+	}).(*tunnelRelayServer)
+
+	user, ih := net.Pipe()
+	ah, agent := net.Pipe()
+
+	padded := make([]byte, tunnelIDLength)
+	copy(padded, "tunnel-001")
+	go server.handleAHConnection(ah, string(padded), "ah-agent")
+
+	relayed := make(chan error, 1)
+	go func() {
+		relayed <- server.RelayIH(ih, "tunnel-001", "gateway:alice", time.Now())
+	}()
+
+	go user.Write([]byte("ping"))
+	buf := make([]byte, 4)
+	_, err := io.ReadFull(agent, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "ping", string(buf))
+	// 配对确认携带去除填充的隧道 ID
+	assert.Equal(t, "tunnel-001", <-paired)
+
+	go agent.Write([]byte("pong"))
+	_, err = io.ReadFull(user, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "pong", string(buf))
+
+	user.Close()
+	select {
+	case <-relayed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("RelayIH did not return after the user closed the connection")
+	}
+	agent.Close()
+
+	// 排空后不再接入
+	require.NoError(t, server.Drain(context.Background()))
+	rejected, peer := net.Pipe()
+	defer peer.Close()
+	assert.Error(t, server.RelayIH(rejected, "tunnel-002", "gateway:alice", time.Time{}))
+	assert.Error(t, server.RelayIH(rejected, "", "gateway:alice", time.Time{}))
+	require.NoError(t, server.Stop())
+}
+
+func TestRelayQoSMarking(t *testing.T) {
+	var resolved []string
+	server := NewTunnelRelayServer(nil, &TunnelRelayConfig{
+		QoSResolver: func(tunnelID string) string {
+			resolved = append(resolved, tunnelID)
+			return qos.ClassRealtime
+		},
+	}).(*tunnelRelayServer)
+	defer server.Stop()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		if conn, err := ln.Accept(); err == nil {
+			defer conn.Close()
+			conn.Read(make([]byte, 1))
+		}
+	}()
+	tcp, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer tcp.Close()
+
+	// 中继侧的连接包装（PROXY protocol、关闭通知）可解包到底层 TCP 连接
+	wrapped := &noticeConn{Conn: &proxyProtocolConn{Conn: tcp}}
+	if runtime.GOOS == "linux" {
+		assert.NoError(t, qos.Mark(wrapped, 46))
+	}
+
+	padded := make([]byte, tunnelIDLength)
+	copy(padded, "tunnel-001")
+	pipe, peer := net.Pipe()
+	defer pipe.Close()
+	defer peer.Close()
+	server.markQoS(string(padded), wrapped, pipe)
+	assert.Equal(t, []string{"tunnel-001"}, resolved)
+}
+
+// TestReadTunnelHandshake tests plain and timed handshake frames
+func TestReadTunnelHandshake(t *testing.T) {
+	plain := make([]byte, tunnelIDLength)
+	copy(plain, "tunnel-001")
+
+	hs, err := readTunnelHandshake(bytes.NewReader(append(plain, "payload"...)))
+	require.NoError(t, err)
+	assert.Equal(t, string(plain), hs.tunnelID)
+	assert.True(t, hs.connectedAt.IsZero())
+	assert.False(t, hs.closeNotice)
+	assert.Nil(t, hs.chain)
+
+	// 带时间戳的帧解析出与普通帧相同的配对键，后续数据保持不变
+	sent := time.Unix(0, 1700000000123456789)
+	frame := make([]byte, tunnelIDLength+timedHandshakeExtra)
+	frame[0] = timedHandshakeMagic
+	frame[1] = 0x01
+	binary.BigEndian.PutUint64(frame[2:10], uint64(sent.UnixNano()))
+	copy(frame[10:], "tunnel-001")
+
+	r := bytes.NewReader(append(frame, "payload"...))
+	hs, err = readTunnelHandshake(r)
+	require.NoError(t, err)
+	assert.Equal(t, string(plain), hs.tunnelID)
+	assert.True(t, sent.Equal(hs.connectedAt))
+	assert.False(t, hs.closeNotice)
+	rest, _ := io.ReadAll(r)
+	assert.Equal(t, "payload", string(rest))
+
+	// 关闭通知帧：版本 0x02，连接时间为 0 表示未携带
+	frame[1] = closeNoticeVersion
+	binary.BigEndian.PutUint64(frame[2:10], 0)
+	hs, err = readTunnelHandshake(bytes.NewReader(frame))
+	require.NoError(t, err)
+	assert.Equal(t, string(plain), hs.tunnelID)
+	assert.True(t, hs.connectedAt.IsZero())
+	assert.True(t, hs.closeNotice)
+
+	_, err = readTunnelHandshake(bytes.NewReader(frame[:40]))
+	assert.Error(t, err)
+}
+
+// TestCloseTunnelWithReason tests that clients which requested close notices receive the reason after pending data
+func TestCloseTunnelWithReason(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	server := &tunnelRelayServer{logger: logger}
+
+	ih, ihPeer := net.Pipe()
+	ah, ahPeer := net.Pipe()
+	defer ihPeer.Close()
+	defer ahPeer.Close()
+
+	notice := &noticeConn{Conn: ih}
+	server.activeRelays.Store("tunnel-001", &activeRelay{tunnelID: "tunnel-001", ihConn: notice, ahConn: ah})
+
+	go func() {
+		notice.Write([]byte("hello"))
+		server.CloseTunnelWithReason("tunnel-001", tunnel.RelayClosePolicyRevoked)
+	}()
+
+	client := tunnel.NewCloseNoticeConn(ihPeer)
+	data, err := io.ReadAll(client)
+	assert.Equal(t, "hello", string(data))
+	assert.Equal(t, tunnel.RelayClosePolicyRevoked, tunnel.RelayCloseReason(err))
+	assert.Equal(t, tunnel.RelayClosePolicyRevoked, client.CloseReason())
+
+	// CLOSE 帧之后不再写出数据，普通连接直接断开
+	_, err = notice.Write([]byte("late"))
+	assert.ErrorIs(t, err, io.ErrClosedPipe)
+	_, err = ah.Write([]byte("x"))
+	assert.ErrorIs(t, err, io.ErrClosedPipe)
+}
+
+// TestNoticeConn_PeerClosed tests that a peer_closed notice ends the stream with io.EOF
+func TestNoticeConn_PeerClosed(t *testing.T) {
+	relaySide, clientSide := net.Pipe()
+	defer clientSide.Close()
+
+	notice := &noticeConn{Conn: relaySide}
+	go func() {
+		notice.Write([]byte("bye"))
+		notifyClose(notice, string(CloseReasonPeerClosed))
+		notice.Close()
+	}()
+
+	client := tunnel.NewCloseNoticeConn(clientSide)
+	data, err := io.ReadAll(client)
+	require.NoError(t, err)
+	assert.Equal(t, "bye", string(data))
+	assert.Equal(t, tunnel.RelayClosePeerClosed, client.CloseReason())
+}
+
+// TestRelayTTFB tests first-byte recording and per-tunnel TTFB stats
+func TestRelayTTFB(t *testing.T) {
+	server := &tunnelRelayServer{
+		serviceResolver: func(tunnelID string) string {
+			if tunnelID == "tunnel-001" {
+				return "svc-web"
+			}
+			return ""
+		},
+	}
+
+	padded := make([]byte, tunnelIDLength)
+	copy(padded, "tunnel-001")
+	assert.Equal(t, "svc-web", server.resolveService(string(padded)))
+	assert.Equal(t, "unknown", server.resolveService("tunnel-002"))
+
+	relay := &activeRelay{
+		tunnelID:    "tunnel-001",
+		service:     "svc-web",
+		startedAt:   time.Now(),
+		connectedAt: time.Now().Add(-50 * time.Millisecond),
+	}
+	server.activeRelays.Store(relay.tunnelID, relay)
+
+	var buf bytes.Buffer
+	w := &countingWriter{w: &buf, counter: &relay.bytesAHToIH, onFirstWrite: relay.recordFirstByte}
+	_, err := w.Write([]byte("HTTP/1.1 200 OK"))
+	require.NoError(t, err)
+	first := relay.ttfb.Load()
+	_, err = w.Write([]byte("more"))
+	require.NoError(t, err)
+	assert.Equal(t, first, relay.ttfb.Load(), "only the first write sets TTFB")
+
+	stats := server.GetTunnelStats()
+	require.Len(t, stats, 1)
+	assert.Equal(t, "svc-web", stats[0].Service)
+	assert.GreaterOrEqual(t, stats[0].TTFBSeconds, 0.05)
+
+	// 时钟偏差导致的负值不记录
+	skewed := &activeRelay{connectedAt: time.Now().Add(time.Hour)}
+	skewed.recordFirstByte()
+	assert.Zero(t, skewed.ttfb.Load())
+}
+
 // TestStop_GracefulShutdown tests graceful server shutdown
 func TestStop_GracefulShutdown(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
 	server := &tunnelRelayServer{
 		logger:         logger,
 		pairingTimeout: 5 * time.Second,
+		clock:          clock.Real(),
 		bufferSize:     32 * 1024,
 		pendingIH:      sync.Map{},
 		pendingAH:      sync.Map{},
@@ -375,3 +699,124 @@ func TestStop_GracefulShutdown(t *testing.T) {
 	err = server.Stop()
 	assert.NoError(t, err, "Second Stop should not error")
 }
+
+// TestDrain tests that draining closes pending connections and force-closes relays at the deadline
+func TestDrain(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	server := &tunnelRelayServer{
+		logger:   logger,
+		clock:    clock.Real(),
+		stopChan: make(chan struct{}),
+	}
+
+	pending := newMockConn([]byte{})
+	server.pendingIH.Store("tunnel-001", &PendingConnection{Conn: pending, TunnelID: "tunnel-001", ReceivedAt: time.Now()})
+
+	// 无活跃隧道时立即完成
+	require.NoError(t, server.Drain(context.Background()))
+	assert.True(t, pending.closed)
+	assert.True(t, server.draining.Load())
+
+	// 活跃隧道在截止时间后被强制断开
+	ih, ihPeer := net.Pipe()
+	ah, ahPeer := net.Pipe()
+	defer ihPeer.Close()
+	defer ahPeer.Close()
+	server.activeRelays.Store("tunnel-002", &activeRelay{tunnelID: "tunnel-002", ihConn: ih, ahConn: ah})
+	server.wg.Add(1)
+	go func() {
+		defer server.wg.Done()
+		io.Copy(io.Discard, ih)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, server.Drain(ctx), context.DeadlineExceeded)
+	_, err := ah.Write([]byte("x"))
+	assert.ErrorIs(t, err, io.ErrClosedPipe)
+}
+
+// TestServe_DrainStopsAccepting tests that Serve returns once the listener is drained
+func TestServe_DrainStopsAccepting(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	server := NewTunnelRelayServer(logger, nil).(*tunnelRelayServer)
+	defer server.Stop()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	done := make(chan error, 1)
+	go func() { done <- server.Serve(ln, &tls.Config{}) }()
+	require.Eventually(t, func() bool { return server.Listener() != nil }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, ln.Addr(), server.Listener().Addr())
+
+	require.NoError(t, server.Drain(context.Background()))
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Serve did not return after Drain")
+	}
+}
+
+// TestServe_ReadyAndAddr tests readiness signalling and bound address reporting
+func TestServe_ReadyAndAddr(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	server := NewTunnelRelayServer(logger, nil)
+	defer server.Stop()
+
+	select {
+	case <-server.Ready():
+		t.Fatal("relay reported ready before Serve")
+	default:
+	}
+	assert.Nil(t, server.Addr())
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go server.Serve(ln, &tls.Config{})
+
+	select {
+	case <-server.Ready():
+	case <-time.After(time.Second):
+		t.Fatal("relay did not become ready")
+	}
+	require.NotNil(t, server.Addr())
+	assert.Equal(t, ln.Addr().String(), server.Addr().String())
+
+	// 排空后不再报告地址
+	require.NoError(t, server.Drain(context.Background()))
+	assert.Nil(t, server.Addr())
+}
+
+// TestTunnelRelayServer_StopNoLeak tests that Stop ends the cleanup loop, pending and paired connections
+func TestTunnelRelayServer_StopNoLeak(t *testing.T) {
+	leaktest.Check(t)
+
+	pki := newChainTestPKI(t)
+	server, addr := startChainRelay(t, pki, &TunnelRelayConfig{})
+
+	paired := []byte("test-tunnel-leak-paired-000000000000")
+	pending := []byte("test-tunnel-leak-pending-00000000000")
+	require.Len(t, paired, tunnelIDLength)
+	require.Len(t, pending, tunnelIDLength)
+
+	ih := dialChainRelay(t, pki, addr, pki.issue(t, "ih-client-001", ""), paired)
+	ah := dialChainRelay(t, pki, addr, pki.issue(t, "ah-agent-001", ""), paired)
+	dialChainRelay(t, pki, addr, pki.issue(t, "ih-client-002", ""), pending)
+
+	_, err := ih.Write([]byte("ping"))
+	require.NoError(t, err)
+	buf := make([]byte, 4)
+	_, err = io.ReadFull(ah, buf)
+	require.NoError(t, err)
+
+	stopped := make(chan error, 1)
+	go func() { stopped <- server.Stop() }()
+	select {
+	case err := <-stopped:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop did not return with active connections")
+	}
+}
@@ -0,0 +1,222 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"time"
+
+	"github.com/houzhh15/sdp-common/clock"
+	"github.com/houzhh15/sdp-common/logging"
+)
+
+// 连接关闭原因（ConnectionEvent.Details["close_reason"]）
+const (
+	CloseReasonPeerClosed   = "peer_closed"   // 数据平面（IH 侧）先关闭
+	CloseReasonTargetClosed = "target_closed" // 目标服务先关闭
+	CloseReasonCancelled    = "cancelled"     // 隧道被删除或 Agent 退出
+	CloseReasonError        = "error"         // 转发出错
+	CloseReasonBlocked      = "blocked"       // 被 L7 检查插件拒绝
+	CloseReasonRelayClosed  = "relay_closed"  // 中继主动断开隧道（原因见 Details["relay_reason"]）
+)
+
+// AccessLogConfig AH 侧连接访问日志配置
+type AccessLogConfig struct {
+	// Audit 连接事件写入目标：审计子系统，或本地文件（logging.NewFileAuditLogger）
+	Audit  logging.AuditLogger
+	Logger logging.Logger
+	Clock  clock.Clock // 连接时长计时，默认真实时钟
+	// Inspectors 转发路径上的 L7 检查插件，按顺序检查 IH→目标方向的数据，任一拒绝即关闭连接
+	Inspectors []Inspector
+}
+
+// ConnAccess 一条被转发连接的标识
+type ConnAccess struct {
+	TunnelID   string
+	ClientID   string
+	ServiceID  string
+	Target     string // 目标服务地址 host:port
+	IHEndpoint string // IH 源地址（Controller 记录时）
+	StreamID   uint32 // 多路复用流 ID，非多路复用为 0
+}
+
+// AccessLogger AH 侧按服务的连接访问日志
+// Forward 转发一条连接，建立时写入 action=open，结束时写入 action=close
+// （时长、双向字节数、关闭原因），用于追溯哪些隧道访问了哪些后端
+type AccessLogger struct {
+	audit      logging.AuditLogger
+	logger     logging.Logger
+	clock      clock.Clock
+	inspectors []Inspector
+}
+
+// NewAccessLogger 创建连接访问日志记录器
+func NewAccessLogger(config *AccessLogConfig) *AccessLogger {
+	if config == nil {
+		config = &AccessLogConfig{}
+	}
+	logger := config.Logger
+	if logger == nil {
+		logger = &noopLogger{}
+	}
+
+	return &AccessLogger{
+		audit:      config.Audit,
+		logger:     logger,
+		clock:      clock.Or(config.Clock),
+		inspectors: config.Inspectors,
+	}
+}
+
+// copyResult 单方向转发结果
+type copyResult struct {
+	toTarget bool
+	n        int64
+	err      error
+}
+
+// Forward 在数据平面连接 peer 与目标连接 target 之间双向转发，
+// 任一方向结束或 ctx 取消后关闭两端，返回写入的 close 事件
+// BytesSent 为发往目标服务的字节数，BytesRecv 为从目标服务收到的字节数
+func (l *AccessLogger) Forward(ctx context.Context, info *ConnAccess, peer, target io.ReadWriteCloser) *logging.ConnectionEvent {
+	startedAt := l.clock.Now()
+	l.write(ctx, l.event(info, "open", startedAt))
+
+	if len(l.inspectors) > 0 {
+		peer = newInspectedReader(peer, info, l.inspectors)
+	}
+
+	// 两端均为明文 TCP 时由内核搬运（见 copyConn），否则使用池化缓冲
+	results := make(chan copyResult, 2)
+	go func() {
+		n, err := copyConn(target, peer)
+		results <- copyResult{toTarget: true, n: n, err: err}
+	}()
+	go func() {
+		n, err := copyConn(peer, target)
+		results <- copyResult{toTarget: false, n: n, err: err}
+	}()
+
+	var first copyResult
+	received := 0
+	reason := CloseReasonCancelled
+	select {
+	case first = <-results:
+		received = 1
+		reason = closeReason(first)
+	case <-ctx.Done():
+	}
+
+	// 关闭两端以结束另一方向的转发，再收集最终字节数
+	peer.Close()
+	target.Close()
+
+	var sent, recv int64
+	tally := func(r copyResult) {
+		if r.toTarget {
+			sent = r.n
+		} else {
+			recv = r.n
+		}
+	}
+	if received == 1 {
+		tally(first)
+	}
+	for ; received < 2; received++ {
+		tally(<-results)
+	}
+
+	event := l.event(info, "close", l.clock.Now())
+	event.Duration = l.clock.Since(startedAt)
+	event.BytesSent = sent
+	event.BytesRecv = recv
+	event.Details["close_reason"] = reason
+	switch reason {
+	case CloseReasonError:
+		event.Details["error"] = first.err.Error()
+	case CloseReasonRelayClosed:
+		event.Details["relay_reason"] = RelayCloseReason(first.err)
+		l.logger.Warn("Connection closed by relay",
+			"tunnel_id", info.TunnelID,
+			"service_id", info.ServiceID,
+			"reason", event.Details["relay_reason"])
+	case CloseReasonBlocked:
+		blocked := blockedBy(first.err)
+		event.Details["inspector"] = blocked.Inspector
+		event.Details["block_reason"] = blocked.Reason
+		l.logger.Warn("Connection blocked by inspector",
+			"tunnel_id", info.TunnelID,
+			"service_id", info.ServiceID,
+			"inspector", blocked.Inspector,
+			"reason", blocked.Reason)
+	}
+	// ctx 可能已取消，close 事件不随之丢弃
+	l.write(context.WithoutCancel(ctx), event)
+
+	return event
+}
+
+// closeReason 根据先结束的方向判断关闭原因
+func closeReason(r copyResult) string {
+	if blockedBy(r.err) != nil {
+		return CloseReasonBlocked
+	}
+	if RelayCloseReason(r.err) != "" {
+		return CloseReasonRelayClosed
+	}
+	if r.err != nil && !errors.Is(r.err, io.EOF) && !errors.Is(r.err, io.ErrClosedPipe) && !errors.Is(r.err, net.ErrClosed) {
+		return CloseReasonError
+	}
+	if r.toTarget {
+		return CloseReasonPeerClosed
+	}
+	return CloseReasonTargetClosed
+}
+
+// event 构造连接事件
+func (l *AccessLogger) event(info *ConnAccess, action string, at time.Time) *logging.ConnectionEvent {
+	details := map[string]interface{}{
+		"target": info.Target,
+	}
+	if info.StreamID != 0 {
+		details["stream_id"] = info.StreamID
+	}
+
+	return &logging.ConnectionEvent{
+		Timestamp:  at,
+		TunnelID:   info.TunnelID,
+		ClientID:   info.ClientID,
+		ServiceID:  info.ServiceID,
+		IHEndpoint: info.IHEndpoint,
+		AHEndpoint: info.Target,
+		Action:     action,
+		Details:    details,
+	}
+}
+
+// write 写入日志与审计（未配置审计时仅写日志）
+func (l *AccessLogger) write(ctx context.Context, event *logging.ConnectionEvent) {
+	if event.Action == "close" {
+		l.logger.Info("Connection closed",
+			"tunnel_id", event.TunnelID,
+			"service_id", event.ServiceID,
+			"target", event.AHEndpoint,
+			"duration", event.Duration,
+			"bytes_sent", event.BytesSent,
+			"bytes_recv", event.BytesRecv,
+			"close_reason", event.Details["close_reason"])
+	} else {
+		l.logger.Debug("Connection opened",
+			"tunnel_id", event.TunnelID,
+			"service_id", event.ServiceID,
+			"target", event.AHEndpoint)
+	}
+
+	if l.audit == nil {
+		return
+	}
+	if err := l.audit.LogConnection(ctx, event); err != nil {
+		l.logger.Warn("Failed to write connection event", "tunnel_id", event.TunnelID, "error", err)
+	}
+}
@@ -0,0 +1,110 @@
+package tunnel
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/houzhh15/sdp-common/logging"
+)
+
+// connAudit 记录连接事件的审计日志
+type connAudit struct {
+	mu     sync.Mutex
+	events []*logging.ConnectionEvent
+}
+
+func (a *connAudit) LogAccess(ctx context.Context, event *logging.AccessEvent) error {
+	return nil
+}
+
+func (a *connAudit) LogConnection(ctx context.Context, event *logging.ConnectionEvent) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.events = append(a.events, event)
+	return nil
+}
+
+func (a *connAudit) LogSecurity(ctx context.Context, event *logging.SecurityEvent) error {
+	return nil
+}
+
+func (a *connAudit) Query(ctx context.Context, filter *logging.AuditFilter) ([]*logging.AuditLog, error) {
+	return nil, nil
+}
+
+func TestAccessLogger_Forward(t *testing.T) {
+	audit := &connAudit{}
+	logger := NewAccessLogger(&AccessLogConfig{Audit: audit})
+	info := &ConnAccess{TunnelID: "tun-1", ClientID: "ih-1", ServiceID: "svc-1", Target: "10.0.0.1:80", StreamID: 3}
+
+	peer, peerRemote := net.Pipe()
+	target, targetRemote := net.Pipe()
+
+	done := make(chan *logging.ConnectionEvent, 1)
+	go func() {
+		done <- logger.Forward(context.Background(), info, peer, target)
+	}()
+
+	// IH 发送请求，目标服务回复后关闭
+	go func() {
+		peerRemote.Write([]byte("request"))
+		io.Copy(io.Discard, peerRemote)
+	}()
+	buf := make([]byte, 7)
+	if _, err := io.ReadFull(targetRemote, buf); err != nil {
+		t.Fatalf("read request: %v", err)
+	}
+	targetRemote.Write([]byte("response!"))
+	targetRemote.Close()
+
+	var event *logging.ConnectionEvent
+	select {
+	case event = <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Forward did not return")
+	}
+
+	if event.BytesSent != 7 || event.BytesRecv != 9 {
+		t.Errorf("bytes sent/recv = %d/%d, want 7/9", event.BytesSent, event.BytesRecv)
+	}
+	if event.Details["close_reason"] != CloseReasonTargetClosed {
+		t.Errorf("close_reason = %v, want %s", event.Details["close_reason"], CloseReasonTargetClosed)
+	}
+	if event.AHEndpoint != "10.0.0.1:80" || event.Details["stream_id"] != uint32(3) {
+		t.Errorf("unexpected event: %+v", event)
+	}
+
+	audit.mu.Lock()
+	defer audit.mu.Unlock()
+	if len(audit.events) != 2 || audit.events[0].Action != "open" || audit.events[1].Action != "close" {
+		t.Fatalf("expected open and close events, got %+v", audit.events)
+	}
+}
+
+func TestAccessLogger_ForwardCancelled(t *testing.T) {
+	logger := NewAccessLogger(nil)
+	peer, peerRemote := net.Pipe()
+	target, targetRemote := net.Pipe()
+	defer peerRemote.Close()
+	defer targetRemote.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan *logging.ConnectionEvent, 1)
+	go func() {
+		done <- logger.Forward(ctx, &ConnAccess{TunnelID: "tun-1"}, peer, target)
+	}()
+	cancel()
+
+	select {
+	case event := <-done:
+		if event.Details["close_reason"] != CloseReasonCancelled {
+			t.Errorf("close_reason = %v, want %s", event.Details["close_reason"], CloseReasonCancelled)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Forward did not return after cancel")
+	}
+}
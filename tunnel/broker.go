@@ -6,6 +6,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/houzhh15/sdp-common/clock"
 	"github.com/houzhh15/sdp-common/logging"
 )
 
@@ -22,6 +23,7 @@ type Broker struct {
 	logger       logging.Logger
 	heartbeatInt time.Duration
 	heartbeatTO  time.Duration
+	clock        clock.Clock
 	stopChan     chan struct{}
 	wg           sync.WaitGroup
 }
@@ -42,6 +44,7 @@ type BrokerConfig struct {
 	Logger            logging.Logger
 	HeartbeatInterval time.Duration
 	HeartbeatTimeout  time.Duration
+	Clock             clock.Clock // 心跳计时时钟，默认真实时钟
 }
 
 // NewBroker creates a new tunnel broker
@@ -61,6 +64,7 @@ func NewBroker(config *BrokerConfig) *Broker {
 		logger:       config.Logger,
 		heartbeatInt: config.HeartbeatInterval,
 		heartbeatTO:  config.HeartbeatTimeout,
+		clock:        clock.Or(config.Clock),
 		stopChan:     make(chan struct{}),
 	}
 
@@ -85,7 +89,7 @@ func (b *Broker) RegisterStream(sessionID string, stream Stream, isIH bool) erro
 				PacketsSent:   0,
 				PacketsRecv:   0,
 			},
-			lastHeartbeat: time.Now(),
+			lastHeartbeat: b.clock.Now(),
 			stopChan:      make(chan struct{}),
 		}
 		b.sessions[sessionID] = sess
@@ -102,7 +106,7 @@ func (b *Broker) RegisterStream(sessionID string, stream Stream, isIH bool) erro
 		b.logger.Info("AH stream registered", "session_id", sessionID)
 	}
 
-	sess.lastHeartbeat = time.Now()
+	sess.lastHeartbeat = b.clock.Now()
 
 	// If both streams are ready, start forwarding
 	if sess.ihStream != nil && sess.ahStream != nil {
@@ -124,6 +128,7 @@ func (b *Broker) forwardIHtoAH(sess *session) {
 	errChan := make(chan error, 1)
 
 	// Start receive goroutine
+	// Recv 返回前无法中断，调用方关闭流后退出；转发结束后不再阻塞在 recvChan 上
 	go func() {
 		for {
 			packet, err := sess.ihStream.Recv()
@@ -131,7 +136,13 @@ func (b *Broker) forwardIHtoAH(sess *session) {
 				errChan <- err
 				return
 			}
-			recvChan <- packet
+			select {
+			case recvChan <- packet:
+			case <-sess.stopChan:
+				return
+			case <-b.stopChan:
+				return
+			}
 		}
 	}()
 
@@ -151,7 +162,7 @@ func (b *Broker) forwardIHtoAH(sess *session) {
 		case packet := <-recvChan:
 			// Update stats
 			sess.mu.Lock()
-			sess.lastHeartbeat = time.Now()
+			sess.lastHeartbeat = b.clock.Now()
 			sess.stats.BytesReceived += int64(len(packet.Payload))
 			sess.stats.PacketsRecv++
 			sess.mu.Unlock()
@@ -180,6 +191,7 @@ func (b *Broker) forwardAHtoIH(sess *session) {
 	errChan := make(chan error, 1)
 
 	// Start receive goroutine
+	// Recv 返回前无法中断，调用方关闭流后退出；转发结束后不再阻塞在 recvChan 上
 	go func() {
 		for {
 			packet, err := sess.ahStream.Recv()
@@ -187,7 +199,13 @@ func (b *Broker) forwardAHtoIH(sess *session) {
 				errChan <- err
 				return
 			}
-			recvChan <- packet
+			select {
+			case recvChan <- packet:
+			case <-sess.stopChan:
+				return
+			case <-b.stopChan:
+				return
+			}
 		}
 	}()
 
@@ -207,7 +225,7 @@ func (b *Broker) forwardAHtoIH(sess *session) {
 		case packet := <-recvChan:
 			// Update stats
 			sess.mu.Lock()
-			sess.lastHeartbeat = time.Now()
+			sess.lastHeartbeat = b.clock.Now()
 			sess.stats.BytesReceived += int64(len(packet.Payload))
 			sess.stats.PacketsRecv++
 			sess.mu.Unlock()
@@ -237,14 +255,14 @@ func (b *Broker) handleForwardError(sess *session, direction string) {
 func (b *Broker) heartbeatMonitor() {
 	defer b.wg.Done()
 
-	ticker := time.NewTicker(b.heartbeatInt)
+	ticker := b.clock.NewTicker(b.heartbeatInt)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-b.stopChan:
 			return
-		case <-ticker.C:
+		case <-ticker.C():
 			b.checkHeartbeats()
 		}
 	}
@@ -252,7 +270,7 @@ func (b *Broker) heartbeatMonitor() {
 
 // checkHeartbeats checks for timed-out sessions
 func (b *Broker) checkHeartbeats() {
-	now := time.Now()
+	now := b.clock.Now()
 	sessionsToClose := []string{}
 
 	b.sessionsMu.RLock()
@@ -314,9 +332,15 @@ func (b *Broker) GetStats(sessionID string) (*TunnelStats, error) {
 	return &stats, nil
 }
 
-// Close stops the broker
+// Close stops the broker and waits for its forwarding goroutines (idempotent).
+// Receive goroutines blocked in Stream.Recv exit once the caller closes the streams
 func (b *Broker) Close() error {
-	close(b.stopChan)
+	select {
+	case <-b.stopChan:
+		return nil
+	default:
+		close(b.stopChan)
+	}
 
 	// Close all sessions
 	b.sessionsMu.Lock()
@@ -5,6 +5,9 @@ import (
 	"io"
 	"testing"
 	"time"
+
+	"github.com/houzhh15/sdp-common/clock"
+	"github.com/houzhh15/sdp-common/leaktest"
 )
 
 // mockStream implements Stream interface for testing
@@ -305,10 +308,12 @@ func TestBrokerCloseSession(t *testing.T) {
 }
 
 func TestBrokerHeartbeatTimeout(t *testing.T) {
+	clk := clock.NewFake(time.Now())
 	config := &BrokerConfig{
 		Logger:            &mockLogger{},
 		HeartbeatInterval: 50 * time.Millisecond,
 		HeartbeatTimeout:  100 * time.Millisecond,
+		Clock:             clk,
 	}
 	broker := NewBroker(config)
 	defer broker.Close()
@@ -320,15 +325,30 @@ func TestBrokerHeartbeatTimeout(t *testing.T) {
 	broker.RegisterStream(sessionID, ihStream, true)
 	broker.RegisterStream(sessionID, ahStream, false)
 
+	sessionExists := func() bool {
+		broker.sessionsMu.RLock()
+		defer broker.sessionsMu.RUnlock()
+		_, exists := broker.sessions[sessionID]
+		return exists
+	}
+
+	// 心跳监控已注册 ticker；未超时前会话保留
+	clk.BlockUntil(1)
+	clk.Advance(100 * time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	if !sessionExists() {
+		t.Fatal("Session closed before heartbeat timeout")
+	}
+
 	// Don't send any packets (no heartbeat update)
-	time.Sleep(200 * time.Millisecond)
+	clk.Advance(50 * time.Millisecond)
 
 	// Verify session was closed due to timeout
-	broker.sessionsMu.RLock()
-	_, exists := broker.sessions[sessionID]
-	broker.sessionsMu.RUnlock()
-
-	if exists {
+	deadline := time.Now().Add(2 * time.Second)
+	for sessionExists() && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if sessionExists() {
 		t.Error("Expected session to be closed due to heartbeat timeout")
 	}
 }
@@ -418,3 +438,35 @@ func TestBrokerMultipleSessions(t *testing.T) {
 		t.Errorf("Expected 3 sessions, got %d", numSessions)
 	}
 }
+
+// TestBrokerCloseNoLeak 关闭 Broker 后心跳与转发 goroutine 退出，接收 goroutine 在流关闭后退出
+func TestBrokerCloseNoLeak(t *testing.T) {
+	leaktest.Check(t)
+
+	broker := NewBroker(&BrokerConfig{})
+	ihStream := newMockStream()
+	ahStream := newMockStream()
+	broker.RegisterStream("session-leak", ihStream, true)
+	broker.RegisterStream("session-leak", ahStream, false)
+
+	ihStream.recvChan <- &DataPacket{TunnelID: "session-leak", Payload: []byte("ping")}
+	select {
+	case <-ahStream.sendChan:
+	case <-time.After(time.Second):
+		t.Fatal("packet not forwarded")
+	}
+
+	if err := broker.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if err := broker.Close(); err != nil {
+		t.Fatalf("second Close failed: %v", err)
+	}
+
+	// 转发已停止时到达的数据不能让接收 goroutine 阻塞
+	for i := 0; i < 3; i++ {
+		ihStream.recvChan <- &DataPacket{TunnelID: "session-leak", Payload: []byte("late")}
+	}
+	close(ihStream.recvChan)
+	close(ahStream.recvChan)
+}
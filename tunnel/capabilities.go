@@ -0,0 +1,103 @@
+package tunnel
+
+import (
+	"slices"
+	"strings"
+)
+
+// Capability advertisement for mixed-version fleets: clients list the optional
+// features they implement in the handshake request and the SSE subscribe request
+// (CapabilitiesHeader), the Controller lists its own in the handshake response and
+// the SSE connected event. Each side degrades to the features both peers support
+const (
+	// CapabilityMux single-connection multiplexed data plane (MuxSession)
+	CapabilityMux = "mux"
+	// CapabilityE2E end-to-end encrypted tunnels (E2EKey key exchange)
+	CapabilityE2E = "e2e"
+	// CapabilityEventReplay Last-Event-ID replay of journaled events
+	CapabilityEventReplay = "event_replay"
+	// CapabilityRelayChain multi-hop tunnels across relays (DataPlaneClient.ConnectChain)
+	CapabilityRelayChain = "relay_chain"
+	// CapabilityObfuscate traffic obfuscation of the data plane (ObfuscatedConn):
+	// frames padded to bucket sizes and flushed after a random delay
+	CapabilityObfuscate = "obfuscate"
+	// CapabilityReverseForward reverse port forwarding: the AH listens and opens
+	// streams back to the IH (ssh -R semantics, see ForwardSpec)
+	CapabilityReverseForward = "reverse_forward"
+	// CapabilityWebSocketEvents event stream over WebSocket. Not implemented by this
+	// library; defined so peers that do can advertise it under a common name
+	CapabilityWebSocketEvents = "ws_events"
+
+	// CapabilitiesHeader request header carrying the subscriber's capabilities on
+	// the SSE subscribe request, comma separated
+	CapabilitiesHeader = "X-SDP-Capabilities"
+)
+
+// legacyCapabilities features implemented by every peer that predates capability
+// advertisement; a peer that advertises nothing is assumed to support these only
+var legacyCapabilities = map[string]bool{
+	CapabilityMux:         true,
+	CapabilityE2E:         true,
+	CapabilityEventReplay: true,
+}
+
+// Capabilities set of capability names advertised by a peer. nil means the peer
+// did not advertise (an older version, see Supports); an empty, non-nil set means
+// it advertised no optional features
+type Capabilities []string
+
+// DefaultCapabilities the capabilities implemented by this library version
+func DefaultCapabilities() Capabilities {
+	return Capabilities{CapabilityE2E, CapabilityEventReplay, CapabilityMux, CapabilityObfuscate, CapabilityRelayChain, CapabilityReverseForward}
+}
+
+// ParseCapabilities parses a comma separated list (CapabilitiesHeader). An empty
+// value returns nil: the peer did not advertise
+func ParseCapabilities(value string) Capabilities {
+	if strings.TrimSpace(value) == "" {
+		return nil
+	}
+	caps := Capabilities{}
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" && !caps.Has(name) {
+			caps = append(caps, name)
+		}
+	}
+	return caps
+}
+
+// Advertised reports whether the peer sent a capability list at all
+func (c Capabilities) Advertised() bool {
+	return c != nil
+}
+
+// Has reports whether name is in the advertised list
+func (c Capabilities) Has(name string) bool {
+	return slices.Contains(c, name)
+}
+
+// Supports reports whether the peer can be expected to handle name: the advertised
+// list when present, otherwise the features of peers predating advertisement
+func (c Capabilities) Supports(name string) bool {
+	if c == nil {
+		return legacyCapabilities[name]
+	}
+	return c.Has(name)
+}
+
+// Intersect the capabilities in both c and other, in the order of c; used to pick
+// the features a connection between the two peers may use
+func (c Capabilities) Intersect(other Capabilities) Capabilities {
+	out := Capabilities{}
+	for _, name := range c {
+		if other.Supports(name) {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+// String the comma separated form used by CapabilitiesHeader
+func (c Capabilities) String() string {
+	return strings.Join(c, ",")
+}
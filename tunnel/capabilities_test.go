@@ -0,0 +1,51 @@
+package tunnel
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseCapabilities(t *testing.T) {
+	if caps := ParseCapabilities(""); caps != nil {
+		t.Errorf("ParseCapabilities(\"\") = %v, want nil", caps)
+	}
+	caps := ParseCapabilities(" mux, e2e ,,mux")
+	if !slices.Equal(caps, Capabilities{"mux", "e2e"}) {
+		t.Errorf("ParseCapabilities = %v, want [mux e2e]", caps)
+	}
+	if got := caps.String(); got != "mux,e2e" {
+		t.Errorf("String() = %q, want mux,e2e", got)
+	}
+}
+
+func TestCapabilitiesSupports(t *testing.T) {
+	// 未通告能力的旧版本对端：只支持通告机制之前已有的特性
+	var legacy Capabilities
+	if legacy.Advertised() {
+		t.Error("nil capabilities reported as advertised")
+	}
+	if !legacy.Supports(CapabilityMux) || !legacy.Supports(CapabilityE2E) {
+		t.Error("legacy peer should support mux and e2e")
+	}
+	if legacy.Supports(CapabilityWebSocketEvents) {
+		t.Error("legacy peer should not support ws_events")
+	}
+
+	// 通告了能力的对端以列表为准
+	caps := Capabilities{CapabilityEventReplay}
+	if !caps.Advertised() || caps.Supports(CapabilityMux) || !caps.Supports(CapabilityEventReplay) {
+		t.Errorf("advertised capabilities %v not authoritative", caps)
+	}
+	if empty := (Capabilities{}); empty.Supports(CapabilityMux) {
+		t.Error("empty advertised list should support nothing")
+	}
+
+	got := DefaultCapabilities().Intersect(Capabilities{CapabilityMux, CapabilityWebSocketEvents})
+	if !slices.Equal(got, Capabilities{CapabilityMux}) {
+		t.Errorf("Intersect = %v, want [mux]", got)
+	}
+	got = Capabilities{CapabilityMux, CapabilityWebSocketEvents}.Intersect(nil)
+	if !slices.Equal(got, Capabilities{CapabilityMux}) {
+		t.Errorf("Intersect with legacy peer = %v, want [mux]", got)
+	}
+}
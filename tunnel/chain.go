@@ -0,0 +1,136 @@
+package tunnel
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+// 多跳隧道（中继链）：IH 位于外部网络、AH 位于内部网络时，数据须依次经过多个中继（如 DMZ → 内网）。
+// IH 连接链上第一跳并在握手中携带剩余路由，每个中继连接下一跳并转发剩余路由，
+// 最后一跳按隧道 ID 与 AH 配对；各跳分别统计字节数
+const (
+	// MetadataKeyRelayChain 隧道 Metadata 中的中继链：各跳数据平面地址，IH 连接第一跳，AH 连接最后一跳
+	MetadataKeyRelayChain = "relay_chain"
+
+	// ChainHandshakeVersion 多跳握手版本
+	// [0xFE][0x03][8 字节连接时间][36 字节 Tunnel ID][标志 1][跳序号 1][路由数 1]{[地址长度 1][地址]}[来源长度 1][来源]
+	ChainHandshakeVersion byte = 0x03
+
+	// ChainFlagCloseNotice 标志位：请求关闭通知（同握手版本 0x02）
+	ChainFlagCloseNotice byte = 0x01
+
+	// MaxRelayHops 中继链最多的跳数
+	MaxRelayHops = 8
+)
+
+// RelayChain 隧道经过的中继链，未启用多跳时为空
+func (t *Tunnel) RelayChain() []string {
+	if t == nil || t.Metadata == nil {
+		return nil
+	}
+	switch v := t.Metadata[MetadataKeyRelayChain].(type) {
+	case []string:
+		return v
+	case []interface{}: // 从存储或事件中解码
+		chain := make([]string, 0, len(v))
+		for _, hop := range v {
+			if addr, ok := hop.(string); ok {
+				chain = append(chain, addr)
+			}
+		}
+		return chain
+	}
+	return nil
+}
+
+// ValidateRelayChain 校验中继链：2 至 MaxRelayHops 个不重复的 host:port
+func ValidateRelayChain(chain []string) error {
+	if len(chain) == 0 {
+		return nil
+	}
+	if len(chain) < 2 || len(chain) > MaxRelayHops {
+		return fmt.Errorf("relay_chain must have 2 to %d hops, got %d", MaxRelayHops, len(chain))
+	}
+	seen := make(map[string]bool, len(chain))
+	for _, addr := range chain {
+		if len(addr) > 255 {
+			return fmt.Errorf("relay_chain address too long: %q", addr)
+		}
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return fmt.Errorf("invalid relay_chain address %q: %w", addr, err)
+		}
+		if seen[addr] {
+			return fmt.Errorf("relay_chain address %q appears more than once", addr)
+		}
+		seen[addr] = true
+	}
+	return nil
+}
+
+// ValidateRelayChain 校验服务的中继链
+func (c *ServiceConfig) ValidateRelayChain() error {
+	if err := ValidateRelayChain(c.RelayChain); err != nil {
+		return fmt.Errorf("service %s: %w", c.ServiceID, err)
+	}
+	return nil
+}
+
+// EncodeChainHandshake 编码 IH 发往第一跳的多跳握手帧，route 为第一跳之后的各跳地址
+// IH 发起时跳序号为 0、来源为空，由中继转发时填写
+func EncodeChainHandshake(tunnelID string, connectedAt time.Time, closeNotice bool, route []string) ([]byte, error) {
+	if len(route) == 0 || len(route) >= MaxRelayHops {
+		return nil, fmt.Errorf("chain route must have 1 to %d hops, got %d", MaxRelayHops-1, len(route))
+	}
+	var nanos int64
+	if !connectedAt.IsZero() {
+		nanos = connectedAt.UnixNano()
+	}
+	frame, err := encodeHandshakeFrame(ChainHandshakeVersion, tunnelID, nanos)
+	if err != nil {
+		return nil, err
+	}
+
+	var flags byte
+	if closeNotice {
+		flags |= ChainFlagCloseNotice
+	}
+	frame = append(frame, flags, 0, byte(len(route)))
+	for _, addr := range route {
+		if addr == "" || len(addr) > 255 {
+			return nil, fmt.Errorf("invalid chain hop address %q", addr)
+		}
+		frame = append(frame, byte(len(addr)))
+		frame = append(frame, addr...)
+	}
+	return append(frame, 0), nil
+}
+
+// ConnectChain 经中继链建立数据平面连接：连接 chain[0]，由中继逐跳转发到最后一跳后与 AH 配对
+// chain 通常取自 Tunnel.RelayChain 或创建隧道响应的 relay_chain；少于两跳时等同 Connect（一跳时连接该地址）
+// 开启 CloseNotice 时返回 *CloseNoticeConn（中间跳断开时原因来自第一跳）
+func (c *DataPlaneClient) ConnectChain(tunnelID string, chain []string) (net.Conn, error) {
+	if len(chain) < 2 {
+		if len(chain) == 1 {
+			c.SetServerAddr(chain[0])
+		}
+		return c.Connect(tunnelID)
+	}
+	frame, err := EncodeChainHandshake(tunnelID, time.Time{}, c.closeNotice, chain[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := c.dialAddr(chain[0])
+	if err != nil {
+		return nil, err
+	}
+	if err := writeHandshake(conn, frame); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to send tunnel ID: %w", err)
+	}
+	if c.closeNotice {
+		return NewCloseNoticeConn(conn), nil
+	}
+	return conn, nil
+}
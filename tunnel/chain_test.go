@@ -0,0 +1,80 @@
+package tunnel
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateRelayChain(t *testing.T) {
+	tests := []struct {
+		name    string
+		chain   []string
+		wantErr string
+	}{
+		{"empty", nil, ""},
+		{"two hops", []string{"dmz.example.com:9443", "10.0.0.1:9443"}, ""},
+		{"single hop", []string{"dmz.example.com:9443"}, "2 to 8 hops"},
+		{"too many hops", strings.Split("a:1,b:1,c:1,d:1,e:1,f:1,g:1,h:1,i:1", ","), "2 to 8 hops"},
+		{"missing port", []string{"dmz.example.com", "10.0.0.1:9443"}, "invalid relay_chain address"},
+		{"duplicate", []string{"10.0.0.1:9443", "10.0.0.1:9443"}, "more than once"},
+		{"too long", []string{strings.Repeat("a", 260) + ":1", "10.0.0.1:9443"}, "too long"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := (&ServiceConfig{ServiceID: "svc", RelayChain: tt.chain}).ValidateRelayChain()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTunnel_RelayChain(t *testing.T) {
+	if chain := (&Tunnel{}).RelayChain(); chain != nil {
+		t.Errorf("RelayChain() = %v, want nil", chain)
+	}
+
+	// 经 JSON 解码（事件、存储）后为 []interface{}
+	data, _ := json.Marshal(&Tunnel{ID: "t1", Metadata: map[string]interface{}{
+		MetadataKeyRelayChain: []string{"dmz:9443", "inner:9443"},
+	}})
+	var decoded Tunnel
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	chain := decoded.RelayChain()
+	if len(chain) != 2 || chain[0] != "dmz:9443" || chain[1] != "inner:9443" {
+		t.Errorf("RelayChain() = %v", chain)
+	}
+}
+
+func TestEncodeChainHandshake(t *testing.T) {
+	frame, err := EncodeChainHandshake("tunnel-001", time.Time{}, true, []string{"inner:9443"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := frame[:TimedHandshakeLength]
+	if base[0] != TimedHandshakeMagic || base[1] != ChainHandshakeVersion {
+		t.Fatalf("frame header = %x", base[:2])
+	}
+	want := append([]byte{ChainFlagCloseNotice, 0, 1, byte(len("inner:9443"))}, "inner:9443"...)
+	want = append(want, 0)
+	if got := frame[TimedHandshakeLength:]; string(got) != string(want) {
+		t.Errorf("route = %x, want %x", got, want)
+	}
+
+	if _, err := EncodeChainHandshake("tunnel-001", time.Time{}, false, nil); err == nil {
+		t.Error("expected error for empty route")
+	}
+	if _, err := EncodeChainHandshake("tunnel-001", time.Time{}, false, []string{""}); err == nil {
+		t.Error("expected error for empty hop address")
+	}
+}
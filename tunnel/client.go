@@ -1,18 +1,29 @@
 package tunnel
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"net"
+	"sync"
 	"time"
+
+	"github.com/houzhh15/sdp-common/backoff"
+	"github.com/houzhh15/sdp-common/egress"
+	"github.com/houzhh15/sdp-common/faults"
 )
 
 // DataPlaneClient encapsulates data plane connection logic
 // It handles the tunnel ID handshake protocol and provides a clean API for IH/AH clients
 type DataPlaneClient struct {
+	mu         sync.RWMutex
 	serverAddr string
 	tlsConfig  *tls.Config
 	timeout    time.Duration
+	proxy      *egress.Config
+	discover   DiscoverFunc
+	// closeNotice request close notices from the relay (handshake version 0x02)
+	closeNotice bool
 }
 
 // DataPlaneClientConfig configuration for data plane client
@@ -20,6 +31,17 @@ type DataPlaneClientConfig struct {
 	ServerAddr string        // Controller TCP Proxy address (e.g., "localhost:9443")
 	TLSConfig  *tls.Config   // mTLS configuration
 	Timeout    time.Duration // Connection timeout (default: 10s)
+	// Proxy outbound proxy (HTTP CONNECT / SOCKS5) for reaching the relay;
+	// nil follows HTTPS_PROXY / NO_PROXY. mTLS is negotiated end-to-end through the tunnel
+	Proxy *egress.Config
+	// Discover looks up the advertised data plane addresses (e.g. DiscoverFromController).
+	// When set, an empty ServerAddr is discovered on first use and a failed dial
+	// refreshes the addresses and tries the other advertised ones (optional)
+	Discover DiscoverFunc
+	// CloseNotice asks the relay to frame its side of the stream so that a tunnel it
+	// terminates carries a machine-readable reason (see CloseNoticeConn). Connections
+	// are returned as *CloseNoticeConn. Requires a Controller supporting handshake version 0x02
+	CloseNotice bool
 }
 
 // NewDataPlaneClient creates a new data plane client
@@ -40,9 +62,50 @@ func NewDataPlaneClientWithConfig(config *DataPlaneClientConfig) *DataPlaneClien
 		serverAddr: config.ServerAddr,
 		tlsConfig:  config.TLSConfig,
 		timeout:    config.Timeout,
+		proxy:      config.Proxy,
+		discover:   config.Discover,
+
+		closeNotice: config.CloseNotice,
 	}
 }
 
+// ServerAddr returns the data plane address currently in use
+func (c *DataPlaneClient) ServerAddr() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.serverAddr
+}
+
+// SetServerAddr switches to another data plane address, e.g. the controller_addr
+// returned when a tunnel is created. Established connections are not affected
+func (c *DataPlaneClient) SetServerAddr(addr string) {
+	c.mu.Lock()
+	c.serverAddr = addr
+	c.mu.Unlock()
+}
+
+// Refresh asks Discover for the advertised addresses and switches to the preferred one
+func (c *DataPlaneClient) Refresh(ctx context.Context) error {
+	_, err := c.refresh(ctx)
+	return err
+}
+
+// refresh returns the advertised addresses after switching to the first one
+func (c *DataPlaneClient) refresh(ctx context.Context) ([]string, error) {
+	if c.discover == nil {
+		return nil, fmt.Errorf("data plane discovery not configured")
+	}
+	addrs, err := c.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("data plane discovery returned no addresses")
+	}
+	c.SetServerAddr(addrs[0])
+	return addrs, nil
+}
+
 // Connect establishes a data plane connection and sends tunnel ID
 // This method encapsulates the handshake protocol details
 //
@@ -61,17 +124,18 @@ func (c *DataPlaneClient) Connect(tunnelID string) (net.Conn, error) {
 		return nil, fmt.Errorf("tunnel ID cannot be empty")
 	}
 
-	// 1. Establish TLS connection
-	dialer := &tls.Dialer{
-		NetDialer: &net.Dialer{
-			Timeout: c.timeout,
-		},
-		Config: c.tlsConfig,
+	if c.closeNotice {
+		frame, err := EncodeCloseNoticeHandshake(tunnelID, time.Time{})
+		if err != nil {
+			return nil, err
+		}
+		return c.connectFrame(frame)
 	}
 
-	conn, err := dialer.Dial("tcp", c.serverAddr)
+	// 1. Establish TLS connection
+	conn, err := c.dial()
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to %s: %w", c.serverAddr, err)
+		return nil, err
 	}
 
 	// 2. Send tunnel ID (protocol handshake)
@@ -83,43 +147,156 @@ func (c *DataPlaneClient) Connect(tunnelID string) (net.Conn, error) {
 	return conn, nil
 }
 
+// connectFrame dials and sends an extended (0xFE) handshake frame. A close notice
+// handshake returns the connection wrapped in a CloseNoticeConn
+func (c *DataPlaneClient) connectFrame(frame []byte) (net.Conn, error) {
+	conn, err := c.dial()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeHandshake(conn, frame); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to send tunnel ID: %w", err)
+	}
+
+	if frame[1] == CloseNoticeHandshakeVersion {
+		return NewCloseNoticeConn(conn), nil
+	}
+	return conn, nil
+}
+
+// dial establishes the mTLS connection to the data plane server. With Discover
+// configured, a failed dial re-discovers the addresses (the relay may have moved)
+// and tries each other advertised address once
+func (c *DataPlaneClient) dial() (net.Conn, error) {
+	addr := c.ServerAddr()
+	if addr == "" && c.discover != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+		_, err := c.refresh(ctx)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+		addr = c.ServerAddr()
+	}
+
+	conn, err := c.dialAddr(addr)
+	if err == nil || c.discover == nil {
+		return conn, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	addrs, rerr := c.refresh(ctx)
+	cancel()
+	if rerr != nil {
+		return nil, err
+	}
+	for _, alt := range addrs {
+		if alt == addr {
+			continue
+		}
+		conn, altErr := c.dialAddr(alt)
+		if altErr == nil {
+			c.SetServerAddr(alt)
+			return conn, nil
+		}
+		err = altErr
+	}
+	return nil, err
+}
+
+// dialAddr establishes the mTLS connection to addr,
+// through the outbound proxy when one applies
+func (c *DataPlaneClient) dialAddr(addr string) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	dialer := &egress.Dialer{Config: c.proxy}
+	rawConn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+
+	tlsConfig := c.tlsConfig
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	}
+	if tlsConfig.ServerName == "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			host = addr
+		}
+		tlsConfig = tlsConfig.Clone()
+		tlsConfig.ServerName = host
+	}
+
+	conn := tls.Client(rawConn, tlsConfig)
+	if err := conn.HandshakeContext(ctx); err != nil {
+		rawConn.Close()
+		return nil, fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	return conn, nil
+}
+
 // sendTunnelID sends the tunnel ID using the data plane protocol
 // Protocol: Fixed 36-byte tunnel ID (UUID format, right-padded with null bytes)
 func (c *DataPlaneClient) sendTunnelID(conn net.Conn, tunnelID string) error {
+	// Encode tunnel ID as fixed 36-byte buffer
+	tunnelIDBytes := make([]byte, TunnelIDLength)
+	copy(tunnelIDBytes, []byte(tunnelID))
+
+	return writeHandshake(conn, tunnelIDBytes)
+}
+
+// writeHandshake writes a complete handshake frame under a write deadline
+func writeHandshake(conn net.Conn, frame []byte) error {
 	// Set write deadline for handshake
 	if err := conn.SetWriteDeadline(time.Now().Add(5 * time.Second)); err != nil {
 		return fmt.Errorf("set write deadline: %w", err)
 	}
 	defer conn.SetWriteDeadline(time.Time{})
 
-	// Encode tunnel ID as fixed 36-byte buffer
-	tunnelIDBytes := make([]byte, TunnelIDLength)
-	copy(tunnelIDBytes, []byte(tunnelID))
-
-	// Send tunnel ID
-	n, err := conn.Write(tunnelIDBytes)
+	frame = faults.CorruptHandshake(frame)
+	n, err := conn.Write(frame)
 	if err != nil {
 		return fmt.Errorf("write tunnel ID: %w", err)
 	}
-	if n != TunnelIDLength {
-		return fmt.Errorf("incomplete write: wrote %d bytes, expected %d", n, TunnelIDLength)
+	if n != len(frame) {
+		return fmt.Errorf("incomplete write: wrote %d bytes, expected %d", n, len(frame))
 	}
 
 	return nil
 }
 
+// ConnectMux establishes a data plane connection and wraps it in a MuxSession.
+// isClient should be true on the IH side (opens streams) and false on the AH side (accepts streams).
+func (c *DataPlaneClient) ConnectMux(tunnelID string, isClient bool) (*MuxSession, error) {
+	conn, err := c.Connect(tunnelID)
+	if err != nil {
+		return nil, err
+	}
+	return NewMuxSession(conn, isClient), nil
+}
+
 // ConnectWithRetry establishes connection with retry logic
+// Waits between attempts are jittered in [0, retryDelay]
 func (c *DataPlaneClient) ConnectWithRetry(tunnelID string, maxRetries int, retryDelay time.Duration) (net.Conn, error) {
-	var lastErr error
-	for i := 0; i < maxRetries; i++ {
-		conn, err := c.Connect(tunnelID)
-		if err == nil {
-			return conn, nil
-		}
-		lastErr = err
-		if i < maxRetries-1 {
-			time.Sleep(retryDelay)
-		}
+	if maxRetries < 1 {
+		maxRetries = 1 // backoff treats 0 as unlimited
 	}
-	return nil, fmt.Errorf("failed after %d retries: %w", maxRetries, lastErr)
+	var conn net.Conn
+	err := backoff.Retry(context.Background(), &backoff.Config{
+		InitialInterval: retryDelay,
+		MaxInterval:     retryDelay,
+		MaxAttempts:     maxRetries,
+	}, func(ctx context.Context) error {
+		var err error
+		conn, err = c.Connect(tunnelID)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed after %d retries: %w", maxRetries, err)
+	}
+	return conn, nil
 }
@@ -0,0 +1,137 @@
+package tunnel
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// IH 客户端事件类型（SSE event 名），仅推送给 IH 作用域订阅
+const (
+	EventPolicyUpdated    = "policy_updated"
+	EventPolicyDeleted    = "policy_deleted"
+	EventSessionRefreshed = "session_refreshed"
+	// EventTunnelE2EReady AH 已上报端到端加密公钥，Details 包含 tunnel_id 与 public_key
+	EventTunnelE2EReady = "tunnel_e2e_ready"
+	// EventSessionRevoked 为终止事件：推送后 Controller 关闭该订阅流
+	EventSessionRevoked = "session_revoked"
+	// EventServiceStatusChanged 服务进入 / 结束维护或被计划停用，Details 包含 status、previous_status，维护中另含 message 与 ends_at
+	EventServiceStatusChanged = "service_status_changed"
+	// EventTunnelFailed 隧道被 Controller 判定失败（如未在配对超时内配对），Details 包含 tunnel_id 与 reason，
+	// 可通过 ClientEvent.TunnelFailure 取得 *TunnelFailedError
+	EventTunnelFailed = "tunnel_failed"
+)
+
+// 隧道失败原因（tunnel_failed 事件与 Tunnel.FailureReason）
+const (
+	// TunnelFailurePairingTimeout 隧道创建后 IH 与 AH 未在 Controller 的配对超时内于中继完成配对
+	TunnelFailurePairingTimeout = "pairing_timeout"
+)
+
+// clientKeyPrefix IH 作用域订阅在订阅表中的键前缀，使 IH 订阅与 AH 的 agent_id 互不覆盖
+const clientKeyPrefix = "ih:"
+
+// ErrReservedAgentID AH 订阅的 agent_id 使用了 IH 作用域订阅的保留前缀
+var ErrReservedAgentID = errors.New("agent_id uses reserved prefix " + clientKeyPrefix)
+
+// clientKey IH 作用域订阅在订阅表中的键
+func clientKey(clientID string) string {
+	return clientKeyPrefix + clientID
+}
+
+// ClientEvent IH 客户端事件（策略变更、会话状态变化）
+type ClientEvent struct {
+	Type      string                 `json:"type"`
+	ClientID  string                 `json:"client_id"`
+	PolicyID  string                 `json:"policy_id,omitempty"`
+	ServiceID string                 `json:"service_id,omitempty"`
+	Details   map[string]interface{} `json:"details,omitempty"` // 例如 session_refreshed 的 expires_at
+	Timestamp time.Time              `json:"timestamp"`
+}
+
+// TunnelFailedError 隧道已被 Controller 判定失败，不会再完成配对，需重新创建隧道
+type TunnelFailedError struct {
+	TunnelID  string
+	ServiceID string
+	Reason    string // 失败原因，如 TunnelFailurePairingTimeout
+}
+
+func (e *TunnelFailedError) Error() string {
+	return fmt.Sprintf("tunnel %s failed: %s", e.TunnelID, e.Reason)
+}
+
+// TunnelFailure 返回 tunnel_failed 事件携带的失败信息，其他事件返回 nil
+func (e *ClientEvent) TunnelFailure() *TunnelFailedError {
+	if e.Type != EventTunnelFailed {
+		return nil
+	}
+	tunnelID, _ := e.Details["tunnel_id"].(string)
+	reason, _ := e.Details["reason"].(string)
+	return &TunnelFailedError{TunnelID: tunnelID, ServiceID: e.ServiceID, Reason: reason}
+}
+
+// SubscribeClient 处理 IH 作用域订阅（调用方负责先校验会话令牌）
+// 与 Subscribe 的区别：
+//   - 广播隧道事件只投递该客户端自己的隧道
+//   - 不投递服务配置事件（仅 AH 关心）
+//   - 额外接收 ClientEvent；收到 session_revoked 后结束订阅
+func (n *Notifier) SubscribeClient(clientID string, w http.ResponseWriter) error {
+	return n.subscribe(clientKey(clientID), clientID, &SubscribeOptions{}, w)
+}
+
+// SubscribeClientFrom 同 SubscribeClient，先补发事件日志中 lastEventID 之后属于该客户端的隧道事件
+func (n *Notifier) SubscribeClientFrom(clientID, lastEventID string, w http.ResponseWriter) error {
+	return n.subscribe(clientKey(clientID), clientID, &SubscribeOptions{LastEventID: lastEventID}, w)
+}
+
+// SubscribeClientWith 同 SubscribeClient，按 opts 补发事件并协商心跳间隔
+func (n *Notifier) SubscribeClientWith(clientID string, opts *SubscribeOptions, w http.ResponseWriter) error {
+	return n.subscribe(clientKey(clientID), clientID, opts, w)
+}
+
+// UnsubscribeClient 断开 IH 作用域订阅（Unsubscribe 只作用于 AH 订阅）
+func (n *Notifier) UnsubscribeClient(clientID string) {
+	n.Unsubscribe(clientKey(clientID))
+}
+
+// NotifyClient 发送客户端事件给特定 IH 客户端
+func (n *Notifier) NotifyClient(clientID string, event *ClientEvent) error {
+	if event.Timestamp.IsZero() {
+		event.Timestamp = n.clock.Now()
+	}
+
+	// 只查找 IH 作用域订阅，同名的 AH 订阅不接收客户端事件
+	client, ok := n.clients.load(clientKey(clientID))
+	if !ok {
+		return fmt.Errorf("client not found: %s", clientID)
+	}
+
+	select {
+	case client.ClientChannel <- event:
+		n.logger.Debug("Client event sent to client",
+			"client_id", clientID,
+			"event_type", event.Type,
+		)
+		return nil
+	case <-client.Done:
+		return fmt.Errorf("client disconnected: %s", clientID)
+	default:
+		return fmt.Errorf("client event channel full: %s", clientID)
+	}
+}
+
+// sendClientEvent 发送客户端事件
+func (n *Notifier) sendClientEvent(w http.ResponseWriter, flusher http.Flusher, event *ClientEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("marshal client event: %w", err)
+	}
+
+	// SSE 格式：event: <type>\ndata: <ClientEvent JSON>\n\n
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+	flusher.Flush()
+
+	return nil
+}
@@ -1,7 +1,12 @@
 package tunnel
 
 import (
+	"context"
 	"crypto/tls"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 )
@@ -91,3 +96,62 @@ func TestConnectEmptyTunnelID(t *testing.T) {
 		t.Errorf("Expected 'tunnel ID cannot be empty', got '%s'", err.Error())
 	}
 }
+
+func TestDataPlaneClient_Discover(t *testing.T) {
+	relay := httptest.NewTLSServer(http.NotFoundHandler())
+	defer relay.Close()
+	relayAddr := relay.Listener.Addr().String()
+
+	// 已关闭的端口，模拟迁移后不再监听的旧地址
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	staleAddr := ln.Addr().String()
+	ln.Close()
+
+	controller := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != DefaultDataPlanePath {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(&DataPlaneInfo{Addrs: []string{staleAddr, relayAddr}, Ready: true})
+	}))
+	defer controller.Close()
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: true}
+	discover := DiscoverFromController(controller.URL, tlsConfig, nil)
+	addrs, err := discover(context.Background())
+	if err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+	if len(addrs) != 2 || addrs[0] != staleAddr {
+		t.Fatalf("addrs = %v", addrs)
+	}
+
+	// 未配置地址：首次连接前发现；首选地址不可达时切换到其他通告地址
+	client := NewDataPlaneClientWithConfig(&DataPlaneClientConfig{
+		TLSConfig: tlsConfig,
+		Timeout:   2 * time.Second,
+		Discover:  discover,
+	})
+	conn, err := client.Connect("tunnel-123")
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	conn.Close()
+	if got := client.ServerAddr(); got != relayAddr {
+		t.Errorf("ServerAddr = %s, want %s", got, relayAddr)
+	}
+
+	if err := client.Refresh(context.Background()); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if got := client.ServerAddr(); got != staleAddr {
+		t.Errorf("ServerAddr after refresh = %s, want preferred %s", got, staleAddr)
+	}
+
+	if err := NewDataPlaneClient(relayAddr, tlsConfig).Refresh(context.Background()); err == nil {
+		t.Error("expected error refreshing without Discover")
+	}
+}
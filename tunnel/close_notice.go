@@ -0,0 +1,178 @@
+package tunnel
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// 关闭通知握手与帧格式
+//
+// 握手帧与带时间戳的握手相同，版本号为 0x02（连接时间为 0 表示未携带）：
+//
+//	[0xFE][0x02][8 字节本地连接时间 unix 纳秒, 大端][36 字节 Tunnel ID]
+//
+// 握手之后客户端 → 中继方向仍为透明字节流；中继 → 客户端方向按帧发送：
+//
+//	+--------+-------------+-----------------+
+//	| Type   | Length      | Payload         |
+//	| 1 byte | 4 bytes BE  | Length bytes    |
+//	+--------+-------------+-----------------+
+//
+// DATA 帧负载为对端数据；CLOSE 帧负载为关闭原因（RelayClose* 之一），之后中继关闭连接
+const (
+	CloseNoticeHandshakeVersion byte = 0x02
+
+	closeNoticeFrameData  byte = 0x01
+	closeNoticeFrameClose byte = 0x02
+
+	closeNoticeHeaderSize = 5
+	// closeNoticeMaxReason CLOSE 帧负载上限，超出视为协议错误
+	closeNoticeMaxReason = 256
+)
+
+// 中继关闭隧道的原因（CLOSE 帧负载）
+const (
+	RelayClosePeerClosed     = "peer_closed"     // 对端断开，正常结束
+	RelayClosePairingTimeout = "pairing_timeout" // 对端未在配对超时内连接
+	RelayCloseShutdown       = "shutdown"        // Controller 停止或升级排空到期
+	RelayCloseTerminated     = "terminated"      // 未指明原因的主动断开
+	RelayCloseRejected       = "tunnel_rejected" // 对账时隧道被拒绝（策略、服务或目标不再允许）
+	RelayCloseUnknownTunnel  = "unknown_tunnel"  // 对账宽限期后仍无 AH 上报的隧道
+	RelayClosePolicyRevoked  = "policy_revoked"  // 访问策略被撤销
+	RelayCloseIdle           = "idle"            // 空闲超时
+	RelayCloseQuota          = "quota_exceeded"  // 超出流量或连接配额
+	RelayCloseDeleted        = "tunnel_deleted"  // 隧道被删除
+	RelayCloseExpired        = "tunnel_expired"  // 隧道已过期
+
+	// 多跳隧道（第一跳告知 IH）
+	RelayCloseChainRejected      = "chain_rejected"       // 多跳握手被中继拒绝
+	RelayCloseNextHopUnreachable = "next_hop_unreachable" // 下一跳中继不可达
+)
+
+// RelayCloseError 中继通过 CLOSE 帧告知的隧道关闭原因
+type RelayCloseError struct {
+	Reason string
+}
+
+func (e *RelayCloseError) Error() string {
+	return "tunnel closed by relay: " + e.Reason
+}
+
+// RelayCloseReason 返回 err 携带的中继关闭原因，不是中继关闭时返回空
+func RelayCloseReason(err error) string {
+	var closeErr *RelayCloseError
+	if errors.As(err, &closeErr) {
+		return closeErr.Reason
+	}
+	return ""
+}
+
+// EncodeCloseNoticeHandshake 编码请求关闭通知的握手帧；connectedAt 为零值时不携带连接时间
+func EncodeCloseNoticeHandshake(tunnelID string, connectedAt time.Time) ([]byte, error) {
+	var nanos int64
+	if !connectedAt.IsZero() {
+		nanos = connectedAt.UnixNano()
+	}
+	return encodeHandshakeFrame(CloseNoticeHandshakeVersion, tunnelID, nanos)
+}
+
+// CloseNoticeConn 解析中继 → 客户端方向的帧，向上层呈现透明字节流
+//
+// 收到 CLOSE 帧后 Read 返回错误：原因为 RelayClosePeerClosed 时返回 io.EOF（正常结束），
+// 其他原因返回 *RelayCloseError；未收到 CLOSE 帧就断开时返回底层错误
+type CloseNoticeConn struct {
+	net.Conn
+
+	header    [closeNoticeHeaderSize]byte
+	remaining uint32 // 当前 DATA 帧未读的负载字节数
+
+	mu     sync.Mutex
+	reason string
+	err    error // 收到 CLOSE 帧或协议错误后固定返回的错误
+}
+
+// NewCloseNoticeConn 包装已发送关闭通知握手的数据平面连接
+func NewCloseNoticeConn(conn net.Conn) *CloseNoticeConn {
+	return &CloseNoticeConn{Conn: conn}
+}
+
+// Read 读取 DATA 帧负载
+func (c *CloseNoticeConn) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	for c.remaining == 0 {
+		if err := c.stickyErr(); err != nil {
+			return 0, err
+		}
+		if err := c.readHeader(); err != nil {
+			return 0, err
+		}
+	}
+
+	if uint32(len(p)) > c.remaining {
+		p = p[:c.remaining]
+	}
+	n, err := c.Conn.Read(p)
+	c.remaining -= uint32(n)
+	if err == io.EOF && c.remaining > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// readHeader 读取下一帧的帧头；CLOSE 帧直接读取原因并记录
+func (c *CloseNoticeConn) readHeader() error {
+	if _, err := io.ReadFull(c.Conn, c.header[:]); err != nil {
+		return err
+	}
+	length := binary.BigEndian.Uint32(c.header[1:])
+
+	switch c.header[0] {
+	case closeNoticeFrameData:
+		c.remaining = length
+		return nil
+	case closeNoticeFrameClose:
+		if length > closeNoticeMaxReason {
+			return c.fail("", fmt.Errorf("close notice reason too long: %d bytes", length))
+		}
+		reason := make([]byte, length)
+		if _, err := io.ReadFull(c.Conn, reason); err != nil {
+			return err
+		}
+		if string(reason) == RelayClosePeerClosed {
+			return c.fail(string(reason), io.EOF)
+		}
+		return c.fail(string(reason), &RelayCloseError{Reason: string(reason)})
+	default:
+		return c.fail("", fmt.Errorf("unknown close notice frame type: 0x%02x", c.header[0]))
+	}
+}
+
+// fail 记录关闭原因和之后 Read 固定返回的错误
+func (c *CloseNoticeConn) fail(reason string, err error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reason = reason
+	c.err = err
+	return err
+}
+
+// stickyErr 返回已记录的错误
+func (c *CloseNoticeConn) stickyErr() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// CloseReason 返回中继告知的关闭原因，尚未收到 CLOSE 帧时为空
+func (c *CloseNoticeConn) CloseReason() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.reason
+}
@@ -0,0 +1,182 @@
+package tunnel
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/houzhh15/sdp-common/logging"
+)
+
+// noticeFrame 编码中继 → 客户端方向的一帧
+func noticeFrame(frameType byte, payload string) []byte {
+	frame := make([]byte, closeNoticeHeaderSize, closeNoticeHeaderSize+len(payload))
+	frame[0] = frameType
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(payload)))
+	return append(frame, payload...)
+}
+
+// noticePipe 返回客户端侧的 CloseNoticeConn，另一端依次写出 frames 后关闭
+func noticePipe(frames ...[]byte) *CloseNoticeConn {
+	client, relay := net.Pipe()
+	go func() {
+		for _, frame := range frames {
+			relay.Write(frame)
+		}
+		relay.Close()
+	}()
+	return NewCloseNoticeConn(client)
+}
+
+func TestEncodeCloseNoticeHandshake(t *testing.T) {
+	frame, err := EncodeCloseNoticeHandshake("tunnel-123", time.Time{})
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	if len(frame) != TimedHandshakeLength || frame[0] != TimedHandshakeMagic || frame[1] != CloseNoticeHandshakeVersion {
+		t.Fatalf("unexpected frame header: %x", frame[:2])
+	}
+	if got := binary.BigEndian.Uint64(frame[2:10]); got != 0 {
+		t.Errorf("timestamp = %d, want 0 for zero connectedAt", got)
+	}
+
+	connectedAt := time.Unix(0, 1700000000123456789)
+	frame, _ = EncodeCloseNoticeHandshake("tunnel-123", connectedAt)
+	if got := int64(binary.BigEndian.Uint64(frame[2:10])); got != connectedAt.UnixNano() {
+		t.Errorf("timestamp = %d, want %d", got, connectedAt.UnixNano())
+	}
+}
+
+func TestCloseNoticeConn(t *testing.T) {
+	// 小缓冲跨帧读取，空 DATA 帧被跳过，CLOSE 帧转为 RelayCloseError
+	conn := noticePipe(
+		noticeFrame(closeNoticeFrameData, "hello "),
+		noticeFrame(closeNoticeFrameData, ""),
+		noticeFrame(closeNoticeFrameData, "world"),
+		noticeFrame(closeNoticeFrameClose, RelayCloseDeleted),
+	)
+	var got []byte
+	buf := make([]byte, 4)
+	var err error
+	for err == nil {
+		var n int
+		n, err = conn.Read(buf)
+		got = append(got, buf[:n]...)
+	}
+	if string(got) != "hello world" {
+		t.Errorf("data = %q, want %q", got, "hello world")
+	}
+	if reason := RelayCloseReason(err); reason != RelayCloseDeleted {
+		t.Errorf("close reason = %q (err %v), want %q", reason, err, RelayCloseDeleted)
+	}
+	if _, again := conn.Read(buf); RelayCloseReason(again) != RelayCloseDeleted {
+		t.Errorf("subsequent read error = %v, want sticky close error", again)
+	}
+	if conn.CloseReason() != RelayCloseDeleted {
+		t.Errorf("CloseReason = %q", conn.CloseReason())
+	}
+
+	// 对端正常断开以 io.EOF 结束
+	conn = noticePipe(noticeFrame(closeNoticeFrameData, "bye"), noticeFrame(closeNoticeFrameClose, RelayClosePeerClosed))
+	data, err := io.ReadAll(conn)
+	if err != nil || string(data) != "bye" {
+		t.Errorf("ReadAll = %q, %v; want \"bye\", nil", data, err)
+	}
+	if conn.CloseReason() != RelayClosePeerClosed {
+		t.Errorf("CloseReason = %q, want %q", conn.CloseReason(), RelayClosePeerClosed)
+	}
+
+	// 未收到 CLOSE 帧即断开：DATA 帧不完整时报告截断
+	truncated := noticeFrame(closeNoticeFrameData, "truncated")
+	conn = noticePipe(truncated[:8])
+	if _, err := io.ReadAll(conn); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("truncated frame error = %v, want io.ErrUnexpectedEOF", err)
+	}
+	if conn.CloseReason() != "" {
+		t.Errorf("CloseReason = %q, want empty", conn.CloseReason())
+	}
+
+	conn = noticePipe([]byte{0x7f, 0, 0, 0, 0})
+	if _, err := io.ReadAll(conn); err == nil || RelayCloseReason(err) != "" {
+		t.Errorf("unknown frame type error = %v", err)
+	}
+}
+
+func TestDataPlaneClient_CloseNotice(t *testing.T) {
+	srv := httptest.NewUnstartedServer(nil)
+	srv.StartTLS()
+	defer srv.Close()
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", srv.TLS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	handshakes := make(chan []byte, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		frame := make([]byte, TimedHandshakeLength)
+		if _, err := io.ReadFull(conn, frame); err != nil {
+			return
+		}
+		handshakes <- frame
+		conn.Write(noticeFrame(closeNoticeFrameData, "pong"))
+		conn.Write(noticeFrame(closeNoticeFrameClose, RelayCloseIdle))
+	}()
+
+	client := NewDataPlaneClientWithConfig(&DataPlaneClientConfig{
+		ServerAddr:  ln.Addr().String(),
+		TLSConfig:   &tls.Config{InsecureSkipVerify: true},
+		CloseNotice: true,
+	})
+	conn, err := client.Connect("tunnel-123")
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer conn.Close()
+	if _, ok := conn.(*CloseNoticeConn); !ok {
+		t.Fatalf("conn type = %T, want *CloseNoticeConn", conn)
+	}
+
+	frame := <-handshakes
+	if frame[0] != TimedHandshakeMagic || frame[1] != CloseNoticeHandshakeVersion {
+		t.Errorf("handshake header = %x, want fe02", frame[:2])
+	}
+	data, err := io.ReadAll(conn)
+	if string(data) != "pong" || RelayCloseReason(err) != RelayCloseIdle {
+		t.Errorf("ReadAll = %q, %v; want \"pong\" and reason %q", data, err, RelayCloseIdle)
+	}
+}
+
+func TestAccessLogger_ForwardRelayClosed(t *testing.T) {
+	audit := &connAudit{}
+	logger := NewAccessLogger(&AccessLogConfig{Audit: audit})
+	target, targetRemote := net.Pipe()
+	defer targetRemote.Close()
+	go io.Copy(io.Discard, targetRemote)
+
+	peer := noticePipe(noticeFrame(closeNoticeFrameClose, RelayClosePolicyRevoked))
+	done := make(chan *logging.ConnectionEvent, 1)
+	go func() {
+		done <- logger.Forward(context.Background(), &ConnAccess{TunnelID: "tun-1"}, peer, target)
+	}()
+
+	select {
+	case event := <-done:
+		if event.Details["close_reason"] != CloseReasonRelayClosed || event.Details["relay_reason"] != RelayClosePolicyRevoked {
+			t.Errorf("details = %v, want close_reason=%s relay_reason=%s", event.Details, CloseReasonRelayClosed, RelayClosePolicyRevoked)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Forward did not return")
+	}
+}
@@ -0,0 +1,35 @@
+package tunnel
+
+import (
+	"context"
+	"time"
+)
+
+// CredentialBroker 按隧道签发目标服务的临时凭据（如 Vault 数据库动态账号）
+// Controller 在创建隧道时调用 Mint，凭据随创建响应交给 IH（不经过 AH 与中继），隧道删除或到期时调用 Revoke
+type CredentialBroker interface {
+	Mint(ctx context.Context, req *CredentialRequest) (*TargetCredential, error)
+	Revoke(ctx context.Context, credential *TargetCredential) error
+}
+
+// CredentialRequest 签发凭据的隧道上下文
+type CredentialRequest struct {
+	TunnelID   string
+	ClientID   string
+	ServiceID  string
+	TargetHost string
+	TargetPort int
+	// ExpiresAt 隧道到期时间，零值表示隧道不过期（由 broker 决定凭据有效期）
+	ExpiresAt time.Time
+}
+
+// TargetCredential 目标服务临时凭据，字段按目标类型选用
+type TargetCredential struct {
+	// CredentialID broker 侧标识（如 Vault lease ID），用于吊销
+	CredentialID string                 `json:"credential_id"`
+	Username     string                 `json:"username,omitempty"`
+	Password     string                 `json:"password,omitempty"`
+	Token        string                 `json:"token,omitempty"`
+	ExpiresAt    time.Time              `json:"expires_at,omitempty"`
+	Metadata     map[string]interface{} `json:"metadata,omitempty"`
+}
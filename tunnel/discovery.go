@@ -0,0 +1,65 @@
+package tunnel
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/houzhh15/sdp-common/egress"
+)
+
+// DefaultDataPlanePath Controller endpoint advertising the data plane address(es)
+const DefaultDataPlanePath = "/api/v1/dataplane"
+
+// DataPlaneInfo is the response of GET /api/v1/dataplane
+type DataPlaneInfo struct {
+	// Addrs data plane addresses (host:port) in order of preference
+	Addrs []string `json:"addrs"`
+	// Ready whether the relay currently accepts connections
+	Ready bool `json:"ready"`
+}
+
+// DiscoverFunc returns the data plane addresses in order of preference
+type DiscoverFunc func(ctx context.Context) ([]string, error)
+
+// DiscoverFromController returns a DiscoverFunc querying the Controller's
+// DefaultDataPlanePath over mTLS (controllerURL e.g. "https://controller:8443").
+// proxy is the outbound proxy; nil follows HTTPS_PROXY / NO_PROXY
+func DiscoverFromController(controllerURL string, tlsConfig *tls.Config, proxy *egress.Config) DiscoverFunc {
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: tlsConfig,
+			Proxy:           proxy.ProxyFunc(),
+		},
+		Timeout: 10 * time.Second,
+	}
+	url := strings.TrimSuffix(controllerURL, "/") + DefaultDataPlanePath
+
+	return func(ctx context.Context) ([]string, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, fmt.Errorf("create discovery request: %w", err)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("data plane discovery: %w", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("data plane discovery: unexpected status %d", resp.StatusCode)
+		}
+		var info DataPlaneInfo
+		if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+			return nil, fmt.Errorf("decode data plane discovery: %w", err)
+		}
+		if len(info.Addrs) == 0 {
+			return nil, fmt.Errorf("data plane discovery: controller advertised no addresses")
+		}
+		return info.Addrs, nil
+	}
+}
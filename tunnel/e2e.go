@@ -0,0 +1,330 @@
+package tunnel
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// 端到端加密（E2E）模式
+// IH 与 AH 各自生成临时 X25519 密钥，公钥经 Controller 交换（IH 随隧道创建请求提交，AH 收到隧道事件后上报），
+// 中继只转发密文。每条数据平面连接开头双方各发送 32 字节随机盐，连接密钥由 ECDH 共享密钥、双方盐值与隧道 ID
+// 经 HKDF-SHA256 派生，每个方向独立密钥；之后的数据以 AES-256-GCM 分帧：[2 字节密文长度, 大端][密文 + 16 字节标签]
+const (
+	// MetadataKeyE2EPublicKey 隧道 Metadata 中 IH 的 E2E 公钥（base64），存在即表示隧道启用 E2E
+	MetadataKeyE2EPublicKey = "e2e_public_key"
+	// MetadataKeyE2EAgentPublicKey 隧道 Metadata 中 AH 上报的 E2E 公钥（base64）
+	MetadataKeyE2EAgentPublicKey = "e2e_agent_public_key"
+
+	// E2E 连接端
+	E2ESideIH = "ih"
+	E2ESideAH = "ah"
+
+	e2eSaltLength   = 32
+	e2eMaxPlaintext = 16 * 1024
+	e2eKDFLabel     = "sdp-e2e-v1"
+)
+
+var (
+	// ErrE2EAuthFailed 密文校验失败（密钥不匹配或数据被篡改）
+	ErrE2EAuthFailed = errors.New("e2e: message authentication failed")
+	// ErrE2EKeyConflict 隧道的 AH 公钥已由其他连接上报（Controller 返回 409）
+	ErrE2EKeyConflict = errors.New("e2e: agent public key already published")
+)
+
+// IsEndToEnd 隧道是否启用端到端加密
+func (t *Tunnel) IsEndToEnd() bool {
+	return t.metadataString(MetadataKeyE2EPublicKey) != ""
+}
+
+// E2EPublicKey IH 的 E2E 公钥，未启用时为空
+func (t *Tunnel) E2EPublicKey() string {
+	return t.metadataString(MetadataKeyE2EPublicKey)
+}
+
+// E2EAgentPublicKey AH 上报的 E2E 公钥，尚未上报时为空
+func (t *Tunnel) E2EAgentPublicKey() string {
+	return t.metadataString(MetadataKeyE2EAgentPublicKey)
+}
+
+func (t *Tunnel) metadataString(key string) string {
+	if t == nil || t.Metadata == nil {
+		return ""
+	}
+	v, _ := t.Metadata[key].(string)
+	return v
+}
+
+// E2EKeyReport AH 上报的隧道 E2E 公钥
+type E2EKeyReport struct {
+	AgentID   string `json:"agent_id"`
+	TunnelID  string `json:"tunnel_id"`
+	PublicKey string `json:"public_key"`
+}
+
+// PublishE2EKey 向 Controller 上报隧道的 AH 公钥（AH 侧），Controller 随后推送给 IH
+// 每个隧道只接受首次上报，重复上报返回 ErrE2EKeyConflict
+func (s *Subscriber) PublishE2EKey(ctx context.Context, tunnelID, publicKey string) error {
+	body, err := json.Marshal(&E2EKeyReport{AgentID: s.agentID, TunnelID: tunnelID, PublicKey: publicKey})
+	if err != nil {
+		return fmt.Errorf("encode e2e key report: %w", err)
+	}
+
+	url := strings.TrimSuffix(s.ControllerURL(), "/") + "/api/v1/tunnels/e2e-key"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusConflict:
+		return ErrE2EKeyConflict
+	default:
+		return fmt.Errorf("unexpected status: %d", resp.StatusCode)
+	}
+}
+
+// E2EKey 单个隧道的临时 X25519 密钥
+type E2EKey struct {
+	priv *ecdh.PrivateKey
+}
+
+// GenerateE2EKey 生成临时密钥，每个隧道使用新的密钥
+func GenerateE2EKey() (*E2EKey, error) {
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("generate e2e key: %w", err)
+	}
+	return &E2EKey{priv: priv}, nil
+}
+
+// PublicKey base64 编码的公钥，经 Controller 交给对端
+func (k *E2EKey) PublicKey() string {
+	return base64.StdEncoding.EncodeToString(k.priv.PublicKey().Bytes())
+}
+
+// ParseE2EPublicKey 解析 base64 编码的 X25519 公钥
+func ParseE2EPublicKey(s string) (*ecdh.PublicKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid e2e public key encoding: %w", err)
+	}
+	pub, err := ecdh.X25519().NewPublicKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid e2e public key: %w", err)
+	}
+	return pub, nil
+}
+
+// Session 与对端公钥协商隧道共享密钥，side 为本端（E2ESideIH / E2ESideAH）
+func (k *E2EKey) Session(tunnelID, peerPublicKey, side string) (*E2ESession, error) {
+	if side != E2ESideIH && side != E2ESideAH {
+		return nil, fmt.Errorf("invalid e2e side: %q", side)
+	}
+	peer, err := ParseE2EPublicKey(peerPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := k.priv.ECDH(peer)
+	if err != nil {
+		return nil, fmt.Errorf("e2e key exchange: %w", err)
+	}
+	return &E2ESession{secret: secret, tunnelID: tunnelID, side: side}, nil
+}
+
+// E2ESession 隧道共享密钥，可包装该隧道的多条数据平面连接（每条连接派生独立密钥）
+type E2ESession struct {
+	secret   []byte
+	tunnelID string
+	side     string
+}
+
+// Wrap 返回已完成数据平面握手的连接对应的加密连接
+// 与 tls.Client 相同，盐值交换在首次读写（或显式调用 Handshake）时进行，不会阻塞调用方等待中继配对；
+// IH 与 AH 需对同一条中继配对连接调用 Wrap（多路复用模式下包装底层连接后再创建 MuxSession）
+func (s *E2ESession) Wrap(conn net.Conn) *E2EConn {
+	return &E2EConn{Conn: conn, session: s}
+}
+
+// handshake 交换双方盐值并派生本连接两个方向的密钥
+func (s *E2ESession) handshake(conn net.Conn) (seal, open cipher.AEAD, err error) {
+	local := make([]byte, e2eSaltLength)
+	if _, err := rand.Read(local); err != nil {
+		return nil, nil, fmt.Errorf("e2e salt: %w", err)
+	}
+
+	// 双方同时发送盐值，写入放在后台避免同步连接（如 net.Pipe）互相阻塞
+	writeErr := make(chan error, 1)
+	go func() {
+		_, err := conn.Write(local)
+		writeErr <- err
+	}()
+	remote := make([]byte, e2eSaltLength)
+	if _, err := io.ReadFull(conn, remote); err != nil {
+		return nil, nil, fmt.Errorf("e2e handshake: read salt: %w", err)
+	}
+	if err := <-writeErr; err != nil {
+		return nil, nil, fmt.Errorf("e2e handshake: write salt: %w", err)
+	}
+
+	ihSalt, ahSalt := local, remote
+	if s.side == E2ESideAH {
+		ihSalt, ahSalt = remote, local
+	}
+	salt := append(append([]byte(nil), ihSalt...), ahSalt...)
+
+	toAH, err := s.aead(salt, "ih->ah")
+	if err != nil {
+		return nil, nil, err
+	}
+	toIH, err := s.aead(salt, "ah->ih")
+	if err != nil {
+		return nil, nil, err
+	}
+	if s.side == E2ESideAH {
+		return toIH, toAH, nil
+	}
+	return toAH, toIH, nil
+}
+
+// aead 派生单方向的 AES-256-GCM 密钥
+func (s *E2ESession) aead(salt []byte, direction string) (cipher.AEAD, error) {
+	key, err := hkdf.Key(sha256.New, s.secret, salt, e2eKDFLabel+" "+s.tunnelID+" "+direction, 32)
+	if err != nil {
+		return nil, fmt.Errorf("e2e key derivation: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// E2EConn 加密连接：写入的数据分帧加密，读取时校验并解密
+// 每个方向的 nonce 为递增计数器，密钥每连接独立，不会重复
+type E2EConn struct {
+	net.Conn
+	session *E2ESession
+
+	handshakeMu   sync.Mutex
+	handshakeDone bool
+	handshakeErr  error
+
+	writeMu   sync.Mutex
+	seal      cipher.AEAD
+	sealCount uint64
+
+	open      cipher.AEAD
+	openCount uint64
+	readBuf   []byte // 已解密未读取的明文
+	frame     []byte
+}
+
+// Handshake 交换盐值并派生连接密钥，首次读写时自动调用；失败后连接不可用
+func (c *E2EConn) Handshake() error {
+	c.handshakeMu.Lock()
+	defer c.handshakeMu.Unlock()
+	if !c.handshakeDone {
+		c.seal, c.open, c.handshakeErr = c.session.handshake(c.Conn)
+		c.handshakeDone = true
+	}
+	return c.handshakeErr
+}
+
+// Write 加密并写入，超过单帧上限时拆分为多帧
+func (c *E2EConn) Write(b []byte) (int, error) {
+	if err := c.Handshake(); err != nil {
+		return 0, err
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	written := 0
+	for len(b) > 0 {
+		chunk := b
+		if len(chunk) > e2eMaxPlaintext {
+			chunk = chunk[:e2eMaxPlaintext]
+		}
+
+		frame := make([]byte, 2, 2+len(chunk)+c.seal.Overhead())
+		frame = c.seal.Seal(frame, c.nonce(c.sealCount), chunk, nil)
+		binary.BigEndian.PutUint16(frame[:2], uint16(len(frame)-2))
+		c.sealCount++
+
+		if _, err := c.Conn.Write(frame); err != nil {
+			return written, err
+		}
+		written += len(chunk)
+		b = b[len(chunk):]
+	}
+	return written, nil
+}
+
+// Read 读取并解密一帧，调用方缓冲区不足时保留剩余明文
+func (c *E2EConn) Read(b []byte) (int, error) {
+	if err := c.Handshake(); err != nil {
+		return 0, err
+	}
+	if len(c.readBuf) == 0 {
+		var header [2]byte
+		if _, err := io.ReadFull(c.Conn, header[:]); err != nil {
+			return 0, err
+		}
+		size := int(binary.BigEndian.Uint16(header[:]))
+		if size < c.open.Overhead() {
+			return 0, ErrE2EAuthFailed
+		}
+		if cap(c.frame) < size {
+			c.frame = make([]byte, size)
+		}
+		frame := c.frame[:size]
+		if _, err := io.ReadFull(c.Conn, frame); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+
+		plain, err := c.open.Open(frame[:0], c.nonce(c.openCount), frame, nil)
+		if err != nil {
+			return 0, ErrE2EAuthFailed
+		}
+		c.openCount++
+		c.readBuf = plain
+	}
+
+	n := copy(b, c.readBuf)
+	c.readBuf = c.readBuf[n:]
+	return n, nil
+}
+
+// nonce 由帧序号构造 12 字节 nonce
+func (c *E2EConn) nonce(counter uint64) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[4:], counter)
+	return nonce
+}
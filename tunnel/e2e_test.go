@@ -0,0 +1,116 @@
+package tunnel
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"testing"
+)
+
+// e2ePair 在 net.Pipe 两端建立 IH / AH 加密连接，relay 记录 IH→AH 方向经过中继的原始字节
+func e2ePair(t *testing.T, ihKey, ahKey *E2EKey, relay *bytes.Buffer) (ih, ah net.Conn) {
+	t.Helper()
+	ihRaw, relayIH := net.Pipe()
+	relayAH, ahRaw := net.Pipe()
+	t.Cleanup(func() {
+		ihRaw.Close()
+		ahRaw.Close()
+	})
+
+	// 模拟中继：双向转发并记录 IH→AH 的数据
+	go func() {
+		io.Copy(relayAH, io.TeeReader(relayIH, relay))
+		relayAH.Close()
+	}()
+	go func() {
+		io.Copy(relayIH, relayAH)
+		relayIH.Close()
+	}()
+
+	ihSession, err := ihKey.Session("tun-1", ahKey.PublicKey(), E2ESideIH)
+	if err != nil {
+		t.Fatalf("ih session: %v", err)
+	}
+	ahSession, err := ahKey.Session("tun-1", ihKey.PublicKey(), E2ESideAH)
+	if err != nil {
+		t.Fatalf("ah session: %v", err)
+	}
+
+	// 握手在首次读写时进行，Wrap 本身不阻塞
+	return ihSession.Wrap(ihRaw), ahSession.Wrap(ahRaw)
+}
+
+func TestE2EConn_RoundTrip(t *testing.T) {
+	ihKey, _ := GenerateE2EKey()
+	ahKey, _ := GenerateE2EKey()
+	var relay bytes.Buffer
+	ih, ah := e2ePair(t, ihKey, ahKey, &relay)
+
+	// 超过单帧上限的数据拆分为多帧
+	request := bytes.Repeat([]byte("GET /secret HTTP/1.1\r\n"), 2000)
+	go func() {
+		ih.Write(request)
+	}()
+	got := make([]byte, len(request))
+	if _, err := io.ReadFull(ah, got); err != nil {
+		t.Fatalf("ah read: %v", err)
+	}
+	if !bytes.Equal(got, request) {
+		t.Fatal("ah received different plaintext")
+	}
+
+	go func() {
+		ah.Write([]byte("HTTP/1.1 200 OK\r\n\r\n"))
+	}()
+	reply := make([]byte, 19)
+	if _, err := io.ReadFull(ih, reply); err != nil {
+		t.Fatalf("ih read: %v", err)
+	}
+	if string(reply) != "HTTP/1.1 200 OK\r\n\r\n" {
+		t.Errorf("ih received %q", reply)
+	}
+
+	// 中继只看到密文
+	if bytes.Contains(relay.Bytes(), []byte("GET /secret")) {
+		t.Error("relay observed plaintext")
+	}
+}
+
+func TestE2EConn_KeyMismatch(t *testing.T) {
+	ihKey, _ := GenerateE2EKey()
+	ahKey, _ := GenerateE2EKey()
+	otherKey, _ := GenerateE2EKey()
+
+	ihRaw, ahRaw := net.Pipe()
+	defer ihRaw.Close()
+	defer ahRaw.Close()
+
+	// IH 使用了错误的 AH 公钥（如中间人替换）
+	ihSession, _ := ihKey.Session("tun-1", otherKey.PublicKey(), E2ESideIH)
+	ahSession, _ := ahKey.Session("tun-1", ihKey.PublicKey(), E2ESideAH)
+
+	ih, ah := ihSession.Wrap(ihRaw), ahSession.Wrap(ahRaw)
+
+	go ih.Write([]byte("hello"))
+	if _, err := ah.Read(make([]byte, 16)); !errors.Is(err, ErrE2EAuthFailed) {
+		t.Errorf("read with mismatched key: err = %v, want ErrE2EAuthFailed", err)
+	}
+}
+
+func TestParseE2EPublicKey(t *testing.T) {
+	key, _ := GenerateE2EKey()
+	if _, err := ParseE2EPublicKey(key.PublicKey()); err != nil {
+		t.Errorf("valid key: %v", err)
+	}
+	for _, invalid := range []string{"", "not base64!", "AAAA"} {
+		if _, err := ParseE2EPublicKey(invalid); err == nil {
+			t.Errorf("ParseE2EPublicKey(%q) should fail", invalid)
+		}
+	}
+
+	tun := &Tunnel{Metadata: map[string]interface{}{MetadataKeyE2EPublicKey: key.PublicKey()}}
+	if !tun.IsEndToEnd() || tun.E2EAgentPublicKey() != "" {
+		t.Error("tunnel with IH key should be end-to-end without agent key")
+	}
+}
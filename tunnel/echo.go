@@ -0,0 +1,349 @@
+package tunnel
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"time"
+)
+
+// NewEchoConn 返回内置回显服务的连接：写入的数据原样从该连接读回
+// AH 对回显服务不拨号目标，以该连接代替目标连接，用于区分隧道问题与应用问题
+func NewEchoConn() net.Conn {
+	client, server := net.Pipe()
+	go func() {
+		defer server.Close()
+		io.Copy(server, server)
+	}()
+	return client
+}
+
+// 诊断帧: [类型 1 字节][序号 8 字节, 大端][负载长度 4 字节, 大端][负载]
+// 回显服务不解析帧，IH 端按帧匹配探测与校验吞吐数据
+const (
+	diagFrameProbe  byte = 'P'
+	diagFrameData   byte = 'D'
+	diagFrameHeader      = 1 + 8 + 4
+	diagMaxPayload       = 1 << 20
+)
+
+// DiagnosticsConfig 隧道诊断参数，零值字段使用默认值
+type DiagnosticsConfig struct {
+	// Probes RTT 探测次数（默认 20）
+	Probes int
+	// ProbeInterval 探测间隔（默认 100ms）
+	ProbeInterval time.Duration
+	// ProbeTimeout 单个探测等待回显的超时，超时计为丢失（默认 2s）
+	ProbeTimeout time.Duration
+	// SetupTimeout 首个探测的超时，包含 AH 配对与回显服务就绪（默认 10s）
+	SetupTimeout time.Duration
+	// ThroughputBytes 吞吐测试发送的字节数（默认 4 MiB），负数跳过吞吐测试
+	ThroughputBytes int64
+	// ChunkSize 吞吐测试每帧负载字节数（默认 32 KiB，最大 1 MiB）
+	ChunkSize int
+	// ThroughputTimeout 吞吐测试的最长时间，超时按已回显的字节计算（默认 30s）
+	ThroughputTimeout time.Duration
+}
+
+func (c *DiagnosticsConfig) withDefaults() DiagnosticsConfig {
+	cfg := DiagnosticsConfig{}
+	if c != nil {
+		cfg = *c
+	}
+	if cfg.Probes <= 0 {
+		cfg.Probes = 20
+	}
+	if cfg.ProbeInterval <= 0 {
+		cfg.ProbeInterval = 100 * time.Millisecond
+	}
+	if cfg.ProbeTimeout <= 0 {
+		cfg.ProbeTimeout = 2 * time.Second
+	}
+	if cfg.SetupTimeout <= 0 {
+		cfg.SetupTimeout = 10 * time.Second
+	}
+	if cfg.ThroughputBytes == 0 {
+		cfg.ThroughputBytes = 4 << 20
+	}
+	if cfg.ChunkSize <= 0 {
+		cfg.ChunkSize = 32 << 10
+	}
+	cfg.ChunkSize = min(cfg.ChunkSize, diagMaxPayload)
+	if cfg.ThroughputTimeout <= 0 {
+		cfg.ThroughputTimeout = 30 * time.Second
+	}
+	return cfg
+}
+
+// DiagnosticsReport 隧道诊断结果
+type DiagnosticsReport struct {
+	// Setup 首个探测的往返时间（含 AH 配对与回显服务就绪）
+	Setup time.Duration `json:"setup"`
+
+	ProbesSent     int           `json:"probes_sent"`
+	ProbesReceived int           `json:"probes_received"`
+	Loss           float64       `json:"loss"` // 超时未回显的探测比例
+	RTTMin         time.Duration `json:"rtt_min"`
+	RTTAvg         time.Duration `json:"rtt_avg"`
+	RTTMax         time.Duration `json:"rtt_max"`
+	Jitter         time.Duration `json:"jitter"` // 相邻 RTT 差值的平均
+
+	BytesSent   int64         `json:"bytes_sent,omitempty"`
+	BytesEchoed int64         `json:"bytes_echoed,omitempty"`
+	Corrupted   int           `json:"corrupted,omitempty"`  // 回显内容不一致的数据帧
+	Elapsed     time.Duration `json:"elapsed,omitempty"`    // 吞吐测试耗时
+	Throughput  float64       `json:"throughput,omitempty"` // 回显字节/秒
+}
+
+// Healthy 探测无丢失、吞吐数据完整回显
+func (r *DiagnosticsReport) Healthy() bool {
+	return r.ProbesReceived == r.ProbesSent && r.Corrupted == 0 && r.BytesEchoed == r.BytesSent
+}
+
+// Print 输出可读的诊断报告
+func (r *DiagnosticsReport) Print(w io.Writer) {
+	fmt.Fprintf(w, "Tunnel diagnostics\n")
+	fmt.Fprintf(w, "  Setup:       %v\n", r.Setup.Round(time.Microsecond))
+	fmt.Fprintf(w, "  Probes:      %d sent, %d received, %.1f%% loss\n", r.ProbesSent, r.ProbesReceived, r.Loss*100)
+	if r.ProbesReceived > 0 {
+		fmt.Fprintf(w, "  RTT:         min %v / avg %v / max %v, jitter %v\n",
+			r.RTTMin.Round(time.Microsecond), r.RTTAvg.Round(time.Microsecond),
+			r.RTTMax.Round(time.Microsecond), r.Jitter.Round(time.Microsecond))
+	}
+	if r.BytesSent > 0 {
+		fmt.Fprintf(w, "  Throughput:  %.2f MiB/s (%d/%d bytes echoed in %v, %d corrupted frames)\n",
+			r.Throughput/(1<<20), r.BytesEchoed, r.BytesSent, r.Elapsed.Round(time.Millisecond), r.Corrupted)
+	}
+	if r.Healthy() {
+		fmt.Fprintf(w, "  Result:      OK\n")
+	} else {
+		fmt.Fprintf(w, "  Result:      DEGRADED\n")
+	}
+}
+
+// diagFrame 读到的回显帧
+type diagFrame struct {
+	typ     byte
+	seq     uint64
+	n       int
+	intact  bool // 数据帧负载与发送内容一致
+	arrived time.Time
+}
+
+// RunDiagnostics 经连接到回显服务的隧道测量建立耗时、RTT、丢失与吞吐
+// conn 为 IH 端的数据平面连接（或多路复用流），返回时关闭
+func RunDiagnostics(ctx context.Context, conn io.ReadWriteCloser, cfg *DiagnosticsConfig) (*DiagnosticsReport, error) {
+	c := cfg.withDefaults()
+	defer conn.Close()
+
+	frames := make(chan diagFrame, 64)
+	readErr := make(chan error, 1)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		readErr <- readDiagFrames(conn, frames, done)
+	}()
+
+	// wait 等待指定序号的探测回显，其他帧（迟到的探测）丢弃
+	wait := func(seq uint64, timeout time.Duration) (time.Time, error) {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return time.Time{}, ctx.Err()
+			case err := <-readErr:
+				return time.Time{}, fmt.Errorf("tunnel closed: %w", err)
+			case <-timer.C:
+				return time.Time{}, nil
+			case f := <-frames:
+				if f.typ == diagFrameProbe && f.seq == seq {
+					return f.arrived, nil
+				}
+			}
+		}
+	}
+
+	report := &DiagnosticsReport{}
+
+	// 首个探测：隧道建立后数据缓存在中继直到 AH 配对，其往返时间即建立耗时
+	start := time.Now()
+	if err := writeDiagFrame(conn, diagFrameProbe, 0, nil); err != nil {
+		return nil, fmt.Errorf("send probe: %w", err)
+	}
+	arrived, err := wait(0, c.SetupTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if arrived.IsZero() {
+		return nil, fmt.Errorf("no echo within %v, check that the service is an AH echo service", c.SetupTimeout)
+	}
+	report.Setup = arrived.Sub(start)
+
+	var rtts []time.Duration
+	for seq := uint64(1); seq <= uint64(c.Probes); seq++ {
+		sentAt := time.Now()
+		if err := writeDiagFrame(conn, diagFrameProbe, seq, nil); err != nil {
+			return nil, fmt.Errorf("send probe: %w", err)
+		}
+		report.ProbesSent++
+		arrived, err := wait(seq, c.ProbeTimeout)
+		if err != nil {
+			return nil, err
+		}
+		if !arrived.IsZero() {
+			rtts = append(rtts, arrived.Sub(sentAt))
+		}
+		if seq < uint64(c.Probes) {
+			if rest := c.ProbeInterval - time.Since(sentAt); rest > 0 {
+				select {
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				case <-time.After(rest):
+				}
+			}
+		}
+	}
+	report.ProbesReceived = len(rtts)
+	report.Loss = float64(report.ProbesSent-report.ProbesReceived) / float64(report.ProbesSent)
+	summarizeRTTs(report, rtts)
+
+	if c.ThroughputBytes < 0 {
+		return report, nil
+	}
+	if err := measureThroughput(ctx, conn, &c, frames, readErr, report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// measureThroughput 连续写入数据帧并统计回显，完整回显或超时后结束
+func measureThroughput(ctx context.Context, conn io.Writer, c *DiagnosticsConfig, frames <-chan diagFrame, readErr <-chan error, report *DiagnosticsReport) error {
+	writeErr := make(chan error, 1)
+	start := time.Now()
+	go func() {
+		payload := make([]byte, c.ChunkSize)
+		var sent int64
+		for seq := uint64(0); sent < c.ThroughputBytes; seq++ {
+			n := int(min(int64(c.ChunkSize), c.ThroughputBytes-sent))
+			fillDiagPayload(payload[:n], seq)
+			if err := writeDiagFrame(conn, diagFrameData, seq, payload[:n]); err != nil {
+				writeErr <- err
+				return
+			}
+			sent += int64(n)
+		}
+	}()
+	report.BytesSent = c.ThroughputBytes
+
+	timer := time.NewTimer(c.ThroughputTimeout)
+	defer timer.Stop()
+	for report.BytesEchoed < report.BytesSent {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-writeErr:
+			return fmt.Errorf("send data: %w", err)
+		case err := <-readErr:
+			return fmt.Errorf("tunnel closed: %w", err)
+		case <-timer.C:
+			report.Elapsed = time.Since(start)
+			report.Throughput = float64(report.BytesEchoed) / report.Elapsed.Seconds()
+			return nil
+		case f := <-frames:
+			if f.typ != diagFrameData {
+				continue
+			}
+			report.BytesEchoed += int64(f.n)
+			if !f.intact {
+				report.Corrupted++
+			}
+		}
+	}
+	report.Elapsed = time.Since(start)
+	report.Throughput = float64(report.BytesEchoed) / report.Elapsed.Seconds()
+	return nil
+}
+
+// summarizeRTTs 计算 RTT 统计
+func summarizeRTTs(report *DiagnosticsReport, rtts []time.Duration) {
+	if len(rtts) == 0 {
+		return
+	}
+	var total, deltas time.Duration
+	report.RTTMin = time.Duration(math.MaxInt64)
+	for i, rtt := range rtts {
+		total += rtt
+		report.RTTMin = min(report.RTTMin, rtt)
+		report.RTTMax = max(report.RTTMax, rtt)
+		if i > 0 {
+			d := rtt - rtts[i-1]
+			if d < 0 {
+				d = -d
+			}
+			deltas += d
+		}
+	}
+	report.RTTAvg = total / time.Duration(len(rtts))
+	if len(rtts) > 1 {
+		report.Jitter = deltas / time.Duration(len(rtts)-1)
+	}
+}
+
+func writeDiagFrame(w io.Writer, typ byte, seq uint64, payload []byte) error {
+	buf := make([]byte, diagFrameHeader+len(payload))
+	buf[0] = typ
+	binary.BigEndian.PutUint64(buf[1:9], seq)
+	binary.BigEndian.PutUint32(buf[9:13], uint32(len(payload)))
+	copy(buf[diagFrameHeader:], payload)
+	_, err := w.Write(buf)
+	return err
+}
+
+// readDiagFrames 持续读取回显帧直到连接关闭或诊断结束
+func readDiagFrames(r io.Reader, frames chan<- diagFrame, done <-chan struct{}) error {
+	header := make([]byte, diagFrameHeader)
+	var payload, expected []byte
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return err
+		}
+		f := diagFrame{
+			typ: header[0],
+			seq: binary.BigEndian.Uint64(header[1:9]),
+			n:   int(binary.BigEndian.Uint32(header[9:13])),
+		}
+		if f.typ != diagFrameProbe && f.typ != diagFrameData {
+			return errors.New("unexpected data echoed, the service is not an echo service")
+		}
+		if f.n > diagMaxPayload {
+			return fmt.Errorf("echoed frame too large: %d bytes", f.n)
+		}
+		if f.n > cap(payload) {
+			payload, expected = make([]byte, f.n), make([]byte, f.n)
+		}
+		if _, err := io.ReadFull(r, payload[:f.n]); err != nil {
+			return err
+		}
+		fillDiagPayload(expected[:f.n], f.seq)
+		f.intact = bytes.Equal(payload[:f.n], expected[:f.n])
+		f.arrived = time.Now()
+		select {
+		case frames <- f:
+		case <-done:
+			return nil
+		}
+	}
+}
+
+// fillDiagPayload 按序号生成可校验的负载
+func fillDiagPayload(b []byte, seq uint64) {
+	for i := range b {
+		b[i] = byte(seq + uint64(i))
+	}
+}
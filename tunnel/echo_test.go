@@ -0,0 +1,114 @@
+package tunnel
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunDiagnostics_Echo(t *testing.T) {
+	report, err := RunDiagnostics(context.Background(), NewEchoConn(), &DiagnosticsConfig{
+		Probes:          5,
+		ProbeInterval:   time.Millisecond,
+		ThroughputBytes: 100 << 10,
+		ChunkSize:       4 << 10,
+	})
+	if err != nil {
+		t.Fatalf("RunDiagnostics: %v", err)
+	}
+	if report.ProbesSent != 5 || report.ProbesReceived != 5 || report.Loss != 0 {
+		t.Errorf("probes = %d/%d loss %v, want 5/5 loss 0", report.ProbesReceived, report.ProbesSent, report.Loss)
+	}
+	if report.RTTMin <= 0 || report.RTTMin > report.RTTAvg || report.RTTAvg > report.RTTMax {
+		t.Errorf("rtt min/avg/max = %v/%v/%v", report.RTTMin, report.RTTAvg, report.RTTMax)
+	}
+	if report.BytesEchoed != 100<<10 || report.Corrupted != 0 || report.Throughput <= 0 {
+		t.Errorf("throughput: echoed %d corrupted %d rate %v", report.BytesEchoed, report.Corrupted, report.Throughput)
+	}
+	if !report.Healthy() {
+		t.Error("report should be healthy")
+	}
+
+	var out bytes.Buffer
+	report.Print(&out)
+	if !strings.Contains(out.String(), "Result:      OK") {
+		t.Errorf("report output:\n%s", out.String())
+	}
+}
+
+// lossyEcho 回显帧但丢弃指定序号的探测、篡改指定序号的数据帧
+func lossyEcho(conn net.Conn, dropProbe, corruptData uint64) {
+	defer conn.Close()
+	header := make([]byte, diagFrameHeader)
+	for {
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+		payload := make([]byte, binary.BigEndian.Uint32(header[9:13]))
+		if _, err := io.ReadFull(conn, payload); err != nil {
+			return
+		}
+		seq := binary.BigEndian.Uint64(header[1:9])
+		switch {
+		case header[0] == diagFrameProbe && seq == dropProbe:
+			continue
+		case header[0] == diagFrameData && seq == corruptData:
+			payload[0]++
+		}
+		if _, err := conn.Write(append(header, payload...)); err != nil {
+			return
+		}
+	}
+}
+
+func TestRunDiagnostics_LossAndCorruption(t *testing.T) {
+	client, server := net.Pipe()
+	go lossyEcho(server, 3, 1)
+
+	report, err := RunDiagnostics(context.Background(), client, &DiagnosticsConfig{
+		Probes:          4,
+		ProbeInterval:   time.Millisecond,
+		ProbeTimeout:    50 * time.Millisecond,
+		ThroughputBytes: 16 << 10,
+		ChunkSize:       4 << 10,
+	})
+	if err != nil {
+		t.Fatalf("RunDiagnostics: %v", err)
+	}
+	if report.ProbesReceived != 3 || report.Loss != 0.25 {
+		t.Errorf("probes received %d loss %v, want 3 and 0.25", report.ProbesReceived, report.Loss)
+	}
+	if report.Corrupted != 1 || report.BytesEchoed != 16<<10 {
+		t.Errorf("corrupted %d echoed %d, want 1 and %d", report.Corrupted, report.BytesEchoed, 16<<10)
+	}
+	if report.Healthy() {
+		t.Error("report should not be healthy")
+	}
+}
+
+func TestRunDiagnostics_NotEcho(t *testing.T) {
+	// 不回显的服务：首个探测超时
+	client, server := net.Pipe()
+	go io.Copy(io.Discard, server)
+	defer server.Close()
+
+	_, err := RunDiagnostics(context.Background(), client, &DiagnosticsConfig{SetupTimeout: 50 * time.Millisecond})
+	if err == nil || !strings.Contains(err.Error(), "echo service") {
+		t.Fatalf("err = %v, want setup timeout", err)
+	}
+
+	// 返回其他数据的服务
+	client, server = net.Pipe()
+	defer server.Close()
+	go io.Copy(io.Discard, server)
+	go server.Write([]byte("HTTP/1.1 400 Bad Request\r\n\r\n"))
+	_, err = RunDiagnostics(context.Background(), client, nil)
+	if err == nil || !strings.Contains(err.Error(), "not an echo service") {
+		t.Fatalf("err = %v, want not an echo service", err)
+	}
+}
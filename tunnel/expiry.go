@@ -0,0 +1,70 @@
+package tunnel
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// 到期提醒事件类型（SSE event 名）
+const (
+	EventSessionExpiring = "session_expiring"
+	EventTunnelExpiring  = "tunnel_expiring"
+)
+
+// ExpiryEvent 会话/隧道即将到期提醒
+// Controller 在到期前（提前量可配置）推送给所属 IH，客户端据此主动刷新会话或重建隧道
+type ExpiryEvent struct {
+	Type      string    `json:"type"` // session_expiring / tunnel_expiring
+	ClientID  string    `json:"client_id"`
+	TunnelID  string    `json:"tunnel_id,omitempty"` // 仅 tunnel_expiring
+	ExpiresAt time.Time `json:"expires_at"`
+	// Renewable 会话可通过刷新延长；为 false 时已达到绝对生命周期上限，需重新握手
+	Renewable bool      `json:"renewable"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// NotifyExpiry 发送到期提醒给特定客户端（agentID 为 IH 的客户端 ID）
+// 优先投递到该客户端的 IH 作用域订阅，其次是以客户端 ID 订阅通用事件流的旧版 IH
+func (n *Notifier) NotifyExpiry(agentID string, event *ExpiryEvent) error {
+	if event.Timestamp.IsZero() {
+		event.Timestamp = n.clock.Now()
+	}
+
+	client, ok := n.clients.load(clientKey(agentID))
+	if !ok {
+		client, ok = n.clients.load(agentID)
+	}
+	if !ok {
+		return fmt.Errorf("client not found: %s", agentID)
+	}
+
+	select {
+	case client.ExpiryChannel <- event:
+		n.logger.Debug("Expiry event sent to client",
+			"agent_id", agentID,
+			"event_type", event.Type,
+			"expires_at", event.ExpiresAt,
+		)
+		return nil
+	case <-client.Done:
+		return fmt.Errorf("client disconnected: %s", agentID)
+	default:
+		return fmt.Errorf("client expiry channel full: %s", agentID)
+	}
+}
+
+// sendExpiryEvent 发送到期提醒到客户端
+func (n *Notifier) sendExpiryEvent(w http.ResponseWriter, flusher http.Flusher, event *ExpiryEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("marshal expiry event: %w", err)
+	}
+
+	// SSE 格式：event: session_expiring|tunnel_expiring\ndata: <ExpiryEvent JSON>\n\n
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+	flusher.Flush()
+
+	return nil
+}
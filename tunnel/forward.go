@@ -0,0 +1,303 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 端口转发（ssh -L / -R 语义），基于现有隧道原语：
+//   - 本地转发（-L）：IH 在本地监听，每个连接经隧道到达服务目标，等同普通隧道
+//   - 反向转发（-R）：AH 在其主机上监听，连接经多路复用隧道转回 IH，由 IH 拨号其所在网络中的目标；
+//     须由匹配策略显式允许（Policy.ReverseForward），IH 侧目标地址不会发送给 Controller 或 AH
+const (
+	// MetadataKeyReverseForward 隧道 Metadata 中反向转发的 AH 监听地址（host:port）
+	MetadataKeyReverseForward = "reverse_forward"
+
+	// defaultForwardBindHost 未指定监听地址时绑定回环地址（同 ssh 默认）
+	defaultForwardBindHost = "localhost"
+)
+
+// ReverseForwardAddr 反向转发隧道的 AH 监听地址，普通隧道为空
+func (t *Tunnel) ReverseForwardAddr() string {
+	return t.metadataString(MetadataKeyReverseForward)
+}
+
+// IsReverseForward 隧道是否为反向转发（AH 监听、IH 拨号目标）
+func (t *Tunnel) IsReverseForward() bool {
+	return t.ReverseForwardAddr() != ""
+}
+
+// ForwardSpec 一条端口转发
+type ForwardSpec struct {
+	// Remote 为 true 时是反向转发（-R）
+	Remote bool
+	// BindAddr 监听地址（host:port）：本地转发为 IH 本机，反向转发为 AH 主机；host 为空表示所有地址
+	BindAddr string
+	// ServiceID 隧道对应的服务：本地转发为访问目标，反向转发用于选择 AH 与评估策略
+	ServiceID string
+	// TargetHost / TargetPort 本地转发时为模式化服务的具体目标（可选），反向转发时为 IH 侧拨号的目标（必填）
+	TargetHost string
+	TargetPort int
+}
+
+// ParseLocalForward 解析本地转发：[bind_address:]port:service_id[:host:hostport]
+// IPv6 地址以方括号包围，bind_address 为 "*" 或空时监听所有地址
+func ParseLocalForward(spec string) (*ForwardSpec, error) {
+	fields, err := splitForwardSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+	f := &ForwardSpec{}
+	switch len(fields) {
+	case 2, 3:
+		if len(fields) == 2 {
+			fields = append([]string{defaultForwardBindHost}, fields...)
+		}
+		if f.BindAddr, err = forwardBindAddr(fields[0], fields[1]); err != nil {
+			return nil, fmt.Errorf("invalid local forward %q: %w", spec, err)
+		}
+		f.ServiceID = fields[2]
+	case 4, 5:
+		if err := f.parseWithTarget(fields); err != nil {
+			return nil, fmt.Errorf("invalid local forward %q: %w", spec, err)
+		}
+	default:
+		return nil, fmt.Errorf("invalid local forward %q: want [bind_address:]port:service_id[:host:hostport]", spec)
+	}
+	if f.ServiceID == "" {
+		return nil, fmt.Errorf("invalid local forward %q: service_id is required", spec)
+	}
+	return f, nil
+}
+
+// ParseRemoteForward 解析反向转发：[bind_address:]port:service_id:host:hostport
+// AH 在 bind_address:port 上监听（默认回环地址），连接转回 IH 后由 IH 拨号 host:hostport
+func ParseRemoteForward(spec string) (*ForwardSpec, error) {
+	fields, err := splitForwardSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) != 4 && len(fields) != 5 {
+		return nil, fmt.Errorf("invalid remote forward %q: want [bind_address:]port:service_id:host:hostport", spec)
+	}
+	f := &ForwardSpec{Remote: true}
+	if err := f.parseWithTarget(fields); err != nil {
+		return nil, fmt.Errorf("invalid remote forward %q: %w", spec, err)
+	}
+	if f.ServiceID == "" {
+		return nil, fmt.Errorf("invalid remote forward %q: service_id is required", spec)
+	}
+	return f, nil
+}
+
+// parseWithTarget 解析 [bind_address:]port:service_id:host:hostport
+func (f *ForwardSpec) parseWithTarget(fields []string) error {
+	if len(fields) == 4 {
+		fields = append([]string{defaultForwardBindHost}, fields...)
+	}
+	var err error
+	if f.BindAddr, err = forwardBindAddr(fields[0], fields[1]); err != nil {
+		return err
+	}
+	f.ServiceID = fields[2]
+	if fields[3] == "" {
+		return errors.New("target host is required")
+	}
+	f.TargetHost = fields[3]
+	if f.TargetPort, err = parseForwardPort(fields[4]); err != nil {
+		return fmt.Errorf("target port: %w", err)
+	}
+	return nil
+}
+
+// Target IH 侧目标地址（反向转发）或模式化服务目标（本地转发），未指定时为空
+func (f *ForwardSpec) Target() string {
+	if f.TargetHost == "" {
+		return ""
+	}
+	return net.JoinHostPort(f.TargetHost, strconv.Itoa(f.TargetPort))
+}
+
+// String 以命令行语法输出，如 "-L localhost:8080:svc-web"、"-R localhost:9000:svc-ci:127.0.0.1:3000"
+func (f *ForwardSpec) String() string {
+	flag := "-L"
+	if f.Remote {
+		flag = "-R"
+	}
+	s := flag + " " + f.BindAddr + ":" + f.ServiceID
+	if target := f.Target(); target != "" {
+		s += ":" + target
+	}
+	return s
+}
+
+// ValidateReverseForwardAddr 校验反向转发的 AH 监听地址：host 为空、localhost 或 IP 字面量，端口 1-65535
+func ValidateReverseForwardAddr(addr string) error {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid reverse forward address %q: %w", addr, err)
+	}
+	if host != "" && host != "localhost" && net.ParseIP(host) == nil {
+		return fmt.Errorf("invalid reverse forward address %q: host must be localhost or an IP address", addr)
+	}
+	if _, err := parseForwardPort(port); err != nil {
+		return fmt.Errorf("invalid reverse forward address %q: %w", addr, err)
+	}
+	return nil
+}
+
+// IsLoopbackForwardAddr 监听地址是否只绑定回环地址；绑定其他地址相当于 sshd 的 GatewayPorts，由 AH 决定是否允许
+func IsLoopbackForwardAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// ServeForward 接受 ln 上的连接，为每个连接调用 open 打开隧道侧连接并双向转发，
+// 直到 ctx 取消（返回 nil）或 ln 出错；open 失败只关闭该连接。返回前等待所有转发结束
+//
+// 本地转发的 open 建立数据平面连接（或在多路复用会话上打开流），反向转发时 AH 以 MuxSession.OpenStream 作为 open
+func ServeForward(ctx context.Context, ln net.Listener, open func(ctx context.Context) (io.ReadWriteCloser, error)) error {
+	accept := func() (io.ReadWriteCloser, error) {
+		return ln.Accept()
+	}
+	return serveForward(ctx, ln.Close, accept, func(conn io.ReadWriteCloser) {
+		peer, err := open(ctx)
+		if err != nil {
+			conn.Close()
+			return
+		}
+		joinConns(ctx, conn, peer)
+	})
+}
+
+// ServeReverseForward IH 侧反向转发：接受 AH 在多路复用会话上打开的流，为每个流调用 dial 拨号本端目标并双向转发，
+// 直到 ctx 取消（返回 nil）或会话关闭；dial 失败只关闭该流。返回前等待所有转发结束
+func ServeReverseForward(ctx context.Context, session *MuxSession, dial func(ctx context.Context) (net.Conn, error)) error {
+	accept := func() (io.ReadWriteCloser, error) {
+		return session.AcceptStream()
+	}
+	return serveForward(ctx, session.Close, accept, func(stream io.ReadWriteCloser) {
+		target, err := dial(ctx)
+		if err != nil {
+			stream.Close()
+			return
+		}
+		joinConns(ctx, stream, target)
+	})
+}
+
+// serveForward 接受循环：ctx 取消时调用 stop 结束 accept
+func serveForward(ctx context.Context, stop func() error, accept func() (io.ReadWriteCloser, error), handle func(io.ReadWriteCloser)) error {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			stop()
+		case <-done:
+		}
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		conn, err := accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			handle(conn)
+		}()
+	}
+}
+
+// joinConns 双向转发，任一方向结束或 ctx 取消后关闭两端并等待另一方向结束
+func joinConns(ctx context.Context, a, b io.ReadWriteCloser) {
+	done := make(chan struct{}, 2)
+	go func() {
+		copyConn(a, b)
+		done <- struct{}{}
+	}()
+	go func() {
+		copyConn(b, a)
+		done <- struct{}{}
+	}()
+	remaining := 2
+	select {
+	case <-done:
+		remaining--
+	case <-ctx.Done():
+	}
+	a.Close()
+	b.Close()
+	for ; remaining > 0; remaining-- {
+		<-done
+	}
+}
+
+// splitForwardSpec 按 ':' 切分，方括号内的 IPv6 地址作为一个字段（去掉方括号）
+func splitForwardSpec(spec string) ([]string, error) {
+	var fields []string
+	for rest := spec; ; {
+		if strings.HasPrefix(rest, "[") {
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid forward %q: unclosed '['", spec)
+			}
+			fields = append(fields, rest[1:end])
+			rest = rest[end+1:]
+			if rest == "" {
+				return fields, nil
+			}
+			if rest[0] != ':' {
+				return nil, fmt.Errorf("invalid forward %q: expected ':' after ']'", spec)
+			}
+			rest = rest[1:]
+			continue
+		}
+		field, next, found := strings.Cut(rest, ":")
+		fields = append(fields, field)
+		if !found {
+			return fields, nil
+		}
+		rest = next
+	}
+}
+
+// forwardBindAddr 组合监听地址，"*" 表示所有地址
+func forwardBindAddr(host, port string) (string, error) {
+	if host == "*" {
+		host = ""
+	}
+	if _, err := parseForwardPort(port); err != nil {
+		return "", fmt.Errorf("listen port: %w", err)
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// parseForwardPort 解析端口（1-65535）
+func parseForwardPort(s string) (int, error) {
+	port, err := strconv.Atoi(s)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("invalid port %q", s)
+	}
+	return port, nil
+}
@@ -0,0 +1,195 @@
+package tunnel
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestParseLocalForward(t *testing.T) {
+	tests := []struct {
+		spec   string
+		bind   string
+		svc    string
+		target string
+	}{
+		{"8080:svc-web", "localhost:8080", "svc-web", ""},
+		{"0.0.0.0:8080:svc-web", "0.0.0.0:8080", "svc-web", ""},
+		{"*:8080:svc-web", ":8080", "svc-web", ""},
+		{":8080:svc-web", ":8080", "svc-web", ""},
+		{"5433:svc-db:10.0.0.5:5432", "localhost:5433", "svc-db", "10.0.0.5:5432"},
+		{"[::1]:5433:svc-db:[fd00::5]:5432", "[::1]:5433", "svc-db", "[fd00::5]:5432"},
+	}
+	for _, tt := range tests {
+		f, err := ParseLocalForward(tt.spec)
+		if err != nil {
+			t.Errorf("%s: %v", tt.spec, err)
+			continue
+		}
+		if f.Remote || f.BindAddr != tt.bind || f.ServiceID != tt.svc || f.Target() != tt.target {
+			t.Errorf("%s: got %+v", tt.spec, f)
+		}
+	}
+
+	for _, spec := range []string{"", "svc-web", "0:svc-web", "70000:svc-web", "8080:", "8080:svc:host", "8080:svc:host:x", "[::1:8080:svc", "[::1]x:8080:svc", "a:b:c:d:e:f"} {
+		if _, err := ParseLocalForward(spec); err == nil {
+			t.Errorf("%q: expected error", spec)
+		}
+	}
+}
+
+func TestParseRemoteForward(t *testing.T) {
+	f, err := ParseRemoteForward("9000:svc-ci:127.0.0.1:3000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.Remote || f.BindAddr != "localhost:9000" || f.ServiceID != "svc-ci" || f.Target() != "127.0.0.1:3000" {
+		t.Errorf("got %+v", f)
+	}
+	if got := f.String(); got != "-R localhost:9000:svc-ci:127.0.0.1:3000" {
+		t.Errorf("String() = %q", got)
+	}
+
+	// 反向转发必须指定 IH 侧目标
+	for _, spec := range []string{"9000:svc-ci", "0.0.0.0:9000:svc-ci", "9000::127.0.0.1:3000", "9000:svc-ci::3000"} {
+		if _, err := ParseRemoteForward(spec); err == nil {
+			t.Errorf("%q: expected error", spec)
+		}
+	}
+}
+
+func TestValidateReverseForwardAddr(t *testing.T) {
+	for _, addr := range []string{"localhost:9000", "127.0.0.1:9000", "[::1]:9000", ":9000", "0.0.0.0:9000"} {
+		if err := ValidateReverseForwardAddr(addr); err != nil {
+			t.Errorf("%s: %v", addr, err)
+		}
+	}
+	for _, addr := range []string{"", "9000", "example.com:9000", "localhost:0", "localhost:http"} {
+		if err := ValidateReverseForwardAddr(addr); err == nil {
+			t.Errorf("%q: expected error", addr)
+		}
+	}
+
+	loopback := map[string]bool{"localhost:9000": true, "127.0.0.1:9000": true, "[::1]:9000": true, ":9000": false, "0.0.0.0:9000": false, "10.0.0.1:9000": false}
+	for addr, want := range loopback {
+		if got := IsLoopbackForwardAddr(addr); got != want {
+			t.Errorf("IsLoopbackForwardAddr(%s) = %v", addr, got)
+		}
+	}
+}
+
+// startEcho 启动回显服务，返回其地址
+func startEcho(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func echoRoundTrip(t *testing.T, addr, msg string) {
+	t.Helper()
+	conn, err := net.DialTimeout("tcp", addr, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+	if _, err := conn.Write([]byte(msg)); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, len(msg))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != msg {
+		t.Errorf("echo = %q, want %q", buf, msg)
+	}
+}
+
+func TestServeForward_Local(t *testing.T) {
+	target := startEcho(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- ServeForward(ctx, ln, func(ctx context.Context) (io.ReadWriteCloser, error) {
+			return net.Dial("tcp", target)
+		})
+	}()
+
+	echoRoundTrip(t, ln.Addr().String(), "hello")
+	echoRoundTrip(t, ln.Addr().String(), "again")
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("ServeForward returned %v after cancel", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("ServeForward did not return after cancel")
+	}
+}
+
+func TestServeReverseForward(t *testing.T) {
+	target := startEcho(t)
+	ih, ah := newMuxPair(t)
+
+	// IH 侧：接受 AH 打开的流并拨号本端目标
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- ServeReverseForward(ctx, ih, func(ctx context.Context) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "tcp", target)
+		})
+	}()
+
+	// AH 侧：监听并为每个连接打开流
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ahCtx, ahCancel := context.WithCancel(context.Background())
+	defer ahCancel()
+	go ServeForward(ahCtx, ln, func(ctx context.Context) (io.ReadWriteCloser, error) {
+		return ah.OpenStream()
+	})
+
+	echoRoundTrip(t, ln.Addr().String(), "reverse")
+	echoRoundTrip(t, ln.Addr().String(), "forward")
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("ServeReverseForward returned %v after cancel", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("ServeReverseForward did not return after cancel")
+	}
+	if !ih.IsClosed() {
+		t.Error("session should be closed after cancel")
+	}
+}
@@ -0,0 +1,126 @@
+package tunnel
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Heartbeat negotiation between Notifier and Subscriber: the subscriber asks for an
+// interval with the heartbeat query parameter (seconds), the notifier clamps it to
+// its bounds and reports the effective interval in the connected event
+const (
+	// HeartbeatParam is the SSE query parameter carrying the requested interval in seconds
+	HeartbeatParam = "heartbeat"
+
+	DefaultHeartbeat    = 30 * time.Second
+	DefaultMinHeartbeat = 5 * time.Second
+	DefaultMaxHeartbeat = 2 * time.Minute
+
+	// defaultMissedHeartbeats heartbeats a subscriber may miss before reconnecting
+	defaultMissedHeartbeats = 3
+)
+
+// errHeartbeatTimeout the stream stayed silent for longer than the missed-heartbeat budget
+var errHeartbeatTimeout = errors.New("missed heartbeats, reconnecting")
+
+// ParseHeartbeat parses the heartbeat query parameter: whole seconds ("15") or a
+// Go duration ("15s"). Empty or invalid values return 0 (use the server default)
+func ParseHeartbeat(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(value); err == nil {
+		if secs <= 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if d, err := time.ParseDuration(value); err == nil && d > 0 {
+		return d
+	}
+	return 0
+}
+
+// SubscribeOptions per-connection subscription options
+type SubscribeOptions struct {
+	// LastEventID replays journaled events after this ID (Last-Event-ID header)
+	LastEventID string
+	// Heartbeat interval requested by the subscriber; 0 uses the notifier default,
+	// other values are clamped to [MinHeartbeat, MaxHeartbeat]
+	Heartbeat time.Duration
+	// Capabilities advertised by the subscriber (CapabilitiesHeader); nil if it did not advertise
+	Capabilities Capabilities
+	// RateLimit limits tunnel and service events for this subscriber; nil uses NotifierConfig.RateLimit
+	RateLimit *EventRateLimit
+}
+
+// heartbeatFor returns the interval to use for a subscriber that requested requested
+func (n *Notifier) heartbeatFor(requested time.Duration) time.Duration {
+	switch {
+	case requested <= 0:
+		return n.heartbeat
+	case requested < n.minHeartbeat:
+		return n.minHeartbeat
+	case requested > n.maxHeartbeat:
+		return n.maxHeartbeat
+	default:
+		return requested
+	}
+}
+
+// heartbeatWatchdog cancels a stream that stays silent (no events, no heartbeat
+// comments) for longer than missed heartbeat intervals. A nil watchdog is disabled
+type heartbeatWatchdog struct {
+	mu      sync.Mutex
+	timer   *time.Timer
+	timeout time.Duration
+	expired atomic.Bool
+}
+
+// newHeartbeatWatchdog starts a watchdog calling onExpire after timeout of silence
+func newHeartbeatWatchdog(timeout time.Duration, onExpire func()) *heartbeatWatchdog {
+	w := &heartbeatWatchdog{timeout: timeout}
+	w.timer = time.AfterFunc(timeout, func() {
+		w.expired.Store(true)
+		onExpire()
+	})
+	return w
+}
+
+// alive records stream activity, restarting the silence timer
+func (w *heartbeatWatchdog) alive() {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.expired.Load() {
+		w.timer.Reset(w.timeout)
+	}
+}
+
+// setTimeout changes the silence budget, e.g. once the server reports its interval
+func (w *heartbeatWatchdog) setTimeout(timeout time.Duration) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	w.timeout = timeout
+	w.mu.Unlock()
+	w.alive()
+}
+
+// stop releases the timer
+func (w *heartbeatWatchdog) stop() {
+	if w != nil {
+		w.timer.Stop()
+	}
+}
+
+// timedOut reports whether the watchdog cancelled the stream
+func (w *heartbeatWatchdog) timedOut() bool {
+	return w != nil && w.expired.Load()
+}
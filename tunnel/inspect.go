@@ -0,0 +1,112 @@
+package tunnel
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// InspectAction 检查插件对一段数据的判定
+type InspectAction int
+
+const (
+	// InspectContinue 数据照常转发，继续观察后续数据
+	InspectContinue InspectAction = iota
+	// InspectAllow 放行，本连接之后的数据不再送检
+	InspectAllow
+	// InspectBlock 拒绝：当前数据不转发，连接被关闭
+	InspectBlock
+)
+
+// InspectResult 检查结果，Reason 在拒绝时写入访问日志
+type InspectResult struct {
+	Action InspectAction
+	Reason string
+}
+
+// Inspector AH 转发路径上的 L7 检查插件（流式，不终止协议）
+// 每个目标连接（多路复用模式下为每个流）调用一次 NewSession，返回 nil 表示该连接不检查（如按服务过滤）
+type Inspector interface {
+	Name() string
+	NewSession(info *ConnAccess) InspectSession
+}
+
+// InspectSession 单个连接的检查会话
+// Inspect 按到达顺序接收 IH→目标方向的数据块（分块边界任意，需要完整报文的插件自行缓存），
+// 在数据写入目标之前调用；返回 InspectBlock 时该块及之后的数据均不会到达目标
+type InspectSession interface {
+	Inspect(data []byte) InspectResult
+}
+
+// InspectionBlockedError 检查插件拒绝连接
+type InspectionBlockedError struct {
+	Inspector string
+	Reason    string
+}
+
+func (e *InspectionBlockedError) Error() string {
+	return fmt.Sprintf("blocked by inspector %s: %s", e.Inspector, e.Reason)
+}
+
+// namedSession 检查会话及其所属插件名称
+type namedSession struct {
+	name    string
+	session InspectSession
+}
+
+// inspectedReader 在读取 IH 侧数据后、写入目标前依次送检
+type inspectedReader struct {
+	io.ReadWriteCloser
+	sessions []namedSession
+}
+
+// newInspectedReader 为连接创建各插件的检查会话，没有需要检查的插件时返回原连接
+func newInspectedReader(peer io.ReadWriteCloser, info *ConnAccess, inspectors []Inspector) io.ReadWriteCloser {
+	var sessions []namedSession
+	for _, inspector := range inspectors {
+		if session := inspector.NewSession(info); session != nil {
+			sessions = append(sessions, namedSession{name: inspector.Name(), session: session})
+		}
+	}
+	if len(sessions) == 0 {
+		return peer
+	}
+	return &inspectedReader{ReadWriteCloser: peer, sessions: sessions}
+}
+
+// Read 读取数据并送检，被拒绝时不返回数据
+func (r *inspectedReader) Read(b []byte) (int, error) {
+	n, err := r.ReadWriteCloser.Read(b)
+	if n > 0 && len(r.sessions) > 0 {
+		if blockErr := r.inspect(b[:n]); blockErr != nil {
+			return 0, blockErr
+		}
+	}
+	return n, err
+}
+
+// inspect 依次调用各会话，已放行的会话不再送检
+func (r *inspectedReader) inspect(data []byte) error {
+	remaining := r.sessions[:0]
+	for _, s := range r.sessions {
+		result := s.session.Inspect(data)
+		switch result.Action {
+		case InspectBlock:
+			r.sessions = nil
+			return &InspectionBlockedError{Inspector: s.name, Reason: result.Reason}
+		case InspectContinue:
+			remaining = append(remaining, s)
+		}
+	}
+	r.sessions = remaining
+	return nil
+}
+
+// blockedBy 返回转发错误中的检查拒绝信息
+func blockedBy(err error) *InspectionBlockedError {
+	var blocked *InspectionBlockedError
+	if errors.As(err, &blocked) {
+		return blocked
+	}
+	return nil
+}
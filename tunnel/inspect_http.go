@@ -0,0 +1,185 @@
+package tunnel
+
+import (
+	"bufio"
+	"bytes"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// maxInspectHeaderBytes HTTP 请求头（含请求行）最大缓存字节数，超出则拒绝
+const maxInspectHeaderBytes = 64 * 1024
+
+// maxInspectChunkLine 分块编码长度行最大字节数
+const maxInspectChunkLine = 1024
+
+// HTTPMethodInspector 拒绝使用指定 HTTP 方法的请求（HTTP/1.x 明文）
+// 同一连接上的后续请求（keep-alive、pipelining）逐个检查，按 Content-Length 或分块编码跳过请求体；
+// 首个请求不是 HTTP 时放行（非 HTTP 协议），协议升级（Upgrade / CONNECT）后的数据不再检查
+type HTTPMethodInspector struct {
+	// BlockedMethods 拒绝的方法（如 "DELETE"、"TRACE"），大小写不敏感
+	BlockedMethods []string
+	// Services 生效的服务 ID，为空时对所有服务生效
+	Services []string
+}
+
+// Name 插件名称
+func (i *HTTPMethodInspector) Name() string {
+	return "http_method"
+}
+
+// NewSession 为连接创建检查会话
+func (i *HTTPMethodInspector) NewSession(info *ConnAccess) InspectSession {
+	if !inspectsService(i.Services, info.ServiceID) {
+		return nil
+	}
+	blocked := make(map[string]bool, len(i.BlockedMethods))
+	for _, m := range i.BlockedMethods {
+		blocked[strings.ToUpper(m)] = true
+	}
+	return &httpMethodSession{blocked: blocked}
+}
+
+// httpMethodState 请求流解析状态
+type httpMethodState int
+
+const (
+	httpStateHeader    httpMethodState = iota // 等待完整请求头
+	httpStateBody                             // 跳过 Content-Length 请求体
+	httpStateChunkSize                        // 等待分块长度行
+	httpStateChunkData                        // 跳过分块数据及其结尾 CRLF
+	httpStateTrailer                          // 等待分块编码的 trailer 结束
+)
+
+// httpMethodSession HTTP 方法检查会话
+type httpMethodSession struct {
+	blocked   map[string]bool
+	state     httpMethodState
+	buf       []byte
+	remaining int64
+	requests  int
+}
+
+// Inspect 解析请求边界并检查每个请求的方法
+func (s *httpMethodSession) Inspect(data []byte) InspectResult {
+	for len(data) > 0 {
+		switch s.state {
+		case httpStateBody, httpStateChunkData:
+			n := int64(len(data))
+			if n > s.remaining {
+				n = s.remaining
+			}
+			data = data[n:]
+			s.remaining -= n
+			if s.remaining == 0 {
+				if s.state == httpStateBody {
+					s.state = httpStateHeader
+				} else {
+					s.state = httpStateChunkSize
+				}
+			}
+
+		case httpStateHeader:
+			s.buf = append(s.buf, data...)
+			data = nil
+			if s.requests == 0 && !looksLikeHTTP(s.buf) {
+				return InspectResult{Action: InspectAllow}
+			}
+			end := bytes.Index(s.buf, []byte("\r\n\r\n"))
+			if end < 0 {
+				if len(s.buf) > maxInspectHeaderBytes {
+					return InspectResult{Action: InspectBlock, Reason: "HTTP request header too large"}
+				}
+				return InspectResult{Action: InspectContinue}
+			}
+
+			req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(s.buf[:end+4])))
+			if err != nil {
+				return InspectResult{Action: InspectBlock, Reason: "malformed HTTP request"}
+			}
+			if s.blocked[req.Method] {
+				return InspectResult{Action: InspectBlock, Reason: "HTTP method " + req.Method + " not allowed"}
+			}
+			s.requests++
+			if req.Method == http.MethodConnect || req.Header.Get("Upgrade") != "" {
+				return InspectResult{Action: InspectAllow}
+			}
+
+			data = s.buf[end+4:]
+			s.buf = nil
+			switch {
+			case slices.Contains(req.TransferEncoding, "chunked"):
+				s.state = httpStateChunkSize
+			case req.ContentLength > 0:
+				s.state = httpStateBody
+				s.remaining = req.ContentLength
+			}
+
+		case httpStateChunkSize:
+			s.buf = append(s.buf, data...)
+			data = nil
+			end := bytes.Index(s.buf, []byte("\r\n"))
+			if end < 0 {
+				if len(s.buf) > maxInspectChunkLine {
+					return InspectResult{Action: InspectBlock, Reason: "malformed chunked body"}
+				}
+				return InspectResult{Action: InspectContinue}
+			}
+			line, _, _ := strings.Cut(string(s.buf[:end]), ";")
+			size, err := strconv.ParseInt(strings.TrimSpace(line), 16, 64)
+			if err != nil || size < 0 {
+				return InspectResult{Action: InspectBlock, Reason: "malformed chunked body"}
+			}
+			data = s.buf[end+2:]
+			s.buf = nil
+			if size == 0 {
+				s.state = httpStateTrailer
+			} else {
+				s.state = httpStateChunkData
+				s.remaining = size + 2
+			}
+
+		case httpStateTrailer:
+			s.buf = append(s.buf, data...)
+			data = nil
+			var rest []byte
+			if bytes.HasPrefix(s.buf, []byte("\r\n")) {
+				rest = s.buf[2:]
+			} else if end := bytes.Index(s.buf, []byte("\r\n\r\n")); end >= 0 {
+				rest = s.buf[end+4:]
+			} else {
+				if len(s.buf) > maxInspectHeaderBytes {
+					return InspectResult{Action: InspectBlock, Reason: "HTTP trailer too large"}
+				}
+				return InspectResult{Action: InspectContinue}
+			}
+			data = rest
+			s.buf = nil
+			s.state = httpStateHeader
+		}
+	}
+	return InspectResult{Action: InspectContinue}
+}
+
+// looksLikeHTTP 根据已收到的前缀判断是否为 HTTP 请求行（方法为大写字母后接空格）
+// 前缀不足以判断时返回 true，等待更多数据
+func looksLikeHTTP(b []byte) bool {
+	for i, c := range b {
+		switch {
+		case c == ' ':
+			return i > 0
+		case c < 'A' || c > 'Z':
+			return false
+		case i >= 16:
+			return false
+		}
+	}
+	return true
+}
+
+// inspectsService 插件是否对服务生效（services 为空时全部生效）
+func inspectsService(services []string, serviceID string) bool {
+	return len(services) == 0 || slices.Contains(services, serviceID)
+}
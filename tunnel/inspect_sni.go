@@ -0,0 +1,136 @@
+package tunnel
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// maxInspectClientHello 缓存 ClientHello 的最大字节数（可跨多个 TLS 记录）
+const maxInspectClientHello = 64 * 1024
+
+// errHelloCaptured 读取到 ClientHello 后中止 TLS 握手
+var errHelloCaptured = errors.New("client hello captured")
+
+// SNIInspector 按 TLS ClientHello 中的 SNI 放行连接（白名单），连接必须以 TLS 握手开始
+// 名称支持通配前缀 "*.example.com"（匹配任意一级及多级子域名，不匹配 example.com 本身）
+type SNIInspector struct {
+	// AllowedServerNames 允许的服务器名称，大小写不敏感
+	AllowedServerNames []string
+	// AllowMissingSNI 允许不携带 SNI 的 ClientHello（如按 IP 访问）
+	AllowMissingSNI bool
+	// Services 生效的服务 ID，为空时对所有服务生效
+	Services []string
+}
+
+// Name 插件名称
+func (i *SNIInspector) Name() string {
+	return "sni"
+}
+
+// NewSession 为连接创建检查会话
+func (i *SNIInspector) NewSession(info *ConnAccess) InspectSession {
+	if !inspectsService(i.Services, info.ServiceID) {
+		return nil
+	}
+	return &sniSession{inspector: i}
+}
+
+// Allowed 检查服务器名称是否在白名单内
+func (i *SNIInspector) Allowed(serverName string) bool {
+	if serverName == "" {
+		return i.AllowMissingSNI
+	}
+	name := strings.ToLower(strings.TrimSuffix(serverName, "."))
+	for _, allowed := range i.AllowedServerNames {
+		allowed = strings.ToLower(allowed)
+		if suffix, ok := strings.CutPrefix(allowed, "*"); ok {
+			if strings.HasSuffix(name, suffix) && len(name) > len(suffix) {
+				return true
+			}
+		} else if name == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// sniSession 缓存 ClientHello 直至可完整解析
+type sniSession struct {
+	inspector *SNIInspector
+	buf       []byte
+}
+
+// Inspect 解析 ClientHello 并判定，判定后本连接不再送检
+func (s *sniSession) Inspect(data []byte) InspectResult {
+	s.buf = append(s.buf, data...)
+	if s.buf[0] != 0x16 { // TLS handshake 记录
+		return InspectResult{Action: InspectBlock, Reason: "not a TLS connection"}
+	}
+
+	hello, err := parseClientHello(s.buf)
+	if err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) && len(s.buf) < maxInspectClientHello {
+			return InspectResult{Action: InspectContinue}
+		}
+		return InspectResult{Action: InspectBlock, Reason: "malformed TLS ClientHello"}
+	}
+
+	if !s.inspector.Allowed(hello.ServerName) {
+		return InspectResult{Action: InspectBlock, Reason: "server name " + quoteServerName(hello.ServerName) + " not allowed"}
+	}
+	return InspectResult{Action: InspectAllow}
+}
+
+// parseClientHello 借助 crypto/tls 解析已缓存的 ClientHello，数据不完整时返回 io.ErrUnexpectedEOF
+func parseClientHello(data []byte) (*tls.ClientHelloInfo, error) {
+	var hello *tls.ClientHelloInfo
+	conn := &helloConn{r: bytes.NewReader(data)}
+	err := tls.Server(conn, &tls.Config{
+		GetConfigForClient: func(info *tls.ClientHelloInfo) (*tls.Config, error) {
+			hello = info
+			return nil, errHelloCaptured
+		},
+	}).Handshake()
+	if hello != nil {
+		return hello, nil
+	}
+	if conn.eof {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return nil, err
+}
+
+// quoteServerName 日志中的服务器名称，缺失时标注
+func quoteServerName(name string) string {
+	if name == "" {
+		return "(none)"
+	}
+	return "\"" + name + "\""
+}
+
+// helloConn 只读的内存连接，供 tls.Server 读取已缓存的 ClientHello（写入的告警被丢弃）
+type helloConn struct {
+	r   *bytes.Reader
+	eof bool
+}
+
+func (c *helloConn) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	if err == io.EOF {
+		c.eof = true
+	}
+	return n, err
+}
+
+func (c *helloConn) Write(b []byte) (int, error)        { return len(b), nil }
+func (c *helloConn) Close() error                       { return nil }
+func (c *helloConn) LocalAddr() net.Addr                { return &net.TCPAddr{} }
+func (c *helloConn) RemoteAddr() net.Addr               { return &net.TCPAddr{} }
+func (c *helloConn) SetDeadline(t time.Time) error      { return nil }
+func (c *helloConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *helloConn) SetWriteDeadline(t time.Time) error { return nil }
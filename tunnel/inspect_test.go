@@ -0,0 +1,176 @@
+package tunnel
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/houzhh15/sdp-common/logging"
+)
+
+// inspectAll 逐块送检，返回最后一个判定
+func inspectAll(session InspectSession, chunks ...string) InspectResult {
+	var result InspectResult
+	for _, chunk := range chunks {
+		result = session.Inspect([]byte(chunk))
+		if result.Action != InspectContinue {
+			return result
+		}
+	}
+	return result
+}
+
+func TestHTTPMethodInspector(t *testing.T) {
+	inspector := &HTTPMethodInspector{BlockedMethods: []string{"delete", "TRACE"}}
+	info := &ConnAccess{ServiceID: "web"}
+
+	tests := []struct {
+		name   string
+		chunks []string
+		want   InspectAction
+	}{
+		{"allowed request", []string{"GET / HTTP/1.1\r\nHost: web\r\n\r\n"}, InspectContinue},
+		{"blocked method", []string{"DELETE /users/1 HTTP/1.1\r\nHost: web\r\n\r\n"}, InspectBlock},
+		{"split request line", []string{"TRA", "CE / HTTP/1.1\r\nHo", "st: web\r\n\r\n"}, InspectBlock},
+		{"keep-alive after body", []string{
+			"POST /a HTTP/1.1\r\nHost: web\r\nContent-Length: 11\r\n\r\nDELETE / HT",
+			"DELETE / HTTP/1.1\r\nHost: web\r\n\r\n",
+		}, InspectBlock},
+		{"chunked body", []string{
+			"POST /a HTTP/1.1\r\nHost: web\r\nTransfer-Encoding: chunked\r\n\r\n",
+			"6\r\nDELETE\r\n0\r\n\r\n",
+			"GET / HTTP/1.1\r\nHost: web\r\n\r\n",
+		}, InspectContinue},
+		{"request after chunked body", []string{
+			"POST /a HTTP/1.1\r\nHost: web\r\nTransfer-Encoding: chunked\r\n\r\n3\r\nabc\r\n0\r\n\r\nDELETE / HTTP/1.1\r\nHost: web\r\n\r\n",
+		}, InspectBlock},
+		{"not HTTP", []string{"\x16\x03\x01\x02\x00"}, InspectAllow},
+		{"upgrade", []string{"GET /ws HTTP/1.1\r\nHost: web\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n"}, InspectAllow},
+		{"garbage after request", []string{"GET / HTTP/1.1\r\nHost: web\r\n\r\n", "\x00\x01\r\n\r\n"}, InspectBlock},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := inspectAll(inspector.NewSession(info), tt.chunks...)
+			if result.Action != tt.want {
+				t.Errorf("action = %v (%s), want %v", result.Action, result.Reason, tt.want)
+			}
+		})
+	}
+
+	scoped := &HTTPMethodInspector{BlockedMethods: []string{"DELETE"}, Services: []string{"api"}}
+	if scoped.NewSession(info) != nil {
+		t.Error("inspector scoped to other services should not inspect web")
+	}
+}
+
+// clientHello 捕获 tls.Client 发出的 ClientHello
+func clientHello(t *testing.T, serverName string) []byte {
+	t.Helper()
+	client, server := net.Pipe()
+	defer server.Close()
+
+	go func() {
+		tls.Client(client, &tls.Config{ServerName: serverName, InsecureSkipVerify: true}).Handshake()
+		client.Close()
+	}()
+
+	buf := make([]byte, maxInspectClientHello)
+	header := buf[:5]
+	if _, err := io.ReadFull(server, header); err != nil {
+		t.Fatalf("read record header: %v", err)
+	}
+	length := int(header[3])<<8 | int(header[4])
+	if _, err := io.ReadFull(server, buf[5:5+length]); err != nil {
+		t.Fatalf("read client hello: %v", err)
+	}
+	return buf[:5+length]
+}
+
+func TestSNIInspector(t *testing.T) {
+	inspector := &SNIInspector{AllowedServerNames: []string{"api.example.com", "*.internal.example.com"}}
+	info := &ConnAccess{ServiceID: "web"}
+
+	tests := []struct {
+		name       string
+		serverName string
+		want       InspectAction
+	}{
+		{"exact", "api.example.com", InspectAllow},
+		{"case insensitive", "API.Example.com", InspectAllow},
+		{"wildcard", "db.internal.example.com", InspectAllow},
+		{"wildcard apex", "internal.example.com", InspectBlock},
+		{"not listed", "evil.example.com", InspectBlock},
+		{"missing", "", InspectBlock},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hello := clientHello(t, tt.serverName)
+			// 分两块送检：首块不完整时继续等待
+			session := inspector.NewSession(info)
+			if result := session.Inspect(hello[:10]); result.Action != InspectContinue {
+				t.Fatalf("partial hello: action = %v (%s)", result.Action, result.Reason)
+			}
+			result := session.Inspect(hello[10:])
+			if result.Action != tt.want {
+				t.Errorf("action = %v (%s), want %v", result.Action, result.Reason, tt.want)
+			}
+		})
+	}
+
+	if result := inspector.NewSession(info).Inspect([]byte("GET / HTTP/1.1\r\n")); result.Action != InspectBlock {
+		t.Errorf("plaintext: action = %v, want block", result.Action)
+	}
+	inspector.AllowMissingSNI = true
+	if result := inspector.NewSession(info).Inspect(clientHello(t, "")); result.Action != InspectAllow {
+		t.Errorf("missing SNI allowed: action = %v (%s)", result.Action, result.Reason)
+	}
+}
+
+func TestAccessLogger_ForwardBlocked(t *testing.T) {
+	audit := &connAudit{}
+	logger := NewAccessLogger(&AccessLogConfig{
+		Audit:      audit,
+		Inspectors: []Inspector{&HTTPMethodInspector{BlockedMethods: []string{"DELETE"}}},
+	})
+	info := &ConnAccess{TunnelID: "tun-1", ServiceID: "web", Target: "10.0.0.1:80"}
+
+	peer, peerRemote := net.Pipe()
+	target, targetRemote := net.Pipe()
+	defer peerRemote.Close()
+
+	done := make(chan *logging.ConnectionEvent, 1)
+	go func() {
+		done <- logger.Forward(context.Background(), info, peer, target)
+	}()
+
+	received := make(chan []byte, 1)
+	go func() {
+		data, _ := io.ReadAll(targetRemote)
+		received <- data
+	}()
+	go func() {
+		peerRemote.Write([]byte("GET / HTTP/1.1\r\nHost: web\r\n\r\n"))
+		peerRemote.Write([]byte("DELETE / HTTP/1.1\r\nHost: web\r\n\r\n"))
+		io.Copy(io.Discard, peerRemote)
+	}()
+
+	var event *logging.ConnectionEvent
+	select {
+	case event = <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Forward did not return")
+	}
+
+	// 被拒绝的请求不会到达目标
+	if data := <-received; string(data) != "GET / HTTP/1.1\r\nHost: web\r\n\r\n" {
+		t.Errorf("target received %q", data)
+	}
+	if event.Details["close_reason"] != CloseReasonBlocked || event.Details["inspector"] != "http_method" {
+		t.Errorf("unexpected close event details: %+v", event.Details)
+	}
+}
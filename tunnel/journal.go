@@ -0,0 +1,116 @@
+package tunnel
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 事件日志条目类别
+const (
+	JournalKindTunnel  = "tunnel"
+	JournalKindService = "service"
+)
+
+// defaultJournalReplayLimit SSE 重连时按 Last-Event-ID 补发的最大事件数
+const defaultJournalReplayLimit = 1000
+
+// JournalEntry 事件日志条目，Seq 单调递增，同时作为 SSE 事件 ID（Last-Event-ID）
+type JournalEntry struct {
+	Seq  uint64 `json:"seq"`
+	Kind string `json:"kind"` // JournalKindTunnel / JournalKindService
+	Type string `json:"type"` // 隧道或服务事件类型
+	// ClientID 隧道所属 IH 客户端，IH 作用域订阅补发时据此过滤
+	ClientID  string          `json:"client_id,omitempty"`
+	Data      json.RawMessage `json:"data"` // 完整的 TunnelEvent / ServiceEvent
+	Timestamp time.Time       `json:"timestamp"`
+}
+
+// EventJournal 推送事件日志，用于审计、轮询消费与 SSE 断线重放
+type EventJournal interface {
+	// Append 追加事件并返回分配的序号
+	Append(ctx context.Context, entry *JournalEntry) (uint64, error)
+	// Since 按序号升序返回 seq 之后的最多 limit 条事件
+	Since(ctx context.Context, seq uint64, limit int) ([]*JournalEntry, error)
+}
+
+// newJournalEntry 序列化事件为日志条目
+func newJournalEntry(kind, eventType, clientID string, event interface{}, ts time.Time) (*JournalEntry, error) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("marshal %s event: %w", kind, err)
+	}
+	return &JournalEntry{Kind: kind, Type: eventType, ClientID: clientID, Data: data, Timestamp: ts}, nil
+}
+
+// ParseEventID 解析 SSE Last-Event-ID，非法值返回 false
+func ParseEventID(id string) (uint64, bool) {
+	if id == "" {
+		return 0, false
+	}
+	seq, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return seq, true
+}
+
+// MemoryJournal 固定容量的内存环形事件日志（进程重启后丢失，多实例部署请使用 DBJournal）
+type MemoryJournal struct {
+	mu      sync.RWMutex
+	entries []*JournalEntry
+	next    int // 下一个写入位置
+	full    bool
+	seq     uint64
+}
+
+// NewMemoryJournal 创建保留最近 size 条事件的内存日志（size <= 0 时为 1000）
+func NewMemoryJournal(size int) *MemoryJournal {
+	if size <= 0 {
+		size = 1000
+	}
+	return &MemoryJournal{entries: make([]*JournalEntry, size)}
+}
+
+// Append 追加事件，容量满后覆盖最旧的事件
+func (j *MemoryJournal) Append(ctx context.Context, entry *JournalEntry) (uint64, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.seq++
+	stored := *entry
+	stored.Seq = j.seq
+	j.entries[j.next] = &stored
+	j.next = (j.next + 1) % len(j.entries)
+	if j.next == 0 {
+		j.full = true
+	}
+	return j.seq, nil
+}
+
+// Since 返回 seq 之后的事件（已被覆盖的事件不再返回）
+func (j *MemoryJournal) Since(ctx context.Context, seq uint64, limit int) ([]*JournalEntry, error) {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+
+	start, count := 0, j.next
+	if j.full {
+		start, count = j.next, len(j.entries)
+	}
+
+	var result []*JournalEntry
+	for i := 0; i < count; i++ {
+		entry := j.entries[(start+i)%len(j.entries)]
+		if entry.Seq <= seq {
+			continue
+		}
+		result = append(result, entry)
+		if limit > 0 && len(result) >= limit {
+			break
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,92 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// journalRecord 事件日志数据库记录
+type journalRecord struct {
+	Seq       uint64    `gorm:"primaryKey;autoIncrement"`
+	Kind      string    `gorm:"index;not null"`
+	Type      string    `gorm:"not null"`
+	ClientID  string    `gorm:"index"`
+	Data      string    `gorm:"type:text;not null"`
+	CreatedAt time.Time `gorm:"index"`
+}
+
+// TableName 指定表名
+func (journalRecord) TableName() string {
+	return "event_journal"
+}
+
+// DBJournal 基于数据库的持久化事件日志
+// 序号由数据库自增主键分配，Controller 重启后继续递增，重启前的 Last-Event-ID 仍可重放
+type DBJournal struct {
+	db *gorm.DB
+}
+
+// NewDBJournal 创建数据库事件日志并迁移表结构
+func NewDBJournal(db *gorm.DB) (*DBJournal, error) {
+	if db == nil {
+		return nil, errors.New("database is required")
+	}
+	if err := db.AutoMigrate(&journalRecord{}); err != nil {
+		return nil, fmt.Errorf("failed to migrate event_journal table: %w", err)
+	}
+	return &DBJournal{db: db}, nil
+}
+
+// Append 追加事件
+func (j *DBJournal) Append(ctx context.Context, entry *JournalEntry) (uint64, error) {
+	record := &journalRecord{
+		Kind:      entry.Kind,
+		Type:      entry.Type,
+		ClientID:  entry.ClientID,
+		Data:      string(entry.Data),
+		CreatedAt: entry.Timestamp,
+	}
+	if err := j.db.WithContext(ctx).Create(record).Error; err != nil {
+		return 0, fmt.Errorf("failed to append event: %w", err)
+	}
+	return record.Seq, nil
+}
+
+// Since 按序号升序返回 seq 之后的事件
+func (j *DBJournal) Since(ctx context.Context, seq uint64, limit int) ([]*JournalEntry, error) {
+	query := j.db.WithContext(ctx).Where("seq > ?", seq).Order("seq")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	var records []journalRecord
+	if err := query.Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("failed to query events: %w", err)
+	}
+
+	entries := make([]*JournalEntry, 0, len(records))
+	for _, record := range records {
+		entries = append(entries, &JournalEntry{
+			Seq:       record.Seq,
+			Kind:      record.Kind,
+			Type:      record.Type,
+			ClientID:  record.ClientID,
+			Data:      []byte(record.Data),
+			Timestamp: record.CreatedAt,
+		})
+	}
+	return entries, nil
+}
+
+// Prune 删除 before 之前的事件，返回删除条数
+func (j *DBJournal) Prune(ctx context.Context, before time.Time) (int64, error) {
+	result := j.db.WithContext(ctx).Where("created_at < ?", before).Delete(&journalRecord{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to prune events: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
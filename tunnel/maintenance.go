@@ -0,0 +1,66 @@
+package tunnel
+
+import (
+	"fmt"
+	"time"
+)
+
+// maxMaintenanceMessageLength 维护说明的最大长度（字节）
+const maxMaintenanceMessageLength = 512
+
+// MaintenanceWindow 服务维护窗口：[Start, End) 内服务状态为 maintenance，Controller 拒绝新建隧道，已有隧道不受影响
+type MaintenanceWindow struct {
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Message string    `json:"message,omitempty"` // 返回给 IH 用户的说明，如预计恢复时间
+}
+
+// ValidateMaintenance 校验维护窗口与计划停用时间
+func (c *ServiceConfig) ValidateMaintenance() error {
+	for i, w := range c.MaintenanceWindows {
+		if w.Start.IsZero() || !w.End.After(w.Start) {
+			return fmt.Errorf("service %s: maintenance window %d must have a start before its end", c.ServiceID, i)
+		}
+		if len(w.Message) > maxMaintenanceMessageLength {
+			return fmt.Errorf("service %s: maintenance message exceeds %d bytes", c.ServiceID, maxMaintenanceMessageLength)
+		}
+	}
+	if c.DisableAt != nil && c.DisableAt.IsZero() {
+		return fmt.Errorf("service %s: disable_at must not be zero", c.ServiceID)
+	}
+	return nil
+}
+
+// ActiveMaintenance 返回 now 所在的维护窗口（多个窗口重叠时取最晚结束的），不在维护窗口内时返回 nil
+func (c *ServiceConfig) ActiveMaintenance(now time.Time) *MaintenanceWindow {
+	var active *MaintenanceWindow
+	for i := range c.MaintenanceWindows {
+		w := &c.MaintenanceWindows[i]
+		if now.Before(w.Start) || !now.Before(w.End) {
+			continue
+		}
+		if active == nil || w.End.After(active.End) {
+			active = w
+		}
+	}
+	return active
+}
+
+// ScheduledStatus 按维护窗口与计划停用时间（DisableAt）计算服务在 now 应处的状态：
+//   - 已删除或已停用的服务保持不变
+//   - 到达 DisableAt 后为 inactive
+//   - 处于维护窗口内为 maintenance
+//   - 配置了维护窗口的服务在窗口外恢复为 active；未配置维护窗口时手动设置的 maintenance 保持不变
+func (c *ServiceConfig) ScheduledStatus(now time.Time) ServiceStatus {
+	switch {
+	case c.Status == ServiceStatusDeleted || c.Status == ServiceStatusInactive:
+		return c.Status
+	case c.DisableAt != nil && !now.Before(*c.DisableAt):
+		return ServiceStatusInactive
+	case c.ActiveMaintenance(now) != nil:
+		return ServiceStatusMaintenance
+	case c.Status == ServiceStatusMaintenance && len(c.MaintenanceWindows) > 0:
+		return ServiceStatusActive
+	}
+	return c.Status
+}
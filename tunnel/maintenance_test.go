@@ -0,0 +1,95 @@
+package tunnel
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateMaintenance(t *testing.T) {
+	start := time.Date(2026, 1, 10, 2, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		windows []MaintenanceWindow
+		wantErr string
+	}{
+		{"none", nil, ""},
+		{"valid", []MaintenanceWindow{{Start: start, End: start.Add(time.Hour), Message: "upgrade"}}, ""},
+		{"zero start", []MaintenanceWindow{{End: start}}, "start before its end"},
+		{"end before start", []MaintenanceWindow{{Start: start, End: start.Add(-time.Minute)}}, "start before its end"},
+		{"message too long", []MaintenanceWindow{{Start: start, End: start.Add(time.Hour), Message: strings.Repeat("m", 513)}}, "exceeds 512 bytes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := (&ServiceConfig{ServiceID: "svc", MaintenanceWindows: tt.windows}).ValidateMaintenance()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	if err := (&ServiceConfig{ServiceID: "svc", DisableAt: &time.Time{}}).ValidateMaintenance(); err == nil {
+		t.Error("expected error for zero disable_at")
+	}
+}
+
+func TestActiveMaintenance(t *testing.T) {
+	start := time.Date(2026, 1, 10, 2, 0, 0, 0, time.UTC)
+	config := &ServiceConfig{MaintenanceWindows: []MaintenanceWindow{
+		{Start: start, End: start.Add(time.Hour), Message: "first"},
+		{Start: start.Add(30 * time.Minute), End: start.Add(2 * time.Hour), Message: "second"},
+	}}
+
+	if w := config.ActiveMaintenance(start.Add(-time.Second)); w != nil {
+		t.Errorf("before windows: got %q", w.Message)
+	}
+	if w := config.ActiveMaintenance(start); w == nil || w.Message != "first" {
+		t.Errorf("window start: got %v", w)
+	}
+	// 重叠时取最晚结束的窗口
+	if w := config.ActiveMaintenance(start.Add(45 * time.Minute)); w == nil || w.Message != "second" {
+		t.Errorf("overlap: got %v", w)
+	}
+	if w := config.ActiveMaintenance(start.Add(2 * time.Hour)); w != nil {
+		t.Errorf("window end is exclusive: got %q", w.Message)
+	}
+}
+
+func TestScheduledStatus(t *testing.T) {
+	start := time.Date(2026, 1, 10, 2, 0, 0, 0, time.UTC)
+	windows := []MaintenanceWindow{{Start: start, End: start.Add(time.Hour)}}
+	disableAt := start.Add(3 * time.Hour)
+
+	tests := []struct {
+		name      string
+		status    ServiceStatus
+		windows   []MaintenanceWindow
+		disableAt *time.Time
+		now       time.Time
+		want      ServiceStatus
+	}{
+		{"active outside window", ServiceStatusActive, windows, nil, start.Add(-time.Minute), ServiceStatusActive},
+		{"window starts", ServiceStatusActive, windows, nil, start, ServiceStatusMaintenance},
+		{"window ends", ServiceStatusMaintenance, windows, nil, start.Add(time.Hour), ServiceStatusActive},
+		{"manual maintenance kept", ServiceStatusMaintenance, nil, nil, start, ServiceStatusMaintenance},
+		{"disable pending", ServiceStatusActive, nil, &disableAt, start, ServiceStatusActive},
+		{"disable reached", ServiceStatusActive, nil, &disableAt, disableAt, ServiceStatusInactive},
+		{"disable during maintenance", ServiceStatusMaintenance, windows, &disableAt, disableAt, ServiceStatusInactive},
+		{"inactive unchanged", ServiceStatusInactive, windows, nil, start, ServiceStatusInactive},
+		{"deleted unchanged", ServiceStatusDeleted, windows, &disableAt, disableAt, ServiceStatusDeleted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &ServiceConfig{Status: tt.status, MaintenanceWindows: tt.windows, DisableAt: tt.disableAt}
+			if got := config.ScheduledStatus(tt.now); got != tt.want {
+				t.Errorf("ScheduledStatus() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -47,10 +47,22 @@ type Manager interface {
 type CreateTunnelRequest struct {
 	SessionToken string                 `json:"session_token"`
 	ClientID     string                 `json:"client_id"`
-	ServiceID    string                 `json:"service_id"` // 通过 ServiceID 查询 ServiceConfig 获取目标地址
-	Protocol     string                 `json:"protocol"`   // "tcp", "udp"
-	TTL          int64                  `json:"ttl"`        // seconds
+	ServiceID    string                 `json:"service_id"`               // 通过 ServiceID 查询 ServiceConfig 获取目标地址
+	Protocol     string                 `json:"protocol"`                 // "tcp", "udp"
+	TTL          int64                  `json:"ttl"`                      // seconds
+	TargetHost   string                 `json:"target_host,omitempty"`    // 仅模式化服务：请求的具体目标主机（IP）
+	TargetPort   int                    `json:"target_port,omitempty"`    // 仅模式化服务：请求的具体目标端口
+	Multiplex    bool                   `json:"multiplex,omitempty"`      // 保持单条中继连接，本地连接以编号流复用
+	ClientAddr   string                 `json:"client_addr,omitempty"`    // IH 原始源地址（ip:port），由 Controller 记录，供 PROXY protocol 使用
+	E2EPublicKey string                 `json:"e2e_public_key,omitempty"` // IH 的端到端加密公钥，非空时隧道启用 E2E
+	QoSClass     string                 `json:"qos_class,omitempty"`      // 生效的 DSCP 服务等级（策略优先于服务配置）
+	TraceID      string                 `json:"trace_id,omitempty"`       // 创建请求的 trace ID（Controller 启用 Tracing 时）
 	Metadata     map[string]interface{} `json:"metadata,omitempty"`
+
+	// ReverseForward 反向转发的 AH 监听地址（host:port），非空时隧道为多路复用的反向转发隧道
+	ReverseForward string `json:"reverse_forward,omitempty"`
+	// Obfuscate 启用流量混淆（帧填充到档位长度、随机化发送时机），由匹配策略决定
+	Obfuscate bool `json:"obfuscate,omitempty"`
 }
 
 // TunnelFilter 隧道过滤器
@@ -60,4 +72,7 @@ type TunnelFilter struct {
 	Status    TunnelStatus `json:"status,omitempty"`
 	Limit     int          `json:"limit,omitempty"`
 	Offset    int          `json:"offset,omitempty"`
+
+	// IncludeFailed 同时返回 failed 状态的隧道；默认只有 Status 为 failed 时才返回
+	IncludeFailed bool `json:"include_failed,omitempty"`
 }
@@ -0,0 +1,509 @@
+package tunnel
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+// 多路复用帧格式（Tunnel ID 握手之后，IH ↔ Controller ↔ AH 端到端透传）：
+//
+//	+--------+-------------+-------------+-----------------+
+//	| Type   | Stream ID   | Length      | Payload         |
+//	| 1 byte | 4 bytes BE  | 4 bytes BE  | Length bytes    |
+//	+--------+-------------+-------------+-----------------+
+//
+// Controller 中继对帧格式无感知，仅 IH 与 AH 两端解析。
+//
+// 流控按流独立进行：每个流的发送方最多发出 muxStreamWindow 字节未被对端读取的数据，
+// 接收方读取后以 WINDOW 帧（4 字节 BE 增量）归还额度。读循环从不阻塞在单个流上，
+// 超出窗口的流被重置，不影响同一连接上的其他流。
+const (
+	muxFrameOpen   byte = 0x01 // 打开新流
+	muxFrameData   byte = 0x02 // 流数据
+	muxFrameClose  byte = 0x03 // 关闭流
+	muxFrameWindow byte = 0x04 // 归还发送窗口
+
+	muxHeaderSize = 9
+	// MuxMaxPayload 单帧最大负载
+	MuxMaxPayload = 32 * 1024
+	// muxStreamWindow 每个流的接收窗口（字节）
+	muxStreamWindow = 256 * 1024
+	// muxAcceptBacklog 等待 AcceptStream 的新流数量，写满后拒绝新流
+	muxAcceptBacklog = 64
+)
+
+// ErrMuxStreamReset 流因超出接收窗口被重置
+var ErrMuxStreamReset = errors.New("mux stream reset")
+
+// MetadataKeyMultiplex 隧道 Metadata 中标记多路复用模式的键
+const MetadataKeyMultiplex = "multiplex"
+
+// IsMultiplexed 隧道是否工作在多路复用模式
+// 多路复用模式下 IH 与 AH 各保持一条数据平面连接，连接上承载 MuxSession 帧
+func (t *Tunnel) IsMultiplexed() bool {
+	if t == nil || t.Metadata == nil {
+		return false
+	}
+	v, _ := t.Metadata[MetadataKeyMultiplex].(bool)
+	return v
+}
+
+// MuxSession 在一条数据平面连接上承载多个编号流
+// IH 端（client）使用奇数流 ID 主动打开流，AH 端（server）通过 AcceptStream 接收
+type MuxSession struct {
+	conn     net.Conn
+	isClient bool
+
+	mu       sync.Mutex
+	streams  map[uint32]*MuxStream
+	nextID   uint32
+	writeMu  sync.Mutex
+	acceptCh chan *MuxStream
+	closed   chan struct{}
+	closeErr error
+	once     sync.Once
+}
+
+// NewMuxSession 在已完成 Tunnel ID 握手的连接上创建多路复用会话
+func NewMuxSession(conn net.Conn, isClient bool) *MuxSession {
+	s := &MuxSession{
+		conn:     conn,
+		isClient: isClient,
+		streams:  make(map[uint32]*MuxStream),
+		acceptCh: make(chan *MuxStream, muxAcceptBacklog),
+		closed:   make(chan struct{}),
+	}
+	if isClient {
+		s.nextID = 1
+	} else {
+		s.nextID = 2
+	}
+
+	go s.readLoop()
+	return s
+}
+
+// OpenStream 打开一个新流（通常由 IH 端为每个本地连接调用）
+func (s *MuxSession) OpenStream() (*MuxStream, error) {
+	s.mu.Lock()
+	if s.IsClosed() {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("mux session closed")
+	}
+	id := s.nextID
+	s.nextID += 2
+	stream := newMuxStream(id, s)
+	s.streams[id] = stream
+	s.mu.Unlock()
+
+	if err := s.writeFrame(muxFrameOpen, id, nil); err != nil {
+		s.removeStream(id)
+		return nil, fmt.Errorf("open stream %d: %w", id, err)
+	}
+
+	return stream, nil
+}
+
+// AcceptStream 等待对端打开的新流（通常由 AH 端循环调用）
+func (s *MuxSession) AcceptStream() (*MuxStream, error) {
+	select {
+	case stream := <-s.acceptCh:
+		return stream, nil
+	case <-s.closed:
+		return nil, s.err()
+	}
+}
+
+// NumStreams 返回当前打开的流数量
+func (s *MuxSession) NumStreams() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.streams)
+}
+
+// IsClosed 会话是否已关闭
+func (s *MuxSession) IsClosed() bool {
+	select {
+	case <-s.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// Done 返回会话关闭时关闭的通道
+func (s *MuxSession) Done() <-chan struct{} {
+	return s.closed
+}
+
+// Close 关闭会话及其承载的所有流
+func (s *MuxSession) Close() error {
+	s.shutdown(io.EOF)
+	return nil
+}
+
+// readLoop 读取帧并分发到对应的流
+func (s *MuxSession) readLoop() {
+	header := make([]byte, muxHeaderSize)
+	for {
+		if _, err := io.ReadFull(s.conn, header); err != nil {
+			s.shutdown(err)
+			return
+		}
+
+		frameType := header[0]
+		id := binary.BigEndian.Uint32(header[1:5])
+		length := binary.BigEndian.Uint32(header[5:9])
+		if length > MuxMaxPayload {
+			s.shutdown(fmt.Errorf("frame too large: %d bytes", length))
+			return
+		}
+
+		var payload []byte
+		if length > 0 {
+			payload = make([]byte, length)
+			if _, err := io.ReadFull(s.conn, payload); err != nil {
+				s.shutdown(err)
+				return
+			}
+		}
+
+		switch frameType {
+		case muxFrameOpen:
+			s.mu.Lock()
+			if _, exists := s.streams[id]; exists {
+				s.mu.Unlock()
+				continue
+			}
+			stream := newMuxStream(id, s)
+			s.streams[id] = stream
+			s.mu.Unlock()
+
+			select {
+			case s.acceptCh <- stream:
+			default:
+				// AcceptStream 跟不上时拒绝新流，不阻塞已有流
+				s.removeStream(id)
+				go s.writeFrame(muxFrameClose, id, nil)
+			}
+
+		case muxFrameData:
+			s.mu.Lock()
+			stream, ok := s.streams[id]
+			s.mu.Unlock()
+			if !ok {
+				continue // 流已关闭，丢弃数据
+			}
+			if !stream.deliver(payload) {
+				s.resetStream(stream)
+			}
+
+		case muxFrameWindow:
+			if length != 4 {
+				s.shutdown(fmt.Errorf("invalid window frame: %d bytes", length))
+				return
+			}
+			s.mu.Lock()
+			stream, ok := s.streams[id]
+			s.mu.Unlock()
+			if ok {
+				stream.grant(int(binary.BigEndian.Uint32(payload)))
+			}
+
+		case muxFrameClose:
+			s.mu.Lock()
+			stream, ok := s.streams[id]
+			if ok {
+				stream.closeRemote()
+				delete(s.streams, id)
+			}
+			s.mu.Unlock()
+
+		default:
+			s.shutdown(fmt.Errorf("unknown frame type: 0x%02x", frameType))
+			return
+		}
+	}
+}
+
+// resetStream 重置超出接收窗口的流：本端读写返回 ErrMuxStreamReset，对端收到 CLOSE
+// CLOSE 异步发送，读循环不等待写入
+func (s *MuxSession) resetStream(stream *MuxStream) {
+	s.mu.Lock()
+	if s.streams[stream.id] == stream {
+		delete(s.streams, stream.id)
+	}
+	if !stream.resetDone {
+		stream.resetDone = true
+		close(stream.reset)
+	}
+	s.mu.Unlock()
+	go s.writeFrame(muxFrameClose, stream.id, nil)
+}
+
+// writeFrame 写入一帧（串行化所有流的写操作）
+func (s *MuxSession) writeFrame(frameType byte, id uint32, payload []byte) error {
+	header := make([]byte, muxHeaderSize)
+	header[0] = frameType
+	binary.BigEndian.PutUint32(header[1:5], id)
+	binary.BigEndian.PutUint32(header[5:9], uint32(len(payload)))
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	if s.IsClosed() {
+		return s.err()
+	}
+	if _, err := s.conn.Write(header); err != nil {
+		return err
+	}
+	if len(payload) > 0 {
+		if _, err := s.conn.Write(payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeStream 从会话中移除流
+func (s *MuxSession) removeStream(id uint32) {
+	s.mu.Lock()
+	if stream, ok := s.streams[id]; ok {
+		stream.closeRemote()
+		delete(s.streams, id)
+	}
+	s.mu.Unlock()
+}
+
+// shutdown 关闭底层连接并唤醒所有等待者
+func (s *MuxSession) shutdown(err error) {
+	s.once.Do(func() {
+		s.mu.Lock()
+		s.closeErr = err
+		close(s.closed)
+		for id, stream := range s.streams {
+			stream.closeRemote()
+			delete(s.streams, id)
+		}
+		s.mu.Unlock()
+		s.conn.Close()
+	})
+}
+
+// err 返回会话关闭原因
+func (s *MuxSession) err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closeErr == nil || s.closeErr == io.EOF {
+		return fmt.Errorf("mux session closed")
+	}
+	return fmt.Errorf("mux session closed: %w", s.closeErr)
+}
+
+// MuxStream 多路复用会话中的单个流，实现 io.ReadWriteCloser
+type MuxStream struct {
+	id      uint32
+	session *MuxSession
+
+	mu         sync.Mutex
+	recvBuf    bytes.Buffer  // 已收到未读取的数据，不超过 muxStreamWindow
+	consumed   int           // 已读取但尚未归还给对端的窗口
+	sendWindow int           // 对端允许继续发送的字节数
+	readable   chan struct{} // recvBuf 有新数据
+	writable   chan struct{} // sendWindow 增加
+
+	remoteClosed chan struct{}
+	remoteDone   bool // 由 session.mu 保护
+	reset        chan struct{}
+	resetDone    bool // 由 session.mu 保护
+	localClosed  chan struct{}
+	closeOnce    sync.Once
+}
+
+func newMuxStream(id uint32, session *MuxSession) *MuxStream {
+	return &MuxStream{
+		id:           id,
+		session:      session,
+		sendWindow:   muxStreamWindow,
+		readable:     make(chan struct{}, 1),
+		writable:     make(chan struct{}, 1),
+		remoteClosed: make(chan struct{}),
+		reset:        make(chan struct{}),
+		localClosed:  make(chan struct{}),
+	}
+}
+
+// ID 返回流编号
+func (st *MuxStream) ID() uint32 {
+	return st.id
+}
+
+// Read 读取流数据，对端关闭后返回 io.EOF，流被重置后返回 ErrMuxStreamReset
+func (st *MuxStream) Read(p []byte) (int, error) {
+	for {
+		// 重置的流已丢失数据，不再交付缓冲中的部分
+		select {
+		case <-st.reset:
+			return 0, ErrMuxStreamReset
+		default:
+		}
+
+		st.mu.Lock()
+		if st.recvBuf.Len() > 0 {
+			n, _ := st.recvBuf.Read(p)
+			st.consumed += n
+			update := 0
+			if st.consumed >= muxStreamWindow/2 {
+				update, st.consumed = st.consumed, 0
+			}
+			st.mu.Unlock()
+			if update > 0 {
+				st.sendWindowUpdate(update)
+			}
+			return n, nil
+		}
+		st.mu.Unlock()
+
+		select {
+		case <-st.readable:
+		case <-st.reset:
+			return 0, ErrMuxStreamReset
+		case <-st.localClosed:
+			return 0, io.ErrClosedPipe
+		case <-st.remoteClosed:
+			// 对端关闭前发送的数据已全部进入缓冲，读完后返回 EOF
+			st.mu.Lock()
+			empty := st.recvBuf.Len() == 0
+			st.mu.Unlock()
+			if empty {
+				return 0, io.EOF
+			}
+		}
+	}
+}
+
+// Write 写入流数据（按 MuxMaxPayload 分帧，受对端接收窗口限制）
+func (st *MuxStream) Write(p []byte) (int, error) {
+	select {
+	case <-st.localClosed:
+		return 0, io.ErrClosedPipe
+	case <-st.reset:
+		return 0, ErrMuxStreamReset
+	default:
+	}
+
+	written := 0
+	for written < len(p) {
+		want := len(p) - written
+		if want > MuxMaxPayload {
+			want = MuxMaxPayload
+		}
+		n, err := st.acquire(want)
+		if err != nil {
+			return written, err
+		}
+		if err := st.session.writeFrame(muxFrameData, st.id, p[written:written+n]); err != nil {
+			return written, err
+		}
+		written += n
+	}
+	return written, nil
+}
+
+// acquire 等待发送窗口，返回本次可发送的字节数（1 ~ want）
+func (st *MuxStream) acquire(want int) (int, error) {
+	for {
+		st.mu.Lock()
+		if st.sendWindow > 0 {
+			n := want
+			if n > st.sendWindow {
+				n = st.sendWindow
+			}
+			st.sendWindow -= n
+			st.mu.Unlock()
+			return n, nil
+		}
+		st.mu.Unlock()
+
+		select {
+		case <-st.writable:
+		case <-st.reset:
+			return 0, ErrMuxStreamReset
+		case <-st.localClosed:
+			return 0, io.ErrClosedPipe
+		case <-st.remoteClosed:
+			// 对端已关闭该流，不会再归还窗口
+			return 0, io.ErrClosedPipe
+		case <-st.session.closed:
+			return 0, st.session.err()
+		}
+	}
+}
+
+// deliver 由读循环调用，缓冲收到的数据；超出接收窗口时返回 false
+func (st *MuxStream) deliver(payload []byte) bool {
+	select {
+	case <-st.localClosed:
+		return true // 本端已关闭，丢弃数据
+	default:
+	}
+
+	st.mu.Lock()
+	if st.recvBuf.Len()+len(payload) > muxStreamWindow {
+		st.mu.Unlock()
+		return false
+	}
+	st.recvBuf.Write(payload)
+	st.mu.Unlock()
+	muxSignal(st.readable)
+	return true
+}
+
+// grant 由读循环调用，增加发送窗口
+func (st *MuxStream) grant(n int) {
+	st.mu.Lock()
+	st.sendWindow += n
+	st.mu.Unlock()
+	muxSignal(st.writable)
+}
+
+// sendWindowUpdate 向对端归还已读取的窗口，会话或流已关闭时忽略
+func (st *MuxStream) sendWindowUpdate(n int) {
+	payload := make([]byte, 4)
+	binary.BigEndian.PutUint32(payload, uint32(n))
+	st.session.writeFrame(muxFrameWindow, st.id, payload)
+}
+
+// muxSignal 非阻塞地唤醒一个等待者
+func muxSignal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// Close 关闭流并通知对端
+func (st *MuxStream) Close() error {
+	var err error
+	st.closeOnce.Do(func() {
+		close(st.localClosed)
+		if !st.session.IsClosed() {
+			err = st.session.writeFrame(muxFrameClose, st.id, nil)
+		}
+		st.session.removeStream(st.id)
+	})
+	return err
+}
+
+// closeRemote 标记对端已关闭（调用方需持有 session.mu）
+func (st *MuxStream) closeRemote() {
+	if !st.remoteDone {
+		st.remoteDone = true
+		close(st.remoteClosed)
+	}
+}
@@ -0,0 +1,285 @@
+package tunnel
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newMuxPair(t *testing.T) (*MuxSession, *MuxSession) {
+	t.Helper()
+	c1, c2 := net.Pipe()
+	client := NewMuxSession(c1, true)
+	server := NewMuxSession(c2, false)
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	return client, server
+}
+
+func TestMuxSession_EchoMultipleStreams(t *testing.T) {
+	client, server := newMuxPair(t)
+
+	// AH 侧：对每个流回显数据
+	go func() {
+		for {
+			stream, err := server.AcceptStream()
+			if err != nil {
+				return
+			}
+			go func(st *MuxStream) {
+				defer st.Close()
+				io.Copy(st, st)
+			}(stream)
+		}
+	}()
+
+	const streams = 5
+	var wg sync.WaitGroup
+	for i := 0; i < streams; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			stream, err := client.OpenStream()
+			if err != nil {
+				t.Errorf("OpenStream failed: %v", err)
+				return
+			}
+			defer stream.Close()
+
+			msg := bytes.Repeat([]byte{byte('a' + i)}, MuxMaxPayload+100) // 跨帧
+			go stream.Write(msg)
+
+			got := make([]byte, len(msg))
+			if _, err := io.ReadFull(stream, got); err != nil {
+				t.Errorf("stream %d read failed: %v", stream.ID(), err)
+				return
+			}
+			if !bytes.Equal(got, msg) {
+				t.Errorf("stream %d echo mismatch", stream.ID())
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestMuxSession_StreamIDs(t *testing.T) {
+	client, server := newMuxPair(t)
+
+	s1, err := client.OpenStream()
+	if err != nil {
+		t.Fatalf("OpenStream failed: %v", err)
+	}
+	s2, err := client.OpenStream()
+	if err != nil {
+		t.Fatalf("OpenStream failed: %v", err)
+	}
+	if s1.ID() != 1 || s2.ID() != 3 {
+		t.Errorf("client stream IDs = %d, %d; want 1, 3", s1.ID(), s2.ID())
+	}
+
+	accepted, err := server.AcceptStream()
+	if err != nil {
+		t.Fatalf("AcceptStream failed: %v", err)
+	}
+	if accepted.ID() != s1.ID() {
+		t.Errorf("accepted stream ID = %d, want %d", accepted.ID(), s1.ID())
+	}
+}
+
+func TestMuxSession_RemoteCloseDeliversEOF(t *testing.T) {
+	client, server := newMuxPair(t)
+
+	stream, err := client.OpenStream()
+	if err != nil {
+		t.Fatalf("OpenStream failed: %v", err)
+	}
+	if _, err := stream.Write([]byte("hello")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	stream.Close()
+
+	accepted, err := server.AcceptStream()
+	if err != nil {
+		t.Fatalf("AcceptStream failed: %v", err)
+	}
+
+	data, err := io.ReadAll(accepted)
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	if string(data) != "hello" {
+		t.Errorf("got %q, want %q", data, "hello")
+	}
+
+	// 流关闭不影响会话
+	if client.IsClosed() || server.IsClosed() {
+		t.Error("session should remain open after stream close")
+	}
+}
+
+func TestMuxSession_CloseUnblocksStreams(t *testing.T) {
+	client, server := newMuxPair(t)
+
+	stream, err := client.OpenStream()
+	if err != nil {
+		t.Fatalf("OpenStream failed: %v", err)
+	}
+	if _, err := server.AcceptStream(); err != nil {
+		t.Fatalf("AcceptStream failed: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := stream.Read(make([]byte, 1))
+		done <- err
+	}()
+
+	server.Close()
+
+	select {
+	case err := <-done:
+		if err != io.EOF {
+			t.Errorf("Read error = %v, want io.EOF", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Read not unblocked by session close")
+	}
+
+	if _, err := client.OpenStream(); err == nil {
+		t.Error("expected OpenStream to fail on closed session")
+	}
+	if _, err := server.AcceptStream(); err == nil {
+		t.Error("expected AcceptStream to fail on closed session")
+	}
+}
+
+func TestMuxSession_SlowStreamDoesNotBlockOthers(t *testing.T) {
+	client, server := newMuxPair(t)
+
+	slow, err := client.OpenStream()
+	if err != nil {
+		t.Fatalf("OpenStream failed: %v", err)
+	}
+	slowPeer, err := server.AcceptStream()
+	if err != nil {
+		t.Fatalf("AcceptStream failed: %v", err)
+	}
+
+	// 对端不读取 slow 流：发送方写满窗口后阻塞，读循环不受影响
+	payload := bytes.Repeat([]byte("s"), 2*muxStreamWindow)
+	slowDone := make(chan error, 1)
+	go func() {
+		_, err := slow.Write(payload)
+		slowDone <- err
+	}()
+
+	fast, err := client.OpenStream()
+	if err != nil {
+		t.Fatalf("OpenStream failed: %v", err)
+	}
+	fastPeer, err := server.AcceptStream()
+	if err != nil {
+		t.Fatalf("AcceptStream failed: %v", err)
+	}
+	go fast.Write([]byte("ping"))
+	buf := make([]byte, 4)
+	readDone := make(chan error, 1)
+	go func() {
+		_, err := io.ReadFull(fastPeer, buf)
+		readDone <- err
+	}()
+	select {
+	case err := <-readDone:
+		if err != nil || string(buf) != "ping" {
+			t.Fatalf("fast stream read = %q, %v", buf, err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("fast stream blocked by slow stream")
+	}
+
+	select {
+	case err := <-slowDone:
+		t.Fatalf("slow Write returned before the peer read: %v", err)
+	default:
+	}
+
+	// 读取后归还窗口，剩余数据完整送达
+	got := make([]byte, len(payload))
+	if _, err := io.ReadFull(slowPeer, got); err != nil {
+		t.Fatalf("slow stream read failed: %v", err)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Error("slow stream data mismatch")
+	}
+	if err := <-slowDone; err != nil {
+		t.Errorf("slow Write failed: %v", err)
+	}
+}
+
+func TestMuxSession_WindowOverrunResetsStream(t *testing.T) {
+	c1, c2 := net.Pipe()
+	server := NewMuxSession(c2, false)
+	t.Cleanup(func() {
+		server.Close()
+		c1.Close()
+	})
+
+	// 不遵守窗口的对端：直接写帧
+	go io.Copy(io.Discard, c1)
+	writeFrame := func(frameType byte, id uint32, payload []byte) {
+		header := make([]byte, muxHeaderSize)
+		header[0] = frameType
+		binary.BigEndian.PutUint32(header[1:5], id)
+		binary.BigEndian.PutUint32(header[5:9], uint32(len(payload)))
+		if _, err := c1.Write(append(header, payload...)); err != nil {
+			t.Fatalf("write frame: %v", err)
+		}
+	}
+
+	writeFrame(muxFrameOpen, 1, nil)
+	writeFrame(muxFrameOpen, 3, nil)
+	flooded, err := server.AcceptStream()
+	if err != nil {
+		t.Fatalf("AcceptStream failed: %v", err)
+	}
+	other, err := server.AcceptStream()
+	if err != nil {
+		t.Fatalf("AcceptStream failed: %v", err)
+	}
+
+	chunk := bytes.Repeat([]byte("x"), MuxMaxPayload)
+	for i := 0; i <= muxStreamWindow/MuxMaxPayload; i++ {
+		writeFrame(muxFrameData, 1, chunk)
+	}
+	writeFrame(muxFrameData, 3, []byte("ok"))
+
+	buf := make([]byte, 2)
+	if _, err := io.ReadFull(other, buf); err != nil || string(buf) != "ok" {
+		t.Fatalf("other stream read = %q, %v", buf, err)
+	}
+	if _, err := flooded.Read(make([]byte, 1)); err != ErrMuxStreamReset {
+		t.Errorf("flooded Read error = %v, want ErrMuxStreamReset", err)
+	}
+	if _, err := flooded.Write([]byte("x")); err != ErrMuxStreamReset {
+		t.Errorf("flooded Write error = %v, want ErrMuxStreamReset", err)
+	}
+	if server.IsClosed() {
+		t.Error("session should survive a stream reset")
+	}
+}
+
+func TestTunnel_IsMultiplexed(t *testing.T) {
+	if (&Tunnel{}).IsMultiplexed() {
+		t.Error("tunnel without metadata should not be multiplexed")
+	}
+	tun := &Tunnel{Metadata: map[string]interface{}{MetadataKeyMultiplex: true}}
+	if !tun.IsMultiplexed() {
+		t.Error("expected multiplexed tunnel")
+	}
+}
@@ -4,104 +4,314 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"runtime"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/houzhh15/sdp-common/clock"
+	"github.com/houzhh15/sdp-common/faults"
 	"github.com/houzhh15/sdp-common/logging"
 )
 
 // SSEClient SSE客户端连接
 type SSEClient struct {
 	ID             string
+	ClientID       string       // IH 作用域订阅的客户端 ID；为空表示 AH/未限定订阅
+	Capabilities   Capabilities // 订阅者通告的能力（CapabilitiesHeader），nil 表示未通告
 	Writer         http.ResponseWriter
 	Flusher        http.Flusher
 	TunnelChannel  chan *TunnelEvent  // 隧道事件通道
 	ServiceChannel chan *ServiceEvent // 服务配置事件通道
+	ExpiryChannel  chan *ExpiryEvent  // 会话/隧道到期提醒通道
+	ClientChannel  chan *ClientEvent  // IH 客户端事件通道（仅 IH 作用域订阅）
 	Done           chan struct{}
 	LastPing       time.Time
+
+	closeOnce  sync.Once
+	drops      atomic.Int64 // 广播时通道满载的连续丢弃次数
+	evicted    atomic.Bool  // 作为慢订阅者被断开
+	slowWrites int          // 连续慢写次数，仅由订阅 goroutine 访问
+}
+
+// close 关闭 Done（可重复调用）
+func (c *SSEClient) close() {
+	c.closeOnce.Do(func() { close(c.Done) })
+}
+
+// NotifierConfig 推送管理器配置
+type NotifierConfig struct {
+	Logger    logging.Logger
+	Heartbeat time.Duration // 心跳间隔，默认 30s
+	Clock     clock.Clock   // 默认真实时钟
+
+	// MinHeartbeat / MaxHeartbeat 订阅者通过 heartbeat 查询参数可请求的心跳间隔范围，默认 5s / 2min；
+	// 代理空闲超时较短时客户端可请求更密的心跳
+	MinHeartbeat time.Duration
+	MaxHeartbeat time.Duration
+
+	// Shards 订阅者注册表分片数，默认 64
+	Shards int
+	// BroadcastWorkers 广播时并行遍历分片的 worker 数，默认 min(GOMAXPROCS, Shards)
+	BroadcastWorkers int
+	// ChannelBuffer 每个订阅者各类事件通道的缓冲大小，默认 10
+	ChannelBuffer int
+	// MaxConsecutiveDrops 广播时订阅者通道连续满载丢弃达到该次数即断开其连接，
+	// 由客户端重连后重新同步，避免慢消费者长期静默丢事件；0 表示只丢弃不断开
+	MaxConsecutiveDrops int
+	// WriteTimeout 单次事件发送（写入 + Flush）的写截止时间，超时即断开该订阅者，
+	// 避免停止读取的客户端使订阅 goroutine 永久阻塞；默认 DefaultSSEWriteTimeout，负数禁用
+	WriteTimeout time.Duration
+	// SlowWriteThreshold / MaxSlowWrites 连续 MaxSlowWrites 次发送耗时达到 SlowWriteThreshold
+	// （默认 DefaultSlowWriteThreshold）即断开该订阅者；MaxSlowWrites 为 0 表示不检测
+	SlowWriteThreshold time.Duration
+	MaxSlowWrites      int
+	// ServiceBatchWindow 广播服务事件的合并窗口：窗口内的多个 NotifyService 合并为一个
+	// service_bulk_updated 事件（同一服务只保留最终状态），避免批量导入时逐条推送；0 表示不合并
+	ServiceBatchWindow time.Duration
+	// RateLimit 每个订阅者的隧道与服务事件速率限制，可由 SubscribeOptions.RateLimit 按订阅覆盖；nil 表示不限制
+	RateLimit *EventRateLimit
+	// Capabilities 在 connected 事件中向订阅者通告的能力，nil 时为 DefaultCapabilities()
+	Capabilities Capabilities
+	// Journal 事件日志：广播的隧道与服务事件先写入日志并以序号作为 SSE 事件 ID，
+	// 重连时按 Last-Event-ID 补发断线期间的事件；nil 表示不记录、不补发
+	Journal EventJournal
 }
 
 // Notifier SSE实时推送管理器
 // 从 controller/internal/api/tunnel_notifier.go 提取并重构
 // 支持混合方案：隧道事件（0x05）和服务配置事件（0x04）
+//
+// 订阅者按 ID 分片存储，广播由 worker 并行遍历分片并非阻塞投递到各订阅者通道，
+// 单个慢订阅者不会阻塞其他订阅者
 type Notifier struct {
-	clients   sync.Map // map[string]*SSEClient
-	logger    logging.Logger
-	heartbeat time.Duration
+	clients       *subscriberShards
+	logger        logging.Logger
+	heartbeat     time.Duration
+	minHeartbeat  time.Duration
+	maxHeartbeat  time.Duration
+	clock         clock.Clock
+	workers       int
+	channelBuffer int
+	maxDrops      int64
+	journal       EventJournal
+	capabilities  Capabilities
+	rateLimit     *EventRateLimit
+
+	writeTimeout       time.Duration
+	slowWriteThreshold time.Duration
+	maxSlowWrites      int
+
+	// 服务事件合并（ServiceBatchWindow > 0）
+	serviceWindow   time.Duration
+	batchMu         sync.Mutex
+	pendingService  []*ServiceEvent
+	pendingIndex    map[string]int // service_id -> pendingService 下标
+	flushScheduled  bool
+	batchGeneration uint64 // 每次推送后递增，过期的窗口计时不再触发推送
+
+	closeOnce sync.Once
+	done      chan struct{} // Close 后关闭，终止合并窗口计时 goroutine
 }
 
 // NewNotifier 创建新的推送管理器
 func NewNotifier(logger logging.Logger, heartbeat time.Duration) *Notifier {
+	return NewNotifierWithClock(logger, heartbeat, nil)
+}
+
+// NewNotifierWithClock 创建使用指定时钟的推送管理器，clk 为 nil 时使用真实时钟
+// 测试中注入 clock.NewFake 可通过 Advance 确定性地触发心跳
+func NewNotifierWithClock(logger logging.Logger, heartbeat time.Duration, clk clock.Clock) *Notifier {
+	return NewNotifierWithConfig(&NotifierConfig{Logger: logger, Heartbeat: heartbeat, Clock: clk})
+}
+
+// NewNotifierWithConfig 按配置创建推送管理器
+func NewNotifierWithConfig(config *NotifierConfig) *Notifier {
+	heartbeat := config.Heartbeat
 	if heartbeat == 0 {
-		heartbeat = 30 * time.Second
+		heartbeat = DefaultHeartbeat
+	}
+	minHeartbeat, maxHeartbeat := config.MinHeartbeat, config.MaxHeartbeat
+	if minHeartbeat <= 0 {
+		minHeartbeat = DefaultMinHeartbeat
+	}
+	if maxHeartbeat <= 0 {
+		maxHeartbeat = DefaultMaxHeartbeat
+	}
+	if maxHeartbeat < minHeartbeat {
+		maxHeartbeat = minHeartbeat
+	}
+	logger := config.Logger
+	if logger == nil {
+		logger = &noopLogger{}
+	}
+	shards := config.Shards
+	if shards <= 0 {
+		shards = 64
+	}
+	workers := config.BroadcastWorkers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > shards {
+		workers = shards
+	}
+	channelBuffer := config.ChannelBuffer
+	if channelBuffer <= 0 {
+		channelBuffer = 10
+	}
+	writeTimeout := config.WriteTimeout
+	if writeTimeout == 0 {
+		writeTimeout = DefaultSSEWriteTimeout
+	}
+	slowWriteThreshold := config.SlowWriteThreshold
+	if slowWriteThreshold <= 0 {
+		slowWriteThreshold = DefaultSlowWriteThreshold
+	}
+	capabilities := config.Capabilities
+	if capabilities == nil {
+		capabilities = DefaultCapabilities()
 	}
 
 	return &Notifier{
-		logger:    logger,
-		heartbeat: heartbeat,
+		clients:       newSubscriberShards(shards),
+		logger:        logger,
+		heartbeat:     heartbeat,
+		minHeartbeat:  minHeartbeat,
+		maxHeartbeat:  maxHeartbeat,
+		clock:         clock.Or(config.Clock),
+		workers:       workers,
+		channelBuffer: channelBuffer,
+		maxDrops:      int64(config.MaxConsecutiveDrops),
+		journal:       config.Journal,
+		capabilities:  capabilities,
+		rateLimit:     config.RateLimit,
+		serviceWindow: config.ServiceBatchWindow,
+		pendingIndex:  make(map[string]int),
+		done:          make(chan struct{}),
+
+		writeTimeout:       writeTimeout,
+		slowWriteThreshold: slowWriteThreshold,
+		maxSlowWrites:      config.MaxSlowWrites,
 	}
 }
 
 // Subscribe 处理客户端订阅
 func (n *Notifier) Subscribe(agentID string, w http.ResponseWriter) error {
+	return n.subscribe(agentID, "", &SubscribeOptions{}, w)
+}
+
+// SubscribeFrom 处理客户端订阅，先补发事件日志中 lastEventID（Last-Event-ID 请求头）之后的事件
+func (n *Notifier) SubscribeFrom(agentID, lastEventID string, w http.ResponseWriter) error {
+	return n.subscribe(agentID, "", &SubscribeOptions{LastEventID: lastEventID}, w)
+}
+
+// SubscribeWith 处理客户端订阅，按 opts 补发事件并协商心跳间隔
+func (n *Notifier) SubscribeWith(agentID string, opts *SubscribeOptions, w http.ResponseWriter) error {
+	return n.subscribe(agentID, "", opts, w)
+}
+
+// subscribe 保持 SSE 连接并分发事件；clientID 非空时为 IH 作用域订阅
+// IH 作用域订阅的 agentID 为 clientKey(clientID)，AH 订阅不可使用该前缀
+func (n *Notifier) subscribe(agentID, clientID string, opts *SubscribeOptions, w http.ResponseWriter) error {
+	if clientID == "" && strings.HasPrefix(agentID, clientKeyPrefix) {
+		return fmt.Errorf("%w: %s", ErrReservedAgentID, agentID)
+	}
+	if opts == nil {
+		opts = &SubscribeOptions{}
+	}
+	heartbeat := n.heartbeatFor(opts.Heartbeat)
+
 	// 设置 SSE 响应头
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("X-Accel-Buffering", "no") // 禁用 nginx 缓冲
 
 	// 确保支持流式响应
-	flusher, ok := w.(http.Flusher)
-	if !ok {
+	if _, ok := w.(http.Flusher); !ok {
 		return fmt.Errorf("streaming not supported")
 	}
+	// 之后的写入均带写截止时间，发送耗时用于慢订阅者检测
+	sw := newDeadlineWriter(w, n.writeTimeout)
+	w, flusher := http.ResponseWriter(sw), http.Flusher(sw)
 
 	// 创建客户端
 	client := &SSEClient{
 		ID:             agentID,
+		ClientID:       clientID,
+		Capabilities:   opts.Capabilities,
 		Writer:         w,
 		Flusher:        flusher,
-		TunnelChannel:  make(chan *TunnelEvent, 10),  // 缓冲 10 个隧道事件
-		ServiceChannel: make(chan *ServiceEvent, 10), // 缓冲 10 个服务事件
+		TunnelChannel:  make(chan *TunnelEvent, n.channelBuffer),
+		ServiceChannel: make(chan *ServiceEvent, n.channelBuffer),
+		ExpiryChannel:  make(chan *ExpiryEvent, n.channelBuffer),
+		ClientChannel:  make(chan *ClientEvent, n.channelBuffer),
 		Done:           make(chan struct{}),
-		LastPing:       time.Now(),
+		LastPing:       n.clock.Now(),
 	}
 
 	// 存储客户端
-	n.clients.Store(agentID, client)
+	n.clients.store(agentID, client)
 	defer func() {
-		n.clients.Delete(agentID)
-		select {
-		case <-client.Done:
-			// Already closed
-		default:
-			close(client.Done)
-		}
+		// 同一 ID 重连时新连接已覆盖映射，只删除自己
+		n.clients.compareAndDelete(agentID, client)
+		client.close()
 	}()
 
-	n.logger.Info("SSE client connected", "agent_id", agentID)
+	n.logger.Info("SSE client connected", "agent_id", agentID, "client_scoped", clientID != "")
 
-	// 发送初始连接消息
-	fmt.Fprintf(w, "event: connected\ndata: {\"agent_id\":\"%s\",\"timestamp\":%d}\n\n", agentID, time.Now().Unix())
+	// 发送初始连接消息，heartbeat 为协商后的心跳间隔（秒），订阅者据此检测心跳丢失；
+	// capabilities 为 Notifier 一方支持的能力
+	capabilities, _ := json.Marshal(n.capabilities)
+	fmt.Fprintf(w, "event: connected\ndata: {\"agent_id\":\"%s\",\"timestamp\":%d,\"heartbeat\":%g,\"capabilities\":%s}\n\n",
+		agentID, n.clock.Now().Unix(), heartbeat.Seconds(), capabilities)
 	flusher.Flush()
+	if err := n.checkWrite(client, sw); err != nil {
+		return err
+	}
+
+	// 补发断线期间的事件；之后通道中序号不大于 replayed 的事件已补发过，跳过
+	replayed, err := n.replay(client, opts.LastEventID)
+	if err != nil {
+		return err
+	}
+	if err := n.checkWrite(client, sw); err != nil {
+		return err
+	}
 
 	// 心跳 ticker
-	ticker := time.NewTicker(n.heartbeat)
+	ticker := n.clock.NewTicker(heartbeat)
 	defer ticker.Stop()
 
+	rateLimit := opts.RateLimit
+	if rateLimit == nil {
+		rateLimit = n.rateLimit
+	}
+	limiter := n.newRateLimiter(rateLimit)
+
 	// 事件循环
 	for {
 		select {
-		case <-ticker.C:
+		case <-ticker.C():
 			// 发送心跳
 			n.logger.Debug("Sending heartbeat", "agent_id", agentID)
 			fmt.Fprintf(w, ": ping\n\n")
 			flusher.Flush()
-			client.LastPing = time.Now()
+			client.LastPing = n.clock.Now()
 
 		case event := <-client.TunnelChannel:
+			if event.Seq != 0 && event.Seq <= replayed {
+				continue
+			}
+			if send, err := n.limitEvent(client, limiter, tunnelPending(event)); err != nil {
+				return err
+			} else if !send {
+				continue
+			}
 			// 发送隧道事件
+			faults.DelaySSE()
 			n.logger.Info("Dequeued tunnel event from channel, sending to SSE",
 				"agent_id", agentID,
 				"tunnel_id", event.Tunnel.ID,
@@ -115,69 +325,115 @@ func (n *Notifier) Subscribe(agentID string, w http.ResponseWriter) error {
 			n.logger.Info("Tunnel event sent successfully via SSE", "agent_id", agentID, "tunnel_id", event.Tunnel.ID)
 
 		case event := <-client.ServiceChannel:
+			if event.Seq != 0 && event.Seq <= replayed {
+				continue
+			}
+			if send, err := n.limitEvent(client, limiter, servicePending(event)); err != nil {
+				return err
+			} else if !send {
+				continue
+			}
 			// 发送服务配置事件
+			faults.DelaySSE()
 			if err := n.sendServiceEvent(w, flusher, event); err != nil {
 				n.logger.Error("Failed to send service event", "agent_id", agentID, "error", err)
 				return err
 			}
 
+		case <-limiter.drainC():
+			// 推送速率受限而暂存的事件
+			if err := n.flushPending(limiter, w, flusher); err != nil {
+				n.logger.Error("Failed to send rate-limited events", "agent_id", agentID, "error", err)
+				return err
+			}
+
+		case event := <-client.ExpiryChannel:
+			// 发送到期提醒
+			faults.DelaySSE()
+			if err := n.sendExpiryEvent(w, flusher, event); err != nil {
+				n.logger.Error("Failed to send expiry event", "agent_id", agentID, "error", err)
+				return err
+			}
+
+		case event := <-client.ClientChannel:
+			// 发送 IH 客户端事件
+			faults.DelaySSE()
+			if err := n.sendClientEvent(w, flusher, event); err != nil {
+				n.logger.Error("Failed to send client event", "agent_id", agentID, "error", err)
+				return err
+			}
+			if event.Type == EventSessionRevoked {
+				n.logger.Info("Session revoked, closing client stream", "agent_id", agentID)
+				return nil
+			}
+
 		case <-client.Done:
+			if client.evicted.Load() {
+				return fmt.Errorf("sse client %s evicted after %d dropped events", agentID, client.drops.Load())
+			}
 			n.logger.Info("SSE client disconnected", "agent_id", agentID)
 			return nil
 		}
+
+		if err := n.checkWrite(client, sw); err != nil {
+			return err
+		}
 	}
 }
 
 // sendTunnelEvent 发送隧道事件到客户端
 func (n *Notifier) sendTunnelEvent(w http.ResponseWriter, flusher http.Flusher, event *TunnelEvent) error {
-	// 序列化完整的 TunnelEvent（包含 Type 和 Tunnel）
-	data, err := json.Marshal(event)
-	if err != nil {
+	// SSE 格式：event: tunnel\n[id: <seq>\n]data: <TunnelEvent JSON>\n\n（完整的 TunnelEvent，包含 Type 和 Tunnel）
+	if err := writeSSEFrame(w, flusher, event.frame, "tunnel", event.Seq, event); err != nil {
 		return fmt.Errorf("marshal tunnel event: %w", err)
 	}
 
-	n.logger.Debug("Sending SSE tunnel event", "data_length", len(data), "event_type", event.Type)
-
-	// SSE 格式：event: tunnel\ndata: <TunnelEvent JSON>\n\n
-	fmt.Fprintf(w, "event: tunnel\ndata: %s\n\n", data)
-	flusher.Flush()
-
 	n.logger.Debug("SSE tunnel event sent", "event_type", event.Type)
 	return nil
 }
 
 // sendServiceEvent 发送服务配置事件到客户端
+// 单个事件的数据为 ServiceConfig，service_bulk_updated 的数据为完整 ServiceEvent（含 events）
 func (n *Notifier) sendServiceEvent(w http.ResponseWriter, flusher http.Flusher, event *ServiceEvent) error {
-	data, err := json.Marshal(event.Service)
-	if err != nil {
+	// SSE 格式：event: <type>\n[id: <seq>\n]data: <json>\n\n
+	if err := writeSSEFrame(w, flusher, event.frame, string(event.Type), event.Seq, event.payload()); err != nil {
 		return fmt.Errorf("marshal service event: %w", err)
 	}
-
-	// SSE 格式：event: <type>\ndata: <json>\n\n
-	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
-	flusher.Flush()
-
 	return nil
 }
 
+// payload 事件推送的数据：单个事件为 ServiceConfig，service_bulk_updated 为完整 ServiceEvent
+func (e *ServiceEvent) payload() interface{} {
+	if e.Type == ServiceEventBulkUpdated {
+		return e
+	}
+	return e.Service
+}
+
 // Notify 广播隧道事件给所有订阅客户端
 func (n *Notifier) Notify(event *TunnelEvent) error {
 	if event.Timestamp.IsZero() {
-		event.Timestamp = time.Now()
+		event.Timestamp = n.clock.Now()
+	}
+	n.journalTunnelEvent(event)
+
+	// 只编码一次，所有订阅者共用；广播副本，不修改调用方的事件
+	if n.clients.count() > 0 {
+		shared := *event
+		shared.frame = cachedSSEFrame("tunnel", event.Seq, event)
+		event = &shared
 	}
 
-	count := 0
-	n.clients.Range(func(key, value interface{}) bool {
-		client := value.(*SSEClient)
+	count := n.broadcast(func(client *SSEClient) bool {
+		if client.ClientID != "" && (event.Tunnel == nil || event.Tunnel.ClientID != client.ClientID) {
+			// IH 作用域订阅只接收自己的隧道事件
+			return false
+		}
 
 		select {
 		case client.TunnelChannel <- event:
-			count++
-			n.logger.Debug("Tunnel event sent to client",
-				"agent_id", client.ID,
-				"event_type", event.Type,
-				"tunnel_id", event.Tunnel.ID,
-			)
+			client.drops.Store(0)
+			return true
 		case <-client.Done:
 			// 客户端已断开
 		default:
@@ -186,9 +442,9 @@ func (n *Notifier) Notify(event *TunnelEvent) error {
 				"agent_id", client.ID,
 				"event_type", event.Type,
 			)
+			n.recordDrop(client)
 		}
-
-		return true
+		return false
 	})
 
 	n.logger.Info("Tunnel event broadcasted",
@@ -201,23 +457,39 @@ func (n *Notifier) Notify(event *TunnelEvent) error {
 }
 
 // NotifyService 广播服务配置事件给所有订阅客户端
+// 配置了 ServiceBatchWindow 时事件先进入合并窗口，窗口结束后统一推送
 func (n *Notifier) NotifyService(event *ServiceEvent) error {
 	if event.Timestamp.IsZero() {
-		event.Timestamp = time.Now()
+		event.Timestamp = n.clock.Now()
+	}
+	if n.serviceWindow > 0 {
+		n.enqueueServiceEvent(event)
+		return nil
+	}
+	return n.broadcastService(event)
+}
+
+// broadcastService 立即广播服务配置事件
+func (n *Notifier) broadcastService(event *ServiceEvent) error {
+	n.journalServiceEvent(event)
+
+	// 只编码一次，所有订阅者共用；广播副本，不修改调用方的事件
+	if n.clients.count() > 0 {
+		shared := *event
+		shared.frame = cachedSSEFrame(string(event.Type), event.Seq, event.payload())
+		event = &shared
 	}
 
-	count := 0
-	n.clients.Range(func(key, value interface{}) bool {
-		client := value.(*SSEClient)
+	count := n.broadcast(func(client *SSEClient) bool {
+		if client.ClientID != "" {
+			// 服务配置事件仅推送给 AH
+			return false
+		}
 
 		select {
 		case client.ServiceChannel <- event:
-			count++
-			n.logger.Debug("Service event sent to client",
-				"agent_id", client.ID,
-				"event_type", event.Type,
-				"service_id", event.Service.ServiceID,
-			)
+			client.drops.Store(0)
+			return true
 		case <-client.Done:
 			// 客户端已断开
 		default:
@@ -226,16 +498,23 @@ func (n *Notifier) NotifyService(event *ServiceEvent) error {
 				"agent_id", client.ID,
 				"event_type", event.Type,
 			)
+			n.recordDrop(client)
 		}
-
-		return true
+		return false
 	})
 
-	n.logger.Info("Service event broadcasted",
-		"event_type", event.Type,
-		"service_id", event.Service.ServiceID,
-		"clients", count,
-	)
+	if event.Type == ServiceEventBulkUpdated {
+		n.logger.Info("Service events broadcasted in bulk",
+			"services", len(event.Events),
+			"clients", count,
+		)
+	} else {
+		n.logger.Info("Service event broadcasted",
+			"event_type", event.Type,
+			"service_id", event.Service.ServiceID,
+			"clients", count,
+		)
+	}
 
 	return nil
 }
@@ -243,18 +522,17 @@ func (n *Notifier) NotifyService(event *ServiceEvent) error {
 // NotifyOne 发送隧道事件给特定客户端
 func (n *Notifier) NotifyOne(agentID string, event *TunnelEvent) error {
 	if event.Timestamp.IsZero() {
-		event.Timestamp = time.Now()
+		event.Timestamp = n.clock.Now()
 	}
 
 	n.logger.Debug("NotifyOne called", "agent_id", agentID, "tunnel_id", event.Tunnel.ID)
 
-	value, ok := n.clients.Load(agentID)
+	client, ok := n.clients.load(agentID)
 	if !ok {
 		n.logger.Warn("Client not found in clients map", "agent_id", agentID)
 		return fmt.Errorf("client not found: %s", agentID)
 	}
 
-	client := value.(*SSEClient)
 	n.logger.Debug("Client found, attempting to send to channel",
 		"agent_id", agentID,
 		"channel_cap", cap(client.TunnelChannel),
@@ -283,16 +561,14 @@ func (n *Notifier) NotifyOne(agentID string, event *TunnelEvent) error {
 // NotifyServiceOne 发送服务配置事件给特定客户端
 func (n *Notifier) NotifyServiceOne(agentID string, event *ServiceEvent) error {
 	if event.Timestamp.IsZero() {
-		event.Timestamp = time.Now()
+		event.Timestamp = n.clock.Now()
 	}
 
-	value, ok := n.clients.Load(agentID)
+	client, ok := n.clients.load(agentID)
 	if !ok {
 		return fmt.Errorf("client not found: %s", agentID)
 	}
 
-	client := value.(*SSEClient)
-
 	select {
 	case client.ServiceChannel <- event:
 		n.logger.Debug("Service event sent to client",
@@ -308,23 +584,93 @@ func (n *Notifier) NotifyServiceOne(agentID string, event *ServiceEvent) error {
 	}
 }
 
+// broadcast 由 worker 并行遍历各分片，对每个订阅者调用 deliver，返回 deliver 成功的数量
+// deliver 必须非阻塞；遍历时复制分片快照，投递期间不持有分片锁
+func (n *Notifier) broadcast(deliver func(*SSEClient) bool) int {
+	var delivered atomic.Int64
+	var next atomic.Int64
+	shards := int64(len(n.clients.shards))
+
+	work := func() {
+		var buf []*SSEClient
+		for {
+			i := next.Add(1) - 1
+			if i >= shards {
+				return
+			}
+			buf = n.clients.snapshot(int(i), buf[:0])
+			for _, client := range buf {
+				if deliver(client) {
+					delivered.Add(1)
+				}
+			}
+		}
+	}
+
+	if n.workers <= 1 {
+		work()
+		return int(delivered.Load())
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < n.workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			work()
+		}()
+	}
+	wg.Wait()
+
+	return int(delivered.Load())
+}
+
+// recordDrop 累计订阅者连续丢弃次数，达到 MaxConsecutiveDrops 时断开该订阅者
+func (n *Notifier) recordDrop(client *SSEClient) {
+	drops := client.drops.Add(1)
+	if n.maxDrops <= 0 || drops < n.maxDrops {
+		return
+	}
+	n.evict(client, EvictReasonChannelFull, "consecutive_drops", drops)
+}
+
 // GetClients 获取所有连接的客户端ID
 func (n *Notifier) GetClients() []string {
-	var clients []string
+	return n.clients.ids()
+}
 
-	n.clients.Range(func(key, value interface{}) bool {
-		clients = append(clients, key.(string))
-		return true
-	})
+// ClientCapabilities 已连接订阅者通告的能力；未连接时 ok 为 false，
+// 已连接但未通告（旧版本订阅者）时返回 nil，按 Capabilities.Supports 判断
+func (n *Notifier) ClientCapabilities(agentID string) (caps Capabilities, ok bool) {
+	client, ok := n.clients.load(agentID)
+	if !ok {
+		return nil, false
+	}
+	return client.Capabilities, true
+}
+
+// ClientCount 当前连接的订阅者数量
+func (n *Notifier) ClientCount() int {
+	return n.clients.count()
+}
 
-	return clients
+// Close 推送合并窗口中尚未发出的服务事件，断开全部订阅者并停止后台 goroutine（幂等）
+// 订阅者的 Subscribe 调用随之返回；Close 之后不应再调用 Notify*
+func (n *Notifier) Close() error {
+	n.closeOnce.Do(func() {
+		n.FlushServiceEvents()
+		close(n.done)
+		for _, id := range n.clients.ids() {
+			n.Unsubscribe(id)
+		}
+	})
+	return nil
 }
 
-// Unsubscribe 取消订阅
+// Unsubscribe 取消 AH 订阅（IH 作用域订阅使用 UnsubscribeClient）
 func (n *Notifier) Unsubscribe(agentID string) {
-	if value, ok := n.clients.LoadAndDelete(agentID); ok {
-		client := value.(*SSEClient)
-		close(client.Done)
+	if client, ok := n.clients.loadAndDelete(agentID); ok {
+		client.close()
 		n.logger.Info("SSE client unsubscribed", "agent_id", agentID)
 	}
 }
@@ -0,0 +1,82 @@
+package tunnel
+
+// enqueueServiceEvent 将服务事件放入合并窗口，首个事件到达时启动窗口计时
+func (n *Notifier) enqueueServiceEvent(event *ServiceEvent) {
+	n.batchMu.Lock()
+	defer n.batchMu.Unlock()
+
+	serviceID := ""
+	if event.Service != nil {
+		serviceID = event.Service.ServiceID
+	}
+	if i, ok := n.pendingIndex[serviceID]; ok {
+		n.pendingService[i] = coalesceServiceEvent(n.pendingService[i], event)
+	} else {
+		n.pendingIndex[serviceID] = len(n.pendingService)
+		n.pendingService = append(n.pendingService, event)
+	}
+
+	if !n.flushScheduled {
+		n.flushScheduled = true
+		generation := n.batchGeneration
+		after := n.clock.After(n.serviceWindow)
+		go func() {
+			select {
+			case <-after:
+				n.flushServiceEvents(generation)
+			case <-n.done:
+			}
+		}()
+	}
+}
+
+// coalesceServiceEvent 合并同一服务的两个事件，保留最终配置
+// 窗口内先创建后更新的服务对订阅者而言仍是新建
+func coalesceServiceEvent(prev, next *ServiceEvent) *ServiceEvent {
+	merged := *next
+	if prev.Type == ServiceEventCreated && next.Type == ServiceEventUpdated {
+		merged.Type = ServiceEventCreated
+		merged.frame = nil // 预编码帧对应原事件类型
+	}
+	return &merged
+}
+
+// FlushServiceEvents 立即推送合并窗口中的服务事件（如批量导入结束时），
+// 只有一个事件时按原类型推送，多个事件合并为一个 service_bulk_updated
+func (n *Notifier) FlushServiceEvents() {
+	n.batchMu.Lock()
+	n.flushLocked()
+}
+
+// flushServiceEvents 窗口到期时推送；窗口内已被手动 Flush 时跳过（下一批有自己的窗口）
+func (n *Notifier) flushServiceEvents(generation uint64) {
+	n.batchMu.Lock()
+	if generation != n.batchGeneration {
+		n.batchMu.Unlock()
+		return
+	}
+	n.flushLocked()
+}
+
+// flushLocked 取出待推送事件并释放 batchMu 后广播
+func (n *Notifier) flushLocked() {
+	events := n.pendingService
+	n.pendingService = nil
+	n.pendingIndex = make(map[string]int)
+	n.flushScheduled = false
+	n.batchGeneration++
+	n.batchMu.Unlock()
+
+	switch len(events) {
+	case 0:
+		return
+	case 1:
+		n.broadcastService(events[0])
+	default:
+		n.broadcastService(&ServiceEvent{
+			Type:      ServiceEventBulkUpdated,
+			Events:    events,
+			Timestamp: n.clock.Now(),
+		})
+	}
+}
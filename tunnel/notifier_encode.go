@@ -0,0 +1,73 @@
+package tunnel
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// maxPooledSSEBuffer 超过该容量的编码缓冲不放回池中，避免个别大事件长期占用内存
+const maxPooledSSEBuffer = 64 << 10
+
+// sseBufferPool 复用 SSE 帧编码缓冲
+var sseBufferPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// encodeSSEFrame 将事件编码为完整的 SSE 帧：event: <type>\n[id: <seq>\n]data: <json>\n\n
+// 返回的缓冲来自 sseBufferPool，用完后须调用 releaseSSEBuffer
+func encodeSSEFrame(eventType string, seq uint64, payload interface{}) (*bytes.Buffer, error) {
+	buf := sseBufferPool.Get().(*bytes.Buffer)
+	buf.WriteString("event: ")
+	buf.WriteString(eventType)
+	buf.WriteByte('\n')
+	if seq != 0 {
+		buf.WriteString("id: ")
+		buf.Write(strconv.AppendUint(buf.AvailableBuffer(), seq, 10))
+		buf.WriteByte('\n')
+	}
+	buf.WriteString("data: ")
+	// Encode 与 json.Marshal 输出一致，末尾换行即 data 行的结束
+	if err := json.NewEncoder(buf).Encode(payload); err != nil {
+		releaseSSEBuffer(buf)
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	return buf, nil
+}
+
+// releaseSSEBuffer 将编码缓冲放回池中
+func releaseSSEBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledSSEBuffer {
+		return
+	}
+	buf.Reset()
+	sseBufferPool.Put(buf)
+}
+
+// cachedSSEFrame 编码一次供广播的所有订阅者共用；编码失败时返回 nil，由各订阅者发送时报告错误
+func cachedSSEFrame(eventType string, seq uint64, payload interface{}) []byte {
+	buf, err := encodeSSEFrame(eventType, seq, payload)
+	if err != nil {
+		return nil
+	}
+	defer releaseSSEBuffer(buf)
+	return bytes.Clone(buf.Bytes())
+}
+
+// writeSSEFrame 写出事件帧：优先使用广播时预编码的 frame，否则（单播、补发）用池化缓冲即时编码
+func writeSSEFrame(w http.ResponseWriter, flusher http.Flusher, frame []byte, eventType string, seq uint64, payload interface{}) error {
+	if frame == nil {
+		buf, err := encodeSSEFrame(eventType, seq, payload)
+		if err != nil {
+			return err
+		}
+		defer releaseSSEBuffer(buf)
+		frame = buf.Bytes()
+	}
+	w.Write(frame)
+	flusher.Flush()
+	return nil
+}
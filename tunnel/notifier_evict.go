@@ -0,0 +1,130 @@
+package tunnel
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// 慢订阅者检测默认值
+const (
+	// DefaultSSEWriteTimeout 单次事件发送（写入 + Flush）的写截止时间
+	DefaultSSEWriteTimeout = 10 * time.Second
+	// DefaultSlowWriteThreshold 单次发送耗时达到该值计为一次慢写
+	DefaultSlowWriteThreshold = time.Second
+)
+
+// 订阅者被断开的原因（sse_subscriber_evictions_total 的 reason 标签）
+const (
+	EvictReasonChannelFull  = "channel_full"  // 广播时通道连续满载，达到 MaxConsecutiveDrops
+	EvictReasonWriteTimeout = "write_timeout" // 单次发送超过 WriteTimeout
+	EvictReasonSlowWrites   = "slow_writes"   // 连续 MaxSlowWrites 次发送超过 SlowWriteThreshold
+)
+
+// sseEvictions 按原因统计被断开的慢订阅者
+var sseEvictions = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "sse_subscriber_evictions_total",
+		Help: "SSE subscribers disconnected by the notifier as slow consumers, by reason",
+	},
+	[]string{"reason"},
+)
+
+// deadlineWriter 订阅者连接的写入包装：每次发送的首个 Write 设置写截止时间，Flush 后清除，
+// 空闲期间（等待事件、心跳间隔）不受截止时间与 http.Server.WriteTimeout 影响。
+// 记录首个写错误与最近一次发送耗时；底层不支持写截止时间（如 httptest.ResponseRecorder）时只做记录
+type deadlineWriter struct {
+	http.ResponseWriter
+	rc      *http.ResponseController
+	timeout time.Duration
+
+	started time.Time     // 本次发送开始时间，零值表示空闲
+	elapsed time.Duration // 最近一次发送耗时
+	sent    bool          // 上次 checkWrite 之后完成过发送
+	err     error
+}
+
+func newDeadlineWriter(w http.ResponseWriter, timeout time.Duration) *deadlineWriter {
+	return &deadlineWriter{ResponseWriter: w, rc: http.NewResponseController(w), timeout: timeout}
+}
+
+func (w *deadlineWriter) Write(b []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	if w.started.IsZero() {
+		w.started = time.Now()
+		if w.timeout > 0 {
+			w.rc.SetWriteDeadline(w.started.Add(w.timeout))
+		}
+	}
+	n, err := w.ResponseWriter.Write(b)
+	if err != nil {
+		w.err = err
+	}
+	return n, err
+}
+
+// Flush 结束一次发送
+func (w *deadlineWriter) Flush() {
+	if w.err == nil {
+		if err := w.rc.Flush(); err != nil {
+			w.err = err
+		}
+	}
+	if w.started.IsZero() {
+		return
+	}
+	w.elapsed = time.Since(w.started)
+	w.started = time.Time{}
+	w.sent = true
+	if w.timeout > 0 {
+		w.rc.SetWriteDeadline(time.Time{})
+	}
+}
+
+// checkWrite 检查最近一次发送：写超时、或连续 MaxSlowWrites 次发送耗时达到 SlowWriteThreshold 时
+// 断开订阅者并返回错误；其他写错误（连接已断开）直接返回
+func (n *Notifier) checkWrite(client *SSEClient, w *deadlineWriter) error {
+	if w.err != nil {
+		var netErr net.Error
+		if errors.Is(w.err, os.ErrDeadlineExceeded) || (errors.As(w.err, &netErr) && netErr.Timeout()) {
+			n.evict(client, EvictReasonWriteTimeout, "write_timeout", n.writeTimeout)
+			return fmt.Errorf("sse client %s evicted: %s", client.ID, EvictReasonWriteTimeout)
+		}
+		return fmt.Errorf("write sse event: %w", w.err)
+	}
+
+	if !w.sent || n.maxSlowWrites <= 0 {
+		return nil
+	}
+	w.sent = false
+	if w.elapsed < n.slowWriteThreshold {
+		client.slowWrites = 0
+		return nil
+	}
+	client.slowWrites++
+	if client.slowWrites < n.maxSlowWrites {
+		return nil
+	}
+	n.evict(client, EvictReasonSlowWrites, "slow_writes", client.slowWrites, "last_write", w.elapsed)
+	return fmt.Errorf("sse client %s evicted: %s", client.ID, EvictReasonSlowWrites)
+}
+
+// evict 从注册表移除订阅者、关闭其连接并计入 sse_subscriber_evictions_total；
+// 同一 ID 已被新连接覆盖或已断开时不做处理
+func (n *Notifier) evict(client *SSEClient, reason string, args ...interface{}) {
+	if !n.clients.compareAndDelete(client.ID, client) {
+		return
+	}
+	client.evicted.Store(true)
+	client.close()
+	sseEvictions.WithLabelValues(reason).Inc()
+	n.logger.Warn("Evicting slow SSE client", append([]interface{}{"agent_id", client.ID, "reason", reason}, args...)...)
+}
@@ -0,0 +1,108 @@
+package tunnel
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// journalTunnelEvent 写入事件日志并为事件分配序号（会话令牌不落盘）
+func (n *Notifier) journalTunnelEvent(event *TunnelEvent) {
+	if n.journal == nil {
+		return
+	}
+
+	stored := *event
+	clientID := ""
+	if event.Tunnel != nil {
+		tun := *event.Tunnel
+		tun.SessionToken = ""
+		stored.Tunnel = &tun
+		clientID = tun.ClientID
+	}
+
+	entry, err := newJournalEntry(JournalKindTunnel, string(event.Type), clientID, &stored, event.Timestamp)
+	if err == nil {
+		event.Seq, err = n.journal.Append(context.Background(), entry)
+	}
+	if err != nil {
+		n.logger.Warn("Failed to journal tunnel event", "event_type", event.Type, "error", err)
+	}
+}
+
+// journalServiceEvent 写入事件日志并为事件分配序号
+func (n *Notifier) journalServiceEvent(event *ServiceEvent) {
+	if n.journal == nil {
+		return
+	}
+
+	entry, err := newJournalEntry(JournalKindService, string(event.Type), "", event, event.Timestamp)
+	if err == nil {
+		event.Seq, err = n.journal.Append(context.Background(), entry)
+	}
+	if err != nil {
+		n.logger.Warn("Failed to journal service event", "event_type", event.Type, "error", err)
+	}
+}
+
+// replay 补发事件日志中 lastEventID 之后、订阅者有权接收的事件，返回补发到的最大序号
+// 日志不可用时只记录告警，不影响订阅（客户端照常接收后续实时事件）
+func (n *Notifier) replay(client *SSEClient, lastEventID string) (uint64, error) {
+	if n.journal == nil {
+		return 0, nil
+	}
+	seq, ok := ParseEventID(lastEventID)
+	if !ok {
+		return 0, nil
+	}
+
+	entries, err := n.journal.Since(context.Background(), seq, defaultJournalReplayLimit)
+	if err != nil {
+		n.logger.Warn("Failed to read event journal for replay", "agent_id", client.ID, "last_event_id", lastEventID, "error", err)
+		return 0, nil
+	}
+
+	var replayed uint64
+	sent := 0
+	for _, entry := range entries {
+		replayed = entry.Seq
+		switch entry.Kind {
+		case JournalKindTunnel:
+			if client.ClientID != "" && entry.ClientID != client.ClientID {
+				continue
+			}
+			var event TunnelEvent
+			if err := json.Unmarshal(entry.Data, &event); err != nil {
+				n.logger.Warn("Skipping malformed journal entry", "seq", entry.Seq, "error", err)
+				continue
+			}
+			event.Seq = entry.Seq
+			if err := n.sendTunnelEvent(client.Writer, client.Flusher, &event); err != nil {
+				return replayed, fmt.Errorf("replay event %d: %w", entry.Seq, err)
+			}
+		case JournalKindService:
+			if client.ClientID != "" {
+				// 服务配置事件仅推送给 AH
+				continue
+			}
+			var event ServiceEvent
+			if err := json.Unmarshal(entry.Data, &event); err != nil {
+				n.logger.Warn("Skipping malformed journal entry", "seq", entry.Seq, "error", err)
+				continue
+			}
+			event.Seq = entry.Seq
+			if err := n.sendServiceEvent(client.Writer, client.Flusher, &event); err != nil {
+				return replayed, fmt.Errorf("replay event %d: %w", entry.Seq, err)
+			}
+		default:
+			continue
+		}
+		sent++
+	}
+
+	n.logger.Info("Replayed journal events", "agent_id", client.ID, "last_event_id", lastEventID, "events", sent)
+	if len(entries) == defaultJournalReplayLimit {
+		n.logger.Warn("Journal replay truncated, client should resync", "agent_id", client.ID, "limit", defaultJournalReplayLimit)
+	}
+	return replayed, nil
+}
@@ -0,0 +1,233 @@
+package tunnel
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/houzhh15/sdp-common/clock"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// OverflowPolicy 订阅者超出事件速率限制时的处理方式
+type OverflowPolicy string
+
+const (
+	// OverflowCoalesce 暂存待发事件，同一隧道/服务只保留最终状态（先创建后更新仍为创建）
+	OverflowCoalesce OverflowPolicy = "coalesce"
+	// OverflowDropOldest 按序暂存待发事件，暂存已满时丢弃最早的事件
+	OverflowDropOldest OverflowPolicy = "drop_oldest"
+	// OverflowDisconnect 断开订阅者，由其重连后按 Last-Event-ID 补发或全量同步
+	OverflowDisconnect OverflowPolicy = "disconnect"
+)
+
+// DefaultRateLimitPending 速率受限时每个订阅者默认最多暂存的事件数
+const DefaultRateLimitPending = 100
+
+// EvictReasonRateLimited 超出事件速率限制且溢出策略为 OverflowDisconnect
+const EvictReasonRateLimited = "rate_limited"
+
+// EventRateLimit 订阅者的隧道与服务事件速率限制（令牌桶），到期提醒与 IH 客户端事件不受限制
+type EventRateLimit struct {
+	// Rate 每秒推送的事件数，<= 0 表示不限制
+	Rate float64
+	// Burst 突发容量，默认 max(1, Rate)
+	Burst int
+	// Overflow 超出速率时的处理方式，默认 OverflowCoalesce
+	Overflow OverflowPolicy
+	// MaxPending 最多暂存的待发事件数（合并策略下按隧道/服务计），默认 DefaultRateLimitPending；
+	// 暂存已满时丢弃最早的事件
+	MaxPending int
+}
+
+// sseRateLimited 按处理结果统计超出速率限制的事件：delayed（暂存后推送）、coalesced（被同一对象的新事件合并）、
+// dropped（暂存已满被丢弃）；disconnect 策略断开的订阅者计入 sse_subscriber_evictions_total{reason="rate_limited"}
+var sseRateLimited = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "sse_rate_limited_events_total",
+		Help: "SSE events held back by per-subscriber rate limits, by outcome",
+	},
+	[]string{"policy", "outcome"},
+)
+
+// tokenBucket 令牌桶，仅由订阅 goroutine 访问
+type tokenBucket struct {
+	clock  clock.Clock
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(limit *EventRateLimit, clk clock.Clock) *tokenBucket {
+	burst := float64(limit.Burst)
+	if burst <= 0 {
+		burst = max(1, limit.Rate)
+	}
+	return &tokenBucket{clock: clk, rate: limit.Rate, burst: burst, tokens: burst, last: clk.Now()}
+}
+
+func (b *tokenBucket) refill() {
+	now := b.clock.Now()
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+// allow 消耗一个令牌，令牌不足时返回 false
+func (b *tokenBucket) allow() bool {
+	b.refill()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// wait 距下一个令牌可用的时间
+func (b *tokenBucket) wait() time.Duration {
+	b.refill()
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// pendingEvent 速率受限而暂存的隧道或服务事件
+type pendingEvent struct {
+	key     string // 合并键：tunnel:<id> / service:<id>
+	tunnel  *TunnelEvent
+	service *ServiceEvent
+}
+
+// limitEvent 速率限制下事件是否立即推送；disconnect 策略超出速率时断开订阅者并返回错误
+func (n *Notifier) limitEvent(client *SSEClient, l *rateLimiter, event *pendingEvent) (bool, error) {
+	send, evict := n.admit(l, event)
+	if evict {
+		n.evict(client, EvictReasonRateLimited, "rate", l.bucket.rate, "burst", l.bucket.burst)
+		return false, fmt.Errorf("sse client %s evicted: %s", client.ID, EvictReasonRateLimited)
+	}
+	return send, nil
+}
+
+// rateLimiter 订阅者的速率限制状态：令牌桶与按序暂存的待发事件
+type rateLimiter struct {
+	bucket     *tokenBucket
+	policy     OverflowPolicy
+	maxPending int
+	pending    []*pendingEvent
+	drain      <-chan time.Time // 暂存非空时等待下一个令牌
+}
+
+// newRateLimiter 按配置创建速率限制，未配置或 Rate <= 0 时返回 nil
+func (n *Notifier) newRateLimiter(limit *EventRateLimit) *rateLimiter {
+	if limit == nil || limit.Rate <= 0 {
+		return nil
+	}
+	policy := limit.Overflow
+	if policy == "" {
+		policy = OverflowCoalesce
+	}
+	maxPending := limit.MaxPending
+	if maxPending <= 0 {
+		maxPending = DefaultRateLimitPending
+	}
+	return &rateLimiter{bucket: newTokenBucket(limit, n.clock), policy: policy, maxPending: maxPending}
+}
+
+// drainC 等待下一个令牌的通道；未限制或没有暂存事件时为 nil（select 中永不就绪）
+func (l *rateLimiter) drainC() <-chan time.Time {
+	if l == nil {
+		return nil
+	}
+	return l.drain
+}
+
+// admit 判断事件能否立即推送；否则按溢出策略暂存。disconnect 策略下返回 false 与 evict=true
+// 有暂存事件时新事件排在其后，保证推送顺序
+func (n *Notifier) admit(l *rateLimiter, event *pendingEvent) (send, evict bool) {
+	if l == nil || (len(l.pending) == 0 && l.bucket.allow()) {
+		return true, false
+	}
+	if l.policy == OverflowDisconnect {
+		return false, true
+	}
+
+	if l.policy == OverflowCoalesce {
+		for i, prev := range l.pending {
+			if prev.key == event.key {
+				l.pending[i] = coalescePending(prev, event)
+				sseRateLimited.WithLabelValues(string(l.policy), "coalesced").Inc()
+				return false, false
+			}
+		}
+	}
+	if len(l.pending) >= l.maxPending {
+		l.pending = l.pending[1:]
+		sseRateLimited.WithLabelValues(string(l.policy), "dropped").Inc()
+	}
+	l.pending = append(l.pending, event)
+	sseRateLimited.WithLabelValues(string(l.policy), "delayed").Inc()
+	if l.drain == nil {
+		l.drain = n.clock.After(l.bucket.wait())
+	}
+	return false, false
+}
+
+// flushPending 按可用令牌推送暂存事件，仍有剩余时等待下一个令牌
+func (n *Notifier) flushPending(l *rateLimiter, w http.ResponseWriter, flusher http.Flusher) error {
+	l.drain = nil
+	for len(l.pending) > 0 && l.bucket.allow() {
+		event := l.pending[0]
+		l.pending[0] = nil
+		l.pending = l.pending[1:]
+		if err := n.sendPending(w, flusher, event); err != nil {
+			return err
+		}
+	}
+	if len(l.pending) > 0 {
+		l.drain = n.clock.After(l.bucket.wait())
+	}
+	return nil
+}
+
+// sendPending 推送一个暂存事件
+func (n *Notifier) sendPending(w http.ResponseWriter, flusher http.Flusher, event *pendingEvent) error {
+	if event.tunnel != nil {
+		return n.sendTunnelEvent(w, flusher, event.tunnel)
+	}
+	return n.sendServiceEvent(w, flusher, event.service)
+}
+
+// tunnelPending / servicePending 构造暂存事件及其合并键
+func tunnelPending(event *TunnelEvent) *pendingEvent {
+	key := "tunnel:"
+	if event.Tunnel != nil {
+		key += event.Tunnel.ID
+	}
+	return &pendingEvent{key: key, tunnel: event}
+}
+
+func servicePending(event *ServiceEvent) *pendingEvent {
+	key := "service:"
+	if event.Service != nil {
+		key += event.Service.ServiceID
+	}
+	if event.Type == ServiceEventBulkUpdated {
+		key = fmt.Sprintf("service_bulk:%d:%p", event.Seq, event) // 批量事件不参与合并
+	}
+	return &pendingEvent{key: key, service: event}
+}
+
+// coalescePending 合并同一隧道/服务的两个暂存事件，保留最终状态
+func coalescePending(prev, next *pendingEvent) *pendingEvent {
+	if next.tunnel != nil {
+		merged := *next.tunnel
+		if prev.tunnel.Type == EventTypeCreated && next.tunnel.Type == EventTypeUpdated {
+			merged.Type = EventTypeCreated
+			merged.frame = nil // 预编码帧对应原事件类型
+		}
+		return &pendingEvent{key: next.key, tunnel: &merged}
+	}
+	return &pendingEvent{key: next.key, service: coalesceServiceEvent(prev.service, next.service)}
+}
@@ -0,0 +1,111 @@
+package tunnel
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+// subscriberShards 按订阅 ID 哈希分片的订阅者注册表
+// 订阅/退订只锁定单个分片；广播时各分片由不同 worker 并行遍历，
+// 避免单一 sync.Map 在数万 AH 连接下成为热点
+type subscriberShards struct {
+	shards []*subscriberShard
+}
+
+type subscriberShard struct {
+	mu      sync.RWMutex
+	clients map[string]*SSEClient
+}
+
+func newSubscriberShards(n int) *subscriberShards {
+	s := &subscriberShards{shards: make([]*subscriberShard, n)}
+	for i := range s.shards {
+		s.shards[i] = &subscriberShard{clients: make(map[string]*SSEClient)}
+	}
+	return s
+}
+
+// shard 返回 id 所在分片
+func (s *subscriberShards) shard(id string) *subscriberShard {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return s.shards[h.Sum32()%uint32(len(s.shards))]
+}
+
+// load 查找订阅者
+func (s *subscriberShards) load(id string) (*SSEClient, bool) {
+	shard := s.shard(id)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+	client, ok := shard.clients[id]
+	return client, ok
+}
+
+// store 注册订阅者，返回被替换的旧连接（同一 ID 重连）
+func (s *subscriberShards) store(id string, client *SSEClient) *SSEClient {
+	shard := s.shard(id)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	previous := shard.clients[id]
+	shard.clients[id] = client
+	return previous
+}
+
+// compareAndDelete 仅当 id 仍映射到 client 时删除
+func (s *subscriberShards) compareAndDelete(id string, client *SSEClient) bool {
+	shard := s.shard(id)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	if shard.clients[id] != client {
+		return false
+	}
+	delete(shard.clients, id)
+	return true
+}
+
+// loadAndDelete 删除并返回订阅者
+func (s *subscriberShards) loadAndDelete(id string) (*SSEClient, bool) {
+	shard := s.shard(id)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	client, ok := shard.clients[id]
+	if ok {
+		delete(shard.clients, id)
+	}
+	return client, ok
+}
+
+// snapshot 复制分片 i 的订阅者列表，投递期间不持有分片锁
+func (s *subscriberShards) snapshot(i int, buf []*SSEClient) []*SSEClient {
+	shard := s.shards[i]
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+	for _, client := range shard.clients {
+		buf = append(buf, client)
+	}
+	return buf
+}
+
+// count 订阅者总数
+func (s *subscriberShards) count() int {
+	total := 0
+	for _, shard := range s.shards {
+		shard.mu.RLock()
+		total += len(shard.clients)
+		shard.mu.RUnlock()
+	}
+	return total
+}
+
+// ids 所有订阅 ID
+func (s *subscriberShards) ids() []string {
+	var ids []string
+	for _, shard := range s.shards {
+		shard.mu.RLock()
+		for id := range shard.clients {
+			ids = append(ids, id)
+		}
+		shard.mu.RUnlock()
+	}
+	return ids
+}
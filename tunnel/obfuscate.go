@@ -0,0 +1,279 @@
+package tunnel
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 流量混淆模式（obfuscate），由匹配策略按隧道启用（Policy.Obfuscate → 隧道 Metadata obfuscate）
+// 数据平面连接上的数据以定长帧发送：[2 字节负载长度][2 字节填充长度][负载][填充]，帧总长取自 Buckets，
+// 写入先进入缓冲，在 0 ~ MaxFlushDelay 的随机延迟后发送（满帧立即发送），使中继看到的包长与发送时机不再直接反映应用行为。
+// 同时启用端到端加密时先填充后加密（混淆层包装 E2EConn），填充内容对中继不可见
+const (
+	// MetadataKeyObfuscate 隧道 Metadata 中标记流量混淆模式的键
+	MetadataKeyObfuscate = "obfuscate"
+
+	// DefaultObfuscationMaxFlushDelay 默认最大发送延迟
+	DefaultObfuscationMaxFlushDelay = 10 * time.Millisecond
+
+	obfuscationHeaderSize = 4
+	obfuscationMaxBucket  = 65535
+	// obfuscationFlushTimeout Close 时发送剩余缓冲数据的最长时间，对端不再读取时不阻塞关闭
+	obfuscationFlushTimeout = time.Second
+)
+
+// DefaultObfuscationBuckets 默认帧长档位（字节），最大档不超过 E2E 单帧明文上限，每帧对应一个 E2E 密文帧
+var DefaultObfuscationBuckets = []int{256, 1024, 4096, e2eMaxPlaintext}
+
+// ErrObfuscatedConnClosed 混淆连接已关闭
+var ErrObfuscatedConnClosed = errors.New("obfuscate: connection closed")
+
+// IsObfuscated 隧道是否启用流量混淆
+func (t *Tunnel) IsObfuscated() bool {
+	if t == nil || t.Metadata == nil {
+		return false
+	}
+	v, _ := t.Metadata[MetadataKeyObfuscate].(bool)
+	return v
+}
+
+// ObfuscationConfig 流量混淆参数，IH 与 AH 的 Buckets 可以不同（读取端按帧头解析）
+type ObfuscationConfig struct {
+	// Buckets 帧长档位（含 4 字节帧头），升序；为空时使用 DefaultObfuscationBuckets
+	Buckets []int
+	// MaxFlushDelay 缓冲数据的最大发送延迟，实际延迟在 [0, MaxFlushDelay] 内均匀随机；
+	// 0 使用 DefaultObfuscationMaxFlushDelay，负数表示只填充、立即发送
+	MaxFlushDelay time.Duration
+	// Stats 开销统计，可由同一隧道的多条连接共用；nil 时不统计
+	Stats *ObfuscationStats
+}
+
+// Validate 校验混淆参数
+func (c *ObfuscationConfig) Validate() error {
+	for i, size := range c.Buckets {
+		if size <= obfuscationHeaderSize || size > obfuscationMaxBucket {
+			return fmt.Errorf("obfuscation bucket %d must be in (%d, %d]", size, obfuscationHeaderSize, obfuscationMaxBucket)
+		}
+		if i > 0 && size <= c.Buckets[i-1] {
+			return fmt.Errorf("obfuscation buckets must be strictly ascending")
+		}
+	}
+	return nil
+}
+
+// Wrap 返回混淆连接，conn 为已完成数据平面握手（及 E2E 包装）的连接
+// 与 E2EConn 相同，IH 与 AH 需对同一条中继配对连接调用（多路复用模式下包装底层连接后再创建 MuxSession）
+func (c *ObfuscationConfig) Wrap(conn net.Conn) *ObfuscatedConn {
+	oc := &ObfuscatedConn{
+		Conn:     conn,
+		buckets:  DefaultObfuscationBuckets,
+		maxDelay: DefaultObfuscationMaxFlushDelay,
+	}
+	if c != nil {
+		if len(c.Buckets) > 0 {
+			oc.buckets = slices.Clone(c.Buckets)
+		}
+		if c.MaxFlushDelay != 0 {
+			oc.maxDelay = max(c.MaxFlushDelay, 0)
+		}
+		oc.stats = c.Stats
+	}
+	return oc
+}
+
+// ObfuscationStats 发送方向的混淆开销计数（并发安全）
+type ObfuscationStats struct {
+	frames       atomic.Int64
+	payloadBytes atomic.Int64
+	paddingBytes atomic.Int64
+}
+
+// ObfuscationSnapshot 混淆开销快照
+type ObfuscationSnapshot struct {
+	Frames        int64 `json:"frames"`         // 发送的帧数
+	PayloadBytes  int64 `json:"payload_bytes"`  // 应用数据字节数
+	PaddingBytes  int64 `json:"padding_bytes"`  // 填充字节数
+	OverheadBytes int64 `json:"overhead_bytes"` // 帧头与填充合计
+}
+
+// Snapshot 返回当前计数，nil 统计返回零值
+func (s *ObfuscationStats) Snapshot() ObfuscationSnapshot {
+	if s == nil {
+		return ObfuscationSnapshot{}
+	}
+	snap := ObfuscationSnapshot{
+		Frames:       s.frames.Load(),
+		PayloadBytes: s.payloadBytes.Load(),
+		PaddingBytes: s.paddingBytes.Load(),
+	}
+	snap.OverheadBytes = snap.Frames*obfuscationHeaderSize + snap.PaddingBytes
+	return snap
+}
+
+// OverheadRatio 开销占应用数据的比例（如 0.25 表示每发送 1 字节数据额外发送 0.25 字节），无数据时为 0
+func (s ObfuscationSnapshot) OverheadRatio() float64 {
+	if s.PayloadBytes == 0 {
+		return 0
+	}
+	return float64(s.OverheadBytes) / float64(s.PayloadBytes)
+}
+
+// ObfuscatedConn 流量混淆连接
+// Write 只把数据放入缓冲，延迟发送的错误在后续 Write 时返回；Close 前发送剩余缓冲数据
+type ObfuscatedConn struct {
+	net.Conn
+	buckets  []int
+	maxDelay time.Duration
+	stats    *ObfuscationStats
+
+	writeMu  sync.Mutex
+	pending  []byte      // 尚未发送的数据，始终少于一个满帧
+	timer    *time.Timer // 缓冲数据的延迟发送，nil 表示未排程
+	writeErr error
+	closed   atomic.Bool
+
+	readBuf []byte // 当前帧未读取的负载
+	frame   []byte
+}
+
+// Write 缓冲数据，凑满最大档的部分立即发送，剩余部分随机延迟后发送
+func (c *ObfuscatedConn) Write(b []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closed.Load() {
+		return 0, ErrObfuscatedConnClosed
+	}
+	if c.writeErr != nil {
+		return 0, c.writeErr
+	}
+
+	c.pending = append(c.pending, b...)
+	maxPayload := c.buckets[len(c.buckets)-1] - obfuscationHeaderSize
+	sent := 0
+	for len(c.pending)-sent >= maxPayload {
+		if err := c.writeFrame(c.pending[sent : sent+maxPayload]); err != nil {
+			c.writeErr = err
+			return 0, err
+		}
+		sent += maxPayload
+	}
+	c.pending = append(c.pending[:0], c.pending[sent:]...)
+
+	if len(c.pending) > 0 && c.timer == nil {
+		if c.maxDelay <= 0 {
+			if err := c.flushLocked(); err != nil {
+				c.writeErr = err
+				return 0, err
+			}
+			return len(b), nil
+		}
+		c.timer = time.AfterFunc(rand.N(c.maxDelay+1), c.flush)
+	}
+	return len(b), nil
+}
+
+// flush 延迟到期后发送缓冲数据
+func (c *ObfuscatedConn) flush() {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.timer = nil
+	if c.closed.Load() || c.writeErr != nil {
+		return
+	}
+	c.writeErr = c.flushLocked()
+}
+
+// flushLocked 把缓冲数据作为一帧发送，调用方持有 writeMu
+func (c *ObfuscatedConn) flushLocked() error {
+	if len(c.pending) == 0 {
+		return nil
+	}
+	if err := c.writeFrame(c.pending); err != nil {
+		return err
+	}
+	c.pending = c.pending[:0]
+	return nil
+}
+
+// writeFrame 以能容纳负载的最小档位组帧并发送
+func (c *ObfuscatedConn) writeFrame(payload []byte) error {
+	size := c.buckets[len(c.buckets)-1]
+	for _, bucket := range c.buckets {
+		if bucket-obfuscationHeaderSize >= len(payload) {
+			size = bucket
+			break
+		}
+	}
+	padding := size - obfuscationHeaderSize - len(payload)
+
+	frame := make([]byte, size)
+	binary.BigEndian.PutUint16(frame[0:2], uint16(len(payload)))
+	binary.BigEndian.PutUint16(frame[2:4], uint16(padding))
+	copy(frame[obfuscationHeaderSize:], payload)
+
+	// 写入前计数：对端读到帧时统计已包含该帧
+	if c.stats != nil {
+		c.stats.frames.Add(1)
+		c.stats.payloadBytes.Add(int64(len(payload)))
+		c.stats.paddingBytes.Add(int64(padding))
+	}
+	_, err := c.Conn.Write(frame)
+	return err
+}
+
+// Read 读取帧负载并丢弃填充，调用方缓冲区不足时保留剩余负载
+func (c *ObfuscatedConn) Read(b []byte) (int, error) {
+	for len(c.readBuf) == 0 {
+		var header [obfuscationHeaderSize]byte
+		if _, err := io.ReadFull(c.Conn, header[:]); err != nil {
+			return 0, err
+		}
+		payload := int(binary.BigEndian.Uint16(header[0:2]))
+		size := payload + int(binary.BigEndian.Uint16(header[2:4]))
+		if cap(c.frame) < size {
+			c.frame = make([]byte, size)
+		}
+		frame := c.frame[:size]
+		if _, err := io.ReadFull(c.Conn, frame); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		c.readBuf = frame[:payload]
+	}
+
+	n := copy(b, c.readBuf)
+	c.readBuf = c.readBuf[n:]
+	return n, nil
+}
+
+// Close 发送剩余缓冲数据后关闭底层连接
+// 其他 goroutine 正阻塞在发送上时不等待，直接关闭底层连接以解除阻塞
+func (c *ObfuscatedConn) Close() error {
+	if c.writeMu.TryLock() {
+		if !c.closed.Load() {
+			if c.timer != nil {
+				c.timer.Stop()
+				c.timer = nil
+			}
+			if c.writeErr == nil && len(c.pending) > 0 {
+				c.Conn.SetWriteDeadline(time.Now().Add(obfuscationFlushTimeout))
+				c.flushLocked()
+			}
+		}
+		c.closed.Store(true)
+		c.writeMu.Unlock()
+	} else {
+		c.closed.Store(true)
+	}
+	return c.Conn.Close()
+}
@@ -0,0 +1,178 @@
+package tunnel
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingConn 记录每次写入底层连接的长度
+type recordingConn struct {
+	net.Conn
+	mu     sync.Mutex
+	writes []int
+}
+
+func (c *recordingConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	c.writes = append(c.writes, len(b))
+	c.mu.Unlock()
+	return c.Conn.Write(b)
+}
+
+func (c *recordingConn) sizes() []int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.writes)
+}
+
+func TestObfuscatedConn_RoundTripAndBuckets(t *testing.T) {
+	c1, c2 := net.Pipe()
+	rec := &recordingConn{Conn: c1}
+	stats := &ObfuscationStats{}
+	writer := (&ObfuscationConfig{Buckets: []int{64, 256, 1024}, MaxFlushDelay: time.Millisecond, Stats: stats}).Wrap(rec)
+	reader := (&ObfuscationConfig{}).Wrap(c2)
+	defer writer.Close()
+	defer reader.Close()
+
+	var payload []byte
+	for i := 0; i < 3000; i++ {
+		payload = append(payload, byte(i))
+	}
+	chunks := [][]byte{payload[:10], payload[10:300], payload[300:2500], payload[2500:]}
+
+	go func() {
+		for _, chunk := range chunks {
+			if _, err := writer.Write(chunk); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	got := make([]byte, len(payload))
+	reader.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := io.ReadFull(reader, got); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Fatal("payload corrupted")
+	}
+
+	var wire int
+	for _, size := range rec.sizes() {
+		if size != 64 && size != 256 && size != 1024 {
+			t.Errorf("frame of %d bytes is not a bucket size", size)
+		}
+		wire += size
+	}
+	snap := stats.Snapshot()
+	if snap.PayloadBytes != int64(len(payload)) {
+		t.Errorf("payload bytes = %d, want %d", snap.PayloadBytes, len(payload))
+	}
+	if snap.PayloadBytes+snap.OverheadBytes != int64(wire) {
+		t.Errorf("payload %d + overhead %d != wire bytes %d", snap.PayloadBytes, snap.OverheadBytes, wire)
+	}
+	if snap.Frames != int64(len(rec.sizes())) || snap.OverheadRatio() <= 0 {
+		t.Errorf("unexpected stats %+v", snap)
+	}
+}
+
+func TestObfuscatedConn_DelaysSmallWritesAndFlushesOnClose(t *testing.T) {
+	c1, c2 := net.Pipe()
+	rec := &recordingConn{Conn: c1}
+	writer := (&ObfuscationConfig{MaxFlushDelay: time.Hour}).Wrap(rec)
+	reader := (&ObfuscationConfig{}).Wrap(c2)
+	defer reader.Close()
+
+	if _, err := writer.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.sizes()) != 0 {
+		t.Fatal("small write should be buffered until the flush delay")
+	}
+
+	done := make(chan []byte, 1)
+	go func() {
+		data, _ := io.ReadAll(reader)
+		done <- data
+	}()
+	writer.Close()
+
+	select {
+	case data := <-done:
+		if string(data) != "hello" {
+			t.Errorf("read %q after close", data)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("pending data was not flushed on close")
+	}
+	if sizes := rec.sizes(); len(sizes) != 1 || sizes[0] != DefaultObfuscationBuckets[0] {
+		t.Errorf("frames = %v", sizes)
+	}
+	if _, err := writer.Write([]byte("x")); err != ErrObfuscatedConnClosed {
+		t.Errorf("write after close = %v", err)
+	}
+}
+
+func TestObfuscatedConn_Mux(t *testing.T) {
+	c1, c2 := net.Pipe()
+	cfg := &ObfuscationConfig{}
+	client := NewMuxSession(cfg.Wrap(c1), true)
+	server := NewMuxSession(cfg.Wrap(c2), false)
+	defer client.Close()
+	defer server.Close()
+
+	go func() {
+		stream, err := server.AcceptStream()
+		if err != nil {
+			return
+		}
+		defer stream.Close()
+		io.Copy(stream, stream)
+	}()
+
+	stream, err := client.OpenStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	msg := bytes.Repeat([]byte("obfuscated "), 5000)
+	go stream.Write(msg)
+
+	got := make([]byte, len(msg))
+	if _, err := io.ReadFull(stream, got); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, msg) {
+		t.Error("echo corrupted")
+	}
+}
+
+func TestObfuscationConfig_Validate(t *testing.T) {
+	valid := []*ObfuscationConfig{{}, {Buckets: []int{128, 1500}}, {Buckets: DefaultObfuscationBuckets, MaxFlushDelay: -1}}
+	for _, cfg := range valid {
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("%+v: %v", cfg, err)
+		}
+	}
+	invalid := []*ObfuscationConfig{{Buckets: []int{4}}, {Buckets: []int{1024, 256}}, {Buckets: []int{256, 256}}, {Buckets: []int{70000}}}
+	for _, cfg := range invalid {
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("%+v: expected error", cfg)
+		}
+	}
+}
+
+func TestTunnel_IsObfuscated(t *testing.T) {
+	if (&Tunnel{}).IsObfuscated() || (*Tunnel)(nil).IsObfuscated() {
+		t.Error("tunnel without metadata should not be obfuscated")
+	}
+	if !(&Tunnel{Metadata: map[string]interface{}{MetadataKeyObfuscate: true}}).IsObfuscated() {
+		t.Error("obfuscate metadata not recognised")
+	}
+}
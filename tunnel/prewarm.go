@@ -0,0 +1,240 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/houzhh15/sdp-common/logging"
+)
+
+// DialParallel 并行拨号目标服务和数据平面，缩短 AH 首字节延迟
+// 任一方失败时关闭另一方已建立的连接并返回错误
+//
+// 用法（AH 收到 tunnel_created 后）:
+//
+//	targetConn, proxyConn, err := tunnel.DialParallel(
+//	    func() (net.Conn, error) { return pool.Get(ctx, targetAddr) },
+//	    func() (net.Conn, error) { return dataPlaneClient.Connect(tun.ID) },
+//	)
+func DialParallel(dialTarget, dialRelay func() (net.Conn, error)) (targetConn, relayConn net.Conn, err error) {
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+
+	targetCh := make(chan result, 1)
+	go func() {
+		conn, err := dialTarget()
+		targetCh <- result{conn, err}
+	}()
+
+	relayConn, relayErr := dialRelay()
+	target := <-targetCh
+
+	if target.err != nil || relayErr != nil {
+		if target.conn != nil {
+			target.conn.Close()
+		}
+		if relayConn != nil {
+			relayConn.Close()
+		}
+		if target.err != nil {
+			return nil, nil, fmt.Errorf("dial target: %w", target.err)
+		}
+		return nil, nil, fmt.Errorf("dial relay: %w", relayErr)
+	}
+
+	return target.conn, relayConn, nil
+}
+
+// TargetPoolConfig 目标连接预热池配置
+type TargetPoolConfig struct {
+	// IdleConns 每个热点目标保持的空闲连接数（默认 2）
+	IdleConns int
+	// IdleTimeout 空闲连接最长保留时间，超过后丢弃重建（默认 30s）
+	// 应小于目标服务自身的空闲断开时间
+	IdleTimeout time.Duration
+	// DialTimeout 拨号超时（默认 5s）
+	DialTimeout time.Duration
+	Logger      logging.Logger
+}
+
+// idleConn 池中的空闲连接
+type idleConn struct {
+	conn    net.Conn
+	idledAt time.Time
+}
+
+// TargetPool AH 侧目标连接预热池
+// 仅对通过 Warm 标记的热点目标保持空闲连接，Get 取走后异步补齐；
+// 未预热的目标 Get 时直接拨号。适用于可接受预先建立空闲连接的 TCP 服务
+type TargetPool struct {
+	config *TargetPoolConfig
+	logger logging.Logger
+	dialer *net.Dialer
+
+	mu      sync.Mutex
+	idle    map[string][]*idleConn // addr -> 空闲连接
+	warm    map[string]bool        // 热点目标
+	filling map[string]bool        // 正在补齐的目标
+	closed  bool
+}
+
+// NewTargetPool 创建目标连接预热池
+func NewTargetPool(config *TargetPoolConfig) *TargetPool {
+	if config == nil {
+		config = &TargetPoolConfig{}
+	}
+	if config.IdleConns <= 0 {
+		config.IdleConns = 2
+	}
+	if config.IdleTimeout <= 0 {
+		config.IdleTimeout = 30 * time.Second
+	}
+	if config.DialTimeout <= 0 {
+		config.DialTimeout = 5 * time.Second
+	}
+	if config.Logger == nil {
+		config.Logger = &noopLogger{}
+	}
+
+	return &TargetPool{
+		config:  config,
+		logger:  config.Logger,
+		dialer:  &net.Dialer{Timeout: config.DialTimeout},
+		idle:    make(map[string][]*idleConn),
+		warm:    make(map[string]bool),
+		filling: make(map[string]bool),
+	}
+}
+
+// Warm 将目标标记为热点并异步建立空闲连接
+func (p *TargetPool) Warm(addr string) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.warm[addr] = true
+	p.mu.Unlock()
+
+	p.refill(addr)
+}
+
+// Unwarm 取消热点标记并关闭该目标的空闲连接（如服务下线）
+func (p *TargetPool) Unwarm(addr string) {
+	p.mu.Lock()
+	delete(p.warm, addr)
+	conns := p.idle[addr]
+	delete(p.idle, addr)
+	p.mu.Unlock()
+
+	for _, ic := range conns {
+		ic.conn.Close()
+	}
+}
+
+// Get 获取到目标的连接：优先使用未过期的空闲连接，否则直接拨号
+func (p *TargetPool) Get(ctx context.Context, addr string) (net.Conn, error) {
+	now := time.Now()
+
+	p.mu.Lock()
+	var conn net.Conn
+	var stale []net.Conn
+	conns := p.idle[addr]
+	for len(conns) > 0 {
+		ic := conns[len(conns)-1]
+		conns = conns[:len(conns)-1]
+		if now.Sub(ic.idledAt) < p.config.IdleTimeout {
+			conn = ic.conn
+			break
+		}
+		stale = append(stale, ic.conn)
+	}
+	p.idle[addr] = conns
+	warm := p.warm[addr]
+	p.mu.Unlock()
+
+	for _, c := range stale {
+		c.Close()
+	}
+	if warm {
+		p.refill(addr)
+	}
+
+	if conn != nil {
+		p.logger.Debug("Using pre-warmed target connection", "target", addr)
+		return conn, nil
+	}
+	return p.dialer.DialContext(ctx, "tcp", addr)
+}
+
+// IdleCount 返回目标当前的空闲连接数
+func (p *TargetPool) IdleCount(addr string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.idle[addr])
+}
+
+// Close 关闭所有空闲连接，之后 Get 退化为直接拨号
+func (p *TargetPool) Close() error {
+	p.mu.Lock()
+	p.closed = true
+	idle := p.idle
+	p.idle = make(map[string][]*idleConn)
+	p.warm = make(map[string]bool)
+	p.mu.Unlock()
+
+	for _, conns := range idle {
+		for _, ic := range conns {
+			ic.conn.Close()
+		}
+	}
+	return nil
+}
+
+// refill 异步补齐热点目标的空闲连接（同一目标同时只有一个补齐任务）
+func (p *TargetPool) refill(addr string) {
+	p.mu.Lock()
+	if p.closed || !p.warm[addr] || p.filling[addr] {
+		p.mu.Unlock()
+		return
+	}
+	p.filling[addr] = true
+	p.mu.Unlock()
+
+	go func() {
+		defer func() {
+			p.mu.Lock()
+			delete(p.filling, addr)
+			p.mu.Unlock()
+		}()
+
+		for {
+			p.mu.Lock()
+			need := !p.closed && p.warm[addr] && len(p.idle[addr]) < p.config.IdleConns
+			p.mu.Unlock()
+			if !need {
+				return
+			}
+
+			conn, err := p.dialer.Dial("tcp", addr)
+			if err != nil {
+				p.logger.Warn("Failed to pre-warm target connection", "target", addr, "error", err)
+				return
+			}
+
+			p.mu.Lock()
+			if p.closed || !p.warm[addr] {
+				p.mu.Unlock()
+				conn.Close()
+				return
+			}
+			p.idle[addr] = append(p.idle[addr], &idleConn{conn: conn, idledAt: time.Now()})
+			p.mu.Unlock()
+		}
+	}()
+}
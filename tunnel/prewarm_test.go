@@ -0,0 +1,154 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// startCountingListener 启动本地 TCP 监听，记录已接受的连接数
+func startCountingListener(t *testing.T) (string, *int32) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	var accepted int32
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&accepted, 1)
+			t.Cleanup(func() { conn.Close() })
+		}
+	}()
+	return ln.Addr().String(), &accepted
+}
+
+func waitIdle(t *testing.T, pool *TargetPool, addr string, want int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for pool.IdleCount(addr) != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("idle count = %d, want %d", pool.IdleCount(addr), want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestTargetPool_WarmAndRefill(t *testing.T) {
+	addr, accepted := startCountingListener(t)
+
+	pool := NewTargetPool(&TargetPoolConfig{IdleConns: 2})
+	defer pool.Close()
+
+	pool.Warm(addr)
+	waitIdle(t, pool, addr, 2)
+
+	conn, err := pool.Get(context.Background(), addr)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	defer conn.Close()
+
+	// 取走后自动补齐，未额外直接拨号
+	waitIdle(t, pool, addr, 2)
+	time.Sleep(20 * time.Millisecond)
+	if n := atomic.LoadInt32(accepted); n != 3 {
+		t.Errorf("accepted = %d, want 3", n)
+	}
+}
+
+func TestTargetPool_ColdTargetDialsDirectly(t *testing.T) {
+	addr, _ := startCountingListener(t)
+
+	pool := NewTargetPool(nil)
+	defer pool.Close()
+
+	conn, err := pool.Get(context.Background(), addr)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	conn.Close()
+
+	if n := pool.IdleCount(addr); n != 0 {
+		t.Errorf("cold target should not be pooled, idle = %d", n)
+	}
+}
+
+func TestTargetPool_StaleConnsDiscarded(t *testing.T) {
+	addr, accepted := startCountingListener(t)
+
+	pool := NewTargetPool(&TargetPoolConfig{IdleConns: 1, IdleTimeout: 20 * time.Millisecond})
+	defer pool.Close()
+
+	pool.Warm(addr)
+	waitIdle(t, pool, addr, 1)
+	time.Sleep(30 * time.Millisecond)
+
+	conn, err := pool.Get(context.Background(), addr)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	conn.Close()
+
+	// 1 个过期空闲连接 + 1 次直接拨号（+ 可能的补齐）
+	deadline := time.Now().Add(2 * time.Second)
+	for atomic.LoadInt32(accepted) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("accepted = %d, want fresh dial after stale conn", atomic.LoadInt32(accepted))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestTargetPool_Unwarm(t *testing.T) {
+	addr, _ := startCountingListener(t)
+
+	pool := NewTargetPool(&TargetPoolConfig{IdleConns: 2})
+	defer pool.Close()
+
+	pool.Warm(addr)
+	waitIdle(t, pool, addr, 2)
+	pool.Unwarm(addr)
+	if n := pool.IdleCount(addr); n != 0 {
+		t.Errorf("idle after Unwarm = %d, want 0", n)
+	}
+}
+
+func TestDialParallel(t *testing.T) {
+	addr, _ := startCountingListener(t)
+	dial := func() (net.Conn, error) { return net.Dial("tcp", addr) }
+
+	target, relay, err := DialParallel(dial, dial)
+	if err != nil {
+		t.Fatalf("DialParallel: %v", err)
+	}
+	target.Close()
+	relay.Close()
+
+	// 数据平面失败时关闭已建立的目标连接
+	var targetConn net.Conn
+	_, _, err = DialParallel(
+		func() (net.Conn, error) {
+			conn, err := dial()
+			targetConn = conn
+			return conn, err
+		},
+		func() (net.Conn, error) { return nil, errors.New("relay down") },
+	)
+	if err == nil {
+		t.Fatal("expected relay error")
+	}
+	if _, werr := targetConn.Write([]byte("x")); werr == nil {
+		t.Error("target connection should be closed after relay failure")
+	}
+}
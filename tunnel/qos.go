@@ -0,0 +1,23 @@
+package tunnel
+
+import (
+	"fmt"
+
+	"github.com/houzhh15/sdp-common/qos"
+)
+
+// MetadataKeyQoSClass 隧道 Metadata 中生效的 DSCP 服务等级，中继、AH、IH 据此标记各自的数据平面连接
+const MetadataKeyQoSClass = "qos_class"
+
+// QoSClass 隧道的 DSCP 服务等级，未设置时为空（不标记）
+func (t *Tunnel) QoSClass() string {
+	return t.metadataString(MetadataKeyQoSClass)
+}
+
+// ValidateQoS 校验服务的 DSCP 服务等级
+func (c *ServiceConfig) ValidateQoS() error {
+	if err := qos.ValidateClass(c.QoSClass); err != nil {
+		return fmt.Errorf("service %s: %w", c.ServiceID, err)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package tunnel
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ReconcileReport AH 在 SSE 连接（重连）建立后上报的本地活跃隧道
+// Controller 重启后内存中的隧道表为空，据此重建仍然合法的隧道，其余通知 AH 终止
+type ReconcileReport struct {
+	AgentID string            `json:"agent_id"`
+	Tunnels []*ReportedTunnel `json:"tunnels"`
+}
+
+// ReportedTunnel AH 侧记录的隧道信息（足以在 Controller 上重建隧道记录）
+type ReportedTunnel struct {
+	TunnelID   string    `json:"tunnel_id"`
+	ClientID   string    `json:"client_id"`
+	ServiceID  string    `json:"service_id"`
+	TargetHost string    `json:"target_host,omitempty"`
+	TargetPort int       `json:"target_port,omitempty"`
+	Multiplex  bool      `json:"multiplex,omitempty"`
+	Obfuscate  bool      `json:"obfuscate,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	ExpiresAt  time.Time `json:"expires_at,omitempty"`
+}
+
+// ReconcileResult Controller 对上报隧道的处理结果（隧道 ID 列表）
+type ReconcileResult struct {
+	// Kept Controller 已知的隧道
+	Kept []string `json:"kept"`
+	// Rebuilt 重启后按上报信息重建的隧道
+	Rebuilt []string `json:"rebuilt"`
+	// Terminate 服务已删除、目标无效或策略不再允许的隧道，AH 应关闭
+	Terminate []string `json:"terminate"`
+}
+
+// Reconcile 向 Controller 上报本地活跃隧道，返回需要终止的隧道（AH 侧）
+// 通常在 ConnectedCallback 中调用，使 Controller 重启后恢复隧道状态
+func (s *Subscriber) Reconcile(ctx context.Context, tunnels []*ReportedTunnel) (*ReconcileResult, error) {
+	if tunnels == nil {
+		tunnels = []*ReportedTunnel{}
+	}
+	body, err := json.Marshal(&ReconcileReport{AgentID: s.agentID, Tunnels: tunnels})
+	if err != nil {
+		return nil, fmt.Errorf("encode reconcile report: %w", err)
+	}
+
+	url := strings.TrimSuffix(s.ControllerURL(), "/") + "/api/v1/tunnels/reconcile"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status: %d", resp.StatusCode)
+	}
+
+	var result ReconcileResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decode reconcile result: %w", err)
+	}
+	return &result, nil
+}
@@ -0,0 +1,231 @@
+package tunnel
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// shadowQueueLength 影子连接待写缓冲块数，影子目标写入跟不上时停止镜像而不阻塞主连接
+const shadowQueueLength = 64
+
+// shadowFlushTimeout 主连接关闭后写完已排队镜像数据的最长时间
+const shadowFlushTimeout = time.Second
+
+// 影子流量统计结果
+const (
+	ShadowResultMirrored = "mirrored" // 已写入影子目标
+	ShadowResultDropped  = "dropped"  // 影子目标过慢或写入失败，未镜像
+)
+
+// shadowBytes 按服务和结果统计的影子流量字节数
+var shadowBytes = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "tunnel_shadow_bytes_total",
+		Help: "Bytes of IH to target traffic mirrored to (or dropped for) the shadow target, by service and result",
+	},
+	[]string{"service", "result"},
+)
+
+// ShadowConfig 影子流量配置：AH 将 IH→目标方向的数据复制一份写入影子目标（影子目标的响应被丢弃）
+// 用于服务迁移到新目标主机前的对比测试，影子目标故障或过慢不影响主连接
+type ShadowConfig struct {
+	TargetHost string `json:"target_host"` // 影子目标主机地址
+	TargetPort int    `json:"target_port"` // 影子目标端口
+	// SamplePercent 镜像的连接比例（1-100），0 表示全部连接
+	SamplePercent int `json:"sample_percent,omitempty"`
+	// MaxBytes 每个连接最多镜像的字节数，超出后停止镜像并关闭影子连接；0 表示不限制
+	MaxBytes int64 `json:"max_bytes,omitempty"`
+}
+
+// Addr 影子目标地址（host:port）
+func (s *ShadowConfig) Addr() string {
+	return net.JoinHostPort(s.TargetHost, strconv.Itoa(s.TargetPort))
+}
+
+// Sampled 按 SamplePercent 决定本连接是否镜像
+func (s *ShadowConfig) Sampled() bool {
+	if s.SamplePercent <= 0 || s.SamplePercent >= 100 {
+		return true
+	}
+	return rand.IntN(100) < s.SamplePercent
+}
+
+// ValidateShadow 校验影子流量配置
+func (c *ServiceConfig) ValidateShadow() error {
+	s := c.Shadow
+	if s == nil {
+		return nil
+	}
+	if s.TargetHost == "" {
+		return fmt.Errorf("shadow target_host is required for service %s", c.ServiceID)
+	}
+	if s.TargetPort <= 0 || s.TargetPort > 65535 {
+		return fmt.Errorf("invalid shadow target port: %d", s.TargetPort)
+	}
+	if s.SamplePercent < 0 || s.SamplePercent > 100 {
+		return fmt.Errorf("shadow sample_percent must be between 0 and 100, got %d", s.SamplePercent)
+	}
+	if s.MaxBytes < 0 {
+		return fmt.Errorf("shadow max_bytes must not be negative")
+	}
+	if s.Addr() == net.JoinHostPort(c.TargetHost, strconv.Itoa(c.TargetPort)) {
+		return fmt.Errorf("shadow target of service %s must differ from its target", c.ServiceID)
+	}
+	return nil
+}
+
+// MirrorTarget 按服务的影子配置包装 AH 侧目标连接
+// 本连接命中采样时拨号影子目标，之后写入 target 的数据同时异步复制到影子目标；
+// 未配置影子、未命中采样时原样返回 target，影子拨号失败时返回 target 与错误（主连接不受影响）
+func (c *ServiceConfig) MirrorTarget(target net.Conn, dial func(addr string) (net.Conn, error)) (net.Conn, error) {
+	if c.Shadow == nil || !c.Shadow.Sampled() {
+		return target, nil
+	}
+	shadow, err := dial(c.Shadow.Addr())
+	if err != nil {
+		return target, fmt.Errorf("failed to dial shadow target %s: %w", c.Shadow.Addr(), err)
+	}
+	return NewShadowConn(target, shadow, c.ServiceID, c.Shadow.MaxBytes), nil
+}
+
+// ShadowConn 目标连接包装：Write 写入主连接后将同样的数据排队写入影子连接
+// 影子连接的响应被读取丢弃；影子写入失败、队列已满或达到字节上限后停止镜像，不影响主连接
+type ShadowConn struct {
+	net.Conn
+	shadow   net.Conn
+	service  string
+	maxBytes int64
+
+	mu        sync.Mutex
+	queue     chan []byte
+	queued    int64 // 已排队字节数
+	stopped   atomic.Bool
+	mirrored  atomic.Int64
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// NewShadowConn 创建镜像写入到 shadow 的目标连接，maxBytes 为 0 时不限制镜像字节数
+func NewShadowConn(target, shadow net.Conn, service string, maxBytes int64) *ShadowConn {
+	c := &ShadowConn{
+		Conn:     target,
+		shadow:   shadow,
+		service:  service,
+		maxBytes: maxBytes,
+		queue:    make(chan []byte, shadowQueueLength),
+		done:     make(chan struct{}),
+	}
+	go c.writeLoop()
+	go c.discardLoop()
+	return c
+}
+
+// Write 写入主连接，成功写入的部分再镜像到影子连接
+func (c *ShadowConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if n > 0 {
+		c.mirror(b[:n])
+	}
+	return n, err
+}
+
+// mirror 将数据排队写入影子连接（不阻塞）
+func (c *ShadowConn) mirror(b []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.stopped.Load() {
+		shadowBytes.WithLabelValues(c.service, ShadowResultDropped).Add(float64(len(b)))
+		return
+	}
+
+	chunk := b
+	if c.maxBytes > 0 && c.queued+int64(len(chunk)) > c.maxBytes {
+		chunk = chunk[:c.maxBytes-c.queued]
+	}
+	if len(chunk) > 0 {
+		select {
+		case c.queue <- append([]byte(nil), chunk...):
+			c.queued += int64(len(chunk))
+		default:
+			// 影子目标跟不上：丢弃部分数据会使影子流不完整，直接停止镜像
+			c.stop()
+			chunk = nil
+		}
+	}
+	if dropped := len(b) - len(chunk); dropped > 0 {
+		shadowBytes.WithLabelValues(c.service, ShadowResultDropped).Add(float64(dropped))
+	}
+	if c.maxBytes > 0 && c.queued >= c.maxBytes {
+		c.stop()
+	}
+}
+
+// writeLoop 依次写入影子连接，停止镜像并写完已排队数据后关闭影子连接
+func (c *ShadowConn) writeLoop() {
+	defer c.shadow.Close()
+	for {
+		select {
+		case chunk := <-c.queue:
+			if _, err := c.shadow.Write(chunk); err != nil {
+				c.stop()
+				shadowBytes.WithLabelValues(c.service, ShadowResultDropped).Add(float64(len(chunk)))
+				return
+			}
+			c.mirrored.Add(int64(len(chunk)))
+			shadowBytes.WithLabelValues(c.service, ShadowResultMirrored).Add(float64(len(chunk)))
+		case <-c.done:
+			// 停止后写完已排队的数据
+			for {
+				select {
+				case chunk := <-c.queue:
+					if _, err := c.shadow.Write(chunk); err != nil {
+						return
+					}
+					c.mirrored.Add(int64(len(chunk)))
+					shadowBytes.WithLabelValues(c.service, ShadowResultMirrored).Add(float64(len(chunk)))
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// discardLoop 读取并丢弃影子目标的响应，避免其发送缓冲区写满
+func (c *ShadowConn) discardLoop() {
+	buf := make([]byte, 32*1024)
+	for {
+		if _, err := c.shadow.Read(buf); err != nil {
+			return
+		}
+	}
+}
+
+// stop 停止镜像，writeLoop 写完已排队数据后关闭影子连接
+func (c *ShadowConn) stop() {
+	c.closeOnce.Do(func() {
+		c.stopped.Store(true)
+		close(c.done)
+	})
+}
+
+// Mirrored 已写入影子目标的字节数
+func (c *ShadowConn) Mirrored() int64 {
+	return c.mirrored.Load()
+}
+
+// Close 关闭主连接并停止镜像，已排队的镜像数据最多再写 shadowFlushTimeout
+func (c *ShadowConn) Close() error {
+	c.stop()
+	c.shadow.SetWriteDeadline(time.Now().Add(shadowFlushTimeout))
+	return c.Conn.Close()
+}
@@ -0,0 +1,138 @@
+package tunnel
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestServiceConfig_ValidateShadow(t *testing.T) {
+	tests := []struct {
+		name    string
+		shadow  *ShadowConfig
+		wantErr bool
+	}{
+		{"none", nil, false},
+		{"valid", &ShadowConfig{TargetHost: "10.0.0.2", TargetPort: 8080, SamplePercent: 10, MaxBytes: 1 << 20}, false},
+		{"missing host", &ShadowConfig{TargetPort: 8080}, true},
+		{"bad port", &ShadowConfig{TargetHost: "10.0.0.2", TargetPort: 70000}, true},
+		{"bad sample", &ShadowConfig{TargetHost: "10.0.0.2", TargetPort: 8080, SamplePercent: 101}, true},
+		{"negative cap", &ShadowConfig{TargetHost: "10.0.0.2", TargetPort: 8080, MaxBytes: -1}, true},
+		{"same as target", &ShadowConfig{TargetHost: "10.0.0.1", TargetPort: 8080}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &ServiceConfig{ServiceID: "web", TargetHost: "10.0.0.1", TargetPort: 8080, Shadow: tt.shadow}
+			if err := svc.ValidateShadow(); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateShadow() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// shadowPipes 返回包装后的目标连接及主目标、影子目标的对端
+func shadowPipes(t *testing.T, maxBytes int64) (*ShadowConn, net.Conn, net.Conn) {
+	t.Helper()
+	target, targetPeer := net.Pipe()
+	shadow, shadowPeer := net.Pipe()
+	t.Cleanup(func() {
+		targetPeer.Close()
+		shadowPeer.Close()
+	})
+	return NewShadowConn(target, shadow, "web", maxBytes), targetPeer, shadowPeer
+}
+
+func TestShadowConn_Mirrors(t *testing.T) {
+	conn, targetPeer, shadowPeer := shadowPipes(t, 0)
+	go io.Copy(io.Discard, targetPeer)
+
+	mirrored := make(chan []byte, 1)
+	go func() {
+		data, _ := io.ReadAll(shadowPeer)
+		mirrored <- data
+	}()
+
+	for _, chunk := range []string{"GET / HTTP/1.1\r\n", "Host: web\r\n\r\n"} {
+		if _, err := conn.Write([]byte(chunk)); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	conn.Close()
+
+	select {
+	case data := <-mirrored:
+		if string(data) != "GET / HTTP/1.1\r\nHost: web\r\n\r\n" {
+			t.Errorf("mirrored %q", data)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("shadow connection was not closed")
+	}
+	if conn.Mirrored() != 29 {
+		t.Errorf("Mirrored() = %d, want 29", conn.Mirrored())
+	}
+}
+
+func TestShadowConn_MaxBytes(t *testing.T) {
+	conn, targetPeer, shadowPeer := shadowPipes(t, 4)
+
+	received := make(chan []byte, 1)
+	go func() {
+		data, _ := io.ReadAll(targetPeer)
+		received <- data
+	}()
+	mirrored := make(chan []byte, 1)
+	go func() {
+		data, _ := io.ReadAll(shadowPeer)
+		mirrored <- data
+	}()
+
+	// 达到上限后影子连接关闭，主连接继续收到完整数据
+	conn.Write([]byte("abcdef"))
+	select {
+	case data := <-mirrored:
+		if string(data) != "abcd" {
+			t.Errorf("mirrored %q, want %q", data, "abcd")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("shadow connection was not closed at byte cap")
+	}
+
+	conn.Write([]byte("gh"))
+	conn.Close()
+	if data := <-received; !bytes.Equal(data, []byte("abcdefgh")) {
+		t.Errorf("target received %q", data)
+	}
+}
+
+func TestServiceConfig_MirrorTarget(t *testing.T) {
+	target, peer := net.Pipe()
+	defer peer.Close()
+	defer target.Close()
+
+	svc := &ServiceConfig{ServiceID: "web", TargetHost: "10.0.0.1", TargetPort: 8080}
+	dialed := 0
+	dial := func(addr string) (net.Conn, error) {
+		dialed++
+		if addr != "10.0.0.2:9090" {
+			t.Errorf("dialed %s", addr)
+		}
+		return nil, errors.New("connection refused")
+	}
+
+	// 未配置影子目标时原样返回
+	conn, err := svc.MirrorTarget(target, dial)
+	if err != nil || conn != target || dialed != 0 {
+		t.Fatalf("unexpected mirror without shadow config: %v", err)
+	}
+
+	// 影子拨号失败时返回主连接与错误
+	svc.Shadow = &ShadowConfig{TargetHost: "10.0.0.2", TargetPort: 9090}
+	conn, err = svc.MirrorTarget(target, dial)
+	if err == nil || conn != target || dialed != 1 {
+		t.Fatalf("expected dial error and original conn, got %v", err)
+	}
+}
@@ -0,0 +1,349 @@
+package tunnel
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 链路整形：IH 本地转发循环中模拟慢速链路（带宽上限、附加延迟、抖动、丢包），仅用于测试
+// 丢包不会真正丢弃数据（隧道承载的是可靠字节流），而是按 TCP 重传的效果延后该数据块及其后的数据
+const (
+	// ShapeUpstream 本地连接 → 隧道
+	ShapeUpstream = 0
+	// ShapeDownstream 隧道 → 本地连接
+	ShapeDownstream = 1
+
+	// shapingChunkSize 单次读取的最大字节数；限速时按约 50ms 的传输量缩小，使速率平滑
+	shapingChunkSize    = 32 << 10
+	shapingMinChunkSize = 1 << 10
+	// shapingQueueLen 每个方向在途（等待延迟到期）的最大数据块数
+	shapingQueueLen = 256
+	// shapingMinRetransmit 丢包后的最小重传延迟（与常见 TCP 最小 RTO 一致）
+	shapingMinRetransmit = 200 * time.Millisecond
+	// shapingMaxDelay 附加延迟与抖动之和的上限
+	shapingMaxDelay = time.Minute
+)
+
+// ShapingConfig 单个映射（本地监听 → 隧道）的整形参数，零值表示不整形
+type ShapingConfig struct {
+	// Bandwidth 每个方向的带宽上限（字节/秒），由该映射的所有连接共享，0 不限制
+	Bandwidth int64 `json:"bandwidth,omitempty"`
+	// Latency 每个方向附加的单向延迟（往返增加 2×Latency）
+	Latency time.Duration `json:"latency,omitempty"`
+	// Jitter 延迟在 [Latency-Jitter, Latency+Jitter] 内均匀随机（不低于 0），数据不会乱序
+	Jitter time.Duration `json:"jitter,omitempty"`
+	// DropRate 每个数据块的丢包概率 [0, 1)，丢包的数据块在 max(2×Latency, 200ms) 后重传
+	DropRate float64 `json:"drop_rate,omitempty"`
+}
+
+// Validate 校验整形参数
+func (c *ShapingConfig) Validate() error {
+	if c.Bandwidth < 0 {
+		return fmt.Errorf("bandwidth cannot be negative")
+	}
+	if c.Latency < 0 || c.Jitter < 0 {
+		return fmt.Errorf("latency and jitter cannot be negative")
+	}
+	if c.Latency+c.Jitter > shapingMaxDelay {
+		return fmt.Errorf("latency plus jitter exceeds %s", shapingMaxDelay)
+	}
+	if c.DropRate < 0 || c.DropRate >= 1 {
+		return fmt.Errorf("drop rate must be in [0, 1)")
+	}
+	return nil
+}
+
+// enabled 是否设置了任一整形参数
+func (c *ShapingConfig) enabled() bool {
+	return c.Bandwidth > 0 || c.Latency > 0 || c.Jitter > 0 || c.DropRate > 0
+}
+
+// ShapingStats 整形计数
+type ShapingStats struct {
+	Bytes   int64 `json:"bytes"`   // 经整形转发的字节数（两个方向合计）
+	Dropped int64 `json:"dropped"` // 模拟丢包（重传）的数据块数
+}
+
+// Shaper 单个映射的链路整形器，整形参数可在运行时通过 Set 修改，对已建立的连接立即生效
+// nil Shaper 的 Copy 等同于 io.Copy
+type Shaper struct {
+	config  atomic.Pointer[ShapingConfig]
+	mu      sync.Mutex
+	next    [2]time.Time // 每个方向带宽调度的下一个可发送时间
+	bytes   atomic.Int64
+	dropped atomic.Int64
+}
+
+// NewShaper 创建整形器，config 为 nil 表示初始不整形
+func NewShaper(config *ShapingConfig) (*Shaper, error) {
+	s := &Shaper{}
+	if err := s.Set(config); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Set 替换整形参数，nil 表示停止整形
+func (s *Shaper) Set(config *ShapingConfig) error {
+	cfg := ShapingConfig{}
+	if config != nil {
+		if err := config.Validate(); err != nil {
+			return err
+		}
+		cfg = *config
+	}
+	s.config.Store(&cfg)
+	return nil
+}
+
+// Config 返回当前整形参数
+func (s *Shaper) Config() ShapingConfig {
+	return *s.config.Load()
+}
+
+// Stats 返回整形计数
+func (s *Shaper) Stats() ShapingStats {
+	return ShapingStats{Bytes: s.bytes.Load(), Dropped: s.dropped.Load()}
+}
+
+// shapedChunk 等待到期发送的数据块
+type shapedChunk struct {
+	data []byte
+	due  time.Time
+}
+
+// Copy 按当前整形参数从 src 向 dst 转发数据，用法与 io.Copy 相同，direction 为 ShapeUpstream 或 ShapeDownstream
+// 读取与发送分离：读到的数据块标记到期时间后排队，到期后再按带宽上限写出，附加延迟不降低吞吐
+func (s *Shaper) Copy(dst io.Writer, src io.Reader, direction int) (written int64, err error) {
+	if s == nil {
+		return io.Copy(dst, src)
+	}
+
+	chunks := make(chan shapedChunk, shapingQueueLen)
+	failed := make(chan struct{})
+	writeErr := make(chan error, 1)
+	go func() {
+		var werr error
+		for chunk := range chunks {
+			if werr != nil {
+				continue // 写失败后丢弃剩余数据块，避免读取端阻塞
+			}
+			if wait := time.Until(chunk.due); wait > 0 {
+				time.Sleep(wait)
+			}
+			if wait := s.reserve(direction, len(chunk.data)); wait > 0 {
+				time.Sleep(wait)
+			}
+			n, e := dst.Write(chunk.data)
+			written += int64(n)
+			s.bytes.Add(int64(n))
+			if e != nil {
+				werr = e
+				close(failed)
+			}
+		}
+		writeErr <- werr
+	}()
+
+	var last time.Time
+read:
+	for {
+		buf := make([]byte, s.chunkSize())
+		n, rerr := src.Read(buf)
+		if n > 0 {
+			last = s.due(time.Now(), last)
+			select {
+			case chunks <- shapedChunk{data: buf[:n], due: last}:
+			case <-failed:
+				break read
+			}
+		}
+		if rerr != nil {
+			if rerr != io.EOF {
+				err = rerr
+			}
+			break
+		}
+	}
+	close(chunks)
+	if werr := <-writeErr; werr != nil {
+		err = werr
+	}
+	return written, err
+}
+
+// chunkSize 返回单次读取的字节数
+func (s *Shaper) chunkSize() int {
+	cfg := s.config.Load()
+	if cfg.Bandwidth <= 0 {
+		return shapingChunkSize
+	}
+	return int(min(shapingChunkSize, max(shapingMinChunkSize, cfg.Bandwidth/20)))
+}
+
+// due 计算在 now 读到的数据块的到期时间，不早于前一个数据块（last），保证数据不乱序
+func (s *Shaper) due(now, last time.Time) time.Time {
+	cfg := s.config.Load()
+	delay := cfg.Latency
+	if cfg.Jitter > 0 {
+		delay += time.Duration(rand.Int64N(int64(2*cfg.Jitter)+1)) - cfg.Jitter
+	}
+	if cfg.DropRate > 0 && rand.Float64() < cfg.DropRate {
+		s.dropped.Add(1)
+		delay += max(2*cfg.Latency, shapingMinRetransmit)
+	}
+	due := now.Add(max(delay, 0))
+	if due.Before(last) {
+		return last
+	}
+	return due
+}
+
+// reserve 按带宽上限为 n 字节预约发送时间，返回需要等待的时长
+func (s *Shaper) reserve(direction, n int) time.Duration {
+	cfg := s.config.Load()
+	if cfg.Bandwidth <= 0 {
+		return 0
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if s.next[direction].Before(now) {
+		s.next[direction] = now
+	}
+	wait := s.next[direction].Sub(now)
+	s.next[direction] = s.next[direction].Add(time.Duration(float64(n) / float64(cfg.Bandwidth) * float64(time.Second)))
+	return wait
+}
+
+// ShapingAdmin 本地管理接口：按映射名称查看与修改整形参数
+//
+//	GET    /shaping         列出所有映射的整形参数与计数
+//	GET    /shaping/{name}  查看单个映射
+//	PUT    /shaping/{name}  设置整形参数（请求体为 ShapingConfig JSON）
+//	DELETE /shaping/{name}  停止整形
+type ShapingAdmin struct {
+	mu      sync.RWMutex
+	shapers map[string]*Shaper
+	mux     *http.ServeMux
+}
+
+// shapingStatus 管理接口中单个映射的状态
+type shapingStatus struct {
+	Name    string        `json:"name"`
+	Enabled bool          `json:"enabled"`
+	Config  ShapingConfig `json:"config"`
+	Stats   ShapingStats  `json:"stats"`
+}
+
+// NewShapingAdmin 创建整形管理接口
+func NewShapingAdmin() *ShapingAdmin {
+	a := &ShapingAdmin{shapers: make(map[string]*Shaper), mux: http.NewServeMux()}
+	a.mux.HandleFunc("GET /shaping", a.handleList)
+	a.mux.HandleFunc("GET /shaping/{name}", a.handleGet)
+	a.mux.HandleFunc("PUT /shaping/{name}", a.handleSet)
+	a.mux.HandleFunc("DELETE /shaping/{name}", a.handleSet)
+	return a
+}
+
+// Register 以 name 注册映射的整形器，同名覆盖
+func (a *ShapingAdmin) Register(name string, shaper *Shaper) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.shapers[name] = shaper
+}
+
+// ServeHTTP 实现 http.Handler
+func (a *ShapingAdmin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mux.ServeHTTP(w, r)
+}
+
+// ListenShapingAdmin 在 Unix socket path 上监听管理接口（权限 0600），并删除上次运行遗留的 socket 文件
+func ListenShapingAdmin(path string) (net.Listener, error) {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("remove stale admin socket: %w", err)
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("listen on admin socket: %w", err)
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("chmod admin socket: %w", err)
+	}
+	return ln, nil
+}
+
+func (a *ShapingAdmin) lookup(name string) *Shaper {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.shapers[name]
+}
+
+func (a *ShapingAdmin) status(name string, shaper *Shaper) shapingStatus {
+	cfg := shaper.Config()
+	return shapingStatus{Name: name, Enabled: cfg.enabled(), Config: cfg, Stats: shaper.Stats()}
+}
+
+func (a *ShapingAdmin) handleList(w http.ResponseWriter, r *http.Request) {
+	a.mu.RLock()
+	mappings := make([]shapingStatus, 0, len(a.shapers))
+	for name, shaper := range a.shapers {
+		mappings = append(mappings, a.status(name, shaper))
+	}
+	a.mu.RUnlock()
+	sort.Slice(mappings, func(i, j int) bool { return mappings[i].Name < mappings[j].Name })
+	writeShapingJSON(w, http.StatusOK, map[string]interface{}{"mappings": mappings})
+}
+
+func (a *ShapingAdmin) handleGet(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	shaper := a.lookup(name)
+	if shaper == nil {
+		writeShapingJSON(w, http.StatusNotFound, map[string]string{"error": "unknown mapping: " + name})
+		return
+	}
+	writeShapingJSON(w, http.StatusOK, a.status(name, shaper))
+}
+
+// handleSet 处理 PUT（设置参数）与 DELETE（停止整形）
+func (a *ShapingAdmin) handleSet(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	shaper := a.lookup(name)
+	if shaper == nil {
+		writeShapingJSON(w, http.StatusNotFound, map[string]string{"error": "unknown mapping: " + name})
+		return
+	}
+
+	var cfg *ShapingConfig
+	if r.Method == http.MethodPut {
+		cfg = &ShapingConfig{}
+		decoder := json.NewDecoder(io.LimitReader(r.Body, 4096))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(cfg); err != nil {
+			writeShapingJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body: " + err.Error()})
+			return
+		}
+	}
+	if err := shaper.Set(cfg); err != nil {
+		writeShapingJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	writeShapingJSON(w, http.StatusOK, a.status(name, shaper))
+}
+
+func writeShapingJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,156 @@
+package tunnel
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShapingConfigValidate(t *testing.T) {
+	valid := []ShapingConfig{
+		{},
+		{Bandwidth: 1 << 20, Latency: 50 * time.Millisecond, Jitter: 10 * time.Millisecond, DropRate: 0.01},
+	}
+	for _, cfg := range valid {
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("Validate(%+v) = %v, want nil", cfg, err)
+		}
+	}
+
+	invalid := []ShapingConfig{
+		{Bandwidth: -1},
+		{Latency: -time.Millisecond},
+		{Jitter: -time.Millisecond},
+		{Latency: time.Minute, Jitter: time.Second},
+		{DropRate: 1},
+		{DropRate: -0.1},
+	}
+	for _, cfg := range invalid {
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Validate(%+v) = nil, want error", cfg)
+		}
+	}
+
+	if _, err := NewShaper(&ShapingConfig{DropRate: 2}); err == nil {
+		t.Error("NewShaper() accepted an invalid config")
+	}
+}
+
+func TestShaperCopy(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), 4096) // 64 KiB
+
+	tests := []struct {
+		name     string
+		config   *ShapingConfig
+		minDelay time.Duration
+	}{
+		{"passthrough", nil, 0},
+		{"latency", &ShapingConfig{Latency: 50 * time.Millisecond, Jitter: 10 * time.Millisecond}, 40 * time.Millisecond},
+		{"bandwidth", &ShapingConfig{Bandwidth: 256 << 10}, 200 * time.Millisecond},
+		{"drop", &ShapingConfig{DropRate: 0.5}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shaper, err := NewShaper(tt.config)
+			if err != nil {
+				t.Fatalf("NewShaper() error = %v", err)
+			}
+			var dst bytes.Buffer
+			start := time.Now()
+			n, err := shaper.Copy(&dst, bytes.NewReader(data), ShapeUpstream)
+			elapsed := time.Since(start)
+			if err != nil || n != int64(len(data)) {
+				t.Fatalf("Copy() = %d, %v; want %d, nil", n, err, len(data))
+			}
+			if !bytes.Equal(dst.Bytes(), data) {
+				t.Fatal("Copy() corrupted or reordered data")
+			}
+			if elapsed < tt.minDelay {
+				t.Errorf("Copy() took %s, want at least %s", elapsed, tt.minDelay)
+			}
+			if st := shaper.Stats(); st.Bytes != int64(len(data)) {
+				t.Errorf("Stats().Bytes = %d, want %d", st.Bytes, len(data))
+			}
+		})
+	}
+}
+
+func TestShaperCopyNil(t *testing.T) {
+	var shaper *Shaper
+	var dst bytes.Buffer
+	if n, err := shaper.Copy(&dst, strings.NewReader("hello"), ShapeDownstream); err != nil || n != 5 {
+		t.Fatalf("nil Shaper Copy() = %d, %v", n, err)
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) { return 0, io.ErrClosedPipe }
+
+func TestShaperCopyWriteError(t *testing.T) {
+	shaper, _ := NewShaper(nil)
+	src := bytes.NewReader(make([]byte, 4*shapingQueueLen*shapingChunkSize))
+	done := make(chan error, 1)
+	go func() {
+		_, err := shaper.Copy(failingWriter{}, src, ShapeUpstream)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != io.ErrClosedPipe {
+			t.Errorf("Copy() error = %v, want %v", err, io.ErrClosedPipe)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Copy() did not return after the writer failed")
+	}
+}
+
+func TestShapingAdmin(t *testing.T) {
+	shaper, _ := NewShaper(nil)
+	admin := NewShapingAdmin()
+	admin.Register("localhost:8080", shaper)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		admin.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	w := do(http.MethodPut, "/shaping/localhost:8080", `{"bandwidth":1048576,"latency":100000000,"drop_rate":0.02}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("PUT status = %d, body %s", w.Code, w.Body)
+	}
+	want := ShapingConfig{Bandwidth: 1 << 20, Latency: 100 * time.Millisecond, DropRate: 0.02}
+	if got := shaper.Config(); got != want {
+		t.Errorf("Config() = %+v, want %+v", got, want)
+	}
+
+	w = do(http.MethodGet, "/shaping", "")
+	var list struct {
+		Mappings []shapingStatus `json:"mappings"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil || len(list.Mappings) != 1 || !list.Mappings[0].Enabled {
+		t.Fatalf("GET /shaping = %s (%v)", w.Body, err)
+	}
+
+	for _, body := range []string{`{"drop_rate":1}`, `{"latency":"100ms"}`, `{"delay":1}`} {
+		if w := do(http.MethodPut, "/shaping/localhost:8080", body); w.Code != http.StatusBadRequest {
+			t.Errorf("PUT %s status = %d, want 400", body, w.Code)
+		}
+	}
+	if w := do(http.MethodGet, "/shaping/unknown", ""); w.Code != http.StatusNotFound {
+		t.Errorf("GET unknown mapping status = %d, want 404", w.Code)
+	}
+
+	if w := do(http.MethodDelete, "/shaping/localhost:8080", ""); w.Code != http.StatusOK {
+		t.Fatalf("DELETE status = %d", w.Code)
+	}
+	if got := shaper.Config(); got != (ShapingConfig{}) {
+		t.Errorf("Config() after DELETE = %+v, want zero", got)
+	}
+}
@@ -0,0 +1,47 @@
+package tunnel
+
+import (
+	"io"
+	"net"
+	"sync"
+)
+
+// copyBufferSize 用户态转发缓冲大小（与 io.Copy 默认一致）
+const copyBufferSize = 32 * 1024
+
+// copyBufferPool 回退路径复用的转发缓冲，避免每条连接每个方向分配 32KB
+var copyBufferPool = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, copyBufferSize)
+		return &buf
+	},
+}
+
+// canOffload 两端是否都是明文 TCP，可由内核直接搬运
+func canOffload(dst io.Writer, src io.Reader) bool {
+	_, dstTCP := dst.(*net.TCPConn)
+	_, srcTCP := src.(*net.TCPConn)
+	return dstTCP && srcTCP
+}
+
+// copyConn 单方向转发 src → dst，返回写入字节数
+//
+// 两端都是明文 TCP 时交给 (*net.TCPConn).ReadFrom：Linux 上由内核 splice 在两个 socket 之间搬运，
+// 数据不经过用户态缓冲。任一端为 TLS（数据平面 mTLS、E2E、TLS 目标）或经过包装
+// （多路复用流、L7 检查、影子镜像）时自动回退为池化缓冲的用户态复制
+func copyConn(dst io.Writer, src io.Reader) (int64, error) {
+	if canOffload(dst, src) {
+		return dst.(*net.TCPConn).ReadFrom(src)
+	}
+
+	bufp := copyBufferPool.Get().(*[]byte)
+	defer copyBufferPool.Put(bufp)
+	// 隐藏 ReaderFrom / WriterTo，确保使用池化缓冲而非 io.Copy 内部临时分配
+	return io.CopyBuffer(writerOnly{dst}, readerOnly{src}, *bufp)
+}
+
+// writerOnly 仅暴露 Write
+type writerOnly struct{ io.Writer }
+
+// readerOnly 仅暴露 Read
+type readerOnly struct{ io.Reader }
@@ -0,0 +1,96 @@
+package tunnel
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+)
+
+// tcpPair 返回一对已连接的回环 TCP 连接
+func tcpPair(tb testing.TB) (*net.TCPConn, *net.TCPConn) {
+	tb.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer ln.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, _ := ln.Accept()
+		accepted <- conn
+	}()
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		tb.Fatal(err)
+	}
+	server := <-accepted
+	if server == nil {
+		tb.Fatal("accept failed")
+	}
+	tb.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	return client.(*net.TCPConn), server.(*net.TCPConn)
+}
+
+func TestCopyConn(t *testing.T) {
+	payload := bytes.Repeat([]byte("0123456789abcdef"), 64*1024) // 1MB
+
+	_, relayRemote := tcpPair(t)
+	target, _ := tcpPair(t)
+	pipeA, pipeB := net.Pipe()
+	defer pipeA.Close()
+	defer pipeB.Close()
+
+	tests := []struct {
+		name    string
+		dst     io.Writer
+		src     io.Reader
+		offload bool
+	}{
+		{"tcp to tcp", target, relayRemote, true},
+		{"wrapped source", target, readerOnly{relayRemote}, false},
+		{"non-tcp destination", pipeA, relayRemote, false},
+	}
+	for _, tt := range tests {
+		if got := canOffload(tt.dst, tt.src); got != tt.offload {
+			t.Errorf("%s: canOffload = %v, want %v", tt.name, got, tt.offload)
+		}
+	}
+
+	// 内核搬运路径与回退路径都应完整转发（relay 写完后半关闭，copyConn 读到 EOF 返回）
+	for _, wrap := range []bool{false, true} {
+		relay, relayRemote := tcpPair(t)
+		target, targetRemote := tcpPair(t)
+		var src io.Reader = relayRemote
+		if wrap {
+			src = readerOnly{relayRemote}
+		}
+		go func() {
+			relay.Write(payload)
+			relay.CloseWrite()
+		}()
+
+		done := make(chan error, 1)
+		go func() {
+			n, err := copyConn(target, src)
+			if err == nil && n != int64(len(payload)) {
+				err = io.ErrShortWrite
+			}
+			done <- err
+		}()
+		got := make([]byte, len(payload))
+		if _, err := io.ReadFull(targetRemote, got); err != nil {
+			t.Fatalf("wrap=%v: read: %v", wrap, err)
+		}
+		if err := <-done; err != nil {
+			t.Fatalf("wrap=%v: copy: %v", wrap, err)
+		}
+		if !bytes.Equal(got, payload) {
+			t.Fatalf("wrap=%v: payload mismatch", wrap)
+		}
+	}
+}
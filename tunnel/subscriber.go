@@ -5,33 +5,99 @@ import (
 	"context"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	neturl "net/url"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	lru "github.com/hashicorp/golang-lru"
+	"github.com/houzhh15/sdp-common/backoff"
+	"github.com/houzhh15/sdp-common/egress"
 	"github.com/houzhh15/sdp-common/logging"
 )
 
 // SubscriberCallback defines callback function for tunnel notifications
 type SubscriberCallback func(*TunnelEvent) error
 
-// Subscriber manages SSE subscription for tunnel notifications (AH side)
+// ExpiryCallback defines callback function for session/tunnel expiry warnings (IH side)
+type ExpiryCallback func(*ExpiryEvent) error
+
+// ClientEventCallback defines callback function for policy/session events (IH side)
+type ClientEventCallback func(*ClientEvent) error
+
+// ServiceEventCallback defines callback function for service config events (AH side)
+// A single service_created/updated/deleted event is delivered as a batch of one;
+// a coalesced service_bulk_updated event is delivered as one batch
+type ServiceEventCallback func([]*ServiceEvent) error
+
+// ConnectedCallback is invoked each time the SSE stream is (re)established,
+// e.g. to report active tunnels via Reconcile after a Controller restart
+type ConnectedCallback func(ctx context.Context)
+
+// Default SSE stream paths (relative to ControllerURL); the Controller also
+// serves the AH stream at /v1/agent/tunnels/stream
+const (
+	DefaultSubscribePath    = "/api/v1/events/subscribe"
+	DefaultClientStreamPath = "/api/v1/client/events/stream"
+)
+
+// devicePostureHeader 与 auth.DevicePostureHeader 相同（auth 依赖本包，不能反向引用）
+const devicePostureHeader = "X-SDP-Device-Posture"
+
+// Subscriber manages SSE subscription for tunnel notifications
+// AH side by default; IH side when a session token is configured
 type Subscriber struct {
-	controllerURL string
+	controllers   []string // ControllerURL followed by FailoverURLs
+	failoverAfter time.Duration
 	agentID       string
+	sessionToken  string // IH 模式：会话令牌（Authorization: Bearer）
+	postureHash   string // IH 模式：设备指纹（DevicePostureHeader）
+	streamPath    string // AH 模式事件流路径
+	clientPath    string // IH 模式事件流路径
 	client        *http.Client
 	callback      SubscriberCallback
+	onExpiry      ExpiryCallback
+	onClientEvent ClientEventCallback
+	onService     ServiceEventCallback
+	onConnected   ConnectedCallback
+	onStateChange StateChangeCallback
+	onFailover    FailoverCallback
 	logger        logging.Logger
+	backoff       *backoff.Backoff // reconnect delays, reset after each successful stream
+	heartbeat     time.Duration    // requested heartbeat interval, 0 = server default
+	missedBeats   int              // silent intervals tolerated before reconnecting, <= 0 disables
+	maxLineSize   int              // longest SSE line accepted, see DefaultMaxSSELineSize
+	maxEventSize  int              // largest undispatched event accepted, see DefaultMaxSSEEventSize
+	capabilities  Capabilities     // advertised to the server in CapabilitiesHeader
 	stopChan      chan struct{}
+	stopOnce      sync.Once
+	cancel        context.CancelFunc // cancels the in-flight SSE request on Stop
 	wg            sync.WaitGroup
 	mu            sync.RWMutex
-	connected     bool
 	lastEventID   string     // 最后收到的事件 ID，用于断线重连恢复
 	eventCache    *lru.Cache // LRU cache for event deduplication (size: 100)
+
+	// Connection health, see Status
+	state             SubscriberState
+	connects          int
+	failedAttempts    int
+	lastError         string
+	lastConnectedAt   time.Time
+	disconnectedSince time.Time
+	lastEventAt       time.Time
+	serverHeartbeat   time.Duration // interval reported by the server in the connected event
+	peerCapabilities  Capabilities  // capabilities reported by the server in the connected event
+	protocolErrors    int           // streams dropped for violating the SSE size limits
+
+	// Controller failover, see FailoverURLs
+	active               int       // index into controllers
+	endpointFailingSince time.Time // first failure against the current endpoint, zero while connected
+	failovers            int
 }
 
 // SubscriberConfig holds Subscriber configuration
@@ -40,7 +106,59 @@ type SubscriberConfig struct {
 	AgentID       string
 	TLSConfig     *tls.Config
 	Callback      SubscriberCallback
-	Logger        logging.Logger
+	// ExpiryCallback receives session_expiring / tunnel_expiring warnings (optional)
+	ExpiryCallback ExpiryCallback
+	// SessionToken switches to IH mode: subscribes to the client-scoped stream
+	// (own tunnels, policy and session events only) authenticated by this token
+	SessionToken string
+	// PostureHash is sent with the session token in IH mode (auth.Client.PostureHash);
+	// required when the handshake reported device info, the Controller treats its absence as device drift
+	PostureHash string
+	// ClientEventCallback receives policy_* / session_* / service_status_changed / tunnel_failed events in IH mode (optional)
+	ClientEventCallback ClientEventCallback
+	// ServiceEventCallback receives service config events in AH mode (optional)
+	ServiceEventCallback ServiceEventCallback
+	// ConnectedCallback runs on every successful (re)connect before events are read;
+	// it must not block, long-running work should start its own goroutine (optional)
+	ConnectedCallback ConnectedCallback
+	// StateChangeCallback runs when the connection state changes (connecting,
+	// connected, disconnected, stopped); it must not block (optional)
+	StateChangeCallback StateChangeCallback
+	Logger              logging.Logger
+	// Proxy outbound proxy for the SSE connection; nil follows HTTPS_PROXY / NO_PROXY
+	Proxy *egress.Config
+	// StreamPath AH-mode SSE path (default: DefaultSubscribePath)
+	StreamPath string
+	// ClientStreamPath IH-mode SSE path (default: DefaultClientStreamPath)
+	ClientStreamPath string
+	// Backoff reconnect delays (default: jittered 1s doubling up to 60s, retry forever);
+	// when MaxAttempts or MaxElapsedTime is exhausted the subscriber gives up
+	Backoff *backoff.Config
+	// Heartbeat interval to request from the server (e.g. shorter than a proxy's idle
+	// timeout); the server clamps it to its bounds. 0 keeps the server default
+	Heartbeat time.Duration
+	// MissedHeartbeats reconnects proactively when the stream stays silent for this many
+	// heartbeat intervals (default 3, negative disables)
+	MissedHeartbeats int
+	// MaxLineSize longest SSE line accepted (default DefaultMaxSSELineSize)
+	MaxLineSize int
+	// MaxEventSize largest event accepted, summed over its event, id and data
+	// lines until the terminating blank line (default DefaultMaxSSEEventSize).
+	// Oversized lines or events drop the stream and the subscriber reconnects,
+	// skipping the offending event when its ID was already received
+	MaxEventSize int
+	// Capabilities advertised to the server on every connect (default DefaultCapabilities())
+	Capabilities Capabilities
+	// FailoverURLs secondary Controller endpoints, tried in order after ControllerURL has
+	// been unreachable for FailoverAfter; after the last one the primary is tried again.
+	// The subscriber stays on the endpoint it switched to until that one fails (optional)
+	FailoverURLs []string
+	// FailoverAfter how long the current endpoint may keep failing before switching
+	// (default DefaultFailoverAfter, negative disables failover)
+	FailoverAfter time.Duration
+	// FailoverCallback runs when the subscriber switches endpoints, e.g. to reload
+	// service configs from the new Controller; it must not block (optional)
+	FailoverCallback FailoverCallback
 }
 
 // NewSubscriber creates a new tunnel subscriber
@@ -56,50 +174,124 @@ func NewSubscriber(config *SubscriberConfig) *Subscriber {
 		panic(fmt.Sprintf("failed to create LRU cache: %v", err))
 	}
 
+	if config.StreamPath == "" {
+		config.StreamPath = DefaultSubscribePath
+	}
+	if config.ClientStreamPath == "" {
+		config.ClientStreamPath = DefaultClientStreamPath
+	}
+	if config.Backoff == nil {
+		config.Backoff = &backoff.Config{InitialInterval: time.Second, MaxInterval: 60 * time.Second}
+	}
+	if config.MissedHeartbeats == 0 {
+		config.MissedHeartbeats = defaultMissedHeartbeats
+	}
+	if config.MaxLineSize <= 0 {
+		config.MaxLineSize = DefaultMaxSSELineSize
+	}
+	if config.MaxEventSize <= 0 {
+		config.MaxEventSize = DefaultMaxSSEEventSize
+	}
+	if config.Capabilities == nil {
+		config.Capabilities = DefaultCapabilities()
+	}
+	if config.FailoverAfter == 0 {
+		config.FailoverAfter = DefaultFailoverAfter
+	}
+
 	return &Subscriber{
-		controllerURL: config.ControllerURL,
+		controllers:   controllerEndpoints(config.ControllerURL, config.FailoverURLs),
+		failoverAfter: config.FailoverAfter,
 		agentID:       config.AgentID,
+		sessionToken:  config.SessionToken,
+		postureHash:   config.PostureHash,
+		streamPath:    config.StreamPath,
+		clientPath:    config.ClientStreamPath,
 		client: &http.Client{
 			Transport: &http.Transport{
 				TLSClientConfig: config.TLSConfig,
+				Proxy:           config.Proxy.ProxyFunc(),
 			},
 			Timeout: 0, // No timeout for SSE long connections
 		},
-		callback:   config.Callback,
-		logger:     config.Logger,
-		stopChan:   make(chan struct{}),
-		eventCache: eventCache,
+		callback:      config.Callback,
+		onExpiry:      config.ExpiryCallback,
+		onClientEvent: config.ClientEventCallback,
+		onService:     config.ServiceEventCallback,
+		onConnected:   config.ConnectedCallback,
+		onStateChange: config.StateChangeCallback,
+		onFailover:    config.FailoverCallback,
+		logger:        config.Logger,
+		backoff:       backoff.New(config.Backoff),
+		heartbeat:     config.Heartbeat,
+		missedBeats:   config.MissedHeartbeats,
+		maxLineSize:   config.MaxLineSize,
+		maxEventSize:  config.MaxEventSize,
+		capabilities:  config.Capabilities,
+		stopChan:      make(chan struct{}),
+		eventCache:    eventCache,
+		state:         SubscriberIdle,
 	}
 }
 
 // Start begins subscribing to tunnel notifications
 func (s *Subscriber) Start(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	s.mu.Lock()
+	s.cancel = cancel
+	s.mu.Unlock()
+
+	s.setState(SubscriberConnecting, nil)
 	s.wg.Add(1)
 	go s.subscribeLoop(ctx)
 	return nil
 }
 
-// Stop stops the subscriber
+// Stop stops the subscriber, aborting a blocked stream read, and waits for the
+// subscribe loop to exit. Idle keep-alive connections are closed so no
+// transport goroutines outlive the subscriber. Safe to call more than once
 func (s *Subscriber) Stop() error {
-	close(s.stopChan)
+	s.stopOnce.Do(func() {
+		close(s.stopChan)
+		s.mu.RLock()
+		cancel := s.cancel
+		s.mu.RUnlock()
+		if cancel != nil {
+			cancel()
+		}
+	})
 	s.wg.Wait()
+	s.client.CloseIdleConnections()
+	s.setState(SubscriberStopped, nil)
 	return nil
 }
 
+// SetSessionToken updates the IH session token used on the next (re)connect,
+// e.g. after re-handshaking in response to session_revoked
+func (s *Subscriber) SetSessionToken(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessionToken = token
+}
+
+// SetPostureHash updates the device posture hash sent with the session token on the next (re)connect
+func (s *Subscriber) SetPostureHash(hash string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.postureHash = hash
+}
+
 // IsConnected returns whether the subscriber is connected
 func (s *Subscriber) IsConnected() bool {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	return s.connected
+	return s.state == SubscriberConnected
 }
 
-// subscribeLoop maintains SSE connection with exponential backoff retry
+// subscribeLoop maintains SSE connection with jittered exponential backoff retry
 func (s *Subscriber) subscribeLoop(ctx context.Context) {
 	defer s.wg.Done()
 
-	backoff := time.Second
-	maxBackoff := 60 * time.Second
-
 	for {
 		select {
 		case <-ctx.Done():
@@ -113,20 +305,31 @@ func (s *Subscriber) subscribeLoop(ctx context.Context) {
 
 		err := s.connectAndListen(ctx)
 		if err != nil {
-			s.logger.Error("SSE connection failed", "error", err.Error(), "retry_in", backoff.String())
+			if ctx.Err() != nil {
+				return // stopped or cancelled, not a connection failure
+			}
+			s.setState(SubscriberDisconnected, err)
 
-			// Mark as disconnected
-			s.mu.Lock()
-			s.connected = false
-			s.mu.Unlock()
+			// Prolonged failure of the current Controller: connect to the next endpoint right away
+			if from, to, ok := s.failover(); ok {
+				s.logger.Warn("Controller unreachable, failing over", "from", from, "to", to, "error", err.Error())
+				if s.onFailover != nil {
+					s.onFailover(from, to)
+				}
+				s.backoff.Reset()
+				continue
+			}
+
+			wait, ok := s.backoff.Next()
+			if !ok {
+				s.logger.Error("SSE connection failed, giving up", "error", err.Error(), "attempts", s.backoff.Attempts())
+				s.setState(SubscriberStopped, nil)
+				return
+			}
+			s.logger.Error("SSE connection failed", "error", err.Error(), "retry_in", wait.String())
 
-			// Exponential backoff
 			select {
-			case <-time.After(backoff):
-				backoff *= 2
-				if backoff > maxBackoff {
-					backoff = maxBackoff
-				}
+			case <-time.After(wait):
 			case <-ctx.Done():
 				return
 			case <-s.stopChan:
@@ -136,19 +339,41 @@ func (s *Subscriber) subscribeLoop(ctx context.Context) {
 		}
 
 		// Connection successful, reset backoff
-		backoff = time.Second
+		s.backoff.Reset()
 	}
 }
 
 // connectAndListen establishes SSE connection and listens for events
 func (s *Subscriber) connectAndListen(ctx context.Context) error {
-	// Build SSE URL - 使用标准的 SDP API 路径
-	url := fmt.Sprintf("%s/api/v1/events/subscribe?client_id=%s",
-		strings.TrimSuffix(s.controllerURL, "/"),
-		s.agentID)
+	s.mu.RLock()
+	sessionToken, postureHash := s.sessionToken, s.postureHash
+	s.mu.RUnlock()
+
+	// Build SSE URL; agent_id is read by the Controller, client_id kept for older servers
+	query := neturl.Values{"agent_id": {s.agentID}, "client_id": {s.agentID}, "agent_type": {"ah"}}
+	path := s.streamPath
+	if sessionToken != "" {
+		// IH 模式：客户端作用域事件流，身份由会话令牌确定
+		query = neturl.Values{}
+		path = s.clientPath
+	}
+	if s.heartbeat > 0 {
+		query.Set(HeartbeatParam, strconv.Itoa(int((s.heartbeat+time.Second-1)/time.Second)))
+	}
+	url := strings.TrimSuffix(s.ControllerURL(), "/") + path
+	if len(query) > 0 {
+		url += "?" + query.Encode()
+	}
+
+	// The watchdog aborts the request when the stream goes silent, e.g. a proxy
+	// dropped the connection without closing it
+	connCtx, cancelConn := context.WithCancel(ctx)
+	defer cancelConn()
+	watchdog := s.newWatchdog(cancelConn)
+	defer watchdog.stop()
 
 	// Create request
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	req, err := http.NewRequestWithContext(connCtx, "GET", url, nil)
 	if err != nil {
 		return fmt.Errorf("create request: %w", err)
 	}
@@ -157,6 +382,13 @@ func (s *Subscriber) connectAndListen(ctx context.Context) error {
 	req.Header.Set("Accept", "text/event-stream")
 	req.Header.Set("Cache-Control", "no-cache")
 	req.Header.Set("Connection", "keep-alive")
+	req.Header.Set(CapabilitiesHeader, s.capabilities.String())
+	if sessionToken != "" {
+		req.Header.Set("Authorization", "Bearer "+sessionToken)
+		if postureHash != "" {
+			req.Header.Set(devicePostureHeader, postureHash)
+		}
+	}
 
 	// Add Last-Event-ID header if available (for reconnection recovery)
 	s.mu.RLock()
@@ -170,6 +402,9 @@ func (s *Subscriber) connectAndListen(ctx context.Context) error {
 	// Send request
 	resp, err := s.client.Do(req)
 	if err != nil {
+		if watchdog.timedOut() {
+			return errHeartbeatTimeout
+		}
 		return fmt.Errorf("send request: %w", err)
 	}
 	defer resp.Body.Close()
@@ -178,23 +413,77 @@ func (s *Subscriber) connectAndListen(ctx context.Context) error {
 		return fmt.Errorf("unexpected status: %d", resp.StatusCode)
 	}
 
-	s.logger.Info("SSE connected", "agent_id", s.agentID)
+	s.logger.Info("SSE connected", "agent_id", s.agentID, "controller", s.ControllerURL())
+
+	s.setState(SubscriberConnected, nil)
+
+	if s.onConnected != nil {
+		s.onConnected(ctx)
+	}
+
+	// Read SSE event stream
+	err = s.readEventStream(ctx, resp.Body, watchdog)
+	if watchdog.timedOut() {
+		s.logger.Warn("SSE stream silent, reconnecting", "agent_id", s.agentID, "missed_heartbeats", s.missedBeats)
+		return errHeartbeatTimeout
+	}
+	return err
+}
+
+// newWatchdog starts the missed-heartbeat watchdog for a connection attempt; until
+// the server reports its interval the larger of the requested and default one is assumed
+func (s *Subscriber) newWatchdog(cancel context.CancelFunc) *heartbeatWatchdog {
+	if s.missedBeats <= 0 {
+		return nil
+	}
+	interval := max(s.heartbeat, DefaultHeartbeat)
+	return newHeartbeatWatchdog(interval*time.Duration(s.missedBeats), cancel)
+}
 
-	// Mark as connected
+// applyConnected adopts the heartbeat interval and records the capabilities
+// reported in the connected event
+func (s *Subscriber) applyConnected(data string, watchdog *heartbeatWatchdog) {
+	var connected struct {
+		Heartbeat    float64      `json:"heartbeat"`
+		Capabilities Capabilities `json:"capabilities"`
+	}
+	if err := json.Unmarshal([]byte(data), &connected); err != nil {
+		return
+	}
+
+	// older servers report neither: capabilities stay nil (not advertised)
 	s.mu.Lock()
-	s.connected = true
+	s.peerCapabilities = connected.Capabilities
 	s.mu.Unlock()
+	if connected.Heartbeat <= 0 {
+		return
+	}
+	interval := time.Duration(connected.Heartbeat * float64(time.Second))
 
-	// Read SSE event stream
-	return s.readEventStream(ctx, resp.Body)
+	s.mu.Lock()
+	s.serverHeartbeat = interval
+	s.mu.Unlock()
+	watchdog.setTimeout(interval * time.Duration(s.missedBeats))
 }
 
-// readEventStream reads and processes SSE events
-func (s *Subscriber) readEventStream(ctx context.Context, body io.ReadCloser) error {
+// PeerCapabilities returns the capabilities the server reported in the last
+// connected event; nil before the first connect or when the server does not
+// advertise them (use Capabilities.Supports to degrade accordingly)
+func (s *Subscriber) PeerCapabilities() Capabilities {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.peerCapabilities
+}
+
+// readEventStream reads and processes SSE events; every line (including heartbeat
+// comments) feeds the watchdog. Multiple data lines of one event are joined with
+// "\n"; lines and events over the size limits end the stream with errSSEProtocol
+func (s *Subscriber) readEventStream(ctx context.Context, body io.ReadCloser, watchdog *heartbeatWatchdog) error {
 	reader := bufio.NewReader(body)
 	var eventType string
 	var eventData string
 	var eventID string
+	var hasData bool
 
 	s.logger.Debug("Starting to read SSE event stream", "agent_id", s.agentID)
 
@@ -209,8 +498,11 @@ func (s *Subscriber) readEventStream(ctx context.Context, body io.ReadCloser) er
 		default:
 		}
 
-		line, err := reader.ReadString('\n')
+		line, err := readSSELine(reader, s.maxLineSize)
 		if err != nil {
+			if errors.Is(err, errSSEProtocol) {
+				return s.protocolError(err, eventType, eventID)
+			}
 			if err == io.EOF {
 				s.logger.Warn("SSE connection closed by server", "agent_id", s.agentID)
 				return fmt.Errorf("connection closed")
@@ -218,6 +510,7 @@ func (s *Subscriber) readEventStream(ctx context.Context, body io.ReadCloser) er
 			s.logger.Error("Error reading SSE line", "agent_id", s.agentID, "error", err.Error())
 			return fmt.Errorf("read line: %w", err)
 		}
+		watchdog.alive()
 
 		line = strings.TrimSpace(line)
 		s.logger.Debug("SSE raw line received", "agent_id", s.agentID, "line", line)
@@ -235,18 +528,18 @@ func (s *Subscriber) readEventStream(ctx context.Context, body io.ReadCloser) er
 						eventType = ""
 						eventData = ""
 						eventID = ""
+						hasData = false
 						continue
 					}
 
 					// Add to cache to prevent reprocessing
 					s.eventCache.Add(eventID, true)
-
-					// Update lastEventID
-					s.mu.Lock()
-					s.lastEventID = eventID
-					s.mu.Unlock()
 					s.logger.Debug("Updated lastEventID", "event_id", eventID)
 				}
+				s.recordEvent(eventID)
+				if eventType == "connected" {
+					s.applyConnected(eventData, watchdog)
+				}
 
 				if err := s.handleEvent(eventType, eventData); err != nil {
 					s.logger.Error("Failed to handle event", "type", eventType, "error", err.Error())
@@ -255,6 +548,7 @@ func (s *Subscriber) readEventStream(ctx context.Context, body io.ReadCloser) er
 				eventData = ""
 				eventID = ""
 			}
+			hasData = false
 			continue
 		}
 
@@ -262,10 +556,17 @@ func (s *Subscriber) readEventStream(ctx context.Context, body io.ReadCloser) er
 		if strings.HasPrefix(line, "event:") {
 			eventType = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
 		} else if strings.HasPrefix(line, "data:") {
-			eventData = strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+			data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+			if hasData {
+				data = eventData + "\n" + data
+			}
+			eventData, hasData = data, true
 		} else if strings.HasPrefix(line, "id:") {
 			eventID = strings.TrimSpace(strings.TrimPrefix(line, "id:"))
 		}
+		if size := len(eventType) + len(eventData) + len(eventID); size > s.maxEventSize {
+			return s.protocolError(fmt.Errorf("%w: event exceeds %d bytes", errSSEProtocol, s.maxEventSize), eventType, eventID)
+		}
 	}
 }
 
@@ -306,6 +607,60 @@ func (s *Subscriber) handleEvent(eventType, data string) error {
 		}
 		return nil
 
+	case EventSessionExpiring, EventTunnelExpiring:
+		var event ExpiryEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return fmt.Errorf("parse expiry event: %w", err)
+		}
+
+		s.logger.Info("Received expiry warning",
+			"type", event.Type,
+			"tunnel_id", event.TunnelID,
+			"expires_at", event.ExpiresAt)
+
+		if s.onExpiry != nil {
+			return s.onExpiry(&event)
+		}
+		return nil
+
+	case EventPolicyUpdated, EventPolicyDeleted, EventSessionRefreshed, EventSessionRevoked, EventServiceStatusChanged, EventTunnelFailed:
+		var event ClientEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return fmt.Errorf("parse client event: %w", err)
+		}
+
+		s.logger.Info("Received client event",
+			"type", event.Type,
+			"policy_id", event.PolicyID)
+
+		if s.onClientEvent != nil {
+			return s.onClientEvent(&event)
+		}
+		return nil
+
+	case string(ServiceEventCreated), string(ServiceEventUpdated), string(ServiceEventDeleted):
+		var svc ServiceConfig
+		if err := json.Unmarshal([]byte(data), &svc); err != nil {
+			return fmt.Errorf("parse service event: %w", err)
+		}
+
+		s.logger.Info("Received service event", "type", eventType, "service_id", svc.ServiceID)
+
+		return s.dispatchServiceEvents([]*ServiceEvent{{
+			Type:    ServiceEventType(eventType),
+			Service: &svc,
+		}})
+
+	case string(ServiceEventBulkUpdated):
+		var batch ServiceEvent
+		if err := json.Unmarshal([]byte(data), &batch); err != nil {
+			return fmt.Errorf("parse service bulk event: %w", err)
+		}
+
+		s.logger.Info("Received service bulk event", "services", len(batch.Events))
+
+		return s.dispatchServiceEvents(batch.Events)
+
 	case "heartbeat":
 		// Heartbeat to keep connection alive
 		s.logger.Debug("Received heartbeat")
@@ -317,6 +672,14 @@ func (s *Subscriber) handleEvent(eventType, data string) error {
 	}
 }
 
+// dispatchServiceEvents invokes the service event callback
+func (s *Subscriber) dispatchServiceEvents(events []*ServiceEvent) error {
+	if s.onService == nil || len(events) == 0 {
+		return nil
+	}
+	return s.onService(events)
+}
+
 // truncate truncates a string to max length
 func truncate(s string, max int) string {
 	if len(s) <= max {
@@ -0,0 +1,57 @@
+package tunnel
+
+import (
+	"strings"
+	"time"
+)
+
+// DefaultFailoverAfter is how long the attached Controller may keep failing
+// before the subscriber moves on to the next configured endpoint
+const DefaultFailoverAfter = 30 * time.Second
+
+// FailoverCallback is invoked when the subscriber gives up on the Controller at
+// from and switches to to. It runs on the subscribe loop and must not block
+type FailoverCallback func(from, to string)
+
+// controllerEndpoints returns the primary URL followed by the failover URLs,
+// skipping empty and duplicate entries
+func controllerEndpoints(primary string, failover []string) []string {
+	endpoints := []string{primary}
+	seen := map[string]bool{strings.TrimSuffix(primary, "/"): true}
+	for _, url := range failover {
+		key := strings.TrimSuffix(url, "/")
+		if url == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		endpoints = append(endpoints, url)
+	}
+	return endpoints
+}
+
+// ControllerURL returns the Controller endpoint the subscriber is attached to,
+// or currently connecting to
+func (s *Subscriber) ControllerURL() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.controllers[s.active]
+}
+
+// failover switches to the next endpoint (wrapping back to the primary) once the
+// current one has been failing for failoverAfter; ok is false when no switch happened
+func (s *Subscriber) failover() (from, to string, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.controllers) < 2 || s.failoverAfter <= 0 || s.endpointFailingSince.IsZero() {
+		return "", "", false
+	}
+	if time.Since(s.endpointFailingSince) < s.failoverAfter {
+		return "", "", false
+	}
+	from = s.controllers[s.active]
+	s.active = (s.active + 1) % len(s.controllers)
+	s.endpointFailingSince = time.Time{}
+	s.failovers++
+	return from, s.controllers[s.active], true
+}
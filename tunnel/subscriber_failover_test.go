@@ -0,0 +1,123 @@
+package tunnel
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/houzhh15/sdp-common/backoff"
+)
+
+func TestControllerEndpoints(t *testing.T) {
+	got := controllerEndpoints("https://a:8443", []string{"https://b:8443", "", "https://a:8443/", "https://b:8443", "https://c:8443"})
+	want := []string{"https://a:8443", "https://b:8443", "https://c:8443"}
+	if !slices.Equal(got, want) {
+		t.Errorf("controllerEndpoints() = %v, want %v", got, want)
+	}
+}
+
+func TestSubscriberFailover(t *testing.T) {
+	var primaryUp atomic.Bool
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !primaryUp.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer primary.Close()
+
+	// 备用 Controller 连接成功后断开，使订阅器在持续失败后回到主 Controller
+	var secondaryRequests atomic.Int32
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if secondaryRequests.Add(1) > 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("event:heartbeat\ndata:ping\n\n"))
+	}))
+	defer secondary.Close()
+
+	var mu sync.Mutex
+	var switches [][2]string
+	sub := NewSubscriber(&SubscriberConfig{
+		ControllerURL: primary.URL,
+		FailoverURLs:  []string{secondary.URL},
+		FailoverAfter: 50 * time.Millisecond,
+		AgentID:       "test-agent",
+		Logger:        &mockLogger{},
+		Backoff:       &backoff.Config{InitialInterval: 10 * time.Millisecond, MaxInterval: 10 * time.Millisecond},
+		FailoverCallback: func(from, to string) {
+			mu.Lock()
+			defer mu.Unlock()
+			switches = append(switches, [2]string{from, to})
+			if to == primary.URL {
+				primaryUp.Store(true)
+			}
+		},
+	})
+	if got := sub.ControllerURL(); got != primary.URL {
+		t.Fatalf("ControllerURL() = %s, want primary", got)
+	}
+
+	sub.Start(context.Background())
+	defer sub.Stop()
+
+	deadline := time.Now().Add(3 * time.Second)
+	for !(sub.IsConnected() && sub.ControllerURL() == primary.URL && sub.Status().Failovers == 2) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Subscriber did not fail over and back, status: %+v", sub.Status())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	st := sub.Status()
+	if st.Controller != primary.URL {
+		t.Errorf("Status().Controller = %s, want primary", st.Controller)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	want := [][2]string{{primary.URL, secondary.URL}, {secondary.URL, primary.URL}}
+	if !slices.Equal(switches, want) {
+		t.Errorf("switches = %v, want %v", switches, want)
+	}
+}
+
+func TestSubscriberFailoverDisabled(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	sub := NewSubscriber(&SubscriberConfig{
+		ControllerURL: server.URL,
+		FailoverURLs:  []string{"https://127.0.0.1:1"},
+		FailoverAfter: -1,
+		AgentID:       "test-agent",
+		Logger:        &mockLogger{},
+		Backoff:       &backoff.Config{InitialInterval: 5 * time.Millisecond, MaxInterval: 5 * time.Millisecond},
+	})
+	sub.Start(context.Background())
+	deadline := time.Now().Add(2 * time.Second)
+	for requests.Load() < 5 {
+		if time.Now().After(deadline) {
+			t.Fatal("Subscriber did not retry")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	sub.Stop()
+
+	if st := sub.Status(); st.Controller != server.URL || st.Failovers != 0 {
+		t.Errorf("Expected to stay on the primary, got %+v", st)
+	}
+}
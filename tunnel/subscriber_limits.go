@@ -0,0 +1,55 @@
+package tunnel
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+)
+
+// SSE stream size limits: a broken or malicious server must not be able to grow
+// the subscriber's memory without bound. Violations drop the connection and the
+// subscriber reconnects with backoff
+const (
+	// DefaultMaxSSELineSize caps a single SSE line, including the line terminator.
+	// An event's JSON payload is sent on one data line, so this also bounds events
+	DefaultMaxSSELineSize = 4 << 20
+	// DefaultMaxSSEEventSize caps the fields (event, id, data) buffered for an event
+	// that has not yet been dispatched by its terminating blank line
+	DefaultMaxSSEEventSize = 8 << 20
+)
+
+// errSSEProtocol the server sent a stream that violates the SSE framing or size limits
+var errSSEProtocol = errors.New("sse protocol violation")
+
+// readSSELine reads one line of at most maxLine bytes (terminator included) without
+// buffering more than maxLine bytes; longer lines fail with errSSEProtocol
+func readSSELine(r *bufio.Reader, maxLine int) (string, error) {
+	var line []byte
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if len(line)+len(chunk) > maxLine {
+			return "", fmt.Errorf("%w: line exceeds %d bytes", errSSEProtocol, maxLine)
+		}
+		line = append(line, chunk...)
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		return string(line), err
+	}
+}
+
+// protocolError counts a protocol violation and returns err to drop the stream. When
+// the offending event's ID is already known it becomes the last event ID, so the
+// reconnect resumes after it instead of replaying it forever
+func (s *Subscriber) protocolError(err error, eventType, eventID string) error {
+	s.logger.Error("Dropping SSE stream", "agent_id", s.agentID, "event_type", eventType, "event_id", eventID, "error", err.Error())
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.protocolErrors++
+	if eventID != "" {
+		s.lastEventID = eventID
+		s.eventCache.Add(eventID, true)
+	}
+	return err
+}
@@ -0,0 +1,121 @@
+package tunnel
+
+import "time"
+
+// SubscriberState is the SSE connection state of a Subscriber
+type SubscriberState string
+
+const (
+	SubscriberIdle         SubscriberState = "idle"         // not started
+	SubscriberConnecting   SubscriberState = "connecting"   // first connect in progress
+	SubscriberConnected    SubscriberState = "connected"    // stream established
+	SubscriberDisconnected SubscriberState = "disconnected" // stream lost or connect failed, retrying
+	SubscriberStopped      SubscriberState = "stopped"      // Stop called or retries exhausted
+)
+
+// SubscriberStatus is a point-in-time snapshot of SSE connection health
+type SubscriberStatus struct {
+	State SubscriberState `json:"state"`
+	// LastConnectedAt is when the stream was last (re)established
+	LastConnectedAt time.Time `json:"last_connected_at,omitempty"`
+	// DisconnectedSince is when the current outage began (zero while connected)
+	DisconnectedSince time.Time `json:"disconnected_since,omitempty"`
+	// Reconnects counts successful connects after the first one
+	Reconnects int `json:"reconnects"`
+	// FailedAttempts counts consecutive failed connects since the stream was last up
+	FailedAttempts int    `json:"failed_attempts"`
+	LastError      string `json:"last_error,omitempty"`
+	LastEventID    string `json:"last_event_id,omitempty"`
+	// LastEventAt is when the last event (including heartbeats) was received
+	LastEventAt time.Time `json:"last_event_at,omitempty"`
+	// LastEventAge is the time since LastEventAt when the snapshot was taken
+	LastEventAge time.Duration `json:"last_event_age,omitempty"`
+	// Heartbeat is the interval negotiated with the server (zero until an older
+	// server connects without reporting it)
+	Heartbeat time.Duration `json:"heartbeat,omitempty"`
+	// ProtocolErrors counts streams dropped for exceeding MaxLineSize / MaxEventSize
+	ProtocolErrors int `json:"protocol_errors,omitempty"`
+	// Controller is the endpoint the subscriber is attached to (or connecting to)
+	Controller string `json:"controller"`
+	// Failovers counts switches to another Controller endpoint, see FailoverURLs
+	Failovers int `json:"failovers,omitempty"`
+}
+
+// StateChangeCallback is invoked when the subscriber moves between states,
+// e.g. to alert when an agent stays disconnected. It runs on the subscribe
+// loop and must not block
+type StateChangeCallback func(prev SubscriberState, status SubscriberStatus)
+
+// Status returns a snapshot of the SSE connection health
+func (s *Subscriber) Status() SubscriberStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.statusLocked()
+}
+
+func (s *Subscriber) statusLocked() SubscriberStatus {
+	status := SubscriberStatus{
+		State:             s.state,
+		LastConnectedAt:   s.lastConnectedAt,
+		DisconnectedSince: s.disconnectedSince,
+		FailedAttempts:    s.failedAttempts,
+		LastError:         s.lastError,
+		LastEventID:       s.lastEventID,
+		LastEventAt:       s.lastEventAt,
+		Heartbeat:         s.serverHeartbeat,
+		ProtocolErrors:    s.protocolErrors,
+		Controller:        s.controllers[s.active],
+		Failovers:         s.failovers,
+	}
+	if s.connects > 1 {
+		status.Reconnects = s.connects - 1
+	}
+	if !s.lastEventAt.IsZero() {
+		status.LastEventAge = time.Since(s.lastEventAt)
+	}
+	return status
+}
+
+// setState records a transition and notifies OnStateChange when the state changed;
+// err is recorded as the last error when moving to disconnected
+func (s *Subscriber) setState(state SubscriberState, err error) {
+	s.mu.Lock()
+	prev := s.state
+	now := time.Now()
+	switch state {
+	case SubscriberConnected:
+		s.connects++
+		s.failedAttempts = 0
+		s.lastConnectedAt = now
+		s.disconnectedSince = time.Time{}
+		s.endpointFailingSince = time.Time{}
+	case SubscriberDisconnected:
+		s.failedAttempts++
+		if err != nil {
+			s.lastError = err.Error()
+		}
+		if s.disconnectedSince.IsZero() {
+			s.disconnectedSince = now
+		}
+		if s.endpointFailingSince.IsZero() {
+			s.endpointFailingSince = now
+		}
+	}
+	s.state = state
+	status := s.statusLocked()
+	s.mu.Unlock()
+
+	if prev != state && s.onStateChange != nil {
+		s.onStateChange(prev, status)
+	}
+}
+
+// recordEvent updates the last event timestamp (and ID when set)
+func (s *Subscriber) recordEvent(eventID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastEventAt = time.Now()
+	if eventID != "" {
+		s.lastEventID = eventID
+	}
+}
@@ -1,13 +1,22 @@
 package tunnel
 
 import (
+	"bufio"
 	"context"
 	"crypto/tls"
+	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"slices"
 	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/houzhh15/sdp-common/backoff"
+	"github.com/houzhh15/sdp-common/clock"
+	"github.com/houzhh15/sdp-common/leaktest"
 )
 
 func TestNewSubscriber(t *testing.T) {
@@ -82,8 +91,9 @@ func TestSubscriberConnection(t *testing.T) {
 		flusher.Flush()
 		eventsSent++
 
-		// Keep connection open for a bit
-		time.Sleep(200 * time.Millisecond)
+		// Keep the stream open until the subscriber stops; returning early would
+		// trigger a reconnect after a jittered (possibly near-zero) backoff
+		<-r.Context().Done()
 	}))
 	defer server.Close()
 
@@ -179,6 +189,8 @@ func TestSubscriberReconnect(t *testing.T) {
 }
 
 func TestSubscriberStop(t *testing.T) {
+	leaktest.Check(t)
+
 	// Create long-running server
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "text/event-stream")
@@ -232,7 +244,7 @@ func TestSubscriberEventParsing(t *testing.T) {
 		w.Write([]byte("data:" + validData + "\n\n"))
 		flusher.Flush()
 
-		time.Sleep(200 * time.Millisecond)
+		<-r.Context().Done()
 	}))
 	defer server.Close()
 
@@ -311,7 +323,7 @@ func TestSubscriberUnknownEventType(t *testing.T) {
 		w.Write([]byte("data:some data\n\n"))
 		flusher.Flush()
 
-		time.Sleep(100 * time.Millisecond)
+		<-r.Context().Done()
 	}))
 	defer server.Close()
 
@@ -345,3 +357,504 @@ func TestSubscriberUnknownEventType(t *testing.T) {
 		t.Error("Expected warning for unknown event type")
 	}
 }
+
+func TestSubscriberExpiryEvent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		flusher := w.(http.Flusher)
+
+		w.Write([]byte("event: session_expiring\n"))
+		w.Write([]byte(`data: {"type":"session_expiring","client_id":"ih-1","expires_at":"2024-01-01T00:05:00Z","renewable":true,"timestamp":"2024-01-01T00:00:00Z"}` + "\n\n"))
+		w.Write([]byte("event: tunnel_expiring\n"))
+		w.Write([]byte(`data: {"type":"tunnel_expiring","client_id":"ih-1","tunnel_id":"tunnel-1","expires_at":"2024-01-01T00:05:00Z","renewable":false,"timestamp":"2024-01-01T00:00:00Z"}` + "\n\n"))
+		flusher.Flush()
+
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	var mu sync.Mutex
+	var received []*ExpiryEvent
+	config := &SubscriberConfig{
+		ControllerURL: server.URL,
+		AgentID:       "ih-1",
+		Callback:      func(e *TunnelEvent) error { return nil },
+		ExpiryCallback: func(e *ExpiryEvent) error {
+			mu.Lock()
+			received = append(received, e)
+			mu.Unlock()
+			return nil
+		},
+		Logger: &mockLogger{},
+	}
+
+	sub := NewSubscriber(config)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sub.Start(ctx)
+	time.Sleep(300 * time.Millisecond)
+	cancel()
+	sub.Stop()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 2 {
+		t.Fatalf("Expected 2 expiry events, got %d", len(received))
+	}
+	if received[0].Type != EventSessionExpiring || !received[0].Renewable {
+		t.Errorf("Unexpected session event: %+v", received[0])
+	}
+	if received[1].Type != EventTunnelExpiring || received[1].TunnelID != "tunnel-1" {
+		t.Errorf("Unexpected tunnel event: %+v", received[1])
+	}
+}
+
+func TestSubscriberClientMode(t *testing.T) {
+	var gotPath, gotAuth, gotPosture string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotAuth = r.Header.Get("Authorization")
+		gotPosture = r.Header.Get(devicePostureHeader)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("event: policy_updated\n"))
+		w.Write([]byte(`data: {"type":"policy_updated","client_id":"ih-1","policy_id":"p1","service_id":"svc-1","timestamp":"2024-01-01T00:00:00Z"}` + "\n\n"))
+		w.Write([]byte("event: tunnel_failed\n"))
+		w.Write([]byte(`data: {"type":"tunnel_failed","client_id":"ih-1","service_id":"svc-1","details":{"tunnel_id":"tunnel-1","reason":"pairing_timeout"},"timestamp":"2024-01-01T00:00:00Z"}` + "\n\n"))
+		w.(http.Flusher).Flush()
+
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	var mu sync.Mutex
+	var received []*ClientEvent
+	sub := NewSubscriber(&SubscriberConfig{
+		ControllerURL: server.URL,
+		AgentID:       "ih-1",
+		SessionToken:  "session-token",
+		PostureHash:   "posture-hash",
+		Callback:      func(e *TunnelEvent) error { return nil },
+		ClientEventCallback: func(e *ClientEvent) error {
+			mu.Lock()
+			received = append(received, e)
+			mu.Unlock()
+			return nil
+		},
+		Logger: &mockLogger{},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sub.Start(ctx)
+	time.Sleep(300 * time.Millisecond)
+	cancel()
+	sub.Stop()
+
+	if gotPath != "/api/v1/client/events/stream" {
+		t.Errorf("Expected client stream path, got %s", gotPath)
+	}
+	if gotAuth != "Bearer session-token" {
+		t.Errorf("Expected bearer session token, got %q", gotAuth)
+	}
+	if gotPosture != "posture-hash" {
+		t.Errorf("Expected device posture header, got %q", gotPosture)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 2 || received[0].PolicyID != "p1" {
+		t.Fatalf("Unexpected client events: %+v", received)
+	}
+	if received[0].TunnelFailure() != nil {
+		t.Errorf("policy_updated is not a tunnel failure")
+	}
+	failure := received[1].TunnelFailure()
+	if failure == nil || failure.TunnelID != "tunnel-1" || failure.ServiceID != "svc-1" || failure.Reason != TunnelFailurePairingTimeout {
+		t.Fatalf("Unexpected tunnel failure: %+v", failure)
+	}
+	var err error = failure
+	var failedErr *TunnelFailedError
+	if !errors.As(err, &failedErr) || err.Error() != "tunnel tunnel-1 failed: pairing_timeout" {
+		t.Errorf("Unexpected tunnel failure error: %v", err)
+	}
+}
+
+func TestSubscriberServiceBulkEvent(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	notifier := NewNotifierWithConfig(&NotifierConfig{
+		Logger:             &noopLogger{},
+		Heartbeat:          time.Hour,
+		Clock:              clk,
+		ServiceBatchWindow: time.Second,
+	})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		notifier.Subscribe("ah-1", w)
+	}))
+	defer server.Close()
+
+	batches := make(chan []*ServiceEvent, 4)
+	sub := NewSubscriber(&SubscriberConfig{
+		ControllerURL: server.URL,
+		AgentID:       "ah-1",
+		Callback:      func(e *TunnelEvent) error { return nil },
+		ServiceEventCallback: func(events []*ServiceEvent) error {
+			batches <- events
+			return nil
+		},
+		Logger: &noopLogger{},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sub.Start(ctx)
+	defer func() {
+		cancel()
+		notifier.Unsubscribe("ah-1")
+		sub.Stop()
+	}()
+	for notifier.ClientCount() == 0 {
+		time.Sleep(5 * time.Millisecond)
+	}
+	clk.BlockUntil(1) // 心跳 ticker
+
+	// 批量导入：窗口内 web 先创建后更新，db 创建，合并为一个事件且 web 仍为新建
+	notifier.NotifyService(&ServiceEvent{Type: ServiceEventCreated, Service: &ServiceConfig{ServiceID: "web", TargetPort: 80}})
+	notifier.NotifyService(&ServiceEvent{Type: ServiceEventCreated, Service: &ServiceConfig{ServiceID: "db", TargetPort: 5432}})
+	notifier.NotifyService(&ServiceEvent{Type: ServiceEventUpdated, Service: &ServiceConfig{ServiceID: "web", TargetPort: 8080}})
+	clk.BlockUntil(2) // 合并窗口计时
+	clk.Advance(time.Second)
+
+	select {
+	case events := <-batches:
+		if len(events) != 2 {
+			t.Fatalf("expected 2 coalesced events, got %d", len(events))
+		}
+		if events[0].Service.ServiceID != "web" || events[0].Type != ServiceEventCreated || events[0].Service.TargetPort != 8080 {
+			t.Errorf("unexpected web event: %+v %+v", events[0], events[0].Service)
+		}
+		if events[1].Service.ServiceID != "db" {
+			t.Errorf("unexpected second event: %+v", events[1].Service)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("bulk service event not received")
+	}
+
+	// 窗口内只有一个事件时按原类型推送
+	notifier.NotifyService(&ServiceEvent{Type: ServiceEventDeleted, Service: &ServiceConfig{ServiceID: "db"}})
+	notifier.FlushServiceEvents()
+
+	select {
+	case events := <-batches:
+		if len(events) != 1 || events[0].Type != ServiceEventDeleted || events[0].Service.ServiceID != "db" {
+			t.Errorf("unexpected single event batch: %+v", events)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("single service event not received")
+	}
+}
+
+func TestSubscriberStatus(t *testing.T) {
+	var mu sync.Mutex
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		n := requests
+		mu.Unlock()
+
+		switch n {
+		case 1: // 推送一个事件后断开
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("id:evt-1\nevent:heartbeat\ndata:ping\n\n"))
+		case 2:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		}
+	}))
+	defer server.Close()
+
+	var states []SubscriberState
+	sub := NewSubscriber(&SubscriberConfig{
+		ControllerURL: server.URL,
+		AgentID:       "test-agent",
+		Logger:        &mockLogger{},
+		Backoff:       &backoff.Config{InitialInterval: 10 * time.Millisecond, MaxInterval: 10 * time.Millisecond},
+		StateChangeCallback: func(prev SubscriberState, status SubscriberStatus) {
+			mu.Lock()
+			defer mu.Unlock()
+			states = append(states, status.State)
+		},
+	})
+	if st := sub.Status(); st.State != SubscriberIdle {
+		t.Errorf("Expected idle before Start, got %s", st.State)
+	}
+
+	sub.Start(context.Background())
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		mu.Lock()
+		n := requests
+		mu.Unlock()
+		if n >= 3 && sub.IsConnected() {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Subscriber did not reconnect, status: %+v", sub.Status())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	st := sub.Status()
+	if st.Reconnects != 1 || st.FailedAttempts != 0 || !st.DisconnectedSince.IsZero() {
+		t.Errorf("Unexpected reconnect counters: %+v", st)
+	}
+	if st.LastError != "unexpected status: 503" {
+		t.Errorf("Expected last error from failed attempt, got %q", st.LastError)
+	}
+	if st.LastEventID != "evt-1" || st.LastEventAt.IsZero() || st.LastEventAge <= 0 {
+		t.Errorf("Unexpected last event: %+v", st)
+	}
+
+	sub.Stop()
+	mu.Lock()
+	defer mu.Unlock()
+	want := []SubscriberState{SubscriberConnecting, SubscriberConnected, SubscriberDisconnected, SubscriberConnected, SubscriberStopped}
+	if !slices.Equal(states, want) {
+		t.Errorf("Expected transitions %v, got %v", want, states)
+	}
+}
+
+func TestSubscriberMissedHeartbeats(t *testing.T) {
+	var mu sync.Mutex
+	var queries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		queries = append(queries, r.URL.Query().Get(HeartbeatParam))
+		mu.Unlock()
+
+		// 报告 50ms 心跳后保持静默（模拟代理吞掉连接但未关闭）
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("event: connected\ndata: {\"agent_id\":\"test-agent\",\"heartbeat\":0.05}\n\n"))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	sub := NewSubscriber(&SubscriberConfig{
+		ControllerURL:    server.URL,
+		AgentID:          "test-agent",
+		Logger:           &mockLogger{},
+		Heartbeat:        1500 * time.Millisecond,
+		MissedHeartbeats: 2,
+		Backoff:          &backoff.Config{InitialInterval: 10 * time.Millisecond, MaxInterval: 10 * time.Millisecond},
+	})
+	sub.Start(context.Background())
+	defer sub.Stop()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		mu.Lock()
+		n := len(queries)
+		mu.Unlock()
+		if n >= 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Subscriber did not reconnect after missed heartbeats, status: %+v", sub.Status())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	st := sub.Status()
+	if st.Heartbeat != 50*time.Millisecond {
+		t.Errorf("Expected negotiated heartbeat 50ms, got %v", st.Heartbeat)
+	}
+	if st.LastError != errHeartbeatTimeout.Error() {
+		t.Errorf("Expected heartbeat timeout error, got %q", st.LastError)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if queries[0] != "2" { // 按整秒向上取整
+		t.Errorf("Expected heartbeat=2 query parameter, got %q", queries[0])
+	}
+}
+
+func TestReadSSELine(t *testing.T) {
+	reader := bufio.NewReaderSize(strings.NewReader("short\n"+strings.Repeat("x", 40)+"\nlast"), 16)
+
+	line, err := readSSELine(reader, 32)
+	if err != nil || line != "short\n" {
+		t.Fatalf("Expected short line, got %q, %v", line, err)
+	}
+	if _, err := readSSELine(reader, 32); !errors.Is(err, errSSEProtocol) {
+		t.Fatalf("Expected protocol violation for a 41-byte line, got %v", err)
+	}
+
+	reader = bufio.NewReaderSize(strings.NewReader(strings.Repeat("y", 20)+"\nlast"), 16)
+	if line, err := readSSELine(reader, 32); err != nil || len(line) != 21 {
+		t.Fatalf("Expected line spanning buffer refills, got %q, %v", line, err)
+	}
+	if line, err := readSSELine(reader, 32); err != io.EOF || line != "last" {
+		t.Fatalf("Expected trailing data with EOF, got %q, %v", line, err)
+	}
+}
+
+func TestSubscriberOversizedEvent(t *testing.T) {
+	valid := `{"type":"created","tunnel":{"id":"after-skip","service_id":"svc-1","status":"active"},"timestamp":"2024-01-01T00:00:00Z"}`
+
+	tests := []struct {
+		name   string
+		config SubscriberConfig
+		stream string
+	}{
+		{
+			name:   "line",
+			config: SubscriberConfig{MaxLineSize: 1024},
+			stream: "event: tunnel\nid: 7\ndata: " + strings.Repeat("x", 2048) + "\n\n",
+		},
+		{
+			name:   "event",
+			config: SubscriberConfig{MaxEventSize: 1024},
+			stream: "event: tunnel\nid: 7\n" + strings.Repeat("data: "+strings.Repeat("x", 100)+"\n", 20) + "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var lastEventIDs []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				lastEventIDs = append(lastEventIDs, r.Header.Get("Last-Event-ID"))
+				first := len(lastEventIDs) == 1
+				mu.Unlock()
+
+				w.Header().Set("Content-Type", "text/event-stream")
+				if first {
+					w.Write([]byte(tt.stream))
+				} else {
+					w.Write([]byte("event: tunnel\nid: 8\ndata: " + valid + "\n\n"))
+				}
+				w.(http.Flusher).Flush()
+				<-r.Context().Done()
+			}))
+			defer server.Close()
+
+			received := make(chan string, 4)
+			config := tt.config
+			config.ControllerURL = server.URL
+			config.AgentID = "test-agent"
+			config.Logger = &mockLogger{}
+			config.Backoff = &backoff.Config{InitialInterval: 10 * time.Millisecond, MaxInterval: 10 * time.Millisecond}
+			config.Callback = func(e *TunnelEvent) error {
+				received <- e.Tunnel.ID
+				return nil
+			}
+			sub := NewSubscriber(&config)
+			sub.Start(context.Background())
+			defer sub.Stop()
+
+			select {
+			case id := <-received:
+				if id != "after-skip" {
+					t.Fatalf("Expected only the event after the oversized one, got %q", id)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatalf("Subscriber did not reconnect after protocol violation, status: %+v", sub.Status())
+			}
+
+			st := sub.Status()
+			if st.ProtocolErrors != 1 {
+				t.Errorf("Expected 1 protocol error, got %d", st.ProtocolErrors)
+			}
+			if !strings.Contains(st.LastError, errSSEProtocol.Error()) {
+				t.Errorf("Expected protocol violation as last error, got %q", st.LastError)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if lastEventIDs[1] != "7" {
+				t.Errorf("Expected reconnect to resume after the oversized event, got Last-Event-ID %q", lastEventIDs[1])
+			}
+		})
+	}
+}
+
+func TestSubscriberMultiLineData(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("event: tunnel\ndata: {\"type\":\"created\",\ndata: \"tunnel\":{\"id\":\"multi\"}}\n\n"))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	received := make(chan string, 1)
+	sub := NewSubscriber(&SubscriberConfig{
+		ControllerURL: server.URL,
+		AgentID:       "test-agent",
+		Logger:        &mockLogger{},
+		Callback: func(e *TunnelEvent) error {
+			received <- e.Tunnel.ID
+			return nil
+		},
+	})
+	sub.Start(context.Background())
+	defer sub.Stop()
+
+	select {
+	case id := <-received:
+		if id != "multi" {
+			t.Errorf("Expected tunnel multi, got %q", id)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Multi-line event was not delivered")
+	}
+}
+
+func TestSubscriberCapabilities(t *testing.T) {
+	notifier := NewNotifierWithConfig(&NotifierConfig{
+		Logger:       &noopLogger{},
+		Heartbeat:    time.Hour,
+		Capabilities: Capabilities{CapabilityMux},
+	})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		notifier.SubscribeWith("test-agent", &SubscribeOptions{
+			Capabilities: ParseCapabilities(r.Header.Get(CapabilitiesHeader)),
+		}, w)
+	}))
+	defer server.Close()
+	defer notifier.Close() // 断开订阅，server.Close 才能返回
+
+	sub := NewSubscriber(&SubscriberConfig{
+		ControllerURL: server.URL,
+		AgentID:       "test-agent",
+		Logger:        &mockLogger{},
+		Capabilities:  Capabilities{CapabilityE2E, CapabilityWebSocketEvents},
+	})
+	if sub.PeerCapabilities() != nil {
+		t.Error("PeerCapabilities should be nil before connecting")
+	}
+	sub.Start(context.Background())
+	defer sub.Stop()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for sub.PeerCapabilities() == nil && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := sub.PeerCapabilities(); !slices.Equal(got, Capabilities{CapabilityMux}) {
+		t.Errorf("PeerCapabilities = %v, want [mux]", got)
+	}
+
+	caps, ok := notifier.ClientCapabilities("test-agent")
+	if !ok || !slices.Equal(caps, Capabilities{CapabilityE2E, CapabilityWebSocketEvents}) {
+		t.Errorf("ClientCapabilities = %v, %v; want [e2e ws_events]", caps, ok)
+	}
+	if _, ok := notifier.ClientCapabilities("other-agent"); ok {
+		t.Error("ClientCapabilities reported an unknown agent as connected")
+	}
+}
@@ -0,0 +1,208 @@
+package tunnel
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"time"
+)
+
+// IsPattern 是否为模式化（通配/CIDR）服务
+// 模式化服务不固定目标地址，由 IH 在隧道请求中携带具体目标，
+// Controller 按 TargetCIDR + TargetPorts 校验，AH 负责拨号具体地址
+func (c *ServiceConfig) IsPattern() bool {
+	return c.TargetCIDR != ""
+}
+
+// ValidatePattern 校验模式化服务定义本身是否合法
+func (c *ServiceConfig) ValidatePattern() error {
+	if !c.IsPattern() {
+		return nil
+	}
+
+	if _, _, err := net.ParseCIDR(c.TargetCIDR); err != nil {
+		return fmt.Errorf("invalid target_cidr %q: %w", c.TargetCIDR, err)
+	}
+
+	if len(c.TargetPorts) == 0 && c.TargetPort == 0 {
+		return fmt.Errorf("target_ports is required for pattern service %s", c.ServiceID)
+	}
+	for _, port := range c.TargetPorts {
+		if port <= 0 || port > 65535 {
+			return fmt.Errorf("invalid target port: %d", port)
+		}
+	}
+
+	return nil
+}
+
+// ResolveTarget 根据服务配置解析隧道的具体目标地址
+//
+// 固定目标服务：忽略空请求，直接返回 TargetHost/TargetPort；
+// 请求中携带的目标若与配置不一致则拒绝。
+// 模式化服务：请求必须携带具体的 IP 和端口，且 IP 位于 TargetCIDR 内、
+// 端口位于 TargetPorts（为空时退化为 TargetPort）中。
+func (c *ServiceConfig) ResolveTarget(host string, port int) (string, int, error) {
+	if !c.IsPattern() {
+		if (host != "" && host != c.TargetHost) || (port != 0 && port != c.TargetPort) {
+			return "", 0, fmt.Errorf("service %s does not accept target override", c.ServiceID)
+		}
+		return c.TargetHost, c.TargetPort, nil
+	}
+
+	if host == "" || port == 0 {
+		return "", 0, fmt.Errorf("target_host and target_port are required for pattern service %s", c.ServiceID)
+	}
+
+	_, network, err := net.ParseCIDR(c.TargetCIDR)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid target_cidr %q: %w", c.TargetCIDR, err)
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return "", 0, fmt.Errorf("target_host must be an IP address: %s", host)
+	}
+	if !network.Contains(ip) {
+		return "", 0, fmt.Errorf("target %s not in %s", host, c.TargetCIDR)
+	}
+
+	if !c.allowsPort(port) {
+		return "", 0, fmt.Errorf("target port %d not allowed for service %s", port, c.ServiceID)
+	}
+
+	return ip.String(), port, nil
+}
+
+// ResolveTunnelTarget AH 侧解析隧道的具体目标地址
+// 模式化服务从隧道 Metadata（target_host/target_port）读取 Controller 下发的目标，
+// 并在本地再次按服务模式校验，避免拨号到模式之外的地址
+// 固定目标服务优先使用 Controller 解析并下发的 IP（target_ip），
+// 服务禁止本地 DNS 且 TargetHost 不是 IP 时，缺少该地址则拒绝
+func (c *ServiceConfig) ResolveTunnelTarget(tun *Tunnel) (string, int, error) {
+	if !c.IsPattern() {
+		return c.resolveFixedTarget(tun)
+	}
+
+	if tun == nil || tun.Metadata == nil {
+		return "", 0, fmt.Errorf("tunnel target not provided for pattern service %s", c.ServiceID)
+	}
+
+	host, _ := tun.Metadata["target_host"].(string)
+	var port int
+	switch v := tun.Metadata["target_port"].(type) {
+	case int:
+		port = v
+	case float64: // JSON 反序列化后的数字类型
+		port = int(v)
+	}
+
+	return c.ResolveTarget(host, port)
+}
+
+// resolveFixedTarget 固定目标服务的拨号地址
+func (c *ServiceConfig) resolveFixedTarget(tun *Tunnel) (string, int, error) {
+	if net.ParseIP(c.TargetHost) != nil {
+		return c.TargetHost, c.TargetPort, nil
+	}
+	if ip := tun.TargetIP(); ip != nil {
+		return ip.String(), c.TargetPort, nil
+	}
+	if c.ForbidLocalDNS {
+		return "", 0, fmt.Errorf("local DNS resolution forbidden for service %s and no controller-resolved address for %s", c.ServiceID, c.TargetHost)
+	}
+	return c.TargetHost, c.TargetPort, nil
+}
+
+// ValidateResolution 校验目标解析设置：禁止本地 DNS 的域名目标必须由 Controller 解析
+func (c *ServiceConfig) ValidateResolution() error {
+	if c.ForbidLocalDNS && !c.ResolveOnController && !c.IsPattern() && net.ParseIP(c.TargetHost) == nil {
+		return fmt.Errorf("service %s forbids local DNS but target_host %q is not an IP; enable resolve_on_controller", c.ServiceID, c.TargetHost)
+	}
+	return nil
+}
+
+// EventSnapshot 返回内嵌到隧道创建事件中的服务配置副本：保留目标、协议、解析设置与元数据（标签），
+// 去掉描述、创建/删除时间与用量告警阈值以控制事件大小；UpdatedAt 保留，供 AH 与本地缓存比较新旧
+func (c *ServiceConfig) EventSnapshot() *ServiceConfig {
+	if c == nil {
+		return nil
+	}
+	snap := *c
+	snap.Description = ""
+	snap.CreatedAt = time.Time{}
+	snap.DeletedAt = nil
+	if c.TargetPorts != nil {
+		snap.TargetPorts = append([]int(nil), c.TargetPorts...)
+	}
+	if c.Shadow != nil {
+		shadow := *c.Shadow
+		snap.Shadow = &shadow
+	}
+	if c.UpstreamTLS != nil {
+		upstream := *c.UpstreamTLS
+		snap.UpstreamTLS = &upstream
+	}
+	snap.UsageAlert = nil // 仅 Controller 使用
+	if c.Metadata != nil {
+		snap.Metadata = make(map[string]interface{}, len(c.Metadata))
+		for k, v := range c.Metadata {
+			snap.Metadata[k] = v
+		}
+	}
+	return &snap
+}
+
+// ProxyProtocolV2 ServiceConfig.ProxyProtocol 取值：目标连接开头写入 PROXY protocol v2 头
+const ProxyProtocolV2 = "v2"
+
+// MetadataKeyClientAddr 隧道 Metadata 中 IH 原始源地址（ip:port）的键，由 Controller 在创建隧道时写入
+const MetadataKeyClientAddr = "client_addr"
+
+// MetadataKeyTargetIP 隧道 Metadata 中 Controller 解析的目标 IP 的键（服务启用 ResolveOnController 时写入）
+const MetadataKeyTargetIP = "target_ip"
+
+// ValidateProxyProtocol 校验 ProxyProtocol 取值
+func (c *ServiceConfig) ValidateProxyProtocol() error {
+	switch c.ProxyProtocol {
+	case "", ProxyProtocolV2:
+		return nil
+	default:
+		return fmt.Errorf("unsupported proxy_protocol %q for service %s (valid: \"\", %q)", c.ProxyProtocol, c.ServiceID, ProxyProtocolV2)
+	}
+}
+
+// ClientAddr 返回 Controller 记录的 IH 原始源地址，未记录或无法解析时返回 nil
+func (t *Tunnel) ClientAddr() *net.TCPAddr {
+	if t == nil || t.Metadata == nil {
+		return nil
+	}
+	addr, _ := t.Metadata[MetadataKeyClientAddr].(string)
+	ap, err := netip.ParseAddrPort(addr)
+	if err != nil {
+		return nil
+	}
+	return net.TCPAddrFromAddrPort(ap)
+}
+
+// TargetIP 返回 Controller 解析并下发的目标 IP，未下发或无法解析时返回 nil
+func (t *Tunnel) TargetIP() net.IP {
+	if t == nil || t.Metadata == nil {
+		return nil
+	}
+	ip, _ := t.Metadata[MetadataKeyTargetIP].(string)
+	return net.ParseIP(ip)
+}
+
+// allowsPort 检查端口是否在允许集合中
+func (c *ServiceConfig) allowsPort(port int) bool {
+	if len(c.TargetPorts) == 0 {
+		return c.TargetPort != 0 && port == c.TargetPort
+	}
+	for _, p := range c.TargetPorts {
+		if p == port {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,208 @@
+package tunnel
+
+import (
+	"testing"
+	"time"
+)
+
+func TestServiceConfig_ResolveTarget_Fixed(t *testing.T) {
+	svc := &ServiceConfig{ServiceID: "web", TargetHost: "localhost", TargetPort: 8080}
+
+	host, port, err := svc.ResolveTarget("", 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if host != "localhost" || port != 8080 {
+		t.Errorf("got %s:%d, want localhost:8080", host, port)
+	}
+
+	if _, _, err := svc.ResolveTarget("10.0.0.1", 22); err == nil {
+		t.Error("expected error for target override on fixed service")
+	}
+}
+
+func TestServiceConfig_ResolveTarget_Pattern(t *testing.T) {
+	svc := &ServiceConfig{
+		ServiceID:   "subnet-https",
+		TargetCIDR:  "10.2.0.0/16",
+		TargetPorts: []int{443, 8443},
+	}
+
+	if err := svc.ValidatePattern(); err != nil {
+		t.Fatalf("ValidatePattern failed: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		host    string
+		port    int
+		wantErr bool
+	}{
+		{"in range", "10.2.3.4", 443, false},
+		{"alternate port", "10.2.255.1", 8443, false},
+		{"outside cidr", "10.3.0.1", 443, true},
+		{"port not allowed", "10.2.3.4", 22, true},
+		{"hostname rejected", "db.internal", 443, true},
+		{"missing target", "", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			host, port, err := svc.ResolveTarget(tt.host, tt.port)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ResolveTarget(%q, %d) error = %v, wantErr %v", tt.host, tt.port, err, tt.wantErr)
+			}
+			if !tt.wantErr && (host != tt.host || port != tt.port) {
+				t.Errorf("got %s:%d, want %s:%d", host, port, tt.host, tt.port)
+			}
+		})
+	}
+}
+
+func TestServiceConfig_ValidatePattern(t *testing.T) {
+	if err := (&ServiceConfig{TargetCIDR: "not-a-cidr", TargetPorts: []int{443}}).ValidatePattern(); err == nil {
+		t.Error("expected error for invalid CIDR")
+	}
+	if err := (&ServiceConfig{TargetCIDR: "10.0.0.0/8"}).ValidatePattern(); err == nil {
+		t.Error("expected error for missing port set")
+	}
+	if err := (&ServiceConfig{TargetCIDR: "10.0.0.0/8", TargetPorts: []int{70000}}).ValidatePattern(); err == nil {
+		t.Error("expected error for invalid port")
+	}
+}
+
+func TestServiceConfig_ResolveTunnelTarget(t *testing.T) {
+	svc := &ServiceConfig{ServiceID: "subnet", TargetCIDR: "192.168.0.0/24", TargetPorts: []int{5432}}
+
+	// JSON 反序列化后的端口为 float64
+	tun := &Tunnel{ID: "t1", Metadata: map[string]interface{}{
+		"target_host": "192.168.0.10",
+		"target_port": float64(5432),
+	}}
+
+	host, port, err := svc.ResolveTunnelTarget(tun)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if host != "192.168.0.10" || port != 5432 {
+		t.Errorf("got %s:%d, want 192.168.0.10:5432", host, port)
+	}
+
+	tun.Metadata["target_host"] = "192.168.1.10"
+	if _, _, err := svc.ResolveTunnelTarget(tun); err == nil {
+		t.Error("expected AH-side rejection of out-of-pattern target")
+	}
+}
+
+func TestServiceConfig_ValidateProxyProtocol(t *testing.T) {
+	for _, value := range []string{"", ProxyProtocolV2} {
+		svc := &ServiceConfig{ServiceID: "db", ProxyProtocol: value}
+		if err := svc.ValidateProxyProtocol(); err != nil {
+			t.Errorf("ProxyProtocol %q: unexpected error: %v", value, err)
+		}
+	}
+
+	svc := &ServiceConfig{ServiceID: "db", ProxyProtocol: "v1"}
+	if err := svc.ValidateProxyProtocol(); err == nil {
+		t.Error("expected error for unsupported proxy protocol version")
+	}
+}
+
+func TestTunnel_ClientAddr(t *testing.T) {
+	tun := &Tunnel{Metadata: map[string]interface{}{MetadataKeyClientAddr: "203.0.113.7:51234"}}
+	addr := tun.ClientAddr()
+	if addr == nil || addr.String() != "203.0.113.7:51234" {
+		t.Errorf("ClientAddr = %v, want 203.0.113.7:51234", addr)
+	}
+
+	tun.Metadata[MetadataKeyClientAddr] = "not-an-address"
+	if addr := tun.ClientAddr(); addr != nil {
+		t.Errorf("ClientAddr = %v, want nil for invalid address", addr)
+	}
+	if addr := (&Tunnel{}).ClientAddr(); addr != nil {
+		t.Errorf("ClientAddr = %v, want nil without metadata", addr)
+	}
+}
+
+func TestServiceConfig_ResolveTunnelTarget_ControllerDNS(t *testing.T) {
+	svc := &ServiceConfig{ServiceID: "db", TargetHost: "db.internal", TargetPort: 5432, ResolveOnController: true}
+
+	// Controller 下发的 IP 优先于本地解析
+	tun := &Tunnel{ID: "t1", Metadata: map[string]interface{}{MetadataKeyTargetIP: "10.1.2.3"}}
+	host, port, err := svc.ResolveTunnelTarget(tun)
+	if err != nil || host != "10.1.2.3" || port != 5432 {
+		t.Fatalf("got %s:%d (%v), want 10.1.2.3:5432", host, port, err)
+	}
+
+	// 未下发时回退到本地 DNS
+	host, _, err = svc.ResolveTunnelTarget(&Tunnel{ID: "t2"})
+	if err != nil || host != "db.internal" {
+		t.Errorf("got %s (%v), want fallback to db.internal", host, err)
+	}
+
+	// 禁止本地 DNS 时拒绝
+	svc.ForbidLocalDNS = true
+	if _, _, err := svc.ResolveTunnelTarget(&Tunnel{ID: "t3"}); err == nil {
+		t.Error("expected rejection without controller-resolved address")
+	}
+
+	// IP 字面量目标不涉及 DNS
+	svc.TargetHost = "10.9.9.9"
+	if host, _, err := svc.ResolveTunnelTarget(&Tunnel{ID: "t4"}); err != nil || host != "10.9.9.9" {
+		t.Errorf("got %s (%v), want literal 10.9.9.9", host, err)
+	}
+}
+
+func TestServiceConfig_ValidateResolution(t *testing.T) {
+	svc := &ServiceConfig{ServiceID: "db", TargetHost: "db.internal", ForbidLocalDNS: true}
+	if err := svc.ValidateResolution(); err == nil {
+		t.Error("expected error for hostname target forbidding local DNS without controller resolution")
+	}
+
+	svc.ResolveOnController = true
+	if err := svc.ValidateResolution(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	svc = &ServiceConfig{ServiceID: "db", TargetHost: "10.0.0.5", ForbidLocalDNS: true}
+	if err := svc.ValidateResolution(); err != nil {
+		t.Errorf("unexpected error for IP target: %v", err)
+	}
+}
+
+func TestServiceConfig_EventSnapshot(t *testing.T) {
+	updated := time.Now()
+	svc := &ServiceConfig{
+		ServiceID:   "web",
+		TargetHost:  "10.0.0.8",
+		TargetPort:  8080,
+		TargetPorts: []int{8080, 8443},
+		Protocol:    "tcp",
+		Description: "long description",
+		CreatedAt:   updated.Add(-time.Hour),
+		UpdatedAt:   updated,
+		Metadata:    map[string]interface{}{"env": "prod"},
+	}
+
+	snap := svc.EventSnapshot()
+	if snap.TargetHost != "10.0.0.8" || snap.TargetPort != 8080 || snap.Protocol != "tcp" {
+		t.Errorf("target not preserved: %+v", snap)
+	}
+	if snap.Description != "" || !snap.CreatedAt.IsZero() {
+		t.Errorf("description and created_at should be dropped: %+v", snap)
+	}
+	if !snap.UpdatedAt.Equal(updated) || snap.Metadata["env"] != "prod" {
+		t.Errorf("updated_at and metadata should be kept: %+v", snap)
+	}
+
+	// 快照与原配置互不影响
+	snap.Metadata["env"] = "staging"
+	snap.TargetPorts[0] = 1
+	if svc.Metadata["env"] != "prod" || svc.TargetPorts[0] != 8080 {
+		t.Error("snapshot shares state with the original config")
+	}
+
+	if (*ServiceConfig)(nil).EventSnapshot() != nil {
+		t.Error("nil config should yield nil snapshot")
+	}
+}
@@ -32,6 +32,10 @@ type TCPProxy struct {
 	logger     logging.Logger
 	bufferSize int
 	timeout    time.Duration
+
+	listener  net.Listener
+	stopChan  chan struct{} // closed by Close: stops the cleanup goroutine and accept loop
+	closeOnce sync.Once
 }
 
 // NewTCPProxy creates a new TCP proxy
@@ -50,6 +54,7 @@ func NewTCPProxy(logger logging.Logger, bufferSize int, timeout time.Duration) *
 		logger:     logger,
 		bufferSize: bufferSize,
 		timeout:    timeout,
+		stopChan:   make(chan struct{}),
 	}
 
 	// Start cleanup goroutine for pending connections
@@ -222,7 +227,12 @@ func (p *TCPProxy) cleanupPendingConnections() {
 	ticker := time.NewTicker(10 * time.Second)
 	defer ticker.Stop()
 
-	for range ticker.C {
+	for {
+		select {
+		case <-p.stopChan:
+			return
+		case <-ticker.C:
+		}
 		now := time.Now()
 
 		p.pendingMu.Lock()
@@ -252,11 +262,20 @@ func (p *TCPProxy) Start(addr string, tlsConfig *tls.Config) error {
 	}
 	defer listener.Close()
 
+	p.tunnelsMu.Lock()
+	p.listener = listener
+	p.tunnelsMu.Unlock()
+
 	p.logger.Info("TCP proxy started", "addr", addr)
 
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
+			select {
+			case <-p.stopChan:
+				return nil
+			default:
+			}
 			p.logger.Error("Accept error", "error", err.Error())
 			continue
 		}
@@ -291,16 +310,31 @@ func (p *TCPProxy) GetStats(tunnelID string) (*TunnelStats, error) {
 	return &TunnelStats{}, nil
 }
 
-// Close stops the proxy
+// Close stops the proxy: the accept loop and cleanup goroutine exit and all
+// active and pending connections are closed. Safe to call more than once
 func (p *TCPProxy) Close() error {
+	p.closeOnce.Do(func() { close(p.stopChan) })
+
 	p.tunnelsMu.Lock()
 	defer p.tunnelsMu.Unlock()
 
+	if p.listener != nil {
+		p.listener.Close()
+	}
 	for _, tunnel := range p.tunnels {
 		tunnel.IHConn.Close()
 		tunnel.AHConn.Close()
 	}
 
+	p.pendingMu.Lock()
+	for _, tunnel := range p.pendingIH {
+		tunnel.IHConn.Close()
+	}
+	for _, tunnel := range p.pendingAH {
+		tunnel.AHConn.Close()
+	}
+	p.pendingMu.Unlock()
+
 	p.logger.Info("TCP proxy stopped")
 	return nil
 }
@@ -6,6 +6,8 @@ import (
 	"net"
 	"testing"
 	"time"
+
+	"github.com/houzhh15/sdp-common/leaktest"
 )
 
 func TestTCPProxyCreation(t *testing.T) {
@@ -303,3 +305,21 @@ func sendTunnelID(conn net.Conn, tunnelID string) error {
 	}
 	return nil
 }
+
+func TestTCPProxyCloseStopsCleanup(t *testing.T) {
+	leaktest.Check(t)
+
+	proxy := NewTCPProxy(&mockLogger{}, 0, 0)
+	ih, peer := net.Pipe()
+	defer peer.Close()
+	proxy.pendingIH["pending"] = &TunnelConnection{TunnelID: "pending", IHConn: ih, CreatedAt: time.Now()}
+
+	if err := proxy.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	// 待配对连接随 Close 关闭
+	if _, err := ih.Write([]byte("x")); err == nil {
+		t.Error("Expected pending connection to be closed")
+	}
+	proxy.Close() // 幂等
+}
@@ -0,0 +1,10 @@
+package tunnel
+
+// MetadataKeyTraceID 隧道 Metadata 中创建该隧道的请求的 trace ID（32 位十六进制，W3C Trace Context），
+// 由启用 Tracing 的 Controller 写入，中继据此为配对耗时附加 exemplar，AH 可据此延续同一链路
+const MetadataKeyTraceID = "trace_id"
+
+// TraceID 创建隧道的请求的 trace ID，未启用追踪时为空
+func (t *Tunnel) TraceID() string {
+	return t.metadataString(MetadataKeyTraceID)
+}
@@ -0,0 +1,121 @@
+package tunnel
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Timed handshake constants
+// 带时间戳的握手帧: [0xFE][version][8 字节本地连接时间 unix 纳秒, 大端][36 字节 Tunnel ID]
+// 首字节 0xFE 不可能出现在 UTF-8 Tunnel ID 中，中继据此区分普通 36 字节握手
+const (
+	TimedHandshakeMagic   byte = 0xFE
+	TimedHandshakeVersion byte = 0x01
+	TimedHandshakeLength       = 2 + 8 + TunnelIDLength
+)
+
+// TTFB 测量端
+const (
+	TTFBSideIH = "ih" // IH: 本地连接建立 → 收到目标返回的首字节
+	TTFBSideAH = "ah" // AH: 收到隧道事件 → 目标返回首字节
+)
+
+// ttfbSeconds 按服务和测量端统计的首字节时间
+// 中继侧的同类指标为 transport 包中的 tunnel_relay_ttfb_seconds
+var ttfbSeconds = promauto.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "tunnel_ttfb_seconds",
+		Help:    "Time from local connect to first byte from target, by service and measuring side",
+		Buckets: []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+	},
+	[]string{"service", "side"},
+)
+
+// EncodeTimedHandshake 编码带本地连接时间的握手帧
+func EncodeTimedHandshake(tunnelID string, connectedAt time.Time) ([]byte, error) {
+	return encodeHandshakeFrame(TimedHandshakeVersion, tunnelID, connectedAt.UnixNano())
+}
+
+// encodeHandshakeFrame 编码 0xFE 开头的扩展握手帧
+func encodeHandshakeFrame(version byte, tunnelID string, connectedAtNanos int64) ([]byte, error) {
+	if tunnelID == "" {
+		return nil, fmt.Errorf("tunnel ID cannot be empty")
+	}
+	if len(tunnelID) > TunnelIDLength {
+		return nil, fmt.Errorf("tunnel ID too long: %d bytes (max %d)", len(tunnelID), TunnelIDLength)
+	}
+
+	frame := make([]byte, TimedHandshakeLength)
+	frame[0] = TimedHandshakeMagic
+	frame[1] = version
+	binary.BigEndian.PutUint64(frame[2:10], uint64(connectedAtNanos))
+	copy(frame[10:], tunnelID)
+	return frame, nil
+}
+
+// ConnectTimed 建立数据平面连接并发送带时间戳的握手帧
+// connectedAt 为本地用户连接建立时间，中继据此计算端到端首字节时间（TTFB）
+// 需要支持带时间戳握手的 Controller；多路复用连接仍使用 Connect
+// 开启 CloseNotice 时改用关闭通知握手，同样携带连接时间
+func (c *DataPlaneClient) ConnectTimed(tunnelID string, connectedAt time.Time) (net.Conn, error) {
+	encode := EncodeTimedHandshake
+	if c.closeNotice {
+		encode = EncodeCloseNoticeHandshake
+	}
+	frame, err := encode(tunnelID, connectedAt)
+	if err != nil {
+		return nil, err
+	}
+	return c.connectFrame(frame)
+}
+
+// TTFBConn 记录首次读到数据的时间，并计入 tunnel_ttfb_seconds
+//
+// IH 包装数据平面连接（start 为本地连接建立时间），
+// AH 包装目标服务连接（start 为收到隧道事件的时间）
+type TTFBConn struct {
+	net.Conn
+	service string
+	side    string
+	start   time.Time
+
+	once sync.Once
+	ttfb time.Duration
+	mu   sync.Mutex
+}
+
+// NewTTFBConn 创建首字节计时连接；service 为空时以 "unknown" 计入指标
+func NewTTFBConn(conn net.Conn, service, side string, start time.Time) *TTFBConn {
+	if service == "" {
+		service = "unknown"
+	}
+	return &TTFBConn{Conn: conn, service: service, side: side, start: start}
+}
+
+// Read 首次读到数据时记录 TTFB
+func (c *TTFBConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.once.Do(func() {
+			ttfb := time.Since(c.start)
+			c.mu.Lock()
+			c.ttfb = ttfb
+			c.mu.Unlock()
+			ttfbSeconds.WithLabelValues(c.service, c.side).Observe(ttfb.Seconds())
+		})
+	}
+	return n, err
+}
+
+// TTFB 返回首字节时间，尚未读到数据时返回 0
+func (c *TTFBConn) TTFB() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ttfb
+}
@@ -0,0 +1,76 @@
+package tunnel
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestEncodeTimedHandshake(t *testing.T) {
+	connectedAt := time.Unix(0, 1700000000123456789)
+	frame, err := EncodeTimedHandshake("tunnel-123", connectedAt)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+
+	if len(frame) != TimedHandshakeLength {
+		t.Fatalf("frame length = %d, want %d", len(frame), TimedHandshakeLength)
+	}
+	if frame[0] != TimedHandshakeMagic || frame[1] != TimedHandshakeVersion {
+		t.Errorf("unexpected header: %x %x", frame[0], frame[1])
+	}
+	if got := int64(binary.BigEndian.Uint64(frame[2:10])); got != connectedAt.UnixNano() {
+		t.Errorf("timestamp = %d, want %d", got, connectedAt.UnixNano())
+	}
+	want := make([]byte, TunnelIDLength)
+	copy(want, "tunnel-123")
+	if !bytes.Equal(frame[10:], want) {
+		t.Errorf("tunnel ID = %q, want %q", frame[10:], want)
+	}
+
+	if _, err := EncodeTimedHandshake("", connectedAt); err == nil {
+		t.Error("expected error for empty tunnel ID")
+	}
+	if _, err := EncodeTimedHandshake(string(make([]byte, TunnelIDLength+1)), connectedAt); err == nil {
+		t.Error("expected error for oversized tunnel ID")
+	}
+}
+
+func TestTTFBConn(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	start := time.Now()
+	conn := NewTTFBConn(client, "", TTFBSideIH, start)
+	if conn.service != "unknown" {
+		t.Errorf("service = %q, want unknown", conn.service)
+	}
+	if conn.TTFB() != 0 {
+		t.Error("TTFB should be zero before first byte")
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		server.Write([]byte("first"))
+		server.Write([]byte("second"))
+	}()
+
+	buf := make([]byte, 16)
+	if _, err := conn.Read(buf); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	ttfb := conn.TTFB()
+	if ttfb < 20*time.Millisecond {
+		t.Errorf("TTFB = %v, want >= 20ms", ttfb)
+	}
+
+	if _, err := conn.Read(buf); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if conn.TTFB() != ttfb {
+		t.Error("TTFB changed after first byte")
+	}
+}
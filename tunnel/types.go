@@ -33,22 +33,43 @@ type Tunnel struct {
 	ExpiresAt  time.Time              `json:"expires_at,omitempty"`
 	Stats      *TunnelStats           `json:"stats,omitempty"`
 	Metadata   map[string]interface{} `json:"metadata,omitempty"`
+
+	// PairedAt 中继首次确认 IH 与 AH 配对的时间；FailureReason 隧道进入 failed 状态的原因（如 TunnelFailurePairingTimeout）
+	PairedAt      time.Time `json:"paired_at,omitempty"`
+	FailureReason string    `json:"failure_reason,omitempty"`
 }
 
 // ServiceConfig 服务配置（SDP 2.0 规范 0x04 消息）
 // Per SDP 2.0 Spec 3.2.1.d: AH Service Message
 // Controller 通过此消息告知 AH Agent 需要代理的服务配置
 type ServiceConfig struct {
-	ServiceID   string                 `json:"service_id"`   // 服务标识
-	ServiceName string                 `json:"service_name"` // 服务名称（可读）
-	TargetHost  string                 `json:"target_host"`  // 目标主机地址
-	TargetPort  int                    `json:"target_port"`  // 目标端口
-	Protocol    string                 `json:"protocol"`     // 协议类型（tcp/udp）
-	Description string                 `json:"description"`  // 服务描述
-	Status      ServiceStatus          `json:"status"`       // 服务状态
-	CreatedAt   time.Time              `json:"created_at"`
-	UpdatedAt   time.Time              `json:"updated_at"`
-	Metadata    map[string]interface{} `json:"metadata,omitempty"` // 额外元数据
+	ServiceID     string `json:"service_id"`               // 服务标识
+	ServiceName   string `json:"service_name"`             // 服务名称（可读）
+	TargetHost    string `json:"target_host"`              // 目标主机地址
+	TargetPort    int    `json:"target_port"`              // 目标端口
+	TargetCIDR    string `json:"target_cidr,omitempty"`    // 模式化目标网段（如 "10.2.0.0/16"），非空时忽略 TargetHost
+	TargetPorts   []int  `json:"target_ports,omitempty"`   // 模式化目标允许的端口集合
+	Protocol      string `json:"protocol"`                 // 协议类型（tcp/udp）
+	ProxyProtocol string `json:"proxy_protocol,omitempty"` // 目标连接开头写入的 PROXY protocol 头（"" 不写入，"v2"）
+	// 目标域名解析：ResolveOnController 时 Controller 在创建隧道时解析 TargetHost 并通过隧道 Metadata 下发，
+	// ForbidLocalDNS 时 AH 不得使用本地 DNS（仅使用 IP 字面量或 Controller 下发的地址）
+	ResolveOnController bool                   `json:"resolve_on_controller,omitempty"`
+	ForbidLocalDNS      bool                   `json:"forbid_local_dns,omitempty"`
+	Shadow              *ShadowConfig          `json:"shadow,omitempty"`            // 影子流量：IH→目标的数据镜像到影子目标（迁移测试）
+	UpstreamTLS         *UpstreamTLSConfig     `json:"upstream_tls,omitempty"`      // AH 以 TLS（可选客户端证书）连接目标
+	UsageAlert          *UsageAlertConfig      `json:"usage_alert,omitempty"`       // 隧道用量告警阈值（Controller 评估）
+	EndToEnd            bool                   `json:"end_to_end,omitempty"`        // 要求隧道启用端到端加密（中继只转发密文）
+	CredentialBroker    string                 `json:"credential_broker,omitempty"` // 按隧道签发临时目标凭据的 broker 名称（Controller 配置中注册）
+	RelayChain          []string               `json:"relay_chain,omitempty"`       // 多跳中继链（数据平面地址，IH 连接第一跳，AH 连接最后一跳），为空时使用 Controller 中继
+	QoSClass            string                 `json:"qos_class,omitempty"`         // 数据平面连接的 DSCP 服务等级（见 qos 包），策略可覆盖
+	Description         string                 `json:"description"`                 // 服务描述
+	Status              ServiceStatus          `json:"status"`                      // 服务状态
+	MaintenanceWindows  []MaintenanceWindow    `json:"maintenance_windows,omitempty"`
+	DisableAt           *time.Time             `json:"disable_at,omitempty"`
+	CreatedAt           time.Time              `json:"created_at"`
+	UpdatedAt           time.Time              `json:"updated_at"`
+	DeletedAt           *time.Time             `json:"deleted_at,omitempty"` // 软删除时间（仅回收站中的服务）
+	Metadata            map[string]interface{} `json:"metadata,omitempty"`   // 额外元数据
 }
 
 // ServiceStatus 服务状态
@@ -58,6 +79,9 @@ const (
 	ServiceStatusActive   ServiceStatus = "active"   // 活跃
 	ServiceStatusInactive ServiceStatus = "inactive" // 停用
 	ServiceStatusDeleted  ServiceStatus = "deleted"  // 已删除
+
+	// ServiceStatusMaintenance 维护中：拒绝新建隧道（MAINTENANCE），已有隧道不受影响
+	ServiceStatusMaintenance ServiceStatus = "maintenance"
 )
 
 // ServiceEvent 服务配置事件（用于 SSE 推送）
@@ -67,6 +91,13 @@ type ServiceEvent struct {
 	Service   *ServiceConfig         `json:"service"`
 	Timestamp time.Time              `json:"timestamp"`
 	Details   map[string]interface{} `json:"details,omitempty"`
+	// Seq 事件日志序号（SSE 事件 ID），未配置事件日志时为 0
+	Seq uint64 `json:"seq,omitempty"`
+	// Events 合并窗口内的服务事件（仅 service_bulk_updated，按服务首次出现顺序，每个服务保留最终状态）
+	Events []*ServiceEvent `json:"events,omitempty"`
+
+	// frame 广播时预编码的 SSE 帧，所有订阅者共用；nil 时发送时编码
+	frame []byte
 }
 
 // ServiceEventType 服务事件类型
@@ -76,6 +107,8 @@ const (
 	ServiceEventCreated ServiceEventType = "service_created"
 	ServiceEventUpdated ServiceEventType = "service_updated"
 	ServiceEventDeleted ServiceEventType = "service_deleted"
+	// ServiceEventBulkUpdated 合并后的批量服务事件（Notifier 配置 ServiceBatchWindow 时）
+	ServiceEventBulkUpdated ServiceEventType = "service_bulk_updated"
 )
 
 // TunnelStatus 隧道状态
@@ -86,6 +119,8 @@ const (
 	TunnelStatusActive  TunnelStatus = "active"  // 活跃
 	TunnelStatusClosed  TunnelStatus = "closed"  // 已关闭
 	TunnelStatusError   TunnelStatus = "error"   // 错误
+	// TunnelStatusFailed 创建后未在配对超时内完成 IH 与 AH 配对（原因见 FailureReason），默认不出现在隧道列表中
+	TunnelStatusFailed TunnelStatus = "failed"
 )
 
 // TunnelStats 隧道统计信息
@@ -112,6 +147,14 @@ type TunnelEvent struct {
 	Tunnel    *Tunnel                `json:"tunnel"`
 	Timestamp time.Time              `json:"timestamp"`
 	Details   map[string]interface{} `json:"details,omitempty"`
+	// Seq 事件日志序号（SSE 事件 ID），未配置事件日志时为 0
+	Seq uint64 `json:"seq,omitempty"`
+	// Service 创建事件内嵌的服务配置快照（Controller 开启 EmbedServiceInTunnelEvents 时），
+	// AH 可直接按快照拨号，不依赖服务配置同步先于隧道事件到达
+	Service *ServiceConfig `json:"service,omitempty"`
+
+	// frame 广播时预编码的 SSE 帧，所有订阅者共用；nil 时发送时编码
+	frame []byte
 }
 
 // EventType 事件类型
@@ -0,0 +1,240 @@
+package tunnel
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/houzhh15/sdp-common/cert"
+	"github.com/houzhh15/sdp-common/logging"
+)
+
+// defaultUpstreamHandshakeTimeout AH 与目标 TLS 握手的默认超时
+const defaultUpstreamHandshakeTimeout = 10 * time.Second
+
+// UpstreamTLSConfig AH → 目标的 TLS 重加密配置，用于要求 TLS（含客户端证书认证）的目标服务
+// 文件路径均为 AH 本地路径；文件更新后（证书轮换）新的目标连接自动使用新证书，已建立的连接不受影响
+type UpstreamTLSConfig struct {
+	CAFile   string `json:"ca_file,omitempty"`   // 校验目标证书的 CA（可为 bundle），为空使用系统根证书
+	CertFile string `json:"cert_file,omitempty"` // 客户端证书，目标要求客户端认证时配置
+	KeyFile  string `json:"key_file,omitempty"`  // 客户端私钥
+	// UseAgentCert 以 AH 自身的 mTLS 证书作为客户端证书，与 CertFile 互斥
+	UseAgentCert bool `json:"use_agent_cert,omitempty"`
+	// ServerName SNI 与证书校验使用的主机名，默认为 TargetHost（模式化服务为隧道目标地址）
+	ServerName string `json:"server_name,omitempty"`
+	// InsecureSkipVerify 不校验目标证书，仅用于测试环境
+	InsecureSkipVerify bool `json:"insecure_skip_verify,omitempty"`
+}
+
+// ValidateUpstreamTLS 校验目标 TLS 配置
+func (c *ServiceConfig) ValidateUpstreamTLS() error {
+	u := c.UpstreamTLS
+	if u == nil {
+		return nil
+	}
+	if (u.CertFile == "") != (u.KeyFile == "") {
+		return fmt.Errorf("upstream_tls cert_file and key_file must be set together for service %s", c.ServiceID)
+	}
+	if u.UseAgentCert && u.CertFile != "" {
+		return fmt.Errorf("upstream_tls use_agent_cert and cert_file are mutually exclusive for service %s", c.ServiceID)
+	}
+	if c.Shadow != nil {
+		return fmt.Errorf("upstream_tls cannot be combined with shadow for service %s", c.ServiceID)
+	}
+	return nil
+}
+
+// upstreamServerName 返回目标 TLS 的 SNI，固定目标服务默认使用 TargetHost（即使拨号使用 Controller 解析的 IP）
+func (c *ServiceConfig) upstreamServerName(targetHost string) string {
+	if c.UpstreamTLS.ServerName != "" {
+		return c.UpstreamTLS.ServerName
+	}
+	if !c.IsPattern() && c.TargetHost != "" {
+		return c.TargetHost
+	}
+	return targetHost
+}
+
+// UpstreamTLSDialerConfig 目标 TLS 握手配置
+type UpstreamTLSDialerConfig struct {
+	// AgentCertificate 服务启用 UseAgentCert 时出示的 AH 证书，通常为 certManager.GetCertificate；
+	// 每次握手调用，AH 证书轮换后返回新证书即可
+	AgentCertificate func() *tls.Certificate
+	// TLSPolicy 与目标握手的版本与密码套件策略，nil 使用 cert.DefaultTLSPolicy
+	TLSPolicy *cert.TLSPolicy
+	// HandshakeTimeout 握手超时（默认 10s）
+	HandshakeTimeout time.Duration
+	Logger           logging.Logger
+}
+
+// UpstreamTLSDialer AH 侧按服务配置与目标完成 TLS 握手
+// 按服务缓存 CA 与客户端证书（cert.Manager），服务配置或证书文件变化时重新加载
+type UpstreamTLSDialer struct {
+	config UpstreamTLSDialerConfig
+	policy *cert.TLSPolicy
+
+	mu     sync.Mutex
+	states map[string]*upstreamTLSState // serviceID -> 已加载的证书
+}
+
+// upstreamTLSState 服务的目标 TLS 证书材料
+type upstreamTLSState struct {
+	config  UpstreamTLSConfig
+	roots   *x509.CertPool // nil 使用系统根证书
+	manager *cert.Manager  // 客户端证书，未配置 CertFile 时为 nil
+	stamps  map[string]time.Time
+}
+
+// NewUpstreamTLSDialer 创建目标 TLS 握手器
+func NewUpstreamTLSDialer(config *UpstreamTLSDialerConfig) *UpstreamTLSDialer {
+	if config == nil {
+		config = &UpstreamTLSDialerConfig{}
+	}
+	cfg := *config
+	if cfg.HandshakeTimeout <= 0 {
+		cfg.HandshakeTimeout = defaultUpstreamHandshakeTimeout
+	}
+	policy := cfg.TLSPolicy
+	if policy == nil {
+		policy = cert.DefaultTLSPolicy()
+	}
+	return &UpstreamTLSDialer{
+		config: cfg,
+		policy: policy,
+		states: make(map[string]*upstreamTLSState),
+	}
+}
+
+// Client 服务配置了 UpstreamTLS 时在 conn 上完成 TLS 握手并返回 TLS 连接，否则原样返回 conn
+// targetHost 为隧道目标地址，仅在模式化服务未配置 ServerName 时用作 SNI；握手失败时关闭 conn
+// PROXY protocol 头须在调用前写入原始连接
+func (d *UpstreamTLSDialer) Client(ctx context.Context, service *ServiceConfig, conn net.Conn, targetHost string) (net.Conn, error) {
+	if service == nil || service.UpstreamTLS == nil {
+		return conn, nil
+	}
+	config, err := d.clientConfig(service, targetHost)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, d.config.HandshakeTimeout)
+	defer cancel()
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("upstream TLS handshake with %s: %w", config.ServerName, err)
+	}
+	return tlsConn, nil
+}
+
+// Forget 丢弃服务缓存的证书材料（服务删除时调用）
+func (d *UpstreamTLSDialer) Forget(serviceID string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.states, serviceID)
+}
+
+// clientConfig 生成本次握手的 tls.Config
+func (d *UpstreamTLSDialer) clientConfig(service *ServiceConfig, targetHost string) (*tls.Config, error) {
+	state, err := d.state(service)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		RootCAs:            state.roots,
+		ServerName:         service.upstreamServerName(targetHost),
+		InsecureSkipVerify: state.config.InsecureSkipVerify,
+	}
+	d.policy.Apply(config)
+
+	switch {
+	case state.manager != nil:
+		config.Certificates = []tls.Certificate{*state.manager.GetCertificate()}
+	case state.config.UseAgentCert:
+		if d.config.AgentCertificate == nil {
+			return nil, fmt.Errorf("service %s requires the agent certificate but none is configured", service.ServiceID)
+		}
+		config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return d.config.AgentCertificate(), nil
+		}
+	}
+	return config, nil
+}
+
+// state 返回服务的证书材料，首次使用、服务配置变化或文件更新时重新加载
+// 重新加载失败时继续使用已加载的证书并记录日志
+func (d *UpstreamTLSDialer) state(service *ServiceConfig) (*upstreamTLSState, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	current := d.states[service.ServiceID]
+	if current != nil && current.config == *service.UpstreamTLS && !current.changed() {
+		return current, nil
+	}
+
+	loaded, err := loadUpstreamTLS(service.UpstreamTLS)
+	if err != nil {
+		if current != nil && current.config == *service.UpstreamTLS {
+			if d.config.Logger != nil {
+				d.config.Logger.Warn("Failed to reload upstream TLS certificates, keeping previous",
+					"service_id", service.ServiceID, "error", err)
+			}
+			return current, nil
+		}
+		return nil, fmt.Errorf("load upstream TLS for service %s: %w", service.ServiceID, err)
+	}
+	if current != nil && d.config.Logger != nil {
+		d.config.Logger.Info("Upstream TLS certificates reloaded", "service_id", service.ServiceID)
+	}
+	d.states[service.ServiceID] = loaded
+	return loaded, nil
+}
+
+// loadUpstreamTLS 加载 CA 与客户端证书，并记录文件修改时间
+func loadUpstreamTLS(config *UpstreamTLSConfig) (*upstreamTLSState, error) {
+	state := &upstreamTLSState{config: *config, stamps: make(map[string]time.Time)}
+	for _, path := range []string{config.CAFile, config.CertFile, config.KeyFile} {
+		if path == "" {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		state.stamps[path] = info.ModTime()
+	}
+
+	if config.CAFile != "" {
+		trust, err := cert.LoadTrustStore([]string{config.CAFile}, nil)
+		if err != nil {
+			return nil, err
+		}
+		state.roots = trust.Pool()
+	}
+	if config.CertFile != "" {
+		manager, err := cert.NewManager(&cert.Config{CertFile: config.CertFile, KeyFile: config.KeyFile})
+		if err != nil {
+			return nil, err
+		}
+		state.manager = manager
+	}
+	return state, nil
+}
+
+// changed 证书文件的修改时间是否变化
+func (s *upstreamTLSState) changed() bool {
+	for path, modTime := range s.stamps {
+		info, err := os.Stat(path)
+		if err != nil || !info.ModTime().Equal(modTime) {
+			return true
+		}
+	}
+	return false
+}
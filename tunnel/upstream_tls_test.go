@@ -0,0 +1,167 @@
+package tunnel
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/houzhh15/sdp-common/testinfra"
+)
+
+// newUpstreamPKI 测试用 CA，签发目标服务端证书与 AH 客户端证书
+func newUpstreamPKI(t *testing.T) *testinfra.PKI {
+	t.Helper()
+	pki, err := testinfra.NewPKI(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pki
+}
+
+// issueUpstreamCert 签发证书（name 同时作为 CN 与 DNS SAN），返回证书及其文件路径
+func issueUpstreamCert(t *testing.T, pki *testinfra.PKI, name string) (tls.Certificate, string, string) {
+	t.Helper()
+	files, err := pki.Issue(name, name, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pair, err := tls.LoadX509KeyPair(files.CertFile, files.KeyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pair, files.CertFile, files.KeyFile
+}
+
+// startUpstreamTarget 启动要求客户端证书的 TLS 目标服务，返回地址与收到的客户端证书 CN
+func startUpstreamTarget(t *testing.T, pki *testinfra.PKI) (string, <-chan string) {
+	t.Helper()
+	serverCert, _, _ := issueUpstreamCert(t, pki, "target.internal")
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientCAs:    pki.CertPool(),
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	clients := make(chan string, 8)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			tlsConn := conn.(*tls.Conn)
+			if tlsConn.Handshake() == nil {
+				clients <- tlsConn.ConnectionState().PeerCertificates[0].Subject.CommonName
+			}
+			conn.Close()
+		}
+	}()
+	return ln.Addr().String(), clients
+}
+
+func TestServiceConfig_ValidateUpstreamTLS(t *testing.T) {
+	tests := []struct {
+		name    string
+		service ServiceConfig
+		wantErr bool
+	}{
+		{"not configured", ServiceConfig{}, false},
+		{"ca only", ServiceConfig{UpstreamTLS: &UpstreamTLSConfig{CAFile: "ca.pem"}}, false},
+		{"client cert", ServiceConfig{UpstreamTLS: &UpstreamTLSConfig{CertFile: "c.pem", KeyFile: "k.pem"}}, false},
+		{"cert without key", ServiceConfig{UpstreamTLS: &UpstreamTLSConfig{CertFile: "c.pem"}}, true},
+		{"agent cert and cert file", ServiceConfig{UpstreamTLS: &UpstreamTLSConfig{UseAgentCert: true, CertFile: "c.pem", KeyFile: "k.pem"}}, true},
+		{"with shadow", ServiceConfig{UpstreamTLS: &UpstreamTLSConfig{}, Shadow: &ShadowConfig{TargetHost: "10.0.0.2", TargetPort: 443}}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.service.ValidateUpstreamTLS(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: ValidateUpstreamTLS() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestUpstreamTLSDialer(t *testing.T) {
+	pki := newUpstreamPKI(t)
+	addr, clients := startUpstreamTarget(t, pki)
+	agentCert, _, _ := issueUpstreamCert(t, pki, "ah-agent")
+	_, certFile, keyFile := issueUpstreamCert(t, pki, "client-1")
+
+	dialer := NewUpstreamTLSDialer(&UpstreamTLSDialerConfig{
+		AgentCertificate: func() *tls.Certificate { return &agentCert },
+	})
+	// 拨号使用 IP，SNI 与证书校验使用 TargetHost
+	service := &ServiceConfig{
+		ServiceID:   "db",
+		TargetHost:  "target.internal",
+		UpstreamTLS: &UpstreamTLSConfig{CAFile: pki.CAFile, CertFile: certFile, KeyFile: keyFile},
+	}
+	connect := func(service *ServiceConfig) (string, error) {
+		raw, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn, err := dialer.Client(context.Background(), service, raw, "127.0.0.1")
+		if err != nil {
+			return "", err
+		}
+		defer conn.Close()
+		select {
+		case cn := <-clients:
+			return cn, nil
+		case <-time.After(2 * time.Second):
+			t.Fatal("target did not complete handshake")
+			return "", nil
+		}
+	}
+
+	if cn, err := connect(service); err != nil || cn != "client-1" {
+		t.Fatalf("client cert = %q, %v; want client-1", cn, err)
+	}
+
+	// 证书轮换：覆盖文件后新连接使用新证书
+	_, rotatedCert, rotatedKey := issueUpstreamCert(t, pki, "client-2")
+	for src, dst := range map[string]string{rotatedCert: certFile, rotatedKey: keyFile} {
+		data, err := os.ReadFile(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(dst, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		later := time.Now().Add(time.Minute)
+		if err := os.Chtimes(dst, later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if cn, err := connect(service); err != nil || cn != "client-2" {
+		t.Fatalf("client cert after rotation = %q, %v; want client-2", cn, err)
+	}
+
+	agentService := &ServiceConfig{
+		ServiceID:   "api",
+		TargetHost:  "target.internal",
+		UpstreamTLS: &UpstreamTLSConfig{CAFile: pki.CAFile, UseAgentCert: true},
+	}
+	if cn, err := connect(agentService); err != nil || cn != "ah-agent" {
+		t.Fatalf("agent cert = %q, %v; want ah-agent", cn, err)
+	}
+
+	// 目标证书不受信任（未配置 CA）时握手失败
+	untrusted := &ServiceConfig{ServiceID: "untrusted", TargetHost: "target.internal", UpstreamTLS: &UpstreamTLSConfig{UseAgentCert: true}}
+	if _, err := connect(untrusted); err == nil {
+		t.Error("handshake with untrusted target should fail")
+	}
+
+	// 未配置 upstream TLS 时原样返回连接
+	raw, _ := net.Dial("tcp", addr)
+	defer raw.Close()
+	if conn, err := dialer.Client(context.Background(), &ServiceConfig{ServiceID: "plain"}, raw, ""); err != nil || conn != raw {
+		t.Errorf("plain service conn = %T, %v; want raw conn", conn, err)
+	}
+}
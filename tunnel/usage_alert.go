@@ -0,0 +1,25 @@
+package tunnel
+
+import "fmt"
+
+// UsageAlertConfig 隧道用量告警阈值，由 Controller 根据中继统计（双向字节合计）评估，超过时记录安全事件并调用告警 webhook
+// 仅对经 Controller 中继的隧道生效，AH 忽略该配置
+type UsageAlertConfig struct {
+	MaxBytesPerSecond int64 `json:"max_bytes_per_second,omitempty"` // 单隧道采样间隔内的平均速率上限（0 不检查）
+	MaxTotalBytes     int64 `json:"max_total_bytes,omitempty"`      // 单隧道累计字节上限，含已断开的中继连接（0 不检查）
+}
+
+// ValidateUsageAlert 校验用量告警阈值
+func (c *ServiceConfig) ValidateUsageAlert() error {
+	a := c.UsageAlert
+	if a == nil {
+		return nil
+	}
+	if a.MaxBytesPerSecond < 0 || a.MaxTotalBytes < 0 {
+		return fmt.Errorf("usage_alert thresholds must not be negative for service %s", c.ServiceID)
+	}
+	if a.MaxBytesPerSecond == 0 && a.MaxTotalBytes == 0 {
+		return fmt.Errorf("usage_alert requires max_bytes_per_second or max_total_bytes for service %s", c.ServiceID)
+	}
+	return nil
+}